@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/archive"
+)
+
+const (
+	// exportSessionsCommand is the subcommand that exports the sessions of
+	// the session store to an encrypted archive
+	exportSessionsCommand = "export-sessions"
+	// importSessionsCommand is the subcommand that imports the sessions of an
+	// encrypted archive into the session store
+	importSessionsCommand = "import-sessions"
+)
+
+// runExportSessions runs the export-sessions subcommand with its arguments
+// and returns the exit code of the command
+func runExportSessions(args []string) int {
+	flagSet := newOptionsFlagSet(exportSessionsCommand)
+	output := flagSet.String("output", "-", "path to the archive to write, or - for the standard output")
+	if code, ok := flagSet.parse(args); !ok {
+		return code
+	}
+
+	archiver, secret, ok := loadSessionArchiver(flagSet)
+	if !ok {
+		return 1
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create the archive: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	w, err := archive.NewWriter(out, secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not export sessions: %v\n", err)
+		return 1
+	}
+	exported, err := archiver.ExportSessions(ctx, w.Write)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not export sessions after %d sessions: %v\n", exported, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d sessions\n", exported)
+	return 0
+}
+
+// runImportSessions runs the import-sessions subcommand with its arguments
+// and returns the exit code of the command
+func runImportSessions(args []string) int {
+	flagSet := newOptionsFlagSet(importSessionsCommand)
+	input := flagSet.String("input", "-", "path to the archive to read, or - for the standard input")
+	if code, ok := flagSet.parse(args); !ok {
+		return code
+	}
+
+	archiver, secret, ok := loadSessionArchiver(flagSet)
+	if !ok {
+		return 1
+	}
+
+	in := io.Reader(os.Stdin)
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open the archive: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	r, err := archive.NewReader(in, secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not import sessions: %v\n", err)
+		return 1
+	}
+	imported, err := archiver.ImportSessions(ctx, r.Read)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not import sessions after %d sessions: %v\n", imported, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d sessions\n", imported)
+	return 0
+}
+
+// loadSessionArchiver creates the session store of the configuration, and
+// returns it with the secret of the archives when it can archive sessions.
+// The problems are written to the standard error.
+func loadSessionArchiver(flagSet *optionsFlagSet) (sessionsapi.SessionArchiver, string, bool) {
+	opts, ss, err := loadSessionStore(flagSet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, "", false
+	}
+	archiver, ok := ss.(sessionsapi.SessionArchiver)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "the %s session store cannot export and import sessions\n", opts.Session.Type)
+		return nil, "", false
+	}
+	if opts.Session.Archive.Secret == "" {
+		fmt.Fprintln(os.Stderr, "exporting and importing sessions requires session_archive_secret to be set")
+		return nil, "", false
+	}
+	return archiver, opts.Session.Archive.Secret, true
+}
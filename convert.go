@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/spf13/pflag"
+)
+
+// convertConfigCommand is the subcommand that converts configuration given as
+// flags, environment variables or a legacy config file to a structured
+// config file
+const convertConfigCommand = "convert-config"
+
+// runConvertConfig runs the convert-config subcommand with its arguments and
+// returns the exit code of the command
+func runConvertConfig(args []string) int {
+	flagSet := options.NewLegacyFlagSet()
+	flagSet.Init("oauth2-proxy convert-config", pflag.ContinueOnError)
+	config := flagSet.String("config", "", "path to the config file to convert")
+	format := flagSet.String("format", "yaml", "the format of the converted config file: yaml or toml")
+
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *format != "yaml" && *format != "toml" {
+		fmt.Fprintf(os.Stderr, "unknown config format %q: expected yaml or toml\n", *format)
+		return 2
+	}
+
+	converted, err := options.ConvertConfig(*config, flagSet, options.NewLegacyOptions(), *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not convert config: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(converted); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write output: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -46,6 +46,11 @@ const sidebars = {
             'configuration/providers/nextcloud',
             'configuration/providers/digitalocean',
             'configuration/providers/bitbucket',
+            'configuration/providers/cognito',
+            'configuration/providers/discord',
+            'configuration/providers/saml',
+            'configuration/providers/slack',
+            'configuration/providers/twitch',
           ],
         },
         'configuration/session_storage',
@@ -1,21 +1,45 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/kubernetes"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/secrets"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/version"
 	"github.com/spf13/pflag"
 )
 
+// subcommands are the commands run instead of the proxy, by their name
+var subcommands = map[string]func(args []string) int{
+	probeCommand:             runProbe,
+	verifyHeadersCommand:     runVerifyHeaders,
+	testRulesCommand:         runTestRules,
+	validateCommand:          runValidate,
+	convertConfigCommand:     runConvertConfig,
+	alphaConfigSchemaCommand: runAlphaConfigSchema,
+	reapSessionsCommand:      runReapSessions,
+	exportSessionsCommand:    runExportSessions,
+	importSessionsCommand:    runImportSessions,
+}
+
 func main() {
 	logger.SetFlags(logger.Lshortfile)
 
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	configFlagSet := pflag.NewFlagSet("oauth2-proxy", pflag.ContinueOnError)
 
 	// Because we parse early to determine alpha vs legacy config, we have to
@@ -26,6 +50,7 @@ func main() {
 	alphaConfig := configFlagSet.String("alpha-config", "", "path to alpha config file (use at your own risk - the structure in this config file may change between minor releases)")
 	convertConfig := configFlagSet.Bool("convert-config-to-alpha", false, "if true, the proxy will load configuration as normal and convert existing configuration to the alpha config structure, and print it to stdout")
 	showVersion := configFlagSet.Bool("version", false, "print version string")
+	dryRun := configFlagSet.Bool("dry-run", false, "validate the configuration, as the validate subcommand does, and exit without running the proxy")
 	configFlagSet.Parse(os.Args[1:])
 
 	if *showVersion {
@@ -33,6 +58,19 @@ func main() {
 		return
 	}
 
+	if *dryRun {
+		report := validateConfiguration(func() (*options.Options, error) {
+			return loadConfiguration(*config, *alphaConfig, configFlagSet, os.Args[1:])
+		})
+		if err := report.write(os.Stdout, "text"); err != nil {
+			logger.Fatalf("ERROR: %v", err)
+		}
+		if !report.Valid {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *convertConfig && *alphaConfig != "" {
 		logger.Fatal("cannot use alpha-config and convert-config-to-alpha together")
 	}
@@ -49,11 +87,45 @@ func main() {
 		return
 	}
 
+	var controller *kubernetes.VirtualHostController
+	if opts.Kubernetes.VirtualHosts {
+		controller, err = newVirtualHostController(opts.Kubernetes)
+		if err != nil {
+			logger.Fatalf("ERROR: %v", err)
+		}
+		opts.VirtualHosts = append(opts.VirtualHosts, controller.VirtualHosts()...)
+	}
+
 	if err = validation.Validate(opts); err != nil {
 		logger.Fatalf("%s", err)
 	}
 
-	validator := NewValidator(opts.EmailDomains, opts.AuthenticatedEmailsFile)
+	var notifiers []changeNotifier
+	if controller != nil {
+		notifiers = append(notifiers, controller)
+	}
+	if opts.Cookie.SecretRef != "" {
+		// Rotations of the cookie secret are applied by reloading
+		notifiers = append(notifiers, secrets.NewWatcher(opts.Cookie.SecretRef))
+	}
+
+	if opts.ReloadConfig || len(notifiers) > 0 {
+		load := func() (*options.Options, error) {
+			loaded, err := loadConfiguration(*config, *alphaConfig, configFlagSet, os.Args[1:])
+			if err == nil && controller != nil {
+				loaded.VirtualHosts = append(loaded.VirtualHosts, controller.VirtualHosts()...)
+			}
+			return loaded, err
+		}
+		configFiles := []string{}
+		if opts.ReloadConfig {
+			configFiles = append(configFiles, *config, *alphaConfig)
+		}
+		runReloader(opts, load, notifiers, configFiles...)
+		return
+	}
+
+	validator := newValidatorFromOptions(opts, nil, func() {})
 	oauthproxy, err := NewOAuthProxy(opts, validator)
 	if err != nil {
 		logger.Fatalf("ERROR: Failed to initialise OAuth2 Proxy: %v", err)
@@ -64,6 +136,59 @@ func main() {
 	}
 }
 
+// changeNotifier runs alongside the servers and notifies of changes that
+// require the configuration to be reloaded
+type changeNotifier interface {
+	proxyhttp.Server
+	OnChange(func())
+}
+
+// runReloader runs the proxy, reloading the configuration on SIGHUP, when
+// the config files change and when the notifiers notify of a change, such as
+// the virtual hosts of the controller changing or the cookie secret being
+// rotated
+func runReloader(opts *options.Options, load func() (*options.Options, error), notifiers []changeNotifier, configFiles ...string) {
+	files := []string{}
+	for _, file := range configFiles {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	background := make([]proxyhttp.Server, 0, len(notifiers))
+	for _, notifier := range notifiers {
+		background = append(background, notifier)
+	}
+	reloader, err := newReloader(opts, load, files, background...)
+	if err != nil {
+		logger.Fatalf("ERROR: Failed to initialise OAuth2 Proxy: %v", err)
+	}
+	for _, notifier := range notifiers {
+		notifier.OnChange(reloader.requestReload)
+	}
+
+	if err := reloader.Run(); err != nil {
+		logger.Fatalf("ERROR: Failed to start OAuth2 Proxy: %v", err)
+	}
+}
+
+// newVirtualHostController creates the controller of the virtual hosts of
+// the custom resources of the cluster, once it has listed them
+func newVirtualHostController(opts options.Kubernetes) (*kubernetes.VirtualHostController, error) {
+	client, err := kubernetes.NewInClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create Kubernetes client: %v", err)
+	}
+	controller := kubernetes.NewVirtualHostController(client, opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := controller.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
 // loadConfiguration will load in the user's configuration.
 // It will either load the alpha configuration (if alphaConfig is given)
 // or the legacy configuration.
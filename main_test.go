@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -39,6 +38,7 @@ upstreamConfig:
     flushInterval: 1s
     passHostHeader: true
     proxyWebSockets: true
+    stripProxyCookies: true
     timeout: 30s
 injectRequestHeaders:
 - name: Authorization
@@ -73,6 +73,7 @@ providers:
   ID: google=oauth2-proxy
   clientSecret: b2F1dGgyLXByb3h5LWNsaWVudC1zZWNyZXQK
   clientID: oauth2-proxy
+  timeout: 30s
   azureConfig:
     tenant: common
   oidcConfig:
@@ -117,13 +118,14 @@ redirect_url="http://localhost:4180/oauth2/callback"
 		opts.UpstreamServers = options.UpstreamConfig{
 			Upstreams: []options.Upstream{
 				{
-					ID:              "/",
-					Path:            "/",
-					URI:             "http://httpbin",
-					FlushInterval:   durationPtr(options.DefaultUpstreamFlushInterval),
-					PassHostHeader:  boolPtr(true),
-					ProxyWebSockets: boolPtr(true),
-					Timeout:         durationPtr(options.DefaultUpstreamTimeout),
+					ID:                "/",
+					Path:              "/",
+					URI:               "http://httpbin",
+					FlushInterval:     durationPtr(options.DefaultUpstreamFlushInterval),
+					PassHostHeader:    boolPtr(true),
+					ProxyWebSockets:   boolPtr(true),
+					StripProxyCookies: boolPtr(true),
+					Timeout:           durationPtr(options.DefaultUpstreamTimeout),
 				},
 			},
 		}
@@ -152,6 +154,7 @@ redirect_url="http://localhost:4180/oauth2/callback"
 				Type:         "google",
 				ClientSecret: "b2F1dGgyLXByb3h5LWNsaWVudC1zZWNyZXQK",
 				ClientID:     "oauth2-proxy",
+				Timeout:      durationPtr(options.DefaultProviderTimeout),
 				AzureConfig: options.AzureOptions{
 					Tenant: "common",
 				},
@@ -178,6 +181,8 @@ redirect_url="http://localhost:4180/oauth2/callback"
 		extraFlags         func() *pflag.FlagSet
 		expectedOptions    func() *options.Options
 		expectedErr        error
+		// expectedConfigFileErr is the format of the expected error, given the config file name
+		expectedConfigFileErr string
 	}
 
 	DescribeTable("LoadConfiguration",
@@ -225,7 +230,9 @@ redirect_url="http://localhost:4180/oauth2/callback"
 			}
 
 			opts, err := loadConfiguration(configFileName, alphaConfigFileName, extraFlags, in.args)
-			if in.expectedErr != nil {
+			if in.expectedConfigFileErr != "" {
+				Expect(err).To(MatchError(fmt.Sprintf(in.expectedConfigFileErr, configFileName)))
+			} else if in.expectedErr != nil {
 				Expect(err).To(MatchError(in.expectedErr.Error()))
 			} else {
 				Expect(err).ToNot(HaveOccurred())
@@ -243,9 +250,9 @@ redirect_url="http://localhost:4180/oauth2/callback"
 			expectedOptions:    testExpectedOptions,
 		}),
 		Entry("with bad legacy configuration", loadConfigurationTableInput{
-			configContent:   testCoreConfig + "unknown_field=\"something\"",
-			expectedOptions: func() *options.Options { return nil },
-			expectedErr:     errors.New("failed to load config: error unmarshalling config: 1 error(s) decoding:\n\n* '' has invalid keys: unknown_field"),
+			configContent:         testCoreConfig + "unknown_field=\"something\"",
+			expectedOptions:       func() *options.Options { return nil },
+			expectedConfigFileErr: "failed to load config: unable to load config file: unknown option(s) in %s: unknown_field",
 		}),
 		Entry("with bad alpha configuration", loadConfigurationTableInput{
 			configContent:      testCoreConfig,
@@ -254,10 +261,10 @@ redirect_url="http://localhost:4180/oauth2/callback"
 			expectedErr:        fmt.Errorf("failed to load alpha options: error unmarshalling config: error converting YAML to JSON: yaml: line %d: did not find expected key", strings.Count(testAlphaConfig, "\n")),
 		}),
 		Entry("with alpha configuration and bad core configuration", loadConfigurationTableInput{
-			configContent:      testCoreConfig + "unknown_field=\"something\"",
-			alphaConfigContent: testAlphaConfig,
-			expectedOptions:    func() *options.Options { return nil },
-			expectedErr:        errors.New("failed to load core options: failed to load config: error unmarshalling config: 1 error(s) decoding:\n\n* '' has invalid keys: unknown_field"),
+			configContent:         testCoreConfig + "unknown_field=\"something\"",
+			alphaConfigContent:    testAlphaConfig,
+			expectedOptions:       func() *options.Options { return nil },
+			expectedConfigFileErr: "failed to load core options: failed to load config: unable to load config file: unknown option(s) in %s: unknown_field",
 		}),
 	)
 })
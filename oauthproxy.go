@@ -2,42 +2,65 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"embed"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/acme"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/admin"
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/openapi"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/redirect"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/basic"
+	upstreamauth "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/authentication/upstream"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/chaos"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/handoff"
 	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/identity"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/version"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/warmup"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ldap"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/oidcissuer"
+	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ratelimit"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/readiness"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/replay"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
 	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/whoami"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
 )
 
@@ -46,14 +69,20 @@ const (
 	schemeHTTPS     = "https"
 	applicationJSON = "application/json"
 
-	robotsPath        = "/robots.txt"
-	signInPath        = "/sign_in"
-	signOutPath       = "/sign_out"
-	oauthStartPath    = "/start"
-	oauthCallbackPath = "/callback"
-	authOnlyPath      = "/auth"
-	userInfoPath      = "/userinfo"
-	staticPathPrefix  = "/static/"
+	robotsPath         = "/robots.txt"
+	signInPath         = "/sign_in"
+	signOutPath        = "/sign_out"
+	oauthStartPath     = "/start"
+	oauthCallbackPath  = "/callback"
+	authOnlyPath       = "/auth"
+	userInfoPath       = "/userinfo"
+	whoAmIPath         = "/whoami"
+	upstreamLogoutPath = "/upstream_logout"
+	handoffPath        = "/handoff"
+	handoffStartPath   = "/handoff/start"
+	handoffRedeemPath  = "/handoff/redeem"
+	readyPath          = "/ready"
+	staticPathPrefix   = "/static/"
 )
 
 var (
@@ -63,6 +92,14 @@ var (
 	// ErrAccessDenied means the user should receive a 401 Unauthorized response
 	ErrAccessDenied = errors.New("access denied")
 
+	// ErrStepUpRequired means the user should sign in again with a stronger
+	// authentication
+	ErrStepUpRequired = errors.New("step up authentication required")
+
+	// ErrInsufficientScope means the user should grant the access token of
+	// their session more scopes
+	ErrInsufficientScope = errors.New("insufficient scope")
+
 	//go:embed static/*
 	staticFiles embed.FS
 )
@@ -72,12 +109,38 @@ type allowedRoute struct {
 	method    string
 	negate    bool
 	pathRegex *regexp.Regexp
+
+	// The conditions, precedence and dry run mode of skip auth routes
+	headers  []options.SkipAuthHeader
+	networks *ip.NetSet
+	priority int
+	dryRun   bool
+	rule     string
 }
 
 type apiRoute struct {
 	pathRegex *regexp.Regexp
 }
 
+// authRoute sets the authentication mode of requests matching the route,
+// and/or how they are answered when they need a sign in
+type authRoute struct {
+	mode  options.AuthMode
+	login options.LoginAction
+	route allowedRoute
+}
+
+// stepUpRoute requires a stronger authentication from the sessions of
+// requests matching the route
+type stepUpRoute struct {
+	id        int
+	acrValues []string
+	mfa       bool
+	maxAge    time.Duration
+	route     allowedRoute
+	rule      string
+}
+
 // OAuthProxy is the main authentication proxy
 type OAuthProxy struct {
 	CookieOptions *options.Cookie
@@ -87,65 +150,196 @@ type OAuthProxy struct {
 
 	allowedRoutes        []allowedRoute
 	apiRoutes            []apiRoute
+	authRoutes           []authRoute
+	stepUpRoutes         []stepUpRoute
 	redirectURL          *url.URL // the url to receive requests at
 	relativeRedirectURL  bool
+	extraRedirectURLs    []*url.URL
+	providerRedirectURLs map[string][]*url.URL
 	whitelistDomains     []string
 	provider             providers.Provider
+	providerSet          *providers.ProviderSet
 	sessionStore         sessionsapi.SessionStore
 	ProxyPrefix          string
 	basicAuthValidator   basic.Validator
+	basicAuthLockout     *basic.Lockout
+	htpasswdDone         chan bool
+	ldapAuthorizer       *ldap.Authorizer
 	basicAuthGroups      []string
 	SkipProviderButton   bool
 	skipAuthPreflight    bool
 	skipJwtBearerTokens  bool
 	forceJSONErrors      bool
+	jsonErrors           options.JSONErrors
 	allowQuerySemicolons bool
 	realClientIPParser   ipapi.RealClientIPParser
 	trustedIPs           *ip.NetSet
+	identityNormalizer   *identity.Normalizer
 
 	sessionChain      alice.Chain
 	headersChain      alice.Chain
 	preAuthChain      alice.Chain
+	authRateLimit     alice.Chain
+	proxyRateLimit    alice.Chain
 	pageWriter        pagewriter.Writer
 	server            proxyhttp.Server
 	upstreamProxy     http.Handler
+	stopUpstreams     func()
+	upstreamScopes    func(*http.Request) []string
+	adminHandler      http.Handler
+	virtualHosts      []virtualHost
 	serveMux          *mux.Router
 	redirectValidator redirect.Validator
 	appDirector       redirect.AppDirector
+	openAPIDocument   *openapi.Document
+	sessionRefresh    proxyhttp.Server
+	sessionReaper     proxyhttp.Server
+	warmUp            *warmup.WarmUp
+	readiness         *readiness.Checker
+	handoff           *handoff.Codec
+	handoffDomains    []string
+	handoffURL        *url.URL
+	oidcIssuer        *oidcissuer.Issuer
+
+	whoAmIEnabled      bool
+	whoAmIRedactClaims []string
+
+	upstreamLogoutAuthenticator *upstreamauth.Authenticator
 
 	encodeState bool
+	// usedStates is set when OAuth states are signed, remembering the states
+	// that have finished an authentication flow
+	usedStates *replay.Cache
 }
 
 // NewOAuthProxy creates a new instance of OAuthProxy from the options provided
 func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthProxy, error) {
-	sessionStore, err := sessions.NewSessionStore(&opts.Session, &opts.Cookie)
+	injectProviderFaults(opts)
+	p, err := newOAuthProxy(opts, validator, newProcessState())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.setupServer(opts); err != nil {
+		return nil, fmt.Errorf("error setting up server: %v", err)
+	}
+
+	return p, nil
+}
+
+// processState is the state of the proxy that outlives the OAuthProxy built
+// from each configuration, so that it is kept when the configuration is
+// reloaded
+type processState struct {
+	// usedStates remembers the signed OAuth states that have finished an
+	// authentication flow
+	usedStates *replay.Cache
+	// redeemedHandoffCodes remembers the handoff codes that have been
+	// redeemed
+	redeemedHandoffCodes *replay.Cache
+	// redeemedIssuerCodes remembers the authorization codes of the OIDC
+	// issuer that have been redeemed
+	redeemedIssuerCodes *replay.Cache
+}
+
+func newProcessState() *processState {
+	return &processState{
+		usedStates:           replay.New(),
+		redeemedHandoffCodes: replay.New(),
+		redeemedIssuerCodes:  replay.New(),
+	}
+}
+
+// injectProviderFaults injects the provider faults of the chaos options into
+// the global HTTP clients. The clients are only wrapped once, and the fault
+// is replaced when the configuration is reloaded.
+func injectProviderFaults(opts *options.Options) {
+	fault := chaos.ProviderFault(opts.Chaos)
+	if fault.Enabled() {
+		logger.Printf("WARNING: injecting faults into provider requests: %+v", fault)
+	}
+	chaos.InjectProviderFaults(fault)
+}
+
+// newOAuthProxy creates the OAuthProxy serving the requests, without the
+// servers listening for them, so that it can replace the OAuthProxy of a
+// running server when the configuration is reloaded
+func newOAuthProxy(opts *options.Options, validator func(string) bool, state *processState) (*OAuthProxy, error) {
+	sessionOpts := opts.Session
+	sessionOpts.Index = adminServerEnabled(opts)
+	sessionStore, err := sessions.NewSessionStore(&sessionOpts, &opts.Cookie)
 	if err != nil {
 		return nil, fmt.Errorf("error initialising session store: %v", err)
 	}
+	var adminHandler http.Handler
+	if sessionOpts.Index {
+		sessionAdmin, ok := sessionStore.(sessionsapi.SessionAdmin)
+		if !ok {
+			return nil, errors.New("the admin server requires a session store that can list its sessions")
+		}
+		adminHandler = admin.NewHandler(sessionAdmin, opts.Session.Archive.Secret)
+	}
+	refresher, _ := sessionStore.(sessionsapi.BackgroundRefresher)
+	reaper, _ := sessionStore.(sessionsapi.SessionReaper)
+	if fault := chaos.SessionStoreFault(opts.Chaos); fault.Enabled() {
+		logger.Printf("WARNING: injecting faults into the session store: %+v", fault)
+		sessionStore = chaos.NewSessionStore(fault, sessionStore)
+	}
+
+	var ldapAuthorizer *ldap.Authorizer
+	if opts.LDAP.Enabled() {
+		ldapAuthorizer, err = ldap.NewAuthorizer(opts.LDAP)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising LDAP authorization: %v", err)
+		}
+		logger.Printf("authorizing emails by their users in LDAP directory %s", opts.LDAP.URL)
+		emailValidator := validator
+		validator = func(email string) bool {
+			return emailValidator(email) || ldapAuthorizer.IsMember(email)
+		}
+	}
 
 	var basicAuthValidator basic.Validator
-	if opts.HtpasswdFile != "" {
-		logger.Printf("using htpasswd file: %s", opts.HtpasswdFile)
+	var basicAuthLockout *basic.Lockout
+	htpasswdDone := make(chan bool)
+	if opts.HtpasswdEnabled() {
 		var err error
-		basicAuthValidator, err = basic.NewHTPasswdValidator(opts.HtpasswdFile)
+		if opts.HtpasswdFile != "" {
+			logger.Printf("using htpasswd file: %s", opts.HtpasswdFile)
+			basicAuthValidator, err = basic.NewHTPasswdValidator(opts.HtpasswdFile, htpasswdDone, opts.HtpasswdBcryptMinCost)
+		} else {
+			logger.Printf("using htpasswd entries of environment variable: %s", opts.HtpasswdEnv)
+			basicAuthValidator, err = basic.NewHTPasswdValidatorFromEnv(opts.HtpasswdEnv, opts.HtpasswdBcryptMinCost)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("could not validate htpasswd: %v", err)
 		}
+		basicAuthLockout = basic.NewLockout(opts.HtpasswdLockout, func(req *http.Request) string {
+			return ip.GetClientString(opts.GetRealClientIPParser(), req, false)
+		})
 	}
 
-	provider, err := providers.NewProvider(opts.Providers[0])
+	providerSet, err := providers.NewProviderSet(opts.Providers)
 	if err != nil {
 		return nil, fmt.Errorf("error initialising provider: %v", err)
 	}
+	provider := providerSet.Default()
 
+	staticAssets, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, fmt.Errorf("error loading static assets: %v", err)
+	}
 	pageWriter, err := pagewriter.NewWriter(pagewriter.Opts{
 		TemplatesPath:    opts.Templates.Path,
+		TranslationsPath: opts.Templates.TranslationsPath,
+		StaticAssets:     staticAssets,
 		CustomLogo:       opts.Templates.CustomLogo,
 		ProxyPrefix:      opts.ProxyPrefix,
 		Footer:           opts.Templates.Footer,
 		Version:          version.VERSION,
 		Debug:            opts.Templates.Debug,
 		ProviderName:     buildProviderName(provider, opts.Providers[0].Name),
+		Providers:        buildSignInProviders(providerSet),
 		SignInMessage:    buildSignInMessage(opts),
 		DisplayLoginForm: basicAuthValidator != nil && opts.Templates.DisplayLoginForm,
 	})
@@ -153,10 +347,17 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		return nil, fmt.Errorf("error initialising page writer: %v", err)
 	}
 
-	upstreamProxy, err := upstream.NewProxy(opts.UpstreamServers, opts.GetSignatureData(), pageWriter)
+	if fault := chaos.UpstreamFault(opts.Chaos); fault.Enabled() {
+		logger.Printf("WARNING: injecting faults into upstream requests: %+v", fault)
+	}
+	upstreamProxy, upstreamChecks, stopUpstreams, upstreamScopes, err := buildUpstreamProxy(opts, opts.UpstreamServers, providerSet, pageWriter)
 	if err != nil {
 		return nil, fmt.Errorf("error initialising upstream proxy: %v", err)
 	}
+	virtualHosts, err := buildVirtualHosts(opts, providerSet, pageWriter)
+	if err != nil {
+		return nil, err
+	}
 
 	if opts.SkipJwtBearerTokens {
 		logger.Printf("Skipping JWT tokens from configured OIDC issuer: %q", opts.Providers[0].OIDCConfig.IssuerURL)
@@ -169,7 +370,18 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		redirectURL.Path = fmt.Sprintf("%s/callback", opts.ProxyPrefix)
 	}
 
-	logger.Printf("OAuthProxy configured for %s Client ID: %s", provider.Data().ProviderName, opts.Providers[0].ClientID)
+	extraRedirectURLs, err := parseRedirectURLs(opts.ExtraRedirectURLs)
+	if err != nil {
+		return nil, err
+	}
+	providerRedirectURLs := make(map[string][]*url.URL)
+	for _, providerConfig := range opts.Providers {
+		logger.Printf("OAuthProxy configured for %s Client ID: %s", providerSet.Name(providerConfig.ID), providerConfig.ClientID)
+		providerRedirectURLs[providerConfig.ID], err = parseRedirectURLs(providerConfig.RedirectURLs)
+		if err != nil {
+			return nil, err
+		}
+	}
 	refresh := "disabled"
 	if opts.Cookie.Refresh != time.Duration(0) {
 		refresh = fmt.Sprintf("after %s", opts.Cookie.Refresh)
@@ -177,13 +389,9 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 
 	logger.Printf("Cookie settings: name:%s secure(https):%v httponly:%v expiry:%s domains:%s path:%s samesite:%s refresh:%s", opts.Cookie.Name, opts.Cookie.Secure, opts.Cookie.HTTPOnly, opts.Cookie.Expire, strings.Join(opts.Cookie.Domains, ","), opts.Cookie.Path, opts.Cookie.SameSite, refresh)
 
-	trustedIPs := ip.NewNetSet()
-	for _, ipStr := range opts.TrustedIPs {
-		if ipNet := ip.ParseIPNet(ipStr); ipNet != nil {
-			trustedIPs.AddIPNet(*ipNet)
-		} else {
-			return nil, fmt.Errorf("could not parse IP network (%s)", ipStr)
-		}
+	trustedIPs, err := buildTrustedIPs(opts)
+	if err != nil {
+		return nil, err
 	}
 
 	allowedRoutes, err := buildRoutesAllowlist(opts)
@@ -196,15 +404,38 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		return nil, err
 	}
 
-	preAuthChain, err := buildPreAuthChain(opts, sessionStore)
+	authRoutes, err := buildAuthRoutes(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stepUpRoutes, err := buildStepUpRoutes(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	warmUp := buildWarmUp(opts, providerSet, sessionStore)
+	preAuthChain, err := buildPreAuthChain(opts, sessionStore, warmUp)
 	if err != nil {
 		return nil, fmt.Errorf("could not build pre-auth chain: %v", err)
 	}
-	sessionChain := buildSessionChain(opts, provider, sessionStore, basicAuthValidator)
+	identityNormalizer, err := identity.NewNormalizer(opts.IdentityNormalization)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising identity normalization: %v", err)
+	}
+	sessionChain := buildSessionChain(opts, providerSet, sessionStore, basicAuthValidator, basicAuthLockout, identityNormalizer)
 	headersChain, err := buildHeadersChain(opts)
 	if err != nil {
 		return nil, fmt.Errorf("could not build headers chain: %v", err)
 	}
+	authRateLimit, err := buildRateLimitChain(opts, pageWriter, "auth", opts.RateLimit.AuthRequests)
+	if err != nil {
+		return nil, fmt.Errorf("could not build auth rate limit: %v", err)
+	}
+	proxyRateLimit, err := buildRateLimitChain(opts, pageWriter, "proxy", opts.RateLimit.ProxyRequests)
+	if err != nil {
+		return nil, fmt.Errorf("could not build proxy rate limit: %v", err)
+	}
 
 	redirectValidator := redirect.NewValidator(opts.WhitelistDomains)
 	appDirector := redirect.NewAppDirector(redirect.AppDirectorOpts{
@@ -220,10 +451,15 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 
 		ProxyPrefix:          opts.ProxyPrefix,
 		provider:             provider,
+		providerSet:          providerSet,
 		sessionStore:         sessionStore,
 		redirectURL:          redirectURL,
 		relativeRedirectURL:  opts.RelativeRedirectURL,
+		extraRedirectURLs:    extraRedirectURLs,
+		providerRedirectURLs: providerRedirectURLs,
 		apiRoutes:            apiRoutes,
+		authRoutes:           authRoutes,
+		stepUpRoutes:         stepUpRoutes,
 		allowedRoutes:        allowedRoutes,
 		whitelistDomains:     opts.WhitelistDomains,
 		skipAuthPreflight:    opts.SkipAuthPreflight,
@@ -231,25 +467,73 @@ func NewOAuthProxy(opts *options.Options, validator func(string) bool) (*OAuthPr
 		realClientIPParser:   opts.GetRealClientIPParser(),
 		SkipProviderButton:   opts.SkipProviderButton,
 		forceJSONErrors:      opts.ForceJSONErrors,
+		jsonErrors:           opts.JSONErrors,
 		allowQuerySemicolons: opts.AllowQuerySemicolons,
 		trustedIPs:           trustedIPs,
+		identityNormalizer:   identityNormalizer,
 
 		basicAuthValidator: basicAuthValidator,
+		basicAuthLockout:   basicAuthLockout,
+		htpasswdDone:       htpasswdDone,
+		ldapAuthorizer:     ldapAuthorizer,
 		basicAuthGroups:    opts.HtpasswdUserGroups,
 		sessionChain:       sessionChain,
 		headersChain:       headersChain,
 		preAuthChain:       preAuthChain,
+		authRateLimit:      authRateLimit,
+		proxyRateLimit:     proxyRateLimit,
 		pageWriter:         pageWriter,
 		upstreamProxy:      upstreamProxy,
+		stopUpstreams:      stopUpstreams,
+		upstreamScopes:     upstreamScopes,
+		adminHandler:       adminHandler,
+		virtualHosts:       virtualHosts,
 		redirectValidator:  redirectValidator,
 		appDirector:        appDirector,
+		openAPIDocument:    openapi.NewProxyDocument(opts),
+		whoAmIEnabled:      opts.WhoAmI.Enabled,
+		whoAmIRedactClaims: opts.WhoAmI.RedactClaims,
 		encodeState:        opts.EncodeState,
+		warmUp:             warmUp,
+		readiness:          buildReadinessChecker(opts, sessionStore, warmUp, upstreamChecks, virtualHosts),
 	}
-	p.buildServeMux(opts.ProxyPrefix)
-
-	if err := p.setupServer(opts); err != nil {
-		return nil, fmt.Errorf("error setting up server: %v", err)
+	if opts.SignedState {
+		p.usedStates = state.usedStates
+	}
+	if opts.Handoff.Secret != "" {
+		p.handoff, err = handoff.NewCodec(opts.Handoff, state.redeemedHandoffCodes)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising session handoff: %v", err)
+		}
+		p.handoffDomains = opts.Handoff.AllowedDomains
+		if opts.Handoff.URL != "" {
+			p.handoffURL, err = url.Parse(opts.Handoff.URL)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing handoff url: %v", err)
+			}
+		}
+	}
+	if opts.OIDCIssuer.Enabled() {
+		p.oidcIssuer, err = oidcissuer.New(opts.OIDCIssuer, opts.ProxyPrefix, opts.Cookie.GetEncryptionKey(), state.redeemedIssuerCodes)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising oidc issuer: %v", err)
+		}
+	}
+	if opts.UpstreamLogout.Enabled() {
+		p.upstreamLogoutAuthenticator, err = upstreamauth.NewAuthenticator(opts.UpstreamLogout)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising upstream logout: %v", err)
+		}
+	}
+	if opts.Session.Refresh.BeforeExpiry > 0 && refresher != nil {
+		logger.Printf("Refreshing sessions in the background %s before they expire", opts.Session.Refresh.BeforeExpiry)
+		p.sessionRefresh = &backgroundSessionRefresh{refresher: refresher, providers: providerSet}
+	}
+	if opts.Session.Reaper.Interval > 0 && reaper != nil {
+		logger.Printf("Reaping expired and orphaned sessions every %s", opts.Session.Reaper.Interval)
+		p.sessionReaper = &backgroundSessionReaper{reaper: reaper, interval: opts.Session.Reaper.Interval}
 	}
+	p.buildServeMux(opts.ProxyPrefix)
 
 	return p, nil
 }
@@ -261,6 +545,12 @@ func (p *OAuthProxy) Start() error {
 		panic("server has not been initialised")
 	}
 
+	return startServer(p.server)
+}
+
+// startServer runs the server until the process is interrupted, terminated
+// or upgraded
+func startServer(server proxyhttp.Server) error {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Observe signals in background goroutine.
@@ -270,16 +560,135 @@ func (p *OAuthProxy) Start() error {
 		<-sigint
 		cancel() // cancel the context
 	}()
+	go upgradeOnSignal(ctx, cancel)
+
+	if err := proxyhttp.NotifyReady(); err != nil {
+		logger.Errorf("Error notifying readiness: %v", err)
+	}
+	return server.Start(ctx)
+}
+
+// backgroundSessionRefresh runs the session store's background refresh
+// alongside the servers
+type backgroundSessionRefresh struct {
+	refresher sessionsapi.BackgroundRefresher
+	providers *providers.ProviderSet
+}
+
+// Start refreshes sessions with their providers until the context is cancelled
+func (b *backgroundSessionRefresh) Start(ctx context.Context) error {
+	return b.refresher.RefreshInBackground(ctx, func(ctx context.Context, s *sessionsapi.SessionState) (bool, error) {
+		refreshed, err := b.providers.RefreshSession(ctx, s)
+		if errors.Is(err, providers.ErrNotImplemented) {
+			// The provider cannot refresh sessions
+			return false, nil
+		}
+		return refreshed, err
+	})
+}
 
-	return p.server.Start(ctx)
+// backgroundSessionReaper reaps the session store's expired and orphaned
+// sessions periodically, alongside the servers
+type backgroundSessionReaper struct {
+	reaper   sessionsapi.SessionReaper
+	interval time.Duration
+}
+
+// Start reaps the sessions every interval until the context is cancelled
+func (b *backgroundSessionReaper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		result, err := b.reaper.ReapSessions(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("Error reaping sessions: %v", err)
+		}
+		if result.Expired > 0 || result.Orphaned > 0 {
+			logger.Printf("Reaped %d expired and %d orphaned sessions", result.Expired, result.Orphaned)
+		}
+	}
 }
 
 func (p *OAuthProxy) setupServer(opts *options.Options) error {
+	server, err := buildServer(opts, p, p.adminHandler, p.backgroundServers()...)
+	if err != nil {
+		return err
+	}
+	p.server = server
+	return nil
+}
+
+// backgroundServers are the tasks of the proxy running alongside its servers
+func (p *OAuthProxy) backgroundServers() []proxyhttp.Server {
+	servers := []proxyhttp.Server{}
+	if p.sessionRefresh != nil {
+		servers = append(servers, p.sessionRefresh)
+	}
+	if p.sessionReaper != nil {
+		servers = append(servers, p.sessionReaper)
+	}
+	if p.warmUp != nil {
+		servers = append(servers, p.warmUp)
+	}
+	return servers
+}
+
+// stop releases the resources of a proxy that has been replaced, once the
+// requests it is serving no longer need them
+func (p *OAuthProxy) stop() {
+	p.stopUpstreams()
+	if closer, ok := p.sessionStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Errorf("Error closing the session store: %v", err)
+		}
+	}
+	if p.htpasswdDone != nil {
+		close(p.htpasswdDone)
+	}
+	if p.ldapAuthorizer != nil {
+		p.ldapAuthorizer.Close()
+	}
+	for _, virtualHost := range p.virtualHosts {
+		if virtualHost.stopUpstreams != nil {
+			virtualHost.stopUpstreams()
+		}
+	}
+}
+
+// adminServerEnabled returns whether the admin server listens on an address
+func adminServerEnabled(opts *options.Options) bool {
+	if len(opts.AdminServer.Listeners) > 0 {
+		return true
+	}
+	for _, address := range []string{opts.AdminServer.BindAddress, opts.AdminServer.SecureBindAddress} {
+		if address != "" && address != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildServer builds the app and metrics servers of the proxy, serving the
+// requests with the handler, and the admin server, serving the admin API
+// with the adminHandler when it is enabled. The background servers run
+// alongside them.
+func buildServer(opts *options.Options, handler, adminHandler http.Handler, background ...proxyhttp.Server) (proxyhttp.Server, error) {
 	serverOpts := proxyhttp.Opts{
-		Handler:           p,
+		Handler:           handler,
 		BindAddress:       opts.Server.BindAddress,
 		SecureBindAddress: opts.Server.SecureBindAddress,
 		TLS:               opts.Server.TLS,
+		RequestClientCert: opts.UpstreamLogout.ClientCAFile != "",
+		HTTP2:             opts.Server.HTTP2,
+		ProxyProtocol:     opts.Server.ProxyProtocol,
+		Listeners:         opts.Server.Listeners,
 	}
 
 	// Option: AllowQuerySemicolons
@@ -287,23 +696,75 @@ func (p *OAuthProxy) setupServer(opts *options.Options) error {
 		serverOpts.Handler = http.AllowQuerySemicolons(serverOpts.Handler)
 	}
 
+	if opts.ACME.Enabled {
+		manager, err := acme.NewManager(opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not build acme certificate manager: %v", err)
+		}
+		serverOpts.GetCertificate = manager.GetCertificate
+		serverOpts.NextProtos = []string{acme.ALPNProto}
+		// HTTP-01 challenges are answered on the HTTP server
+		serverOpts.Handler = manager.HTTPHandler(serverOpts.Handler)
+	}
+
 	appServer, err := proxyhttp.NewServer(serverOpts)
 	if err != nil {
-		return fmt.Errorf("could not build app server: %v", err)
+		return nil, fmt.Errorf("could not build app server: %v", err)
+	}
+
+	metricsHandler := middleware.DefaultMetricsHandler
+	if opts.MetricsServer.Auth != nil {
+		metricsAuth, err := middleware.NewServerAuth(opts.MetricsServer.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("could not build metrics server auth: %v", err)
+		}
+		metricsHandler = metricsAuth(metricsHandler)
 	}
 
 	metricsServer, err := proxyhttp.NewServer(proxyhttp.Opts{
-		Handler:           middleware.DefaultMetricsHandler,
+		Handler:           metricsHandler,
 		BindAddress:       opts.MetricsServer.BindAddress,
 		SecureBindAddress: opts.MetricsServer.SecureBindAddress,
 		TLS:               opts.MetricsServer.TLS,
+		RequestClientCert: opts.MetricsServer.Auth != nil && opts.MetricsServer.Auth.ClientCA != nil,
+		Listeners:         opts.MetricsServer.Listeners,
 	})
 	if err != nil {
-		return fmt.Errorf("could not build metrics server: %v", err)
+		return nil, fmt.Errorf("could not build metrics server: %v", err)
 	}
 
-	p.server = proxyhttp.NewServerGroup(appServer, metricsServer)
-	return nil
+	servers := []proxyhttp.Server{appServer, metricsServer}
+	if adminHandler != nil {
+		adminServer, err := buildAdminServer(opts.AdminServer, adminHandler)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, adminServer)
+	}
+	servers = append(servers, background...)
+	return proxyhttp.NewServerGroup(servers...), nil
+}
+
+// buildAdminServer builds the server of the admin API, which clients must
+// authenticate to
+func buildAdminServer(opts options.Server, adminHandler http.Handler) (proxyhttp.Server, error) {
+	adminAuth, err := middleware.NewServerAuth(opts.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("could not build admin server auth: %v", err)
+	}
+
+	adminServer, err := proxyhttp.NewServer(proxyhttp.Opts{
+		Handler:           adminAuth(adminHandler),
+		BindAddress:       opts.BindAddress,
+		SecureBindAddress: opts.SecureBindAddress,
+		TLS:               opts.TLS,
+		RequestClientCert: opts.Auth.ClientCA != nil,
+		Listeners:         opts.Listeners,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build admin server: %v", err)
+	}
+	return adminServer, nil
 }
 
 func (p *OAuthProxy) buildServeMux(proxyPrefix string) {
@@ -311,7 +772,7 @@ func (p *OAuthProxy) buildServeMux(proxyPrefix string) {
 	// Otherwise something like /%2F/ would be redirected to / here already.
 	r := mux.NewRouter().UseEncodedPath()
 	// Everything served by the router must go through the preAuthChain first.
-	r.Use(p.preAuthChain.Then)
+	r.Use(p.preAuthChain.Then, p.scopeVirtualHost)
 
 	// Register the robots path writer
 	r.Path(robotsPath).HandlerFunc(p.pageWriter.WriteRobotsTxt)
@@ -327,7 +788,7 @@ func (p *OAuthProxy) buildServeMux(proxyPrefix string) {
 
 	// Register serveHTTP last so it catches anything that isn't already caught earlier.
 	// Anything that got to this point needs to have a session loaded.
-	r.PathPrefix("/").Handler(p.sessionChain.ThenFunc(p.Proxy))
+	r.PathPrefix("/").Handler(p.sessionChain.Extend(p.proxyRateLimit).ThenFunc(p.Proxy))
 	p.serveMux = r
 }
 
@@ -335,21 +796,163 @@ func (p *OAuthProxy) buildProxySubrouter(s *mux.Router) {
 	s.Use(prepareNoCacheMiddleware)
 
 	s.Path(signInPath).HandlerFunc(p.SignIn)
-	s.Path(oauthStartPath).HandlerFunc(p.OAuthStart)
-	s.Path(oauthCallbackPath).HandlerFunc(p.OAuthCallback)
+	s.Path(oauthStartPath).Handler(p.authRateLimit.ThenFunc(p.OAuthStart))
+	s.Path(oauthCallbackPath).Handler(p.authRateLimit.ThenFunc(p.OAuthCallback))
+	s.Path(openapi.Path).Handler(openapi.Handler(p.openAPIDocument))
+	s.Path(readyPath).Handler(p.readiness)
 
 	// Static file paths
-	s.PathPrefix(staticPathPrefix).Handler(http.StripPrefix(p.ProxyPrefix, http.FileServer(http.FS(staticFiles))))
+	s.PathPrefix(staticPathPrefix).HandlerFunc(p.pageWriter.WriteStaticAsset)
 
 	// The userinfo and logout endpoints needs to load sessions before handling the request
 	s.Path(userInfoPath).Handler(p.sessionChain.ThenFunc(p.UserInfo))
 	s.Path(signOutPath).Handler(p.sessionChain.ThenFunc(p.SignOut))
+	if p.whoAmIEnabled {
+		s.Path(whoAmIPath).Handler(p.sessionChain.ThenFunc(p.WhoAmI))
+	}
+	if p.upstreamLogoutAuthenticator != nil {
+		s.Path(upstreamLogoutPath).HandlerFunc(p.UpstreamLogout)
+	}
+
+	if p.handoff != nil {
+		if p.handoffURL != nil {
+			s.Path(handoffStartPath).HandlerFunc(p.HandoffStart)
+			s.Path(handoffRedeemPath).HandlerFunc(p.HandoffRedeem)
+		}
+		if len(p.handoffDomains) > 0 {
+			s.Path(handoffPath).Handler(p.sessionChain.ThenFunc(p.Handoff))
+		}
+	}
+
+	if p.oidcIssuer != nil {
+		s.Path(oidcissuer.DiscoveryPath).HandlerFunc(p.oidcIssuer.Discovery)
+		s.Path(oidcissuer.JWKSPath).HandlerFunc(p.oidcIssuer.JWKS)
+		s.Path(oidcissuer.TokenPath).HandlerFunc(p.oidcIssuer.Token)
+		s.Path(oidcissuer.UserInfoPath).HandlerFunc(p.oidcIssuer.UserInfo)
+		// The authorization endpoint signs users in with their session
+		s.Path(oidcissuer.AuthorizePath).Handler(p.sessionChain.ThenFunc(p.OIDCAuthorize))
+	}
+}
+
+// virtualHost is the configuration scoped to the requests made to a set of
+// hosts
+type virtualHost struct {
+	hosts           []string
+	providerID      string
+	upstreamProxy   http.Handler
+	readinessChecks []readiness.Check
+	stopUpstreams   func()
+	upstreamScopes  func(*http.Request) []string
+	cookieDomain    string
+	allowedGroups   map[string]struct{}
+}
+
+// allowsSession checks that the session user is a member of one of the
+// allowed groups of the virtual host, when it restricts them
+func (v *virtualHost) allowsSession(s *sessionsapi.SessionState) bool {
+	if len(v.allowedGroups) == 0 {
+		return true
+	}
+	for _, group := range s.Groups {
+		if _, ok := v.allowedGroups[group]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// buildUpstreamProxy creates the handler proxying authenticated requests to
+// the upstreams, the readiness checks of its load balanced upstreams, and a
+// function stopping their health checks, and a function returning the scopes
+// the upstream of a request requires.
+// Access tokens are exchanged for the audiences of upstreams with the
+// providers the sessions were created with.
+func buildUpstreamProxy(opts *options.Options, upstreams options.UpstreamConfig, providerSet *providers.ProviderSet, pageWriter pagewriter.Writer) (http.Handler, []readiness.Check, func(), func(*http.Request) []string, error) {
+	upstreamProxy, err := upstream.NewProxy(upstreams, opts.GetSignatureData(), opts.Cookie.Name, providerSet.ExchangeToken, pageWriter)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	checks := upstream.ReadinessChecks(upstreamProxy)
+	stop := func() { upstream.StopHealthChecks(upstreamProxy) }
+	proxy := upstreamProxy
+	scopes := func(req *http.Request) []string { return upstream.RequiredScopes(proxy, req) }
+	if fault := chaos.UpstreamFault(opts.Chaos); fault.Enabled() {
+		upstreamProxy = chaos.NewHandler(fault, upstreamProxy, pageWriter.ProxyErrorHandler)
+	}
+	return upstreamProxy, checks, stop, scopes, nil
+}
+
+// buildVirtualHosts creates the virtual hosts configured in the options
+func buildVirtualHosts(opts *options.Options, providerSet *providers.ProviderSet, pageWriter pagewriter.Writer) ([]virtualHost, error) {
+	virtualHosts := make([]virtualHost, 0, len(opts.VirtualHosts))
+	for i, vhostConfig := range opts.VirtualHosts {
+		vhost := virtualHost{
+			hosts:        vhostConfig.Hosts,
+			providerID:   vhostConfig.ProviderID,
+			cookieDomain: vhostConfig.CookieDomain,
+		}
+		if vhost.providerID != "" {
+			if _, ok := providerSet.Get(vhost.providerID); !ok {
+				return nil, fmt.Errorf("virtual host %d uses unknown provider %q", i, vhost.providerID)
+			}
+		}
+		if len(vhostConfig.Upstreams.Upstreams) > 0 {
+			var checks []readiness.Check
+			var err error
+			vhost.upstreamProxy, checks, vhost.stopUpstreams, vhost.upstreamScopes, err = buildUpstreamProxy(opts, vhostConfig.Upstreams, providerSet, pageWriter)
+			if err != nil {
+				return nil, fmt.Errorf("error initialising upstream proxy of virtual host %d: %v", i, err)
+			}
+			for _, check := range checks {
+				check.Name = fmt.Sprintf("virtual host %d %s", i, check.Name)
+				vhost.readinessChecks = append(vhost.readinessChecks, check)
+			}
+		}
+		if len(vhostConfig.AllowedGroups) > 0 {
+			vhost.allowedGroups = make(map[string]struct{}, len(vhostConfig.AllowedGroups))
+			for _, group := range vhostConfig.AllowedGroups {
+				vhost.allowedGroups[group] = struct{}{}
+			}
+		}
+
+		logger.Printf("Serving virtual host %s", strings.Join(vhost.hosts, ","))
+		virtualHosts = append(virtualHosts, vhost)
+	}
+	return virtualHosts, nil
+}
+
+// getVirtualHost returns the virtual host serving the request, or nil when
+// the request host does not match any virtual host
+func (p *OAuthProxy) getVirtualHost(req *http.Request) *virtualHost {
+	if len(p.virtualHosts) == 0 {
+		return nil
+	}
+	host := &url.URL{Host: requestutil.GetRequestHost(req)}
+	for i := range p.virtualHosts {
+		if util.IsEndpointAllowed(host, p.virtualHosts[i].hosts) {
+			return &p.virtualHosts[i]
+		}
+	}
+	return nil
+}
+
+// scopeVirtualHost sets the cookie domain of the virtual host serving the
+// request on the request scope
+func (p *OAuthProxy) scopeVirtualHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if vhost := p.getVirtualHost(req); vhost != nil && vhost.cookieDomain != "" {
+			if scope := middlewareapi.GetRequestScope(req); scope != nil {
+				scope.CookieDomain = vhost.cookieDomain
+			}
+		}
+		next.ServeHTTP(rw, req)
+	})
 }
 
 // buildPreAuthChain constructs a chain that should process every request before
 // the OAuth2 Proxy authentication logic kicks in.
 // For example forcing HTTPS or health checks.
-func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionStore) (alice.Chain, error) {
+func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionStore, warmUp *warmup.WarmUp) (alice.Chain, error) {
 	chain := alice.New(middleware.NewScope(opts.ReverseProxy, opts.Logging.RequestIDHeader))
 
 	if opts.ForceHTTPS {
@@ -368,19 +971,25 @@ func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionSt
 		healthCheckUserAgents = append(healthCheckUserAgents, "GoogleHC/1.0")
 	}
 
+	readyVerifiables := []middleware.Verifiable{sessionStore}
+	if warmUp != nil {
+		// Report the warm-up first, as the proxy is not ready until it finishes
+		readyVerifiables = []middleware.Verifiable{warmUp, sessionStore}
+	}
+
 	// To silence logging of health checks, register the health check handler before
 	// the logging handler
 	if opts.Logging.SilencePing {
 		chain = chain.Append(
 			middleware.NewHealthCheck(healthCheckPaths, healthCheckUserAgents),
-			middleware.NewReadynessCheck(opts.ReadyPath, sessionStore),
+			middleware.NewReadynessCheck(opts.ReadyPath, readyVerifiables...),
 			middleware.NewRequestLogger(),
 		)
 	} else {
 		chain = chain.Append(
 			middleware.NewRequestLogger(),
 			middleware.NewHealthCheck(healthCheckPaths, healthCheckUserAgents),
-			middleware.NewReadynessCheck(opts.ReadyPath, sessionStore),
+			middleware.NewReadynessCheck(opts.ReadyPath, readyVerifiables...),
 		)
 	}
 
@@ -389,12 +998,97 @@ func buildPreAuthChain(opts *options.Options, sessionStore sessionsapi.SessionSt
 	return chain, nil
 }
 
-func buildSessionChain(opts *options.Options, provider providers.Provider, sessionStore sessionsapi.SessionStore, validator basic.Validator) alice.Chain {
+// buildWarmUp builds the warm-up of the session store, the JWKS of the
+// providers and extra JWT issuers, and the DNS of the upstreams, when enabled
+func buildWarmUp(opts *options.Options, providerSet *providers.ProviderSet, sessionStore sessionsapi.SessionStore) *warmup.WarmUp {
+	if opts.WarmUpTimeout <= 0 {
+		return nil
+	}
+
+	tasks := []warmup.Task{{Name: "session store", Run: sessionStore.VerifyConnection}}
+	for _, id := range providerSet.IDs() {
+		provider, _ := providerSet.Get(id)
+		tasks = append(tasks, warmup.Task{
+			Name: fmt.Sprintf("JWKS of provider %q", id),
+			Run:  provider.Data().WarmUp,
+		})
+	}
+	for i, verifier := range opts.GetJWTBearerVerifiers() {
+		if w, ok := verifier.(interface{ WarmUp(context.Context) error }); ok {
+			tasks = append(tasks, warmup.Task{
+				Name: fmt.Sprintf("JWKS of extra JWT issuer %d", i+1),
+				Run:  w.WarmUp,
+			})
+		}
+	}
+
+	upstreamURIs := upstreamServerURIs(opts.UpstreamServers)
+	for _, virtualHost := range opts.VirtualHosts {
+		upstreamURIs = append(upstreamURIs, upstreamServerURIs(virtualHost.Upstreams)...)
+	}
+	tasks = append(tasks, warmup.ResolveHostsTask("upstream DNS", upstreamURIs))
+
+	logger.Printf("Warming up for at most %s before reporting ready", opts.WarmUpTimeout)
+	return warmup.New(opts.WarmUpTimeout, tasks...)
+}
+
+// buildReadinessChecker builds the checks of the /oauth2/ready endpoint: the
+// warm-up, the session store, the discovery endpoints of the providers and,
+// when enabled, the load balanced upstreams
+func buildReadinessChecker(opts *options.Options, sessionStore sessionsapi.SessionStore, warmUp *warmup.WarmUp, upstreamChecks []readiness.Check, virtualHosts []virtualHost) *readiness.Checker {
+	checks := []readiness.Check{}
+	if warmUp != nil {
+		checks = append(checks, readiness.Check{Name: "warm-up", Run: warmUp.VerifyConnection})
+	}
+	checks = append(checks, readiness.Check{Name: "session store", Run: sessionStore.VerifyConnection})
+
+	for _, provider := range opts.Providers {
+		if provider.OIDCConfig.IssuerURL == "" || provider.OIDCConfig.SkipDiscovery {
+			continue
+		}
+		discoveryURL := internaloidc.DiscoveryURL(provider.OIDCConfig.IssuerURL)
+		checks = append(checks, readiness.Check{
+			Name: fmt.Sprintf("provider %q discovery", provider.ID),
+			Run: func(ctx context.Context) error {
+				result := requests.New(discoveryURL).WithContext(ctx).Do()
+				if result.Error() != nil {
+					return result.Error()
+				}
+				if result.StatusCode() != http.StatusOK {
+					return fmt.Errorf("unexpected status code %d from %s", result.StatusCode(), discoveryURL)
+				}
+				return nil
+			},
+		})
+	}
+
+	if opts.ReadyUpstreams {
+		checks = append(checks, upstreamChecks...)
+		for _, vhost := range virtualHosts {
+			checks = append(checks, vhost.readinessChecks...)
+		}
+	}
+	return readiness.NewChecker(checks...)
+}
+
+// upstreamServerURIs returns the URIs of the upstreams, and of their targets
+func upstreamServerURIs(upstreams options.UpstreamConfig) []string {
+	uris := []string{}
+	for _, upstream := range upstreams.Upstreams {
+		uris = append(uris, upstream.URI)
+		for _, target := range upstream.Targets {
+			uris = append(uris, target.URI)
+		}
+	}
+	return uris
+}
+
+func buildSessionChain(opts *options.Options, providerSet *providers.ProviderSet, sessionStore sessionsapi.SessionStore, validator basic.Validator, lockout *basic.Lockout, normalizer *identity.Normalizer) alice.Chain {
 	chain := alice.New()
 
 	if opts.SkipJwtBearerTokens {
 		sessionLoaders := []middlewareapi.TokenToSessionFunc{
-			provider.CreateSessionFromToken,
+			providerSet.Default().CreateSessionFromToken,
 		}
 
 		for _, verifier := range opts.GetJWTBearerVerifiers() {
@@ -406,16 +1100,20 @@ func buildSessionChain(opts *options.Options, provider providers.Provider, sessi
 	}
 
 	if validator != nil {
-		chain = chain.Append(middleware.NewBasicAuthSessionLoader(validator, opts.HtpasswdUserGroups, opts.LegacyPreferEmailToUser))
+		chain = chain.Append(middleware.NewBasicAuthSessionLoader(validator, lockout, opts.HtpasswdUserGroups, opts.LegacyPreferEmailToUser))
 	}
 
 	chain = chain.Append(middleware.NewStoredSessionLoader(&middleware.StoredSessionLoaderOptions{
 		SessionStore:    sessionStore,
 		RefreshPeriod:   opts.Cookie.Refresh,
-		RefreshSession:  provider.RefreshSession,
-		ValidateSession: provider.ValidateSession,
+		RefreshSession:  providerSet.RefreshSession,
+		ValidateSession: providerSet.ValidateSession,
 	}))
 
+	if normalizer != nil {
+		chain = chain.Append(middleware.NewIdentityNormalizer(normalizer))
+	}
+
 	return chain
 }
 
@@ -433,6 +1131,28 @@ func buildHeadersChain(opts *options.Options) (alice.Chain, error) {
 	return alice.New(requestInjector, responseInjector), nil
 }
 
+// buildRateLimitChain constructs a chain limiting the rate of the requests
+// of each client to the number of requests per period of the options.
+// The chain is empty when the number of requests is zero.
+func buildRateLimitChain(opts *options.Options, pageWriter pagewriter.Writer, name string, requests int) (alice.Chain, error) {
+	if requests <= 0 {
+		return alice.New(), nil
+	}
+
+	key, err := ratelimit.NewKeyFunc(opts.RateLimit.Key, opts.GetRealClientIPParser())
+	if err != nil {
+		return alice.Chain{}, err
+	}
+	limiter, err := ratelimit.NewLimiter(opts.RateLimit, opts.Session.Redis, name, ratelimit.Rate{
+		Requests: requests,
+		Period:   opts.RateLimit.Period,
+	})
+	if err != nil {
+		return alice.Chain{}, err
+	}
+	return alice.New(ratelimit.NewMiddleware(limiter, key, pageWriter)), nil
+}
+
 func buildSignInMessage(opts *options.Options) string {
 	var msg string
 	if len(opts.Templates.Banner) >= 1 {
@@ -458,6 +1178,20 @@ func buildProviderName(p providers.Provider, override string) string {
 	return p.Data().ProviderName
 }
 
+// buildSignInProviders lists the providers users can choose from on the sign
+// in page. No choice is given when a single provider is configured.
+func buildSignInProviders(providerSet *providers.ProviderSet) []pagewriter.SignInProvider {
+	if len(providerSet.IDs()) < 2 {
+		return nil
+	}
+
+	signInProviders := make([]pagewriter.SignInProvider, 0, len(providerSet.IDs()))
+	for _, id := range providerSet.IDs() {
+		signInProviders = append(signInProviders, pagewriter.SignInProvider{ID: id, Name: providerSet.Name(id)})
+	}
+	return signInProviders
+}
+
 // buildRoutesAllowlist builds an []allowedRoute  list from either the legacy
 // SkipAuthRegex option (paths only support) or newer SkipAuthRoutes option
 // (method=path support)
@@ -476,31 +1210,133 @@ func buildRoutesAllowlist(opts *options.Options) ([]allowedRoute, error) {
 		})
 	}
 
-	for _, methodPath := range opts.SkipAuthRoutes {
-		var (
-			method string
-			path   string
-			negate = strings.Contains(methodPath, "!=")
-		)
+	for _, rule := range opts.SkipAuthRoutes {
+		skipAuthRoute, err := options.ParseSkipAuthRoute(rule)
+		if err != nil {
+			return nil, err
+		}
+		route, err := parseMethodPathRoute(skipAuthRoute.MethodPath)
+		if err != nil {
+			return nil, err
+		}
+		route.headers = skipAuthRoute.Headers
+		route.priority = skipAuthRoute.Priority
+		route.dryRun = skipAuthRoute.DryRun
+		route.rule = rule
+		if len(skipAuthRoute.Networks) > 0 {
+			route.networks = ip.NewNetSet()
+			for _, network := range skipAuthRoute.Networks {
+				ipNet := ip.ParseIPNet(network)
+				if ipNet == nil {
+					return nil, fmt.Errorf("could not parse IP network (%s)", network)
+				}
+				route.networks.AddIPNet(*ipNet)
+			}
+		}
+		if route.dryRun {
+			logger.Printf("Skipping auth (dry run) - Method: %s | Path: %s | Rule: %s", route.method, route.pathRegex, rule)
+		} else {
+			logger.Printf("Skipping auth - Method: %s | Path: %s | Rule: %s", route.method, route.pathRegex, rule)
+		}
+		routes = append(routes, route)
+	}
 
-		parts := regexp.MustCompile("!?=").Split(methodPath, 2)
-		if len(parts) == 1 {
-			method = ""
-			path = parts[0]
+	// Routes with a higher priority are evaluated first, routes of the same
+	// priority in the order they are configured
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].priority > routes[j].priority
+	})
+
+	return routes, nil
+}
+
+// buildTrustedIPs builds the set of the TrustedIPs networks
+func buildTrustedIPs(opts *options.Options) (*ip.NetSet, error) {
+	trustedIPs := ip.NewNetSet()
+	for _, ipStr := range opts.TrustedIPs {
+		if ipNet := ip.ParseIPNet(ipStr); ipNet != nil {
+			trustedIPs.AddIPNet(*ipNet)
 		} else {
-			method = strings.ToUpper(parts[0])
-			path = parts[1]
+			return nil, fmt.Errorf("could not parse IP network (%s)", ipStr)
 		}
+	}
+	return trustedIPs, nil
+}
 
-		compiledRegex, err := regexp.Compile(path)
+// parseMethodPathRoute parses a method=path_regex or method!=path_regex route.
+// Routes without a method match all methods.
+func parseMethodPathRoute(methodPath string) (allowedRoute, error) {
+	var (
+		method string
+		path   string
+		negate = strings.Contains(methodPath, "!=")
+	)
+
+	parts := regexp.MustCompile("!?=").Split(methodPath, 2)
+	if len(parts) == 1 {
+		method = ""
+		path = parts[0]
+	} else {
+		method = strings.ToUpper(parts[0])
+		path = parts[1]
+	}
+
+	compiledRegex, err := regexp.Compile(path)
+	if err != nil {
+		return allowedRoute{}, err
+	}
+	return allowedRoute{
+		method:    method,
+		negate:    negate,
+		pathRegex: compiledRegex,
+	}, nil
+}
+
+// buildAuthRoutes builds an []authRoute from the AuthRoutes option
+func buildAuthRoutes(opts *options.Options) ([]authRoute, error) {
+	routes := make([]authRoute, 0, len(opts.AuthRoutes))
+
+	for _, r := range opts.AuthRoutes {
+		parsed, err := options.ParseAuthRoute(r)
 		if err != nil {
 			return nil, err
 		}
-		logger.Printf("Skipping auth - Method: %s | Path: %s", method, path)
-		routes = append(routes, allowedRoute{
-			method:    method,
-			negate:    negate,
-			pathRegex: compiledRegex,
+		route, err := parseMethodPathRoute(parsed.MethodPath)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("Auth route - Mode: %s | Login: %s | Method: %s | Path: %s", parsed.Mode, parsed.Login, route.method, route.pathRegex)
+		routes = append(routes, authRoute{
+			mode:  parsed.Mode,
+			login: parsed.Login,
+			route: route,
+		})
+	}
+
+	return routes, nil
+}
+
+// buildStepUpRoutes builds a []stepUpRoute from the StepUpRoutes option
+func buildStepUpRoutes(opts *options.Options) ([]stepUpRoute, error) {
+	routes := make([]stepUpRoute, 0, len(opts.StepUpRoutes))
+
+	for i, r := range opts.StepUpRoutes {
+		stepUp, err := options.ParseStepUpRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		route, err := parseMethodPathRoute(stepUp.MethodPath)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("Step up route - ACR: %s | MFA: %t | Max age: %s | Method: %s | Path: %s", strings.Join(stepUp.ACRValues, ","), stepUp.MFA, stepUp.MaxAge, route.method, route.pathRegex)
+		routes = append(routes, stepUpRoute{
+			id:        i,
+			acrValues: stepUp.ACRValues,
+			mfa:       stepUp.MFA,
+			maxAge:    stepUp.MaxAge,
+			route:     route,
+			rule:      r,
 		})
 	}
 
@@ -557,11 +1393,13 @@ func (p *OAuthProxy) ErrorPage(rw http.ResponseWriter, req *http.Request, code i
 
 	scope := middlewareapi.GetRequestScope(req)
 	p.pageWriter.WriteErrorPage(rw, pagewriter.ErrorPageOpts{
-		Status:      code,
-		RedirectURL: redirectURL,
-		RequestID:   scope.RequestID,
-		AppError:    appError,
-		Messages:    messages,
+		Status:         code,
+		RedirectURL:    redirectURL,
+		RequestID:      scope.RequestID,
+		AppError:       appError,
+		Messages:       messages,
+		Host:           requestutil.GetRequestHost(req),
+		AcceptLanguage: req.Header.Get("Accept-Language"),
 	})
 }
 
@@ -587,14 +1425,119 @@ func isAllowedPath(req *http.Request, route allowedRoute) bool {
 
 // IsAllowedRoute is used to check if the request method & path is allowed without auth
 func (p *OAuthProxy) isAllowedRoute(req *http.Request) bool {
+	if p.getAuthMode(req) == options.AuthModeSkip {
+		return true
+	}
 	for _, route := range p.allowedRoutes {
-		if isAllowedMethod(req, route) && isAllowedPath(req, route) {
+		if route.dryRun && p.isSkipAuthRoute(req, route) {
+			logger.Printf("Dry run: %s %s would skip authentication with the skip auth route %q", req.Method, requestutil.GetRequestURI(req), route.rule)
+			break
+		}
+	}
+	return false
+}
+
+// isSkipAuthRoute checks whether the request matches the method, path and
+// conditions of the skip auth route
+func (p *OAuthProxy) isSkipAuthRoute(req *http.Request, route allowedRoute) bool {
+	if !isAllowedMethod(req, route) || !isAllowedPath(req, route) {
+		return false
+	}
+	for _, header := range route.headers {
+		if !hasHeader(req, header) {
+			return false
+		}
+	}
+	if route.networks != nil {
+		clientIP, err := ip.GetClientIP(p.realClientIPParser, req)
+		if err != nil {
+			logger.Errorf("Error obtaining real IP for skip auth route: %v", err)
+			return false
+		}
+		if clientIP == nil || !route.networks.Has(clientIP) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasHeader checks whether the request has the header, with its value when
+// it requires one. Values are compared in constant time, as they may be
+// pre-shared keys.
+func hasHeader(req *http.Request, header options.SkipAuthHeader) bool {
+	values := req.Header.Values(header.Name)
+	if header.Value == "" {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(header.Value)) == 1 {
 			return true
 		}
 	}
 	return false
 }
 
+// getAuthMode returns the authentication mode of the request.
+// The first matching auth route that sets a mode takes precedence over the
+// skip auth routes.
+func (p *OAuthProxy) getAuthMode(req *http.Request) options.AuthMode {
+	for _, r := range p.authRoutes {
+		if r.mode != "" && isAllowedMethod(req, r.route) && isAllowedPath(req, r.route) {
+			return r.mode
+		}
+	}
+	for _, route := range p.allowedRoutes {
+		if !route.dryRun && p.isSkipAuthRoute(req, route) {
+			return options.AuthModeSkip
+		}
+	}
+	return options.AuthModeRequired
+}
+
+// getLoginAction returns how the request is answered when it is
+// unauthenticated. Bearer only requests receive a 401 JSON error, while the
+// first matching auth route that sets a login action decides for the others.
+// Requests without one are answered with a 401 JSON error when they match an
+// API route or negotiate JSON errors, and are sent to sign in otherwise.
+func (p *OAuthProxy) getLoginAction(req *http.Request) options.LoginAction {
+	if p.getAuthMode(req) == options.AuthModeBearerOnly {
+		return options.LoginActionUnauthorized
+	}
+	for _, r := range p.authRoutes {
+		if r.login != "" && isAllowedMethod(req, r.route) && isAllowedPath(req, r.route) {
+			return r.login
+		}
+	}
+	if p.forceJSONErrors || p.isJSONRequest(req) || p.isAPIPath(req) {
+		return options.LoginActionUnauthorized
+	}
+	return options.LoginActionRedirect
+}
+
+// getStepUpRoute returns the first step up route the request matches, or
+// nil if it matches none
+func (p *OAuthProxy) getStepUpRoute(req *http.Request) *stepUpRoute {
+	for i, r := range p.stepUpRoutes {
+		if isAllowedMethod(req, r.route) && isAllowedPath(req, r.route) {
+			return &p.stepUpRoutes[i]
+		}
+	}
+	return nil
+}
+
+// satisfiedBy checks whether the session was authenticated with one of the
+// acr values, with a multi-factor authentication and within the max age when
+// they are required. Sessions without an auth_time are too old.
+func (r *stepUpRoute) satisfiedBy(s *sessionsapi.SessionState) bool {
+	if len(r.acrValues) > 0 && !slices.Contains(r.acrValues, s.ACR) {
+		return false
+	}
+	if r.maxAge > 0 && (s.AuthTime == nil || s.Clock.Now().Sub(*s.AuthTime) > r.maxAge) {
+		return false
+	}
+	return !r.mfa || slices.Contains(s.AMR, "mfa")
+}
+
 func (p *OAuthProxy) isAPIPath(req *http.Request) bool {
 	for _, route := range p.apiRoutes {
 		if route.pathRegex.MatchString(requestutil.GetRequestURI(req)) {
@@ -646,6 +1589,14 @@ func (p *OAuthProxy) SignInPage(rw http.ResponseWriter, req *http.Request, code
 		redirectURL = "/"
 	}
 
+	if id, ok := p.selectProvider(req); ok && req.URL.Query().Get("provider") == "" {
+		// Only offer the provider configured for the request host
+		req = req.Clone(req.Context())
+		query := req.URL.Query()
+		query.Set("provider", id)
+		req.URL.RawQuery = query.Encode()
+	}
+
 	p.pageWriter.WriteSignInPage(rw, req, redirectURL, code)
 }
 
@@ -660,10 +1611,15 @@ func (p *OAuthProxy) ManualSignIn(req *http.Request) (string, bool, int) {
 		return "", false, http.StatusBadRequest
 	}
 	// check auth
-	if p.basicAuthValidator.Validate(user, passwd) {
+	err := p.basicAuthLockout.Validate(req, p.basicAuthValidator, user, passwd)
+	if err == nil {
 		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via HtpasswdFile")
 		return user, true, http.StatusOK
 	}
+	var lockedOut *basic.LockedOutError
+	if errors.As(err, &lockedOut) {
+		return "", false, http.StatusTooManyRequests
+	}
 	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via HtpasswdFile")
 	return "", false, http.StatusUnauthorized
 }
@@ -733,6 +1689,33 @@ func (p *OAuthProxy) UserInfo(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// WhoAmI renders the decoded session of the user in JSON format for
+// debugging, including the claims of their tokens and whether they are
+// authorized. Users that are not authorized can see their session too.
+func (p *OAuthProxy) WhoAmI(rw http.ResponseWriter, req *http.Request) {
+	session := middlewareapi.GetRequestScope(req).Session
+	if session == nil {
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	snapshot := whoami.NewSnapshot(session, p.whoAmIRedactClaims)
+	if provider, ok := p.getProvider(session.ProviderID); ok {
+		snapshot.Provider = provider.Data().ProviderName
+		authorized, err := provider.Authorize(req.Context(), session)
+		if err != nil {
+			logger.Errorf("Error with authorization: %v", err)
+		}
+		snapshot.Authorized = authorized && (session.Email == "" || p.Validator(session.Email))
+	}
+
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(snapshot); err != nil {
+		logger.Printf("Error encoding session snapshot: %v", err)
+	}
+}
+
 // SignOut sends a response to clear the authentication cookie
 func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 	redirect, err := p.appDirector.GetRedirect(req)
@@ -750,9 +1733,78 @@ func (p *OAuthProxy) SignOut(rw http.ResponseWriter, req *http.Request) {
 
 	p.backendLogout(rw, req)
 
+	// SAML identity providers return users signed out with their logout
+	// response, and the redirect as its relay state
+	if relayState := req.Form.Get("RelayState"); req.Form.Get("SAMLResponse") != "" && p.redirectValidator.IsValidRedirect(relayState) {
+		redirect = relayState
+	}
+	if signOutURL := p.providerSignOutURL(req, redirect); signOutURL != "" {
+		redirect = signOutURL
+	}
 	http.Redirect(rw, req, redirect, http.StatusFound)
 }
 
+// providerSignOutURL returns the URL signing the user out of the provider of
+// the session, which redirects the user on to the redirect, when the provider
+// signs users out in the browser
+func (p *OAuthProxy) providerSignOutURL(req *http.Request, redirect string) string {
+	session := middlewareapi.GetRequestScope(req).Session
+	if session == nil {
+		return ""
+	}
+	provider, ok := p.getProvider(session.ProviderID)
+	if !ok {
+		return ""
+	}
+
+	// The provider redirects the user back to an absolute URL
+	rd, err := url.Parse(redirect)
+	if err != nil {
+		return ""
+	}
+	if rd.Host == "" {
+		rd.Host = requestutil.GetRequestHost(req)
+		rd.Scheme = requestutil.GetRequestProto(req)
+		if rd.Scheme == "" {
+			rd.Scheme = schemeHTTP
+		}
+		if p.CookieOptions.Secure {
+			rd.Scheme = schemeHTTPS
+		}
+	}
+	return provider.Data().SignOutURL(session, rd.String())
+}
+
+// UpstreamLogout revokes the session of the user on behalf of an upstream
+// application, which authenticates with the shared secret or a client
+// certificate and forwards the cookies of the user. The cookies clearing the
+// session are set on the response for the application to relay to the user.
+func (p *OAuthProxy) UpstreamLogout(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.upstreamLogoutAuthenticator.Authenticate(req) {
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	session, err := p.LoadCookiedSession(req)
+	if err != nil || session == nil {
+		http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if err := p.ClearSessionCookie(rw, req); err != nil {
+		logger.Errorf("Error clearing session cookie: %v", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Printf("Session of %s revoked by an upstream application", session.Email)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
 func (p *OAuthProxy) backendLogout(rw http.ResponseWriter, req *http.Request) {
 	session, err := p.getAuthenticatedSession(rw, req)
 	if err != nil {
@@ -762,26 +1814,226 @@ func (p *OAuthProxy) backendLogout(rw http.ResponseWriter, req *http.Request) {
 
 	if session == nil {
 		return
-	}
-
-	providerData := p.provider.Data()
-	if providerData.BackendLogoutURL == "" {
+	}
+
+	provider, ok := p.getProvider(session.ProviderID)
+	if !ok {
+		return
+	}
+
+	providerData := provider.Data()
+	if providerData.BackendLogoutURL == "" {
+		return
+	}
+
+	backendLogoutURL := strings.ReplaceAll(providerData.BackendLogoutURL, "{id_token}", session.IDToken)
+	// security exception because URL is dynamic ({id_token} replacement) but
+	// base is not end-user provided but comes from configuration somewhat secure
+	resp, err := http.Get(backendLogoutURL) // #nosec G107
+	if err != nil {
+		logger.Errorf("error while calling backend logout: %v", err)
+		return
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		logger.Errorf("error while calling backend logout url, returned error code %v", resp.StatusCode)
+	}
+}
+
+// HandoffStart asks the sibling proxy given by the handoff URL for the
+// session, binding the handoff code it mints to a nonce kept in a cookie of
+// the browser
+func (p *OAuthProxy) HandoffStart(rw http.ResponseWriter, req *http.Request) {
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		logger.Errorf("Error obtaining application redirect: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	nonce, err := handoff.NewNonce()
+	if err != nil {
+		logger.Errorf("Error starting session handoff: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(req, p.handoffCookieName(), nonce,
+		p.CookieOptions, p.CookieOptions.CSRFExpire, time.Now()))
+
+	// The sibling hands the session off to the redeem endpoint of this proxy
+	redeem := url.URL{
+		Scheme:   requestutil.GetRequestProto(req),
+		Host:     requestutil.GetRequestHost(req),
+		Path:     p.ProxyPrefix + handoffRedeemPath,
+		RawQuery: url.Values{"rd": {appRedirect}}.Encode(),
+	}
+	if redeem.Scheme == "" {
+		redeem.Scheme = schemeHTTP
+	}
+	if p.CookieOptions.Secure {
+		redeem.Scheme = schemeHTTPS
+	}
+
+	target := *p.handoffURL
+	query := target.Query()
+	query.Set("rd", redeem.String())
+	query.Set("nonce", handoff.NonceDigest(nonce))
+	target.RawQuery = query.Encode()
+	http.Redirect(rw, req, target.String(), http.StatusFound)
+}
+
+// Handoff mints a one-time handoff code carrying the session and redirects to
+// the handoff redeem URL of the sibling proxy given by the `rd` parameter.
+// The code is bound to the nonce digest given by the `nonce` parameter, so
+// that only the browser holding the nonce can redeem it.
+func (p *OAuthProxy) Handoff(rw http.ResponseWriter, req *http.Request) {
+	target, err := url.Parse(req.URL.Query().Get("rd"))
+	if err != nil || (target.Scheme != schemeHTTP && target.Scheme != schemeHTTPS) || !util.IsEndpointAllowed(target, p.handoffDomains) {
+		logger.Errorf("Rejecting session handoff to %q: not on an allowed handoff domain", req.URL.Query().Get("rd"))
+		p.ErrorPage(rw, req, http.StatusBadRequest, "invalid handoff redirect", "The session cannot be handed off to this application.")
+		return
+	}
+	nonce := req.URL.Query().Get("nonce")
+	if nonce == "" {
+		logger.Errorf("Rejecting session handoff to %q: no nonce was given", target.Host)
+		p.ErrorPage(rw, req, http.StatusBadRequest, "missing handoff nonce", "The session cannot be handed off to this application.")
+		return
+	}
+
+	session, err := p.getAuthenticatedSession(rw, req)
+	switch err {
+	case nil:
+	case ErrNeedsLogin:
+		// Come back to hand off the session once signed in
+		signIn := url.URL{Path: p.SignInPath, RawQuery: url.Values{"rd": {req.URL.RequestURI()}}.Encode()}
+		http.Redirect(rw, req, signIn.String(), http.StatusFound)
+		return
+	case ErrAccessDenied:
+		p.ErrorPage(rw, req, http.StatusForbidden, "The session failed authorization checks")
+		return
+	default:
+		logger.Errorf("Unexpected internal error: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	code, err := p.handoff.Mint(session, target.Host, nonce)
+	if err != nil {
+		logger.Errorf("Error minting handoff code: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	query := target.Query()
+	query.Set("code", code)
+	target.RawQuery = query.Encode()
+
+	logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Handing off session to %s", target.Host)
+	http.Redirect(rw, req, target.String(), http.StatusFound)
+}
+
+// HandoffRedeem redeems a handoff code minted by a sibling proxy for the
+// nonce set by HandoffStart, saving the session it carries once it has passed
+// the same checks as a new session
+func (p *OAuthProxy) HandoffRedeem(rw http.ResponseWriter, req *http.Request) {
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		logger.Errorf("Error obtaining application redirect: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var nonce string
+	if c, err := req.Cookie(p.handoffCookieName()); err == nil {
+		nonce = c.Value
+	}
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(req, p.handoffCookieName(), "", p.CookieOptions, time.Hour*-1, time.Now()))
+
+	session, err := p.handoff.Redeem(req.Form.Get("code"), requestutil.GetRequestHost(req), nonce)
+	if err != nil {
+		logger.PrintAuthf("", req, logger.AuthFailure, "Invalid authentication via session handoff: %v", err)
+		p.ErrorPage(rw, req, http.StatusForbidden, err.Error(), "Login Failed: The handoff link is invalid or has expired. Please try again.")
+		return
+	}
+
+	provider, ok := p.getProvider(session.ProviderID)
+	if !ok || session.IsExpired() || !provider.ValidateSession(req.Context(), session) {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session validation failed for handoff: %s", session)
+		p.ErrorPage(rw, req, http.StatusForbidden, "Session validation failed")
+		return
+	}
+
+	authorized, err := provider.Authorize(req.Context(), session)
+	if err != nil {
+		logger.Errorf("Error with authorization: %v", err)
+	}
+	if !p.Validator(session.Email) || !authorized {
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via session handoff: unauthorized")
+		p.ErrorPage(rw, req, http.StatusForbidden, "Invalid session: unauthorized")
+		return
+	}
+
+	logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via session handoff: %s", session)
+	if err := p.SaveSession(rw, req, session); err != nil {
+		logger.Errorf("Error saving session state from handoff: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(rw, req, appRedirect, http.StatusFound)
+}
+
+// handoffCookieName is the name of the cookie keeping the nonce that handoff
+// codes are bound to while the browser is sent to the sibling proxy
+func (p *OAuthProxy) handoffCookieName() string {
+	return p.CookieOptions.Name + "_handoff"
+}
+
+// OIDCAuthorize is the authorization endpoint of the OIDC issuer, which
+// redirects back to the upstream application with an authorization code
+// carrying the session
+func (p *OAuthProxy) OIDCAuthorize(rw http.ResponseWriter, req *http.Request) {
+	authReq, err := p.oidcIssuer.ParseAuthRequest(req)
+	if err != nil {
+		logger.Errorf("Rejecting OIDC issuer authorization request: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error(), "The application is not allowed to sign in with this proxy.")
+		return
+	}
+	if authReq.Error != "" {
+		http.Redirect(rw, req, authReq.Redirect(url.Values{"error": {authReq.Error}}), http.StatusFound)
+		return
+	}
+
+	session, err := p.getAuthenticatedSession(rw, req)
+	switch err {
+	case nil:
+	case ErrNeedsLogin:
+		if authReq.Prompt == "none" {
+			http.Redirect(rw, req, authReq.Redirect(url.Values{"error": {"login_required"}}), http.StatusFound)
+			return
+		}
+		// Come back to authorize the application once signed in
+		signIn := url.URL{Path: p.SignInPath, RawQuery: url.Values{"rd": {req.URL.RequestURI()}}.Encode()}
+		http.Redirect(rw, req, signIn.String(), http.StatusFound)
+		return
+	case ErrAccessDenied:
+		http.Redirect(rw, req, authReq.Redirect(url.Values{"error": {"access_denied"}}), http.StatusFound)
+		return
+	default:
+		logger.Errorf("Unexpected internal error: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	backendLogoutURL := strings.ReplaceAll(providerData.BackendLogoutURL, "{id_token}", session.IDToken)
-	// security exception because URL is dynamic ({id_token} replacement) but
-	// base is not end-user provided but comes from configuration somewhat secure
-	resp, err := http.Get(backendLogoutURL) // #nosec G107
+	target, err := p.oidcIssuer.Authorize(authReq, session)
 	if err != nil {
-		logger.Errorf("error while calling backend logout: %v", err)
+		logger.Errorf("Error minting OIDC issuer authorization code: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		logger.Errorf("error while calling backend logout url, returned error code %v", resp.StatusCode)
-	}
+	logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Signing in to OIDC issuer client %s", authReq.ClientID)
+	http.Redirect(rw, req, target, http.StatusFound)
 }
 
 // OAuthStart starts the OAuth2 authentication flow
@@ -791,15 +2043,38 @@ func (p *OAuthProxy) OAuthStart(rw http.ResponseWriter, req *http.Request) {
 }
 
 func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, overrides url.Values) {
-	extraParams := p.provider.Data().LoginURLParams(overrides)
+	providerID, ok := p.selectProvider(req)
+	if !ok {
+		providerID = p.providerSet.DefaultID()
+	}
+	provider, ok := p.getProvider(providerID)
+	if !ok {
+		logger.Errorf("Unknown provider %q requested to start the OAuth2 flow", providerID)
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("unknown provider %q", providerID))
+		return
+	}
+
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		logger.Errorf("Error obtaining application redirect: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p.redirectToProvider(rw, req, providerID, provider, appRedirect, provider.Data().LoginURLParams(overrides))
+}
+
+// redirectToProvider starts the OAuth2 flow with the provider, redirecting
+// the user to the provider's login URL with the given extra parameters
+func (p *OAuthProxy) redirectToProvider(rw http.ResponseWriter, req *http.Request, providerID string, provider providers.Provider, appRedirect string, extraParams url.Values) {
 	prepareNoCache(rw)
 
 	var (
 		err                                              error
 		codeChallenge, codeVerifier, codeChallengeMethod string
 	)
-	if p.provider.Data().CodeChallengeMethod != "" {
-		codeChallengeMethod = p.provider.Data().CodeChallengeMethod
+	if provider.Data().CodeChallengeMethod != "" {
+		codeChallengeMethod = provider.Data().CodeChallengeMethod
 		codeVerifier, err = encryption.GenerateRandomASCIIString(96)
 		if err != nil {
 			logger.Errorf("Unable to build random ASCII string for code verifier: %v", err)
@@ -807,7 +2082,7 @@ func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, ove
 			return
 		}
 
-		codeChallenge, err = encryption.GenerateCodeChallenge(p.provider.Data().CodeChallengeMethod, codeVerifier)
+		codeChallenge, err = encryption.GenerateCodeChallenge(provider.Data().CodeChallengeMethod, codeVerifier)
 		if err != nil {
 			logger.Errorf("Error creating code challenge: %v", err)
 			p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
@@ -824,18 +2099,21 @@ func (p *OAuthProxy) doOAuthStart(rw http.ResponseWriter, req *http.Request, ove
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	csrf.SetProviderID(providerID)
+	csrf.SetPrompt(extraParams.Get("prompt"))
+	csrf.SetScope(extraParams.Get("scope"))
 
-	appRedirect, err := p.appDirector.GetRedirect(req)
+	state, err := p.makeState(csrf, appRedirect)
 	if err != nil {
-		logger.Errorf("Error obtaining application redirect: %v", err)
-		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		logger.Errorf("Error creating OAuth2 state: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	callbackRedirect := p.getOAuthRedirectURI(req)
-	loginURL := p.provider.GetLoginURL(
+	callbackRedirect := p.getOAuthRedirectURI(req, providerID)
+	loginURL := provider.GetLoginURL(
 		callbackRedirect,
-		encodeState(csrf.HashOAuthState(), appRedirect, p.encodeState),
+		state,
 		csrf.HashOIDCNonce(),
 		extraParams,
 	)
@@ -861,9 +2139,19 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// SAML identity providers post their response and the relay state, with
+	// the HTTP-POST binding, in place of the code and state
+	if samlResponse := req.Form.Get("SAMLResponse"); samlResponse != "" {
+		req.Form.Set("code", samlResponse)
+		req.Form.Set("state", req.Form.Get("RelayState"))
+	}
 	errorString := req.Form.Get("error")
 	if errorString != "" {
 		logger.Errorf("Error while parsing OAuth2 callback: %s", errorString)
+		if interaction, ok := interactionErrors[errorString]; ok {
+			p.handleInteractionRequired(rw, req, interaction)
+			return
+		}
 		message := fmt.Sprintf("Login Failed: The upstream identity provider returned an error: %s", errorString)
 		// Set the debug message and override the non debug message to be the same for this case
 		p.ErrorPage(rw, req, http.StatusForbidden, message, message)
@@ -877,53 +2165,68 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	session, err := p.redeemCode(req, csrf.GetCodeVerifier())
+	flow, err := p.loadState(req, csrf)
 	if err != nil {
-		logger.Errorf("Error redeeming code during OAuth2 callback: %v", err)
+		if errors.Is(err, errCSRFMismatch) {
+			logger.Println(req, logger.AuthFailure, "Invalid authentication via OAuth2:", err.Error())
+			p.ErrorPage(rw, req, http.StatusForbidden, errCSRFMismatch.Error(), "Login Failed: Unable to find a valid CSRF token. Please try again.")
+			return
+		}
+		logger.Errorf("Error while parsing OAuth2 state: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = p.enrichSessionState(req.Context(), session)
-	if err != nil {
-		logger.Errorf("Error creating session during OAuth2 callback: %v", err)
-		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
+	provider, ok := p.getProvider(flow.providerID)
+	if !ok {
+		logger.Errorf("Unknown provider %q in OAuth2 callback", flow.providerID)
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("unknown provider %q", flow.providerID))
 		return
 	}
 
-	csrf.ClearCookie(rw, req)
-
-	nonce, appRedirect, err := decodeState(req.Form.Get("state"), p.encodeState)
+	session, err := p.redeemCode(req, provider, p.getOAuthRedirectURI(req, flow.providerID), flow.codeVerifier)
 	if err != nil {
-		logger.Errorf("Error while parsing OAuth2 state: %v", err)
+		logger.Errorf("Error redeeming code during OAuth2 callback: %v", err)
 		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	session.ProviderID = flow.providerID
 
-	if !csrf.CheckOAuthState(nonce) {
-		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authentication via OAuth2: CSRF token mismatch, potential attack")
-		p.ErrorPage(rw, req, http.StatusForbidden, "CSRF token mismatch, potential attack", "Login Failed: Unable to find a valid CSRF token. Please try again.")
+	err = p.enrichSessionState(req.Context(), provider, session)
+	if err != nil {
+		logger.Errorf("Error creating session during OAuth2 callback: %v", err)
+		p.ErrorPage(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	p.identityNormalizer.Normalize(session)
+	if scope := csrf.GetScope(); scope != "" {
+		session.Scopes = grantedScopes(provider, scope)
+	}
+
+	csrf.ClearCookie(rw, req)
 
 	csrf.SetSessionNonce(session)
-	if !p.provider.ValidateSession(req.Context(), session) {
+	if !provider.ValidateSession(req.Context(), session) {
 		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Session validation failed: %s", session)
 		p.ErrorPage(rw, req, http.StatusForbidden, "Session validation failed")
 		return
 	}
 
+	appRedirect := flow.redirect
 	if !p.redirectValidator.IsValidRedirect(appRedirect) {
 		appRedirect = "/"
 	}
 
 	// set cookie, or deny
-	authorized, err := p.provider.Authorize(req.Context(), session)
+	authorized, err := provider.Authorize(req.Context(), session)
 	if err != nil {
 		logger.Errorf("Error with authorization: %v", err)
 	}
 	if p.Validator(session.Email) && authorized {
 		logger.PrintAuthf(session.Email, req, logger.AuthSuccess, "Authenticated via OAuth2: %s", session)
+		if csrf.GetScope() != "" {
+			session = p.mergeGrantedScopes(req, session)
+		}
 		err := p.SaveSession(rw, req, session)
 		if err != nil {
 			logger.Errorf("Error saving session state for %s: %v", remoteAddr, err)
@@ -937,14 +2240,80 @@ func (p *OAuthProxy) OAuthCallback(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (p *OAuthProxy) redeemCode(req *http.Request, codeVerifier string) (*sessionsapi.SessionState, error) {
+// interactionRequired describes how to recover from an OAuth error returned
+// by providers that could not sign the user in without their interaction
+type interactionRequired struct {
+	// prompt is the prompt that lets the user interact with the provider
+	prompt string
+	// guidance tells the user what they need to do with the provider
+	guidance string
+}
+
+// interactionErrors are the standard OAuth error codes returned by providers
+// when they cannot sign the user in without their interaction
+var interactionErrors = map[string]interactionRequired{
+	"login_required": {
+		prompt:   "login",
+		guidance: "You need to sign in with the identity provider to continue.",
+	},
+	"consent_required": {
+		prompt:   "consent",
+		guidance: "You need to allow this application to access your account with the identity provider to continue.",
+	},
+	"interaction_required": {
+		prompt:   "login",
+		guidance: "The identity provider needs you to complete an additional step, such as multi-factor authentication, to continue.",
+	},
+	"account_selection_required": {
+		prompt:   "select_account",
+		guidance: "You need to choose the account to sign in with to continue.",
+	},
+}
+
+// handleInteractionRequired handles the callback of a provider that could not
+// sign the user in without their interaction.
+// When the flow was started with `prompt=none`, it is restarted once with a
+// prompt that lets the user interact with the provider. Otherwise the user is
+// told what they need to do to sign in.
+func (p *OAuthProxy) handleInteractionRequired(rw http.ResponseWriter, req *http.Request, interaction interactionRequired) {
+	message := fmt.Sprintf("Login Failed: %s", interaction.guidance)
+
+	csrf, err := cookies.LoadCSRFCookie(req, p.CookieOptions)
+	if err != nil || csrf.GetPrompt() != "none" {
+		p.ErrorPage(rw, req, http.StatusForbidden, message, message)
+		return
+	}
+	csrf.ClearCookie(rw, req)
+
+	flow, err := p.loadState(req, csrf)
+	if err != nil {
+		logger.Println(req, logger.AuthFailure, "Invalid authentication via OAuth2: CSRF token mismatch, potential attack")
+		p.ErrorPage(rw, req, http.StatusForbidden, errCSRFMismatch.Error(), "Login Failed: Unable to find a valid CSRF token. Please try again.")
+		return
+	}
+	provider, ok := p.getProvider(flow.providerID)
+	if !ok {
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("unknown provider %q", flow.providerID))
+		return
+	}
+	appRedirect := flow.redirect
+	if !p.redirectValidator.IsValidRedirect(appRedirect) {
+		appRedirect = "/"
+	}
+
+	logger.Printf("Provider requires interaction to sign in: retrying with prompt=%s", interaction.prompt)
+	extraParams := provider.Data().LoginURLParams(nil)
+	extraParams.Set("prompt", interaction.prompt)
+	p.redirectToProvider(rw, req, flow.providerID, provider, appRedirect, extraParams)
+}
+
+func (p *OAuthProxy) redeemCode(req *http.Request, provider providers.Provider, redirectURI, codeVerifier string) (*sessionsapi.SessionState, error) {
 	code := req.Form.Get("code")
 	if code == "" {
 		return nil, providers.ErrMissingCode
 	}
 
-	redirectURI := p.getOAuthRedirectURI(req)
-	s, err := p.provider.Redeem(req.Context(), redirectURI, code, codeVerifier)
+	s, err := provider.Redeem(req.Context(), redirectURI, code, codeVerifier)
 	if err != nil {
 		return nil, err
 	}
@@ -960,18 +2329,40 @@ func (p *OAuthProxy) redeemCode(req *http.Request, codeVerifier string) (*sessio
 	return s, nil
 }
 
-func (p *OAuthProxy) enrichSessionState(ctx context.Context, s *sessionsapi.SessionState) error {
+func (p *OAuthProxy) enrichSessionState(ctx context.Context, provider providers.Provider, s *sessionsapi.SessionState) error {
 	var err error
 	if s.Email == "" {
 		// TODO(@NickMeves): Remove once all provider are updated to implement EnrichSession
 		// nolint:staticcheck
-		s.Email, err = p.provider.GetEmailAddress(ctx, s)
+		s.Email, err = provider.GetEmailAddress(ctx, s)
 		if err != nil && !errors.Is(err, providers.ErrNotImplemented) {
 			return err
 		}
 	}
 
-	return p.provider.EnrichSession(ctx, s)
+	return provider.EnrichSession(ctx, s)
+}
+
+// selectProvider returns the ID of the provider chosen by the request, either
+// with the `provider` query parameter, by the virtual host serving the request
+// or by the providers configured for the request host
+func (p *OAuthProxy) selectProvider(req *http.Request) (string, bool) {
+	if id := req.URL.Query().Get("provider"); id != "" {
+		return id, true
+	}
+	if vhost := p.getVirtualHost(req); vhost != nil && vhost.providerID != "" {
+		return vhost.providerID, true
+	}
+	return p.providerSet.ForHost(requestutil.GetRequestHost(req))
+}
+
+// getProvider returns the provider with the given ID.
+// The default provider is returned when the ID is empty.
+func (p *OAuthProxy) getProvider(id string) (providers.Provider, bool) {
+	if id == "" || id == p.providerSet.DefaultID() {
+		return p.provider, true
+	}
+	return p.providerSet.Get(id)
 }
 
 // AuthOnly checks whether the user is currently logged in (both authentication
@@ -985,11 +2376,17 @@ func (p *OAuthProxy) AuthOnly(rw http.ResponseWriter, req *http.Request) {
 
 	// Unauthorized cases need to return 403 to prevent infinite redirects with
 	// subrequest architectures
-	if !authOnlyAuthorize(req, session) {
+	if !authOnlyAuthorize(req, session) || !p.checkAllowedRoles(req, session) {
 		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
+	if route := p.getStepUpRoute(req); route != nil && session != nil && !route.satisfiedBy(session) {
+		rw.Header().Set("WWW-Authenticate", route.challenge())
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
 	// we are authenticated
 	p.addHeadersForProxying(rw, session)
 	p.headersChain.Then(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
@@ -1003,15 +2400,41 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	session, err := p.getAuthenticatedSession(rw, req)
 	switch err {
 	case nil:
+		if route := p.getStepUpRoute(req); route != nil && session != nil {
+			if !route.satisfiedBy(session) {
+				p.stepUp(rw, req, session, route)
+				return
+			}
+			// Let the user step up again once the max age has passed
+			if _, err := req.Cookie(p.stepUpCookieName()); err == nil {
+				p.clearStepUpCookie(rw, req)
+			}
+		}
+
 		// we are authenticated
+		upstreamProxy, upstreamScopes := p.upstreamProxy, p.upstreamScopes
+		if vhost := p.getVirtualHost(req); vhost != nil && vhost.upstreamProxy != nil {
+			upstreamProxy, upstreamScopes = vhost.upstreamProxy, vhost.upstreamScopes
+		}
+		if session != nil && upstreamScopes != nil {
+			if missing := p.missingScopes(session, upstreamScopes(req)); len(missing) > 0 {
+				p.authorizeScopes(rw, req, session, missing)
+				return
+			}
+		}
 		p.addHeadersForProxying(rw, session)
-		p.headersChain.Then(p.upstreamProxy).ServeHTTP(rw, req)
+		p.headersChain.Then(upstreamProxy).ServeHTTP(rw, req)
 	case ErrNeedsLogin:
 		// we need to send the user to a login screen
-		if p.forceJSONErrors || isAjax(req) || p.isAPIPath(req) {
+		switch p.getLoginAction(req) {
+		case options.LoginActionUnauthorized:
 			logger.Printf("No valid authentication in request. Access Denied.")
 			// no point redirecting an AJAX request
-			p.errorJSON(rw, http.StatusUnauthorized)
+			p.errorJSON(rw, req, http.StatusUnauthorized, ErrNeedsLogin)
+			return
+		case options.LoginActionForbidden:
+			logger.Printf("No valid authentication in request. Access Denied.")
+			p.errorJSON(rw, req, http.StatusForbidden, ErrNeedsLogin)
 			return
 		}
 
@@ -1026,8 +2449,8 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 		}
 
 	case ErrAccessDenied:
-		if p.forceJSONErrors {
-			p.errorJSON(rw, http.StatusForbidden)
+		if p.forceJSONErrors || p.isJSONRequest(req) {
+			p.errorJSON(rw, req, http.StatusForbidden, ErrAccessDenied)
 		} else {
 			p.ErrorPage(rw, req, http.StatusForbidden, "The session failed authorization checks")
 		}
@@ -1039,6 +2462,192 @@ func (p *OAuthProxy) Proxy(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// stepUp signs the user in again with the stronger authentication the step up
+// route requires, coming back to the request once signed in.
+// The sign in is not restarted when the provider already signed the user in
+// again since the last step up of the route, as it did not provide that
+// authentication.
+func (p *OAuthProxy) stepUp(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState, route *stepUpRoute) {
+	logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Insufficient authentication for the step up route %q: acr %q, amr %v", route.rule, session.ACR, session.AMR)
+
+	if p.getLoginAction(req) != options.LoginActionRedirect {
+		rw.Header().Set("WWW-Authenticate", route.challenge())
+		p.errorJSON(rw, req, http.StatusUnauthorized, ErrStepUpRequired)
+		return
+	}
+
+	if p.isStepUpFailed(req, session, route) {
+		p.clearStepUpCookie(rw, req)
+		p.ErrorPage(rw, req, http.StatusForbidden, "The identity provider did not provide the authentication this page requires",
+			"You need to sign in with a stronger authentication, such as multi-factor authentication, to access this page.")
+		return
+	}
+
+	providerID := p.sessionProviderID(session)
+	provider, ok := p.getProvider(providerID)
+	if !ok {
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("unknown provider %q", providerID))
+		return
+	}
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		logger.Errorf("Error obtaining application redirect: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	extraParams := provider.Data().LoginURLParams(nil)
+	if len(route.acrValues) > 0 {
+		extraParams.Set("acr_values", strings.Join(route.acrValues, " "))
+	}
+	if route.maxAge > 0 {
+		extraParams.Set("max_age", strconv.Itoa(int(route.maxAge.Seconds())))
+	}
+	extraParams.Set("prompt", "login")
+
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(req, p.stepUpCookieName(), fmt.Sprintf("%d.%d", route.id, time.Now().Unix()),
+		p.CookieOptions, p.CookieOptions.CSRFExpire, time.Now()))
+	p.redirectToProvider(rw, req, providerID, provider, appRedirect, extraParams)
+}
+
+// isStepUpFailed checks whether the session was created since the last step
+// up of the user for the route
+func (p *OAuthProxy) isStepUpFailed(req *http.Request, session *sessionsapi.SessionState, route *stepUpRoute) bool {
+	c, err := req.Cookie(p.stepUpCookieName())
+	if err != nil || session.CreatedAt == nil {
+		return false
+	}
+	id, startedAt, ok := strings.Cut(c.Value, ".")
+	if !ok || id != strconv.Itoa(route.id) {
+		return false
+	}
+	started, err := strconv.ParseInt(startedAt, 10, 64)
+	if err != nil {
+		return false
+	}
+	return !session.CreatedAt.Before(time.Unix(started, 0))
+}
+
+// clearStepUpCookie expires the cookie of the last step up
+func (p *OAuthProxy) clearStepUpCookie(rw http.ResponseWriter, req *http.Request) {
+	http.SetCookie(rw, cookies.MakeCookieFromOptions(req, p.stepUpCookieName(), "", p.CookieOptions, time.Hour*-1, time.Now()))
+}
+
+// stepUpCookieName is the name of the cookie recording the route and time
+// the user was last sent to sign in again with a stronger authentication
+func (p *OAuthProxy) stepUpCookieName() string {
+	return p.CookieOptions.Name + "_step_up"
+}
+
+// challenge returns the WWW-Authenticate challenge of RFC 9470 asking
+// clients for a stronger authentication
+func (r *stepUpRoute) challenge() string {
+	challenge := `Bearer error="insufficient_user_authentication", error_description="A stronger authentication is required"`
+	if len(r.acrValues) > 0 {
+		challenge += fmt.Sprintf(`, acr_values="%s"`, strings.Join(r.acrValues, " "))
+	}
+	if r.maxAge > 0 {
+		challenge += fmt.Sprintf(`, max_age=%d`, int(r.maxAge.Seconds()))
+	}
+	return challenge
+}
+
+// sessionProviderID returns the ID of the provider the session was created
+// with, sessions that do not record it belonging to the default provider
+func (p *OAuthProxy) sessionProviderID(session *sessionsapi.SessionState) string {
+	if session.ProviderID == "" {
+		return p.providerSet.DefaultID()
+	}
+	return session.ProviderID
+}
+
+// missingScopes returns the required scopes that the access token of the
+// session was not granted, either as scopes of its provider or incrementally.
+// Sessions without an access token, such as those of basic auth users, are
+// not checked.
+func (p *OAuthProxy) missingScopes(session *sessionsapi.SessionState, required []string) []string {
+	if len(required) == 0 || session.AccessToken == "" {
+		return nil
+	}
+	provider, ok := p.getProvider(p.sessionProviderID(session))
+	if !ok {
+		return nil
+	}
+	granted := strings.Fields(provider.Data().Scope)
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) && !slices.Contains(session.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// authorizeScopes sends the user back to the provider of their session to
+// grant the access token the missing scopes, along with those it was already
+// granted, coming back to the request once granted
+func (p *OAuthProxy) authorizeScopes(rw http.ResponseWriter, req *http.Request, session *sessionsapi.SessionState, missing []string) {
+	logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Insufficient scope for the upstream: missing %v", missing)
+
+	if p.getLoginAction(req) != options.LoginActionRedirect {
+		rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(missing, " ")))
+		p.errorJSON(rw, req, http.StatusForbidden, ErrInsufficientScope)
+		return
+	}
+
+	providerID := p.sessionProviderID(session)
+	provider, ok := p.getProvider(providerID)
+	if !ok {
+		p.ErrorPage(rw, req, http.StatusBadRequest, fmt.Sprintf("unknown provider %q", providerID))
+		return
+	}
+	appRedirect, err := p.appDirector.GetRedirect(req)
+	if err != nil {
+		logger.Errorf("Error obtaining application redirect: %v", err)
+		p.ErrorPage(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	scopes := append(strings.Fields(provider.Data().Scope), session.Scopes...)
+	scopes = append(scopes, missing...)
+	extraParams := provider.Data().LoginURLParams(nil)
+	extraParams.Set("scope", strings.Join(scopes, " "))
+	extraParams.Set("include_granted_scopes", "true")
+	p.redirectToProvider(rw, req, providerID, provider, appRedirect, extraParams)
+}
+
+// mergeGrantedScopes merges the access token granted more scopes by an
+// incremental authorization into the existing session of the user, which
+// keeps its other details, such as the time it was created
+func (p *OAuthProxy) mergeGrantedScopes(req *http.Request, session *sessionsapi.SessionState) *sessionsapi.SessionState {
+	existing, err := p.LoadCookiedSession(req)
+	if err != nil || existing == nil || existing.User != session.User ||
+		p.sessionProviderID(existing) != p.sessionProviderID(session) {
+		return session
+	}
+
+	existing.AccessToken = session.AccessToken
+	if session.RefreshToken != "" {
+		existing.RefreshToken = session.RefreshToken
+	}
+	existing.ExpiresOn = session.ExpiresOn
+	existing.Scopes = session.Scopes
+	return existing
+}
+
+// grantedScopes returns the scopes of the scope parameter of an incremental
+// authorization that are not scopes of the provider
+func grantedScopes(provider providers.Provider, scope string) []string {
+	providerScopes := strings.Fields(provider.Data().Scope)
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(providerScopes, s) && !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
 // See https://developers.google.com/web/fundamentals/performance/optimizing-content-efficiency/http-caching?hl=en
 var noCacheHeaders = map[string]string{
 	"Expires":         time.Unix(0, 0).Format(time.RFC1123),
@@ -1064,7 +2673,11 @@ func prepareNoCacheMiddleware(next http.Handler) http.Handler {
 // getOAuthRedirectURI returns the redirectURL that the upstream OAuth Provider will
 // redirect clients to once authenticated.
 // This is usually the OAuthProxy callback URL.
-func (p *OAuthProxy) getOAuthRedirectURI(req *http.Request) string {
+func (p *OAuthProxy) getOAuthRedirectURI(req *http.Request, providerID string) string {
+	if rd := p.selectRedirectURL(req, providerID); rd != nil {
+		return rd.String()
+	}
+
 	// if `p.redirectURL` already has a host, return it
 	if p.relativeRedirectURL || p.redirectURL.Host != "" {
 		return p.redirectURL.String()
@@ -1088,6 +2701,43 @@ func (p *OAuthProxy) getOAuthRedirectURI(req *http.Request) string {
 	return rd.String()
 }
 
+// selectRedirectURL returns the redirect URL of the provider, or else the
+// extra redirect URL, matching the request host.
+// Wildcard hosts are replaced by the request host.
+func (p *OAuthProxy) selectRedirectURL(req *http.Request, providerID string) *url.URL {
+	if providerID == "" {
+		providerID = p.providerSet.DefaultID()
+	}
+	host := &url.URL{Host: requestutil.GetRequestHost(req)}
+	for _, redirectURLs := range [][]*url.URL{p.providerRedirectURLs[providerID], p.extraRedirectURLs} {
+		for _, redirectURL := range redirectURLs {
+			if !util.IsEndpointAllowed(host, []string{redirectURL.Host}) {
+				continue
+			}
+			rd := *redirectURL
+			if strings.HasPrefix(rd.Host, "*.") {
+				rd.Host = host.Host
+			}
+			return &rd
+		}
+	}
+	return nil
+}
+
+// parseRedirectURLs parses the redirect URLs that are selected by the
+// request host
+func parseRedirectURLs(rawURLs []string) ([]*url.URL, error) {
+	redirectURLs := make([]*url.URL, 0, len(rawURLs))
+	for _, rawURL := range rawURLs {
+		redirectURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing redirect URL %q: %v", rawURL, err)
+		}
+		redirectURLs = append(redirectURLs, redirectURL)
+	}
+	return redirectURLs, nil
+}
+
 // getAuthenticatedSession checks whether a user is authenticated and returns a session object and nil error if so
 // Returns:
 // - `nil, ErrNeedsLogin` if user needs to login.
@@ -1101,14 +2751,33 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 		return session, nil
 	}
 
+	mode := p.getAuthMode(req)
+	if mode == options.AuthModeBearerOnly && session != nil && !isBearerSession(req, session) {
+		// Ignore sessions that were not loaded from a bearer token
+		session = dropSession(req)
+	}
+
+	vhost := p.getVirtualHost(req)
+	if vhost != nil && vhost.providerID != "" && session != nil && !p.isProviderSession(vhost.providerID, session) {
+		// Users must sign in again with the provider of the virtual host
+		session = dropSession(req)
+	}
+
 	if session == nil {
+		if mode == options.AuthModeOptional {
+			return nil, nil
+		}
 		return nil, ErrNeedsLogin
 	}
 
 	invalidEmail := session.Email != "" && !p.Validator(session.Email)
-	authorized, err := p.provider.Authorize(req.Context(), session)
-	if err != nil {
-		logger.Errorf("Error with authorization: %v", err)
+	authorized := false
+	if provider, ok := p.getProvider(session.ProviderID); ok {
+		var err error
+		authorized, err = provider.Authorize(req.Context(), session)
+		if err != nil {
+			logger.Errorf("Error with authorization: %v", err)
+		}
 	}
 
 	if invalidEmail || !authorized {
@@ -1117,6 +2786,12 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 			cause = "invalid email"
 		}
 
+		if mode == options.AuthModeOptional {
+			// Proxy the request anonymously, keeping the session for routes that require it
+			logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authorization via session (%s): proxying anonymously %s", cause, session)
+			return dropSession(req), nil
+		}
+
 		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authorization via session (%s): removing session %s", cause, session)
 		// Invalid session, clear it
 		err := p.ClearSessionCookie(rw, req)
@@ -1126,9 +2801,41 @@ func (p *OAuthProxy) getAuthenticatedSession(rw http.ResponseWriter, req *http.R
 		return nil, ErrAccessDenied
 	}
 
+	if vhost != nil && !vhost.allowsSession(session) {
+		// Keep the session as it may be shared with other virtual hosts
+		logger.PrintAuthf(session.Email, req, logger.AuthFailure, "Invalid authorization via session (not in the allowed groups of the virtual host): %s", session)
+		if mode == options.AuthModeOptional {
+			return dropSession(req), nil
+		}
+		return nil, ErrAccessDenied
+	}
+
 	return session, nil
 }
 
+// isProviderSession checks whether the session was created by the provider
+// with the given ID
+func (p *OAuthProxy) isProviderSession(id string, s *sessionsapi.SessionState) bool {
+	if s.ProviderID == "" {
+		return id == p.providerSet.DefaultID()
+	}
+	return s.ProviderID == id
+}
+
+// dropSession removes the session from the request scope so that it is not
+// used to authenticate the request, or to inject headers
+func dropSession(req *http.Request) *sessionsapi.SessionState {
+	middlewareapi.GetRequestScope(req).Session = nil
+	return nil
+}
+
+// isBearerSession checks whether the session was created from the bearer token
+// in the request's Authorization header
+func isBearerSession(req *http.Request, session *sessionsapi.SessionState) bool {
+	tokenType, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	return ok && tokenType == "Bearer" && token != "" && session.AccessToken == token
+}
+
 // authOnlyAuthorize handles special authorization logic that is only done
 // on the AuthOnly endpoint for use with Nginx subrequest architectures.
 func authOnlyAuthorize(req *http.Request, s *sessionsapi.SessionState) bool {
@@ -1211,6 +2918,31 @@ func checkAllowedGroups(req *http.Request, s *sessionsapi.SessionState) bool {
 	return false
 }
 
+// checkAllowedRoles allow role restrictions based on the `allowed_roles`
+// querystring parameter, for the providers that know the roles of the user
+func (p *OAuthProxy) checkAllowedRoles(req *http.Request, s *sessionsapi.SessionState) bool {
+	// Allow requests previously allowed to be bypassed
+	if s == nil {
+		return true
+	}
+
+	allowedRoles := extractAllowedEntities(req, "allowed_roles")
+	if len(allowedRoles) == 0 {
+		return true
+	}
+
+	provider, ok := p.getProvider(s.ProviderID)
+	if !ok {
+		return false
+	}
+	for role := range allowedRoles {
+		if provider.HasRole(s, role) {
+			return true
+		}
+	}
+	return false
+}
+
 // checkAllowedEmails allow email restrictions based on the `allowed_emails`
 // querystring parameter
 func checkAllowedEmails(req *http.Request, s *sessionsapi.SessionState) bool {
@@ -1231,6 +2963,71 @@ func checkAllowedEmails(req *http.Request, s *sessionsapi.SessionState) bool {
 	return allowed
 }
 
+// errCSRFMismatch is returned when the OAuth state reflected by the provider
+// was not issued for the CSRF cookie of the request
+var errCSRFMismatch = errors.New("CSRF token mismatch, potential attack")
+
+// oauthFlow is what the callback of an authentication flow needs from the
+// start of it
+type oauthFlow struct {
+	redirect     string
+	providerID   string
+	codeVerifier string
+}
+
+// makeState builds the OAuth state param of an authentication flow started
+// with the CSRF, signing it when signed states are enabled
+func (p *OAuthProxy) makeState(csrf cookies.CSRF, redirect string) (string, error) {
+	if p.usedStates == nil {
+		return encodeState(csrf.HashOAuthState(), redirect, p.encodeState), nil
+	}
+
+	state, err := cookies.NewOAuthState(csrf, redirect)
+	if err != nil {
+		return "", err
+	}
+	return state.Encode(p.CookieOptions, time.Now())
+}
+
+// loadState reads the authentication flow back from the OAuth state param
+// reflected by the provider, checking that it was issued for the CSRF.
+// Signed states are also checked to be unexpired and not used before.
+func (p *OAuthProxy) loadState(req *http.Request, csrf cookies.CSRF) (*oauthFlow, error) {
+	if p.usedStates == nil {
+		nonce, redirect, err := decodeState(req.Form.Get("state"), p.encodeState)
+		if err != nil {
+			return nil, err
+		}
+		if !csrf.CheckOAuthState(nonce) {
+			return nil, errCSRFMismatch
+		}
+		return &oauthFlow{
+			redirect:     redirect,
+			providerID:   csrf.GetProviderID(),
+			codeVerifier: csrf.GetCodeVerifier(),
+		}, nil
+	}
+
+	state, err := cookies.DecodeOAuthState(req.Form.Get("state"), p.CookieOptions)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCSRFMismatch, err)
+	}
+	if !csrf.CheckOAuthState(state.CSRF) {
+		return nil, errCSRFMismatch
+	}
+	// Signed states are valid for the CSRF expiry, plus the clock skew
+	// allowed when validating their timestamp
+	now := time.Now()
+	if !p.usedStates.Use(state.ID, now.Add(p.CookieOptions.CSRFExpire+5*time.Minute), now) {
+		return nil, fmt.Errorf("%w: state has been used before", errCSRFMismatch)
+	}
+	return &oauthFlow{
+		redirect:     state.Redirect,
+		providerID:   state.ProviderID,
+		codeVerifier: state.CodeVerifier,
+	}, nil
+}
+
 // encodedState builds the OAuth state param out of our nonce and
 // original application redirect
 func encodeState(nonce string, redirect string, encode bool) string {
@@ -1269,31 +3066,84 @@ func (p *OAuthProxy) addHeadersForProxying(rw http.ResponseWriter, session *sess
 	}
 }
 
-// isAjax checks if a request is an ajax request
-func isAjax(req *http.Request) bool {
-	acceptValues := req.Header.Values("Accept")
-	const ajaxReq = applicationJSON
+// isJSONRequest checks if a request should be answered with JSON errors,
+// because it accepts one of the JSON error media types, or has one of the
+// JSON error headers, such as the X-Requested-With header of AJAX requests
+func (p *OAuthProxy) isJSONRequest(req *http.Request) bool {
+	for _, header := range p.jsonErrors.Headers {
+		if req.Header.Get(header) != "" {
+			return true
+		}
+	}
+
 	// Iterate over multiple Accept headers, i.e.
 	// Accept: application/json
 	// Accept: text/plain
-	for _, mimeTypes := range acceptValues {
+	for _, mimeTypes := range req.Header.Values("Accept") {
 		// Iterate over multiple mimetypes in a single header, i.e.
 		// Accept: application/json, text/plain, */*
-		for _, mimeType := range strings.Split(mimeTypes, ",") {
-			mimeType = strings.TrimSpace(mimeType)
-			if mimeType == ajaxReq {
-				return true
+		for _, accepted := range strings.Split(mimeTypes, ",") {
+			mimeType, params, err := mime.ParseMediaType(accepted)
+			if err != nil {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				// A quality of 0 means the media type is not acceptable
+				continue
+			}
+			for _, jsonType := range p.jsonErrors.AcceptTypes {
+				if strings.EqualFold(mimeType, jsonType) {
+					return true
+				}
 			}
 		}
 	}
 	return false
 }
 
-// errorJSON returns the error code with an application/json mime type
-func (p *OAuthProxy) errorJSON(rw http.ResponseWriter, code int) {
+// jsonError is the body of the JSON error responses
+type jsonError struct {
+	// Error is the code of the error, login_required or access_denied
+	Error string `json:"error"`
+	// Description describes the error
+	Description string `json:"error_description"`
+	// LoginURL is the URL of the sign in page of unauthenticated requests,
+	// redirecting back to the request after signing in
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// errorJSON returns the error code with an application/json mime type, and
+// a body describing the error, ErrNeedsLogin or ErrAccessDenied
+func (p *OAuthProxy) errorJSON(rw http.ResponseWriter, req *http.Request, code int, err error) {
+	body := jsonError{
+		Error:       "access_denied",
+		Description: "The session failed authorization checks",
+	}
+	switch err {
+	case ErrNeedsLogin:
+		body = jsonError{
+			Error:       "login_required",
+			Description: "Authentication is required to access this resource",
+			LoginURL:    p.SignInPath,
+		}
+		if redirect, err := p.appDirector.GetRedirect(req); err == nil {
+			body.LoginURL += "?" + url.Values{"rd": {redirect}}.Encode()
+		}
+	case ErrStepUpRequired:
+		body = jsonError{
+			Error:       "insufficient_user_authentication",
+			Description: "A stronger authentication is required to access this resource",
+		}
+	case ErrInsufficientScope:
+		body = jsonError{
+			Error:       "insufficient_scope",
+			Description: "The access token requires more scopes to access this resource",
+		}
+	}
+
 	rw.Header().Set("Content-Type", applicationJSON)
 	rw.WriteHeader(code)
-	// we need to send some JSON response because we set the Content-Type to
-	// application/json
-	rw.Write([]byte("{}"))
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Errorf("Error encoding JSON error: %v", err)
+	}
 }
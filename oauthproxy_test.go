@@ -3,12 +3,20 @@ package main
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -21,9 +29,11 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/cookies"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/readiness"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/whoami"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -58,6 +68,69 @@ func TestRobotsTxt(t *testing.T) {
 	assert.Equal(t, "User-agent: *\nDisallow: /\n", rw.Body.String())
 }
 
+func TestOpenAPIDocument(t *testing.T) {
+	opts := baseTestOptions()
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/openapi.json", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+	var doc struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &doc))
+	assert.Contains(t, doc.Paths, "/oauth2/userinfo")
+}
+
+func TestReadyEndpoint(t *testing.T) {
+	discovery := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer discovery.Close()
+
+	opts := baseTestOptions()
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2/ready", nil)
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+	var result readiness.Result
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &result))
+	assert.Equal(t, readiness.StatusOK, result.Status)
+	assert.Equal(t, readiness.StatusOK, result.Checks["session store"].Status)
+
+	// The discovery endpoint of the provider is checked once it is set
+	opts.Providers[0].OIDCConfig.IssuerURL = discovery.URL
+	proxy, err = NewOAuthProxy(opts, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw = httptest.NewRecorder()
+	proxy.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+
+	assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &result))
+	assert.Equal(t, readiness.StatusError, result.Status)
+	assert.Equal(t, readiness.StatusError, result.Checks[`provider "providerID" discovery`].Status)
+	assert.Contains(t, result.Checks[`provider "providerID" discovery`].Error, "unexpected status code 500")
+}
+
 type TestProvider struct {
 	*providers.ProviderData
 	EmailAddress   string
@@ -114,7 +187,7 @@ func Test_redeemCode(t *testing.T) {
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	_, err = proxy.redeemCode(req, "")
+	_, err = proxy.redeemCode(req, proxy.provider, proxy.getOAuthRedirectURI(req, ""), "")
 	assert.Equal(t, providers.ErrMissingCode, err)
 }
 
@@ -166,7 +239,7 @@ func Test_enrichSession(t *testing.T) {
 			}
 			proxy.provider = NewTestProvider(&url.URL{Host: "www.example.com"}, providerEmail)
 
-			err = proxy.enrichSessionState(context.Background(), tc.session)
+			err = proxy.enrichSessionState(context.Background(), proxy.provider, tc.session)
 			assert.NoError(t, err)
 			assert.Equal(t, tc.expectedUser, tc.session.User)
 			assert.Equal(t, tc.expectedEmail, tc.session.Email)
@@ -711,6 +784,30 @@ func TestManualSignInCorrectCredentials(t *testing.T) {
 	assert.Equal(t, http.StatusFound, statusCode)
 }
 
+func TestManualSignInLockout(t *testing.T) {
+	opts := baseTestOptions()
+	opts.HtpasswdFile = "pkg/authentication/basic/test/htpasswd-sha1.txt"
+	opts.HtpasswdLockout.Threshold = 2
+	require.NoError(t, validation.Validate(opts))
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	signIn := func(user, pass string) int {
+		formData := url.Values{"username": {user}, "password": {pass}}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/sign_in", strings.NewReader(formData.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, signIn("admin", "wrong"))
+	// The next attempts are rejected without checking the password, even
+	// when it is right
+	assert.Equal(t, http.StatusTooManyRequests, signIn("admin", "Adm1n1str$t0r"))
+	assert.Equal(t, http.StatusTooManyRequests, signIn("other", "wrong"))
+}
+
 func TestSignInPageIncludesTargetRedirect(t *testing.T) {
 	sipTest, err := NewSignInPageTest(false)
 	if err != nil {
@@ -797,6 +894,468 @@ func TestSignInPageSkipProviderDirect(t *testing.T) {
 	}
 }
 
+func TestMultipleProviders(t *testing.T) {
+	opts := baseTestOptions()
+	opts.Providers[0].Name = "Google"
+	opts.Providers = append(opts.Providers, options.Provider{
+		ID:           "github",
+		Type:         options.GitHubProvider,
+		Name:         "GitHub",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Hosts:        []string{"github.example.com"},
+	})
+	require.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	serve := func(host, path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("sign in page offers each provider", func(t *testing.T) {
+		rw := serve("app.example.com", "/oauth2/sign_in")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), "Sign in with Google")
+		assert.Contains(t, rw.Body.String(), "Sign in with GitHub")
+		assert.Contains(t, rw.Body.String(), `name="provider" value="github"`)
+	})
+
+	t.Run("sign in page offers the provider for the host", func(t *testing.T) {
+		rw := serve("github.example.com", "/oauth2/sign_in")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "Sign in with Google")
+		assert.Contains(t, rw.Body.String(), "Sign in with GitHub")
+	})
+
+	for _, tc := range []struct {
+		name      string
+		host      string
+		path      string
+		loginHost string
+	}{
+		{name: "default provider", host: "app.example.com", path: "/oauth2/start", loginHost: "accounts.google.com"},
+		{name: "provider query parameter", host: "app.example.com", path: "/oauth2/start?provider=github", loginHost: "github.com"},
+		{name: "provider for the host", host: "github.example.com", path: "/oauth2/start", loginHost: "github.com"},
+		{name: "query parameter overrides the host", host: "github.example.com", path: "/oauth2/start?provider=providerID", loginHost: "accounts.google.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := serve(tc.host, tc.path)
+			require.Equal(t, http.StatusFound, rw.Code)
+
+			loginURL, err := url.Parse(rw.Header().Get("Location"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.loginHost, loginURL.Host)
+		})
+	}
+
+	t.Run("unknown provider", func(t *testing.T) {
+		rw := serve("app.example.com", "/oauth2/start?provider=unknown")
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestOAuthCallbackInteractionRequired(t *testing.T) {
+	opts := baseTestOptions()
+	opts.Providers[0].LoginURLParameters = []options.LoginURLParameter{
+		{Name: "prompt", Default: []string{"none"}},
+	}
+	require.NoError(t, validation.Validate(opts))
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	serve := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	// callback returns the provider's error response to the login started by rw
+	callback := func(rw *httptest.ResponseRecorder, oauthError string) *httptest.ResponseRecorder {
+		loginURL, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		query := url.Values{"error": {oauthError}, "state": {loginURL.Query().Get("state")}}
+		return serve("/oauth2/callback?"+query.Encode(), rw.Result().Cookies())
+	}
+	prompt := func(rw *httptest.ResponseRecorder) string {
+		loginURL, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		return loginURL.Query().Get("prompt")
+	}
+
+	rw := serve("/oauth2/start?rd=%2Fapp", nil)
+	require.Equal(t, http.StatusFound, rw.Code)
+	assert.Equal(t, "none", prompt(rw))
+
+	// Signing in without interaction is retried once with an interactive prompt
+	rw = callback(rw, "consent_required")
+	require.Equal(t, http.StatusFound, rw.Code)
+	assert.Equal(t, "consent", prompt(rw))
+	loginURL, err := url.Parse(rw.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(loginURL.Query().Get("state"), ":/app"))
+
+	rw = callback(rw, "interaction_required")
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Body.String(), "complete an additional step")
+
+	// Other errors are reported as before
+	rw = callback(serve("/oauth2/start", nil), "access_denied")
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Body.String(), "The upstream identity provider returned an error: access_denied")
+}
+
+func TestSignedOAuthState(t *testing.T) {
+	opts := baseTestOptions()
+	opts.SignedState = true
+	opts.Providers[0].LoginURLParameters = []options.LoginURLParameter{
+		{Name: "prompt", Default: []string{"none"}},
+	}
+	require.NoError(t, validation.Validate(opts))
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	serve := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	state := func(rw *httptest.ResponseRecorder) string {
+		loginURL, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		return loginURL.Query().Get("state")
+	}
+	callback := func(state string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		query := url.Values{"error": {"login_required"}, "state": {state}}
+		return serve("/oauth2/callback?"+query.Encode(), cookies)
+	}
+
+	start := serve("/oauth2/start?rd=%2Fapp", nil)
+	require.Equal(t, http.StatusFound, start.Code)
+	signed := state(start)
+	assert.NotContains(t, signed, "/app")
+
+	t.Run("with a tampered state", func(t *testing.T) {
+		rw := callback(signed+"tampered", start.Result().Cookies())
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("with the CSRF cookie of another flow", func(t *testing.T) {
+		other := serve("/oauth2/start?rd=%2Fother", nil)
+		rw := callback(signed, other.Result().Cookies())
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("with a valid state used twice", func(t *testing.T) {
+		rw := callback(signed, start.Result().Cookies())
+		require.Equal(t, http.StatusFound, rw.Code)
+		assert.NotEqual(t, signed, state(rw))
+
+		rw = callback(signed, start.Result().Cookies())
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
+
+func TestVirtualHosts(t *testing.T) {
+	globalCode := http.StatusOK
+	vhostCode := http.StatusAccepted
+	pcTest, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+		opts.Providers = append(opts.Providers, options.Provider{
+			ID:           "github",
+			Type:         options.GitHubProvider,
+			Name:         "GitHub",
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+		})
+		opts.UpstreamServers = options.UpstreamConfig{
+			Upstreams: []options.Upstream{{ID: "global", Path: "/", Static: true, StaticCode: &globalCode}},
+		}
+		opts.VirtualHosts = options.VirtualHosts{
+			{
+				Hosts:      []string{"app.example.com"},
+				ProviderID: "github",
+				Upstreams: options.UpstreamConfig{
+					Upstreams: []options.Upstream{{ID: "app", Path: "/", Static: true, StaticCode: &vhostCode}},
+				},
+				CookieDomain:  ".example.com",
+				AllowedGroups: []string{"admins"},
+			},
+		}
+	})
+	require.NoError(t, err)
+
+	session := func(providerID string, groups ...string) []*http.Cookie {
+		pcTest.req = httptest.NewRequest(http.MethodGet, "/", nil)
+		pcTest.rw = httptest.NewRecorder()
+		created := time.Now()
+		require.NoError(t, pcTest.SaveSession(&sessions.SessionState{
+			Email:       "john.doe@example.com",
+			AccessToken: "access",
+			Groups:      groups,
+			ProviderID:  providerID,
+			CreatedAt:   &created,
+		}))
+		return pcTest.req.Cookies()
+	}
+	serve := func(host, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		pcTest.proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("proxies to the upstreams of the virtual host", func(t *testing.T) {
+		cookies := session("github", "admins")
+		assert.Equal(t, vhostCode, serve("app.example.com", "/", cookies).Code)
+		assert.Equal(t, globalCode, serve("other.example.com", "/", cookies).Code)
+	})
+
+	t.Run("requires a session of the virtual host provider", func(t *testing.T) {
+		rw := serve("app.example.com", "/", session("", "admins"))
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Contains(t, rw.Body.String(), "Sign in with GitHub")
+	})
+
+	t.Run("requires a member of the allowed groups", func(t *testing.T) {
+		rw := serve("app.example.com", "/", session("github", "users"))
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "Sign in with")
+		assert.Empty(t, rw.Result().Cookies())
+	})
+
+	t.Run("signs in with the provider and cookie domain of the virtual host", func(t *testing.T) {
+		rw := serve("app.example.com", "/oauth2/start", nil)
+		require.Equal(t, http.StatusFound, rw.Code)
+
+		loginURL, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "github.com", loginURL.Host)
+
+		require.NotEmpty(t, rw.Result().Cookies())
+		for _, cookie := range rw.Result().Cookies() {
+			assert.Equal(t, "example.com", cookie.Domain)
+		}
+	})
+}
+
+func TestSessionHandoff(t *testing.T) {
+	const startURL = "https://b.example.net/oauth2/handoff/start?rd=%2Fapp"
+
+	withHandoff := func(opts *options.Options) {
+		opts.Handoff.Secret = "a secret shared by sibling proxies"
+		opts.Handoff.AllowedDomains = []string{"b.example.net"}
+		opts.Handoff.URL = "https://a.example.com/oauth2/handoff"
+	}
+	issuer, err := NewProcessCookieTestWithOptionsModifiers(withHandoff)
+	require.NoError(t, err)
+	redeemer, err := NewProcessCookieTestWithOptionsModifiers(withHandoff)
+	require.NoError(t, err)
+
+	created := time.Now()
+	expires := created.Add(time.Hour)
+	require.NoError(t, issuer.SaveSession(&sessions.SessionState{
+		Email:        "john.doe@example.com",
+		User:         "john.doe",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		CreatedAt:    &created,
+		ExpiresOn:    &expires,
+	}))
+
+	serve := func(test *ProcessCookieTest, location string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, location, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		test.proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	start := func() (string, []*http.Cookie) {
+		rw := serve(redeemer, startURL, nil)
+		require.Equal(t, http.StatusFound, rw.Code)
+		return rw.Header().Get("Location"), rw.Result().Cookies()
+	}
+	handoff := func(location string) string {
+		rw := serve(issuer, location, issuer.req.Cookies())
+		require.Equal(t, http.StatusFound, rw.Code)
+		return rw.Header().Get("Location")
+	}
+
+	location, nonceCookies := start()
+	require.Len(t, nonceCookies, 1)
+	assert.Equal(t, "_oauth2_proxy_handoff", nonceCookies[0].Name)
+	target, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.Equal(t, "a.example.com", target.Host)
+	assert.Equal(t, "/oauth2/handoff", target.Path)
+	assert.Equal(t, "https://b.example.net/oauth2/handoff/redeem?rd=%2Fapp", target.Query().Get("rd"))
+	assert.NotEmpty(t, target.Query().Get("nonce"))
+	assert.NotContains(t, location, nonceCookies[0].Value)
+
+	location = handoff(location)
+	assert.True(t, strings.HasPrefix(location, "https://b.example.net/oauth2/handoff/redeem?"), location)
+
+	rw := serve(redeemer, location, nonceCookies)
+	require.Equal(t, http.StatusFound, rw.Code)
+	assert.Equal(t, "/app", rw.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodGet, "https://b.example.net/app", nil)
+	for _, cookie := range rw.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	session, err := redeemer.proxy.LoadCookiedSession(req)
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe@example.com", session.Email)
+	assert.Equal(t, "access", session.AccessToken)
+	assert.Empty(t, session.RefreshToken)
+
+	t.Run("codes are redeemed once", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(redeemer, location, nonceCookies).Code)
+	})
+
+	t.Run("codes are bound to the browser that started the handoff", func(t *testing.T) {
+		location, _ := start()
+		location = handoff(location)
+		assert.Equal(t, http.StatusForbidden, serve(redeemer, location, nil).Code)
+
+		_, otherCookies := start()
+		assert.Equal(t, http.StatusForbidden, serve(redeemer, location, otherCookies).Code)
+	})
+
+	t.Run("codes are bound to the sibling they were minted for", func(t *testing.T) {
+		location, cookies := start()
+		other := strings.Replace(handoff(location), "b.example.net", "c.example.net", 1)
+		assert.Equal(t, http.StatusForbidden, serve(redeemer, other, cookies).Code)
+	})
+
+	t.Run("codes are only minted for a nonce", func(t *testing.T) {
+		location := "https://a.example.com/oauth2/handoff?rd=" + url.QueryEscape("https://b.example.net/oauth2/handoff/redeem")
+		assert.Equal(t, http.StatusBadRequest, serve(issuer, location, issuer.req.Cookies()).Code)
+	})
+
+	t.Run("siblings must be on an allowed domain", func(t *testing.T) {
+		location := "https://a.example.com/oauth2/handoff?nonce=digest&rd=" + url.QueryEscape("https://evil.example.org/oauth2/handoff/redeem")
+		assert.Equal(t, http.StatusBadRequest, serve(issuer, location, issuer.req.Cookies()).Code)
+	})
+
+	t.Run("users without a session sign in first", func(t *testing.T) {
+		location, _ := start()
+		rw := serve(issuer, location, nil)
+		require.Equal(t, http.StatusFound, rw.Code)
+
+		signIn, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/oauth2/sign_in", signIn.Path)
+		assert.Equal(t, strings.TrimPrefix(location, "https://a.example.com"), signIn.Query().Get("rd"))
+	})
+}
+
+func TestOIDCIssuer(t *testing.T) {
+	const redirectURI = "https://wiki.example.com/oidc/callback"
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "issuer.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+
+	test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+		opts.OIDCIssuer.SigningKeyFile = keyFile
+		opts.OIDCIssuer.Clients = []string{"wiki:wiki-secret:" + redirectURI}
+	})
+	require.NoError(t, err)
+	require.NoError(t, test.SaveSession(&sessions.SessionState{
+		Email:       "john.doe@example.com",
+		User:        "john.doe",
+		AccessToken: "access",
+	}))
+
+	authorize := func(query url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "https://auth.example.com/oauth2/oidc/authorize?"+query.Encode(), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		test.proxy.ServeHTTP(rw, req)
+		return rw
+	}
+	authQuery := url.Values{
+		"client_id":     {"wiki"},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {"xyz"},
+	}
+
+	rw := authorize(authQuery, test.req.Cookies())
+	require.Equal(t, http.StatusFound, rw.Code)
+	callback, err := url.Parse(rw.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "wiki.example.com", callback.Host)
+	assert.Equal(t, "xyz", callback.Query().Get("state"))
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {callback.Query().Get("code")}, "redirect_uri": {redirectURI}}
+	req := httptest.NewRequest(http.MethodPost, "https://auth.example.com/oauth2/oidc/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("wiki", "wiki-secret")
+	rw = httptest.NewRecorder()
+	test.proxy.ServeHTTP(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &tokens))
+	verifier := oidc.NewVerifier("https://auth.example.com/oauth2/oidc", &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key.Public()}},
+		&oidc.Config{ClientID: "wiki", SupportedSigningAlgs: []string{oidc.ES256}})
+	idToken, err := verifier.Verify(context.Background(), tokens.IDToken)
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe", idToken.Subject)
+
+	t.Run("unknown clients are rejected", func(t *testing.T) {
+		query := url.Values{"client_id": {"other"}, "redirect_uri": {redirectURI}, "response_type": {"code"}, "scope": {"openid"}}
+		assert.Equal(t, http.StatusBadRequest, authorize(query, test.req.Cookies()).Code)
+	})
+
+	t.Run("users without a session sign in first", func(t *testing.T) {
+		rw := authorize(authQuery, nil)
+		require.Equal(t, http.StatusFound, rw.Code)
+
+		signIn, err := url.Parse(rw.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/oauth2/sign_in", signIn.Path)
+		assert.Equal(t, "/oauth2/oidc/authorize?"+authQuery.Encode(), signIn.Query().Get("rd"))
+	})
+
+	t.Run("users without a session are not signed in with prompt=none", func(t *testing.T) {
+		query := url.Values{"prompt": {"none"}}
+		for name, values := range authQuery {
+			query[name] = values
+		}
+		rw := authorize(query, nil)
+		require.Equal(t, http.StatusFound, rw.Code)
+		assert.Equal(t, redirectURI+"?error=login_required&state=xyz", rw.Header().Get("Location"))
+	})
+}
+
 type ProcessCookieTest struct {
 	opts         *options.Options
 	proxy        *OAuthProxy
@@ -1060,6 +1619,145 @@ func TestUserInfoEndpointUnauthorizedOnNoCookieSetError(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, test.rw.Code)
 }
 
+func TestWhoAmIEndpoint(t *testing.T) {
+	testCases := []struct {
+		name               string
+		enabled            bool
+		validateUser       bool
+		expectedStatus     int
+		expectedAuthorized bool
+	}{
+		{
+			name:               "Authorized user",
+			enabled:            true,
+			validateUser:       true,
+			expectedStatus:     http.StatusOK,
+			expectedAuthorized: true,
+		},
+		{
+			name:               "Unauthorized user",
+			enabled:            true,
+			validateUser:       false,
+			expectedStatus:     http.StatusOK,
+			expectedAuthorized: false,
+		},
+		{
+			name:           "Disabled",
+			enabled:        false,
+			validateUser:   true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.WhoAmI.Enabled = tc.enabled
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.req, _ = http.NewRequest("GET", test.opts.ProxyPrefix+"/whoami", nil)
+			test.validateUser = tc.validateUser
+
+			err = test.SaveSession(&sessions.SessionState{
+				User:         "john.doe",
+				Email:        "john.doe@example.com",
+				Groups:       []string{"example"},
+				AccessToken:  "my_access_token",
+				RefreshToken: "my_refresh_token",
+			})
+			assert.NoError(t, err)
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+			assert.Equal(t, tc.expectedStatus, test.rw.Code)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var snapshot whoami.Snapshot
+			assert.NoError(t, json.NewDecoder(test.rw.Body).Decode(&snapshot))
+			assert.Equal(t, "john.doe@example.com", snapshot.Email)
+			assert.Equal(t, []string{"example"}, snapshot.Groups)
+			assert.Equal(t, []string{"access_token", "refresh_token"}, snapshot.Tokens)
+			assert.Equal(t, tc.expectedAuthorized, snapshot.Authorized)
+		})
+	}
+}
+
+func TestUpstreamLogoutEndpoint(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		authorization  string
+		withSession    bool
+		expectedStatus int
+	}{
+		{
+			name:           "Revokes the session",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			withSession:    true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Wrong secret",
+			method:         http.MethodPost,
+			authorization:  "Bearer wrong",
+			withSession:    true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "No session",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			withSession:    false,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodGet,
+			authorization:  "Bearer secret",
+			withSession:    true,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.UpstreamLogout.Secret = "secret"
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.req, _ = http.NewRequest(tc.method, test.opts.ProxyPrefix+"/upstream_logout", nil)
+			test.req.Header.Set("Authorization", tc.authorization)
+
+			if tc.withSession {
+				err = test.SaveSession(&sessions.SessionState{
+					Email:       "john.doe@example.com",
+					AccessToken: "my_access_token",
+				})
+				assert.NoError(t, err)
+				test.rw = httptest.NewRecorder()
+			}
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+			assert.Equal(t, tc.expectedStatus, test.rw.Code)
+			if tc.expectedStatus != http.StatusNoContent {
+				return
+			}
+
+			cookies := test.rw.Result().Cookies()
+			if assert.Len(t, cookies, 1) {
+				assert.Equal(t, test.opts.Cookie.Name, cookies[0].Name)
+				assert.Equal(t, "", cookies[0].Value)
+			}
+		})
+	}
+}
+
 func TestEncodedUrlsStayEncoded(t *testing.T) {
 	encodeTest, err := NewSignInPageTest(false)
 	if err != nil {
@@ -1099,6 +1797,27 @@ func TestAuthOnlyEndpointAccepted(t *testing.T) {
 	assert.Equal(t, "", string(bodyBytes))
 }
 
+func TestAuthOnlyEndpointUnauthorizedOnStepUpRoute(t *testing.T) {
+	test, err := NewAuthOnlyEndpointTest("", func(opts *options.Options) {
+		opts.ReverseProxy = true
+		opts.StepUpRoutes = []string{"^/admin/ mfa"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.req.Header.Set("X-Forwarded-Uri", "/admin/users")
+
+	created := time.Now()
+	startSession := &sessions.SessionState{
+		Email: "michael.bland@gsa.gov", AccessToken: "my_access_token", CreatedAt: &created, AMR: []string{"pwd"}}
+	err = test.SaveSession(startSession)
+	assert.NoError(t, err)
+
+	test.proxy.ServeHTTP(test.rw, test.req)
+	assert.Equal(t, http.StatusUnauthorized, test.rw.Code)
+	assert.Equal(t, `Bearer error="insufficient_user_authentication", error_description="A stronger authentication is required"`, test.rw.Header().Get("WWW-Authenticate"))
+}
+
 func TestAuthOnlyEndpointUnauthorizedOnNoCookieSetError(t *testing.T) {
 	test, err := NewAuthOnlyEndpointTest("")
 	if err != nil {
@@ -1642,63 +2361,497 @@ func newAjaxRequestTest(forceJSONErrors bool) (*ajaxRequestTest, error) {
 		return nil, err
 	}
 
-	test.proxy, err = NewOAuthProxy(test.opts, func(email string) bool {
-		return true
-	})
-	if err != nil {
-		return nil, err
+	test.proxy, err = NewOAuthProxy(test.opts, func(email string) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+func (test *ajaxRequestTest) getEndpoint(endpoint string, header http.Header) (int, http.Header, []byte, error) {
+	rw := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, endpoint, strings.NewReader(""))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header = header
+	test.proxy.ServeHTTP(rw, req)
+	return rw.Code, rw.Header(), rw.Body.Bytes(), nil
+}
+
+func testAjaxUnauthorizedRequest(t *testing.T, header http.Header, forceJSONErrors bool) {
+	test, err := newAjaxRequestTest(forceJSONErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := "/test"
+
+	code, rh, body, err := test.getEndpoint(endpoint, header)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	mime := rh.Get("Content-Type")
+	assert.Equal(t, applicationJSON, mime)
+
+	var jsonErr jsonError
+	assert.NoError(t, json.Unmarshal(body, &jsonErr))
+	assert.Equal(t, jsonError{
+		Error:       "login_required",
+		Description: "Authentication is required to access this resource",
+		LoginURL:    "/oauth2/sign_in?rd=%2Ftest",
+	}, jsonErr)
+}
+func TestAjaxUnauthorizedRequest1(t *testing.T) {
+	header := make(http.Header)
+	header.Add("accept", applicationJSON)
+
+	testAjaxUnauthorizedRequest(t, header, false)
+}
+
+func TestAjaxUnauthorizedRequest2(t *testing.T) {
+	header := make(http.Header)
+	header.Add("Accept", applicationJSON)
+
+	testAjaxUnauthorizedRequest(t, header, false)
+}
+
+func TestAjaxUnauthorizedRequestAccept1(t *testing.T) {
+	header := make(http.Header)
+	header.Add("Accept", "application/json, text/plain, */*")
+
+	testAjaxUnauthorizedRequest(t, header, false)
+}
+
+func TestForceJSONErrorsUnauthorizedRequest(t *testing.T) {
+	testAjaxUnauthorizedRequest(t, nil, true)
+}
+
+func TestAjaxUnauthorizedRequestQuality(t *testing.T) {
+	header := make(http.Header)
+	header.Add("Accept", "text/html, application/json;q=0.5")
+
+	testAjaxUnauthorizedRequest(t, header, false)
+}
+
+func TestAjaxUnauthorizedRequestedWith(t *testing.T) {
+	header := make(http.Header)
+	header.Add("X-Requested-With", "XMLHttpRequest")
+
+	testAjaxUnauthorizedRequest(t, header, false)
+}
+
+func TestJSONErrorsNegotiation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   http.Header
+		expected bool
+	}{
+		{
+			name:     "without headers",
+			header:   http.Header{},
+			expected: false,
+		},
+		{
+			name:     "accepting HTML",
+			header:   http.Header{"Accept": {"text/html,application/xhtml+xml,*/*;q=0.8"}},
+			expected: false,
+		},
+		{
+			name:     "accepting a configured media type",
+			header:   http.Header{"Accept": {"Application/Problem+JSON"}},
+			expected: true,
+		},
+		{
+			name:     "refusing a configured media type",
+			header:   http.Header{"Accept": {"text/html, application/problem+json;q=0"}},
+			expected: false,
+		},
+		{
+			name:     "with a configured header",
+			header:   http.Header{"X-Api-Client": {"cli"}},
+			expected: true,
+		},
+		{
+			name:     "with a header that is not configured",
+			header:   http.Header{"X-Requested-With": {"XMLHttpRequest"}},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &OAuthProxy{jsonErrors: options.JSONErrors{
+				AcceptTypes: []string{"application/problem+json"},
+				Headers:     []string{"X-Api-Client"},
+			}}
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header = tc.header
+			assert.Equal(t, tc.expected, p.isJSONRequest(req))
+		})
+	}
+}
+
+func TestAuthRouteLoginActions(t *testing.T) {
+	opts := baseTestOptions()
+	opts.AuthRoutes = []string{
+		"login=redirect:^/app/",
+		"required,login=401:^/api/",
+		"login=403:POST=^/forms/",
+	}
+	opts.APIRoutes = []string{"^/app/api/"}
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		header       http.Header
+		expectedCode int
+		expectedJSON string
+	}{
+		{
+			name:         "redirect route with a JSON request",
+			method:       http.MethodGet,
+			path:         "/app/api/items",
+			header:       http.Header{"Accept": {applicationJSON}},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "401 route",
+			method:       http.MethodGet,
+			path:         "/api/items",
+			header:       http.Header{},
+			expectedCode: http.StatusUnauthorized,
+			expectedJSON: `{"error":"login_required","error_description":"Authentication is required to access this resource","login_url":"/oauth2/sign_in?rd=%2Fapi%2Fitems"}`,
+		},
+		{
+			name:         "403 route",
+			method:       http.MethodPost,
+			path:         "/forms/contact",
+			header:       http.Header{},
+			expectedCode: http.StatusForbidden,
+			expectedJSON: `{"error":"login_required","error_description":"Authentication is required to access this resource","login_url":"/oauth2/sign_in?rd=%2Fforms%2Fcontact"}`,
+		},
+		{
+			name:         "403 route with another method",
+			method:       http.MethodGet,
+			path:         "/forms/contact",
+			header:       http.Header{},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "no route with a JSON request",
+			method:       http.MethodGet,
+			path:         "/other",
+			header:       http.Header{"Accept": {applicationJSON}},
+			expectedCode: http.StatusUnauthorized,
+			expectedJSON: `{"error":"login_required","error_description":"Authentication is required to access this resource","login_url":"/oauth2/sign_in?rd=%2Fother"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header = tc.header
+			proxy.ServeHTTP(rw, req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			if tc.expectedJSON == "" {
+				assert.Contains(t, rw.Body.String(), "<!DOCTYPE html>")
+				return
+			}
+			assert.Equal(t, applicationJSON, rw.Header().Get("Content-Type"))
+			assert.JSONEq(t, tc.expectedJSON, rw.Body.String())
+		})
+	}
+}
+
+func TestAuthRouteLoginActionsWithoutMode(t *testing.T) {
+	opts := baseTestOptions()
+	opts.AuthRoutes = []string{
+		"login=401:^/public/",
+		"login=403:^/docs/[^ ]+\\.pdf$",
+	}
+	opts.SkipAuthRoutes = []string{"^/public/"}
+	assert.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/public/index.html", nil)
+	assert.Equal(t, options.AuthModeSkip, proxy.getAuthMode(req), "a route without a mode should not override the skip auth routes")
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/guide.pdf", nil)
+	assert.Equal(t, options.AuthModeRequired, proxy.getAuthMode(req))
+	assert.Equal(t, options.LoginActionForbidden, proxy.getLoginAction(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/guide.html", nil)
+	assert.Equal(t, options.LoginActionRedirect, proxy.getLoginAction(req))
+}
+
+func TestStepUpRoutes(t *testing.T) {
+	created := time.Now()
+	recentAuth := created.Add(-time.Minute)
+	oldAuth := created.Add(-time.Hour)
+	testCases := []struct {
+		name           string
+		path           string
+		session        *sessions.SessionState
+		header         http.Header
+		stepUpCookie   string
+		expectedCode   int
+		expectedParams url.Values
+		expectedJSON   string
+	}{
+		{
+			name:         "satisfied requirements",
+			path:         "/admin/users",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created, ACR: "phrh", AMR: []string{"pwd", "mfa"}},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:           "missing mfa",
+			path:           "/admin/users",
+			session:        &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created, ACR: "phrh", AMR: []string{"pwd"}},
+			expectedCode:   http.StatusFound,
+			expectedParams: url.Values{"acr_values": {"phrh phr"}, "prompt": {"login"}},
+		},
+		{
+			name:           "unknown acr",
+			path:           "/admin/users",
+			session:        &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created, ACR: "pwd", AMR: []string{"mfa"}},
+			expectedCode:   http.StatusFound,
+			expectedParams: url.Values{"acr_values": {"phrh phr"}, "prompt": {"login"}},
+		},
+		{
+			name:         "JSON request",
+			path:         "/admin/users",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created},
+			header:       http.Header{"Accept": {applicationJSON}},
+			expectedCode: http.StatusUnauthorized,
+			expectedJSON: `{"error":"insufficient_user_authentication","error_description":"A stronger authentication is required to access this resource"}`,
+		},
+		{
+			name:         "signed in again since the step up",
+			path:         "/admin/users",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created},
+			stepUpCookie: fmt.Sprintf("0.%d", created.Add(-time.Minute).Unix()),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:           "signed in again since the step up of another route",
+			path:           "/admin/users",
+			session:        &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created},
+			stepUpCookie:   fmt.Sprintf("1.%d", created.Add(-time.Minute).Unix()),
+			expectedCode:   http.StatusFound,
+			expectedParams: url.Values{"acr_values": {"phrh phr"}, "prompt": {"login"}},
+		},
+		{
+			name:         "recent authentication",
+			path:         "/transfers/new",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created, AuthTime: &recentAuth},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:           "old authentication",
+			path:           "/transfers/new",
+			session:        &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created, AuthTime: &oldAuth},
+			expectedCode:   http.StatusFound,
+			expectedParams: url.Values{"max_age": {"300"}, "prompt": {"login"}},
+		},
+		{
+			name:           "unknown authentication time",
+			path:           "/transfers/new",
+			session:        &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", CreatedAt: &created},
+			expectedCode:   http.StatusFound,
+			expectedParams: url.Values{"max_age": {"300"}, "prompt": {"login"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusAccepted)
+			}))
+			t.Cleanup(upstream.Close)
+
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.StepUpRoutes = []string{
+					"^/admin/ acr=phrh,phr mfa",
+					"^/billing/ mfa",
+					"^/transfers/ max-age=5m",
+				}
+				opts.UpstreamServers = options.UpstreamConfig{
+					Upstreams: []options.Upstream{{ID: "upstream", Path: "/", URI: upstream.URL}},
+				}
+			})
+			require.NoError(t, err)
+			test.proxy.provider.Data().LoginURL = &url.URL{Scheme: "https", Host: "idp.example.com", Path: "/authorize"}
+			test.req = httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for name, values := range tc.header {
+				test.req.Header[name] = values
+			}
+			require.NoError(t, test.SaveSession(tc.session))
+			if tc.stepUpCookie != "" {
+				test.req.AddCookie(&http.Cookie{Name: "_oauth2_proxy_step_up", Value: tc.stepUpCookie})
+			}
+
+			rw := httptest.NewRecorder()
+			test.proxy.ServeHTTP(rw, test.req)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+
+			if tc.expectedParams != nil {
+				location, err := url.Parse(rw.Header().Get("Location"))
+				require.NoError(t, err)
+				for name := range tc.expectedParams {
+					assert.Equal(t, tc.expectedParams.Get(name), location.Query().Get(name))
+				}
+				assert.Contains(t, rw.Header().Values("Set-Cookie")[0], "_oauth2_proxy_step_up=")
+			}
+			if tc.expectedJSON != "" {
+				assert.Equal(t, `Bearer error="insufficient_user_authentication", error_description="A stronger authentication is required", acr_values="phrh phr"`, rw.Header().Get("WWW-Authenticate"))
+				assert.JSONEq(t, tc.expectedJSON, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpstreamScopes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		path          string
+		session       *sessions.SessionState
+		header        http.Header
+		expectedCode  int
+		expectedScope string
+		expectedJSON  string
+	}{
+		{
+			name:         "upstream without scopes",
+			path:         "/",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token"},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "scopes of the provider",
+			path:         "/profile/",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token"},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:          "missing scopes",
+			path:          "/calendar/events",
+			session:       &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token"},
+			expectedCode:  http.StatusFound,
+			expectedScope: "openid email calendar.read",
+		},
+		{
+			name:          "missing scopes with scopes granted incrementally",
+			path:          "/calendar/events",
+			session:       &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", Scopes: []string{"drive.read"}},
+			expectedCode:  http.StatusFound,
+			expectedScope: "openid email drive.read calendar.read",
+		},
+		{
+			name:         "scopes granted incrementally",
+			path:         "/calendar/events",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token", Scopes: []string{"calendar.read"}},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "session without an access token",
+			path:         "/calendar/events",
+			session:      &sessions.SessionState{Email: "john.doe@example.com"},
+			expectedCode: http.StatusAccepted,
+		},
+		{
+			name:         "JSON request",
+			path:         "/calendar/events",
+			session:      &sessions.SessionState{Email: "john.doe@example.com", AccessToken: "my_access_token"},
+			header:       http.Header{"Accept": {applicationJSON}},
+			expectedCode: http.StatusForbidden,
+			expectedJSON: `{"error":"insufficient_scope","error_description":"The access token requires more scopes to access this resource"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusAccepted)
+			}))
+			t.Cleanup(upstream.Close)
+
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.UpstreamServers = options.UpstreamConfig{
+					Upstreams: []options.Upstream{
+						{ID: "upstream", Path: "/", URI: upstream.URL},
+						{ID: "profile", Path: "/profile/", URI: upstream.URL, Scopes: []string{"email"}},
+						{ID: "calendar", Path: "/calendar/", URI: upstream.URL, Scopes: []string{"calendar.read"}},
+					},
+				}
+			})
+			require.NoError(t, err)
+			test.proxy.provider.Data().LoginURL = &url.URL{Scheme: "https", Host: "idp.example.com", Path: "/authorize"}
+			test.proxy.provider.Data().Scope = "openid email"
+			test.req = httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for name, values := range tc.header {
+				test.req.Header[name] = values
+			}
+			require.NoError(t, test.SaveSession(tc.session))
+
+			rw := httptest.NewRecorder()
+			test.proxy.ServeHTTP(rw, test.req)
+			assert.Equal(t, tc.expectedCode, rw.Code)
+
+			if tc.expectedScope != "" {
+				location, err := url.Parse(rw.Header().Get("Location"))
+				require.NoError(t, err)
+				assert.Equal(t, []string{tc.expectedScope}, location.Query()["scope"])
+				assert.Equal(t, "true", location.Query().Get("include_granted_scopes"))
+			}
+			if tc.expectedJSON != "" {
+				assert.Equal(t, `Bearer error="insufficient_scope", scope="calendar.read"`, rw.Header().Get("WWW-Authenticate"))
+				assert.JSONEq(t, tc.expectedJSON, rw.Body.String())
+			}
+		})
 	}
-	return test, nil
 }
 
-func (test *ajaxRequestTest) getEndpoint(endpoint string, header http.Header) (int, http.Header, []byte, error) {
-	rw := httptest.NewRecorder()
-	req, err := http.NewRequest(http.MethodGet, endpoint, strings.NewReader(""))
-	if err != nil {
-		return 0, nil, nil, err
-	}
-	req.Header = header
-	test.proxy.ServeHTTP(rw, req)
-	return rw.Code, rw.Header(), rw.Body.Bytes(), nil
+func TestMergeGrantedScopes(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	test, err := NewProcessCookieTestWithOptionsModifiers()
+	require.NoError(t, err)
+	require.NoError(t, test.SaveSession(&sessions.SessionState{User: "john", AccessToken: "old_token", RefreshToken: "old_refresh", CreatedAt: &created, Groups: []string{"admins"}}))
+
+	granted := &sessions.SessionState{User: "john", AccessToken: "new_token", Scopes: []string{"calendar.read"}}
+	merged := test.proxy.mergeGrantedScopes(test.req, granted)
+	assert.Equal(t, "new_token", merged.AccessToken)
+	assert.Equal(t, "old_refresh", merged.RefreshToken)
+	assert.Equal(t, []string{"calendar.read"}, merged.Scopes)
+	assert.Equal(t, []string{"admins"}, merged.Groups)
+	assert.Equal(t, created.Unix(), merged.CreatedAt.Unix())
+
+	other := &sessions.SessionState{User: "jane", AccessToken: "new_token", Scopes: []string{"calendar.read"}}
+	assert.Same(t, other, test.proxy.mergeGrantedScopes(test.req, other))
 }
 
-func testAjaxUnauthorizedRequest(t *testing.T, header http.Header, forceJSONErrors bool) {
-	test, err := newAjaxRequestTest(forceJSONErrors)
+func TestAjaxAccessDeniedRequest(t *testing.T) {
+	test, err := newAjaxRequestTest(false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	endpoint := "/test"
-
-	code, rh, body, err := test.getEndpoint(endpoint, header)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusUnauthorized, code)
-	mime := rh.Get("Content-Type")
-	assert.Equal(t, applicationJSON, mime)
-	assert.Equal(t, []byte("{}"), body)
-}
-func TestAjaxUnauthorizedRequest1(t *testing.T) {
-	header := make(http.Header)
-	header.Add("accept", applicationJSON)
-
-	testAjaxUnauthorizedRequest(t, header, false)
-}
-
-func TestAjaxUnauthorizedRequest2(t *testing.T) {
-	header := make(http.Header)
-	header.Add("Accept", applicationJSON)
-
-	testAjaxUnauthorizedRequest(t, header, false)
-}
-
-func TestAjaxUnauthorizedRequestAccept1(t *testing.T) {
-	header := make(http.Header)
-	header.Add("Accept", "application/json, text/plain, */*")
-
-	testAjaxUnauthorizedRequest(t, header, false)
-}
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	test.proxy.errorJSON(rw, req, http.StatusForbidden, ErrAccessDenied)
 
-func TestForceJSONErrorsUnauthorizedRequest(t *testing.T) {
-	testAjaxUnauthorizedRequest(t, nil, true)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Equal(t, applicationJSON, rw.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"access_denied","error_description":"The session failed authorization checks"}`, rw.Body.String())
 }
 
 func TestAjaxForbiddendRequest(t *testing.T) {
@@ -1790,25 +2943,26 @@ func (NoOpKeySet) VerifySignature(_ context.Context, jwt string) (payload []byte
 	return base64.RawURLEncoding.DecodeString(payloadString)
 }
 
-func TestGetJwtSession(t *testing.T) {
-	/* token payload:
-	{
-	  "sub": "1234567890",
-	  "aud": "https://test.myapp.com",
-	  "name": "John Doe",
-	  "email": "john@example.com",
-	  "iss": "https://issuer.example.com",
-	  "iat": 1553691215,
-	  "exp": 1912151821
-	}
-	*/
-	goodJwt := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
-		"eyJzdWIiOiIxMjM0NTY3ODkwIiwiYXVkIjoiaHR0cHM6Ly90ZXN0Lm15YXBwLmNvbSIsIm5hbWUiOiJKb2huIERvZSIsImVtY" +
-		"WlsIjoiam9obkBleGFtcGxlLmNvbSIsImlzcyI6Imh0dHBzOi8vaXNzdWVyLmV4YW1wbGUuY29tIiwiaWF0IjoxNTUzNjkxMj" +
-		"E1LCJleHAiOjE5MTIxNTE4MjF9." +
-		"rLVyzOnEldUq_pNkfa-WiV8TVJYWyZCaM2Am_uo8FGg11zD7l-qmz3x1seTvqpH6Y0Ty00fmv6dJnGnC8WMnPXQiodRTfhBSe" +
-		"OKZMu0HkMD2sg52zlKkbfLTO6ic5VnbVgwjjrB8am_Ta6w7kyFUaB5C1BsIrrLMldkWEhynbb8"
-
+/* goodJwt payload:
+{
+  "sub": "1234567890",
+  "aud": "https://test.myapp.com",
+  "name": "John Doe",
+  "email": "john@example.com",
+  "iss": "https://issuer.example.com",
+  "iat": 1553691215,
+  "exp": 1912151821
+}
+*/
+const goodJwt = "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+	"eyJzdWIiOiIxMjM0NTY3ODkwIiwiYXVkIjoiaHR0cHM6Ly90ZXN0Lm15YXBwLmNvbSIsIm5hbWUiOiJKb2huIERvZSIsImVtY" +
+	"WlsIjoiam9obkBleGFtcGxlLmNvbSIsImlzcyI6Imh0dHBzOi8vaXNzdWVyLmV4YW1wbGUuY29tIiwiaWF0IjoxNTUzNjkxMj" +
+	"E1LCJleHAiOjE5MTIxNTE4MjF9." +
+	"rLVyzOnEldUq_pNkfa-WiV8TVJYWyZCaM2Am_uo8FGg11zD7l-qmz3x1seTvqpH6Y0Ty00fmv6dJnGnC8WMnPXQiodRTfhBSe" +
+	"OKZMu0HkMD2sg52zlKkbfLTO6ic5VnbVgwjjrB8am_Ta6w7kyFUaB5C1BsIrrLMldkWEhynbb8"
+
+// newGoodJwtVerifier returns a verifier that accepts goodJwt
+func newGoodJwtVerifier() internaloidc.IDTokenVerifier {
 	keyset := NoOpKeySet{}
 	verifier := oidc.NewVerifier("https://issuer.example.com", keyset,
 		&oidc.Config{ClientID: "https://test.myapp.com", SkipExpiryCheck: true,
@@ -1818,7 +2972,11 @@ func TestGetJwtSession(t *testing.T) {
 		ClientID:       "https://test.myapp.com",
 		ExtraAudiences: []string{},
 	}
-	internalVerifier := internaloidc.NewVerifier(verifier, verificationOptions)
+	return internaloidc.NewVerifier(verifier, verificationOptions)
+}
+
+func TestGetJwtSession(t *testing.T) {
+	internalVerifier := newGoodJwtVerifier()
 
 	test, err := NewAuthOnlyEndpointTest("", func(opts *options.Options) {
 		opts.InjectRequestHeaders = []options.Header{
@@ -2533,6 +3691,135 @@ func TestApiRoutes(t *testing.T) {
 	}
 }
 
+func TestAuthRoutes(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, err := w.Write([]byte(r.Header.Get("X-Forwarded-Email")))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	testCases := []struct {
+		name          string
+		url           string
+		cookieSession bool
+		bearerToken   bool
+		invalidUser   bool
+		expectedCode  int
+		expectedBody  string
+	}{
+		{
+			name:         "Skip route without session",
+			url:          "/skip",
+			expectedCode: 200,
+			expectedBody: "",
+		},
+		{
+			name:         "Required route overrides skip auth route",
+			url:          "/required",
+			expectedCode: 403,
+		},
+		{
+			name:          "Required route with session",
+			url:           "/required",
+			cookieSession: true,
+			expectedCode:  200,
+			expectedBody:  "john@example.com",
+		},
+		{
+			name:         "Optional route without session",
+			url:          "/optional",
+			expectedCode: 200,
+			expectedBody: "",
+		},
+		{
+			name:          "Optional route with session",
+			url:           "/optional",
+			cookieSession: true,
+			expectedCode:  200,
+			expectedBody:  "john@example.com",
+		},
+		{
+			name:          "Optional route with unauthorized session",
+			url:           "/optional",
+			cookieSession: true,
+			invalidUser:   true,
+			expectedCode:  200,
+			expectedBody:  "",
+		},
+		{
+			name:         "Bearer only route without session",
+			url:          "/bearer",
+			expectedCode: 401,
+		},
+		{
+			name:          "Bearer only route with cookie session",
+			url:           "/bearer",
+			cookieSession: true,
+			expectedCode:  401,
+		},
+		{
+			name:         "Bearer only route with bearer token",
+			url:          "/bearer",
+			bearerToken:  true,
+			expectedCode: 200,
+			expectedBody: "john@example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			test, err := NewProcessCookieTestWithOptionsModifiers(func(opts *options.Options) {
+				opts.UpstreamServers = options.UpstreamConfig{
+					Upstreams: []options.Upstream{
+						{
+							ID:   upstreamServer.URL,
+							Path: "/",
+							URI:  upstreamServer.URL,
+						},
+					},
+				}
+				opts.SkipAuthRoutes = []string{"^/required"}
+				opts.AuthRoutes = []string{
+					"skip:^/skip",
+					"required:^/required",
+					"optional:GET=^/optional",
+					"bearer-only:^/bearer",
+				}
+				opts.SkipJwtBearerTokens = true
+				opts.SetJWTBearerVerifiers(append(opts.GetJWTBearerVerifiers(), newGoodJwtVerifier()))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.req, err = http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			if tc.cookieSession {
+				created := time.Now()
+				assert.NoError(t, test.SaveSession(&sessions.SessionState{
+					Email: "john@example.com", AccessToken: "my_access_token", CreatedAt: &created}))
+			}
+			if tc.bearerToken {
+				test.req.Header.Set("Authorization", "Bearer "+goodJwt)
+			}
+			test.validateUser = !tc.invalidUser
+
+			rw := httptest.NewRecorder()
+			test.proxy.ServeHTTP(rw, test.req)
+
+			assert.Equal(t, tc.expectedCode, rw.Code)
+			if tc.expectedCode == 200 {
+				assert.Equal(t, tc.expectedBody, rw.Body.String())
+			}
+			// Unauthorized sessions on optional routes are kept
+			assert.Empty(t, rw.Result().Cookies())
+		})
+	}
+}
+
 func TestAllowedRequest(t *testing.T) {
 	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -2635,6 +3922,127 @@ func TestAllowedRequest(t *testing.T) {
 	}
 }
 
+func TestAllowedRequestWithSkipAuthRouteConditions(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, err := w.Write([]byte("Allowed Request"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	opts := baseTestOptions()
+	opts.UpstreamServers = options.UpstreamConfig{
+		Upstreams: []options.Upstream{
+			{
+				ID:   upstreamServer.URL,
+				Path: "/",
+				URI:  upstreamServer.URL,
+			},
+		},
+	}
+	opts.SkipAuthRoutes = []string{
+		"GET=^/metrics$ header=X-Scanner-Key:secret cidr=192.0.2.0/24",
+		"^/webhook$ header=X-Hub-Signature",
+		"^/preview dry-run",
+		"^/internal priority=10 cidr=10.0.0.0/8",
+	}
+	err := validation.Validate(opts)
+	assert.NoError(t, err)
+	proxy, err := NewOAuthProxy(opts, func(_ string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "^/internal", proxy.allowedRoutes[0].pathRegex.String())
+
+	testCases := []struct {
+		name       string
+		method     string
+		url        string
+		headers    map[string]string
+		remoteAddr string
+		allowed    bool
+	}{
+		{
+			name:       "Route allowed with header value and network",
+			method:     "GET",
+			url:        "/metrics",
+			headers:    map[string]string{"X-Scanner-Key": "secret"},
+			remoteAddr: "192.0.2.1:1234",
+			allowed:    true,
+		},
+		{
+			name:       "Route denied with wrong header value",
+			method:     "GET",
+			url:        "/metrics",
+			headers:    map[string]string{"X-Scanner-Key": "wrong"},
+			remoteAddr: "192.0.2.1:1234",
+			allowed:    false,
+		},
+		{
+			name:       "Route denied without header",
+			method:     "GET",
+			url:        "/metrics",
+			remoteAddr: "192.0.2.1:1234",
+			allowed:    false,
+		},
+		{
+			name:       "Route denied from another network",
+			method:     "GET",
+			url:        "/metrics",
+			headers:    map[string]string{"X-Scanner-Key": "secret"},
+			remoteAddr: "198.51.100.1:1234",
+			allowed:    false,
+		},
+		{
+			name:       "Route allowed with any header value",
+			method:     "POST",
+			url:        "/webhook",
+			headers:    map[string]string{"X-Hub-Signature": "sha256=abc"},
+			remoteAddr: "198.51.100.1:1234",
+			allowed:    true,
+		},
+		{
+			name:       "Route denied in dry run",
+			method:     "GET",
+			url:        "/preview",
+			remoteAddr: "192.0.2.1:1234",
+			allowed:    false,
+		},
+		{
+			name:       "Prioritized route allowed from network",
+			method:     "GET",
+			url:        "/internal",
+			remoteAddr: "10.1.2.3:1234",
+			allowed:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			assert.NoError(t, err)
+			req.RemoteAddr = tc.remoteAddr
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tc.allowed, proxy.isAllowedRoute(req))
+
+			rw := httptest.NewRecorder()
+			proxy.ServeHTTP(rw, req)
+
+			if tc.allowed {
+				assert.Equal(t, 200, rw.Code)
+				assert.Equal(t, "Allowed Request", rw.Body.String())
+			} else {
+				assert.Equal(t, 403, rw.Code)
+			}
+		})
+	}
+}
+
 func TestAllowedRequestWithForwardedUriHeader(t *testing.T) {
 	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -3381,6 +4789,72 @@ func TestAuthOnlyAllowedEmails(t *testing.T) {
 	}
 }
 
+// roleTestProvider is a TestProvider that knows the roles of its users
+type roleTestProvider struct {
+	*TestProvider
+	roles map[string][]string
+}
+
+func (p *roleTestProvider) HasRole(s *sessions.SessionState, role string) bool {
+	for _, r := range p.roles[s.Email] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAuthOnlyAllowedRoles(t *testing.T) {
+	testCases := []struct {
+		name               string
+		querystring        string
+		expectedStatusCode int
+	}{
+		{
+			name:               "NoAllowedRoles",
+			querystring:        "",
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "UserWithAllowedRole",
+			querystring:        "?allowed_roles=admin,client:editor",
+			expectedStatusCode: http.StatusAccepted,
+		},
+		{
+			name:               "UserWithoutAllowedRoles",
+			querystring:        "?allowed_roles=admin&allowed_roles=auditor",
+			expectedStatusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created := time.Now()
+			session := &sessions.SessionState{
+				Email:       "toto@example.com",
+				AccessToken: "oauth_token",
+				CreatedAt:   &created,
+			}
+
+			test, err := NewAuthOnlyEndpointTest(tc.querystring, func(opts *options.Options) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.proxy.provider = &roleTestProvider{
+				TestProvider: &TestProvider{ProviderData: &providers.ProviderData{}, ValidToken: true},
+				roles:        map[string][]string{"toto@example.com": {"client:editor"}},
+			}
+
+			err = test.SaveSession(session)
+			assert.NoError(t, err)
+
+			test.proxy.ServeHTTP(test.rw, test.req)
+
+			assert.Equal(t, tc.expectedStatusCode, test.rw.Code)
+		})
+	}
+}
+
 func TestGetOAuthRedirectURI(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -3463,7 +4937,79 @@ func TestGetOAuthRedirectURI(t *testing.T) {
 			proxy, err := NewOAuthProxy(tt.setupOpts(baseOpts), func(string) bool { return true })
 			assert.NoError(t, err)
 
-			assert.Equalf(t, tt.want, proxy.getOAuthRedirectURI(tt.req), "getOAuthRedirectURI(%v)", tt.req)
+			assert.Equalf(t, tt.want, proxy.getOAuthRedirectURI(tt.req, ""), "getOAuthRedirectURI(%v)", tt.req)
 		})
 	}
 }
+
+func TestGetOAuthRedirectURIByHost(t *testing.T) {
+	opts := baseTestOptions()
+	opts.RawRedirectURL = "https://auth.example.com/oauth2/callback"
+	opts.ExtraRedirectURLs = []string{
+		"https://app.example.net/oauth2/callback",
+		"https://*.apps.example.org/oauth2/callback",
+	}
+	opts.Providers = append(opts.Providers, options.Provider{
+		ID:           "github",
+		Type:         options.GitHubProvider,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURLs: []string{"https://github.example.net/callback"},
+	})
+	require.NoError(t, validation.Validate(opts))
+
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		host       string
+		providerID string
+		want       string
+	}{
+		{host: "app.example.net", want: "https://app.example.net/oauth2/callback"},
+		{host: "team.apps.example.org", want: "https://team.apps.example.org/oauth2/callback"},
+		{host: "apps.example.org:8443", want: "https://auth.example.com/oauth2/callback"},
+		{host: "other.example.com", want: "https://auth.example.com/oauth2/callback"},
+		{host: "github.example.net", want: "https://auth.example.com/oauth2/callback"},
+		{host: "github.example.net", providerID: "github", want: "https://github.example.net/callback"},
+		{host: "app.example.net", providerID: "github", want: "https://app.example.net/oauth2/callback"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/oauth2/start", nil)
+		req.Host = tc.host
+		assert.Equal(t, tc.want, proxy.getOAuthRedirectURI(req, tc.providerID), "%s (%s)", tc.host, tc.providerID)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	opts := baseTestOptions()
+	opts.RateLimit.AuthRequests = 2
+	opts.RateLimit.ProxyRequests = 3
+	require.NoError(t, validation.Validate(opts))
+	proxy, err := NewOAuthProxy(opts, func(string) bool { return true })
+	require.NoError(t, err)
+
+	serve := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// The sign in endpoints share the auth rate limit
+	assert.Equal(t, http.StatusFound, serve("/oauth2/start", "10.0.0.1:1234").Code)
+	assert.NotEqual(t, http.StatusTooManyRequests, serve("/oauth2/callback", "10.0.0.1:1234").Code)
+	rw := serve("/oauth2/start", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "30", rw.Header().Get("Retry-After"))
+
+	// Other clients and the other endpoints are not limited by it
+	assert.Equal(t, http.StatusFound, serve("/oauth2/start", "10.0.0.2:1234").Code)
+	assert.Equal(t, http.StatusOK, serve("/oauth2/sign_in", "10.0.0.1:1234").Code)
+
+	// Proxied requests have their own rate limit
+	for i := 0; i < 3; i++ {
+		assert.NotEqual(t, http.StatusTooManyRequests, serve("/app", "10.0.0.1:1234").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve("/app", "10.0.0.1:1234").Code)
+}
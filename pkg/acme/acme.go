@@ -0,0 +1,139 @@
+// Package acme obtains and renews the certificate of the HTTPS server from an
+// ACME certificate authority, such as Let's Encrypt.
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// cacheKeyPrefix separates the certificates and account key stored in
+	// the session store from the sessions
+	cacheKeyPrefix = "acme-"
+
+	// cacheExpiry is how long the entries stored in the session store are
+	// kept. Certificates are saved again, well before, when they are renewed.
+	cacheExpiry = 365 * 24 * time.Hour
+)
+
+// ALPNProto is the application protocol the HTTPS server must negotiate to
+// answer TLS-ALPN-01 challenges
+const ALPNProto = acme.ALPNProto
+
+// NewManager creates the manager of the certificates of the HTTPS server.
+// It answers the TLS-ALPN-01 challenges in the TLS handshakes of the HTTPS
+// server, and the HTTP-01 challenges when its HTTPHandler serves the HTTP
+// server.
+func NewManager(opts *options.Options) (*autocert.Manager, error) {
+	cache, err := newCache(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       cache,
+		HostPolicy:  autocert.HostWhitelist(Hosts(opts)...),
+		RenewBefore: opts.ACME.RenewBefore,
+		Email:       opts.ACME.Email,
+		Client:      &acme.Client{DirectoryURL: opts.ACME.DirectoryURL},
+	}, nil
+}
+
+// newCache creates the cache of the certificates and account key: the cache
+// directory, or the session store
+func newCache(opts *options.Options) (autocert.Cache, error) {
+	if opts.ACME.CacheDir != "" {
+		return autocert.DirCache(opts.ACME.CacheDir), nil
+	}
+
+	store, err := sessions.NewPersistentStore(&opts.Session, &opts.Cookie)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the acme cache: %v", err)
+	}
+	return NewStoreCache(store), nil
+}
+
+// Hosts returns the hosts to obtain certificates for: the hosts given in the
+// options, or the hosts of the redirect URLs and virtual hosts. Wildcard
+// hosts are skipped as their certificates cannot be obtained with the
+// HTTP-01 and TLS-ALPN-01 challenges.
+func Hosts(opts *options.Options) []string {
+	if len(opts.ACME.Hosts) > 0 {
+		return opts.ACME.Hosts
+	}
+
+	var hosts []string
+	seen := map[string]bool{}
+	add := func(host string) {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if host == "" || strings.HasPrefix(host, ".") || strings.HasPrefix(host, "*") || seen[host] {
+			return
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+
+	for _, redirectURL := range append([]string{opts.RawRedirectURL}, opts.ExtraRedirectURLs...) {
+		if u, err := url.Parse(redirectURL); err == nil {
+			add(u.Host)
+		}
+	}
+	for _, virtualHost := range opts.VirtualHosts {
+		for _, host := range virtualHost.Hosts {
+			add(host)
+		}
+	}
+	return hosts
+}
+
+// StoreCache stores the certificates and account key of a Manager in the
+// Store of a persistent session store, so that the replicas of the proxy
+// share them
+type StoreCache struct {
+	store persistence.Store
+}
+
+// NewStoreCache creates a StoreCache storing its entries in the store
+func NewStoreCache(store persistence.Store) *StoreCache {
+	return &StoreCache{store: store}
+}
+
+// Get returns the entry for the key, or autocert.ErrCacheMiss when there is
+// none. Session stores do not tell missing keys apart from other errors, so
+// the entry is missing when loading it fails while the store is reachable.
+func (c *StoreCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.store.Load(ctx, cacheKeyPrefix+key)
+	if err == nil {
+		return data, nil
+	}
+	if verifyErr := c.store.VerifyConnection(ctx); verifyErr != nil {
+		return nil, errors.Join(err, verifyErr)
+	}
+	return nil, autocert.ErrCacheMiss
+}
+
+// Put stores the entry for the key
+func (c *StoreCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.store.Save(ctx, cacheKeyPrefix+key, data, cacheExpiry)
+}
+
+// Delete removes the entry for the key
+func (c *StoreCache) Delete(ctx context.Context, key string) error {
+	return c.store.Clear(ctx, cacheKeyPrefix+key)
+}
@@ -0,0 +1,147 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// unreachableStore is a store whose server cannot be reached
+type unreachableStore struct {
+	*tests.MockStore
+}
+
+func (s unreachableStore) Load(_ context.Context, _ string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (s unreachableStore) VerifyConnection(_ context.Context) error {
+	return errors.New("connection refused")
+}
+
+var _ = Describe("ACME", func() {
+	type hostsTableInput struct {
+		opts          *options.Options
+		expectedHosts []string
+	}
+
+	DescribeTable("Hosts",
+		func(in hostsTableInput) {
+			Expect(Hosts(in.opts)).To(Equal(in.expectedHosts))
+		},
+		Entry("with hosts", hostsTableInput{
+			opts: &options.Options{
+				RawRedirectURL: "https://auth.example.com/oauth2/callback",
+				ACME:           options.ACME{Hosts: []string{"proxy.example.com"}},
+			},
+			expectedHosts: []string{"proxy.example.com"},
+		}),
+		Entry("with redirect URLs", hostsTableInput{
+			opts: &options.Options{
+				RawRedirectURL:    "https://Auth.example.com/oauth2/callback",
+				ExtraRedirectURLs: []string{"https://auth.example.org:8443/oauth2/callback", "https://*.example.net/oauth2/callback", "https://auth.example.com/oauth2/callback"},
+			},
+			expectedHosts: []string{"auth.example.com", "auth.example.org"},
+		}),
+		Entry("with virtual hosts", hostsTableInput{
+			opts: &options.Options{
+				VirtualHosts: options.VirtualHosts{
+					{Hosts: []string{"wiki.example.com", ".example.org"}},
+					{Hosts: []string{"grafana.example.com:443", "*.example.net"}},
+				},
+			},
+			expectedHosts: []string{"wiki.example.com", "grafana.example.com"},
+		}),
+		Entry("with a relative redirect URL", hostsTableInput{
+			opts: &options.Options{
+				RawRedirectURL: "/oauth2/callback",
+			},
+			expectedHosts: nil,
+		}),
+	)
+
+	Context("NewManager", func() {
+		It("stores the certificates in the cache dir", func() {
+			dir := filepath.Join(GinkgoT().TempDir(), "acme")
+			manager, err := NewManager(&options.Options{
+				ACME: options.ACME{
+					Hosts:        []string{"proxy.example.com"},
+					Email:        "admin@example.com",
+					DirectoryURL: "https://acme.example.com/directory",
+					CacheDir:     dir,
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manager.Cache).To(Equal(autocert.DirCache(dir)))
+		})
+
+		It("accepts only the hosts to obtain certificates for", func() {
+			manager, err := NewManager(&options.Options{
+				ACME: options.ACME{
+					Hosts:    []string{"proxy.example.com"},
+					CacheDir: GinkgoT().TempDir(),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manager.HostPolicy(context.Background(), "proxy.example.com")).To(Succeed())
+			Expect(manager.HostPolicy(context.Background(), "other.example.com")).ToNot(Succeed())
+		})
+
+		It("fails without a persistent session store or cache dir", func() {
+			_, err := NewManager(&options.Options{
+				Cookie:  options.Cookie{Secret: "0123456789abcdef0123456789abcdef"},
+				Session: options.SessionOptions{Type: options.CookieSessionStoreType},
+				ACME:    options.ACME{Hosts: []string{"proxy.example.com"}},
+			})
+			Expect(err).To(MatchError("could not create the acme cache: the cookie session store is not persistent"))
+		})
+	})
+
+	Context("StoreCache", func() {
+		var store *tests.MockStore
+		var cache *StoreCache
+
+		BeforeEach(func() {
+			store = tests.NewMockStore()
+			cache = NewStoreCache(store)
+		})
+
+		It("stores entries under the acme prefix", func() {
+			Expect(cache.Put(context.Background(), "proxy.example.com", []byte("certificate"))).To(Succeed())
+
+			data, err := store.Load(context.Background(), "acme-proxy.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("certificate")))
+
+			data, err = cache.Get(context.Background(), "proxy.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("certificate")))
+		})
+
+		It("deletes entries", func() {
+			Expect(cache.Put(context.Background(), "proxy.example.com", []byte("certificate"))).To(Succeed())
+			Expect(cache.Delete(context.Background(), "proxy.example.com")).To(Succeed())
+
+			_, err := cache.Get(context.Background(), "proxy.example.com")
+			Expect(err).To(Equal(autocert.ErrCacheMiss))
+		})
+
+		It("misses entries that were not stored", func() {
+			_, err := cache.Get(context.Background(), "proxy.example.com")
+			Expect(err).To(Equal(autocert.ErrCacheMiss))
+		})
+
+		It("fails when the store is unreachable", func() {
+			cache = NewStoreCache(unreachableStore{store})
+			_, err := cache.Get(context.Background(), "proxy.example.com")
+			Expect(err).To(HaveOccurred())
+			Expect(err).ToNot(Equal(autocert.ErrCacheMiss))
+		})
+	})
+})
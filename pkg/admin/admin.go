@@ -0,0 +1,222 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/archive"
+)
+
+// SessionList is the response listing sessions
+type SessionList struct {
+	Sessions []sessions.SessionInfo `json:"sessions"`
+}
+
+// Imported is the response of an import, with the number of sessions
+// imported
+type Imported struct {
+	Imported int `json:"imported"`
+}
+
+// Revoked is the response of a revocation, with the IDs of the sessions
+// revoked
+type Revoked struct {
+	Revoked []string `json:"revoked"`
+}
+
+// errorResponse is the response of a request that failed
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler creates the handler of the admin API, which lists and revokes
+// the sessions of the store:
+//
+//	GET    /sessions         lists the sessions, filtered by email, user or group
+//	DELETE /sessions         revokes the sessions of an email, user or group
+//	GET    /sessions/export  exports the sessions to an encrypted archive
+//	POST   /sessions/import  imports the sessions of an encrypted archive
+//	GET    /sessions/{id}    returns a session
+//	DELETE /sessions/{id}    revokes a session
+//
+// Sessions can only be exported and imported when the store can archive
+// them, and the secret of the archives is set.
+func NewHandler(store sessions.SessionAdmin, archiveSecret string) http.Handler {
+	h := &handler{store: store, archiveSecret: archiveSecret}
+
+	r := mux.NewRouter()
+	r.Path("/sessions").Methods(http.MethodGet).HandlerFunc(h.listSessions)
+	r.Path("/sessions").Methods(http.MethodDelete).HandlerFunc(h.revokeSessions)
+	r.Path("/sessions/export").Methods(http.MethodGet).HandlerFunc(h.exportSessions)
+	r.Path("/sessions/import").Methods(http.MethodPost).HandlerFunc(h.importSessions)
+	r.Path("/sessions/{id}").Methods(http.MethodGet).HandlerFunc(h.getSession)
+	r.Path("/sessions/{id}").Methods(http.MethodDelete).HandlerFunc(h.revokeSession)
+	return r
+}
+
+type handler struct {
+	store         sessions.SessionAdmin
+	archiveSecret string
+}
+
+func (h *handler) listSessions(rw http.ResponseWriter, req *http.Request) {
+	matches, err := h.store.ListSessions(req.Context(), newFilter(req))
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, SessionList{Sessions: matches})
+}
+
+// revokeSessions revokes the sessions matching the filter, which must be
+// set so that a mistake does not sign out every user
+func (h *handler) revokeSessions(rw http.ResponseWriter, req *http.Request) {
+	f := newFilter(req)
+	if f == (sessions.SessionFilter{}) {
+		writeError(rw, http.StatusBadRequest, errors.New("an email, user or group is required to revoke sessions"))
+		return
+	}
+
+	matches, err := h.store.ListSessions(req.Context(), f)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	revoked := Revoked{Revoked: []string{}}
+	for _, info := range matches {
+		err := h.store.RevokeSession(req.Context(), info.ID)
+		if errors.Is(err, sessions.ErrSessionNotFound) {
+			// The session expired or was revoked since it was listed
+			continue
+		}
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Printf("Revoked session %s of %s with the admin API", info.ID, info.Email)
+		revoked.Revoked = append(revoked.Revoked, info.ID)
+	}
+	writeJSON(rw, http.StatusOK, revoked)
+}
+
+// exportSessions streams the sessions to an encrypted archive. An error once
+// the archive has started cannot be returned, and leaves the archive
+// incomplete, which importing it detects.
+func (h *handler) exportSessions(rw http.ResponseWriter, req *http.Request) {
+	archiver, err := h.archiver()
+	if err != nil {
+		writeError(rw, http.StatusNotImplemented, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Disposition", `attachment; filename="sessions.archive"`)
+	w, err := archive.NewWriter(rw, h.archiveSecret)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+	exported, err := archiver.ExportSessions(req.Context(), w.Write)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		logger.Errorf("Error exporting sessions with the admin API after %d sessions: %v", exported, err)
+		return
+	}
+	logger.Printf("Exported %d sessions with the admin API", exported)
+}
+
+// importSessions saves the sessions of the encrypted archive of the request
+func (h *handler) importSessions(rw http.ResponseWriter, req *http.Request) {
+	archiver, err := h.archiver()
+	if err != nil {
+		writeError(rw, http.StatusNotImplemented, err)
+		return
+	}
+
+	r, err := archive.NewReader(req.Body, h.archiveSecret)
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err)
+		return
+	}
+	imported, err := archiver.ImportSessions(req.Context(), r.Read)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, archive.ErrInvalidArchive) || errors.Is(err, archive.ErrTruncatedArchive) {
+			status = http.StatusBadRequest
+		}
+		writeError(rw, status, fmt.Errorf("imported %d sessions before failing: %v", imported, err))
+		return
+	}
+	logger.Printf("Imported %d sessions with the admin API", imported)
+	writeJSON(rw, http.StatusOK, Imported{Imported: imported})
+}
+
+// archiver returns the store to export sessions from and import them into
+func (h *handler) archiver() (sessions.SessionArchiver, error) {
+	archiver, ok := h.store.(sessions.SessionArchiver)
+	if !ok {
+		return nil, errors.New("the session store cannot export and import sessions")
+	}
+	if h.archiveSecret == "" {
+		return nil, errors.New("exporting and importing sessions requires session_archive_secret to be set")
+	}
+	return archiver, nil
+}
+
+func (h *handler) getSession(rw http.ResponseWriter, req *http.Request) {
+	info, err := h.store.GetSession(req.Context(), mux.Vars(req)["id"])
+	switch {
+	case errors.Is(err, sessions.ErrSessionNotFound):
+		writeError(rw, http.StatusNotFound, err)
+	case err != nil:
+		writeError(rw, http.StatusInternalServerError, err)
+	default:
+		writeJSON(rw, http.StatusOK, info)
+	}
+}
+
+func (h *handler) revokeSession(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	err := h.store.RevokeSession(req.Context(), id)
+	switch {
+	case errors.Is(err, sessions.ErrSessionNotFound):
+		writeError(rw, http.StatusNotFound, err)
+	case err != nil:
+		writeError(rw, http.StatusInternalServerError, err)
+	default:
+		logger.Printf("Revoked session %s with the admin API", id)
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFilter(req *http.Request) sessions.SessionFilter {
+	query := req.URL.Query()
+	return sessions.SessionFilter{
+		Email: query.Get("email"),
+		User:  query.Get("user"),
+		Group: query.Get("group"),
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Errorf("Error encoding admin API response: %v", err)
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		logger.Errorf("Error handling admin API request: %v", err)
+	}
+	writeJSON(rw, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeStore holds the sessions in memory
+type fakeStore struct {
+	sessions map[string]sessions.SessionInfo
+}
+
+func (s *fakeStore) ListSessions(_ context.Context, filter sessions.SessionFilter) ([]sessions.SessionInfo, error) {
+	infos := []sessions.SessionInfo{}
+	for _, info := range s.sessions {
+		if filter.Matches(info) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+func (s *fakeStore) GetSession(_ context.Context, id string) (*sessions.SessionInfo, error) {
+	info, ok := s.sessions[id]
+	if !ok {
+		return nil, sessions.ErrSessionNotFound
+	}
+	return &info, nil
+}
+
+func (s *fakeStore) RevokeSession(_ context.Context, id string) error {
+	if _, ok := s.sessions[id]; !ok {
+		return sessions.ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// archivingStore holds the archived sessions in memory
+type archivingStore struct {
+	fakeStore
+	archived []sessions.ArchivedSession
+}
+
+func (s *archivingStore) ExportSessions(_ context.Context, export func(sessions.ArchivedSession) error) (int, error) {
+	for i, archived := range s.archived {
+		if err := export(archived); err != nil {
+			return i, err
+		}
+	}
+	return len(s.archived), nil
+}
+
+func (s *archivingStore) ImportSessions(_ context.Context, read func() (*sessions.ArchivedSession, error)) (int, error) {
+	imported := 0
+	for {
+		archived, err := read()
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, err
+		}
+		s.archived = append(s.archived, *archived)
+		imported++
+	}
+}
+
+var _ = Describe("Admin API", func() {
+	var store *fakeStore
+	var handler http.Handler
+
+	BeforeEach(func() {
+		store = &fakeStore{sessions: map[string]sessions.SessionInfo{
+			"session-1": {ID: "session-1", Email: "alice@example.com", User: "alice", Groups: []string{"admins"}},
+			"session-2": {ID: "session-2", Email: "alice@example.com", User: "alice"},
+			"session-3": {ID: "session-3", Email: "bob@example.com", User: "bob", Groups: []string{"admins", "devs"}},
+		}}
+		handler = NewHandler(store, "")
+	})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+		return rw
+	}
+
+	listIDs := func(target string) []string {
+		rw := serve(http.MethodGet, target)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var list SessionList
+		Expect(json.Unmarshal(rw.Body.Bytes(), &list)).To(Succeed())
+		ids := []string{}
+		for _, info := range list.Sessions {
+			ids = append(ids, info.ID)
+		}
+		return ids
+	}
+
+	DescribeTable("lists the sessions",
+		func(target string, expected []string) {
+			Expect(listIDs(target)).To(Equal(expected))
+		},
+		Entry("without a filter", "/sessions", []string{"session-1", "session-2", "session-3"}),
+		Entry("by email", "/sessions?email=Alice@example.com", []string{"session-1", "session-2"}),
+		Entry("by user", "/sessions?user=bob", []string{"session-3"}),
+		Entry("by group", "/sessions?group=admins", []string{"session-1", "session-3"}),
+		Entry("by email and group", "/sessions?email=alice@example.com&group=admins", []string{"session-1"}),
+		Entry("without matches", "/sessions?email=carol@example.com", []string{}),
+	)
+
+	It("returns a session", func() {
+		rw := serve(http.MethodGet, "/sessions/session-3")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+
+		var info sessions.SessionInfo
+		Expect(json.Unmarshal(rw.Body.Bytes(), &info)).To(Succeed())
+		Expect(info).To(Equal(store.sessions["session-3"]))
+
+		rw = serve(http.MethodGet, "/sessions/unknown")
+		Expect(rw.Code).To(Equal(http.StatusNotFound))
+		Expect(rw.Body.String()).To(MatchJSON(`{"error":"session not found"}`))
+	})
+
+	It("revokes a session", func() {
+		Expect(serve(http.MethodDelete, "/sessions/session-1").Code).To(Equal(http.StatusNoContent))
+		Expect(store.sessions).ToNot(HaveKey("session-1"))
+
+		Expect(serve(http.MethodDelete, "/sessions/session-1").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("revokes the sessions of a user", func() {
+		rw := serve(http.MethodDelete, "/sessions?email=alice@example.com")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"revoked":["session-1","session-2"]}`))
+		Expect(listIDs("/sessions")).To(Equal([]string{"session-3"}))
+	})
+
+	It("revokes the sessions of a group", func() {
+		rw := serve(http.MethodDelete, "/sessions?group=devs")
+		Expect(rw.Body.String()).To(MatchJSON(`{"revoked":["session-3"]}`))
+		Expect(listIDs("/sessions")).To(Equal([]string{"session-1", "session-2"}))
+	})
+
+	It("does not revoke every session without a filter", func() {
+		rw := serve(http.MethodDelete, "/sessions")
+		Expect(rw.Code).To(Equal(http.StatusBadRequest))
+		Expect(store.sessions).To(HaveLen(3))
+	})
+
+	Context("with a store archiving sessions", func() {
+		const secret = "0123456789abcdef"
+
+		var archiving *archivingStore
+
+		BeforeEach(func() {
+			archiving = &archivingStore{
+				fakeStore: *store,
+				archived: []sessions.ArchivedSession{
+					{ID: "session-1", Value: []byte("value-1"), Index: []byte("index-1")},
+					{ID: "session-2", Value: []byte("value-2")},
+				},
+			}
+			handler = NewHandler(archiving, secret)
+		})
+
+		importArchive := func(archive []byte) *httptest.ResponseRecorder {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/sessions/import", bytes.NewReader(archive)))
+			return rw
+		}
+
+		It("imports the sessions exported", func() {
+			rw := serve(http.MethodGet, "/sessions/export")
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Header().Get("Content-Type")).To(Equal("application/octet-stream"))
+			exported := archiving.archived
+
+			archiving.archived = nil
+			rw = importArchive(rw.Body.Bytes())
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Body.String()).To(MatchJSON(`{"imported":2}`))
+			Expect(archiving.archived).To(Equal(exported))
+		})
+
+		It("rejects archives that are not valid", func() {
+			rw := importArchive([]byte("not an archive"))
+			Expect(rw.Code).To(Equal(http.StatusBadRequest))
+
+			export := serve(http.MethodGet, "/sessions/export").Body.Bytes()
+			rw = importArchive(export[:len(export)-1])
+			Expect(rw.Code).To(Equal(http.StatusBadRequest))
+			Expect(rw.Body.String()).To(ContainSubstring("imported 2 sessions before failing: invalid session archive"))
+		})
+
+		It("does not export sessions without the secret of the archives", func() {
+			handler = NewHandler(archiving, "")
+			rw := serve(http.MethodGet, "/sessions/export")
+			Expect(rw.Code).To(Equal(http.StatusNotImplemented))
+			Expect(rw.Body.String()).To(MatchJSON(`{"error":"exporting and importing sessions requires session_archive_secret to be set"}`))
+		})
+	})
+
+	It("does not export sessions from a store that cannot archive them", func() {
+		handler = NewHandler(store, "0123456789abcdef")
+		rw := serve(http.MethodGet, "/sessions/export")
+		Expect(rw.Code).To(Equal(http.StatusNotImplemented))
+		Expect(rw.Body.String()).To(MatchJSON(`{"error":"the session store cannot export and import sessions"}`))
+	})
+})
@@ -41,6 +41,11 @@ type RequestScope struct {
 
 	// Upstream tracks which upstream was used for this request
 	Upstream string
+
+	// CookieDomain is the domain cookies should be set on for this request,
+	// in place of the configured cookie domains, when it is served by a
+	// virtual host with its own cookie domain.
+	CookieDomain string
 }
 
 // GetRequestScope returns the current request scope from the given request
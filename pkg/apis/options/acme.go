@@ -0,0 +1,57 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// LetsEncryptDirectoryURL is the directory of the production Let's Encrypt
+// certificate authority
+const LetsEncryptDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ACME includes options for obtaining and renewing the certificate of the
+// HTTPS server from an ACME certificate authority, such as Let's Encrypt,
+// instead of loading it from the TLS options.
+type ACME struct {
+	// Enabled obtains the certificates of the HTTPS server with ACME.
+	Enabled bool `flag:"acme" cfg:"acme"`
+	// Hosts are the hosts to obtain certificates for. They default to the
+	// hosts of the redirect URLs and of the virtual hosts.
+	Hosts []string `flag:"acme-host" cfg:"acme_hosts"`
+	// Email is the contact address of the ACME account, which the
+	// certificate authority sends expiry and account notices to.
+	Email string `flag:"acme-email" cfg:"acme_email"`
+	// DirectoryURL is the directory of the ACME certificate authority.
+	DirectoryURL string `flag:"acme-directory-url" cfg:"acme_directory_url"`
+	// AcceptTOS accepts the terms of service of the certificate authority,
+	// which is required to register an account.
+	AcceptTOS bool `flag:"acme-accept-tos" cfg:"acme_accept_tos"`
+	// CacheDir is the directory the certificates and the account key are
+	// stored in. They are stored in the session store when it is empty.
+	CacheDir string `flag:"acme-cache-dir" cfg:"acme_cache_dir"`
+	// RenewBefore is how long before their expiry certificates are renewed.
+	RenewBefore time.Duration `flag:"acme-renew-before" cfg:"acme_renew_before"`
+}
+
+func acmeFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("acme", pflag.ExitOnError)
+
+	flagSet.Bool("acme", false, "obtain and renew the certificate of the HTTPS server from an ACME certificate authority, such as Let's Encrypt")
+	flagSet.StringSlice("acme-host", []string{}, "hosts to obtain certificates for (defaults to the hosts of the redirect URLs and virtual hosts) (may be given multiple times)")
+	flagSet.String("acme-email", "", "contact email address of the ACME account, for expiry and account notices")
+	flagSet.String("acme-directory-url", LetsEncryptDirectoryURL, "the directory URL of the ACME certificate authority")
+	flagSet.Bool("acme-accept-tos", false, "accept the terms of service of the ACME certificate authority")
+	flagSet.String("acme-cache-dir", "", "directory to store the ACME certificates and account key in (defaults to the session store, which must be persistent)")
+	flagSet.Duration("acme-renew-before", 30*24*time.Hour, "how long before their expiry ACME certificates are renewed")
+
+	return flagSet
+}
+
+// acmeDefaults creates an ACME populating each field with its default value
+func acmeDefaults() ACME {
+	return ACME{
+		DirectoryURL: LetsEncryptDirectoryURL,
+		RenewBefore:  30 * 24 * time.Hour,
+	}
+}
@@ -41,8 +41,17 @@ type AlphaOptions struct {
 	// To use the secure server you must configure a TLS certificate and key.
 	MetricsServer Server `json:"metricsServer,omitempty"`
 
+	// AdminServer is used to configure the HTTP(S) server for the admin API,
+	// which lists and revokes sessions. It requires authentication and a
+	// redis or postgres session store.
+	AdminServer Server `json:"adminServer,omitempty"`
+
 	// Providers is used to configure multiple providers.
 	Providers Providers `json:"providers,omitempty"`
+
+	// VirtualHosts is used to configure the provider, upstreams, cookie domain
+	// and allowed groups of the requests made to particular hosts.
+	VirtualHosts VirtualHosts `json:"virtualHosts,omitempty"`
 }
 
 // MergeInto replaces alpha options in the Options struct with the values
@@ -53,7 +62,9 @@ func (a *AlphaOptions) MergeInto(opts *Options) {
 	opts.InjectResponseHeaders = a.InjectResponseHeaders
 	opts.Server = a.Server
 	opts.MetricsServer = a.MetricsServer
+	opts.AdminServer = a.AdminServer
 	opts.Providers = a.Providers
+	opts.VirtualHosts = a.VirtualHosts
 }
 
 // ExtractFrom populates the fields in the AlphaOptions with the values from
@@ -64,5 +75,7 @@ func (a *AlphaOptions) ExtractFrom(opts *Options) {
 	a.InjectResponseHeaders = opts.InjectResponseHeaders
 	a.Server = opts.Server
 	a.MetricsServer = opts.MetricsServer
+	a.AdminServer = opts.AdminServer
 	a.Providers = opts.Providers
+	a.VirtualHosts = opts.VirtualHosts
 }
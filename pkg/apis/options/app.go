@@ -9,8 +9,18 @@ type Templates struct {
 	// template.
 	// These files will be used instead of the default templates if present.
 	// If either file is missing, the default will be used instead.
+	// Other .html files are loaded as templates the pages can include, the
+	// static subdirectory holds static assets, and the hosts subdirectory
+	// holds a directory overriding these for each branded host.
 	Path string `flag:"custom-templates-dir" cfg:"custom_templates_dir"`
 
+	// TranslationsPath is the path to a folder of message catalogs translating
+	// the sign_in and error pages, selected by the Accept-Language header of
+	// requests.
+	// Each catalog is a JSON object mapping the English messages to their
+	// translation, in a file named after its language, eg. de.json.
+	TranslationsPath string `flag:"translations-dir" cfg:"translations_dir"`
+
 	// CustomLogo is the path or a URL to a logo that should replace the default logo
 	// on the sign_in page template.
 	// Supported formats are .svg, .png, .jpg and .jpeg.
@@ -41,6 +51,7 @@ func templatesFlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("templates", pflag.ExitOnError)
 
 	flagSet.String("custom-templates-dir", "", "path to custom html templates")
+	flagSet.String("translations-dir", "", "path to message catalogs translating the sign_in and error pages")
 	flagSet.String("custom-sign-in-logo", "", "path or URL to an custom image for the sign_in page logo. Use \"-\" to disable default logo.")
 	flagSet.String("banner", "", "custom banner string. Use \"-\" to disable default banner.")
 	flagSet.String("footer", "", "custom footer string. Use \"-\" to disable default footer.")
@@ -0,0 +1,107 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AuthMode is the authentication requirement of a route
+type AuthMode string
+
+const (
+	// AuthModeRequired requires a valid session, redirecting unauthenticated
+	// users to sign in. This is the default for routes that match no auth route.
+	AuthModeRequired AuthMode = "required"
+
+	// AuthModeOptional proxies requests with a valid session as authenticated,
+	// and requests without one anonymously.
+	AuthModeOptional AuthMode = "optional"
+
+	// AuthModeBearerOnly requires a session from a bearer token in the
+	// Authorization header. Cookie sessions are ignored and unauthenticated
+	// requests receive a 401 rather than a redirect.
+	AuthModeBearerOnly AuthMode = "bearer-only"
+
+	// AuthModeSkip bypasses authentication entirely.
+	AuthModeSkip AuthMode = "skip"
+)
+
+// LoginAction is how requests matching an auth route are answered when they
+// need the user to sign in
+type LoginAction string
+
+const (
+	// LoginActionRedirect sends unauthenticated users to sign in, with the
+	// sign in page or a redirect to the provider.
+	LoginActionRedirect LoginAction = "redirect"
+
+	// LoginActionUnauthorized answers unauthenticated requests with a 401
+	// JSON error.
+	LoginActionUnauthorized LoginAction = "401"
+
+	// LoginActionForbidden answers unauthenticated requests with a 403 JSON
+	// error.
+	LoginActionForbidden LoginAction = "403"
+)
+
+// AuthRoute is a route of the AuthRoutes option
+type AuthRoute struct {
+	// Mode is the authentication requirement of the requests. When empty,
+	// the route only sets the login action, and the authentication mode is
+	// decided by the following auth routes and the skip auth routes.
+	Mode AuthMode
+
+	// MethodPath is the method=path route the requests must match, which
+	// has the same format as a skip auth route.
+	MethodPath string
+
+	// Login is how the requests are answered when they need the user to sign
+	// in. When empty, API and JSON requests receive a 401 and other requests
+	// are sent to sign in.
+	Login LoginAction
+}
+
+// ParseAuthRoute parses an auth route of the form settings:method=path_regex,
+// settings:method!=path_regex or settings:path_regex, where the settings are
+// a mode, a login=action or both separated by a comma, eg.
+// required,login=401:^/api/ or login=401:^/api/.
+// The route is everything after the first colon, as neither the modes nor
+// the login actions contain one, so the path regex may contain any character.
+func ParseAuthRoute(route string) (AuthRoute, error) {
+	settings, methodPath, ok := strings.Cut(route, ":")
+	if !ok || settings == "" {
+		return AuthRoute{}, fmt.Errorf("auth route %q must be of the form mode[,login=action]:[method=]path_regex or login=action:[method=]path_regex", route)
+	}
+
+	parsed := AuthRoute{MethodPath: methodPath}
+	for _, setting := range strings.Split(settings, ",") {
+		if value, ok := strings.CutPrefix(setting, "login="); ok {
+			if parsed.Login != "" {
+				return AuthRoute{}, fmt.Errorf("auth route %q sets the login action more than once", route)
+			}
+			switch action := LoginAction(value); action {
+			case LoginActionRedirect, LoginActionUnauthorized, LoginActionForbidden:
+				parsed.Login = action
+			default:
+				return AuthRoute{}, fmt.Errorf("auth route %q has unknown login action %q, must be one of %q, %q or %q",
+					route, value, LoginActionRedirect, LoginActionUnauthorized, LoginActionForbidden)
+			}
+			continue
+		}
+
+		if parsed.Mode != "" {
+			return AuthRoute{}, fmt.Errorf("auth route %q sets the mode more than once", route)
+		}
+		switch mode := AuthMode(setting); mode {
+		case AuthModeRequired, AuthModeOptional, AuthModeBearerOnly, AuthModeSkip:
+			parsed.Mode = mode
+		default:
+			return AuthRoute{}, fmt.Errorf("auth route %q has unknown mode %q, must be one of %q, %q, %q or %q",
+				route, setting, AuthModeRequired, AuthModeOptional, AuthModeBearerOnly, AuthModeSkip)
+		}
+	}
+	if parsed.Login != "" && (parsed.Mode == AuthModeBearerOnly || parsed.Mode == AuthModeSkip) {
+		return AuthRoute{}, fmt.Errorf("auth route %q cannot set a login action with mode %q", route, parsed.Mode)
+	}
+	return parsed, nil
+}
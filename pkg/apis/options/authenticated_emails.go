@@ -0,0 +1,36 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// AuthenticatedEmails includes options for loading the authenticated emails
+// from an HTTPS endpoint, such as an internal service, instead of the
+// authenticated emails file.
+type AuthenticatedEmails struct {
+	// URL is the HTTPS URL the authenticated emails are fetched from, in the
+	// format of the authenticated emails file.
+	URL string `flag:"authenticated-emails-url" cfg:"authenticated_emails_url"`
+	// RefreshInterval is how often the URL is polled for changes, with
+	// conditional requests so unchanged lists are not downloaded again.
+	RefreshInterval time.Duration `flag:"authenticated-emails-refresh-interval" cfg:"authenticated_emails_refresh_interval"`
+}
+
+func authenticatedEmailsFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("authenticatedemails", pflag.ExitOnError)
+
+	flagSet.String("authenticated-emails-url", "", "authenticate against emails fetched from an HTTPS URL, in the format of the authenticated emails file, instead of a file")
+	flagSet.Duration("authenticated-emails-refresh-interval", time.Minute, "how often the authenticated emails URL is polled for changes")
+
+	return flagSet
+}
+
+// authenticatedEmailsDefaults creates an AuthenticatedEmails populating each
+// field with its default value
+func authenticatedEmailsDefaults() AuthenticatedEmails {
+	return AuthenticatedEmails{
+		RefreshInterval: time.Minute,
+	}
+}
@@ -0,0 +1,59 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Chaos includes options for injecting latency and errors into provider
+// calls, the session store and upstream proxying. They allow operators to
+// verify their timeout, retry and alerting configuration before a real
+// incident.
+// These options are hidden from the usage output and must not be used in
+// production.
+type Chaos struct {
+	// ProviderLatency is added to the given percentage of outbound HTTP
+	// requests made to the provider.
+	ProviderLatency           time.Duration `flag:"chaos-provider-latency" cfg:"chaos_provider_latency"`
+	ProviderLatencyPercentage int           `flag:"chaos-provider-latency-percentage" cfg:"chaos_provider_latency_percentage"`
+	// ProviderErrorPercentage is the percentage of outbound HTTP requests made
+	// to the provider that fail with an error.
+	ProviderErrorPercentage int `flag:"chaos-provider-error-percentage" cfg:"chaos_provider_error_percentage"`
+
+	// SessionStoreLatency is added to the given percentage of session store
+	// operations.
+	SessionStoreLatency           time.Duration `flag:"chaos-session-store-latency" cfg:"chaos_session_store_latency"`
+	SessionStoreLatencyPercentage int           `flag:"chaos-session-store-latency-percentage" cfg:"chaos_session_store_latency_percentage"`
+	// SessionStoreErrorPercentage is the percentage of session store
+	// operations that fail with an error.
+	SessionStoreErrorPercentage int `flag:"chaos-session-store-error-percentage" cfg:"chaos_session_store_error_percentage"`
+
+	// UpstreamLatency is added to the given percentage of proxied requests.
+	UpstreamLatency           time.Duration `flag:"chaos-upstream-latency" cfg:"chaos_upstream_latency"`
+	UpstreamLatencyPercentage int           `flag:"chaos-upstream-latency-percentage" cfg:"chaos_upstream_latency_percentage"`
+	// UpstreamErrorPercentage is the percentage of proxied requests that
+	// fail with a 502 Bad Gateway response instead of reaching the upstream.
+	UpstreamErrorPercentage int `flag:"chaos-upstream-error-percentage" cfg:"chaos_upstream_error_percentage"`
+}
+
+func chaosFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("chaos", pflag.ExitOnError)
+
+	flagSet.Duration("chaos-provider-latency", 0, "latency to inject into provider requests")
+	flagSet.Int("chaos-provider-latency-percentage", 0, "percentage of provider requests to inject latency into")
+	flagSet.Int("chaos-provider-error-percentage", 0, "percentage of provider requests to fail")
+	flagSet.Duration("chaos-session-store-latency", 0, "latency to inject into session store operations")
+	flagSet.Int("chaos-session-store-latency-percentage", 0, "percentage of session store operations to inject latency into")
+	flagSet.Int("chaos-session-store-error-percentage", 0, "percentage of session store operations to fail")
+	flagSet.Duration("chaos-upstream-latency", 0, "latency to inject into upstream requests")
+	flagSet.Int("chaos-upstream-latency-percentage", 0, "percentage of upstream requests to inject latency into")
+	flagSet.Int("chaos-upstream-error-percentage", 0, "percentage of upstream requests to fail with a 502")
+
+	flagSet.VisitAll(func(flag *pflag.Flag) {
+		// MarkHidden only fails for unknown flags
+		_ = flagSet.MarkHidden(flag.Name)
+	})
+
+	return flagSet
+}
@@ -17,6 +17,16 @@ type SecretSource struct {
 
 	// FromFile expects a path to a file containing the secret value.
 	FromFile string `json:"fromFile,omitempty"`
+
+	// FromRef expects a reference to a secret held in a secret store, eg. a
+	// key of a Kubernetes Secret, `kubernetes://namespace/secret/key`, a field
+	// of a HashiCorp Vault secret, `vault://secret/data/app#key`, or a secret
+	// of the AWS, GCP or Azure secret managers, `aws-secretsmanager://id`,
+	// `gcp-secretmanager://projects/project/secrets/secret` or
+	// `azure-keyvault://vault/secret`.
+	// Values are cached and fetched again every few minutes so that rotated
+	// secrets are picked up.
+	FromRef string `json:"fromRef,omitempty"`
 }
 
 // Duration is an alias for time.Duration so that we can ensure the marshalling
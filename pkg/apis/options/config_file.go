@@ -0,0 +1,237 @@
+package options
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/a8m/envsubst"
+	"github.com/ghodss/yaml"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// includeKey is the config file option listing the config files to load
+// before the file that includes them
+const includeKey = "include"
+
+// envReferencePattern matches the `${VAR}` references to environment
+// variables in config files, along with the `$${VAR}` escapes of literal
+// references. Bare `$VAR` references are not substituted so that the `$`
+// in existing values, such as regular expressions, is left untouched.
+var envReferencePattern = regexp.MustCompile(`\$?\$\{[^}]*\}`)
+
+// configFileFormat returns the format of the config file from its extension.
+// Config files are in TOML format unless their extension says otherwise.
+func configFileFormat(configFileName string) string {
+	switch strings.ToLower(filepath.Ext(configFileName)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	default:
+		return "toml"
+	}
+}
+
+// readConfigFile reads the config file at the path given, along with the files
+// it includes, into a map of options keyed by their `cfg` name.
+// Environment variable references are substituted before the file is parsed,
+// and the sections of structured files are flattened so that
+//
+//	[cookie]
+//	secret = "..."
+//
+// is read as `cookie_secret = "..."`.
+// Included files are read first, in order, so that the options of the
+// including file override them.
+func readConfigFile(configFileName string, schema map[string]reflect.Value) (map[string]interface{}, error) {
+	return readConfigFileFrom(configFileName, schema, map[string]bool{})
+}
+
+func readConfigFileFrom(configFileName string, schema map[string]reflect.Value, including map[string]bool) (map[string]interface{}, error) {
+	path, err := filepath.Abs(configFileName)
+	if err != nil {
+		return nil, err
+	}
+	if including[path] {
+		return nil, fmt.Errorf("config file %s includes itself", configFileName)
+	}
+	including[path] = true
+	defer delete(including, path)
+
+	content, err := os.ReadFile(configFileName)
+	if err != nil {
+		return nil, err
+	}
+	content, err = substituteEnvReferences(content)
+	if err != nil {
+		return nil, fmt.Errorf("error in substituting env variables in %s: %w", configFileName, err)
+	}
+
+	v := viper.New()
+	v.SetConfigType(configFileFormat(configFileName))
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	settings := v.AllSettings()
+
+	var includes []string
+	if include, ok := settings[includeKey]; ok {
+		includes, err = cast.ToStringSliceE(include)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", includeKey, configFileName, err)
+		}
+		delete(settings, includeKey)
+	}
+
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(configFileName), include)
+		}
+		included, err := readConfigFileFrom(include, schema, including)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range included {
+			merged[key] = value
+		}
+	}
+
+	options := map[string]interface{}{}
+	flattenConfig("", settings, schema, options)
+	var unknown []string
+	for key, value := range options {
+		if _, ok := schema[key]; !ok {
+			unknown = append(unknown, key)
+		}
+		merged[key] = value
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown option(s) in %s: %s", configFileName, strings.Join(unknown, ", "))
+	}
+
+	return merged, nil
+}
+
+// substituteEnvReferences substitutes the `${VAR}` references to environment
+// variables in the content of a config file
+func substituteEnvReferences(content []byte) ([]byte, error) {
+	var substituteErr error
+	substituted := envReferencePattern.ReplaceAllFunc(content, func(reference []byte) []byte {
+		value, err := envsubst.Bytes(reference)
+		if err != nil && substituteErr == nil {
+			substituteErr = err
+		}
+		return value
+	})
+	return substituted, substituteErr
+}
+
+// flattenConfig adds the options in the sections of a config file to the
+// options given, joining the names of nested sections with `_`.
+// Sections named after an option are the value of that option.
+func flattenConfig(prefix string, section map[string]interface{}, schema map[string]reflect.Value, options map[string]interface{}) {
+	for name, value := range section {
+		key := name
+		if prefix != "" {
+			key = prefix + "_" + name
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			if _, isOption := schema[key]; !isOption {
+				flattenConfig(key, nested, schema, options)
+				continue
+			}
+		}
+		options[key] = value
+	}
+}
+
+// configSchema returns the fields of the options given, keyed by the `cfg`
+// name of the option they hold.
+func configSchema(options interface{}) map[string]reflect.Value {
+	schema := map[string]reflect.Value{}
+	addToConfigSchema(reflect.Indirect(reflect.ValueOf(options)), schema)
+	return schema
+}
+
+func addToConfigSchema(val reflect.Value, schema map[string]reflect.Value) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		cfgName := field.Tag.Get("cfg")
+		if cfgName == ",internal" || isUnexported(field.Name) {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct && cfgName == ",squash" {
+			addToConfigSchema(val.Field(i), schema)
+			continue
+		}
+		if cfgName != "" {
+			schema[cfgName] = val.Field(i)
+		}
+	}
+}
+
+// nestConfig groups the options sharing the first part of their name into
+// sections, so that a converted config file reads like a structured one.
+// Options are only grouped when reading the sections back, as flattenConfig
+// does, gives the same options.
+func nestConfig(options map[string]interface{}, schema map[string]reflect.Value) map[string]interface{} {
+	sections := map[string]map[string]interface{}{}
+	for key, value := range options {
+		section, name, found := strings.Cut(key, "_")
+		if !found {
+			continue
+		}
+		if _, isOption := schema[section]; isOption {
+			continue
+		}
+		if sections[section] == nil {
+			sections[section] = map[string]interface{}{}
+		}
+		sections[section][name] = value
+	}
+
+	nested := map[string]interface{}{}
+	for key, value := range options {
+		section, _, _ := strings.Cut(key, "_")
+		if len(sections[section]) > 1 {
+			nested[section] = sections[section]
+			continue
+		}
+		nested[key] = value
+	}
+	return nested
+}
+
+// configValue returns the value of an option as it is written in a config file
+func configValue(field reflect.Value) interface{} {
+	if d, ok := field.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return field.Interface()
+}
+
+// marshalConfig renders the options in the format given
+func marshalConfig(options map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(options)
+	case "toml":
+		return toml.Marshal(options)
+	default:
+		return nil, fmt.Errorf("unknown config format %q: expected yaml or toml", format)
+	}
+}
@@ -3,6 +3,7 @@ package options
 import (
 	"time"
 
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/spf13/pflag"
 )
 
@@ -10,6 +11,7 @@ import (
 type Cookie struct {
 	Name           string        `flag:"cookie-name" cfg:"cookie_name"`
 	Secret         string        `flag:"cookie-secret" cfg:"cookie_secret"`
+	SecretRef      string        `flag:"cookie-secret-ref" cfg:"cookie_secret_ref"`
 	Domains        []string      `flag:"cookie-domain" cfg:"cookie_domains"`
 	Path           string        `flag:"cookie-path" cfg:"cookie_path"`
 	Expire         time.Duration `flag:"cookie-expire" cfg:"cookie_expire"`
@@ -19,6 +21,81 @@ type Cookie struct {
 	SameSite       string        `flag:"cookie-samesite" cfg:"cookie_samesite"`
 	CSRFPerRequest bool          `flag:"cookie-csrf-per-request" cfg:"cookie_csrf_per_request"`
 	CSRFExpire     time.Duration `flag:"cookie-csrf-expire" cfg:"cookie_csrf_expire"`
+	KeyDerivation  string        `flag:"cookie-key-derivation" cfg:"cookie_key_derivation"`
+	SigningSecret  string        `flag:"cookie-signing-secret" cfg:"cookie_signing_secret"`
+
+	// internal values that are set after config validation
+	encryptionKey *encryption.LockedBuffer
+	signingKey    *encryption.LockedBuffer
+	previous      *Cookie
+}
+
+// GetEncryptionKey returns the key used to encrypt cookie values.
+// If no key has been set, the cookie secret is used directly.
+// Each call returns a copy of the key that the caller may keep.
+func (c *Cookie) GetEncryptionKey() []byte {
+	if c.encryptionKey != nil {
+		return c.encryptionKey.Bytes()
+	}
+	return encryption.SecretBytes(c.Secret)
+}
+
+// GetSigningKey returns the key used to sign cookie values.
+// If no key has been set, the cookie secret is used directly.
+// Each call returns a copy of the key that the caller may keep.
+func (c *Cookie) GetSigningKey() []byte {
+	if c.signingKey != nil {
+		return c.signingKey.Bytes()
+	}
+	return []byte(c.Secret)
+}
+
+// SetCookieKeys sets the cookie encryption and signing keys.
+// Both keys are moved to locked memory and zeroed.
+func (c *Cookie) SetCookieKeys(encryptionKey, signingKey []byte) {
+	c.encryptionKey = encryption.NewLockedBuffer(encryptionKey)
+	c.signingKey = encryption.NewLockedBuffer(signingKey)
+}
+
+// SetPreviousSecret sets the cookie secret the secret reference had before it
+// was rotated, whose keys are also used by GetCookieKeys
+func (c *Cookie) SetPreviousSecret(secret string) {
+	c.previous = &Cookie{
+		Secret:        secret,
+		KeyDerivation: c.KeyDerivation,
+		SigningSecret: c.SigningSecret,
+	}
+}
+
+// Previous returns the cookie options of the previous cookie secret, if the
+// secret reference has been rotated, so that their keys can be set
+func (c *Cookie) Previous() *Cookie {
+	return c.previous
+}
+
+// CookieKeys are the encryption and signing keys of a cookie secret
+type CookieKeys struct {
+	EncryptionKey []byte
+	SigningKey    []byte
+}
+
+// GetCookieKeys returns the keys of the cookie secret, followed by those of
+// the previous cookie secret once the secret reference has been rotated.
+// Values are protected with the first keys, and read with any of them, so
+// that existing sessions survive the rotation.
+func (c *Cookie) GetCookieKeys() []CookieKeys {
+	keys := []CookieKeys{{EncryptionKey: c.GetEncryptionKey(), SigningKey: c.GetSigningKey()}}
+	if c.previous != nil {
+		keys = append(keys, CookieKeys{EncryptionKey: c.previous.GetEncryptionKey(), SigningKey: c.previous.GetSigningKey()})
+	}
+	return keys
+}
+
+// CookieKeysLocked returns whether the cookie encryption and signing keys
+// are held in locked memory
+func (c *Cookie) CookieKeysLocked() bool {
+	return c.encryptionKey != nil && c.encryptionKey.Locked() &&
+		c.signingKey != nil && c.signingKey.Locked()
 }
 
 func cookieFlagSet() *pflag.FlagSet {
@@ -26,6 +103,7 @@ func cookieFlagSet() *pflag.FlagSet {
 
 	flagSet.String("cookie-name", "_oauth2_proxy", "the name of the cookie that the oauth_proxy creates")
 	flagSet.String("cookie-secret", "", "the seed string for secure cookies (optionally base64 encoded)")
+	flagSet.String("cookie-secret-ref", "", "a reference to the cookie secret in a secret store, eg. aws-secretsmanager://secret-id, which is renewed periodically. Cookies protected by the previous secret stay valid once it is rotated")
 	flagSet.StringSlice("cookie-domain", []string{}, "Optional cookie domains to force cookies to (ie: `.yourcompany.com`). The longest domain matching the request's host will be used (or the shortest cookie domain if there is no match).")
 	flagSet.String("cookie-path", "/", "an optional cookie path to force cookies to (ie: /poc/)*")
 	flagSet.Duration("cookie-expire", time.Duration(168)*time.Hour, "expire timeframe for cookie")
@@ -35,6 +113,8 @@ func cookieFlagSet() *pflag.FlagSet {
 	flagSet.String("cookie-samesite", "", "set SameSite cookie attribute (ie: \"lax\", \"strict\", \"none\", or \"\"). ")
 	flagSet.Bool("cookie-csrf-per-request", false, "When this property is set to true, then the CSRF cookie name is built based on the state and varies per request. If property is set to false, then CSRF cookie has the same name for all requests.")
 	flagSet.Duration("cookie-csrf-expire", time.Duration(15)*time.Minute, "expire timeframe for CSRF cookie")
+	flagSet.String("cookie-key-derivation", "none", "how cookie encryption and signing keys are derived from the cookie secret (ie: \"none\", \"hkdf-sha256\" or \"argon2id\")")
+	flagSet.String("cookie-signing-secret", "", "optional secret to derive the cookie signing key from, allowing it to be rotated independently of the cookie secret. Requires --cookie-key-derivation")
 	return flagSet
 }
 
@@ -52,5 +132,7 @@ func cookieDefaults() Cookie {
 		SameSite:       "",
 		CSRFPerRequest: false,
 		CSRFExpire:     time.Duration(15) * time.Minute,
+		KeyDerivation:  "none",
+		SigningSecret:  "",
 	}
 }
@@ -1,2 +1,3 @@
 //go:generate go run github.com/oauth2-proxy/tools/reference-gen/cmd/reference-gen --package github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options --types AlphaOptions --header-file ../../../docs/docs/configuration/alpha_config.md.tmpl --out-file ../../../docs/docs/configuration/alpha_config.md
+//go:generate go run github.com/oauth2-proxy/oauth2-proxy/v7 alpha-config-schema --out-file ../../../docs/static/alpha_config.schema.json
 package options
@@ -0,0 +1,45 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Handoff includes options for sharing sessions with sibling OAuth2 Proxy
+// instances, such as proxies on unrelated top-level domains that cannot
+// share a cookie. A proxy with a session mints a one-time handoff code that
+// the sibling redeems to establish its own session, without sending the user
+// back to the provider.
+type Handoff struct {
+	// Secret is the key shared by all of the sibling proxies to encrypt
+	// handoff codes. Handoff is disabled when it is empty.
+	Secret string `flag:"handoff-secret" cfg:"handoff_secret"`
+	// Expire is how long a handoff code can be redeemed for.
+	Expire time.Duration `flag:"handoff-expire" cfg:"handoff_expire"`
+	// AllowedDomains are the domains of the sibling proxies that handoff
+	// codes may be minted for. Codes are only minted when this is set.
+	AllowedDomains []string `flag:"handoff-allowed-domain" cfg:"handoff_allowed_domains"`
+	// URL is the handoff endpoint of the sibling proxy that sessions are
+	// handed off from, e.g. https://auth.example.com/oauth2/handoff.
+	// Sessions are only redeemed from a sibling when this is set.
+	URL string `flag:"handoff-url" cfg:"handoff_url"`
+}
+
+func handoffFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("handoff", pflag.ExitOnError)
+
+	flagSet.String("handoff-secret", "", "the secret shared by sibling proxies to encrypt session handoff codes")
+	flagSet.Duration("handoff-expire", time.Second*30, "how long a session handoff code can be redeemed for")
+	flagSet.StringSlice("handoff-allowed-domain", []string{}, "domains of sibling proxies that session handoff codes may be minted for (may be given multiple times)")
+	flagSet.String("handoff-url", "", "the handoff endpoint of the sibling proxy that sessions are handed off from (e.g. https://auth.example.com/oauth2/handoff)")
+
+	return flagSet
+}
+
+// handoffDefaults creates a Handoff populating each field with its default value
+func handoffDefaults() Handoff {
+	return Handoff{
+		Expire: time.Second * 30,
+	}
+}
@@ -25,6 +25,18 @@ type HeaderValue struct {
 
 	// Allow users to load the value from a session claim
 	*ClaimSource `json:",omitempty"`
+
+	// JWT mints a JWT signed by the proxy holding claims of the session
+	JWT *JWTSource `json:"jwt,omitempty"`
+
+	// Template renders the value from a Go template, eg.
+	// `user={{ .Email }};groups={{ .Groups | join "," }}`.
+	// The template has the `User`, `Email`, `PreferredUsername` and `Groups`
+	// of the session, other claims with `{{ .Claim "name" }}`, and the
+	// `Method`, `Host`, `Path`, `Query` and `Header` of the request as
+	// `.Request`. The template functions of the proxy are available.
+	// The value is left out when it renders empty.
+	Template string `json:"template,omitempty"`
 }
 
 // ClaimSource allows loading a header value from a claim within the session
@@ -42,4 +54,76 @@ type ClaimSource struct {
 	// Note the value of claim will become the basic auth username and the
 	// basicAuthPassword will be used as the password value.
 	BasicAuthPassword *SecretSource `json:"basicAuthPassword,omitempty"`
+
+	// Transforms are applied to each value of the claim in order, before the
+	// prefix is added or the value is used as the basic auth username.
+	// Values that are empty once transformed are left out.
+	Transforms []ClaimTransform `json:"transforms,omitempty"`
+}
+
+// ClaimTransform transforms the value of a claim.
+// Only one transformation may be set per ClaimTransform.
+type ClaimTransform struct {
+	// Extract is a regular expression the value is replaced with the match
+	// of, or with the first submatch when it has one, eg: `^([^@]+)@` for the
+	// local part of a UPN. Values that do not match are left out.
+	Extract string `json:"extract,omitempty"`
+
+	// Replace replaces every match of a regular expression in the value.
+	Replace *ClaimReplace `json:"replace,omitempty"`
+
+	// Case folds the value to `upper` or `lower` case.
+	Case string `json:"case,omitempty"`
+
+	// Base64 either `encode`s the value with standard base64 encoding or
+	// `decode`s it from standard or URL base64 encoding.
+	Base64 string `json:"base64,omitempty"`
+
+	// StripPrefix removes the prefix from the value, if it has it.
+	StripPrefix string `json:"stripPrefix,omitempty"`
+}
+
+// ClaimReplace replaces the matches of a regular expression in a claim value
+type ClaimReplace struct {
+	// Pattern is the regular expression to match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Replacement replaces each match, and may refer to submatches,
+	// eg: `CORP\${1}`.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// JWTSource mints a short-lived JWT signed by the proxy, holding claims of the
+// session, so that upstream servers can verify the identity of the user
+// cryptographically rather than trusting plain headers.
+// The JWT has the `iss`, `sub`, `aud`, `iat` and `exp` claims, with the user
+// of the session as the subject.
+type JWTSource struct {
+	// SigningKey is the PEM encoded private key the JWT is signed with.
+	// RSA keys sign with RS256, and P-256 EC keys with ES256.
+	SigningKey *SecretSource `json:"signingKey,omitempty"`
+
+	// KeyID is set as the `kid` header of the JWT, so that upstream servers
+	// can find the public key to verify it with
+	KeyID string `json:"keyID,omitempty"`
+
+	// Issuer is the `iss` claim of the JWT.
+	// Defaults to "oauth2-proxy".
+	Issuer string `json:"issuer,omitempty"`
+
+	// Audience is the `aud` claim of the JWT, identifying the upstream
+	// servers it is intended for
+	Audience string `json:"audience,omitempty"`
+
+	// Expiry is how long the JWT is valid for after it is minted.
+	// Defaults to 5 minutes.
+	Expiry *Duration `json:"expiry,omitempty"`
+
+	// Claims maps claims of the JWT to the claims of the session they are
+	// taken from, eg: `email: email` or `roles: groups`. The `groups` claim
+	// of the session is always a list, other claims are strings.
+	Claims map[string]string `json:"claims,omitempty"`
+
+	// Prefix is prepended to the JWT, eg: `Bearer `.
+	Prefix string `json:"prefix,omitempty"`
 }
@@ -0,0 +1,46 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// HtpasswdLockout includes options for slowing down and locking out the
+// clients and users guessing the passwords of the htpasswd file, with basic
+// auth or the sign in form.
+// Failed attempts are tracked per username and per client IP. After each
+// failure, further attempts are rejected for a delay doubling with each
+// failure, and once the threshold is reached they are locked out.
+type HtpasswdLockout struct {
+	// Threshold is the number of consecutive failed attempts after which a
+	// username or client is locked out. Lockouts are disabled when zero.
+	Threshold int `flag:"htpasswd-lockout-threshold" cfg:"htpasswd_lockout_threshold"`
+	// Duration is how long the first lockout lasts, doubling with each
+	// further failed attempt. The delays before the threshold is reached
+	// start at a second and do not exceed it.
+	Duration time.Duration `flag:"htpasswd-lockout-duration" cfg:"htpasswd_lockout_duration"`
+	// MaxDuration caps how long lockouts last. Failed attempts are forgotten
+	// once it has passed since the end of the last delay or lockout.
+	MaxDuration time.Duration `flag:"htpasswd-lockout-max-duration" cfg:"htpasswd_lockout_max_duration"`
+}
+
+func htpasswdLockoutFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("htpasswdlockout", pflag.ExitOnError)
+
+	flagSet.Int("htpasswd-lockout-threshold", 5, "number of consecutive failed htpasswd logins after which a username or client IP is locked out (disabled if 0)")
+	flagSet.Duration("htpasswd-lockout-duration", time.Minute, "how long the first htpasswd lockout lasts, doubling with each further failed login")
+	flagSet.Duration("htpasswd-lockout-max-duration", time.Hour, "the maximum duration of an htpasswd lockout")
+
+	return flagSet
+}
+
+// htpasswdLockoutDefaults creates a HtpasswdLockout populating each field
+// with its default value
+func htpasswdLockoutDefaults() HtpasswdLockout {
+	return HtpasswdLockout{
+		Threshold:   5,
+		Duration:    time.Minute,
+		MaxDuration: time.Hour,
+	}
+}
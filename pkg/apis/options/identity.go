@@ -0,0 +1,32 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// IdentityNormalization includes options for normalizing the user ID and
+// email of sessions before they are authorized and passed to upstreams, such
+// as when migrating between identity providers that format them differently.
+// The subject emails are mapped first, then the email domain aliases, and the
+// user ID and email are lowercased last.
+type IdentityNormalization struct {
+	// LowercaseUser lowercases the user ID of sessions.
+	LowercaseUser bool `flag:"normalize-lowercase-user" cfg:"normalize_lowercase_user"`
+	// LowercaseEmail lowercases the email of sessions.
+	LowercaseEmail bool `flag:"normalize-lowercase-email" cfg:"normalize_lowercase_email"`
+	// EmailDomainAliases replace the domain of session emails, in the form
+	// `old.com=new.com`. Domains are matched case insensitively.
+	EmailDomainAliases []string `flag:"normalize-email-domain-alias" cfg:"normalize_email_domain_aliases"`
+	// SubjectEmailsFile is a CSV file of `subject,email` lines setting the
+	// email of the sessions of the users with the subject.
+	SubjectEmailsFile string `flag:"normalize-subject-emails-file" cfg:"normalize_subject_emails_file"`
+}
+
+func identityNormalizationFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("identity", pflag.ExitOnError)
+
+	flagSet.Bool("normalize-lowercase-user", false, "lowercase the user ID of sessions before they are authorized and passed to upstreams")
+	flagSet.Bool("normalize-lowercase-email", false, "lowercase the email of sessions before they are authorized and passed to upstreams")
+	flagSet.StringSlice("normalize-email-domain-alias", []string{}, "replace the domain of session emails, eg: old.com=new.com (may be given multiple times)")
+	flagSet.String("normalize-subject-emails-file", "", "CSV file of subject,email lines setting the email of the sessions of users by their subject")
+
+	return flagSet
+}
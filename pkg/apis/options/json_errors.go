@@ -0,0 +1,33 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// JSONErrors includes options for the content negotiation answering API
+// clients with JSON errors, instead of the sign in and error pages, when
+// they are unauthenticated or unauthorized.
+type JSONErrors struct {
+	// AcceptTypes are the media types that, when accepted by a request, answer
+	// it with a JSON error.
+	AcceptTypes []string `flag:"json-errors-accept-type" cfg:"json_errors_accept_types"`
+	// Headers are the headers that, when present in a request, answer it with
+	// a JSON error, such as the X-Requested-With header of AJAX requests.
+	Headers []string `flag:"json-errors-header" cfg:"json_errors_headers"`
+}
+
+func jsonErrorsFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("jsonerrors", pflag.ExitOnError)
+
+	flagSet.StringSlice("json-errors-accept-type", []string{"application/json"}, "media types of the Accept header answered with JSON errors instead of the sign in and error pages (may be given multiple times)")
+	flagSet.StringSlice("json-errors-header", []string{"X-Requested-With"}, "headers whose presence answers requests with JSON errors instead of the sign in and error pages (may be given multiple times)")
+
+	return flagSet
+}
+
+// jsonErrorsDefaults creates a JSONErrors populating each field with its
+// default value
+func jsonErrorsDefaults() JSONErrors {
+	return JSONErrors{
+		AcceptTypes: []string{"application/json"},
+		Headers:     []string{"X-Requested-With"},
+	}
+}
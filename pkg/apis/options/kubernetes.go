@@ -0,0 +1,31 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// Kubernetes includes options for the controller that configures virtual
+// hosts from OAuth2ProxyVirtualHost custom resources, so that the routes and
+// allowed groups of each application can be managed as Kubernetes objects.
+// The virtual hosts of the resources are added after those of the
+// configuration, and the configuration is reloaded whenever they change.
+type Kubernetes struct {
+	// VirtualHosts enables the controller. The proxy must run in the
+	// cluster, with a service account allowed to list and watch the
+	// resources.
+	VirtualHosts bool `flag:"kubernetes-virtual-hosts" cfg:"kubernetes_virtual_hosts"`
+	// Namespace restricts the controller to the resources of a namespace.
+	// The resources of all namespaces are watched when it is empty.
+	Namespace string `flag:"kubernetes-namespace" cfg:"kubernetes_namespace"`
+	// LabelSelector restricts the controller to the resources with matching
+	// labels, eg: `oauth2-proxy.github.io/instance=internal`.
+	LabelSelector string `flag:"kubernetes-label-selector" cfg:"kubernetes_label_selector"`
+}
+
+func kubernetesFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("kubernetes", pflag.ExitOnError)
+
+	flagSet.Bool("kubernetes-virtual-hosts", false, "configure virtual hosts from the OAuth2ProxyVirtualHost custom resources of the cluster, reloading the configuration when they change")
+	flagSet.String("kubernetes-namespace", "", "the namespace of the OAuth2ProxyVirtualHost resources to watch (all namespaces if empty)")
+	flagSet.String("kubernetes-label-selector", "", "the label selector of the OAuth2ProxyVirtualHost resources to watch")
+
+	return flagSet
+}
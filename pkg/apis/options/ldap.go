@@ -0,0 +1,85 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// LDAPEmailPlaceholder is replaced with the escaped email of the session in
+// the LDAP user filter
+const LDAPEmailPlaceholder = "{email}"
+
+// LDAP includes options for authorizing the emails of sessions by the
+// membership of their directory users in LDAP or Active Directory groups,
+// in addition to the email domains and authenticated emails file.
+type LDAP struct {
+	// URL is the ldap:// or ldaps:// URL of the directory server.
+	// Authorization by group membership is disabled when empty.
+	URL string `flag:"ldap-url" cfg:"ldap_url"`
+	// StartTLS upgrades ldap:// connections to TLS before binding.
+	StartTLS bool `flag:"ldap-start-tls" cfg:"ldap_start_tls"`
+	// CAFiles are the CA certificates the certificate of the server is
+	// verified with, instead of the system pool.
+	CAFiles []string `flag:"ldap-ca-file" cfg:"ldap_ca_files"`
+	// InsecureSkipVerify skips verifying the certificate of the server.
+	InsecureSkipVerify bool `flag:"ldap-insecure-skip-verify" cfg:"ldap_insecure_skip_verify"`
+	// BindDN and BindPassword are the credentials of the service account
+	// searching the directory. Searches are anonymous when BindDN is empty.
+	BindDN       string `flag:"ldap-bind-dn" cfg:"ldap_bind_dn"`
+	BindPassword string `flag:"ldap-bind-password" cfg:"ldap_bind_password"`
+	// UserBaseDN is the DN the users are searched under.
+	UserBaseDN string `flag:"ldap-user-base-dn" cfg:"ldap_user_base_dn"`
+	// UserFilter is the filter finding the user of an email, in which
+	// {email} is replaced with the escaped email.
+	UserFilter string `flag:"ldap-user-filter" cfg:"ldap_user_filter"`
+	// GroupAttribute is the attribute of the user listing the DNs of the
+	// groups the user is a member of.
+	GroupAttribute string `flag:"ldap-group-attribute" cfg:"ldap_group_attribute"`
+	// Groups are the DNs of the groups whose members are authorized. Every
+	// user found by the UserFilter is authorized when empty.
+	Groups []string `flag:"ldap-group" cfg:"ldap_groups"`
+	// PoolSize is the number of idle connections kept open to the server.
+	PoolSize int `flag:"ldap-pool-size" cfg:"ldap_pool_size"`
+	// Timeout bounds connecting to the server and each of its operations.
+	Timeout time.Duration `flag:"ldap-timeout" cfg:"ldap_timeout"`
+	// CacheDuration is how long the membership of an email is cached for.
+	// Memberships are looked up on each request when zero.
+	CacheDuration time.Duration `flag:"ldap-cache-duration" cfg:"ldap_cache_duration"`
+}
+
+// Enabled returns whether emails are authorized by group membership
+func (l LDAP) Enabled() bool {
+	return l.URL != ""
+}
+
+func ldapFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("ldap", pflag.ExitOnError)
+
+	flagSet.String("ldap-url", "", "the ldap:// or ldaps:// URL of a directory server to authorize emails by their users' group membership (disabled if empty)")
+	flagSet.Bool("ldap-start-tls", false, "upgrade ldap:// connections to TLS with StartTLS")
+	flagSet.StringSlice("ldap-ca-file", []string{}, "the CA certificates the LDAP server certificate is verified with (may be given multiple times)")
+	flagSet.Bool("ldap-insecure-skip-verify", false, "skip verifying the LDAP server certificate")
+	flagSet.String("ldap-bind-dn", "", "the DN of the service account searching the directory (anonymous if empty)")
+	flagSet.String("ldap-bind-password", "", "the password of the LDAP service account")
+	flagSet.String("ldap-user-base-dn", "", "the DN the users are searched under")
+	flagSet.String("ldap-user-filter", "(|(mail={email})(userPrincipalName={email}))", "the filter finding the user of an email, where {email} is replaced with the escaped email")
+	flagSet.String("ldap-group-attribute", "memberOf", "the attribute of the user listing the DNs of its groups")
+	flagSet.StringSlice("ldap-group", []string{}, "the DN of a group whose members are authorized (may be given multiple times). Every user found by the filter is authorized if none")
+	flagSet.Int("ldap-pool-size", 4, "the number of idle connections kept open to the LDAP server")
+	flagSet.Duration("ldap-timeout", 10*time.Second, "the timeout of connecting to the LDAP server and of each operation")
+	flagSet.Duration("ldap-cache-duration", 5*time.Minute, "how long the group membership of an email is cached for (disabled if 0)")
+
+	return flagSet
+}
+
+// ldapDefaults creates a LDAP populating each field with its default value
+func ldapDefaults() LDAP {
+	return LDAP{
+		UserFilter:     "(|(mail={email})(userPrincipalName={email}))",
+		GroupAttribute: "memberOf",
+		PoolSize:       4,
+		Timeout:        10 * time.Second,
+		CacheDuration:  5 * time.Minute,
+	}
+}
@@ -31,10 +31,12 @@ type LegacyOptions struct {
 func NewLegacyOptions() *LegacyOptions {
 	return &LegacyOptions{
 		LegacyUpstreams: LegacyUpstreams{
-			PassHostHeader:  true,
-			ProxyWebSockets: true,
-			FlushInterval:   DefaultUpstreamFlushInterval,
-			Timeout:         DefaultUpstreamTimeout,
+			PassHostHeader:         true,
+			ProxyWebSockets:        true,
+			StripProxyCookies:      true,
+			FlushInterval:          DefaultUpstreamFlushInterval,
+			Timeout:                DefaultUpstreamTimeout,
+			CircuitBreakerCooldown: DefaultUpstreamCircuitBreakerCooldown,
 		},
 
 		LegacyHeaders: LegacyHeaders{
@@ -49,15 +51,19 @@ func NewLegacyOptions() *LegacyOptions {
 		},
 
 		LegacyProvider: LegacyProvider{
-			ProviderType:          "google",
-			AzureTenant:           "common",
-			ApprovalPrompt:        "force",
-			UserIDClaim:           "email",
-			OIDCEmailClaim:        "email",
-			OIDCGroupsClaim:       "groups",
-			OIDCAudienceClaims:    []string{"aud"},
-			OIDCExtraAudiences:    []string{},
-			InsecureOIDCSkipNonce: true,
+			ProviderType:            "google",
+			AzureTenant:             "common",
+			ApprovalPrompt:          "force",
+			UserIDClaim:             "email",
+			OIDCEmailClaim:          "email",
+			OIDCGroupsClaim:         "groups",
+			OIDCAudienceClaims:      []string{"aud"},
+			OIDCExtraAudiences:      []string{},
+			InsecureOIDCSkipNonce:   true,
+			ProviderTimeout:         DefaultProviderTimeout,
+			ProviderRetryBackoff:    DefaultProviderRetryBackoff,
+			ProviderRetryMaxBackoff: DefaultProviderRetryMaxBackoff,
+			ProviderRetryBudget:     DefaultProviderRetryBudget,
 		},
 
 		Options: *NewOptions(),
@@ -86,6 +92,10 @@ func (l *LegacyOptions) ToOptions() (*Options, error) {
 	l.Options.InjectRequestHeaders, l.Options.InjectResponseHeaders = l.LegacyHeaders.convert()
 
 	l.Options.Server, l.Options.MetricsServer = l.LegacyServer.convert()
+	if l.Options.ACME.Enabled {
+		l.Options.Server = l.LegacyServer.convertACMEServer(l.Options.Server)
+	}
+	l.Options.AdminServer = l.LegacyServer.convertAdminServer()
 
 	l.Options.LegacyPreferEmailToUser = l.LegacyHeaders.PreferEmailToUser
 
@@ -102,9 +112,21 @@ type LegacyUpstreams struct {
 	FlushInterval                 time.Duration `flag:"flush-interval" cfg:"flush_interval"`
 	PassHostHeader                bool          `flag:"pass-host-header" cfg:"pass_host_header"`
 	ProxyWebSockets               bool          `flag:"proxy-websockets" cfg:"proxy_websockets"`
+	StripProxyCookies             bool          `flag:"strip-proxy-cookies" cfg:"strip_proxy_cookies"`
 	SSLUpstreamInsecureSkipVerify bool          `flag:"ssl-upstream-insecure-skip-verify" cfg:"ssl_upstream_insecure_skip_verify"`
 	Upstreams                     []string      `flag:"upstream" cfg:"upstreams"`
 	Timeout                       time.Duration `flag:"upstream-timeout" cfg:"upstream_timeout"`
+	CircuitBreakerThreshold       int           `flag:"upstream-circuit-breaker-threshold" cfg:"upstream_circuit_breaker_threshold"`
+	CircuitBreakerCooldown        time.Duration `flag:"upstream-circuit-breaker-cooldown" cfg:"upstream_circuit_breaker_cooldown"`
+	TimeoutBudgetHeader           string        `flag:"upstream-timeout-budget-header" cfg:"upstream_timeout_budget_header"`
+	TimeoutBudgetTrustedNetworks  []string      `flag:"upstream-timeout-budget-trusted-network" cfg:"upstream_timeout_budget_trusted_networks"`
+	AllowedResponseHeaders        []string      `flag:"upstream-allowed-response-header" cfg:"upstream_allowed_response_headers"`
+	DeniedResponseHeaders         []string      `flag:"upstream-denied-response-header" cfg:"upstream_denied_response_headers"`
+	MaxRequestBodySize            int64         `flag:"upstream-max-request-body-size" cfg:"upstream_max_request_body_size"`
+	MaxResponseBodySize           int64         `flag:"upstream-max-response-body-size" cfg:"upstream_max_response_body_size"`
+	ClientReadTimeout             time.Duration `flag:"upstream-client-read-timeout" cfg:"upstream_client_read_timeout"`
+	ClientWriteTimeout            time.Duration `flag:"upstream-client-write-timeout" cfg:"upstream_client_write_timeout"`
+	H2C                           bool          `flag:"upstream-h2c" cfg:"upstream_h2c"`
 }
 
 func legacyUpstreamsFlagSet() *pflag.FlagSet {
@@ -113,9 +135,21 @@ func legacyUpstreamsFlagSet() *pflag.FlagSet {
 	flagSet.Duration("flush-interval", DefaultUpstreamFlushInterval, "period between response flushing when streaming responses")
 	flagSet.Bool("pass-host-header", true, "pass the request Host Header to upstream")
 	flagSet.Bool("proxy-websockets", true, "enables WebSocket proxying")
+	flagSet.Bool("strip-proxy-cookies", true, "remove the session and CSRF cookies of the proxy from requests to upstreams")
 	flagSet.Bool("ssl-upstream-insecure-skip-verify", false, "skip validation of certificates presented when using HTTPS upstreams")
 	flagSet.StringSlice("upstream", []string{}, "the http url(s) of the upstream endpoint, file:// paths for static files or static://<status_code> for static response. Routing is based on the path")
 	flagSet.Duration("upstream-timeout", DefaultUpstreamTimeout, "maximum amount of time the server will wait for a response from the upstream")
+	flagSet.Int("upstream-circuit-breaker-threshold", 0, "number of consecutive failures after which requests stop being proxied to an upstream until it recovers (0 to disable)")
+	flagSet.Duration("upstream-circuit-breaker-cooldown", DefaultUpstreamCircuitBreakerCooldown, "duration an upstream's circuit breaker stays open before the upstream is probed")
+	flagSet.String("upstream-timeout-budget-header", "", "the header to forward the time remaining to respond to each request in to upstreams, in milliseconds (e.g. X-Request-Timeout-Ms)")
+	flagSet.StringSlice("upstream-timeout-budget-trusted-network", []string{}, "IPs or CIDR ranges of the gateways whose timeout budget header is honored (may be given multiple times)")
+	flagSet.StringSlice("upstream-allowed-response-header", []string{}, "the only headers of upstream responses passed back to clients, besides the Content-Type, Content-Length and Content-Encoding headers (may be given multiple times, a trailing * matches by prefix)")
+	flagSet.StringSlice("upstream-denied-response-header", []string{}, "headers removed from upstream responses before they are passed back to clients, eg: Server (may be given multiple times, a trailing * matches by prefix)")
+	flagSet.Int64("upstream-max-request-body-size", 0, "maximum size in bytes of the bodies of requests proxied to upstreams (0 for unlimited)")
+	flagSet.Int64("upstream-max-response-body-size", 0, "maximum size in bytes of the bodies of upstream responses (0 for unlimited)")
+	flagSet.Duration("upstream-client-read-timeout", 0, "maximum duration to read the body of each request proxied to upstreams from the client (0 for unlimited)")
+	flagSet.Duration("upstream-client-write-timeout", 0, "maximum duration to write each upstream response to the client (0 for unlimited)")
+	flagSet.Bool("upstream-h2c", false, "proxy requests to http:// and unix:// upstreams over HTTP/2 cleartext (h2c), such as gRPC services")
 
 	return flagSet
 }
@@ -142,6 +176,7 @@ func (l *LegacyUpstreams) convert() (UpstreamConfig, error) {
 			InsecureSkipTLSVerify: l.SSLUpstreamInsecureSkipVerify,
 			PassHostHeader:        &l.PassHostHeader,
 			ProxyWebSockets:       &l.ProxyWebSockets,
+			StripProxyCookies:     &l.StripProxyCookies,
 			FlushInterval:         &flushInterval,
 			Timeout:               &timeout,
 		}
@@ -174,15 +209,53 @@ func (l *LegacyUpstreams) convert() (UpstreamConfig, error) {
 			upstream.InsecureSkipTLSVerify = false
 			upstream.PassHostHeader = nil
 			upstream.ProxyWebSockets = nil
+			upstream.StripProxyCookies = nil
 			upstream.FlushInterval = nil
 			upstream.Timeout = nil
 		case "unix":
 			upstream.Path = "/"
 		}
 
+		if l.CircuitBreakerThreshold > 0 && !upstream.Static && u.Scheme != "file" {
+			cooldown := Duration(l.CircuitBreakerCooldown)
+			upstream.CircuitBreaker = &UpstreamCircuitBreaker{
+				FailureThreshold: l.CircuitBreakerThreshold,
+				Cooldown:         &cooldown,
+			}
+		}
+
+		if len(l.AllowedResponseHeaders) > 0 && !upstream.Static && u.Scheme != "file" {
+			upstream.AllowedResponseHeaders = l.AllowedResponseHeaders
+		}
+		if len(l.DeniedResponseHeaders) > 0 && !upstream.Static && u.Scheme != "file" {
+			upstream.DeniedResponseHeaders = l.DeniedResponseHeaders
+		}
+		if !upstream.Static && u.Scheme != "file" {
+			upstream.MaxRequestBodySize = l.MaxRequestBodySize
+			upstream.MaxResponseBodySize = l.MaxResponseBodySize
+		}
+		if l.ClientReadTimeout > 0 && !upstream.Static && u.Scheme != "file" {
+			clientReadTimeout := Duration(l.ClientReadTimeout)
+			upstream.ClientReadTimeout = &clientReadTimeout
+		}
+		if l.ClientWriteTimeout > 0 && !upstream.Static && u.Scheme != "file" {
+			clientWriteTimeout := Duration(l.ClientWriteTimeout)
+			upstream.ClientWriteTimeout = &clientWriteTimeout
+		}
+		if l.H2C && !upstream.Static && (u.Scheme == "http" || u.Scheme == "unix") {
+			upstream.H2C = true
+		}
+
 		upstreams.Upstreams = append(upstreams.Upstreams, upstream)
 	}
 
+	if l.TimeoutBudgetHeader != "" {
+		upstreams.TimeoutBudget = &UpstreamTimeoutBudget{
+			Header:          l.TimeoutBudgetHeader,
+			TrustedNetworks: l.TimeoutBudgetTrustedNetworks,
+		}
+	}
+
 	return upstreams, nil
 }
 
@@ -451,16 +524,36 @@ func getXAuthRequestAccessTokenHeader() Header {
 }
 
 type LegacyServer struct {
-	MetricsAddress       string   `flag:"metrics-address" cfg:"metrics_address"`
-	MetricsSecureAddress string   `flag:"metrics-secure-address" cfg:"metrics_secure_address"`
-	MetricsTLSCertFile   string   `flag:"metrics-tls-cert-file" cfg:"metrics_tls_cert_file"`
-	MetricsTLSKeyFile    string   `flag:"metrics-tls-key-file" cfg:"metrics_tls_key_file"`
-	HTTPAddress          string   `flag:"http-address" cfg:"http_address"`
-	HTTPSAddress         string   `flag:"https-address" cfg:"https_address"`
-	TLSCertFile          string   `flag:"tls-cert-file" cfg:"tls_cert_file"`
-	TLSKeyFile           string   `flag:"tls-key-file" cfg:"tls_key_file"`
-	TLSMinVersion        string   `flag:"tls-min-version" cfg:"tls_min_version"`
-	TLSCipherSuites      []string `flag:"tls-cipher-suite" cfg:"tls_cipher_suites"`
+	MetricsAddress         string   `flag:"metrics-address" cfg:"metrics_address"`
+	MetricsSecureAddress   string   `flag:"metrics-secure-address" cfg:"metrics_secure_address"`
+	MetricsTLSCertFile     string   `flag:"metrics-tls-cert-file" cfg:"metrics_tls_cert_file"`
+	MetricsTLSKeyFile      string   `flag:"metrics-tls-key-file" cfg:"metrics_tls_key_file"`
+	MetricsBearerTokenFile string   `flag:"metrics-bearer-token-file" cfg:"metrics_bearer_token_file"`
+	MetricsClientCAFile    string   `flag:"metrics-client-ca-file" cfg:"metrics_client_ca_file"`
+	MetricsAllowedNetworks []string `flag:"metrics-allowed-network" cfg:"metrics_allowed_networks"`
+	AdminAddress           string   `flag:"admin-address" cfg:"admin_address"`
+	AdminSecureAddress     string   `flag:"admin-secure-address" cfg:"admin_secure_address"`
+	AdminTLSCertFile       string   `flag:"admin-tls-cert-file" cfg:"admin_tls_cert_file"`
+	AdminTLSKeyFile        string   `flag:"admin-tls-key-file" cfg:"admin_tls_key_file"`
+	AdminBearerTokenFile   string   `flag:"admin-bearer-token-file" cfg:"admin_bearer_token_file"`
+	AdminClientCAFile      string   `flag:"admin-client-ca-file" cfg:"admin_client_ca_file"`
+	AdminAllowedNetworks   []string `flag:"admin-allowed-network" cfg:"admin_allowed_networks"`
+	HTTPAddress            string   `flag:"http-address" cfg:"http_address"`
+	HTTPSAddress           string   `flag:"https-address" cfg:"https_address"`
+	TLSCertFile            string   `flag:"tls-cert-file" cfg:"tls_cert_file"`
+	TLSKeyFile             string   `flag:"tls-key-file" cfg:"tls_key_file"`
+	TLSMinVersion          string   `flag:"tls-min-version" cfg:"tls_min_version"`
+	TLSCipherSuites        []string `flag:"tls-cipher-suite" cfg:"tls_cipher_suites"`
+	TLSClientCAFiles       []string `flag:"tls-client-ca-file" cfg:"tls_client_ca_files"`
+	TLSMaxVersion          string   `flag:"tls-max-version" cfg:"tls_max_version"`
+	TLSCurvePreferences    []string `flag:"tls-curve-preference" cfg:"tls_curve_preferences"`
+	TLSALPNProtocols       []string `flag:"tls-alpn-protocol" cfg:"tls_alpn_protocols"`
+	TLSClientAuth          string   `flag:"tls-client-auth" cfg:"tls_client_auth"`
+	TLSSNICertFiles        []string `flag:"tls-sni-cert-file" cfg:"tls_sni_cert_files"`
+	TLSSNIKeyFiles         []string `flag:"tls-sni-key-file" cfg:"tls_sni_key_files"`
+	TLSCertificatesDir     string   `flag:"tls-certificates-dir" cfg:"tls_certificates_dir"`
+	HTTP2                  bool     `flag:"http2" cfg:"http2"`
+	ProxyProtocol          bool     `flag:"proxy-protocol" cfg:"proxy_protocol"`
 }
 
 func legacyServerFlagset() *pflag.FlagSet {
@@ -470,12 +563,32 @@ func legacyServerFlagset() *pflag.FlagSet {
 	flagSet.String("metrics-secure-address", "", "the address /metrics will be served on for HTTPS clients (e.g. \":9100\")")
 	flagSet.String("metrics-tls-cert-file", "", "path to certificate file for secure metrics server")
 	flagSet.String("metrics-tls-key-file", "", "path to private key file for secure metrics server")
+	flagSet.String("metrics-bearer-token-file", "", "path to a file containing the bearer token clients must send to the metrics server")
+	flagSet.String("metrics-client-ca-file", "", "path to the CA certificates of the client certificates clients may authenticate to the secure metrics server with")
+	flagSet.StringSlice("metrics-allowed-network", []string{}, "IPs or CIDR ranges clients of the metrics server must connect from (may be given multiple times)")
+	flagSet.String("admin-address", "", "the address the admin API, which lists and revokes sessions, will be served on (e.g. \":9200\")")
+	flagSet.String("admin-secure-address", "", "the address the admin API will be served on for HTTPS clients (e.g. \":9200\")")
+	flagSet.String("admin-tls-cert-file", "", "path to certificate file for secure admin server")
+	flagSet.String("admin-tls-key-file", "", "path to private key file for secure admin server")
+	flagSet.String("admin-bearer-token-file", "", "path to a file containing the bearer token clients must send to the admin server")
+	flagSet.String("admin-client-ca-file", "", "path to the CA certificates of the client certificates clients may authenticate to the secure admin server with")
+	flagSet.StringSlice("admin-allowed-network", []string{}, "IPs or CIDR ranges clients of the admin server must connect from (may be given multiple times)")
 	flagSet.String("http-address", "127.0.0.1:4180", "[http://]<addr>:<port> or unix://<path> to listen on for HTTP clients")
 	flagSet.String("https-address", ":443", "<addr>:<port> to listen on for HTTPS clients")
 	flagSet.String("tls-cert-file", "", "path to certificate file")
 	flagSet.String("tls-key-file", "", "path to private key file")
 	flagSet.String("tls-min-version", "", "minimal TLS version for HTTPS clients (either \"TLS1.2\" or \"TLS1.3\")")
 	flagSet.StringSlice("tls-cipher-suite", []string{}, "restricts TLS cipher suites to those listed (e.g. TLS_RSA_WITH_RC4_128_SHA) (may be given multiple times)")
+	flagSet.StringSlice("tls-client-ca-file", []string{}, "path to the CA certificates issuing the client certificates HTTPS clients must present (may be given multiple times)")
+	flagSet.String("tls-max-version", "", "maximal TLS version for HTTPS clients (either \"TLS1.2\" or \"TLS1.3\")")
+	flagSet.StringSlice("tls-curve-preference", []string{}, "restricts the elliptic curves of the TLS key exchange to those listed, in order of preference (X25519, P256, P384, P521) (may be given multiple times)")
+	flagSet.StringSlice("tls-alpn-protocol", []string{}, "the application protocols negotiated with HTTPS clients, in order of preference (h2, http/1.1) (may be given multiple times)")
+	flagSet.String("tls-client-auth", "", "how client certificates are requested and verified: none, request, require, verify-if-given or require-and-verify (defaults to require-and-verify with --tls-client-ca-file)")
+	flagSet.StringSlice("tls-sni-cert-file", []string{}, "path to a further certificate file, served to HTTPS clients requesting one of its DNS names (may be given multiple times, with a --tls-sni-key-file each)")
+	flagSet.StringSlice("tls-sni-key-file", []string{}, "path to the private key file of the --tls-sni-cert-file given at the same position (may be given multiple times)")
+	flagSet.String("tls-certificates-dir", "", "directory of further <name>.crt certificate and <name>.key private key files, served to HTTPS clients requesting one of the DNS names of a certificate, picked up while the proxy runs")
+	flagSet.Bool("http2", false, "serve HTTP/2 to HTTPS clients that negotiate it, and HTTP/2 cleartext (h2c) to HTTP clients, such as gRPC clients")
+	flagSet.Bool("proxy-protocol", false, "require the connections of HTTP and HTTPS clients to start with a PROXY protocol header (version 1 or 2) carrying the client IP, as sent by load balancers")
 
 	return flagSet
 }
@@ -484,17 +597,25 @@ type LegacyProvider struct {
 	ClientID         string `flag:"client-id" cfg:"client_id"`
 	ClientSecret     string `flag:"client-secret" cfg:"client_secret"`
 	ClientSecretFile string `flag:"client-secret-file" cfg:"client_secret_file"`
+	ClientSecretRef  string `flag:"client-secret-ref" cfg:"client_secret_ref"`
 
 	KeycloakGroups                         []string `flag:"keycloak-group" cfg:"keycloak_groups"`
 	AzureTenant                            string   `flag:"azure-tenant" cfg:"azure_tenant"`
 	AzureGraphGroupField                   string   `flag:"azure-graph-group-field" cfg:"azure_graph_group_field"`
+	AzureSkipGraphGroups                   bool     `flag:"azure-skip-graph-groups" cfg:"azure_skip_graph_groups"`
+	AzureGraphMaxPages                     int      `flag:"azure-graph-max-pages" cfg:"azure_graph_max_pages"`
+	AzureAllowedTenants                    []string `flag:"azure-allowed-tenant" cfg:"azure_allowed_tenants"`
 	BitbucketTeam                          string   `flag:"bitbucket-team" cfg:"bitbucket_team"`
 	BitbucketRepository                    string   `flag:"bitbucket-repository" cfg:"bitbucket_repository"`
+	DiscordGuilds                          []string `flag:"discord-guild" cfg:"discord_guilds"`
+	DiscordRoles                           []string `flag:"discord-role" cfg:"discord_roles"`
 	GitHubOrg                              string   `flag:"github-org" cfg:"github_org"`
 	GitHubTeam                             string   `flag:"github-team" cfg:"github_team"`
 	GitHubRepo                             string   `flag:"github-repo" cfg:"github_repo"`
 	GitHubToken                            string   `flag:"github-token" cfg:"github_token"`
 	GitHubUsers                            []string `flag:"github-user" cfg:"github_users"`
+	GitHubOrgRole                          string   `flag:"github-org-role" cfg:"github_org_role"`
+	GitHubUseGraphQL                       bool     `flag:"github-use-graphql" cfg:"github_use_graphql"`
 	GitLabGroup                            []string `flag:"gitlab-group" cfg:"gitlab_groups"`
 	GitLabProjects                         []string `flag:"gitlab-project" cfg:"gitlab_projects"`
 	GoogleGroupsLegacy                     []string `flag:"google-group" cfg:"google_group"`
@@ -503,36 +624,55 @@ type LegacyProvider struct {
 	GoogleServiceAccountJSON               string   `flag:"google-service-account-json" cfg:"google_service_account_json"`
 	GoogleUseApplicationDefaultCredentials bool     `flag:"google-use-application-default-credentials" cfg:"google_use_application_default_credentials"`
 	GoogleTargetPrincipal                  string   `flag:"google-target-principal" cfg:"google_target_principal"`
+	GoogleUseCloudIdentity                 bool     `flag:"google-use-cloud-identity" cfg:"google_use_cloud_identity"`
+	SAMLIdPEntityID                        string   `flag:"saml-idp-entity-id" cfg:"saml_idp_entity_id"`
+	SAMLIdPCertificateFiles                []string `flag:"saml-idp-certificate-file" cfg:"saml_idp_certificate_files"`
+	SAMLLogoutURL                          string   `flag:"saml-logout-url" cfg:"saml_logout_url"`
+	SAMLSigningKeyFile                     string   `flag:"saml-signing-key-file" cfg:"saml_signing_key_file"`
+	SAMLNameIDFormat                       string   `flag:"saml-name-id-format" cfg:"saml_name_id_format"`
+	SAMLEmailAttribute                     string   `flag:"saml-email-attribute" cfg:"saml_email_attribute"`
+	SAMLGroupsAttribute                    string   `flag:"saml-groups-attribute" cfg:"saml_groups_attribute"`
+	SlackWorkspaces                        []string `flag:"slack-workspace" cfg:"slack_workspaces"`
 
 	// These options allow for other providers besides Google, with
 	// potential overrides.
-	ProviderType                       string   `flag:"provider" cfg:"provider"`
-	ProviderName                       string   `flag:"provider-display-name" cfg:"provider_display_name"`
-	ProviderCAFiles                    []string `flag:"provider-ca-file" cfg:"provider_ca_files"`
-	UseSystemTrustStore                bool     `flag:"use-system-trust-store" cfg:"use_system_trust_store"`
-	OIDCIssuerURL                      string   `flag:"oidc-issuer-url" cfg:"oidc_issuer_url"`
-	InsecureOIDCAllowUnverifiedEmail   bool     `flag:"insecure-oidc-allow-unverified-email" cfg:"insecure_oidc_allow_unverified_email"`
-	InsecureOIDCSkipIssuerVerification bool     `flag:"insecure-oidc-skip-issuer-verification" cfg:"insecure_oidc_skip_issuer_verification"`
-	InsecureOIDCSkipNonce              bool     `flag:"insecure-oidc-skip-nonce" cfg:"insecure_oidc_skip_nonce"`
-	SkipOIDCDiscovery                  bool     `flag:"skip-oidc-discovery" cfg:"skip_oidc_discovery"`
-	OIDCJwksURL                        string   `flag:"oidc-jwks-url" cfg:"oidc_jwks_url"`
-	OIDCEmailClaim                     string   `flag:"oidc-email-claim" cfg:"oidc_email_claim"`
-	OIDCGroupsClaim                    string   `flag:"oidc-groups-claim" cfg:"oidc_groups_claim"`
-	OIDCAudienceClaims                 []string `flag:"oidc-audience-claim" cfg:"oidc_audience_claims"`
-	OIDCExtraAudiences                 []string `flag:"oidc-extra-audience" cfg:"oidc_extra_audiences"`
-	LoginURL                           string   `flag:"login-url" cfg:"login_url"`
-	RedeemURL                          string   `flag:"redeem-url" cfg:"redeem_url"`
-	ProfileURL                         string   `flag:"profile-url" cfg:"profile_url"`
-	SkipClaimsFromProfileURL           bool     `flag:"skip-claims-from-profile-url" cfg:"skip_claims_from_profile_url"`
-	ProtectedResource                  string   `flag:"resource" cfg:"resource"`
-	ValidateURL                        string   `flag:"validate-url" cfg:"validate_url"`
-	Scope                              string   `flag:"scope" cfg:"scope"`
-	Prompt                             string   `flag:"prompt" cfg:"prompt"`
-	ApprovalPrompt                     string   `flag:"approval-prompt" cfg:"approval_prompt"` // Deprecated by OIDC 1.0
-	UserIDClaim                        string   `flag:"user-id-claim" cfg:"user_id_claim"`
-	AllowedGroups                      []string `flag:"allowed-group" cfg:"allowed_groups"`
-	AllowedRoles                       []string `flag:"allowed-role" cfg:"allowed_roles"`
-	BackendLogoutURL                   string   `flag:"backend-logout-url" cfg:"backend_logout_url"`
+	ProviderType                       string        `flag:"provider" cfg:"provider"`
+	ProviderName                       string        `flag:"provider-display-name" cfg:"provider_display_name"`
+	ProviderCAFiles                    []string      `flag:"provider-ca-file" cfg:"provider_ca_files"`
+	UseSystemTrustStore                bool          `flag:"use-system-trust-store" cfg:"use_system_trust_store"`
+	ProviderTimeout                    time.Duration `flag:"provider-timeout" cfg:"provider_timeout"`
+	ProviderMaxRetries                 int           `flag:"provider-max-retries" cfg:"provider_max_retries"`
+	ProviderRetryBackoff               time.Duration `flag:"provider-retry-backoff" cfg:"provider_retry_backoff"`
+	ProviderRetryMaxBackoff            time.Duration `flag:"provider-retry-max-backoff" cfg:"provider_retry_max_backoff"`
+	ProviderRetryBudget                float64       `flag:"provider-retry-budget" cfg:"provider_retry_budget"`
+	AzureGraphTimeout                  time.Duration `flag:"azure-graph-timeout" cfg:"azure_graph_timeout"`
+	OIDCIssuerURL                      string        `flag:"oidc-issuer-url" cfg:"oidc_issuer_url"`
+	InsecureOIDCAllowUnverifiedEmail   bool          `flag:"insecure-oidc-allow-unverified-email" cfg:"insecure_oidc_allow_unverified_email"`
+	InsecureOIDCSkipIssuerVerification bool          `flag:"insecure-oidc-skip-issuer-verification" cfg:"insecure_oidc_skip_issuer_verification"`
+	InsecureOIDCSkipNonce              bool          `flag:"insecure-oidc-skip-nonce" cfg:"insecure_oidc_skip_nonce"`
+	SkipOIDCDiscovery                  bool          `flag:"skip-oidc-discovery" cfg:"skip_oidc_discovery"`
+	OIDCJwksURL                        string        `flag:"oidc-jwks-url" cfg:"oidc_jwks_url"`
+	OIDCEmailClaim                     string        `flag:"oidc-email-claim" cfg:"oidc_email_claim"`
+	OIDCGroupsClaim                    string        `flag:"oidc-groups-claim" cfg:"oidc_groups_claim"`
+	OIDCGroupsOverageURL               string        `flag:"oidc-groups-overage-url" cfg:"oidc_groups_overage_url"`
+	OIDCDistributedClaims              bool          `flag:"oidc-distributed-claims" cfg:"oidc_distributed_claims"`
+	OIDCAudienceClaims                 []string      `flag:"oidc-audience-claim" cfg:"oidc_audience_claims"`
+	OIDCExtraAudiences                 []string      `flag:"oidc-extra-audience" cfg:"oidc_extra_audiences"`
+	OIDCUserInfoEnrichment             bool          `flag:"oidc-userinfo-enrichment" cfg:"oidc_userinfo_enrichment"`
+	OIDCUserInfoPrecedence             string        `flag:"oidc-userinfo-precedence" cfg:"oidc_userinfo_precedence"`
+	LoginURL                           string        `flag:"login-url" cfg:"login_url"`
+	RedeemURL                          string        `flag:"redeem-url" cfg:"redeem_url"`
+	ProfileURL                         string        `flag:"profile-url" cfg:"profile_url"`
+	SkipClaimsFromProfileURL           bool          `flag:"skip-claims-from-profile-url" cfg:"skip_claims_from_profile_url"`
+	ProtectedResource                  string        `flag:"resource" cfg:"resource"`
+	ValidateURL                        string        `flag:"validate-url" cfg:"validate_url"`
+	Scope                              string        `flag:"scope" cfg:"scope"`
+	Prompt                             string        `flag:"prompt" cfg:"prompt"`
+	ApprovalPrompt                     string        `flag:"approval-prompt" cfg:"approval_prompt"` // Deprecated by OIDC 1.0
+	UserIDClaim                        string        `flag:"user-id-claim" cfg:"user_id_claim"`
+	AllowedGroups                      []string      `flag:"allowed-group" cfg:"allowed_groups"`
+	AllowedRoles                       []string      `flag:"allowed-role" cfg:"allowed_roles"`
+	BackendLogoutURL                   string        `flag:"backend-logout-url" cfg:"backend_logout_url"`
 
 	AcrValues  string `flag:"acr-values" cfg:"acr_values"`
 	JWTKey     string `flag:"jwt-key" cfg:"jwt_key"`
@@ -549,23 +689,44 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 
 	flagSet.StringSlice("keycloak-group", []string{}, "restrict logins to members of these groups (may be given multiple times)")
 	flagSet.String("azure-tenant", "common", "go to a tenant-specific or common (tenant-independent) endpoint.")
-	flagSet.String("azure-graph-group-field", "", "configures the group field to be used when building the groups list(`id` or `displayName`. Default is `id`) from Microsoft Graph(available only for v2.0 oidc url). Based on this value, the `allowed-group` config values should be adjusted accordingly. If using `id` as group field, `allowed-group` should contains groups IDs, if using `displayName` as group field, `allowed-group` should contains groups name")
+	flagSet.String("azure-graph-group-field", "", "configures the group field to be used when building the groups list(`id` or `displayName`. Default is `id`) from Microsoft Graph(available only for v2.0 oidc url). Based on this value, the `allowed-group` config values should be adjusted accordingly. If using `id` as group field, `allowed-group` should contains groups IDs, if using `displayName` as group field, `allowed-group` should contains groups name. Use `id,displayName` to add both")
+	flagSet.Int("azure-graph-max-pages", 0, "maximum number of pages of groups requested from Microsoft Graph for a user (0 requests every page)")
+	flagSet.Duration("azure-graph-timeout", 0, "maximum duration of each request to Microsoft Graph (0 for no limit other than --provider-timeout)")
+	flagSet.StringSlice("azure-allowed-tenant", []string{}, "restrict logins to users of these tenant IDs, `organizations`, `consumers` or `*` for any tenant (may be given multiple times)")
+	flagSet.Bool("azure-skip-graph-groups", false, "use the app roles of the user as their groups, without querying Microsoft Graph for group memberships (available only for v2.0 oidc url)")
 	flagSet.String("bitbucket-team", "", "restrict logins to members of this team")
 	flagSet.String("bitbucket-repository", "", "restrict logins to user with access to this repository")
+	flagSet.StringSlice("discord-guild", []string{}, "restrict logins to members of these Discord guilds, by ID (may be given multiple times)")
+	flagSet.StringSlice("discord-role", []string{}, "restrict logins to members with these roles, given as <guild ID>:<role ID> (may be given multiple times)")
 	flagSet.String("github-org", "", "restrict logins to members of this organisation")
 	flagSet.String("github-team", "", "restrict logins to members of this team")
 	flagSet.String("github-repo", "", "restrict logins to collaborators of this repository")
 	flagSet.String("github-token", "", "the token to use when verifying repository collaborators (must have push access to the repository)")
 	flagSet.StringSlice("github-user", []string{}, "allow users with these usernames to login even if they do not belong to the specified org and team or collaborators (may be given multiple times)")
+	flagSet.String("github-org-role", "", "restrict logins to members of the organisation with this role (admin or member)")
+	flagSet.Bool("github-use-graphql", false, "look up organisations and teams with the GraphQL API, including the parent teams of nested teams")
 	flagSet.StringSlice("gitlab-group", []string{}, "restrict logins to members of this group (may be given multiple times)")
 	flagSet.StringSlice("gitlab-project", []string{}, "restrict logins to members of this project (may be given multiple times) (eg `group/project=accesslevel`). Access level should be a value matching Gitlab access levels (see https://docs.gitlab.com/ee/api/members.html#valid-access-levels), defaulted to 20 if absent")
+	flagSet.String("saml-idp-entity-id", "", "the entity ID of the SAML identity provider, which assertions must be issued by")
+	flagSet.StringSlice("saml-idp-certificate-file", []string{}, "path to a PEM encoded certificate the SAML identity provider signs with (may be given multiple times)")
+	flagSet.String("saml-logout-url", "", "the single logout endpoint of the SAML identity provider")
+	flagSet.String("saml-signing-key-file", "", "path to the PEM encoded RSA private key SAML authentication and logout requests are signed with")
+	flagSet.String("saml-name-id-format", "", "the format of the name ID requested from the SAML identity provider")
+	flagSet.String("saml-email-attribute", "email", "the SAML attribute holding the email address of users")
+	flagSet.String("saml-groups-attribute", "groups", "the SAML attribute holding the groups of users")
 	flagSet.String("client-id", "", "the OAuth Client ID: ie: \"123456.apps.googleusercontent.com\"")
 	flagSet.String("client-secret", "", "the OAuth Client Secret")
 	flagSet.String("client-secret-file", "", "the file with OAuth Client Secret")
+	flagSet.String("client-secret-ref", "", "a reference to the OAuth Client Secret in a secret store, eg. kubernetes://namespace/secret/key or vault://path#field")
 
 	flagSet.String("provider", "google", "OAuth provider")
 	flagSet.String("provider-display-name", "", "Provider display name")
 	flagSet.StringSlice("provider-ca-file", []string{}, "One or more paths to CA certificates that should be used when connecting to the provider.  If not specified, the default Go trust sources are used instead.")
+	flagSet.Duration("provider-timeout", DefaultProviderTimeout, "maximum amount of time to wait for each call to the provider, e.g. redeeming a code or refreshing a session")
+	flagSet.Int("provider-max-retries", 0, "maximum number of times to retry a request to the provider that fails with a transient error, e.g. a 5xx or 429 response")
+	flagSet.Duration("provider-retry-backoff", DefaultProviderRetryBackoff, "delay before the first retry of a request to the provider, doubling with each retry")
+	flagSet.Duration("provider-retry-max-backoff", DefaultProviderRetryMaxBackoff, "maximum delay between retries of a request to the provider")
+	flagSet.Float64("provider-retry-budget", DefaultProviderRetryBudget, "ratio of retries to requests allowed for the provider")
 	flagSet.Bool("use-system-trust-store", false, "Determines if 'provider-ca-file' files and the system trust store are used. If set to true, your custom CA files and the system trust store are used otherwise only your custom CA files.")
 	flagSet.String("oidc-issuer-url", "", "OpenID Connect issuer URL (ie: https://accounts.google.com)")
 	flagSet.Bool("insecure-oidc-allow-unverified-email", false, "Don't fail if an email address in an id_token is not verified")
@@ -573,10 +734,14 @@ func legacyProviderFlagSet() *pflag.FlagSet {
 	flagSet.Bool("insecure-oidc-skip-nonce", true, "skip verifying the OIDC ID Token's nonce claim")
 	flagSet.Bool("skip-oidc-discovery", false, "Skip OIDC discovery and use manually supplied Endpoints")
 	flagSet.String("oidc-jwks-url", "", "OpenID Connect JWKS URL (ie: https://www.googleapis.com/oauth2/v3/certs)")
-	flagSet.String("oidc-groups-claim", OIDCGroupsClaim, "which OIDC claim contains the user groups")
+	flagSet.String("oidc-groups-claim", OIDCGroupsClaim, "which OIDC claim contains the user groups, or a JSONPath-like expression to a nested claim such as realm_access.roles")
+	flagSet.String("oidc-groups-overage-url", "", "URL template to fetch the user's groups from when they are left out of the ID token, as advertised by the _claim_names and _claim_sources claims (ie: {endpoint})")
+	flagSet.Bool("oidc-distributed-claims", false, "resolve claims left out of the ID token from the aggregated claims or endpoints advertised by the _claim_names and _claim_sources claims")
 	flagSet.String("oidc-email-claim", OIDCEmailClaim, "which OIDC claim contains the user's email")
 	flagSet.StringSlice("oidc-audience-claim", OIDCAudienceClaims, "which OIDC claims are used as audience to verify against client id")
 	flagSet.StringSlice("oidc-extra-audience", []string{}, "additional audiences allowed to pass audience verification")
+	flagSet.Bool("oidc-userinfo-enrichment", false, "call the userinfo endpoint each time a session is created and merge its claims into those of the ID token")
+	flagSet.String("oidc-userinfo-precedence", "", "which claims are used when both the ID token and the userinfo endpoint have a claim (idToken or userInfo, default idToken)")
 	flagSet.String("login-url", "", "Authentication endpoint")
 	flagSet.String("redeem-url", "", "Token redemption endpoint")
 	flagSet.String("profile-url", "", "Profile access endpoint")
@@ -610,28 +775,85 @@ func legacyGoogleFlagSet() *pflag.FlagSet {
 	flagSet.String("google-service-account-json", "", "the path to the service account json credentials")
 	flagSet.String("google-use-application-default-credentials", "", "use application default credentials instead of service account json (i.e. GKE Workload Identity)")
 	flagSet.String("google-target-principal", "", "the target principal to impersonate when using ADC")
+	flagSet.Bool("google-use-cloud-identity", false, "check group membership with the Cloud Identity API and application default credentials, without an admin email or domain-wide delegation")
+	flagSet.StringSlice("slack-workspace", []string{}, "restrict logins to members of these Slack workspaces, by team ID (may be given multiple times)")
 
 	return flagSet
 }
 
+// convertACMEServer runs both the HTTP and HTTPS servers when the
+// certificates are obtained with ACME: the HTTPS server serves them and the
+// HTTP server answers the HTTP-01 challenges. The TLS options apply without
+// a certificate and key.
+func (l LegacyServer) convertACMEServer(appServer Server) Server {
+	appServer.BindAddress = l.HTTPAddress
+	appServer.SecureBindAddress = l.HTTPSAddress
+	if appServer.TLS == nil {
+		tls := &TLS{MinVersion: l.TLSMinVersion}
+		l.convertTLSPolicy(tls)
+		if !reflect.DeepEqual(*tls, TLS{}) {
+			appServer.TLS = tls
+		}
+	}
+	return appServer
+}
+
+// convertTLSPolicy sets the cipher suites, curves, application protocols and
+// client authentication of the app server that are given
+func (l LegacyServer) convertTLSPolicy(tls *TLS) {
+	if len(l.TLSCipherSuites) != 0 {
+		tls.CipherSuites = l.TLSCipherSuites
+	}
+	if len(l.TLSClientCAFiles) != 0 {
+		tls.ClientCAFiles = l.TLSClientCAFiles
+	}
+	tls.MaxVersion = l.TLSMaxVersion
+	if len(l.TLSCurvePreferences) != 0 {
+		tls.CurvePreferences = l.TLSCurvePreferences
+	}
+	if len(l.TLSALPNProtocols) != 0 {
+		tls.ALPNProtocols = l.TLSALPNProtocols
+	}
+	tls.ClientAuth = l.TLSClientAuth
+}
+
+// convertTLSCertificates sets the further certificates of the app server,
+// pairing the SNI certificate and key files given at the same position
+func (l LegacyServer) convertTLSCertificates(tls *TLS) {
+	for i := 0; i < len(l.TLSSNICertFiles) || i < len(l.TLSSNIKeyFiles); i++ {
+		certificate := TLSCertificate{}
+		if i < len(l.TLSSNIKeyFiles) {
+			certificate.Key = &SecretSource{FromFile: l.TLSSNIKeyFiles[i]}
+		}
+		if i < len(l.TLSSNICertFiles) {
+			certificate.Cert = &SecretSource{FromFile: l.TLSSNICertFiles[i]}
+		}
+		tls.Certificates = append(tls.Certificates, certificate)
+	}
+	tls.CertificatesDir = l.TLSCertificatesDir
+}
+
 func (l LegacyServer) convert() (Server, Server) {
 	appServer := Server{
 		BindAddress:       l.HTTPAddress,
 		SecureBindAddress: l.HTTPSAddress,
+		HTTP2:             l.HTTP2,
+		ProxyProtocol:     l.ProxyProtocol,
 	}
-	if l.TLSKeyFile != "" || l.TLSCertFile != "" {
+	if l.TLSKeyFile != "" || l.TLSCertFile != "" || len(l.TLSSNICertFiles) != 0 || len(l.TLSSNIKeyFiles) != 0 || l.TLSCertificatesDir != "" {
 		appServer.TLS = &TLS{
-			Key: &SecretSource{
-				FromFile: l.TLSKeyFile,
-			},
-			Cert: &SecretSource{
-				FromFile: l.TLSCertFile,
-			},
 			MinVersion: l.TLSMinVersion,
 		}
-		if len(l.TLSCipherSuites) != 0 {
-			appServer.TLS.CipherSuites = l.TLSCipherSuites
+		if l.TLSKeyFile != "" || l.TLSCertFile != "" {
+			appServer.TLS.Key = &SecretSource{
+				FromFile: l.TLSKeyFile,
+			}
+			appServer.TLS.Cert = &SecretSource{
+				FromFile: l.TLSCertFile,
+			}
 		}
+		l.convertTLSPolicy(appServer.TLS)
+		l.convertTLSCertificates(appServer.TLS)
 		// Preserve backwards compatibility, only run one server
 		appServer.BindAddress = ""
 	} else {
@@ -640,34 +862,61 @@ func (l LegacyServer) convert() (Server, Server) {
 		appServer.SecureBindAddress = ""
 	}
 
-	metricsServer := Server{
-		BindAddress:       l.MetricsAddress,
-		SecureBindAddress: l.MetricsSecureAddress,
+	metricsServer := convertAuthenticatedServer(l.MetricsAddress, l.MetricsSecureAddress, l.MetricsTLSCertFile, l.MetricsTLSKeyFile,
+		l.MetricsBearerTokenFile, l.MetricsClientCAFile, l.MetricsAllowedNetworks)
+
+	return appServer, metricsServer
+}
+
+func (l LegacyServer) convertAdminServer() Server {
+	return convertAuthenticatedServer(l.AdminAddress, l.AdminSecureAddress, l.AdminTLSCertFile, l.AdminTLSKeyFile,
+		l.AdminBearerTokenFile, l.AdminClientCAFile, l.AdminAllowedNetworks)
+}
+
+// convertAuthenticatedServer converts the options of a server that is not
+// meant for users, and which clients may be required to authenticate to
+func convertAuthenticatedServer(address, secureAddress, tlsCertFile, tlsKeyFile, bearerTokenFile, clientCAFile string, allowedNetworks []string) Server {
+	server := Server{
+		BindAddress:       address,
+		SecureBindAddress: secureAddress,
 	}
-	if l.MetricsTLSKeyFile != "" || l.MetricsTLSCertFile != "" {
-		metricsServer.TLS = &TLS{
+	if tlsKeyFile != "" || tlsCertFile != "" {
+		server.TLS = &TLS{
 			Key: &SecretSource{
-				FromFile: l.MetricsTLSKeyFile,
+				FromFile: tlsKeyFile,
 			},
 			Cert: &SecretSource{
-				FromFile: l.MetricsTLSCertFile,
+				FromFile: tlsCertFile,
 			},
 		}
 	}
-
-	return appServer, metricsServer
+	if bearerTokenFile != "" || clientCAFile != "" || len(allowedNetworks) > 0 {
+		server.Auth = &ServerAuth{
+			AllowedNetworks: allowedNetworks,
+		}
+		if bearerTokenFile != "" {
+			server.Auth.BearerToken = &SecretSource{FromFile: bearerTokenFile}
+		}
+		if clientCAFile != "" {
+			server.Auth.ClientCA = &SecretSource{FromFile: clientCAFile}
+		}
+	}
+	return server
 }
 
 func (l *LegacyProvider) convert() (Providers, error) {
 	providers := Providers{}
+	timeout := Duration(l.ProviderTimeout)
 
 	provider := Provider{
 		ClientID:                 l.ClientID,
 		ClientSecret:             l.ClientSecret,
 		ClientSecretFile:         l.ClientSecretFile,
+		ClientSecretRef:          l.ClientSecretRef,
 		Type:                     ProviderType(l.ProviderType),
 		CAFiles:                  l.ProviderCAFiles,
 		UseSystemTrustStore:      l.UseSystemTrustStore,
+		Timeout:                  &timeout,
 		LoginURL:                 l.LoginURL,
 		RedeemURL:                l.RedeemURL,
 		ProfileURL:               l.ProfileURL,
@@ -680,6 +929,15 @@ func (l *LegacyProvider) convert() (Providers, error) {
 		BackendLogoutURL:         l.BackendLogoutURL,
 	}
 
+	if l.ProviderMaxRetries > 0 {
+		provider.Retry = &ProviderRetry{
+			MaxRetries: l.ProviderMaxRetries,
+			Backoff:    Duration(l.ProviderRetryBackoff),
+			MaxBackoff: Duration(l.ProviderRetryMaxBackoff),
+			Budget:     l.ProviderRetryBudget,
+		}
+	}
+
 	// This part is out of the switch section for all providers that support OIDC
 	provider.OIDCConfig = OIDCOptions{
 		IssuerURL:                      l.OIDCIssuerURL,
@@ -691,8 +949,12 @@ func (l *LegacyProvider) convert() (Providers, error) {
 		UserIDClaim:                    l.UserIDClaim,
 		EmailClaim:                     l.OIDCEmailClaim,
 		GroupsClaim:                    l.OIDCGroupsClaim,
+		GroupsOverageURL:               l.OIDCGroupsOverageURL,
+		DistributedClaims:              l.OIDCDistributedClaims,
 		AudienceClaims:                 l.OIDCAudienceClaims,
 		ExtraAudiences:                 l.OIDCExtraAudiences,
+		UserInfoEnrichment:             l.OIDCUserInfoEnrichment,
+		UserInfoPrecedence:             l.OIDCUserInfoPrecedence,
 	}
 
 	// Support for legacy configuration option
@@ -705,16 +967,25 @@ func (l *LegacyProvider) convert() (Providers, error) {
 	provider.AzureConfig = AzureOptions{
 		Tenant:          l.AzureTenant,
 		GraphGroupField: l.AzureGraphGroupField,
+		SkipGraphGroups: l.AzureSkipGraphGroups,
+		GraphMaxPages:   l.AzureGraphMaxPages,
+		AllowedTenants:  l.AzureAllowedTenants,
+	}
+	if l.AzureGraphTimeout > 0 {
+		graphTimeout := Duration(l.AzureGraphTimeout)
+		provider.AzureConfig.GraphTimeout = &graphTimeout
 	}
 
 	switch provider.Type {
 	case "github":
 		provider.GitHubConfig = GitHubOptions{
-			Org:   l.GitHubOrg,
-			Team:  l.GitHubTeam,
-			Repo:  l.GitHubRepo,
-			Token: l.GitHubToken,
-			Users: l.GitHubUsers,
+			Org:        l.GitHubOrg,
+			Team:       l.GitHubTeam,
+			Repo:       l.GitHubRepo,
+			Token:      l.GitHubToken,
+			Users:      l.GitHubUsers,
+			OrgRole:    l.GitHubOrgRole,
+			UseGraphQL: l.GitHubUseGraphQL,
 		}
 	case "keycloak-oidc":
 		provider.KeycloakConfig = KeycloakOptions{
@@ -741,6 +1012,25 @@ func (l *LegacyProvider) convert() (Providers, error) {
 			Team:       l.BitbucketTeam,
 			Repository: l.BitbucketRepository,
 		}
+	case "discord":
+		provider.DiscordConfig = DiscordOptions{
+			Guilds: l.DiscordGuilds,
+			Roles:  l.DiscordRoles,
+		}
+	case "saml":
+		provider.SAMLConfig = SAMLOptions{
+			IdPEntityID:         l.SAMLIdPEntityID,
+			IdPCertificateFiles: l.SAMLIdPCertificateFiles,
+			LogoutURL:           l.SAMLLogoutURL,
+			SigningKeyFile:      l.SAMLSigningKeyFile,
+			NameIDFormat:        l.SAMLNameIDFormat,
+			EmailAttribute:      l.SAMLEmailAttribute,
+			GroupsAttribute:     l.SAMLGroupsAttribute,
+		}
+	case "slack":
+		provider.SlackConfig = SlackOptions{
+			Workspaces: l.SlackWorkspaces,
+		}
 	case "google":
 		if len(l.GoogleGroupsLegacy) != 0 && !reflect.DeepEqual(l.GoogleGroupsLegacy, l.GoogleGroups) {
 			// Log the deprecation notice
@@ -755,6 +1045,7 @@ func (l *LegacyProvider) convert() (Providers, error) {
 			ServiceAccountJSON:               l.GoogleServiceAccountJSON,
 			UseApplicationDefaultCredentials: l.GoogleUseApplicationDefaultCredentials,
 			TargetPrincipal:                  l.GoogleTargetPrincipal,
+			UseCloudIdentity:                 l.GoogleUseCloudIdentity,
 		}
 	}
 
@@ -37,6 +37,7 @@ var _ = Describe("Legacy Options", func() {
 						InsecureSkipTLSVerify: true,
 						PassHostHeader:        &truth,
 						ProxyWebSockets:       &truth,
+						StripProxyCookies:     &truth,
 						Timeout:               &timeout,
 					},
 					{
@@ -47,6 +48,7 @@ var _ = Describe("Legacy Options", func() {
 						InsecureSkipTLSVerify: true,
 						PassHostHeader:        &truth,
 						ProxyWebSockets:       &truth,
+						StripProxyCookies:     &truth,
 						Timeout:               &timeout,
 					},
 					{
@@ -59,6 +61,7 @@ var _ = Describe("Legacy Options", func() {
 						InsecureSkipTLSVerify: false,
 						PassHostHeader:        nil,
 						ProxyWebSockets:       nil,
+						StripProxyCookies:     nil,
 						Timeout:               nil,
 					},
 				},
@@ -122,6 +125,8 @@ var _ = Describe("Legacy Options", func() {
 			opts.Providers[0].OIDCConfig.InsecureSkipNonce = true
 			opts.Providers[0].OIDCConfig.AudienceClaims = []string{"aud"}
 			opts.Providers[0].OIDCConfig.ExtraAudiences = []string{}
+			providerTimeout := Duration(DefaultProviderTimeout)
+			opts.Providers[0].Timeout = &providerTimeout
 			opts.Providers[0].LoginURLParameters = []LoginURLParameter{
 				{Name: "approval_prompt", Default: []string{"force"}},
 			}
@@ -143,6 +148,7 @@ var _ = Describe("Legacy Options", func() {
 		skipVerify := true
 		passHostHeader := false
 		proxyWebSockets := true
+		stripProxyCookies := true
 		flushInterval := Duration(5 * time.Second)
 		timeout := Duration(5 * time.Second)
 
@@ -155,6 +161,7 @@ var _ = Describe("Legacy Options", func() {
 			InsecureSkipTLSVerify: skipVerify,
 			PassHostHeader:        &passHostHeader,
 			ProxyWebSockets:       &proxyWebSockets,
+			StripProxyCookies:     &stripProxyCookies,
 			FlushInterval:         &flushInterval,
 			Timeout:               &timeout,
 		}
@@ -168,6 +175,7 @@ var _ = Describe("Legacy Options", func() {
 			InsecureSkipTLSVerify: skipVerify,
 			PassHostHeader:        &passHostHeader,
 			ProxyWebSockets:       &proxyWebSockets,
+			StripProxyCookies:     &stripProxyCookies,
 			FlushInterval:         &flushInterval,
 			Timeout:               &timeout,
 		}
@@ -180,6 +188,7 @@ var _ = Describe("Legacy Options", func() {
 			InsecureSkipTLSVerify: skipVerify,
 			PassHostHeader:        &passHostHeader,
 			ProxyWebSockets:       &proxyWebSockets,
+			StripProxyCookies:     &stripProxyCookies,
 			FlushInterval:         &flushInterval,
 			Timeout:               &timeout,
 		}
@@ -195,6 +204,7 @@ var _ = Describe("Legacy Options", func() {
 			InsecureSkipTLSVerify: false,
 			PassHostHeader:        nil,
 			ProxyWebSockets:       nil,
+			StripProxyCookies:     nil,
 			FlushInterval:         nil,
 			Timeout:               nil,
 		}
@@ -210,6 +220,7 @@ var _ = Describe("Legacy Options", func() {
 			InsecureSkipTLSVerify: false,
 			PassHostHeader:        nil,
 			ProxyWebSockets:       nil,
+			StripProxyCookies:     nil,
 			FlushInterval:         nil,
 			Timeout:               nil,
 		}
@@ -224,6 +235,7 @@ var _ = Describe("Legacy Options", func() {
 					SSLUpstreamInsecureSkipVerify: skipVerify,
 					PassHostHeader:                passHostHeader,
 					ProxyWebSockets:               proxyWebSockets,
+					StripProxyCookies:             stripProxyCookies,
 					FlushInterval:                 time.Duration(flushInterval),
 					Timeout:                       time.Duration(timeout),
 				}
@@ -285,6 +297,58 @@ var _ = Describe("Legacy Options", func() {
 				errMsg:            "",
 			}),
 		)
+
+		It("sets a circuit breaker on proxied upstreams", func() {
+			legacyUpstreams := LegacyUpstreams{
+				Upstreams:               []string{validHTTP, validFileWithFragment, validStatic},
+				CircuitBreakerThreshold: 5,
+				CircuitBreakerCooldown:  time.Minute,
+			}
+
+			upstreams, err := legacyUpstreams.convert()
+			Expect(err).ToNot(HaveOccurred())
+
+			cooldown := Duration(time.Minute)
+			Expect(upstreams.Upstreams).To(HaveLen(3))
+			Expect(upstreams.Upstreams[0].CircuitBreaker).To(Equal(&UpstreamCircuitBreaker{
+				FailureThreshold: 5,
+				Cooldown:         &cooldown,
+			}))
+			Expect(upstreams.Upstreams[1].CircuitBreaker).To(BeNil())
+			Expect(upstreams.Upstreams[2].CircuitBreaker).To(BeNil())
+		})
+
+		It("sets the timeout budget when a header is given", func() {
+			legacyUpstreams := LegacyUpstreams{
+				Upstreams:                    []string{validHTTP},
+				TimeoutBudgetHeader:          "X-Request-Timeout-Ms",
+				TimeoutBudgetTrustedNetworks: []string{"10.0.0.0/8"},
+			}
+
+			upstreams, err := legacyUpstreams.convert()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upstreams.TimeoutBudget).To(Equal(&UpstreamTimeoutBudget{
+				Header:          "X-Request-Timeout-Ms",
+				TrustedNetworks: []string{"10.0.0.0/8"},
+			}))
+		})
+
+		It("filters the response headers of proxied upstreams", func() {
+			legacyUpstreams := LegacyUpstreams{
+				Upstreams:              []string{validHTTP, validFileWithFragment, validStatic},
+				AllowedResponseHeaders: []string{"Cache-Control"},
+				DeniedResponseHeaders:  []string{"Server"},
+			}
+
+			upstreams, err := legacyUpstreams.convert()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(upstreams.Upstreams).To(HaveLen(3))
+			Expect(upstreams.Upstreams[0].AllowedResponseHeaders).To(Equal([]string{"Cache-Control"}))
+			Expect(upstreams.Upstreams[0].DeniedResponseHeaders).To(Equal([]string{"Server"}))
+			Expect(upstreams.Upstreams[1].DeniedResponseHeaders).To(BeNil())
+			Expect(upstreams.Upstreams[2].DeniedResponseHeaders).To(BeNil())
+		})
 	})
 
 	Context("Legacy Headers", func() {
@@ -882,6 +946,47 @@ var _ = Describe("Legacy Options", func() {
 					TLS:               tlsConfigCipherSuites,
 				},
 			}),
+			Entry("with TLS options specified with client CA files", legacyServersTableInput{
+				legacyServer: LegacyServer{
+					HTTPAddress:      insecureAddr,
+					HTTPSAddress:     secureAddr,
+					TLSKeyFile:       keyPath,
+					TLSCertFile:      crtPath,
+					TLSClientCAFiles: []string{"/etc/oauth2-proxy/client-ca.pem"},
+				},
+				expectedAppServer: Server{
+					SecureBindAddress: secureAddr,
+					TLS: &TLS{
+						Key:           tlsConfig.Key,
+						Cert:          tlsConfig.Cert,
+						ClientCAFiles: []string{"/etc/oauth2-proxy/client-ca.pem"},
+					},
+				},
+			}),
+			Entry("with SNI certificates only starts app HTTPS server", legacyServersTableInput{
+				legacyServer: LegacyServer{
+					HTTPAddress:        insecureAddr,
+					HTTPSAddress:       secureAddr,
+					TLSSNICertFiles:    []string{"example.com.crt", "example.org.crt"},
+					TLSSNIKeyFiles:     []string{"example.com.key"},
+					TLSCertificatesDir: "/etc/oauth2-proxy/certificates",
+				},
+				expectedAppServer: Server{
+					SecureBindAddress: secureAddr,
+					TLS: &TLS{
+						Certificates: []TLSCertificate{
+							{
+								Key:  &SecretSource{FromFile: "example.com.key"},
+								Cert: &SecretSource{FromFile: "example.com.crt"},
+							},
+							{
+								Cert: &SecretSource{FromFile: "example.org.crt"},
+							},
+						},
+						CertificatesDir: "/etc/oauth2-proxy/certificates",
+					},
+				},
+			}),
 			Entry("with metrics HTTP and HTTPS addresses", legacyServersTableInput{
 				legacyServer: LegacyServer{
 					HTTPAddress:          insecureAddr,
@@ -915,7 +1020,71 @@ var _ = Describe("Legacy Options", func() {
 					TLS:               tlsConfig,
 				},
 			}),
+			Entry("with metrics auth", legacyServersTableInput{
+				legacyServer: LegacyServer{
+					HTTPAddress:            insecureAddr,
+					HTTPSAddress:           secureAddr,
+					MetricsAddress:         insecureMetricsAddr,
+					MetricsBearerTokenFile: "/etc/oauth2-proxy/metrics-token",
+					MetricsAllowedNetworks: []string{"10.0.0.0/8"},
+				},
+				expectedAppServer: Server{
+					BindAddress: insecureAddr,
+				},
+				expectedMetricsServer: Server{
+					BindAddress: insecureMetricsAddr,
+					Auth: &ServerAuth{
+						BearerToken:     &SecretSource{FromFile: "/etc/oauth2-proxy/metrics-token"},
+						AllowedNetworks: []string{"10.0.0.0/8"},
+					},
+				},
+			}),
+		)
+
+		DescribeTable("should run both app servers with ACME",
+			func(legacyServer LegacyServer, expectedAppServer Server) {
+				appServer, _ := legacyServer.convert()
+				Expect(legacyServer.convertACMEServer(appServer)).To(Equal(expectedAppServer))
+			},
+			Entry("with default options", LegacyServer{
+				HTTPAddress:  insecureAddr,
+				HTTPSAddress: secureAddr,
+			}, Server{
+				BindAddress:       insecureAddr,
+				SecureBindAddress: secureAddr,
+			}),
+			Entry("with TLS options", LegacyServer{
+				HTTPAddress:     insecureAddr,
+				HTTPSAddress:    secureAddr,
+				TLSMinVersion:   minVersion,
+				TLSCipherSuites: cipherSuites,
+			}, Server{
+				BindAddress:       insecureAddr,
+				SecureBindAddress: secureAddr,
+				TLS: &TLS{
+					MinVersion:   minVersion,
+					CipherSuites: cipherSuites,
+				},
+			}),
 		)
+
+		It("should convert to the admin server", func() {
+			adminServer := LegacyServer{
+				AdminSecureAddress:   ":9200",
+				AdminTLSCertFile:     crtPath,
+				AdminTLSKeyFile:      keyPath,
+				AdminClientCAFile:    "/etc/oauth2-proxy/admin-ca.pem",
+				AdminAllowedNetworks: []string{"10.0.0.0/8"},
+			}.convertAdminServer()
+			Expect(adminServer).To(Equal(Server{
+				SecureBindAddress: ":9200",
+				TLS:               tlsConfig,
+				Auth: &ServerAuth{
+					ClientCA:        &SecretSource{FromFile: "/etc/oauth2-proxy/admin-ca.pem"},
+					AllowedNetworks: []string{"10.0.0.0/8"},
+				},
+			}))
+		})
 	})
 
 	Context("Legacy Providers", func() {
@@ -932,29 +1101,35 @@ var _ = Describe("Legacy Options", func() {
 			{Name: "approval_prompt", Default: []string{"force"}},
 		}
 
+		providerTimeout := Duration(DefaultProviderTimeout)
+
 		defaultProvider := Provider{
 			ID:                 "google=" + clientID,
 			ClientID:           clientID,
 			Type:               "google",
+			Timeout:            &providerTimeout,
 			LoginURLParameters: defaultURLParams,
 		}
 		defaultLegacyProvider := LegacyProvider{
-			ClientID:     clientID,
-			ProviderType: "google",
+			ClientID:        clientID,
+			ProviderType:    "google",
+			ProviderTimeout: DefaultProviderTimeout,
 		}
 
 		defaultProviderWithPrompt := Provider{
 			ID:       "google=" + clientID,
 			ClientID: clientID,
 			Type:     "google",
+			Timeout:  &providerTimeout,
 			LoginURLParameters: []LoginURLParameter{
 				{Name: "prompt", Default: []string{"switch_user"}},
 			},
 		}
 		defaultLegacyProviderWithPrompt := LegacyProvider{
-			ClientID:     clientID,
-			ProviderType: "google",
-			Prompt:       "switch_user",
+			ClientID:        clientID,
+			ProviderType:    "google",
+			ProviderTimeout: DefaultProviderTimeout,
+			Prompt:          "switch_user",
 		}
 
 		displayNameProvider := Provider{
@@ -962,19 +1137,22 @@ var _ = Describe("Legacy Options", func() {
 			Name:               "displayName",
 			ClientID:           clientID,
 			Type:               "google",
+			Timeout:            &providerTimeout,
 			LoginURLParameters: defaultURLParams,
 		}
 
 		displayNameLegacyProvider := LegacyProvider{
-			ClientID:     clientID,
-			ProviderName: "displayName",
-			ProviderType: "google",
+			ClientID:        clientID,
+			ProviderName:    "displayName",
+			ProviderType:    "google",
+			ProviderTimeout: DefaultProviderTimeout,
 		}
 
 		internalConfigProvider := Provider{
 			ID:       "google=" + clientID,
 			ClientID: clientID,
 			Type:     "google",
+			Timeout:  &providerTimeout,
 			GoogleConfig: GoogleOptions{
 				AdminEmail:         "email@email.com",
 				ServiceAccountJSON: "test.json",
@@ -986,6 +1164,7 @@ var _ = Describe("Legacy Options", func() {
 		internalConfigLegacyProvider := LegacyProvider{
 			ClientID:                 clientID,
 			ProviderType:             "google",
+			ProviderTimeout:          DefaultProviderTimeout,
 			GoogleAdminEmail:         "email@email.com",
 			GoogleServiceAccountJSON: "test.json",
 			GoogleGroups:             []string{"1", "2"},
@@ -994,10 +1173,36 @@ var _ = Describe("Legacy Options", func() {
 		legacyConfigLegacyProvider := LegacyProvider{
 			ClientID:                 clientID,
 			ProviderType:             "google",
+			ProviderTimeout:          DefaultProviderTimeout,
 			GoogleAdminEmail:         "email@email.com",
 			GoogleServiceAccountJSON: "test.json",
 			GoogleGroupsLegacy:       []string{"1", "2"},
 		}
+
+		retryProvider := Provider{
+			ID:       "google=" + clientID,
+			ClientID: clientID,
+			Type:     "google",
+			Timeout:  &providerTimeout,
+			Retry: &ProviderRetry{
+				MaxRetries: 3,
+				Backoff:    Duration(DefaultProviderRetryBackoff),
+				MaxBackoff: Duration(DefaultProviderRetryMaxBackoff),
+				Budget:     DefaultProviderRetryBudget,
+			},
+			LoginURLParameters: defaultURLParams,
+		}
+
+		retryLegacyProvider := LegacyProvider{
+			ClientID:                clientID,
+			ProviderType:            "google",
+			ProviderTimeout:         DefaultProviderTimeout,
+			ProviderMaxRetries:      3,
+			ProviderRetryBackoff:    DefaultProviderRetryBackoff,
+			ProviderRetryMaxBackoff: DefaultProviderRetryMaxBackoff,
+			ProviderRetryBudget:     DefaultProviderRetryBudget,
+		}
+
 		DescribeTable("convertLegacyProviders",
 			func(in *convertProvidersTableInput) {
 				providers, err := in.legacyProvider.convert()
@@ -1036,6 +1241,11 @@ var _ = Describe("Legacy Options", func() {
 				expectedProviders: Providers{internalConfigProvider},
 				errMsg:            "",
 			}),
+			Entry("with provider retries", &convertProvidersTableInput{
+				legacyProvider:    retryLegacyProvider,
+				expectedProviders: Providers{retryProvider},
+				errMsg:            "",
+			}),
 		)
 	})
 })
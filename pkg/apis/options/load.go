@@ -23,35 +23,66 @@ import (
 //
 // Can be set in the config file as `foo_bar="baz"`, in the environment as `OAUTH2_PROXY_FOO_BAR=baz`,
 // or via the command line flag `--foo-bar=baz`.
+// The config file is in TOML format, or in YAML or JSON format when its extension is
+// `.yaml`, `.yml` or `.json`. It may group options in sections, include other config files
+// and reference environment variables, as readConfigFile describes.
 func Load(configFileName string, flagSet *pflag.FlagSet, into interface{}) error {
+	_, err := load(configFileName, flagSet, into)
+	return err
+}
+
+// ConvertConfig loads the configuration as Load does, then renders the options set
+// in the config file, the environment or the flags as a config file in the format
+// given, yaml or toml, with the options grouped in sections.
+// This converts configuration given as flags or in the legacy flat format to
+// the structured format.
+func ConvertConfig(configFileName string, flagSet *pflag.FlagSet, into interface{}, format string) ([]byte, error) {
+	v, err := load(configFileName, flagSet, into)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := configSchema(into)
+	settings := map[string]interface{}{}
+	for key, field := range schema {
+		if v.IsSet(key) {
+			settings[key] = configValue(field)
+		}
+	}
+
+	return marshalConfig(nestConfig(settings, schema), format)
+}
+
+func load(configFileName string, flagSet *pflag.FlagSet, into interface{}) (*viper.Viper, error) {
 	v := viper.New()
-	v.SetConfigFile(configFileName)
-	v.SetConfigType("toml") // Config is in toml format
 	v.SetEnvPrefix("OAUTH2_PROXY")
 	v.AutomaticEnv()
 	v.SetTypeByDefaultValue(true)
 
 	if configFileName != "" {
-		err := v.ReadInConfig()
+		settings, err := readConfigFile(configFileName, configSchema(into))
 		if err != nil {
-			return fmt.Errorf("unable to load config file: %w", err)
+			return nil, fmt.Errorf("unable to load config file: %w", err)
+		}
+		if err := v.MergeConfigMap(settings); err != nil {
+			return nil, fmt.Errorf("unable to load config file: %w", err)
 		}
 	}
 
 	err := registerFlags(v, "", flagSet, into)
 	if err != nil {
 		// This should only happen if there is a programming error
-		return fmt.Errorf("unable to register flags: %w", err)
+		return nil, fmt.Errorf("unable to register flags: %w", err)
 	}
 
 	// UnmarshalExact will return an error if the config includes options that are
 	// not mapped to fields of the into struct
 	err = v.UnmarshalExact(into, decodeFromCfgTag)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling config: %w", err)
+		return nil, fmt.Errorf("error unmarshalling config: %w", err)
 	}
 
-	return nil
+	return v, nil
 }
 
 // registerFlags uses `cfg` and `flag` tags to associate flags in the flagSet
@@ -140,12 +171,21 @@ func isUnexported(name string) bool {
 }
 
 // LoadYAML will load a YAML based configuration file into the options interface provided.
+// Unknown fields are rejected, naming their path and the field that was likely meant.
 func LoadYAML(configFileName string, into interface{}) error {
 	buffer, err := loadAndParseYaml(configFileName)
 	if err != nil {
 		return err
 	}
 
+	// Values that do not parse are reported by UnmarshalStrict below
+	var raw interface{}
+	if yaml.Unmarshal(buffer, &raw) == nil {
+		if unknown := unknownFields("", raw, reflect.TypeOf(into)); len(unknown) > 0 {
+			return fmt.Errorf("error unmarshalling config: unknown field(s):\n  %s", strings.Join(unknown, "\n  "))
+		}
+	}
+
 	// UnmarshalStrict will return an error if the config includes options that are
 	// not mapped to fields of the into struct
 	if err := yaml.UnmarshalStrict(buffer, into, yaml.DisallowUnknownFields); err != nil {
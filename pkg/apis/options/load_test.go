@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	. "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/testutil"
@@ -18,10 +19,12 @@ var _ = Describe("Load", func() {
 
 	legacyOptionsWithNilProvider := &LegacyOptions{
 		LegacyUpstreams: LegacyUpstreams{
-			PassHostHeader:  true,
-			ProxyWebSockets: true,
-			FlushInterval:   DefaultUpstreamFlushInterval,
-			Timeout:         DefaultUpstreamTimeout,
+			PassHostHeader:         true,
+			ProxyWebSockets:        true,
+			StripProxyCookies:      true,
+			FlushInterval:          DefaultUpstreamFlushInterval,
+			Timeout:                DefaultUpstreamTimeout,
+			CircuitBreakerCooldown: DefaultUpstreamCircuitBreakerCooldown,
 		},
 
 		LegacyHeaders: LegacyHeaders{
@@ -36,14 +39,20 @@ var _ = Describe("Load", func() {
 		},
 
 		LegacyProvider: LegacyProvider{
-			ProviderType:          "google",
-			AzureTenant:           "common",
-			ApprovalPrompt:        "force",
-			UserIDClaim:           "email",
-			OIDCEmailClaim:        "email",
-			OIDCGroupsClaim:       "groups",
-			OIDCAudienceClaims:    []string{"aud"},
-			InsecureOIDCSkipNonce: true,
+			ProviderType:            "google",
+			AzureTenant:             "common",
+			ApprovalPrompt:          "force",
+			UserIDClaim:             "email",
+			OIDCEmailClaim:          "email",
+			OIDCGroupsClaim:         "groups",
+			OIDCAudienceClaims:      []string{"aud"},
+			InsecureOIDCSkipNonce:   true,
+			SAMLEmailAttribute:      "email",
+			SAMLGroupsAttribute:     "groups",
+			ProviderTimeout:         DefaultProviderTimeout,
+			ProviderRetryBackoff:    DefaultProviderRetryBackoff,
+			ProviderRetryMaxBackoff: DefaultProviderRetryMaxBackoff,
+			ProviderRetryBudget:     DefaultProviderRetryBudget,
 		},
 
 		Options: Options{
@@ -55,8 +64,17 @@ var _ = Describe("Load", func() {
 			Cookie:             cookieDefaults(),
 			Session:            sessionOptionsDefaults(),
 			Templates:          templatesDefaults(),
+			Handoff:            handoffDefaults(),
+			OIDCIssuer:         oidcIssuerDefaults(),
+			RateLimit:          rateLimitDefaults(),
+			HtpasswdLockout:    htpasswdLockoutDefaults(),
+			LDAP:               ldapDefaults(),
 			SkipAuthPreflight:  false,
 			Logging:            loggingDefaults(),
+
+			AuthenticatedEmails: authenticatedEmailsDefaults(),
+			JSONErrors:          jsonErrorsDefaults(),
+			ACME:                acmeDefaults(),
 		},
 	}
 
@@ -97,13 +115,17 @@ var _ = Describe("Load", func() {
 		var testOptionsFlagSet *pflag.FlagSet
 
 		type testOptionsTableInput struct {
-			env            map[string]string
-			args           []string
-			configFile     []byte
-			flagSet        func() *pflag.FlagSet
-			expectedErr    error
-			input          interface{}
-			expectedOutput interface{}
+			env        map[string]string
+			args       []string
+			configFile []byte
+			// configFileExtension is the extension of the config file, which sets its format
+			configFileExtension string
+			flagSet             func() *pflag.FlagSet
+			expectedErr         error
+			// expectedConfigFileErr is the format of the expected error, given the config file name
+			expectedConfigFileErr string
+			input                 interface{}
+			expectedOutput        interface{}
 		}
 
 		BeforeEach(func() {
@@ -118,7 +140,7 @@ var _ = Describe("Load", func() {
 
 				if o.configFile != nil {
 					By("Creating a config file")
-					configFile, err := os.CreateTemp("", "oauth2-proxy-test-legacy-config-file")
+					configFile, err := os.CreateTemp("", "oauth2-proxy-test-legacy-config-file*"+o.configFileExtension)
 					Expect(err).ToNot(HaveOccurred())
 					defer configFile.Close()
 
@@ -153,7 +175,9 @@ var _ = Describe("Load", func() {
 					input = &TestOptions{}
 				}
 				err := Load(configFileName, flagSet, input)
-				if o.expectedErr != nil {
+				if o.expectedConfigFileErr != "" {
+					Expect(err).To(MatchError(fmt.Sprintf(o.expectedConfigFileErr, configFileName)))
+				} else if o.expectedErr != nil {
 					Expect(err).To(MatchError(o.expectedErr.Error()))
 				} else {
 					Expect(err).ToNot(HaveOccurred())
@@ -326,14 +350,47 @@ var _ = Describe("Load", func() {
 				},
 			}),
 			Entry("with an unknown option in the config file", &testOptionsTableInput{
-				configFile:  []byte(`unknown_option="foo"`),
-				flagSet:     func() *pflag.FlagSet { return testOptionsFlagSet },
-				expectedErr: fmt.Errorf("error unmarshalling config: 1 error(s) decoding:\n\n* '' has invalid keys: unknown_option"),
-				// Viper will unmarshal before returning the error, so this is the default output
+				configFile:            []byte(`unknown_option="foo"`),
+				flagSet:               func() *pflag.FlagSet { return testOptionsFlagSet },
+				expectedConfigFileErr: "unable to load config file: unknown option(s) in %s: unknown_option",
+				expectedOutput:        &TestOptions{},
+			}),
+			Entry("with an unknown option in a section of the config file", &testOptionsTableInput{
+				configFile:            []byte("[string]\noption = \"foo\"\nunknown = \"bar\"\n"),
+				flagSet:               func() *pflag.FlagSet { return testOptionsFlagSet },
+				expectedConfigFileErr: "unable to load config file: unknown option(s) in %s: string_unknown",
+				expectedOutput:        &TestOptions{},
+			}),
+			Entry("with options in sections of the config file", &testOptionsTableInput{
+				configFile: []byte("[string]\noption = \"foo\"\nslice_option = [\"c\", \"d\"]\n"),
+				flagSet:    func() *pflag.FlagSet { return testOptionsFlagSet },
 				expectedOutput: &TestOptions{
-					StringOption: "default",
+					StringOption: "foo",
 					Sub: TestOptionSubStruct{
-						StringSliceOption: []string{"a", "b"},
+						StringSliceOption: []string{"c", "d"},
+					},
+				},
+			}),
+			Entry("with a YAML config file", &testOptionsTableInput{
+				configFile:          []byte("string:\n  option: foo\n  slice_option:\n  - c\n  - d\n"),
+				configFileExtension: ".yaml",
+				flagSet:             func() *pflag.FlagSet { return testOptionsFlagSet },
+				expectedOutput: &TestOptions{
+					StringOption: "foo",
+					Sub: TestOptionSubStruct{
+						StringSliceOption: []string{"c", "d"},
+					},
+				},
+			}),
+			Entry("with environment variable references in the config file", &testOptionsTableInput{
+				configFile: []byte(`string_option = "${TEST_STRING_OPTION}-$${LITERAL}-$notareference"` + "\n" +
+					`string_slice_option = ["${TEST_UNSET_OPTION:-fallback}"]`),
+				env:     map[string]string{"TEST_STRING_OPTION": "foo"},
+				flagSet: func() *pflag.FlagSet { return testOptionsFlagSet },
+				expectedOutput: &TestOptions{
+					StringOption: "foo-${LITERAL}-$notareference",
+					Sub: TestOptionSubStruct{
+						StringSliceOption: []string{"fallback"},
 					},
 				},
 			}),
@@ -348,6 +405,67 @@ var _ = Describe("Load", func() {
 				expectedOutput: legacyOptionsWithNilProvider,
 			}),
 		)
+
+		Context("with config files including others", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = os.MkdirTemp("", "oauth2-proxy-test-include")
+				Expect(err).ToNot(HaveOccurred())
+				DeferCleanup(os.RemoveAll, dir)
+			})
+
+			writeConfigFile := func(name, content string) string {
+				path := filepath.Join(dir, name)
+				Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+				return path
+			}
+
+			It("loads the included files first", func() {
+				writeConfigFile("base.yaml", "string_option: base\nstring_slice_option: [c, d]\n")
+				configFileName := writeConfigFile("main.cfg", "include = [\"base.yaml\"]\nstring_option = \"main\"\n")
+
+				input := &TestOptions{}
+				Expect(Load(configFileName, testOptionsFlagSet, input)).To(Succeed())
+				Expect(input).To(EqualOpts(&TestOptions{
+					StringOption: "main",
+					Sub: TestOptionSubStruct{
+						StringSliceOption: []string{"c", "d"},
+					},
+				}))
+			})
+
+			It("rejects config files including themselves", func() {
+				writeConfigFile("base.cfg", "include = \"main.cfg\"\n")
+				configFileName := writeConfigFile("main.cfg", "include = \"base.cfg\"\n")
+
+				Expect(Load(configFileName, testOptionsFlagSet, &TestOptions{})).To(MatchError(
+					fmt.Sprintf("unable to load config file: config file %s includes itself", filepath.Join(dir, "main.cfg"))))
+			})
+		})
+
+		Context("ConvertConfig", func() {
+			It("renders the options that are set in sections", func() {
+				os.Setenv("OAUTH2_PROXY_STRING_OPTION", "foo")
+				defer os.Unsetenv("OAUTH2_PROXY_STRING_OPTION")
+				Expect(testOptionsFlagSet.Parse([]string{"--string-slice-option=c"})).To(Succeed())
+
+				converted, err := ConvertConfig("", testOptionsFlagSet, &TestOptions{}, "yaml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(converted)).To(Equal("string:\n  option: foo\n  slice_option:\n  - c\n"))
+
+				converted, err = ConvertConfig("", testOptionsFlagSet, &TestOptions{}, "toml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(converted)).To(Equal("[string]\noption = 'foo'\nslice_option = ['c']\n"))
+			})
+
+			It("leaves out the options that are not set", func() {
+				converted, err := ConvertConfig("", testOptionsFlagSet, &TestOptions{}, "yaml")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(converted)).To(Equal("{}\n"))
+			})
+		})
 	})
 })
 
@@ -447,18 +565,25 @@ sub:
 				expectedErr:    errors.New("error unmarshalling config: error converting YAML to JSON: yaml: found character that cannot start any token"),
 			}),
 			Entry("with extra fields in the YAML", loadYAMLTableInput{
-				configFile: append(testOptionsConfigBytesFull, []byte("foo: bar\n")...),
+				configFile:     append(testOptionsConfigBytesFull, []byte("foo: bar\n")...),
+				input:          &TestOptions{},
+				expectedOutput: &TestOptions{},
+				expectedErr:    errors.New("error unmarshalling config: unknown field(s):\n  foo: unknown field"),
+			}),
+			Entry("with misspelled fields in the YAML", loadYAMLTableInput{
+				configFile:     []byte("stringOptoin: foo\nsub:\n  string_slice_option:\n  - a\n"),
+				input:          &TestOptions{},
+				expectedOutput: &TestOptions{},
+				expectedErr: errors.New("error unmarshalling config: unknown field(s):\n" +
+					"  stringOptoin: unknown field, did you mean \"StringOption\"?\n" +
+					"  sub.string_slice_option: unknown field, did you mean \"StringSliceOption\"?"),
+			}),
+			Entry("with fields differing in case in the YAML", loadYAMLTableInput{
+				configFile: []byte("StringOption: foo\n"),
 				input:      &TestOptions{},
 				expectedOutput: &TestOptions{
 					StringOption: "foo",
-					Sub: TestOptionSubStruct{
-						StringSliceOption: []string{"d", "e"},
-					},
-					TestOptionSubStruct: TestOptionSubStruct{
-						StringSliceOption: []string{"a", "b", "c"},
-					},
 				},
-				expectedErr: errors.New("error unmarshalling config: error unmarshaling JSON: while decoding JSON: json: unknown field \"foo\""),
 			}),
 			Entry("with an incorrect type for a string field", loadYAMLTableInput{
 				configFile:     []byte(`stringOption: ["a", "b"]`),
@@ -561,4 +686,88 @@ injectResponseHeaders:
 			},
 		}))
 	})
+
+	It("should suggest fixes for unknown AlphaOptions fields", func() {
+		config := []byte(`
+cookie_secret: secret
+upstreams:
+- http://httpbin
+upstreamConfig:
+  upstreams:
+  - id: httpbin
+    path: /
+    uri: http://httpbin
+    pass_host_header: false
+`)
+
+		By("Creating a config file")
+		configFile, err := os.CreateTemp("", "oauth2-proxy-test-alpha-config-file")
+		Expect(err).ToNot(HaveOccurred())
+		defer configFile.Close()
+
+		_, err = configFile.Write(config)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(configFile.Name())
+
+		By("Loading the config")
+		Expect(LoadYAML(configFile.Name(), &AlphaOptions{})).To(MatchError("error unmarshalling config: unknown field(s):\n" +
+			"  cookie_secret: cookie_secret is not an alpha option, set it with --cookie-secret or in the --config file\n" +
+			"  upstreamConfig.upstreams[0].pass_host_header: unknown field, did you mean \"passHostHeader\"?\n" +
+			"  upstreams: --upstream is a legacy option replaced by the alpha configuration, use --convert-config-to-alpha to convert it"))
+	})
+})
+
+var _ = Describe("GenerateJSONSchema", func() {
+	type Nested struct {
+		Values   []string          `json:"values,omitempty"`
+		Secret   []byte            `json:"secret,omitempty"`
+		Children []Nested          `json:"children,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+	}
+
+	type Root struct {
+		Name    string    `json:"name"`
+		Enabled *bool     `json:"enabled,omitempty"`
+		Timeout *Duration `json:"timeout,omitempty"`
+		Nested  Nested    `json:"nested,omitempty"`
+		Ignored string    `json:"-"`
+	}
+
+	It("generates the schema of the options", func() {
+		schema, err := GenerateJSONSchema(&Root{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(schema).To(MatchJSON(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$ref": "#/$defs/Root",
+			"$defs": {
+				"Root": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {
+						"name": {"type": "string"},
+						"enabled": {"type": "boolean"},
+						"timeout": {"type": "string", "format": "duration"},
+						"nested": {"$ref": "#/$defs/Nested"}
+					}
+				},
+				"Nested": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {
+						"values": {"type": "array", "items": {"type": "string"}},
+						"secret": {"type": "string", "contentEncoding": "base64"},
+						"children": {"type": "array", "items": {"$ref": "#/$defs/Nested"}},
+						"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+					}
+				}
+			}
+		}`))
+	})
+
+	It("generates a schema validating the AlphaOptions", func() {
+		schema, err := GenerateJSONSchema(&AlphaOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(schema).To(ContainSubstring(`"$ref": "#/$defs/AlphaOptions"`))
+		Expect(schema).To(ContainSubstring(`"passHostHeader": {`))
+	})
 })
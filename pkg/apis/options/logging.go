@@ -7,18 +7,25 @@ import (
 
 // Logging contains all options required for configuring the logging
 type Logging struct {
-	AuthEnabled     bool           `flag:"auth-logging" cfg:"auth_logging"`
-	AuthFormat      string         `flag:"auth-logging-format" cfg:"auth_logging_format"`
-	RequestEnabled  bool           `flag:"request-logging" cfg:"request_logging"`
-	RequestFormat   string         `flag:"request-logging-format" cfg:"request_logging_format"`
-	StandardEnabled bool           `flag:"standard-logging" cfg:"standard_logging"`
-	StandardFormat  string         `flag:"standard-logging-format" cfg:"standard_logging_format"`
-	ErrToInfo       bool           `flag:"errors-to-info-log" cfg:"errors_to_info_log"`
-	ExcludePaths    []string       `flag:"exclude-logging-path" cfg:"exclude_logging_paths"`
-	LocalTime       bool           `flag:"logging-local-time" cfg:"logging_local_time"`
-	SilencePing     bool           `flag:"silence-ping-logging" cfg:"silence_ping_logging"`
-	RequestIDHeader string         `flag:"request-id-header" cfg:"request_id_header"`
-	File            LogFileOptions `cfg:",squash"`
+	AuthEnabled         bool           `flag:"auth-logging" cfg:"auth_logging"`
+	AuthFormat          string         `flag:"auth-logging-format" cfg:"auth_logging_format"`
+	RequestEnabled      bool           `flag:"request-logging" cfg:"request_logging"`
+	RequestFormat       string         `flag:"request-logging-format" cfg:"request_logging_format"`
+	RequestFormatter    string         `flag:"request-logging-formatter" cfg:"request_logging_formatter"`
+	RequestDestinations []string       `flag:"request-logging-destination" cfg:"request_logging_destinations"`
+	StandardEnabled     bool           `flag:"standard-logging" cfg:"standard_logging"`
+	StandardFormat      string         `flag:"standard-logging-format" cfg:"standard_logging_format"`
+	ErrToInfo           bool           `flag:"errors-to-info-log" cfg:"errors_to_info_log"`
+	ExcludePaths        []string       `flag:"exclude-logging-path" cfg:"exclude_logging_paths"`
+	LocalTime           bool           `flag:"logging-local-time" cfg:"logging_local_time"`
+	SilencePing         bool           `flag:"silence-ping-logging" cfg:"silence_ping_logging"`
+	RequestIDHeader     string         `flag:"request-id-header" cfg:"request_id_header"`
+	RequestSamples      []string       `flag:"request-logging-sample" cfg:"request_logging_samples"`
+	RedactTokens        bool           `flag:"logging-redact-tokens" cfg:"logging_redact_tokens"`
+	RedactEmails        string         `flag:"logging-redact-emails" cfg:"logging_redact_emails"`
+	HashKey             string         `flag:"logging-hash-key" cfg:"logging_hash_key"`
+	RedactQueryParams   []string       `flag:"logging-redact-query-param" cfg:"logging_redact_query_params"`
+	File                LogFileOptions `cfg:",squash"`
 }
 
 // LogFileOptions contains options for configuring logging to a file
@@ -39,12 +46,19 @@ func loggingFlagSet() *pflag.FlagSet {
 	flagSet.String("standard-logging-format", logger.DefaultStandardLoggingFormat, "Template for standard log lines")
 	flagSet.Bool("request-logging", true, "Log HTTP requests")
 	flagSet.String("request-logging-format", logger.DefaultRequestLoggingFormat, "Template for HTTP request log lines")
+	flagSet.String("request-logging-formatter", logger.TemplateRequestFormatter, "Formatter of HTTP request log lines: template (--request-logging-format), json or combined (Apache combined log format)")
+	flagSet.StringSlice("request-logging-destination", []string{}, "Destination of HTTP request logs, in place of the standard log output: stdout, stderr, file://<path>, syslog:// or syslog+<udp|tcp>://<host>:<port>, with an optional ?format=<formatter> (may be given multiple times)")
 	flagSet.Bool("errors-to-info-log", false, "Log errors to the standard logging channel instead of stderr")
 
 	flagSet.StringSlice("exclude-logging-path", []string{}, "Exclude logging requests to paths (eg: '/path1,/path2,/path3')")
 	flagSet.Bool("logging-local-time", true, "If the time in log files and backup filenames are local or UTC time")
 	flagSet.Bool("silence-ping-logging", false, "Disable logging of requests to ping & ready endpoints")
 	flagSet.String("request-id-header", "X-Request-Id", "Request header to use as the request ID")
+	flagSet.StringSlice("request-logging-sample", []string{}, "<path prefix>=<rate> logging only the given fraction, between 0 and 1, of the successful requests to the paths starting with the prefix (may be given multiple times)")
+	flagSet.Bool("logging-redact-tokens", false, "Redact bearer tokens, JWTs and the values of token and secret fields from all log lines")
+	flagSet.String("logging-redact-emails", "", "Redact email addresses from all log lines: redact replaces them, hash replaces them with a hash")
+	flagSet.String("logging-hash-key", "", "Key of the HMAC hashes of email addresses redacted with --logging-redact-emails=hash")
+	flagSet.StringSlice("logging-redact-query-param", []string{}, "Query parameter whose values are redacted from all log lines (may be given multiple times)")
 
 	flagSet.String("logging-filename", "", "File to log requests to, empty for stdout")
 	flagSet.Int("logging-max-size", 100, "Maximum size in megabytes of the log file before rotation")
@@ -58,17 +72,18 @@ func loggingFlagSet() *pflag.FlagSet {
 // loggingDefaults creates a Logging structure, populating each field with its default value
 func loggingDefaults() Logging {
 	return Logging{
-		ExcludePaths:    nil,
-		LocalTime:       true,
-		SilencePing:     false,
-		RequestIDHeader: "X-Request-Id",
-		AuthEnabled:     true,
-		AuthFormat:      logger.DefaultAuthLoggingFormat,
-		RequestEnabled:  true,
-		RequestFormat:   logger.DefaultRequestLoggingFormat,
-		StandardEnabled: true,
-		StandardFormat:  logger.DefaultStandardLoggingFormat,
-		ErrToInfo:       false,
+		ExcludePaths:     nil,
+		LocalTime:        true,
+		SilencePing:      false,
+		RequestIDHeader:  "X-Request-Id",
+		AuthEnabled:      true,
+		AuthFormat:       logger.DefaultAuthLoggingFormat,
+		RequestEnabled:   true,
+		RequestFormat:    logger.DefaultRequestLoggingFormat,
+		RequestFormatter: logger.TemplateRequestFormatter,
+		StandardEnabled:  true,
+		StandardFormat:   logger.DefaultStandardLoggingFormat,
+		ErrToInfo:        false,
 		File: LogFileOptions{
 			Filename:   "",
 			MaxSize:    100,
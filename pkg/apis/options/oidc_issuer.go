@@ -0,0 +1,80 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// OIDCIssuer includes options for the OpenID Connect issuer the proxy exposes
+// to upstream applications that can only authenticate users with OIDC. The
+// issuer signs the users in with the session of the proxy, and mints ID and
+// access tokens representing it, instead of the application signing users in
+// with the provider itself.
+type OIDCIssuer struct {
+	// SigningKeyFile is the path to the PEM encoded RSA or P-256 EC private
+	// key the tokens are signed with. The issuer is disabled when it is empty.
+	SigningKeyFile string `flag:"oidc-idp-signing-key-file" cfg:"oidc_idp_signing_key_file"`
+	// URL is the issuer identifier of the tokens. It defaults to the
+	// `/oauth2/oidc` endpoint on the host of each request.
+	URL string `flag:"oidc-idp-issuer-url" cfg:"oidc_idp_issuer_url"`
+	// Clients are the applications that may use the issuer, as
+	// `client_id:client_secret:redirect_uri[,redirect_uri...]` entries, with
+	// the redirect URIs the authorization endpoint may send the users of the
+	// client back to.
+	Clients []string `flag:"oidc-idp-client" cfg:"oidc_idp_clients"`
+	// TokenExpire is how long the minted ID and access tokens are valid for.
+	TokenExpire time.Duration `flag:"oidc-idp-token-expire" cfg:"oidc_idp_token_expire"`
+}
+
+// OIDCIssuerClient is a client of the Clients option of the OIDC issuer
+type OIDCIssuerClient struct {
+	ID     string
+	Secret string
+
+	// RedirectURLs are the redirect URIs the users of the client may be
+	// sent back to.
+	RedirectURLs []string
+}
+
+// ParseOIDCIssuerClient parses a client of the form
+// client_id:client_secret:redirect_uri[,redirect_uri...]. The client ID and
+// secret cannot contain a colon, the redirect URIs are the rest of the entry.
+func ParseOIDCIssuerClient(entry string) (OIDCIssuerClient, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		id, _, _ := strings.Cut(entry, ":")
+		return OIDCIssuerClient{}, fmt.Errorf("invalid oidc_idp_clients entry %q, expected client_id:client_secret:redirect_uri[,redirect_uri...]", id)
+	}
+	return OIDCIssuerClient{
+		ID:           parts[0],
+		Secret:       parts[1],
+		RedirectURLs: strings.Split(parts[2], ","),
+	}, nil
+}
+
+// Enabled returns whether the OIDC issuer endpoints are enabled
+func (o OIDCIssuer) Enabled() bool {
+	return o.SigningKeyFile != ""
+}
+
+func oidcIssuerFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("oidcissuer", pflag.ExitOnError)
+
+	flagSet.String("oidc-idp-signing-key-file", "", "path to the PEM encoded private key of the OIDC issuer for upstream applications at /oauth2/oidc (disabled if empty)")
+	flagSet.String("oidc-idp-issuer-url", "", "the issuer identifier of the tokens minted for upstream applications (defaults to the /oauth2/oidc endpoint on the host of the request)")
+	flagSet.StringSlice("oidc-idp-client", []string{}, "applications that may sign users in with the OIDC issuer, as client_id:client_secret:redirect_uri[,redirect_uri...] (may be given multiple times)")
+	flagSet.Duration("oidc-idp-token-expire", time.Hour, "how long the ID and access tokens minted by the OIDC issuer are valid for")
+
+	return flagSet
+}
+
+// oidcIssuerDefaults creates an OIDCIssuer populating each field with its
+// default value
+func oidcIssuerDefaults() OIDCIssuer {
+	return OIDCIssuer{
+		TokenExpire: time.Hour,
+	}
+}
@@ -1,11 +1,36 @@
 package options
 
+import "time"
+
 const (
+	// DefaultProviderTimeout is the maximum duration of each call to the provider.
+	DefaultProviderTimeout = 30 * time.Second
+
+	// DefaultProviderRetryBackoff is the delay before the first retry of a
+	// request to the provider.
+	DefaultProviderRetryBackoff = 100 * time.Millisecond
+
+	// DefaultProviderRetryMaxBackoff is the maximum delay between retries of a
+	// request to the provider.
+	DefaultProviderRetryMaxBackoff = 5 * time.Second
+
+	// DefaultProviderRetryBudget is the ratio of retries to requests allowed
+	// for each provider.
+	DefaultProviderRetryBudget = 0.1
+
 	// OIDCEmailClaim is the generic email claim used by the OIDC provider.
 	OIDCEmailClaim = "email"
 
 	// OIDCGroupsClaim is the generic groups claim used by the OIDC provider.
 	OIDCGroupsClaim = "groups"
+
+	// OIDCUserInfoPrecedenceIDToken prefers the claims of the ID token over
+	// those of the userinfo endpoint.
+	OIDCUserInfoPrecedenceIDToken = "idToken"
+
+	// OIDCUserInfoPrecedenceUserInfo prefers the claims of the userinfo
+	// endpoint over those of the ID token.
+	OIDCUserInfoPrecedenceUserInfo = "userInfo"
 )
 
 // OIDCAudienceClaims is the generic audience claim list used by the OIDC provider.
@@ -25,15 +50,24 @@ type Provider struct {
 	// ClientSecretFile is the name of the file
 	// containing the OAuth Client Secret, it will be used if ClientSecret is not set.
 	ClientSecretFile string `json:"clientSecretFile,omitempty"`
+	// ClientSecretRef is a reference to the OAuth Client Secret in a secret
+	// store, eg. `kubernetes://namespace/secret/key` or `vault://path#field`.
+	// It will be used if ClientSecret is not set, and is fetched again every
+	// few minutes so that a rotated secret is picked up.
+	ClientSecretRef string `json:"clientSecretRef,omitempty"`
 
 	// KeycloakConfig holds all configurations for Keycloak provider.
 	KeycloakConfig KeycloakOptions `json:"keycloakConfig,omitempty"`
 	// AzureConfig holds all configurations for Azure provider.
 	AzureConfig AzureOptions `json:"azureConfig,omitempty"`
+	// CognitoConfig holds all configurations for Cognito provider.
+	CognitoConfig CognitoOptions `json:"cognitoConfig,omitempty"`
 	// ADFSConfig holds all configurations for ADFS provider.
 	ADFSConfig ADFSOptions `json:"ADFSConfig,omitempty"`
 	// BitbucketConfig holds all configurations for Bitbucket provider.
 	BitbucketConfig BitbucketOptions `json:"bitbucketConfig,omitempty"`
+	// DiscordConfig holds all configurations for Discord provider.
+	DiscordConfig DiscordOptions `json:"discordConfig,omitempty"`
 	// GitHubConfig holds all configurations for GitHubC provider.
 	GitHubConfig GitHubOptions `json:"githubConfig,omitempty"`
 	// GitLabConfig holds all configurations for GitLab provider.
@@ -45,6 +79,10 @@ type Provider struct {
 	OIDCConfig OIDCOptions `json:"oidcConfig,omitempty"`
 	// LoginGovConfig holds all configurations for LoginGov provider.
 	LoginGovConfig LoginGovOptions `json:"loginGovConfig,omitempty"`
+	// SAMLConfig holds all configurations for SAML provider.
+	SAMLConfig SAMLOptions `json:"samlConfig,omitempty"`
+	// SlackConfig holds all configurations for Slack provider.
+	SlackConfig SlackOptions `json:"slackConfig,omitempty"`
 
 	// ID should be a unique identifier for the provider.
 	// This value is required for all providers.
@@ -56,12 +94,30 @@ type Provider struct {
 	// Name is the providers display name
 	// if set, it will be shown to the users in the login page.
 	Name string `json:"name,omitempty"`
+	// Hosts is a list of request hosts for which users sign in with this
+	// provider when several providers are configured, instead of choosing one
+	// from the sign in page. Hosts are matched in the same way as the
+	// whitelist domains, so `.example.com` matches all subdomains of example.com.
+	Hosts []string `json:"hosts,omitempty"`
+	// RedirectURLs are OAuth redirect URLs registered with this provider.
+	// The URL whose host matches the request host is used in place of the
+	// global redirect URL. A host starting with `*.` matches all subdomains and
+	// is replaced by the request host.
+	RedirectURLs []string `json:"redirectURLs,omitempty"`
 	// CAFiles is a list of paths to CA certificates that should be used when connecting to the provider.
 	// If not specified, the default Go trust sources are used instead
 	CAFiles []string `json:"caFiles,omitempty"`
 	// UseSystemTrustStore determines if your custom CA files and the system trust store are used
 	// If set to true, your custom CA files and the system trust store are used otherwise only your custom CA files.
 	UseSystemTrustStore bool `json:"useSystemTrustStore,omitempty"`
+	// Timeout is the maximum duration of each call to the provider, such as
+	// redeeming a code or refreshing a session.
+	// Defaults to 30 seconds. A zero value disables the timeout.
+	Timeout *Duration `json:"timeout,omitempty"`
+	// Retry configures the retrying of requests to the provider that fail
+	// with a transient error, such as a 5xx or 429 response.
+	// Requests are not retried by default.
+	Retry *ProviderRetry `json:"retry,omitempty"`
 	// LoginURL is the authentication endpoint
 	LoginURL string `json:"loginURL,omitempty"`
 	// LoginURLParameters defines the parameters that can be passed from the start URL to the IdP login URL
@@ -89,9 +145,9 @@ type Provider struct {
 }
 
 // ProviderType is used to enumerate the different provider type options
-// Valid options are: adfs, azure, bitbucket, digitalocean facebook, github,
-// gitlab, google, keycloak, keycloak-oidc, linkedin, login.gov, nextcloud
-// and oidc.
+// Valid options are: adfs, azure, bitbucket, cognito, digitalocean, discord,
+// facebook, github, gitlab, google, keycloak, keycloak-oidc, linkedin,
+// login.gov, nextcloud, oidc, saml, slack and twitch.
 type ProviderType string
 
 const (
@@ -104,9 +160,15 @@ const (
 	// BitbucketProvider is the provider type for Bitbucket
 	BitbucketProvider ProviderType = "bitbucket"
 
+	// CognitoProvider is the provider type for AWS Cognito
+	CognitoProvider ProviderType = "cognito"
+
 	// DigitalOceanProvider is the provider type for DigitalOcean
 	DigitalOceanProvider ProviderType = "digitalocean"
 
+	// DiscordProvider is the provider type for Discord
+	DiscordProvider ProviderType = "discord"
+
 	// FacebookProvider is the provider type for Facebook
 	FacebookProvider ProviderType = "facebook"
 
@@ -136,14 +198,61 @@ const (
 
 	// OIDCProvider is the provider type for OIDC
 	OIDCProvider ProviderType = "oidc"
+
+	// SAMLProvider is the provider type for SAML 2.0 identity providers
+	SAMLProvider ProviderType = "saml"
+
+	// SlackProvider is the provider type for Slack
+	SlackProvider ProviderType = "slack"
+
+	// TwitchProvider is the provider type for Twitch
+	TwitchProvider ProviderType = "twitch"
 )
 
+// ProviderRetry configures the retrying of requests to the provider.
+// Requests that are not idempotent, such as redeeming a code, are only
+// retried when the provider cannot have processed them.
+type ProviderRetry struct {
+	// MaxRetries is the maximum number of times each request is retried.
+	// Requests are not retried when zero.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// Backoff is the delay before the first retry, doubling with each retry.
+	// Defaults to 100 milliseconds.
+	Backoff Duration `json:"backoff,omitempty"`
+	// MaxBackoff is the maximum delay between retries.
+	// Defaults to 5 seconds.
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+	// Budget is the ratio of retries to requests allowed, so that retries do
+	// not overwhelm a struggling provider.
+	// Defaults to 0.1, one retry for every ten requests.
+	Budget float64 `json:"budget,omitempty"`
+}
+
 type KeycloakOptions struct {
 	// Group enables to restrict login to members of indicated group
 	Groups []string `json:"groups,omitempty"`
 
 	// Role enables to restrict login to users with role (only available when using the keycloak-oidc provider)
 	Roles []string `json:"roles,omitempty"`
+
+	// RealmRolePrefix is prepended to the realm roles of the user when they are
+	// added to the session groups (only available when using the keycloak-oidc provider).
+	// Defaults to `role:`.
+	RealmRolePrefix *string `json:"realmRolePrefix,omitempty"`
+
+	// ClientRolePrefix is prepended to the `<client>:<role>` client roles of the
+	// user when they are added to the session groups (only available when using
+	// the keycloak-oidc provider).
+	// Defaults to `role:`.
+	ClientRolePrefix *string `json:"clientRolePrefix,omitempty"`
+}
+
+type CognitoOptions struct {
+	// Attributes are the claims of the ID token, such as `custom:tenant`,
+	// that are added to the session attributes, and so may be injected into
+	// headers with the claim source of the same name.
+	// Defaults to all the `custom:` attributes of the user.
+	Attributes []string `json:"attributes,omitempty"`
 }
 
 type AzureOptions struct {
@@ -151,8 +260,26 @@ type AzureOptions struct {
 	// Default value is 'common'
 	Tenant string `json:"tenant,omitempty"`
 	// GraphGroupField configures the group field to be used when building the groups list from Microsoft Graph
+	// Several fields may be separated by commas, eg. 'id,displayName' adds both the IDs and the names of the groups
 	// Default value is 'id'
 	GraphGroupField string `json:"graphGroupField,omitempty"`
+	// SkipGraphGroups uses the app roles of the `roles` claim as the groups of
+	// the user, without querying Microsoft Graph for their group memberships
+	SkipGraphGroups bool `json:"skipGraphGroups,omitempty"`
+	// GraphMaxPages limits the number of pages of groups requested from
+	// Microsoft Graph for a user. Further groups are not added to the session.
+	// Default value is 0, requesting every page.
+	GraphMaxPages int `json:"graphMaxPages,omitempty"`
+	// GraphTimeout is the maximum duration of each request to Microsoft Graph.
+	// Requests are only bounded by the provider timeout when it is not set.
+	GraphTimeout *Duration `json:"graphTimeout,omitempty"`
+	// AllowedTenants restricts the tenants users may sign in from, typically
+	// with a multi-tenant endpoint, where the issuer of ID tokens varies.
+	// The issuer and `tid` claim of verified tokens must name one of the
+	// tenant IDs. `organizations` allows any work or school tenant, `consumers`
+	// allows personal Microsoft accounts and `*` allows any tenant.
+	// Tenants not listed are denied. Every tenant is allowed when not set.
+	AllowedTenants []string `json:"allowedTenants,omitempty"`
 }
 
 type ADFSOptions struct {
@@ -168,6 +295,48 @@ type BitbucketOptions struct {
 	Repository string `json:"repository,omitempty"`
 }
 
+type DiscordOptions struct {
+	// Guilds restricts logins to members of these Discord guilds (servers), by ID
+	Guilds []string `json:"guilds,omitempty"`
+	// Roles restricts logins to members of guilds with these roles, given as
+	// `<guild ID>:<role ID>`
+	Roles []string `json:"roles,omitempty"`
+}
+
+type SAMLOptions struct {
+	// IdPEntityID is the entity ID of the identity provider, which assertions
+	// must be issued by. The issuer is not checked when not set.
+	IdPEntityID string `json:"idpEntityID,omitempty"`
+	// IdPCertificateFiles are the paths to the PEM encoded certificates the
+	// identity provider signs responses or assertions with. Several
+	// certificates may be given while the identity provider rolls its key over.
+	IdPCertificateFiles []string `json:"idpCertificateFiles,omitempty"`
+	// LogoutURL is the single logout endpoint of the identity provider, for
+	// the HTTP-Redirect binding. Users are not signed out of the identity
+	// provider when not set.
+	LogoutURL string `json:"logoutURL,omitempty"`
+	// SigningKeyFile is the path to the PEM encoded RSA private key that
+	// authentication and logout requests are signed with, for identity
+	// providers that require signed requests.
+	SigningKeyFile string `json:"signingKeyFile,omitempty"`
+	// NameIDFormat is the format of the name ID requested for users, such as
+	// `urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress`.
+	// The identity provider chooses the format when not set.
+	NameIDFormat string `json:"nameIDFormat,omitempty"`
+	// EmailAttribute is the name of the attribute holding the email address
+	// of users. The name ID is used when it has the email address format and
+	// the attribute is missing.
+	// Defaults to `email`.
+	EmailAttribute string `json:"emailAttribute,omitempty"`
+	// GroupsAttribute is the name of the attribute holding the groups of
+	// users.
+	// Defaults to `groups`.
+	GroupsAttribute string `json:"groupsAttribute,omitempty"`
+	// PreferredUsernameAttribute is the name of the attribute holding the
+	// preferred username of users.
+	PreferredUsernameAttribute string `json:"preferredUsernameAttribute,omitempty"`
+}
+
 type GitHubOptions struct {
 	// Org sets restrict logins to members of this organisation
 	Org string `json:"org,omitempty"`
@@ -181,6 +350,13 @@ type GitHubOptions struct {
 	// Users allows users with these usernames to login
 	// even if they do not belong to the specified org and team or collaborators
 	Users []string `json:"users,omitempty"`
+	// OrgRole restricts logins to members of the organisation with this role,
+	// either admin or member. It requires Org and enables UseGraphQL.
+	OrgRole string `json:"orgRole,omitempty"`
+	// UseGraphQL looks up the organisations and teams of users with the
+	// GraphQL API, including the parent teams of nested teams.
+	// Lookups are cached per session.
+	UseGraphQL bool `json:"useGraphQL,omitempty"`
 }
 
 type GitLabOptions struct {
@@ -201,6 +377,18 @@ type GoogleOptions struct {
 	UseApplicationDefaultCredentials bool `json:"useApplicationDefaultCredentials,omitempty"`
 	// TargetPrincipal is the Google Service Account used for Application Default Credentials
 	TargetPrincipal string `json:"targetPrincipal,omitempty"`
+	// UseCloudIdentity checks group membership with the Cloud Identity API
+	// using Application Default Credentials, such as Workload Identity,
+	// instead of the Admin SDK with domain-wide delegation.
+	// AdminEmail and ServiceAccountJSON are not required.
+	UseCloudIdentity bool `json:"useCloudIdentity,omitempty"`
+	// APITokens exchanges the refresh token of the session for access tokens
+	// restricted to the scopes of the token exchange of an upstream, such as
+	// https://www.googleapis.com/auth/bigquery.readonly, so that upstreams
+	// call Google APIs on behalf of the user without OAuth credentials of
+	// their own. The scopes must have been granted at sign in, or through the
+	// scopes of the upstream.
+	APITokens bool `json:"apiTokens,omitempty"`
 }
 
 type OIDCOptions struct {
@@ -229,8 +417,24 @@ type OIDCOptions struct {
 	// default set to 'email'
 	EmailClaim string `json:"emailClaim,omitempty"`
 	// GroupsClaim indicates which claim contains the user groups
+	// It may be a JSONPath-like expression to a nested claim, eg. 'realm_access.roles'
+	// or "resource_access['my-app'].roles". Claims holding JSON encoded strings are decoded.
 	// default set to 'groups'
 	GroupsClaim string `json:"groupsClaim,omitempty"`
+	// GroupsOverageURL enables resolving groups that the IdP left out of the ID token
+	// because the user is a member of too many groups, as advertised by the
+	// `_claim_names` and `_claim_sources` claims.
+	// Groups are fetched from this URL using the access token.
+	// `{endpoint}` is replaced with the endpoint advertised in `_claim_sources`
+	// and any other `{claim}` with the value of that claim in the ID token,
+	// eg: `{endpoint}` or https://graph.microsoft.com/v1.0/users/{oid}/transitiveMemberOf
+	GroupsOverageURL string `json:"groupsOverageURL,omitempty"`
+	// DistributedClaims enables resolving claims that the ID token leaves out and
+	// advertises in its `_claim_names` and `_claim_sources` claims instead, from
+	// the aggregated claims or the endpoint of their source.
+	// Endpoints are requested with the access token.
+	// default set to 'false'
+	DistributedClaims bool `json:"distributedClaims,omitempty"`
 	// UserIDClaim indicates which claim contains the user ID
 	// default set to 'email'
 	UserIDClaim string `json:"userIDClaim,omitempty"`
@@ -240,6 +444,15 @@ type OIDCOptions struct {
 	// ExtraAudiences is a list of additional audiences that are allowed
 	// to pass verification in addition to the client id.
 	ExtraAudiences []string `json:"extraAudiences,omitempty"`
+	// UserInfoEnrichment calls the userinfo endpoint each time a session is created,
+	// and merges its claims into those of the ID token, rather than only calling it
+	// for claims missing from the ID token. The groups of both are combined.
+	// default set to 'false'
+	UserInfoEnrichment bool `json:"userInfoEnrichment,omitempty"`
+	// UserInfoPrecedence is which claims are used when both the ID token and the
+	// userinfo endpoint have the claim, either `idToken` or `userInfo`.
+	// default set to 'idToken'
+	UserInfoPrecedence string `json:"userInfoPrecedence,omitempty"`
 }
 
 type LoginGovOptions struct {
@@ -251,6 +464,13 @@ type LoginGovOptions struct {
 	PubJWKURL string `json:"pubjwkURL,omitempty"`
 }
 
+type SlackOptions struct {
+	// Workspaces restricts logins to members of these Slack workspaces, by
+	// team ID. Users are asked to sign in to the workspace when only one is
+	// set.
+	Workspaces []string `json:"workspaces,omitempty"`
+}
+
 func providerDefaults() Providers {
 	providers := Providers{
 		{
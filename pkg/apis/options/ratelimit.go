@@ -0,0 +1,70 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// The keys requests can be rate limited by
+const (
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyUser   = "user"
+	RateLimitKeyHeader = "header:"
+)
+
+// The stores the rate limits can be tracked in
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// RateLimit includes options for limiting the rate of the requests of each
+// client, with a token bucket per client that holds the number of requests
+// allowed per period and refills continuously.
+type RateLimit struct {
+	// AuthRequests is the number of requests to the sign in endpoints
+	// (/oauth2/start and /oauth2/callback) allowed per period.
+	// Unlimited when zero.
+	AuthRequests int `flag:"rate-limit-auth-requests" cfg:"rate_limit_auth_requests"`
+	// ProxyRequests is the number of requests proxied to the upstreams
+	// allowed per period. Unlimited when zero.
+	ProxyRequests int `flag:"rate-limit-proxy-requests" cfg:"rate_limit_proxy_requests"`
+	// Period is the period the number of requests are allowed in.
+	Period time.Duration `flag:"rate-limit-period" cfg:"rate_limit_period"`
+	// Key is what requests are limited by: the client IP (ip), the user of
+	// the session (user) or the value of a header (header:<name>). Requests
+	// without a user or the header are limited by their client IP.
+	Key string `flag:"rate-limit-key" cfg:"rate_limit_key"`
+	// Store is where the requests are counted: in the memory of the proxy
+	// (memory) or, to share the limits between the replicas of the proxy, in
+	// the redis server configured for the session store (redis).
+	Store string `flag:"rate-limit-store" cfg:"rate_limit_store"`
+}
+
+// Enabled returns whether any requests are rate limited
+func (r RateLimit) Enabled() bool {
+	return r.AuthRequests > 0 || r.ProxyRequests > 0
+}
+
+func rateLimitFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("ratelimit", pflag.ExitOnError)
+
+	flagSet.Int("rate-limit-auth-requests", 0, "number of requests to /oauth2/start and /oauth2/callback each client may make per rate limit period (unlimited if 0)")
+	flagSet.Int("rate-limit-proxy-requests", 0, "number of requests each client may make to the upstreams per rate limit period (unlimited if 0)")
+	flagSet.Duration("rate-limit-period", time.Minute, "the period the rate limits allow their number of requests in")
+	flagSet.String("rate-limit-key", RateLimitKeyIP, "what the requests are rate limited by. One of: ip, user, header:<name>")
+	flagSet.String("rate-limit-store", RateLimitStoreMemory, "where the requests are counted. One of: memory, redis (uses the --redis-* session store options)")
+
+	return flagSet
+}
+
+// rateLimitDefaults creates a RateLimit populating each field with its
+// default value
+func rateLimitDefaults() RateLimit {
+	return RateLimit{
+		Period: time.Minute,
+		Key:    RateLimitKeyIP,
+		Store:  RateLimitStoreMemory,
+	}
+}
@@ -0,0 +1,311 @@
+package options
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonSchemaDialect is the version of JSON Schema the generated schemas follow
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	durationType        = reflect.TypeOf(Duration(0))
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonField is a field of a struct as encoding/json decodes it
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields returns the fields of a struct type by the name they are given
+// in JSON, including the fields of embedded structs, as encoding/json
+// decodes them
+func jsonFields(typ reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(fieldType)...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: field.Type})
+	}
+	return fields
+}
+
+// decodesItself returns whether values of the type decode themselves,
+// in which case their structure is not known
+func decodesItself(typ reflect.Type) bool {
+	ptr := reflect.PointerTo(typ)
+	return ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType)
+}
+
+// GenerateJSONSchema generates the JSON Schema of the options given, as they
+// are loaded by LoadYAML, so that editors can validate and complete config files.
+func GenerateJSONSchema(options interface{}) ([]byte, error) {
+	typ := reflect.TypeOf(options)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot generate a schema for %s: expected a struct", typ)
+	}
+
+	defs := map[string]interface{}{}
+	schema := map[string]interface{}{
+		"$schema": jsonSchemaDialect,
+		"$ref":    typeSchema(typ, defs)["$ref"],
+		"$defs":   defs,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of values of the type given, adding the
+// schemas of the structs it references to the definitions
+func typeSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch {
+	case typ == durationType:
+		return map[string]interface{}{"type": "string", "format": "duration"}
+	case decodesItself(typ):
+		return map[string]interface{}{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return typeSchema(typ.Elem(), defs)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			// Bytes are encoded as base64 strings
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(typ.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(typ.Elem(), defs)}
+	case reflect.Struct:
+		return structSchema(typ, defs)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns a reference to the schema of a struct, defining it
+// first if needed. Anonymous structs are defined inline.
+func structSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	name := typ.Name()
+	if name != "" {
+		ref := map[string]interface{}{"$ref": "#/$defs/" + name}
+		if _, ok := defs[name]; ok {
+			return ref
+		}
+		// Reserve the definition so that recursive types reference it
+		defs[name] = nil
+		defs[name] = objectSchema(typ, defs)
+		return ref
+	}
+	return objectSchema(typ, defs)
+}
+
+func objectSchema(typ reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, field := range jsonFields(typ) {
+		properties[field.name] = typeSchema(field.typ, defs)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// unknownFields returns the fields of the value given, as decoded from YAML,
+// that the type given has no field for, as errors naming their path and
+// suggesting the field that was likely meant.
+func unknownFields(path string, value interface{}, typ reflect.Type) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if decodesItself(typ) {
+		return nil
+	}
+
+	var unknown []string
+	switch typ.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(typ)
+		for _, key := range sortedKeys(object) {
+			fieldPath := joinFieldPath(path, key)
+			field, ok := lookupJSONField(fields, key)
+			if !ok {
+				unknown = append(unknown, fmt.Sprintf("%s: %s", fieldPath, suggestField(path, key, fields)))
+				continue
+			}
+			unknown = append(unknown, unknownFields(fieldPath, object[key], field.typ)...)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(fmt.Sprintf("%s[%d]", path, i), item, typ.Elem())...)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range sortedKeys(object) {
+			unknown = append(unknown, unknownFields(joinFieldPath(path, key), object[key], typ.Elem())...)
+		}
+	}
+	return unknown
+}
+
+// lookupJSONField finds the field for a key, preferring an exact match but
+// accepting a case-insensitive one, as encoding/json does
+func lookupJSONField(fields []jsonField, key string) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == key {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.name, key) {
+			return field, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// suggestField returns what to do about an unknown field: use the field it is
+// a misspelling of, or, for the options of the legacy configuration, set them
+// with their flag or convert them to the alpha configuration.
+func suggestField(path, key string, fields []jsonField) string {
+	normalizedKey := normalizeFieldName(key)
+	best, bestDistance := "", 3
+	for _, field := range fields {
+		if normalizeFieldName(field.name) == normalizedKey {
+			return fmt.Sprintf("unknown field, did you mean %q?", field.name)
+		}
+		if distance := editDistance(strings.ToLower(field.name), strings.ToLower(key)); distance < bestDistance {
+			best, bestDistance = field.name, distance
+		}
+	}
+
+	if path == "" {
+		cfgName := strings.ReplaceAll(key, "-", "_")
+		if flag, ok := configFlags(NewOptions())[cfgName]; ok {
+			return fmt.Sprintf("%s is not an alpha option, set it with --%s or in the --config file", key, flag)
+		}
+		if flag, ok := configFlags(NewLegacyOptions())[cfgName]; ok {
+			return fmt.Sprintf("--%s is a legacy option replaced by the alpha configuration, use --convert-config-to-alpha to convert it", flag)
+		}
+	}
+
+	if best != "" {
+		return fmt.Sprintf("unknown field, did you mean %q?", best)
+	}
+	return "unknown field"
+}
+
+// configFlags returns the flags of the options given, by their `cfg` name
+func configFlags(options interface{}) map[string]string {
+	flags := map[string]string{}
+	addConfigFlags(reflect.Indirect(reflect.ValueOf(options)).Type(), flags)
+	return flags
+}
+
+func addConfigFlags(typ reflect.Type, flags map[string]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		cfgName := field.Tag.Get("cfg")
+		if field.Type.Kind() == reflect.Struct && cfgName == ",squash" {
+			addConfigFlags(field.Type, flags)
+			continue
+		}
+		if flag := field.Tag.Get("flag"); flag != "" && cfgName != "" && cfgName != ",internal" {
+			flags[cfgName] = flag
+		}
+	}
+}
+
+// normalizeFieldName removes the case and separators of a field name, so that
+// `pass_host_header` and `pass-host-header` both match `passHostHeader`
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
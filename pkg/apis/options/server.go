@@ -13,6 +13,53 @@ type Server struct {
 	// TLS contains the information for loading the certificate and key for the
 	// secure traffic and further configuration for the TLS server.
 	TLS *TLS
+
+	// Auth restricts access to the server to authenticated clients, for
+	// servers not meant for users, such as the metrics server.
+	Auth *ServerAuth
+
+	// HTTP2 serves HTTP/2 to clients: negotiated over TLS on the secure
+	// address, and as HTTP/2 cleartext (h2c) on the insecure address, such
+	// as for gRPC clients.
+	HTTP2 bool
+
+	// ProxyProtocol requires the connections to start with a PROXY protocol
+	// header, version 1 or 2, sent by a load balancer with the address of
+	// its client, which becomes the client IP of the requests.
+	ProxyProtocol bool
+
+	// Listeners are further addresses on which to serve the same traffic,
+	// each with its own TLS settings, such as an internal address requiring
+	// client certificates next to the public address.
+	Listeners []Listener
+}
+
+// Listener is an address on which a server serves traffic, in addition to
+// its BindAddress and SecureBindAddress.
+type Listener struct {
+	// BindAddress is the address on which to serve traffic.
+	BindAddress string
+
+	// TLS contains the certificate and key for serving secure traffic on the
+	// address. Leave unset to serve insecure traffic.
+	TLS *TLS
+}
+
+// ServerAuth contains the ways clients authenticate to a server.
+// When AllowedNetworks is set, clients must connect from one of the networks.
+// When BearerToken or ClientCA is set, clients must also send the token or
+// present a client certificate issued by one of the certificate authorities.
+type ServerAuth struct {
+	// BearerToken is the token clients send in the Authorization header.
+	// It should be a long random value, as it is not rate limited.
+	BearerToken *SecretSource
+
+	// ClientCA is the PEM encoded certificate authorities that issue the
+	// client certificates clients may authenticate with over TLS.
+	ClientCA *SecretSource
+
+	// AllowedNetworks are the IPs or CIDR ranges clients must connect from.
+	AllowedNetworks []string
 }
 
 // TLS contains the information for loading a TLS certificate and key
@@ -37,4 +84,70 @@ type TLS struct {
 	// If not specified, the default Go safe cipher list is used.
 	// List of valid cipher suites can be found in the [crypto/tls documentation](https://pkg.go.dev/crypto/tls#pkg-constants).
 	CipherSuites []string
+
+	// MaxVersion is the maximal TLS version that is acceptable.
+	// E.g. Set to "TLS1.2" to disable TLS version 1.3
+	MaxVersion string
+
+	// CurvePreferences are the elliptic curves allowed for the key exchange,
+	// in order of preference: X25519, P256, P384 and P521.
+	// If not specified, the Go default curves are used.
+	CurvePreferences []string
+
+	// ALPNProtocols are the application protocols negotiated with clients,
+	// in order of preference: h2 and http/1.1.
+	// If not specified, h2 is negotiated when HTTP/2 is enabled, and http/1.1.
+	ALPNProtocols []string
+
+	// ClientCAFiles are the paths of the PEM encoded certificate authorities
+	// issuing the certificates clients must present during the TLS handshake.
+	// Connections from clients without such a certificate are refused.
+	ClientCAFiles []string
+
+	// ClientAuth is how client certificates are requested and verified:
+	// none, request, require, verify-if-given or require-and-verify.
+	// It defaults to require-and-verify when ClientCAFiles are set.
+	ClientAuth string
+
+	// Certificates are further certificates, served to the clients that
+	// request one of their hosts with SNI, so that a single address serves
+	// the hosts of several virtual hosts.
+	// The certificate given by Key and Cert is served to the other clients.
+	Certificates []TLSCertificate
+
+	// CertificatesDir is a directory of further certificates, each in a
+	// `<name>.crt` file next to its key in `<name>.key`, served to the clients
+	// that request one of the DNS names of the certificate with SNI.
+	// Certificates added to, replaced in or removed from the directory are
+	// picked up while the proxy runs.
+	CertificatesDir string
 }
+
+// TLSCertificate is a certificate served to the clients that request one of
+// its hosts with SNI.
+type TLSCertificate struct {
+	// Hosts are the server names the certificate is served for.
+	// A leading `*.` matches all subdomains of the host.
+	// They default to the DNS names of the certificate.
+	Hosts []string
+
+	// Key is the TLS key data to use.
+	Key *SecretSource
+
+	// Cert is the TLS certificate data to use.
+	Cert *SecretSource
+}
+
+const (
+	// TLSClientAuthNone does not request client certificates
+	TLSClientAuthNone = "none"
+	// TLSClientAuthRequest requests client certificates without verifying them
+	TLSClientAuthRequest = "request"
+	// TLSClientAuthRequire requires client certificates without verifying them
+	TLSClientAuthRequire = "require"
+	// TLSClientAuthVerifyIfGiven verifies client certificates when clients
+	// present one
+	TLSClientAuthVerifyIfGiven = "verify-if-given"
+	// TLSClientAuthRequireAndVerify requires and verifies client certificates
+	TLSClientAuthRequireAndVerify = "require-and-verify"
+)
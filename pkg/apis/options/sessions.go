@@ -1,10 +1,58 @@
 package options
 
+import "time"
+
 // SessionOptions contains configuration options for the SessionStore providers.
 type SessionOptions struct {
-	Type   string             `flag:"session-store-type" cfg:"session_store_type"`
-	Cookie CookieStoreOptions `cfg:",squash"`
-	Redis  RedisStoreOptions  `cfg:",squash"`
+	Type      string                 `flag:"session-store-type" cfg:"session_store_type"`
+	Failover  SessionFailoverOptions `cfg:",squash"`
+	Refresh   SessionRefreshOptions  `cfg:",squash"`
+	Reaper    SessionReaperOptions   `cfg:",squash"`
+	Cookie    CookieStoreOptions     `cfg:",squash"`
+	Redis     RedisStoreOptions      `cfg:",squash"`
+	Memcached MemcachedStoreOptions  `cfg:",squash"`
+	Postgres  PostgresStoreOptions   `cfg:",squash"`
+	KMS       SessionKMSOptions      `cfg:",squash"`
+	Archive   SessionArchiveOptions  `cfg:",squash"`
+
+	// Index saves the user of each session alongside it in persistent
+	// session stores, so that the sessions can be listed and revoked by the
+	// admin API. It is set when the admin server is enabled.
+	Index bool `cfg:",internal"`
+}
+
+// SessionFailoverOptions contains configuration options for failing over
+// from the primary session store to further session stores.
+type SessionFailoverOptions struct {
+	Stores           []string      `flag:"session-store-failover" cfg:"session_store_failover"`
+	FailureThreshold int           `flag:"session-store-failover-threshold" cfg:"session_store_failover_threshold"`
+	Cooldown         time.Duration `flag:"session-store-failover-cooldown" cfg:"session_store_failover_cooldown"`
+}
+
+// SessionRefreshOptions contains configuration options for refreshing
+// sessions held in a persistent session store in the background, before
+// they expire.
+type SessionRefreshOptions struct {
+	BeforeExpiry time.Duration `flag:"session-refresh-before-expiry" cfg:"session_refresh_before_expiry"`
+	Interval     time.Duration `flag:"session-refresh-interval" cfg:"session_refresh_interval"`
+}
+
+// SessionReaperOptions contains configuration options for deleting the
+// expired and orphaned sessions of a persistent session store in the
+// background, in batches.
+type SessionReaperOptions struct {
+	Interval  time.Duration `flag:"session-reaper-interval" cfg:"session_reaper_interval"`
+	BatchSize int           `flag:"session-reaper-batch-size" cfg:"session_reaper_batch_size"`
+	Rate      int           `flag:"session-reaper-rate" cfg:"session_reaper_rate"`
+}
+
+// SessionArchiveOptions contains configuration options for exporting the
+// sessions of a persistent session store to encrypted archives, and
+// importing them again.
+type SessionArchiveOptions struct {
+	// Secret is the secret the keys of the archives are derived from.
+	// Sessions cannot be exported or imported when it is empty.
+	Secret string `flag:"session-archive-secret" cfg:"session_archive_secret"`
 }
 
 // CookieSessionStoreType is used to indicate the CookieSessionStore should be
@@ -15,6 +63,14 @@ var CookieSessionStoreType = "cookie"
 // used for storing sessions.
 var RedisSessionStoreType = "redis"
 
+// MemcachedSessionStoreType is used to indicate the MemcachedSessionStore
+// should be used for storing sessions.
+var MemcachedSessionStoreType = "memcached"
+
+// PostgresSessionStoreType is used to indicate the PostgresSessionStore
+// should be used for storing sessions.
+var PostgresSessionStoreType = "postgres"
+
 // CookieStoreOptions contains configuration options for the CookieSessionStore.
 type CookieStoreOptions struct {
 	Minimal bool `flag:"session-cookie-minimal" cfg:"session_cookie_minimal"`
@@ -22,25 +78,130 @@ type CookieStoreOptions struct {
 
 // RedisStoreOptions contains configuration options for the RedisSessionStore.
 type RedisStoreOptions struct {
-	ConnectionURL          string   `flag:"redis-connection-url" cfg:"redis_connection_url"`
-	Username               string   `flag:"redis-username" cfg:"redis_username"`
-	Password               string   `flag:"redis-password" cfg:"redis_password"`
-	UseSentinel            bool     `flag:"redis-use-sentinel" cfg:"redis_use_sentinel"`
-	SentinelPassword       string   `flag:"redis-sentinel-password" cfg:"redis_sentinel_password"`
-	SentinelMasterName     string   `flag:"redis-sentinel-master-name" cfg:"redis_sentinel_master_name"`
-	SentinelConnectionURLs []string `flag:"redis-sentinel-connection-urls" cfg:"redis_sentinel_connection_urls"`
-	UseCluster             bool     `flag:"redis-use-cluster" cfg:"redis_use_cluster"`
-	ClusterConnectionURLs  []string `flag:"redis-cluster-connection-urls" cfg:"redis_cluster_connection_urls"`
-	CAPath                 string   `flag:"redis-ca-path" cfg:"redis_ca_path"`
-	InsecureSkipTLSVerify  bool     `flag:"redis-insecure-skip-tls-verify" cfg:"redis_insecure_skip_tls_verify"`
-	IdleTimeout            int      `flag:"redis-connection-idle-timeout" cfg:"redis_connection_idle_timeout"`
+	ConnectionURL               string        `flag:"redis-connection-url" cfg:"redis_connection_url"`
+	Username                    string        `flag:"redis-username" cfg:"redis_username"`
+	Password                    string        `flag:"redis-password" cfg:"redis_password"`
+	UseSentinel                 bool          `flag:"redis-use-sentinel" cfg:"redis_use_sentinel"`
+	SentinelPassword            string        `flag:"redis-sentinel-password" cfg:"redis_sentinel_password"`
+	SentinelMasterName          string        `flag:"redis-sentinel-master-name" cfg:"redis_sentinel_master_name"`
+	SentinelConnectionURLs      []string      `flag:"redis-sentinel-connection-urls" cfg:"redis_sentinel_connection_urls"`
+	SentinelReadReplicas        bool          `flag:"redis-sentinel-read-replicas" cfg:"redis_sentinel_read_replicas"`
+	SentinelReplicaMaxStaleness time.Duration `flag:"redis-sentinel-replica-max-staleness" cfg:"redis_sentinel_replica_max_staleness"`
+	UseCluster                  bool          `flag:"redis-use-cluster" cfg:"redis_use_cluster"`
+	ClusterConnectionURLs       []string      `flag:"redis-cluster-connection-urls" cfg:"redis_cluster_connection_urls"`
+	CAPath                      string        `flag:"redis-ca-path" cfg:"redis_ca_path"`
+	InsecureSkipTLSVerify       bool          `flag:"redis-insecure-skip-tls-verify" cfg:"redis_insecure_skip_tls_verify"`
+	IdleTimeout                 int           `flag:"redis-connection-idle-timeout" cfg:"redis_connection_idle_timeout"`
+	Compression                 string        `flag:"redis-compression" cfg:"redis_compression"`
+	ChunkSize                   int           `flag:"redis-chunk-size" cfg:"redis_chunk_size"`
+	CacheSize                   int           `flag:"redis-cache-size" cfg:"redis_cache_size"`
+	CacheTTL                    time.Duration `flag:"redis-cache-ttl" cfg:"redis_cache_ttl"`
+	CacheConsistency            string        `flag:"redis-cache-consistency" cfg:"redis_cache_consistency"`
+}
+
+// RedisCompressionNone, RedisCompressionLZ4, RedisCompressionZstd and
+// RedisCompressionBrotli are the compression algorithms sessions can be
+// compressed with in the RedisSessionStore.
+const (
+	RedisCompressionNone   = "none"
+	RedisCompressionLZ4    = "lz4"
+	RedisCompressionZstd   = "zstd"
+	RedisCompressionBrotli = "brotli"
+)
+
+// RedisCacheConsistencyStrict and RedisCacheConsistencyEventual are the
+// consistency modes of the cache of the RedisSessionStore. Strict only serves
+// cached sessions while their changes are notified by redis, eventual serves
+// them until they expire from the cache regardless.
+const (
+	RedisCacheConsistencyStrict   = "strict"
+	RedisCacheConsistencyEventual = "eventual"
+)
+
+// MemcachedStoreOptions contains configuration options for the MemcachedSessionStore.
+type MemcachedStoreOptions struct {
+	Servers               []string `flag:"memcached-servers" cfg:"memcached_servers"`
+	Username              string   `flag:"memcached-username" cfg:"memcached_username"`
+	Password              string   `flag:"memcached-password" cfg:"memcached_password"`
+	AuthMechanism         string   `flag:"memcached-auth-mechanism" cfg:"memcached_auth_mechanism"`
+	UseTLS                bool     `flag:"memcached-use-tls" cfg:"memcached_use_tls"`
+	CAPath                string   `flag:"memcached-ca-path" cfg:"memcached_ca_path"`
+	InsecureSkipTLSVerify bool     `flag:"memcached-insecure-skip-tls-verify" cfg:"memcached_insecure_skip_tls_verify"`
+	Timeout               int      `flag:"memcached-timeout" cfg:"memcached_timeout"`
+}
+
+// MemcachedAuthSASL and MemcachedAuthASCII are the mechanisms the
+// MemcachedSessionStore authenticates with. SASL authenticates with the PLAIN
+// mechanism over the binary protocol, which is then used for every command.
+// ASCII authenticates with the credentials of a set command over the text
+// protocol.
+const (
+	MemcachedAuthSASL  = "sasl"
+	MemcachedAuthASCII = "ascii"
+)
+
+// PostgresStoreOptions contains configuration options for the PostgresSessionStore.
+type PostgresStoreOptions struct {
+	ConnectionURL   string        `flag:"postgres-connection-url" cfg:"postgres_connection_url"`
+	Table           string        `flag:"postgres-table" cfg:"postgres_table"`
+	CleanupInterval time.Duration `flag:"postgres-cleanup-interval" cfg:"postgres_cleanup_interval"`
+	EncryptionKey   string        `flag:"postgres-encryption-key" cfg:"postgres_encryption_key"`
+}
+
+// AWSKMSProvider, GCPKMSProvider and VaultKMSProvider are the key management
+// services that can be used to envelope encrypt server side sessions.
+const (
+	AWSKMSProvider   = "aws"
+	GCPKMSProvider   = "gcp"
+	VaultKMSProvider = "vault"
+)
+
+// SessionKMSOptions contains configuration options for envelope encrypting
+// sessions held in a persistent session store with an external KMS.
+type SessionKMSOptions struct {
+	Provider        string        `flag:"session-kms-provider" cfg:"session_kms_provider"`
+	KeyID           string        `flag:"session-kms-key-id" cfg:"session_kms_key_id"`
+	Endpoint        string        `flag:"session-kms-endpoint" cfg:"session_kms_endpoint"`
+	AWSRegion       string        `flag:"session-kms-aws-region" cfg:"session_kms_aws_region"`
+	VaultToken      string        `flag:"session-kms-vault-token" cfg:"session_kms_vault_token"`
+	VaultMount      string        `flag:"session-kms-vault-mount" cfg:"session_kms_vault_mount"`
+	DataKeyRotation time.Duration `flag:"session-kms-data-key-rotation" cfg:"session_kms_data_key_rotation"`
 }
 
 func sessionOptionsDefaults() SessionOptions {
 	return SessionOptions{
 		Type: CookieSessionStoreType,
+		Failover: SessionFailoverOptions{
+			FailureThreshold: 3,
+			Cooldown:         30 * time.Second,
+		},
+		Refresh: SessionRefreshOptions{
+			Interval: 30 * time.Second,
+		},
+		Reaper: SessionReaperOptions{
+			BatchSize: 100,
+			Rate:      1000,
+		},
 		Cookie: CookieStoreOptions{
 			Minimal: false,
 		},
+		Redis: RedisStoreOptions{
+			SentinelReplicaMaxStaleness: 5 * time.Second,
+			Compression:                 RedisCompressionNone,
+			CacheTTL:                    10 * time.Second,
+			CacheConsistency:            RedisCacheConsistencyStrict,
+		},
+		Memcached: MemcachedStoreOptions{
+			AuthMechanism: MemcachedAuthSASL,
+			Timeout:       1,
+		},
+		Postgres: PostgresStoreOptions{
+			Table:           "oauth2_proxy_sessions",
+			CleanupInterval: 5 * time.Minute,
+		},
+		KMS: SessionKMSOptions{
+			VaultMount:      "transit",
+			DataKeyRotation: time.Hour,
+		},
 	}
 }
@@ -0,0 +1,85 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SkipAuthRoute is a skip auth route, whose requests must also match all of
+// its conditions to skip authentication
+type SkipAuthRoute struct {
+	// MethodPath is the method=path_regex, method!=path_regex or path_regex
+	// route.
+	MethodPath string
+
+	// Headers are the headers the requests must have.
+	Headers []SkipAuthHeader
+
+	// Networks are the IPs and CIDRs one of which the client IP of the
+	// requests must be in.
+	Networks []string
+
+	// Priority orders the routes, routes with a higher priority being
+	// evaluated first.
+	Priority int
+
+	// DryRun only logs the requests that would skip authentication with the
+	// route, which still require authentication.
+	DryRun bool
+}
+
+// SkipAuthHeader is a header a request must have to skip authentication
+type SkipAuthHeader struct {
+	// Name is the name of the header.
+	Name string
+
+	// Value is the value the header must have, any value being accepted when
+	// empty.
+	Value string
+}
+
+// ParseSkipAuthRoute parses a skip auth route of the form
+// [method=]path_regex, followed by whitespace separated conditions:
+//   - header=Name requires the header, header=Name:value requires its value
+//   - cidr=10.0.0.0/8,192.168.0.1 requires the client IP to be in one of the
+//     networks
+//   - priority=10 evaluates the route before those of a lower priority
+//   - dry-run only logs the requests that would skip authentication
+func ParseSkipAuthRoute(route string) (SkipAuthRoute, error) {
+	fields := strings.Fields(route)
+	if len(fields) == 0 {
+		return SkipAuthRoute{}, fmt.Errorf("skip auth route %q must be of the form [method=]path_regex [conditions]", route)
+	}
+
+	parsed := SkipAuthRoute{MethodPath: fields[0]}
+	for _, condition := range fields[1:] {
+		name, value, _ := strings.Cut(condition, "=")
+		switch name {
+		case "header":
+			headerName, headerValue, _ := strings.Cut(value, ":")
+			if headerName == "" {
+				return SkipAuthRoute{}, fmt.Errorf("skip auth route %q has a header condition without a header name", route)
+			}
+			parsed.Headers = append(parsed.Headers, SkipAuthHeader{Name: headerName, Value: headerValue})
+		case "cidr":
+			for _, network := range strings.Split(value, ",") {
+				if network == "" {
+					return SkipAuthRoute{}, fmt.Errorf("skip auth route %q has an empty cidr condition", route)
+				}
+				parsed.Networks = append(parsed.Networks, network)
+			}
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return SkipAuthRoute{}, fmt.Errorf("skip auth route %q has an invalid priority %q", route, value)
+			}
+			parsed.Priority = priority
+		case "dry-run":
+			parsed.DryRun = true
+		default:
+			return SkipAuthRoute{}, fmt.Errorf("skip auth route %q has unknown condition %q, must be one of \"header\", \"cidr\", \"priority\" or \"dry-run\"", route, name)
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,68 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepUpRoute is a route whose requests require a session authenticated
+// with a stronger authentication than the sign in of other routes
+type StepUpRoute struct {
+	// MethodPath is the method=path_regex, method!=path_regex or path_regex
+	// route.
+	MethodPath string
+
+	// ACRValues are the authentication context class references, one of
+	// which the acr claim of the session must be. They are requested from the
+	// provider with the acr_values parameter.
+	ACRValues []string
+
+	// MFA requires the amr claim of the session to contain "mfa".
+	MFA bool
+
+	// MaxAge is how long ago the auth_time claim of the session may be. It is
+	// requested from the provider with the max_age parameter.
+	MaxAge time.Duration
+}
+
+// ParseStepUpRoute parses a step up route of the form [method=]path_regex,
+// followed by whitespace separated requirements:
+//   - acr=urn:mace:incommon:iap:silver,phr requires one of the acr values
+//   - mfa requires a multi-factor authentication
+//   - max-age=15m requires the user to have authenticated in the last 15
+//     minutes
+func ParseStepUpRoute(route string) (StepUpRoute, error) {
+	fields := strings.Fields(route)
+	if len(fields) == 0 {
+		return StepUpRoute{}, fmt.Errorf("step up route %q must be of the form [method=]path_regex requirements", route)
+	}
+
+	parsed := StepUpRoute{MethodPath: fields[0]}
+	for _, requirement := range fields[1:] {
+		name, value, _ := strings.Cut(requirement, "=")
+		switch name {
+		case "acr":
+			for _, acr := range strings.Split(value, ",") {
+				if acr == "" {
+					return StepUpRoute{}, fmt.Errorf("step up route %q has an empty acr requirement", route)
+				}
+				parsed.ACRValues = append(parsed.ACRValues, acr)
+			}
+		case "mfa":
+			parsed.MFA = true
+		case "max-age":
+			maxAge, err := time.ParseDuration(value)
+			if err != nil || maxAge <= 0 {
+				return StepUpRoute{}, fmt.Errorf("step up route %q has an invalid max-age %q", route, value)
+			}
+			parsed.MaxAge = maxAge
+		default:
+			return StepUpRoute{}, fmt.Errorf("step up route %q has unknown requirement %q, must be one of \"acr\", \"mfa\" or \"max-age\"", route, name)
+		}
+	}
+	if len(parsed.ACRValues) == 0 && !parsed.MFA && parsed.MaxAge == 0 {
+		return StepUpRoute{}, fmt.Errorf("step up route %q has no requirement, must have an \"acr\", \"mfa\" or \"max-age\" requirement", route)
+	}
+	return parsed, nil
+}
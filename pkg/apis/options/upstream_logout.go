@@ -0,0 +1,31 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// UpstreamLogout includes options for the endpoint upstream applications call
+// to revoke the session of the user, so that signing out of the application
+// also ends the session at the proxy. The endpoint is enabled when either of
+// the authentication methods is configured.
+type UpstreamLogout struct {
+	// Secret is the secret applications send as a bearer token to
+	// authenticate to the endpoint.
+	Secret string `flag:"upstream-logout-secret" cfg:"upstream_logout_secret"`
+	// ClientCAFile is the path to the PEM encoded certificate authorities that
+	// issue the client certificates applications authenticate to the endpoint
+	// with. Client certificates are requested when it is set.
+	ClientCAFile string `flag:"upstream-logout-client-ca-file" cfg:"upstream_logout_client_ca_file"`
+}
+
+// Enabled returns whether the upstream logout endpoint is enabled
+func (u UpstreamLogout) Enabled() bool {
+	return u.Secret != "" || u.ClientCAFile != ""
+}
+
+func upstreamLogoutFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("upstreamlogout", pflag.ExitOnError)
+
+	flagSet.String("upstream-logout-secret", "", "the bearer secret upstream applications authenticate with to revoke the session of the user at /oauth2/upstream_logout")
+	flagSet.String("upstream-logout-client-ca-file", "", "path to the CA certificates of the client certificates upstream applications authenticate with at /oauth2/upstream_logout")
+
+	return flagSet
+}
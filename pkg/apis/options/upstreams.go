@@ -8,6 +8,26 @@ const (
 
 	// DefaultUpstreamTimeout is the maximum duration a network dial to a upstream server for a response.
 	DefaultUpstreamTimeout = 30 * time.Second
+
+	// DefaultUpstreamCircuitBreakerCooldown is the default duration an open
+	// circuit breaker waits before probing the upstream server.
+	DefaultUpstreamCircuitBreakerCooldown = 30 * time.Second
+
+	// DefaultUpstreamHealthCheckInterval is the default duration between the
+	// active health checks of the targets of an upstream.
+	DefaultUpstreamHealthCheckInterval = 10 * time.Second
+
+	// DefaultUpstreamHealthCheckTimeout is the default maximum duration of an
+	// active health check.
+	DefaultUpstreamHealthCheckTimeout = 5 * time.Second
+
+	// DefaultUpstreamHealthCheckCooldown is the default duration a target
+	// failing proxied requests is skipped for.
+	DefaultUpstreamHealthCheckCooldown = 30 * time.Second
+
+	// DefaultUpstreamHMACSigningHeader is the default header holding the
+	// HMAC signature of the requests proxied to an upstream server.
+	DefaultUpstreamHMACSigningHeader = "X-Signature"
 )
 
 // UpstreamConfig is a collection of definitions for upstream servers.
@@ -19,6 +39,48 @@ type UpstreamConfig struct {
 	// Upstreams represents the configuration for the upstream servers.
 	// Requests will be proxied to this upstream if the path matches the request path.
 	Upstreams []Upstream `json:"upstreams,omitempty"`
+
+	// TimeoutBudget forwards the time remaining to respond to each request
+	// to the HTTP(S) upstream servers, so that they can stop working on
+	// requests that the client has stopped waiting for.
+	TimeoutBudget *UpstreamTimeoutBudget `json:"timeoutBudget,omitempty"`
+
+	// ResponseHeaders are injected into, or stripped from, the responses of
+	// all HTTP(S) upstream servers.
+	// The ResponseHeaders of an upstream take precedence over these.
+	ResponseHeaders *ResponseHeaders `json:"responseHeaders,omitempty"`
+}
+
+// ResponseHeaders configures the headers of the responses of upstream servers
+// that are passed back to clients, such as security headers.
+// Headers are stripped before headers are injected.
+type ResponseHeaders struct {
+	// Inject are headers set on the responses of the upstream servers,
+	// replacing any header of the same name sent by the upstream server, eg:
+	// `Strict-Transport-Security`, `Content-Security-Policy` or
+	// `X-Frame-Options`. Their values may come from the session of the
+	// request, like those of the InjectResponseHeaders.
+	Inject []Header `json:"inject,omitempty"`
+
+	// Strip are headers removed from the responses of the upstream servers.
+	// They are matched like the DeniedResponseHeaders of an upstream.
+	Strip []string `json:"strip,omitempty"`
+}
+
+// UpstreamTimeoutBudget configures the header holding the time remaining to
+// respond to a request. The budget forwarded is the timeout of the upstream
+// server, or the budget received from a trusted gateway when it is shorter.
+type UpstreamTimeoutBudget struct {
+	// Header is the name of the header holding the remaining budget in
+	// milliseconds, for example `X-Request-Timeout-Ms`.
+	// This value is required to forward the budget.
+	Header string `json:"header,omitempty"`
+
+	// TrustedNetworks are the IPs or CIDR ranges of the gateways whose Header
+	// is honored. The request to the upstream server is cancelled once the
+	// budget they send has passed. The Header of requests from other
+	// addresses is replaced.
+	TrustedNetworks []string `json:"trustedNetworks,omitempty"`
 }
 
 // Upstream represents the configuration for an upstream server.
@@ -91,4 +153,260 @@ type Upstream struct {
 	// Timeout is the maximum duration the server will wait for a response from the upstream server.
 	// Defaults to 30 seconds.
 	Timeout *Duration `json:"timeout,omitempty"`
+
+	// CircuitBreaker stops requests from being proxied to the upstream server
+	// after repeated failures, serving an error page or a fallback upstream
+	// server instead until the upstream server recovers.
+	// Only HTTP(S) and unix socket upstreams support circuit breakers.
+	CircuitBreaker *UpstreamCircuitBreaker `json:"circuitBreaker,omitempty"`
+
+	// AccessTokenAudiences are the audiences the access token of the session
+	// must be issued for to be passed to the upstream server. When set, the
+	// headers holding the access token are removed from the request unless
+	// one of the audiences is in the `aud` or `scp` claim of the token.
+	// Access tokens that are not JWTs cannot be checked and are passed as is.
+	AccessTokenAudiences []string `json:"accessTokenAudiences,omitempty"`
+
+	// Scopes are the OAuth scopes, in addition to the scopes of the provider,
+	// the access token of the session must be granted to proxy requests to
+	// the upstream server. Users whose session lacks them are sent back to
+	// the provider to grant them, and the access token of their session is
+	// replaced with the one granted the scopes.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// TokenExchange exchanges the access token of the session for an access
+	// token issued for the audience of the upstream server before proxying
+	// requests to it, at the token endpoint of the provider of the session.
+	// Only HTTP(S) and unix socket upstreams support token exchange.
+	TokenExchange *UpstreamTokenExchange `json:"tokenExchange,omitempty"`
+
+	// Signing signs the requests proxied to the upstream server, including
+	// WebSocket handshakes, so that the upstream server can check that they
+	// were sent by OAuth2 Proxy.
+	// Only HTTP(S) and unix socket upstreams support signing.
+	Signing *UpstreamSigning `json:"signing,omitempty"`
+
+	// StripProxyCookies removes the session and CSRF cookies of OAuth2 Proxy
+	// from requests proxied to the upstream server, so that the encrypted
+	// session does not reach the upstream server or its logs.
+	// Defaults to true.
+	StripProxyCookies *bool `json:"stripProxyCookies,omitempty"`
+
+	// AllowedResponseHeaders are the only headers of the responses of the
+	// upstream server that are passed back to clients, when set. The
+	// Content-Type, Content-Length and Content-Encoding headers describing
+	// the body are always passed back.
+	// Names are case insensitive, and a name ending in `*` matches any header
+	// starting with it, eg: `X-Debug-*`.
+	AllowedResponseHeaders []string `json:"allowedResponseHeaders,omitempty"`
+
+	// DeniedResponseHeaders are headers removed from the responses of the
+	// upstream server before they are passed back to clients, such as
+	// `Server` or `X-Powered-By`. They are matched like the
+	// AllowedResponseHeaders, and are removed even when allowed.
+	DeniedResponseHeaders []string `json:"deniedResponseHeaders,omitempty"`
+
+	// ResponseHeaders are injected into, or stripped from, the responses of
+	// the upstream server. Injected headers replace the headers of the same
+	// name injected into the responses of all upstream servers.
+	// Only HTTP(S) and unix socket upstreams support response headers.
+	ResponseHeaders *ResponseHeaders `json:"responseHeaders,omitempty"`
+
+	// MaxRequestBodySize is the maximum size in bytes of the bodies of the
+	// requests proxied to the upstream server. Larger requests are rejected
+	// with a 413 Request Entity Too Large response.
+	// Unlimited when zero.
+	MaxRequestBodySize int64 `json:"maxRequestBodySize,omitempty"`
+
+	// MaxResponseBodySize is the maximum size in bytes of the bodies of the
+	// responses of the upstream server. Responses declaring a larger
+	// Content-Length are replaced with a 502 Bad Gateway response, and other
+	// responses are cut off once they reach the limit.
+	// Unlimited when zero.
+	MaxResponseBodySize int64 `json:"maxResponseBodySize,omitempty"`
+
+	// ClientReadTimeout is the maximum duration to read the body of each
+	// request from the client, so that slow clients can not hold requests to
+	// the upstream server open.
+	// Unlimited when not set.
+	ClientReadTimeout *Duration `json:"clientReadTimeout,omitempty"`
+
+	// ClientWriteTimeout is the maximum duration to write each response to
+	// the client. Streamed responses, such as server-sent events, are cut off
+	// once it has passed.
+	// Unlimited when not set.
+	// Only HTTP(S) and unix socket upstreams support body size limits and
+	// client timeouts, and WebSocket connections are not limited by them.
+	ClientWriteTimeout *Duration `json:"clientWriteTimeout,omitempty"`
+
+	// H2C proxies requests to the upstream server over HTTP/2 cleartext,
+	// as needed by gRPC services without TLS.
+	// HTTPS upstream servers are proxied over HTTP/2 whenever they support it.
+	// Only HTTP and unix socket upstreams support H2C.
+	H2C bool `json:"h2c,omitempty"`
+
+	// Targets are the servers requests are balanced across, in proportion to
+	// their weights, instead of the single server of the URI. Targets found
+	// unhealthy by the HealthCheck are skipped until they recover.
+	// Only HTTP(S) and unix socket targets are supported, and all the other
+	// options of the upstream apply to each of them.
+	Targets []UpstreamTarget `json:"targets,omitempty"`
+
+	// HealthCheck configures how unhealthy Targets are detected: actively,
+	// by probing a path of each target, and passively, by counting the
+	// failures of the requests proxied to each target.
+	// Only used with Targets.
+	HealthCheck *UpstreamHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// UpstreamTokenExchange configures the OAuth 2.0 Token Exchange (RFC 8693)
+// of the access token of the session for an access token of the upstream.
+// The exchanged token replaces the access token of the session in the
+// request headers, and is sent in the Authorization header as a bearer
+// token. Exchanged tokens are cached per session and audience until they
+// expire.
+type UpstreamTokenExchange struct {
+	// Audience is the audience the exchanged token is requested for, such
+	// as the client ID or API identifier of the upstream server.
+	// Google providers with API tokens ignore it.
+	Audience string `json:"audience,omitempty"`
+
+	// Scopes are the scopes requested for the exchanged token.
+	// Defaults to the scopes the provider grants by default.
+	// Google providers with API tokens restrict the tokens to them.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// UpstreamSigning configures how the requests proxied to an upstream server
+// are signed. Exactly one of AWSSigV4 or HMAC must be set.
+// The requests are signed as they are sent, once the headers of OAuth2 Proxy
+// have been added, and their bodies are read into memory to be hashed unless
+// their payload is unsigned, which requires the MaxRequestBodySize of the
+// upstream to be set.
+type UpstreamSigning struct {
+	// AWSSigV4 signs the requests with AWS Signature Version 4, for upstream
+	// servers such as Amazon API Gateway, S3 or OpenSearch.
+	AWSSigV4 *UpstreamAWSSigV4Signing `json:"awsSigV4,omitempty"`
+
+	// HMAC signs the requests with an HMAC-SHA256 signature in a header.
+	HMAC *UpstreamHMACSigning `json:"hmac,omitempty"`
+}
+
+// UpstreamAWSSigV4Signing configures the AWS Signature Version 4 of the
+// requests proxied to an upstream server.
+// The host the requests are sent to is signed, so PassHostHeader should be
+// false unless the requests are made to the host of the AWS service.
+type UpstreamAWSSigV4Signing struct {
+	// Region is the AWS region of the service, eg: `us-east-1`.
+	// This value is required.
+	Region string `json:"region,omitempty"`
+
+	// Service is the signing name of the AWS service, eg: `execute-api` for
+	// API Gateway, `s3` or `es` for OpenSearch.
+	// This value is required.
+	Service string `json:"service,omitempty"`
+
+	// AccessKeyID is the ID of the access key the requests are signed with.
+	// The credentials are read from the AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables when
+	// neither AccessKeyID nor SecretAccessKey are set.
+	AccessKeyID *SecretSource `json:"accessKeyID,omitempty"`
+
+	// SecretAccessKey is the secret of the access key the requests are
+	// signed with. Required with AccessKeyID.
+	SecretAccessKey *SecretSource `json:"secretAccessKey,omitempty"`
+
+	// SessionToken is the session token of temporary credentials.
+	// The credentials are loaded once on startup, so temporary credentials
+	// are not renewed.
+	SessionToken *SecretSource `json:"sessionToken,omitempty"`
+
+	// UnsignedPayload leaves the bodies of the requests unsigned, so that
+	// they are streamed to the upstream server instead of being read into
+	// memory. Only some services, such as S3, accept unsigned payloads.
+	UnsignedPayload bool `json:"unsignedPayload,omitempty"`
+}
+
+// UpstreamHMACSigning configures the HMAC signature of the requests proxied
+// to an upstream server. The signature is sent as `t=<timestamp>,v1=<hex>`,
+// where the timestamp is the Unix time the request was signed at and v1 is
+// the hex encoded HMAC-SHA256 of the timestamp, the method, the request URI,
+// the host and the hex encoded SHA-256 hash of the body, joined by newlines.
+type UpstreamHMACSigning struct {
+	// Key is the key of the HMAC.
+	// This value is required.
+	Key *SecretSource `json:"key,omitempty"`
+
+	// Header is the name of the header holding the signature.
+	// Defaults to `X-Signature`.
+	Header string `json:"header,omitempty"`
+}
+
+// UpstreamTarget is one of the servers an upstream balances requests across.
+type UpstreamTarget struct {
+	// URI of the target server, eg: http://10.0.0.1:8080 or
+	// unix:///var/run/app.sock
+	URI string `json:"uri,omitempty"`
+
+	// Weight of the target relative to the other targets of the upstream.
+	// A target with a weight of 2 receives twice as many requests as a target
+	// with a weight of 1.
+	// Defaults to 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// UpstreamHealthCheck configures the health checks of the targets of an
+// upstream. Requests are only proxied to healthy targets, and receive a 503
+// error page when no target is healthy.
+type UpstreamHealthCheck struct {
+	// Path is requested from each target every Interval. A target is
+	// unhealthy while this request fails or gets a response other than 2xx
+	// or 3xx. Active health checks are disabled when empty.
+	Path string `json:"path,omitempty"`
+
+	// Interval is the duration between active health checks.
+	// Defaults to 10 seconds.
+	Interval *Duration `json:"interval,omitempty"`
+
+	// Timeout is the maximum duration of an active health check.
+	// Defaults to 5 seconds.
+	Timeout *Duration `json:"timeout,omitempty"`
+
+	// FailureThreshold is the number of consecutive failures of the requests
+	// proxied to a target, where a failure is an error connecting to the
+	// target or a 502, 503 or 504 response from it, after which the target
+	// is skipped for the Cooldown, or until its active health check passes.
+	// Passive failure detection is disabled when zero.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// Cooldown is the duration a target is skipped for after reaching the
+	// FailureThreshold. A single failure skips the target again once the
+	// Cooldown has passed, until a request to it succeeds.
+	// Defaults to 30 seconds.
+	Cooldown *Duration `json:"cooldown,omitempty"`
+}
+
+// UpstreamCircuitBreaker configures the circuit breaker of an upstream server.
+// The circuit opens after FailureThreshold consecutive failures, where a
+// failure is an error connecting to the upstream server or a 502, 503 or 504
+// response from it. Once the Cooldown has passed, a single request is proxied
+// to the upstream server to probe it, closing the circuit if it succeeds.
+type UpstreamCircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that open the
+	// circuit. The circuit breaker is disabled when zero.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// Cooldown is the duration the circuit stays open before the upstream
+	// server is probed.
+	// Defaults to 30 seconds.
+	Cooldown *Duration `json:"cooldown,omitempty"`
+
+	// FallbackURI is the URI of an HTTP(S) server that requests are proxied to
+	// while the circuit is open, with the same options as the upstream server.
+	FallbackURI string `json:"fallbackURI,omitempty"`
+
+	// ErrorPage is the path to a static HTML page served with a 503 response
+	// while the circuit is open, when no FallbackURI is set.
+	// Defaults to the standard error page.
+	ErrorPage string `json:"errorPage,omitempty"`
 }
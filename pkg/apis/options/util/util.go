@@ -1,22 +1,38 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"os"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/secrets"
 )
 
 // GetSecretValue returns the value of the Secret from its source
 func GetSecretValue(source *options.SecretSource) ([]byte, error) {
+	if countSecretSources(source) != 1 {
+		return nil, errors.New("secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef")
+	}
+
 	switch {
-	case len(source.Value) > 0 && source.FromEnv == "" && source.FromFile == "":
+	case len(source.Value) > 0:
 		return source.Value, nil
-	case len(source.Value) == 0 && source.FromEnv != "" && source.FromFile == "":
+	case source.FromEnv != "":
 		return []byte(os.Getenv(source.FromEnv)), nil
-	case len(source.Value) == 0 && source.FromEnv == "" && source.FromFile != "":
+	case source.FromFile != "":
 		return os.ReadFile(source.FromFile)
 	default:
-		return nil, errors.New("secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile")
+		return secrets.Get(context.Background(), source.FromRef)
+	}
+}
+
+func countSecretSources(source *options.SecretSource) int {
+	count := 0
+	for _, set := range []bool{len(source.Value) > 0, source.FromEnv != "", source.FromFile != "", source.FromRef != ""} {
+		if set {
+			count++
+		}
 	}
+	return count
 }
@@ -63,7 +63,7 @@ var _ = Describe("GetSecretValue", func() {
 
 	It("with no source set", func() {
 		value, err := GetSecretValue(&options.SecretSource{})
-		Expect(err).To(MatchError("secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile"))
+		Expect(err).To(MatchError("secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef"))
 		Expect(value).To(BeEmpty())
 	})
 
@@ -72,7 +72,7 @@ var _ = Describe("GetSecretValue", func() {
 			FromEnv:  secretEnvKey,
 			FromFile: path.Join(fileDir, "secret-file"),
 		})
-		Expect(err).To(MatchError("secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile"))
+		Expect(err).To(MatchError("secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef"))
 		Expect(value).To(BeEmpty())
 	})
 })
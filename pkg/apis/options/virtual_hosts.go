@@ -0,0 +1,34 @@
+package options
+
+// VirtualHosts is a collection of virtual hosts.
+type VirtualHosts []VirtualHost
+
+// VirtualHost scopes configuration to the requests made to a set of hosts,
+// so that a single proxy can front several applications that each sign in
+// with their own provider and are served by their own upstreams.
+type VirtualHost struct {
+	// Hosts are the request hosts served by the virtual host.
+	// A leading `.` or `*.` matches all subdomains of the host, and a port may be
+	// included to only match requests made to that port.
+	// Requests are served by the first virtual host with a matching host.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// ProviderID is the ID of the provider that users of the virtual host sign
+	// in with. Sessions created by any other provider are not accepted by the
+	// virtual host.
+	// When empty, users may sign in with any provider.
+	ProviderID string `json:"providerID,omitempty"`
+
+	// Upstreams are the upstream servers that authenticated requests to the
+	// virtual host are proxied to.
+	// When empty, the global upstream configuration is used.
+	Upstreams UpstreamConfig `json:"upstreams,omitempty"`
+
+	// CookieDomain is the domain that cookies are set on for requests to the
+	// virtual host, in place of the global cookie domains.
+	CookieDomain string `json:"cookieDomain,omitempty"`
+
+	// AllowedGroups restricts access to the virtual host to users that are a
+	// member of at least one of the groups.
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+}
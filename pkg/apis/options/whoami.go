@@ -0,0 +1,22 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// WhoAmI includes options for the debugging endpoint rendering the decoded
+// session of the user, such as their claims and groups.
+type WhoAmI struct {
+	// Enabled serves the session of the user at /oauth2/whoami.
+	Enabled bool `flag:"whoami-enabled" cfg:"whoami_enabled"`
+	// RedactClaims are the claims whose values are replaced in the rendered
+	// tokens, such as personal data that should not show in screenshots.
+	RedactClaims []string `flag:"whoami-redact-claim" cfg:"whoami_redact_claims"`
+}
+
+func whoAmIFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("whoami", pflag.ExitOnError)
+
+	flagSet.Bool("whoami-enabled", false, "serve the decoded session of the user, including the claims of their tokens, at /oauth2/whoami for debugging")
+	flagSet.StringSlice("whoami-redact-claim", []string{}, "claims whose values are redacted at /oauth2/whoami (may be given multiple times)")
+
+	return flagSet
+}
@@ -0,0 +1,110 @@
+package sessions
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionLZ4, CompressionZstd and CompressionBrotli are the algorithms
+// sessions can be compressed with before they are encrypted
+const (
+	CompressionLZ4    = "lz4"
+	CompressionZstd   = "zstd"
+	CompressionBrotli = "brotli"
+)
+
+var (
+	// lz4Magic and zstdMagic start the LZ4 and zstd frames, so that the
+	// algorithm of compressed sessions can be told apart. Brotli streams have
+	// no magic number, and are assumed for any other value.
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// The zstd encoder and decoder are safe for concurrent use, and are
+	// created once as they allocate their buffers up front. Sessions are
+	// small, so the encoder is configured to use less memory.
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithLowerEncoderMem(true))
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil)
+	})
+)
+
+// compress compresses the payload with the algorithm, LZ4 when empty
+func compress(algorithm string, payload []byte) ([]byte, error) {
+	switch algorithm {
+	case "", CompressionLZ4:
+		return lz4Compress(payload)
+	case CompressionZstd:
+		return zstdCompress(payload)
+	case CompressionBrotli:
+		return brotliCompress(payload)
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+	}
+}
+
+// decompress decompresses a payload compressed with any of the algorithms,
+// so that sessions can still be loaded once the algorithm is changed
+func decompress(compressed []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(compressed, lz4Magic):
+		return lz4Decompress(compressed)
+	case bytes.HasPrefix(compressed, zstdMagic):
+		return zstdDecompress(compressed)
+	default:
+		return brotliDecompress(compressed)
+	}
+}
+
+// zstdCompress compresses with zstd, which compresses better than LZ4 at a
+// similar speed
+func zstdCompress(payload []byte) ([]byte, error) {
+	encoder, err := zstdEncoder()
+	if err != nil {
+		return nil, fmt.Errorf("error creating zstd encoder: %w", err)
+	}
+	return encoder.EncodeAll(payload, nil), nil
+}
+
+// zstdDecompress decompresses with zstd
+func zstdDecompress(compressed []byte) ([]byte, error) {
+	decoder, err := zstdDecoder()
+	if err != nil {
+		return nil, fmt.Errorf("error creating zstd decoder: %w", err)
+	}
+	payload, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing zstd payload: %w", err)
+	}
+	return payload, nil
+}
+
+// brotliCompress compresses with Brotli, which compresses best but is the
+// slowest to compress
+func brotliCompress(payload []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := brotli.NewWriterLevel(buf, brotli.DefaultCompression)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, fmt.Errorf("error writing brotli stream to buffer: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error closing brotli writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// brotliDecompress decompresses with Brotli
+func brotliDecompress(compressed []byte) ([]byte, error) {
+	payload, err := io.ReadAll(brotli.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading brotli stream: %w", err)
+	}
+	return payload, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,6 +16,113 @@ type SessionStore interface {
 	VerifyConnection(ctx context.Context) error
 }
 
+// RefreshSessionFunc refreshes the session with the provider, returning true
+// if the session was refreshed
+type RefreshSessionFunc func(ctx context.Context, s *SessionState) (bool, error)
+
+// BackgroundRefresher is implemented by session stores that can refresh
+// sessions before they expire, without waiting for a request
+type BackgroundRefresher interface {
+	// RefreshInBackground refreshes sessions that are about to expire until
+	// the context is cancelled
+	RefreshInBackground(ctx context.Context, refresh RefreshSessionFunc) error
+}
+
+// SessionReaper is implemented by session stores that can delete the
+// expired and orphaned sessions they hold, which they do not expire natively
+type SessionReaper interface {
+	// ReapSessions deletes the expired and orphaned sessions held by the
+	// store, in batches
+	ReapSessions(ctx context.Context) (ReapResult, error)
+}
+
+// ReapResult is the number of keys a SessionReaper deleted
+type ReapResult struct {
+	// Expired is the number of expired keys deleted
+	Expired int
+	// Orphaned is the number of keys deleted that belong to sessions that no
+	// longer exist
+	Orphaned int
+}
+
+// SessionArchiver is implemented by session stores that can export the
+// sessions they hold as they are stored, and import them again, so that the
+// sessions survive the maintenance of the store without their users being
+// signed out
+type SessionArchiver interface {
+	// ExportSessions passes each session held by the store to export, and
+	// returns the number of sessions exported
+	ExportSessions(ctx context.Context, export func(ArchivedSession) error) (int, error)
+	// ImportSessions saves the sessions read until read returns io.EOF, and
+	// returns the number of sessions imported
+	ImportSessions(ctx context.Context, read func() (*ArchivedSession, error)) (int, error)
+}
+
+// ArchivedSession is a session of a session store as it is stored, which
+// remains encrypted with the secret held in the ticket of its cookie
+type ArchivedSession struct {
+	ID    string `json:"id"`
+	Value []byte `json:"value"`
+	// Index is the index of the session for the admin API, if it has one
+	Index []byte `json:"index,omitempty"`
+}
+
+// SessionInfo is the user of a session held by a session store, without its
+// tokens
+type SessionInfo struct {
+	ID                string     `json:"id"`
+	Email             string     `json:"email,omitempty"`
+	User              string     `json:"user,omitempty"`
+	PreferredUsername string     `json:"preferredUsername,omitempty"`
+	Groups            []string   `json:"groups,omitempty"`
+	CreatedAt         *time.Time `json:"createdAt,omitempty"`
+	ExpiresOn         *time.Time `json:"expiresOn,omitempty"`
+}
+
+// SessionFilter selects sessions by their user. Fields that are empty match
+// every session.
+type SessionFilter struct {
+	Email string
+	User  string
+	Group string
+}
+
+// Matches returns whether the session matches every field of the filter
+// that is set. Emails are matched regardless of case.
+func (f SessionFilter) Matches(info SessionInfo) bool {
+	if f.Email != "" && !strings.EqualFold(f.Email, info.Email) {
+		return false
+	}
+	if f.User != "" && f.User != info.User {
+		return false
+	}
+	if f.Group != "" {
+		for _, group := range info.Groups {
+			if group == f.Group {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SessionAdmin is implemented by session stores that can list and revoke
+// the sessions they hold, for the admin API
+type SessionAdmin interface {
+	// ListSessions returns the sessions held by the store matching the
+	// filter
+	ListSessions(ctx context.Context, filter SessionFilter) ([]SessionInfo, error)
+	// GetSession returns the session with the ID, or ErrSessionNotFound
+	GetSession(ctx context.Context, id string) (*SessionInfo, error)
+	// RevokeSession removes the session with the ID from the store, so that
+	// its cookie is no longer valid, or returns ErrSessionNotFound
+	RevokeSession(ctx context.Context, id string) error
+}
+
+// ErrSessionNotFound is returned by a SessionAdmin for unknown sessions
+var ErrSessionNotFound = errors.New("session not found")
+
 var ErrLockNotObtained = errors.New("lock: not obtained")
 var ErrNotLocked = errors.New("tried to release not existing lock")
 
@@ -35,3 +143,20 @@ type Lock interface {
 	// Otherwise it will return ErrNotLocked
 	Release(ctx context.Context) error
 }
+
+type consistentReadKey struct{}
+
+// WithConsistentRead returns a copy of the context for loading sessions that
+// must see their latest value, such as sessions being validated after a
+// refresh or revoked. Stores reading from replicas or caches read them from
+// their primary instead.
+func WithConsistentRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, true)
+}
+
+// IsConsistentRead returns whether sessions loaded with the context must see
+// their latest value
+func IsConsistentRead(ctx context.Context) bool {
+	consistent, _ := ctx.Value(consistentReadKey{}).(bool)
+	return consistent
+}
@@ -29,6 +29,25 @@ type SessionState struct {
 	Groups            []string `msgpack:"g,omitempty"`
 	PreferredUsername string   `msgpack:"pu,omitempty"`
 
+	// ACR, AMR and AuthTime are the authentication context class reference,
+	// the authentication methods and the time of the sign in, from the ID
+	// token, that step up routes require
+	ACR      string     `msgpack:"acr,omitempty"`
+	AMR      []string   `msgpack:"amr,omitempty"`
+	AuthTime *time.Time `msgpack:"aut,omitempty"`
+
+	// Scopes are the scopes the access token was granted, through incremental
+	// authorization, in addition to the scopes of the provider
+	Scopes []string `msgpack:"sc,omitempty"`
+
+	// Attributes are the provider specific claims of the ID token, such as
+	// the custom attributes of Cognito users, that may be injected into headers
+	Attributes map[string]string `msgpack:"atr,omitempty"`
+
+	// ProviderID is the ID of the provider the session was created with, so
+	// that it is refreshed and validated by the same provider
+	ProviderID string `msgpack:"pid,omitempty"`
+
 	// Internal helpers, not serialized
 	Clock clock.Clock `msgpack:"-"`
 	Lock  Lock        `msgpack:"-"`
@@ -120,6 +139,9 @@ func (s *SessionState) String() string {
 	if len(s.Groups) > 0 {
 		o += fmt.Sprintf(" groups:%v", s.Groups)
 	}
+	if s.ProviderID != "" {
+		o += fmt.Sprintf(" provider:%s", s.ProviderID)
+	}
 	return o + "}"
 }
 
@@ -149,6 +171,9 @@ func (s *SessionState) GetClaim(claim string) []string {
 	case "preferred_username":
 		return []string{s.PreferredUsername}
 	default:
+		if value, ok := s.Attributes[claim]; ok {
+			return []string{value}
+		}
 		return []string{}
 	}
 }
@@ -160,35 +185,62 @@ func (s *SessionState) CheckNonce(hashed string) bool {
 
 // EncodeSessionState returns an encrypted, lz4 compressed, MessagePack encoded session
 func (s *SessionState) EncodeSessionState(c encryption.Cipher, compress bool) ([]byte, error) {
+	if compress {
+		encoded, _, err := s.EncodeCompressedSessionState(c, CompressionLZ4)
+		return encoded, err
+	}
+
 	packed, err := msgpack.Marshal(s)
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling session state to msgpack: %w", err)
 	}
+	// Scrub the plaintext tokens once encrypted
+	defer encryption.Zero(packed)
+	return c.Encrypt(packed)
+}
 
-	if !compress {
-		return c.Encrypt(packed)
+// EncodeCompressedSessionState returns an encrypted, compressed, MessagePack
+// encoded session along with its compression ratio: the size of the
+// MessagePack encoding over the compressed size. The algorithm is one of
+// CompressionLZ4, CompressionZstd or CompressionBrotli, LZ4 when empty.
+func (s *SessionState) EncodeCompressedSessionState(c encryption.Cipher, algorithm string) ([]byte, float64, error) {
+	packed, err := msgpack.Marshal(s)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error marshalling session state to msgpack: %w", err)
+	}
+	// Scrub the plaintext tokens once encrypted
+	defer encryption.Zero(packed)
+
+	compressed, err := compress(algorithm, packed)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer encryption.Zero(compressed)
 
-	compressed, err := lz4Compress(packed)
+	encoded, err := c.Encrypt(compressed)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return c.Encrypt(compressed)
+	return encoded, float64(len(packed)) / float64(len(compressed)), nil
 }
 
-// DecodeSessionState decodes a LZ4 compressed MessagePack into a Session State
+// DecodeSessionState decodes a MessagePack, compressed with any of the
+// compression algorithms when compressed is set, into a Session State
 func DecodeSessionState(data []byte, c encryption.Cipher, compressed bool) (*SessionState, error) {
 	decrypted, err := c.Decrypt(data)
 	if err != nil {
 		return nil, fmt.Errorf("error decrypting the session state: %w", err)
 	}
+	// Scrub the plaintext tokens once unmarshalled
+	defer encryption.Zero(decrypted)
 
 	packed := decrypted
 	if compressed {
-		packed, err = lz4Decompress(decrypted)
+		packed, err = decompress(decrypted)
 		if err != nil {
 			return nil, err
 		}
+		defer encryption.Zero(packed)
 	}
 
 	var ss SessionState
@@ -292,3 +292,35 @@ func compareSessionStates(t *testing.T, expected *SessionState, actual *SessionS
 	act.ExpiresOn = nil
 	assert.Equal(t, exp, act)
 }
+
+func TestEncodeCompressedSessionState(t *testing.T) {
+	ss := &SessionState{
+		Email:        "user@domain.com",
+		User:         "just-user",
+		AccessToken:  "token1234",
+		IDToken:      "rawtoken1234",
+		RefreshToken: "refresh4321",
+		Groups:       []string{"group-a", "group-b", "group-c", "group-d"},
+	}
+
+	c, err := encryption.NewGCMCipher([]byte("0123456789abcdefghijklmnopqrstuv"))
+	require.NoError(t, err)
+
+	for _, algorithm := range []string{CompressionLZ4, CompressionZstd, CompressionBrotli} {
+		t.Run(algorithm, func(t *testing.T) {
+			encoded, ratio, err := ss.EncodeCompressedSessionState(c, algorithm)
+			require.NoError(t, err)
+			assert.Greater(t, ratio, 0.0)
+
+			// Compressed sessions are decoded whatever their algorithm
+			decoded, err := DecodeSessionState(encoded, c, true)
+			require.NoError(t, err)
+			compareSessionStates(t, ss, decoded)
+		})
+	}
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		_, _, err := ss.EncodeCompressedSessionState(c, "zip")
+		assert.EqualError(t, err, `unknown compression algorithm "zip"`)
+	})
+}
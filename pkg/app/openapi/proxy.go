@@ -0,0 +1,580 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/version"
+)
+
+const (
+	// Path is the path, under the proxy prefix, the document is served from
+	Path = "/openapi.json"
+
+	cookieScheme = "sessionCookie"
+	basicScheme  = "basicAuth"
+	bearerScheme = "bearerToken"
+
+	userInfoSchema = "UserInfo"
+	whoAmISchema   = "WhoAmI"
+	readySchema    = "Readiness"
+
+	tagAuthentication = "authentication"
+	tagSession        = "session"
+	tagHealth         = "health"
+	tagOIDCIssuer     = "oidc issuer"
+)
+
+// NewProxyDocument describes the endpoints served by the proxy itself
+// under the configured proxy prefix, reflecting the active configuration
+func NewProxyDocument(opts *options.Options) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "OAuth2 Proxy",
+			Description: "Endpoints served by OAuth2 Proxy. All other paths are proxied to the upstreams once authenticated.",
+			Version:     version.VERSION,
+		},
+		Components: Components{
+			Schemas:         proxySchemas(),
+			SecuritySchemes: securitySchemes(opts),
+		},
+	}
+	if server := serverURL(opts.RawRedirectURL); server != "" {
+		doc.Servers = []Server{{URL: server}}
+	}
+
+	prefix := opts.ProxyPrefix
+	security := securityRequirements(opts)
+
+	doc.AddOperation(prefix+"/sign_in", http.MethodGet, signInOperation(opts))
+	if opts.HtpasswdEnabled() {
+		doc.AddOperation(prefix+"/sign_in", http.MethodPost, basicSignInOperation())
+	}
+	doc.AddOperation(prefix+"/start", http.MethodGet, startOperation(opts))
+	doc.AddOperation(prefix+"/callback", http.MethodGet, callbackOperation())
+	doc.AddOperation(prefix+"/sign_out", http.MethodGet, signOutOperation())
+	doc.AddOperation(prefix+"/auth", http.MethodGet, authOperation(security))
+	doc.AddOperation(prefix+"/userinfo", http.MethodGet, userInfoOperation(security))
+	doc.AddOperation(prefix+Path, http.MethodGet, openAPIOperation())
+	doc.AddOperation(prefix+"/ready", http.MethodGet, readyOperation())
+
+	if opts.WhoAmI.Enabled {
+		doc.AddOperation(prefix+"/whoami", http.MethodGet, whoAmIOperation(security))
+	}
+
+	if opts.UpstreamLogout.Enabled() {
+		doc.AddOperation(prefix+"/upstream_logout", http.MethodPost, upstreamLogoutOperation())
+	}
+
+	if opts.Handoff.Secret != "" {
+		if len(opts.Handoff.AllowedDomains) > 0 {
+			doc.AddOperation(prefix+"/handoff", http.MethodGet, handoffOperation(security))
+		}
+		doc.AddOperation(prefix+"/handoff/redeem", http.MethodGet, handoffRedeemOperation())
+	}
+
+	if opts.OIDCIssuer.Enabled() {
+		addOIDCIssuerOperations(doc, prefix+"/oidc", security)
+	}
+
+	if opts.PingPath != "" {
+		doc.AddOperation(opts.PingPath, http.MethodGet, &Operation{
+			OperationID: "ping",
+			Summary:     "Liveness check",
+			Tags:        []string{tagHealth},
+			Responses: map[string]Response{
+				"200": textResponse("The proxy is running"),
+			},
+		})
+	}
+	if opts.ReadyPath != "" {
+		doc.AddOperation(opts.ReadyPath, http.MethodGet, &Operation{
+			OperationID: "ready",
+			Summary:     "Readiness check",
+			Description: "Checks the connection to the session store.",
+			Tags:        []string{tagHealth},
+			Responses: map[string]Response{
+				"200": textResponse("The proxy and its session store are ready"),
+				"500": textResponse("The session store is not connected"),
+			},
+		})
+	}
+	return doc
+}
+
+func signInOperation(opts *options.Options) *Operation {
+	op := &Operation{
+		OperationID: "signIn",
+		Summary:     "Sign in page",
+		Description: "Clears any existing session and renders the sign in page.",
+		Tags:        []string{tagAuthentication},
+		Parameters:  []Parameter{redirectParameter()},
+		Responses: map[string]Response{
+			"200": htmlResponse("The sign in page"),
+		},
+	}
+	if opts.SkipProviderButton {
+		op.Description = "Clears any existing session and redirects to the provider to sign in."
+		op.Responses = map[string]Response{
+			"302": redirectResponse("Redirect to the provider's login page"),
+		}
+	}
+	return op
+}
+
+func basicSignInOperation() *Operation {
+	return &Operation{
+		OperationID: "signInWithPassword",
+		Summary:     "Sign in with a username and password from the htpasswd file",
+		Tags:        []string{tagAuthentication},
+		Parameters:  []Parameter{redirectParameter()},
+		RequestBody: &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/x-www-form-urlencoded": {Schema: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"username": {Type: "string"},
+						"password": {Type: "string", Format: "password"},
+					},
+					Required: []string{"username", "password"},
+				}},
+			},
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Signed in, redirecting to the requested URL"),
+			"400": htmlResponse("No username was given"),
+			"401": htmlResponse("Invalid credentials, the sign in page is shown again"),
+		},
+	}
+}
+
+func startOperation(opts *options.Options) *Operation {
+	params := []Parameter{redirectParameter()}
+	if len(opts.Providers) > 0 {
+		for _, p := range opts.Providers[0].LoginURLParameters {
+			if len(p.Allow) == 0 {
+				continue
+			}
+			params = append(params, Parameter{
+				Name:        p.Name,
+				In:          "query",
+				Description: "Overrides the value passed to the provider's login URL.",
+				Schema:      loginURLParameterSchema(p),
+			})
+		}
+	}
+
+	responses := map[string]Response{
+		"302": redirectResponse("Redirect to the provider's login page"),
+		"500": htmlResponse("The flow could not be started"),
+	}
+	if len(opts.Providers) > 1 {
+		schema := &Schema{Type: "string"}
+		for _, p := range opts.Providers {
+			schema.Enum = append(schema.Enum, p.ID)
+		}
+		params = append(params, Parameter{
+			Name:        "provider",
+			In:          "query",
+			Description: "The ID of the provider to sign in with.",
+			Schema:      schema,
+		})
+		responses["400"] = htmlResponse("An unknown provider was requested")
+	}
+
+	return &Operation{
+		OperationID: "start",
+		Summary:     "Start the OAuth flow",
+		Tags:        []string{tagAuthentication},
+		Parameters:  params,
+		Responses:   responses,
+	}
+}
+
+// loginURLParameterSchema restricts a login URL parameter to its allowed
+// values, when every allow rule is a fixed value
+func loginURLParameterSchema(p options.LoginURLParameter) *Schema {
+	schema := &Schema{Type: "string"}
+	for _, rule := range p.Allow {
+		if rule.Value == nil {
+			return &Schema{Type: "string"}
+		}
+		schema.Enum = append(schema.Enum, *rule.Value)
+	}
+	return schema
+}
+
+func callbackOperation() *Operation {
+	return &Operation{
+		OperationID: "callback",
+		Summary:     "OAuth callback",
+		Description: "Receives the authorization code from the provider, redeems it and creates the session.",
+		Tags:        []string{tagAuthentication},
+		Parameters: []Parameter{
+			{Name: "code", In: "query", Description: "The authorization code", Schema: &Schema{Type: "string"}},
+			{Name: "state", In: "query", Required: true, Description: "The state sent to the provider", Schema: &Schema{Type: "string"}},
+			{Name: "error", In: "query", Description: "The error returned by the provider", Schema: &Schema{Type: "string"}},
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Signed in, redirecting to the requested URL"),
+			"403": htmlResponse("The state is invalid or the user is not authorized"),
+			"500": htmlResponse("The code could not be redeemed"),
+		},
+	}
+}
+
+func handoffOperation(security []SecurityRequirement) *Operation {
+	return &Operation{
+		OperationID: "handoff",
+		Summary:     "Hand off the session",
+		Description: "Mints a one-time code carrying the session and redirects to a sibling proxy to redeem it.",
+		Tags:        []string{tagSession},
+		Parameters: []Parameter{
+			{
+				Name:        "rd",
+				In:          "query",
+				Required:    true,
+				Description: "The handoff redeem URL of the sibling proxy. It must be on an allowed handoff domain.",
+				Schema:      &Schema{Type: "string"},
+			},
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Redirect to the sibling proxy with the handoff code, or to the sign in page"),
+			"400": htmlResponse("The sibling proxy is not on an allowed handoff domain"),
+			"403": htmlResponse("The user is not authorized"),
+		},
+		Security: security,
+	}
+}
+
+func handoffRedeemOperation() *Operation {
+	return &Operation{
+		OperationID: "handoffRedeem",
+		Summary:     "Redeem a handoff code",
+		Description: "Creates a session from a handoff code minted by a sibling proxy.",
+		Tags:        []string{tagAuthentication},
+		Parameters: []Parameter{
+			{Name: "code", In: "query", Required: true, Description: "The handoff code", Schema: &Schema{Type: "string"}},
+			redirectParameter(),
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Signed in, redirecting to the requested URL"),
+			"403": htmlResponse("The code is invalid, expired or already redeemed, or the user is not authorized"),
+		},
+	}
+}
+
+// addOIDCIssuerOperations describes the endpoints of the OIDC issuer for
+// upstream applications
+func addOIDCIssuerOperations(doc *Document, issuer string, security []SecurityRequirement) {
+	doc.AddOperation(issuer+"/.well-known/openid-configuration", http.MethodGet, &Operation{
+		OperationID: "oidcDiscovery",
+		Summary:     "OIDC issuer discovery document",
+		Tags:        []string{tagOIDCIssuer},
+		Responses: map[string]Response{
+			"200": jsonObjectResponse("The OpenID Connect discovery document"),
+		},
+	})
+	doc.AddOperation(issuer+"/jwks", http.MethodGet, &Operation{
+		OperationID: "oidcJWKS",
+		Summary:     "OIDC issuer signing keys",
+		Tags:        []string{tagOIDCIssuer},
+		Responses: map[string]Response{
+			"200": jsonObjectResponse("The JSON Web Key Set the tokens are signed with"),
+		},
+	})
+	doc.AddOperation(issuer+"/authorize", http.MethodGet, &Operation{
+		OperationID: "oidcAuthorize",
+		Summary:     "OIDC issuer authorization endpoint",
+		Description: "Signs the user in to an upstream application with their session, redirecting back to the application with an authorization code.",
+		Tags:        []string{tagOIDCIssuer},
+		Parameters: []Parameter{
+			{Name: "client_id", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+			{Name: "redirect_uri", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+			{Name: "response_type", In: "query", Required: true, Schema: &Schema{Type: "string", Enum: []string{"code"}}},
+			{Name: "scope", In: "query", Required: true, Description: "Must include openid.", Schema: &Schema{Type: "string"}},
+			{Name: "state", In: "query", Schema: &Schema{Type: "string"}},
+			{Name: "nonce", In: "query", Schema: &Schema{Type: "string"}},
+			{Name: "prompt", In: "query", Schema: &Schema{Type: "string", Enum: []string{"none"}}},
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Redirect to the application with an authorization code or an error, or to the sign in page"),
+			"400": htmlResponse("The client or redirect URI are not allowed"),
+		},
+		Security: security,
+	})
+	doc.AddOperation(issuer+"/token", http.MethodPost, &Operation{
+		OperationID: "oidcToken",
+		Summary:     "OIDC issuer token endpoint",
+		Description: "Redeems an authorization code for an ID token and an access token. The client authenticates with basic auth or the client_id and client_secret form parameters.",
+		Tags:        []string{tagOIDCIssuer},
+		Responses: map[string]Response{
+			"200": jsonObjectResponse("The tokens"),
+			"400": jsonObjectResponse("The authorization code is invalid, expired or already redeemed"),
+			"401": jsonObjectResponse("The client is not authenticated"),
+		},
+	})
+	doc.AddOperation(issuer+"/userinfo", http.MethodGet, &Operation{
+		OperationID: "oidcUserInfo",
+		Summary:     "OIDC issuer userinfo endpoint",
+		Description: "Returns the identity of the user an access token of the issuer was minted for.",
+		Tags:        []string{tagOIDCIssuer},
+		Responses: map[string]Response{
+			"200": jsonObjectResponse("The claims of the user"),
+			"401": jsonObjectResponse("The access token is invalid or expired"),
+		},
+	})
+}
+
+func signOutOperation() *Operation {
+	return &Operation{
+		OperationID: "signOut",
+		Summary:     "Sign out",
+		Description: "Clears the session cookie. The user remains signed in with the provider.",
+		Tags:        []string{tagSession},
+		Parameters: []Parameter{
+			redirectParameter(),
+			{
+				Name:        "X-Auth-Request-Redirect",
+				In:          "header",
+				Description: "The URL to redirect to once signed out, if rd is not set.",
+				Schema:      &Schema{Type: "string"},
+			},
+		},
+		Responses: map[string]Response{
+			"302": redirectResponse("Signed out, redirecting to the requested URL"),
+		},
+	}
+}
+
+func authOperation(security []SecurityRequirement) *Operation {
+	allowed := func(name, description string) Parameter {
+		return Parameter{
+			Name:        name,
+			In:          "query",
+			Description: description,
+			Schema:      &Schema{Type: "string"},
+		}
+	}
+
+	return &Operation{
+		OperationID: "auth",
+		Summary:     "Check authentication",
+		Description: "Checks the request is authenticated, for use with auth subrequests from a reverse proxy.",
+		Tags:        []string{tagSession},
+		Parameters: []Parameter{
+			allowed("allowed_groups", "Comma separated groups, one of which the user must be a member of."),
+			allowed("allowed_email_domains", "Comma separated email domains, one of which the user's email must belong to."),
+			allowed("allowed_emails", "Comma separated emails, one of which must be the user's email."),
+		},
+		Responses: map[string]Response{
+			"202": {Description: "The request is authenticated and authorized"},
+			"401": textResponse("The request is not authenticated"),
+			"403": textResponse("The user is not authorized"),
+		},
+		Security: security,
+	}
+}
+
+func userInfoOperation(security []SecurityRequirement) *Operation {
+	return &Operation{
+		OperationID: "userInfo",
+		Summary:     "The authenticated user",
+		Tags:        []string{tagSession},
+		Responses: map[string]Response{
+			"200": jsonResponse("The user from the session", userInfoSchema),
+			"401": textResponse("The request is not authenticated"),
+		},
+		Security: security,
+	}
+}
+
+func whoAmIOperation(security []SecurityRequirement) *Operation {
+	return &Operation{
+		OperationID: "whoAmI",
+		Summary:     "The decoded session",
+		Description: "Renders the session of the user for debugging, including the claims of their tokens and whether they are authorized.",
+		Tags:        []string{tagSession},
+		Responses: map[string]Response{
+			"200": jsonResponse("The decoded session", whoAmISchema),
+			"401": textResponse("The request has no session"),
+		},
+		Security: security,
+	}
+}
+
+func upstreamLogoutOperation() *Operation {
+	return &Operation{
+		OperationID: "upstreamLogout",
+		Summary:     "Revoke the session on behalf of an upstream",
+		Description: "Revokes the session in the forwarded cookies, for upstream applications signing the user out. " +
+			"The application authenticates with the upstream logout secret as a bearer token, or with a client certificate, " +
+			"and relays the cookies set on the response to the user.",
+		Tags: []string{tagSession},
+		Responses: map[string]Response{
+			"204": {Description: "The session is revoked"},
+			"401": textResponse("The application is not authenticated"),
+			"404": textResponse("The forwarded cookies hold no session"),
+		},
+	}
+}
+
+func readyOperation() *Operation {
+	return &Operation{
+		OperationID: "readiness",
+		Summary:     "Detailed readiness check",
+		Description: "Checks the warm-up, the session store, the discovery endpoints of the providers and, " +
+			"when enabled, the targets of the load balanced upstreams, reporting the result of each check.",
+		Tags: []string{tagHealth},
+		Responses: map[string]Response{
+			"200": jsonResponse("All the dependencies of the proxy are ready", readySchema),
+			"503": jsonResponse("Some dependencies of the proxy are not ready", readySchema),
+		},
+	}
+}
+
+func openAPIOperation() *Operation {
+	return &Operation{
+		OperationID: "openAPI",
+		Summary:     "This OpenAPI document",
+		Responses: map[string]Response{
+			"200": jsonObjectResponse("The OpenAPI document"),
+		},
+	}
+}
+
+func redirectParameter() Parameter {
+	return Parameter{
+		Name:        "rd",
+		In:          "query",
+		Description: "The URL to redirect to afterwards. It must be on an allowed domain.",
+		Schema:      &Schema{Type: "string"},
+	}
+}
+
+func redirectResponse(description string) Response {
+	return Response{
+		Description: description,
+		Headers: map[string]Header{
+			"Location": {Schema: &Schema{Type: "string"}},
+		},
+	}
+}
+
+func htmlResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+func textResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+func jsonResponse(description, schema string) Response {
+	return Response{
+		Description: description,
+		Content: map[string]MediaType{
+			"application/json": {Schema: &Schema{Ref: schemaRef(schema)}},
+		},
+	}
+}
+
+func jsonObjectResponse(description string) Response {
+	return Response{
+		Description: description,
+		Content:     map[string]MediaType{"application/json": {Schema: &Schema{Type: "object"}}},
+	}
+}
+
+func schemaRef(name string) string {
+	return fmt.Sprintf("#/components/schemas/%s", name)
+}
+
+func proxySchemas() map[string]*Schema {
+	return map[string]*Schema{
+		userInfoSchema: {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"user":              {Type: "string"},
+				"email":             {Type: "string"},
+				"groups":            {Type: "array", Items: &Schema{Type: "string"}},
+				"preferredUsername": {Type: "string"},
+			},
+			Required: []string{"user", "email"},
+		},
+		whoAmISchema: {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"provider":          {Type: "string"},
+				"providerID":        {Type: "string"},
+				"authorized":        {Type: "boolean"},
+				"user":              {Type: "string"},
+				"email":             {Type: "string"},
+				"preferredUsername": {Type: "string"},
+				"groups":            {Type: "array", Items: &Schema{Type: "string"}},
+				"createdAt":         {Type: "string", Format: "date-time"},
+				"expiresOn":         {Type: "string", Format: "date-time"},
+				"expired":           {Type: "boolean"},
+				"tokens":            {Type: "array", Items: &Schema{Type: "string"}},
+				"idTokenClaims":     {Type: "object"},
+				"accessTokenClaims": {Type: "object"},
+			},
+			Required: []string{"authorized", "expired", "tokens"},
+		},
+		readySchema: {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"status": {Type: "string", Enum: []string{"ok", "error"}},
+				"checks": {Type: "object"},
+			},
+			Required: []string{"status", "checks"},
+		},
+	}
+}
+
+func securitySchemes(opts *options.Options) map[string]SecurityScheme {
+	schemes := map[string]SecurityScheme{
+		cookieScheme: {
+			Type:        "apiKey",
+			Description: "The session cookie set when signing in.",
+			Name:        opts.Cookie.Name,
+			In:          "cookie",
+		},
+	}
+	if opts.HtpasswdEnabled() {
+		schemes[basicScheme] = SecurityScheme{
+			Type:        "http",
+			Description: "Credentials from the htpasswd entries.",
+			Scheme:      "basic",
+		}
+	}
+	if opts.SkipJwtBearerTokens {
+		schemes[bearerScheme] = SecurityScheme{
+			Type:         "http",
+			Description:  "A JWT issued by the provider or an extra JWT issuer.",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+		}
+	}
+	return schemes
+}
+
+// securityRequirements lists each enabled security scheme as an alternative
+func securityRequirements(opts *options.Options) []SecurityRequirement {
+	requirements := []SecurityRequirement{{cookieScheme: {}}}
+	if opts.HtpasswdEnabled() {
+		requirements = append(requirements, SecurityRequirement{basicScheme: {}})
+	}
+	if opts.SkipJwtBearerTokens {
+		requirements = append(requirements, SecurityRequirement{bearerScheme: {}})
+	}
+	return requirements
+}
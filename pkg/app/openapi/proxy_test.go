@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy OpenAPI Document", func() {
+	var opts *options.Options
+
+	BeforeEach(func() {
+		opts = options.NewOptions()
+		opts.Providers = options.Providers{{ID: "provider"}}
+	})
+
+	It("describes the endpoints under the proxy prefix", func() {
+		opts.ProxyPrefix = "/auth-proxy"
+		doc := NewProxyDocument(opts)
+
+		Expect(doc.OpenAPI).To(Equal(Version))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/sign_in"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/start"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/callback"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/sign_out"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/auth"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/userinfo"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/openapi.json"))
+		Expect(doc.Paths).To(HaveKey("/auth-proxy/ready"))
+		Expect(doc.Paths).To(HaveKey("/ping"))
+		Expect(doc.Paths).To(HaveKey("/ready"))
+		Expect(doc.Paths).ToNot(HaveKey("/oauth2/sign_in"))
+	})
+
+	It("uses the session cookie name in the security scheme", func() {
+		opts.Cookie.Name = "_my_session"
+		doc := NewProxyDocument(opts)
+
+		Expect(doc.Components.SecuritySchemes).To(HaveKeyWithValue(cookieScheme, SecurityScheme{
+			Type:        "apiKey",
+			Description: "The session cookie set when signing in.",
+			Name:        "_my_session",
+			In:          "cookie",
+		}))
+		Expect(doc.Components.SecuritySchemes).To(HaveLen(1))
+		Expect(doc.Paths["/oauth2/auth"].Get.Security).To(ConsistOf(SecurityRequirement{cookieScheme: {}}))
+	})
+
+	It("includes basic auth and the password sign in with an htpasswd file", func() {
+		opts.HtpasswdFile = "/etc/htpasswd"
+		doc := NewProxyDocument(opts)
+
+		Expect(doc.Components.SecuritySchemes).To(HaveKey(basicScheme))
+		Expect(doc.Paths["/oauth2/sign_in"].Post).ToNot(BeNil())
+		Expect(doc.Paths["/oauth2/userinfo"].Get.Security).To(ContainElement(SecurityRequirement{basicScheme: {}}))
+	})
+
+	It("only includes the password sign in with an htpasswd file", func() {
+		doc := NewProxyDocument(opts)
+		Expect(doc.Paths["/oauth2/sign_in"].Post).To(BeNil())
+	})
+
+	It("includes bearer tokens when JWT bearer tokens are accepted", func() {
+		opts.SkipJwtBearerTokens = true
+		doc := NewProxyDocument(opts)
+
+		Expect(doc.Components.SecuritySchemes).To(HaveKeyWithValue(bearerScheme, HaveField("BearerFormat", "JWT")))
+		Expect(doc.Paths["/oauth2/auth"].Get.Security).To(ContainElement(SecurityRequirement{bearerScheme: {}}))
+	})
+
+	It("describes the sign in redirect when the provider button is skipped", func() {
+		opts.SkipProviderButton = true
+		doc := NewProxyDocument(opts)
+
+		Expect(doc.Paths["/oauth2/sign_in"].Get.Responses).To(HaveKey("302"))
+		Expect(doc.Paths["/oauth2/sign_in"].Get.Responses).ToNot(HaveKey("200"))
+	})
+
+	It("sets the server from an absolute redirect URL", func() {
+		opts.RawRedirectURL = "https://auth.example.com/oauth2/callback"
+		doc := NewProxyDocument(opts)
+		Expect(doc.Servers).To(ConsistOf(Server{URL: "https://auth.example.com"}))
+	})
+
+	It("omits the server for a relative redirect URL", func() {
+		opts.RawRedirectURL = "/oauth2/callback"
+		doc := NewProxyDocument(opts)
+		Expect(doc.Servers).To(BeEmpty())
+	})
+
+	It("omits the health checks when their paths are disabled", func() {
+		opts.PingPath = ""
+		opts.ReadyPath = ""
+		doc := NewProxyDocument(opts)
+		Expect(doc.Paths).ToNot(HaveKey("/ping"))
+		Expect(doc.Paths).ToNot(HaveKey("/ready"))
+	})
+
+	Context("with login URL parameters", func() {
+		BeforeEach(func() {
+			prompt := "login"
+			consent := "consent"
+			pattern := "^[a-z]+$"
+			opts.Providers[0].LoginURLParameters = []options.LoginURLParameter{
+				{Name: "prompt", Allow: []options.URLParameterRule{{Value: &prompt}, {Value: &consent}}},
+				{Name: "login_hint", Allow: []options.URLParameterRule{{Pattern: &pattern}}},
+				{Name: "fixed", Default: []string{"value"}},
+			}
+		})
+
+		It("describes the overridable parameters on the start endpoint", func() {
+			params := NewProxyDocument(opts).Paths["/oauth2/start"].Get.Parameters
+
+			Expect(params).To(ContainElement(HaveField("Name", "rd")))
+			Expect(params).To(ContainElement(And(
+				HaveField("Name", "prompt"),
+				HaveField("Schema.Enum", ConsistOf("login", "consent")),
+			)))
+			Expect(params).To(ContainElement(And(
+				HaveField("Name", "login_hint"),
+				HaveField("Schema.Enum", BeEmpty()),
+			)))
+			Expect(params).ToNot(ContainElement(HaveField("Name", "fixed")))
+		})
+	})
+
+	It("describes the handoff endpoints when handoff is enabled", func() {
+		Expect(NewProxyDocument(opts).Paths).ToNot(HaveKey("/oauth2/handoff/redeem"))
+
+		opts.Handoff.Secret = "0123456789abcdef"
+		doc := NewProxyDocument(opts)
+		Expect(doc.Paths).To(HaveKey("/oauth2/handoff/redeem"))
+		Expect(doc.Paths).ToNot(HaveKey("/oauth2/handoff"))
+
+		opts.Handoff.AllowedDomains = []string{".example.net"}
+		Expect(NewProxyDocument(opts).Paths).To(HaveKey("/oauth2/handoff"))
+	})
+
+	It("describes the OIDC issuer endpoints when the issuer is enabled", func() {
+		Expect(NewProxyDocument(opts).Paths).ToNot(HaveKey("/oauth2/oidc/token"))
+
+		opts.OIDCIssuer.SigningKeyFile = "/etc/oauth2-proxy/issuer.pem"
+		doc := NewProxyDocument(opts)
+		Expect(doc.Paths).To(HaveKey("/oauth2/oidc/.well-known/openid-configuration"))
+		Expect(doc.Paths).To(HaveKey("/oauth2/oidc/authorize"))
+		Expect(doc.Paths).To(HaveKey("/oauth2/oidc/token"))
+	})
+
+	It("describes the whoami endpoint when it is enabled", func() {
+		Expect(NewProxyDocument(opts).Paths).ToNot(HaveKey("/oauth2/whoami"))
+
+		opts.WhoAmI.Enabled = true
+		Expect(NewProxyDocument(opts).Paths).To(HaveKey("/oauth2/whoami"))
+	})
+
+	It("describes the upstream logout endpoint when it is enabled", func() {
+		Expect(NewProxyDocument(opts).Paths).ToNot(HaveKey("/oauth2/upstream_logout"))
+
+		opts.UpstreamLogout.Secret = "secret"
+		Expect(NewProxyDocument(opts).Paths["/oauth2/upstream_logout"].Post).ToNot(BeNil())
+	})
+
+	It("describes the provider parameter when there are multiple providers", func() {
+		Expect(NewProxyDocument(opts).Paths["/oauth2/start"].Get.Parameters).ToNot(ContainElement(HaveField("Name", "provider")))
+
+		opts.Providers = append(opts.Providers, options.Provider{ID: "github"})
+		start := NewProxyDocument(opts).Paths["/oauth2/start"].Get
+		Expect(start.Parameters).To(ContainElement(And(
+			HaveField("Name", "provider"),
+			HaveField("Schema.Enum", ConsistOf(opts.Providers[0].ID, "github")),
+		)))
+		Expect(start.Responses).To(HaveKey("400"))
+	})
+
+	It("is served as JSON", func() {
+		rw := httptest.NewRecorder()
+		Handler(NewProxyDocument(opts)).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/oauth2/openapi.json", nil))
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var doc map[string]interface{}
+		Expect(json.Unmarshal(rw.Body.Bytes(), &doc)).To(Succeed())
+		Expect(doc).To(HaveKeyWithValue("openapi", Version))
+		Expect(doc["paths"]).To(HaveKey("/oauth2/userinfo"))
+		Expect(doc["components"]).To(HaveKeyWithValue("schemas", HaveKey(userInfoSchema)))
+	})
+})
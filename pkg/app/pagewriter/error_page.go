@@ -7,6 +7,7 @@ import (
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
 
 // errorMessages are default error messages for each of the different
@@ -23,6 +24,9 @@ type errorPageWriter struct {
 	// template is the error page HTML template.
 	template *template.Template
 
+	// hostTemplates are the error page HTML templates of the branded hosts.
+	hostTemplates hostTemplates
+
 	// proxyPrefix is the prefix under which OAuth2 Proxy pages are served.
 	proxyPrefix string
 
@@ -36,6 +40,13 @@ type errorPageWriter struct {
 	// debug determines whether errors pages should be rendered with detailed
 	// errors.
 	debug bool
+
+	// providerName and providers are the providers users can sign in with.
+	providerName string
+	providers    []SignInProvider
+
+	// translations translate the messages of the page.
+	translations *translations
 }
 
 // ErrorPageOpts bundles up all the content needed to write the Error Page
@@ -50,6 +61,11 @@ type ErrorPageOpts struct {
 	AppError string
 	// Generic error messages shown in non-debug mode
 	Messages []interface{}
+	// The host of the request, selecting the templates of branded hosts
+	Host string
+	// The Accept-Language header of the request, selecting the language of
+	// the page
+	AcceptLanguage string
 }
 
 // WriteErrorPage writes an error page to the given response writer.
@@ -58,27 +74,36 @@ type ErrorPageOpts struct {
 func (e *errorPageWriter) WriteErrorPage(rw http.ResponseWriter, opts ErrorPageOpts) {
 	rw.WriteHeader(opts.Status)
 
+	lang := e.translations.match(opts.AcceptLanguage)
 	data := struct {
-		Title       string
-		Message     string
-		ProxyPrefix string
-		StatusCode  int
-		Redirect    string
-		RequestID   string
-		Footer      template.HTML
-		Version     string
+		Title        string
+		Message      string
+		ProxyPrefix  string
+		StatusCode   int
+		Redirect     string
+		RequestID    string
+		Footer       template.HTML
+		Version      string
+		Host         string
+		ProviderName string
+		Providers    []SignInProvider
+		Language     string
 	}{
-		Title:       http.StatusText(opts.Status),
-		Message:     e.getMessage(opts.Status, opts.AppError, opts.Messages...),
-		ProxyPrefix: e.proxyPrefix,
-		StatusCode:  opts.Status,
-		Redirect:    opts.RedirectURL,
-		RequestID:   opts.RequestID,
-		Footer:      template.HTML(e.footer), // #nosec G203 -- We allow unescaped template.HTML since it is user configured options
-		Version:     e.version,
+		Title:        e.translations.translate(lang, http.StatusText(opts.Status)),
+		Message:      e.getMessage(lang, opts.Status, opts.AppError, opts.Messages...),
+		ProxyPrefix:  e.proxyPrefix,
+		StatusCode:   opts.Status,
+		Redirect:     opts.RedirectURL,
+		RequestID:    opts.RequestID,
+		Footer:       template.HTML(e.footer), // #nosec G203 -- We allow unescaped template.HTML since it is user configured options
+		Version:      e.version,
+		Host:         opts.Host,
+		ProviderName: e.providerName,
+		Providers:    e.providers,
+		Language:     lang,
 	}
 
-	if err := e.template.Execute(rw, data); err != nil {
+	if err := e.hostTemplates.forHost(opts.Host, e.template).Execute(rw, data); err != nil {
 		logger.Printf("Error rendering error template: %v", err)
 		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
@@ -91,11 +116,13 @@ func (e *errorPageWriter) ProxyErrorHandler(rw http.ResponseWriter, req *http.Re
 	logger.Errorf("Error proxying to upstream server: %v", proxyErr)
 	scope := middlewareapi.GetRequestScope(req)
 	e.WriteErrorPage(rw, ErrorPageOpts{
-		Status:      http.StatusBadGateway,
-		RedirectURL: "", // The user is already logged in and has hit an upstream error. Makes no sense to redirect in this case.
-		RequestID:   scope.RequestID,
-		AppError:    proxyErr.Error(),
-		Messages:    []interface{}{"There was a problem connecting to the upstream server."},
+		Status:         http.StatusBadGateway,
+		RedirectURL:    "", // The user is already logged in and has hit an upstream error. Makes no sense to redirect in this case.
+		RequestID:      scope.RequestID,
+		AppError:       proxyErr.Error(),
+		Messages:       []interface{}{"There was a problem connecting to the upstream server."},
+		Host:           requestutil.GetRequestHost(req),
+		AcceptLanguage: req.Header.Get("Accept-Language"),
 	})
 }
 
@@ -104,16 +131,17 @@ func (e *errorPageWriter) ProxyErrorHandler(rw http.ResponseWriter, req *http.Re
 // Otherwise, any messages will be used.
 // The first message is expected to be a format string.
 // If no messages are supplied, a default error message will be used.
-func (e *errorPageWriter) getMessage(status int, appError string, messages ...interface{}) string {
+// The messages are translated to the language of the page.
+func (e *errorPageWriter) getMessage(lang string, status int, appError string, messages ...interface{}) string {
 	if e.debug {
 		return appError
 	}
 	if len(messages) > 0 {
-		format := fmt.Sprintf("%v", messages[0])
+		format := e.translations.translate(lang, fmt.Sprintf("%v", messages[0]))
 		return fmt.Sprintf(format, messages[1:]...)
 	}
 	if msg, ok := errorMessages[status]; ok {
-		return msg
+		return e.translations.translate(lang, msg)
 	}
-	return "Unknown error"
+	return e.translations.translate(lang, "Unknown error")
 }
@@ -2,6 +2,7 @@ package pagewriter
 
 import (
 	"fmt"
+	"io/fs"
 	"net/http"
 )
 
@@ -14,6 +15,7 @@ type Writer interface {
 	WriteErrorPage(rw http.ResponseWriter, opts ErrorPageOpts)
 	ProxyErrorHandler(rw http.ResponseWriter, req *http.Request, proxyErr error)
 	WriteRobotsTxt(rw http.ResponseWriter, req *http.Request)
+	WriteStaticAsset(rw http.ResponseWriter, req *http.Request)
 }
 
 // pageWriter implements the Writer interface
@@ -27,8 +29,18 @@ type pageWriter struct {
 // rendering within OAuth2 Proxy.
 type Opts struct {
 	// TemplatesPath is the path from which to load custom templates for the sign-in and error pages.
+	// Its static subdirectory holds static assets, and its hosts subdirectory
+	// holds a directory of templates and static assets for each branded host.
 	TemplatesPath string
 
+	// TranslationsPath is the path from which to load the message catalogs
+	// translating the sign-in and error pages.
+	TranslationsPath string
+
+	// StaticAssets are the default static assets, served when an asset is not
+	// in the custom templates directory.
+	StaticAssets fs.FS
+
 	// ProxyPrefix is the prefix under which OAuth2 Proxy pages are served.
 	ProxyPrefix string
 
@@ -49,6 +61,10 @@ type Opts struct {
 	// ProviderName is the name of the provider that should be displayed on the login button.
 	ProviderName string
 
+	// Providers are the providers users can choose to sign in with when more
+	// than one is configured. A sign in button is displayed for each of them.
+	Providers []SignInProvider
+
 	// SignInMessage is the messge displayed above the login button.
 	SignInMessage string
 
@@ -61,29 +77,46 @@ type Opts struct {
 // NewWriter constructs a Writer from the options given to allow
 // rendering of sign-in and error pages.
 func NewWriter(opts Opts) (Writer, error) {
-	templates, err := loadTemplates(opts.TemplatesPath)
+	translations, err := loadTranslations(opts.TranslationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading translations: %v", err)
+	}
+
+	templates, err := loadTemplates(translations, opts.TemplatesPath)
 	if err != nil {
 		return nil, fmt.Errorf("error loading templates: %v", err)
 	}
 
+	hosts, err := loadHostTemplates(translations, opts.TemplatesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading host templates: %v", err)
+	}
+
 	logoData, err := loadCustomLogo(opts.CustomLogo)
 	if err != nil {
 		return nil, fmt.Errorf("error loading logo: %v", err)
 	}
 
 	errorPage := &errorPageWriter{
-		template:    templates.Lookup("error.html"),
-		proxyPrefix: opts.ProxyPrefix,
-		footer:      opts.Footer,
-		version:     opts.Version,
-		debug:       opts.Debug,
+		template:      templates.Lookup(errorTemplateName),
+		hostTemplates: hosts.page(errorTemplateName),
+		proxyPrefix:   opts.ProxyPrefix,
+		footer:        opts.Footer,
+		version:       opts.Version,
+		debug:         opts.Debug,
+		providerName:  opts.ProviderName,
+		providers:     opts.Providers,
+		translations:  translations,
 	}
 
 	signInPage := &signInPageWriter{
-		template:         templates.Lookup("sign_in.html"),
+		template:         templates.Lookup(signInTemplateName),
+		hostTemplates:    hosts.page(signInTemplateName),
+		translations:     translations,
 		errorPageWriter:  errorPage,
 		proxyPrefix:      opts.ProxyPrefix,
 		providerName:     opts.ProviderName,
+		providers:        opts.Providers,
 		signInMessage:    opts.SignInMessage,
 		footer:           opts.Footer,
 		version:          opts.Version,
@@ -95,6 +128,10 @@ func NewWriter(opts Opts) (Writer, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error loading static page writer: %v", err)
 	}
+	staticPages.assets, err = loadStaticAssets(opts.TemplatesPath, opts.ProxyPrefix, opts.StaticAssets)
+	if err != nil {
+		return nil, fmt.Errorf("error loading static assets: %v", err)
+	}
 
 	return &pageWriter{
 		errorPageWriter:  errorPage,
@@ -108,10 +145,11 @@ func NewWriter(opts Opts) (Writer, error) {
 // If any of the funcs are not provided, a default implementation will be used.
 // This is primarily for us in testing.
 type WriterFuncs struct {
-	SignInPageFunc func(rw http.ResponseWriter, req *http.Request, redirectURL string, statusCode int)
-	ErrorPageFunc  func(rw http.ResponseWriter, opts ErrorPageOpts)
-	ProxyErrorFunc func(rw http.ResponseWriter, req *http.Request, proxyErr error)
-	RobotsTxtfunc  func(rw http.ResponseWriter, req *http.Request)
+	SignInPageFunc  func(rw http.ResponseWriter, req *http.Request, redirectURL string, statusCode int)
+	ErrorPageFunc   func(rw http.ResponseWriter, opts ErrorPageOpts)
+	ProxyErrorFunc  func(rw http.ResponseWriter, req *http.Request, proxyErr error)
+	RobotsTxtfunc   func(rw http.ResponseWriter, req *http.Request)
+	StaticAssetFunc func(rw http.ResponseWriter, req *http.Request)
 }
 
 // WriteSignInPage implements the Writer interface.
@@ -172,3 +210,15 @@ func (w *WriterFuncs) WriteRobotsTxt(rw http.ResponseWriter, req *http.Request)
 		rw.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// WriteStaticAsset implements the Writer interface.
+// If the StaticAssetFunc is provided, this will be used, else a default
+// implementation will be used.
+func (w *WriterFuncs) WriteStaticAsset(rw http.ResponseWriter, req *http.Request) {
+	if w.StaticAssetFunc != nil {
+		w.StaticAssetFunc(rw, req)
+		return
+	}
+
+	http.NotFound(rw, req)
+}
@@ -111,6 +111,124 @@ var _ = Describe("Writer", func() {
 			})
 		})
 
+		Context("With custom templates for a host", func() {
+			var customDir string
+
+			BeforeEach(func() {
+				var err error
+				customDir, err = os.MkdirTemp("", "oauth2-proxy-pagewriter-test")
+				Expect(err).ToNot(HaveOccurred())
+
+				hostDir := filepath.Join(customDir, hostsDirName, "auth.example.com")
+				Expect(os.MkdirAll(hostDir, 0700)).To(Succeed())
+				signInFile := filepath.Join(hostDir, signInTemplateName)
+				Expect(os.WriteFile(signInFile, []byte(`{{.Host}} {{.Redirect}} {{range .Providers}}{{.ID}} {{end}}{{.StatusCode}}`), 0600)).To(Succeed())
+				errorFile := filepath.Join(hostDir, errorTemplateName)
+				Expect(os.WriteFile(errorFile, []byte(`{{.Host}} {{.StatusCode}} {{range .Providers}}{{.Name}}{{end}}`), 0600)).To(Succeed())
+
+				opts.TemplatesPath = customDir
+				opts.Providers = []SignInProvider{{ID: "google", Name: "Google"}}
+
+				writer, err = NewWriter(opts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(customDir)).To(Succeed())
+			})
+
+			It("Writes the sign in template of the host", func() {
+				recorder := httptest.NewRecorder()
+				request = httptest.NewRequest("", "http://auth.example.com/", nil)
+				writer.WriteSignInPage(recorder, request, "/redirect", http.StatusUnauthorized)
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("auth.example.com /redirect google 401"))
+			})
+
+			It("Writes the error template of the host", func() {
+				recorder := httptest.NewRecorder()
+				writer.WriteErrorPage(recorder, ErrorPageOpts{
+					Status: http.StatusForbidden,
+					Host:   "auth.example.com",
+				})
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("auth.example.com 403 Google"))
+			})
+
+			It("Writes the default sign in template for other hosts", func() {
+				recorder := httptest.NewRecorder()
+				writer.WriteSignInPage(recorder, request, "/redirect", http.StatusOK)
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(HavePrefix("\n<!DOCTYPE html>"))
+			})
+		})
+
+		Context("With translations", func() {
+			var translationsDir string
+
+			BeforeEach(func() {
+				var err error
+				translationsDir, err = os.MkdirTemp("", "oauth2-proxy-pagewriter-test")
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(os.WriteFile(filepath.Join(translationsDir, "de.json"), []byte(`{
+					"Sign in with %s": "Mit %s anmelden",
+					"Forbidden": "Verboten",
+					"You do not have permission to access this resource.": "Sie haben keine Berechtigung."
+				}`), 0600)).To(Succeed())
+
+				opts.TranslationsPath = translationsDir
+
+				writer, err = NewWriter(opts)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(translationsDir)).To(Succeed())
+			})
+
+			It("Writes the sign in page in the language of the request", func() {
+				recorder := httptest.NewRecorder()
+				request.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+				writer.WriteSignInPage(recorder, request, "/redirect", http.StatusOK)
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`<html lang="de"`))
+				Expect(string(body)).To(ContainSubstring("Mit &lt;ProviderName&gt; anmelden"))
+			})
+
+			It("Writes the error page in the language of the request", func() {
+				recorder := httptest.NewRecorder()
+				writer.WriteErrorPage(recorder, ErrorPageOpts{
+					Status:         http.StatusForbidden,
+					AcceptLanguage: "de",
+				})
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring("Verboten"))
+				Expect(string(body)).To(ContainSubstring("Sie haben keine Berechtigung."))
+			})
+
+			It("Writes the pages in English for other languages", func() {
+				recorder := httptest.NewRecorder()
+				request.Header.Set("Accept-Language", "fr")
+				writer.WriteSignInPage(recorder, request, "/redirect", http.StatusOK)
+
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`<html lang="en"`))
+				Expect(string(body)).To(ContainSubstring("Sign in with &lt;ProviderName&gt;"))
+			})
+		})
+
 		Context("With an invalid custom template", func() {
 			var customDir string
 
@@ -276,5 +394,34 @@ var _ = Describe("Writer", func() {
 				expectedBody:   "Disallow: *",
 			}),
 		)
+
+		DescribeTable("WriteStaticAsset",
+			func(in writerFuncsTableInput) {
+				rw := httptest.NewRecorder()
+				req := httptest.NewRequest("", "/static/logo.svg", nil)
+				in.writer.WriteStaticAsset(rw, req)
+
+				Expect(rw.Result().StatusCode).To(Equal(in.expectedStatus))
+
+				body, err := io.ReadAll(rw.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal(in.expectedBody))
+			},
+			Entry("With no override", writerFuncsTableInput{
+				writer:         &WriterFuncs{},
+				expectedStatus: 404,
+				expectedBody:   "404 page not found\n",
+			}),
+			Entry("With an override function", writerFuncsTableInput{
+				writer: &WriterFuncs{
+					StaticAssetFunc: func(rw http.ResponseWriter, req *http.Request) {
+						rw.WriteHeader(202)
+						rw.Write([]byte(req.URL.Path))
+					},
+				},
+				expectedStatus: 202,
+				expectedBody:   "/static/logo.svg",
+			}),
+		)
 	})
 })
@@ -15,6 +15,7 @@ import (
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
 
 //go:embed default_logo.svg
@@ -25,6 +26,9 @@ type signInPageWriter struct {
 	// Template is the sign-in page HTML template.
 	template *template.Template
 
+	// hostTemplates are the sign-in page HTML templates of the branded hosts.
+	hostTemplates hostTemplates
+
 	// errorPageWriter is used to render an error if there are problems with rendering the sign-in page.
 	errorPageWriter *errorPageWriter
 
@@ -34,6 +38,9 @@ type signInPageWriter struct {
 	// ProviderName is the name of the provider that should be displayed on the login button.
 	providerName string
 
+	// Providers are the providers users can choose to sign in with.
+	providers []SignInProvider
+
 	// SignInMessage is the messge displayed above the login button.
 	signInMessage string
 
@@ -50,13 +57,27 @@ type signInPageWriter struct {
 	// LogoData is the logo to render in the template.
 	// This should contain valid html.
 	logoData string
+
+	// translations translate the messages of the page.
+	translations *translations
+}
+
+// SignInProvider is a provider users can choose to sign in with
+type SignInProvider struct {
+	// ID is the ID of the provider, passed to the start of the OAuth flow.
+	ID string
+
+	// Name is the name of the provider that should be displayed on its login button.
+	Name string
 }
 
 // WriteSignInPage writes the sign-in page to the given response writer.
 // It uses the redirectURL to be able to set the final destination for the user post login.
 func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Request, redirectURL string, statusCode int) {
+	host := requestutil.GetRequestHost(req)
 	t := struct {
 		ProviderName  string
+		Providers     []SignInProvider
 		SignInMessage template.HTML
 		StatusCode    int
 		CustomLogin   bool
@@ -65,8 +86,11 @@ func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Req
 		ProxyPrefix   string
 		Footer        template.HTML
 		LogoData      template.HTML
+		Host          string
+		Language      string
 	}{
 		ProviderName:  s.providerName,
+		Providers:     s.selectProviders(req),
 		SignInMessage: template.HTML(s.signInMessage), // #nosec G203 -- We allow unescaped template.HTML since it is user configured options
 		StatusCode:    statusCode,
 		CustomLogin:   s.displayLoginForm,
@@ -75,21 +99,38 @@ func (s *signInPageWriter) WriteSignInPage(rw http.ResponseWriter, req *http.Req
 		ProxyPrefix:   s.proxyPrefix,
 		Footer:        template.HTML(s.footer),   // #nosec G203 -- We allow unescaped template.HTML since it is user configured options
 		LogoData:      template.HTML(s.logoData), // #nosec G203 -- We allow unescaped template.HTML since it is user configured options
+		Host:          host,
+		Language:      s.translations.match(req.Header.Get("Accept-Language")),
 	}
 
-	err := s.template.Execute(rw, t)
+	err := s.hostTemplates.forHost(host, s.template).Execute(rw, t)
 	if err != nil {
 		logger.Printf("Error rendering sign-in template: %v", err)
 		scope := middlewareapi.GetRequestScope(req)
 		s.errorPageWriter.WriteErrorPage(rw, ErrorPageOpts{
-			Status:      http.StatusInternalServerError,
-			RedirectURL: redirectURL,
-			RequestID:   scope.RequestID,
-			AppError:    err.Error(),
+			Status:         http.StatusInternalServerError,
+			RedirectURL:    redirectURL,
+			RequestID:      scope.RequestID,
+			AppError:       err.Error(),
+			Host:           host,
+			AcceptLanguage: req.Header.Get("Accept-Language"),
 		})
 	}
 }
 
+// selectProviders returns the providers to display a sign in button for.
+// When the request selects a provider with the `provider` query parameter,
+// only that provider is displayed.
+func (s *signInPageWriter) selectProviders(req *http.Request) []SignInProvider {
+	selected := req.URL.Query().Get("provider")
+	for _, provider := range s.providers {
+		if provider.ID == selected {
+			return []SignInProvider{provider}
+		}
+	}
+	return s.providers
+}
+
 // loadCustomLogo loads the logo file from the path and encodes it to an HTML
 // entity or if a URL is provided then it's used directly,
 // otherwise if no custom logo is provided, the OAuth2 Proxy Icon is used instead.
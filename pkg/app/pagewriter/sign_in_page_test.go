@@ -60,6 +60,25 @@ var _ = Describe("SignIn Page", func() {
 				Expect(string(body)).To(Equal("/prefix/ My Provider Sign In Here Custom Footer Text v0.0.0-test /redirect true Logo Data"))
 			})
 
+			It("Writes a button for each provider", func() {
+				tmpl, err := template.New("").Parse("{{range .Providers}}{{.ID}}:{{.Name}} {{end}}")
+				Expect(err).ToNot(HaveOccurred())
+				signInPage.template = tmpl
+				signInPage.providers = []SignInProvider{
+					{ID: "google", Name: "Google"},
+					{ID: "github", Name: "GitHub"},
+				}
+
+				recorder := httptest.NewRecorder()
+				signInPage.WriteSignInPage(recorder, request, "/redirect", http.StatusOK)
+				Expect(recorder.Body.String()).To(Equal("google:Google github:GitHub "))
+
+				// Only the provider selected by the request is displayed
+				recorder = httptest.NewRecorder()
+				signInPage.WriteSignInPage(recorder, httptest.NewRequest("", "http://127.0.0.1/?provider=github", nil), "/redirect", http.StatusOK)
+				Expect(recorder.Body.String()).To(Equal("github:GitHub "))
+			})
+
 			It("Writes an error if the template can't be rendered", func() {
 				// Overwrite the template with something bad
 				tmpl, err := template.New("").Parse("{{.Unknown}}")
@@ -3,17 +3,29 @@ package pagewriter
 import (
 	// Import embed to allow importing default page templates
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
 
 const (
 	robotsTxtName = "robots.txt"
+
+	// staticDirName is the subdirectory of the custom templates directory, and
+	// of each host directory, holding the static assets
+	staticDirName = "static"
+
+	// staticPath is the path static assets are served under, below the
+	// proxy prefix
+	staticPath = "/static/"
 )
 
 //go:embed robots.txt
@@ -23,6 +35,7 @@ var defaultRobotsTxt []byte
 type staticPageWriter struct {
 	pageGetter      *pageGetter
 	errorPageWriter *errorPageWriter
+	assets          *staticAssets
 }
 
 // WriteRobotsTxt writes the robots.txt content to the response writer.
@@ -30,6 +43,30 @@ func (s *staticPageWriter) WriteRobotsTxt(rw http.ResponseWriter, req *http.Requ
 	s.writePage(rw, req, robotsTxtName)
 }
 
+// WriteStaticAsset writes the static asset at the path of the request,
+// below the static path of the proxy prefix, to the response writer.
+func (s *staticPageWriter) WriteStaticAsset(rw http.ResponseWriter, req *http.Request) {
+	host := requestutil.GetRequestHost(req)
+	name := strings.TrimPrefix(req.URL.Path, s.assets.proxyPrefix+staticPath)
+	if fs.ValidPath(name) {
+		for _, fsys := range s.assets.forHost(host) {
+			if info, err := fs.Stat(fsys, name); err == nil && info.Mode().IsRegular() {
+				http.ServeFileFS(rw, req, fsys, name)
+				return
+			}
+		}
+	}
+
+	scope := middlewareapi.GetRequestScope(req)
+	s.errorPageWriter.WriteErrorPage(rw, ErrorPageOpts{
+		Status:         http.StatusNotFound,
+		RequestID:      scope.RequestID,
+		AppError:       fmt.Sprintf("static asset %q not found", name),
+		Host:           host,
+		AcceptLanguage: req.Header.Get("Accept-Language"),
+	})
+}
+
 // writePage writes the content of the page to the response writer.
 func (s *staticPageWriter) writePage(rw http.ResponseWriter, req *http.Request, pageName string) {
 	_, err := rw.Write(s.pageGetter.getPage(pageName))
@@ -54,9 +91,62 @@ func newStaticPageWriter(customDir string, errorWriter *errorPageWriter) (*stati
 	return &staticPageWriter{
 		pageGetter:      pageGetter,
 		errorPageWriter: errorWriter,
+		assets:          &staticAssets{},
 	}, nil
 }
 
+// staticAssets are the file systems static assets are served from, in order
+// of precedence.
+type staticAssets struct {
+	proxyPrefix string
+	defaults    []fs.FS
+	hosts       map[string][]fs.FS
+}
+
+// loadStaticAssets serves the static assets from the static subdirectory of
+// the custom templates directory, falling back on the default assets.
+// The assets of a branded host are served from the static subdirectory of its
+// host directory first.
+func loadStaticAssets(customDir, proxyPrefix string, defaultAssets fs.FS) (*staticAssets, error) {
+	assets := &staticAssets{
+		proxyPrefix: proxyPrefix,
+		hosts:       make(map[string][]fs.FS),
+	}
+	if customDir != "" {
+		assets.defaults = append(assets.defaults, os.DirFS(filepath.Join(customDir, staticDirName)))
+	}
+	if defaultAssets != nil {
+		assets.defaults = append(assets.defaults, defaultAssets)
+	}
+	if customDir == "" {
+		return assets, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(customDir, hostsDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return assets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read host directories: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			hostAssets := os.DirFS(filepath.Join(customDir, hostsDirName, entry.Name(), staticDirName))
+			assets.hosts[strings.ToLower(entry.Name())] = append([]fs.FS{hostAssets}, assets.defaults...)
+		}
+	}
+	return assets, nil
+}
+
+// forHost returns the file systems the static assets of the host are served
+// from
+func (a *staticAssets) forHost(host string) []fs.FS {
+	if hostAssets, ok := a.hosts[hostName(host)]; ok {
+		return hostAssets
+	}
+	return a.defaults
+}
+
 // loadStaticPages loads static page content from the custom directory provided.
 // If any file is not provided in the custom directory, the default will be used
 // instead.
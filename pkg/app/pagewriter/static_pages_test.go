@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"testing/fstest"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	. "github.com/onsi/ginkgo/v2"
@@ -104,6 +105,88 @@ var _ = Describe("Static Pages", func() {
 		})
 	})
 
+	Context("WriteStaticAsset", func() {
+		var pageWriter *staticPageWriter
+
+		BeforeEach(func() {
+			staticDir := filepath.Join(customDir, staticDirName)
+			Expect(os.MkdirAll(staticDir, 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(staticDir, "logo.svg"), []byte("custom logo"), 0600)).To(Succeed())
+
+			hostStaticDir := filepath.Join(customDir, hostsDirName, "auth.example.com", staticDirName)
+			Expect(os.MkdirAll(hostStaticDir, 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(hostStaticDir, "logo.svg"), []byte("host logo"), 0600)).To(Succeed())
+
+			var err error
+			pageWriter, err = newStaticPageWriter(customDir, errorPage)
+			Expect(err).ToNot(HaveOccurred())
+			pageWriter.assets, err = loadStaticAssets(customDir, "/prefix", fstest.MapFS{
+				"logo.svg":      {Data: []byte("default logo")},
+				"css/bulma.css": {Data: []byte("default css")},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		type writeStaticAssetTableInput struct {
+			host           string
+			path           string
+			expectedStatus int
+			expectedBody   string
+		}
+
+		DescribeTable("writes the asset",
+			func(in writeStaticAssetTableInput) {
+				req := httptest.NewRequest("", "http://"+in.host+in.path, nil)
+				req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+					RequestID: testRequestID,
+				})
+				recorder := httptest.NewRecorder()
+				pageWriter.WriteStaticAsset(recorder, req)
+
+				Expect(recorder.Result().StatusCode).To(Equal(in.expectedStatus))
+				body, err := io.ReadAll(recorder.Result().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal(in.expectedBody))
+			},
+			Entry("from the custom directory", writeStaticAssetTableInput{
+				host:           "127.0.0.1",
+				path:           "/prefix/static/logo.svg",
+				expectedStatus: http.StatusOK,
+				expectedBody:   "custom logo",
+			}),
+			Entry("from the host directory", writeStaticAssetTableInput{
+				host:           "auth.example.com:8443",
+				path:           "/prefix/static/logo.svg",
+				expectedStatus: http.StatusOK,
+				expectedBody:   "host logo",
+			}),
+			Entry("from the defaults when it is not custom", writeStaticAssetTableInput{
+				host:           "auth.example.com",
+				path:           "/prefix/static/css/bulma.css",
+				expectedStatus: http.StatusOK,
+				expectedBody:   "default css",
+			}),
+			Entry("with a not found error for a missing asset", writeStaticAssetTableInput{
+				host:           "127.0.0.1",
+				path:           "/prefix/static/missing.css",
+				expectedStatus: http.StatusNotFound,
+				expectedBody:   "Not Found",
+			}),
+			Entry("with a not found error for a directory", writeStaticAssetTableInput{
+				host:           "127.0.0.1",
+				path:           "/prefix/static/css",
+				expectedStatus: http.StatusNotFound,
+				expectedBody:   "Not Found",
+			}),
+			Entry("with a not found error outside of the static directory", writeStaticAssetTableInput{
+				host:           "127.0.0.1",
+				path:           "/prefix/static/%2e%2e/hosts/auth.example.com/static/logo.svg",
+				expectedStatus: http.StatusNotFound,
+				expectedBody:   "Not Found",
+			}),
+		)
+	})
+
 	Context("loadStaticPages", func() {
 		Context("With custom content", func() {
 			Context("And a custom robots txt", func() {
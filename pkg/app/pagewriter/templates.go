@@ -4,18 +4,27 @@ import (
 	// Import embed to allow importing default page templates
 	_ "embed"
 
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/templates"
 )
 
 const (
 	errorTemplateName  = "error.html"
 	signInTemplateName = "sign_in.html"
+
+	// hostsDirName is the subdirectory of the custom templates directory
+	// holding a directory of templates and static assets for each branded host
+	hostsDirName = "hosts"
 )
 
 //go:embed error.html
@@ -24,32 +33,38 @@ var defaultErrorTemplate string
 //go:embed sign_in.html
 var defaultSignInTemplate string
 
-// loadTemplates adds the Sign In and Error templates from the custom template
-// directory, or uses the defaults if they do not exist or the custom directory
-// is not provided.
-func loadTemplates(customDir string) (*template.Template, error) {
-	t := template.New("").Funcs(template.FuncMap{
-		"ToUpper": strings.ToUpper,
-		"ToLower": strings.ToLower,
+// loadTemplates adds the Sign In and Error templates from the first of the
+// custom template directories they exist in, or uses the defaults if they do
+// not exist or no custom directory is provided.
+// Any other .html file of the directories is added as a template named after
+// the file, so that the pages can share them.
+// The templates translate their messages with the t function, eg.
+// {{ t .Language "Sign in with %s" .ProviderName }}.
+func loadTemplates(translations *translations, customDirs ...string) (*template.Template, error) {
+	t := template.New("").Funcs(templates.FuncMap()).Funcs(template.FuncMap{
+		"t": translations.translate,
 	})
 	var err error
-	t, err = addTemplate(t, customDir, signInTemplateName, defaultSignInTemplate)
+	t, err = addTemplate(t, customDirs, signInTemplateName, defaultSignInTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("could not add Sign In template: %v", err)
 	}
-	t, err = addTemplate(t, customDir, errorTemplateName, defaultErrorTemplate)
+	t, err = addTemplate(t, customDirs, errorTemplateName, defaultErrorTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("could not add Error template: %v", err)
 	}
+	t, err = addPartialTemplates(t, customDirs)
+	if err != nil {
+		return nil, fmt.Errorf("could not add partial templates: %v", err)
+	}
 
 	return t, nil
 }
 
-// addTemplate will add the template from the custom directory if provided,
+// addTemplate will add the template from the custom directories if provided,
 // else it will add the default template.
-func addTemplate(t *template.Template, customDir, fileName, defaultTemplate string) (*template.Template, error) {
-	filePath := filepath.Join(customDir, fileName)
-	if customDir != "" && isFile(filePath) {
+func addTemplate(t *template.Template, customDirs []string, fileName, defaultTemplate string) (*template.Template, error) {
+	if filePath, ok := findFile(customDirs, fileName); ok {
 		t, err := t.ParseFiles(filePath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse template %s: %v", filePath, err)
@@ -65,6 +80,130 @@ func addTemplate(t *template.Template, customDir, fileName, defaultTemplate stri
 	return t, nil
 }
 
+// addPartialTemplates adds the .html files of the custom directories other
+// than the Sign In and Error templates, each from the first directory it
+// exists in.
+func addPartialTemplates(t *template.Template, customDirs []string) (*template.Template, error) {
+	names := make(map[string]struct{})
+	for _, dir := range customDirs {
+		if dir == "" {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			names[filepath.Base(match)] = struct{}{}
+		}
+	}
+	delete(names, signInTemplateName)
+	delete(names, errorTemplateName)
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		filePath, ok := findFile(customDirs, name)
+		if !ok {
+			continue
+		}
+		var err error
+		t, err = t.ParseFiles(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", filePath, err)
+		}
+	}
+	return t, nil
+}
+
+// hostTemplates are the templates of the hosts branded with a directory in
+// the hosts subdirectory of the custom templates directory, by host name
+type hostTemplates map[string]*template.Template
+
+// loadHostTemplates loads the templates of each directory in the hosts
+// subdirectory of the custom templates directory.
+// The templates a host directory does not contain are loaded from the custom
+// templates directory, or use the defaults.
+func loadHostTemplates(translations *translations, customDir string) (hostTemplates, error) {
+	hosts := make(hostTemplates)
+	if customDir == "" {
+		return hosts, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(customDir, hostsDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return hosts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read host directories: %v", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t, err := loadTemplates(translations, filepath.Join(customDir, hostsDirName, entry.Name()), customDir)
+		if err != nil {
+			return nil, fmt.Errorf("could not load templates of host %s: %v", entry.Name(), err)
+		}
+		hosts[strings.ToLower(entry.Name())] = t
+	}
+	return hosts, nil
+}
+
+// page returns the template with the given name of each host
+func (h hostTemplates) page(name string) hostTemplates {
+	pages := make(hostTemplates, len(h))
+	for host, t := range h {
+		pages[host] = t.Lookup(name)
+	}
+	return pages
+}
+
+// forHost returns the template of the host, or the default template if the
+// host is not branded
+func (h hostTemplates) forHost(host string, defaultTemplate *template.Template) *template.Template {
+	if t, ok := h[hostName(host)]; ok {
+		return t
+	}
+	return defaultTemplate
+}
+
+// hostName returns the lower case name of the host, without its port
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(host)
+}
+
+// findFile returns the path of the file in the first of the directories it
+// exists in.
+// A missing file is only reported for the last directory, as the others fall
+// back on the directories after them.
+func findFile(dirs []string, fileName string) (string, bool) {
+	for i, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		filePath := filepath.Join(dir, fileName)
+		if i < len(dirs)-1 {
+			if info, err := os.Stat(filePath); err == nil && info.Mode().IsRegular() {
+				return filePath, true
+			}
+			continue
+		}
+		if isFile(filePath) {
+			return filePath, true
+		}
+	}
+	return "", false
+}
+
 // isFile checks if the file exists and checks whether it is a regular file.
 // If either of these fail then it cannot be used as a template file.
 func isFile(fileName string) bool {
@@ -39,10 +39,12 @@ var _ = Describe("Templates", func() {
 				ProxyPrefix string
 				Redirect    string
 				Footer      string
+				Language    string
 
 				// For default sign_in template
 				SignInMessage string
 				ProviderName  string
+				Providers     []SignInProvider
 				CustomLogin   bool
 				LogoData      string
 
@@ -58,6 +60,7 @@ var _ = Describe("Templates", func() {
 				ProxyPrefix: "<proxy-prefix>",
 				Redirect:    "<redirect>",
 				Footer:      "<footer>",
+				Language:    "en",
 
 				SignInMessage: "<sign-in-message>",
 				ProviderName:  "<provider-name>",
@@ -76,7 +79,7 @@ var _ = Describe("Templates", func() {
 		Context("With no custom directory", func() {
 			BeforeEach(func() {
 				var err error
-				t, err = loadTemplates("")
+				t, err = loadTemplates(nil, "")
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -97,7 +100,7 @@ var _ = Describe("Templates", func() {
 			Context("With both templates", func() {
 				BeforeEach(func() {
 					var err error
-					t, err = loadTemplates(customDir)
+					t, err = loadTemplates(nil, customDir)
 					Expect(err).ToNot(HaveOccurred())
 				})
 
@@ -119,7 +122,7 @@ var _ = Describe("Templates", func() {
 					Expect(os.Remove(filepath.Join(customDir, errorTemplateName))).To(Succeed())
 
 					var err error
-					t, err = loadTemplates(customDir)
+					t, err = loadTemplates(nil, customDir)
 					Expect(err).ToNot(HaveOccurred())
 				})
 
@@ -141,7 +144,7 @@ var _ = Describe("Templates", func() {
 					Expect(os.Remove(filepath.Join(customDir, signInTemplateName))).To(Succeed())
 
 					var err error
-					t, err = loadTemplates(customDir)
+					t, err = loadTemplates(nil, customDir)
 					Expect(err).ToNot(HaveOccurred())
 				})
 
@@ -165,7 +168,7 @@ var _ = Describe("Templates", func() {
 				})
 
 				It("Should return an error when loading templates", func() {
-					t, err := loadTemplates(customDir)
+					t, err := loadTemplates(nil, customDir)
 					Expect(err).To(MatchError(HavePrefix("could not add Sign In template:")))
 					Expect(t).To(BeNil())
 				})
@@ -178,7 +181,7 @@ var _ = Describe("Templates", func() {
 				})
 
 				It("Should return an error when loading templates", func() {
-					t, err := loadTemplates(customDir)
+					t, err := loadTemplates(nil, customDir)
 					Expect(err).To(MatchError(HavePrefix("could not add Error template:")))
 					Expect(t).To(BeNil())
 				})
@@ -186,6 +189,86 @@ var _ = Describe("Templates", func() {
 		})
 	})
 
+	Context("With partial templates", func() {
+		BeforeEach(func() {
+			signInFile := filepath.Join(customDir, signInTemplateName)
+			Expect(os.WriteFile(signInFile, []byte(`{{template "header.html" .}} sign in`), 0600)).To(Succeed())
+			headerFile := filepath.Join(customDir, "header.html")
+			Expect(os.WriteFile(headerFile, []byte(`{{.TestString}}`), 0600)).To(Succeed())
+		})
+
+		It("Adds the partial templates of the custom directory", func() {
+			t, err := loadTemplates(nil, customDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			buf := bytes.NewBuffer([]byte{})
+			Expect(t.ExecuteTemplate(buf, signInTemplateName, struct{ TestString string }{"Testing"})).To(Succeed())
+			Expect(buf.String()).To(Equal("Testing sign in"))
+		})
+
+		It("Should return an error with an invalid partial template", func() {
+			headerFile := filepath.Join(customDir, "header.html")
+			Expect(os.WriteFile(headerFile, []byte("{{"), 0600)).To(Succeed())
+
+			t, err := loadTemplates(nil, customDir)
+			Expect(err).To(MatchError(HavePrefix("could not add partial templates:")))
+			Expect(t).To(BeNil())
+		})
+
+		Context("loadHostTemplates", func() {
+			var hostDir string
+
+			BeforeEach(func() {
+				hostDir = filepath.Join(customDir, hostsDirName, "Auth.Example.com")
+				Expect(os.MkdirAll(hostDir, 0700)).To(Succeed())
+				headerFile := filepath.Join(hostDir, "header.html")
+				Expect(os.WriteFile(headerFile, []byte(`{{.TestString | ToUpper}}`), 0600)).To(Succeed())
+			})
+
+			It("Overrides the templates of the custom directory for the host", func() {
+				hosts, err := loadHostTemplates(nil, customDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hosts).To(HaveKey("auth.example.com"))
+
+				pages := hosts.page(signInTemplateName)
+				data := struct{ TestString string }{"Testing"}
+
+				buf := bytes.NewBuffer([]byte{})
+				Expect(pages.forHost("auth.example.com:443", nil).Execute(buf, data)).To(Succeed())
+				Expect(buf.String()).To(Equal("TESTING sign in"))
+
+				buf.Reset()
+				Expect(pages.forHost("AUTH.example.com", nil).ExecuteTemplate(buf, errorTemplateName, data)).To(Succeed())
+				Expect(buf.String()).To(Equal("Testing testing TESTING"))
+			})
+
+			It("Uses the default template for other hosts", func() {
+				hosts, err := loadHostTemplates(nil, customDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				defaultTemplate := template.New("default")
+				Expect(hosts.page(signInTemplateName).forHost("other.example.com", defaultTemplate)).To(Equal(defaultTemplate))
+			})
+
+			It("Should return an error with an invalid host template", func() {
+				signInFile := filepath.Join(hostDir, signInTemplateName)
+				Expect(os.WriteFile(signInFile, []byte("{{"), 0600)).To(Succeed())
+
+				hosts, err := loadHostTemplates(nil, customDir)
+				Expect(err).To(MatchError(HavePrefix("could not load templates of host Auth.Example.com:")))
+				Expect(hosts).To(BeNil())
+			})
+
+			It("Loads no host templates without a hosts directory", func() {
+				Expect(os.RemoveAll(filepath.Join(customDir, hostsDirName))).To(Succeed())
+
+				hosts, err := loadHostTemplates(nil, customDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hosts).To(BeEmpty())
+			})
+		})
+	})
+
 	Context("isFile", func() {
 		It("with a valid file", func() {
 			Expect(isFile(filepath.Join(customDir, signInTemplateName))).To(BeTrue())
@@ -0,0 +1,108 @@
+package pagewriter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// defaultLanguage is the language of the messages of the pages, used when
+// none of the translations matches the languages accepted by a request.
+var defaultLanguage = language.English
+
+// translations are the message catalogs translating the English messages of
+// the pages, by language
+type translations struct {
+	// catalogs maps the messages to their translation, by language
+	catalogs map[string]map[string]string
+
+	// languages are the languages of the matcher, the default language first
+	languages []string
+	matcher   language.Matcher
+}
+
+// loadTranslations loads the message catalogs of the translations directory.
+// Each catalog is a JSON object mapping the English messages to their
+// translation, in a file named after its language, eg. de.json or pt-BR.json.
+// Without a directory, the pages are only rendered in English.
+func loadTranslations(dir string) (*translations, error) {
+	t := &translations{
+		catalogs:  make(map[string]map[string]string),
+		languages: []string{defaultLanguage.String()},
+	}
+	tags := []language.Tag{defaultLanguage}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("could not list translations: %v", err)
+		}
+		for _, file := range files {
+			tag, err := language.Parse(strings.TrimSuffix(filepath.Base(file), ".json"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid language of translations %s: %v", file, err)
+			}
+			catalog, err := loadCatalog(file)
+			if err != nil {
+				return nil, err
+			}
+
+			t.catalogs[tag.String()] = catalog
+			if tag != defaultLanguage {
+				tags = append(tags, tag)
+				t.languages = append(t.languages, tag.String())
+			}
+		}
+	}
+	t.matcher = language.NewMatcher(tags)
+	return t, nil
+}
+
+// loadCatalog reads the messages and translations of a catalog file
+func loadCatalog(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read translations: %v", err)
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("could not parse translations %s: %v", file, err)
+	}
+	return catalog, nil
+}
+
+// match returns the language of the translations best matching the
+// Accept-Language header of a request, or the default language if none of
+// them is accepted
+func (t *translations) match(acceptLanguage string) string {
+	if t == nil || acceptLanguage == "" {
+		return defaultLanguage.String()
+	}
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return defaultLanguage.String()
+	}
+	_, index, confidence := t.matcher.Match(tags...)
+	if confidence == language.No {
+		return defaultLanguage.String()
+	}
+	return t.languages[index]
+}
+
+// translate returns the translation of the message in the language, or the
+// message itself if it has no translation.
+// When arguments are given, the translation is used as their format string.
+func (t *translations) translate(lang, message string, args ...interface{}) string {
+	if t != nil {
+		if translation, ok := t.catalogs[lang][message]; ok && translation != "" {
+			message = translation
+		}
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
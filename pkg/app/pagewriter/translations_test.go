@@ -0,0 +1,104 @@
+package pagewriter
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Translations", func() {
+	var translationsDir string
+
+	BeforeEach(func() {
+		var err error
+		translationsDir, err = os.MkdirTemp("", "oauth2-proxy-translations-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(translationsDir, "de.json"), []byte(`{
+			"Sign in with %s": "Mit %s anmelden",
+			"Forbidden": "Verboten"
+		}`), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(translationsDir, "pt-BR.json"), []byte(`{
+			"Forbidden": "Proibido"
+		}`), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(translationsDir)).To(Succeed())
+	})
+
+	Context("match", func() {
+		var t *translations
+
+		BeforeEach(func() {
+			var err error
+			t, err = loadTranslations(translationsDir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		DescribeTable("selects the language of the request",
+			func(acceptLanguage, expected string) {
+				Expect(t.match(acceptLanguage)).To(Equal(expected))
+			},
+			Entry("without an Accept-Language header", "", "en"),
+			Entry("with a translated language", "de", "de"),
+			Entry("with a regional variant of a translated language", "de-AT,en;q=0.5", "de"),
+			Entry("with the most preferred language", "en;q=0.5,pt-BR;q=0.8,de;q=0.1", "pt-BR"),
+			Entry("with an untranslated language", "fr-FR,fr;q=0.9", "en"),
+			Entry("with an invalid header", "!!!", "en"),
+		)
+
+		It("selects the default language without translations", func() {
+			var none *translations
+			Expect(none.match("de")).To(Equal("en"))
+		})
+	})
+
+	Context("translate", func() {
+		It("translates the messages of the catalog", func() {
+			t, err := loadTranslations(translationsDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(t.translate("de", "Sign in with %s", "Google")).To(Equal("Mit Google anmelden"))
+			Expect(t.translate("pt-BR", "Forbidden")).To(Equal("Proibido"))
+		})
+
+		It("keeps the messages without a translation", func() {
+			t, err := loadTranslations(translationsDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(t.translate("de", "Username")).To(Equal("Username"))
+			Expect(t.translate("en", "Sign in with %s", "Google")).To(Equal("Sign in with Google"))
+		})
+
+		It("keeps the messages without translations", func() {
+			var none *translations
+			Expect(none.translate("de", "100%")).To(Equal("100%"))
+		})
+	})
+
+	Context("loadTranslations", func() {
+		It("loads no catalogs without a directory", func() {
+			t, err := loadTranslations("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t.catalogs).To(BeEmpty())
+			Expect(t.match("de")).To(Equal("en"))
+		})
+
+		It("returns an error for an invalid language", func() {
+			Expect(os.WriteFile(filepath.Join(translationsDir, "not a language.json"), []byte(`{}`), 0600)).To(Succeed())
+
+			_, err := loadTranslations(translationsDir)
+			Expect(err).To(MatchError(HavePrefix("invalid language of translations")))
+		})
+
+		It("returns an error for an invalid catalog", func() {
+			Expect(os.WriteFile(filepath.Join(translationsDir, "fr.json"), []byte(`["Interdit"]`), 0600)).To(Succeed())
+
+			_, err := loadTranslations(translationsDir)
+			Expect(err).To(MatchError(HavePrefix("could not parse translations")))
+		})
+	})
+})
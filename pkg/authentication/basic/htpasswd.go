@@ -3,20 +3,27 @@ package basic
 import (
 	// We support SHA1 & bcrypt in HTPasswd
 	"crypto/sha1" // #nosec G505
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
 )
 
 // htpasswdMap represents the structure of an htpasswd file.
-// Passwords must be generated with -B for bcrypt or -s for SHA1.
+// Passwords must be generated with -B for bcrypt or -s for SHA1, or be
+// scrypt or argon2id hashes in the PHC string format.
 type htpasswdMap struct {
 	users map[string]interface{}
 	rwm   sync.RWMutex
@@ -30,17 +37,39 @@ type bcryptPass string
 // htpasswdMap users.
 type sha1Pass string
 
+// argon2idPass is an argon2id hash, in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<hash>
+type argon2idPass struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	hash    []byte
+}
+
+// scryptPass is an scrypt hash, in the PHC string format:
+// $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>$<salt>$<hash>
+type scryptPass struct {
+	logN int
+	r    int
+	p    int
+	salt []byte
+	hash []byte
+}
+
 // NewHTPasswdValidator constructs an httpasswd based validator from the file
-// at the path given.
-func NewHTPasswdValidator(path string) (Validator, error) {
+// at the path given, reloading it when it changes until done is closed.
+// Users with bcrypt entries of a lower cost than bcryptMinCost are reported
+// so that their passwords can be rehashed.
+func NewHTPasswdValidator(path string, done <-chan bool, bcryptMinCost int) (Validator, error) {
 	h := &htpasswdMap{users: make(map[string]interface{})}
 
-	if err := h.loadHTPasswdFile(path); err != nil {
+	if err := h.loadHTPasswdFile(path, bcryptMinCost); err != nil {
 		return nil, fmt.Errorf("could not load htpasswd file: %v", err)
 	}
 
-	if err := watcher.WatchFileForUpdates(path, nil, func() {
-		err := h.loadHTPasswdFile(path)
+	if err := watcher.WatchFileForUpdates(path, done, func() {
+		err := h.loadHTPasswdFile(path, bcryptMinCost)
 		if err != nil {
 			logger.Errorf("%v: no changes were made to the current htpasswd map", err)
 		}
@@ -51,8 +80,26 @@ func NewHTPasswdValidator(path string) (Validator, error) {
 	return h, nil
 }
 
-// loadHTPasswdFile loads htpasswd entries from an io.Reader (an opened file) into a htpasswdMap.
-func (h *htpasswdMap) loadHTPasswdFile(filename string) error {
+// NewHTPasswdValidatorFromEnv constructs an httpasswd based validator from
+// the entries in the environment variable given, such as one set from a
+// Kubernetes Secret.
+func NewHTPasswdValidatorFromEnv(name string, bcryptMinCost int) (Validator, error) {
+	h := &htpasswdMap{users: make(map[string]interface{})}
+
+	entries, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("could not load htpasswd entries: environment variable %s is not set", name)
+	}
+	if err := h.loadHTPasswd(strings.NewReader(entries), bcryptMinCost); err != nil {
+		return nil, fmt.Errorf("could not load htpasswd entries from environment variable %s: %v", name, err)
+	}
+
+	return h, nil
+}
+
+// loadHTPasswdFile loads htpasswd entries from the file at the path given
+// into a htpasswdMap.
+func (h *htpasswdMap) loadHTPasswdFile(filename string, bcryptMinCost int) error {
 	// We allow HTPasswd location via config options
 	r, err := os.Open(filename) // #nosec G304
 	if err != nil {
@@ -65,6 +112,11 @@ func (h *htpasswdMap) loadHTPasswdFile(filename string) error {
 		}
 	}(r)
 
+	return h.loadHTPasswd(r, bcryptMinCost)
+}
+
+// loadHTPasswd loads htpasswd entries from an io.Reader into a htpasswdMap.
+func (h *htpasswdMap) loadHTPasswd(r io.Reader, bcryptMinCost int) error {
 	csvReader := csv.NewReader(r)
 	csvReader.Comma = ':'
 	csvReader.Comment = '#'
@@ -79,6 +131,7 @@ func (h *htpasswdMap) loadHTPasswdFile(filename string) error {
 	if err != nil {
 		return fmt.Errorf("htpasswd entries error: %v", err)
 	}
+	updated.reportBcryptCost(bcryptMinCost)
 
 	h.rwm.Lock()
 	h.users = updated.users
@@ -98,7 +151,7 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 		switch {
 		case lr == 2:
 			user, realPassword := record[0], record[1]
-			invalidEntries = passShaOrBcrypt(h, user, realPassword)
+			invalidEntries = append(invalidEntries, addPassword(h, user, realPassword)...)
 		case lr == 1, lr > 2:
 			invalidRecords = append(invalidRecords, record[0])
 		}
@@ -109,7 +162,7 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 	}
 
 	if len(invalidEntries) > 0 {
-		return h, fmt.Errorf("'%+q' user(s) could not be added: invalid password, must be a SHA or bcrypt entry", invalidEntries)
+		return h, fmt.Errorf("'%+q' user(s) could not be added: invalid password, must be a SHA, bcrypt, scrypt or argon2id entry", invalidEntries)
 	}
 
 	if len(h.users) == 0 {
@@ -119,9 +172,9 @@ func createHtpasswdMap(records [][]string) (*htpasswdMap, error) {
 	return h, nil
 }
 
-// passShaOrBcrypt checks if a htpasswd entry is valid and the password is encrypted with SHA or bcrypt.
-// Valid user entries are saved in the htpasswdMap, invalid records are reurned.
-func passShaOrBcrypt(h *htpasswdMap, user, password string) (invalidEntries []string) {
+// addPassword checks if a htpasswd entry is valid and the password is hashed with SHA, bcrypt, scrypt or argon2id.
+// Valid user entries are saved in the htpasswdMap, invalid records are returned.
+func addPassword(h *htpasswdMap, user, password string) (invalidEntries []string) {
 	passLen := len(password)
 	switch {
 	case passLen > 6 && password[:5] == "{SHA}":
@@ -132,6 +185,18 @@ func passShaOrBcrypt(h *htpasswdMap, user, password string) (invalidEntries []st
 			password[:4] == "$2x$" ||
 			password[:4] == "$2a$"):
 		h.users[user] = bcryptPass(password)
+	case strings.HasPrefix(password, "$argon2id$"):
+		pass, err := parseArgon2idPass(password)
+		if err != nil {
+			return append(invalidEntries, user)
+		}
+		h.users[user] = pass
+	case strings.HasPrefix(password, "$scrypt$"):
+		pass, err := parseScryptPass(password)
+		if err != nil {
+			return append(invalidEntries, user)
+		}
+		h.users[user] = pass
 	default:
 		invalidEntries = append(invalidEntries, user)
 	}
@@ -139,6 +204,116 @@ func passShaOrBcrypt(h *htpasswdMap, user, password string) (invalidEntries []st
 	return invalidEntries
 }
 
+// parseArgon2idPass parses an argon2id hash in the PHC string format
+func parseArgon2idPass(password string) (*argon2idPass, error) {
+	parts := strings.Split(password, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+	params, err := parsePHCParams(parts[3], "m", "t", "p")
+	if err != nil {
+		return nil, err
+	}
+	if params["p"] > 255 {
+		return nil, fmt.Errorf("invalid argon2id parallelism %d", params["p"])
+	}
+	salt, hash, err := decodePHCSaltAndHash(parts[4], parts[5])
+	if err != nil {
+		return nil, err
+	}
+	return &argon2idPass{
+		memory:  uint32(params["m"]),
+		time:    uint32(params["t"]),
+		threads: uint8(params["p"]),
+		salt:    salt,
+		hash:    hash,
+	}, nil
+}
+
+// parseScryptPass parses an scrypt hash in the PHC string format
+func parseScryptPass(password string) (*scryptPass, error) {
+	parts := strings.Split(password, "$")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid scrypt hash")
+	}
+	params, err := parsePHCParams(parts[2], "ln", "r", "p")
+	if err != nil {
+		return nil, err
+	}
+	if params["ln"] > 30 {
+		return nil, fmt.Errorf("invalid scrypt cost %d", params["ln"])
+	}
+	salt, hash, err := decodePHCSaltAndHash(parts[3], parts[4])
+	if err != nil {
+		return nil, err
+	}
+	return &scryptPass{
+		logN: int(params["ln"]),
+		r:    int(params["r"]),
+		p:    int(params["p"]),
+		salt: salt,
+		hash: hash,
+	}, nil
+}
+
+// parsePHCParams parses the positive integer parameters of a PHC string,
+// such as m=65536,t=3,p=4, which must all be set
+func parsePHCParams(s string, names ...string) (map[string]uint64, error) {
+	params := make(map[string]uint64, len(names))
+	for _, param := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid hash parameter %q", param)
+		}
+		params[name] = n
+	}
+	for _, name := range names {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("missing hash parameter %q", name)
+		}
+	}
+	return params, nil
+}
+
+// decodePHCSaltAndHash decodes the salt and hash of a PHC string, which are
+// base64 encoded without padding. The '.' of the adapted base64 encoding
+// used by passlib is accepted in place of '+'.
+func decodePHCSaltAndHash(salt, hash string) ([]byte, []byte, error) {
+	decode := func(s string) ([]byte, error) {
+		return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, ".", "+"))
+	}
+	decodedSalt, err := decode(salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid hash salt: %v", err)
+	}
+	decodedHash, err := decode(hash)
+	if err != nil || len(decodedHash) == 0 {
+		return nil, nil, fmt.Errorf("invalid hash")
+	}
+	return decodedSalt, decodedHash, nil
+}
+
+// reportBcryptCost logs the users whose bcrypt entries have a lower cost
+// than the minimum, so that their passwords can be rehashed
+func (h *htpasswdMap) reportBcryptCost(minCost int) {
+	if minCost <= 0 {
+		return
+	}
+	var users []string
+	for user, password := range h.users {
+		if bp, ok := password.(bcryptPass); ok {
+			if cost, err := bcrypt.Cost([]byte(bp)); err == nil && cost < minCost {
+				users = append(users, user)
+			}
+		}
+	}
+	if len(users) > 0 {
+		sort.Strings(users)
+		logger.Printf("WARNING: the bcrypt cost of the htpasswd entries of %q is lower than %d, their passwords should be rehashed with \"htpasswd -B -C %d\"", users, minCost, minCost)
+	}
+}
+
 // GetUsers return a "thread safe" copy of the internal user list
 func (h *htpasswdMap) GetUsers() map[string]interface{} {
 	newUserList := make(map[string]interface{})
@@ -152,7 +327,9 @@ func (h *htpasswdMap) GetUsers() map[string]interface{} {
 
 // Validate checks a users password against the htpasswd entries
 func (h *htpasswdMap) Validate(user string, password string) bool {
+	h.rwm.RLock()
 	realPassword, exists := h.users[user]
+	h.rwm.RUnlock()
 	if !exists {
 		return false
 	}
@@ -168,6 +345,15 @@ func (h *htpasswdMap) Validate(user string, password string) bool {
 		return string(rp) == base64.StdEncoding.EncodeToString(d.Sum(nil))
 	case bcryptPass:
 		return bcrypt.CompareHashAndPassword([]byte(rp), []byte(password)) == nil
+	case *argon2idPass:
+		hash := argon2.IDKey([]byte(password), rp.salt, rp.time, rp.memory, rp.threads, uint32(len(rp.hash)))
+		return subtle.ConstantTimeCompare(hash, rp.hash) == 1
+	case *scryptPass:
+		hash, err := scrypt.Key([]byte(password), rp.salt, 1<<rp.logN, rp.r, rp.p, len(rp.hash))
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(hash, rp.hash) == 1
 	default:
 		return false
 	}
@@ -36,7 +36,7 @@ var _ = Describe("HTPasswd Suite", func() {
 
 			BeforeEach(func() {
 				var validator Validator
-				validator, err = NewHTPasswdValidator(filePath)
+				validator, err = NewHTPasswdValidator(filePath, nil, 0)
 
 				var ok bool
 				htpasswd, ok = validator.(*htpasswdMap)
@@ -88,13 +88,47 @@ var _ = Describe("HTPasswd Suite", func() {
 				assertHtpasswdMapFromFile(filePath)
 			})
 
+			Context("with argon2id entries", func() {
+				const filePath = "./test/htpasswd-argon2id.txt"
+
+				assertHtpasswdMapFromFile(filePath)
+			})
+
+			Context("with scrypt entries", func() {
+				const filePath = "./test/htpasswd-scrypt.txt"
+
+				assertHtpasswdMapFromFile(filePath)
+			})
+
+			Context("with bcrypt entries of a lower cost than the minimum", func() {
+				It("loads the entries", func() {
+					validator, err := NewHTPasswdValidator("./test/htpasswd-bcrypt.txt", nil, 10)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				})
+			})
+
+			Context("with an invalid argon2id entry", func() {
+				It("returns an error", func() {
+					file, err := os.CreateTemp("", "htpasswd-invalid-argon2id-")
+					Expect(err).ToNot(HaveOccurred())
+					fileNames = append(fileNames, file.Name())
+					_, err = file.WriteString("admin:$argon2id$v=19$m=1024,t=1$c2FsdA$aGFzaA\n")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(file.Close()).To(Succeed())
+
+					_, err = NewHTPasswdValidator(file.Name(), nil, 0)
+					Expect(err).To(MatchError("could not load htpasswd file: htpasswd entries error: '[\"admin\"]' user(s) could not be added: invalid password, must be a SHA, bcrypt, scrypt or argon2id entry"))
+				})
+			})
+
 			Context("with a non existent file", func() {
 				const filePath = "./test/htpasswd-doesnt-exist.txt"
 				var validator Validator
 				var err error
 
 				BeforeEach(func() {
-					validator, err = NewHTPasswdValidator(filePath)
+					validator, err = NewHTPasswdValidator(filePath, nil, 0)
 				})
 
 				It("returns an error", func() {
@@ -129,7 +163,7 @@ var _ = Describe("HTPasswd Suite", func() {
 					_, err = file.WriteString(adminUserHtpasswdEntry + "\n")
 					Expect(err).ToNot(HaveOccurred())
 
-					validator, err = NewHTPasswdValidator(file.Name())
+					validator, err = NewHTPasswdValidator(file.Name(), nil, 0)
 					Expect(err).ToNot(HaveOccurred())
 
 					htpasswd, ok := validator.(*htpasswdMap)
@@ -173,5 +207,31 @@ var _ = Describe("HTPasswd Suite", func() {
 
 			})
 		})
+
+		Context("load from an environment variable", func() {
+			const envName = "OAUTH2_PROXY_TEST_HTPASSWD"
+
+			AfterEach(func() {
+				Expect(os.Unsetenv(envName)).To(Succeed())
+			})
+
+			It("accepts the correct passwords", func() {
+				entries, err := os.ReadFile("./test/htpasswd-mixed.txt")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.Setenv(envName, string(entries))).To(Succeed())
+
+				validator, err := NewHTPasswdValidatorFromEnv(envName, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(validator.Validate(adminUser, adminPassword)).To(BeTrue())
+				Expect(validator.Validate(user1, user1Password)).To(BeTrue())
+				Expect(validator.Validate(user2, "12345")).To(BeFalse())
+			})
+
+			It("returns an error when the variable is not set", func() {
+				validator, err := NewHTPasswdValidatorFromEnv(envName, 0)
+				Expect(err).To(MatchError("could not load htpasswd entries: environment variable OAUTH2_PROXY_TEST_HTPASSWD is not set"))
+				Expect(validator).To(BeNil())
+			})
+		})
 	})
 })
@@ -0,0 +1,186 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// lockoutMinDelay is how long attempts are rejected for after the first
+	// failed attempt, doubling with each further failure until the threshold
+	lockoutMinDelay = time.Second
+
+	// lockoutMaxShift caps the doublings of the delays, so that they do not
+	// overflow
+	lockoutMaxShift = 30
+)
+
+// ErrInvalidCredentials is returned for credentials rejected by the Validator
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LockedOutError is returned for attempts made while the username or client
+// is locked out by earlier failed attempts
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedOutError) Error() string {
+	return fmt.Sprintf("too many failed attempts, locked out for another %s", e.RetryAfter.Round(time.Second))
+}
+
+// Lockout tracks the failed attempts of each username and client, and
+// rejects further attempts for a delay doubling with each failure, so that
+// passwords cannot be guessed at speed.
+// A nil Lockout validates every attempt.
+type Lockout struct {
+	threshold   int
+	duration    time.Duration
+	maxDuration time.Duration
+	client      func(*http.Request) string
+	clock       clock.Clock
+
+	mu        sync.Mutex
+	attempts  map[string]*failedAttempts
+	lastSweep time.Time
+}
+
+// failedAttempts are the consecutive failed attempts of a username or client
+type failedAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// NewLockout creates a Lockout identifying the client of each request with
+// the client function, or nil when lockouts are disabled
+func NewLockout(opts options.HtpasswdLockout, client func(*http.Request) string) *Lockout {
+	if opts.Threshold <= 0 {
+		return nil
+	}
+	return &Lockout{
+		threshold:   opts.Threshold,
+		duration:    opts.Duration,
+		maxDuration: opts.MaxDuration,
+		client:      client,
+		attempts:    make(map[string]*failedAttempts),
+	}
+}
+
+// Validate validates the credentials sent with the request, unless the
+// username or the client are locked out, recording the outcome.
+// It returns ErrInvalidCredentials when the Validator rejects the
+// credentials, and a LockedOutError when the attempt was not validated.
+func (l *Lockout) Validate(req *http.Request, validator Validator, user, password string) error {
+	if l == nil {
+		if validator.Validate(user, password) {
+			return nil
+		}
+		return ErrInvalidCredentials
+	}
+
+	keys := []string{"user:" + user, "client:" + l.client(req)}
+	if retryAfter := l.lockedOut(keys); retryAfter > 0 {
+		logger.PrintAuthf(user, req, logger.AuthFailure, "Rejected htpasswd login while locked out for another %s", retryAfter.Round(time.Second))
+		return &LockedOutError{RetryAfter: retryAfter}
+	}
+
+	if validator.Validate(user, password) {
+		l.succeed(keys)
+		return nil
+	}
+	if failures := l.fail(keys); failures >= l.threshold {
+		logger.PrintAuthf(user, req, logger.AuthFailure, "Locked out of htpasswd logins after %d failed attempts", failures)
+	}
+	return ErrInvalidCredentials
+}
+
+// lockedOut returns how long until attempts for all of the keys are
+// accepted again, or zero if they are
+func (l *Lockout) lockedOut(keys []string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	var retryAfter time.Duration
+	for _, key := range keys {
+		if a, ok := l.attempts[key]; ok && a.lockedUntil.After(now) {
+			retryAfter = max(retryAfter, a.lockedUntil.Sub(now))
+		}
+	}
+	return retryAfter
+}
+
+// succeed forgets the failed attempts of the keys
+func (l *Lockout) succeed(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		delete(l.attempts, key)
+	}
+}
+
+// fail records a failed attempt for each of the keys, delaying their next
+// attempts, and returns the highest number of consecutive failures among
+// them
+func (l *Lockout) fail(keys []string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	highest := 0
+	for _, key := range keys {
+		a, ok := l.attempts[key]
+		if !ok || l.expired(a, now) {
+			a = &failedAttempts{}
+			l.attempts[key] = a
+		}
+		a.failures++
+		a.lockedUntil = now.Add(l.delay(a.failures))
+		highest = max(highest, a.failures)
+	}
+	return highest
+}
+
+// delay returns how long attempts are rejected for after the number of
+// consecutive failures
+func (l *Lockout) delay(failures int) time.Duration {
+	if failures < l.threshold {
+		return min(l.duration, doubled(lockoutMinDelay, failures-1))
+	}
+	return min(l.maxDuration, doubled(l.duration, failures-l.threshold))
+}
+
+// sweep forgets the expired failed attempts, once per maximum lockout, so
+// that the attempts of past clients do not accumulate
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.maxDuration {
+		return
+	}
+	l.lastSweep = now
+	for key, a := range l.attempts {
+		if l.expired(a, now) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// expired returns whether the failed attempts are forgotten, once the
+// maximum lockout has passed since the end of their last delay or lockout
+func (l *Lockout) expired(a *failedAttempts, now time.Time) bool {
+	return now.Sub(a.lockedUntil) >= l.maxDuration
+}
+
+// doubled returns the duration doubled the number of times
+func doubled(d time.Duration, times int) time.Duration {
+	times = min(times, lockoutMaxShift)
+	return d << times
+}
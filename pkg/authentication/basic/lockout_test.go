@@ -0,0 +1,127 @@
+package basic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// staticValidator accepts the password of a single user
+type staticValidator struct {
+	user     string
+	password string
+}
+
+func (v staticValidator) Validate(user, password string) bool {
+	return user == v.user && password == v.password
+}
+
+var _ = Describe("Lockout Suite", func() {
+	validator := staticValidator{user: adminUser, password: adminPassword}
+
+	var lockout *Lockout
+
+	BeforeEach(func() {
+		lockout = NewLockout(options.HtpasswdLockout{
+			Threshold:   3,
+			Duration:    time.Minute,
+			MaxDuration: 4 * time.Minute,
+		}, func(req *http.Request) string {
+			return req.RemoteAddr
+		})
+		lockout.clock.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	validate := func(client, user, password string) error {
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/sign_in", nil)
+		req.RemoteAddr = client
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		return lockout.Validate(req, validator, user, password)
+	}
+
+	advance := func(d time.Duration) {
+		Expect(lockout.clock.Add(d)).To(Succeed())
+	}
+
+	expectLockedOut := func(err error, retryAfter time.Duration) {
+		var lockedOut *LockedOutError
+		Expect(err).To(BeAssignableToTypeOf(lockedOut))
+		Expect(err.(*LockedOutError).RetryAfter).To(Equal(retryAfter))
+	}
+
+	It("validates the credentials", func() {
+		Expect(validate("10.0.0.1", adminUser, adminPassword)).To(Succeed())
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+	})
+
+	It("delays the attempts after each failure, doubling the delay", func() {
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		expectLockedOut(validate("10.0.0.1", adminUser, adminPassword), time.Second)
+
+		advance(time.Second)
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		expectLockedOut(validate("10.0.0.1", adminUser, adminPassword), 2*time.Second)
+	})
+
+	It("locks out once the threshold is reached, doubling the lockouts up to the maximum", func() {
+		for _, delay := range []time.Duration{time.Second, 2 * time.Second} {
+			Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+			advance(delay)
+		}
+
+		for _, lockedOut := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+			Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+			expectLockedOut(validate("10.0.0.1", adminUser, adminPassword), lockedOut)
+			advance(lockedOut)
+		}
+
+		Expect(validate("10.0.0.1", adminUser, adminPassword)).To(Succeed())
+	})
+
+	It("tracks the usernames and the clients separately", func() {
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+
+		// The username is locked out from other clients
+		expectLockedOut(validate("10.0.0.2", adminUser, adminPassword), time.Second)
+		// The client is locked out for other usernames
+		expectLockedOut(validate("10.0.0.1", user1, user1Password), time.Second)
+		// Other usernames from other clients are not
+		Expect(validate("10.0.0.2", user1, "wrong")).To(MatchError(ErrInvalidCredentials))
+	})
+
+	It("forgets the failures after a success", func() {
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		advance(time.Second)
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		advance(2 * time.Second)
+		Expect(validate("10.0.0.1", adminUser, adminPassword)).To(Succeed())
+
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		expectLockedOut(validate("10.0.0.1", adminUser, adminPassword), time.Second)
+	})
+
+	It("forgets the failures once the maximum lockout has passed", func() {
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		advance(time.Second + 4*time.Minute)
+		Expect(validate("10.0.0.2", user1, "wrong")).To(MatchError(ErrInvalidCredentials))
+		Expect(lockout.attempts).ToNot(HaveKey("user:" + adminUser))
+
+		Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		expectLockedOut(validate("10.0.0.1", adminUser, adminPassword), time.Second)
+	})
+
+	It("validates every attempt when disabled", func() {
+		lockout = NewLockout(options.HtpasswdLockout{}, nil)
+		Expect(lockout).To(BeNil())
+
+		for i := 0; i < 10; i++ {
+			Expect(validate("10.0.0.1", adminUser, "wrong")).To(MatchError(ErrInvalidCredentials))
+		}
+		Expect(validate("10.0.0.1", adminUser, adminPassword)).To(Succeed())
+	})
+})
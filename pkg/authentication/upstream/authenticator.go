@@ -0,0 +1,79 @@
+package upstream
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// Authenticator authenticates the requests upstream applications make to the
+// proxy, either with a shared bearer secret or with a client certificate
+// issued by one of the configured certificate authorities
+type Authenticator struct {
+	secret    []byte
+	clientCAs *x509.CertPool
+}
+
+// NewAuthenticator creates an Authenticator from the upstream logout options
+func NewAuthenticator(opts options.UpstreamLogout) (*Authenticator, error) {
+	a := &Authenticator{}
+	if opts.Secret != "" {
+		a.secret = []byte(opts.Secret)
+	}
+
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA file: %v", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", opts.ClientCAFile)
+		}
+	}
+
+	if a.secret == nil && a.clientCAs == nil {
+		return nil, errors.New("a secret or a client CA file is required")
+	}
+	return a, nil
+}
+
+// Authenticate returns whether the request carries the secret or a client
+// certificate issued by one of the certificate authorities
+func (a *Authenticator) Authenticate(req *http.Request) bool {
+	return a.hasSecret(req) || a.hasClientCert(req)
+}
+
+func (a *Authenticator) hasSecret(req *http.Request) bool {
+	if a.secret == nil {
+		return false
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), a.secret) == 1
+}
+
+func (a *Authenticator) hasClientCert(req *http.Request) bool {
+	if a.clientCAs == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := req.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         a.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
@@ -0,0 +1,153 @@
+package upstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticator", func() {
+	newCert := func(name string, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		if parent == nil {
+			template.IsCA = true
+			template.BasicConstraintsValid = true
+			template.KeyUsage = x509.KeyUsageCertSign
+			parent, parentKey = template, key
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+		return cert, key
+	}
+
+	var ca, otherCA *x509.Certificate
+	var caKey, otherCAKey *ecdsa.PrivateKey
+	var caFile string
+
+	BeforeEach(func() {
+		ca, caKey = newCert("ca", x509.ExtKeyUsageAny, nil, nil)
+		otherCA, otherCAKey = newCert("other-ca", x509.ExtKeyUsageAny, nil, nil)
+
+		caFile = filepath.Join(GinkgoT().TempDir(), "ca.pem")
+		Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600)).To(Succeed())
+	})
+
+	Context("NewAuthenticator", func() {
+		It("requires a secret or a client CA file", func() {
+			_, err := NewAuthenticator(options.UpstreamLogout{})
+			Expect(err).To(MatchError("a secret or a client CA file is required"))
+		})
+
+		It("fails when the client CA file has no certificates", func() {
+			emptyFile := filepath.Join(GinkgoT().TempDir(), "empty.pem")
+			Expect(os.WriteFile(emptyFile, []byte("not a certificate"), 0600)).To(Succeed())
+
+			_, err := NewAuthenticator(options.UpstreamLogout{ClientCAFile: emptyFile})
+			Expect(err).To(MatchError("no certificates found in client CA file " + emptyFile))
+		})
+	})
+
+	type authenticateTableInput struct {
+		opts          options.UpstreamLogout
+		authorization string
+		clientCert    func() *x509.Certificate
+		expected      bool
+	}
+
+	DescribeTable("Authenticate",
+		func(in authenticateTableInput) {
+			if in.opts.ClientCAFile == "ca" {
+				in.opts.ClientCAFile = caFile
+			}
+			authenticator, err := NewAuthenticator(in.opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			req, err := http.NewRequest(http.MethodPost, "https://proxy.localhost/oauth2/upstream_logout", nil)
+			Expect(err).ToNot(HaveOccurred())
+			if in.authorization != "" {
+				req.Header.Set("Authorization", in.authorization)
+			}
+			if in.clientCert != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{in.clientCert()}}
+			}
+
+			Expect(authenticator.Authenticate(req)).To(Equal(in.expected))
+		},
+		Entry("with the secret", authenticateTableInput{
+			opts:          options.UpstreamLogout{Secret: "secret"},
+			authorization: "Bearer secret",
+			expected:      true,
+		}),
+		Entry("with a different secret", authenticateTableInput{
+			opts:          options.UpstreamLogout{Secret: "secret"},
+			authorization: "Bearer other",
+			expected:      false,
+		}),
+		Entry("with the secret in basic auth", authenticateTableInput{
+			opts:          options.UpstreamLogout{Secret: "secret"},
+			authorization: "Basic secret",
+			expected:      false,
+		}),
+		Entry("without credentials", authenticateTableInput{
+			opts:     options.UpstreamLogout{Secret: "secret", ClientCAFile: "ca"},
+			expected: false,
+		}),
+		Entry("with a client certificate issued by the CA", authenticateTableInput{
+			opts: options.UpstreamLogout{ClientCAFile: "ca"},
+			clientCert: func() *x509.Certificate {
+				cert, _ := newCert("app", x509.ExtKeyUsageClientAuth, ca, caKey)
+				return cert
+			},
+			expected: true,
+		}),
+		Entry("with a server certificate issued by the CA", authenticateTableInput{
+			opts: options.UpstreamLogout{ClientCAFile: "ca"},
+			clientCert: func() *x509.Certificate {
+				cert, _ := newCert("app", x509.ExtKeyUsageServerAuth, ca, caKey)
+				return cert
+			},
+			expected: false,
+		}),
+		Entry("with a client certificate issued by another CA", authenticateTableInput{
+			opts: options.UpstreamLogout{ClientCAFile: "ca"},
+			clientCert: func() *x509.Certificate {
+				cert, _ := newCert("app", x509.ExtKeyUsageClientAuth, otherCA, otherCAKey)
+				return cert
+			},
+			expected: false,
+		}),
+		Entry("with a client certificate when only the secret is configured", authenticateTableInput{
+			opts: options.UpstreamLogout{Secret: "secret"},
+			clientCert: func() *x509.Certificate {
+				cert, _ := newCert("app", x509.ExtKeyUsageClientAuth, ca, caKey)
+				return cert
+			},
+			expected: false,
+		}),
+	)
+})
@@ -0,0 +1,56 @@
+// Package chaos injects latency and errors into provider calls, the session
+// store and upstream proxying for resilience testing.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrInjected is returned by operations failed by fault injection
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Fault describes the latency and errors to inject into an operation
+type Fault struct {
+	// Latency is added to LatencyPercentage percent of operations
+	Latency           time.Duration
+	LatencyPercentage int
+
+	// ErrorPercentage percent of operations fail with ErrInjected
+	ErrorPercentage int
+}
+
+// Enabled returns true if the Fault injects anything
+func (f Fault) Enabled() bool {
+	return (f.Latency > 0 && f.LatencyPercentage > 0) || f.ErrorPercentage > 0
+}
+
+// Inject applies the Fault to a single operation. It waits for the injected
+// latency, if any, and then returns ErrInjected if the operation should fail.
+// If the context is done while waiting, the context error is returned.
+func (f Fault) Inject(ctx context.Context) error {
+	if f.Latency > 0 && roll(f.LatencyPercentage) {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if roll(f.ErrorPercentage) {
+		return ErrInjected
+	}
+	return nil
+}
+
+// roll returns true with the given percentage probability
+func roll(percentage int) bool {
+	if percentage <= 0 {
+		return false
+	}
+	return rand.Intn(100) < percentage // #nosec G404 -- fault injection does not need a secure source
+}
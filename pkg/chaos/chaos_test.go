@@ -0,0 +1,132 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chaos Tests", func() {
+	Context("Fault", func() {
+		It("is disabled by default", func() {
+			Expect(Fault{}.Enabled()).To(BeFalse())
+			Expect(Fault{Latency: time.Second}.Enabled()).To(BeFalse())
+			Expect(Fault{Latency: time.Second, LatencyPercentage: 1}.Enabled()).To(BeTrue())
+			Expect(Fault{ErrorPercentage: 1}.Enabled()).To(BeTrue())
+			Expect(Fault{}.Inject(context.Background())).To(Succeed())
+		})
+
+		It("injects errors", func() {
+			Expect(Fault{ErrorPercentage: 100}.Inject(context.Background())).To(MatchError(ErrInjected))
+		})
+
+		It("injects latency", func() {
+			start := time.Now()
+			Expect(Fault{Latency: 20 * time.Millisecond, LatencyPercentage: 100}.Inject(context.Background())).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 20*time.Millisecond))
+		})
+
+		It("stops waiting when the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := Fault{Latency: time.Hour, LatencyPercentage: 100}.Inject(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("NewTransport", func() {
+		It("fails requests without reaching the server", func() {
+			called := false
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				called = true
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewTransport(Fault{ErrorPercentage: 100}, nil)}
+			_, err := client.Get(server.URL)
+			Expect(errors.Is(err, ErrInjected)).To(BeTrue())
+			Expect(called).To(BeFalse())
+
+			client = &http.Client{Transport: NewTransport(Fault{}, nil)}
+			resp, err := client.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(called).To(BeTrue())
+		})
+	})
+
+	Context("InjectProviderFaults", func() {
+		It("replaces the fault injected rather than adding to it", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+			defer server.Close()
+
+			previous, previousDefault := requests.DefaultHTTPClient.Transport, http.DefaultClient.Transport
+			defer func() {
+				requests.DefaultHTTPClient.Transport = previous
+				http.DefaultClient.Transport = previousDefault
+				providerFault.Store(nil)
+			}()
+
+			InjectProviderFaults(Fault{ErrorPercentage: 100})
+			wrapped := requests.DefaultHTTPClient.Transport
+			_, err := requests.DefaultHTTPClient.Get(server.URL)
+			Expect(errors.Is(err, ErrInjected)).To(BeTrue())
+
+			InjectProviderFaults(Fault{Latency: time.Millisecond, LatencyPercentage: 100})
+			Expect(requests.DefaultHTTPClient.Transport).To(BeIdenticalTo(wrapped))
+			resp, err := requests.DefaultHTTPClient.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+
+			InjectProviderFaults(Fault{})
+			resp, err = requests.DefaultHTTPClient.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+		})
+	})
+
+	Context("NewSessionStore", func() {
+		It("fails session store operations", func() {
+			store := NewSessionStore(Fault{ErrorPercentage: 100},
+				persistence.NewManager(tests.NewMockStore(), &options.Cookie{Name: "_oauth2_proxy", Secret: "0123456789abcdef"}))
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+
+			Expect(store.Save(rw, req, &sessions.SessionState{})).To(MatchError("error saving session: chaos: injected fault"))
+			_, err := store.Load(req)
+			Expect(err).To(MatchError("error loading session: chaos: injected fault"))
+			Expect(store.Clear(rw, req)).To(MatchError("error clearing session: chaos: injected fault"))
+			Expect(store.VerifyConnection(context.Background())).To(MatchError(ErrInjected))
+		})
+	})
+
+	Context("NewHandler", func() {
+		It("passes failed requests to the error handler", func() {
+			upstream := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			})
+			errorHandler := func(rw http.ResponseWriter, _ *http.Request, err error) {
+				Expect(err).To(MatchError(ErrInjected))
+				rw.WriteHeader(http.StatusBadGateway)
+			}
+
+			rw := httptest.NewRecorder()
+			NewHandler(Fault{ErrorPercentage: 100}, upstream, errorHandler).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+			Expect(rw.Code).To(Equal(http.StatusBadGateway))
+
+			rw = httptest.NewRecorder()
+			NewHandler(Fault{}, upstream, errorHandler).ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,30 @@
+package chaos
+
+import "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+
+// ProviderFault returns the Fault configured for provider requests
+func ProviderFault(opts options.Chaos) Fault {
+	return Fault{
+		Latency:           opts.ProviderLatency,
+		LatencyPercentage: opts.ProviderLatencyPercentage,
+		ErrorPercentage:   opts.ProviderErrorPercentage,
+	}
+}
+
+// SessionStoreFault returns the Fault configured for session store operations
+func SessionStoreFault(opts options.Chaos) Fault {
+	return Fault{
+		Latency:           opts.SessionStoreLatency,
+		LatencyPercentage: opts.SessionStoreLatencyPercentage,
+		ErrorPercentage:   opts.SessionStoreErrorPercentage,
+	}
+}
+
+// UpstreamFault returns the Fault configured for upstream requests
+func UpstreamFault(opts options.Chaos) Fault {
+	return Fault{
+		Latency:           opts.UpstreamLatency,
+		LatencyPercentage: opts.UpstreamLatencyPercentage,
+		ErrorPercentage:   opts.UpstreamErrorPercentage,
+	}
+}
@@ -0,0 +1,134 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// transport injects faults before performing requests
+type transport struct {
+	fault Fault
+	next  http.RoundTripper
+}
+
+// NewTransport wraps the http.RoundTripper with fault injection.
+// A nil next uses http.DefaultTransport.
+func NewTransport(fault Fault, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{fault: fault, next: next}
+}
+
+// RoundTrip injects the fault and then performs the request
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.fault.Inject(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// providerFault is the fault injected into provider calls by the
+// providerTransports
+var providerFault atomic.Pointer[Fault]
+
+// providerTransport injects the current provider fault before performing
+// requests, so that the fault can be replaced without wrapping the transport
+// again
+type providerTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip injects the current provider fault and then performs the request
+func (t *providerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := providerFault.Load()
+	if fault == nil {
+		fault = &Fault{}
+	}
+	return NewTransport(*fault, t.next).RoundTrip(req)
+}
+
+// InjectProviderFaults injects the fault into the HTTP clients used for
+// provider calls, the requests.DefaultHTTPClient and the http.DefaultClient.
+// Each client is only wrapped once, so that injecting a fault again when the
+// configuration is reloaded replaces the fault rather than adding to it.
+func InjectProviderFaults(fault Fault) {
+	providerFault.Store(&fault)
+	if !fault.Enabled() {
+		return
+	}
+	for _, client := range []*http.Client{requests.DefaultHTTPClient, http.DefaultClient} {
+		if _, ok := client.Transport.(*providerTransport); !ok {
+			client.Transport = &providerTransport{next: client.Transport}
+		}
+	}
+}
+
+// sessionStore injects faults before each session store operation
+type sessionStore struct {
+	fault Fault
+	next  sessions.SessionStore
+}
+
+// NewSessionStore wraps the sessions.SessionStore with fault injection
+func NewSessionStore(fault Fault, next sessions.SessionStore) sessions.SessionStore {
+	return &sessionStore{fault: fault, next: next}
+}
+
+func (s *sessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessions.SessionState) error {
+	if err := s.fault.Inject(req.Context()); err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return s.next.Save(rw, req, ss)
+}
+
+func (s *sessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
+	if err := s.fault.Inject(req.Context()); err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+	return s.next.Load(req)
+}
+
+func (s *sessionStore) Clear(rw http.ResponseWriter, req *http.Request) error {
+	if err := s.fault.Inject(req.Context()); err != nil {
+		return fmt.Errorf("error clearing session: %w", err)
+	}
+	return s.next.Clear(rw, req)
+}
+
+func (s *sessionStore) VerifyConnection(ctx context.Context) error {
+	if err := s.fault.Inject(ctx); err != nil {
+		return err
+	}
+	return s.next.VerifyConnection(ctx)
+}
+
+// Close closes the wrapped session store, if it holds resources to release
+func (s *sessionStore) Close() error {
+	if closer, ok := s.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewHandler wraps the upstream http.Handler with fault injection.
+// Failed requests are passed to the errorHandler, as if the upstream could
+// not be reached.
+func NewHandler(fault Fault, next http.Handler, errorHandler func(http.ResponseWriter, *http.Request, error)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if err := fault.Inject(req.Context()); err != nil {
+			errorHandler(rw, req, err)
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
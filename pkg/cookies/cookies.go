@@ -7,7 +7,9 @@ import (
 	"strings"
 	"time"
 
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
 )
@@ -16,8 +18,11 @@ import (
 // value and creation time
 func MakeCookieFromOptions(req *http.Request, name string, value string, opts *options.Cookie, expiration time.Duration, now time.Time) *http.Cookie {
 	domain := GetCookieDomain(req, opts.Domains)
-	// If nothing matches, create the cookie with the shortest domain
-	if domain == "" && len(opts.Domains) > 0 {
+	if scope := middlewareapi.GetRequestScope(req); scope != nil && scope.CookieDomain != "" {
+		// The virtual host serving the request overrides the cookie domains
+		domain = scope.CookieDomain
+	} else if domain == "" && len(opts.Domains) > 0 {
+		// If nothing matches, create the cookie with the shortest domain
 		logger.Errorf("Warning: request host %q did not match any of the specific cookie domains of %q",
 			requestutil.GetRequestHost(req),
 			strings.Join(opts.Domains, ","),
@@ -72,6 +77,19 @@ func ParseSameSite(v string) http.SameSite {
 	}
 }
 
+// ValidateSigned validates the signature and age of a signed cookie with the
+// keys of the cookie secret, or of the previous cookie secret once it has been
+// rotated. It returns the value with the keys it was signed with, which also
+// decrypt it.
+func ValidateSigned(c *http.Cookie, opts *options.Cookie, expiration time.Duration) ([]byte, options.CookieKeys, bool) {
+	for _, keys := range opts.GetCookieKeys() {
+		if value, _, ok := encryption.ValidateWithKey(c, keys.SigningKey, expiration); ok {
+			return value, keys, true
+		}
+	}
+	return nil, options.CookieKeys{}, false
+}
+
 // warnInvalidDomain logs a warning if the request host and cookie domain are
 // mismatched.
 func warnInvalidDomain(c *http.Cookie, req *http.Request) {
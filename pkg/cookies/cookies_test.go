@@ -147,5 +147,15 @@ var _ = Describe("Cookie Tests", func() {
 				expectedOutput: expectedExpires,
 			}),
 		)
+
+		It("uses the cookie domain of the request scope", func() {
+			opts := &options.Cookie{Name: validName, Domains: domains}
+			req, err := http.NewRequest(http.MethodGet, "https://app.cookies.test/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(MakeCookieFromOptions(req, validName, "1", opts, 0, now).Domain).To(Equal("www.cookies.test"))
+
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{CookieDomain: ".cookies.test"})
+			Expect(MakeCookieFromOptions(req, validName, "1", opts, 0, now).Domain).To(Equal(".cookies.test"))
+		})
 	})
 })
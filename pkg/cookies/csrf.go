@@ -21,6 +21,12 @@ type CSRF interface {
 	CheckOAuthState(string) bool
 	CheckOIDCNonce(string) bool
 	GetCodeVerifier() string
+	GetProviderID() string
+	SetProviderID(string)
+	GetPrompt() string
+	SetPrompt(string)
+	GetScope() string
+	SetScope(string)
 
 	SetSessionNonce(s *sessions.SessionState)
 
@@ -44,6 +50,20 @@ type csrf struct {
 	// authentication code.
 	CodeVerifier string `msgpack:"cv,omitempty"`
 
+	// ProviderID holds the ID of the provider the user chose to sign in with,
+	// so that the code is redeemed with the same provider in the callback.
+	ProviderID string `msgpack:"p,omitempty"`
+
+	// Prompt holds the prompt parameter sent to the provider in the initial
+	// authentication request, so that the callback can tell whether the
+	// provider was asked to sign the user in without any interaction.
+	Prompt string `msgpack:"pr,omitempty"`
+
+	// Scope holds the scope parameter sent to the provider in the initial
+	// authentication request when it replaces the scope of the provider, so
+	// that the callback can record the scopes granted incrementally.
+	Scope string `msgpack:"sc,omitempty"`
+
 	cookieOpts *options.Cookie
 	time       clock.Clock
 }
@@ -100,6 +120,42 @@ func (c *csrf) GetCodeVerifier() string {
 	return c.CodeVerifier
 }
 
+// GetProviderID returns the ID of the provider the authentication flow was
+// started with
+func (c *csrf) GetProviderID() string {
+	return c.ProviderID
+}
+
+// SetProviderID sets the ID of the provider the authentication flow was
+// started with
+func (c *csrf) SetProviderID(id string) {
+	c.ProviderID = id
+}
+
+// GetPrompt returns the prompt parameter the authentication flow was started
+// with
+func (c *csrf) GetPrompt() string {
+	return c.Prompt
+}
+
+// SetPrompt sets the prompt parameter the authentication flow was started
+// with
+func (c *csrf) SetPrompt(prompt string) {
+	c.Prompt = prompt
+}
+
+// GetScope returns the scope parameter the authentication flow was started
+// with, when it replaces the scope of the provider
+func (c *csrf) GetScope() string {
+	return c.Scope
+}
+
+// SetScope sets the scope parameter the authentication flow was started with,
+// when it replaces the scope of the provider
+func (c *csrf) SetScope(scope string) {
+	c.Scope = scope
+}
+
 // HashOAuthState returns the hash of the OAuth state nonce
 func (c *csrf) HashOAuthState() string {
 	return encryption.HashNonce(c.OAuthState)
@@ -166,23 +222,23 @@ func (c *csrf) encodeCookie() (string, error) {
 		return "", fmt.Errorf("error marshalling CSRF to msgpack: %v", err)
 	}
 
-	encrypted, err := encrypt(packed, c.cookieOpts)
+	encrypted, err := encrypt(packed, c.cookieOpts.GetEncryptionKey())
 	if err != nil {
 		return "", err
 	}
 
-	return encryption.SignedValue(c.cookieOpts.Secret, c.cookieName(), encrypted, c.time.Now())
+	return encryption.SignedValueWithKey(c.cookieOpts.GetSigningKey(), c.cookieName(), encrypted, c.time.Now())
 }
 
 // decodeCSRFCookie validates the signature then decrypts and decodes a CSRF
 // cookie into a CSRF struct
 func decodeCSRFCookie(cookie *http.Cookie, opts *options.Cookie) (*csrf, error) {
-	val, _, ok := encryption.Validate(cookie, opts.Secret, opts.Expire)
+	val, keys, ok := ValidateSigned(cookie, opts, opts.Expire)
 	if !ok {
 		return nil, errors.New("CSRF cookie failed validation")
 	}
 
-	decrypted, err := decrypt(val, opts)
+	decrypted, err := decrypt(val, keys)
 	if err != nil {
 		return nil, err
 	}
@@ -228,22 +284,19 @@ func ExtractStateSubstring(req *http.Request) string {
 	return stateSubstring
 }
 
-func encrypt(data []byte, opts *options.Cookie) ([]byte, error) {
-	cipher, err := makeCipher(opts)
+func encrypt(data []byte, encryptionKey []byte) ([]byte, error) {
+	cipher, err := encryption.NewCookieCipher(encryptionKey)
 	if err != nil {
 		return nil, err
 	}
 	return cipher.Encrypt(data)
 }
 
-func decrypt(data []byte, opts *options.Cookie) ([]byte, error) {
-	cipher, err := makeCipher(opts)
+// decrypt decrypts data with the keys its signature was validated with
+func decrypt(data []byte, keys options.CookieKeys) ([]byte, error) {
+	cipher, err := encryption.NewCookieCipher(keys.EncryptionKey)
 	if err != nil {
 		return nil, err
 	}
 	return cipher.Decrypt(data)
 }
-
-func makeCipher(opts *options.Cookie) (encryption.Cipher, error) {
-	return encryption.NewCFBCipher(encryption.SecretBytes(opts.Secret))
-}
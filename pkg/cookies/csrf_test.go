@@ -92,6 +92,9 @@ var _ = Describe("CSRF Cookie Tests", func() {
 		It("encodes and decodes to the same nonces", func() {
 			privateCSRF.OAuthState = []byte(csrfState)
 			privateCSRF.OIDCNonce = []byte(csrfNonce)
+			publicCSRF.SetProviderID("github")
+			publicCSRF.SetPrompt("none")
+			publicCSRF.SetScope("openid email calendar.read")
 
 			encoded, err := privateCSRF.encodeCookie()
 			Expect(err).ToNot(HaveOccurred())
@@ -106,6 +109,9 @@ var _ = Describe("CSRF Cookie Tests", func() {
 			Expect(decoded).ToNot(BeNil())
 			Expect(decoded.OAuthState).To(Equal([]byte(csrfState)))
 			Expect(decoded.OIDCNonce).To(Equal([]byte(csrfNonce)))
+			Expect(decoded.GetProviderID()).To(Equal("github"))
+			Expect(decoded.GetPrompt()).To(Equal("none"))
+			Expect(decoded.GetScope()).To(Equal("openid email calendar.read"))
 		})
 
 		It("signs the encoded cookie value", func() {
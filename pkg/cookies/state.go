@@ -0,0 +1,111 @@
+package cookies
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// stateSignatureKey is signed along with signed OAuth states, so that the
+// signatures of cookies can not be passed off as signatures of states
+const stateSignatureKey = "oauth_state"
+
+// OAuthState is the payload of a signed OAuth state parameter.
+// It carries everything the callback needs to finish the authentication
+// flow, encrypted, signed and timestamped, so that the flow can finish on any
+// instance of the proxy. It is bound to the browser that started the flow by
+// the hash of the OAuth state nonce of its CSRF cookie.
+type OAuthState struct {
+	// ID is a random identifier of the state, used to reject states that
+	// are replayed
+	ID string `msgpack:"i"`
+
+	// CSRF is the hash of the OAuth state nonce of the CSRF cookie
+	CSRF string `msgpack:"c"`
+
+	// Redirect is the URL the user is redirected to once signed in
+	Redirect string `msgpack:"r,omitempty"`
+
+	// ProviderID is the ID of the provider the user chose to sign in with
+	ProviderID string `msgpack:"p,omitempty"`
+
+	// CodeVerifier is the PKCE code verifier of the authentication flow
+	CodeVerifier string `msgpack:"cv,omitempty"`
+}
+
+// NewOAuthState creates the state of an authentication flow started with the
+// CSRF
+func NewOAuthState(csrf CSRF, redirect string) (*OAuthState, error) {
+	id, err := encryption.Nonce(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthState{
+		ID:           base64.RawURLEncoding.EncodeToString(id),
+		CSRF:         csrf.HashOAuthState(),
+		Redirect:     redirect,
+		ProviderID:   csrf.GetProviderID(),
+		CodeVerifier: csrf.GetCodeVerifier(),
+	}, nil
+}
+
+// Encode MessagePack encodes, encrypts and signs the state.
+// The value starts with the hash of the CSRF nonce, followed by a `:`, so
+// that the CSRF cookie of the flow can be found when CSRF cookies are per
+// request.
+func (s *OAuthState) Encode(opts *options.Cookie, now time.Time) (string, error) {
+	packed, err := msgpack.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling state to msgpack: %v", err)
+	}
+
+	encrypted, err := encrypt(packed, opts.GetEncryptionKey())
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := encryption.SignedValueWithKey(opts.GetSigningKey(), stateSignatureKey, encrypted, now)
+	if err != nil {
+		return "", err
+	}
+	return s.CSRF + ":" + signed, nil
+}
+
+// DecodeOAuthState validates the signature and age of a signed state, then
+// decrypts and decodes it.
+// States older than the CSRF cookie expiry are rejected.
+func DecodeOAuthState(value string, opts *options.Cookie) (*OAuthState, error) {
+	csrfHash, signed, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, errors.New("state is not signed")
+	}
+
+	val, keys, ok := ValidateSigned(&http.Cookie{Name: stateSignatureKey, Value: signed}, opts, opts.CSRFExpire)
+	if !ok {
+		return nil, errors.New("state failed validation")
+	}
+
+	decrypted, err := decrypt(val, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &OAuthState{}
+	if err := msgpack.Unmarshal(decrypted, state); err != nil {
+		return nil, fmt.Errorf("error unmarshalling data to state: %v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(csrfHash), []byte(state.CSRF)) != 1 {
+		return nil, errors.New("state does not match its CSRF hash")
+	}
+
+	return state, nil
+}
@@ -0,0 +1,103 @@
+package cookies
+
+import (
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signed OAuth State Tests", func() {
+	var (
+		cookieOpts *options.Cookie
+		csrf       CSRF
+	)
+
+	BeforeEach(func() {
+		cookieOpts = &options.Cookie{
+			Name:       cookieName,
+			Secret:     cookieSecret,
+			CSRFExpire: 15 * time.Minute,
+		}
+
+		var err error
+		csrf, err = NewCSRF(cookieOpts, "verifier")
+		Expect(err).ToNot(HaveOccurred())
+		csrf.SetProviderID("oidc")
+	})
+
+	Context("NewOAuthState", func() {
+		It("takes the flow from the CSRF", func() {
+			state, err := NewOAuthState(csrf, "/app")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(state.ID).ToNot(BeEmpty())
+			Expect(state.CSRF).To(Equal(csrf.HashOAuthState()))
+			Expect(state.Redirect).To(Equal("/app"))
+			Expect(state.ProviderID).To(Equal("oidc"))
+			Expect(state.CodeVerifier).To(Equal("verifier"))
+		})
+
+		It("creates a different ID for each state", func() {
+			first, err := NewOAuthState(csrf, "/app")
+			Expect(err).ToNot(HaveOccurred())
+			second, err := NewOAuthState(csrf, "/app")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(first.ID).ToNot(Equal(second.ID))
+		})
+	})
+
+	Context("Encode and DecodeOAuthState", func() {
+		var state *OAuthState
+
+		BeforeEach(func() {
+			var err error
+			state, err = NewOAuthState(csrf, "/app")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("round trips the state", func() {
+			encoded, err := state.Encode(cookieOpts, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoded).To(HavePrefix(csrf.HashOAuthState() + ":"))
+			Expect(encoded).ToNot(ContainSubstring("verifier"))
+
+			decoded, err := DecodeOAuthState(encoded, cookieOpts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(state))
+		})
+
+		It("rejects an expired state", func() {
+			encoded, err := state.Encode(cookieOpts, time.Now().Add(-time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = DecodeOAuthState(encoded, cookieOpts)
+			Expect(err).To(MatchError("state failed validation"))
+		})
+
+		It("rejects a state signed with another secret", func() {
+			encoded, err := state.Encode(&options.Cookie{Secret: "0987654321abcdef0987654321abcdef", CSRFExpire: time.Hour}, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = DecodeOAuthState(encoded, cookieOpts)
+			Expect(err).To(MatchError("state failed validation"))
+		})
+
+		It("rejects a state with another CSRF hash", func() {
+			encoded, err := state.Encode(cookieOpts, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, signed, _ := strings.Cut(encoded, ":")
+			_, err = DecodeOAuthState("other:"+signed, cookieOpts)
+			Expect(err).To(MatchError("state does not match its CSRF hash"))
+		})
+
+		It("rejects an unsigned state", func() {
+			_, err := DecodeOAuthState("nonce", cookieOpts)
+			Expect(err).To(MatchError("state is not signed"))
+		})
+	})
+})
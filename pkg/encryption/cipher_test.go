@@ -158,6 +158,14 @@ func TestDecryptGCMWrongSecret(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDecryptGCMShortCiphertext(t *testing.T) {
+	c, err := NewGCMCipher([]byte("0123456789abcdefghijklmnopqrstuv"))
+	assert.Equal(t, nil, err)
+
+	_, err = c.Decrypt([]byte("short"))
+	assert.Error(t, err)
+}
+
 // Encrypt with GCM, Decrypt with CFB: Results in Garbage data
 func TestGCMtoCFBErrors(t *testing.T) {
 	// Test all 3 valid AES sizes
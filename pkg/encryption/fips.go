@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"crypto"
+	"crypto/tls"
+	"strings"
+	"sync/atomic"
+)
+
+// fipsMode records whether FIPS 140-3 mode was enabled at runtime.
+// Binaries built with the `fips` build tag always run in FIPS mode.
+var fipsMode atomic.Bool
+
+// SetFIPSMode enables or disables FIPS 140-3 mode for the process.
+// This should be called once during configuration validation, before any
+// ciphers, TLS listeners or token verifiers are constructed.
+// FIPS mode cannot be disabled in binaries built with the `fips` build tag.
+func SetFIPSMode(enabled bool) {
+	fipsMode.Store(enabled)
+}
+
+// FIPSMode returns whether cryptographic operations are restricted to
+// FIPS 140-3 approved algorithms.
+func FIPSMode() bool {
+	return fipsBuild || fipsMode.Load()
+}
+
+// FIPSApprovedSigningAlgs is the list of JWS signature algorithms that are
+// approved for use in FIPS mode (RSA PKCS#1 v1.5, RSA-PSS and ECDSA over the
+// NIST curves with SHA-2).
+var FIPSApprovedSigningAlgs = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+}
+
+// FIPSApprovedCipherSuites is the list of TLS 1.2 cipher suites that are
+// approved for use in FIPS mode.
+// TLS 1.3 cipher suites are not configurable in crypto/tls.
+var FIPSApprovedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// FIPSApprovedCurves is the list of elliptic curves that are approved for
+// TLS key exchange in FIPS mode.
+var FIPSApprovedCurves = []tls.CurveID{
+	tls.CurveP256,
+	tls.CurveP384,
+	tls.CurveP521,
+}
+
+// CurveName returns the name of an elliptic curve in the TLS options:
+// X25519, P256, P384 or P521
+func CurveName(curve tls.CurveID) string {
+	return strings.TrimPrefix(curve.String(), "Curve")
+}
+
+// IsFIPSApprovedCurve returns whether the elliptic curve with the given name
+// may be used for TLS key exchange in FIPS mode.
+func IsFIPSApprovedCurve(name string) bool {
+	for _, id := range FIPSApprovedCurves {
+		if CurveName(id) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFIPSApprovedSigningAlg returns whether the given JWS algorithm may be
+// used in FIPS mode.
+func IsFIPSApprovedSigningAlg(alg string) bool {
+	for _, approved := range FIPSApprovedSigningAlgs {
+		if alg == approved {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFIPSApprovedCipherSuite returns whether the named TLS cipher suite may be
+// used in FIPS mode.
+func IsFIPSApprovedCipherSuite(name string) bool {
+	for _, id := range FIPSApprovedCipherSuites {
+		if tls.CipherSuiteName(id) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFIPSApprovedHash returns whether the given hash may be used for request
+// signatures in FIPS mode.
+func IsFIPSApprovedHash(hash crypto.Hash) bool {
+	switch hash {
+	case crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512,
+		crypto.SHA512_224, crypto.SHA512_256,
+		crypto.SHA3_224, crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewCookieCipher returns the Cipher used to encrypt cookie values.
+// AES-CFB is used by default for compatibility with existing cookies.
+// In FIPS mode, the authenticated AES-GCM cipher is used instead.
+func NewCookieCipher(secret []byte) (Cipher, error) {
+	if FIPSMode() {
+		return NewGCMCipher(secret)
+	}
+	return NewCFBCipher(secret)
+}
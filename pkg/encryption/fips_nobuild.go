@@ -0,0 +1,6 @@
+//go:build !fips
+
+package encryption
+
+// fipsBuild forces FIPS mode on in binaries built with the `fips` build tag.
+const fipsBuild = false
@@ -0,0 +1,64 @@
+package encryption
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIPSMode(t *testing.T) {
+	defer SetFIPSMode(false)
+
+	SetFIPSMode(false)
+	assert.Equal(t, fipsBuild, FIPSMode())
+
+	SetFIPSMode(true)
+	assert.True(t, FIPSMode())
+}
+
+func TestIsFIPSApprovedSigningAlg(t *testing.T) {
+	for _, alg := range []string{"RS256", "PS384", "ES512"} {
+		assert.True(t, IsFIPSApprovedSigningAlg(alg), alg)
+	}
+	for _, alg := range []string{"HS256", "EdDSA", "none", ""} {
+		assert.False(t, IsFIPSApprovedSigningAlg(alg), alg)
+	}
+}
+
+func TestIsFIPSApprovedCipherSuite(t *testing.T) {
+	assert.True(t, IsFIPSApprovedCipherSuite("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"))
+	assert.False(t, IsFIPSApprovedCipherSuite("TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"))
+	assert.False(t, IsFIPSApprovedCipherSuite("TLS_RSA_WITH_RC4_128_SHA"))
+	assert.False(t, IsFIPSApprovedCipherSuite("unknown"))
+}
+
+func TestIsFIPSApprovedHash(t *testing.T) {
+	assert.True(t, IsFIPSApprovedHash(crypto.SHA256))
+	assert.True(t, IsFIPSApprovedHash(crypto.SHA512))
+	assert.False(t, IsFIPSApprovedHash(crypto.SHA1))
+	assert.False(t, IsFIPSApprovedHash(crypto.MD5))
+}
+
+func TestNewCookieCipher(t *testing.T) {
+	defer SetFIPSMode(false)
+	secret := []byte("0123456789abcdefghijklmnopqrstuv")
+
+	SetFIPSMode(false)
+	c, err := NewCookieCipher(secret)
+	assert.NoError(t, err)
+	if !fipsBuild {
+		assert.IsType(t, &cfbCipher{}, c)
+	}
+
+	SetFIPSMode(true)
+	c, err = NewCookieCipher(secret)
+	assert.NoError(t, err)
+	assert.IsType(t, &gcmCipher{}, c)
+
+	encrypted, err := c.Encrypt([]byte("value"))
+	assert.NoError(t, err)
+	decrypted, err := c.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), decrypted)
+}
@@ -0,0 +1,77 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// KeyDerivationNone uses secrets directly as keys (legacy behaviour)
+	KeyDerivationNone = "none"
+
+	// KeyDerivationHKDF derives keys with HKDF-SHA256.
+	// This should be used with high entropy secrets.
+	KeyDerivationHKDF = "hkdf-sha256"
+
+	// KeyDerivationArgon2id derives keys with Argon2id.
+	// This should be used when secrets may be low entropy passphrases.
+	KeyDerivationArgon2id = "argon2id"
+
+	// CookieEncryptionKeyLabel is the context label for cookie encryption keys
+	CookieEncryptionKeyLabel = "oauth2-proxy cookie encryption v1"
+
+	// CookieSigningKeyLabel is the context label for cookie signing keys
+	CookieSigningKeyLabel = "oauth2-proxy cookie signing v1"
+
+	// HandoffKeyLabel is the context label for session handoff encryption keys
+	HandoffKeyLabel = "oauth2-proxy session handoff v1"
+
+	// OIDCIssuerKeyLabel is the context label for the encryption keys of the
+	// authorization codes of the OIDC issuer
+	OIDCIssuerKeyLabel = "oauth2-proxy oidc issuer v1"
+
+	// SessionArchiveKeyLabel is the context label for the encryption keys of
+	// session archives
+	SessionArchiveKeyLabel = "oauth2-proxy session archive v1"
+
+	// SessionIndexEncryptionKeyLabel is the context label for the encryption
+	// keys of the session indexes of the admin API
+	SessionIndexEncryptionKeyLabel = "oauth2-proxy session index encryption v1"
+
+	// SessionIndexLookupKeyLabel is the context label for the keys of the
+	// hashes the session indexes are looked up by
+	SessionIndexLookupKeyLabel = "oauth2-proxy session index lookup v1"
+
+	// argon2id parameters, as recommended by RFC 9106 for memory constrained
+	// environments. Keys are only derived once at startup.
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+)
+
+// DeriveKey derives a key of the given length from the secret using the
+// named key derivation method.
+// The label binds the key to its purpose so that keys derived from the same
+// secret for different purposes are independent.
+func DeriveKey(method string, secret []byte, label string, length int) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("cannot derive key from an empty secret")
+	}
+
+	switch method {
+	case KeyDerivationHKDF:
+		key := make([]byte, length)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(label)), key); err != nil {
+			return nil, fmt.Errorf("error deriving key with hkdf: %v", err)
+		}
+		return key, nil
+	case KeyDerivationArgon2id:
+		return argon2.IDKey(secret, []byte(label), argon2Time, argon2Memory, argon2Threads, uint32(length)), nil
+	default:
+		return nil, fmt.Errorf("unknown key derivation method %q", method)
+	}
+}
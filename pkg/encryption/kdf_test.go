@@ -0,0 +1,35 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	secret := []byte("0123456789abcdefghijklmnopqrstuv")
+
+	for _, method := range []string{KeyDerivationHKDF, KeyDerivationArgon2id} {
+		t.Run(method, func(t *testing.T) {
+			encryptionKey, err := DeriveKey(method, secret, CookieEncryptionKeyLabel, 32)
+			assert.NoError(t, err)
+			assert.Len(t, encryptionKey, 32)
+
+			again, err := DeriveKey(method, secret, CookieEncryptionKeyLabel, 32)
+			assert.NoError(t, err)
+			assert.Equal(t, encryptionKey, again)
+
+			signingKey, err := DeriveKey(method, secret, CookieSigningKeyLabel, 32)
+			assert.NoError(t, err)
+			assert.NotEqual(t, encryptionKey, signingKey)
+		})
+	}
+}
+
+func TestDeriveKeyErrors(t *testing.T) {
+	_, err := DeriveKey(KeyDerivationHKDF, []byte{}, CookieEncryptionKeyLabel, 32)
+	assert.EqualError(t, err, "cannot derive key from an empty secret")
+
+	_, err = DeriveKey("unknown", []byte("secret"), CookieEncryptionKeyLabel, 32)
+	assert.EqualError(t, err, "unknown key derivation method \"unknown\"")
+}
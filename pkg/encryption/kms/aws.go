@@ -0,0 +1,96 @@
+package kms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sigv4"
+)
+
+// awsKeyManager uses AWS KMS. Credentials are read from the environment,
+// a web identity token, the container credentials or the instance profile,
+// as with the AWS SDKs.
+type awsKeyManager struct {
+	client      *http.Client
+	endpoint    string
+	region      string
+	key         string
+	credentials sigv4.CredentialsProvider
+}
+
+func newAWSKeyManager(opts options.SessionKMSOptions) (*awsKeyManager, error) {
+	region := opts.AWSRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("aws region is not set")
+	}
+
+	credentials, err := sigv4.NewCredentialsProvider(requests.DefaultHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", region)
+	}
+	return &awsKeyManager{
+		client:      requests.DefaultHTTPClient,
+		endpoint:    endpoint,
+		region:      region,
+		key:         opts.KeyID,
+		credentials: credentials,
+	}, nil
+}
+
+// GenerateDataKey requests a new AES-256 data key from AWS KMS
+func (a *awsKeyManager) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	var resp struct {
+		CiphertextBlob []byte
+		Plaintext      []byte
+	}
+	err := a.call(ctx, "GenerateDataKey", map[string]string{"KeyId": a.key, "KeySpec": "AES_256"}, &resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating aws data key: %v", err)
+	}
+	return resp.Plaintext, resp.CiphertextBlob, nil
+}
+
+// Decrypt unwraps a data key with AWS KMS
+func (a *awsKeyManager) Decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte
+	}
+	err := a.call(ctx, "Decrypt", map[string]interface{}{"KeyId": a.key, "CiphertextBlob": wrapped}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting aws data key: %v", err)
+	}
+	return resp.Plaintext, nil
+}
+
+func (a *awsKeyManager) call(ctx context.Context, action string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	credentials, err := a.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	req, body, err := newJSONRequest(ctx, a.endpoint, in)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	sigv4.Sign(req, body, credentials, a.region, "kms", time.Now())
+
+	return doJSON(a.client, req, out)
+}
@@ -0,0 +1,199 @@
+package kms
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
+)
+
+const (
+	// envelopeVersion prefixes sealed values to allow the format to change
+	envelopeVersion byte = 1
+
+	// maxCachedKeys bounds the number of unwrapped data keys held in memory
+	maxCachedKeys = 1024
+
+	// lowMemoryMaxCachedKeys bounds the number of unwrapped data keys held in
+	// memory in low memory mode
+	lowMemoryMaxCachedKeys = 16
+)
+
+// Envelope seals values with a data key generated by a KeyManager.
+//
+// The data key used to seal new values is rotated after the rotation period.
+// Unwrapped data keys are cached for the same period, so that the KMS is
+// only called once per data key rather than once per value.
+type Envelope struct {
+	keys     KeyManager
+	rotation time.Duration
+
+	mu      sync.Mutex
+	current *dataKey
+	cache   map[string]*dataKey
+
+	Clock clock.Clock
+}
+
+// dataKey is an unwrapped data key ready to use
+type dataKey struct {
+	cipher  encryption.Cipher
+	wrapped []byte
+	expires time.Time
+}
+
+// NewEnvelope creates an Envelope using data keys from the KeyManager
+func NewEnvelope(keys KeyManager, rotation time.Duration) *Envelope {
+	return &Envelope{
+		keys:     keys,
+		rotation: rotation,
+		cache:    make(map[string]*dataKey),
+	}
+}
+
+// Seal encrypts the value with the current data key.
+// The sealed value is formatted as:
+// version (1 byte) | wrapped key length (2 bytes) | wrapped key | ciphertext
+func (e *Envelope) Seal(ctx context.Context, value []byte) ([]byte, error) {
+	key, err := e.currentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := key.cipher.Encrypt(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting value: %v", err)
+	}
+
+	sealed := make([]byte, 0, 3+len(key.wrapped)+len(ciphertext))
+	sealed = append(sealed, envelopeVersion)
+	sealed = binary.BigEndian.AppendUint16(sealed, uint16(len(key.wrapped)))
+	sealed = append(sealed, key.wrapped...)
+	return append(sealed, ciphertext...), nil
+}
+
+// Open decrypts a value sealed by Seal, unwrapping its data key if it is not
+// already cached
+func (e *Envelope) Open(ctx context.Context, sealed []byte) ([]byte, error) {
+	if len(sealed) < 3 || sealed[0] != envelopeVersion {
+		return nil, errors.New("value is not envelope encrypted")
+	}
+	length := int(binary.BigEndian.Uint16(sealed[1:3]))
+	if len(sealed) < 3+length {
+		return nil, errors.New("envelope encrypted value is truncated")
+	}
+
+	key, err := e.unwrapKey(ctx, sealed[3:3+length])
+	if err != nil {
+		return nil, err
+	}
+	value, err := key.cipher.Decrypt(sealed[3+length:])
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting value: %v", err)
+	}
+	return value, nil
+}
+
+// currentKey returns the data key for sealing new values, generating a new
+// one if it has expired
+func (e *Envelope) currentKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	key := e.current
+	e.mu.Unlock()
+	if key != nil && e.Clock.Now().Before(key.expires) {
+		return key, nil
+	}
+
+	plaintext, wrapped, err := e.keys.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) > math.MaxUint16 {
+		return nil, fmt.Errorf("wrapped data key is too large (%d bytes)", len(wrapped))
+	}
+	key, err = e.newDataKey(plaintext, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.current = key
+	e.cacheKey(key)
+	return key, nil
+}
+
+// unwrapKey returns the cached data key for the wrapped key, or unwraps it
+// with the KeyManager
+func (e *Envelope) unwrapKey(ctx context.Context, wrapped []byte) (*dataKey, error) {
+	e.mu.Lock()
+	key, ok := e.cache[string(wrapped)]
+	e.mu.Unlock()
+	if ok && e.Clock.Now().Before(key.expires) {
+		return key, nil
+	}
+
+	plaintext, err := e.keys.Decrypt(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	key, err = e.newDataKey(plaintext, append([]byte{}, wrapped...))
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cacheKey(key)
+	return key, nil
+}
+
+// newDataKey creates the cipher for a plaintext data key, then clears the
+// plaintext so it only remains in memory within the cipher
+func (e *Envelope) newDataKey(plaintext, wrapped []byte) (*dataKey, error) {
+	defer clear(plaintext)
+
+	if len(plaintext) != dataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", dataKeySize, len(plaintext))
+	}
+	cipher, err := encryption.NewGCMCipher(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error creating data key cipher: %v", err)
+	}
+	return &dataKey{
+		cipher:  cipher,
+		wrapped: wrapped,
+		expires: e.Clock.Now().Add(e.rotation),
+	}, nil
+}
+
+// cacheKey adds the key to the cache, evicting expired keys when it is full.
+// The caller must hold the lock.
+func (e *Envelope) cacheKey(key *dataKey) {
+	maxKeys := maxCachedKeys
+	if memory.LowMemory() {
+		maxKeys = lowMemoryMaxCachedKeys
+	}
+
+	if len(e.cache) >= maxKeys {
+		now := e.Clock.Now()
+		for wrapped, cached := range e.cache {
+			if !now.Before(cached.expires) {
+				delete(e.cache, wrapped)
+			}
+		}
+	}
+	if len(e.cache) >= maxKeys {
+		for wrapped := range e.cache {
+			delete(e.cache, wrapped)
+			break
+		}
+	}
+	e.cache[string(key.wrapped)] = key
+}
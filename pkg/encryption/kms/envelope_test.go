@@ -0,0 +1,119 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKeyManager wraps data keys by reversing them and counts KMS calls
+type fakeKeyManager struct {
+	generated int
+	decrypted int
+	err       error
+}
+
+func (f *fakeKeyManager) GenerateDataKey(_ context.Context) ([]byte, []byte, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	f.generated++
+	plaintext := bytes.Repeat([]byte{byte(f.generated)}, dataKeySize)
+	plaintext[0] = 0xff
+	return append([]byte{}, plaintext...), reverse(plaintext), nil
+}
+
+func (f *fakeKeyManager) Decrypt(_ context.Context, wrapped []byte) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.decrypted++
+	return reverse(wrapped), nil
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+func TestEnvelopeSealOpen(t *testing.T) {
+	ctx := context.Background()
+	keys := &fakeKeyManager{}
+	envelope := NewEnvelope(keys, time.Hour)
+
+	sealed, err := envelope.Seal(ctx, []byte("session"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "session")
+	assert.Equal(t, envelopeVersion, sealed[0])
+
+	value, err := envelope.Open(ctx, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("session"), value)
+
+	// The current key is reused and its unwrapped form is cached
+	_, err = envelope.Seal(ctx, []byte("another"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, keys.generated)
+	assert.Equal(t, 0, keys.decrypted)
+
+	// A new envelope must unwrap the key once with the KMS
+	other := NewEnvelope(keys, time.Hour)
+	for i := 0; i < 3; i++ {
+		value, err = other.Open(ctx, sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("session"), value)
+	}
+	assert.Equal(t, 1, keys.decrypted)
+}
+
+func TestEnvelopeRotation(t *testing.T) {
+	ctx := context.Background()
+	keys := &fakeKeyManager{}
+	envelope := NewEnvelope(keys, time.Hour)
+	envelope.Clock.Set(time.Now())
+
+	first, err := envelope.Seal(ctx, []byte("first"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, envelope.Clock.Add(2*time.Hour))
+	second, err := envelope.Seal(ctx, []byte("second"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, keys.generated)
+	assert.NotEqual(t, first[3:3+dataKeySize], second[3:3+dataKeySize])
+
+	// Values sealed with the previous key can still be opened, and the
+	// expired cache entry is refreshed from the KMS
+	value, err := envelope.Open(ctx, first)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), value)
+	assert.Equal(t, 1, keys.decrypted)
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	ctx := context.Background()
+	keys := &fakeKeyManager{}
+	envelope := NewEnvelope(keys, time.Hour)
+
+	_, err := envelope.Open(ctx, []byte("plain session"))
+	assert.EqualError(t, err, "value is not envelope encrypted")
+
+	_, err = envelope.Open(ctx, []byte{envelopeVersion, 0, 64, 1, 2})
+	assert.EqualError(t, err, "envelope encrypted value is truncated")
+
+	sealed, err := envelope.Seal(ctx, []byte("session"))
+	assert.NoError(t, err)
+	sealed[len(sealed)-1] ^= 0xff
+	_, err = envelope.Open(ctx, sealed)
+	assert.ErrorContains(t, err, "error decrypting value")
+
+	keys.err = errors.New("kms unavailable")
+	_, err = NewEnvelope(keys, time.Hour).Seal(ctx, []byte("session"))
+	assert.EqualError(t, err, "kms unavailable")
+}
@@ -0,0 +1,91 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcpKMSEndpoint = "https://cloudkms.googleapis.com/v1/"
+	gcpKMSScope    = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// gcpKeyManager uses Google Cloud KMS. Cloud KMS has no data key API, so data
+// keys are generated locally and wrapped with the CryptoKey.
+type gcpKeyManager struct {
+	client   *http.Client
+	endpoint string
+	key      string
+}
+
+func newGCPKeyManager(opts options.SessionKMSOptions) (*gcpKeyManager, error) {
+	client, err := google.DefaultClient(context.Background(), gcpKMSScope)
+	if err != nil {
+		return nil, fmt.Errorf("error loading google application default credentials: %v", err)
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = gcpKMSEndpoint
+	}
+	return &gcpKeyManager{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		key:      opts.KeyID,
+	}, nil
+}
+
+// GenerateDataKey generates a random data key and wraps it with the CryptoKey
+func (g *gcpKeyManager) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	plaintext, err := encryption.Nonce(dataKeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating data key: %v", err)
+	}
+
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err = g.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}, &resp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error wrapping gcp data key: %v", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding gcp wrapped data key: %v", err)
+	}
+	return plaintext, wrapped, nil
+}
+
+// Decrypt unwraps a data key with the CryptoKey
+func (g *gcpKeyManager) Decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := g.call(ctx, "decrypt", map[string]string{"ciphertext": base64.StdEncoding.EncodeToString(wrapped)}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting gcp data key: %v", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding gcp data key: %v", err)
+	}
+	return plaintext, nil
+}
+
+func (g *gcpKeyManager) call(ctx context.Context, operation string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, _, err := newJSONRequest(ctx, g.endpoint+g.key+":"+operation, in)
+	if err != nil {
+		return err
+	}
+	return doJSON(g.client, req, out)
+}
@@ -0,0 +1,89 @@
+// Package kms implements envelope encryption with data keys protected by an
+// external key management service.
+//
+// Each value is encrypted locally with an AES-256-GCM data key. The data key
+// is wrapped (encrypted) by a master key held in the KMS and stored alongside
+// the value, so the value cannot be decrypted without access to the KMS.
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+const (
+	// dataKeySize is the size of the AES-256 data keys
+	dataKeySize = 32
+
+	// requestTimeout bounds each request to a KMS, including fetching the
+	// credentials it is authenticated with
+	requestTimeout = 10 * time.Second
+)
+
+// KeyManager generates and unwraps data keys using an external key
+// management service.
+type KeyManager interface {
+	// GenerateDataKey returns a new data key, both in plaintext and
+	// wrapped by the master key
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+
+	// Decrypt unwraps a data key previously returned by GenerateDataKey
+	Decrypt(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// NewKeyManager creates a KeyManager for the configured KMS provider
+func NewKeyManager(opts options.SessionKMSOptions) (KeyManager, error) {
+	switch opts.Provider {
+	case options.AWSKMSProvider:
+		return newAWSKeyManager(opts)
+	case options.GCPKMSProvider:
+		return newGCPKeyManager(opts)
+	case options.VaultKMSProvider:
+		return newVaultKeyManager(opts)
+	default:
+		return nil, fmt.Errorf("unknown kms provider %q", opts.Provider)
+	}
+}
+
+// doJSON sends the request and decodes a successful JSON response into out.
+// Non 2xx responses are returned as errors including the response body.
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading kms response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d from kms: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error decoding kms response: %v", err)
+	}
+	return nil
+}
+
+// newJSONRequest builds a POST request with the JSON encoded body
+func newJSONRequest(ctx context.Context, endpoint string, in interface{}) (*http.Request, []byte, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, body, nil
+}
@@ -0,0 +1,185 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDataKey = []byte("0123456789abcdefghijklmnopqrstuv")
+
+func TestVaultKeyManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "token", req.Header.Get("X-Vault-Token"))
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+
+		switch req.URL.Path {
+		case "/v1/transit/datakey/plaintext/sessions":
+			assert.Equal(t, float64(256), body["bits"])
+			rw.Write([]byte(`{"data":{"plaintext":"` + base64.StdEncoding.EncodeToString(testDataKey) + `","ciphertext":"vault:v1:wrapped"}}`))
+		case "/v1/transit/decrypt/sessions":
+			assert.Equal(t, "vault:v1:wrapped", body["ciphertext"])
+			rw.Write([]byte(`{"data":{"plaintext":"` + base64.StdEncoding.EncodeToString(testDataKey) + `"}}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(`{"errors":["not found"]}`))
+		}
+	}))
+	defer server.Close()
+
+	keys, err := NewKeyManager(options.SessionKMSOptions{
+		Provider:   options.VaultKMSProvider,
+		KeyID:      "sessions",
+		Endpoint:   server.URL + "/",
+		VaultToken: "token",
+		VaultMount: "transit",
+	})
+	assert.NoError(t, err)
+
+	plaintext, wrapped, err := keys.GenerateDataKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, testDataKey, plaintext)
+	assert.Equal(t, []byte("vault:v1:wrapped"), wrapped)
+
+	plaintext, err = keys.Decrypt(context.Background(), wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, testDataKey, plaintext)
+
+	keys.(*vaultKeyManager).mount = "missing"
+	_, err = keys.Decrypt(context.Background(), wrapped)
+	assert.EqualError(t, err, `error decrypting vault data key: unexpected status 404 from kms: {"errors":["not found"]}`)
+}
+
+func TestAWSKeyManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "application/x-amz-json-1.1", req.Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request")
+		assert.Equal(t, "session-token", req.Header.Get("X-Amz-Security-Token"))
+
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		assert.Equal(t, "alias/sessions", body["KeyId"])
+
+		switch req.Header.Get("X-Amz-Target") {
+		case "TrentService.GenerateDataKey":
+			assert.Equal(t, "AES_256", body["KeySpec"])
+			json.NewEncoder(rw).Encode(map[string][]byte{"Plaintext": testDataKey, "CiphertextBlob": []byte("wrapped")})
+		case "TrentService.Decrypt":
+			assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("wrapped")), body["CiphertextBlob"])
+			json.NewEncoder(rw).Encode(map[string][]byte{"Plaintext": testDataKey})
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+	keys, err := NewKeyManager(options.SessionKMSOptions{
+		Provider:  options.AWSKMSProvider,
+		KeyID:     "alias/sessions",
+		Endpoint:  server.URL,
+		AWSRegion: "eu-west-1",
+	})
+	assert.NoError(t, err)
+
+	plaintext, wrapped, err := keys.GenerateDataKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, testDataKey, plaintext)
+	assert.Equal(t, []byte("wrapped"), wrapped)
+
+	plaintext, err = keys.Decrypt(context.Background(), wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, testDataKey, plaintext)
+}
+
+func TestAWSKeyManagerRequiresCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	_, err := NewKeyManager(options.SessionKMSOptions{Provider: options.AWSKMSProvider, KeyID: "alias/sessions"})
+	assert.EqualError(t, err, "aws credentials are not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token or container credentials are required when the instance metadata service is disabled")
+}
+
+func TestAWSKeyManagerContainerCredentials(t *testing.T) {
+	credentials := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"AccessKeyId":"ASIATASK","SecretAccessKey":"secret","Token":"task-token","Expiration":"2099-01-01T00:00:00Z"}`))
+	}))
+	defer credentials.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIATASK/"))
+		assert.Equal(t, "task-token", req.Header.Get("X-Amz-Security-Token"))
+		json.NewEncoder(rw).Encode(map[string][]byte{"Plaintext": testDataKey})
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", credentials.URL)
+	keys, err := NewKeyManager(options.SessionKMSOptions{
+		Provider:  options.AWSKMSProvider,
+		KeyID:     "alias/sessions",
+		Endpoint:  server.URL,
+		AWSRegion: "eu-west-1",
+	})
+	assert.NoError(t, err)
+
+	plaintext, err := keys.Decrypt(context.Background(), []byte("wrapped"))
+	assert.NoError(t, err)
+	assert.Equal(t, testDataKey, plaintext)
+}
+
+func TestGCPKeyManager(t *testing.T) {
+	const key = "projects/p/locations/global/keyRings/r/cryptoKeys/sessions"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+
+		switch req.URL.Path {
+		case "/v1/" + key + ":encrypt":
+			plaintext, err := base64.StdEncoding.DecodeString(body["plaintext"])
+			assert.NoError(t, err)
+			json.NewEncoder(rw).Encode(map[string][]byte{"ciphertext": reverse(plaintext)})
+		case "/v1/" + key + ":decrypt":
+			wrapped, err := base64.StdEncoding.DecodeString(body["ciphertext"])
+			assert.NoError(t, err)
+			json.NewEncoder(rw).Encode(map[string][]byte{"plaintext": reverse(wrapped)})
+		}
+	}))
+	defer server.Close()
+
+	keys := &gcpKeyManager{
+		client:   http.DefaultClient,
+		endpoint: server.URL + "/v1/",
+		key:      key,
+	}
+
+	plaintext, wrapped, err := keys.GenerateDataKey(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, plaintext, dataKeySize)
+	assert.Equal(t, reverse(plaintext), wrapped)
+
+	unwrapped, err := keys.Decrypt(context.Background(), wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, unwrapped)
+}
+
+func TestNewKeyManagerUnknownProvider(t *testing.T) {
+	_, err := NewKeyManager(options.SessionKMSOptions{Provider: "unknown"})
+	assert.EqualError(t, err, `unknown kms provider "unknown"`)
+}
@@ -0,0 +1,100 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// vaultKeyManager uses the HashiCorp Vault transit secrets engine
+type vaultKeyManager struct {
+	client  *http.Client
+	address string
+	mount   string
+	key     string
+	token   string
+}
+
+type vaultResponse struct {
+	Data struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+}
+
+func newVaultKeyManager(opts options.SessionKMSOptions) (*vaultKeyManager, error) {
+	address := opts.Endpoint
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, errors.New("vault address is not set")
+	}
+	token := opts.VaultToken
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("vault token is not set")
+	}
+
+	return &vaultKeyManager{
+		client:  requests.DefaultHTTPClient,
+		address: strings.TrimSuffix(address, "/"),
+		mount:   strings.Trim(opts.VaultMount, "/"),
+		key:     opts.KeyID,
+		token:   token,
+	}, nil
+}
+
+// GenerateDataKey requests a new data key from the transit engine
+func (v *vaultKeyManager) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	resp, err := v.call(ctx, "datakey/plaintext", map[string]interface{}{"bits": dataKeySize * 8})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating vault data key: %v", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding vault data key: %v", err)
+	}
+	return plaintext, []byte(resp.Data.Ciphertext), nil
+}
+
+// Decrypt unwraps a data key with the transit engine
+func (v *vaultKeyManager) Decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := v.call(ctx, "decrypt", map[string]interface{}{"ciphertext": string(wrapped)})
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting vault data key: %v", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding vault data key: %v", err)
+	}
+	return plaintext, nil
+}
+
+func (v *vaultKeyManager) call(ctx context.Context, operation string, in interface{}) (*vaultResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", v.address, v.mount, operation, url.PathEscape(v.key))
+	req, _, err := newJSONRequest(ctx, endpoint, in)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp := &vaultResponse{}
+	if err := doJSON(v.client, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
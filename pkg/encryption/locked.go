@@ -0,0 +1,69 @@
+package encryption
+
+import (
+	"runtime"
+	"sync"
+)
+
+// LockedBuffer holds secret material in memory that is locked so that it is
+// not swapped out, excluded from core dumps where the platform allows it, and
+// zeroed when the buffer is destroyed or garbage collected.
+type LockedBuffer struct {
+	mu     sync.Mutex
+	buf    []byte
+	free   func([]byte)
+	locked bool
+}
+
+// NewLockedBuffer copies the secret into a LockedBuffer and zeroes the secret
+func NewLockedBuffer(secret []byte) *LockedBuffer {
+	buf, free, locked := allocLocked(len(secret))
+	copy(buf, secret)
+	Zero(secret)
+
+	b := &LockedBuffer{buf: buf, free: free, locked: locked}
+	runtime.SetFinalizer(b, (*LockedBuffer).Destroy)
+	return b
+}
+
+// Bytes returns a copy of the secret held by the buffer, or nil once the
+// buffer is destroyed.
+// The locked memory itself is never handed out, as it is released when the
+// buffer is destroyed or garbage collected while the copy may still be in
+// use. Callers should Zero the copy once they no longer need it.
+func (b *LockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf == nil {
+		return nil
+	}
+	return append([]byte(nil), b.buf...)
+}
+
+// Locked returns whether the memory of the buffer could be locked
+func (b *LockedBuffer) Locked() bool {
+	return b.locked
+}
+
+// Destroy zeroes and releases the memory of the buffer
+func (b *LockedBuffer) Destroy() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf == nil {
+		return
+	}
+	Zero(b.buf)
+	if b.free != nil {
+		b.free(b.buf)
+	}
+	b.buf = nil
+	runtime.SetFinalizer(b, nil)
+}
+
+// Zero overwrites the secret with zeroes, to scrub it from memory once it is
+// no longer needed
+func Zero(secret []byte) {
+	clear(secret)
+	runtime.KeepAlive(secret)
+}
@@ -0,0 +1,12 @@
+//go:build linux
+
+package encryption
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// excludeFromCoreDump excludes the memory from core dumps
+func excludeFromCoreDump(buf []byte) {
+	_ = unix.Madvise(buf, unix.MADV_DONTDUMP)
+}
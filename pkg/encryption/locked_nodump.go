@@ -0,0 +1,7 @@
+//go:build unix && !linux
+
+package encryption
+
+// excludeFromCoreDump is not supported on this platform: locked memory is
+// still included in core dumps
+func excludeFromCoreDump([]byte) {}
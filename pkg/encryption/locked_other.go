@@ -0,0 +1,9 @@
+//go:build !unix
+
+package encryption
+
+// allocLocked allocates heap memory as memory cannot be locked on this
+// platform. The secret is still zeroed when it is destroyed.
+func allocLocked(size int) ([]byte, func([]byte), bool) {
+	return make([]byte, size), nil, false
+}
@@ -0,0 +1,40 @@
+package encryption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockedBuffer(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	b := NewLockedBuffer(secret)
+
+	assert.Equal(t, []byte("0123456789abcdef"), b.Bytes())
+	assert.Equal(t, make([]byte, 16), secret, "the source secret should be zeroed")
+
+	held := b.Bytes()
+	held[0] = 'x'
+	assert.Equal(t, []byte("0123456789abcdef"), b.Bytes(), "the secret should be copied out")
+
+	b.Destroy()
+	assert.Nil(t, b.Bytes())
+	assert.Equal(t, []byte("x123456789abcdef"), held, "copies should outlive the buffer")
+
+	// Destroying twice is a no-op
+	b.Destroy()
+}
+
+func TestLockedBufferEmpty(t *testing.T) {
+	b := NewLockedBuffer(nil)
+	assert.Empty(t, b.Bytes())
+	b.Destroy()
+}
+
+func TestZero(t *testing.T) {
+	secret := []byte("secret")
+	Zero(secret)
+	assert.Equal(t, make([]byte, 6), secret)
+
+	Zero(nil)
+}
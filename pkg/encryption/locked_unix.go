@@ -0,0 +1,32 @@
+//go:build unix
+
+package encryption
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// allocLocked maps anonymous memory outside of the Go heap for a secret of
+// the size and locks it. The memory is released by the returned function.
+// Heap memory is used when the memory cannot be mapped or locked, eg. when
+// RLIMIT_MEMLOCK is exceeded.
+func allocLocked(size int) ([]byte, func([]byte), bool) {
+	if size == 0 {
+		return []byte{}, nil, false
+	}
+
+	buf, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), nil, false
+	}
+	if err := unix.Mlock(buf); err != nil {
+		_ = unix.Munmap(buf)
+		return make([]byte, size), nil, false
+	}
+	excludeFromCoreDump(buf)
+
+	return buf, func(b []byte) {
+		_ = unix.Munlock(b)
+		_ = unix.Munmap(b)
+	}, true
+}
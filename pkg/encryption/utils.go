@@ -43,12 +43,18 @@ func SecretBytes(secret string) []byte {
 
 // Validate ensures a cookie is properly signed
 func Validate(cookie *http.Cookie, seed string, expiration time.Duration) (value []byte, t time.Time, ok bool) {
+	return ValidateWithKey(cookie, []byte(seed), expiration)
+}
+
+// ValidateWithKey ensures a cookie is properly signed with the key, which is
+// not copied so that it can be held in locked memory
+func ValidateWithKey(cookie *http.Cookie, key []byte, expiration time.Duration) (value []byte, t time.Time, ok bool) {
 	// value, timestamp, sig
 	parts := strings.Split(cookie.Value, "|")
 	if len(parts) != 3 {
 		return
 	}
-	if checkSignature(parts[2], seed, cookie.Name, parts[0], parts[1]) {
+	if checkSignature(parts[2], key, cookie.Name, parts[0], parts[1]) {
 		ts, err := strconv.Atoi(parts[1])
 		if err != nil {
 			return
@@ -73,9 +79,16 @@ func Validate(cookie *http.Cookie, seed string, expiration time.Duration) (value
 
 // SignedValue returns a cookie that is signed and can later be checked with Validate
 func SignedValue(seed string, key string, value []byte, now time.Time) (string, error) {
+	return SignedValueWithKey([]byte(seed), key, value, now)
+}
+
+// SignedValueWithKey returns a cookie that is signed with the signingKey, and
+// can later be checked with ValidateWithKey. The signingKey is not copied so
+// that it can be held in locked memory.
+func SignedValueWithKey(signingKey []byte, key string, value []byte, now time.Time) (string, error) {
 	encodedValue := base64.URLEncoding.EncodeToString(value)
 	timeStr := fmt.Sprintf("%d", now.Unix())
-	sig, err := cookieSignature(sha256.New, seed, key, encodedValue, timeStr)
+	sig, err := cookieSignature(sha256.New, signingKey, key, encodedValue, timeStr)
 	if err != nil {
 		return "", err
 	}
@@ -108,9 +121,9 @@ func GenerateCodeChallenge(method, codeVerifier string) (string, error) {
 	}
 }
 
-func cookieSignature(signer func() hash.Hash, args ...string) (string, error) {
-	h := hmac.New(signer, []byte(args[0]))
-	for _, arg := range args[1:] {
+func cookieSignature(signer func() hash.Hash, key []byte, args ...string) (string, error) {
+	h := hmac.New(signer, key)
+	for _, arg := range args {
 		_, err := h.Write([]byte(arg))
 		if err != nil {
 			return "", err
@@ -121,8 +134,8 @@ func cookieSignature(signer func() hash.Hash, args ...string) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-func checkSignature(signature string, args ...string) bool {
-	checkSig, err := cookieSignature(sha256.New, args...)
+func checkSignature(signature string, key []byte, args ...string) bool {
+	checkSig, err := cookieSignature(sha256.New, key, args...)
 	if err != nil {
 		return false
 	}
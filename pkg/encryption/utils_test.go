@@ -93,17 +93,17 @@ func TestSignAndValidate(t *testing.T) {
 	value := base64.URLEncoding.EncodeToString([]byte("I am soooo encoded"))
 	epoch := "123456789"
 
-	sha256sig, err := cookieSignature(sha256.New, seed, key, value, epoch)
+	sha256sig, err := cookieSignature(sha256.New, []byte(seed), key, value, epoch)
 	assert.NoError(t, err)
-	sha1sig, err := cookieSignature(sha1.New, seed, key, value, epoch)
+	sha1sig, err := cookieSignature(sha1.New, []byte(seed), key, value, epoch)
 	assert.NoError(t, err)
 
-	assert.True(t, checkSignature(sha256sig, seed, key, value, epoch))
+	assert.True(t, checkSignature(sha256sig, []byte(seed), key, value, epoch))
 	// We don't validate legacy SHA1 signatures anymore
-	assert.False(t, checkSignature(sha1sig, seed, key, value, epoch))
+	assert.False(t, checkSignature(sha1sig, []byte(seed), key, value, epoch))
 
-	assert.False(t, checkSignature(sha256sig, seed, key, "tampered", epoch))
-	assert.False(t, checkSignature(sha1sig, seed, key, "tampered", epoch))
+	assert.False(t, checkSignature(sha256sig, []byte(seed), key, "tampered", epoch))
+	assert.False(t, checkSignature(sha1sig, []byte(seed), key, "tampered", epoch))
 }
 
 func TestValidate(t *testing.T) {
@@ -113,7 +113,7 @@ func TestValidate(t *testing.T) {
 	epoch := int64(123456789)
 	epochStr := strconv.FormatInt(epoch, 10)
 
-	sha256sig, err := cookieSignature(sha256.New, seed, key, value, epochStr)
+	sha256sig, err := cookieSignature(sha256.New, []byte(seed), key, value, epochStr)
 	assert.NoError(t, err)
 
 	cookie := &http.Cookie{
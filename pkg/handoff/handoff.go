@@ -0,0 +1,166 @@
+package handoff
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/replay"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// codeIDLength is the length of the random ID identifying each code
+	codeIDLength = 16
+
+	// nonceLength is the length of the random nonces binding the codes to
+	// the browser they are redeemed in
+	nonceLength = 32
+)
+
+var (
+	// ErrInvalidCode is returned when a handoff code cannot be decrypted,
+	// was minted for another proxy or browser, or has expired
+	ErrInvalidCode = errors.New("invalid handoff code")
+
+	// ErrCodeRedeemed is returned when a handoff code has already been redeemed
+	ErrCodeRedeemed = errors.New("handoff code has already been redeemed")
+)
+
+// Codec mints handoff codes carrying a session to a sibling proxy, and
+// redeems the codes minted by its siblings.
+// Codes are encrypted with a key derived from the secret shared by the
+// siblings, are bound to the host of the proxy they were minted for and to
+// the nonce of the browser that asked for them, and can only be redeemed
+// once before they expire.
+type Codec struct {
+	cipher encryption.Cipher
+	expire time.Duration
+	clock  clock.Clock
+
+	redeemed *replay.Cache
+}
+
+// code is the content of an encrypted handoff code
+type code struct {
+	ID        []byte                 `msgpack:"id"`
+	Audience  string                 `msgpack:"aud"`
+	Nonce     string                 `msgpack:"n"`
+	ExpiresAt int64                  `msgpack:"exp"`
+	Session   *sessions.SessionState `msgpack:"s"`
+}
+
+// NewCodec creates a Codec from the handoff options, remembering the codes
+// redeemed in the replay cache
+func NewCodec(opts options.Handoff, redeemed *replay.Cache) (*Codec, error) {
+	key, err := encryption.DeriveKey(encryption.KeyDerivationHKDF, []byte(opts.Secret), encryption.HandoffKeyLabel, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving handoff key: %v", err)
+	}
+	cipher, err := encryption.NewGCMCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating handoff cipher: %v", err)
+	}
+
+	return &Codec{
+		cipher:   cipher,
+		expire:   opts.Expire,
+		redeemed: redeemed,
+	}, nil
+}
+
+// NewNonce returns a random nonce, which the sibling redeeming a code keeps
+// in a cookie of the browser so that the code can only be redeemed in the
+// browser that asked for it
+func NewNonce() (string, error) {
+	nonce, err := encryption.Nonce(nonceLength)
+	if err != nil {
+		return "", fmt.Errorf("error generating handoff nonce: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
+
+// NonceDigest returns the digest of the nonce that codes are minted with, so
+// that the nonce itself is never sent to the proxy minting the code
+func NonceDigest(nonce string) string {
+	digest := sha256.Sum256([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// Mint returns a handoff code carrying the session to the proxy serving the
+// audience host, for the browser whose nonce has the digest given.
+// The refresh token is not handed off so that the proxies do not race each
+// other to refresh, and possibly rotate, the same token.
+func (c *Codec) Mint(s *sessions.SessionState, audience, nonceDigest string) (string, error) {
+	if nonceDigest == "" {
+		return "", errors.New("handoff codes require a nonce")
+	}
+
+	id, err := encryption.Nonce(codeIDLength)
+	if err != nil {
+		return "", fmt.Errorf("error generating handoff code id: %v", err)
+	}
+
+	handoff := *s
+	handoff.RefreshToken = ""
+	packed, err := msgpack.Marshal(&code{
+		ID:        id,
+		Audience:  normalizeHost(audience),
+		Nonce:     nonceDigest,
+		ExpiresAt: c.clock.Now().Add(c.expire).Unix(),
+		Session:   &handoff,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling handoff code: %v", err)
+	}
+
+	encrypted, err := c.cipher.Encrypt(packed)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting handoff code: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encrypted), nil
+}
+
+// Redeem returns the session carried by a handoff code minted for the
+// audience host and the nonce of the browser. Each code can only be redeemed
+// once.
+func (c *Codec) Redeem(value, audience, nonce string) (*sessions.SessionState, error) {
+	encrypted, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCode
+	}
+	packed, err := c.cipher.Decrypt(encrypted)
+	if err != nil {
+		return nil, ErrInvalidCode
+	}
+
+	var handoff code
+	if err := msgpack.Unmarshal(packed, &handoff); err != nil || handoff.Session == nil {
+		return nil, ErrInvalidCode
+	}
+
+	now := c.clock.Now()
+	expiresAt := time.Unix(handoff.ExpiresAt, 0)
+	if handoff.Audience != normalizeHost(audience) || !now.Before(expiresAt) ||
+		nonce == "" || subtle.ConstantTimeCompare([]byte(handoff.Nonce), []byte(NonceDigest(nonce))) != 1 {
+		return nil, ErrInvalidCode
+	}
+
+	if !c.redeemed.Use(hex.EncodeToString(handoff.ID), expiresAt, now) {
+		return nil, ErrCodeRedeemed
+	}
+	return handoff.Session, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(host)
+}
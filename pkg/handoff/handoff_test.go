@@ -0,0 +1,135 @@
+package handoff
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/replay"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handoff Codec", func() {
+	const audience = "app.example.net"
+
+	var codec *Codec
+	var session *sessions.SessionState
+	var nonce string
+
+	BeforeEach(func() {
+		var err error
+		nonce, err = NewNonce()
+		Expect(err).ToNot(HaveOccurred())
+
+		codec, err = NewCodec(options.Handoff{
+			Secret: "a secret shared by sibling proxies",
+			Expire: 30 * time.Second,
+		}, replay.New())
+		Expect(err).ToNot(HaveOccurred())
+		codec.clock.Set(time.Unix(1700000000, 0))
+
+		session = &sessions.SessionState{
+			Email:        "user@example.com",
+			User:         "user",
+			Groups:       []string{"admins"},
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ProviderID:   "google",
+		}
+	})
+
+	AfterEach(func() {
+		codec.clock.Reset()
+	})
+
+	It("hands off the session without its refresh token", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		redeemed, err := codec.Redeem(value, "APP.example.net", nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(redeemed.Email).To(Equal("user@example.com"))
+		Expect(redeemed.Groups).To(ConsistOf("admins"))
+		Expect(redeemed.AccessToken).To(Equal("access"))
+		Expect(redeemed.ProviderID).To(Equal("google"))
+		Expect(redeemed.RefreshToken).To(BeEmpty())
+		Expect(session.RefreshToken).To(Equal("refresh"))
+	})
+
+	It("redeems each code once", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).To(MatchError(ErrCodeRedeemed))
+	})
+
+	It("rejects codes minted for another proxy", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = codec.Redeem(value, "other.example.net", nonce)
+		Expect(err).To(MatchError(ErrInvalidCode))
+	})
+
+	It("rejects codes redeemed in another browser", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		other, err := NewNonce()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = codec.Redeem(value, audience, other)
+		Expect(err).To(MatchError(ErrInvalidCode))
+		_, err = codec.Redeem(value, audience, "")
+		Expect(err).To(MatchError(ErrInvalidCode))
+		_, err = codec.Redeem(value, audience, NonceDigest(nonce))
+		Expect(err).To(MatchError(ErrInvalidCode))
+
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("requires a nonce to mint codes", func() {
+		_, err := codec.Mint(session, audience, "")
+		Expect(err).To(MatchError("handoff codes require a nonce"))
+	})
+
+	It("rejects expired codes", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(codec.clock.Add(30 * time.Second)).To(Succeed())
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).To(MatchError(ErrInvalidCode))
+	})
+
+	It("rejects codes minted with another secret", func() {
+		other, err := NewCodec(options.Handoff{Secret: "another secret", Expire: time.Minute}, replay.New())
+		Expect(err).ToNot(HaveOccurred())
+		value, err := other.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).To(MatchError(ErrInvalidCode))
+		_, err = codec.Redeem("not a code", audience, nonce)
+		Expect(err).To(MatchError(ErrInvalidCode))
+	})
+
+	It("forgets redeemed codes once they expire", func() {
+		value, err := codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(codec.redeemed.Len()).To(Equal(1))
+
+		Expect(codec.clock.Add(time.Minute)).To(Succeed())
+		value, err = codec.Mint(session, audience, NonceDigest(nonce))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = codec.Redeem(value, audience, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(codec.redeemed.Len()).To(Equal(1))
+	})
+})
@@ -10,17 +10,19 @@ import (
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 )
 
+// Injector adds values to the header of a request or response.
+// The request is the request being proxied, which values may be derived from.
 type Injector interface {
-	Inject(http.Header, *sessionsapi.SessionState)
+	Inject(http.Header, *http.Request, *sessionsapi.SessionState)
 }
 
 type injector struct {
 	valueInjectors []valueInjector
 }
 
-func (i injector) Inject(header http.Header, session *sessionsapi.SessionState) {
+func (i injector) Inject(header http.Header, req *http.Request, session *sessionsapi.SessionState) {
 	for _, injector := range i.valueInjectors {
-		injector.inject(header, session)
+		injector.inject(header, req, session)
 	}
 }
 
@@ -40,29 +42,49 @@ func NewInjector(headers []options.Header) (Injector, error) {
 }
 
 type valueInjector interface {
-	inject(http.Header, *sessionsapi.SessionState)
+	inject(http.Header, *http.Request, *sessionsapi.SessionState)
 }
 
 func newValueinjector(name string, value options.HeaderValue) (valueInjector, error) {
 	switch {
-	case value.SecretSource != nil && value.ClaimSource == nil:
+	case countValueSources(value) != 1:
+		return nil, fmt.Errorf("header %q value has multiple entries: only one entry per value is allowed", name)
+	case value.SecretSource != nil:
 		return newSecretInjector(name, value.SecretSource)
-	case value.SecretSource == nil && value.ClaimSource != nil:
+	case value.ClaimSource != nil:
 		return newClaimInjector(name, value.ClaimSource)
+	case value.JWT != nil:
+		return newJWTInjector(name, value.JWT)
 	default:
-		return nil, fmt.Errorf("header %q value has multiple entries: only one entry per value is allowed", name)
+		return newTemplateInjector(name, value.Template)
 	}
 }
 
+// countValueSources counts the sources set on the header value
+func countValueSources(value options.HeaderValue) int {
+	count := 0
+	for _, set := range []bool{
+		value.SecretSource != nil,
+		value.ClaimSource != nil,
+		value.JWT != nil,
+		value.Template != "",
+	} {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
 type injectorFunc struct {
-	injectFunc func(http.Header, *sessionsapi.SessionState)
+	injectFunc func(http.Header, *http.Request, *sessionsapi.SessionState)
 }
 
-func (i *injectorFunc) inject(header http.Header, session *sessionsapi.SessionState) {
-	i.injectFunc(header, session)
+func (i *injectorFunc) inject(header http.Header, req *http.Request, session *sessionsapi.SessionState) {
+	i.injectFunc(header, req, session)
 }
 
-func newInjectorFunc(injectFunc func(header http.Header, session *sessionsapi.SessionState)) valueInjector {
+func newInjectorFunc(injectFunc func(header http.Header, req *http.Request, session *sessionsapi.SessionState)) valueInjector {
 	return &injectorFunc{injectFunc: injectFunc}
 }
 
@@ -72,20 +94,25 @@ func newSecretInjector(name string, source *options.SecretSource) (valueInjector
 		return nil, fmt.Errorf("error getting secret value: %v", err)
 	}
 
-	return newInjectorFunc(func(header http.Header, _ *sessionsapi.SessionState) {
+	return newInjectorFunc(func(header http.Header, _ *http.Request, _ *sessionsapi.SessionState) {
 		header.Add(name, string(value))
 	}), nil
 }
 
 func newClaimInjector(name string, source *options.ClaimSource) (valueInjector, error) {
+	transformer, err := newClaimTransformer(source.Transforms)
+	if err != nil {
+		return nil, err
+	}
+
 	switch {
 	case source.BasicAuthPassword != nil:
 		password, err := util.GetSecretValue(source.BasicAuthPassword)
 		if err != nil {
 			return nil, fmt.Errorf("error loading basicAuthPassword: %v", err)
 		}
-		return newInjectorFunc(func(header http.Header, session *sessionsapi.SessionState) {
-			claimValues := session.GetClaim(source.Claim)
+		return newInjectorFunc(func(header http.Header, _ *http.Request, session *sessionsapi.SessionState) {
+			claimValues := transformer.transform(session.GetClaim(source.Claim))
 			for _, claim := range claimValues {
 				if claim == "" {
 					continue
@@ -95,8 +122,8 @@ func newClaimInjector(name string, source *options.ClaimSource) (valueInjector,
 			}
 		}), nil
 	case source.Prefix != "":
-		return newInjectorFunc(func(header http.Header, session *sessionsapi.SessionState) {
-			claimValues := session.GetClaim(source.Claim)
+		return newInjectorFunc(func(header http.Header, _ *http.Request, session *sessionsapi.SessionState) {
+			claimValues := transformer.transform(session.GetClaim(source.Claim))
 			for _, claim := range claimValues {
 				if claim == "" {
 					continue
@@ -105,8 +132,8 @@ func newClaimInjector(name string, source *options.ClaimSource) (valueInjector,
 			}
 		}), nil
 	default:
-		return newInjectorFunc(func(header http.Header, session *sessionsapi.SessionState) {
-			claimValues := session.GetClaim(source.Claim)
+		return newInjectorFunc(func(header http.Header, _ *http.Request, session *sessionsapi.SessionState) {
+			claimValues := transformer.transform(session.GetClaim(source.Claim))
 			for _, claim := range claimValues {
 				if claim == "" {
 					continue
@@ -34,7 +34,7 @@ var _ = Describe("Injector Suite", func() {
 				Expect(injector).ToNot(BeNil())
 
 				headers := in.initialHeaders.Clone()
-				injector.Inject(headers, in.session)
+				injector.Inject(headers, nil, in.session)
 				Expect(headers).To(Equal(in.expectedHeaders))
 			},
 			Entry("with no configured headers", newInjectorTableInput{
@@ -311,7 +311,7 @@ var _ = Describe("Injector Suite", func() {
 				},
 				session:         &sessionsapi.SessionState{},
 				expectedHeaders: nil,
-				expectedErr:     errors.New("error building injector for header \"Secret\": error getting secret value: secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile"),
+				expectedErr:     errors.New("error building injector for header \"Secret\": error getting secret value: secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef"),
 			}),
 			Entry("with an invalid basicAuthPassword claim valued header", newInjectorTableInput{
 				headers: []options.Header{
@@ -337,7 +337,7 @@ var _ = Describe("Injector Suite", func() {
 					User: "user-123",
 				},
 				expectedHeaders: nil,
-				expectedErr:     errors.New("error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile"),
+				expectedErr:     errors.New("error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef"),
 			}),
 			Entry("with a mix of configured headers", newInjectorTableInput{
 				headers: []options.Header{
@@ -0,0 +1,154 @@
+package header
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	defaultJWTIssuer = "oauth2-proxy"
+	defaultJWTExpiry = 5 * time.Minute
+)
+
+// jwtMinter mints the JWTs injected by a JWTSource
+type jwtMinter struct {
+	key    crypto.Signer
+	method jwt.SigningMethod
+	keyID  string
+	issuer string
+	aud    string
+	expiry time.Duration
+	claims map[string]string
+}
+
+func newJWTInjector(name string, source *options.JWTSource) (valueInjector, error) {
+	minter, err := newJWTMinter(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return newInjectorFunc(func(header http.Header, _ *http.Request, session *sessionsapi.SessionState) {
+		if session == nil {
+			return
+		}
+		token, err := minter.mint(session)
+		if err != nil {
+			logger.Errorf("Error minting JWT for header %q: %v", name, err)
+			return
+		}
+		header.Add(name, source.Prefix+token)
+	}), nil
+}
+
+func newJWTMinter(source *options.JWTSource) (*jwtMinter, error) {
+	if source.SigningKey == nil {
+		return nil, errors.New("jwt has no signingKey")
+	}
+	pemKey, err := util.GetSecretValue(source.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("error loading signingKey: %v", err)
+	}
+	key, method, err := ParseJWTSigningKey(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signingKey: %v", err)
+	}
+
+	m := &jwtMinter{
+		key:    key,
+		method: method,
+		keyID:  source.KeyID,
+		issuer: source.Issuer,
+		aud:    source.Audience,
+		expiry: defaultJWTExpiry,
+		claims: source.Claims,
+	}
+	if m.issuer == "" {
+		m.issuer = defaultJWTIssuer
+	}
+	if source.Expiry != nil {
+		m.expiry = source.Expiry.Duration()
+	}
+	return m, nil
+}
+
+// ParseJWTSigningKey parses a PEM encoded RSA or P-256 EC private key,
+// returning the signing method used with it.
+// The decoded key material is scrubbed once it has been parsed.
+func ParseJWTSigningKey(pemKey []byte) (crypto.Signer, jwt.SigningMethod, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+	defer encryption.Zero(block.Bytes)
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, nil, fmt.Errorf("unsupported EC curve %s: only P-256 is supported", k.Curve.Params().Name)
+		}
+		return k, jwt.SigningMethodES256, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T: only RSA and EC keys are supported", key)
+	}
+}
+
+// mint creates a JWT for the session, signed by the proxy
+func (m *jwtMinter) mint(session *sessionsapi.SessionState) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": m.issuer,
+		"sub": session.User,
+		"iat": now.Unix(),
+		"exp": now.Add(m.expiry).Unix(),
+	}
+	if m.aud != "" {
+		claims["aud"] = m.aud
+	}
+
+	for name, sessionClaim := range m.claims {
+		values := session.GetClaim(sessionClaim)
+		switch {
+		case sessionClaim == "groups":
+			claims[name] = values
+		case len(values) > 0 && values[0] != "":
+			claims[name] = values[0]
+		}
+	}
+
+	token := jwt.NewWithClaims(m.method, claims)
+	if m.keyID != "" {
+		token.Header["kid"] = m.keyID
+	}
+	return token.SignedString(m.key)
+}
@@ -0,0 +1,161 @@
+package header
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWT Injector Suite", func() {
+	encodeKey := func(key crypto.Signer) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).ToNot(HaveOccurred())
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	session := &sessionsapi.SessionState{
+		User:   "user-id",
+		Email:  "user@example.com",
+		Groups: []string{"admins", "devs"},
+	}
+
+	type jwtInjectorTableInput struct {
+		key            crypto.Signer
+		source         options.JWTSource
+		expectedMethod string
+		expectedExpiry time.Duration
+		expectedClaims jwt.MapClaims
+	}
+
+	DescribeTable("injecting a JWT",
+		func(in jwtInjectorTableInput) {
+			in.source.SigningKey = &options.SecretSource{Value: encodeKey(in.key)}
+			injector, err := NewInjector([]options.Header{
+				{
+					Name:   "Authorization",
+					Values: []options.HeaderValue{{JWT: &in.source}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			header := http.Header{}
+			injector.Inject(header, nil, session)
+			value := header.Get("Authorization")
+			Expect(value).To(HavePrefix(in.source.Prefix))
+
+			token, err := jwt.Parse(strings.TrimPrefix(value, in.source.Prefix), func(*jwt.Token) (interface{}, error) {
+				return in.key.Public(), nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(token.Method.Alg()).To(Equal(in.expectedMethod))
+			if in.source.KeyID != "" {
+				Expect(token.Header["kid"]).To(Equal(in.source.KeyID))
+			} else {
+				Expect(token.Header).ToNot(HaveKey("kid"))
+			}
+
+			claims := token.Claims.(jwt.MapClaims)
+			iat, err := claims.GetIssuedAt()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(iat.Time).To(BeTemporally("~", time.Now(), time.Minute))
+			exp, err := claims.GetExpirationTime()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exp.Time).To(BeTemporally("~", iat.Time.Add(in.expectedExpiry), time.Second))
+			delete(claims, "iat")
+			delete(claims, "exp")
+			Expect(claims).To(Equal(in.expectedClaims))
+		},
+		Entry("with an RSA key", jwtInjectorTableInput{
+			key: rsaKey,
+			source: options.JWTSource{
+				KeyID:    "rsa-key",
+				Audience: "upstream",
+				Claims:   map[string]string{"email": "email", "roles": "groups"},
+				Prefix:   "Bearer ",
+			},
+			expectedMethod: "RS256",
+			expectedExpiry: 5 * time.Minute,
+			expectedClaims: jwt.MapClaims{
+				"iss":   "oauth2-proxy",
+				"sub":   "user-id",
+				"aud":   "upstream",
+				"email": "user@example.com",
+				"roles": []interface{}{"admins", "devs"},
+			},
+		}),
+		Entry("with an EC key", jwtInjectorTableInput{
+			key: ecKey,
+			source: options.JWTSource{
+				Issuer: "https://proxy.example.com",
+				Expiry: durationPtr(time.Minute),
+				Claims: map[string]string{"email": "email", "name": "preferred_username"},
+			},
+			expectedMethod: "ES256",
+			expectedExpiry: time.Minute,
+			expectedClaims: jwt.MapClaims{
+				"iss":   "https://proxy.example.com",
+				"sub":   "user-id",
+				"email": "user@example.com",
+			},
+		}),
+	)
+
+	It("does not inject a JWT without a session", func() {
+		injector, err := NewInjector([]options.Header{
+			{
+				Name: "Authorization",
+				Values: []options.HeaderValue{{JWT: &options.JWTSource{
+					SigningKey: &options.SecretSource{Value: encodeKey(ecKey)},
+				}}},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		header := http.Header{}
+		injector.Inject(header, nil, nil)
+		Expect(header).To(BeEmpty())
+	})
+
+	DescribeTable("with an unsupported signing key",
+		func(pemKey []byte, expectedError string) {
+			_, err := NewInjector([]options.Header{
+				{
+					Name: "Authorization",
+					Values: []options.HeaderValue{{JWT: &options.JWTSource{
+						SigningKey: &options.SecretSource{Value: pemKey},
+					}}},
+				},
+			})
+			Expect(err).To(MatchError(ContainSubstring(expectedError)))
+		},
+		Entry("with a P-384 key", func() []byte {
+			key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			return encodeKey(key)
+		}(), "unsupported EC curve P-384: only P-256 is supported"),
+		Entry("with a key that is not PEM encoded", []byte("not a key"), "no PEM block found"),
+	)
+})
+
+func durationPtr(d time.Duration) *options.Duration {
+	duration := options.Duration(d)
+	return &duration
+}
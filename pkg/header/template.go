@@ -0,0 +1,89 @@
+package header
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/templates"
+)
+
+// templateData is the data header value templates are rendered with
+type templateData struct {
+	User              string
+	Email             string
+	PreferredUsername string
+	Groups            []string
+	Request           templateRequest
+
+	session *sessionsapi.SessionState
+}
+
+// templateRequest holds the attributes of the proxied request available to
+// header value templates
+type templateRequest struct {
+	Method string
+	Host   string
+	Path   string
+	Query  string
+	Header http.Header
+}
+
+// Claim returns the first value of the claim of the session, eg.
+// `{{ .Claim "access_token" }}`
+func (d templateData) Claim(name string) string {
+	for _, value := range d.session.GetClaim(name) {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ParseTemplate parses a header value template with the template functions
+// of the proxy
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templates.FuncMap()).Parse(text)
+}
+
+func newTemplateInjector(name, text string) (valueInjector, error) {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+
+	return newInjectorFunc(func(header http.Header, req *http.Request, session *sessionsapi.SessionState) {
+		if session == nil {
+			return
+		}
+
+		data := templateData{
+			User:              session.User,
+			Email:             session.Email,
+			PreferredUsername: session.PreferredUsername,
+			Groups:            session.Groups,
+			session:           session,
+		}
+		if req != nil {
+			data.Request = templateRequest{
+				Method: req.Method,
+				Host:   req.Host,
+				Path:   req.URL.Path,
+				Query:  req.URL.RawQuery,
+				Header: req.Header,
+			}
+		}
+
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			logger.Errorf("Error rendering template for header %q: %v", name, err)
+			return
+		}
+		if buf.Len() > 0 {
+			header.Add(name, buf.String())
+		}
+	}), nil
+}
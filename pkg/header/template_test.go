@@ -0,0 +1,99 @@
+package header
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template Injector Suite", func() {
+	session := &sessionsapi.SessionState{
+		User:              "user-id",
+		Email:             "User@Example.com",
+		PreferredUsername: "user",
+		Groups:            []string{"admins", "devs"},
+		AccessToken:       "access-token",
+	}
+
+	type templateInjectorTableInput struct {
+		template        string
+		session         *sessionsapi.SessionState
+		expectedHeaders http.Header
+	}
+
+	DescribeTable("injecting a templated value",
+		func(in templateInjectorTableInput) {
+			injector, err := NewInjector([]options.Header{
+				{
+					Name:   "X-Auth",
+					Values: []options.HeaderValue{{Template: in.template}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodPost, "https://app.example.com/api/things?id=1", nil)
+			req.Header.Set("X-Tenant", "acme")
+
+			header := http.Header{}
+			injector.Inject(header, req, in.session)
+			Expect(header).To(Equal(in.expectedHeaders))
+		},
+		Entry("with session fields and functions", templateInjectorTableInput{
+			template: `user={{ .Email | lower }};groups={{ .Groups | join "," }}`,
+			session:  session,
+			expectedHeaders: http.Header{
+				"X-Auth": []string{"user=user@example.com;groups=admins,devs"},
+			},
+		}),
+		Entry("with a claim", templateInjectorTableInput{
+			template: `Bearer {{ .Claim "access_token" }}`,
+			session:  session,
+			expectedHeaders: http.Header{
+				"X-Auth": []string{"Bearer access-token"},
+			},
+		}),
+		Entry("with request attributes", templateInjectorTableInput{
+			template: `{{ .Request.Method }} {{ .Request.Host }}{{ .Request.Path }}?{{ .Request.Query }} {{ .Request.Header.Get "X-Tenant" }}`,
+			session:  session,
+			expectedHeaders: http.Header{
+				"X-Auth": []string{"POST app.example.com/api/things?id=1 acme"},
+			},
+		}),
+		Entry("with a conditional on the groups", templateInjectorTableInput{
+			template: `{{ if hasGroup "admins" .Groups }}admin{{ end }}`,
+			session:  session,
+			expectedHeaders: http.Header{
+				"X-Auth": []string{"admin"},
+			},
+		}),
+		Entry("with an empty value", templateInjectorTableInput{
+			template:        `{{ if hasGroup "ops" .Groups }}ops{{ end }}`,
+			session:         session,
+			expectedHeaders: http.Header{},
+		}),
+		Entry("with an error rendering the template", templateInjectorTableInput{
+			template:        `{{ .Email | b64dec }}`,
+			session:         session,
+			expectedHeaders: http.Header{},
+		}),
+		Entry("without a session", templateInjectorTableInput{
+			template:        `user={{ .Email }}`,
+			session:         nil,
+			expectedHeaders: http.Header{},
+		}),
+	)
+
+	It("returns an error for an invalid template", func() {
+		_, err := NewInjector([]options.Header{
+			{
+				Name:   "X-Auth",
+				Values: []options.HeaderValue{{Template: "{{ .Email"}},
+			},
+		})
+		Expect(err).To(MatchError(ContainSubstring(`error building injector for header "X-Auth": error parsing template:`)))
+	})
+})
@@ -0,0 +1,148 @@
+package header
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// claimTransform transforms a claim value, returning false when the value
+// should be left out
+type claimTransform func(string) (string, bool)
+
+// claimTransformer applies the transforms of a ClaimSource to the values of
+// its claim
+type claimTransformer []claimTransform
+
+func newClaimTransformer(transforms []options.ClaimTransform) (claimTransformer, error) {
+	transformer := claimTransformer{}
+	for i, transform := range transforms {
+		t, err := newClaimTransform(transform)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform %d: %v", i+1, err)
+		}
+		transformer = append(transformer, t)
+	}
+	return transformer, nil
+}
+
+func newClaimTransform(transform options.ClaimTransform) (claimTransform, error) {
+	switch {
+	case countClaimTransforms(transform) != 1:
+		return nil, errors.New("exactly one transformation must be set per transform")
+	case transform.Extract != "":
+		return newExtractTransform(transform.Extract)
+	case transform.Replace != nil:
+		return newReplaceTransform(transform.Replace)
+	case transform.Case != "":
+		return newCaseTransform(transform.Case)
+	case transform.Base64 != "":
+		return newBase64Transform(transform.Base64)
+	default:
+		return func(value string) (string, bool) {
+			return strings.TrimPrefix(value, transform.StripPrefix), true
+		}, nil
+	}
+}
+
+// countClaimTransforms counts the transformations set on the transform
+func countClaimTransforms(transform options.ClaimTransform) int {
+	count := 0
+	for _, set := range []bool{
+		transform.Extract != "",
+		transform.Replace != nil,
+		transform.Case != "",
+		transform.Base64 != "",
+		transform.StripPrefix != "",
+	} {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
+func newExtractTransform(pattern string) (claimTransform, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extract: %v", err)
+	}
+	return func(value string) (string, bool) {
+		match := re.FindStringSubmatch(value)
+		switch {
+		case match == nil:
+			return "", false
+		case len(match) > 1:
+			return match[1], true
+		default:
+			return match[0], true
+		}
+	}, nil
+}
+
+func newReplaceTransform(replace *options.ClaimReplace) (claimTransform, error) {
+	re, err := regexp.Compile(replace.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replace pattern: %v", err)
+	}
+	return func(value string) (string, bool) {
+		return re.ReplaceAllString(value, replace.Replacement), true
+	}, nil
+}
+
+func newCaseTransform(c string) (claimTransform, error) {
+	switch c {
+	case "upper":
+		return func(value string) (string, bool) { return strings.ToUpper(value), true }, nil
+	case "lower":
+		return func(value string) (string, bool) { return strings.ToLower(value), true }, nil
+	default:
+		return nil, fmt.Errorf("unknown case %q: expected upper or lower", c)
+	}
+}
+
+func newBase64Transform(direction string) (claimTransform, error) {
+	switch direction {
+	case "encode":
+		return func(value string) (string, bool) {
+			return base64.StdEncoding.EncodeToString([]byte(value)), true
+		}, nil
+	case "decode":
+		return func(value string) (string, bool) {
+			for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+				if decoded, err := encoding.DecodeString(value); err == nil {
+					return string(decoded), true
+				}
+			}
+			return "", false
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown base64 %q: expected encode or decode", direction)
+	}
+}
+
+// transform applies the transforms to each value in order, leaving out values
+// that a transform rejects or that end up empty
+func (t claimTransformer) transform(values []string) []string {
+	if len(t) == 0 {
+		return values
+	}
+
+	transformed := make([]string, 0, len(values))
+	for _, value := range values {
+		ok := true
+		for _, transform := range t {
+			if value, ok = transform(value); !ok {
+				break
+			}
+		}
+		if ok && value != "" {
+			transformed = append(transformed, value)
+		}
+	}
+	return transformed
+}
@@ -0,0 +1,126 @@
+package header
+
+import (
+	"net/http"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Claim Transform Suite", func() {
+	session := &sessionsapi.SessionState{
+		Email:  "John.Doe@corp.example.com",
+		User:   "dXNlci1pZA",
+		Groups: []string{"team:admins", "team:devs", "other"},
+	}
+
+	type transformTableInput struct {
+		source          options.ClaimSource
+		expectedHeaders http.Header
+	}
+
+	DescribeTable("injecting a transformed claim",
+		func(in transformTableInput) {
+			injector, err := NewInjector([]options.Header{
+				{
+					Name:   "X-Remote-User",
+					Values: []options.HeaderValue{{ClaimSource: &in.source}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			header := http.Header{}
+			injector.Inject(header, nil, session)
+			Expect(header).To(Equal(in.expectedHeaders))
+		},
+		Entry("with the local part of a UPN", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "email",
+				Transforms: []options.ClaimTransform{{Extract: "^([^@]+)@"}, {Case: "lower"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"john.doe"}},
+		}),
+		Entry("with a domain qualified username", transformTableInput{
+			source: options.ClaimSource{
+				Claim: "email",
+				Transforms: []options.ClaimTransform{
+					{Replace: &options.ClaimReplace{Pattern: `^([^@]+)@([^.]+)\..*$`, Replacement: `${2}\${1}`}},
+					{Case: "upper"},
+				},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{`CORP\JOHN.DOE`}},
+		}),
+		Entry("with a whole match extracted", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "email",
+				Transforms: []options.ClaimTransform{{Extract: "[a-z]+\\.example\\.com$"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"corp.example.com"}},
+		}),
+		Entry("with groups that do not match left out", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "groups",
+				Prefix:     "role=",
+				Transforms: []options.ClaimTransform{{Extract: "^team:(.+)$"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"role=admins", "role=devs"}},
+		}),
+		Entry("with prefixes stripped", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "groups",
+				Transforms: []options.ClaimTransform{{StripPrefix: "team:"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"admins", "devs", "other"}},
+		}),
+		Entry("with base64 decoding", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "user",
+				Transforms: []options.ClaimTransform{{Base64: "decode"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"user-id"}},
+		}),
+		Entry("with base64 encoding", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "groups",
+				Transforms: []options.ClaimTransform{{Extract: "other"}, {Base64: "encode"}},
+			},
+			expectedHeaders: http.Header{"X-Remote-User": []string{"b3RoZXI="}},
+		}),
+		Entry("with a value that is not base64 encoded", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "email",
+				Transforms: []options.ClaimTransform{{Base64: "decode"}},
+			},
+			expectedHeaders: http.Header{},
+		}),
+		Entry("with a value that is empty once transformed", transformTableInput{
+			source: options.ClaimSource{
+				Claim:      "groups",
+				Transforms: []options.ClaimTransform{{Replace: &options.ClaimReplace{Pattern: ".*"}}},
+			},
+			expectedHeaders: http.Header{},
+		}),
+	)
+
+	DescribeTable("with invalid transforms",
+		func(transform options.ClaimTransform, expectedError string) {
+			_, err := NewInjector([]options.Header{
+				{
+					Name: "X-Remote-User",
+					Values: []options.HeaderValue{{ClaimSource: &options.ClaimSource{
+						Claim:      "email",
+						Transforms: []options.ClaimTransform{{Case: "lower"}, transform},
+					}}},
+				},
+			})
+			Expect(err).To(MatchError(`error building injector for header "X-Remote-User": ` + expectedError))
+		},
+		Entry("with no transformation", options.ClaimTransform{}, "invalid transform 2: exactly one transformation must be set per transform"),
+		Entry("with two transformations", options.ClaimTransform{Case: "upper", StripPrefix: "x"}, "invalid transform 2: exactly one transformation must be set per transform"),
+		Entry("with an invalid extract", options.ClaimTransform{Extract: "("}, "invalid transform 2: invalid extract: error parsing regexp: missing closing ): `(`"),
+		Entry("with an unknown case", options.ClaimTransform{Case: "title"}, `invalid transform 2: unknown case "title": expected upper or lower`),
+		Entry("with an unknown base64 direction", options.ClaimTransform{Base64: "url"}, `invalid transform 2: unknown base64 "url": expected encode or decode`),
+	)
+})
@@ -0,0 +1,290 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// The environment variables of the socket activation protocol of systemd,
+	// see sd_listen_fds(3). A process sets them for the process it upgrades to.
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+
+	// notifySocketEnv is the socket systemd listens on for the readiness of
+	// services, see sd_notify(3)
+	notifySocketEnv = "NOTIFY_SOCKET"
+
+	// upgradeReadyFDEnv is the pipe a process upgraded to writes to once it
+	// is ready, so that the process it upgrades stops serving
+	upgradeReadyFDEnv = "OAUTH2_PROXY_UPGRADE_READY_FD"
+
+	// listenFDsStart is the first file descriptor passed to the process
+	listenFDsStart = 3
+
+	// activatedScheme is the scheme of the bind addresses naming a socket
+	// passed to the process, by its name or file descriptor: `fd://https`
+	activatedScheme = "fd"
+)
+
+// activatedSocket is a socket passed to the process, or bound by it, which
+// is passed to the process it upgrades to
+type activatedSocket struct {
+	// fd is the file descriptor the socket was passed to the process with,
+	// or 0 when the process bound it
+	fd int
+
+	// name is the name of the socket in LISTEN_FDNAMES
+	name string
+
+	listener net.Listener
+}
+
+var (
+	inheritOnce  sync.Once
+	socketsMutex sync.Mutex
+
+	// inheritedSockets are the sockets passed to the process that no server
+	// listens on yet
+	inheritedSockets []activatedSocket
+
+	// boundSockets are the sockets servers listen on
+	boundSockets []activatedSocket
+
+	// upgradeReady is the pipe to write to once the servers of a process
+	// upgraded to are listening
+	upgradeReady *os.File
+)
+
+// listenSocket returns a listener for the network address given: the socket
+// passed to the process for the address if there is one, or a new socket
+// bound to the address.
+func listenSocket(network, address string) (net.Listener, error) {
+	inheritOnce.Do(inheritSockets)
+
+	socketsMutex.Lock()
+	defer socketsMutex.Unlock()
+
+	socket, ok := takeInheritedSocket(network, address)
+	if !ok {
+		if network == activatedScheme {
+			return nil, fmt.Errorf("no socket named %q was passed to the process", address)
+		}
+
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		socket = activatedSocket{listener: listener}
+	}
+	boundSockets = append(boundSockets, socket)
+	return socket.listener, nil
+}
+
+// takeInheritedSocket removes the socket passed to the process for the
+// address from the inherited sockets and returns it
+func takeInheritedSocket(network, address string) (activatedSocket, bool) {
+	for i, socket := range inheritedSockets {
+		var matches bool
+		if network == activatedScheme {
+			matches = socket.name == address || strconv.Itoa(socket.fd) == address
+		} else {
+			matches = sameAddress(socket.listener.Addr(), network, address)
+		}
+		if matches {
+			inheritedSockets = append(inheritedSockets[:i], inheritedSockets[i+1:]...)
+			return socket, true
+		}
+	}
+	return activatedSocket{}, false
+}
+
+// sameAddress returns whether a socket bound to the network address given
+// would be bound to addr. Unspecified IPs match each other, as they all
+// listen on every interface, and port 0 never matches.
+func sameAddress(addr net.Addr, network, address string) bool {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		if !strings.HasPrefix(network, "tcp") {
+			return false
+		}
+		requested, err := net.ResolveTCPAddr(network, address)
+		if err != nil || requested.Port == 0 || requested.Port != addr.Port {
+			return false
+		}
+		if requested.IP == nil || requested.IP.IsUnspecified() {
+			return addr.IP == nil || addr.IP.IsUnspecified()
+		}
+		return requested.IP.Equal(addr.IP)
+	case *net.UnixAddr:
+		return network == "unix" && addr.Name == address
+	default:
+		return false
+	}
+}
+
+// NotifyReady tells the process that started this one that its servers are
+// listening: the process it upgrades, or systemd when it runs the process as
+// a notify service.
+func NotifyReady() error {
+	inheritOnce.Do(inheritSockets)
+
+	socketsMutex.Lock()
+	for _, socket := range inheritedSockets {
+		logger.Errorf("Socket %s (fd %d) passed to the process is not used by any server", socket.listener.Addr(), socket.fd)
+	}
+	ready := upgradeReady
+	upgradeReady = nil
+	socketsMutex.Unlock()
+
+	if ready != nil {
+		_, err := ready.Write([]byte{1})
+		ready.Close()
+		if err != nil {
+			return fmt.Errorf("could not notify the upgraded process: %v", err)
+		}
+	}
+
+	if socket := os.Getenv(notifySocketEnv); socket != "" {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+		if err != nil {
+			return fmt.Errorf("could not notify systemd: %v", err)
+		}
+		defer conn.Close()
+		// The process may not be the main process of the service after an upgrade
+		if _, err := fmt.Fprintf(conn, "MAINPID=%d\nREADY=1", os.Getpid()); err != nil {
+			return fmt.Errorf("could not notify systemd: %v", err)
+		}
+	}
+	return nil
+}
+
+// Upgrade starts a new copy of the process, with the same arguments and
+// environment, passing it the sockets the servers listen on, and returns once
+// the servers of the new process are listening. The process should then stop
+// serving, leaving the new process to serve its clients.
+// The sockets passed to the process keep their file descriptor and name, so
+// that the bind addresses naming them still do in the new process.
+func Upgrade(ctx context.Context) error {
+	inheritOnce.Do(inheritSockets)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the executable: %v", err)
+	}
+
+	files, names, err := upgradeSocketFiles()
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("could not create the ready pipe: %v", err)
+	}
+	defer readyReader.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...) // #nosec G204
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", listenFDsEnv, len(files)),
+		fmt.Sprintf("%s=%s", listenFDNamesEnv, strings.Join(names, ":")),
+		fmt.Sprintf("%s=%d", upgradeReadyFDEnv, listenFDsStart+len(files)),
+	)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("could not start the new process: %v", err)
+	}
+
+	ready := make(chan bool, 1)
+	go func() {
+		n, _ := readyReader.Read(make([]byte, 1))
+		ready <- n > 0
+	}()
+
+	select {
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return ctx.Err()
+	case ok := <-ready:
+		if !ok {
+			return fmt.Errorf("the new process exited before it was ready: %v", cmd.Wait())
+		}
+	}
+
+	// Unix sockets are now served by the new process, they must not be
+	// removed when the servers of this process close them
+	socketsMutex.Lock()
+	defer socketsMutex.Unlock()
+	for _, socket := range boundSockets {
+		if unixListener, ok := socket.listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+	return nil
+}
+
+// upgradeSocketFiles returns the files and names of the sockets passed to
+// the process upgraded to: the sockets passed to this process, whether a
+// server listens on them or not, in the order of their file descriptors,
+// followed by the sockets bound by this process. Sockets closed by their
+// server are skipped.
+func upgradeSocketFiles() ([]*os.File, []string, error) {
+	socketsMutex.Lock()
+	defer socketsMutex.Unlock()
+
+	sockets := append(append([]activatedSocket{}, boundSockets...), inheritedSockets...)
+	sort.SliceStable(sockets, func(i, j int) bool {
+		if sockets[i].fd == 0 || sockets[j].fd == 0 {
+			return sockets[j].fd == 0 && sockets[i].fd != 0
+		}
+		return sockets[i].fd < sockets[j].fd
+	})
+
+	var files []*os.File
+	var names []string
+	closed := map[net.Listener]bool{}
+	for _, socket := range sockets {
+		filer, ok := socket.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return files, nil, fmt.Errorf("cannot pass the socket %s to the new process", socket.listener.Addr())
+		}
+		file, err := filer.File()
+		if errors.Is(err, net.ErrClosed) {
+			closed[socket.listener] = true
+			continue
+		}
+		if err != nil {
+			return files, nil, fmt.Errorf("cannot pass the socket %s to the new process: %v", socket.listener.Addr(), err)
+		}
+		files = append(files, file)
+		names = append(names, socket.name)
+	}
+
+	open := boundSockets[:0]
+	for _, socket := range boundSockets {
+		if !closed[socket.listener] {
+			open = append(open, socket)
+		}
+	}
+	boundSockets = open
+	return files, names, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package http
+
+import (
+	"os"
+)
+
+// UpgradeSignal is nil as processes cannot be upgraded on this platform
+var UpgradeSignal os.Signal
+
+// inheritSockets does nothing as sockets cannot be passed to processes on
+// this platform
+func inheritSockets() {}
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"net"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Socket activation", func() {
+	var inherited net.Listener
+
+	BeforeEach(func() {
+		// Load the (empty) environment so that it does not replace the sockets
+		inheritOnce.Do(inheritSockets)
+
+		var err error
+		inherited, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		socketsMutex.Lock()
+		inheritedSockets = []activatedSocket{{fd: 3, name: "web", listener: inherited}}
+		socketsMutex.Unlock()
+	})
+
+	AfterEach(func() {
+		Expect(inherited.Close()).To(Succeed())
+
+		socketsMutex.Lock()
+		inheritedSockets = nil
+		socketsMutex.Unlock()
+	})
+
+	type listenSocketTableInput struct {
+		network         string
+		address         func() string
+		expectInherited bool
+		expectedErr     string
+	}
+
+	DescribeTable("listenSocket",
+		func(in listenSocketTableInput) {
+			listener, err := listenSocket(in.network, in.address())
+			if in.expectedErr != "" {
+				Expect(err).To(MatchError(in.expectedErr))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+
+			if in.expectInherited {
+				Expect(listener).To(BeIdenticalTo(inherited))
+				Expect(inheritedSockets).To(BeEmpty())
+				return
+			}
+			Expect(listener).ToNot(BeIdenticalTo(inherited))
+			Expect(inheritedSockets).To(HaveLen(1))
+			Expect(listener.Close()).To(Succeed())
+		},
+		Entry("with the name of the socket", listenSocketTableInput{
+			network:         "fd",
+			address:         func() string { return "web" },
+			expectInherited: true,
+		}),
+		Entry("with the file descriptor of the socket", listenSocketTableInput{
+			network:         "fd",
+			address:         func() string { return "3" },
+			expectInherited: true,
+		}),
+		Entry("with the name of a socket that was not passed", listenSocketTableInput{
+			network:     "fd",
+			address:     func() string { return "admin" },
+			expectedErr: "no socket named \"admin\" was passed to the process",
+		}),
+		Entry("with the address of the socket", listenSocketTableInput{
+			network:         "tcp",
+			address:         func() string { return inherited.Addr().String() },
+			expectInherited: true,
+		}),
+		Entry("with another address", listenSocketTableInput{
+			network: "tcp",
+			address: func() string { return "127.0.0.1:0" },
+		}),
+		Entry("with a unix socket", listenSocketTableInput{
+			network: "unix",
+			address: func() string { return filepath.Join(GinkgoT().TempDir(), "proxy.sock") },
+		}),
+	)
+
+	It("Serves the socket of its bind address", func() {
+		srv, err := NewServer(Opts{
+			Handler:     nil,
+			BindAddress: "fd://web",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		s, ok := srv.(*server)
+		Expect(ok).To(BeTrue())
+		Expect(s.listener).To(BeIdenticalTo(inherited))
+	})
+
+	type sameAddressTableInput struct {
+		addr     net.Addr
+		network  string
+		address  string
+		expected bool
+	}
+
+	DescribeTable("sameAddress",
+		func(in sameAddressTableInput) {
+			Expect(sameAddress(in.addr, in.network, in.address)).To(Equal(in.expected))
+		},
+		Entry("with the same address", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4180},
+			network:  "tcp",
+			address:  "127.0.0.1:4180",
+			expected: true,
+		}),
+		Entry("with another port", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4180},
+			network:  "tcp",
+			address:  "127.0.0.1:4181",
+			expected: false,
+		}),
+		Entry("with another IP", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4180},
+			network:  "tcp",
+			address:  "127.0.0.2:4180",
+			expected: false,
+		}),
+		Entry("with unspecified IPs", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv6unspecified, Port: 4180},
+			network:  "tcp",
+			address:  "0.0.0.0:4180",
+			expected: true,
+		}),
+		Entry("with no host", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv6unspecified, Port: 4180},
+			network:  "tcp",
+			address:  ":4180",
+			expected: true,
+		}),
+		Entry("with port 0", sameAddressTableInput{
+			addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0},
+			network:  "tcp",
+			address:  "127.0.0.1:0",
+			expected: false,
+		}),
+		Entry("with the same unix socket", sameAddressTableInput{
+			addr:     &net.UnixAddr{Name: "/run/oauth2-proxy.sock", Net: "unix"},
+			network:  "unix",
+			address:  "/run/oauth2-proxy.sock",
+			expected: true,
+		}),
+		Entry("with a unix socket and a TCP address", sameAddressTableInput{
+			addr:     &net.UnixAddr{Name: "/run/oauth2-proxy.sock", Net: "unix"},
+			network:  "tcp",
+			address:  "127.0.0.1:4180",
+			expected: false,
+		}),
+	)
+})
@@ -0,0 +1,65 @@
+//go:build unix
+
+package http
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+// UpgradeSignal is the signal that upgrades the process to a new copy of it
+var UpgradeSignal os.Signal = syscall.SIGUSR2
+
+// inheritSockets takes the sockets passed to the process by systemd or by the
+// process it upgrades, as described by the environment. The environment is
+// cleared so that processes started by this one do not take them too.
+func inheritSockets() {
+	pid := os.Getenv(listenPIDEnv)
+	count, countErr := strconv.Atoi(os.Getenv(listenFDsEnv))
+	names := strings.Split(os.Getenv(listenFDNamesEnv), ":")
+	readyFD, readyErr := strconv.Atoi(os.Getenv(upgradeReadyFDEnv))
+	for _, env := range []string{listenPIDEnv, listenFDsEnv, listenFDNamesEnv, upgradeReadyFDEnv} {
+		os.Unsetenv(env)
+	}
+
+	// The process upgrading this one cannot know its PID, systemd sets it
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	if readyErr == nil {
+		unix.CloseOnExec(readyFD)
+		upgradeReady = os.NewFile(uintptr(readyFD), "upgrade-ready")
+	}
+	if countErr != nil {
+		return
+	}
+
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		unix.CloseOnExec(fd)
+
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			logger.Errorf("Error using socket fd %d passed to the process: %v", fd, err)
+			continue
+		}
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			// The socket file belongs to the process that created it
+			unixListener.SetUnlinkOnClose(false)
+		}
+		inheritedSockets = append(inheritedSockets, activatedSocket{fd: fd, name: name, listener: listener})
+	}
+}
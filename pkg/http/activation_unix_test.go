@@ -0,0 +1,119 @@
+//go:build unix
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// upgradeChildEnv is set for the test binary started by Upgrade, which then
+// runs serveUpgraded instead of the tests
+const upgradeChildEnv = "OAUTH2_PROXY_TEST_UPGRADE_CHILD"
+
+func init() {
+	if os.Getenv(upgradeChildEnv) != "" {
+		os.Exit(serveUpgraded())
+	}
+}
+
+// serveUpgraded is the process the tests upgrade to. It listens on every
+// socket passed to it, and answers the first connection to the socket named
+// web with the file descriptors and names of the sockets.
+func serveUpgraded() int {
+	inheritOnce.Do(inheritSockets)
+
+	socketsMutex.Lock()
+	sockets := append([]activatedSocket{}, inheritedSockets...)
+	socketsMutex.Unlock()
+
+	passed := make([]string, 0, len(sockets))
+	var web net.Listener
+	for _, socket := range sockets {
+		passed = append(passed, fmt.Sprintf("%d=%s", socket.fd, socket.name))
+		listener, err := listenSocket(activatedScheme, strconv.Itoa(socket.fd))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if socket.name == "web" {
+			web = listener
+		}
+	}
+	if web == nil {
+		fmt.Fprintln(os.Stderr, "no socket named web was passed")
+		return 1
+	}
+	if err := NotifyReady(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	conn, err := web.Accept()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, strings.Join(passed, " "))
+	return 0
+}
+
+var _ = Describe("Upgrade", func() {
+	It("passes the sockets with their file descriptors and names", func() {
+		inheritOnce.Do(inheritSockets)
+
+		web, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		unused, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		socketsMutex.Lock()
+		inheritedSockets = []activatedSocket{
+			{fd: 3, name: "web", listener: web},
+			{fd: 4, name: "admin", listener: unused},
+		}
+		boundSockets = nil
+		socketsMutex.Unlock()
+
+		// The socket bound by the process is passed after those passed to it
+		bound, err := listenSocket("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = listenSocket(activatedScheme, "web")
+		Expect(err).ToNot(HaveOccurred())
+
+		DeferCleanup(func() {
+			for _, listener := range []net.Listener{web, unused, bound} {
+				listener.Close()
+			}
+			socketsMutex.Lock()
+			inheritedSockets = nil
+			boundSockets = nil
+			socketsMutex.Unlock()
+		})
+
+		Expect(os.Setenv(upgradeChildEnv, "1")).To(Succeed())
+		DeferCleanup(os.Unsetenv, upgradeChildEnv)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		Expect(Upgrade(ctx)).To(Succeed())
+
+		conn, err := net.Dial("tcp", web.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.SetReadDeadline(time.Now().Add(10 * time.Second))).To(Succeed())
+		passed, err := io.ReadAll(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(passed)).To(Equal("3=web 4=admin 5="))
+	})
+})
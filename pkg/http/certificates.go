@@ -0,0 +1,202 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// certificatesDirInterval is how often the certificates directory is
+	// checked for changes, during TLS handshakes
+	certificatesDirInterval = 30 * time.Second
+
+	certificateFileExt = ".crt"
+	keyFileExt         = ".key"
+)
+
+// sniCertificates selects the certificate of a TLS handshake from the server
+// name the client requests with SNI, among the certificates given for hosts
+// and the certificates of a directory
+type sniCertificates struct {
+	hosts map[string]*tls.Certificate
+	dir   *certificatesDir
+}
+
+// configureCertificates sets the certificates of a TLS configuration from
+// the TLS options: the certificate of the Key and Cert, which is served to
+// clients that request no other host, and the further certificates served
+// for the hosts requested with SNI
+func configureCertificates(config *tls.Config, tlsOpts *options.TLS) error {
+	if tlsOpts.Key != nil || tlsOpts.Cert != nil || (len(tlsOpts.Certificates) == 0 && tlsOpts.CertificatesDir == "") {
+		cert, err := loadCertificate(tlsOpts.Key, tlsOpts.Cert)
+		if err != nil {
+			return fmt.Errorf("could not load certificate: %v", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(tlsOpts.Certificates) == 0 && tlsOpts.CertificatesDir == "" {
+		return nil
+	}
+
+	sni := &sniCertificates{hosts: map[string]*tls.Certificate{}}
+	for i, certOpts := range tlsOpts.Certificates {
+		cert, err := loadCertificate(certOpts.Key, certOpts.Cert)
+		if err != nil {
+			return fmt.Errorf("could not load certificates[%d]: %v", i, err)
+		}
+		// The TLS server matches the certificates without hosts to the server
+		// names from their DNS names
+		config.Certificates = append(config.Certificates, cert)
+		for _, host := range certOpts.Hosts {
+			sni.hosts[normalizeCertificateHost(host)] = &cert
+		}
+	}
+	if tlsOpts.CertificatesDir != "" {
+		sni.dir = &certificatesDir{path: tlsOpts.CertificatesDir}
+		if err := sni.dir.load(); err != nil {
+			return fmt.Errorf("could not load certificates directory: %v", err)
+		}
+	}
+	config.GetCertificate = sni.getCertificate
+	return nil
+}
+
+// getCertificate returns the certificate given for the host requested by the
+// client, or found for it in the certificates directory. It returns no
+// certificate when there is none, for the TLS server to select one of the
+// certificates of its configuration.
+func (s *sniCertificates) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		return nil, nil
+	}
+	if cert := matchCertificate(s.hosts, hello.ServerName); cert != nil {
+		return cert, nil
+	}
+	if s.dir != nil {
+		return s.dir.getCertificate(hello.ServerName), nil
+	}
+	return nil, nil
+}
+
+// matchCertificate returns the certificate of the hosts for the server name,
+// or of its wildcard host
+func matchCertificate(hosts map[string]*tls.Certificate, serverName string) *tls.Certificate {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if cert, ok := hosts[serverName]; ok {
+		return cert
+	}
+	if _, domain, ok := strings.Cut(serverName, "."); ok {
+		return hosts["*."+domain]
+	}
+	return nil
+}
+
+// normalizeCertificateHost lower cases a host and writes its subdomain
+// wildcards as `*.`, like the DNS names of certificates
+func normalizeCertificateHost(host string) string {
+	host = strings.ToLower(host)
+	if strings.HasPrefix(host, ".") {
+		return "*" + host
+	}
+	return host
+}
+
+// certificatesDir holds the certificates of a directory, by their DNS names,
+// reloading them when the files of the directory change
+type certificatesDir struct {
+	path string
+
+	mutex     sync.RWMutex
+	hosts     map[string]*tls.Certificate
+	files     string
+	checkedAt time.Time
+}
+
+// getCertificate returns the certificate of the directory for the server
+// name, reloading the directory first if it may have changed
+func (d *certificatesDir) getCertificate(serverName string) *tls.Certificate {
+	d.mutex.RLock()
+	stale := time.Since(d.checkedAt) > certificatesDirInterval
+	d.mutex.RUnlock()
+
+	if stale {
+		if err := d.load(); err != nil {
+			logger.Errorf("Error reloading the certificates of %s: %v", d.path, err)
+		}
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return matchCertificate(d.hosts, serverName)
+}
+
+// load loads the certificates of the directory if its files changed since
+// they were last loaded. Certificates that cannot be loaded are skipped, as
+// they may be being written.
+func (d *certificatesDir) load() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.checkedAt = time.Now()
+
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return err
+	}
+
+	// The names, sizes and modification times of the files tell whether
+	// they changed since the certificates were last loaded
+	var names, files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if ext != certificateFileExt && ext != keyFileExt {
+			continue
+		}
+		// Stat follows the symbolic links of mounted secrets
+		info, err := os.Stat(filepath.Join(d.path, entry.Name()))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if ext == certificateFileExt {
+			names = append(names, strings.TrimSuffix(entry.Name(), ext))
+		}
+		files = append(files, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(files)
+	signature := strings.Join(files, "\n")
+	if d.hosts != nil && signature == d.files {
+		return nil
+	}
+
+	hosts := map[string]*tls.Certificate{}
+	for _, name := range names {
+		certFile := filepath.Join(d.path, name+certificateFileExt)
+		keyFile := filepath.Join(d.path, name+keyFileExt)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			logger.Errorf("Error loading the certificate %s: %v", certFile, err)
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			logger.Errorf("Error parsing the certificate %s: %v", certFile, err)
+			continue
+		}
+		cert.Leaf = leaf
+		for _, host := range leaf.DNSNames {
+			hosts[normalizeCertificateHost(host)] = &cert
+		}
+	}
+	d.hosts = hosts
+	d.files = signature
+	return nil
+}
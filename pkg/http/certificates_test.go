@@ -0,0 +1,179 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SNI certificates", func() {
+	// generateCertificate returns the PEM encoded certificate and key of a
+	// self-signed certificate for the DNS names, identified by its common name
+	generateCertificate := func(commonName string, dnsNames ...string) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     dnsNames,
+		}
+		certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		Expect(err).ToNot(HaveOccurred())
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}),
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	}
+
+	writeCertificate := func(dir, name, commonName string, dnsNames ...string) {
+		certData, keyData := generateCertificate(commonName, dnsNames...)
+		Expect(os.WriteFile(filepath.Join(dir, name+".crt"), certData, 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, name+".key"), keyData, 0600)).To(Succeed())
+	}
+
+	// servedCertificate returns the common name of the certificate served to
+	// a client requesting the server name
+	servedCertificate := func(config *tls.Config, serverName string) string {
+		serverConn, clientConn := net.Pipe()
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		go func() {
+			_ = tls.Server(serverConn, config).Handshake()
+		}()
+
+		client := tls.Client(clientConn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}) // #nosec G402
+		if err := client.Handshake(); err != nil {
+			return err.Error()
+		}
+		return client.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	var dir string
+	var tlsOpts *options.TLS
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeCertificate(dir, "directory", "directory", "dir.example.net")
+		Expect(os.WriteFile(filepath.Join(dir, "README"), []byte("certificates"), 0600)).To(Succeed())
+
+		defaultCert, defaultKey := generateCertificate("default", "example.com")
+		hostsCert, hostsKey := generateCertificate("hosts", "hosts.example.com")
+		namesCert, namesKey := generateCertificate("names", "*.example.org")
+		tlsOpts = &options.TLS{
+			Cert: &options.SecretSource{Value: defaultCert},
+			Key:  &options.SecretSource{Value: defaultKey},
+			Certificates: []options.TLSCertificate{
+				{
+					Hosts: []string{"app.example.com", ".apps.example.com"},
+					Cert:  &options.SecretSource{Value: hostsCert},
+					Key:   &options.SecretSource{Value: hostsKey},
+				},
+				{
+					Cert: &options.SecretSource{Value: namesCert},
+					Key:  &options.SecretSource{Value: namesKey},
+				},
+			},
+			CertificatesDir: dir,
+		}
+	})
+
+	DescribeTable("serves the certificate of the requested host",
+		func(serverName, expected string) {
+			config := &tls.Config{}
+			Expect(configureCertificates(config, tlsOpts)).To(Succeed())
+			Expect(servedCertificate(config, serverName)).To(Equal(expected))
+		},
+		Entry("with a host of a certificate", "app.example.com", "hosts"),
+		Entry("with a subdomain of a wildcard host", "one.apps.example.com", "hosts"),
+		Entry("with a host in different case", "APP.example.com", "hosts"),
+		Entry("with a DNS name of a certificate", "www.example.org", "names"),
+		Entry("with a DNS name of a certificate of the directory", "dir.example.net", "directory"),
+		Entry("with another host", "other.example.com", "default"),
+		Entry("without a server name", "", "default"),
+	)
+
+	It("serves the certificates alone without a certificate and key", func() {
+		tlsOpts.Cert = nil
+		tlsOpts.Key = nil
+
+		config := &tls.Config{}
+		Expect(configureCertificates(config, tlsOpts)).To(Succeed())
+		Expect(servedCertificate(config, "dir.example.net")).To(Equal("directory"))
+		Expect(servedCertificate(config, "app.example.com")).To(Equal("hosts"))
+	})
+
+	It("fails when the certificates directory cannot be read", func() {
+		tlsOpts.CertificatesDir = filepath.Join(dir, "missing")
+
+		err := configureCertificates(&tls.Config{}, tlsOpts)
+		Expect(err).To(MatchError(ContainSubstring("could not load certificates directory")))
+	})
+
+	It("fails when a certificate cannot be loaded", func() {
+		tlsOpts.Certificates[1].Key = nil
+
+		err := configureCertificates(&tls.Config{}, tlsOpts)
+		Expect(err).To(MatchError("could not load certificates[1]: could not load key data: no configuration provided"))
+	})
+
+	Context("with a certificates directory", func() {
+		var certificates *certificatesDir
+
+		BeforeEach(func() {
+			certificates = &certificatesDir{path: dir}
+			Expect(certificates.load()).To(Succeed())
+		})
+
+		commonName := func(serverName string) string {
+			cert := certificates.getCertificate(serverName)
+			if cert == nil {
+				return ""
+			}
+			return cert.Leaf.Subject.CommonName
+		}
+
+		It("picks up the certificates added once the directory is checked again", func() {
+			writeCertificate(dir, "added", "added", "added.example.net")
+			Expect(commonName("added.example.net")).To(BeEmpty())
+
+			certificates.checkedAt = time.Time{}
+			Expect(commonName("added.example.net")).To(Equal("added"))
+			Expect(commonName("dir.example.net")).To(Equal("directory"))
+		})
+
+		It("picks up the certificates replaced and removed", func() {
+			writeCertificate(dir, "directory", "replaced", "dir.example.net", "new.example.net")
+			certificates.checkedAt = time.Time{}
+			Expect(commonName("dir.example.net")).To(Equal("replaced"))
+			Expect(commonName("new.example.net")).To(Equal("replaced"))
+
+			Expect(os.Remove(filepath.Join(dir, "directory.crt"))).To(Succeed())
+			certificates.checkedAt = time.Time{}
+			Expect(commonName("dir.example.net")).To(BeEmpty())
+		})
+
+		It("skips the certificates that cannot be loaded", func() {
+			Expect(os.WriteFile(filepath.Join(dir, "broken.crt"), []byte("not a certificate"), 0600)).To(Succeed())
+			certificates.checkedAt = time.Time{}
+			Expect(commonName("dir.example.net")).To(Equal("directory"))
+		})
+	})
+})
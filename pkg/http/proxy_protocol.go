@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyProtocolHeaderTimeout is how long clients have to send the PROXY
+// protocol header once connected.
+const proxyProtocolHeaderTimeout = 10 * time.Second
+
+var (
+	// proxyProtocolV1Prefix starts the human readable header of version 1
+	proxyProtocolV1Prefix = []byte("PROXY ")
+
+	// proxyProtocolV2Signature starts the binary header of version 2
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolListener accepts connections from a load balancer that sends
+// the address of its client in a PROXY protocol header, version 1 or 2, as
+// specified by https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt.
+// The connections take the address of the client as their remote address.
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+// Accept waits for the next connection. Its header is read on the first
+// call of its Read or RemoteAddr methods, so that a slow client does not
+// block the connections of other clients.
+func (l proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn is a connection starting with a PROXY protocol header
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// Read reads the data following the header. Connections without a valid
+// header fail with the error of their header.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the address of the client of the load balancer, or the
+// address of the load balancer for its own connections, such as health checks.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads the header, within the header timeout
+func (c *proxyProtocolConn) readHeader() {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout)); err != nil {
+		c.err = err
+		return
+	}
+	c.remoteAddr, c.err = readProxyProtocolHeader(c.reader)
+	if c.err != nil {
+		c.err = fmt.Errorf("invalid PROXY protocol header from %s: %v", c.Conn.RemoteAddr(), c.err)
+		return
+	}
+	c.err = c.Conn.SetReadDeadline(time.Time{})
+}
+
+// readProxyProtocolHeader reads a version 1 or 2 header and returns the
+// source address it carries, which is nil when the header carries none
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	switch {
+	case bytes.Equal(signature, proxyProtocolV2Signature):
+		return readProxyProtocolV2Header(r)
+	case bytes.HasPrefix(signature, proxyProtocolV1Prefix):
+		return readProxyProtocolV1Header(r)
+	default:
+		return nil, errors.New("missing header")
+	}
+}
+
+// readProxyProtocolV1Header reads a header of the form
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n" or "PROXY UNKNOWN\r\n"
+func readProxyProtocolV1Header(r *bufio.Reader) (net.Addr, error) {
+	// The header is at most 107 bytes long
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("could not read header: %v", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("header is not terminated by CRLF")
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return nil, nil
+	case len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6"):
+		return nil, fmt.Errorf("malformed header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtocolV2Header reads a binary header: the signature, the
+// version and command, the address family and protocol, the length of the
+// addresses, and the addresses
+func readProxyProtocolV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyProtocolV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	versionCommand := header[12]
+	family := header[13]
+	addresses := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, addresses); err != nil {
+		return nil, fmt.Errorf("could not read header addresses: %v", err)
+	}
+
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version %d", versionCommand>>4)
+	}
+	switch versionCommand & 0x0f {
+	case 0x0:
+		// LOCAL: the connection of the load balancer itself
+		return nil, nil
+	case 0x1:
+		// PROXY: the connection of a client of the load balancer
+	default:
+		return nil, fmt.Errorf("unsupported command %d", versionCommand&0x0f)
+	}
+
+	switch family >> 4 {
+	case 0x1:
+		// AF_INET: source and destination addresses, then ports
+		if len(addresses) < 12 {
+			return nil, errors.New("truncated IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 0x2:
+		// AF_INET6
+		if len(addresses) < 36 {
+			return nil, errors.New("truncated IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	default:
+		// AF_UNSPEC and AF_UNIX carry no client IP
+		return nil, nil
+	}
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gleak"
+)
+
+var _ = Describe("PROXY protocol", func() {
+	Context("readProxyProtocolHeader", func() {
+		type headerTableInput struct {
+			header       string
+			expectedAddr string
+			expectedErr  string
+		}
+
+		v2Header := func(command, family byte, addresses ...byte) string {
+			header := append([]byte{}, proxyProtocolV2Signature...)
+			header = append(header, 0x20|command, family, 0, byte(len(addresses)))
+			return string(append(header, addresses...))
+		}
+
+		DescribeTable("reads the client address of the header", func(in headerTableInput) {
+			r := bufio.NewReader(strings.NewReader(in.header + "GET / HTTP/1.1\r\n"))
+
+			addr, err := readProxyProtocolHeader(r)
+			if in.expectedErr != "" {
+				Expect(err).To(MatchError(ContainSubstring(in.expectedErr)))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			if in.expectedAddr == "" {
+				Expect(addr).To(BeNil())
+			} else {
+				Expect(addr.String()).To(Equal(in.expectedAddr))
+			}
+
+			rest, err := io.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(rest)).To(Equal("GET / HTTP/1.1\r\n"))
+		},
+			Entry("with a version 1 TCP4 header", headerTableInput{
+				header:       "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+				expectedAddr: "192.0.2.1:56324",
+			}),
+			Entry("with a version 1 TCP6 header", headerTableInput{
+				header:       "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n",
+				expectedAddr: "[2001:db8::1]:56324",
+			}),
+			Entry("with a version 1 UNKNOWN header", headerTableInput{
+				header: "PROXY UNKNOWN\r\n",
+			}),
+			Entry("with a version 1 header with a mismatched address family", headerTableInput{
+				header:      "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n",
+				expectedErr: "invalid source address \"2001:db8::1\"",
+			}),
+			Entry("with a malformed version 1 header", headerTableInput{
+				header:      "PROXY TCP4 192.0.2.1\r\n",
+				expectedErr: "malformed header",
+			}),
+			Entry("with a version 2 IPv4 header", headerTableInput{
+				header:       v2Header(0x1, 0x11, 192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb),
+				expectedAddr: "192.0.2.1:56324",
+			}),
+			Entry("with a version 2 IPv6 header", headerTableInput{
+				header: v2Header(0x1, 0x21,
+					0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+					0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+					0xdc, 0x04, 0x01, 0xbb),
+				expectedAddr: "[2001:db8::1]:56324",
+			}),
+			Entry("with a version 2 LOCAL header", headerTableInput{
+				header: v2Header(0x0, 0x00),
+			}),
+			Entry("with a truncated version 2 IPv4 header", headerTableInput{
+				header:      v2Header(0x1, 0x11, 192, 0, 2, 1),
+				expectedErr: "truncated IPv4 addresses",
+			}),
+			Entry("without a header", headerTableInput{
+				header:      "GET / HTTP/1.1\r\n",
+				expectedErr: "missing header",
+			}),
+		)
+	})
+
+	Context("with a server", func() {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		var listenAddr string
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			srv, err := NewServer(Opts{
+				Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					rw.Write([]byte(req.RemoteAddr))
+				}),
+				BindAddress:   "127.0.0.1:0",
+				ProxyProtocol: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			s, ok := srv.(*server)
+			Expect(ok).To(BeTrue())
+			listenAddr = s.listener.Addr().String()
+
+			go func() {
+				defer GinkgoRecover()
+				Expect(srv.Start(ctx)).To(Succeed())
+			}()
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(Goroutines).ShouldNot(HaveLeaked())
+		})
+
+		request := func(header string) (string, error) {
+			conn, err := net.Dial("tcp", listenAddr)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+
+			if _, err := fmt.Fprintf(conn, "%sGET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n", header); err != nil {
+				return "", err
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			return string(body), err
+		}
+
+		It("serves the requests with the client address of the header", func() {
+			body, err := request("PROXY TCP4 192.0.2.1 198.51.100.1 56324 80\r\n")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal("192.0.2.1:56324"))
+		})
+
+		It("rejects the connections without a header", func() {
+			body, err := request("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal("400 Bad Request"))
+		})
+	})
+})
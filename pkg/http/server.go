@@ -12,7 +12,11 @@ import (
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	pkgutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -35,12 +39,38 @@ type Opts struct {
 
 	// TLS is the TLS configuration for the server.
 	TLS *options.TLS
+
+	// RequestClientCert asks clients for a certificate during the TLS
+	// handshake, without requiring or verifying it, so that handlers can
+	// authenticate clients that present one.
+	RequestClientCert bool
+
+	// HTTP2 serves HTTP/2 to clients that negotiate it over TLS, and to
+	// clients using HTTP/2 cleartext (h2c) on the HTTP server.
+	HTTP2 bool
+
+	// ProxyProtocol requires connections to start with a PROXY protocol
+	// header, whose client address becomes the remote address of requests.
+	ProxyProtocol bool
+
+	// Listeners are further addresses the server should listen on, each with
+	// its own TLS configuration.
+	Listeners []options.Listener
+
+	// GetCertificate, if set, returns the certificate of the HTTPS server for
+	// each TLS handshake, in place of the certificate of the TLS options.
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// NextProtos are further application protocols the HTTPS server
+	// negotiates, such as the ACME TLS-ALPN-01 challenge protocol.
+	NextProtos []string
 }
 
 // NewServer creates a new Server from the options given.
 func NewServer(opts Opts) (Server, error) {
 	s := &server{
 		handler: opts.Handler,
+		http2:   opts.HTTP2,
 	}
 	if err := s.setupListener(opts); err != nil {
 		return nil, fmt.Errorf("error setting up listener: %v", err)
@@ -48,6 +78,12 @@ func NewServer(opts Opts) (Server, error) {
 	if err := s.setupTLSListener(opts); err != nil {
 		return nil, fmt.Errorf("error setting up TLS listener: %v", err)
 	}
+	for _, listenerOpts := range opts.Listeners {
+		if err := s.setupAdditionalListener(opts, listenerOpts); err != nil {
+			s.close()
+			return nil, fmt.Errorf("error setting up listener on %s: %v", listenerOpts.BindAddress, err)
+		}
+	}
 
 	return s, nil
 }
@@ -55,9 +91,20 @@ func NewServer(opts Opts) (Server, error) {
 // server is an implementation of the Server interface.
 type server struct {
 	handler http.Handler
+	http2   bool
 
 	listener    net.Listener
 	tlsListener net.Listener
+
+	// listeners are the additional listeners of the server
+	listeners []additionalListener
+}
+
+// additionalListener is a listener the server serves traffic on in addition
+// to its HTTP and HTTPS listeners
+type additionalListener struct {
+	net.Listener
+	secure bool
 }
 
 // setupListener sets the server listener if the HTTP server is enabled.
@@ -69,18 +116,90 @@ func (s *server) setupListener(opts Opts) error {
 		return nil
 	}
 
-	networkType := getNetworkScheme(opts.BindAddress)
-	listenAddr := getListenAddress(opts.BindAddress)
-
-	listener, err := net.Listen(networkType, listenAddr)
+	listener, err := listen(opts.BindAddress, opts.ProxyProtocol)
 	if err != nil {
-		return fmt.Errorf("listen (%s, %s) failed: %v", networkType, listenAddr, err)
+		return err
 	}
 	s.listener = listener
+	return nil
+}
 
+// setupAdditionalListener adds a listener on the address given, serving TLS
+// when the listener has a TLS configuration
+func (s *server) setupAdditionalListener(opts Opts, listenerOpts options.Listener) error {
+	if listenerOpts.TLS == nil {
+		listener, err := listen(listenerOpts.BindAddress, opts.ProxyProtocol)
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, additionalListener{Listener: listener})
+		return nil
+	}
+
+	config, err := newTLSConfig(listenerOpts.TLS, opts)
+	if err != nil {
+		return err
+	}
+	listener, err := listenTLS(listenerOpts.BindAddress, config, opts.ProxyProtocol)
+	if err != nil {
+		return err
+	}
+	s.listeners = append(s.listeners, additionalListener{Listener: listener, secure: true})
 	return nil
 }
 
+// listen listens for HTTP clients on the address given
+func listen(address string, proxyProtocol bool) (net.Listener, error) {
+	networkType := getNetworkScheme(address)
+	listenAddr := getListenAddress(address)
+
+	listener, err := listenSocket(networkType, listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen (%s, %s) failed: %v", networkType, listenAddr, err)
+	}
+	if proxyProtocol {
+		return proxyProtocolListener{listener}, nil
+	}
+	return listener, nil
+}
+
+// listenTLS listens for HTTPS clients on the address given. The address is a
+// TCP address, or names a socket passed to the process.
+func listenTLS(address string, config *tls.Config, proxyProtocol bool) (net.Listener, error) {
+	networkType := "tcp"
+	if getNetworkScheme(address) == activatedScheme {
+		networkType = activatedScheme
+	}
+	listenAddr := getListenAddress(address)
+
+	listener, err := listenSocket(networkType, listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen (%s) failed: %v", listenAddr, err)
+	}
+
+	var tcpListener net.Listener = listener
+	if listener, ok := listener.(*net.TCPListener); ok {
+		tcpListener = tcpKeepAliveListener{listener}
+	}
+	if proxyProtocol {
+		tcpListener = proxyProtocolListener{tcpListener}
+	}
+	return tls.NewListener(tcpListener, config), nil
+}
+
+// close closes the listeners of a server that will not be started
+func (s *server) close() {
+	listeners := []net.Listener{s.listener, s.tlsListener}
+	for _, listener := range s.listeners {
+		listeners = append(listeners, listener.Listener)
+	}
+	for _, listener := range listeners {
+		if listener != nil {
+			listener.Close()
+		}
+	}
+}
+
 func parseCipherSuites(names []string) ([]uint16, error) {
 	cipherNameMap := make(map[string]uint16)
 
@@ -111,30 +230,113 @@ func (s *server) setupTLSListener(opts Opts) error {
 		return nil
 	}
 
-	config := &tls.Config{
-		MinVersion: tls.VersionTLS12, // default, override below
-		MaxVersion: tls.VersionTLS13,
-		NextProtos: []string{"http/1.1"},
+	var config *tls.Config
+	var err error
+	if opts.GetCertificate != nil {
+		config, err = newCertificateManagerTLSConfig(opts)
+	} else {
+		config, err = newTLSConfig(opts.TLS, opts)
 	}
-	if opts.TLS == nil {
-		return errors.New("no TLS config provided")
+	if err != nil {
+		return err
 	}
-	cert, err := getCertificate(opts.TLS)
+	listener, err := listenTLS(opts.SecureBindAddress, config, opts.ProxyProtocol)
 	if err != nil {
-		return fmt.Errorf("could not load certificate: %v", err)
+		return err
+	}
+	s.tlsListener = listener
+	return nil
+}
+
+// newCertificateManagerTLSConfig builds the TLS configuration of the HTTPS
+// server when its certificates are managed by the GetCertificate function of
+// the options. The TLS options, which are optional, configure the rest.
+func newCertificateManagerTLSConfig(opts Opts) (*tls.Config, error) {
+	tlsOpts := opts.TLS
+	if tlsOpts == nil {
+		tlsOpts = &options.TLS{}
+	}
+	config := &tls.Config{GetCertificate: opts.GetCertificate}
+	if err := configureTLS(config, tlsOpts, opts); err != nil {
+		return nil, err
+	}
+	config.NextProtos = append(config.NextProtos, opts.NextProtos...)
+	return config, nil
+}
+
+// newTLSConfig builds the TLS configuration of a listener from its TLS
+// options and the options of its server
+func newTLSConfig(tlsOpts *options.TLS, opts Opts) (*tls.Config, error) {
+	if tlsOpts == nil {
+		return nil, errors.New("no TLS config provided")
+	}
+	config := &tls.Config{}
+	if err := configureCertificates(config, tlsOpts); err != nil {
+		return nil, err
+	}
+	if err := configureTLS(config, tlsOpts, opts); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// configureTLS sets the protocol versions, cipher suites and client
+// certificate options of a TLS configuration
+func configureTLS(config *tls.Config, tlsOpts *options.TLS, opts Opts) error {
+	config.MinVersion = tls.VersionTLS12 // default, override below
+	config.MaxVersion = tls.VersionTLS13
+	config.NextProtos = []string{"http/1.1"}
+	if opts.RequestClientCert {
+		config.ClientAuth = tls.RequestClientCert
+	}
+	if len(tlsOpts.ClientCAFiles) > 0 {
+		pool, err := pkgutil.GetCertPool(tlsOpts.ClientCAFiles, false)
+		if err != nil {
+			return fmt.Errorf("could not load client CA files: %v", err)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if tlsOpts.ClientAuth != "" {
+		clientAuth, err := parseClientAuth(tlsOpts.ClientAuth)
+		if err != nil {
+			return err
+		}
+		config.ClientAuth = clientAuth
+	}
+	if opts.HTTP2 {
+		config.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+	if len(tlsOpts.ALPNProtocols) > 0 {
+		config.NextProtos = append([]string{}, tlsOpts.ALPNProtocols...)
 	}
-	config.Certificates = []tls.Certificate{cert}
 
-	if len(opts.TLS.CipherSuites) > 0 {
-		cipherSuites, err := parseCipherSuites(opts.TLS.CipherSuites)
+	if len(tlsOpts.CipherSuites) > 0 {
+		cipherSuites, err := parseCipherSuites(tlsOpts.CipherSuites)
 		if err != nil {
 			return fmt.Errorf("could not parse cipher suites: %v", err)
 		}
 		config.CipherSuites = cipherSuites
 	}
 
-	if len(opts.TLS.MinVersion) > 0 {
-		switch opts.TLS.MinVersion {
+	if encryption.FIPSMode() {
+		// Cipher suites are checked against the approved list during validation
+		if len(config.CipherSuites) == 0 {
+			config.CipherSuites = encryption.FIPSApprovedCipherSuites
+		}
+		config.CurvePreferences = encryption.FIPSApprovedCurves
+	}
+	if len(tlsOpts.CurvePreferences) > 0 {
+		// Curves are checked against the approved list during validation
+		curves, err := parseCurvePreferences(tlsOpts.CurvePreferences)
+		if err != nil {
+			return fmt.Errorf("could not parse curve preferences: %v", err)
+		}
+		config.CurvePreferences = curves
+	}
+
+	if len(tlsOpts.MinVersion) > 0 {
+		switch tlsOpts.MinVersion {
 		case "TLS1.2":
 			config.MinVersion = tls.VersionTLS12
 		case "TLS1.3":
@@ -143,16 +345,57 @@ func (s *server) setupTLSListener(opts Opts) error {
 			return errors.New("unknown TLS MinVersion config provided")
 		}
 	}
+	if len(tlsOpts.MaxVersion) > 0 {
+		switch tlsOpts.MaxVersion {
+		case "TLS1.2":
+			config.MaxVersion = tls.VersionTLS12
+		case "TLS1.3":
+			config.MaxVersion = tls.VersionTLS13
+		default:
+			return errors.New("unknown TLS MaxVersion config provided")
+		}
+	}
+	if config.MinVersion > config.MaxVersion {
+		return errors.New("TLS MinVersion is greater than MaxVersion")
+	}
+
+	return nil
+}
 
-	listenAddr := getListenAddress(opts.SecureBindAddress)
+func parseCurvePreferences(names []string) ([]tls.CurveID, error) {
+	curveNameMap := make(map[string]tls.CurveID)
+	for _, curve := range []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521} {
+		curveNameMap[encryption.CurveName(curve)] = curve
+	}
 
-	listener, err := net.Listen("tcp", listenAddr)
-	if err != nil {
-		return fmt.Errorf("listen (%s) failed: %v", listenAddr, err)
+	result := make([]tls.CurveID, len(names))
+	for i, name := range names {
+		id, present := curveNameMap[name]
+		if !present {
+			return nil, fmt.Errorf("unknown TLS curve name specified %q", name)
+		}
+		result[i] = id
 	}
+	return result, nil
+}
 
-	s.tlsListener = tls.NewListener(tcpKeepAliveListener{listener.(*net.TCPListener)}, config)
-	return nil
+// parseClientAuth returns the client authentication type of a ClientAuth
+// option
+func parseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case options.TLSClientAuthNone:
+		return tls.NoClientCert, nil
+	case options.TLSClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case options.TLSClientAuthRequire:
+		return tls.RequireAnyClientCert, nil
+	case options.TLSClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case options.TLSClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown TLS ClientAuth config provided %q", clientAuth)
+	}
 }
 
 // Start starts the HTTP and HTTPS server if applicable.
@@ -163,7 +406,7 @@ func (s *server) Start(ctx context.Context) error {
 
 	if s.listener != nil {
 		g.Go(func() error {
-			if err := s.startServer(groupCtx, s.listener); err != nil {
+			if err := s.startServer(groupCtx, s.listener, false); err != nil {
 				return fmt.Errorf("error starting insecure server: %v", err)
 			}
 			return nil
@@ -172,21 +415,36 @@ func (s *server) Start(ctx context.Context) error {
 
 	if s.tlsListener != nil {
 		g.Go(func() error {
-			if err := s.startServer(groupCtx, s.tlsListener); err != nil {
+			if err := s.startServer(groupCtx, s.tlsListener, true); err != nil {
 				return fmt.Errorf("error starting secure server: %v", err)
 			}
 			return nil
 		})
 	}
 
+	for _, listener := range s.listeners {
+		listener := listener
+		g.Go(func() error {
+			if err := s.startServer(groupCtx, listener.Listener, listener.secure); err != nil {
+				return fmt.Errorf("error starting server on %s: %v", listener.Addr(), err)
+			}
+			return nil
+		})
+	}
+
 	return g.Wait()
 }
 
 // startServer creates and starts a new server with the given listener.
 // When the given context is cancelled the server will be shutdown.
 // If any errors occur, only the first error will be returned.
-func (s *server) startServer(ctx context.Context, listener net.Listener) error {
+func (s *server) startServer(ctx context.Context, listener net.Listener, secure bool) error {
 	srv := &http.Server{Handler: s.handler, ReadHeaderTimeout: time.Minute}
+	if s.http2 {
+		if err := configureHTTP2(srv, secure); err != nil {
+			return err
+		}
+	}
 	g, groupCtx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -208,6 +466,21 @@ func (s *server) startServer(ctx context.Context, listener net.Listener) error {
 	return g.Wait()
 }
 
+// configureHTTP2 serves HTTP/2 on the server: negotiated by the TLS
+// handshake on secure servers, and with prior knowledge or an upgrade from
+// HTTP/1.1 (h2c) on insecure servers
+func configureHTTP2(srv *http.Server, secure bool) error {
+	h2Server := &http2.Server{}
+	if !secure {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2Server)
+		return nil
+	}
+	if err := http2.ConfigureServer(srv, h2Server); err != nil {
+		return fmt.Errorf("could not configure HTTP/2: %v", err)
+	}
+	return nil
+}
+
 // getNetworkScheme gets the scheme for the HTTP server.
 func getNetworkScheme(addr string) string {
 	var scheme string
@@ -230,24 +503,24 @@ func getListenAddress(addr string) string {
 	return slice[len(slice)-1]
 }
 
-// getCertificate loads the certificate data from the TLS config.
-func getCertificate(opts *options.TLS) (tls.Certificate, error) {
-	keyData, err := getSecretValue(opts.Key)
+// loadCertificate loads the certificate data of a key and certificate.
+func loadCertificate(key, cert *options.SecretSource) (tls.Certificate, error) {
+	keyData, err := getSecretValue(key)
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("could not load key data: %v", err)
 	}
 
-	certData, err := getSecretValue(opts.Cert)
+	certData, err := getSecretValue(cert)
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("could not load cert data: %v", err)
 	}
 
-	cert, err := tls.X509KeyPair(certData, keyData)
+	certificate, err := tls.X509KeyPair(certData, keyData)
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("could not parse certificate data: %v", err)
 	}
 
-	return cert, nil
+	return certificate, nil
 }
 
 // getSecretValue wraps util.GetSecretValue so that we can return an error if no
@@ -2,16 +2,29 @@ package http
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gleak"
+	"golang.org/x/net/http2"
 )
 
 const hello = "Hello World!"
@@ -300,6 +313,80 @@ var _ = Describe("Server", func() {
 				expectHTTPListener: false,
 				expectTLSListener:  true,
 			}),
+			Entry("with an ipv4 valid https bind address, and valid TLS config with a TLS policy", &newServerTableInput{
+				opts: Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:              &ipv4KeyDataSource,
+						Cert:             &ipv4CertDataSource,
+						MaxVersion:       "TLS1.2",
+						CurvePreferences: []string{"X25519", "P256"},
+						ALPNProtocols:    []string{"http/1.1"},
+						ClientAuth:       options.TLSClientAuthRequest,
+					},
+				},
+				expectedErr:        nil,
+				expectHTTPListener: false,
+				expectTLSListener:  true,
+			}),
+			Entry("with an ipv4 valid https bind address, and invalid TLS config with unknown MaxVersion", &newServerTableInput{
+				opts: Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:        &ipv4KeyDataSource,
+						Cert:       &ipv4CertDataSource,
+						MaxVersion: "TLS1.1",
+					},
+				},
+				expectedErr:        errors.New("error setting up TLS listener: unknown TLS MaxVersion config provided"),
+				expectHTTPListener: false,
+				expectTLSListener:  true,
+			}),
+			Entry("with an ipv4 valid https bind address, and invalid TLS config with MinVersion greater than MaxVersion", &newServerTableInput{
+				opts: Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:        &ipv4KeyDataSource,
+						Cert:       &ipv4CertDataSource,
+						MinVersion: "TLS1.3",
+						MaxVersion: "TLS1.2",
+					},
+				},
+				expectedErr:        errors.New("error setting up TLS listener: TLS MinVersion is greater than MaxVersion"),
+				expectHTTPListener: false,
+				expectTLSListener:  true,
+			}),
+			Entry("with an ipv4 valid https bind address, and invalid TLS config with unknown CurvePreferences", &newServerTableInput{
+				opts: Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:              &ipv4KeyDataSource,
+						Cert:             &ipv4CertDataSource,
+						CurvePreferences: []string{"P224"},
+					},
+				},
+				expectedErr:        errors.New("error setting up TLS listener: could not parse curve preferences: unknown TLS curve name specified \"P224\""),
+				expectHTTPListener: false,
+				expectTLSListener:  true,
+			}),
+			Entry("with an ipv4 valid https bind address, and invalid TLS config with unknown ClientAuth", &newServerTableInput{
+				opts: Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:        &ipv4KeyDataSource,
+						Cert:       &ipv4CertDataSource,
+						ClientAuth: "optional",
+					},
+				},
+				expectedErr:        errors.New("error setting up TLS listener: unknown TLS ClientAuth config provided \"optional\""),
+				expectHTTPListener: false,
+				expectTLSListener:  true,
+			}),
 			Entry("with an ipv6 valid http bind address", &newServerTableInput{
 				opts: Opts{
 					Handler:     handler,
@@ -682,6 +769,138 @@ var _ = Describe("Server", func() {
 			})
 		})
 
+		Context("with a certificate manager", func() {
+			var secureListenAddr string
+
+			BeforeEach(func() {
+				cert, err := tls.X509KeyPair(ipv4CertDataSource.Value, ipv4KeyDataSource.Value)
+				Expect(err).ToNot(HaveOccurred())
+
+				srv, err = NewServer(Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+						return &cert, nil
+					},
+					NextProtos: []string{"acme-tls/1"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				s, ok := srv.(*server)
+				Expect(ok).To(BeTrue())
+
+				secureListenAddr = fmt.Sprintf("https://%s/", s.tlsListener.Addr().String())
+			})
+
+			It("Serves the certificate of the manager", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				resp, err := httpGet(ctx, secureListenAddr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				Expect(resp.TLS.VerifiedChains).Should(HaveLen(1))
+				Expect(resp.TLS.VerifiedChains[0][0].Raw).Should(Equal(ipv4CertData))
+			})
+
+			It("Negotiates the further protocols", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				conn, err := tls.Dial("tcp", strings.TrimSuffix(strings.TrimPrefix(secureListenAddr, "https://"), "/"), &tls.Config{
+					RootCAs:    transport.TLSClientConfig.RootCAs,
+					NextProtos: []string{"acme-tls/1"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				Expect(conn.ConnectionState().NegotiatedProtocol).To(Equal("acme-tls/1"))
+			})
+		})
+
+		Context("with a TLS policy", func() {
+			var secureAddr string
+
+			BeforeEach(func() {
+				var err error
+				srv, err = NewServer(Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					HTTP2:             true,
+					TLS: &options.TLS{
+						Key:              &ipv4KeyDataSource,
+						Cert:             &ipv4CertDataSource,
+						MaxVersion:       "TLS1.2",
+						CurvePreferences: []string{"P384"},
+						ALPNProtocols:    []string{"http/1.1"},
+						ClientAuth:       options.TLSClientAuthRequire,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				s, ok := srv.(*server)
+				Expect(ok).To(BeTrue())
+
+				secureAddr = s.tlsListener.Addr().String()
+
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+			})
+
+			dial := func(config *tls.Config) (*tls.Conn, error) {
+				config.RootCAs = transport.TLSClientConfig.RootCAs
+				conn, err := tls.Dial("tcp", secureAddr, config)
+				if err != nil {
+					return nil, err
+				}
+				// Client certificates are checked after the client handshake
+				// completes, when the server reads from the connection
+				_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+				if err == nil {
+					_, err = conn.Read(make([]byte, 1))
+				}
+				return conn, err
+			}
+
+			It("Negotiates the versions, curves and protocols of the policy", func() {
+				clientCert, err := tls.X509KeyPair(ipv4CertDataSource.Value, ipv4KeyDataSource.Value)
+				Expect(err).ToNot(HaveOccurred())
+
+				conn, err := dial(&tls.Config{
+					Certificates: []tls.Certificate{clientCert},
+					NextProtos:   []string{"h2", "http/1.1"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				state := conn.ConnectionState()
+				Expect(state.Version).To(Equal(uint16(tls.VersionTLS12)))
+				Expect(state.NegotiatedProtocol).To(Equal("http/1.1"))
+			})
+
+			It("Refuses clients without a certificate", func() {
+				_, err := dial(&tls.Config{})
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("Refuses clients without a curve of the policy", func() {
+				clientCert, err := tls.X509KeyPair(ipv4CertDataSource.Value, ipv4KeyDataSource.Value)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = dial(&tls.Config{
+					Certificates:     []tls.Certificate{clientCert},
+					CurvePreferences: []tls.CurveID{tls.X25519},
+				})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("with both an ipv4 http and an ipv4 https server", func() {
 			var listenAddr, secureListenAddr string
 
@@ -759,6 +978,87 @@ var _ = Describe("Server", func() {
 			})
 		})
 
+		Context("with HTTP/2 enabled", func() {
+			var listenAddr, secureListenAddr string
+			var h2Transport *http2.Transport
+
+			BeforeEach(func() {
+				var err error
+				srv, err = NewServer(Opts{
+					Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+						rw.Write([]byte(req.Proto))
+					}),
+					BindAddress:       "127.0.0.1:0",
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:  &ipv4KeyDataSource,
+						Cert: &ipv4CertDataSource,
+					},
+					HTTP2: true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				s, ok := srv.(*server)
+				Expect(ok).To(BeTrue())
+
+				listenAddr = fmt.Sprintf("http://%s/", s.listener.Addr().String())
+				secureListenAddr = fmt.Sprintf("https://%s/", s.tlsListener.Addr().String())
+
+				h2Transport = &http2.Transport{
+					AllowHTTP:       true,
+					TLSClientConfig: transport.TLSClientConfig.Clone(),
+				}
+			})
+
+			get := func(url string) string {
+				req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := h2Transport.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				// Close the connection so that the server connection goroutines stop
+				defer h2Transport.CloseIdleConnections()
+
+				body, err := io.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return string(body)
+			}
+
+			It("Serves HTTP/2 cleartext on http", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				h2Transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				}
+				Expect(get(listenAddr)).To(Equal("HTTP/2.0"))
+			})
+
+			It("Negotiates HTTP/2 on https", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				Expect(get(secureListenAddr)).To(Equal("HTTP/2.0"))
+			})
+
+			It("Still serves HTTP/1.1 clients", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				resp, err := httpGet(ctx, listenAddr)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := io.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("HTTP/1.1"))
+			})
+		})
+
 		Context("with an ipv6 http server", func() {
 			var listenAddr string
 
@@ -957,6 +1257,86 @@ var _ = Describe("Server", func() {
 				}).Should(HaveOccurred())
 			})
 		})
+
+		Context("with additional listeners", func() {
+			var listenAddr, clientCertListenAddr string
+			var clientCert tls.Certificate
+
+			BeforeEach(func() {
+				var clientCAFile string
+				clientCert, clientCAFile = generateClientCert()
+
+				var err error
+				srv, err = NewServer(Opts{
+					Handler:           handler,
+					SecureBindAddress: "127.0.0.1:0",
+					TLS: &options.TLS{
+						Key:  &ipv4KeyDataSource,
+						Cert: &ipv4CertDataSource,
+					},
+					Listeners: []options.Listener{
+						{BindAddress: "127.0.0.1:0"},
+						{
+							BindAddress: "127.0.0.1:0",
+							TLS: &options.TLS{
+								Key:           &ipv4KeyDataSource,
+								Cert:          &ipv4CertDataSource,
+								ClientCAFiles: []string{clientCAFile},
+							},
+						},
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				s, ok := srv.(*server)
+				Expect(ok).To(BeTrue())
+				Expect(s.listeners).To(HaveLen(2))
+
+				listenAddr = fmt.Sprintf("http://%s/", s.listeners[0].Addr().String())
+				clientCertListenAddr = fmt.Sprintf("https://%s/", s.listeners[1].Addr().String())
+			})
+
+			It("Serves the handler on every listener", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				resp, err := httpGet(ctx, listenAddr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				c := &http.Client{Transport: transport.Clone()}
+				c.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+				req, err := http.NewRequestWithContext(ctx, "GET", clientCertListenAddr, nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err = c.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				c.CloseIdleConnections()
+			})
+
+			It("Refuses clients without a client certificate", func() {
+				go func() {
+					defer GinkgoRecover()
+					Expect(srv.Start(ctx)).To(Succeed())
+				}()
+
+				_, err := httpGet(ctx, clientCertListenAddr)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		It("Fails when a listener cannot be set up", func() {
+			_, err := NewServer(Opts{
+				Handler:     handler,
+				BindAddress: "127.0.0.1:0",
+				Listeners: []options.Listener{
+					{BindAddress: "127.0.0.1:0", TLS: &options.TLS{Cert: &ipv4CertDataSource}},
+				},
+			})
+			Expect(err).To(MatchError("error setting up listener on 127.0.0.1:0: could not load certificate: could not load key data: no configuration provided"))
+		})
 	})
 
 	Context("getNetworkScheme", func() {
@@ -999,3 +1379,24 @@ func skipDevContainer() {
 		Skip("Skipping testing in DevContainer environment")
 	}
 }
+
+// generateClientCert generates a self-signed client certificate, and writes
+// it to a file to be used as the client CA
+func generateClientCert() (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+
+	caFile := filepath.Join(GinkgoT().TempDir(), "client-ca.pem")
+	Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600)).To(Succeed())
+	return tls.Certificate{Certificate: [][]byte{certBytes}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,116 @@
+package identity
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// Normalizer normalizes the user ID and email of sessions, so that users
+// keep the same identity when their identity provider changes the format of
+// their user ID or email.
+type Normalizer struct {
+	lowercaseUser  bool
+	lowercaseEmail bool
+	domainAliases  map[string]string
+	subjectEmails  map[string]string
+}
+
+// NewNormalizer creates the Normalizer of the options, loading the subject
+// emails file. It returns nil when no normalization is configured.
+func NewNormalizer(opts options.IdentityNormalization) (*Normalizer, error) {
+	if !opts.LowercaseUser && !opts.LowercaseEmail && len(opts.EmailDomainAliases) == 0 && opts.SubjectEmailsFile == "" {
+		return nil, nil
+	}
+
+	n := &Normalizer{
+		lowercaseUser:  opts.LowercaseUser,
+		lowercaseEmail: opts.LowercaseEmail,
+	}
+
+	domainAliases, err := ParseEmailDomainAliases(opts.EmailDomainAliases)
+	if err != nil {
+		return nil, err
+	}
+	n.domainAliases = domainAliases
+
+	if opts.SubjectEmailsFile != "" {
+		subjectEmails, err := loadSubjectEmails(opts.SubjectEmailsFile)
+		if err != nil {
+			return nil, err
+		}
+		n.subjectEmails = subjectEmails
+	}
+	return n, nil
+}
+
+// ParseEmailDomainAliases parses `old.com=new.com` aliases into a map of the
+// lowercased old domains to the new domains
+func ParseEmailDomainAliases(aliases []string) (map[string]string, error) {
+	domainAliases := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		from, to, ok := strings.Cut(alias, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" || strings.Contains(from, "@") || strings.Contains(to, "@") {
+			return nil, fmt.Errorf("invalid email domain alias %q: expected old.com=new.com", alias)
+		}
+		domainAliases[strings.ToLower(from)] = to
+	}
+	return domainAliases, nil
+}
+
+// loadSubjectEmails reads the `subject,email` lines of the subject emails file
+func loadSubjectEmails(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open subject emails file: %v", err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.Comment = '#'
+	csvReader.TrimLeadingSpace = true
+	csvReader.FieldsPerRecord = 2
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not read subject emails file: %v", err)
+	}
+
+	subjectEmails := make(map[string]string, len(records))
+	for _, record := range records {
+		subject, email := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if subject == "" || email == "" {
+			return nil, fmt.Errorf("subject emails file has an empty subject or email: %q", strings.Join(record, ","))
+		}
+		subjectEmails[subject] = email
+	}
+	return subjectEmails, nil
+}
+
+// Normalize normalizes the user ID and email of the session in place.
+// The email is mapped from the subject of the user first, then its domain
+// is replaced by its alias, and the user ID and email are lowercased last.
+func (n *Normalizer) Normalize(s *sessionsapi.SessionState) {
+	if n == nil || s == nil {
+		return
+	}
+
+	if email, ok := n.subjectEmails[s.User]; ok {
+		s.Email = email
+	}
+	if at := strings.LastIndex(s.Email, "@"); at >= 0 {
+		if alias, ok := n.domainAliases[strings.ToLower(s.Email[at+1:])]; ok {
+			s.Email = s.Email[:at+1] + alias
+		}
+	}
+	if n.lowercaseUser {
+		s.User = strings.ToLower(s.User)
+	}
+	if n.lowercaseEmail {
+		s.Email = strings.ToLower(s.Email)
+	}
+}
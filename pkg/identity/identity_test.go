@@ -0,0 +1,99 @@
+package identity
+
+import (
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Identity Normalization Suite", func() {
+	writeSubjectEmails := func(content string) string {
+		f, err := os.CreateTemp("", "subject-emails-*.csv")
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		_, err = f.WriteString(content)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.Remove, f.Name())
+		return f.Name()
+	}
+
+	It("returns no normalizer when no normalization is configured", func() {
+		normalizer, err := NewNormalizer(options.IdentityNormalization{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(normalizer).To(BeNil())
+
+		// A nil normalizer leaves sessions as they are
+		session := &sessionsapi.SessionState{User: "Alice", Email: "Alice@Example.com"}
+		normalizer.Normalize(session)
+		Expect(session).To(Equal(&sessionsapi.SessionState{User: "Alice", Email: "Alice@Example.com"}))
+	})
+
+	type normalizeTableInput struct {
+		opts     options.IdentityNormalization
+		session  *sessionsapi.SessionState
+		expected *sessionsapi.SessionState
+	}
+
+	DescribeTable("Normalize",
+		func(in normalizeTableInput) {
+			if in.opts.SubjectEmailsFile != "" {
+				in.opts.SubjectEmailsFile = writeSubjectEmails(in.opts.SubjectEmailsFile)
+			}
+			normalizer, err := NewNormalizer(in.opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			normalizer.Normalize(in.session)
+			Expect(in.session).To(Equal(in.expected))
+		},
+		Entry("lowercases the user and email", normalizeTableInput{
+			opts:     options.IdentityNormalization{LowercaseUser: true, LowercaseEmail: true},
+			session:  &sessionsapi.SessionState{User: "Alice", Email: "Alice@Example.com"},
+			expected: &sessionsapi.SessionState{User: "alice", Email: "alice@example.com"},
+		}),
+		Entry("replaces aliased email domains case insensitively", normalizeTableInput{
+			opts:     options.IdentityNormalization{EmailDomainAliases: []string{"old.com=new.com"}},
+			session:  &sessionsapi.SessionState{User: "alice", Email: "Alice@OLD.com"},
+			expected: &sessionsapi.SessionState{User: "alice", Email: "Alice@new.com"},
+		}),
+		Entry("does not replace other email domains", normalizeTableInput{
+			opts:     options.IdentityNormalization{EmailDomainAliases: []string{"old.com=new.com"}},
+			session:  &sessionsapi.SessionState{User: "alice", Email: "alice@sub.old.com"},
+			expected: &sessionsapi.SessionState{User: "alice", Email: "alice@sub.old.com"},
+		}),
+		Entry("maps the email of subjects before aliasing and lowercasing it", normalizeTableInput{
+			opts: options.IdentityNormalization{
+				LowercaseEmail:     true,
+				EmailDomainAliases: []string{"old.com=new.com"},
+				SubjectEmailsFile:  "# subject,email\n00u1a2b3c, Alice@Old.com\n",
+			},
+			session:  &sessionsapi.SessionState{User: "00u1a2b3c", Email: "a.smith@partner.com"},
+			expected: &sessionsapi.SessionState{User: "00u1a2b3c", Email: "alice@new.com"},
+		}),
+		Entry("leaves the email of unmapped subjects", normalizeTableInput{
+			opts:     options.IdentityNormalization{SubjectEmailsFile: "00u1a2b3c,alice@new.com\n"},
+			session:  &sessionsapi.SessionState{User: "00u4d5e6f", Email: "bob@new.com"},
+			expected: &sessionsapi.SessionState{User: "00u4d5e6f", Email: "bob@new.com"},
+		}),
+	)
+
+	DescribeTable("with invalid options",
+		func(opts options.IdentityNormalization, expectedError string) {
+			_, err := NewNormalizer(opts)
+			Expect(err).To(MatchError(ContainSubstring(expectedError)))
+		},
+		Entry("with an alias without a new domain",
+			options.IdentityNormalization{EmailDomainAliases: []string{"old.com="}},
+			`invalid email domain alias "old.com=": expected old.com=new.com`),
+		Entry("with a missing subject emails file",
+			options.IdentityNormalization{SubjectEmailsFile: "/does/not/exist.csv"},
+			"could not open subject emails file"),
+	)
+
+	It("rejects subject emails files with a missing email", func() {
+		_, err := NewNormalizer(options.IdentityNormalization{SubjectEmailsFile: writeSubjectEmails("00u1a2b3c\n")})
+		Expect(err).To(MatchError(ContainSubstring("could not read subject emails file")))
+	})
+})
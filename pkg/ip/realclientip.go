@@ -9,20 +9,26 @@ import (
 	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
 )
 
-func GetRealClientIPParser(headerKey string) (ipapi.RealClientIPParser, error) {
+// GetRealClientIPParser returns the parser of the client IP of the header.
+// With trustedHops, the client IP is the address appended by the outermost of
+// that many trusted proxies in front of the proxy, ignoring the addresses
+// clients may have injected before it. Without, it is the first address.
+func GetRealClientIPParser(headerKey string, trustedHops int) (ipapi.RealClientIPParser, error) {
 	headerKey = http.CanonicalHeaderKey(headerKey)
 
 	switch headerKey {
 	case http.CanonicalHeaderKey("X-Forwarded-For"), http.CanonicalHeaderKey("X-Real-IP"), http.CanonicalHeaderKey("X-ProxyUser-IP"):
-		return &xForwardedForClientIPParser{header: headerKey}, nil
+		return &xForwardedForClientIPParser{header: headerKey, trustedHops: trustedHops}, nil
+	case http.CanonicalHeaderKey("Forwarded"):
+		return &forwardedClientIPParser{trustedHops: trustedHops}, nil
 	}
 
-	// TODO: implement the more standardized but more complex `Forwarded` header.
 	return nil, fmt.Errorf("the http header key (%s) is either invalid or unsupported", headerKey)
 }
 
 type xForwardedForClientIPParser struct {
-	header string
+	header      string
+	trustedHops int
 }
 
 // GetRealClientIP obtain the IP address of the end-user (not proxy).
@@ -32,32 +38,108 @@ type xForwardedForClientIPParser struct {
 // Additionally, is capable of parsing IPs with the port included, for v4 in the format "<ip>:<port>" and for v6 in the
 // format "[<ip>]:<port>".  With-port and without-port formats are seamlessly supported concurrently.
 func (p xForwardedForClientIPParser) GetRealClientIP(h http.Header) (net.IP, error) {
-	var ipStr string
-	if realIP := h.Get(p.header); realIP != "" {
-		ipStr = realIP
-	} else {
+	// Each successive proxy may append itself, comma separated, to the end of the X-Forwarded-for header,
+	// and the header may be repeated.
+	var hops []string
+	for _, value := range h.Values(p.header) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	if len(hops) == 0 || (len(hops) == 1 && strings.TrimSpace(hops[0]) == "") {
 		return nil, nil
 	}
 
-	// Each successive proxy may append itself, comma separated, to the end of the X-Forwarded-for header.
-	// Select only the first IP listed, as it is the client IP recorded by the first proxy.
-	if commaIndex := strings.IndexRune(ipStr, ','); commaIndex != -1 {
-		ipStr = ipStr[:commaIndex]
+	ipStr := strings.TrimSpace(selectHop(hops, p.trustedHops))
+	ip := parseIP(ipStr)
+	if ip == nil {
+		return nil, fmt.Errorf("unable to parse ip (%s) from %s header", ipStr, http.CanonicalHeaderKey(p.header))
 	}
-	ipStr = strings.TrimSpace(ipStr)
 
-	if ipHost, _, err := net.SplitHostPort(ipStr); err == nil {
-		ipStr = ipHost
+	return ip, nil
+}
+
+// forwardedClientIPParser parses the Forwarded header of RFC 7239
+type forwardedClientIPParser struct {
+	trustedHops int
+}
+
+// GetRealClientIP obtains the IP address of the end-user from the `for`
+// parameter of the Forwarded header, as specified by:
+// * https://www.rfc-editor.org/rfc/rfc7239.
+// Each proxy appends a comma separated element of semicolon separated
+// parameters, eg. `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`.
+// Obfuscated and unknown identifiers cannot be parsed as an IP.
+func (p forwardedClientIPParser) GetRealClientIP(h http.Header) (net.IP, error) {
+	var hops []string
+	for _, value := range h.Values("Forwarded") {
+		for _, element := range splitQuoted(value, ',') {
+			hops = append(hops, forwardedFor(element))
+		}
+	}
+	if len(hops) == 0 {
+		return nil, nil
 	}
 
-	ip := net.ParseIP(ipStr)
+	ipStr := selectHop(hops, p.trustedHops)
+	ip := parseIP(ipStr)
 	if ip == nil {
-		return nil, fmt.Errorf("unable to parse ip (%s) from %s header", ipStr, http.CanonicalHeaderKey(p.header))
+		return nil, fmt.Errorf("unable to parse ip (%s) from Forwarded header", ipStr)
 	}
 
 	return ip, nil
 }
 
+// forwardedFor returns the unquoted `for` parameter of a Forwarded element
+func forwardedFor(element string) string {
+	for _, pair := range splitQuoted(element, ';') {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if strings.EqualFold(name, "for") {
+			return strings.Trim(strings.TrimSpace(value), "\"")
+		}
+	}
+	return ""
+}
+
+// splitQuoted splits s around the separator, except in quoted strings
+func splitQuoted(s string, separator rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == separator && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// selectHop selects the address of the client from the addresses appended by
+// each proxy: the one appended by the outermost of the trusted proxies, or
+// the first one without trusted proxies or when there are fewer addresses
+func selectHop(hops []string, trustedHops int) string {
+	if trustedHops <= 0 || trustedHops >= len(hops) {
+		return hops[0]
+	}
+	return hops[len(hops)-trustedHops]
+}
+
+// parseIP parses an IP with an optional port, brackets around IPv6 addresses
+// and IPv6 zone, eg. "[fe80::1%eth0]:8080". The zone is dropped, as it only
+// names the interface of a link-local address.
+func parseIP(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i != -1 && strings.ContainsRune(s, ':') {
+		s = s[:i]
+	}
+	return net.ParseIP(s)
+}
+
 // GetClientIP obtains the perceived end-user IP address from headers if p != nil else from req.RemoteAddr.
 func GetClientIP(p ipapi.RealClientIPParser, req *http.Request) (net.IP, error) {
 	if p != nil {
@@ -71,7 +153,7 @@ func getRemoteIP(req *http.Request) (net.IP, error) {
 	//revive:disable:indent-error-flow
 	if ipStr, _, err := net.SplitHostPort(req.RemoteAddr); err != nil {
 		return nil, fmt.Errorf("unable to get ip and port from http.RemoteAddr (%s)", req.RemoteAddr)
-	} else if ip := net.ParseIP(ipStr); ip != nil {
+	} else if ip := parseIP(ipStr); ip != nil {
 		return ip, nil
 	} else {
 		return nil, fmt.Errorf("unable to parse ip (%s)", ipStr)
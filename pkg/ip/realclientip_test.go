@@ -12,6 +12,7 @@ import (
 
 func TestGetRealClientIPParser(t *testing.T) {
 	forwardedForType := reflect.TypeOf((*xForwardedForClientIPParser)(nil))
+	forwardedType := reflect.TypeOf((*forwardedClientIPParser)(nil))
 
 	tests := []struct {
 		header     string
@@ -22,12 +23,13 @@ func TestGetRealClientIPParser(t *testing.T) {
 		{"X-REAL-IP", "", forwardedForType},
 		{"x-proxyuser-ip", "", forwardedForType},
 		{"", "the http header key () is either invalid or unsupported", nil},
-		{"Forwarded", "the http header key (Forwarded) is either invalid or unsupported", nil},
+		{"Forwarded", "", forwardedType},
+		{"forwarded", "", forwardedType},
 		{"2#* @##$$:kd", "the http header key (2#* @##$$:kd) is either invalid or unsupported", nil},
 	}
 
 	for _, test := range tests {
-		p, err := GetRealClientIPParser(test.header)
+		p, err := GetRealClientIPParser(test.header, 0)
 
 		if test.errString == "" {
 			assert.Nil(t, err)
@@ -64,6 +66,8 @@ func TestXForwardedForClientIPParser(t *testing.T) {
 		{"[::1]:1234", "", net.ParseIP("::1")},
 		{"10.0.10.11:1234", "", net.ParseIP("10.0.10.11")},
 		{"192.168.10.50, 10.0.0.1, 1.2.3.4", "", net.ParseIP("192.168.10.50")},
+		{"fe80::1%eth0", "", net.ParseIP("fe80::1")},
+		{"[fe80::1%25eth0]:1234", "", net.ParseIP("fe80::1")},
 		{"nil", "unable to parse ip (nil) from X-Forwarded-For header", nil},
 		{"10000.10000.10000.10000", "unable to parse ip (10000.10000.10000.10000) from X-Forwarded-For header", nil},
 	}
@@ -104,6 +108,76 @@ func TestXForwardedForClientIPParserIgnoresOthers(t *testing.T) {
 	assert.Equal(t, ip, net.ParseIP(expectedIPString))
 }
 
+func TestXForwardedForClientIPParserWithTrustedHops(t *testing.T) {
+	tests := []struct {
+		trustedHops int
+		headers     []string
+		expectedIP  net.IP
+	}{
+		{0, []string{"192.168.10.50, 10.0.0.1, 1.2.3.4"}, net.ParseIP("192.168.10.50")},
+		{1, []string{"192.168.10.50, 10.0.0.1, 1.2.3.4"}, net.ParseIP("1.2.3.4")},
+		{2, []string{"192.168.10.50, 10.0.0.1, 1.2.3.4"}, net.ParseIP("10.0.0.1")},
+		{5, []string{"192.168.10.50, 10.0.0.1, 1.2.3.4"}, net.ParseIP("192.168.10.50")},
+		{2, []string{"192.168.10.50, 10.0.0.1", "1.2.3.4"}, net.ParseIP("10.0.0.1")},
+	}
+
+	for _, test := range tests {
+		p, err := GetRealClientIPParser("X-Forwarded-For", test.trustedHops)
+		assert.Nil(t, err)
+
+		h := http.Header{}
+		for _, header := range test.headers {
+			h.Add("X-Forwarded-For", header)
+		}
+
+		ip, err := p.GetRealClientIP(h)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedIP, ip)
+	}
+}
+
+func TestForwardedClientIPParser(t *testing.T) {
+	tests := []struct {
+		trustedHops int
+		headerValue string
+		errString   string
+		expectedIP  net.IP
+	}{
+		{0, "", "", nil},
+		{0, "for=192.0.2.60", "", net.ParseIP("192.0.2.60")},
+		{0, "For=192.0.2.60;proto=http;by=203.0.113.43", "", net.ParseIP("192.0.2.60")},
+		{0, "proto=https;for=\"192.0.2.60:4711\"", "", net.ParseIP("192.0.2.60")},
+		{0, "for=\"[2001:db8:cafe::17]:4711\"", "", net.ParseIP("2001:db8:cafe::17")},
+		{0, "for=\"[2001:db8:cafe::17]\"", "", net.ParseIP("2001:db8:cafe::17")},
+		{0, "for=\"[fe80::1%25eth0]:4711\"", "", net.ParseIP("fe80::1")},
+		{0, "for=192.0.2.43, for=198.51.100.17", "", net.ParseIP("192.0.2.43")},
+		{1, "for=192.0.2.43, for=198.51.100.17", "", net.ParseIP("198.51.100.17")},
+		{1, "for=192.0.2.43, for=\"[2001:db8::1]\";proto=\"a,b\"", "", net.ParseIP("2001:db8::1")},
+		{0, "for=unknown", "unable to parse ip (unknown) from Forwarded header", nil},
+		{0, "for=_hidden, for=192.0.2.43", "unable to parse ip (_hidden) from Forwarded header", nil},
+		{0, "proto=https", "unable to parse ip () from Forwarded header", nil},
+	}
+
+	for _, test := range tests {
+		p := &forwardedClientIPParser{trustedHops: test.trustedHops}
+
+		h := http.Header{}
+		if test.headerValue != "" {
+			h.Add("Forwarded", test.headerValue)
+		}
+
+		ip, err := p.GetRealClientIP(h)
+
+		if test.errString == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.NotNil(t, err)
+			assert.Equal(t, test.errString, err.Error())
+		}
+		assert.Equal(t, test.expectedIP, ip)
+	}
+}
+
 func TestGetRemoteIP(t *testing.T) {
 	tests := []struct {
 		remoteAddr string
@@ -117,6 +191,7 @@ func TestGetRemoteIP(t *testing.T) {
 		{"192.168.73.165:14976, 10.4.201.15:18453", "unable to get ip and port from http.RemoteAddr (192.168.73.165:14976, 10.4.201.15:18453)", nil},
 		{"10000.10000.10000.10000:8080", "unable to parse ip (10000.10000.10000.10000)", nil},
 		{"[::1]:48290", "", net.ParseIP("::1")},
+		{"[fe80::1%eth0]:48290", "", net.ParseIP("fe80::1")},
 		{"10.254.244.165:62750", "", net.ParseIP("10.254.244.165")},
 	}
 
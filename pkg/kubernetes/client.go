@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// serviceAccountDir is where the credentials of the service account of
+	// the pod are mounted
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Client is a minimal client of the Kubernetes API, authenticating with the
+// service account of the pod the proxy runs in
+type Client struct {
+	baseURL   string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewInClusterClient creates a Client for the API server of the cluster the
+// proxy runs in
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in the service account CA")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return NewClient("https://"+net.JoinHostPort(host, port), serviceAccountDir+"/token", &http.Client{Transport: transport}), nil
+}
+
+// NewClient creates a Client for the API server at the base URL,
+// authenticating with the bearer token in the token file
+func NewClient(baseURL, tokenFile string, client *http.Client) *Client {
+	return &Client{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		tokenFile: tokenFile,
+		client:    client,
+	}
+}
+
+// InClusterNamespace returns the namespace of the pod the proxy runs in
+func InClusterNamespace() (string, error) {
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return "", fmt.Errorf("error reading service account namespace: %v", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// get sends a GET request to the API path, returning the response when it
+// succeeds. The caller must close the body of the response.
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if c.tokenFile != "" {
+		// Service account tokens are rotated, so the file is read each time
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading service account token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// StatusError is returned when the API server responds with an error status
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from the Kubernetes API: %s", e.Code, e.Message)
+}
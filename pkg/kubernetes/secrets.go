@@ -0,0 +1,29 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// secretObject is a Secret, whose data is base64 encoded by the API
+type secretObject struct {
+	Data map[string][]byte `json:"data"`
+}
+
+// SecretData returns the data of the Secret in the namespace
+func (c *Client) SecretData(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", url.PathEscape(namespace), url.PathEscape(name))
+	resp, err := c.get(ctx, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s/%s: %v", namespace, name, err)
+	}
+	defer resp.Body.Close()
+
+	var secret secretObject
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("error decoding secret %s/%s: %v", namespace, name, err)
+	}
+	return secret.Data, nil
+}
@@ -0,0 +1,292 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// Group is the API group of the custom resources of the proxy
+	Group = "oauth2-proxy.github.io"
+
+	// Version is the API version of the custom resources of the proxy
+	Version = "v1alpha1"
+
+	// VirtualHostResource is the plural name of the OAuth2ProxyVirtualHost
+	// custom resource
+	VirtualHostResource = "oauth2proxyvirtualhosts"
+
+	// watchTimeout is how long each watch request lasts before it is renewed
+	watchTimeout = 5 * time.Minute
+
+	// retryInterval is how long to wait before listing the resources again
+	// after a failed request
+	retryInterval = 5 * time.Second
+)
+
+// virtualHostObject is an OAuth2ProxyVirtualHost custom resource, whose spec
+// is a virtual host of the alpha configuration
+type virtualHostObject struct {
+	Metadata objectMeta          `json:"metadata"`
+	Spec     options.VirtualHost `json:"spec"`
+}
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type virtualHostList struct {
+	Metadata objectMeta          `json:"metadata"`
+	Items    []virtualHostObject `json:"items"`
+}
+
+// watchEvent is an event of a watch request
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchStatus is the object of an ERROR watch event
+type watchStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// errResourceVersionExpired is returned when a watch must start over with a
+// new list, as the resource version it started from is too old
+var errResourceVersionExpired = errors.New("resource version expired")
+
+// VirtualHostController watches the OAuth2ProxyVirtualHost custom resources,
+// holding the virtual hosts they configure, and calls its change handler
+// whenever they change so that the configuration can be reloaded.
+type VirtualHostController struct {
+	client        *Client
+	namespace     string
+	labelSelector string
+
+	mu              sync.RWMutex
+	objects         map[string]virtualHostObject
+	resourceVersion string
+	onChange        func()
+}
+
+// NewVirtualHostController creates a VirtualHostController watching the
+// custom resources selected by the Kubernetes options
+func NewVirtualHostController(client *Client, opts options.Kubernetes) *VirtualHostController {
+	return &VirtualHostController{
+		client:        client,
+		namespace:     opts.Namespace,
+		labelSelector: opts.LabelSelector,
+		objects:       make(map[string]virtualHostObject),
+		onChange:      func() {},
+	}
+}
+
+// OnChange sets the function called whenever the virtual hosts change
+func (c *VirtualHostController) OnChange(onChange func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = onChange
+}
+
+// VirtualHosts returns the virtual hosts of the custom resources, ordered by
+// the namespace and name of the resources
+func (c *VirtualHostController) VirtualHosts() options.VirtualHosts {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.objects))
+	for key := range c.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	vhosts := make(options.VirtualHosts, 0, len(keys))
+	for _, key := range keys {
+		vhosts = append(vhosts, c.objects[key].Spec)
+	}
+	return vhosts
+}
+
+// Sync lists the custom resources, replacing the virtual hosts held by the
+// controller
+func (c *VirtualHostController) Sync(ctx context.Context) error {
+	query := url.Values{}
+	if c.labelSelector != "" {
+		query.Set("labelSelector", c.labelSelector)
+	}
+	resp, err := c.client.get(ctx, c.path(), query)
+	if err != nil {
+		return fmt.Errorf("error listing %s: %v", VirtualHostResource, err)
+	}
+	defer resp.Body.Close()
+
+	var list virtualHostList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("error decoding %s: %v", VirtualHostResource, err)
+	}
+
+	objects := make(map[string]virtualHostObject, len(list.Items))
+	for _, obj := range list.Items {
+		objects[objectKey(obj.Metadata)] = obj
+	}
+
+	c.mu.Lock()
+	changed := !sameObjects(c.objects, objects)
+	c.objects = objects
+	c.resourceVersion = list.Metadata.ResourceVersion
+	onChange := c.onChange
+	c.mu.Unlock()
+
+	if changed {
+		onChange()
+	}
+	return nil
+}
+
+// Start watches the custom resources until the context is cancelled.
+// The resources are listed again whenever the watch cannot be resumed.
+// It implements the Server interface so that it runs alongside the servers.
+func (c *VirtualHostController) Start(ctx context.Context) error {
+	for {
+		err := c.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			// The watch timed out, resume it from the last resource version
+			continue
+		}
+
+		if !errors.Is(err, errResourceVersionExpired) {
+			logger.Errorf("Error watching %s: %v", VirtualHostResource, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retryInterval):
+			}
+		}
+		if err := c.Sync(ctx); err != nil && ctx.Err() == nil {
+			logger.Errorf("Error syncing %s: %v", VirtualHostResource, err)
+		}
+	}
+}
+
+// watch applies the events of a watch request, from the last resource
+// version, to the virtual hosts until the request ends
+func (c *VirtualHostController) watch(ctx context.Context) error {
+	c.mu.RLock()
+	resourceVersion := c.resourceVersion
+	c.mu.RUnlock()
+
+	query := url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {resourceVersion},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {fmt.Sprint(int(watchTimeout.Seconds()))},
+	}
+	if c.labelSelector != "" {
+		query.Set("labelSelector", c.labelSelector)
+	}
+	resp, err := c.client.get(ctx, c.path(), query)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusGone {
+			return errResourceVersionExpired
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("error decoding watch event: %v", err)
+		}
+		if err := c.apply(event); err != nil {
+			return err
+		}
+	}
+}
+
+// apply applies a watch event to the virtual hosts
+func (c *VirtualHostController) apply(event watchEvent) error {
+	if event.Type == "ERROR" {
+		var status watchStatus
+		if err := json.Unmarshal(event.Object, &status); err == nil && status.Code == http.StatusGone {
+			return errResourceVersionExpired
+		}
+		return fmt.Errorf("watch error: %s", event.Object)
+	}
+
+	var obj virtualHostObject
+	if err := json.Unmarshal(event.Object, &obj); err != nil {
+		return fmt.Errorf("error decoding %s %s event: %v", VirtualHostResource, event.Type, err)
+	}
+	key := objectKey(obj.Metadata)
+
+	c.mu.Lock()
+	c.resourceVersion = obj.Metadata.ResourceVersion
+	changed := true
+	switch event.Type {
+	case "ADDED", "MODIFIED":
+		logger.Printf("OAuth2ProxyVirtualHost %s was updated", key)
+		c.objects[key] = obj
+	case "DELETED":
+		logger.Printf("OAuth2ProxyVirtualHost %s was deleted", key)
+		delete(c.objects, key)
+	default:
+		// Bookmarks only move the resource version on
+		changed = false
+	}
+	onChange := c.onChange
+	c.mu.Unlock()
+
+	if changed {
+		onChange()
+	}
+	return nil
+}
+
+// path returns the API path of the custom resources
+func (c *VirtualHostController) path() string {
+	if c.namespace == "" {
+		return fmt.Sprintf("/apis/%s/%s/%s", Group, Version, VirtualHostResource)
+	}
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", Group, Version, url.PathEscape(c.namespace), VirtualHostResource)
+}
+
+func objectKey(meta objectMeta) string {
+	return meta.Namespace + "/" + meta.Name
+}
+
+// sameObjects returns whether the objects are at the same resource versions
+func sameObjects(a, b map[string]virtualHostObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, obj := range a {
+		other, ok := b[key]
+		if !ok || other.Metadata.ResourceVersion != obj.Metadata.ResourceVersion {
+			return false
+		}
+	}
+	return true
+}
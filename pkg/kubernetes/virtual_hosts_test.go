@@ -0,0 +1,139 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const virtualHostsPath = "/apis/oauth2-proxy.github.io/v1alpha1/namespaces/apps/oauth2proxyvirtualhosts"
+
+func virtualHostJSON(name, resourceVersion, host string) string {
+	return fmt.Sprintf(`{"metadata":{"name":%q,"namespace":"apps","resourceVersion":%q},"spec":{"hosts":[%q],"allowedGroups":["%s-users"]}}`,
+		name, resourceVersion, host, name)
+}
+
+var _ = Describe("VirtualHostController", func() {
+	var server *httptest.Server
+	var controller *VirtualHostController
+	var list string
+	var watches chan string
+	var requests []*http.Request
+	var mu sync.Mutex
+	var changes atomic.Int32
+
+	BeforeEach(func() {
+		list = `{"metadata":{"resourceVersion":"10"},"items":[` +
+			virtualHostJSON("wiki", "9", "wiki.example.com") + `,` +
+			virtualHostJSON("admin", "8", "admin.example.com") + `]}`
+		watches = make(chan string, 4)
+		requests = nil
+		changes.Store(0)
+
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+
+			if req.URL.Path != virtualHostsPath {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if req.URL.Query().Get("watch") != "1" {
+				rw.Write([]byte(list))
+				return
+			}
+			select {
+			case events := <-watches:
+				rw.Write([]byte(events))
+			case <-req.Context().Done():
+			}
+		}))
+
+		tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("service-account-token\n"), 0600)).To(Succeed())
+
+		controller = NewVirtualHostController(NewClient(server.URL, tokenFile, server.Client()), options.Kubernetes{
+			Namespace:     "apps",
+			LabelSelector: "tier=internal",
+		})
+		controller.OnChange(func() { changes.Add(1) })
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	lastRequest := func() *http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[len(requests)-1]
+	}
+
+	It("lists the virtual hosts in the order of their names", func() {
+		Expect(controller.Sync(context.Background())).To(Succeed())
+		Expect(controller.VirtualHosts()).To(Equal(options.VirtualHosts{
+			{Hosts: []string{"admin.example.com"}, AllowedGroups: []string{"admin-users"}},
+			{Hosts: []string{"wiki.example.com"}, AllowedGroups: []string{"wiki-users"}},
+		}))
+		Expect(changes.Load()).To(BeEquivalentTo(1))
+
+		req := lastRequest()
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer service-account-token"))
+		Expect(req.URL.Query().Get("labelSelector")).To(Equal("tier=internal"))
+
+		By("not reporting a change when nothing changed")
+		Expect(controller.Sync(context.Background())).To(Succeed())
+		Expect(changes.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("applies the watch events from the listed resource version", func() {
+		Expect(controller.Sync(context.Background())).To(Succeed())
+
+		watches <- `{"type":"MODIFIED","object":` + virtualHostJSON("wiki", "11", "docs.example.com") + `}` + "\n" +
+			`{"type":"DELETED","object":` + virtualHostJSON("admin", "12", "admin.example.com") + `}` + "\n" +
+			`{"type":"BOOKMARK","object":{"metadata":{"resourceVersion":"13"}}}` + "\n"
+		Expect(controller.watch(context.Background())).To(Succeed())
+		Expect(lastRequest().URL.Query().Get("resourceVersion")).To(Equal("10"))
+
+		Expect(controller.VirtualHosts()).To(Equal(options.VirtualHosts{
+			{Hosts: []string{"docs.example.com"}, AllowedGroups: []string{"wiki-users"}},
+		}))
+		Expect(changes.Load()).To(BeEquivalentTo(3))
+		Expect(controller.resourceVersion).To(Equal("13"))
+	})
+
+	It("lists the resources again when the resource version expired", func() {
+		Expect(controller.Sync(context.Background())).To(Succeed())
+
+		watches <- `{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}` + "\n"
+		Expect(controller.watch(context.Background())).To(MatchError(errResourceVersionExpired))
+
+		list = `{"metadata":{"resourceVersion":"20"},"items":[` + virtualHostJSON("wiki", "19", "wiki.example.com") + `]}`
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(controller.Start(ctx)).To(Succeed())
+		}()
+
+		watches <- `{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}` + "\n"
+		Eventually(controller.VirtualHosts).Should(HaveLen(1))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("reports the errors of the API server", func() {
+		controller.namespace = "other"
+		Expect(controller.Sync(context.Background())).To(MatchError(ContainSubstring("unexpected status code 404 from the Kubernetes API")))
+	})
+})
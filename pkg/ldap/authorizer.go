@@ -0,0 +1,197 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+)
+
+// searcher searches a directory for a single entry
+type searcher interface {
+	Search(baseDN, filter string, attributes []string) (*SearchEntry, error)
+}
+
+// Authorizer authorizes emails by the membership of their directory users
+// in groups, caching the memberships so that the directory is not searched
+// on every request
+type Authorizer struct {
+	searcher       searcher
+	userBaseDN     string
+	userFilter     string
+	groupAttribute string
+	groups         map[string]bool
+	cacheDuration  time.Duration
+	clock          clock.Clock
+
+	mu        sync.Mutex
+	cache     map[string]cachedMembership
+	lastSweep time.Time
+}
+
+// cachedMembership is whether the user of an email is a member of one of
+// the groups, until it expires
+type cachedMembership struct {
+	member  bool
+	expires time.Time
+}
+
+// NewAuthorizer creates an Authorizer searching the directory of the
+// options
+func NewAuthorizer(opts options.LDAP) (*Authorizer, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	// InsecureSkipVerify is a configurable option we allow
+	/* #nosec G402 */
+	if opts.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if len(opts.CAFiles) > 0 {
+		pool, err := util.GetCertPool(opts.CAFiles, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the LDAP CA files: %v", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	pool, err := NewPool(Config{
+		URL:          opts.URL,
+		StartTLS:     opts.StartTLS,
+		TLSConfig:    tlsConfig,
+		BindDN:       opts.BindDN,
+		BindPassword: opts.BindPassword,
+		Timeout:      opts.Timeout,
+		PoolSize:     opts.PoolSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newAuthorizer(pool, opts), nil
+}
+
+func newAuthorizer(s searcher, opts options.LDAP) *Authorizer {
+	groups := make(map[string]bool, len(opts.Groups))
+	for _, group := range opts.Groups {
+		groups[normalizeDN(group)] = true
+	}
+	return &Authorizer{
+		searcher:       s,
+		userBaseDN:     opts.UserBaseDN,
+		userFilter:     opts.UserFilter,
+		groupAttribute: opts.GroupAttribute,
+		groups:         groups,
+		cacheDuration:  opts.CacheDuration,
+		cache:          make(map[string]cachedMembership),
+	}
+}
+
+// IsMember returns whether the user of the email is a member of one of the
+// groups, or is found at all when there are no groups. Emails are not
+// authorized when the directory cannot be searched.
+func (a *Authorizer) IsMember(email string) bool {
+	if email == "" {
+		return false
+	}
+	email = strings.ToLower(email)
+	if member, ok := a.cached(email); ok {
+		return member
+	}
+
+	member, err := a.lookup(email)
+	if err != nil {
+		// Errors are not cached, so that the next request tries again
+		logger.Errorf("Error looking up the LDAP groups of %s: %v", email, err)
+		return false
+	}
+	a.store(email, member)
+	return member
+}
+
+// Close closes the idle connections to the directory
+func (a *Authorizer) Close() {
+	if pool, ok := a.searcher.(*Pool); ok {
+		pool.Close()
+	}
+}
+
+// lookup searches the directory for the user of the email, and checks its
+// groups
+func (a *Authorizer) lookup(email string) (bool, error) {
+	filter := strings.ReplaceAll(a.userFilter, options.LDAPEmailPlaceholder, EscapeFilter(email))
+	entry, err := a.searcher.Search(a.userBaseDN, filter, []string{a.groupAttribute})
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if len(a.groups) == 0 {
+		// The filter alone decides which users are authorized
+		return true, nil
+	}
+
+	for _, group := range entry.Attributes[strings.ToLower(a.groupAttribute)] {
+		if a.groups[normalizeDN(group)] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cached returns the cached membership of the email, if it has not expired
+func (a *Authorizer) cached(email string) (bool, bool) {
+	if a.cacheDuration <= 0 {
+		return false, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m, ok := a.cache[email]
+	if !ok || !a.clock.Now().Before(m.expires) {
+		return false, false
+	}
+	return m.member, true
+}
+
+// store caches the membership of the email
+func (a *Authorizer) store(email string, member bool) {
+	if a.cacheDuration <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	a.sweep(now)
+	a.cache[email] = cachedMembership{member: member, expires: now.Add(a.cacheDuration)}
+}
+
+// sweep forgets the expired memberships, once per cache duration, so that
+// the memberships of past users do not accumulate
+func (a *Authorizer) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.cacheDuration {
+		return
+	}
+	a.lastSweep = now
+	for email, m := range a.cache {
+		if !now.Before(m.expires) {
+			delete(a.cache, email)
+		}
+	}
+}
+
+// normalizeDN lowercases a DN and removes the spaces around its separators,
+// so that DNs written differently compare equal
+func normalizeDN(dn string) string {
+	rdns := strings.Split(strings.ToLower(dn), ",")
+	for i, rdn := range rdns {
+		attribute, value, _ := strings.Cut(rdn, "=")
+		rdns[i] = strings.TrimSpace(attribute) + "=" + strings.TrimSpace(value)
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,132 @@
+package ldap
+
+import (
+	"errors"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeSearcher returns its entry for the filters it was given, counting
+// the searches
+type fakeSearcher struct {
+	entries  map[string]*SearchEntry
+	err      error
+	searches int
+}
+
+func (s *fakeSearcher) Search(_, filter string, _ []string) (*SearchEntry, error) {
+	s.searches++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.entries[filter], nil
+}
+
+var _ = Describe("Authorizer", func() {
+	const filter = "(mail={email})"
+
+	var searcher *fakeSearcher
+	var authorizer *Authorizer
+
+	BeforeEach(func() {
+		searcher = &fakeSearcher{entries: map[string]*SearchEntry{
+			"(mail=jane@example.com)": {
+				DN: "uid=jane,ou=people,dc=example,dc=com",
+				Attributes: map[string][]string{
+					"memberof": {"cn=users,ou=groups,dc=example,dc=com", "CN=Admins, OU=Groups, DC=example, DC=com"},
+				},
+			},
+			"(mail=john@example.com)": {
+				DN: "uid=john,ou=people,dc=example,dc=com",
+				Attributes: map[string][]string{
+					"memberof": {"cn=users,ou=groups,dc=example,dc=com"},
+				},
+			},
+		}}
+		authorizer = newAuthorizer(searcher, options.LDAP{
+			UserBaseDN:     "ou=people,dc=example,dc=com",
+			UserFilter:     filter,
+			GroupAttribute: "memberOf",
+			Groups:         []string{"cn=admins,ou=groups,dc=example,dc=com"},
+			CacheDuration:  time.Minute,
+		})
+		authorizer.clock.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	It("authorizes the members of the groups", func() {
+		Expect(authorizer.IsMember("Jane@Example.com")).To(BeTrue())
+	})
+
+	It("does not authorize users outside of the groups", func() {
+		Expect(authorizer.IsMember("john@example.com")).To(BeFalse())
+	})
+
+	It("does not authorize unknown emails", func() {
+		Expect(authorizer.IsMember("nobody@example.com")).To(BeFalse())
+		Expect(authorizer.IsMember("")).To(BeFalse())
+	})
+
+	It("escapes the email in the filter", func() {
+		Expect(authorizer.IsMember("*)(mail=jane@example.com")).To(BeFalse())
+		Expect(searcher.searches).To(Equal(1))
+	})
+
+	It("caches the memberships until they expire", func() {
+		Expect(authorizer.IsMember("jane@example.com")).To(BeTrue())
+		Expect(authorizer.IsMember("john@example.com")).To(BeFalse())
+		Expect(authorizer.IsMember("jane@example.com")).To(BeTrue())
+		Expect(authorizer.IsMember("john@example.com")).To(BeFalse())
+		Expect(searcher.searches).To(Equal(2))
+
+		Expect(authorizer.clock.Add(time.Minute)).To(Succeed())
+		Expect(authorizer.IsMember("jane@example.com")).To(BeTrue())
+		Expect(searcher.searches).To(Equal(3))
+	})
+
+	It("does not authorize or cache when the search fails", func() {
+		searcher.err = errors.New("connection refused")
+		Expect(authorizer.IsMember("jane@example.com")).To(BeFalse())
+
+		searcher.err = nil
+		Expect(authorizer.IsMember("jane@example.com")).To(BeTrue())
+		Expect(searcher.searches).To(Equal(2))
+	})
+
+	It("authorizes every user found without groups", func() {
+		authorizer = newAuthorizer(searcher, options.LDAP{
+			UserBaseDN: "ou=people,dc=example,dc=com",
+			UserFilter: filter,
+		})
+		Expect(authorizer.IsMember("john@example.com")).To(BeTrue())
+		Expect(authorizer.IsMember("nobody@example.com")).To(BeFalse())
+	})
+
+	It("searches a directory server", func() {
+		server := newFakeServer("", "", &SearchEntry{
+			DN: "uid=jane,ou=people,dc=example,dc=com",
+			Attributes: map[string][]string{
+				"mail":     {"jane@example.com"},
+				"memberof": {"cn=admins,ou=groups,dc=example,dc=com"},
+			},
+		})
+		defer server.close()
+
+		authorizer, err := NewAuthorizer(options.LDAP{
+			URL:            server.url(),
+			UserBaseDN:     "ou=people,dc=example,dc=com",
+			UserFilter:     "(|(mail={email})(userPrincipalName={email}))",
+			GroupAttribute: "memberOf",
+			Groups:         []string{"cn=admins,ou=groups,dc=example,dc=com"},
+			PoolSize:       1,
+			Timeout:        5 * time.Second,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer authorizer.Close()
+
+		Expect(authorizer.IsMember("jane@example.com")).To(BeTrue())
+		Expect(authorizer.IsMember("john@example.com")).To(BeFalse())
+	})
+})
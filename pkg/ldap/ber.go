@@ -0,0 +1,210 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The classes of BER tags
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+)
+
+// The universal BER tags used by LDAP
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+// maxPacketSize bounds the size of the packets read from the server, so a
+// broken or hostile server cannot exhaust the memory of the proxy
+const maxPacketSize = 16 << 20
+
+// packet is a BER element: either primitive, holding a value, or
+// constructed, holding child elements. Only the low tag numbers used by
+// LDAP are supported.
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+func newConstructed(class, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newPrimitive(class, tag byte, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newString(s string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(s))
+}
+
+func newInteger(tag byte, n int64) *packet {
+	return newPrimitive(classUniversal, tag, encodeInteger(n))
+}
+
+func newBoolean(b bool) *packet {
+	value := byte(0x00)
+	if b {
+		value = 0xff
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{value})
+}
+
+// is returns whether the packet has the class and tag
+func (p *packet) is(class, tag byte) bool {
+	return p.class == class && p.tag == tag
+}
+
+// str returns the value of a primitive packet as a string
+func (p *packet) str() string {
+	return string(p.value)
+}
+
+// integer returns the value of a primitive INTEGER or ENUMERATED packet
+func (p *packet) integer() (int64, error) {
+	if p.constructed || len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errors.New("invalid integer")
+	}
+	n := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// encode returns the BER encoding of the packet
+func (p *packet) encode() []byte {
+	contents := p.value
+	if p.constructed {
+		contents = nil
+		for _, child := range p.children {
+			contents = append(contents, child.encode()...)
+		}
+	}
+
+	identifier := p.class | p.tag
+	if p.constructed {
+		identifier |= 0x20
+	}
+	encoded := append([]byte{identifier}, encodeLength(len(contents))...)
+	return append(encoded, contents...)
+}
+
+func encodeInteger(n int64) []byte {
+	var encoded []byte
+	for {
+		encoded = append([]byte{byte(n)}, encoded...)
+		n >>= 8
+		// Stop once the remaining bits are only the sign extension of the
+		// encoded bytes
+		if (n == 0 && encoded[0]&0x80 == 0) || (n == -1 && encoded[0]&0x80 != 0) {
+			return encoded
+		}
+	}
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var encoded []byte
+	for ; length > 0; length >>= 8 {
+		encoded = append([]byte{byte(length)}, encoded...)
+	}
+	return append([]byte{0x80 | byte(len(encoded))}, encoded...)
+}
+
+// readPacket reads a BER packet from the reader
+func readPacket(r *bufio.Reader) (*packet, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if identifier&0x1f == 0x1f {
+		return nil, errors.New("unsupported high tag number")
+	}
+
+	length, err := readLength(r)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]byte, length)
+	if _, err := io.ReadFull(r, contents); err != nil {
+		return nil, err
+	}
+	return decodePacket(identifier, contents)
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+
+	octets := int(first & 0x7f)
+	if octets == 0 || octets > 4 {
+		return 0, errors.New("unsupported length encoding")
+	}
+	length := 0
+	for i := 0; i < octets; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	if length > maxPacketSize {
+		return 0, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+	return length, nil
+}
+
+// decodePacket decodes the contents of a packet, and of its children if it
+// is constructed
+func decodePacket(identifier byte, contents []byte) (*packet, error) {
+	p := &packet{
+		class:       identifier & 0xc0,
+		constructed: identifier&0x20 != 0,
+		tag:         identifier & 0x1f,
+	}
+	if !p.constructed {
+		p.value = contents
+		return p, nil
+	}
+
+	r := bufio.NewReader(bytes.NewReader(contents))
+	for {
+		child, err := readPacket(r)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid child element: %v", err)
+		}
+		p.children = append(p.children, child)
+	}
+}
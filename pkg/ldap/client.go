@@ -0,0 +1,422 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The application tags of the LDAP operations
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opSearchResultRef   = 19
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+)
+
+const (
+	resultSuccess          = 0
+	scopeWholeSubtree      = 2
+	derefAliasesNever      = 0
+	startTLSOID            = "1.3.6.1.4.1.1466.20037"
+	protocolVersion        = 3
+	maxSearchResultEntries = 1
+)
+
+// SearchEntry is an entry found by a search
+type SearchEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// ResultError is the error result of an LDAP operation
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// Config configures the connections of a Pool
+type Config struct {
+	// URL is the ldap:// or ldaps:// URL of the server
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS before binding
+	StartTLS bool
+	// TLSConfig is used for ldaps:// and StartTLS connections
+	TLSConfig *tls.Config
+	// BindDN and BindPassword are the credentials connections are bound
+	// with. Connections are anonymous when BindDN is empty.
+	BindDN       string
+	BindPassword string
+	// Timeout bounds connecting and each operation
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept open
+	PoolSize int
+}
+
+// Pool keeps bound connections to an LDAP server open, so that searches do
+// not pay for connecting, the TLS handshake and binding each time
+type Pool struct {
+	config  Config
+	address string
+	useTLS  bool
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// NewPool creates a Pool of connections to the server of the config.
+// Connections are opened as they are needed.
+func NewPool(config Config) (*Pool, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL %q: %v", config.URL, err)
+	}
+
+	p := &Pool{config: config, address: u.Host}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			p.address = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		if config.StartTLS {
+			return nil, errors.New("StartTLS cannot be used with an ldaps:// URL")
+		}
+		p.useTLS = true
+		if u.Port() == "" {
+			p.address = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("invalid LDAP URL %q: the scheme must be ldap or ldaps", config.URL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid LDAP URL %q: missing host", config.URL)
+	}
+	return p, nil
+}
+
+// Search searches the subtree under the base DN for a single entry matching
+// the filter, returning its attributes. It returns nil when no entry
+// matches, and an error when several do.
+func (p *Pool) Search(baseDN, filter string, attributes []string) (*SearchEntry, error) {
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		c, reused, err := p.get()
+		if err != nil {
+			return nil, err
+		}
+		entry, err := c.search(baseDN, compiled, attributes)
+		var resultErr *ResultError
+		if err != nil && !errors.As(err, &resultErr) {
+			// The connection is in an unknown state after an I/O or protocol
+			// error, unlike after an error result from the server
+			c.close()
+			if reused {
+				// The server may have closed the idle connection
+				continue
+			}
+			return nil, err
+		}
+		p.put(c)
+		return entry, err
+	}
+}
+
+// Close closes the idle connections
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.close()
+	}
+}
+
+// get returns an idle connection, and whether it was idle, or opens a new
+// one
+func (p *Pool) get() (*conn, bool, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, true, nil
+	}
+	p.mu.Unlock()
+
+	c, err := p.dial()
+	return c, false, err
+}
+
+// put returns a connection to the pool, closing it when the pool is full
+func (p *Pool) put(c *conn) {
+	p.mu.Lock()
+	if len(p.idle) < p.config.PoolSize {
+		p.idle = append(p.idle, c)
+		c = nil
+	}
+	p.mu.Unlock()
+
+	if c != nil {
+		c.close()
+	}
+}
+
+// dial opens a connection, upgrading it to TLS and binding it as configured
+func (p *Pool) dial() (*conn, error) {
+	dialer := &net.Dialer{Timeout: p.config.Timeout}
+	var netConn net.Conn
+	var err error
+	if p.useTLS {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", p.address, p.tlsConfig())
+	} else {
+		netConn, err = dialer.Dial("tcp", p.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the LDAP server: %v", err)
+	}
+
+	c := newConn(netConn, p.config.Timeout)
+	if p.config.StartTLS {
+		if err := c.startTLS(p.tlsConfig()); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if p.config.BindDN != "" {
+		if err := c.bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// tlsConfig returns the TLS config of the connections, verifying the host
+// of the URL
+func (p *Pool) tlsConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if p.config.TLSConfig != nil {
+		config = p.config.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(p.address)
+	}
+	return config
+}
+
+// conn is a connection to an LDAP server, used for one operation at a time
+type conn struct {
+	netConn   net.Conn
+	reader    *bufio.Reader
+	timeout   time.Duration
+	messageID int64
+}
+
+func newConn(netConn net.Conn, timeout time.Duration) *conn {
+	return &conn{
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		timeout: timeout,
+	}
+}
+
+// send sends an operation in a new message, returning its message ID
+func (c *conn) send(op *packet) (int64, error) {
+	c.messageID++
+	message := newSequence(newInteger(tagInteger, c.messageID), op)
+	if err := c.netConn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := c.netConn.Write(message.encode()); err != nil {
+		return 0, fmt.Errorf("error writing to the LDAP server: %v", err)
+	}
+	return c.messageID, nil
+}
+
+// receive reads the operation of the next message, which must answer the
+// message ID
+func (c *conn) receive(messageID int64) (*packet, error) {
+	message, err := readPacket(c.reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading from the LDAP server: %v", err)
+	}
+	if !message.is(classUniversal, tagSequence) || len(message.children) < 2 {
+		return nil, errors.New("invalid LDAP message")
+	}
+	id, err := message.children[0].integer()
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP message ID: %v", err)
+	}
+	if id != messageID {
+		return nil, fmt.Errorf("unexpected LDAP message ID %d, expected %d", id, messageID)
+	}
+	return message.children[1], nil
+}
+
+// result returns the error of an LDAPResult, if it is not a success
+func result(op *packet) error {
+	if len(op.children) < 3 {
+		return errors.New("invalid LDAP result")
+	}
+	code, err := op.children[0].integer()
+	if err != nil {
+		return fmt.Errorf("invalid LDAP result code: %v", err)
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: op.children[2].str()}
+	}
+	return nil
+}
+
+// startTLS upgrades the connection to TLS
+func (c *conn) startTLS(config *tls.Config) error {
+	request := newConstructed(classApplication, opExtendedRequest,
+		newPrimitive(classContext, 0, []byte(startTLSOID)))
+	id, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	response, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if !response.is(classApplication, opExtendedResponse) {
+		return errors.New("unexpected response to StartTLS")
+	}
+	if err := result(response); err != nil {
+		return fmt.Errorf("error starting TLS: %v", err)
+	}
+
+	tlsConn := tls.Client(c.netConn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("error starting TLS: %v", err)
+	}
+	c.netConn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// bind authenticates the connection with a simple bind
+func (c *conn) bind(dn, password string) error {
+	request := newConstructed(classApplication, opBindRequest,
+		newInteger(tagInteger, protocolVersion),
+		newString(dn),
+		newPrimitive(classContext, 0, []byte(password)))
+	id, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	response, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if !response.is(classApplication, opBindResponse) {
+		return errors.New("unexpected response to bind")
+	}
+	if err := result(response); err != nil {
+		return fmt.Errorf("error binding as %q: %v", dn, err)
+	}
+	return nil
+}
+
+// search searches the subtree under the base DN for a single entry
+// matching the filter
+func (c *conn) search(baseDN string, filter *packet, attributes []string) (*SearchEntry, error) {
+	attributeList := newSequence()
+	for _, attribute := range attributes {
+		attributeList.children = append(attributeList.children, newString(attribute))
+	}
+	request := newConstructed(classApplication, opSearchRequest,
+		newString(baseDN),
+		newInteger(tagEnumerated, scopeWholeSubtree),
+		newInteger(tagEnumerated, derefAliasesNever),
+		// Ask for one more entry than is accepted, to detect ambiguous
+		// filters
+		newInteger(tagInteger, maxSearchResultEntries+1),
+		newInteger(tagInteger, int64(c.timeout/time.Second)),
+		newBoolean(false),
+		filter,
+		attributeList)
+	id, err := c.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*SearchEntry
+	for {
+		response, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case response.is(classApplication, opSearchResultEntry):
+			entry, err := parseEntry(response)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case response.is(classApplication, opSearchResultRef):
+			// Referrals to other servers are not followed
+		case response.is(classApplication, opSearchResultDone):
+			if len(entries) > maxSearchResultEntries {
+				return nil, fmt.Errorf("the search of %q matched several entries", baseDN)
+			}
+			if err := result(response); err != nil {
+				return nil, fmt.Errorf("error searching %q: %w", baseDN, err)
+			}
+			if len(entries) == 0 {
+				return nil, nil
+			}
+			return entries[0], nil
+		default:
+			return nil, errors.New("unexpected response to search")
+		}
+	}
+}
+
+// parseEntry parses a SearchResultEntry
+func parseEntry(op *packet) (*SearchEntry, error) {
+	if len(op.children) != 2 {
+		return nil, errors.New("invalid LDAP search result entry")
+	}
+	entry := &SearchEntry{DN: op.children[0].str(), Attributes: make(map[string][]string)}
+	for _, attribute := range op.children[1].children {
+		if len(attribute.children) != 2 {
+			return nil, errors.New("invalid LDAP search result attribute")
+		}
+		name := strings.ToLower(attribute.children[0].str())
+		for _, value := range attribute.children[1].children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.str())
+		}
+	}
+	return entry, nil
+}
+
+// close unbinds and closes the connection
+func (c *conn) close() {
+	// The server does not answer unbind requests, so errors are ignored
+	_, _ = c.send(newPrimitive(classApplication, opUnbindRequest, nil))
+	_ = c.netConn.Close()
+}
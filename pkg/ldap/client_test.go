@@ -0,0 +1,121 @@
+package ldap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	const (
+		bindDN       = "cn=oauth2-proxy,ou=services,dc=example,dc=com"
+		bindPassword = "s3cr3t"
+		baseDN       = "ou=people,dc=example,dc=com"
+	)
+
+	jane := &SearchEntry{
+		DN: "uid=jane,ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"mail":     {"jane@example.com"},
+			"memberof": {"cn=admins,ou=groups,dc=example,dc=com"},
+		},
+	}
+	john := &SearchEntry{
+		DN: "uid=john,ou=people,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"mail":     {"john@example.com"},
+			"memberof": {"cn=users,ou=groups,dc=example,dc=com"},
+		},
+	}
+
+	var server *fakeServer
+	var pool *Pool
+
+	newPool := func(password string) *Pool {
+		p, err := NewPool(Config{
+			URL:          server.url(),
+			BindDN:       bindDN,
+			BindPassword: password,
+			Timeout:      5 * time.Second,
+			PoolSize:     1,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return p
+	}
+
+	BeforeEach(func() {
+		server = newFakeServer(bindDN, bindPassword, jane, john)
+		pool = newPool(bindPassword)
+	})
+
+	AfterEach(func() {
+		pool.Close()
+		server.close()
+	})
+
+	It("finds the entry matching the filter", func() {
+		entry, err := pool.Search(baseDN, "(mail=jane@example.com)", []string{"memberOf"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entry).To(Equal(jane))
+	})
+
+	It("returns nil when no entry matches", func() {
+		entry, err := pool.Search(baseDN, "(mail=nobody@example.com)", []string{"memberOf"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entry).To(BeNil())
+	})
+
+	It("returns an error when several entries match", func() {
+		_, err := pool.Search(baseDN, "(mail=*)", []string{"memberOf"})
+		Expect(err).To(MatchError(`the search of "ou=people,dc=example,dc=com" matched several entries`))
+	})
+
+	It("reuses the idle connection", func() {
+		for i := 0; i < 3; i++ {
+			_, err := pool.Search(baseDN, "(mail=jane@example.com)", []string{"memberOf"})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		connections, searches := server.counts()
+		Expect(connections).To(Equal(1))
+		Expect(searches).To(Equal(3))
+	})
+
+	It("reconnects when the server closed the idle connection", func() {
+		_, err := pool.Search(baseDN, "(mail=jane@example.com)", []string{"memberOf"})
+		Expect(err).ToNot(HaveOccurred())
+
+		server.dropConnections()
+		entry, err := pool.Search(baseDN, "(mail=jane@example.com)", []string{"memberOf"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entry).To(Equal(jane))
+		connections, _ := server.counts()
+		Expect(connections).To(Equal(2))
+	})
+
+	It("returns an error when the bind fails", func() {
+		wrongPool := newPool("wrong")
+		defer wrongPool.Close()
+
+		_, err := wrongPool.Search(baseDN, "(mail=jane@example.com)", []string{"memberOf"})
+		Expect(err).To(MatchError(ContainSubstring("error binding as")))
+	})
+
+	It("returns an error for an invalid filter", func() {
+		_, err := pool.Search(baseDN, "mail=jane@example.com", []string{"memberOf"})
+		Expect(err).To(MatchError(ContainSubstring("invalid filter")))
+	})
+
+	DescribeTable("NewPool with an invalid config",
+		func(config Config, expected string) {
+			_, err := NewPool(config)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("with an unknown scheme", Config{URL: "http://ldap.example.com"},
+			`invalid LDAP URL "http://ldap.example.com": the scheme must be ldap or ldaps`),
+		Entry("without a host", Config{URL: "ldap://"},
+			`invalid LDAP URL "ldap://": missing host`),
+		Entry("with StartTLS on an ldaps URL", Config{URL: "ldaps://ldap.example.com", StartTLS: true},
+			"StartTLS cannot be used with an ldaps:// URL"),
+	)
+})
@@ -0,0 +1,246 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The context tags of the choices of a search filter
+const (
+	filterAnd             = 0
+	filterOr              = 1
+	filterNot             = 2
+	filterEqualityMatch   = 3
+	filterSubstrings      = 4
+	filterGreaterOrEqual  = 5
+	filterLessOrEqual     = 6
+	filterPresent         = 7
+	filterApproxMatch     = 8
+	filterExtensibleMatch = 9
+)
+
+// The context tags of the parts of a substrings filter
+const (
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// EscapeFilter escapes the characters of a value that are special in a
+// search filter, so that it only ever matches the value itself
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ValidateFilter checks a search filter can be parsed
+func ValidateFilter(filter string) error {
+	_, err := compileFilter(filter)
+	return err
+}
+
+// compileFilter parses a search filter in the string representation of RFC
+// 4515, such as (&(objectClass=person)(mail=jane@example.com)), into its
+// BER encoding
+func compileFilter(filter string) (*packet, error) {
+	p, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q after the filter", filter, rest)
+	}
+	return p, nil
+}
+
+// parseFilter parses the parenthesized filter at the start of s, returning
+// the rest of s
+func parseFilter(s string) (*packet, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("expected ( at %q", s)
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("unexpected end of filter")
+	}
+
+	var p *packet
+	var err error
+	switch s[0] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if s[0] == '|' {
+			tag = filterOr
+		}
+		p = newConstructed(classContext, tag)
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			var child *packet
+			child, s, err = parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+		}
+	case '!':
+		var child *packet
+		child, s, err = parseFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		p = newConstructed(classContext, filterNot, child)
+	default:
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return nil, "", fmt.Errorf("missing ) at %q", s)
+		}
+		p, err = parseItem(s[:end])
+		if err != nil {
+			return nil, "", err
+		}
+		s = s[end:]
+	}
+
+	if !strings.HasPrefix(s, ")") {
+		return nil, "", fmt.Errorf("missing ) at %q", s)
+	}
+	return p, s[1:], nil
+}
+
+// parseItem parses a simple filter item, such as mail=jane@example.com,
+// without its parentheses
+func parseItem(item string) (*packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid filter item %q", item)
+	}
+	attribute, rawValue := item[:eq], item[eq+1:]
+
+	var tag byte = filterEqualityMatch
+	switch attribute[len(attribute)-1] {
+	case '>':
+		tag, attribute = filterGreaterOrEqual, attribute[:len(attribute)-1]
+	case '<':
+		tag, attribute = filterLessOrEqual, attribute[:len(attribute)-1]
+	case '~':
+		tag, attribute = filterApproxMatch, attribute[:len(attribute)-1]
+	case ':':
+		return parseExtensibleMatch(attribute[:len(attribute)-1], rawValue)
+	}
+	if attribute == "" {
+		return nil, fmt.Errorf("invalid filter item %q", item)
+	}
+
+	if tag == filterEqualityMatch {
+		if rawValue == "*" {
+			return newPrimitive(classContext, filterPresent, []byte(attribute)), nil
+		}
+		if strings.Contains(rawValue, "*") {
+			return parseSubstrings(attribute, rawValue)
+		}
+	}
+
+	value, err := unescapeFilterValue(rawValue)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(classContext, tag, newString(attribute), newString(value)), nil
+}
+
+// parseSubstrings parses the value of a substrings filter, such as
+// jane*@*.example.com
+func parseSubstrings(attribute, rawValue string) (*packet, error) {
+	parts := strings.Split(rawValue, "*")
+	substrings := newSequence()
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		value, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+		var tag byte = substringAny
+		switch i {
+		case 0:
+			tag = substringInitial
+		case len(parts) - 1:
+			tag = substringFinal
+		}
+		substrings.children = append(substrings.children, newPrimitive(classContext, tag, []byte(value)))
+	}
+	return newConstructed(classContext, filterSubstrings, newString(attribute), substrings), nil
+}
+
+// parseExtensibleMatch parses an extensible match filter, such as the
+// member:1.2.840.113556.1.4.1941:=<DN> matching nested groups in Active
+// Directory, of which the attribute is the part before :=
+func parseExtensibleMatch(attribute, rawValue string) (*packet, error) {
+	parts := strings.Split(attribute, ":")
+	attributeType, dnAttributes, matchingRule := parts[0], false, ""
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn"):
+			dnAttributes = true
+		case part != "" && matchingRule == "":
+			matchingRule = part
+		default:
+			return nil, fmt.Errorf("invalid extensible match %q", attribute)
+		}
+	}
+	if attributeType == "" && matchingRule == "" {
+		return nil, fmt.Errorf("extensible match %q needs an attribute or a matching rule", attribute)
+	}
+
+	value, err := unescapeFilterValue(rawValue)
+	if err != nil {
+		return nil, err
+	}
+	p := newConstructed(classContext, filterExtensibleMatch)
+	if matchingRule != "" {
+		p.children = append(p.children, newPrimitive(classContext, 1, []byte(matchingRule)))
+	}
+	if attributeType != "" {
+		p.children = append(p.children, newPrimitive(classContext, 2, []byte(attributeType)))
+	}
+	p.children = append(p.children, newPrimitive(classContext, 3, []byte(value)))
+	if dnAttributes {
+		p.children = append(p.children, newPrimitive(classContext, 4, []byte{0xff}))
+	}
+	return p, nil
+}
+
+// unescapeFilterValue replaces the \XX escapes of a filter value with the
+// bytes they encode
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("invalid escape in filter value %q", value)
+		}
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in filter value %q", value)
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	type compileFilterTableInput struct {
+		filter   string
+		expected *packet
+	}
+
+	equality := func(attribute, value string) *packet {
+		return newConstructed(classContext, filterEqualityMatch, newString(attribute), newString(value))
+	}
+
+	DescribeTable("compileFilter",
+		func(in compileFilterTableInput) {
+			compiled, err := compileFilter(in.filter)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(compiled.encode()).To(Equal(in.expected.encode()))
+		},
+		Entry("with an equality match", compileFilterTableInput{
+			filter:   "(mail=jane@example.com)",
+			expected: equality("mail", "jane@example.com"),
+		}),
+		Entry("with nested and, or and not", compileFilterTableInput{
+			filter: "(&(objectClass=person)(|(mail=jane@example.com)(uid=jane))(!(disabled=TRUE)))",
+			expected: newConstructed(classContext, filterAnd,
+				equality("objectClass", "person"),
+				newConstructed(classContext, filterOr,
+					equality("mail", "jane@example.com"),
+					equality("uid", "jane")),
+				newConstructed(classContext, filterNot, equality("disabled", "TRUE"))),
+		}),
+		Entry("with a presence match", compileFilterTableInput{
+			filter:   "(mail=*)",
+			expected: newPrimitive(classContext, filterPresent, []byte("mail")),
+		}),
+		Entry("with a substrings match", compileFilterTableInput{
+			filter: "(mail=jane*@*.example.com)",
+			expected: newConstructed(classContext, filterSubstrings, newString("mail"), newSequence(
+				newPrimitive(classContext, substringInitial, []byte("jane")),
+				newPrimitive(classContext, substringAny, []byte("@")),
+				newPrimitive(classContext, substringFinal, []byte(".example.com")))),
+		}),
+		Entry("with an escaped value", compileFilterTableInput{
+			filter:   `(cn=\2a\28admin\29)`,
+			expected: equality("cn", "*(admin)"),
+		}),
+		Entry("with an extensible match", compileFilterTableInput{
+			filter: "(memberOf:1.2.840.113556.1.4.1941:=cn=admins,dc=example,dc=com)",
+			expected: newConstructed(classContext, filterExtensibleMatch,
+				newPrimitive(classContext, 1, []byte("1.2.840.113556.1.4.1941")),
+				newPrimitive(classContext, 2, []byte("memberOf")),
+				newPrimitive(classContext, 3, []byte("cn=admins,dc=example,dc=com"))),
+		}),
+	)
+
+	DescribeTable("compileFilter with an invalid filter",
+		func(filter string) {
+			_, err := compileFilter(filter)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("without parentheses", "mail=jane@example.com"),
+		Entry("with an unclosed filter", "(&(mail=jane@example.com)"),
+		Entry("with trailing characters", "(mail=jane@example.com))"),
+		Entry("without an attribute", "(=jane@example.com)"),
+		Entry("with an invalid escape", `(cn=\zz)`),
+	)
+
+	It("escapes the special characters of a value", func() {
+		Expect(EscapeFilter("*)(uid=*")).To(Equal(`\2a\29\28uid=\2a`))
+		Expect(EscapeFilter(`a\b`)).To(Equal(`a\5cb`))
+	})
+
+	It("compiles an escaped value to a single equality match", func() {
+		compiled, err := compileFilter("(mail=" + EscapeFilter("*)(|(mail=*") + ")")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(compiled.encode()).To(Equal(equality("mail", "*)(|(mail=*").encode()))
+	})
+})
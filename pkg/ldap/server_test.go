@@ -0,0 +1,168 @@
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeServer is a minimal LDAP server answering binds and searches of its
+// entries, for testing the client
+type fakeServer struct {
+	listener     net.Listener
+	bindDN       string
+	bindPassword string
+	entries      []*SearchEntry
+
+	mu          sync.Mutex
+	connections int
+	searches    int
+	conns       []net.Conn
+}
+
+func newFakeServer(bindDN, bindPassword string, entries ...*SearchEntry) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	s := &fakeServer{
+		listener:     listener,
+		bindDN:       bindDN,
+		bindPassword: bindPassword,
+		entries:      entries,
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) counts() (connections, searches int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.searches
+}
+
+// dropConnections closes the open connections, as a server closing idle
+// connections would
+func (s *fakeServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *fakeServer) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	bound := s.bindDN == ""
+	for {
+		message, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		id := message.children[0]
+		op := message.children[1]
+		reply := func(op *packet) {
+			_, _ = c.Write(newSequence(id, op).encode())
+		}
+
+		switch {
+		case op.is(classApplication, opBindRequest):
+			code := int64(49)
+			if op.children[1].str() == s.bindDN && op.children[2].str() == s.bindPassword {
+				code, bound = resultSuccess, true
+			}
+			reply(newConstructed(classApplication, opBindResponse,
+				newInteger(tagEnumerated, code), newString(""), newString("")))
+		case op.is(classApplication, opSearchRequest):
+			s.mu.Lock()
+			s.searches++
+			s.mu.Unlock()
+			if !bound {
+				reply(newConstructed(classApplication, opSearchResultDone,
+					newInteger(tagEnumerated, 50), newString(""), newString("insufficient access")))
+				continue
+			}
+			for _, entry := range s.entries {
+				if strings.HasSuffix(entry.DN, op.children[0].str()) && matchFilter(op.children[6], entry) {
+					reply(encodeEntry(entry))
+				}
+			}
+			reply(newConstructed(classApplication, opSearchResultDone,
+				newInteger(tagEnumerated, resultSuccess), newString(""), newString("")))
+		case op.is(classApplication, opUnbindRequest):
+			return
+		}
+	}
+}
+
+func encodeEntry(entry *SearchEntry) *packet {
+	attributes := newSequence()
+	for name, values := range entry.Attributes {
+		set := newConstructed(classUniversal, tagSet)
+		for _, value := range values {
+			set.children = append(set.children, newString(value))
+		}
+		attributes.children = append(attributes.children, newSequence(newString(name), set))
+	}
+	return newConstructed(classApplication, opSearchResultEntry, newString(entry.DN), attributes)
+}
+
+// matchFilter evaluates the and, or, not, equality and presence filters
+func matchFilter(filter *packet, entry *SearchEntry) bool {
+	switch filter.tag {
+	case filterAnd:
+		for _, child := range filter.children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !matchFilter(filter.children[0], entry)
+	case filterEqualityMatch:
+		for _, value := range entry.Attributes[strings.ToLower(filter.children[0].str())] {
+			if strings.EqualFold(value, filter.children[1].str()) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		return len(entry.Attributes[strings.ToLower(filter.str())]) > 0
+	default:
+		return false
+	}
+}
@@ -86,12 +86,21 @@ type reqLogMessageData struct {
 	Timestamp,
 	Upstream,
 	UserAgent,
-	Username string
+	Username,
+	Provider,
+	SessionAge string
 }
 
 // Returns the apparent "real client IP" as a string.
 type GetClientFunc = func(r *http.Request) string
 
+// RequestOutput is a destination of the request logs, with the formatter of
+// its log lines. A nil Writer writes to the output of the logger.
+type RequestOutput struct {
+	Formatter RequestFormatter
+	Writer    io.Writer
+}
+
 // A Logger represents an active logging object that generates lines of
 // output to an io.Writer passed through a formatter. Each logging
 // operation makes a single call to the Writer's Write method. A Logger
@@ -109,7 +118,9 @@ type Logger struct {
 	excludePaths   map[string]struct{}
 	stdLogTemplate *template.Template
 	authTemplate   *template.Template
-	reqTemplate    *template.Template
+	reqFormatter   RequestFormatter
+	reqOutputs     []RequestOutput
+	policy         *Policy
 }
 
 // New creates a new Standarderr Logger.
@@ -125,7 +136,7 @@ func New(flag int) *Logger {
 		excludePaths:   nil,
 		stdLogTemplate: template.Must(template.New("std-log").Parse(DefaultStandardLoggingFormat)),
 		authTemplate:   template.Must(template.New("auth-log").Parse(DefaultAuthLoggingFormat)),
-		reqTemplate:    template.Must(template.New("req-log").Parse(DefaultRequestLoggingFormat)),
+		reqFormatter:   templateRequestFormatter{template.Must(template.New("req-log").Parse(DefaultRequestLoggingFormat))},
 	}
 }
 
@@ -143,7 +154,7 @@ func (l *Logger) formatLogMessage(calldepth int, message string) []byte {
 	err := l.stdLogTemplate.Execute(logBuff, stdLogMessageData{
 		Timestamp: FormatTimestamp(now),
 		File:      file,
-		Message:   message,
+		Message:   l.policy.redactMessage(message),
 	})
 	if err != nil {
 		panic(err)
@@ -198,6 +209,8 @@ func (l *Logger) PrintAuthf(username string, req *http.Request, status AuthStatu
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	username = l.policy.redactUsername(username)
+
 	scope := middlewareapi.GetRequestScope(req)
 	err := l.authTemplate.Execute(l.writer, authLogMessageData{
 		Client:        client,
@@ -209,7 +222,7 @@ func (l *Logger) PrintAuthf(username string, req *http.Request, status AuthStatu
 		UserAgent:     fmt.Sprintf("%q", req.UserAgent()),
 		Username:      username,
 		Status:        string(status),
-		Message:       fmt.Sprintf(format, a...),
+		Message:       l.policy.redactMessage(fmt.Sprintf(format, a...)),
 	})
 	if err != nil {
 		panic(err)
@@ -233,50 +246,67 @@ func (l *Logger) PrintReq(username, upstream string, req *http.Request, url url.
 		return
 	}
 
-	duration := float64(time.Since(ts)) / float64(time.Second)
-
-	if username == "" {
-		username = "-"
+	entry := &RequestLogEntry{
+		Client:        l.getClientFunc(req),
+		Host:          requestutil.GetRequestHost(req),
+		Protocol:      req.Proto,
+		RequestMethod: req.Method,
+		RequestURI:    url.RequestURI(),
+		Referer:       req.Referer(),
+		UserAgent:     req.UserAgent(),
+		Timestamp:     ts,
+		Duration:      time.Since(ts),
+		StatusCode:    status,
+		ResponseSize:  size,
+		Upstream:      upstream,
+		Username:      username,
 	}
-
-	if upstream == "" {
-		upstream = "-"
+	if url.User != nil && username == "" {
+		entry.Username = url.User.Username()
 	}
-
-	if url.User != nil && username == "-" {
-		if name := url.User.Username(); name != "" {
-			username = name
+	if scope := middlewareapi.GetRequestScope(req); scope != nil {
+		entry.RequestID = scope.RequestID
+		if session := scope.Session; session != nil {
+			entry.Provider = session.ProviderID
+			if session.CreatedAt != nil {
+				entry.SessionAge = entry.Timestamp.Sub(*session.CreatedAt)
+			}
 		}
 	}
 
-	client := l.getClientFunc(req)
-
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	scope := middlewareapi.GetRequestScope(req)
-	err := l.reqTemplate.Execute(l.writer, reqLogMessageData{
-		Client:          client,
-		Host:            requestutil.GetRequestHost(req),
-		Protocol:        req.Proto,
-		RequestID:       scope.RequestID,
-		RequestDuration: fmt.Sprintf("%0.3f", duration),
-		RequestMethod:   req.Method,
-		RequestURI:      fmt.Sprintf("%q", url.RequestURI()),
-		ResponseSize:    fmt.Sprintf("%d", size),
-		StatusCode:      fmt.Sprintf("%d", status),
-		Timestamp:       FormatTimestamp(ts),
-		Upstream:        upstream,
-		UserAgent:       fmt.Sprintf("%q", req.UserAgent()),
-		Username:        username,
-	})
-	if err != nil {
-		panic(err)
+	if !l.policy.sampled(url.Path, status) {
+		return
 	}
+	entry.Username = l.policy.redactUsername(entry.Username)
+	entry.RequestURI = l.policy.redactURI(entry.RequestURI)
+	entry.Referer = l.policy.redactURI(entry.Referer)
 
-	_, err = l.writer.Write([]byte("\n"))
-	if err != nil {
-		panic(err)
+	outputs := l.reqOutputs
+	if len(outputs) == 0 {
+		outputs = []RequestOutput{{Formatter: l.reqFormatter}}
+	}
+	var buf bytes.Buffer
+	for _, output := range outputs {
+		buf.Reset()
+		if err := output.Formatter.FormatRequest(&buf, entry); err != nil {
+			panic(err)
+		}
+		buf.WriteByte('\n')
+
+		if output.Writer == nil {
+			if _, err := l.writer.Write(buf.Bytes()); err != nil {
+				panic(err)
+			}
+			continue
+		}
+		// A destination being unavailable, such as a syslog server, must
+		// not stop the requests from being served
+		if _, err := output.Writer.Write(buf.Bytes()); err != nil {
+			fmt.Fprintf(l.errWriter, "Error writing request log: %v\n", err)
+		}
 	}
 }
 
@@ -310,11 +340,15 @@ func (l *Logger) GetFileLineString(calldepth int) string {
 
 // FormatTimestamp returns a formatted timestamp.
 func (l *Logger) FormatTimestamp(ts time.Time) string {
+	return l.inTimeZone(ts).Format("2006/01/02 15:04:05")
+}
+
+// inTimeZone returns the timestamp in UTC when the logger logs UTC times
+func (l *Logger) inTimeZone(ts time.Time) time.Time {
 	if l.flag&LUTC != 0 {
-		ts = ts.UTC()
+		return ts.UTC()
 	}
-
-	return ts.Format("2006/01/02 15:04:05")
+	return ts
 }
 
 // Flags returns the output flags for the logger.
@@ -398,7 +432,39 @@ func (l *Logger) SetAuthTemplate(t string) {
 func (l *Logger) SetReqTemplate(t string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.reqTemplate = template.Must(template.New("req-log").Parse(t))
+	l.reqFormatter = templateRequestFormatter{template.Must(template.New("req-log").Parse(t))}
+}
+
+// SetPolicy sets the policy redacting and sampling the log lines. A nil
+// policy logs them unchanged. The policy must not be changed once set.
+func (l *Logger) SetPolicy(p *Policy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p != nil {
+		p.compile()
+	}
+	l.policy = p
+}
+
+// SetReqFormatter sets the formatter for request logging.
+func (l *Logger) SetReqFormatter(f RequestFormatter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reqFormatter = f
+}
+
+// SetReqOutputs sets the destinations of request logs, in place of the
+// output of the logger. Writers of the previous destinations that are
+// closers are closed.
+func (l *Logger) SetReqOutputs(outputs []RequestOutput) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, output := range l.reqOutputs {
+		if closer, ok := output.Writer.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	l.reqOutputs = outputs
 }
 
 // These functions utilize the standard logger.
@@ -485,6 +551,24 @@ func SetReqTemplate(t string) {
 	std.SetReqTemplate(t)
 }
 
+// SetPolicy sets the policy redacting and sampling the log lines of the
+// standard logger.
+func SetPolicy(p *Policy) {
+	std.SetPolicy(p)
+}
+
+// SetReqFormatter sets the formatter for request logging for the
+// standard logger.
+func SetReqFormatter(f RequestFormatter) {
+	std.SetReqFormatter(f)
+}
+
+// SetReqOutputs sets the destinations of request logs for the standard
+// logger.
+func SetReqOutputs(outputs []RequestOutput) {
+	std.SetReqOutputs(outputs)
+}
+
 // Print calls Output to print to the standard logger.
 // Arguments are handled in the manner of fmt.Print.
 func Print(v ...interface{}) {
@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+)
+
+// EmailRedaction is how a Policy writes the email addresses of log lines
+type EmailRedaction string
+
+const (
+	// EmailRedactionNone keeps email addresses
+	EmailRedactionNone EmailRedaction = ""
+	// EmailRedactionRedact replaces email addresses with a placeholder
+	EmailRedactionRedact EmailRedaction = "redact"
+	// EmailRedactionHash replaces email addresses with a hash, so that the
+	// lines of a user can still be correlated
+	EmailRedactionHash EmailRedaction = "hash"
+
+	// redacted replaces the sensitive values of log lines
+	redacted = "[REDACTED]"
+
+	// emailHashLength is the number of hex characters of email hashes
+	emailHashLength = 16
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	authPattern  = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	// tokenFieldPattern matches the values of token and secret fields, in
+	// query strings, JSON and Go structs
+	tokenFieldPattern = regexp.MustCompile(`(?i)\b(` + tokenFields + `)(["']?\s*[=:]\s*["']?)[^\s"'&,;}]+`)
+)
+
+// tokenFields are the names of the token and secret fields
+const tokenFields = `(?:access|refresh|id)_?token|client_secret|password`
+
+// Policy redacts the sensitive fields of all log lines, and samples the
+// request logs of high-volume paths
+type Policy struct {
+	// RedactTokens replaces bearer tokens, JWTs and the values of token and
+	// secret fields
+	RedactTokens bool
+
+	// Emails is how email addresses are written
+	Emails EmailRedaction
+
+	// HashKey is the key of the HMAC-SHA256 hashes of email addresses. They
+	// are plain SHA-256 hashes without it, which can be reversed by hashing
+	// known addresses.
+	HashKey []byte
+
+	// QueryParams are the query parameters whose values are redacted from
+	// request URIs, referers and log messages
+	QueryParams []string
+
+	// SampleRates are the fractions of the requests to paths starting with
+	// each prefix that are logged. The longest matching prefix applies.
+	// Requests failing with a 4xx or 5xx status are always logged.
+	SampleRates map[string]float64
+
+	queryParamPattern *regexp.Regexp
+}
+
+// compile prepares the patterns of the policy
+func (p *Policy) compile() {
+	names := make([]string, 0, len(p.QueryParams)+1)
+	if p.RedactTokens {
+		names = append(names, "(?i:"+tokenFields+")")
+	}
+	for _, name := range p.QueryParams {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if len(names) > 0 {
+		// The parameters are matched in query strings, and in printed
+		// url.Values such as `map[code:[value]]`
+		joined := strings.Join(names, "|")
+		p.queryParamPattern = regexp.MustCompile(`([?&](?:` + joined + `)=)[^&#\s"]*|([\[ ](?:` + joined + `):\[)[^\]]*`)
+	}
+}
+
+// redactMessage redacts the tokens, email addresses and query parameters of
+// a log message
+func (p *Policy) redactMessage(message string) string {
+	if p == nil {
+		return message
+	}
+	if p.RedactTokens {
+		message = jwtPattern.ReplaceAllString(message, redacted)
+		message = authPattern.ReplaceAllString(message, "$1 "+redacted)
+		message = tokenFieldPattern.ReplaceAllString(message, "${1}${2}"+redacted)
+	}
+	if p.queryParamPattern != nil {
+		message = p.queryParamPattern.ReplaceAllString(message, "${1}${2}"+redacted)
+	}
+	if p.Emails != EmailRedactionNone {
+		message = emailPattern.ReplaceAllStringFunc(message, p.redactEmail)
+	}
+	return message
+}
+
+// redactUsername redacts the username of a log line when it is an email
+// address
+func (p *Policy) redactUsername(username string) string {
+	if p == nil || p.Emails == EmailRedactionNone || !strings.Contains(username, "@") {
+		return username
+	}
+	return p.redactEmail(username)
+}
+
+// redactEmail replaces an email address with a placeholder, or its hash
+func (p *Policy) redactEmail(email string) string {
+	if p.Emails != EmailRedactionHash {
+		return redacted
+	}
+
+	var sum []byte
+	if len(p.HashKey) > 0 {
+		mac := hmac.New(sha256.New, p.HashKey)
+		mac.Write([]byte(strings.ToLower(email)))
+		sum = mac.Sum(nil)
+	} else {
+		hash := sha256.Sum256([]byte(strings.ToLower(email)))
+		sum = hash[:]
+	}
+	return "sha256:" + hex.EncodeToString(sum)[:emailHashLength]
+}
+
+// redactURI redacts the query parameters of a request URI or URL
+func (p *Policy) redactURI(uri string) string {
+	if p == nil || p.queryParamPattern == nil {
+		return uri
+	}
+	return p.queryParamPattern.ReplaceAllString(uri, "${1}${2}"+redacted)
+}
+
+// sampled returns whether the request to the path is logged
+func (p *Policy) sampled(path string, status int) bool {
+	if p == nil || len(p.SampleRates) == 0 || status >= 400 {
+		return true
+	}
+
+	longest := -1
+	rate := 1.0
+	for prefix, prefixRate := range p.SampleRates {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			longest = len(prefix)
+			rate = prefixRate
+		}
+	}
+	return rate >= 1 || rand.Float64() < rate // #nosec G404
+}
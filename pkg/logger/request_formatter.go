@@ -0,0 +1,263 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// TemplateRequestFormatter formats request log lines with the request
+	// logging format template
+	TemplateRequestFormatter = "template"
+	// JSONRequestFormatter formats request log lines as JSON objects
+	JSONRequestFormatter = "json"
+	// CombinedRequestFormatter formats request log lines in the Apache
+	// combined log format
+	CombinedRequestFormatter = "combined"
+)
+
+// RequestLogEntry holds the details of a request logged by the request
+// logger, for RequestFormatters to format
+type RequestLogEntry struct {
+	Client        string
+	Host          string
+	Protocol      string
+	RequestID     string
+	RequestMethod string
+	RequestURI    string
+	Referer       string
+	UserAgent     string
+	Timestamp     time.Time
+	Duration      time.Duration
+	StatusCode    int
+	ResponseSize  int
+
+	// Upstream is the ID of the upstream the request was proxied to,
+	// empty when it was not proxied
+	Upstream string
+	// Username is the email, or the user, of the session of the request,
+	// empty when the request is not authenticated
+	Username string
+	// Provider is the ID of the provider the user signed in with
+	Provider string
+	// SessionAge is how long ago the session of the request was created,
+	// 0 when it is not known
+	SessionAge time.Duration
+}
+
+// RequestFormatter formats the log lines of requests
+type RequestFormatter interface {
+	// FormatRequest writes the log line of a request to the writer, without
+	// a final newline
+	FormatRequest(w io.Writer, entry *RequestLogEntry) error
+}
+
+// RequestFormatterFactory creates a RequestFormatter from the request logging
+// format template, which formatters other than templates may ignore
+type RequestFormatterFactory func(format string) (RequestFormatter, error)
+
+var (
+	requestFormattersMutex sync.RWMutex
+	requestFormatters      = map[string]RequestFormatterFactory{
+		TemplateRequestFormatter: newTemplateRequestFormatter,
+		JSONRequestFormatter:     func(string) (RequestFormatter, error) { return jsonRequestFormatter{}, nil },
+		CombinedRequestFormatter: func(string) (RequestFormatter, error) { return combinedRequestFormatter{}, nil },
+	}
+)
+
+// RegisterRequestFormatter registers a request formatter under a name, so that
+// request logs can be configured to use it
+func RegisterRequestFormatter(name string, factory RequestFormatterFactory) {
+	requestFormattersMutex.Lock()
+	defer requestFormattersMutex.Unlock()
+	requestFormatters[name] = factory
+}
+
+// RequestFormatterNames returns the names of the registered request formatters
+func RequestFormatterNames() []string {
+	requestFormattersMutex.RLock()
+	defer requestFormattersMutex.RUnlock()
+
+	names := make([]string, 0, len(requestFormatters))
+	for name := range requestFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRequestFormatter creates the request formatter registered under the name
+func NewRequestFormatter(name, format string) (RequestFormatter, error) {
+	requestFormattersMutex.RLock()
+	factory, ok := requestFormatters[name]
+	requestFormattersMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown request formatter %q", name)
+	}
+	return factory(format)
+}
+
+// templateRequestFormatter formats request log lines with a template of the
+// pre-formatted fields of reqLogMessageData
+type templateRequestFormatter struct {
+	template *template.Template
+}
+
+func newTemplateRequestFormatter(format string) (RequestFormatter, error) {
+	t, err := template.New("req-log").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	return templateRequestFormatter{template: t}, nil
+}
+
+// FormatRequest executes the template with the fields of the entry
+func (f templateRequestFormatter) FormatRequest(w io.Writer, entry *RequestLogEntry) error {
+	sessionAge := "-"
+	if entry.SessionAge > 0 {
+		sessionAge = fmt.Sprintf("%d", int64(entry.SessionAge/time.Second))
+	}
+	return f.template.Execute(w, reqLogMessageData{
+		Client:          entry.Client,
+		Host:            entry.Host,
+		Protocol:        entry.Protocol,
+		RequestID:       entry.RequestID,
+		RequestDuration: fmt.Sprintf("%0.3f", entry.Duration.Seconds()),
+		RequestMethod:   entry.RequestMethod,
+		RequestURI:      fmt.Sprintf("%q", entry.RequestURI),
+		ResponseSize:    fmt.Sprintf("%d", entry.ResponseSize),
+		StatusCode:      fmt.Sprintf("%d", entry.StatusCode),
+		Timestamp:       FormatTimestamp(entry.Timestamp),
+		Upstream:        orDash(entry.Upstream),
+		UserAgent:       fmt.Sprintf("%q", entry.UserAgent),
+		Username:        orDash(entry.Username),
+		Provider:        orDash(entry.Provider),
+		SessionAge:      sessionAge,
+	})
+}
+
+// jsonRequestFormatter formats request log lines as JSON objects
+type jsonRequestFormatter struct{}
+
+// jsonRequestLogLine is the JSON object of a request log line
+type jsonRequestLogLine struct {
+	Timestamp     string   `json:"timestamp"`
+	Client        string   `json:"client"`
+	RequestID     string   `json:"request_id,omitempty"`
+	Username      string   `json:"username,omitempty"`
+	Provider      string   `json:"provider,omitempty"`
+	SessionAge    *float64 `json:"session_age,omitempty"`
+	Host          string   `json:"host"`
+	RequestMethod string   `json:"method"`
+	RequestURI    string   `json:"uri"`
+	Protocol      string   `json:"protocol"`
+	Referer       string   `json:"referer,omitempty"`
+	UserAgent     string   `json:"user_agent,omitempty"`
+	Upstream      string   `json:"upstream,omitempty"`
+	StatusCode    int      `json:"status"`
+	ResponseSize  int      `json:"size"`
+	Duration      float64  `json:"duration"`
+}
+
+// FormatRequest writes the entry as a JSON object. Durations are in seconds.
+func (jsonRequestFormatter) FormatRequest(w io.Writer, entry *RequestLogEntry) error {
+	line := jsonRequestLogLine{
+		Timestamp:     formatTimestampRFC3339(entry.Timestamp),
+		Client:        entry.Client,
+		RequestID:     entry.RequestID,
+		Username:      entry.Username,
+		Provider:      entry.Provider,
+		Host:          entry.Host,
+		RequestMethod: entry.RequestMethod,
+		RequestURI:    entry.RequestURI,
+		Protocol:      entry.Protocol,
+		Referer:       entry.Referer,
+		UserAgent:     entry.UserAgent,
+		Upstream:      entry.Upstream,
+		StatusCode:    entry.StatusCode,
+		ResponseSize:  entry.ResponseSize,
+		Duration:      entry.Duration.Seconds(),
+	}
+	if entry.SessionAge > 0 {
+		sessionAge := entry.SessionAge.Seconds()
+		line.SessionAge = &sessionAge
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(line); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return err
+}
+
+// combinedRequestFormatter formats request log lines in the Apache combined
+// log format: `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`
+type combinedRequestFormatter struct{}
+
+// FormatRequest writes the entry in the combined log format
+func (combinedRequestFormatter) FormatRequest(w io.Writer, entry *RequestLogEntry) error {
+	size := "-"
+	if entry.ResponseSize > 0 {
+		size = fmt.Sprintf("%d", entry.ResponseSize)
+	}
+	_, err := fmt.Fprintf(w, "%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"",
+		entry.Client,
+		orDash(strings.ReplaceAll(entry.Username, " ", "%20")),
+		formatTimestampCLF(entry.Timestamp),
+		entry.RequestMethod,
+		escapeCombined(entry.RequestURI),
+		entry.Protocol,
+		entry.StatusCode,
+		size,
+		escapeCombined(orDash(entry.Referer)),
+		escapeCombined(orDash(entry.UserAgent)),
+	)
+	return err
+}
+
+// escapeCombined escapes the quotes, backslashes and control characters of
+// a field of the combined log format, as Apache does
+func escapeCombined(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatTimestampRFC3339 formats a timestamp of the standard logger in the
+// RFC 3339 format, with nanoseconds
+func formatTimestampRFC3339(ts time.Time) string {
+	return std.inTimeZone(ts).Format(time.RFC3339Nano)
+}
+
+// formatTimestampCLF formats a timestamp of the standard logger in the
+// format of the common log format
+func formatTimestampCLF(ts time.Time) string {
+	return std.inTimeZone(ts).Format("02/Jan/2006:15:04:05 -0700")
+}
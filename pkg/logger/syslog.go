@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// NewSyslogWriter returns a writer sending each log line to syslog, with the
+// informational severity of the daemon facility. An empty network and
+// address send them to the local syslog server.
+func NewSyslogWriter(network, address, tag string) (io.WriteCloser, error) {
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BufferSize is the size of the buffers proxied bodies are copied with
+	// in low memory mode, rather than the 32KiB buffers allocated per copy
+	BufferSize = 4 * 1024
+
+	// MaxIdleConns is the number of idle connections kept to all hosts by
+	// HTTP transports in low memory mode
+	MaxIdleConns = 8
+
+	// IdleConnTimeout is how long idle HTTP connections are kept in low
+	// memory mode
+	IdleConnTimeout = 30 * time.Second
+
+	// StorePoolSize is the number of connections kept to the session store
+	// in low memory mode
+	StorePoolSize = 4
+
+	// gcPercent is the garbage collection target percentage in low memory
+	// mode, unless set with the GOGC environment variable
+	gcPercent = 50
+)
+
+// lowMemory records whether the low memory profile was enabled at runtime
+var lowMemory atomic.Bool
+
+// SetLowMemory enables or disables the low memory profile for the process,
+// for small devices such as ARM edge devices.
+// This should be called once during configuration validation, before any
+// transports, session stores or caches are constructed.
+// Enabling it lowers the idle connection limits of the default HTTP
+// transport, which the transports of the proxy are cloned from, and
+// collects garbage more often.
+func SetLowMemory(enabled bool) {
+	lowMemory.Store(enabled)
+	if !enabled {
+		return
+	}
+
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		ConfigureTransport(transport)
+	}
+	if _, ok := os.LookupEnv("GOGC"); !ok {
+		debug.SetGCPercent(gcPercent)
+	}
+}
+
+// LowMemory returns whether the low memory profile is enabled, in which
+// case in-process caches are disabled or shrunk, buffers are smaller and
+// connection limits are lower
+func LowMemory() bool {
+	return lowMemory.Load()
+}
+
+// ConfigureTransport lowers the idle connection limits of the transport in
+// low memory mode
+func ConfigureTransport(transport *http.Transport) {
+	if !LowMemory() {
+		return
+	}
+	transport.MaxIdleConns = MaxIdleConns
+	transport.IdleConnTimeout = IdleConnTimeout
+}
+
+var bufferPool = &pool{pool: sync.Pool{New: func() interface{} {
+	buf := make([]byte, BufferSize)
+	return &buf
+}}}
+
+// BufferPool returns the pool of buffers reverse proxies copy bodies with,
+// or nil to allocate the default buffers, unless in low memory mode
+func BufferPool() httputil.BufferPool {
+	if !LowMemory() {
+		return nil
+	}
+	return bufferPool
+}
+
+// pool is an httputil.BufferPool of BufferSize buffers
+type pool struct {
+	pool sync.Pool
+}
+
+// Get returns a buffer from the pool
+func (p *pool) Get() []byte {
+	return *(p.pool.Get().(*[]byte))
+}
+
+// Put returns a buffer to the pool
+func (p *pool) Put(buf []byte) {
+	if cap(buf) != BufferSize {
+		return
+	}
+	buf = buf[:BufferSize]
+	p.pool.Put(&buf)
+}
@@ -0,0 +1,13 @@
+package memory
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMemorySuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memory")
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	Context("without low memory mode", func() {
+		It("leaves transports and buffers to their defaults", func() {
+			Expect(LowMemory()).To(BeFalse())
+			Expect(BufferPool()).To(BeNil())
+
+			transport := &http.Transport{MaxIdleConns: 100, IdleConnTimeout: 90 * time.Second}
+			ConfigureTransport(transport)
+			Expect(transport.MaxIdleConns).To(Equal(100))
+			Expect(transport.IdleConnTimeout).To(Equal(90 * time.Second))
+		})
+	})
+
+	Context("with low memory mode", func() {
+		var defaultTransport *http.Transport
+
+		BeforeEach(func() {
+			defaultTransport = http.DefaultTransport.(*http.Transport)
+			http.DefaultTransport = defaultTransport.Clone()
+			gcPercent := debug.SetGCPercent(100)
+			gogc, hasGOGC := os.LookupEnv("GOGC")
+			os.Unsetenv("GOGC")
+
+			SetLowMemory(true)
+
+			DeferCleanup(func() {
+				SetLowMemory(false)
+				debug.SetGCPercent(gcPercent)
+				if hasGOGC {
+					os.Setenv("GOGC", gogc)
+				}
+				http.DefaultTransport = defaultTransport
+			})
+		})
+
+		It("lowers the limits of the default transport and the GC percent", func() {
+			Expect(LowMemory()).To(BeTrue())
+
+			transport := http.DefaultTransport.(*http.Transport)
+			Expect(transport.MaxIdleConns).To(Equal(MaxIdleConns))
+			Expect(transport.IdleConnTimeout).To(Equal(IdleConnTimeout))
+			Expect(debug.SetGCPercent(100)).To(Equal(gcPercent))
+		})
+
+		It("pools small buffers", func() {
+			pool := BufferPool()
+			Expect(pool).ToNot(BeNil())
+
+			buf := pool.Get()
+			Expect(buf).To(HaveLen(BufferSize))
+			pool.Put(buf[:10])
+			Expect(pool.Get()).To(HaveLen(BufferSize))
+
+			// Buffers of other sizes are not pooled
+			pool.Put(make([]byte, 10))
+			Expect(pool.Get()).To(HaveLen(BufferSize))
+		})
+	})
+})
@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the collector, returning the existing collector if an
+// identical one has already been registered, such as when a component is
+// created again by a configuration reload
+func Register(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registerer.Register(collector); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return collector
+}
@@ -0,0 +1,13 @@
+package metrics
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetricsSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Metrics")
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ = Describe("Register", func() {
+	newCounter := func() prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "A counter for the tests"})
+	}
+
+	It("returns the existing collector when an identical one is registered", func() {
+		registry := prometheus.NewRegistry()
+		first := Register(registry, newCounter())
+		Expect(Register(registry, newCounter())).To(BeIdenticalTo(first))
+	})
+
+	It("panics when a conflicting collector is registered", func() {
+		registry := prometheus.NewRegistry()
+		Register(registry, newCounter())
+		Expect(func() {
+			Register(registry, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_total", Help: "A gauge for the tests"}))
+		}).To(Panic())
+	})
+})
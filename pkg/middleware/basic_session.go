@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -11,9 +12,12 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 )
 
-func NewBasicAuthSessionLoader(validator basic.Validator, sessionGroups []string, preferEmail bool) alice.Constructor {
+// NewBasicAuthSessionLoader creates a new handler that loads sessions from
+// the basic auth credentials of requests. Attempts are rejected while the
+// lockout, which may be nil, locks out their username or client.
+func NewBasicAuthSessionLoader(validator basic.Validator, lockout *basic.Lockout, sessionGroups []string, preferEmail bool) alice.Constructor {
 	return func(next http.Handler) http.Handler {
-		return loadBasicAuthSession(validator, sessionGroups, preferEmail, next)
+		return loadBasicAuthSession(validator, lockout, sessionGroups, preferEmail, next)
 	}
 }
 
@@ -22,15 +26,15 @@ func NewBasicAuthSessionLoader(validator basic.Validator, sessionGroups []string
 // If no authorization header is found, or the header is invalid, no session
 // will be loaded and the request will be passed to the next handler.
 // If a session was loaded by a previous handler, it will not be replaced.
-func loadBasicAuthSession(validator basic.Validator, sessionGroups []string, preferEmail bool, next http.Handler) http.Handler {
+func loadBasicAuthSession(validator basic.Validator, lockout *basic.Lockout, sessionGroups []string, preferEmail bool, next http.Handler) http.Handler {
 	// This is a hack to be backwards compatible with the old PreferEmailToUser option.
 	// Long term we will have a rich static user configuration option and this will
 	// be removed.
 	// TODO(JoelSpeed): Remove this hack once rich static user config is implemented.
 	getSession := getBasicSession
 	if preferEmail {
-		getSession = func(validator basic.Validator, sessionGroups []string, req *http.Request) (*sessionsapi.SessionState, error) {
-			session, err := getBasicSession(validator, sessionGroups, req)
+		getSession = func(validator basic.Validator, lockout *basic.Lockout, sessionGroups []string, req *http.Request) (*sessionsapi.SessionState, error) {
+			session, err := getBasicSession(validator, lockout, sessionGroups, req)
 			if session != nil {
 				session.Email = session.User
 			}
@@ -48,7 +52,7 @@ func loadBasicAuthSession(validator basic.Validator, sessionGroups []string, pre
 			return
 		}
 
-		session, err := getSession(validator, sessionGroups, req)
+		session, err := getSession(validator, lockout, sessionGroups, req)
 		if err != nil {
 			logger.Errorf("Error retrieving session from token in Authorization header: %v", err)
 		}
@@ -62,7 +66,7 @@ func loadBasicAuthSession(validator basic.Validator, sessionGroups []string, pre
 // getBasicSession attempts to load a basic session from the request.
 // If the credentials in the request exist within the htpasswdMap,
 // a new session will be created.
-func getBasicSession(validator basic.Validator, sessionGroups []string, req *http.Request) (*sessionsapi.SessionState, error) {
+func getBasicSession(validator basic.Validator, lockout *basic.Lockout, sessionGroups []string, req *http.Request) (*sessionsapi.SessionState, error) {
 	auth := req.Header.Get("Authorization")
 	if auth == "" {
 		// No auth header provided, so don't attempt to load a session
@@ -74,12 +78,18 @@ func getBasicSession(validator basic.Validator, sessionGroups []string, req *htt
 		return nil, err
 	}
 
-	if validator.Validate(user, password) {
+	err = lockout.Validate(req, validator, user, password)
+	if err == nil {
 		logger.PrintAuthf(user, req, logger.AuthSuccess, "Authenticated via basic auth and HTpasswd File")
 
 		return &sessionsapi.SessionState{User: user, Groups: sessionGroups}, nil
 	}
 
+	var lockedOut *basic.LockedOutError
+	if errors.As(err, &lockedOut) {
+		// The attempt was logged by the lockout
+		return nil, nil
+	}
 	logger.PrintAuthf(user, req, logger.AuthFailure, "Invalid authentication via basic auth: not in Htpasswd File")
 	return nil, nil
 }
@@ -203,7 +203,7 @@ var _ = Describe("Headers Suite", func() {
 				User: "user-123",
 			},
 			expectedHeaders: nil,
-			expectedErr:     "error building request header injector: error building request injector: error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile",
+			expectedErr:     "error building request header injector: error building request injector: error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef",
 		}),
 	)
 
@@ -431,7 +431,7 @@ var _ = Describe("Headers Suite", func() {
 				User: "user-123",
 			},
 			expectedHeaders: nil,
-			expectedErr:     "error building response header injector: error building response injector: error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv or fromFile",
+			expectedErr:     "error building response header injector: error building response injector: error building injector for header \"X-Auth-Request-Authorization\": error loading basicAuthPassword: secret source is invalid: exactly one entry required, specify either value, fromEnv, fromFile or fromRef",
 		}),
 	)
 })
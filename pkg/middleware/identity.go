@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/justinas/alice"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/identity"
+)
+
+// NewIdentityNormalizer creates a new handler that normalizes the user ID
+// and email of the session loaded by the previous handlers, before the
+// session is authorized and passed to the upstream.
+func NewIdentityNormalizer(normalizer *identity.Normalizer) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			scope := middlewareapi.GetRequestScope(req)
+			// If scope is nil, this will panic.
+			// A scope should always be injected before this handler is called.
+			normalizer.Normalize(scope.Session)
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
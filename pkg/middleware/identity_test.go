@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/identity"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Identity Normalizer Suite", func() {
+	var handler http.Handler
+	var session *sessionsapi.SessionState
+
+	BeforeEach(func() {
+		normalizer, err := identity.NewNormalizer(options.IdentityNormalization{
+			LowercaseEmail:     true,
+			EmailDomainAliases: []string{"old.com=new.com"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		session = nil
+		handler = NewIdentityNormalizer(normalizer)(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			session = middlewareapi.GetRequestScope(req).Session
+		}))
+	})
+
+	It("normalizes the loaded session before the next handler", func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{
+			Session: &sessionsapi.SessionState{User: "alice", Email: "Alice@Old.com"},
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(session).To(Equal(&sessionsapi.SessionState{User: "alice", Email: "alice@new.com"}))
+	})
+
+	It("passes requests without a session", func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(session).To(BeNil())
+	})
+})
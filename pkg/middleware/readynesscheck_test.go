@@ -14,6 +14,7 @@ var _ = Describe("ReadynessCheck suite", func() {
 	type requestTableInput struct {
 		readyPath        string
 		healthVerifiable Verifiable
+		verifiables      []Verifiable
 		requestString    string
 		expectedStatus   int
 		expectedBody     string
@@ -25,7 +26,8 @@ var _ = Describe("ReadynessCheck suite", func() {
 
 			rw := httptest.NewRecorder()
 
-			handler := NewReadynessCheck(in.readyPath, in.healthVerifiable)(http.NotFoundHandler())
+			verifiables := append([]Verifiable{in.healthVerifiable}, in.verifiables...)
+			handler := NewReadynessCheck(in.readyPath, verifiables...)(http.NotFoundHandler())
 			handler.ServeHTTP(rw, req)
 
 			Expect(rw.Code).To(Equal(in.expectedStatus))
@@ -66,6 +68,25 @@ var _ = Describe("ReadynessCheck suite", func() {
 			expectedStatus:   500,
 			expectedBody:     "error: failed to check",
 		}),
+		Entry("with several verifiables without an underlying error", &requestTableInput{
+			readyPath:        "/ready",
+			healthVerifiable: &fakeVerifiable{nil},
+			verifiables:      []Verifiable{&fakeVerifiable{nil}},
+			requestString:    "http://example.com/ready",
+			expectedStatus:   200,
+			expectedBody:     "OK",
+		}),
+		Entry("with several verifiables and with an underlying error", &requestTableInput{
+			readyPath:        "/ready",
+			healthVerifiable: &fakeVerifiable{nil},
+			verifiables: []Verifiable{
+				&fakeVerifiable{func(ctx context.Context) error { return errors.New("warming up") }},
+				&fakeVerifiable{func(ctx context.Context) error { return errors.New("failed to check") }},
+			},
+			requestString:  "http://example.com/ready",
+			expectedStatus: 500,
+			expectedBody:   "error: warming up",
+		}),
 	)
 })
 
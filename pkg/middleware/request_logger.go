@@ -99,6 +99,12 @@ func (r *loggingResponse) Flush() {
 	}
 }
 
+// Unwrap allows the http.ResponseController to set the read and write
+// deadlines of the underlying ResponseWriter
+func (r *loggingResponse) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Status returns the response status code
 func (r *loggingResponse) Status() int {
 	return r.status
@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
@@ -107,6 +109,11 @@ var _ = Describe("Request logger suite", func() {
 			Upstream:           "custom",
 			Session:            &sessions.SessionState{User: "custom.format"},
 		}),
+		Entry("custom format with auth fields without a session", &requestLoggerTableInput{
+			Format:             "{{.Username}} {{.Provider}} {{.SessionAge}} {{.Upstream}}",
+			ExpectedLogMessage: "- - - -\n",
+			Path:               "/foo/bar",
+		}),
 		Entry("custom format ping path", &requestLoggerTableInput{
 			Format:             "{{.RequestMethod}}",
 			ExpectedLogMessage: "GET\n",
@@ -120,4 +127,207 @@ var _ = Describe("Request logger suite", func() {
 			ExcludePaths:       []string{"/ping"},
 		}),
 	)
+
+	Context("with a request formatter", func() {
+		var buf *bytes.Buffer
+
+		BeforeEach(func() {
+			buf = bytes.NewBuffer(nil)
+			logger.SetOutput(buf)
+			logger.SetExcludePaths(nil)
+		})
+
+		AfterEach(func() {
+			logger.SetReqOutputs(nil)
+			logger.SetReqTemplate(logger.DefaultRequestLoggingFormat)
+		})
+
+		serveRequest := func() {
+			req, err := http.NewRequest("GET", "/foo/bar?q=\"quoted\"", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.RemoteAddr = "127.0.0.1"
+			req.Host = "test-server"
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+
+			createdAt := time.Now().Add(-90 * time.Second)
+			scope := &middlewareapi.RequestScope{
+				RequestID: "11111111-2222-4333-8444-555555555555",
+				Session: &sessions.SessionState{
+					Email:      "formatted@example.com",
+					ProviderID: "keycloak",
+					CreatedAt:  &createdAt,
+				},
+			}
+			req = middlewareapi.AddRequestScope(req, scope)
+
+			NewRequestLogger()(testUpstreamHandler("formatted")).ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		It("logs the auth fields of requests with templates", func() {
+			logger.SetReqTemplate("{{.Username}} {{.Provider}} {{.SessionAge}} {{.Upstream}}")
+
+			serveRequest()
+
+			Expect(buf.String()).To(Equal("formatted@example.com keycloak 90 formatted\n"))
+		})
+
+		It("logs requests as JSON objects", func() {
+			formatter, err := logger.NewRequestFormatter(logger.JSONRequestFormatter, "")
+			Expect(err).ToNot(HaveOccurred())
+			logger.SetReqFormatter(formatter)
+
+			serveRequest()
+
+			line := map[string]interface{}{}
+			Expect(json.Unmarshal(buf.Bytes(), &line)).To(Succeed())
+			Expect(line).To(HaveKey("timestamp"))
+			Expect(line).To(HaveKey("duration"))
+			Expect(line["session_age"]).To(BeNumerically("~", 90, 1))
+			delete(line, "timestamp")
+			delete(line, "duration")
+			delete(line, "session_age")
+			Expect(line).To(Equal(map[string]interface{}{
+				"client":     "127.0.0.1",
+				"request_id": "11111111-2222-4333-8444-555555555555",
+				"username":   "formatted@example.com",
+				"provider":   "keycloak",
+				"host":       "test-server",
+				"method":     "GET",
+				"uri":        "/foo/bar?q=\"quoted\"",
+				"protocol":   "HTTP/1.1",
+				"referer":    "https://example.com/",
+				"user_agent": "test-agent",
+				"upstream":   "formatted",
+				"status":     float64(200),
+				"size":       float64(4),
+			}))
+		})
+
+		It("logs requests in the combined log format", func() {
+			formatter, err := logger.NewRequestFormatter(logger.CombinedRequestFormatter, "")
+			Expect(err).ToNot(HaveOccurred())
+			logger.SetReqFormatter(formatter)
+
+			serveRequest()
+
+			Expect(buf.String()).To(MatchRegexp(`^127\.0\.0\.1 - formatted@example\.com \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /foo/bar\?q=\\"quoted\\" HTTP/1\.1" 200 4 "https://example\.com/" "test-agent"\n$`))
+		})
+
+		It("logs requests to each destination with its formatter", func() {
+			jsonFormatter, err := logger.NewRequestFormatter(logger.JSONRequestFormatter, "")
+			Expect(err).ToNot(HaveOccurred())
+			templateFormatter, err := logger.NewRequestFormatter(logger.TemplateRequestFormatter, "{{.Username}} {{.Upstream}}")
+			Expect(err).ToNot(HaveOccurred())
+
+			jsonBuf := bytes.NewBuffer(nil)
+			templateBuf := bytes.NewBuffer(nil)
+			logger.SetReqOutputs([]logger.RequestOutput{
+				{Formatter: jsonFormatter, Writer: jsonBuf},
+				{Formatter: templateFormatter, Writer: templateBuf},
+			})
+
+			serveRequest()
+
+			Expect(buf.String()).To(BeEmpty())
+			Expect(jsonBuf.String()).To(HavePrefix("{"))
+			Expect(templateBuf.String()).To(Equal("formatted@example.com formatted\n"))
+		})
+	})
+
+	Context("with a logging policy", func() {
+		var buf *bytes.Buffer
+
+		BeforeEach(func() {
+			buf = bytes.NewBuffer(nil)
+			logger.SetOutput(buf)
+			logger.SetExcludePaths(nil)
+			logger.SetReqTemplate("{{.Username}} {{.RequestURI}}")
+		})
+
+		AfterEach(func() {
+			logger.SetPolicy(nil)
+			logger.SetReqTemplate(logger.DefaultRequestLoggingFormat)
+		})
+
+		serveRequest := func(path string, status int) {
+			req, err := http.NewRequest("GET", path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			scope := &middlewareapi.RequestScope{
+				Session: &sessions.SessionState{Email: "policy@example.com"},
+			}
+			req = middlewareapi.AddRequestScope(req, scope)
+
+			handler := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(status)
+			})
+			NewRequestLogger()(handler).ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		It("redacts the tokens and query parameters of request URIs", func() {
+			logger.SetPolicy(&logger.Policy{
+				RedactTokens: true,
+				QueryParams:  []string{"code"},
+			})
+
+			serveRequest("/callback?code=abc&state=xyz&access_token=secret", http.StatusOK)
+
+			Expect(buf.String()).To(Equal("policy@example.com \"/callback?code=[REDACTED]&state=xyz&access_token=[REDACTED]\"\n"))
+		})
+
+		It("redacts email usernames", func() {
+			logger.SetPolicy(&logger.Policy{Emails: logger.EmailRedactionRedact})
+
+			serveRequest("/", http.StatusOK)
+
+			Expect(buf.String()).To(Equal("[REDACTED] \"/\"\n"))
+		})
+
+		It("hashes email usernames with the hash key", func() {
+			logger.SetPolicy(&logger.Policy{Emails: logger.EmailRedactionHash, HashKey: []byte("key")})
+			serveRequest("/", http.StatusOK)
+			hashed := buf.String()
+			Expect(hashed).To(MatchRegexp(`^sha256:[0-9a-f]{16} "/"\n$`))
+
+			buf.Reset()
+			serveRequest("/", http.StatusOK)
+			Expect(buf.String()).To(Equal(hashed))
+
+			buf.Reset()
+			logger.SetPolicy(&logger.Policy{Emails: logger.EmailRedactionHash, HashKey: []byte("other")})
+			serveRequest("/", http.StatusOK)
+			Expect(buf.String()).ToNot(Equal(hashed))
+		})
+
+		It("redacts the tokens and emails of standard log lines", func() {
+			logger.SetPolicy(&logger.Policy{RedactTokens: true, Emails: logger.EmailRedactionRedact})
+
+			logger.Printf("refreshed session of policy@example.com: Authorization: Bearer abc.def refresh_token=xyz id_token: eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig")
+
+			Expect(buf.String()).To(ContainSubstring("refreshed session of [REDACTED]: Authorization: Bearer [REDACTED] refresh_token=[REDACTED] id_token: [REDACTED]\n"))
+		})
+
+		It("redacts the query parameters of printed query values", func() {
+			logger.SetPolicy(&logger.Policy{QueryParams: []string{"code"}})
+
+			logger.Printf("callback form: map[code:[abc] state:[xyz]]")
+
+			Expect(buf.String()).To(ContainSubstring("callback form: map[code:[[REDACTED]] state:[xyz]]\n"))
+		})
+
+		It("samples the successful requests to the paths", func() {
+			logger.SetPolicy(&logger.Policy{SampleRates: map[string]float64{
+				"/static":      0,
+				"/static/logs": 1,
+			}})
+
+			serveRequest("/static/app.js", http.StatusOK)
+			Expect(buf.String()).To(BeEmpty())
+
+			serveRequest("/static/missing.js", http.StatusNotFound)
+			serveRequest("/static/logs/app.js", http.StatusOK)
+			serveRequest("/api", http.StatusOK)
+			Expect(buf.String()).To(Equal("policy@example.com \"/static/missing.js\"\npolicy@example.com \"/static/logs/app.js\"\npolicy@example.com \"/api\"\n"))
+		})
+	})
 })
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/justinas/alice"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// serverAuth holds the credentials clients authenticate to a server with
+type serverAuth struct {
+	bearerToken     []byte
+	clientCAs       *x509.CertPool
+	allowedNetworks *ip.NetSet
+}
+
+// NewServerAuth returns a middleware that only passes requests from clients
+// that authenticate with the options given, responding with a 403 otherwise
+func NewServerAuth(opts *options.ServerAuth) (alice.Constructor, error) {
+	auth := &serverAuth{}
+
+	if opts.BearerToken != nil {
+		token, err := util.GetSecretValue(opts.BearerToken)
+		if err != nil {
+			return nil, fmt.Errorf("could not load bearer token: %v", err)
+		}
+		// Tokens loaded from files often end with a newline
+		token = bytes.TrimSpace(token)
+		if len(token) == 0 {
+			return nil, errors.New("bearer token is empty")
+		}
+		auth.bearerToken = token
+	}
+
+	if opts.ClientCA != nil {
+		pem, err := util.GetSecretValue(opts.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client CA: %v", err)
+		}
+		auth.clientCAs = x509.NewCertPool()
+		if !auth.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA")
+		}
+	}
+
+	if len(opts.AllowedNetworks) > 0 {
+		auth.allowedNetworks = ip.NewNetSet()
+		for _, network := range opts.AllowedNetworks {
+			ipNet := ip.ParseIPNet(network)
+			if ipNet == nil {
+				return nil, fmt.Errorf("could not parse allowed network (%s)", network)
+			}
+			auth.allowedNetworks.AddIPNet(*ipNet)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !auth.authenticate(req) {
+				http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}, nil
+}
+
+// authenticate checks the client connects from an allowed network, and that
+// it sends the bearer token or presents a client certificate when either is
+// configured
+func (a *serverAuth) authenticate(req *http.Request) bool {
+	if a.allowedNetworks != nil {
+		remoteIP, err := ip.GetClientIP(nil, req)
+		if err != nil || !a.allowedNetworks.Has(remoteIP) {
+			logger.Errorf("Denied request to %s from %s: not in an allowed network", req.URL.Path, req.RemoteAddr)
+			return false
+		}
+	}
+
+	if a.bearerToken == nil && a.clientCAs == nil {
+		return true
+	}
+	if a.hasBearerToken(req) || a.hasClientCert(req) {
+		return true
+	}
+	logger.Errorf("Denied request to %s from %s: no valid bearer token or client certificate", req.URL.Path, req.RemoteAddr)
+	return false
+}
+
+func (a *serverAuth) hasBearerToken(req *http.Request) bool {
+	if a.bearerToken == nil {
+		return false
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), a.bearerToken) == 1
+}
+
+func (a *serverAuth) hasClientCert(req *http.Request) bool {
+	if a.clientCAs == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := req.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         a.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
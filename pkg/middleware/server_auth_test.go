@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server auth", func() {
+	const token = "0123456789abcdef"
+
+	var ca *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	var caPEM []byte
+
+	newClientCert := func(parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "prometheus"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+		return cert
+	}
+
+	BeforeEach(func() {
+		var err error
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "ca"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		ca, err = x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+		caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	})
+
+	type serverAuthTableInput struct {
+		auth           func() *options.ServerAuth
+		remoteAddr     string
+		authorization  string
+		clientCert     bool
+		expectedStatus int
+	}
+
+	DescribeTable("NewServerAuth",
+		func(in serverAuthTableInput) {
+			serverAuth, err := NewServerAuth(in.auth())
+			Expect(err).ToNot(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = in.remoteAddr
+			if in.authorization != "" {
+				req.Header.Set("Authorization", in.authorization)
+			}
+			if in.clientCert {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{newClientCert(ca, caKey)}}
+			}
+
+			rw := httptest.NewRecorder()
+			serverAuth(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rw, req)
+			Expect(rw.Code).To(Equal(in.expectedStatus))
+		},
+		Entry("with the bearer token", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{BearerToken: &options.SecretSource{Value: []byte(token + "\n")}}
+			},
+			remoteAddr:     "192.168.0.1:1234",
+			authorization:  "Bearer " + token,
+			expectedStatus: http.StatusOK,
+		}),
+		Entry("with a wrong bearer token", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{BearerToken: &options.SecretSource{Value: []byte(token)}}
+			},
+			remoteAddr:     "192.168.0.1:1234",
+			authorization:  "Bearer fedcba9876543210",
+			expectedStatus: http.StatusForbidden,
+		}),
+		Entry("with a client certificate instead of the bearer token", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{
+					BearerToken: &options.SecretSource{Value: []byte(token)},
+					ClientCA:    &options.SecretSource{Value: caPEM},
+				}
+			},
+			remoteAddr:     "192.168.0.1:1234",
+			clientCert:     true,
+			expectedStatus: http.StatusOK,
+		}),
+		Entry("with an allowed network", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{AllowedNetworks: []string{"10.0.0.0/8"}}
+			},
+			remoteAddr:     "10.1.2.3:1234",
+			expectedStatus: http.StatusOK,
+		}),
+		Entry("with a network that is not allowed", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{AllowedNetworks: []string{"10.0.0.0/8"}}
+			},
+			remoteAddr:     "192.168.0.1:1234",
+			expectedStatus: http.StatusForbidden,
+		}),
+		Entry("with the bearer token from a network that is not allowed", serverAuthTableInput{
+			auth: func() *options.ServerAuth {
+				return &options.ServerAuth{
+					BearerToken:     &options.SecretSource{Value: []byte(token)},
+					AllowedNetworks: []string{"10.0.0.0/8"},
+				}
+			},
+			remoteAddr:     "192.168.0.1:1234",
+			authorization:  "Bearer " + token,
+			expectedStatus: http.StatusForbidden,
+		}),
+	)
+
+	It("fails with an empty bearer token", func() {
+		_, err := NewServerAuth(&options.ServerAuth{BearerToken: &options.SecretSource{FromEnv: "OAUTH2_PROXY_TEST_UNSET_TOKEN"}})
+		Expect(err).To(MatchError("bearer token is empty"))
+	})
+})
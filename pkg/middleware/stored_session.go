@@ -162,8 +162,9 @@ func (s *storedSessionLoader) refreshSessionIfNeeded(rw http.ResponseWriter, req
 		}
 	}()
 
-	// Reload the session in case it was changed underneath us.
-	freshSession, err := s.store.Load(req)
+	// Reload the session in case it was changed underneath us, from the
+	// primary copy of the store as replicas may not have the change yet.
+	freshSession, err := s.store.Load(req.WithContext(sessionsapi.WithConsistentRead(req.Context())))
 	if err != nil {
 		return fmt.Errorf("could not load session: %v", err)
 	}
@@ -0,0 +1,181 @@
+package oidcissuer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// discovery is the OpenID Connect discovery document of the issuer
+type discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// errorResponse is an OAuth 2.0 error response
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Discovery serves the OpenID Connect discovery document of the issuer
+func (i *Issuer) Discovery(rw http.ResponseWriter, req *http.Request) {
+	issuer := i.issuerURL(req)
+	writeJSON(rw, http.StatusOK, discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{i.method.Alg()},
+		ScopesSupported:                   []string{"openid", "email", "profile", "groups"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "iat", "exp", "nonce", "email", "preferred_username", "groups"},
+	})
+}
+
+// JWKS serves the public key the tokens are signed with
+func (i *Issuer) JWKS(rw http.ResponseWriter, _ *http.Request) {
+	writeJSON(rw, http.StatusOK, jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{
+			Key:       i.key.Public(),
+			KeyID:     i.keyID,
+			Algorithm: i.method.Alg(),
+			Use:       "sig",
+		}},
+	})
+}
+
+// Token redeems an authorization code for an ID token and an access token,
+// for the client the code was minted for
+func (i *Issuer) Token(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Cache-Control", "no-store")
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		writeError(rw, http.StatusMethodNotAllowed, "invalid_request", "the token endpoint only accepts POST requests")
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, secret, ok := clientCredentials(req)
+	if !ok || !i.authenticateClient(clientID, secret) {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="oidc"`)
+		writeError(rw, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+	if grantType := req.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		writeError(rw, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	c, err := i.redeem(req.PostForm.Get("code"), clientID, req.PostForm.Get("redirect_uri"))
+	if err != nil {
+		logger.Errorf("Error redeeming OIDC issuer authorization code of client %q: %v", clientID, err)
+		writeError(rw, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	issuer := i.issuerURL(req)
+	idClaims := jwt.MapClaims{}
+	if c.Nonce != "" {
+		idClaims["nonce"] = c.Nonce
+	}
+	idToken, err := i.mint(issuer, clientID, c.Session, idClaims, "")
+	if err != nil {
+		logger.Errorf("Error minting OIDC issuer ID token: %v", err)
+		writeError(rw, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	accessToken, err := i.mint(issuer, clientID, c.Session, jwt.MapClaims{"client_id": clientID}, accessTokenType)
+	if err != nil {
+		logger.Errorf("Error minting OIDC issuer access token: %v", err)
+		writeError(rw, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(i.expire.Seconds()),
+		IDToken:     idToken,
+	})
+}
+
+// UserInfo serves the identity of the user an access token was minted for
+func (i *Issuer) UserInfo(rw http.ResponseWriter, req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(rw, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+
+	claims, err := i.verifyAccessToken(i.issuerURL(req), token)
+	if err != nil {
+		rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(rw, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+
+	userInfo := jwt.MapClaims{}
+	for _, claim := range []string{"sub", "email", "preferred_username", "groups"} {
+		if value, ok := claims[claim]; ok {
+			userInfo[claim] = value
+		}
+	}
+	writeJSON(rw, http.StatusOK, userInfo)
+}
+
+// clientCredentials returns the credentials of the client, from the basic
+// auth header or the form
+func clientCredentials(req *http.Request) (string, string, bool) {
+	if id, secret, ok := req.BasicAuth(); ok {
+		// Basic auth credentials are form encoded by OAuth 2.0 clients
+		id, idErr := url.QueryUnescape(id)
+		secret, secretErr := url.QueryUnescape(secret)
+		return id, secret, idErr == nil && secretErr == nil
+	}
+	id := req.PostForm.Get("client_id")
+	return id, req.PostForm.Get("client_secret"), id != ""
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logger.Errorf("Error encoding OIDC issuer response: %v", err)
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, code, description string) {
+	writeJSON(rw, status, errorResponse{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,364 @@
+package oidcissuer
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/header"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/replay"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// Path is the path of the issuer, under the proxy prefix
+	Path = "/oidc"
+
+	// AuthorizePath is the path of the authorization endpoint, under the
+	// proxy prefix
+	AuthorizePath = Path + "/authorize"
+
+	// DiscoveryPath is the path of the discovery document, under the proxy
+	// prefix
+	DiscoveryPath = Path + "/.well-known/openid-configuration"
+
+	// JWKSPath is the path of the public keys, under the proxy prefix
+	JWKSPath = Path + "/jwks"
+
+	// TokenPath is the path of the token endpoint, under the proxy prefix
+	TokenPath = Path + "/token"
+
+	// UserInfoPath is the path of the userinfo endpoint, under the proxy
+	// prefix
+	UserInfoPath = Path + "/userinfo"
+
+	// codeExpire is how long an authorization code can be redeemed for
+	codeExpire = time.Minute
+
+	// codeIDLength is the length of the random ID identifying each code
+	codeIDLength = 16
+
+	// accessTokenType is the `typ` header of access tokens, which tells
+	// them apart from ID tokens
+	accessTokenType = "at+jwt"
+)
+
+var (
+	// ErrInvalidClient is returned when an authorization request is made
+	// for an unknown client
+	ErrInvalidClient = errors.New("unknown client_id")
+
+	// ErrInvalidRedirectURI is returned when an authorization request is
+	// made with a redirect URI that is not allowed
+	ErrInvalidRedirectURI = errors.New("redirect_uri is not allowed")
+
+	errInvalidCode  = errors.New("invalid authorization code")
+	errCodeRedeemed = errors.New("authorization code has already been redeemed")
+)
+
+// Issuer is a minimal OpenID Connect issuer, that signs the users of
+// upstream applications in with the session of the proxy.
+// It supports the authorization code flow for confidential clients.
+// Authorization codes are encrypted, rather than stored, so that any replica
+// of the proxy sharing the cookie secret can redeem them, and can only be
+// redeemed once per replica before they expire.
+type Issuer struct {
+	url         string
+	proxyPrefix string
+	key         crypto.Signer
+	method      jwt.SigningMethod
+	keyID       string
+	clients     map[string]options.OIDCIssuerClient
+	expire      time.Duration
+	cipher      encryption.Cipher
+	clock       clock.Clock
+	redeemed    *replay.Cache
+}
+
+// code is the content of an encrypted authorization code
+type code struct {
+	ID          []byte                 `msgpack:"id"`
+	ClientID    string                 `msgpack:"cid"`
+	RedirectURI string                 `msgpack:"ru"`
+	Nonce       string                 `msgpack:"n,omitempty"`
+	ExpiresAt   int64                  `msgpack:"exp"`
+	Session     *sessions.SessionState `msgpack:"s"`
+}
+
+// New creates an Issuer from the OIDC issuer options. The authorization
+// codes are encrypted with a key derived from the secret, and remembered in
+// the replay cache once redeemed.
+func New(opts options.OIDCIssuer, proxyPrefix string, secret []byte, redeemed *replay.Cache) (*Issuer, error) {
+	pemKey, err := os.ReadFile(opts.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %v", err)
+	}
+	key, method, err := header.ParseJWTSigningKey(pemKey)
+	encryption.Zero(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing signing key: %v", err)
+	}
+	thumbprint, err := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error computing signing key id: %v", err)
+	}
+
+	clients, err := parseClients(opts.Clients)
+	if err != nil {
+		return nil, err
+	}
+
+	codeKey, err := encryption.DeriveKey(encryption.KeyDerivationHKDF, secret, encryption.OIDCIssuerKeyLabel, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving authorization code key: %v", err)
+	}
+	cipher, err := encryption.NewGCMCipher(codeKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating authorization code cipher: %v", err)
+	}
+
+	return &Issuer{
+		url:         strings.TrimSuffix(opts.URL, "/"),
+		proxyPrefix: proxyPrefix,
+		key:         key,
+		method:      method,
+		keyID:       base64.RawURLEncoding.EncodeToString(thumbprint),
+		clients:     clients,
+		expire:      opts.TokenExpire,
+		cipher:      cipher,
+		redeemed:    redeemed,
+	}, nil
+}
+
+// parseClients parses the clients of the issuer by their ID
+func parseClients(entries []string) (map[string]options.OIDCIssuerClient, error) {
+	clients := make(map[string]options.OIDCIssuerClient, len(entries))
+	for _, entry := range entries {
+		client, err := options.ParseOIDCIssuerClient(entry)
+		if err != nil {
+			return nil, err
+		}
+		clients[client.ID] = client
+	}
+	return clients, nil
+}
+
+// issuerURL returns the issuer identifier, which defaults to the issuer path
+// on the host of the request
+func (i *Issuer) issuerURL(req *http.Request) string {
+	if i.url != "" {
+		return i.url
+	}
+
+	proto := requestutil.GetRequestProto(req)
+	if proto == "" {
+		proto = "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+	}
+	return proto + "://" + requestutil.GetRequestHost(req) + i.proxyPrefix + Path
+}
+
+// AuthRequest is a request to the authorization endpoint, made by a known
+// client with an allowed redirect URI
+type AuthRequest struct {
+	ClientID    string
+	RedirectURI string
+	State       string
+	Nonce       string
+	// Prompt is `none` when the client asks that the user is not signed in
+	// if they have no session
+	Prompt string
+	// Error is the OAuth 2.0 error code the request fails with, when it is
+	// otherwise invalid
+	Error string
+}
+
+// ParseAuthRequest parses a request to the authorization endpoint.
+// An error is returned when the client or redirect URI are not known, as
+// the user must not be redirected to them then.
+func (i *Issuer) ParseAuthRequest(req *http.Request) (*AuthRequest, error) {
+	query := req.URL.Query()
+	authReq := &AuthRequest{
+		ClientID:    query.Get("client_id"),
+		RedirectURI: query.Get("redirect_uri"),
+		State:       query.Get("state"),
+		Nonce:       query.Get("nonce"),
+		Prompt:      query.Get("prompt"),
+	}
+	client, ok := i.clients[authReq.ClientID]
+	if !ok {
+		return nil, ErrInvalidClient
+	}
+	if !slices.Contains(client.RedirectURLs, authReq.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	switch {
+	case query.Get("response_type") != "code":
+		authReq.Error = "unsupported_response_type"
+	case !slices.Contains(strings.Fields(query.Get("scope")), "openid"):
+		authReq.Error = "invalid_scope"
+	}
+	return authReq, nil
+}
+
+// Redirect returns the redirect URI of the request with the response
+// parameters, and the state of the request
+func (a *AuthRequest) Redirect(params url.Values) string {
+	// The redirect URI is one of the allowed redirect URLs, so it parses
+	target, _ := url.Parse(a.RedirectURI)
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if a.State != "" {
+		query.Set("state", a.State)
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// Authorize mints an authorization code carrying the session and returns the
+// redirect URI of the request with it.
+// The tokens of the session are not carried by the code, as the tokens
+// minted from it only hold the identity of the user.
+func (i *Issuer) Authorize(authReq *AuthRequest, s *sessions.SessionState) (string, error) {
+	id, err := encryption.Nonce(codeIDLength)
+	if err != nil {
+		return "", fmt.Errorf("error generating authorization code id: %v", err)
+	}
+
+	packed, err := msgpack.Marshal(&code{
+		ID:          id,
+		ClientID:    authReq.ClientID,
+		RedirectURI: authReq.RedirectURI,
+		Nonce:       authReq.Nonce,
+		ExpiresAt:   i.clock.Now().Add(codeExpire).Unix(),
+		Session: &sessions.SessionState{
+			User:              s.User,
+			Email:             s.Email,
+			PreferredUsername: s.PreferredUsername,
+			Groups:            s.Groups,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling authorization code: %v", err)
+	}
+
+	encrypted, err := i.cipher.Encrypt(packed)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting authorization code: %v", err)
+	}
+	return authReq.Redirect(url.Values{"code": {base64.RawURLEncoding.EncodeToString(encrypted)}}), nil
+}
+
+// redeem returns the content of an authorization code minted for the client
+// and redirect URI. Each code can only be redeemed once.
+func (i *Issuer) redeem(value, clientID, redirectURI string) (*code, error) {
+	encrypted, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCode
+	}
+	packed, err := i.cipher.Decrypt(encrypted)
+	if err != nil {
+		return nil, errInvalidCode
+	}
+
+	var c code
+	if err := msgpack.Unmarshal(packed, &c); err != nil || c.Session == nil {
+		return nil, errInvalidCode
+	}
+
+	now := i.clock.Now()
+	expiresAt := time.Unix(c.ExpiresAt, 0)
+	if c.ClientID != clientID || c.RedirectURI != redirectURI || !now.Before(expiresAt) {
+		return nil, errInvalidCode
+	}
+
+	if !i.redeemed.Use(hex.EncodeToString(c.ID), expiresAt, now) {
+		return nil, errCodeRedeemed
+	}
+	return &c, nil
+}
+
+// authenticateClient returns whether the secret is the secret of the client
+func (i *Issuer) authenticateClient(clientID, secret string) bool {
+	client, ok := i.clients[clientID]
+	return ok && subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) == 1
+}
+
+// mint signs a token with the identity of the session for the client
+func (i *Issuer) mint(issuer, clientID string, s *sessions.SessionState, extra jwt.MapClaims, tokenType string) (string, error) {
+	now := i.clock.Now()
+	claims := identityClaims(s)
+	claims["iss"] = issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(i.expire).Unix()
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(i.method, claims)
+	token.Header["kid"] = i.keyID
+	if tokenType != "" {
+		token.Header["typ"] = tokenType
+	}
+	return token.SignedString(i.key)
+}
+
+// identityClaims returns the standard claims of the identity of the session.
+// The subject is the user of the session, or its email when it has no user.
+func identityClaims(s *sessions.SessionState) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": s.User}
+	if s.User == "" {
+		claims["sub"] = s.Email
+	}
+	if s.Email != "" {
+		claims["email"] = s.Email
+	}
+	if s.PreferredUsername != "" {
+		claims["preferred_username"] = s.PreferredUsername
+	}
+	if len(s.Groups) > 0 {
+		claims["groups"] = s.Groups
+	}
+	return claims
+}
+
+// verifyAccessToken returns the claims of an access token minted by the
+// issuer
+func (i *Issuer) verifyAccessToken(issuer, value string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(value, claims,
+		func(*jwt.Token) (interface{}, error) { return i.key.Public(), nil },
+		jwt.WithValidMethods([]string{i.method.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithTimeFunc(i.clock.Now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if token.Header["typ"] != accessTokenType {
+		return nil, errors.New("token is not an access token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,242 @@
+package oidcissuer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/replay"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OIDC Issuer", func() {
+	const (
+		issuerURL   = "https://auth.example.com/oauth2/oidc"
+		redirectURI = "https://wiki.example.com/oidc/callback"
+	)
+
+	var issuer *Issuer
+	var key *ecdsa.PrivateKey
+	var session *sessions.SessionState
+
+	BeforeEach(func() {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		der, err := x509.MarshalECPrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+		keyFile := filepath.Join(GinkgoT().TempDir(), "issuer.pem")
+		Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)).To(Succeed())
+
+		issuer, err = New(options.OIDCIssuer{
+			SigningKeyFile: keyFile,
+			Clients: []string{
+				"wiki:wiki-secret:" + redirectURI,
+				"chat:chat-secret:https://chat.example.com/callback",
+			},
+			TokenExpire: time.Hour,
+		}, "/oauth2", []byte("0123456789abcdef0123456789abcdef"), replay.New())
+		Expect(err).ToNot(HaveOccurred())
+
+		session = &sessions.SessionState{
+			User:              "123456",
+			Email:             "user@example.com",
+			PreferredUsername: "user",
+			Groups:            []string{"admins"},
+			AccessToken:       "provider-access-token",
+		}
+	})
+
+	AfterEach(func() {
+		issuer.clock.Reset()
+	})
+
+	authorize := func(nonce string) string {
+		req := httptest.NewRequest("GET", "https://auth.example.com/oauth2/oidc/authorize?"+url.Values{
+			"client_id":     {"wiki"},
+			"redirect_uri":  {redirectURI},
+			"response_type": {"code"},
+			"scope":         {"openid email"},
+			"state":         {"xyz"},
+			"nonce":         {nonce},
+		}.Encode(), nil)
+		authReq, err := issuer.ParseAuthRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(authReq.Error).To(BeEmpty())
+
+		target, err := issuer.Authorize(authReq, session)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target).To(HavePrefix(redirectURI + "?"))
+		u, err := url.Parse(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(u.Query().Get("state")).To(Equal("xyz"))
+		return u.Query().Get("code")
+	}
+
+	redeem := func(code, secret string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {redirectURI}}
+		req := httptest.NewRequest("POST", "https://auth.example.com/oauth2/oidc/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("wiki", secret)
+		rw := httptest.NewRecorder()
+		issuer.Token(rw, req)
+		return rw
+	}
+
+	Context("ParseAuthRequest", func() {
+		type parseAuthRequestTableInput struct {
+			query         url.Values
+			expectedErr   error
+			expectedError string
+		}
+
+		DescribeTable("validates the request",
+			func(in parseAuthRequestTableInput) {
+				req := httptest.NewRequest("GET", "/oauth2/oidc/authorize?"+in.query.Encode(), nil)
+				authReq, err := issuer.ParseAuthRequest(req)
+				if in.expectedErr != nil {
+					Expect(err).To(MatchError(in.expectedErr))
+					return
+				}
+				Expect(err).ToNot(HaveOccurred())
+				Expect(authReq.Error).To(Equal(in.expectedError))
+			},
+			Entry("with a valid request", parseAuthRequestTableInput{
+				query: url.Values{"client_id": {"wiki"}, "redirect_uri": {redirectURI}, "response_type": {"code"}, "scope": {"openid"}},
+			}),
+			Entry("with an unknown client", parseAuthRequestTableInput{
+				query:       url.Values{"client_id": {"other"}, "redirect_uri": {redirectURI}, "response_type": {"code"}, "scope": {"openid"}},
+				expectedErr: ErrInvalidClient,
+			}),
+			Entry("with a redirect URI that is not allowed", parseAuthRequestTableInput{
+				query:       url.Values{"client_id": {"wiki"}, "redirect_uri": {"https://evil.example.com/"}, "response_type": {"code"}, "scope": {"openid"}},
+				expectedErr: ErrInvalidRedirectURI,
+			}),
+			Entry("with the redirect URI of another client", parseAuthRequestTableInput{
+				query:       url.Values{"client_id": {"wiki"}, "redirect_uri": {"https://chat.example.com/callback"}, "response_type": {"code"}, "scope": {"openid"}},
+				expectedErr: ErrInvalidRedirectURI,
+			}),
+			Entry("with the redirect URI of the other client", parseAuthRequestTableInput{
+				query: url.Values{"client_id": {"chat"}, "redirect_uri": {"https://chat.example.com/callback"}, "response_type": {"code"}, "scope": {"openid"}},
+			}),
+			Entry("with the implicit flow", parseAuthRequestTableInput{
+				query:         url.Values{"client_id": {"wiki"}, "redirect_uri": {redirectURI}, "response_type": {"id_token"}, "scope": {"openid"}},
+				expectedError: "unsupported_response_type",
+			}),
+			Entry("without the openid scope", parseAuthRequestTableInput{
+				query:         url.Values{"client_id": {"wiki"}, "redirect_uri": {redirectURI}, "response_type": {"code"}, "scope": {"email"}},
+				expectedError: "invalid_scope",
+			}),
+		)
+	})
+
+	It("serves the discovery document on the host of the request", func() {
+		req := httptest.NewRequest("GET", "https://auth.example.com/oauth2/oidc/.well-known/openid-configuration", nil)
+		req.URL.Scheme = "https"
+		rw := httptest.NewRecorder()
+		issuer.Discovery(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		var doc map[string]interface{}
+		Expect(json.Unmarshal(rw.Body.Bytes(), &doc)).To(Succeed())
+		Expect(doc).To(HaveKeyWithValue("issuer", issuerURL))
+		Expect(doc).To(HaveKeyWithValue("authorization_endpoint", issuerURL+"/authorize"))
+		Expect(doc).To(HaveKeyWithValue("token_endpoint", issuerURL+"/token"))
+		Expect(doc).To(HaveKeyWithValue("jwks_uri", issuerURL+"/jwks"))
+		Expect(doc).To(HaveKeyWithValue("id_token_signing_alg_values_supported", ConsistOf("ES256")))
+	})
+
+	It("mints ID tokens that OIDC clients verify with the JWKS", func() {
+		rw := redeem(authorize("n-0S6_WzA2Mj"), "wiki-secret")
+		Expect(rw.Code).To(Equal(http.StatusOK), rw.Body.String())
+		Expect(rw.Header().Get("Cache-Control")).To(Equal("no-store"))
+
+		var tokens tokenResponse
+		Expect(json.Unmarshal(rw.Body.Bytes(), &tokens)).To(Succeed())
+		Expect(tokens.TokenType).To(Equal("Bearer"))
+		Expect(tokens.ExpiresIn).To(Equal(int64(3600)))
+
+		jwksRW := httptest.NewRecorder()
+		issuer.JWKS(jwksRW, httptest.NewRequest("GET", "/oauth2/oidc/jwks", nil))
+		jwks := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Write(jwksRW.Body.Bytes())
+		}))
+		defer jwks.Close()
+
+		verifier := oidc.NewVerifier(issuerURL, oidc.NewRemoteKeySet(context.Background(), jwks.URL), &oidc.Config{ClientID: "wiki", SupportedSigningAlgs: []string{"ES256"}})
+		idToken, err := verifier.Verify(context.Background(), tokens.IDToken)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(idToken.Subject).To(Equal("123456"))
+		Expect(idToken.Nonce).To(Equal("n-0S6_WzA2Mj"))
+
+		var claims map[string]interface{}
+		Expect(idToken.Claims(&claims)).To(Succeed())
+		Expect(claims).To(HaveKeyWithValue("email", "user@example.com"))
+		Expect(claims).To(HaveKeyWithValue("preferred_username", "user"))
+		Expect(claims).To(HaveKeyWithValue("groups", ConsistOf("admins")))
+		Expect(tokens.IDToken).ToNot(ContainSubstring("provider-access-token"))
+	})
+
+	It("serves the identity of access tokens at the userinfo endpoint", func() {
+		rw := redeem(authorize(""), "wiki-secret")
+		var tokens tokenResponse
+		Expect(json.Unmarshal(rw.Body.Bytes(), &tokens)).To(Succeed())
+
+		userInfo := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "https://auth.example.com/oauth2/oidc/userinfo", nil)
+			req.URL.Scheme = "https"
+			req.Header.Set("Authorization", "Bearer "+token)
+			rw := httptest.NewRecorder()
+			issuer.UserInfo(rw, req)
+			return rw
+		}
+
+		rw = userInfo(tokens.AccessToken)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"sub":"123456","email":"user@example.com","preferred_username":"user","groups":["admins"]}`))
+
+		Expect(userInfo(tokens.IDToken).Code).To(Equal(http.StatusUnauthorized))
+
+		issuer.clock.Set(time.Now().Add(2 * time.Hour))
+		Expect(userInfo(tokens.AccessToken).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("redeems authorization codes once", func() {
+		code := authorize("")
+		Expect(redeem(code, "wiki-secret").Code).To(Equal(http.StatusOK))
+
+		rw := redeem(code, "wiki-secret")
+		Expect(rw.Code).To(Equal(http.StatusBadRequest))
+		Expect(rw.Body.String()).To(ContainSubstring(`"error":"invalid_grant"`))
+	})
+
+	It("rejects expired authorization codes", func() {
+		code := authorize("")
+		issuer.clock.Set(time.Now().Add(2 * time.Minute))
+
+		rw := redeem(code, "wiki-secret")
+		Expect(rw.Code).To(Equal(http.StatusBadRequest))
+		Expect(rw.Body.String()).To(ContainSubstring(`"error":"invalid_grant"`))
+	})
+
+	It("rejects clients with the wrong secret", func() {
+		rw := redeem(authorize(""), "wrong-secret")
+		Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+		Expect(rw.Body.String()).To(ContainSubstring(`"error":"invalid_client"`))
+	})
+})
@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Options configures a probe of an OAuth2 Proxy deployment
+type Options struct {
+	// URL is the URL of an application protected by the proxy.
+	// The application should be an echo server, responding with the headers of
+	// the request, for the injected headers to be checked.
+	URL string
+	// ProxyPrefix is the prefix of the proxy endpoints
+	ProxyPrefix string
+	// CookieName is the name of the session cookie
+	CookieName string
+
+	// TokenURL is the token endpoint of the provider
+	TokenURL string
+	// DeviceAuthURL is the device authorization endpoint of the provider.
+	// When set the device flow is used to obtain a token, otherwise the
+	// resource owner password credentials of the test account are used.
+	DeviceAuthURL string
+	// ClientID and ClientSecret identify the client requesting tokens
+	ClientID     string
+	ClientSecret string
+	// Scope is the scope of the tokens requested
+	Scope string
+	// Username and Password are the credentials of the test account
+	Username string
+	Password string
+
+	// ExpectHeaders are the headers the proxy must inject into requests to the
+	// application
+	ExpectHeaders []string
+
+	// Client is used to make the requests to the proxy and the provider.
+	// Redirects are not followed.
+	Client *http.Client
+	// Out receives the instructions for the user during the device flow
+	Out io.Writer
+}
+
+// Result is the outcome of a single step of the probe
+type Result struct {
+	Step     string
+	Err      error
+	Duration time.Duration
+}
+
+// Results are the outcomes of the steps of the probe
+type Results []Result
+
+// Failed returns whether any step of the probe failed
+func (r Results) Failed() bool {
+	for _, result := range r {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the results with a line per step
+func (r Results) String() string {
+	var b strings.Builder
+	for _, result := range r {
+		if result.Err != nil {
+			fmt.Fprintf(&b, "FAIL %s (%s): %v\n", result.Step, result.Duration.Round(time.Millisecond), result.Err)
+		} else {
+			fmt.Fprintf(&b, "OK   %s (%s)\n", result.Step, result.Duration.Round(time.Millisecond))
+		}
+	}
+	return b.String()
+}
+
+// step is a step of the probe, stopping the probe when it fails
+type step struct {
+	name string
+	run  func(context.Context) error
+}
+
+// Run exercises the login flow of the proxy with the test account: it checks
+// that unauthenticated requests are sent to sign in with a CSRF cookie, signs
+// in with a token from the provider, checks the headers injected into the
+// application requests and signs out.
+// The steps run in order and the probe stops at the first failing step.
+func Run(ctx context.Context, opts Options) Results {
+	p := &prober{opts: opts, client: noRedirects(opts.Client)}
+	steps := []step{
+		{name: "unauthenticated request is denied", run: p.checkUnauthenticated},
+		{name: "sign in starts with a CSRF cookie", run: p.checkStart},
+		{name: "token is issued for the test account", run: p.getToken},
+		{name: "authenticated request is proxied", run: p.checkAuthenticated},
+		{name: "sign out clears the session cookie", run: p.checkSignOut},
+	}
+
+	results := Results{}
+	for _, s := range steps {
+		start := time.Now()
+		err := s.run(ctx)
+		results = append(results, Result{Step: s.name, Err: err, Duration: time.Since(start)})
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+// prober holds the state shared by the steps of a probe
+type prober struct {
+	opts   Options
+	client *http.Client
+	token  string
+}
+
+// noRedirects returns a copy of the client that does not follow redirects
+func noRedirects(client *http.Client) *http.Client {
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return c
+}
+
+func (p *prober) checkUnauthenticated(ctx context.Context) error {
+	resp, _, err := p.get(ctx, p.opts.URL, "")
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusFound, http.StatusUnauthorized, http.StatusForbidden:
+		return nil
+	default:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func (p *prober) checkStart(ctx context.Context) error {
+	start, err := p.proxyURL("/start", url.Values{"rd": {"/"}})
+	if err != nil {
+		return err
+	}
+	resp, _, err := p.get(ctx, start, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Location") == "" {
+		return fmt.Errorf("no redirect to the provider")
+	}
+	for _, cookie := range resp.Cookies() {
+		if strings.HasPrefix(cookie.Name, p.opts.CookieName+"_csrf") {
+			return nil
+		}
+	}
+	return fmt.Errorf("no CSRF cookie was set")
+}
+
+func (p *prober) checkAuthenticated(ctx context.Context) error {
+	resp, body, err := p.get(ctx, p.opts.URL, p.token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	echoed := strings.ToLower(string(body))
+	missing := []string{}
+	for _, header := range p.opts.ExpectHeaders {
+		if !strings.Contains(echoed, strings.ToLower(header)) {
+			missing = append(missing, header)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("headers were not injected: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (p *prober) checkSignOut(ctx context.Context) error {
+	signOut, err := p.proxyURL("/sign_out", nil)
+	if err != nil {
+		return err
+	}
+	resp, _, err := p.get(ctx, signOut, p.token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusFound {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == p.opts.CookieName && (cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now()))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the session cookie was not cleared")
+}
+
+// proxyURL returns the URL of a proxy endpoint on the host of the application
+func (p *prober) proxyURL(path string, query url.Values) (string, error) {
+	u, err := url.Parse(p.opts.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %v", p.opts.URL, err)
+	}
+	u.Path = p.opts.ProxyPrefix + path
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// get requests the URL, with the token as a bearer token when set
+func (p *prober) get(ctx context.Context, target, token string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error requesting %s: %v", target, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response from %s: %v", target, err)
+	}
+	return resp, body, nil
+}
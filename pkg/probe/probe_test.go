@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Probe", func() {
+	const idToken = "test-id-token"
+
+	var (
+		proxy, provider *httptest.Server
+		injectHeaders   bool
+		opts            Options
+	)
+
+	BeforeEach(func() {
+		injectHeaders = true
+
+		provider = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			Expect(req.ParseForm()).To(Succeed())
+			Expect(req.Form.Get("client_id")).To(Equal("probe"))
+			rw.Header().Set("Content-Type", "application/json")
+
+			switch req.URL.Path {
+			case "/device":
+				fmt.Fprint(rw, `{"device_code":"device","user_code":"ABCD-EFGH","verification_uri":"https://idp.example.com/device","interval":1}`)
+			case "/token":
+				switch req.Form.Get("grant_type") {
+				case "password":
+					if req.Form.Get("password") != "secret" {
+						rw.WriteHeader(http.StatusBadRequest)
+						fmt.Fprint(rw, `{"error":"invalid_grant","error_description":"Invalid user credentials"}`)
+						return
+					}
+				case deviceCodeGrantType:
+					Expect(req.Form.Get("device_code")).To(Equal("device"))
+				}
+				fmt.Fprintf(rw, `{"access_token":"access","id_token":%q}`, idToken)
+			}
+		}))
+
+		proxy = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			authenticated := req.Header.Get("Authorization") == "Bearer "+idToken
+			switch req.URL.Path {
+			case "/oauth2/start":
+				http.SetCookie(rw, &http.Cookie{Name: "_oauth2_proxy_csrf", Value: "csrf"})
+				http.Redirect(rw, req, provider.URL+"/authorize", http.StatusFound)
+			case "/oauth2/sign_out":
+				http.SetCookie(rw, &http.Cookie{Name: "_oauth2_proxy", MaxAge: -1})
+				http.Redirect(rw, req, "/", http.StatusFound)
+			default:
+				if !authenticated {
+					rw.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if injectHeaders {
+					fmt.Fprintln(rw, "X-Forwarded-Email: probe@example.com")
+				}
+				fmt.Fprintln(rw, "X-Forwarded-User: probe")
+			}
+		}))
+
+		opts = Options{
+			URL:           proxy.URL + "/app",
+			ProxyPrefix:   "/oauth2",
+			CookieName:    "_oauth2_proxy",
+			TokenURL:      provider.URL + "/token",
+			ClientID:      "probe",
+			Username:      "probe@example.com",
+			Password:      "secret",
+			ExpectHeaders: []string{"X-Forwarded-User", "X-Forwarded-Email"},
+		}
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		provider.Close()
+	})
+
+	It("passes every step with the password credentials", func() {
+		report := Run(context.Background(), opts)
+		Expect(report.Failed()).To(BeFalse(), report.String())
+		Expect(report).To(HaveLen(5))
+	})
+
+	It("passes every step with the device flow", func() {
+		out := &bytes.Buffer{}
+		opts.DeviceAuthURL = provider.URL + "/device"
+		opts.Out = out
+
+		report := Run(context.Background(), opts)
+		Expect(report.Failed()).To(BeFalse(), report.String())
+		Expect(out.String()).To(ContainSubstring("visit https://idp.example.com/device and enter the code ABCD-EFGH"))
+	})
+
+	It("stops when the test account cannot sign in", func() {
+		opts.Password = "wrong"
+
+		report := Run(context.Background(), opts)
+		Expect(report.Failed()).To(BeTrue())
+		Expect(report).To(HaveLen(3))
+		Expect(report[2].Err).To(MatchError("token request failed: invalid_grant Invalid user credentials"))
+	})
+
+	It("fails when headers are not injected", func() {
+		injectHeaders = false
+
+		report := Run(context.Background(), opts)
+		Expect(report.Failed()).To(BeTrue())
+		Expect(report).To(HaveLen(4))
+		Expect(report[3].Err).To(MatchError("headers were not injected: X-Forwarded-Email"))
+		Expect(report.String()).To(ContainSubstring("FAIL authenticated request is proxied"))
+	})
+})
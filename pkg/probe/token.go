@@ -0,0 +1,190 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// deviceCodeGrantType is the grant type of the device flow (RFC 8628)
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// defaultDevicePollInterval is the interval between token requests of the
+	// device flow when the provider does not give one
+	defaultDevicePollInterval = 5 * time.Second
+)
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceAuthResponse is the response of the device authorization endpoint
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// getToken obtains a token for the test account, preferring the ID token as
+// it is the token the proxy verifies bearer tokens as
+func (p *prober) getToken(ctx context.Context) error {
+	var (
+		token *tokenResponse
+		err   error
+	)
+	if p.opts.DeviceAuthURL != "" {
+		token, err = p.deviceFlow(ctx)
+	} else {
+		token, err = p.passwordGrant(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.token = token.IDToken
+	if p.token == "" {
+		p.token = token.AccessToken
+	}
+	if p.token == "" {
+		return errors.New("no token was issued")
+	}
+	return nil
+}
+
+// passwordGrant requests a token with the resource owner password credentials
+// of the test account
+func (p *prober) passwordGrant(ctx context.Context) (*tokenResponse, error) {
+	token, err := p.requestToken(ctx, url.Values{
+		"grant_type": {"password"},
+		"username":   {p.opts.Username},
+		"password":   {p.opts.Password},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	return token, nil
+}
+
+// deviceFlow asks the user to authorize the probe on another device, and polls
+// the token endpoint until they have
+func (p *prober) deviceFlow(ctx context.Context) (*tokenResponse, error) {
+	var auth deviceAuthResponse
+	status, err := p.postForm(ctx, p.opts.DeviceAuthURL, p.clientParams(url.Values{}), &auth)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || auth.DeviceCode == "" {
+		return nil, fmt.Errorf("device authorization failed with status %d", status)
+	}
+
+	if p.opts.Out != nil {
+		verificationURI := auth.VerificationURIComplete
+		if verificationURI == "" {
+			verificationURI = auth.VerificationURI
+		}
+		fmt.Fprintf(p.opts.Out, "To sign in the test account, visit %s and enter the code %s\n", verificationURI, auth.UserCode)
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		token, err := p.requestToken(ctx, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {auth.DeviceCode},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.Error {
+		case "":
+			return token, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, fmt.Errorf("device authorization failed: %s %s", token.Error, token.ErrorDescription)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("device authorization was not completed: %v", ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// requestToken requests a token from the token endpoint
+func (p *prober) requestToken(ctx context.Context, params url.Values) (*tokenResponse, error) {
+	var token tokenResponse
+	status, err := p.postForm(ctx, p.opts.TokenURL, p.clientParams(params), &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK && token.Error == "" {
+		return nil, fmt.Errorf("token request failed with status %d", status)
+	}
+	return &token, nil
+}
+
+// clientParams adds the client credentials to the parameters
+func (p *prober) clientParams(params url.Values) url.Values {
+	params.Set("client_id", p.opts.ClientID)
+	if p.opts.ClientSecret != "" {
+		params.Set("client_secret", p.opts.ClientSecret)
+	}
+	if p.opts.Scope != "" {
+		params.Set("scope", p.opts.Scope)
+	}
+	return params
+}
+
+// postForm posts the parameters to the endpoint and decodes the JSON response
+// into the value, whatever the status of the response
+func (p *prober) postForm(ctx context.Context, endpoint string, params url.Values, into interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error requesting %s: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("error reading response from %s: %v", endpoint, err)
+	}
+	if err := json.Unmarshal(body, into); err != nil {
+		return resp.StatusCode, fmt.Errorf("error decoding response from %s (status %d): %v", endpoint, resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
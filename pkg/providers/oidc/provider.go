@@ -55,8 +55,7 @@ func NewProvider(ctx context.Context, issuerURL string, skipIssuerVerification b
 	logger.Printf("Performing OIDC Discovery...")
 
 	var p providerJSON
-	requestURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
-	if err := requests.New(requestURL).WithContext(ctx).Do().UnmarshalInto(&p); err != nil {
+	if err := requests.New(DiscoveryURL(issuerURL)).WithContext(ctx).Do().UnmarshalInto(&p); err != nil {
 		return nil, fmt.Errorf("failed to discover OIDC configuration: %v", err)
 	}
 
@@ -74,6 +73,12 @@ func NewProvider(ctx context.Context, issuerURL string, skipIssuerVerification b
 	}, nil
 }
 
+// DiscoveryURL returns the URL of the OpenID Connect discovery document of
+// the issuer
+func DiscoveryURL(issuerURL string) string {
+	return strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+}
+
 // discoveryProvider holds the discovered endpoints
 type discoveryProvider struct {
 	authURL              string
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
@@ -41,12 +42,18 @@ type ProviderVerifierOptions struct {
 	// SkipDiscovery allows to skip OIDC discovery and use manually supplied Endpoints
 	SkipDiscovery bool
 
+	// DiscoveryTimeout is the maximum duration of the discovery request.
+	// A zero value disables the timeout.
+	DiscoveryTimeout time.Duration
+
 	// SkipIssuerVerification skips verification of ID token issuers.
 	// When false, ID Token Issuers must match the OIDC discovery URL.
 	SkipIssuerVerification bool
 
 	// SupportedSigningAlgs is the list of signature algorithms supported by the
 	// provider.
+	// When discovery is enabled, the discovered algorithms are restricted to
+	// this list.
 	SupportedSigningAlgs []string
 }
 
@@ -98,7 +105,7 @@ func NewProviderVerifier(ctx context.Context, opts ProviderVerifierOptions) (Pro
 	if err != nil {
 		return nil, fmt.Errorf("could not get verifier builder: %v", err)
 	}
-	verifier := NewVerifier(verifierBuilder(opts.toOIDCConfig()), opts.toVerificationOptions())
+	verifier := verifierBuilder(opts.toOIDCConfig(), opts.toVerificationOptions())
 
 	if provider == nil {
 		// To avoid the possibility of nil pointers, always return an empty provider if discovery didn't occur.
@@ -113,7 +120,7 @@ func NewProviderVerifier(ctx context.Context, opts ProviderVerifierOptions) (Pro
 	}, nil
 }
 
-type verifierBuilder func(*oidc.Config) *oidc.IDTokenVerifier
+type verifierBuilder func(*oidc.Config, IDTokenVerificationOptions) IDTokenVerifier
 
 func getVerifierBuilder(ctx context.Context, opts ProviderVerifierOptions) (verifierBuilder, DiscoveryProvider, error) {
 	if opts.SkipDiscovery {
@@ -121,24 +128,58 @@ func getVerifierBuilder(ctx context.Context, opts ProviderVerifierOptions) (veri
 		return newVerifierBuilder(ctx, opts.IssuerURL, opts.JWKsURL, opts.SupportedSigningAlgs), nil, nil
 	}
 
-	provider, err := NewProvider(ctx, opts.IssuerURL, opts.SkipIssuerVerification)
+	discoveryCtx := ctx
+	if opts.DiscoveryTimeout > 0 {
+		var cancel context.CancelFunc
+		discoveryCtx, cancel = context.WithTimeout(ctx, opts.DiscoveryTimeout)
+		defer cancel()
+	}
+	provider, err := NewProvider(discoveryCtx, opts.IssuerURL, opts.SkipIssuerVerification)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error while discovery OIDC configuration: %v", err)
 	}
-	verifierBuilder := newVerifierBuilder(ctx, opts.IssuerURL, provider.Endpoints().JWKsURL, provider.SupportedSigningAlgs())
+	supportedSigningAlgs, err := restrictSigningAlgs(provider.SupportedSigningAlgs(), opts.SupportedSigningAlgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	verifierBuilder := newVerifierBuilder(ctx, opts.IssuerURL, provider.Endpoints().JWKsURL, supportedSigningAlgs)
 	return verifierBuilder, provider, nil
 }
 
+// restrictSigningAlgs returns the discovered signing algorithms that are also
+// in the allowed list. If no allowed list is given, the discovered algorithms
+// are returned unchanged.
+func restrictSigningAlgs(discovered, allowed []string) ([]string, error) {
+	if len(allowed) == 0 || len(discovered) == 0 {
+		return discovered, nil
+	}
+
+	var algs []string
+	for _, alg := range discovered {
+		for _, allowedAlg := range allowed {
+			if alg == allowedAlg {
+				algs = append(algs, alg)
+				break
+			}
+		}
+	}
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("none of the discovered signing algorithms %v are allowed, expected one of %v", discovered, allowed)
+	}
+	return algs, nil
+}
+
 // newVerifierBuilder returns a function to create a IDToken verifier from an OIDC config.
+// The verifiers can warm up by fetching the keys of the JWKS URL.
 func newVerifierBuilder(ctx context.Context, issuerURL, jwksURL string, supportedSigningAlgs []string) verifierBuilder {
 	ctx = oidc.ClientContext(ctx, requests.DefaultHTTPClient)
 	keySet := oidc.NewRemoteKeySet(ctx, jwksURL)
-	return func(oidcConfig *oidc.Config) *oidc.IDTokenVerifier {
+	return func(oidcConfig *oidc.Config, verificationOptions IDTokenVerificationOptions) IDTokenVerifier {
 		if len(supportedSigningAlgs) > 0 {
 			oidcConfig.SupportedSigningAlgs = supportedSigningAlgs
 		}
 
-		return oidc.NewVerifier(issuerURL, keySet, oidcConfig)
+		return newIDTokenVerifier(oidc.NewVerifier(issuerURL, keySet, oidcConfig), verificationOptions, keySet)
 	}
 }
 
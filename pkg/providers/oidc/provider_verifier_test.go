@@ -2,6 +2,9 @@ package oidc
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -85,6 +88,12 @@ var _ = Describe("ProviderVerifier", func() {
 				p.JWKsURL = m.JWKSEndpoint()
 			},
 		}),
+		Entry("when none of the discovered signing algorithms are supported", &newProviderVerifierTableInput{
+			modifyOpts: func(p *ProviderVerifierOptions) {
+				p.SupportedSigningAlgs = []string{"ES256"}
+			},
+			expectedError: "could not get verifier builder: none of the discovered signing algorithms [RS256] are allowed, expected one of [ES256]",
+		}),
 	)
 
 	type verifierTableInput struct {
@@ -134,6 +143,11 @@ var _ = Describe("ProviderVerifier", func() {
 		Expect(idToken.Subject).To(Equal(claims.Subject))
 	},
 		Entry("with the default opts and claims", &verifierTableInput{}),
+		Entry("with restricted signing algorithms", &verifierTableInput{
+			modifyOpts: func(p *ProviderVerifierOptions) {
+				p.SupportedSigningAlgs = []string{"RS256", "ES256"}
+			},
+		}),
 		Entry("when the audience is mismatched", &verifierTableInput{
 			modifyClaims: func(j *jwt.RegisteredClaims) {
 				j.Audience = jwt.ClaimStrings{"OtherClient"}
@@ -170,3 +184,55 @@ var _ = Describe("ProviderVerifier", func() {
 		}),
 	)
 })
+
+var _ = Describe("ProviderVerifier WarmUp", func() {
+	type warmUpTableInput struct {
+		status          int
+		expectedError   string
+		expectedFetches int32
+	}
+
+	DescribeTable("fetching the keys of the JWKS URL", func(in warmUpTableInput) {
+		var fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			rw.WriteHeader(in.status)
+			rw.Write([]byte(`{"keys":[]}`))
+		}))
+		defer server.Close()
+
+		pv, err := NewProviderVerifier(context.Background(), ProviderVerifierOptions{
+			ClientID:      "client",
+			IssuerURL:     server.URL,
+			JWKsURL:       server.URL,
+			SkipDiscovery: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		warmUpper, ok := pv.Verifier().(interface{ WarmUp(context.Context) error })
+		Expect(ok).To(BeTrue())
+
+		err = warmUpper.WarmUp(context.Background())
+		if in.expectedError != "" {
+			Expect(err).To(MatchError(HavePrefix(in.expectedError)))
+		} else {
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(atomic.LoadInt32(&fetches)).To(Equal(in.expectedFetches))
+	},
+		Entry("with a JWKS URL that serves keys", warmUpTableInput{
+			status:          http.StatusOK,
+			expectedFetches: 1,
+		}),
+		Entry("with a JWKS URL that fails", warmUpTableInput{
+			status:          http.StatusInternalServerError,
+			expectedError:   "fetching keys",
+			expectedFetches: 1,
+		}),
+	)
+
+	It("does nothing for verifiers without a key set", func() {
+		verifier := NewVerifier(nil, IDTokenVerificationOptions{}).(*idTokenVerifier)
+		Expect(verifier.WarmUp(context.Background())).To(Succeed())
+	})
+})
@@ -2,8 +2,10 @@ package oidc
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 )
@@ -18,6 +20,9 @@ type idTokenVerifier struct {
 	verifier            *oidc.IDTokenVerifier
 	verificationOptions IDTokenVerificationOptions
 	allowedAudiences    map[string]struct{}
+
+	// keySet is the key set of the verifier, when it can be warmed up
+	keySet oidc.KeySet
 }
 
 // IDTokenVerificationOptions options for the oidc.idTokenVerifier that are required to verify an ID Token
@@ -29,6 +34,10 @@ type IDTokenVerificationOptions struct {
 
 // NewVerifier constructs a new idTokenVerifier
 func NewVerifier(iv *oidc.IDTokenVerifier, vo IDTokenVerificationOptions) IDTokenVerifier {
+	return newIDTokenVerifier(iv, vo, nil)
+}
+
+func newIDTokenVerifier(iv *oidc.IDTokenVerifier, vo IDTokenVerificationOptions, keySet oidc.KeySet) *idTokenVerifier {
 	allowedAudiences := make(map[string]struct{})
 	allowedAudiences[vo.ClientID] = struct{}{}
 	for _, extraAudience := range vo.ExtraAudiences {
@@ -38,9 +47,34 @@ func NewVerifier(iv *oidc.IDTokenVerifier, vo IDTokenVerificationOptions) IDToke
 		verifier:            iv,
 		verificationOptions: vo,
 		allowedAudiences:    allowedAudiences,
+		keySet:              keySet,
 	}
 }
 
+// WarmUp fetches the keys of the remote key set of the verifier, so that
+// the first ID tokens verified do not wait for them.
+// The key set only fetches keys when it verifies a signature with a key it
+// does not have, so a token signed with an unknown key is verified.
+func (v *idTokenVerifier) WarmUp(ctx context.Context) error {
+	if v.keySet == nil {
+		return nil
+	}
+
+	_, err := v.keySet.VerifySignature(ctx, warmUpToken)
+	if err != nil && strings.HasPrefix(err.Error(), "fetching keys") {
+		return err
+	}
+	return nil
+}
+
+// warmUpToken is a JWT signed with a key ID no key set holds, eg:
+// `{"alg":"RS256","kid":"oauth2-proxy-warm-up"}.{}.warm-up`
+var warmUpToken = strings.Join([]string{
+	base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"oauth2-proxy-warm-up"}`)),
+	base64.RawURLEncoding.EncodeToString([]byte(`{}`)),
+	base64.RawURLEncoding.EncodeToString([]byte(`warm-up`)),
+}, ".")
+
 // Verify verifies incoming ID Token
 func (v *idTokenVerifier) Verify(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
 	token, err := v.verifier.Verify(ctx, rawIDToken)
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 
 	"github.com/bitly/go-simplejson"
@@ -28,7 +29,40 @@ type ClaimExtractor interface {
 // NewClaimExtractor constructs a new ClaimExtractor from the raw ID Token.
 // If needed, it will use the profile URL to look up a claim if it isn't present
 // within the ID Token.
-func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header) (ClaimExtractor, error) {
+func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header, opts ...ClaimExtractorOption) (ClaimExtractor, error) {
+	return newClaimExtractor(ctx, idToken, profileURL, profileRequestHeaders, opts...)
+}
+
+// NewMergingClaimExtractor constructs a new ClaimExtractor from the raw ID Token
+// that always fetches the profile URL and merges its claims with those of the
+// ID Token. Claims present in both are taken from the profile URL when
+// preferProfile is set, and from the ID Token otherwise, except for lists,
+// whose values are combined.
+func NewMergingClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header, preferProfile bool, opts ...ClaimExtractorOption) (ClaimExtractor, error) {
+	c, err := newClaimExtractor(ctx, idToken, profileURL, profileRequestHeaders, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.mergeProfileClaims = true
+	c.preferProfileClaims = preferProfile
+	return c, nil
+}
+
+// ClaimExtractorOption configures optional behaviour of a ClaimExtractor
+type ClaimExtractorOption func(*claimExtractor)
+
+// WithDistributedClaims makes the ClaimExtractor resolve claims that the ID
+// Token leaves out and names in its `_claim_names` claim instead, from the
+// aggregated claims or the endpoint of their `_claim_sources` entry.
+// Endpoints are requested with the access token of the source, or else with
+// the profile request headers.
+func WithDistributedClaims() ClaimExtractorOption {
+	return func(c *claimExtractor) {
+		c.resolveDistributedClaims = true
+	}
+}
+
+func newClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL, profileRequestHeaders http.Header, opts ...ClaimExtractorOption) (*claimExtractor, error) {
 	payload, err := parseJWT(idToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse ID Token: %v", err)
@@ -39,12 +73,16 @@ func NewClaimExtractor(ctx context.Context, idToken string, profileURL *url.URL,
 		return nil, fmt.Errorf("failed to parse ID Token payload: %v", err)
 	}
 
-	return &claimExtractor{
+	c := &claimExtractor{
 		ctx:            ctx,
 		profileURL:     profileURL,
 		requestHeaders: profileRequestHeaders,
 		tokenClaims:    tokenClaims,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 // claimExtractor implements the ClaimExtractor interface
@@ -54,6 +92,11 @@ type claimExtractor struct {
 	requestHeaders map[string][]string
 	tokenClaims    *simplejson.Json
 	profileClaims  *simplejson.Json
+	sourceClaims   map[string]*simplejson.Json
+
+	mergeProfileClaims       bool
+	preferProfileClaims      bool
+	resolveDistributedClaims bool
 }
 
 // GetClaim will return the value claim if it exists.
@@ -64,17 +107,20 @@ func (c *claimExtractor) GetClaim(claim string) (interface{}, bool, error) {
 		return nil, false, nil
 	}
 
-	if value := getClaimFrom(claim, c.tokenClaims); value != nil {
-		return value, true, nil
+	if c.mergeProfileClaims {
+		return c.getMergedClaim(claim)
 	}
 
-	if c.profileClaims == nil {
-		profileClaims, err := c.loadProfileClaims()
-		if err != nil {
-			return nil, false, fmt.Errorf("failed to fetch claims from profile URL: %v", err)
-		}
+	value, err := c.getTokenClaim(claim)
+	if err != nil {
+		return nil, false, err
+	}
+	if value != nil {
+		return value, true, nil
+	}
 
-		c.profileClaims = profileClaims
+	if err := c.ensureProfileClaims(); err != nil {
+		return nil, false, err
 	}
 
 	if value := getClaimFrom(claim, c.profileClaims); value != nil {
@@ -84,6 +130,88 @@ func (c *claimExtractor) GetClaim(claim string) (interface{}, bool, error) {
 	return nil, false, nil
 }
 
+// getMergedClaim returns the value of the claim in the ID Token merged with
+// its value from the profile URL
+func (c *claimExtractor) getMergedClaim(claim string) (interface{}, bool, error) {
+	if err := c.ensureProfileClaims(); err != nil {
+		return nil, false, err
+	}
+
+	tokenValue, err := c.getTokenClaim(claim)
+	if err != nil {
+		return nil, false, err
+	}
+
+	preferred, other := tokenValue, getClaimFrom(claim, c.profileClaims)
+	if c.preferProfileClaims {
+		preferred, other = other, preferred
+	}
+
+	value := mergeClaimValues(preferred, other)
+	return value, value != nil, nil
+}
+
+// getTokenClaim returns the value of the claim in the ID Token, resolving it
+// from its claim source when it is distributed and this is enabled
+func (c *claimExtractor) getTokenClaim(claim string) (interface{}, error) {
+	if value := getClaimFrom(claim, c.tokenClaims); value != nil {
+		return value, nil
+	}
+	if !c.resolveDistributedClaims {
+		return nil, nil
+	}
+	return c.getDistributedClaim(claim)
+}
+
+// mergeClaimValues combines the values of lists, and otherwise returns the
+// preferred value when it is set
+func mergeClaimValues(preferred, other interface{}) interface{} {
+	if preferred == nil {
+		return other
+	}
+
+	preferredList, ok := preferred.([]interface{})
+	if !ok {
+		return preferred
+	}
+	otherList, ok := other.([]interface{})
+	if !ok {
+		return preferred
+	}
+
+	merged := append([]interface{}{}, preferredList...)
+	for _, value := range otherList {
+		if !containsClaimValue(merged, value) {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+func containsClaimValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureProfileClaims loads the profile claims, unless they are loaded already
+func (c *claimExtractor) ensureProfileClaims() error {
+	if c.profileClaims != nil {
+		return nil
+	}
+
+	profileClaims, err := c.loadProfileClaims()
+	if err != nil {
+		return fmt.Errorf("failed to fetch claims from profile URL: %v", err)
+	}
+
+	c.profileClaims = profileClaims
+	return nil
+}
+
 // loadProfileClaims will fetch the profileURL using the provided headers as
 // authentication.
 func (c *claimExtractor) loadProfileClaims() (*simplejson.Json, error) {
@@ -140,15 +268,110 @@ func parseJWT(p string) ([]byte, error) {
 }
 
 // getClaimFrom gets a claim from a Json object.
-// It can accept either a single claim name or a json path if the path is a valid json path.
-// Paths with indexes are not supported.
+// It can accept either a single claim name or a JSONPath-like expression to a
+// nested claim, such as `realm_access.roles`, `resource_access['my-app'].roles`
+// or `groups[*].name`. Claims named with characters that are not valid in a
+// path, such as `https://example.com/groups`, are looked up as they are.
+// Values nested in claims that hold JSON encoded strings are decoded.
 func getClaimFrom(claim string, src *simplejson.Json) interface{} {
-	_, err := jp.ParseString(claim)
+	if value, ok := src.CheckGet(claim); ok {
+		return decodeJSONString(value.Interface())
+	}
+
+	expr, err := jp.ParseString(claim)
 	if err != nil {
-		return src.Get(claim).Interface()
+		return nil
 	}
-	claimParts := strings.Split(claim, ".")
-	return src.GetPath(claimParts...).Interface()
+	return getClaimPath(expr, src.Interface())
+}
+
+// getClaimPath follows the fragments of the path expression through the
+// claims, decoding JSON encoded strings along the way. Wildcards collect the
+// values they match into a slice.
+func getClaimPath(expr jp.Expr, claims interface{}) interface{} {
+	values := []interface{}{claims}
+	wildcard := false
+
+	for _, frag := range expr {
+		next := []interface{}{}
+		for _, value := range values {
+			value = decodeJSONString(value)
+			switch f := frag.(type) {
+			case jp.Root, jp.At, jp.Bracket:
+				next = append(next, value)
+			case jp.Child:
+				if m, ok := value.(map[string]interface{}); ok {
+					if child, ok := m[string(f)]; ok {
+						next = append(next, child)
+					}
+				}
+			case jp.Nth:
+				if a, ok := value.([]interface{}); ok {
+					i := int(f)
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					}
+				}
+			case jp.Wildcard:
+				wildcard = true
+				switch v := value.(type) {
+				case map[string]interface{}:
+					for _, child := range v {
+						next = append(next, child)
+					}
+				case []interface{}:
+					next = append(next, v...)
+				}
+			default:
+				// Filters, slices and other expressions are not supported
+				return nil
+			}
+		}
+		values = next
+	}
+
+	if !wildcard {
+		if len(values) == 0 {
+			return nil
+		}
+		return decodeJSONString(values[0])
+	}
+
+	out := []interface{}{}
+	for _, value := range values {
+		value = decodeJSONString(value)
+		if a, ok := value.([]interface{}); ok {
+			out = append(out, a...)
+		} else if value != nil {
+			out = append(out, value)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// decodeJSONString decodes a string holding a JSON object or array, as some
+// providers encode structured claims, returning other values as they are
+func decodeJSONString(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	trimmed := strings.TrimSpace(str)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return value
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return value
+	}
+	return decoded
 }
 
 // coerceClaim tries to convert the value into the destination interface type.
@@ -170,6 +393,12 @@ func coerceClaim(value, dst interface{}) error {
 		*d = strSlice
 	case *bool:
 		*d = cast.ToBool(value)
+	case *int64:
+		i, err := cast.ToInt64E(value)
+		if err != nil {
+			return fmt.Errorf("could not convert value to int64: %v", err)
+		}
+		*d = i
 	default:
 		return fmt.Errorf("unknown type for destination: %T", dst)
 	}
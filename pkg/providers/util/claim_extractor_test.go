@@ -3,6 +3,7 @@ package util
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -57,6 +58,14 @@ const (
         }
       ]
     }`
+	nestedGroupsPayload = `{
+      "cognito:groups": ["cognitoGroup"],
+      "realm_access": {"roles": ["realmRole1", "realmRole2"]},
+      "resource_access": {"my.client": {"roles": ["clientRole"]}},
+      "encoded_access": "{\"roles\": [\"encodedRole\"]}",
+      "encoded_groups": "[\"encodedGroup1\", \"encodedGroup2\"]",
+      "memberships": [{"name": "team1"}, {"name": "team2"}]
+    }`
 )
 
 var _ = Describe("Claim Extractor Suite", func() {
@@ -239,6 +248,62 @@ var _ = Describe("Claim Extractor Suite", func() {
 				expectedValue: []interface{}{"fqdnGroup1", "fqdnGroup2"},
 				expectedError: nil,
 			}),
+			Entry("retrieves a claim named with a colon", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "cognito:groups",
+				expectExists:  true,
+				expectedValue: []interface{}{"cognitoGroup"},
+			}),
+			Entry("retrieves a nested claim from a path with a root", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "$.realm_access.roles",
+				expectExists:  true,
+				expectedValue: []interface{}{"realmRole1", "realmRole2"},
+			}),
+			Entry("retrieves a nested claim with a bracketed key", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "resource_access['my.client'].roles",
+				expectExists:  true,
+				expectedValue: []interface{}{"clientRole"},
+			}),
+			Entry("retrieves a nested claim from a JSON encoded claim", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "encoded_access.roles",
+				expectExists:  true,
+				expectedValue: []interface{}{"encodedRole"},
+			}),
+			Entry("decodes a JSON encoded array claim", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "encoded_groups",
+				expectExists:  true,
+				expectedValue: []interface{}{"encodedGroup1", "encodedGroup2"},
+			}),
+			Entry("retrieves the values matched by a wildcard", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "memberships[*].name",
+				expectExists:  true,
+				expectedValue: []interface{}{"team1", "team2"},
+			}),
+			Entry("when a nested claim is not found", getClaimTableInput{
+				testClaimExtractorOpts: testClaimExtractorOpts{
+					idTokenPayload: nestedGroupsPayload,
+				},
+				claim:         "realm_access.missing",
+				expectExists:  false,
+				expectedValue: nil,
+			}),
 		)
 	})
 
@@ -292,6 +357,83 @@ var _ = Describe("Claim Extractor Suite", func() {
 		Expect(value).To(BeNil())
 	})
 
+	type mergedClaimTableInput struct {
+		preferProfile bool
+		claim         string
+		expectedValue interface{}
+		expectExists  bool
+	}
+
+	DescribeTable("GetClaim with merged profile claims",
+		func(in mergedClaimTableInput) {
+			server := httptest.NewServer(http.HandlerFunc(requiresAuthProfileHandler))
+			defer server.Close()
+			profileURL, err := url.Parse(server.URL + profilePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			claimExtractor, err := NewMergingClaimExtractor(context.Background(), createJWTFromPayload(basicIDTokenPayload), profileURL, newAuthorizedHeader(), in.preferProfile)
+			Expect(err).ToNot(HaveOccurred())
+
+			value, exists, err := claimExtractor.GetClaim(in.claim)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(Equal(in.expectExists))
+			if in.expectedValue != nil {
+				Expect(value).To(Equal(in.expectedValue))
+			} else {
+				Expect(value).To(BeNil())
+			}
+		},
+		Entry("prefers the ID Token claim", mergedClaimTableInput{
+			claim:         "email",
+			expectExists:  true,
+			expectedValue: "idTokenEmail",
+		}),
+		Entry("prefers the profile claim", mergedClaimTableInput{
+			preferProfile: true,
+			claim:         "email",
+			expectExists:  true,
+			expectedValue: "profileEmail",
+		}),
+		Entry("combines the groups, ID Token groups first", mergedClaimTableInput{
+			claim:         "groups",
+			expectExists:  true,
+			expectedValue: []interface{}{"idTokenGroup1", "idTokenGroup2", "profileGroup1", "profileGroup2"},
+		}),
+		Entry("combines the groups, profile groups first", mergedClaimTableInput{
+			preferProfile: true,
+			claim:         "groups",
+			expectExists:  true,
+			expectedValue: []interface{}{"profileGroup1", "profileGroup2", "idTokenGroup1", "idTokenGroup2"},
+		}),
+		Entry("uses a claim only in the ID Token", mergedClaimTableInput{
+			preferProfile: true,
+			claim:         "https://groups.test",
+			expectExists:  true,
+			expectedValue: []interface{}{"fqdnGroup1", "fqdnGroup2"},
+		}),
+		Entry("with a claim in neither", mergedClaimTableInput{
+			claim:         "missing",
+			expectExists:  false,
+			expectedValue: nil,
+		}),
+	)
+
+	It("GetClaim with merged profile claims deduplicates list values", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Write([]byte(`{"groups": ["idTokenGroup2", "profileGroup1"]}`))
+		}))
+		defer server.Close()
+		profileURL, err := url.Parse(server.URL + profilePath)
+		Expect(err).ToNot(HaveOccurred())
+
+		claimExtractor, err := NewMergingClaimExtractor(context.Background(), createJWTFromPayload(basicIDTokenPayload), profileURL, newAuthorizedHeader(), false)
+		Expect(err).ToNot(HaveOccurred())
+
+		value, _, err := claimExtractor.GetClaim("groups")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]interface{}{"idTokenGroup1", "idTokenGroup2", "profileGroup1"}))
+	})
+
 	type getClaimIntoTableInput struct {
 		testClaimExtractorOpts
 		into          interface{}
@@ -471,6 +613,16 @@ var _ = Describe("Claim Extractor Suite", func() {
 			dst:         boolPointer(false),
 			expectedDst: boolPointer(true),
 		}),
+		Entry("coerces a number to an int64", coerceClaimTableInput{
+			value:       json.Number("1311280970"),
+			dst:         int64Pointer(0),
+			expectedDst: int64Pointer(1311280970),
+		}),
+		Entry("coerces a float to an int64", coerceClaimTableInput{
+			value:       float64(1311280970),
+			dst:         int64Pointer(0),
+			expectedDst: int64Pointer(1311280970),
+		}),
 		Entry("coerces a map to a string", coerceClaimTableInput{
 			value: map[string]interface{}{
 				"foo": []interface{}{"bar", "baz"},
@@ -543,6 +695,10 @@ func boolPointer(in bool) *bool {
 	return &in
 }
 
+func int64Pointer(in int64) *int64 {
+	return &in
+}
+
 // ******************************
 // Different profile URL handlers
 // ******************************
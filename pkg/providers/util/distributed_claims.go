@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// ClaimSource is a source of aggregated or distributed claims, as advertised
+// in the `_claim_sources` claim of an ID Token.
+// See https://openid.net/specs/openid-connect-core-1_0.html#AggregatedDistributedClaims
+type ClaimSource struct {
+	// Name is the key of the source in `_claim_sources`
+	Name string
+	// Endpoint is the URL distributed claims are fetched from
+	Endpoint string
+	// AccessToken is used to fetch the Endpoint instead of the access token
+	// of the user, when the source has one
+	AccessToken string
+	// JWT holds the aggregated claims of the source
+	JWT string
+}
+
+// GetClaimSource returns the source of a claim that the ID Token names in its
+// `_claim_names` claim. ok is false if the claim is not aggregated or
+// distributed.
+func GetClaimSource(extractor ClaimExtractor, claim string) (source *ClaimSource, ok bool, err error) {
+	names, _, err := extractor.GetClaim("_claim_names")
+	if err != nil {
+		return nil, false, err
+	}
+	sources, _, err := extractor.GetClaim("_claim_sources")
+	if err != nil {
+		return nil, false, err
+	}
+	return claimSourceFrom(names, sources, claim)
+}
+
+// claimSourceFrom looks the claim up in the `_claim_names` and
+// `_claim_sources` claim values
+func claimSourceFrom(names, sources interface{}, claim string) (*ClaimSource, bool, error) {
+	namesMap, _ := names.(map[string]interface{})
+	name, ok := namesMap[claim].(string)
+	if !ok {
+		return nil, false, nil
+	}
+
+	sourcesMap, _ := sources.(map[string]interface{})
+	sourceMap, ok := sourcesMap[name].(map[string]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("claim source %q for the %q claim is missing", name, claim)
+	}
+
+	source := &ClaimSource{Name: name}
+	source.Endpoint, _ = sourceMap["endpoint"].(string)
+	source.AccessToken, _ = sourceMap["access_token"].(string)
+	source.JWT, _ = sourceMap["JWT"].(string)
+	return source, true, nil
+}
+
+// getDistributedClaim returns the value of a claim the ID Token left out and
+// marked as aggregated or distributed instead.
+// The claims of each source are loaded once per claimExtractor.
+func (c *claimExtractor) getDistributedClaim(claim string) (interface{}, error) {
+	source, ok, err := claimSourceFrom(
+		getClaimFrom("_claim_names", c.tokenClaims),
+		getClaimFrom("_claim_sources", c.tokenClaims),
+		claim,
+	)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	claims, ok := c.sourceClaims[source.Name]
+	if !ok {
+		claims, err = c.loadSourceClaims(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch claims from claim source %q: %v", source.Name, err)
+		}
+		if c.sourceClaims == nil {
+			c.sourceClaims = make(map[string]*simplejson.Json)
+		}
+		c.sourceClaims[source.Name] = claims
+	}
+
+	return getClaimFrom(claim, claims), nil
+}
+
+// loadSourceClaims reads the aggregated claims of the source, or fetches its
+// distributed claims from the endpoint.
+// The claims are not verified any further: aggregated claims are part of the
+// verified ID Token, and the endpoint of distributed claims is advertised by
+// it.
+func (c *claimExtractor) loadSourceClaims(source *ClaimSource) (*simplejson.Json, error) {
+	if source.JWT != "" {
+		return parseSourceClaims([]byte(source.JWT))
+	}
+	if source.Endpoint == "" {
+		return nil, errors.New("claim source has neither an endpoint nor a JWT")
+	}
+
+	headers := http.Header(c.requestHeaders)
+	if source.AccessToken != "" {
+		headers = http.Header{}
+		headers.Set("Authorization", "Bearer "+source.AccessToken)
+	}
+	if headers == nil {
+		// Without an access token the request would be unauthorized, so the
+		// claims are left missing, as they are for the profile URL
+		return simplejson.New(), nil
+	}
+
+	result := requests.New(source.Endpoint).
+		WithContext(c.ctx).
+		WithHeaders(headers).
+		Do()
+	if result.Error() != nil {
+		return nil, fmt.Errorf("error making request to claim source endpoint: %v", result.Error())
+	}
+	if result.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from claim source endpoint", result.StatusCode())
+	}
+
+	return parseSourceClaims(result.Body())
+}
+
+// parseSourceClaims parses the claims of a source, which are either a JSON
+// object or a JWT
+func parseSourceClaims(body []byte) (*simplejson.Json, error) {
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("{")) {
+		payload, err := parseJWT(string(body))
+		if err != nil {
+			return nil, err
+		}
+		body = payload
+	}
+
+	claims, err := simplejson.NewJson(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %v", err)
+	}
+	return claims, nil
+}
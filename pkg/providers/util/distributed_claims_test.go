@@ -0,0 +1,186 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	sourceAccessToken    = "source_access_token"
+	distributedClaimJSON = `{"groups": ["distributedGroup1", "distributedGroup2"]}`
+)
+
+var _ = Describe("Distributed Claims Suite", func() {
+	var server *httptest.Server
+	var requests int32
+
+	BeforeEach(func() {
+		requests = 0
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			switch req.Header.Get("Authorization") {
+			case "Bearer " + authorizedAccessToken:
+			case "Bearer " + sourceAccessToken:
+			default:
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			switch req.URL.Path {
+			case "/claims":
+				rw.Write([]byte(distributedClaimJSON))
+			case "/jwt":
+				rw.Header().Set("Content-Type", "application/jwt")
+				rw.Write([]byte(createJWTFromPayload(distributedClaimJSON)))
+			default:
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	distributedPayload := func(source string) string {
+		return fmt.Sprintf(`{"email": "idTokenEmail", "_claim_names": {"groups": "src1"}, "_claim_sources": {"src1": %s}}`, source)
+	}
+
+	type distributedClaimTableInput struct {
+		source           string
+		headers          http.Header
+		disabled         bool
+		expectedValue    interface{}
+		expectedError    string
+		expectedRequests int32
+	}
+
+	DescribeTable("GetClaim with distributed claims",
+		func(in distributedClaimTableInput) {
+			source := strings.ReplaceAll(in.source, "{server}", server.URL)
+
+			var opts []ClaimExtractorOption
+			if !in.disabled {
+				opts = append(opts, WithDistributedClaims())
+			}
+			claimExtractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload(source)), nil, in.headers, opts...)
+			Expect(err).ToNot(HaveOccurred())
+
+			value, exists, err := claimExtractor.GetClaim("groups")
+			if in.expectedError != "" {
+				Expect(err).To(MatchError(in.expectedError))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			if in.expectedValue != nil {
+				Expect(exists).To(BeTrue())
+				Expect(value).To(Equal(in.expectedValue))
+			} else {
+				Expect(exists).To(BeFalse())
+				Expect(value).To(BeNil())
+			}
+			Expect(requests).To(Equal(in.expectedRequests))
+		},
+		Entry("fetches the claims from the endpoint", distributedClaimTableInput{
+			source:           `{"endpoint": "{server}/claims"}`,
+			headers:          newAuthorizedHeader(),
+			expectedValue:    []interface{}{"distributedGroup1", "distributedGroup2"},
+			expectedRequests: 1,
+		}),
+		Entry("fetches the claims from an endpoint responding with a JWT", distributedClaimTableInput{
+			source:           `{"endpoint": "{server}/jwt"}`,
+			headers:          newAuthorizedHeader(),
+			expectedValue:    []interface{}{"distributedGroup1", "distributedGroup2"},
+			expectedRequests: 1,
+		}),
+		Entry("fetches the claims with the access token of the source", distributedClaimTableInput{
+			source:           `{"endpoint": "{server}/claims", "access_token": "` + sourceAccessToken + `"}`,
+			expectedValue:    []interface{}{"distributedGroup1", "distributedGroup2"},
+			expectedRequests: 1,
+		}),
+		Entry("reads aggregated claims", distributedClaimTableInput{
+			source:           `{"JWT": "` + createJWTFromPayload(distributedClaimJSON) + `"}`,
+			headers:          newAuthorizedHeader(),
+			expectedValue:    []interface{}{"distributedGroup1", "distributedGroup2"},
+			expectedRequests: 0,
+		}),
+		Entry("does not fetch the claims without an access token", distributedClaimTableInput{
+			source:           `{"endpoint": "{server}/claims"}`,
+			expectedValue:    nil,
+			expectedRequests: 0,
+		}),
+		Entry("does not fetch the claims when disabled", distributedClaimTableInput{
+			source:           `{"endpoint": "{server}/claims"}`,
+			headers:          newAuthorizedHeader(),
+			disabled:         true,
+			expectedValue:    nil,
+			expectedRequests: 0,
+		}),
+		Entry("with a missing claim source", distributedClaimTableInput{
+			source:        `null`,
+			headers:       newAuthorizedHeader(),
+			expectedError: "claim source \"src1\" for the \"groups\" claim is missing",
+		}),
+		Entry("with a failing endpoint", distributedClaimTableInput{
+			source:        `{"endpoint": "{server}/missing"}`,
+			headers:       newAuthorizedHeader(),
+			expectedError: "failed to fetch claims from claim source \"src1\": unexpected status 404 from claim source endpoint",
+		}),
+	)
+
+	It("GetClaim should only call the claim source endpoint once", func() {
+		payload := fmt.Sprintf(`{"_claim_names": {"groups": "src1", "roles": "src1"}, "_claim_sources": {"src1": {"endpoint": "%s/claims"}}}`, server.URL)
+		claimExtractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(payload), nil, newAuthorizedHeader(), WithDistributedClaims())
+		Expect(err).ToNot(HaveOccurred())
+
+		_, exists, err := claimExtractor.GetClaim("groups")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+
+		_, exists, err = claimExtractor.GetClaim("roles")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeFalse())
+		Expect(requests).To(BeEquivalentTo(1))
+	})
+
+	It("GetClaim with merged profile claims combines distributed claims", func() {
+		profileServer := httptest.NewServer(http.HandlerFunc(requiresAuthProfileHandler))
+		defer profileServer.Close()
+
+		payload := distributedPayload(fmt.Sprintf(`{"endpoint": "%s/claims"}`, server.URL))
+		profileURL, err := url.Parse(profileServer.URL + profilePath)
+		Expect(err).ToNot(HaveOccurred())
+		claimExtractor, err := NewMergingClaimExtractor(context.Background(), createJWTFromPayload(payload), profileURL, newAuthorizedHeader(), false, WithDistributedClaims())
+		Expect(err).ToNot(HaveOccurred())
+
+		value, _, err := claimExtractor.GetClaim("groups")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]interface{}{"distributedGroup1", "distributedGroup2", "profileGroup1", "profileGroup2"}))
+	})
+
+	It("GetClaimSource returns the source of a distributed claim", func() {
+		claimExtractor, err := NewClaimExtractor(context.Background(), createJWTFromPayload(distributedPayload(`{"endpoint": "https://example.com/claims", "access_token": "token"}`)), nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		source, ok, err := GetClaimSource(claimExtractor, "groups")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(source).To(Equal(&ClaimSource{
+			Name:        "src1",
+			Endpoint:    "https://example.com/claims",
+			AccessToken: "token",
+		}))
+
+		_, ok, err = GetClaimSource(claimExtractor, "email")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
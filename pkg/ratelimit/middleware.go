@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/justinas/alice"
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	requestutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests/util"
+)
+
+// KeyFunc returns the key a request is rate limited by
+type KeyFunc func(req *http.Request) string
+
+// NewKeyFunc returns the KeyFunc of the rate limit key of the options:
+// ip, user or header:<name>.
+// Requests without a session or the header are limited by their client IP,
+// determined with the parser.
+func NewKeyFunc(key string, parser ipapi.RealClientIPParser) (KeyFunc, error) {
+	byIP := func(req *http.Request) string {
+		return "ip:" + ip.GetClientString(parser, req, false)
+	}
+
+	switch {
+	case key == "" || key == options.RateLimitKeyIP:
+		return byIP, nil
+	case key == options.RateLimitKeyUser:
+		return func(req *http.Request) string {
+			scope := middlewareapi.GetRequestScope(req)
+			if scope == nil || scope.Session == nil || scope.Session.User == "" {
+				return byIP(req)
+			}
+			return "user:" + scope.Session.User
+		}, nil
+	case strings.HasPrefix(key, options.RateLimitKeyHeader):
+		header := http.CanonicalHeaderKey(strings.TrimPrefix(key, options.RateLimitKeyHeader))
+		if header == "" {
+			return nil, fmt.Errorf("rate limit key %q is missing the header name", key)
+		}
+		return func(req *http.Request) string {
+			value := req.Header.Get(header)
+			if value == "" {
+				return byIP(req)
+			}
+			return "header:" + value
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q", key)
+	}
+}
+
+// NewMiddleware returns a middleware passing the requests allowed by the
+// limiter, and rendering a 429 error page with a Retry-After header for the
+// others.
+// Requests are passed when the limiter fails, so that an unavailable store
+// does not take the proxy down with it.
+func NewMiddleware(limiter Limiter, key KeyFunc, writer pagewriter.Writer) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			allowed, retryAfter, err := limiter.Allow(req.Context(), key(req))
+			if err != nil {
+				logger.Errorf("Error checking the rate limit: %v", err)
+				next.ServeHTTP(rw, req)
+				return
+			}
+			if allowed {
+				next.ServeHTTP(rw, req)
+				return
+			}
+
+			// Retry-After is in whole seconds, rounded up so that the retry
+			// is allowed
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			opts := pagewriter.ErrorPageOpts{
+				Status:         http.StatusTooManyRequests,
+				AppError:       "rate limit exceeded",
+				Messages:       []interface{}{"Too many requests, please try again later."},
+				Host:           requestutil.GetRequestHost(req),
+				AcceptLanguage: req.Header.Get("Accept-Language"),
+			}
+			if scope := middlewareapi.GetRequestScope(req); scope != nil {
+				opts.RequestID = scope.RequestID
+			}
+			writer.WriteErrorPage(rw, opts)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	ipapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/ip"
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeLimiter allows the keys in allowed, failing when err is set
+type fakeLimiter struct {
+	allowed map[string]bool
+	keys    []string
+	err     error
+}
+
+func (l *fakeLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	l.keys = append(l.keys, key)
+	return l.allowed[key], 1500 * time.Millisecond, l.err
+}
+
+var _ = Describe("Rate Limit Middleware", func() {
+	writer := &pagewriter.WriterFuncs{
+		ErrorPageFunc: func(rw http.ResponseWriter, opts pagewriter.ErrorPageOpts) {
+			rw.WriteHeader(opts.Status)
+			rw.Write([]byte("Error Page"))
+		},
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Write([]byte("upstream"))
+	})
+
+	serve := func(limiter Limiter) *httptest.ResponseRecorder {
+		key, err := NewKeyFunc(options.RateLimitKeyIP, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:43670"
+		rw := httptest.NewRecorder()
+		NewMiddleware(limiter, key, writer)(next).ServeHTTP(rw, req)
+		return rw
+	}
+
+	It("passes allowed requests", func() {
+		rw := serve(&fakeLimiter{allowed: map[string]bool{"ip:10.0.0.1": true}})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(Equal("upstream"))
+	})
+
+	It("rejects limited requests with a Retry-After header", func() {
+		rw := serve(&fakeLimiter{})
+		Expect(rw.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rw.Header().Get("Retry-After")).To(Equal("2"))
+		Expect(rw.Body.String()).To(Equal("Error Page"))
+	})
+
+	It("passes requests when the limiter fails", func() {
+		rw := serve(&fakeLimiter{err: errors.New("unavailable")})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+	})
+
+	type keyTableInput struct {
+		key         string
+		header      http.Header
+		session     *sessionsapi.SessionState
+		realIP      bool
+		expectedKey string
+	}
+
+	DescribeTable("the keys of requests",
+		func(in keyTableInput) {
+			var parser ipapi.RealClientIPParser
+			if in.realIP {
+				var err error
+				parser, err = ip.GetRealClientIPParser("X-Real-IP", 0)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			key, err := NewKeyFunc(in.key, parser)
+			Expect(err).ToNot(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:43670"
+			for name, values := range in.header {
+				req.Header[name] = values
+			}
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{Session: in.session})
+
+			Expect(key(req)).To(Equal(in.expectedKey))
+		},
+		Entry("by IP", keyTableInput{
+			key:         options.RateLimitKeyIP,
+			expectedKey: "ip:10.0.0.1",
+		}),
+		Entry("by the real client IP", keyTableInput{
+			key:         options.RateLimitKeyIP,
+			header:      http.Header{"X-Real-Ip": []string{"192.168.0.1"}},
+			realIP:      true,
+			expectedKey: "ip:192.168.0.1",
+		}),
+		Entry("by user", keyTableInput{
+			key:         options.RateLimitKeyUser,
+			session:     &sessionsapi.SessionState{User: "alice"},
+			expectedKey: "user:alice",
+		}),
+		Entry("by IP without a session", keyTableInput{
+			key:         options.RateLimitKeyUser,
+			expectedKey: "ip:10.0.0.1",
+		}),
+		Entry("by header", keyTableInput{
+			key:         "header:x-api-key",
+			header:      http.Header{"X-Api-Key": []string{"abc"}},
+			expectedKey: "header:abc",
+		}),
+		Entry("by IP without the header", keyTableInput{
+			key:         "header:x-api-key",
+			expectedKey: "ip:10.0.0.1",
+		}),
+	)
+
+	It("rejects unknown keys", func() {
+		_, err := NewKeyFunc("cookie", nil)
+		Expect(err).To(MatchError("unknown rate limit key \"cookie\""))
+
+		_, err = NewKeyFunc("header:", nil)
+		Expect(err).To(MatchError("rate limit key \"header:\" is missing the header name"))
+	})
+})
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+)
+
+// Limiter limits the rate of requests with a token bucket per key. Each
+// bucket holds up to the number of requests allowed per period, and refills
+// continuously at that rate.
+type Limiter interface {
+	// Allow takes a token from the bucket of the key. When the bucket is
+	// empty the request is not allowed, and retryAfter is how long until
+	// the bucket holds a token again.
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Rate is the number of requests allowed per period
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// perSecond returns the number of tokens added to the buckets per second
+func (r Rate) perSecond() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+// NewLimiter creates the Limiter of the rate in the store of the options.
+// The buckets of limiters sharing a redis server are kept apart by name.
+func NewLimiter(opts options.RateLimit, redisOpts options.RedisStoreOptions, name string, rate Rate) (Limiter, error) {
+	switch opts.Store {
+	case "", options.RateLimitStoreMemory:
+		return NewMemoryLimiter(rate), nil
+	case options.RateLimitStoreRedis:
+		client, err := redis.NewRedisClient(redisOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the redis client of the rate limits: %v", err)
+		}
+		return NewRedisLimiter(client, name, rate), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", opts.Store)
+	}
+}
+
+// memoryLimiter keeps the buckets in memory, so each replica of the proxy
+// limits the requests it receives on its own
+type memoryLimiter struct {
+	rate  Rate
+	clock clock.Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the token bucket of a key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewMemoryLimiter creates a Limiter keeping its buckets in memory
+func NewMemoryLimiter(rate Rate) Limiter {
+	return &memoryLimiter{
+		rate:    rate,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow implements the Limiter interface
+func (l *memoryLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Requests), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, secondsToDuration((1 - b.tokens) / l.rate.perSecond()), nil
+}
+
+// refill returns the tokens in the bucket once it has been refilled for the
+// time since it was last updated
+func (l *memoryLimiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.rate.Requests), b.tokens+elapsed*l.rate.perSecond())
+}
+
+// sweep removes the buckets that have refilled, which are the same as new
+// buckets, once per period so that the buckets of past clients do not
+// accumulate
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Period {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.rate.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
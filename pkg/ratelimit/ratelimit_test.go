@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiters", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	// limiterTests verifies a limiter allowing 3 requests per minute, with a
+	// function moving its clock forward
+	limiterTests := func(newLimiter func() (Limiter, func(time.Duration))) {
+		var limiter Limiter
+		var advance func(time.Duration)
+
+		BeforeEach(func() {
+			limiter, advance = newLimiter()
+		})
+
+		allow := func(key string) (bool, time.Duration) {
+			allowed, retryAfter, err := limiter.Allow(context.Background(), key)
+			Expect(err).ToNot(HaveOccurred())
+			return allowed, retryAfter
+		}
+
+		It("allows the requests of a period", func() {
+			for i := 0; i < 3; i++ {
+				allowed, _ := allow("client")
+				Expect(allowed).To(BeTrue())
+			}
+
+			allowed, retryAfter := allow("client")
+			Expect(allowed).To(BeFalse())
+			Expect(retryAfter).To(BeNumerically("~", 20*time.Second, time.Millisecond))
+		})
+
+		It("refills the bucket over time", func() {
+			for i := 0; i < 3; i++ {
+				allowed, _ := allow("client")
+				Expect(allowed).To(BeTrue())
+			}
+
+			advance(10 * time.Second)
+			allowed, retryAfter := allow("client")
+			Expect(allowed).To(BeFalse())
+			Expect(retryAfter).To(BeNumerically("~", 10*time.Second, time.Millisecond))
+
+			advance(10 * time.Second)
+			allowed, _ = allow("client")
+			Expect(allowed).To(BeTrue())
+		})
+
+		It("does not refill the bucket over its capacity", func() {
+			advance(time.Hour)
+			for i := 0; i < 3; i++ {
+				allowed, _ := allow("client")
+				Expect(allowed).To(BeTrue())
+			}
+			allowed, _ := allow("client")
+			Expect(allowed).To(BeFalse())
+		})
+
+		It("limits each key separately", func() {
+			for i := 0; i < 3; i++ {
+				allowed, _ := allow("client")
+				Expect(allowed).To(BeTrue())
+			}
+			allowed, _ := allow("other")
+			Expect(allowed).To(BeTrue())
+		})
+	}
+
+	rate := Rate{Requests: 3, Period: time.Minute}
+
+	Context("in memory", func() {
+		limiterTests(func() (Limiter, func(time.Duration)) {
+			limiter := NewMemoryLimiter(rate).(*memoryLimiter)
+			limiter.clock.Set(now)
+			return limiter, func(d time.Duration) {
+				Expect(limiter.clock.Add(d)).To(Succeed())
+			}
+		})
+
+		It("removes the buckets that have refilled", func() {
+			limiter := NewMemoryLimiter(rate).(*memoryLimiter)
+			limiter.clock.Set(now)
+
+			_, _, err := limiter.Allow(context.Background(), "client")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(limiter.buckets).To(HaveKey("client"))
+
+			Expect(limiter.clock.Add(time.Minute)).To(Succeed())
+			_, _, err = limiter.Allow(context.Background(), "other")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(limiter.buckets).ToNot(HaveKey("client"))
+			Expect(limiter.buckets).To(HaveKey("other"))
+		})
+	})
+
+	Context("in redis", func() {
+		var mr *miniredis.Miniredis
+
+		BeforeEach(func() {
+			var err error
+			mr, err = miniredis.Run()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(mr.Close)
+		})
+
+		limiterTests(func() (Limiter, func(time.Duration)) {
+			client, err := redis.NewRedisClient(options.RedisStoreOptions{ConnectionURL: "redis://" + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			limiter := NewRedisLimiter(client, "test", rate).(*redisLimiter)
+			limiter.clock.Set(now)
+			return limiter, func(d time.Duration) {
+				Expect(limiter.clock.Add(d)).To(Succeed())
+			}
+		})
+
+		It("expires the buckets once they would have refilled", func() {
+			client, err := redis.NewRedisClient(options.RedisStoreOptions{ConnectionURL: "redis://" + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			limiter := NewRedisLimiter(client, "test", rate)
+
+			_, _, err = limiter.Allow(context.Background(), "client")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mr.Exists("ratelimit:test:client")).To(BeTrue())
+			Expect(mr.TTL("ratelimit:test:client")).To(Equal(time.Minute))
+		})
+
+		It("returns an error when redis is unavailable", func() {
+			client, err := redis.NewRedisClient(options.RedisStoreOptions{ConnectionURL: "redis://" + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			limiter := NewRedisLimiter(client, "test", rate)
+			mr.Close()
+
+			_, _, err = limiter.Allow(context.Background(), "client")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// takeToken refills the bucket at KEYS[1] for the time since it was last
+// updated and takes a token from it, atomically so that the replicas of the
+// proxy share the bucket.
+// ARGV holds the capacity of the bucket, the tokens added per millisecond
+// and the current time in milliseconds. It returns whether a token was taken
+// and, if not, how many milliseconds until the bucket holds a token again.
+var takeToken = goredis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+  tokens = capacity
+  updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate))
+return {allowed, wait}
+`)
+
+// redisLimiter keeps the buckets in redis, so the replicas of the proxy
+// share the limits
+type redisLimiter struct {
+	client redis.Client
+	prefix string
+	rate   Rate
+	clock  clock.Clock
+}
+
+// NewRedisLimiter creates a Limiter keeping its buckets in redis, under keys
+// starting with the name
+func NewRedisLimiter(client redis.Client, name string, rate Rate) Limiter {
+	return &redisLimiter{
+		client: client,
+		prefix: fmt.Sprintf("ratelimit:%s:", name),
+		rate:   rate,
+	}
+}
+
+// Allow implements the Limiter interface
+func (l *redisLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	perMillisecond := l.rate.perSecond() / 1000
+	result, err := l.client.RunScript(ctx, takeToken, []string{l.prefix + key},
+		l.rate.Requests, perMillisecond, l.clock.Now().UnixMilli())
+	if err != nil {
+		return false, 0, fmt.Errorf("error taking a rate limit token: %v", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
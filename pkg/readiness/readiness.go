@@ -0,0 +1,117 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// checkTimeout is the maximum duration of each check
+	checkTimeout = 5 * time.Second
+
+	// StatusOK and StatusError are the statuses of the report and its checks
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Check verifies that a dependency of the proxy, such as the session store or
+// the discovery endpoint of a provider, is available
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+// Result is the readiness of the proxy, with the result of each of its checks
+type Result struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// CheckResult is the result of a single check
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Checker runs the readiness checks of the proxy
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker creates a Checker running the checks
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: checkTimeout,
+	}
+}
+
+// Check runs all the checks concurrently. The proxy is ready when all of
+// them succeed.
+func (c *Checker) Check(ctx context.Context) Result {
+	report := Result{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusError
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ServeHTTP renders the report of the checks in JSON, with a 503 status code
+// when the proxy is not ready
+func (c *Checker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	report := c.Check(req.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(report); err != nil {
+		logger.Errorf("Error encoding readiness report: %v", err)
+	}
+}
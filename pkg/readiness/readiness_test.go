@@ -0,0 +1,71 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Readiness Suite", func() {
+	succeeds := func(context.Context) error { return nil }
+	fails := func(context.Context) error { return errors.New("connection refused") }
+
+	serve := func(checker *Checker) (*httptest.ResponseRecorder, Result) {
+		rw := httptest.NewRecorder()
+		checker.ServeHTTP(rw, httptest.NewRequest("GET", "/oauth2/ready", nil))
+
+		var report Result
+		Expect(json.Unmarshal(rw.Body.Bytes(), &report)).To(Succeed())
+		return rw, report
+	}
+
+	It("reports ready when all checks succeed", func() {
+		rw, report := serve(NewChecker(
+			Check{Name: "session store", Run: succeeds},
+			Check{Name: `provider "default" discovery`, Run: succeeds},
+		))
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(report.Status).To(Equal(StatusOK))
+		Expect(report.Checks).To(HaveLen(2))
+		Expect(report.Checks["session store"].Status).To(Equal(StatusOK))
+		Expect(report.Checks[`provider "default" discovery`].Status).To(Equal(StatusOK))
+	})
+
+	It("reports the checks that failed", func() {
+		rw, report := serve(NewChecker(
+			Check{Name: "session store", Run: fails},
+			Check{Name: `provider "default" discovery`, Run: succeeds},
+		))
+
+		Expect(rw.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Status).To(Equal(StatusError))
+		Expect(report.Checks["session store"]).To(Equal(CheckResult{Status: StatusError, Error: "connection refused"}))
+		Expect(report.Checks[`provider "default" discovery`].Status).To(Equal(StatusOK))
+	})
+
+	It("fails checks that do not finish before the timeout", func() {
+		checker := NewChecker(Check{Name: "session store", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+		checker.timeout = 10 * time.Millisecond
+
+		report := checker.Check(context.Background())
+		Expect(report.Status).To(Equal(StatusError))
+		Expect(report.Checks["session store"].Error).To(Equal(context.DeadlineExceeded.Error()))
+	})
+
+	It("reports ready without checks", func() {
+		rw, report := serve(NewChecker())
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(report).To(Equal(Result{Status: StatusOK, Checks: map[string]CheckResult{}}))
+	})
+})
@@ -0,0 +1,77 @@
+package replay
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Cache remembers the IDs of single use values, such as signed OAuth states
+// and authorization codes, until they expire, so that each value is accepted
+// at most once.
+// The IDs are kept in the order they expire, so that only the expired IDs are
+// visited when they are forgotten.
+// IDs are only remembered by the instance of the proxy they are used on.
+type Cache struct {
+	mu     sync.Mutex
+	used   map[string]struct{}
+	expiry expiryQueue
+}
+
+// New creates an empty Cache
+func New() *Cache {
+	return &Cache{
+		used: make(map[string]struct{}),
+	}
+}
+
+// Use marks the ID as used until it expires, returning false if it was used
+// already
+func (c *Cache) Use(id string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.expiry) > 0 && !now.Before(c.expiry[0].expiresAt) {
+		delete(c.used, heap.Pop(&c.expiry).(entry).id)
+	}
+
+	if _, ok := c.used[id]; ok {
+		return false
+	}
+	c.used[id] = struct{}{}
+	heap.Push(&c.expiry, entry{id: id, expiresAt: expiresAt})
+	return true
+}
+
+// Len returns the number of IDs remembered
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.used)
+}
+
+// entry is a used ID and when it expires
+type entry struct {
+	id        string
+	expiresAt time.Time
+}
+
+// expiryQueue is a heap.Interface of the used IDs, which pops the ID that
+// expires first
+type expiryQueue []entry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x interface{}) {
+	*q = append(*q, x.(entry))
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
@@ -0,0 +1,13 @@
+package replay
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestReplaySuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Replay")
+}
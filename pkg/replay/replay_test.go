@@ -0,0 +1,41 @@
+package replay
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Now()
+	})
+
+	It("only allows each ID to be used once until it expires", func() {
+		cache := New()
+
+		Expect(cache.Use("first", now.Add(time.Minute), now)).To(BeTrue())
+		Expect(cache.Use("first", now.Add(time.Minute), now.Add(30*time.Second))).To(BeFalse())
+		Expect(cache.Use("second", now.Add(90*time.Second), now.Add(30*time.Second))).To(BeTrue())
+
+		Expect(cache.Use("first", now.Add(3*time.Minute), now.Add(time.Minute))).To(BeTrue())
+		Expect(cache.Len()).To(Equal(2))
+	})
+
+	It("forgets the IDs in the order they expire", func() {
+		cache := New()
+
+		Expect(cache.Use("late", now.Add(3*time.Minute), now)).To(BeTrue())
+		Expect(cache.Use("early", now.Add(time.Minute), now)).To(BeTrue())
+		Expect(cache.Use("middle", now.Add(2*time.Minute), now)).To(BeTrue())
+
+		Expect(cache.Use("other", now.Add(time.Hour), now.Add(90*time.Second))).To(BeTrue())
+		Expect(cache.Len()).To(Equal(3))
+		Expect(cache.Use("early", now.Add(time.Hour), now.Add(90*time.Second))).To(BeTrue())
+		Expect(cache.Use("middle", now.Add(time.Hour), now.Add(90*time.Second))).To(BeFalse())
+		Expect(cache.Use("late", now.Add(time.Hour), now.Add(90*time.Second))).To(BeFalse())
+	})
+})
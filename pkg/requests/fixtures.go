@@ -0,0 +1,376 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FixtureMode controls whether a FixtureTransport records live exchanges or
+// replays previously recorded ones.
+type FixtureMode string
+
+const (
+	// FixtureModeReplay serves responses from the fixture file without
+	// performing any network requests
+	FixtureModeReplay FixtureMode = "replay"
+
+	// FixtureModeRecord performs live requests and records the sanitized
+	// exchanges to the fixture file
+	FixtureModeRecord FixtureMode = "record"
+
+	// FixtureModeEnv is the environment variable used by UseFixtures to select
+	// the mode. Fixtures are replayed unless it is set to "record".
+	FixtureModeEnv = "OAUTH2_PROXY_FIXTURE_MODE"
+
+	// redacted replaces sensitive values in recorded exchanges
+	redacted = "REDACTED"
+)
+
+// defaultRedactedHeaders are headers whose values are never written to fixtures
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// defaultRedactedFields are query, form and JSON fields whose values are
+// never written to fixtures
+var defaultRedactedFields = []string{
+	"access_token",
+	"assertion",
+	"client_assertion",
+	"client_secret",
+	"code",
+	"code_verifier",
+	"id_token",
+	"password",
+	"refresh_token",
+}
+
+// FixtureOptions configures how exchanges are sanitized before they are
+// recorded and matched
+type FixtureOptions struct {
+	// RedactHeaders are the header names whose values are redacted.
+	// Defaults to credential and cookie headers.
+	RedactHeaders []string
+
+	// RedactFields are the URL query, form and JSON body fields whose values
+	// are redacted. Defaults to OAuth tokens, codes and client secrets.
+	RedactFields []string
+}
+
+// Exchange is a single recorded request and its response
+type Exchange struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the sanitized form of a request
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the sanitized form of a response
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// FixtureTransport is an http.RoundTripper that records sanitized exchanges
+// to a fixture file, or replays them in place of the network.
+//
+// Replayed requests are matched on their method, sanitized URL and sanitized
+// body. Each recorded exchange is replayed at most once, in recorded order,
+// so repeated identical requests may receive different responses.
+type FixtureTransport struct {
+	mode    FixtureMode
+	path    string
+	next    http.RoundTripper
+	headers map[string]bool
+	fields  map[string]bool
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	replayed  []bool
+}
+
+// NewFixtureTransport creates a FixtureTransport for the fixture file.
+// In replay mode the fixture file is loaded immediately. In record mode
+// requests are sent with next, or http.DefaultTransport if it is nil.
+func NewFixtureTransport(path string, mode FixtureMode, next http.RoundTripper, opts FixtureOptions) (*FixtureTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = defaultRedactedHeaders
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = defaultRedactedFields
+	}
+
+	t := &FixtureTransport{
+		mode:    mode,
+		path:    path,
+		next:    next,
+		headers: make(map[string]bool),
+		fields:  make(map[string]bool),
+	}
+	for _, header := range opts.RedactHeaders {
+		t.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range opts.RedactFields {
+		t.fields[field] = true
+	}
+
+	switch mode {
+	case FixtureModeRecord:
+	case FixtureModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture file: %v", err)
+		}
+		if err := json.Unmarshal(data, &t.exchanges); err != nil {
+			return nil, fmt.Errorf("error parsing fixture file %s: %v", path, err)
+		}
+		t.replayed = make([]bool, len(t.exchanges))
+	default:
+		return nil, fmt.Errorf("unknown fixture mode %q", mode)
+	}
+	return t, nil
+}
+
+// RoundTrip records or replays a single exchange
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %v", err)
+		}
+	}
+	recorded := t.sanitizeRequest(req, body)
+
+	if t.mode == FixtureModeReplay {
+		return t.replay(req, recorded)
+	}
+
+	live := req.Clone(req.Context())
+	live.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(live)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	t.mu.Lock()
+	t.exchanges = append(t.exchanges, Exchange{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     t.sanitizeHeader(resp.Header),
+			Body:       t.sanitizeBody(resp.Header.Get("Content-Type"), respBody),
+		},
+	})
+	t.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// Save writes the recorded exchanges to the fixture file.
+// It does nothing in replay mode.
+func (t *FixtureTransport) Save() error {
+	if t.mode != FixtureModeRecord {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(t.exchanges); err != nil {
+		return fmt.Errorf("error encoding fixtures: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return fmt.Errorf("error creating fixture directory: %v", err)
+	}
+	return os.WriteFile(t.path, data.Bytes(), 0o600)
+}
+
+// Unreplayed returns the recorded exchanges that have not been replayed yet.
+// Tests may use it to assert every expected request was made.
+func (t *FixtureTransport) Unreplayed() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var unreplayed []Exchange
+	for i, exchange := range t.exchanges {
+		if t.replayed != nil && !t.replayed[i] {
+			unreplayed = append(unreplayed, exchange)
+		}
+	}
+	return unreplayed
+}
+
+// UseFixtures replaces the transport of the DefaultHTTPClient with a
+// FixtureTransport for the fixture file, so that all requests made through
+// this package are recorded or replayed.
+// The mode is read from the OAUTH2_PROXY_FIXTURE_MODE environment variable.
+// The returned function saves any recording and restores the transport.
+func UseFixtures(path string) (func() error, error) {
+	mode := FixtureModeReplay
+	if FixtureMode(os.Getenv(FixtureModeEnv)) == FixtureModeRecord {
+		mode = FixtureModeRecord
+	}
+
+	original := DefaultHTTPClient.Transport
+	ua, wrapped := original.(*userAgentTransport)
+	next := original
+	if wrapped {
+		next = ua.next
+	}
+	transport, err := NewFixtureTransport(path, mode, next, FixtureOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if wrapped {
+		DefaultHTTPClient.Transport = &userAgentTransport{next: transport, userAgent: ua.userAgent}
+	} else {
+		DefaultHTTPClient.Transport = transport
+	}
+
+	return func() error {
+		DefaultHTTPClient.Transport = original
+		return transport.Save()
+	}, nil
+}
+
+func (t *FixtureTransport) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, exchange := range t.exchanges {
+		if t.replayed[i] ||
+			exchange.Request.Method != recorded.Method ||
+			exchange.Request.URL != recorded.URL ||
+			exchange.Request.Body != recorded.Body {
+			continue
+		}
+		t.replayed[i] = true
+
+		header := exchange.Response.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", exchange.Response.StatusCode, http.StatusText(exchange.Response.StatusCode)),
+			StatusCode:    exchange.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(exchange.Response.Body)),
+			ContentLength: int64(len(exchange.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded exchange for %s %s in %s", recorded.Method, recorded.URL, t.path)
+}
+
+func (t *FixtureTransport) sanitizeRequest(req *http.Request, body []byte) RecordedRequest {
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = t.sanitizeValues(u.Query()).Encode()
+
+	return RecordedRequest{
+		Method: req.Method,
+		URL:    u.String(),
+		Header: t.sanitizeHeader(req.Header),
+		Body:   t.sanitizeBody(req.Header.Get("Content-Type"), body),
+	}
+}
+
+func (t *FixtureTransport) sanitizeHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	sanitized := header.Clone()
+	for name := range sanitized {
+		if t.headers[name] {
+			sanitized[name] = []string{redacted}
+		}
+	}
+	return sanitized
+}
+
+func (t *FixtureTransport) sanitizeValues(values url.Values) url.Values {
+	for name := range values {
+		if t.fields[name] {
+			values[name] = []string{redacted}
+		}
+	}
+	return values
+}
+
+// sanitizeBody redacts fields in JSON and form encoded bodies.
+// Other bodies are recorded unchanged.
+func (t *FixtureTransport) sanitizeBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			return t.sanitizeValues(values).Encode()
+		}
+	case strings.Contains(contentType, "json"):
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			if sanitized, err := json.Marshal(t.sanitizeJSON(decoded)); err == nil {
+				return string(sanitized)
+			}
+		}
+	}
+	return string(body)
+}
+
+func (t *FixtureTransport) sanitizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if t.fields[key] {
+				v[key] = redacted
+			} else {
+				v[key] = t.sanitizeJSON(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = t.sanitizeJSON(v[i])
+		}
+	}
+	return value
+}
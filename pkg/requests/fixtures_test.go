@@ -0,0 +1,111 @@
+package requests
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fixtures suite", func() {
+	var fixture string
+
+	BeforeEach(func() {
+		fixture = filepath.Join(GinkgoT().TempDir(), "testdata", "fixture.json")
+	})
+
+	record := func() {
+		transport, err := NewFixtureTransport(fixture, FixtureModeRecord, nil, FixtureOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		client := &http.Client{Transport: transport}
+
+		req, err := http.NewRequest("POST", serverAddr+"/string/token?code=secret-code&state=abc",
+			strings.NewReader("client_id=proxy&client_secret=secret-value&grant_type=authorization_code"))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Basic c2VjcmV0")
+
+		resp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		resp.Body.Close()
+
+		Expect(transport.Save()).To(Succeed())
+	}
+
+	It("records sanitized exchanges", func() {
+		record()
+
+		data, err := os.ReadFile(fixture)
+		Expect(err).ToNot(HaveOccurred())
+		for _, secret := range []string{"secret-code", "secret-value", "c2VjcmV0"} {
+			Expect(string(data)).ToNot(ContainSubstring(secret))
+		}
+		Expect(string(data)).To(ContainSubstring("client_id=proxy"))
+		Expect(string(data)).To(ContainSubstring(`"Authorization": [`))
+		Expect(string(data)).To(ContainSubstring(`"OK"`))
+	})
+
+	It("replays recorded exchanges without the network", func() {
+		record()
+
+		transport, err := NewFixtureTransport(fixture, FixtureModeReplay, nil, FixtureOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		client := &http.Client{Transport: transport}
+		Expect(transport.Unreplayed()).To(HaveLen(1))
+
+		// Redacted values do not need to match the recording
+		req, err := http.NewRequest("POST", "http://"+server.Listener.Addr().String()+"/string/token?state=abc&code=other-code",
+			strings.NewReader("grant_type=authorization_code&client_id=proxy&client_secret=other-value"))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		resp.Body.Close()
+		Expect(transport.Unreplayed()).To(BeEmpty())
+
+		// Each exchange is only replayed once
+		_, err = client.Get(serverAddr + "/string/token")
+		Expect(err).To(MatchError(ContainSubstring("no recorded exchange for GET " + serverAddr + "/string/token")))
+	})
+
+	It("redacts JSON fields", func() {
+		transport, err := NewFixtureTransport(fixture, FixtureModeRecord, nil, FixtureOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		body := transport.sanitizeBody("application/json; charset=utf-8",
+			[]byte(`{"access_token":"at","nested":[{"refresh_token":"rt","email":"a@b.c"}]}`))
+		Expect(body).To(Equal(`{"access_token":"REDACTED","nested":[{"email":"a@b.c","refresh_token":"REDACTED"}]}`))
+	})
+
+	It("returns an error for a missing fixture in replay mode", func() {
+		_, err := NewFixtureTransport(fixture, FixtureModeReplay, nil, FixtureOptions{})
+		Expect(err).To(MatchError(HavePrefix("error reading fixture file: ")))
+	})
+
+	It("swaps the default client transport with UseFixtures", func() {
+		Expect(os.Setenv(FixtureModeEnv, string(FixtureModeRecord))).To(Succeed())
+		DeferCleanup(os.Unsetenv, FixtureModeEnv)
+
+		restore, err := UseFixtures(fixture)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(New(serverAddr + "/string/path").Do().Body()).To(Equal([]byte("OK")))
+		Expect(restore()).To(Succeed())
+
+		Expect(os.Unsetenv(FixtureModeEnv)).To(Succeed())
+		restore, err = UseFixtures(fixture)
+		Expect(err).ToNot(HaveOccurred())
+		result := New(serverAddr + "/string/path").Do()
+		Expect(result.Error()).ToNot(HaveOccurred())
+		Expect(result.Body()).To(Equal([]byte("OK")))
+		Expect(restore()).To(Succeed())
+
+		_, isFixture := DefaultHTTPClient.Transport.(*userAgentTransport).next.(*FixtureTransport)
+		Expect(isFixture).To(BeFalse())
+	})
+})
@@ -0,0 +1,220 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryBudgetMaxTokens is the number of retries a RetryPolicy can make in a
+// burst before its budget has to be earned back by new requests
+const retryBudgetMaxTokens = 10
+
+// RetryPolicy configures the retrying of requests made with the
+// DefaultHTTPClient that fail with a transient error, such as a 5xx or 429
+// response. It is attached to requests through their context with
+// WithRetryPolicy, so that each provider can use its own policy.
+type RetryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	budget     *retryBudget
+}
+
+// NewRetryPolicy creates a RetryPolicy retrying each request at most
+// maxRetries times. The delay before each retry starts at backoff and doubles
+// up to maxBackoff. Retries are limited across all requests using the policy
+// to the budget ratio of requests, so that a struggling server is not
+// overwhelmed by retries.
+func NewRetryPolicy(maxRetries int, backoff, maxBackoff time.Duration, budget float64) *RetryPolicy {
+	return &RetryPolicy{
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		budget: &retryBudget{
+			tokens: retryBudgetMaxTokens,
+			ratio:  budget,
+		},
+	}
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a copy of the context with the retry policy for
+// requests made with it
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+func retryPolicyFromContext(ctx context.Context) *RetryPolicy {
+	policy, _ := ctx.Value(retryPolicyKey{}).(*RetryPolicy)
+	return policy
+}
+
+// delay returns the delay before the given retry, with jitter so that
+// clients failing at the same time do not retry in lockstep
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	delay := p.backoff
+	for i := 0; i < retry && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// #nosec G404 -- jitter does not need a secure random source
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryBudget is a token bucket limiting retries to a ratio of requests.
+// Each request deposits the ratio and each retry withdraws a whole token.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetMaxTokens {
+		b.tokens = retryBudgetMaxTokens
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryTransport retries requests according to the RetryPolicy in their
+// context. Requests without a policy are passed through unchanged.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := retryPolicyFromContext(req.Context())
+	if policy == nil || policy.maxRetries <= 0 || !isReplayable(req) {
+		return t.next.RoundTrip(req)
+	}
+	policy.budget.deposit()
+
+	attemptReq := req
+	for retry := 0; ; retry++ {
+		resp, err := t.next.RoundTrip(attemptReq)
+		if retry >= policy.maxRetries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := policy.delay(retry)
+		if resp != nil {
+			// Honour the server's Retry-After, unless it asks for longer than
+			// we are prepared to wait
+			if wait, ok := parseRetryAfter(resp, time.Now()); ok {
+				if wait > policy.maxBackoff {
+					return resp, nil
+				}
+				if wait > delay {
+					delay = wait
+				}
+			}
+		}
+		if !policy.budget.withdraw() {
+			return resp, err
+		}
+		if resp != nil {
+			drainBody(resp)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		attemptReq, err = replayRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isReplayable returns whether the body of the request, if any, can be
+// sent again
+func isReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// isIdempotent returns whether the request can safely be sent more than once,
+// either because of its method or because it carries an idempotency key
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// shouldRetry returns whether the outcome of the request is a transient
+// failure that can be retried. Requests that are not idempotent, such as
+// redeeming a code or refresh token, are only retried when the server cannot
+// have processed them.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil || isThrottled(err) {
+			return false
+		}
+		return isIdempotent(req) || isDialError(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	default:
+		return false
+	}
+}
+
+// isDialError returns whether the error occurred while connecting, before
+// any of the request was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func replayRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// drainBody reads a little of the body of a response that is being discarded
+// so that its connection can be reused
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
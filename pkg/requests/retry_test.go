@@ -0,0 +1,204 @@
+package requests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry Suite", func() {
+	var retryServer *httptest.Server
+	var attempts atomic.Int32
+	var failures int32
+	var failureStatus int
+	var bodies []string
+
+	BeforeEach(func() {
+		attempts.Store(0)
+		failures = 0
+		failureStatus = http.StatusServiceUnavailable
+		bodies = nil
+
+		retryServer = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			bodies = append(bodies, string(body))
+			if attempts.Add(1) <= failures {
+				rw.WriteHeader(failureStatus)
+				return
+			}
+			rw.Write([]byte("OK"))
+		}))
+	})
+
+	AfterEach(func() {
+		retryServer.Close()
+	})
+
+	type retryTableInput struct {
+		method           string
+		body             string
+		header           http.Header
+		failures         int32
+		failureStatus    int
+		policy           *RetryPolicy
+		expectedAttempts int32
+		expectedStatus   int
+	}
+
+	DescribeTable("should retry transient failures",
+		func(in retryTableInput) {
+			failures = in.failures
+			if in.failureStatus != 0 {
+				failureStatus = in.failureStatus
+			}
+
+			ctx := context.Background()
+			if in.policy != nil {
+				ctx = WithRetryPolicy(ctx, in.policy)
+			}
+			b := New(retryServer.URL).WithContext(ctx).WithMethod(in.method).WithHeaders(in.header)
+			if in.body != "" {
+				b = b.WithBody(strings.NewReader(in.body))
+			}
+
+			result := b.Do()
+			Expect(result.Error()).ToNot(HaveOccurred())
+			Expect(result.StatusCode()).To(Equal(in.expectedStatus))
+			Expect(attempts.Load()).To(Equal(in.expectedAttempts))
+			for _, body := range bodies {
+				Expect(body).To(Equal(in.body))
+			}
+		},
+		Entry("without a policy", retryTableInput{
+			method:           http.MethodGet,
+			failures:         1,
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusServiceUnavailable,
+		}),
+		Entry("with a policy that does not retry", retryTableInput{
+			method:           http.MethodGet,
+			failures:         1,
+			policy:           NewRetryPolicy(0, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusServiceUnavailable,
+		}),
+		Entry("with a GET that succeeds after retrying", retryTableInput{
+			method:           http.MethodGet,
+			failures:         2,
+			policy:           NewRetryPolicy(3, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 3,
+			expectedStatus:   http.StatusOK,
+		}),
+		Entry("with a GET that exhausts its retries", retryTableInput{
+			method:           http.MethodGet,
+			failures:         5,
+			policy:           NewRetryPolicy(2, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 3,
+			expectedStatus:   http.StatusServiceUnavailable,
+		}),
+		Entry("with a POST that fails with a 503", retryTableInput{
+			method:           http.MethodPost,
+			body:             "code=1234",
+			failures:         1,
+			policy:           NewRetryPolicy(3, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusServiceUnavailable,
+		}),
+		Entry("with a POST that is rate limited", retryTableInput{
+			method:           http.MethodPost,
+			body:             "code=1234",
+			failures:         1,
+			failureStatus:    http.StatusTooManyRequests,
+			policy:           NewRetryPolicy(3, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 2,
+			expectedStatus:   http.StatusOK,
+		}),
+		Entry("with a POST with an idempotency key", retryTableInput{
+			method:           http.MethodPost,
+			body:             "code=1234",
+			header:           http.Header{"Idempotency-Key": []string{"abc"}},
+			failures:         1,
+			policy:           NewRetryPolicy(3, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 2,
+			expectedStatus:   http.StatusOK,
+		}),
+		Entry("with a client error", retryTableInput{
+			method:           http.MethodGet,
+			failures:         1,
+			failureStatus:    http.StatusBadRequest,
+			policy:           NewRetryPolicy(3, time.Millisecond, time.Millisecond, 1),
+			expectedAttempts: 1,
+			expectedStatus:   http.StatusBadRequest,
+		}),
+	)
+
+	It("should limit retries to the budget", func() {
+		failures = 100
+		policy := NewRetryPolicy(1, time.Millisecond, time.Millisecond, 0.5)
+		ctx := WithRetryPolicy(context.Background(), policy)
+
+		// The initial burst of retries is allowed, each spending half a token
+		// more than the request earns
+		for i := 0; i < 2*retryBudgetMaxTokens-1; i++ {
+			New(retryServer.URL).WithContext(ctx).Do()
+		}
+		Expect(attempts.Load()).To(Equal(int32(2 * (2*retryBudgetMaxTokens - 1))))
+
+		// After which each retry has to be earned by two requests
+		attempts.Store(0)
+		for i := 0; i < 4; i++ {
+			New(retryServer.URL).WithContext(ctx).Do()
+		}
+		Expect(attempts.Load()).To(Equal(int32(6)))
+	})
+
+	It("should stop retrying when the context is done", func() {
+		failures = 100
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		ctx = WithRetryPolicy(ctx, NewRetryPolicy(10, time.Hour, time.Hour, 1))
+
+		result := New(retryServer.URL).WithContext(ctx).Do()
+		Expect(result.Error()).To(MatchError(ContainSubstring(context.DeadlineExceeded.Error())))
+		Expect(attempts.Load()).To(Equal(int32(1)))
+	})
+
+	It("should retry a POST that could not connect", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := listener.Addr().String()
+		Expect(listener.Close()).To(Succeed())
+
+		var dials atomic.Int32
+		transport := &retryTransport{next: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dials.Add(1)
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		}}
+
+		req, err := http.NewRequestWithContext(
+			WithRetryPolicy(context.Background(), NewRetryPolicy(2, time.Millisecond, time.Millisecond, 1)),
+			http.MethodPost, "http://"+addr, strings.NewReader("code=1234"))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = transport.RoundTrip(req)
+		Expect(err).To(HaveOccurred())
+		Expect(dials.Load()).To(Equal(int32(3)))
+	})
+
+	It("should cap the backoff", func() {
+		policy := NewRetryPolicy(10, 10*time.Millisecond, 50*time.Millisecond, 1)
+		Expect(policy.delay(0)).To(BeNumerically("~", 7500*time.Microsecond, 2500*time.Microsecond))
+		Expect(policy.delay(1)).To(BeNumerically("~", 15*time.Millisecond, 5*time.Millisecond))
+		Expect(policy.delay(8)).To(BeNumerically("~", 37500*time.Microsecond, 12500*time.Microsecond))
+	})
+})
@@ -0,0 +1,266 @@
+package requests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// throttleMinBackoff is how long requests to a server are held back after
+	// it asks to slow down without saying for how long. It doubles for each
+	// further request to slow down, up to throttleMaxBackoff.
+	throttleMinBackoff = 5 * time.Second
+
+	// throttleMaxBackoff caps how long requests to a server are held back,
+	// including when its Retry-After header asks for longer
+	throttleMaxBackoff = 5 * time.Minute
+
+	// throttleMaxErrorBody is how much of an error response is read to look
+	// for a slow_down error
+	throttleMaxErrorBody = 64 * 1024
+)
+
+// DefaultThrottle is the Throttle shared by the whole process, so that all
+// requests to a server that has asked to slow down are held back
+var DefaultThrottle = NewThrottle(prometheus.DefaultRegisterer)
+
+// ThrottledError is returned for requests that were not sent because the
+// server asked for requests to be held back
+type ThrottledError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("requests to %s are throttled for another %s", e.Host, e.RetryAfter.Round(time.Second))
+}
+
+// Throttle tracks servers that have asked for requests to be held back,
+// with a `Retry-After` header on a 429 or 503 response or an OAuth
+// `slow_down` error. It is attached to requests through their context with
+// WithThrottle. Requests to a server that is being backed off from fail with
+// a ThrottledError without being sent.
+type Throttle struct {
+	clock   clock.Clock
+	metrics *throttleMetrics
+
+	mu    sync.Mutex
+	hosts map[string]*hostThrottle
+}
+
+// hostThrottle is the backoff state of a single server
+type hostThrottle struct {
+	until   time.Time
+	backoff time.Duration
+}
+
+// NewThrottle creates a Throttle recording its metrics to the registerer
+func NewThrottle(registerer prometheus.Registerer) *Throttle {
+	return &Throttle{
+		metrics: newThrottleMetrics(registerer),
+		hosts:   make(map[string]*hostThrottle),
+	}
+}
+
+type throttleKey struct{}
+
+// throttleScope is the throttle of a context, and whether any request made
+// with the context has been held back by it
+type throttleScope struct {
+	throttle *Throttle
+	heldBack atomic.Bool
+}
+
+// WithThrottle returns a copy of the context with the throttle for requests
+// made with it
+func WithThrottle(ctx context.Context, throttle *Throttle) context.Context {
+	return context.WithValue(ctx, throttleKey{}, &throttleScope{throttle: throttle})
+}
+
+// WasThrottled returns whether a request made with the context, or a context
+// derived from it, was held back by the throttle given to WithThrottle
+func WasThrottled(ctx context.Context) bool {
+	scope, ok := ctx.Value(throttleKey{}).(*throttleScope)
+	return ok && scope.heldBack.Load()
+}
+
+// check returns a ThrottledError if requests to the host are held back
+func (t *Throttle) check(host string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.hosts[host]
+	if !ok {
+		return nil
+	}
+	if wait := h.until.Sub(t.clock.Now()); wait > 0 {
+		t.metrics.rejected.WithLabelValues(host).Inc()
+		return &ThrottledError{Host: host, RetryAfter: wait}
+	}
+	return nil
+}
+
+// observe updates the backoff state of the host from the response
+func (t *Throttle) observe(host string, resp *http.Response) {
+	retryAfter, hasRetryAfter := parseRetryAfter(resp, t.clock.Now())
+
+	var reason string
+	switch {
+	case hasRetryAfter:
+		reason = "retry_after"
+	case isSlowDown(resp):
+		reason = "slow_down"
+	case resp.StatusCode == http.StatusTooManyRequests:
+		reason = "rate_limited"
+	default:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.hosts, host)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostThrottle{}
+		t.hosts[host] = h
+	}
+
+	wait := retryAfter
+	if !hasRetryAfter {
+		// Back off for longer each time the server asks
+		h.backoff *= 2
+		if h.backoff < throttleMinBackoff {
+			h.backoff = throttleMinBackoff
+		}
+		wait = h.backoff
+	}
+	if wait > throttleMaxBackoff {
+		wait = throttleMaxBackoff
+	}
+	h.until = t.clock.Now().Add(wait)
+
+	t.metrics.throttled.WithLabelValues(host, reason).Inc()
+	logger.Errorf("Server %s asked to slow down (%s), holding back requests for %s", host, reason, wait)
+}
+
+// parseRetryAfter reads the Retry-After header of a 429 or 503 response,
+// given either in seconds or as an HTTP date
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isSlowDown returns whether the response is an OAuth `slow_down` error.
+// The body is read and replaced so that it can still be read by the caller.
+func isSlowDown(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, throttleMaxErrorBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+
+	var oauthErr struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error == "slow_down"
+}
+
+// throttleTransport holds back requests according to the Throttle in their
+// context. Requests without a throttle are passed through unchanged.
+type throttleTransport struct {
+	next http.RoundTripper
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope, ok := req.Context().Value(throttleKey{}).(*throttleScope)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	if err := scope.throttle.check(host); err != nil {
+		scope.heldBack.Store(true)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		scope.throttle.observe(host, resp)
+	}
+	return resp, err
+}
+
+// isThrottled returns whether the request was held back by a Throttle
+func isThrottled(err error) bool {
+	var throttledErr *ThrottledError
+	return errors.As(err, &throttledErr)
+}
+
+// throttleMetrics are the prometheus metrics recorded by a Throttle
+type throttleMetrics struct {
+	throttled *prometheus.CounterVec
+	rejected  *prometheus.CounterVec
+}
+
+func newThrottleMetrics(registerer prometheus.Registerer) *throttleMetrics {
+	return &throttleMetrics{
+		throttled: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_provider_throttled_total",
+				Help: "Total number of times a provider server asked for requests to be held back, by host and reason.",
+			},
+			[]string{"host", "reason"},
+		)).(*prometheus.CounterVec),
+		rejected: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_provider_throttled_requests_total",
+				Help: "Total number of requests to a provider server held back because it asked to slow down, by host.",
+			},
+			[]string{"host"},
+		)).(*prometheus.CounterVec),
+	}
+}
@@ -0,0 +1,136 @@
+package requests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Throttle Suite", func() {
+	var throttleServer *httptest.Server
+	var host string
+	var requests int
+	var respond func(rw http.ResponseWriter)
+	var throttle *Throttle
+	var ctx context.Context
+
+	BeforeEach(func() {
+		requests = 0
+		respond = func(rw http.ResponseWriter) {
+			rw.Write([]byte("OK"))
+		}
+		throttleServer = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			requests++
+			respond(rw)
+		}))
+		u, err := url.Parse(throttleServer.URL)
+		Expect(err).ToNot(HaveOccurred())
+		host = u.Host
+
+		throttle = NewThrottle(prometheus.NewRegistry())
+		throttle.clock.Set(time.Now())
+		ctx = WithThrottle(context.Background(), throttle)
+	})
+
+	AfterEach(func() {
+		throttle.clock.Reset()
+		throttleServer.Close()
+	})
+
+	slowDown := func(rw http.ResponseWriter) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(`{"error": "slow_down"}`))
+	}
+
+	It("holds back requests for the Retry-After duration", func() {
+		respond = func(rw http.ResponseWriter) {
+			rw.Header().Set("Retry-After", "120")
+			rw.WriteHeader(http.StatusTooManyRequests)
+		}
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().StatusCode()).To(Equal(http.StatusTooManyRequests))
+
+		respond = func(rw http.ResponseWriter) {
+			rw.Write([]byte("OK"))
+		}
+		result := New(throttleServer.URL).WithContext(ctx).Do()
+		Expect(result.Error()).To(MatchError(ContainSubstring("requests to " + host + " are throttled for another 2m0s")))
+		Expect(requests).To(Equal(1))
+		Expect(testutil.ToFloat64(throttle.metrics.throttled.WithLabelValues(host, "retry_after"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(throttle.metrics.rejected.WithLabelValues(host))).To(Equal(1.0))
+
+		// Requests without the throttle are not held back
+		Expect(New(throttleServer.URL).Do().StatusCode()).To(Equal(http.StatusOK))
+
+		Expect(throttle.clock.Add(2 * time.Minute)).To(Succeed())
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().StatusCode()).To(Equal(http.StatusOK))
+	})
+
+	It("reads a Retry-After date", func() {
+		respond = func(rw http.ResponseWriter) {
+			rw.Header().Set("Retry-After", throttle.clock.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		New(throttleServer.URL).WithContext(ctx).Do()
+
+		Expect(WasThrottled(ctx)).To(BeFalse())
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().Error()).To(MatchError(ContainSubstring("are throttled")))
+		Expect(WasThrottled(ctx)).To(BeTrue())
+		Expect(throttle.clock.Add(time.Minute)).To(Succeed())
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().Error()).ToNot(HaveOccurred())
+	})
+
+	It("backs off for longer each time the server asks to slow down", func() {
+		respond = slowDown
+		result := New(throttleServer.URL).WithContext(ctx).Do()
+		Expect(result.StatusCode()).To(Equal(http.StatusBadRequest))
+		Expect(string(result.Body())).To(Equal(`{"error": "slow_down"}`))
+		Expect(testutil.ToFloat64(throttle.metrics.throttled.WithLabelValues(host, "slow_down"))).To(Equal(1.0))
+
+		Expect(throttle.clock.Add(throttleMinBackoff)).To(Succeed())
+		New(throttleServer.URL).WithContext(ctx).Do()
+		Expect(requests).To(Equal(2))
+
+		// The second backoff is twice as long
+		Expect(throttle.clock.Add(throttleMinBackoff)).To(Succeed())
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().Error()).To(HaveOccurred())
+		Expect(throttle.clock.Add(throttleMinBackoff)).To(Succeed())
+
+		// A successful response resets the backoff
+		respond = func(rw http.ResponseWriter) {
+			rw.Write([]byte("OK"))
+		}
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().StatusCode()).To(Equal(http.StatusOK))
+		Expect(throttle.hosts).To(BeEmpty())
+	})
+
+	It("does not hold back requests after other errors", func() {
+		respond = func(rw http.ResponseWriter) {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error": "invalid_grant"}`))
+		}
+		New(throttleServer.URL).WithContext(ctx).Do()
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().Error()).ToNot(HaveOccurred())
+		Expect(requests).To(Equal(2))
+	})
+
+	It("is not retried when Retry-After is longer than the maximum backoff", func() {
+		respond = func(rw http.ResponseWriter) {
+			rw.Header().Set("Retry-After", "120")
+			rw.WriteHeader(http.StatusTooManyRequests)
+		}
+		ctx = WithRetryPolicy(ctx, NewRetryPolicy(3, time.Millisecond, time.Second, 1))
+
+		// The Retry-After is longer than the retry policy is prepared to wait
+		Expect(New(throttleServer.URL).WithContext(ctx).Do().StatusCode()).To(Equal(http.StatusTooManyRequests))
+		Expect(requests).To(Equal(1))
+	})
+})
@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sigv4"
+)
+
+// awsSecretsManagerStore reads the current version of AWS Secrets Manager
+// secrets. Credentials are read from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+type awsSecretsManagerStore struct {
+	client      *http.Client
+	endpoint    string
+	region      string
+	credentials sigv4.Credentials
+}
+
+// awsSecretValue is the response of GetSecretValue. Binary secrets are base64
+// encoded by the API.
+type awsSecretValue struct {
+	SecretString *string `json:"SecretString"`
+	SecretBinary []byte  `json:"SecretBinary"`
+}
+
+func newAWSSecretsManagerStoreFromEnv() (store, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		return nil, errors.New("aws region is not set: AWS_REGION is empty")
+	}
+	credentials, err := sigv4.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &awsSecretsManagerStore{
+		client:      http.DefaultClient,
+		endpoint:    fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region),
+		region:      region,
+		credentials: credentials,
+	}, nil
+}
+
+func (a *awsSecretsManagerStore) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": ref.Path})
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.Sign(req, body, a.credentials, a.region, "secretsmanager", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("unexpected status code %d from aws secrets manager: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var secret awsSecretValue
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, 0, fmt.Errorf("error decoding aws secret: %v", err)
+	}
+	value := secret.SecretBinary
+	if secret.SecretString != nil {
+		value = []byte(*secret.SecretString)
+	}
+	value, err = jsonField(value, ref.Key)
+	return value, 0, err
+}
+
+// jsonField returns the string field of the JSON object value, or the value
+// itself when no field is selected
+func jsonField(value []byte, field string) ([]byte, error) {
+	if field == "" {
+		return value, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %v", err)
+	}
+	fieldValue, ok := object[field]
+	if !ok {
+		return nil, fmt.Errorf("secret has no field %q", field)
+	}
+	s, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %q of the secret is not a string", field)
+	}
+	return []byte(s), nil
+}
@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	azureKeyVaultResource   = "https://vault.azure.net"
+	azureKeyVaultAPIVersion = "7.4"
+	azureIMDSTokenEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// azureKeyVaultStore reads Azure Key Vault secrets, the current version unless
+// the reference names a version. It authenticates as the service principal
+// set by AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, or else
+// with the managed identity of the machine.
+type azureKeyVaultStore struct {
+	client *http.Client
+	// vaultURL returns the URL of the vault with the name
+	vaultURL func(name string) string
+}
+
+type azureSecretBundle struct {
+	Value string `json:"value"`
+}
+
+func newAzureKeyVaultStoreFromEnv() (store, error) {
+	var tokens oauth2.TokenSource
+	if secret := os.Getenv("AZURE_CLIENT_SECRET"); secret != "" {
+		config := clientcredentials.Config{
+			ClientID:     os.Getenv("AZURE_CLIENT_ID"),
+			ClientSecret: secret,
+			TokenURL:     fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(os.Getenv("AZURE_TENANT_ID"))),
+			Scopes:       []string{azureKeyVaultResource + "/.default"},
+		}
+		tokens = config.TokenSource(context.Background())
+	} else {
+		tokens = oauth2.ReuseTokenSource(nil, &azureManagedIdentityTokens{
+			client:   &http.Client{Timeout: fetchTimeout},
+			endpoint: azureIMDSTokenEndpoint,
+			clientID: os.Getenv("AZURE_CLIENT_ID"),
+		})
+	}
+	return newAzureKeyVaultStore(oauth2.NewClient(context.Background(), tokens), func(name string) string {
+		return "https://" + name + ".vault.azure.net"
+	}), nil
+}
+
+func newAzureKeyVaultStore(client *http.Client, vaultURL func(string) string) *azureKeyVaultStore {
+	return &azureKeyVaultStore{client: client, vaultURL: vaultURL}
+}
+
+func (a *azureKeyVaultStore) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	parts := strings.Split(ref.Path, "/")
+	endpoint := a.vaultURL(parts[0]) + "/secrets/" + url.PathEscape(parts[1])
+	if len(parts) == 3 {
+		endpoint += "/" + url.PathEscape(parts[2])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?api-version="+azureKeyVaultAPIVersion, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("unexpected status code %d from azure key vault: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var bundle azureSecretBundle
+	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
+		return nil, 0, fmt.Errorf("error decoding azure secret: %v", err)
+	}
+	value, err := jsonField([]byte(bundle.Value), ref.Key)
+	return value, 0, err
+}
+
+// azureManagedIdentityTokens requests Key Vault tokens of the managed
+// identity of the machine from the instance metadata service
+type azureManagedIdentityTokens struct {
+	client   *http.Client
+	endpoint string
+	clientID string
+}
+
+type azureManagedIdentityToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresOn   string `json:"expires_on"`
+}
+
+// Token implements oauth2.TokenSource
+func (m *azureManagedIdentityTokens) Token() (*oauth2.Token, error) {
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {azureKeyVaultResource},
+	}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, m.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting azure managed identity token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status code %d from azure instance metadata service: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var token azureManagedIdentityToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("error decoding azure managed identity token: %v", err)
+	}
+	var expiresOn int64
+	if _, err := fmt.Sscan(token.ExpiresOn, &expiresOn); err != nil {
+		return nil, fmt.Errorf("invalid expiry of azure managed identity token %q", token.ExpiresOn)
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Unix(expiresOn, 0),
+	}, nil
+}
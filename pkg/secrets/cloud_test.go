@@ -0,0 +1,219 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sigv4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cloud secret managers", func() {
+	var server *httptest.Server
+	var handler http.HandlerFunc
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			handler(rw, req)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("awsSecretsManagerStore", func() {
+		var store *awsSecretsManagerStore
+
+		BeforeEach(func() {
+			store = &awsSecretsManagerStore{
+				client:      server.Client(),
+				endpoint:    server.URL + "/",
+				region:      "eu-west-1",
+				credentials: sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+			}
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Expect(req.Header.Get("X-Amz-Target")).To(Equal("secretsmanager.GetSecretValue"))
+				Expect(req.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=AKID/"))
+				Expect(req.Header.Get("Authorization")).To(ContainSubstring("/eu-west-1/secretsmanager/aws4_request"))
+
+				var in map[string]string
+				Expect(json.NewDecoder(req.Body).Decode(&in)).To(Succeed())
+				switch in["SecretId"] {
+				case "oauth2-proxy/cookie-secret":
+					rw.Write([]byte(`{"Name":"oauth2-proxy/cookie-secret","SecretString":"string-secret"}`))
+				case "oauth2-proxy/binary":
+					// YmluYXJ5LXNlY3JldA== is binary-secret
+					rw.Write([]byte(`{"Name":"oauth2-proxy/binary","SecretBinary":"YmluYXJ5LXNlY3JldA=="}`))
+				case "oauth2-proxy/json":
+					rw.Write([]byte(`{"Name":"oauth2-proxy/json","SecretString":"{\"client-secret\":\"json-secret\"}"}`))
+				default:
+					rw.WriteHeader(http.StatusBadRequest)
+					rw.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+				}
+			}
+		})
+
+		It("reads string and binary secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: AWSSecretsManagerScheme, Path: "oauth2-proxy/cookie-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("string-secret"))
+
+			value, _, err = store.fetch(context.Background(), Ref{Scheme: AWSSecretsManagerScheme, Path: "oauth2-proxy/binary"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("binary-secret"))
+		})
+
+		It("reads the fields of JSON secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: AWSSecretsManagerScheme, Path: "oauth2-proxy/json", Key: "client-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("json-secret"))
+
+			_, _, err = store.fetch(context.Background(), Ref{Scheme: AWSSecretsManagerScheme, Path: "oauth2-proxy/cookie-secret", Key: "client-secret"})
+			Expect(err).To(MatchError(HavePrefix("secret is not a JSON object")))
+		})
+
+		It("reports the errors of the API", func() {
+			_, _, err := store.fetch(context.Background(), Ref{Scheme: AWSSecretsManagerScheme, Path: "missing"})
+			Expect(err).To(MatchError(`unexpected status code 400 from aws secrets manager: {"__type":"ResourceNotFoundException"}`))
+		})
+	})
+
+	Context("gcpSecretManagerStore", func() {
+		var store *gcpSecretManagerStore
+
+		BeforeEach(func() {
+			store = &gcpSecretManagerStore{client: server.Client(), endpoint: server.URL + "/v1/"}
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/projects/my-project/secrets/cookie-secret/versions/latest:access":
+					// bGF0ZXN0LXNlY3JldA== is latest-secret
+					rw.Write([]byte(`{"name":"projects/1/secrets/cookie-secret/versions/2","payload":{"data":"bGF0ZXN0LXNlY3JldA=="}}`))
+				case "/v1/projects/my-project/secrets/cookie-secret/versions/1:access":
+					// Zmlyc3Qtc2VjcmV0 is first-secret
+					rw.Write([]byte(`{"name":"projects/1/secrets/cookie-secret/versions/1","payload":{"data":"Zmlyc3Qtc2VjcmV0"}}`))
+				default:
+					rw.WriteHeader(http.StatusNotFound)
+					rw.Write([]byte(`{"error":{"code":404}}`))
+				}
+			}
+		})
+
+		It("reads the latest version of secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: GCPSecretManagerScheme, Path: "projects/my-project/secrets/cookie-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("latest-secret"))
+		})
+
+		It("reads the versions of secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: GCPSecretManagerScheme, Path: "projects/my-project/secrets/cookie-secret/versions/1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("first-secret"))
+		})
+
+		It("reports the errors of the API", func() {
+			_, _, err := store.fetch(context.Background(), Ref{Scheme: GCPSecretManagerScheme, Path: "projects/my-project/secrets/missing"})
+			Expect(err).To(MatchError(`unexpected status code 404 from gcp secret manager: {"error":{"code":404}}`))
+		})
+	})
+
+	Context("azureKeyVaultStore", func() {
+		var store *azureKeyVaultStore
+
+		BeforeEach(func() {
+			store = newAzureKeyVaultStore(server.Client(), func(name string) string {
+				return server.URL + "/" + name
+			})
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Query().Get("api-version") != azureKeyVaultAPIVersion {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				switch req.URL.Path {
+				case "/my-vault/secrets/cookie-secret":
+					rw.Write([]byte(`{"value":"current-secret","id":"https://my-vault.vault.azure.net/secrets/cookie-secret/2"}`))
+				case "/my-vault/secrets/cookie-secret/1":
+					rw.Write([]byte(`{"value":"{\"key\":\"versioned-secret\"}","id":"https://my-vault.vault.azure.net/secrets/cookie-secret/1"}`))
+				default:
+					rw.WriteHeader(http.StatusNotFound)
+					rw.Write([]byte(`{"error":{"code":"SecretNotFound"}}`))
+				}
+			}
+		})
+
+		It("reads the current version of secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: AzureKeyVaultScheme, Path: "my-vault/cookie-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("current-secret"))
+		})
+
+		It("reads the fields of versions of secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: AzureKeyVaultScheme, Path: "my-vault/cookie-secret/1", Key: "key"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("versioned-secret"))
+		})
+
+		It("reports the errors of the API", func() {
+			_, _, err := store.fetch(context.Background(), Ref{Scheme: AzureKeyVaultScheme, Path: "my-vault/missing"})
+			Expect(err).To(MatchError(`unexpected status code 404 from azure key vault: {"error":{"code":"SecretNotFound"}}`))
+		})
+
+		It("requests tokens of the managed identity", func() {
+			handler = func(rw http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Metadata") != "true" || req.URL.Query().Get("resource") != azureKeyVaultResource ||
+					req.URL.Query().Get("client_id") != "client-id" {
+					rw.WriteHeader(http.StatusBadRequest)
+					body, _ := io.ReadAll(req.Body)
+					rw.Write(body)
+					return
+				}
+				rw.Write([]byte(`{"access_token":"managed-identity-token","expires_on":"1700000000","token_type":"Bearer"}`))
+			}
+			tokens := &azureManagedIdentityTokens{client: server.Client(), endpoint: server.URL, clientID: "client-id"}
+			token, err := tokens.Token()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("managed-identity-token"))
+			Expect(token.Expiry.Unix()).To(BeEquivalentTo(1700000000))
+
+			tokens.clientID = "other"
+			_, err = tokens.Token()
+			Expect(err).To(MatchError(HavePrefix("unexpected status code 400 from azure instance metadata service")))
+		})
+	})
+
+	DescribeTable("ParseRef of cloud secret managers",
+		func(ref string, expected Ref) {
+			parsed, err := ParseRef(ref)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(expected))
+			Expect(parsed.String()).To(Equal(ref))
+		},
+		Entry("with an AWS secret ARN", "aws-secretsmanager://arn:aws:secretsmanager:eu-west-1:123456789012:secret:oauth2-proxy",
+			Ref{Scheme: AWSSecretsManagerScheme, Path: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:oauth2-proxy"}),
+		Entry("with a field of an AWS secret", "aws-secretsmanager://oauth2-proxy#cookie-secret",
+			Ref{Scheme: AWSSecretsManagerScheme, Path: "oauth2-proxy", Key: "cookie-secret"}),
+		Entry("with a GCP secret", "gcp-secretmanager://projects/my-project/secrets/cookie-secret",
+			Ref{Scheme: GCPSecretManagerScheme, Path: "projects/my-project/secrets/cookie-secret"}),
+		Entry("with a GCP secret version", "gcp-secretmanager://projects/my-project/secrets/cookie-secret/versions/3",
+			Ref{Scheme: GCPSecretManagerScheme, Path: "projects/my-project/secrets/cookie-secret/versions/3"}),
+		Entry("with an Azure secret", "azure-keyvault://my-vault/cookie-secret",
+			Ref{Scheme: AzureKeyVaultScheme, Path: "my-vault/cookie-secret"}),
+	)
+
+	DescribeTable("ParseRef of invalid cloud secret manager references",
+		func(ref, expectedFormat string) {
+			_, err := ParseRef(ref)
+			Expect(err).To(MatchError(`invalid secret reference "` + ref + `": expected ` + expectedFormat))
+		},
+		Entry("with an AWS reference without a secret", "aws-secretsmanager://#key", "aws-secretsmanager://secret-id[#key]"),
+		Entry("with a GCP reference without a project", "gcp-secretmanager://secrets/cookie-secret",
+			"gcp-secretmanager://projects/project/secrets/secret[/versions/version][#key]"),
+		Entry("with an Azure reference without a secret", "azure-keyvault://my-vault",
+			"azure-keyvault://vault/secret[/version][#key]"),
+	)
+})
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com/v1/"
+	gcpSecretManagerScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// gcpSecretManagerStore reads Google Cloud Secret Manager secret versions,
+// the latest one unless the reference names a version, with the application
+// default credentials
+type gcpSecretManagerStore struct {
+	client   *http.Client
+	endpoint string
+}
+
+// gcpSecretVersion is the response of the access method of secret versions.
+// The payload is base64 encoded by the API.
+type gcpSecretVersion struct {
+	Payload struct {
+		Data []byte `json:"data"`
+	} `json:"payload"`
+}
+
+func newGCPSecretManagerStore() (store, error) {
+	client, err := google.DefaultClient(context.Background(), gcpSecretManagerScope)
+	if err != nil {
+		return nil, fmt.Errorf("error loading google application default credentials: %v", err)
+	}
+	return &gcpSecretManagerStore{client: client, endpoint: gcpSecretManagerEndpoint}, nil
+}
+
+func (g *gcpSecretManagerStore) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	name := ref.Path
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.endpoint+name+":access", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("unexpected status code %d from gcp secret manager: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var version gcpSecretVersion
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return nil, 0, fmt.Errorf("error decoding gcp secret version: %v", err)
+	}
+	value, err := jsonField(version.Payload.Data, ref.Key)
+	return value, 0, err
+}
@@ -0,0 +1,36 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/kubernetes"
+)
+
+// kubernetesStore reads the keys of Kubernetes Secrets
+type kubernetesStore struct {
+	client *kubernetes.Client
+}
+
+func newInClusterKubernetesStore() (store, error) {
+	client, err := kubernetes.NewInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	return &kubernetesStore{client: client}, nil
+}
+
+func (k *kubernetesStore) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	namespace, name, _ := strings.Cut(ref.Path, "/")
+	data, err := k.client.SecretData(ctx, namespace, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, ok := data[ref.Key]
+	if !ok {
+		return nil, 0, fmt.Errorf("secret %s has no key %q", ref.Path, ref.Key)
+	}
+	return value, 0, nil
+}
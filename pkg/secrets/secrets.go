@@ -0,0 +1,275 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+const (
+	// KubernetesScheme is the scheme of references to a key of a Kubernetes
+	// Secret, eg. kubernetes://namespace/secret/key
+	KubernetesScheme = "kubernetes"
+
+	// VaultScheme is the scheme of references to a field of a HashiCorp Vault
+	// secret, eg. vault://secret/data/oauth2-proxy#client-secret
+	VaultScheme = "vault"
+
+	// AWSSecretsManagerScheme is the scheme of references to an AWS Secrets
+	// Manager secret, eg. aws-secretsmanager://oauth2-proxy/client-secret
+	AWSSecretsManagerScheme = "aws-secretsmanager"
+
+	// GCPSecretManagerScheme is the scheme of references to a Google Cloud
+	// Secret Manager secret, eg.
+	// gcp-secretmanager://projects/my-project/secrets/client-secret
+	GCPSecretManagerScheme = "gcp-secretmanager"
+
+	// AzureKeyVaultScheme is the scheme of references to an Azure Key Vault
+	// secret, eg. azure-keyvault://my-vault/client-secret
+	AzureKeyVaultScheme = "azure-keyvault"
+
+	// defaultTTL is how long resolved values are cached before they are
+	// fetched again, unless the secret has a shorter lease
+	defaultTTL = 5 * time.Minute
+
+	// fetchTimeout bounds each request to a secret store
+	fetchTimeout = 10 * time.Second
+)
+
+const refFormats = "kubernetes://namespace/secret/key, vault://path#field, aws-secretsmanager://secret-id, " +
+	"gcp-secretmanager://projects/project/secrets/secret or azure-keyvault://vault/secret"
+
+// Ref is a parsed reference to a secret held in a secret store
+type Ref struct {
+	// Scheme is the secret store
+	Scheme string
+
+	// Path identifies the secret in the store: namespace/secret for
+	// Kubernetes, the API path of the secret, under /v1/, for Vault, the
+	// secret ID or ARN for AWS, the resource name of the secret, or of one of
+	// its versions, for GCP, and vault/secret, or vault/secret/version, for
+	// Azure
+	Path string
+
+	// Key is the key of the Secret data for Kubernetes and the field of the
+	// secret for Vault. For the cloud secret managers it is optional, and
+	// selects a field of a secret holding a JSON object.
+	Key string
+}
+
+// String returns the reference as it is configured
+func (r Ref) String() string {
+	switch {
+	case r.Scheme == KubernetesScheme:
+		return fmt.Sprintf("%s://%s/%s", r.Scheme, r.Path, r.Key)
+	case r.Key != "":
+		return fmt.Sprintf("%s://%s#%s", r.Scheme, r.Path, r.Key)
+	default:
+		return fmt.Sprintf("%s://%s", r.Scheme, r.Path)
+	}
+}
+
+// ParseRef parses a secret reference, eg. kubernetes://namespace/secret/key
+// or vault://path#field
+func ParseRef(ref string) (Ref, error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok {
+		return Ref{}, fmt.Errorf("invalid secret reference %q: expected %s", ref, refFormats)
+	}
+	path, key, _ := strings.Cut(rest, "#")
+
+	switch scheme {
+	case KubernetesScheme:
+		parts := strings.Split(rest, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: expected kubernetes://namespace/secret/key", ref)
+		}
+		return Ref{Scheme: scheme, Path: parts[0] + "/" + parts[1], Key: parts[2]}, nil
+	case VaultScheme:
+		path = strings.Trim(path, "/")
+		if path == "" || key == "" {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: expected vault://path#field", ref)
+		}
+		if _, err := url.Parse("/" + path); err != nil {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: %v", ref, err)
+		}
+		return Ref{Scheme: scheme, Path: path, Key: key}, nil
+	case AWSSecretsManagerScheme:
+		if path == "" {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: expected aws-secretsmanager://secret-id[#key]", ref)
+		}
+		return Ref{Scheme: scheme, Path: path, Key: key}, nil
+	case GCPSecretManagerScheme:
+		parts := strings.Split(path, "/")
+		if (len(parts) != 4 && len(parts) != 6) || parts[0] != "projects" || parts[2] != "secrets" ||
+			(len(parts) == 6 && parts[4] != "versions") || hasEmpty(parts) {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: expected gcp-secretmanager://projects/project/secrets/secret[/versions/version][#key]", ref)
+		}
+		return Ref{Scheme: scheme, Path: path, Key: key}, nil
+	case AzureKeyVaultScheme:
+		parts := strings.Split(path, "/")
+		if (len(parts) != 2 && len(parts) != 3) || hasEmpty(parts) {
+			return Ref{}, fmt.Errorf("invalid secret reference %q: expected azure-keyvault://vault/secret[/version][#key]", ref)
+		}
+		return Ref{Scheme: scheme, Path: path, Key: key}, nil
+	default:
+		return Ref{}, fmt.Errorf("invalid secret reference %q: unsupported scheme %q, expected %s", ref, scheme, refFormats)
+	}
+}
+
+func hasEmpty(parts []string) bool {
+	for _, part := range parts {
+		if part == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// store fetches secret values from a secret store, returning how long the
+// value may be cached for, or zero for the default
+type store interface {
+	fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error)
+}
+
+type cacheEntry struct {
+	value   []byte
+	expires time.Time
+
+	// previous is the value the secret had before it was last rotated
+	previous []byte
+}
+
+// Resolver resolves secret references, caching the values so that the secret
+// stores are not called each time a secret is used. Expired values are
+// fetched again, so that rotated secrets are picked up.
+type Resolver struct {
+	ttl    time.Duration
+	now    func() time.Time
+	stores map[string]func() (store, error)
+
+	mu     sync.Mutex
+	cache  map[string]cacheEntry
+	loaded map[string]store
+}
+
+// NewResolver creates a Resolver for the in-cluster Kubernetes API, the
+// Vault server set by VAULT_ADDR and VAULT_TOKEN, and the secret managers of
+// AWS, GCP and Azure with their standard credentials
+func NewResolver() *Resolver {
+	return newResolver(map[string]func() (store, error){
+		KubernetesScheme:        newInClusterKubernetesStore,
+		VaultScheme:             newVaultStoreFromEnv,
+		AWSSecretsManagerScheme: newAWSSecretsManagerStoreFromEnv,
+		GCPSecretManagerScheme:  newGCPSecretManagerStore,
+		AzureKeyVaultScheme:     newAzureKeyVaultStoreFromEnv,
+	})
+}
+
+func newResolver(stores map[string]func() (store, error)) *Resolver {
+	return &Resolver{
+		ttl:    defaultTTL,
+		now:    time.Now,
+		stores: stores,
+		cache:  make(map[string]cacheEntry),
+		loaded: make(map[string]store),
+	}
+}
+
+var defaultResolver = NewResolver()
+
+// Get resolves the secret reference with the default Resolver
+func Get(ctx context.Context, ref string) ([]byte, error) {
+	return defaultResolver.Get(ctx, ref)
+}
+
+// Previous returns the previous value of the secret reference with the
+// default Resolver
+func Previous(ref string) []byte {
+	return defaultResolver.Previous(ref)
+}
+
+// Get returns the value of the secret reference, from the cache while it is
+// fresh. When the value cannot be renewed once it expires, the previous value
+// is returned so that an outage of the secret store does not break requests.
+func (r *Resolver) Get(ctx context.Context, ref string) ([]byte, error) {
+	parsed, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	key := parsed.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, cached := r.cache[key]
+	if cached && r.now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, ttl, err := r.fetch(ctx, parsed)
+	if err != nil {
+		if cached {
+			logger.Errorf("Error renewing secret %s, using the cached value: %v", key, err)
+			return entry.value, nil
+		}
+		return nil, err
+	}
+	if ttl <= 0 || ttl > r.ttl {
+		ttl = r.ttl
+	}
+	previous := entry.previous
+	if cached && !bytes.Equal(entry.value, value) {
+		logger.Printf("Secret %s was rotated", key)
+		previous = entry.value
+	}
+	r.cache[key] = cacheEntry{value: value, expires: r.now().Add(ttl), previous: previous}
+	return value, nil
+}
+
+// Previous returns the value the secret reference had before it was last
+// rotated, while this process was running, so that values protected by the
+// previous secret can still be read. It is nil until the secret is rotated.
+func (r *Resolver) Previous(ref string) []byte {
+	parsed, err := ParseRef(ref)
+	if err != nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cache[parsed.String()].previous
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	s, ok := r.loaded[ref.Scheme]
+	if !ok {
+		newStore, ok := r.stores[ref.Scheme]
+		if !ok {
+			return nil, 0, fmt.Errorf("no secret store for %s references", ref.Scheme)
+		}
+		var err error
+		if s, err = newStore(); err != nil {
+			return nil, 0, fmt.Errorf("error loading secret %s: %v", ref, err)
+		}
+		r.loaded[ref.Scheme] = s
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	value, ttl, err := s.fetch(ctx, ref)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error loading secret %s: %v", ref, err)
+	}
+	if len(value) == 0 {
+		return nil, 0, errors.New("error loading secret " + ref.String() + ": the value is empty")
+	}
+	return value, ttl, nil
+}
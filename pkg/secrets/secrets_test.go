@@ -0,0 +1,266 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/kubernetes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeStore returns its value, or its error, counting the fetches
+type fakeStore struct {
+	value   string
+	ttl     time.Duration
+	err     error
+	fetches int
+}
+
+func (f *fakeStore) fetch(_ context.Context, _ Ref) ([]byte, time.Duration, error) {
+	f.fetches++
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	return []byte(f.value), f.ttl, nil
+}
+
+var _ = Describe("Secrets", func() {
+	type parseRefTableInput struct {
+		ref         string
+		expectedRef Ref
+		expectedErr string
+	}
+
+	DescribeTable("ParseRef",
+		func(in parseRefTableInput) {
+			ref, err := ParseRef(in.ref)
+			if in.expectedErr != "" {
+				Expect(err).To(MatchError(in.expectedErr))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ref).To(Equal(in.expectedRef))
+			Expect(ref.String()).To(Equal(in.ref))
+		},
+		Entry("with a Kubernetes Secret key", parseRefTableInput{
+			ref:         "kubernetes://apps/oauth2-proxy/client-secret",
+			expectedRef: Ref{Scheme: KubernetesScheme, Path: "apps/oauth2-proxy", Key: "client-secret"},
+		}),
+		Entry("with a Vault secret field", parseRefTableInput{
+			ref:         "vault://secret/data/oauth2-proxy#client-secret",
+			expectedRef: Ref{Scheme: VaultScheme, Path: "secret/data/oauth2-proxy", Key: "client-secret"},
+		}),
+		Entry("with a Kubernetes Secret without a key", parseRefTableInput{
+			ref:         "kubernetes://apps/oauth2-proxy",
+			expectedErr: "invalid secret reference \"kubernetes://apps/oauth2-proxy\": expected kubernetes://namespace/secret/key",
+		}),
+		Entry("with a Vault secret without a field", parseRefTableInput{
+			ref:         "vault://secret/data/oauth2-proxy",
+			expectedErr: "invalid secret reference \"vault://secret/data/oauth2-proxy\": expected vault://path#field",
+		}),
+		Entry("without a scheme", parseRefTableInput{
+			ref:         "apps/oauth2-proxy/client-secret",
+			expectedErr: "invalid secret reference \"apps/oauth2-proxy/client-secret\": expected " + refFormats,
+		}),
+	)
+
+	Context("Resolver", func() {
+		const ref = "vault://secret/data/oauth2-proxy#client-secret"
+		var resolver *Resolver
+		var fake *fakeStore
+		var now time.Time
+
+		BeforeEach(func() {
+			fake = &fakeStore{value: "secret-1"}
+			now = time.Unix(1700000000, 0)
+			resolver = newResolver(map[string]func() (store, error){
+				VaultScheme: func() (store, error) { return fake, nil },
+			})
+			resolver.now = func() time.Time { return now }
+		})
+
+		It("caches the value until it expires", func() {
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			fake.value = "secret-2"
+			now = now.Add(defaultTTL - time.Second)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			Expect(fake.fetches).To(Equal(1))
+
+			By("renewing the value once it expires")
+			now = now.Add(time.Second)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-2"))
+			Expect(fake.fetches).To(Equal(2))
+		})
+
+		It("renews the value at the end of a shorter lease", func() {
+			fake.ttl = time.Minute
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			fake.value = "secret-2"
+			now = now.Add(time.Minute)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-2"))
+		})
+
+		It("keeps the cached value when it cannot be renewed", func() {
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			fake.err = errors.New("vault is sealed")
+			now = now.Add(defaultTTL)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			Expect(fake.fetches).To(Equal(2))
+		})
+
+		It("keeps the previous value once the secret is rotated", func() {
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			Expect(resolver.Previous(ref)).To(BeNil())
+
+			now = now.Add(defaultTTL)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-1"))
+			Expect(resolver.Previous(ref)).To(BeNil())
+
+			fake.value = "secret-2"
+			now = now.Add(defaultTTL)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-2"))
+			Expect(resolver.Previous(ref)).To(BeEquivalentTo("secret-1"))
+
+			By("keeping it while the secret does not change")
+			now = now.Add(defaultTTL)
+			Expect(resolver.Get(context.Background(), ref)).To(BeEquivalentTo("secret-2"))
+			Expect(resolver.Previous(ref)).To(BeEquivalentTo("secret-1"))
+		})
+
+		It("notifies the watchers of rotated secrets", func() {
+			watcher := newWatcher(resolver, time.Millisecond, ref)
+			changes := make(chan struct{}, 1)
+			watcher.OnChange(func() { changes <- struct{}{} })
+
+			watcher.check(context.Background())
+			now = now.Add(defaultTTL)
+			watcher.check(context.Background())
+			Expect(changes).ToNot(Receive())
+
+			fake.value = "secret-2"
+			now = now.Add(defaultTTL)
+			watcher.check(context.Background())
+			Expect(changes).To(Receive())
+		})
+
+		It("returns the errors of the store when nothing is cached", func() {
+			fake.err = errors.New("vault is sealed")
+			_, err := resolver.Get(context.Background(), ref)
+			Expect(err).To(MatchError("error loading secret " + ref + ": vault is sealed"))
+		})
+
+		It("rejects empty values", func() {
+			fake.value = ""
+			_, err := resolver.Get(context.Background(), ref)
+			Expect(err).To(MatchError("error loading secret " + ref + ": the value is empty"))
+		})
+
+		It("returns an error for stores that are not configured", func() {
+			_, err := resolver.Get(context.Background(), "kubernetes://apps/oauth2-proxy/client-secret")
+			Expect(err).To(MatchError("no secret store for kubernetes references"))
+		})
+	})
+
+	Context("vaultStore", func() {
+		var server *httptest.Server
+		var vault *vaultStore
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("X-Vault-Token") != "vault-token" {
+					rw.WriteHeader(http.StatusForbidden)
+					rw.Write([]byte(`{"errors":["permission denied"]}`))
+					return
+				}
+				switch req.URL.Path {
+				case "/v1/secret/data/oauth2-proxy":
+					rw.Write([]byte(`{"lease_duration":0,"data":{"data":{"client-secret":"kv2-secret","port":8080},"metadata":{"version":3}}}`))
+				case "/v1/kv/oauth2-proxy":
+					rw.Write([]byte(`{"lease_duration":600,"data":{"client-secret":"kv1-secret"}}`))
+				default:
+					rw.WriteHeader(http.StatusNotFound)
+					rw.Write([]byte(`{"errors":[]}`))
+				}
+			}))
+			vault = newVaultStore(server.URL+"/", "vault-token", server.Client())
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reads the fields of KV version 2 secrets", func() {
+			value, ttl, err := vault.fetch(context.Background(), Ref{Scheme: VaultScheme, Path: "secret/data/oauth2-proxy", Key: "client-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("kv2-secret"))
+			Expect(ttl).To(BeZero())
+		})
+
+		It("reads the fields of KV version 1 secrets with their lease", func() {
+			value, ttl, err := vault.fetch(context.Background(), Ref{Scheme: VaultScheme, Path: "kv/oauth2-proxy", Key: "client-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("kv1-secret"))
+			Expect(ttl).To(Equal(10 * time.Minute))
+		})
+
+		It("rejects missing and non string fields", func() {
+			_, _, err := vault.fetch(context.Background(), Ref{Scheme: VaultScheme, Path: "secret/data/oauth2-proxy", Key: "missing"})
+			Expect(err).To(MatchError("vault secret secret/data/oauth2-proxy has no field \"missing\""))
+			_, _, err = vault.fetch(context.Background(), Ref{Scheme: VaultScheme, Path: "secret/data/oauth2-proxy", Key: "port"})
+			Expect(err).To(MatchError("field \"port\" of vault secret secret/data/oauth2-proxy is not a string"))
+		})
+
+		It("reports the errors of vault", func() {
+			vault.token = "other-token"
+			_, _, err := vault.fetch(context.Background(), Ref{Scheme: VaultScheme, Path: "secret/data/oauth2-proxy", Key: "client-secret"})
+			Expect(err).To(MatchError(`unexpected status code 403 from vault: {"errors":["permission denied"]}`))
+		})
+	})
+
+	Context("kubernetesStore", func() {
+		var server *httptest.Server
+		var store *kubernetesStore
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/api/v1/namespaces/apps/secrets/oauth2-proxy" {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+				Expect(req.Header.Get("Authorization")).To(Equal("Bearer service-account-token"))
+				// c2VjcmV0LXZhbHVl is secret-value
+				rw.Write([]byte(`{"kind":"Secret","data":{"client-secret":"c2VjcmV0LXZhbHVl"}}`))
+			}))
+
+			tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+			Expect(os.WriteFile(tokenFile, []byte("service-account-token"), 0600)).To(Succeed())
+			store = &kubernetesStore{client: kubernetes.NewClient(server.URL, tokenFile, server.Client())}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("reads the keys of Secrets", func() {
+			value, _, err := store.fetch(context.Background(), Ref{Scheme: KubernetesScheme, Path: "apps/oauth2-proxy", Key: "client-secret"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEquivalentTo("secret-value"))
+		})
+
+		It("rejects missing keys", func() {
+			_, _, err := store.fetch(context.Background(), Ref{Scheme: KubernetesScheme, Path: "apps/oauth2-proxy", Key: "missing"})
+			Expect(err).To(MatchError("secret apps/oauth2-proxy has no key \"missing\""))
+		})
+
+		It("reports the errors of the API server", func() {
+			_, _, err := store.fetch(context.Background(), Ref{Scheme: KubernetesScheme, Path: "apps/other", Key: "client-secret"})
+			Expect(err).To(MatchError(ContainSubstring("error getting secret apps/other: unexpected status code 404")))
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultStore reads the fields of secrets of HashiCorp Vault, such as those of
+// the KV secrets engine
+type vaultStore struct {
+	client  *http.Client
+	address string
+	token   string
+}
+
+// vaultSecret is a secret read from Vault. The data of KV version 2 secrets
+// is nested in a data field, alongside their metadata.
+type vaultSecret struct {
+	LeaseDuration int64                  `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+func newVaultStoreFromEnv() (store, error) {
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return nil, errors.New("vault address is not set: VAULT_ADDR is empty")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("vault token is not set: VAULT_TOKEN is empty")
+	}
+	return newVaultStore(address, token, http.DefaultClient), nil
+}
+
+func newVaultStore(address, token string, client *http.Client) *vaultStore {
+	return &vaultStore{
+		client:  client,
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+	}
+}
+
+func (v *vaultStore) fetch(ctx context.Context, ref Ref) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.address+"/v1/"+ref.Path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("unexpected status code %d from vault: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, 0, fmt.Errorf("error decoding vault secret: %v", err)
+	}
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	value, ok := data[ref.Key]
+	if !ok {
+		return nil, 0, fmt.Errorf("vault secret %s has no field %q", ref.Path, ref.Key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil, 0, fmt.Errorf("field %q of vault secret %s is not a string", ref.Key, ref.Path)
+	}
+	return []byte(s), time.Duration(secret.LeaseDuration) * time.Second, nil
+}
@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// Watcher renews secret references periodically and calls its change handler
+// whenever one of them is rotated, so that the configuration holding their
+// values can be reloaded.
+type Watcher struct {
+	resolver *Resolver
+	refs     []string
+	interval time.Duration
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	onChange func()
+}
+
+// NewWatcher creates a Watcher of the secret references, renewed with the
+// default Resolver
+func NewWatcher(refs ...string) *Watcher {
+	return newWatcher(defaultResolver, defaultTTL, refs...)
+}
+
+func newWatcher(resolver *Resolver, interval time.Duration, refs ...string) *Watcher {
+	return &Watcher{
+		resolver: resolver,
+		refs:     refs,
+		interval: interval,
+		values:   make(map[string][]byte),
+		onChange: func() {},
+	}
+}
+
+// OnChange sets the function called whenever a secret is rotated
+func (w *Watcher) OnChange(onChange func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onChange = onChange
+}
+
+// Start renews the secrets until the context is cancelled.
+// It implements the Server interface so that it runs alongside the servers.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.check(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check renews the secrets, calling the change handler when one of them
+// differs from the value it had when it was last checked
+func (w *Watcher) check(ctx context.Context) {
+	changed := false
+	for _, ref := range w.refs {
+		value, err := w.resolver.Get(ctx, ref)
+		if err != nil {
+			logger.Errorf("Error renewing secret: %v", err)
+			continue
+		}
+
+		w.mu.Lock()
+		last, seen := w.values[ref]
+		w.values[ref] = value
+		w.mu.Unlock()
+		if seen && !bytes.Equal(last, value) {
+			changed = true
+		}
+	}
+
+	if changed {
+		w.mu.Lock()
+		onChange := w.onChange
+		w.mu.Unlock()
+		onChange()
+	}
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const (
+	// header starts every archive, so that other files are not mistaken for
+	// archives
+	header = "oauth2-proxy session archive v1\n"
+
+	// maxRecordSize is the largest record read from an archive, so that a
+	// corrupt archive cannot exhaust the memory of the proxy
+	maxRecordSize = 16 << 20
+)
+
+var (
+	// ErrInvalidArchive is returned when reading a file that is not an
+	// archive, or one that was encrypted with another secret or modified
+	ErrInvalidArchive = errors.New("invalid session archive: it is corrupt or was encrypted with another secret")
+
+	// ErrTruncatedArchive is returned when an archive ends before all of its
+	// sessions were written to it
+	ErrTruncatedArchive = errors.New("invalid session archive: it is incomplete")
+)
+
+// An archive is its header followed by records, each of which is the length
+// of the record and a nonce followed by a session encrypted with AES-GCM. The
+// number of the record is authenticated with it, so that records cannot be
+// removed or reordered. The last record is empty, so that archives cannot be
+// truncated.
+
+// Writer writes sessions to an encrypted archive
+type Writer struct {
+	w      *bufio.Writer
+	aead   cipher.AEAD
+	record uint64
+}
+
+// NewWriter creates a Writer writing an archive encrypted with a key derived
+// from the secret to w. Close must be called once the sessions are written.
+func NewWriter(w io.Writer, secret string) (*Writer, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	writer := &Writer{w: bufio.NewWriter(w), aead: aead}
+	if _, err := writer.w.WriteString(header); err != nil {
+		return nil, fmt.Errorf("error writing session archive: %v", err)
+	}
+	return writer, nil
+}
+
+// Write writes a session to the archive
+func (w *Writer) Write(s sessions.ArchivedSession) error {
+	plaintext, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error encoding archived session: %v", err)
+	}
+	return w.writeRecord(plaintext)
+}
+
+// Close ends the archive, and flushes it to the underlying writer
+func (w *Writer) Close() error {
+	if err := w.writeRecord(nil); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("error writing session archive: %v", err)
+	}
+	return nil
+}
+
+func (w *Writer) writeRecord(plaintext []byte) error {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("error generating session archive nonce: %v", err)
+	}
+	record := w.aead.Seal(nonce, nonce, plaintext, recordNumber(w.record))
+	w.record++
+
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(record))) // #nosec G115 -- sessions are far smaller than 4GiB
+	if _, err := w.w.Write(length); err != nil {
+		return fmt.Errorf("error writing session archive: %v", err)
+	}
+	if _, err := w.w.Write(record); err != nil {
+		return fmt.Errorf("error writing session archive: %v", err)
+	}
+	return nil
+}
+
+// Reader reads the sessions of an encrypted archive
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	record uint64
+	done   bool
+}
+
+// NewReader creates a Reader reading an archive encrypted with a key derived
+// from the secret from r
+func NewReader(r io.Reader, secret string) (*Reader, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	reader := &Reader{r: bufio.NewReader(r), aead: aead}
+
+	start := make([]byte, len(header))
+	if _, err := io.ReadFull(reader.r, start); err != nil || string(start) != header {
+		return nil, ErrInvalidArchive
+	}
+	return reader, nil
+}
+
+// Read returns the next session of the archive, or io.EOF once all of them
+// have been read
+func (r *Reader) Read() (*sessions.ArchivedSession, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(r.r, length); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncatedArchive
+		}
+		return nil, fmt.Errorf("error reading session archive: %v", err)
+	}
+	size := binary.BigEndian.Uint32(length)
+	if size < uint32(r.aead.NonceSize()) || size > maxRecordSize {
+		return nil, ErrInvalidArchive
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(r.r, record); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncatedArchive
+		}
+		return nil, fmt.Errorf("error reading session archive: %v", err)
+	}
+
+	nonceSize := r.aead.NonceSize()
+	plaintext, err := r.aead.Open(nil, record[:nonceSize], record[nonceSize:], recordNumber(r.record))
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	r.record++
+
+	if len(plaintext) == 0 {
+		r.done = true
+		return nil, io.EOF
+	}
+	s := &sessions.ArchivedSession{}
+	if err := json.Unmarshal(plaintext, s); err != nil {
+		return nil, ErrInvalidArchive
+	}
+	return s, nil
+}
+
+// newAEAD creates the AES-GCM cipher of the archives of the secret
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key, err := encryption.DeriveKey(encryption.KeyDerivationHKDF, []byte(secret), encryption.SessionArchiveKeyLabel, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving session archive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session archive cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordNumber is the additional data authenticated with a record
+func recordNumber(record uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, record)
+}
@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session Archive", func() {
+	const secret = "0123456789abcdef"
+
+	archived := []sessions.ArchivedSession{
+		{ID: "_oauth2_proxy-1", Value: []byte("encrypted session"), Index: []byte(`{"id":"_oauth2_proxy-1"}`)},
+		{ID: "_oauth2_proxy-2", Value: []byte("another encrypted session")},
+	}
+
+	write := func(sessions ...sessions.ArchivedSession) []byte {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, secret)
+		Expect(err).ToNot(HaveOccurred())
+		for _, s := range sessions {
+			Expect(w.Write(s)).To(Succeed())
+		}
+		Expect(w.Close()).To(Succeed())
+		return buf.Bytes()
+	}
+
+	// readAll reads the sessions of the archive until it fails
+	readAll := func(archive []byte, secret string) ([]sessions.ArchivedSession, error) {
+		r, err := NewReader(bytes.NewReader(archive), secret)
+		if err != nil {
+			return nil, err
+		}
+		read := []sessions.ArchivedSession{}
+		for {
+			s, err := r.Read()
+			if err != nil {
+				return read, err
+			}
+			read = append(read, *s)
+		}
+	}
+
+	It("reads the sessions written", func() {
+		read, err := readAll(write(archived...), secret)
+		Expect(err).To(MatchError(io.EOF))
+		Expect(read).To(Equal(archived))
+	})
+
+	It("reads an empty archive", func() {
+		read, err := readAll(write(), secret)
+		Expect(err).To(MatchError(io.EOF))
+		Expect(read).To(BeEmpty())
+	})
+
+	It("encrypts the sessions", func() {
+		archive := write(archived...)
+		Expect(bytes.Contains(archive, []byte("_oauth2_proxy-1"))).To(BeFalse())
+		Expect(bytes.Contains(archive, []byte("encrypted session"))).To(BeFalse())
+	})
+
+	It("fails to read an archive encrypted with another secret", func() {
+		_, err := readAll(write(archived...), "fedcba9876543210")
+		Expect(err).To(MatchError(ErrInvalidArchive))
+	})
+
+	It("fails to read a file that is not an archive", func() {
+		_, err := readAll([]byte("not an archive"), secret)
+		Expect(err).To(MatchError(ErrInvalidArchive))
+	})
+
+	It("fails to read a truncated archive", func() {
+		archive := write(archived...)
+		first := write(archived[0])
+
+		// The first session and the start of the second
+		read, err := readAll(archive[:len(first)-10], secret)
+		Expect(err).To(MatchError(ErrTruncatedArchive))
+		Expect(read).To(Equal(archived[:1]))
+
+		// Every session, without the end of the archive
+		end := len(write()) - len(header)
+		read, err = readAll(archive[:len(archive)-end], secret)
+		Expect(err).To(MatchError(ErrTruncatedArchive))
+		Expect(read).To(Equal(archived))
+	})
+
+	It("fails to read an archive whose sessions were reordered", func() {
+		archive := write(archived...)
+		first := write(archived[0])
+		end := len(write()) - len(header)
+		firstRecord := first[len(header) : len(first)-end]
+		secondRecord := archive[len(first)-end : len(archive)-end]
+
+		reordered := append([]byte(header), secondRecord...)
+		reordered = append(reordered, firstRecord...)
+		reordered = append(reordered, archive[len(archive)-end:]...)
+		_, err := readAll(reordered, secret)
+		Expect(err).To(MatchError(ErrInvalidArchive))
+	})
+})
@@ -0,0 +1,189 @@
+package cookie
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+)
+
+const (
+	// refreshedSessionTTL is how long a refreshed session is served in place
+	// of the session it replaced. This covers requests that were waiting on the
+	// refresh lock, and requests sent with the previous cookie before the
+	// browser received the refreshed one.
+	refreshedSessionTTL = 30 * time.Second
+
+	// pruneInterval is how often expired locks and refreshed sessions are
+	// removed from memory
+	pruneInterval = time.Minute
+)
+
+// refreshLocker holds in-memory refresh locks for cookie sessions.
+// Cookie sessions have no server side state, so locks are keyed by a hash of
+// the session's refresh token and only deduplicate refreshes within this
+// process. Sessions saved while holding a lock are remembered so that
+// requests still presenting the previous cookie receive the refreshed
+// session rather than refreshing again with a refresh token that may have
+// been rotated.
+type refreshLocker struct {
+	mu        sync.Mutex
+	locks     map[string]*lockEntry
+	refreshed map[string]refreshedSession
+	lastPrune time.Time
+
+	clock clock.Clock
+}
+
+type lockEntry struct {
+	owner   *Lock
+	expires time.Time
+}
+
+type refreshedSession struct {
+	session sessions.SessionState
+	expires time.Time
+}
+
+func newRefreshLocker() *refreshLocker {
+	return &refreshLocker{
+		locks:     make(map[string]*lockEntry),
+		refreshed: make(map[string]refreshedSession),
+	}
+}
+
+// refreshLockKey identifies a session by its refresh token.
+// Sessions without a refresh token cannot be refreshed and are not locked.
+func refreshLockKey(session *sessions.SessionState) string {
+	if session.RefreshToken == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(session.RefreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// lockFor returns a Lock for the session
+func (r *refreshLocker) lockFor(session *sessions.SessionState) sessions.Lock {
+	key := refreshLockKey(session)
+	if key == "" {
+		return &sessions.NoOpLock{}
+	}
+	return &Lock{locker: r, key: key}
+}
+
+// saved remembers the session if it was saved while holding a refresh lock
+func (r *refreshLocker) saved(session *sessions.SessionState) {
+	lock, ok := session.Lock.(*Lock)
+	if !ok || lock.locker != r {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, held := r.locks[lock.key]; !held || entry.owner != lock {
+		return
+	}
+	refreshed := *session
+	refreshed.Lock = nil
+	r.refreshed[lock.key] = refreshedSession{
+		session: refreshed,
+		expires: r.clock.Now().Add(refreshedSessionTTL),
+	}
+}
+
+// replacement returns the session that replaced the given session, if it was
+// refreshed recently
+func (r *refreshLocker) replacement(session *sessions.SessionState) (*sessions.SessionState, bool) {
+	key := refreshLockKey(session)
+	if key == "" {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refreshed, ok := r.refreshed[key]
+	if !ok || !r.clock.Now().Before(refreshed.expires) {
+		return nil, false
+	}
+	replacement := refreshed.session
+	return &replacement, true
+}
+
+// prune removes expired locks and refreshed sessions.
+// The caller must hold the mutex.
+func (r *refreshLocker) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < pruneInterval {
+		return
+	}
+	r.lastPrune = now
+	for key, entry := range r.locks {
+		if !now.Before(entry.expires) {
+			delete(r.locks, key)
+		}
+	}
+	for key, refreshed := range r.refreshed {
+		if !now.Before(refreshed.expires) {
+			delete(r.refreshed, key)
+		}
+	}
+}
+
+// Lock is an in-memory lock for a cookie session
+type Lock struct {
+	locker *refreshLocker
+	key    string
+}
+
+// Obtain obtains the lock unless it is held by another request
+func (l *Lock) Obtain(_ context.Context, expiration time.Duration) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	now := l.locker.clock.Now()
+	l.locker.prune(now)
+	if entry, ok := l.locker.locks[l.key]; ok && entry.owner != l && now.Before(entry.expires) {
+		return sessions.ErrLockNotObtained
+	}
+	l.locker.locks[l.key] = &lockEntry{owner: l, expires: now.Add(expiration)}
+	return nil
+}
+
+// Peek returns true if the lock is held by any request
+func (l *Lock) Peek(_ context.Context) (bool, error) {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	entry, ok := l.locker.locks[l.key]
+	return ok && l.locker.clock.Now().Before(entry.expires), nil
+}
+
+// Refresh extends the lock if it is still held by this Lock
+func (l *Lock) Refresh(_ context.Context, expiration time.Duration) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	now := l.locker.clock.Now()
+	entry, ok := l.locker.locks[l.key]
+	if !ok || entry.owner != l || !now.Before(entry.expires) {
+		return sessions.ErrNotLocked
+	}
+	entry.expires = now.Add(expiration)
+	return nil
+}
+
+// Release releases the lock if it is still held by this Lock
+func (l *Lock) Release(_ context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	entry, ok := l.locker.locks[l.key]
+	if !ok || entry.owner != l || !l.locker.clock.Now().Before(entry.expires) {
+		return sessions.ErrNotLocked
+	}
+	delete(l.locker.locks, l.key)
+	return nil
+}
@@ -0,0 +1,160 @@
+package cookie
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cookie Session Refresh Lock Tests", func() {
+	var ss *SessionStore
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		store, err := NewCookieSessionStore(&options.SessionOptions{}, &options.Cookie{
+			Name:    "_oauth2_proxy",
+			Path:    "/",
+			Expire:  time.Hour,
+			Refresh: time.Minute,
+			Secret:  "0123456789abcdef0123456789abcdef",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		ss = store.(*SessionStore)
+		ss.refreshLocks.clock.Set(time.Now())
+	})
+
+	AfterEach(func() {
+		ss.refreshLocks.clock.Reset()
+	})
+
+	// saveAndLoad saves the session and returns a request carrying its cookie
+	saveAndLoad := func(session *sessionsapi.SessionState) (*http.Request, *sessionsapi.SessionState) {
+		rw := httptest.NewRecorder()
+		Expect(ss.Save(rw, httptest.NewRequest("GET", "/", nil), session)).To(Succeed())
+
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range rw.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		loaded, err := ss.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		return req, loaded
+	}
+
+	Context("with a refresh token", func() {
+		var req *http.Request
+		var loaded *sessionsapi.SessionState
+
+		BeforeEach(func() {
+			req, loaded = saveAndLoad(&sessionsapi.SessionState{
+				AccessToken:  "AccessToken",
+				RefreshToken: "RefreshToken",
+				Email:        "john.doe@example.com",
+			})
+		})
+
+		It("loads the session with a cookie lock", func() {
+			Expect(loaded.Lock).To(BeAssignableToTypeOf(&Lock{}))
+		})
+
+		It("prevents other requests for the session obtaining the lock", func() {
+			other, err := ss.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(loaded.ObtainLock(ctx, time.Minute)).To(Succeed())
+			Expect(other.ObtainLock(ctx, time.Minute)).To(Equal(sessionsapi.ErrLockNotObtained))
+
+			locked, err := other.PeekLock(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(locked).To(BeTrue())
+
+			Expect(other.ReleaseLock(ctx)).To(Equal(sessionsapi.ErrNotLocked))
+			Expect(loaded.ReleaseLock(ctx)).To(Succeed())
+			Expect(other.ObtainLock(ctx, time.Minute)).To(Succeed())
+		})
+
+		It("refreshes the lock while it is held", func() {
+			Expect(loaded.ObtainLock(ctx, time.Minute)).To(Succeed())
+			Expect(ss.refreshLocks.clock.Add(50 * time.Second)).To(Succeed())
+			Expect(loaded.RefreshLock(ctx, time.Minute)).To(Succeed())
+			Expect(ss.refreshLocks.clock.Add(50 * time.Second)).To(Succeed())
+
+			locked, err := loaded.PeekLock(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(locked).To(BeTrue())
+		})
+
+		It("expires the lock", func() {
+			other, err := ss.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(loaded.ObtainLock(ctx, time.Minute)).To(Succeed())
+			Expect(ss.refreshLocks.clock.Add(2 * time.Minute)).To(Succeed())
+
+			locked, err := other.PeekLock(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(locked).To(BeFalse())
+			Expect(loaded.RefreshLock(ctx, time.Minute)).To(Equal(sessionsapi.ErrNotLocked))
+			Expect(other.ObtainLock(ctx, time.Minute)).To(Succeed())
+		})
+
+		Context("when the session is refreshed while locked", func() {
+			BeforeEach(func() {
+				Expect(loaded.ObtainLock(ctx, time.Minute)).To(Succeed())
+				loaded.AccessToken = "RefreshedAccessToken"
+				loaded.RefreshToken = "RotatedRefreshToken"
+				Expect(ss.Save(httptest.NewRecorder(), req, loaded)).To(Succeed())
+				Expect(loaded.ReleaseLock(ctx)).To(Succeed())
+			})
+
+			It("loads the refreshed session for the previous cookie", func() {
+				reloaded, err := ss.Load(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reloaded.AccessToken).To(Equal("RefreshedAccessToken"))
+				Expect(reloaded.RefreshToken).To(Equal("RotatedRefreshToken"))
+			})
+
+			It("locks the refreshed session by its new refresh token", func() {
+				reloaded, err := ss.Load(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reloaded.Lock).To(BeAssignableToTypeOf(&Lock{}))
+				Expect(reloaded.Lock.(*Lock).key).To(Equal(refreshLockKey(reloaded)))
+			})
+
+			It("loads the previous session once the refreshed session expires", func() {
+				Expect(ss.refreshLocks.clock.Add(refreshedSessionTTL)).To(Succeed())
+
+				reloaded, err := ss.Load(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reloaded.AccessToken).To(Equal("AccessToken"))
+			})
+		})
+
+		It("does not record sessions saved without holding the lock", func() {
+			loaded.AccessToken = "RefreshedAccessToken"
+			Expect(ss.Save(httptest.NewRecorder(), req, loaded)).To(Succeed())
+
+			reloaded, err := ss.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reloaded.AccessToken).To(Equal("AccessToken"))
+		})
+	})
+
+	Context("without a refresh token", func() {
+		It("loads the session with a no-op lock", func() {
+			_, loaded := saveAndLoad(&sessionsapi.SessionState{
+				AccessToken: "AccessToken",
+				Email:       "john.doe@example.com",
+			})
+			Expect(loaded.Lock).To(BeAssignableToTypeOf(&sessionsapi.NoOpLock{}))
+		})
+	})
+})
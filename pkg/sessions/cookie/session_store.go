@@ -1,6 +1,7 @@
 package cookie
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -31,6 +32,8 @@ type SessionStore struct {
 	Cookie       *options.Cookie
 	CookieCipher encryption.Cipher
 	Minimal      bool
+
+	refreshLocks *refreshLocker
 }
 
 // Save takes a sessions.SessionState and stores the information from it
@@ -43,7 +46,13 @@ func (s *SessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessi
 	if err != nil {
 		return err
 	}
-	return s.setSessionCookie(rw, req, value, *ss.CreatedAt)
+	if err := s.setSessionCookie(rw, req, value, *ss.CreatedAt); err != nil {
+		return err
+	}
+	if s.refreshLocks != nil {
+		s.refreshLocks.saved(ss)
+	}
+	return nil
 }
 
 // Load reads sessions.SessionState information from Cookies within the
@@ -54,15 +63,32 @@ func (s *SessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
 		// always http.ErrNoCookie
 		return nil, err
 	}
-	val, _, ok := encryption.Validate(c, s.Cookie.Secret, s.Cookie.Expire)
+	val, keys, ok := pkgcookies.ValidateSigned(c, s.Cookie, s.Cookie.Expire)
 	if !ok {
 		return nil, errors.New("cookie signature not valid")
 	}
 
-	session, err := sessions.DecodeSessionState(val, s.CookieCipher, true)
+	cipher := s.CookieCipher
+	if !bytes.Equal(keys.SigningKey, s.Cookie.GetSigningKey()) {
+		// The cookie was saved before the cookie secret was rotated
+		cipher, err = encryption.NewCookieCipher(keys.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising cipher: %v", err)
+		}
+	}
+
+	session, err := sessions.DecodeSessionState(val, cipher, true)
 	if err != nil {
 		return nil, err
 	}
+	if s.refreshLocks != nil {
+		// Serve the refreshed session if another request has just refreshed
+		// this one, so that it is not refreshed again
+		if refreshed, ok := s.refreshLocks.replacement(session); ok {
+			session = refreshed
+		}
+		session.Lock = s.refreshLocks.lockFor(session)
+	}
 	return session, nil
 }
 
@@ -121,7 +147,7 @@ func (s *SessionStore) makeSessionCookie(req *http.Request, value []byte, now ti
 	strValue := string(value)
 	if strValue != "" {
 		var err error
-		strValue, err = encryption.SignedValue(s.Cookie.Secret, s.Cookie.Name, value, now)
+		strValue, err = encryption.SignedValueWithKey(s.Cookie.GetSigningKey(), s.Cookie.Name, value, now)
 		if err != nil {
 			return nil, err
 		}
@@ -147,7 +173,7 @@ func (s *SessionStore) makeCookie(req *http.Request, name string, value string,
 // NewCookieSessionStore initialises a new instance of the SessionStore from
 // the configuration given
 func NewCookieSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
-	cipher, err := encryption.NewCFBCipher(encryption.SecretBytes(cookieOpts.Secret))
+	cipher, err := encryption.NewCookieCipher(cookieOpts.GetEncryptionKey())
 	if err != nil {
 		return nil, fmt.Errorf("error initialising cipher: %v", err)
 	}
@@ -156,6 +182,7 @@ func NewCookieSessionStore(opts *options.SessionOptions, cookieOpts *options.Coo
 		CookieCipher: cipher,
 		Cookie:       cookieOpts,
 		Minimal:      opts.Cookie.Minimal,
+		refreshLocks: newRefreshLocker(),
 	}, nil
 }
 
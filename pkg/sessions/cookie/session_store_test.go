@@ -4,6 +4,7 @@ import (
 	"fmt"
 	mathrand "math/rand"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -34,6 +35,51 @@ var _ = Describe("Cookie SessionStore Tests", func() {
 		}, nil)
 })
 
+var _ = Describe("Cookie SessionStore Secret Rollover Tests", func() {
+	const previousSecret = "0123456789abcdef0123456789abcdef"
+	const rotatedSecret = "fedcba9876543210fedcba9876543210"
+
+	newStore := func(secret, previous string) *SessionStore {
+		cookieOpts := &options.Cookie{Name: "_oauth2_proxy", Path: "/", Expire: time.Hour, Secret: secret}
+		if previous != "" {
+			cookieOpts.SetPreviousSecret(previous)
+		}
+		store, err := NewCookieSessionStore(&options.SessionOptions{}, cookieOpts)
+		Expect(err).ToNot(HaveOccurred())
+		return store.(*SessionStore)
+	}
+
+	// savedRequest returns a request carrying the cookie of the session saved
+	// by the store
+	savedRequest := func(store *SessionStore) *http.Request {
+		rw := httptest.NewRecorder()
+		Expect(store.Save(rw, httptest.NewRequest("GET", "/", nil), &sessionsapi.SessionState{Email: "john.doe@example.com"})).To(Succeed())
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range rw.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		return req
+	}
+
+	It("loads the sessions saved with the previous cookie secret", func() {
+		req := savedRequest(newStore(previousSecret, ""))
+
+		loaded, err := newStore(rotatedSecret, previousSecret).Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Email).To(Equal("john.doe@example.com"))
+
+		By("saving them with the rotated cookie secret")
+		loaded, err = newStore(rotatedSecret, "").Load(savedRequest(newStore(rotatedSecret, previousSecret)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Email).To(Equal("john.doe@example.com"))
+	})
+
+	It("rejects the sessions of other cookie secrets", func() {
+		_, err := newStore(rotatedSecret, "").Load(savedRequest(newStore(previousSecret, "")))
+		Expect(err).To(MatchError("cookie signature not valid"))
+	})
+})
+
 func Test_copyCookie(t *testing.T) {
 	expire, _ := time.Parse(time.RFC3339, "2020-03-17T00:00:00Z")
 	c := &http.Cookie{
@@ -0,0 +1,56 @@
+package failover
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+)
+
+// breaker is a circuit breaker for a single session store.
+// It opens after threshold consecutive failures. Once the cooldown has
+// passed it allows requests again, and is closed by the next success or
+// reopened by the next failure.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     *clock.Clock
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration, clock *clock.Clock) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     clock,
+	}
+}
+
+// allow returns whether the store should be used
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < b.threshold || !b.clock.Now().Before(b.openedAt.Add(b.cooldown))
+}
+
+// success closes the breaker
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// failure records a failure and returns true if the breaker is open
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.clock.Now()
+		return true
+	}
+	return false
+}
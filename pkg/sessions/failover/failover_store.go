@@ -0,0 +1,217 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Store is a named session store within a failover chain
+type Store struct {
+	Name         string
+	SessionStore sessions.SessionStore
+}
+
+// backend is a Store and its circuit breaker
+type backend struct {
+	Store
+	breaker *breaker
+}
+
+// SessionStore is an implementation of the sessions.SessionStore interface
+// that uses an ordered chain of session stores.
+//
+// Sessions are saved to the first available store. A store that returns
+// errors for FailureThreshold consecutive saves or connection checks is
+// skipped until the cooldown has passed. Sessions are loaded from the first
+// store that can load them, so sessions saved to a failover store remain
+// valid once the primary store recovers.
+type SessionStore struct {
+	backends []*backend
+	metrics  *storeMetrics
+
+	Clock clock.Clock
+}
+
+// NewFailoverSessionStore creates a SessionStore that fails over between the
+// stores in order, recording metrics to the registerer
+func NewFailoverSessionStore(stores []Store, opts options.SessionFailoverOptions, registerer prometheus.Registerer) *SessionStore {
+	ss := &SessionStore{
+		metrics: newMetrics(registerer),
+	}
+	for _, store := range stores {
+		ss.backends = append(ss.backends, &backend{
+			Store:   store,
+			breaker: newBreaker(opts.FailureThreshold, opts.Cooldown, &ss.Clock),
+		})
+		ss.metrics.circuitOpen.WithLabelValues(store.Name).Set(0)
+	}
+	return ss
+}
+
+// Save saves the session to the first available store, failing over to the
+// next store on error. If every circuit breaker is open, all stores are tried.
+func (s *SessionStore) Save(rw http.ResponseWriter, req *http.Request, ss *sessions.SessionState) error {
+	available, open := s.partition()
+	if len(available) == 0 {
+		available = open
+	}
+
+	var errs []error
+	for _, b := range available {
+		err := b.SessionStore.Save(rw, req, ss)
+		if err == nil {
+			s.recordSuccess(b)
+			if b != s.backends[0] {
+				s.metrics.failovers.WithLabelValues(b.Name).Inc()
+			}
+			return nil
+		}
+		s.recordFailure(b, "save", err)
+		errs = append(errs, fmt.Errorf("%s: %v", b.Name, err))
+	}
+	return fmt.Errorf("error saving session to any session store: %v", errors.Join(errs...))
+}
+
+// Load loads the session from the first store that holds it. Stores with an
+// open circuit breaker are tried last, as they may still hold sessions saved
+// before they started failing.
+// Load errors do not trip the circuit breakers, as a store not holding the
+// session is expected after a failover.
+func (s *SessionStore) Load(req *http.Request) (*sessions.SessionState, error) {
+	available, open := s.partition()
+
+	var firstErr error
+	for _, b := range append(available, open...) {
+		ss, err := b.SessionStore.Load(req)
+		if err == nil {
+			return ss, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// Clear clears the session from every store, as it may be held by any of them.
+// It only returns an error if no store could clear the session.
+func (s *SessionStore) Clear(rw http.ResponseWriter, req *http.Request) error {
+	var errs []error
+	for _, b := range s.backends {
+		err := b.SessionStore.Clear(rw, req)
+		if err == nil {
+			continue
+		}
+		s.metrics.errors.WithLabelValues(b.Name, "clear").Inc()
+		errs = append(errs, fmt.Errorf("%s: %v", b.Name, err))
+	}
+	if len(errs) == len(s.backends) {
+		return fmt.Errorf("error clearing session from any session store: %v", errors.Join(errs...))
+	}
+	for _, err := range errs {
+		logger.Errorf("Error clearing session from failover session store %v", err)
+	}
+	return nil
+}
+
+// VerifyConnection checks every store, returning an error only if none of
+// them are connected
+func (s *SessionStore) VerifyConnection(ctx context.Context) error {
+	var errs []error
+	for _, b := range s.backends {
+		err := b.SessionStore.VerifyConnection(ctx)
+		if err == nil {
+			s.recordSuccess(b)
+			continue
+		}
+		s.recordFailure(b, "verify", err)
+		errs = append(errs, fmt.Errorf("%s: %v", b.Name, err))
+	}
+	if len(errs) == len(s.backends) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Close closes every store that holds connections to release
+func (s *SessionStore) Close() error {
+	var errs []error
+	for _, b := range s.backends {
+		if closer, ok := b.SessionStore.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", b.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RefreshInBackground refreshes sessions in the background in every store
+// that supports it, until the context is cancelled
+func (s *SessionStore) RefreshInBackground(ctx context.Context, refresh sessions.RefreshSessionFunc) error {
+	g, groupCtx := errgroup.WithContext(ctx)
+	for _, b := range s.backends {
+		refresher, ok := b.SessionStore.(sessions.BackgroundRefresher)
+		if !ok {
+			continue
+		}
+		g.Go(func() error {
+			return refresher.RefreshInBackground(groupCtx, refresh)
+		})
+	}
+	return g.Wait()
+}
+
+// ReapSessions reaps the sessions of every store that supports it
+func (s *SessionStore) ReapSessions(ctx context.Context) (sessions.ReapResult, error) {
+	total := sessions.ReapResult{}
+	for _, b := range s.backends {
+		reaper, ok := b.SessionStore.(sessions.SessionReaper)
+		if !ok {
+			continue
+		}
+		result, err := reaper.ReapSessions(ctx)
+		total.Expired += result.Expired
+		total.Orphaned += result.Orphaned
+		if err != nil {
+			return total, fmt.Errorf("error reaping the sessions of the %s session store: %v", b.Name, err)
+		}
+	}
+	return total, nil
+}
+
+// partition splits the stores into those whose circuit breakers allow
+// requests and those whose breakers are open, preserving their order
+func (s *SessionStore) partition() (available, open []*backend) {
+	for _, b := range s.backends {
+		if b.breaker.allow() {
+			available = append(available, b)
+		} else {
+			open = append(open, b)
+		}
+	}
+	return available, open
+}
+
+func (s *SessionStore) recordSuccess(b *backend) {
+	b.breaker.success()
+	s.metrics.circuitOpen.WithLabelValues(b.Name).Set(0)
+}
+
+func (s *SessionStore) recordFailure(b *backend, operation string, err error) {
+	s.metrics.errors.WithLabelValues(b.Name, operation).Inc()
+	if b.breaker.failure() {
+		s.metrics.circuitOpen.WithLabelValues(b.Name).Set(1)
+		logger.Errorf("Session store %s is failing, skipping it for %s: %v", b.Name, b.breaker.cooldown, err)
+	}
+}
@@ -0,0 +1,221 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeStore is a sessions.SessionStore holding a single session that can be
+// made to fail
+type fakeStore struct {
+	session *sessions.SessionState
+	err     error
+	saves   int
+	loads   int
+	clears  int
+}
+
+func (f *fakeStore) Save(_ http.ResponseWriter, _ *http.Request, s *sessions.SessionState) error {
+	f.saves++
+	if f.err != nil {
+		return f.err
+	}
+	f.session = s
+	return nil
+}
+
+func (f *fakeStore) Load(_ *http.Request) (*sessions.SessionState, error) {
+	f.loads++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.session == nil {
+		return nil, errors.New("session not found")
+	}
+	return f.session, nil
+}
+
+func (f *fakeStore) Clear(_ http.ResponseWriter, _ *http.Request) error {
+	f.clears++
+	if f.err != nil {
+		return f.err
+	}
+	f.session = nil
+	return nil
+}
+
+func (f *fakeStore) VerifyConnection(_ context.Context) error {
+	return f.err
+}
+
+// refreshingStore is a fakeStore that refreshes sessions in the background
+type refreshingStore struct {
+	fakeStore
+	refreshed chan struct{}
+}
+
+func (r *refreshingStore) RefreshInBackground(ctx context.Context, _ sessions.RefreshSessionFunc) error {
+	close(r.refreshed)
+	<-ctx.Done()
+	return nil
+}
+
+type reapingStore struct {
+	fakeStore
+	result sessions.ReapResult
+}
+
+func (r *reapingStore) ReapSessions(_ context.Context) (sessions.ReapResult, error) {
+	return r.result, nil
+}
+
+var _ = Describe("Failover SessionStore Tests", func() {
+	var primary, secondary *fakeStore
+	var registry *prometheus.Registry
+	var ss *SessionStore
+	var rw *httptest.ResponseRecorder
+	var req *http.Request
+	session := &sessions.SessionState{Email: "user@example.com"}
+
+	BeforeEach(func() {
+		primary = &fakeStore{}
+		secondary = &fakeStore{}
+		registry = prometheus.NewRegistry()
+		ss = NewFailoverSessionStore([]Store{
+			{Name: "redis", SessionStore: primary},
+			{Name: "cookie", SessionStore: secondary},
+		}, options.SessionFailoverOptions{
+			FailureThreshold: 2,
+			Cooldown:         time.Minute,
+		}, registry)
+		ss.Clock.Set(time.Now())
+
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/", nil)
+	})
+
+	It("saves to and loads from the primary store", func() {
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(primary.session).To(Equal(session))
+		Expect(secondary.saves).To(Equal(0))
+
+		loaded, err := ss.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(Equal(session))
+		Expect(secondary.loads).To(Equal(0))
+	})
+
+	It("fails over when the primary store returns an error", func() {
+		primary.err = errors.New("connection refused")
+
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(secondary.session).To(Equal(session))
+
+		loaded, err := ss.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(Equal(session))
+
+		Expect(testutil.ToFloat64(ss.metrics.errors.WithLabelValues("redis", "save"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(ss.metrics.failovers.WithLabelValues("cookie"))).To(Equal(1.0))
+	})
+
+	It("opens the circuit breaker after repeated failures and recovers after the cooldown", func() {
+		primary.err = errors.New("connection refused")
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(primary.saves).To(Equal(2))
+		Expect(testutil.ToFloat64(ss.metrics.circuitOpen.WithLabelValues("redis"))).To(Equal(1.0))
+
+		// The primary store is skipped while the breaker is open
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(primary.saves).To(Equal(2))
+		Expect(secondary.saves).To(Equal(3))
+
+		// Sessions are loaded from the available store first
+		_, err := ss.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(primary.loads).To(Equal(0))
+
+		primary.err = nil
+		Expect(ss.Clock.Add(time.Minute)).To(Succeed())
+		Expect(ss.Save(rw, req, session)).To(Succeed())
+		Expect(primary.saves).To(Equal(3))
+		Expect(primary.session).To(Equal(session))
+		Expect(testutil.ToFloat64(ss.metrics.circuitOpen.WithLabelValues("redis"))).To(Equal(0.0))
+	})
+
+	It("returns an error when every store fails", func() {
+		primary.err = errors.New("connection refused")
+		secondary.err = errors.New("cookie too large")
+
+		err := ss.Save(rw, req, session)
+		Expect(err).To(MatchError("error saving session to any session store: redis: connection refused\ncookie: cookie too large"))
+
+		_, err = ss.Load(req)
+		Expect(err).To(MatchError("connection refused"))
+
+		Expect(ss.VerifyConnection(context.Background())).ToNot(Succeed())
+	})
+
+	It("clears the session from every store", func() {
+		primary.err = errors.New("connection refused")
+		Expect(ss.Clear(rw, req)).To(Succeed())
+		Expect(primary.clears).To(Equal(1))
+		Expect(secondary.clears).To(Equal(1))
+
+		secondary.err = errors.New("failed")
+		Expect(ss.Clear(rw, req)).ToNot(Succeed())
+	})
+
+	It("verifies the connection if any store is connected", func() {
+		primary.err = errors.New("connection refused")
+		Expect(ss.VerifyConnection(context.Background())).To(Succeed())
+		Expect(testutil.ToFloat64(ss.metrics.errors.WithLabelValues("redis", "verify"))).To(Equal(1.0))
+	})
+
+	It("refreshes sessions in the background in the stores that support it", func() {
+		refreshing := &refreshingStore{refreshed: make(chan struct{})}
+		ss = NewFailoverSessionStore([]Store{
+			{Name: "redis", SessionStore: refreshing},
+			{Name: "cookie", SessionStore: secondary},
+		}, options.SessionFailoverOptions{
+			FailureThreshold: 2,
+			Cooldown:         time.Minute,
+		}, registry)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- ss.RefreshInBackground(ctx, nil)
+		}()
+
+		Eventually(refreshing.refreshed).Should(BeClosed())
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("reaps the sessions of the stores that support it", func() {
+		ss = NewFailoverSessionStore([]Store{
+			{Name: "redis", SessionStore: &reapingStore{result: sessions.ReapResult{Expired: 1, Orphaned: 2}}},
+			{Name: "postgres", SessionStore: &reapingStore{result: sessions.ReapResult{Expired: 3}}},
+			{Name: "cookie", SessionStore: secondary},
+		}, options.SessionFailoverOptions{
+			FailureThreshold: 2,
+			Cooldown:         time.Minute,
+		}, registry)
+
+		result, err := ss.ReapSessions(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(sessions.ReapResult{Expired: 4, Orphaned: 2}))
+	})
+})
@@ -0,0 +1,39 @@
+package failover
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storeMetrics are the prometheus metrics recorded by the SessionStore
+type storeMetrics struct {
+	errors      *prometheus.CounterVec
+	failovers   *prometheus.CounterVec
+	circuitOpen *prometheus.GaugeVec
+}
+
+func newMetrics(registerer prometheus.Registerer) *storeMetrics {
+	return &storeMetrics{
+		errors: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_session_store_errors_total",
+				Help: "Total number of session store errors by store and operation.",
+			},
+			[]string{"store", "operation"},
+		)).(*prometheus.CounterVec),
+		failovers: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_session_store_failovers_total",
+				Help: "Total number of sessions saved to a failover session store, by store.",
+			},
+			[]string{"store"},
+		)).(*prometheus.CounterVec),
+		circuitOpen: metrics.Register(registerer, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "oauth2_proxy_session_store_circuit_open",
+				Help: "Whether the circuit breaker for a session store is open (1) or closed (0).",
+			},
+			[]string{"store"},
+		)).(*prometheus.GaugeVec),
+	}
+}
@@ -0,0 +1,200 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// binaryHeaderLength is the length of the header of binary protocol
+	// requests and responses
+	binaryHeaderLength = 24
+
+	// maxBinaryBodyLength is the longest response body accepted: the extras,
+	// the key and a value of the maximum length. Longer bodies reported by a
+	// server are rejected rather than allocated.
+	maxBinaryBodyLength = 8 + maxKeyLength + maxValueLength
+
+	// saslMechanismPlain is the SASL mechanism the client authenticates with
+	saslMechanismPlain = "PLAIN"
+)
+
+// The magic bytes of binary protocol requests and responses
+const (
+	magicRequest  byte = 0x80
+	magicResponse byte = 0x81
+)
+
+// The opcodes of the binary protocol commands used by the client
+const (
+	opGet      byte = 0x00
+	opSet      byte = 0x01
+	opAdd      byte = 0x02
+	opDelete   byte = 0x04
+	opVersion  byte = 0x0b
+	opTouch    byte = 0x1c
+	opSASLAuth byte = 0x21
+)
+
+// The statuses of binary protocol responses handled by the client
+const (
+	statusOK          uint16 = 0x0000
+	statusKeyNotFound uint16 = 0x0001
+	statusKeyExists   uint16 = 0x0002
+	statusNotStored   uint16 = 0x0005
+	statusAuthError   uint16 = 0x0020
+)
+
+// binaryResponse is the status and value of a binary protocol response. The
+// value of error responses is their message.
+type binaryResponse struct {
+	status uint16
+	value  []byte
+}
+
+// binaryAuthenticate authenticates the connection with the SASL PLAIN
+// mechanism, which memcached requires before any other binary command when
+// it is started with SASL enabled
+func (cn *conn) binaryAuthenticate(username, password string) error {
+	resp, err := cn.binaryRoundTrip(opSASLAuth, nil, saslMechanismPlain, []byte("\x00"+username+"\x00"+password))
+	if err != nil {
+		return err
+	}
+	switch resp.status {
+	case statusOK:
+		return nil
+	case statusAuthError:
+		return errors.New("authentication failure")
+	default:
+		return binaryResponseError(resp)
+	}
+}
+
+func (cn *conn) binaryGet(key string) ([]byte, error) {
+	resp, err := cn.binaryRoundTrip(opGet, nil, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.status {
+	case statusOK:
+		return resp.value, nil
+	case statusKeyNotFound:
+		return nil, ErrCacheMiss
+	default:
+		return nil, binaryResponseError(resp)
+	}
+}
+
+func (cn *conn) binaryStore(verb, key string, value []byte, expiration time.Duration) error {
+	opcode := opSet
+	if verb == "add" {
+		opcode = opAdd
+	}
+	// The flags of the value, followed by its expiration
+	extras := make([]byte, 8)
+	binary.BigEndian.PutUint32(extras[4:], uint32(expirationSeconds(expiration)))
+
+	resp, err := cn.binaryRoundTrip(opcode, extras, key, value)
+	if err != nil {
+		return err
+	}
+	switch resp.status {
+	case statusOK:
+		return nil
+	case statusKeyExists, statusNotStored:
+		return ErrNotStored
+	default:
+		return binaryResponseError(resp)
+	}
+}
+
+func (cn *conn) binaryTouch(key string, expiration time.Duration) error {
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, uint32(expirationSeconds(expiration)))
+
+	resp, err := cn.binaryRoundTrip(opTouch, extras, key, nil)
+	if err != nil {
+		return err
+	}
+	switch resp.status {
+	case statusOK:
+		return nil
+	case statusKeyNotFound:
+		return ErrCacheMiss
+	default:
+		return binaryResponseError(resp)
+	}
+}
+
+func (cn *conn) binaryDelete(key string) error {
+	resp, err := cn.binaryRoundTrip(opDelete, nil, key, nil)
+	if err != nil {
+		return err
+	}
+	switch resp.status {
+	case statusOK, statusKeyNotFound:
+		return nil
+	default:
+		return binaryResponseError(resp)
+	}
+}
+
+func (cn *conn) binaryVersion() error {
+	resp, err := cn.binaryRoundTrip(opVersion, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.status != statusOK {
+		return binaryResponseError(resp)
+	}
+	return nil
+}
+
+// binaryRoundTrip writes a binary protocol request and reads its response
+func (cn *conn) binaryRoundTrip(opcode byte, extras []byte, key string, value []byte) (*binaryResponse, error) {
+	header := make([]byte, binaryHeaderLength)
+	header[0] = magicRequest
+	header[1] = opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(key)))
+	header[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(extras)+len(key)+len(value)))
+
+	for _, part := range [][]byte{header, extras, []byte(key), value} {
+		if _, err := cn.rw.Write(part); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(cn.rw, header); err != nil {
+		return nil, err
+	}
+	if header[0] != magicResponse || header[1] != opcode {
+		return nil, fmt.Errorf("unexpected memcached binary response to opcode %#02x", opcode)
+	}
+	keyLength := int(binary.BigEndian.Uint16(header[2:4]))
+	extrasLength := int(header[4])
+	bodyLength := binary.BigEndian.Uint32(header[8:12])
+	if bodyLength > maxBinaryBodyLength || uint32(extrasLength+keyLength) > bodyLength {
+		return nil, fmt.Errorf("invalid body length %d in binary response", bodyLength)
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err := io.ReadFull(cn.rw, body); err != nil {
+		return nil, err
+	}
+	return &binaryResponse{
+		status: binary.BigEndian.Uint16(header[6:8]),
+		value:  body[extrasLength+keyLength:],
+	}, nil
+}
+
+// binaryResponseError converts an unexpected binary response into an error
+func binaryResponseError(resp *binaryResponse) error {
+	return fmt.Errorf("unexpected memcached response status %#04x %q", resp.status, resp.value)
+}
@@ -0,0 +1,522 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
+)
+
+const (
+	// maxIdleConns is the number of idle connections kept open per server
+	maxIdleConns = 8
+
+	// maxKeyLength is the maximum length of a memcached key
+	maxKeyLength = 250
+
+	// maxValueLength is the maximum length of a value, the default item size
+	// limit of memcached. Values reported larger by a server are rejected
+	// rather than allocated.
+	maxValueLength = 1024 * 1024
+
+	// maxRelativeExpiration is the longest expiration memcached accepts as a
+	// number of seconds. Longer expirations must be sent as a unix timestamp.
+	maxRelativeExpiration = 60 * 60 * 24 * 30
+)
+
+var (
+	// ErrCacheMiss is returned when the requested key does not exist
+	ErrCacheMiss = errors.New("memcached: cache miss")
+
+	// ErrNotStored is returned when a conditional write was not performed
+	ErrNotStored = errors.New("memcached: item not stored")
+
+	// errClientClosed is returned by the operations of a closed client
+	errClientClosed = errors.New("memcached: client is closed")
+)
+
+// Client is the interface for the memcached operations required by the
+// SessionStore.
+type Client interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	Add(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	Touch(ctx context.Context, key string, expiration time.Duration) error
+	Del(ctx context.Context, key string) error
+	Lock(key string) sessions.Lock
+	Ping(ctx context.Context) error
+}
+
+// dialFunc opens a new connection to the given address
+type dialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+var (
+	_ Client    = (*client)(nil)
+	_ io.Closer = (*client)(nil)
+)
+
+// client is a memcached client which distributes keys across servers using
+// consistent hashing. It speaks the text protocol, or the binary protocol
+// when it authenticates with SASL.
+type client struct {
+	ring    *hashRing
+	servers map[string]*server
+}
+
+// newClient constructs a client for the given server addresses.
+// If a username is given, each new connection authenticates using the
+// mechanism given: SASL PLAIN over the binary protocol, or the memcached
+// ASCII authentication.
+func newClient(addrs []string, dial dialFunc, timeout time.Duration, username, password, mechanism string) *client {
+	servers := make(map[string]*server, len(addrs))
+	for _, addr := range addrs {
+		servers[addr] = &server{
+			addr:      addr,
+			dial:      dial,
+			timeout:   timeout,
+			username:  username,
+			password:  password,
+			mechanism: mechanism,
+		}
+	}
+	return &client{
+		ring:    newHashRing(addrs),
+		servers: servers,
+	}
+}
+
+func (c *client) serverFor(key string) (*server, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	return c.servers[c.ring.get(key)], nil
+}
+
+// Get returns the value stored for the key, or ErrCacheMiss if there is none.
+func (c *client) Get(ctx context.Context, key string) ([]byte, error) {
+	s, err := c.serverFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	err = s.do(ctx, func(cn *conn) error {
+		value, err = cn.get(key)
+		return err
+	})
+	return value, err
+}
+
+// Set stores the value for the key unconditionally.
+func (c *client) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	return c.store(ctx, "set", key, value, expiration)
+}
+
+// Add stores the value for the key only if the key does not already exist.
+// ErrNotStored is returned if the key exists.
+func (c *client) Add(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	return c.store(ctx, "add", key, value, expiration)
+}
+
+func (c *client) store(ctx context.Context, verb, key string, value []byte, expiration time.Duration) error {
+	if len(value) > maxValueLength {
+		return fmt.Errorf("memcached value of %d bytes is larger than the maximum of %d bytes", len(value), maxValueLength)
+	}
+	s, err := c.serverFor(key)
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, func(cn *conn) error {
+		return cn.store(verb, key, value, expiration)
+	})
+}
+
+// Touch updates the expiration of the key.
+// ErrCacheMiss is returned if the key does not exist.
+func (c *client) Touch(ctx context.Context, key string, expiration time.Duration) error {
+	s, err := c.serverFor(key)
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, func(cn *conn) error {
+		return cn.touch(key, expiration)
+	})
+}
+
+// Del removes the key. Deleting a key that does not exist is not an error.
+func (c *client) Del(ctx context.Context, key string) error {
+	s, err := c.serverFor(key)
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, func(cn *conn) error {
+		return cn.delete(key)
+	})
+}
+
+// Lock returns a lock for the key
+func (c *client) Lock(key string) sessions.Lock {
+	return NewLock(c, key)
+}
+
+// Ping checks that every server is reachable and responding
+func (c *client) Ping(ctx context.Context) error {
+	for _, addr := range c.ring.addrs {
+		err := c.servers[addr].do(ctx, (*conn).version)
+		if err != nil {
+			return fmt.Errorf("error pinging memcached server %s: %v", addr, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the idle connections to every server. Connections in use are
+// closed once they are returned, and no new connections are opened.
+func (c *client) Close() error {
+	for _, s := range c.servers {
+		s.close()
+	}
+	return nil
+}
+
+// server manages a pool of connections to a single memcached server
+type server struct {
+	addr      string
+	dial      dialFunc
+	timeout   time.Duration
+	username  string
+	password  string
+	mechanism string
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// do runs the function with a pooled connection.
+// Connections are only returned to the pool if the function succeeds or
+// fails with a memcached level error, in which case the connection is still
+// in a known state.
+func (s *server) do(ctx context.Context, fn func(*conn) error) error {
+	cn, err := s.getConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := cn.setDeadline(ctx, s.timeout); err != nil {
+		cn.close()
+		return err
+	}
+
+	err = fn(cn)
+	if err == nil || errors.Is(err, ErrCacheMiss) || errors.Is(err, ErrNotStored) {
+		s.putConn(cn)
+		return err
+	}
+	cn.close()
+	return err
+}
+
+func (s *server) getConn(ctx context.Context) (*conn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errClientClosed
+	}
+	if n := len(s.idle); n > 0 {
+		cn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return cn, nil
+	}
+	s.mu.Unlock()
+
+	dialCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	nc, err := s.dial(dialCtx, s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to memcached server %s: %v", s.addr, err)
+	}
+	cn := &conn{
+		nc:             nc,
+		rw:             bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+		binaryProtocol: s.username != "" && s.mechanism == options.MemcachedAuthSASL,
+	}
+
+	if s.username != "" {
+		if err := cn.setDeadline(ctx, s.timeout); err != nil {
+			cn.close()
+			return nil, err
+		}
+		if err := cn.authenticate(s.mechanism, s.username, s.password); err != nil {
+			cn.close()
+			return nil, fmt.Errorf("error authenticating to memcached server %s: %v", s.addr, err)
+		}
+	}
+	return cn, nil
+}
+
+// maxIdle returns the number of idle connections kept open per server
+func maxIdle() int {
+	if memory.LowMemory() {
+		return memory.StorePoolSize
+	}
+	return maxIdleConns
+}
+
+func (s *server) putConn(cn *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.idle) >= maxIdle() {
+		cn.close()
+		return
+	}
+	s.idle = append(s.idle, cn)
+}
+
+// close closes the idle connections and stops the server pooling any more
+func (s *server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, cn := range s.idle {
+		cn.close()
+	}
+	s.idle = nil
+}
+
+// conn is a single connection to a memcached server, speaking the text
+// protocol or, once authenticated with SASL, the binary protocol
+type conn struct {
+	nc             net.Conn
+	rw             *bufio.ReadWriter
+	binaryProtocol bool
+}
+
+func (cn *conn) close() {
+	_ = cn.nc.Close()
+}
+
+// setDeadline sets the connection deadline to the earlier of the context
+// deadline and the configured timeout.
+func (cn *conn) setDeadline(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	return cn.nc.SetDeadline(deadline)
+}
+
+// authenticate authenticates the connection with SASL PLAIN, or with memcached
+// ASCII authentication, where the credentials are sent as the value of a set
+// command for any key
+func (cn *conn) authenticate(mechanism, username, password string) error {
+	if mechanism == options.MemcachedAuthSASL {
+		return cn.binaryAuthenticate(username, password)
+	}
+
+	err := cn.store("set", "auth", []byte(username+" "+password), 0)
+	if errors.Is(err, ErrNotStored) {
+		return errors.New("authentication failure")
+	}
+	return err
+}
+
+// get returns the value stored for the key, or ErrCacheMiss
+func (cn *conn) get(key string) ([]byte, error) {
+	if cn.binaryProtocol {
+		return cn.binaryGet(key)
+	}
+
+	if _, err := fmt.Fprintf(cn.rw, "get %s\r\n", key); err != nil {
+		return nil, err
+	}
+	if err := cn.rw.Flush(); err != nil {
+		return nil, err
+	}
+	return cn.readValue(key)
+}
+
+// touch updates the expiration of the key, or returns ErrCacheMiss
+func (cn *conn) touch(key string, expiration time.Duration) error {
+	if cn.binaryProtocol {
+		return cn.binaryTouch(key, expiration)
+	}
+
+	line, err := cn.roundTrip(fmt.Sprintf("touch %s %d\r\n", key, expirationSeconds(expiration)))
+	if err != nil {
+		return err
+	}
+	switch line {
+	case "TOUCHED":
+		return nil
+	case "NOT_FOUND":
+		return ErrCacheMiss
+	default:
+		return responseError(line)
+	}
+}
+
+// delete removes the key, whether it exists or not
+func (cn *conn) delete(key string) error {
+	if cn.binaryProtocol {
+		return cn.binaryDelete(key)
+	}
+
+	line, err := cn.roundTrip(fmt.Sprintf("delete %s\r\n", key))
+	if err != nil {
+		return err
+	}
+	switch line {
+	case "DELETED", "NOT_FOUND":
+		return nil
+	default:
+		return responseError(line)
+	}
+}
+
+// version checks that the server responds with its version
+func (cn *conn) version() error {
+	if cn.binaryProtocol {
+		return cn.binaryVersion()
+	}
+
+	line, err := cn.roundTrip("version\r\n")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "VERSION ") {
+		return responseError(line)
+	}
+	return nil
+}
+
+// store runs the storage command given by the verb, set or add
+func (cn *conn) store(verb, key string, value []byte, expiration time.Duration) error {
+	if cn.binaryProtocol {
+		return cn.binaryStore(verb, key, value, expiration)
+	}
+
+	if _, err := fmt.Fprintf(cn.rw, "%s %s 0 %d %d\r\n", verb, key, expirationSeconds(expiration), len(value)); err != nil {
+		return err
+	}
+	if _, err := cn.rw.Write(value); err != nil {
+		return err
+	}
+	line, err := cn.roundTrip("\r\n")
+	if err != nil {
+		return err
+	}
+
+	switch line {
+	case "STORED":
+		return nil
+	case "NOT_STORED", "EXISTS":
+		return ErrNotStored
+	default:
+		return responseError(line)
+	}
+}
+
+// roundTrip writes the command and returns the single line response
+func (cn *conn) roundTrip(cmd string) (string, error) {
+	if _, err := cn.rw.WriteString(cmd); err != nil {
+		return "", err
+	}
+	if err := cn.rw.Flush(); err != nil {
+		return "", err
+	}
+	return cn.readLine()
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// readValue reads the response to a get command for a single key
+func (cn *conn) readValue(key string) ([]byte, error) {
+	line, err := cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "END" {
+		return nil, ErrCacheMiss
+	}
+
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "VALUE" || fields[1] != key {
+		return nil, responseError(line)
+	}
+	size, err := strconv.Atoi(fields[3])
+	if err != nil || size < 0 || size > maxValueLength {
+		return nil, fmt.Errorf("invalid value length in response %q", line)
+	}
+
+	value := make([]byte, size+2)
+	if _, err := io.ReadFull(cn.rw, value); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(value, []byte("\r\n")) {
+		return nil, errors.New("corrupt value in response")
+	}
+
+	line, err = cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line != "END" {
+		return nil, responseError(line)
+	}
+	return value[:size], nil
+}
+
+// responseError converts an unexpected response line into an error
+func responseError(line string) error {
+	return fmt.Errorf("unexpected memcached response %q", line)
+}
+
+// validateKey checks the key is acceptable to the memcached text protocol
+func validateKey(key string) error {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return fmt.Errorf("memcached key must be between 1 and %d characters", maxKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return fmt.Errorf("memcached key %q contains invalid characters", key)
+		}
+	}
+	return nil
+}
+
+// expirationSeconds converts the expiration into the format memcached
+// expects: a number of seconds, or a unix timestamp if longer than 30 days.
+func expirationSeconds(expiration time.Duration) int64 {
+	if expiration <= 0 {
+		return 0
+	}
+
+	seconds := int64((expiration + time.Second - 1) / time.Second)
+	if seconds > maxRelativeExpiration {
+		return time.Now().Add(expiration).Unix()
+	}
+	return seconds
+}
@@ -0,0 +1,165 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memcached Client Tests", func() {
+	var fs *fakeServer
+	var client Client
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		var err error
+		fs, err = newFakeServer("", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		client, err = NewMemcachedClient(options.MemcachedStoreOptions{
+			Servers: []string{fs.Addr()},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(fs.Close()).To(Succeed())
+	})
+
+	It("stores, loads and deletes values", func() {
+		Expect(client.Set(ctx, "key", []byte("value\r\nwith newline"), time.Minute)).To(Succeed())
+
+		value, err := client.Get(ctx, "key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("value\r\nwith newline")))
+
+		Expect(client.Del(ctx, "key")).To(Succeed())
+		_, err = client.Get(ctx, "key")
+		Expect(err).To(MatchError(ErrCacheMiss))
+
+		// Deleting a missing key is not an error
+		Expect(client.Del(ctx, "key")).To(Succeed())
+	})
+
+	It("only adds values that do not exist", func() {
+		Expect(client.Add(ctx, "key", []byte("first"), time.Minute)).To(Succeed())
+		Expect(client.Add(ctx, "key", []byte("second"), time.Minute)).To(MatchError(ErrNotStored))
+
+		value, err := client.Get(ctx, "key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("first")))
+	})
+
+	It("expires values", func() {
+		Expect(client.Set(ctx, "key", []byte("value"), time.Minute)).To(Succeed())
+		Expect(client.Touch(ctx, "key", 2*time.Minute)).To(Succeed())
+
+		fs.FastForward(90 * time.Second)
+		_, err := client.Get(ctx, "key")
+		Expect(err).ToNot(HaveOccurred())
+
+		fs.FastForward(time.Minute)
+		_, err = client.Get(ctx, "key")
+		Expect(err).To(MatchError(ErrCacheMiss))
+		Expect(client.Touch(ctx, "key", time.Minute)).To(MatchError(ErrCacheMiss))
+	})
+
+	It("rejects invalid keys", func() {
+		Expect(client.Set(ctx, "invalid key", []byte("value"), time.Minute)).To(MatchError("memcached key \"invalid key\" contains invalid characters"))
+	})
+
+	It("rejects values larger than the maximum", func() {
+		Expect(client.Set(ctx, "key", make([]byte, maxValueLength+1), time.Minute)).To(MatchError(ContainSubstring("larger than the maximum")))
+	})
+
+	It("rejects invalid value lengths from the server before reading them", func() {
+		for _, size := range []string{"-1", "1048577", "9223372036854775807"} {
+			response := "VALUE key 0 " + size + "\r\nvalue\r\nEND\r\n"
+			cn := &conn{rw: bufio.NewReadWriter(bufio.NewReader(strings.NewReader(response)), bufio.NewWriter(io.Discard))}
+			_, err := cn.readValue("key")
+			Expect(err).To(MatchError(fmt.Sprintf("invalid value length in response %q", "VALUE key 0 "+size)))
+		}
+	})
+
+	It("rejects invalid body lengths from the server before reading them", func() {
+		header := make([]byte, binaryHeaderLength)
+		header[0], header[1] = magicResponse, opGet
+		binary.BigEndian.PutUint32(header[8:12], maxBinaryBodyLength+1)
+		cn := &conn{rw: bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(header)), bufio.NewWriter(io.Discard)), binaryProtocol: true}
+		_, err := cn.get("key")
+		Expect(err).To(MatchError(fmt.Sprintf("invalid body length %d in binary response", maxBinaryBodyLength+1)))
+	})
+
+	It("pings the server", func() {
+		Expect(client.Ping(ctx)).To(Succeed())
+	})
+
+	It("closes its connections once closed", func() {
+		Expect(client.Set(ctx, "key", []byte("value"), time.Minute)).To(Succeed())
+		Expect(client.(io.Closer).Close()).To(Succeed())
+
+		_, err := client.Get(ctx, "key")
+		Expect(err).To(MatchError(errClientClosed))
+	})
+
+	It("fails when no servers are configured", func() {
+		_, err := NewMemcachedClient(options.MemcachedStoreOptions{})
+		Expect(err).To(MatchError("no memcached servers configured"))
+	})
+
+	It("fails with an unknown auth mechanism", func() {
+		_, err := NewMemcachedClient(options.MemcachedStoreOptions{
+			Servers:       []string{fs.Addr()},
+			AuthMechanism: "digest",
+		})
+		Expect(err).To(MatchError(`unknown memcached auth mechanism "digest"`))
+	})
+})
+
+var _ = Describe("hashRing", func() {
+	It("distributes keys across all servers", func() {
+		ring := newHashRing([]string{"a:11211", "b:11211", "c:11211"})
+
+		counts := map[string]int{}
+		for i := 0; i < 3000; i++ {
+			counts[ring.get(fmt.Sprintf("key-%d", i))]++
+		}
+		Expect(counts).To(HaveLen(3))
+		for _, count := range counts {
+			Expect(count).To(BeNumerically(">", 500))
+		}
+	})
+
+	It("only moves keys owned by a removed server", func() {
+		ring := newHashRing([]string{"a:11211", "b:11211", "c:11211"})
+		smaller := newHashRing([]string{"a:11211", "b:11211"})
+
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if owner := ring.get(key); owner != "c:11211" {
+				Expect(smaller.get(key)).To(Equal(owner))
+			}
+		}
+	})
+})
+
+var _ = Describe("expirationSeconds", func() {
+	It("rounds up to whole seconds", func() {
+		Expect(expirationSeconds(1500 * time.Millisecond)).To(Equal(int64(2)))
+		Expect(expirationSeconds(0)).To(Equal(int64(0)))
+	})
+
+	It("uses a unix timestamp for long expirations", func() {
+		exp := expirationSeconds(60 * 24 * time.Hour)
+		Expect(exp).To(BeNumerically("~", time.Now().Add(60*24*time.Hour).Unix(), 1))
+	})
+})
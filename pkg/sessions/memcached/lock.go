@@ -0,0 +1,110 @@
+package memcached
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+const LockSuffix = "lock"
+
+// Lock is a distributed lock stored in memcached.
+// The lock is obtained with an atomic add of a random token, so that only the
+// holder of the token may refresh or release the lock.
+type Lock struct {
+	client Client
+	key    string
+	token  []byte
+}
+
+// NewLock instantiate a new lock instance. This will not yet apply a lock on Memcached side.
+// For that you have to call Obtain(ctx context.Context, expiration time.Duration)
+func NewLock(client Client, key string) sessions.Lock {
+	return &Lock{
+		client: client,
+		key:    key,
+	}
+}
+
+// Obtain obtains a distributed lock on Memcached for the configured key.
+func (l *Lock) Obtain(ctx context.Context, expiration time.Duration) error {
+	token, err := encryption.Nonce(16)
+	if err != nil {
+		return err
+	}
+
+	err = l.client.Add(ctx, l.lockKey(), token, expiration)
+	if errors.Is(err, ErrNotStored) {
+		return sessions.ErrLockNotObtained
+	}
+	if err != nil {
+		return err
+	}
+	l.token = token
+	return nil
+}
+
+// Refresh refreshes an already existing lock.
+func (l *Lock) Refresh(ctx context.Context, expiration time.Duration) error {
+	if err := l.checkHeld(ctx); err != nil {
+		return err
+	}
+	err := l.client.Touch(ctx, l.lockKey(), expiration)
+	if errors.Is(err, ErrCacheMiss) {
+		return sessions.ErrNotLocked
+	}
+	return err
+}
+
+// Peek returns true, if the lock is still applied.
+func (l *Lock) Peek(ctx context.Context) (bool, error) {
+	_, err := l.client.Get(ctx, l.lockKey())
+	if errors.Is(err, ErrCacheMiss) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release releases the lock on Memcached side.
+func (l *Lock) Release(ctx context.Context) error {
+	if err := l.checkHeld(ctx); err != nil {
+		return err
+	}
+	if err := l.client.Del(ctx, l.lockKey()); err != nil {
+		return err
+	}
+	l.token = nil
+	return nil
+}
+
+// checkHeld ensures the lock in memcached still holds our token.
+// Memcached has no compare-and-delete, so there is a small window in which
+// an expired lock obtained by another holder could be released.
+func (l *Lock) checkHeld(ctx context.Context) error {
+	if l.token == nil {
+		return sessions.ErrNotLocked
+	}
+	value, err := l.client.Get(ctx, l.lockKey())
+	if errors.Is(err, ErrCacheMiss) {
+		return sessions.ErrNotLocked
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(value, l.token) {
+		return sessions.ErrNotLocked
+	}
+	return nil
+}
+
+func (l *Lock) lockKey() string {
+	return fmt.Sprintf("%s.%s", l.key, LockSuffix)
+}
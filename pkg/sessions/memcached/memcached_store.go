@@ -0,0 +1,164 @@
+package memcached
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// SessionStore is an implementation of the persistence.Store
+// interface that stores sessions in memcached
+type SessionStore struct {
+	Client Client
+}
+
+// NewMemcachedSessionStore initialises a new instance of the SessionStore and wraps
+// it in a persistence.Manager
+func NewMemcachedSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	client, err := NewMemcachedClient(opts.Memcached)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing memcached client: %v", err)
+	}
+
+	ms := &SessionStore{
+		Client: client,
+	}
+	return persistence.NewManager(ms, cookieOpts), nil
+}
+
+// Save takes a sessions.SessionState and stores the information from it
+// to memcached, and adds a new persistence cookie on the HTTP response writer
+func (store *SessionStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	err := store.Client.Set(ctx, key, value, exp)
+	if err != nil {
+		return fmt.Errorf("error saving memcached session: %v", err)
+	}
+	return nil
+}
+
+// Load reads sessions.SessionState information from a persistence
+// cookie within the HTTP request object
+func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
+	value, err := store.Client.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading memcached session: %v", err)
+	}
+	return value, nil
+}
+
+// Clear clears any saved session information for a given persistence cookie
+// from memcached, and then clears the session
+func (store *SessionStore) Clear(ctx context.Context, key string) error {
+	err := store.Client.Del(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error clearing the session from memcached: %v", err)
+	}
+	return nil
+}
+
+// Lock creates a lock object for sessions.SessionState
+func (store *SessionStore) Lock(key string) sessions.Lock {
+	return store.Client.Lock(key)
+}
+
+// VerifyConnection verifies the memcached connections are valid and the
+// servers are responsive
+func (store *SessionStore) VerifyConnection(ctx context.Context) error {
+	return store.Client.Ping(ctx)
+}
+
+// Close closes the pooled connections to memcached
+func (store *SessionStore) Close() error {
+	if closer, ok := store.Client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewMemcachedClient makes a Client that distributes keys across the
+// configured memcached servers
+func NewMemcachedClient(opts options.MemcachedStoreOptions) (Client, error) {
+	if len(opts.Servers) == 0 {
+		return nil, errors.New("no memcached servers configured")
+	}
+
+	tlsConfig, err := buildTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{}
+	var dial dialFunc = func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	if tlsConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		dial = func(ctx context.Context, addr string) (net.Conn, error) {
+			return tlsDialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+
+	timeout := time.Duration(opts.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	mechanism := opts.AuthMechanism
+	switch mechanism {
+	case "":
+		mechanism = options.MemcachedAuthSASL
+	case options.MemcachedAuthSASL, options.MemcachedAuthASCII:
+	default:
+		return nil, fmt.Errorf("unknown memcached auth mechanism %q", mechanism)
+	}
+
+	return newClient(opts.Servers, dial, timeout, opts.Username, opts.Password, mechanism), nil
+}
+
+// buildTLSConfig returns the TLS configuration for memcached connections, or
+// nil if TLS is not enabled
+func buildTLSConfig(opts options.MemcachedStoreOptions) (*tls.Config, error) {
+	if !opts.UseTLS {
+		return nil, nil
+	}
+
+	/* #nosec G402 */
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipTLSVerify,
+	}
+
+	if opts.CAPath != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			logger.Errorf("failed to load system cert pool for memcached connection, falling back to empty cert pool")
+		}
+		if rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		certs, err := os.ReadFile(opts.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %q, %v", opts.CAPath, err)
+		}
+
+		// Append our cert to the system pool
+		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
+			logger.Errorf("no certs appended, using system certs only")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+var _ persistence.Store = (*SessionStore)(nil)
@@ -0,0 +1,196 @@
+package memcached
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	memcachedUsername = "testuser"
+	memcachedPassword = "0123456789abcdefghijklmnopqrstuv"
+)
+
+var _ = Describe("Memcached SessionStore Tests", func() {
+	Context("with a single server", func() {
+		var fs *fakeServer
+
+		BeforeEach(func() {
+			var err error
+			fs, err = newFakeServer("", "", nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(fs.Close()).To(Succeed())
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.MemcachedSessionStoreType
+				opts.Memcached.Servers = []string{fs.Addr()}
+				return NewMemcachedSessionStore(opts, cookieOpts)
+			},
+			func(d time.Duration) error {
+				fs.FastForward(d)
+				return nil
+			},
+		)
+	})
+
+	Context("with multiple servers", func() {
+		var servers []*fakeServer
+
+		BeforeEach(func() {
+			servers = nil
+			for i := 0; i < 3; i++ {
+				fs, err := newFakeServer("", "", nil)
+				Expect(err).ToNot(HaveOccurred())
+				servers = append(servers, fs)
+			}
+		})
+
+		AfterEach(func() {
+			for _, fs := range servers {
+				Expect(fs.Close()).To(Succeed())
+			}
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.MemcachedSessionStoreType
+				opts.Memcached.Servers = []string{}
+				for _, fs := range servers {
+					opts.Memcached.Servers = append(opts.Memcached.Servers, fs.Addr())
+				}
+				return NewMemcachedSessionStore(opts, cookieOpts)
+			},
+			func(d time.Duration) error {
+				for _, fs := range servers {
+					fs.FastForward(d)
+				}
+				return nil
+			},
+		)
+	})
+
+	Context("with SASL authentication", func() {
+		var fs *fakeServer
+
+		BeforeEach(func() {
+			var err error
+			fs, err = newFakeServer(memcachedUsername, memcachedPassword, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(fs.Close()).To(Succeed())
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.MemcachedSessionStoreType
+				opts.Memcached.Servers = []string{fs.Addr()}
+				opts.Memcached.Username = memcachedUsername
+				opts.Memcached.Password = memcachedPassword
+				opts.Memcached.AuthMechanism = options.MemcachedAuthSASL
+				return NewMemcachedSessionStore(opts, cookieOpts)
+			},
+			func(d time.Duration) error {
+				fs.FastForward(d)
+				return nil
+			},
+		)
+
+		It("fails to connect with the wrong password", func() {
+			client, err := NewMemcachedClient(options.MemcachedStoreOptions{
+				Servers:  []string{fs.Addr()},
+				Username: memcachedUsername,
+				Password: "wrong",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = client.Ping(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("error authenticating to memcached server")))
+		})
+	})
+
+	Context("with ASCII authentication", func() {
+		var fs *fakeServer
+
+		BeforeEach(func() {
+			var err error
+			fs, err = newFakeServer(memcachedUsername, memcachedPassword, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(fs.Close()).To(Succeed())
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.MemcachedSessionStoreType
+				opts.Memcached.Servers = []string{fs.Addr()}
+				opts.Memcached.Username = memcachedUsername
+				opts.Memcached.Password = memcachedPassword
+				opts.Memcached.AuthMechanism = options.MemcachedAuthASCII
+				return NewMemcachedSessionStore(opts, cookieOpts)
+			},
+			func(d time.Duration) error {
+				fs.FastForward(d)
+				return nil
+			},
+		)
+
+		It("fails to connect with the wrong password", func() {
+			client, err := NewMemcachedClient(options.MemcachedStoreOptions{
+				Servers:       []string{fs.Addr()},
+				Username:      memcachedUsername,
+				Password:      "wrong",
+				AuthMechanism: options.MemcachedAuthASCII,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = client.Ping(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("error authenticating to memcached server")))
+		})
+	})
+
+	Context("with TLS", func() {
+		var fs *fakeServer
+
+		BeforeEach(func() {
+			var err error
+			fs, err = newFakeServer("", "", &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(fs.Close()).To(Succeed())
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.MemcachedSessionStoreType
+				opts.Memcached.Servers = []string{fs.Addr()}
+				opts.Memcached.UseTLS = true
+				opts.Memcached.CAPath = caPath
+				return NewMemcachedSessionStore(opts, cookieOpts)
+			},
+			func(d time.Duration) error {
+				fs.FastForward(d)
+				return nil
+			},
+		)
+	})
+})
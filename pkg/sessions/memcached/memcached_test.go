@@ -0,0 +1,362 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var (
+	cert   tls.Certificate
+	caPath string
+)
+
+func TestMemcached(t *testing.T) {
+	logger.SetOutput(GinkgoWriter)
+	logger.SetErrOutput(GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memcached")
+}
+
+var _ = BeforeSuite(func() {
+	var err error
+	certBytes, keyBytes, err := util.GenerateCert("127.0.0.1")
+	Expect(err).ToNot(HaveOccurred())
+	certOut := new(bytes.Buffer)
+	Expect(pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: certBytes})).To(Succeed())
+	certData := certOut.Bytes()
+	keyOut := new(bytes.Buffer)
+	Expect(pem.Encode(keyOut, &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})).To(Succeed())
+	cert, err = tls.X509KeyPair(certData, keyOut.Bytes())
+	Expect(err).ToNot(HaveOccurred())
+
+	certFile, err := os.CreateTemp("", "cert.*.pem")
+	Expect(err).ToNot(HaveOccurred())
+	caPath = certFile.Name()
+	_, err = certFile.Write(certData)
+	defer certFile.Close()
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	Expect(os.Remove(caPath)).ToNot(HaveOccurred())
+})
+
+// fakeServer is a minimal in-memory memcached server for tests, speaking the
+// text protocol, or the binary protocol when a connection starts with a
+// binary request. Connections authenticate with ASCII authentication over the
+// text protocol, and with SASL PLAIN over the binary protocol.
+// Time can be fast forwarded to test expiration.
+type fakeServer struct {
+	listener net.Listener
+	username string
+	password string
+
+	mu     sync.Mutex
+	items  map[string]fakeItem
+	offset time.Duration
+}
+
+type fakeItem struct {
+	value   []byte
+	expires time.Time
+}
+
+func newFakeServer(username, password string, tlsConfig *tls.Config) (*fakeServer, error) {
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeServer{
+		listener: listener,
+		username: username,
+		password: password,
+		items:    make(map[string]fakeItem),
+	}
+	go s.serve()
+	return s, nil
+}
+
+func (s *fakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *fakeServer) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+func (s *fakeServer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *fakeServer) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *fakeServer) handle(nc net.Conn) {
+	defer nc.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))
+	if magic, err := rw.Peek(1); err == nil && magic[0] == magicRequest {
+		s.handleBinary(rw)
+		return
+	}
+	authenticated := s.username == ""
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		var resp string
+		switch fields[0] {
+		case "set", "add":
+			value, err := readData(rw, fields)
+			if err != nil {
+				return
+			}
+			if !authenticated {
+				authenticated = string(value) == s.username+" "+s.password
+				resp = "STORED"
+				if !authenticated {
+					resp = "CLIENT_ERROR authentication failure"
+				}
+				break
+			}
+			resp = s.store(fields, value)
+		case "get", "touch", "delete", "version":
+			if !authenticated {
+				resp = "CLIENT_ERROR unauthenticated"
+				break
+			}
+			resp = s.command(fields)
+		default:
+			resp = "ERROR"
+		}
+
+		if _, err := rw.WriteString(resp + "\r\n"); err != nil {
+			return
+		}
+		if err := rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readData(rw *bufio.ReadWriter, fields []string) ([]byte, error) {
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid storage command")
+	}
+	size, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(rw, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+func (s *fakeServer) expiry(field string) time.Time {
+	exp, _ := strconv.ParseInt(field, 10, 64)
+	switch {
+	case exp == 0:
+		return time.Time{}
+	case exp > maxRelativeExpiration:
+		return time.Unix(exp, 0)
+	default:
+		return s.now().Add(time.Duration(exp) * time.Second)
+	}
+}
+
+func (s *fakeServer) lookup(key string) (fakeItem, bool) {
+	item, ok := s.items[key]
+	if ok && !item.expires.IsZero() && !s.now().Before(item.expires) {
+		delete(s.items, key)
+		return fakeItem{}, false
+	}
+	return item, ok
+}
+
+func (s *fakeServer) store(fields []string, value []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fields[1]
+	if _, exists := s.lookup(key); exists && fields[0] == "add" {
+		return "NOT_STORED"
+	}
+	s.items[key] = fakeItem{value: value, expires: s.expiry(fields[3])}
+	return "STORED"
+}
+
+func (s *fakeServer) command(fields []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch fields[0] {
+	case "get":
+		item, ok := s.lookup(fields[1])
+		if !ok {
+			return "END"
+		}
+		return fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND", fields[1], len(item.value), item.value)
+	case "touch":
+		item, ok := s.lookup(fields[1])
+		if !ok {
+			return "NOT_FOUND"
+		}
+		item.expires = s.expiry(fields[2])
+		s.items[fields[1]] = item
+		return "TOUCHED"
+	case "delete":
+		if _, ok := s.lookup(fields[1]); !ok {
+			return "NOT_FOUND"
+		}
+		delete(s.items, fields[1])
+		return "DELETED"
+	default:
+		return "VERSION 1.6.0-fake"
+	}
+}
+
+// handleBinary serves a connection speaking the binary protocol
+func (s *fakeServer) handleBinary(rw *bufio.ReadWriter) {
+	authenticated := s.username == ""
+
+	for {
+		header := make([]byte, binaryHeaderLength)
+		if _, err := io.ReadFull(rw, header); err != nil {
+			return
+		}
+		opcode := header[1]
+		keyLength := int(binary.BigEndian.Uint16(header[2:4]))
+		extrasLength := int(header[4])
+		body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+		if _, err := io.ReadFull(rw, body); err != nil {
+			return
+		}
+		extras := body[:extrasLength]
+		key := string(body[extrasLength : extrasLength+keyLength])
+		value := body[extrasLength+keyLength:]
+
+		var status uint16
+		var respExtras, respValue []byte
+		switch {
+		case opcode == opSASLAuth:
+			authenticated = key == saslMechanismPlain && string(value) == "\x00"+s.username+"\x00"+s.password
+			if !authenticated {
+				status, respValue = statusAuthError, []byte("Auth failure")
+			}
+		case !authenticated:
+			status, respValue = statusAuthError, []byte("Auth failure")
+		default:
+			status, respExtras, respValue = s.binaryCommand(opcode, extras, key, value)
+		}
+
+		resp := make([]byte, binaryHeaderLength)
+		resp[0] = magicResponse
+		resp[1] = opcode
+		resp[4] = byte(len(respExtras))
+		binary.BigEndian.PutUint16(resp[6:8], status)
+		binary.BigEndian.PutUint32(resp[8:12], uint32(len(respExtras)+len(respValue)))
+		resp = append(append(resp, respExtras...), respValue...)
+		if _, err := rw.Write(resp); err != nil {
+			return
+		}
+		if err := rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// binaryCommand runs a binary protocol command, returning the status, extras
+// and value of its response
+func (s *fakeServer) binaryCommand(opcode byte, extras []byte, key string, value []byte) (uint16, []byte, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry := func(extras []byte) time.Time {
+		return s.expiry(strconv.FormatUint(uint64(binary.BigEndian.Uint32(extras)), 10))
+	}
+
+	switch opcode {
+	case opGet:
+		item, ok := s.lookup(key)
+		if !ok {
+			return statusKeyNotFound, nil, []byte("Not found")
+		}
+		return statusOK, make([]byte, 4), item.value
+	case opSet, opAdd:
+		if _, exists := s.lookup(key); exists && opcode == opAdd {
+			return statusKeyExists, nil, []byte("Data exists for key.")
+		}
+		s.items[key] = fakeItem{value: value, expires: expiry(extras[4:8])}
+		return statusOK, nil, nil
+	case opTouch:
+		item, ok := s.lookup(key)
+		if !ok {
+			return statusKeyNotFound, nil, []byte("Not found")
+		}
+		item.expires = expiry(extras[0:4])
+		s.items[key] = item
+		return statusOK, nil, nil
+	case opDelete:
+		if _, ok := s.lookup(key); !ok {
+			return statusKeyNotFound, nil, []byte("Not found")
+		}
+		delete(s.items, key)
+		return statusOK, nil, nil
+	case opVersion:
+		return statusOK, nil, []byte("1.6.0-fake")
+	default:
+		return 0x0081, nil, []byte("Unknown command")
+	}
+}
@@ -0,0 +1,58 @@
+package memcached
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// ringPointsPerServer is the number of points each server is given on the
+// hash ring. More points give a more even distribution of keys.
+const ringPointsPerServer = 160
+
+// hashRing distributes keys across servers using consistent hashing, so that
+// adding or removing a server only moves the keys owned by that server.
+type hashRing struct {
+	addrs  []string
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash uint32
+	addr string
+}
+
+func newHashRing(addrs []string) *hashRing {
+	r := &hashRing{
+		addrs:  addrs,
+		points: make([]ringPoint, 0, len(addrs)*ringPointsPerServer),
+	}
+	for _, addr := range addrs {
+		for i := 0; i < ringPointsPerServer; i++ {
+			r.points = append(r.points, ringPoint{
+				hash: crc32.ChecksumIEEE([]byte(addr + "-" + strconv.Itoa(i))),
+				addr: addr,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// get returns the address of the server that owns the key
+func (r *hashRing) get(key string) string {
+	if len(r.addrs) == 1 {
+		return r.addrs[0]
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].addr
+}
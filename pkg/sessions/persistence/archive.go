@@ -0,0 +1,93 @@
+package persistence
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// ExportSessions passes the sessions of the Store to export as they are
+// saved, so that they can be imported with their tickets. Sessions are
+// exported without the envelope encryption of the Store, if any, so that
+// they can be imported into a Store using other keys.
+func (m *Manager) ExportSessions(ctx context.Context, export func(sessions.ArchivedSession) error) (int, error) {
+	lister, ok := m.Store.(Lister)
+	if !ok {
+		return 0, errListNotSupported
+	}
+	// Ticket IDs start with the name of the cookie
+	keys, err := lister.List(ctx, m.Options.Name+"-")
+	if err != nil {
+		return 0, fmt.Errorf("error listing the sessions: %v", err)
+	}
+	sort.Strings(keys)
+
+	exported := 0
+	for _, key := range keys {
+		if !m.isTicketID(key) {
+			// The locks of the sessions are held alongside them
+			continue
+		}
+		value, err := m.Store.Load(ctx, key)
+		if err != nil {
+			// The session expired since the keys were listed
+			continue
+		}
+		archived := sessions.ArchivedSession{ID: key, Value: value}
+		if index, err := m.Store.Load(ctx, indexKey(key)); err == nil {
+			archived.Index = index
+		}
+
+		if err := export(archived); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, nil
+}
+
+// ImportSessions saves the sessions read in the Store, to be loaded with the
+// tickets they were exported with. They expire once the session cookie of
+// the Manager would.
+func (m *Manager) ImportSessions(ctx context.Context, read func() (*sessions.ArchivedSession, error)) (int, error) {
+	imported := 0
+	for {
+		archived, err := read()
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+		if err != nil {
+			return imported, err
+		}
+		if !m.isTicketID(archived.ID) {
+			return imported, fmt.Errorf("session %q was not exported from a session store of the cookie %s", archived.ID, m.Options.Name)
+		}
+
+		if err := m.Store.Save(ctx, archived.ID, archived.Value, m.Options.Expire); err != nil {
+			return imported, fmt.Errorf("error importing session %s: %v", archived.ID, err)
+		}
+		if archived.Index != nil {
+			if err := m.Store.Save(ctx, indexKey(archived.ID), archived.Index, m.Options.Expire); err != nil {
+				return imported, fmt.Errorf("error importing the index of session %s: %v", archived.ID, err)
+			}
+		}
+		imported++
+	}
+}
+
+// isTicketID returns whether the key is the ID of a ticket of the Manager,
+// rather than another key held alongside the sessions
+func (m *Manager) isTicketID(key string) bool {
+	id, ok := strings.CutPrefix(key, m.Options.Name+"-")
+	if !ok || len(id) != hex.EncodedLen(ticketIDLength) {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,139 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session Archive Tests", func() {
+	var ctx context.Context
+	var cookieOpts *options.Cookie
+	var source, target *tests.MockStore
+	var exporter, importer *Manager
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cookieOpts = &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdef0123456789abcdef",
+			Path:   "/",
+			Expire: time.Hour,
+		}
+		source = tests.NewMockStore()
+		target = tests.NewMockStore()
+		exporter = NewManager(source, cookieOpts)
+		exporter.Index = true
+		importer = NewManager(target, cookieOpts)
+	})
+
+	// save saves a new session for the email, returning its cookie
+	save := func(email string) *http.Cookie {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		Expect(exporter.Save(rw, req, &sessionsapi.SessionState{Email: email})).To(Succeed())
+		return rw.Result().Cookies()[0]
+	}
+
+	export := func() []sessionsapi.ArchivedSession {
+		archived := []sessionsapi.ArchivedSession{}
+		exported, err := exporter.ExportSessions(ctx, func(s sessionsapi.ArchivedSession) error {
+			archived = append(archived, s)
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exported).To(Equal(len(archived)))
+		return archived
+	}
+
+	// reader returns a function reading the sessions, and then io.EOF
+	reader := func(archived []sessionsapi.ArchivedSession) func() (*sessionsapi.ArchivedSession, error) {
+		return func() (*sessionsapi.ArchivedSession, error) {
+			if len(archived) == 0 {
+				return nil, io.EOF
+			}
+			s := archived[0]
+			archived = archived[1:]
+			return &s, nil
+		}
+	}
+
+	It("imports the sessions exported, which load with their cookies", func() {
+		alice := save("alice@example.com")
+		bob := save("bob@example.com")
+		// Locks are held alongside the sessions
+		Expect(source.Save(ctx, "_oauth2_proxy-lock", []byte("lock"), time.Hour)).To(Succeed())
+
+		archived := export()
+		Expect(archived).To(HaveLen(2))
+		imported, err := importer.ImportSessions(ctx, reader(archived))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(imported).To(Equal(2))
+
+		for email, cookie := range map[string]*http.Cookie{"alice@example.com": alice, "bob@example.com": bob} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(cookie)
+			session, err := importer.Load(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.Email).To(Equal(email))
+		}
+
+		importer.Index = true
+		infos, err := importer.ListSessions(ctx, sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+	})
+
+	It("exports the sessions without their index", func() {
+		exporter.Index = false
+		save("alice@example.com")
+
+		archived := export()
+		Expect(archived).To(HaveLen(1))
+		Expect(archived[0].Index).To(BeNil())
+	})
+
+	It("skips the sessions that expired", func() {
+		save("alice@example.com")
+		source.FastForward(2 * time.Hour)
+		Expect(export()).To(BeEmpty())
+	})
+
+	It("stops exporting when a session cannot be exported", func() {
+		save("alice@example.com")
+		save("bob@example.com")
+
+		exported, err := exporter.ExportSessions(ctx, func(sessionsapi.ArchivedSession) error {
+			return errors.New("disk full")
+		})
+		Expect(err).To(MatchError("disk full"))
+		Expect(exported).To(Equal(0))
+	})
+
+	It("rejects the sessions of other cookies", func() {
+		save("alice@example.com")
+		archived := export()
+
+		importer.Options = &options.Cookie{Name: "_other", Expire: time.Hour}
+		imported, err := importer.ImportSessions(ctx, reader(archived))
+		Expect(err).To(MatchError(ContainSubstring("was not exported from a session store of the cookie _other")))
+		Expect(imported).To(Equal(0))
+	})
+
+	It("returns the errors reading the sessions", func() {
+		imported, err := importer.ImportSessions(ctx, func() (*sessionsapi.ArchivedSession, error) {
+			return nil, errors.New("invalid archive")
+		})
+		Expect(err).To(MatchError("invalid archive"))
+		Expect(imported).To(Equal(0))
+	})
+})
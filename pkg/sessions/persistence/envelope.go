@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption/kms"
+)
+
+// EnvelopeStore wraps a Store and envelope encrypts every value with a data
+// key protected by an external KMS before it reaches the underlying Store.
+// Values read from a compromised Store cannot be decrypted without the KMS.
+type EnvelopeStore struct {
+	Store
+	Envelope *kms.Envelope
+}
+
+// NewEnvelopeStore wraps the Store with envelope encryption
+func NewEnvelopeStore(store Store, envelope *kms.Envelope) *EnvelopeStore {
+	return &EnvelopeStore{
+		Store:    store,
+		Envelope: envelope,
+	}
+}
+
+// Save seals the value before saving it in the underlying Store
+func (s *EnvelopeStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	sealed, err := s.Envelope.Seal(ctx, value)
+	if err != nil {
+		return fmt.Errorf("error envelope encrypting session: %v", err)
+	}
+	return s.Store.Save(ctx, key, sealed, exp)
+}
+
+// Load opens a value loaded from the underlying Store
+func (s *EnvelopeStore) Load(ctx context.Context, key string) ([]byte, error) {
+	sealed, err := s.Store.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := s.Envelope.Open(ctx, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("error envelope decrypting session: %v", err)
+	}
+	return value, nil
+}
+
+// List lists the keys of the underlying Store, which are not encrypted
+func (s *EnvelopeStore) List(ctx context.Context, prefix string) ([]string, error) {
+	lister, ok := s.Store.(Lister)
+	if !ok {
+		return nil, errListNotSupported
+	}
+	return lister.List(ctx, prefix)
+}
+
+// VerifyConnection verifies the underlying Store and that a data key can be
+// obtained from the KMS
+func (s *EnvelopeStore) VerifyConnection(ctx context.Context) error {
+	if err := s.Store.VerifyConnection(ctx); err != nil {
+		return err
+	}
+	if _, err := s.Envelope.Seal(ctx, nil); err != nil {
+		return fmt.Errorf("error obtaining a kms data key: %v", err)
+	}
+	return nil
+}
+
+// Close closes the underlying Store, if it holds connections to release
+func (s *EnvelopeStore) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption/kms"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// staticKeyManager returns the same data key for every session
+type staticKeyManager struct{}
+
+func (staticKeyManager) GenerateDataKey(_ context.Context) ([]byte, []byte, error) {
+	return []byte("0123456789abcdefghijklmnopqrstuv"), []byte("wrapped"), nil
+}
+
+func (staticKeyManager) Decrypt(_ context.Context, _ []byte) ([]byte, error) {
+	return []byte("0123456789abcdefghijklmnopqrstuv"), nil
+}
+
+var _ = Describe("Envelope Store Tests", func() {
+	var ms *tests.MockStore
+	BeforeEach(func() {
+		ms = tests.NewMockStore()
+	})
+
+	tests.RunSessionStoreTests(
+		func(_ *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+			return NewManager(NewEnvelopeStore(ms, kms.NewEnvelope(staticKeyManager{}, time.Hour)), cookieOpts), nil
+		},
+		func(d time.Duration) error {
+			ms.FastForward(d)
+			return nil
+		})
+
+	It("stores sealed values in the underlying store", func() {
+		ctx := context.Background()
+		store := NewEnvelopeStore(ms, kms.NewEnvelope(staticKeyManager{}, time.Hour))
+		Expect(store.Save(ctx, "key", []byte("session"), time.Hour)).To(Succeed())
+
+		raw, err := ms.Load(ctx, "key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).ToNot(ContainSubstring("session"))
+
+		value, err := store.Load(ctx, "key")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("session")))
+
+		Expect(ms.Save(ctx, "plain", []byte("session"), time.Hour)).To(Succeed())
+		_, err = store.Load(ctx, "plain")
+		Expect(err).To(MatchError("error envelope decrypting session: value is not envelope encrypted"))
+	})
+})
@@ -0,0 +1,231 @@
+package persistence
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// indexPrefix starts the keys the index of each session is saved under,
+// followed by the ID of the session ticket
+const indexPrefix = "index:"
+
+var errListNotSupported = errors.New("the session store cannot list the sessions it holds")
+
+// indexKey returns the key the index of the session with the ticket ID is
+// saved under
+func indexKey(id string) string {
+	return indexPrefix + id
+}
+
+// index is the value saved under the index key of a session. The user of
+// the session is encrypted, and only keyed hashes of its email and user are
+// saved alongside, so that the sessions of a user are found without
+// decrypting the index of every session.
+type index struct {
+	EmailHash string `json:"emailHash,omitempty"`
+	UserHash  string `json:"userHash,omitempty"`
+	Info      []byte `json:"info"`
+}
+
+// indexCipher encrypts the indexes and hashes their email and user with
+// keys derived from a cookie encryption key
+type indexCipher struct {
+	cipher    encryption.Cipher
+	lookupKey []byte
+}
+
+// indexCiphers returns the ciphers of the keys of the cookie secret,
+// followed by those of the previous cookie secret once the secret reference
+// has been rotated. Indexes are saved with the first, and loaded with any.
+func (m *Manager) indexCiphers() ([]indexCipher, error) {
+	cookieKeys := m.Options.GetCookieKeys()
+	ciphers := make([]indexCipher, 0, len(cookieKeys))
+	for _, keys := range cookieKeys {
+		encryptionKey, err := encryption.DeriveKey(encryption.KeyDerivationHKDF, keys.EncryptionKey, encryption.SessionIndexEncryptionKeyLabel, 32)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving the session index encryption key: %v", err)
+		}
+		c, err := encryption.NewGCMCipher(encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the session index cipher: %v", err)
+		}
+		lookupKey, err := encryption.DeriveKey(encryption.KeyDerivationHKDF, keys.EncryptionKey, encryption.SessionIndexLookupKeyLabel, 32)
+		if err != nil {
+			return nil, fmt.Errorf("error deriving the session index lookup key: %v", err)
+		}
+		ciphers = append(ciphers, indexCipher{cipher: c, lookupKey: lookupKey})
+	}
+	return ciphers, nil
+}
+
+// hashEmail returns the keyed hash of the email, regardless of its case
+func (c indexCipher) hashEmail(email string) string {
+	return c.hash(strings.ToLower(email))
+}
+
+// hash returns the keyed hash of the value, empty for an empty value
+func (c indexCipher) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.lookupKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mayMatch returns whether the hashes of the index match the email and user
+// of the filter, before the index is decrypted
+func (c indexCipher) mayMatch(idx *index, filter sessions.SessionFilter) bool {
+	if filter.Email != "" && !hmac.Equal([]byte(idx.EmailHash), []byte(c.hashEmail(filter.Email))) {
+		return false
+	}
+	if filter.User != "" && !hmac.Equal([]byte(idx.UserHash), []byte(c.hash(filter.User))) {
+		return false
+	}
+	return true
+}
+
+// saveIndex saves the user of the session, encrypted with a key derived
+// from the cookie secret rather than by the ticket, so that the session can
+// be found without its ticket
+func (m *Manager) saveIndex(ctx context.Context, id string, s *sessions.SessionState, exp time.Duration) error {
+	ciphers, err := m.indexCiphers()
+	if err != nil {
+		return err
+	}
+	c := ciphers[0]
+
+	info, err := json.Marshal(sessions.SessionInfo{
+		ID:                id,
+		Email:             s.Email,
+		User:              s.User,
+		PreferredUsername: s.PreferredUsername,
+		Groups:            s.Groups,
+		CreatedAt:         s.CreatedAt,
+		ExpiresOn:         s.ExpiresOn,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding the session index: %v", err)
+	}
+	encrypted, err := c.cipher.Encrypt(info)
+	if err != nil {
+		return fmt.Errorf("error encrypting the session index: %v", err)
+	}
+	value, err := json.Marshal(index{
+		EmailHash: c.hashEmail(s.Email),
+		UserHash:  c.hash(s.User),
+		Info:      encrypted,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding the session index: %v", err)
+	}
+	if err := m.Store.Save(ctx, indexKey(id), value, exp); err != nil {
+		return fmt.Errorf("error saving the session index: %v", err)
+	}
+	return nil
+}
+
+// ListSessions returns the indexed sessions of the Store matching the
+// filter, by their ID
+func (m *Manager) ListSessions(ctx context.Context, filter sessions.SessionFilter) ([]sessions.SessionInfo, error) {
+	lister, ok := m.Store.(Lister)
+	if !ok {
+		return nil, errListNotSupported
+	}
+	ciphers, err := m.indexCiphers()
+	if err != nil {
+		return nil, err
+	}
+	// Ticket IDs start with the name of the cookie
+	keys, err := lister.List(ctx, indexKey(m.Options.Name+"-"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing the sessions: %v", err)
+	}
+
+	infos := make([]sessions.SessionInfo, 0, len(keys))
+	for _, key := range keys {
+		info, err := m.loadIndex(ctx, key, filter, ciphers)
+		if err != nil || info == nil {
+			// The session expired since the keys were listed, or does not
+			// match the filter
+			continue
+		}
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos, nil
+}
+
+// GetSession returns the indexed session with the ticket ID
+func (m *Manager) GetSession(ctx context.Context, id string) (*sessions.SessionInfo, error) {
+	ciphers, err := m.indexCiphers()
+	if err != nil {
+		return nil, err
+	}
+	info, err := m.loadIndex(ctx, indexKey(id), sessions.SessionFilter{}, ciphers)
+	if err != nil || info == nil {
+		return nil, sessions.ErrSessionNotFound
+	}
+	return info, nil
+}
+
+// RevokeSession clears the indexed session with the ticket ID from the
+// Store, so that its ticket no longer loads it
+func (m *Manager) RevokeSession(ctx context.Context, id string) error {
+	ctx = sessions.WithConsistentRead(ctx)
+	if _, err := m.GetSession(ctx, id); err != nil {
+		return err
+	}
+
+	if m.Refresher != nil {
+		m.Refresher.forget(id)
+	}
+	if err := m.Store.Clear(ctx, id); err != nil {
+		return err
+	}
+	return m.Store.Clear(ctx, indexKey(id))
+}
+
+// loadIndex loads and decrypts the index saved under the key, returning nil
+// when it does not match the filter or none of the ciphers decrypt it
+func (m *Manager) loadIndex(ctx context.Context, key string, filter sessions.SessionFilter, ciphers []indexCipher) (*sessions.SessionInfo, error) {
+	value, err := m.Store.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	idx := &index{}
+	if err := json.Unmarshal(value, idx); err != nil {
+		return nil, fmt.Errorf("error decoding the session index: %v", err)
+	}
+
+	for _, c := range ciphers {
+		if !c.mayMatch(idx, filter) {
+			continue
+		}
+		decrypted, err := c.cipher.Decrypt(idx.Info)
+		if err != nil {
+			// The index was saved with the keys of another cookie secret
+			continue
+		}
+		info := &sessions.SessionInfo{}
+		if err := json.Unmarshal(decrypted, info); err != nil {
+			return nil, fmt.Errorf("error decoding the session index: %v", err)
+		}
+		if !filter.Matches(*info) {
+			return nil, nil
+		}
+		return info, nil
+	}
+	return nil, nil
+}
@@ -17,3 +17,10 @@ type Store interface {
 	Lock(key string) sessions.Lock
 	VerifyConnection(context.Context) error
 }
+
+// Lister is implemented by Stores that can list the keys they hold, which
+// the Manager needs to list the sessions it has indexed
+type Lister interface {
+	// List returns the keys starting with the prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
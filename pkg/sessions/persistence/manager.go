@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -15,6 +16,37 @@ import (
 type Manager struct {
 	Store   Store
 	Options *options.Cookie
+
+	// Refresher, if set, refreshes the sessions saved and loaded by the
+	// Manager in the background
+	Refresher *Refresher
+
+	// Reaper, if set, deletes the expired and orphaned sessions of the Store
+	// when the sessions are reaped
+	Reaper *Reaper
+
+	// Compression, if set, compresses sessions before they are encrypted and
+	// saved in the Store
+	Compression *Compression
+
+	// Index, if set, saves the user of each session alongside it, so that
+	// the sessions can be listed and revoked by the admin API
+	Index bool
+}
+
+// Compression configures the compression of the sessions saved by a Manager.
+// Sessions saved without compression can still be loaded, and the other way
+// around, so compression can be turned on and off.
+type Compression struct {
+	// Algorithm is the algorithm sessions are compressed with, one of
+	// sessions.CompressionLZ4, sessions.CompressionZstd or
+	// sessions.CompressionBrotli, LZ4 when empty. Sessions compressed with
+	// any of them can be loaded.
+	Algorithm string
+
+	// ObserveRatio, if set, is called with the compression ratio of each
+	// session saved
+	ObserveRatio func(ratio float64)
 }
 
 // NewManager creates a Manager that can wrap a Store and manage the
@@ -41,6 +73,7 @@ func (m *Manager) Save(rw http.ResponseWriter, req *http.Request, s *sessions.Se
 			return fmt.Errorf("error creating a session ticket: %v", err)
 		}
 	}
+	tckt.compression = m.Compression
 
 	err = tckt.saveSession(s, func(key string, val []byte, exp time.Duration) error {
 		return m.Store.Save(req.Context(), key, val, exp)
@@ -49,7 +82,19 @@ func (m *Manager) Save(rw http.ResponseWriter, req *http.Request, s *sessions.Se
 		return err
 	}
 
-	return tckt.setCookie(rw, req, s)
+	if m.Index {
+		if err := m.saveIndex(req.Context(), tckt.id, s, m.Options.Expire); err != nil {
+			return err
+		}
+	}
+
+	if err := tckt.setCookie(rw, req, s); err != nil {
+		return err
+	}
+	if m.Refresher != nil {
+		m.Refresher.track(tckt, s, true)
+	}
+	return nil
 }
 
 // Load reads sessions.SessionState information from a session store. It will
@@ -59,13 +104,21 @@ func (m *Manager) Load(req *http.Request) (*sessions.SessionState, error) {
 	if err != nil {
 		return nil, err
 	}
+	tckt.compression = m.Compression
 
-	return tckt.loadSession(
+	session, err := tckt.loadSession(
 		func(key string) ([]byte, error) {
 			return m.Store.Load(req.Context(), key)
 		},
 		m.Store.Lock,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if m.Refresher != nil {
+		m.Refresher.track(tckt, session, false)
+	}
+	return session, nil
 }
 
 // Clear clears any saved session information for a given ticket cookie.
@@ -87,6 +140,14 @@ func (m *Manager) Clear(rw http.ResponseWriter, req *http.Request) error {
 	}
 
 	tckt.clearCookie(rw, req)
+	if m.Refresher != nil {
+		m.Refresher.forget(tckt.id)
+	}
+	if m.Index {
+		if err := m.Store.Clear(req.Context(), indexKey(tckt.id)); err != nil {
+			return err
+		}
+	}
 	return tckt.clearSession(func(key string) error {
 		return m.Store.Clear(req.Context(), key)
 	})
@@ -96,3 +157,20 @@ func (m *Manager) Clear(rw http.ResponseWriter, req *http.Request) error {
 func (m *Manager) VerifyConnection(ctx context.Context) error {
 	return m.Store.VerifyConnection(ctx)
 }
+
+// Close closes the underlying store, if it holds connections to release
+func (m *Manager) Close() error {
+	if closer, ok := m.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// RefreshInBackground refreshes sessions before they expire until the context
+// is cancelled. It returns immediately if the Manager has no Refresher.
+func (m *Manager) RefreshInBackground(ctx context.Context, refresh sessions.RefreshSessionFunc) error {
+	if m.Refresher == nil {
+		return nil
+	}
+	return m.Refresher.run(ctx, m.Store, refresh)
+}
@@ -1,12 +1,16 @@
 package persistence
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Persistence Manager Tests", func() {
@@ -23,3 +27,160 @@ var _ = Describe("Persistence Manager Tests", func() {
 			return nil
 		})
 })
+
+var _ = Describe("Persistence Manager Index Tests", func() {
+	var ms *tests.MockStore
+	var manager *Manager
+
+	BeforeEach(func() {
+		ms = tests.NewMockStore()
+		manager = NewManager(ms, &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdef0123456789abcdef",
+			Path:   "/",
+			Expire: time.Hour,
+		})
+		manager.Index = true
+	})
+
+	// save saves a new session for the email, returning its cookie
+	save := func(email string, groups ...string) *http.Cookie {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		Expect(manager.Save(rw, req, &sessionsapi.SessionState{Email: email, User: email, Groups: groups})).To(Succeed())
+		return rw.Result().Cookies()[0]
+	}
+
+	load := func(cookie *http.Cookie) error {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		_, err := manager.Load(req)
+		return err
+	}
+
+	ticketID := func(cookie *http.Cookie) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		t, err := decodeTicketFromRequest(req, manager.Options)
+		Expect(err).ToNot(HaveOccurred())
+		return t.id
+	}
+
+	It("lists the users of the sessions", func() {
+		alice := save("alice@example.com", "admins")
+		bob := save("bob@example.com")
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+		emails := map[string]string{}
+		for _, info := range infos {
+			emails[info.ID] = info.Email
+			Expect(info.CreatedAt).ToNot(BeNil())
+		}
+		Expect(emails).To(Equal(map[string]string{
+			ticketID(alice): "alice@example.com",
+			ticketID(bob):   "bob@example.com",
+		}))
+
+		info, err := manager.GetSession(context.Background(), ticketID(alice))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Groups).To(Equal([]string{"admins"}))
+	})
+
+	It("revokes sessions by their ID", func() {
+		alice := save("alice@example.com")
+		bob := save("bob@example.com")
+
+		Expect(manager.RevokeSession(context.Background(), ticketID(alice))).To(Succeed())
+		Expect(load(alice)).ToNot(Succeed())
+		Expect(load(bob)).To(Succeed())
+
+		_, err := manager.GetSession(context.Background(), ticketID(alice))
+		Expect(err).To(MatchError(sessionsapi.ErrSessionNotFound))
+		Expect(manager.RevokeSession(context.Background(), ticketID(alice))).To(MatchError(sessionsapi.ErrSessionNotFound))
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+	})
+
+	It("removes the index of cleared and expired sessions", func() {
+		alice := save("alice@example.com")
+		save("bob@example.com")
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(alice)
+		Expect(manager.Clear(rw, req)).To(Succeed())
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Email).To(Equal("bob@example.com"))
+
+		ms.FastForward(2 * time.Hour)
+		infos, err = manager.ListSessions(context.Background(), sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+
+	It("finds the sessions by their email, user and group", func() {
+		alice := save("alice@example.com", "admins")
+		save("bob@example.com")
+
+		for _, filter := range []sessionsapi.SessionFilter{
+			{Email: "Alice@Example.com"},
+			{User: "alice@example.com"},
+			{Group: "admins"},
+			{Email: "alice@example.com", Group: "admins"},
+		} {
+			infos, err := manager.ListSessions(context.Background(), filter)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(infos).To(HaveLen(1))
+			Expect(infos[0].ID).To(Equal(ticketID(alice)))
+		}
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{Email: "bob@example.com", Group: "admins"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+
+	It("encrypts the index, holding only keyed hashes of the email and user", func() {
+		id := ticketID(save("alice@example.com", "admins"))
+
+		value, err := ms.Load(context.Background(), indexKey(id))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(value)).ToNot(ContainSubstring("alice"))
+		Expect(string(value)).ToNot(ContainSubstring("admins"))
+
+		// The index cannot be read with the keys of another cookie secret
+		manager.Options = &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "fedcba9876543210fedcba9876543210",
+			Path:   "/",
+			Expire: time.Hour,
+		}
+		_, err = manager.GetSession(context.Background(), id)
+		Expect(err).To(MatchError(sessionsapi.ErrSessionNotFound))
+
+		// Until it is the previous secret of the rotated secret reference
+		manager.Options.SetPreviousSecret("0123456789abcdef0123456789abcdef")
+		info, err := manager.GetSession(context.Background(), id)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Email).To(Equal("alice@example.com"))
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{Email: "alice@example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+	})
+
+	It("does not index the sessions when disabled", func() {
+		manager.Index = false
+		save("alice@example.com")
+
+		infos, err := manager.ListSessions(context.Background(), sessionsapi.SessionFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+})
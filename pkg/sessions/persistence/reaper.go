@@ -0,0 +1,147 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// Reapable is implemented by Stores that hold expired keys, or keys left
+// behind by keys that no longer exist, which they do not delete themselves
+type Reapable interface {
+	// Reap deletes up to limit of the expired or orphaned keys starting with
+	// the prefix, and returns how many of each it deleted
+	Reap(ctx context.Context, prefix string, limit int) (sessions.ReapResult, error)
+}
+
+// Reaper deletes the expired and orphaned keys of a Store in batches, at a
+// limited rate so that the Store is not overloaded
+type Reaper struct {
+	// BatchSize is the maximum number of keys deleted at once
+	BatchSize int
+	// Rate is the maximum number of keys deleted per second, unlimited if 0
+	Rate int
+}
+
+// NewReaper creates a Reaper from the configuration given
+func NewReaper(opts options.SessionReaperOptions) *Reaper {
+	return &Reaper{
+		BatchSize: opts.BatchSize,
+		Rate:      opts.Rate,
+	}
+}
+
+// ReapSessions deletes the expired keys of the Store, when it does not delete
+// them itself, and the indexes of the sessions that no longer exist
+func (m *Manager) ReapSessions(ctx context.Context) (sessions.ReapResult, error) {
+	if m.Reaper == nil {
+		return sessions.ReapResult{}, nil
+	}
+
+	// The keys are reaped without opening their envelope encryption
+	store := m.Store
+	if envelope, ok := store.(*EnvelopeStore); ok {
+		store = envelope.Store
+	}
+	if err := store.VerifyConnection(ctx); err != nil {
+		return sessions.ReapResult{}, fmt.Errorf("error connecting to the session store: %v", err)
+	}
+
+	// Ticket IDs start with the name of the cookie
+	prefix := m.Options.Name + "-"
+	result, err := m.Reaper.reapKeys(ctx, store, prefix)
+	if err != nil {
+		return result, err
+	}
+	orphaned, err := m.Reaper.reapIndexes(ctx, store, prefix)
+	result.Orphaned += orphaned
+	return result, err
+}
+
+// reapKeys deletes the expired and orphaned keys of the Store in batches,
+// until a batch is not full
+func (r *Reaper) reapKeys(ctx context.Context, store Store, prefix string) (sessions.ReapResult, error) {
+	total := sessions.ReapResult{}
+	reapable, ok := store.(Reapable)
+	if !ok {
+		return total, nil
+	}
+
+	for {
+		result, err := reapable.Reap(ctx, prefix, r.BatchSize)
+		total.Expired += result.Expired
+		total.Orphaned += result.Orphaned
+		if err != nil {
+			return total, fmt.Errorf("error reaping sessions: %v", err)
+		}
+		deleted := result.Expired + result.Orphaned
+		if deleted < r.BatchSize {
+			return total, nil
+		}
+		if err := r.wait(ctx, deleted); err != nil {
+			return total, err
+		}
+	}
+}
+
+// reapIndexes deletes the indexes of the sessions that no longer exist,
+// which are left behind when the index cannot be cleared with its session
+func (r *Reaper) reapIndexes(ctx context.Context, store Store, prefix string) (int, error) {
+	lister, ok := store.(Lister)
+	if !ok {
+		return 0, nil
+	}
+
+	// The indexes are listed before the sessions, as sessions are saved
+	// before their index, so that the sessions of the indexes are listed
+	// unless they were cleared
+	indexes, err := lister.List(ctx, indexKey(prefix))
+	if err != nil {
+		return 0, fmt.Errorf("error listing the session indexes: %v", err)
+	}
+	keys, err := lister.List(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("error listing the sessions: %v", err)
+	}
+	existing := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		existing[key] = struct{}{}
+	}
+
+	deleted := 0
+	for _, index := range indexes {
+		if _, ok := existing[strings.TrimPrefix(index, indexPrefix)]; ok {
+			continue
+		}
+		if deleted > 0 && deleted%r.BatchSize == 0 {
+			if err := r.wait(ctx, r.BatchSize); err != nil {
+				return deleted, err
+			}
+		}
+		if err := store.Clear(ctx, index); err != nil {
+			return deleted, fmt.Errorf("error deleting the orphaned session index %s: %v", index, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// wait waits long enough after processing the keys to keep to the Rate
+func (r *Reaper) wait(ctx context.Context, keys int) error {
+	if r.Rate <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Duration(keys) * time.Second / time.Duration(r.Rate))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
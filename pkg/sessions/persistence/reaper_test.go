@@ -0,0 +1,150 @@
+package persistence
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// reapableStore is a Store that reaps the expired keys given to it, in the
+// batches it is asked for
+type reapableStore struct {
+	*tests.MockStore
+	expired []string
+	batches []int
+}
+
+func (s *reapableStore) Reap(ctx context.Context, prefix string, limit int) (sessionsapi.ReapResult, error) {
+	s.batches = append(s.batches, limit)
+	deleted := 0
+	for len(s.expired) > 0 && deleted < limit {
+		if strings.HasPrefix(s.expired[0], prefix) {
+			Expect(s.Clear(ctx, s.expired[0])).To(Succeed())
+			deleted++
+		}
+		s.expired = s.expired[1:]
+	}
+	return sessionsapi.ReapResult{Expired: deleted}, nil
+}
+
+var _ = Describe("Session Reaper Tests", func() {
+	var ctx context.Context
+	var ms *tests.MockStore
+	var manager *Manager
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ms = tests.NewMockStore()
+		manager = NewManager(ms, &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdef0123456789abcdef",
+			Path:   "/",
+			Expire: time.Hour,
+		})
+		manager.Index = true
+		manager.Reaper = NewReaper(options.SessionReaperOptions{BatchSize: 2})
+	})
+
+	// save saves a new session for the email, returning its ticket ID
+	save := func(email string) string {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		Expect(manager.Save(rw, req, &sessionsapi.SessionState{Email: email})).To(Succeed())
+
+		req = httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(rw.Result().Cookies()[0])
+		t, err := decodeTicketFromRequest(req, manager.Options)
+		Expect(err).ToNot(HaveOccurred())
+		return t.id
+	}
+
+	It("deletes the indexes of the sessions that no longer exist", func() {
+		ids := []string{save("alice@example.com"), save("bob@example.com"), save("carol@example.com")}
+		kept := save("dave@example.com")
+		for _, id := range ids {
+			Expect(ms.Clear(ctx, id)).To(Succeed())
+		}
+
+		result, err := manager.ReapSessions(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(sessionsapi.ReapResult{Orphaned: 3}))
+
+		indexes, err := ms.List(ctx, indexPrefix)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(indexes).To(ConsistOf(indexKey(kept)))
+		_, err = manager.GetSession(ctx, kept)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reaps the expired keys of the store in batches", func() {
+		store := &reapableStore{
+			MockStore: ms,
+			expired:   []string{"_oauth2_proxy-1", "other-1", "_oauth2_proxy-2", "_oauth2_proxy-3"},
+		}
+		for _, key := range store.expired {
+			Expect(ms.Save(ctx, key, []byte("value"), time.Hour)).To(Succeed())
+		}
+		manager.Store = store
+
+		result, err := manager.ReapSessions(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(sessionsapi.ReapResult{Expired: 3}))
+		Expect(store.batches).To(Equal([]int{2, 2}))
+
+		keys, err := ms.List(ctx, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keys).To(ConsistOf("other-1"))
+	})
+
+	It("reaps the keys of envelope encrypted stores without opening them", func() {
+		id := save("alice@example.com")
+		Expect(ms.Clear(ctx, id)).To(Succeed())
+		manager.Store = &EnvelopeStore{Store: ms}
+
+		result, err := manager.ReapSessions(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(sessionsapi.ReapResult{Orphaned: 1}))
+	})
+
+	It("waits between the batches to keep to the rate", func() {
+		manager.Reaper.Rate = 20
+		for i := 0; i < 3; i++ {
+			Expect(ms.Clear(ctx, save("alice@example.com"))).To(Succeed())
+		}
+
+		start := time.Now()
+		result, err := manager.ReapSessions(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Orphaned).To(Equal(3))
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("stops when the context is cancelled", func() {
+		manager.Reaper.Rate = 1
+		for i := 0; i < 3; i++ {
+			Expect(ms.Clear(ctx, save("alice@example.com"))).To(Succeed())
+		}
+
+		cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		result, err := manager.ReapSessions(cancelled)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(result.Orphaned).To(Equal(2))
+	})
+
+	It("does nothing without a reaper", func() {
+		Expect(ms.Clear(ctx, save("alice@example.com"))).To(Succeed())
+		manager.Reaper = nil
+
+		result, err := manager.ReapSessions(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(sessionsapi.ReapResult{}))
+	})
+})
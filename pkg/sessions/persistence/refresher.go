@@ -0,0 +1,197 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// refreshLockDuration is the maximum time a background refresh holds the
+// session lock for
+const refreshLockDuration = 10 * time.Second
+
+// Refresher refreshes sessions in the background before their access
+// tokens expire.
+//
+// Sessions are encrypted with the secret from their ticket, which is only
+// held by the client, so the Refresher tracks the tickets of sessions saved
+// or loaded by this Manager. Each instance of the proxy refreshes the
+// sessions it has served. The session lock prevents the same session being
+// refreshed by several instances, or by a request, at once.
+type Refresher struct {
+	BeforeExpiry time.Duration
+	Interval     time.Duration
+	Clock        clock.Clock
+
+	mu      sync.Mutex
+	tickets map[string]*trackedTicket
+}
+
+// trackedTicket is a ticket and the expiry of its session
+type trackedTicket struct {
+	ticket *ticket
+
+	// expiresOn is when the session's access token expires
+	expiresOn time.Time
+	// storedUntil is when the session cookie expires
+	storedUntil time.Time
+}
+
+// NewRefresher creates a Refresher from the configuration given
+func NewRefresher(opts options.SessionRefreshOptions) *Refresher {
+	return &Refresher{
+		BeforeExpiry: opts.BeforeExpiry,
+		Interval:     opts.Interval,
+		tickets:      make(map[string]*trackedTicket),
+	}
+}
+
+// track records the ticket of a session that was saved or loaded.
+// Sessions that cannot be refreshed are not tracked.
+// Tickets are tracked until the session cookie expires, which is extended
+// when the cookie is reissued.
+func (r *Refresher) track(t *ticket, s *sessions.SessionState, cookieIssued bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.RefreshToken == "" || s.ExpiresOn == nil {
+		delete(r.tickets, t.id)
+		return
+	}
+
+	tracked, ok := r.tickets[t.id]
+	if !ok {
+		tracked = &trackedTicket{ticket: t}
+		r.tickets[t.id] = tracked
+	}
+	tracked.expiresOn = *s.ExpiresOn
+	if !ok || cookieIssued {
+		tracked.storedUntil = r.Clock.Now().Add(t.options.Expire)
+	}
+}
+
+// forget stops tracking the ticket
+func (r *Refresher) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tickets, id)
+}
+
+// due returns the tickets of sessions that expire within BeforeExpiry,
+// dropping tickets whose session cookies have expired
+func (r *Refresher) due() []*ticket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.Clock.Now()
+	var due []*ticket
+	for id, tracked := range r.tickets {
+		if !now.Before(tracked.storedUntil) {
+			delete(r.tickets, id)
+			continue
+		}
+		if tracked.expiresOn.Sub(now) <= r.BeforeExpiry {
+			due = append(due, tracked.ticket)
+		}
+	}
+	return due
+}
+
+// run refreshes the sessions that are due every Interval until the context
+// is cancelled
+func (r *Refresher) run(ctx context.Context, store Store, refresh sessions.RefreshSessionFunc) error {
+	ticker := r.Clock.Ticker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.refreshDue(ctx, store, refresh)
+		}
+	}
+}
+
+// refreshDue refreshes each session that is due
+func (r *Refresher) refreshDue(ctx context.Context, store Store, refresh sessions.RefreshSessionFunc) {
+	for _, t := range r.due() {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.refreshTicket(ctx, t, store, refresh); err != nil {
+			logger.Errorf("Unable to refresh session in the background: %v", err)
+		}
+	}
+}
+
+// refreshTicket refreshes and saves the ticket's session under its lock.
+// The session is skipped if it is locked, as it is already being refreshed.
+func (r *Refresher) refreshTicket(ctx context.Context, t *ticket, store Store, refresh sessions.RefreshSessionFunc) error {
+	load := func(key string) ([]byte, error) {
+		return store.Load(sessions.WithConsistentRead(ctx), key)
+	}
+
+	session, err := t.loadSession(load, store.Lock)
+	if err != nil {
+		// The session has been cleared or has expired from the store
+		r.forget(t.id)
+		return nil
+	}
+
+	err = session.ObtainLock(ctx, refreshLockDuration)
+	if errors.Is(err, sessions.ErrLockNotObtained) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lock := session.Lock
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			logger.Errorf("unable to release lock: %v", err)
+		}
+	}()
+
+	// Reload the session in case it was refreshed before the lock was obtained
+	session, err = t.loadSession(load, store.Lock)
+	if err != nil {
+		r.forget(t.id)
+		return nil
+	}
+	r.track(t, session, false)
+	if session.RefreshToken == "" || session.ExpiresOn == nil {
+		return nil
+	}
+	expiresIn := session.ExpiresOn.Sub(r.Clock.Now())
+	if expiresIn > r.BeforeExpiry {
+		return nil
+	}
+
+	logger.Printf("Refreshing session in the background - User: %s; ExpiresIn: %s", session.User, expiresIn.Round(time.Second))
+	refreshed, err := refresh(ctx, session)
+	if err != nil {
+		return err
+	}
+	if !refreshed {
+		// The provider cannot refresh this session
+		r.forget(t.id)
+		return nil
+	}
+
+	session.CreatedAtNow()
+	err = t.saveSession(session, func(key string, val []byte, exp time.Duration) error {
+		return store.Save(ctx, key, val, exp)
+	})
+	if err != nil {
+		return err
+	}
+	r.track(t, session, false)
+	return nil
+}
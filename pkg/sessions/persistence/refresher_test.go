@@ -0,0 +1,219 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// lockedStore is a Store whose sessions are always locked by another request
+type lockedStore struct {
+	*tests.MockStore
+}
+
+func (lockedStore) Lock(_ string) sessionsapi.Lock {
+	return &lockedLock{}
+}
+
+type lockedLock struct {
+	sessionsapi.NoOpLock
+}
+
+func (lockedLock) Obtain(_ context.Context, _ time.Duration) error {
+	return sessionsapi.ErrLockNotObtained
+}
+
+var _ = Describe("Background Refresher Tests", func() {
+	const beforeExpiry = 5 * time.Minute
+
+	var ctx context.Context
+	var ms *tests.MockStore
+	var manager *Manager
+	var refresher *Refresher
+	var now time.Time
+	var req *http.Request
+	var refreshed []string
+	var refresh sessionsapi.RefreshSessionFunc
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ms = tests.NewMockStore()
+		now = time.Now().Truncate(time.Second)
+
+		refresher = NewRefresher(options.SessionRefreshOptions{
+			BeforeExpiry: beforeExpiry,
+			Interval:     time.Minute,
+		})
+		refresher.Clock.Set(now)
+
+		manager = NewManager(ms, &options.Cookie{
+			Name:   "_oauth2_proxy",
+			Secret: "0123456789abcdef0123456789abcdef",
+			Expire: time.Hour,
+		})
+		manager.Refresher = refresher
+
+		refreshed = []string{}
+		refresh = func(_ context.Context, s *sessionsapi.SessionState) (bool, error) {
+			refreshed = append(refreshed, s.RefreshToken)
+			s.AccessToken = "RefreshedAccessToken"
+			s.SetExpiresOn(now.Add(time.Hour))
+			return true, nil
+		}
+	})
+
+	AfterEach(func() {
+		refresher.Clock.Reset()
+	})
+
+	// save saves the session and returns a request carrying its ticket
+	save := func(expiresIn time.Duration, refreshToken string) {
+		rw := httptest.NewRecorder()
+		session := &sessionsapi.SessionState{
+			AccessToken:  "AccessToken",
+			RefreshToken: refreshToken,
+			Email:        "john.doe@example.com",
+		}
+		session.SetExpiresOn(now.Add(expiresIn))
+		Expect(manager.Save(rw, httptest.NewRequest("GET", "/", nil), session)).To(Succeed())
+
+		req = httptest.NewRequest("GET", "/", nil)
+		for _, c := range rw.Result().Cookies() {
+			req.AddCookie(c)
+		}
+	}
+
+	load := func() *sessionsapi.SessionState {
+		session, err := manager.Load(req)
+		Expect(err).ToNot(HaveOccurred())
+		return session
+	}
+
+	It("refreshes and saves sessions that are about to expire", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.refreshDue(ctx, ms, refresh)
+
+		Expect(refreshed).To(ConsistOf("RefreshToken"))
+		session := load()
+		Expect(session.AccessToken).To(Equal("RefreshedAccessToken"))
+		Expect(*session.ExpiresOn).To(BeTemporally("==", now.Add(time.Hour)))
+	})
+
+	It("does not refresh sessions again once refreshed", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.refreshDue(ctx, ms, refresh)
+		refresher.refreshDue(ctx, ms, refresh)
+
+		Expect(refreshed).To(HaveLen(1))
+	})
+
+	It("does not refresh sessions that are not about to expire", func() {
+		save(time.Hour, "RefreshToken")
+		refresher.refreshDue(ctx, ms, refresh)
+
+		Expect(refreshed).To(BeEmpty())
+		Expect(load().AccessToken).To(Equal("AccessToken"))
+	})
+
+	It("does not track sessions without a refresh token", func() {
+		save(time.Minute, "")
+		refresher.refreshDue(ctx, ms, refresh)
+
+		Expect(refreshed).To(BeEmpty())
+		Expect(refresher.tickets).To(BeEmpty())
+	})
+
+	It("skips sessions that are locked", func() {
+		save(time.Minute, "RefreshToken")
+
+		refresher.refreshDue(ctx, lockedStore{ms}, refresh)
+		Expect(refreshed).To(BeEmpty())
+		Expect(refresher.tickets).To(HaveLen(1))
+	})
+
+	It("stops tracking sessions that are cleared", func() {
+		save(time.Minute, "RefreshToken")
+		Expect(manager.Clear(httptest.NewRecorder(), req)).To(Succeed())
+
+		refresher.refreshDue(ctx, ms, refresh)
+		Expect(refreshed).To(BeEmpty())
+		Expect(refresher.tickets).To(BeEmpty())
+	})
+
+	It("stops tracking sessions that expired from the store", func() {
+		save(time.Minute, "RefreshToken")
+		ms.FastForward(2 * time.Hour)
+
+		refresher.refreshDue(ctx, ms, refresh)
+		Expect(refreshed).To(BeEmpty())
+		Expect(refresher.tickets).To(BeEmpty())
+	})
+
+	It("stops tracking sessions once the session cookie expires", func() {
+		save(2*time.Hour, "RefreshToken")
+		Expect(refresher.Clock.Add(time.Hour)).To(Succeed())
+
+		Expect(refresher.due()).To(BeEmpty())
+		Expect(refresher.tickets).To(BeEmpty())
+	})
+
+	It("stops tracking sessions the provider does not refresh", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.refreshDue(ctx, ms, func(_ context.Context, _ *sessionsapi.SessionState) (bool, error) {
+			return false, nil
+		})
+
+		Expect(refresher.tickets).To(BeEmpty())
+		Expect(load().AccessToken).To(Equal("AccessToken"))
+	})
+
+	It("keeps tracking sessions that fail to refresh", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.refreshDue(ctx, ms, func(_ context.Context, _ *sessionsapi.SessionState) (bool, error) {
+			return false, errors.New("provider unavailable")
+		})
+
+		Expect(refresher.tickets).To(HaveLen(1))
+		Expect(load().AccessToken).To(Equal("AccessToken"))
+	})
+
+	It("tracks sessions loaded by the manager", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.forget(refresher.due()[0].id)
+
+		load()
+		Expect(refresher.tickets).To(HaveLen(1))
+	})
+
+	It("refreshes sessions on each interval until cancelled", func() {
+		save(time.Minute, "RefreshToken")
+		refresher.Interval = 10 * time.Millisecond
+		refresher.Clock.Reset()
+
+		var done = make(chan struct{})
+		runCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			Expect(refresher.run(runCtx, ms, func(ctx context.Context, s *sessionsapi.SessionState) (bool, error) {
+				defer cancel()
+				return refresh(ctx, s)
+			})).To(Succeed())
+		}()
+		Eventually(done).Should(BeClosed())
+		Expect(refreshed).To(ConsistOf("RefreshToken"))
+	})
+
+	It("returns immediately from RefreshInBackground without a Refresher", func() {
+		manager.Refresher = nil
+		Expect(manager.RefreshInBackground(ctx, refresh)).To(Succeed())
+	})
+})
@@ -41,12 +41,18 @@ type ticket struct {
 	id      string
 	secret  []byte
 	options *options.Cookie
+
+	// compression, if set, compresses the session before it is encrypted
+	compression *Compression
 }
 
+// ticketIDLength is the number of random bytes of ticket IDs
+const ticketIDLength = 16
+
 // newTicket creates a new ticket. The ID & secret will be randomly created
 // with 16 byte sizes. The ID will be prefixed & hex encoded.
 func newTicket(cookieOpts *options.Cookie) (*ticket, error) {
-	rawID := make([]byte, 16)
+	rawID := make([]byte, ticketIDLength)
 	if _, err := io.ReadFull(rand.Reader, rawID); err != nil {
 		return nil, fmt.Errorf("failed to create new ticket ID: %v", err)
 	}
@@ -146,7 +152,7 @@ func decodeTicketFromRequest(req *http.Request, cookieOpts *options.Cookie) (*ti
 	}
 
 	// An existing cookie exists, try to retrieve the ticket
-	val, _, ok := encryption.Validate(requestCookie, cookieOpts.Secret, cookieOpts.Expire)
+	val, _, ok := cookies.ValidateSigned(requestCookie, cookieOpts, cookieOpts.Expire)
 	if !ok {
 		return nil, fmt.Errorf("session ticket cookie failed validation: %v", err)
 	}
@@ -162,7 +168,17 @@ func (t *ticket) saveSession(s *sessions.SessionState, saver saveFunc) error {
 	if err != nil {
 		return err
 	}
-	ciphertext, err := s.EncodeSessionState(c, false)
+
+	var ciphertext []byte
+	if t.compression != nil {
+		var ratio float64
+		ciphertext, ratio, err = s.EncodeCompressedSessionState(c, t.compression.Algorithm)
+		if err == nil && t.compression.ObserveRatio != nil {
+			t.compression.ObserveRatio(ratio)
+		}
+	} else {
+		ciphertext, err = s.EncodeSessionState(c, false)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to encode the session state with the ticket: %v", err)
 	}
@@ -183,9 +199,15 @@ func (t *ticket) loadSession(loader loadFunc, initLock initLockFunc) (*sessions.
 		return nil, err
 	}
 
-	sessionState, err := sessions.DecodeSessionState(ciphertext, c, false)
+	// The session may have been saved before compression was turned on or off
+	compressed := t.compression != nil
+	sessionState, err := sessions.DecodeSessionState(ciphertext, c, compressed)
 	if err != nil {
-		return nil, err
+		var retryErr error
+		sessionState, retryErr = sessions.DecodeSessionState(ciphertext, c, !compressed)
+		if retryErr != nil {
+			return nil, err
+		}
 	}
 	lock := initLock(t.id)
 	sessionState.Lock = lock
@@ -231,7 +253,7 @@ func (t *ticket) clearCookie(rw http.ResponseWriter, req *http.Request) {
 func (t *ticket) makeCookie(req *http.Request, value string, expires time.Duration, now time.Time) (*http.Cookie, error) {
 	if value != "" {
 		var err error
-		value, err = encryption.SignedValue(t.options.Secret, t.options.Name, []byte(value), now)
+		value, err = encryption.SignedValueWithKey(t.options.GetSigningKey(), t.options.Name, []byte(value), now)
 		if err != nil {
 			return nil, err
 		}
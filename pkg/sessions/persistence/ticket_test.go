@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -81,6 +82,29 @@ var _ = Describe("Session Ticket Tests", func() {
 			Expect(stored).To(Equal(ss))
 		})
 
+		It("compresses the session with compression", func() {
+			t, err := newTicket(&options.Cookie{Name: "dummy"})
+			Expect(err).ToNot(HaveOccurred())
+			var ratio float64
+			t.compression = &Compression{ObserveRatio: func(r float64) { ratio = r }}
+
+			c, err := t.makeCipher()
+			Expect(err).ToNot(HaveOccurred())
+
+			ss := &sessions.SessionState{User: "foobar", AccessToken: strings.Repeat("token", 100)}
+			store := map[string][]byte{}
+			err = t.saveSession(ss, func(k string, v []byte, e time.Duration) error {
+				store[k] = v
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ratio).To(BeNumerically(">", 1))
+
+			stored, err := sessions.DecodeSessionState(store[t.id], c, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stored).To(Equal(ss))
+		})
+
 		It("errors when the saveFunc errors", func() {
 			t, err := newTicket(&options.Cookie{Name: "dummy"})
 			Expect(err).ToNot(HaveOccurred())
@@ -117,6 +141,53 @@ var _ = Describe("Session Ticket Tests", func() {
 			Expect(loadedSession).To(Equal(ss))
 		})
 
+		It("loads sessions saved before compression was turned on", func() {
+			t, err := newTicket(&options.Cookie{Name: "dummy"})
+			Expect(err).ToNot(HaveOccurred())
+			t.compression = &Compression{}
+
+			c, err := t.makeCipher()
+			Expect(err).ToNot(HaveOccurred())
+
+			ss := &sessions.SessionState{
+				User: "foobar",
+				Lock: &sessions.NoOpLock{},
+			}
+			loadedSession, err := t.loadSession(
+				func(k string) ([]byte, error) {
+					return ss.EncodeSessionState(c, false)
+				},
+				func(k string) sessions.Lock {
+					return &sessions.NoOpLock{}
+				})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loadedSession).To(Equal(ss))
+		})
+
+		It("loads sessions saved with another compression algorithm", func() {
+			t, err := newTicket(&options.Cookie{Name: "dummy"})
+			Expect(err).ToNot(HaveOccurred())
+			t.compression = &Compression{Algorithm: sessions.CompressionBrotli}
+
+			c, err := t.makeCipher()
+			Expect(err).ToNot(HaveOccurred())
+
+			ss := &sessions.SessionState{
+				User: "foobar",
+				Lock: &sessions.NoOpLock{},
+			}
+			loadedSession, err := t.loadSession(
+				func(k string) ([]byte, error) {
+					encoded, _, err := ss.EncodeCompressedSessionState(c, sessions.CompressionZstd)
+					return encoded, err
+				},
+				func(k string) sessions.Lock {
+					return &sessions.NoOpLock{}
+				})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loadedSession).To(Equal(ss))
+		})
+
 		It("errors when the loadFunc errors", func() {
 			t, err := newTicket(&options.Cookie{Name: "dummy"})
 			Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// Lock is a distributed lock stored in the session lock table.
+// A lock row is owned by whoever holds its random token until it expires.
+type Lock struct {
+	store *SessionStore
+	key   string
+	token string
+}
+
+// NewLock instantiate a new lock instance. This will not yet apply a lock in PostgreSQL.
+// For that you have to call Obtain(ctx context.Context, expiration time.Duration)
+func NewLock(store *SessionStore, key string) sessions.Lock {
+	return &Lock{
+		store: store,
+		key:   key,
+	}
+}
+
+// Obtain obtains a distributed lock in PostgreSQL for the configured key.
+// An expired lock held by someone else is taken over.
+func (l *Lock) Obtain(ctx context.Context, expiration time.Duration) error {
+	nonce, err := encryption.Nonce(16)
+	if err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(nonce)
+
+	now := l.store.Clock.Now()
+	result, err := l.store.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %[1]s (key, token, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET token = EXCLUDED.token, expires_at = EXCLUDED.expires_at
+		WHERE %[1]s.expires_at <= $4`, l.store.lockTable()),
+		l.key, token, now.Add(expiration), now)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sessions.ErrLockNotObtained
+	}
+
+	l.token = token
+	return nil
+}
+
+// Refresh refreshes an already existing lock.
+func (l *Lock) Refresh(ctx context.Context, expiration time.Duration) error {
+	if l.token == "" {
+		return sessions.ErrNotLocked
+	}
+
+	now := l.store.Clock.Now()
+	result, err := l.store.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET expires_at = $1 WHERE key = $2 AND token = $3 AND expires_at > $4", l.store.lockTable()),
+		now.Add(expiration), l.key, l.token, now)
+	return checkLockAffected(result, err)
+}
+
+// Peek returns true, if the lock is still applied.
+func (l *Lock) Peek(ctx context.Context) (bool, error) {
+	var exists int
+	err := l.store.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT 1 FROM %s WHERE key = $1 AND expires_at > $2", l.store.lockTable()),
+		l.key, l.store.Clock.Now()).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release releases the lock in PostgreSQL.
+func (l *Lock) Release(ctx context.Context) error {
+	if l.token == "" {
+		return sessions.ErrNotLocked
+	}
+
+	result, err := l.store.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE key = $1 AND token = $2 AND expires_at > $3", l.store.lockTable()),
+		l.key, l.token, l.store.Clock.Now())
+	if err := checkLockAffected(result, err); err != nil {
+		return err
+	}
+	l.token = ""
+	return nil
+}
+
+// checkLockAffected returns ErrNotLocked if the statement did not match our lock
+func checkLockAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sessions.ErrNotLocked
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+)
+
+// migrations are the schema changes applied, in order, to create and update
+// the session tables. Each migration is a format string that is passed the
+// session table name.
+// Existing migrations must never be modified; add a new migration instead.
+var migrations = []string{
+	// 1: session table
+	`CREATE TABLE IF NOT EXISTS %[1]s (
+		key TEXT PRIMARY KEY,
+		value BYTEA NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+	// 2: index for the expired session cleanup job
+	`CREATE INDEX IF NOT EXISTS %[1]s_expires_at_idx ON %[1]s (expires_at)`,
+	// 3: session lock table
+	`CREATE TABLE IF NOT EXISTS %[1]s_locks (
+		key TEXT PRIMARY KEY,
+		token TEXT NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+}
+
+// migrate brings the schema for the session table up to date.
+// Migrations run in a single transaction holding an advisory lock, so that
+// multiple proxies starting at once do not race each other.
+func migrate(ctx context.Context, db *sql.DB, table string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting migration transaction: %v", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", int64(crc32.ChecksumIEEE([]byte(table)))); err != nil {
+		return fmt.Errorf("error obtaining migration lock: %v", err)
+	}
+
+	versionTable := table + "_schema_version"
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL)", versionTable)); err != nil {
+		return fmt.Errorf("error creating schema version table: %v", err)
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s", versionTable)).Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (0)", versionTable)); err != nil {
+			return fmt.Errorf("error initialising schema version: %v", err)
+		}
+	case err != nil:
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(migrations[i], table)); err != nil {
+			return fmt.Errorf("error applying migration %d: %v", i+1, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET version = $1", versionTable), len(migrations)); err != nil {
+		return fmt.Errorf("error updating schema version: %v", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,270 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// Register the postgres database/sql driver
+	_ "github.com/lib/pq"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+)
+
+// migrationTimeout is the maximum time allowed to bring the schema up to date
+const migrationTimeout = 30 * time.Second
+
+// SessionStore is an implementation of the persistence.Store
+// interface that stores sessions in PostgreSQL
+type SessionStore struct {
+	db     *sql.DB
+	table  string
+	cipher encryption.Cipher
+
+	Clock clock.Clock
+
+	// done is closed when the store is closed, to stop the cleanup job
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPostgresSessionStore initialises a new instance of the SessionStore,
+// migrates the schema, starts the expired session cleanup job and wraps
+// the store in a persistence.Manager
+func NewPostgresSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	store, err := NewSessionStore(opts.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	if err := migrate(ctx, store.db, store.table); err != nil {
+		return nil, fmt.Errorf("error migrating postgres schema: %v", err)
+	}
+
+	if opts.Postgres.CleanupInterval > 0 {
+		go store.runCleanup(opts.Postgres.CleanupInterval)
+	}
+
+	return persistence.NewManager(store, cookieOpts), nil
+}
+
+// NewSessionStore opens a connection pool to PostgreSQL.
+// It does not migrate the schema.
+func NewSessionStore(opts options.PostgresStoreOptions) (*SessionStore, error) {
+	db, err := sql.Open("postgres", opts.ConnectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("error opening postgres connection: %v", err)
+	}
+	if memory.LowMemory() {
+		db.SetMaxOpenConns(memory.StorePoolSize)
+	}
+
+	store := &SessionStore{
+		db:    db,
+		table: opts.Table,
+		done:  make(chan struct{}),
+	}
+
+	if opts.EncryptionKey != "" {
+		store.cipher, err = encryption.NewGCMCipher(encryption.SecretBytes(opts.EncryptionKey))
+		if err != nil {
+			return nil, fmt.Errorf("error initialising postgres row cipher: %v", err)
+		}
+	}
+	return store, nil
+}
+
+// Save takes a sessions.SessionState and stores the information from it
+// to PostgreSQL, and adds a new persistence cookie on the HTTP response writer
+func (store *SessionStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	value, err := store.encrypt(value)
+	if err != nil {
+		return fmt.Errorf("error saving postgres session: %v", err)
+	}
+
+	_, err = store.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (key, value, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`, store.table),
+		key, value, store.Clock.Now().Add(exp))
+	if err != nil {
+		return fmt.Errorf("error saving postgres session: %v", err)
+	}
+	return nil
+}
+
+// Load reads sessions.SessionState information from a persistence
+// cookie within the HTTP request object
+func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := store.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT value FROM %s WHERE key = $1 AND expires_at > $2", store.table),
+		key, store.Clock.Now()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("error loading postgres session: session not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading postgres session: %v", err)
+	}
+
+	value, err = store.decrypt(value)
+	if err != nil {
+		return nil, fmt.Errorf("error loading postgres session: %v", err)
+	}
+	return value, nil
+}
+
+// Clear clears any saved session information for a given persistence cookie
+// from PostgreSQL, and then clears the session
+func (store *SessionStore) Clear(ctx context.Context, key string) error {
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key = $1", store.table), key)
+	if err != nil {
+		return fmt.Errorf("error clearing the session from postgres: %v", err)
+	}
+	return nil
+}
+
+// List lists the keys starting with the prefix that have not expired
+func (store *SessionStore) List(ctx context.Context, prefix string) ([]string, error) {
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT key FROM %s WHERE key LIKE $1 ESCAPE '\' AND expires_at > $2`, store.table),
+		likeEscaper.Replace(prefix)+"%", store.Clock.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error listing postgres keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("error listing postgres keys: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing postgres keys: %v", err)
+	}
+	return keys, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Lock creates a lock object for sessions.SessionState
+func (store *SessionStore) Lock(key string) sessions.Lock {
+	return NewLock(store, key)
+}
+
+// VerifyConnection verifies the PostgreSQL connection is valid and the
+// server is responsive
+func (store *SessionStore) VerifyConnection(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
+// Close stops the expired session cleanup job and closes the connection pool
+func (store *SessionStore) Close() error {
+	store.closeOnce.Do(func() { close(store.done) })
+	return store.db.Close()
+}
+
+// DeleteExpired removes expired sessions and locks, returning the number of
+// sessions removed
+func (store *SessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	now := store.Clock.Now()
+	result, err := store.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", store.table), now)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired sessions: %v", err)
+	}
+	if _, err := store.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= $1", store.lockTable()), now); err != nil {
+		return 0, fmt.Errorf("error deleting expired session locks: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// Reap deletes up to limit of the expired sessions and locks with keys
+// starting with the prefix, so that they are deleted in batches rather than
+// all at once
+func (store *SessionStore) Reap(ctx context.Context, prefix string, limit int) (sessions.ReapResult, error) {
+	pattern := likeEscaper.Replace(prefix) + "%"
+	now := store.Clock.Now()
+
+	deleted := 0
+	for _, table := range []string{store.table, store.lockTable()} {
+		result, err := store.db.ExecContext(ctx, fmt.Sprintf(
+			`DELETE FROM %[1]s WHERE key IN (
+				SELECT key FROM %[1]s WHERE key LIKE $1 ESCAPE '\' AND expires_at <= $2 LIMIT $3
+			)`, table),
+			pattern, now, limit-deleted)
+		if err != nil {
+			return sessions.ReapResult{Expired: deleted}, fmt.Errorf("error deleting expired postgres keys: %v", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return sessions.ReapResult{Expired: deleted}, fmt.Errorf("error deleting expired postgres keys: %v", err)
+		}
+		deleted += int(rows)
+		if deleted == limit {
+			break
+		}
+	}
+	return sessions.ReapResult{Expired: deleted}, nil
+}
+
+// runCleanup periodically deletes expired sessions until the store is closed
+func (store *SessionStore) runCleanup(interval time.Duration) {
+	ticker := store.Clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-store.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		deleted, err := store.DeleteExpired(ctx)
+		cancel()
+		if err != nil {
+			logger.Errorf("Error cleaning up postgres sessions: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			logger.Printf("Deleted %d expired sessions from postgres", deleted)
+		}
+	}
+}
+
+// encrypt applies the optional row level encryption
+func (store *SessionStore) encrypt(value []byte) ([]byte, error) {
+	if store.cipher == nil {
+		return value, nil
+	}
+	return store.cipher.Encrypt(value)
+}
+
+// decrypt removes the optional row level encryption
+func (store *SessionStore) decrypt(value []byte) ([]byte, error) {
+	if store.cipher == nil {
+		return value, nil
+	}
+	return store.cipher.Decrypt(value)
+}
+
+func (store *SessionStore) lockTable() string {
+	return store.table + "_locks"
+}
+
+var _ persistence.Store = (*SessionStore)(nil)
+var _ persistence.Reapable = (*SessionStore)(nil)
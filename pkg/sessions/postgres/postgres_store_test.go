@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Postgres SessionStore Tests", func() {
+	Context("with row level encryption", func() {
+		It("encrypts and decrypts values", func() {
+			store, err := NewSessionStore(options.PostgresStoreOptions{
+				ConnectionURL: "postgres://localhost/sessions",
+				Table:         "sessions",
+				EncryptionKey: "0123456789abcdefghijklmnopqrstuv",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			encrypted, err := store.encrypt([]byte("session"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encrypted).ToNot(Equal([]byte("session")))
+
+			decrypted, err := store.decrypt(encrypted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decrypted).To(Equal([]byte("session")))
+		})
+
+		It("stores values unchanged without a key", func() {
+			store, err := NewSessionStore(options.PostgresStoreOptions{
+				ConnectionURL: "postgres://localhost/sessions",
+				Table:         "sessions",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			encrypted, err := store.encrypt([]byte("session"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encrypted).To(Equal([]byte("session")))
+		})
+
+		It("rejects an invalid key", func() {
+			_, err := NewSessionStore(options.PostgresStoreOptions{
+				ConnectionURL: "postgres://localhost/sessions",
+				Table:         "sessions",
+				EncryptionKey: "short",
+			})
+			Expect(err).To(MatchError("error initialising postgres row cipher: crypto/aes: invalid key size 5"))
+		})
+	})
+
+	Context("with a database", func() {
+		var ss sessionsapi.SessionStore
+		var table string
+
+		BeforeEach(func() {
+			table = fmt.Sprintf("oauth2_proxy_test_%d", time.Now().UnixNano())
+		})
+
+		JustAfterEach(func() {
+			if manager, ok := ss.(*persistence.Manager); ok {
+				store := manager.Store.(*SessionStore)
+				for _, suffix := range []string{"", "_locks", "_schema_version"} {
+					_, err := store.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s%s", table, suffix))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(store.Close()).To(Succeed())
+			}
+		})
+
+		getStore := func() *SessionStore {
+			return ss.(*persistence.Manager).Store.(*SessionStore)
+		}
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.PostgresSessionStoreType
+				opts.Postgres.ConnectionURL = postgresURL()
+				opts.Postgres.Table = table
+				opts.Postgres.EncryptionKey = "0123456789abcdefghijklmnopqrstuv"
+
+				var err error
+				ss, err = NewPostgresSessionStore(opts, cookieOpts)
+				if err == nil {
+					getStore().Clock.Set(time.Now())
+				}
+				return ss, err
+			},
+			func(d time.Duration) error {
+				return getStore().Clock.Add(d)
+			},
+		)
+
+		It("migrates idempotently and removes expired sessions", func() {
+			opts := &options.SessionOptions{
+				Postgres: options.PostgresStoreOptions{
+					ConnectionURL: postgresURL(),
+					Table:         table,
+				},
+			}
+			var err error
+			ss, err = NewPostgresSessionStore(opts, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+
+			store := getStore()
+			ctx := context.Background()
+			Expect(migrate(ctx, store.db, table)).To(Succeed())
+
+			store.Clock.Set(time.Now())
+			Expect(store.Save(ctx, "expiring", []byte("value"), time.Minute)).To(Succeed())
+			Expect(store.Save(ctx, "remaining", []byte("value"), time.Hour)).To(Succeed())
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+
+			deleted, err := store.DeleteExpired(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deleted).To(Equal(int64(1)))
+
+			_, err = store.Load(ctx, "remaining")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("lists the keys with a prefix", func() {
+			opts := &options.SessionOptions{
+				Postgres: options.PostgresStoreOptions{
+					ConnectionURL: postgresURL(),
+					Table:         table,
+				},
+			}
+			var err error
+			ss, err = NewPostgresSessionStore(opts, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+
+			store := getStore()
+			ctx := context.Background()
+			store.Clock.Set(time.Now())
+			for _, key := range []string{"index:_oauth2_proxy-1", "index:_oauth2_proxy-2", "index:Xoauth2Xproxy-1", "_oauth2_proxy-1"} {
+				Expect(store.Save(ctx, key, []byte("value"), time.Hour)).To(Succeed())
+			}
+			Expect(store.Save(ctx, "index:_oauth2_proxy-expiring", []byte("value"), time.Minute)).To(Succeed())
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+
+			// Wildcards in the prefix are matched literally
+			keys, err := store.List(ctx, "index:_oauth2_proxy-")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(ConsistOf("index:_oauth2_proxy-1", "index:_oauth2_proxy-2"))
+		})
+
+		It("reaps the expired keys with a prefix in batches", func() {
+			opts := &options.SessionOptions{
+				Postgres: options.PostgresStoreOptions{
+					ConnectionURL: postgresURL(),
+					Table:         table,
+				},
+			}
+			var err error
+			ss, err = NewPostgresSessionStore(opts, &options.Cookie{})
+			Expect(err).ToNot(HaveOccurred())
+
+			store := getStore()
+			ctx := context.Background()
+			store.Clock.Set(time.Now())
+			for _, key := range []string{"_oauth2_proxy-1", "_oauth2_proxy-2", "_oauth2_proxy-3", "Xoauth2Xproxy-1"} {
+				Expect(store.Save(ctx, key, []byte("value"), time.Minute)).To(Succeed())
+			}
+			Expect(store.Save(ctx, "_oauth2_proxy-remaining", []byte("value"), time.Hour)).To(Succeed())
+			Expect(store.Clock.Add(2 * time.Minute)).To(Succeed())
+
+			for _, expired := range []int{2, 1} {
+				result, err := store.Reap(ctx, "_oauth2_proxy-", 2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Expired).To(Equal(expired))
+			}
+
+			// Wildcards in the prefix are matched literally
+			deleted, err := store.DeleteExpired(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deleted).To(Equal(int64(1)))
+			_, err = store.Load(ctx, "_oauth2_proxy-remaining")
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
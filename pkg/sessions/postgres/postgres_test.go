@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// postgresURLEnv names the environment variable holding the connection URL of
+// a PostgreSQL database used for integration tests.
+// Tests requiring a database are skipped if it is not set.
+const postgresURLEnv = "OAUTH2_PROXY_TEST_POSTGRES_URL"
+
+func TestPostgres(t *testing.T) {
+	logger.SetOutput(GinkgoWriter)
+	logger.SetErrOutput(GinkgoWriter)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Postgres")
+}
+
+// postgresURL returns the integration test database URL, skipping the
+// current test if none is configured
+func postgresURL() string {
+	url := os.Getenv(postgresURLEnv)
+	if url == "" {
+		Skip(postgresURLEnv + " is not set")
+	}
+	return url
+}
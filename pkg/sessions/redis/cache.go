@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// keyspaceChannelPrefix starts the channels of the keyspace notifications
+	// of the keys of all databases, which are followed by the key
+	keyspaceChannelPrefix = "__keyspace@"
+	keyspaceChannelKey    = "__:"
+
+	// cacheResubscribeInterval is how long the cache waits before receiving
+	// notifications again after losing its subscription
+	cacheResubscribeInterval = time.Second
+)
+
+// sessionCache is an LRU cache of the values of the SessionStore, invalidated
+// with the keyspace notifications redis publishes when keys are changed, so
+// that hot sessions are not loaded from redis on every request.
+type sessionCache struct {
+	size int
+	ttl  time.Duration
+
+	// strict only serves cached values while the cache is subscribed to the
+	// keyspace notifications, so that they are only stale until the
+	// notifications of their changes are received
+	strict bool
+
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	subscribed bool
+
+	// generation counts the invalidations of the cache, so that values
+	// loaded before an invalidation are not cached after it
+	generation uint64
+
+	metrics *storeMetrics
+}
+
+// cacheEntry is a value of the sessionCache, which is used until it expires
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newSessionCache(size int, ttl time.Duration, strict bool, m *storeMetrics) *sessionCache {
+	return &sessionCache{
+		size:    size,
+		ttl:     ttl,
+		strict:  strict,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		metrics: m,
+	}
+}
+
+// get returns the cached value of the key
+func (c *sessionCache) get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok && (c.subscribed || !c.strict) {
+		entry := element.Value.(*cacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(element)
+			c.observe("hit")
+			return entry.value, true
+		}
+		c.removeElement(element)
+	}
+	c.observe("miss")
+	return nil, false
+}
+
+// currentGeneration returns the generation of the cache, to add the values
+// loaded from now on with
+func (c *sessionCache) currentGeneration() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// add caches the value of the key loaded in the generation, evicting the
+// least recently used values once the cache is full. The value is not cached
+// when the cache was invalidated since, as it may have changed.
+func (c *sessionCache) add(key string, value []byte, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation || (c.strict && !c.subscribed) {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// remove removes the cached value of the key
+func (c *sessionCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+func (c *sessionCache) removeElement(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// setSubscribed records whether the cache receives the keyspace
+// notifications. The cached values are removed either way, as they may
+// have changed while the notifications were not received.
+func (c *sessionCache) setSubscribed(subscribed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.subscribed = subscribed
+	c.generation++
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+func (c *sessionCache) observe(result string) {
+	if c.metrics != nil {
+		c.metrics.cacheRequests.WithLabelValues(result).Inc()
+	}
+}
+
+// keyspaceEventsEnabled returns whether the notify-keyspace-events setting of
+// redis publishes the keyspace notifications of the keys set, deleted and
+// expired
+func keyspaceEventsEnabled(setting string) bool {
+	if !strings.Contains(setting, "K") {
+		return false
+	}
+	// A is an alias of all the classes of events
+	return strings.Contains(setting, "A") || (strings.Contains(setting, "g") &&
+		strings.Contains(setting, "$") && strings.Contains(setting, "x"))
+}
+
+// verifyKeyspaceEvents returns an error unless redis is confirmed to publish
+// the keyspace notifications the cache is invalidated with
+func verifyKeyspaceEvents(ctx context.Context, client Client) error {
+	setting, err := client.ConfigGet(ctx, "notify-keyspace-events")
+	if err != nil {
+		return fmt.Errorf("unable to get the notify-keyspace-events setting: %v", err)
+	}
+	if !keyspaceEventsEnabled(setting) {
+		return fmt.Errorf("notify-keyspace-events %q does not publish the keyspace notifications of the keys set, deleted and expired", setting)
+	}
+	return nil
+}
+
+// runInvalidation removes the cached values of the keys starting with the
+// prefix that redis notifies the changes of, until the client is closed. The
+// subscription is renewed whenever the connection is lost.
+// A strict cache is only used once redis is confirmed to publish the keyspace
+// notifications, which is checked whenever the cache subscribes.
+func (c *sessionCache) runInvalidation(client Client, prefix string) {
+	ctx := context.Background()
+	pubsub := client.PSubscribe(ctx, keyspaceChannelPrefix+"*"+keyspaceChannelKey+globEscaper.Replace(prefix)+"*")
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			c.setSubscribed(false)
+			if errors.Is(err, redis.ErrClosed) {
+				return
+			}
+			logger.Errorf("Error receiving the redis keyspace notifications of the session cache: %v", err)
+			time.Sleep(cacheResubscribeInterval)
+			continue
+		}
+		if _, ok := msg.(*redis.Subscription); ok && c.strict {
+			if err := verifyKeyspaceEvents(ctx, client); err != nil {
+				logger.Errorf("Error enabling the strict session cache, sessions are loaded from redis: %v", err)
+				continue
+			}
+		}
+		c.handleNotification(msg)
+	}
+}
+
+// handleNotification handles a message received from the subscription to
+// the keyspace notifications
+func (c *sessionCache) handleNotification(msg interface{}) {
+	switch msg := msg.(type) {
+	case *redis.Subscription:
+		c.setSubscribed(true)
+	case *redis.Message:
+		if _, key, ok := strings.Cut(msg.Channel, keyspaceChannelKey); ok {
+			c.remove(key)
+			if c.metrics != nil {
+				c.metrics.cacheInvalidations.Inc()
+			}
+		}
+	}
+}
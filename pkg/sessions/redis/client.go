@@ -2,9 +2,14 @@ package redis
 
 import (
 	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -14,7 +19,11 @@ type Client interface {
 	Lock(key string) sessions.Lock
 	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
 	Del(ctx context.Context, key string) error
+	Scan(ctx context.Context, match string) ([]string, error)
+	RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
 	Ping(ctx context.Context) error
+	PSubscribe(ctx context.Context, patterns ...string) *redis.PubSub
+	ConfigGet(ctx context.Context, parameter string) (string, error)
 }
 
 var _ Client = (*client)(nil)
@@ -41,6 +50,14 @@ func (c *client) Del(ctx context.Context, key string) error {
 	return c.Client.Del(ctx, key).Err()
 }
 
+func (c *client) Scan(ctx context.Context, match string) ([]string, error) {
+	return scanKeys(ctx, c.Client, match)
+}
+
+func (c *client) RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, c.Client, keys, args...).Result()
+}
+
 func (c *client) Lock(key string) sessions.Lock {
 	return NewLock(c.Client, key)
 }
@@ -49,6 +66,10 @@ func (c *client) Ping(ctx context.Context) error {
 	return c.Client.Ping(ctx).Err()
 }
 
+func (c *client) ConfigGet(ctx context.Context, parameter string) (string, error) {
+	return configGet(ctx, c.Client, parameter)
+}
+
 var _ Client = (*clusterClient)(nil)
 
 type clusterClient struct {
@@ -73,6 +94,28 @@ func (c *clusterClient) Del(ctx context.Context, key string) error {
 	return c.ClusterClient.Del(ctx, key).Err()
 }
 
+// Scan scans the keys of each master of the cluster, as the keys are
+// spread across them
+func (c *clusterClient) Scan(ctx context.Context, match string) ([]string, error) {
+	var mu sync.Mutex
+	keys := []string{}
+	err := c.ClusterClient.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		masterKeys, err := scanKeys(ctx, master, match)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, masterKeys...)
+		return nil
+	})
+	return keys, err
+}
+
+func (c *clusterClient) RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, c.ClusterClient, keys, args...).Result()
+}
+
 func (c *clusterClient) Lock(key string) sessions.Lock {
 	return NewLock(c.ClusterClient, key)
 }
@@ -80,3 +123,174 @@ func (c *clusterClient) Lock(key string) sessions.Lock {
 func (c *clusterClient) Ping(ctx context.Context) error {
 	return c.ClusterClient.Ping(ctx).Err()
 }
+
+func (c *clusterClient) ConfigGet(ctx context.Context, parameter string) (string, error) {
+	return configGet(ctx, c.ClusterClient, parameter)
+}
+
+// configGet returns the value of a configuration parameter of redis, which
+// is empty when redis does not have the parameter
+func configGet(ctx context.Context, c redis.UniversalClient, parameter string) (string, error) {
+	values, err := c.ConfigGet(ctx, parameter).Result()
+	if err != nil {
+		return "", err
+	}
+	return values[parameter], nil
+}
+
+// scanKeys scans the keys of a redis server matching the glob pattern
+func scanKeys(ctx context.Context, c *redis.Client, match string) ([]string, error) {
+	keys := []string{}
+	iter := c.Scan(ctx, 0, match, 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+var _ Client = (*replicaClient)(nil)
+
+// replicaClient reads keys from the replicas of a master, and writes them to
+// the master. Keys are read from the master when the replicas may not have
+// replicated their latest value.
+type replicaClient struct {
+	Client
+	replicas *redis.Client
+
+	// maxStaleness is how long keys written by the client are read from the
+	// master, and how often the replication of the replicas is checked
+	maxStaleness time.Duration
+
+	mutex       sync.Mutex
+	written     map[string]time.Time
+	checkedAt   time.Time
+	replicating bool
+}
+
+func newReplicaClient(master Client, replicas *redis.Client, maxStaleness time.Duration) Client {
+	return &replicaClient{
+		Client:       master,
+		replicas:     replicas,
+		maxStaleness: maxStaleness,
+		written:      map[string]time.Time{},
+	}
+}
+
+// masterClient returns the client of the master of the client, for reads
+// that must see the latest value of keys
+func masterClient(c Client) Client {
+	if replicas, ok := c.(*replicaClient); ok {
+		return replicas.Client
+	}
+	return c
+}
+
+// Get reads the key from the replicas, or from the master when the replicas
+// may not have its latest value, do not have it, or cannot be read from, and
+// for consistent reads
+func (c *replicaClient) Get(ctx context.Context, key string) ([]byte, error) {
+	if !sessions.IsConsistentRead(ctx) && c.readReplicas(ctx, key) {
+		value, err := c.replicas.Get(ctx, key).Bytes()
+		if err == nil {
+			return value, nil
+		}
+	}
+	return c.Client.Get(ctx, key)
+}
+
+func (c *replicaClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	defer c.markWritten(key)
+	return c.Client.Set(ctx, key, value, expiration)
+}
+
+func (c *replicaClient) Del(ctx context.Context, key string) error {
+	defer c.markWritten(key)
+	return c.Client.Del(ctx, key)
+}
+
+// markWritten reads the key from the master until the replicas are expected
+// to have replicated its value
+func (c *replicaClient) markWritten(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.written[key] = time.Now()
+}
+
+// readReplicas returns whether the key is read from the replicas: when it was
+// not written recently by this client, and the replicas are replicating the
+// master. The replication is checked at most once per maxStaleness, during
+// reads.
+// Keys written by other instances of the proxy are only known to the master,
+// so they may be read from the replicas before they have replicated them.
+func (c *replicaClient) readReplicas(ctx context.Context, key string) bool {
+	c.mutex.Lock()
+	now := time.Now()
+	check := now.Sub(c.checkedAt) > c.maxStaleness
+	if check {
+		c.checkedAt = now
+		for written, writtenAt := range c.written {
+			if now.Sub(writtenAt) > c.maxStaleness {
+				delete(c.written, written)
+			}
+		}
+	}
+	writtenAt, written := c.written[key]
+	c.mutex.Unlock()
+
+	if check {
+		replicating := c.replicationCurrent(ctx)
+		c.mutex.Lock()
+		c.replicating = replicating
+		c.mutex.Unlock()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.replicating && (!written || now.Sub(writtenAt) > c.maxStaleness)
+}
+
+// replicationCurrent returns whether the replica the replicas client reads
+// from is connected to its master, and has heard from it within maxStaleness
+func (c *replicaClient) replicationCurrent(ctx context.Context) bool {
+	info, err := c.replicas.Info(ctx, "replication").Result()
+	if err != nil {
+		logger.Errorf("Error checking the replication of the redis replicas, reading sessions from the master: %v", err)
+		return false
+	}
+	if !isReplicationCurrent(info, c.maxStaleness) {
+		logger.Errorf("The redis replicas are not replicating the master within %s, reading sessions from the master", c.maxStaleness)
+		return false
+	}
+	return true
+}
+
+// isReplicationCurrent returns whether the replication section of the INFO
+// of a replica shows it connected to its master, and that it has heard from
+// it within maxStaleness
+func isReplicationCurrent(info string, maxStaleness time.Duration) bool {
+	linkUp, lastIO := false, -1
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if status, ok := strings.CutPrefix(line, "master_link_status:"); ok {
+			linkUp = status == "up"
+		}
+		if seconds, ok := strings.CutPrefix(line, "master_last_io_seconds_ago:"); ok {
+			if n, err := strconv.Atoi(seconds); err == nil {
+				lastIO = n
+			}
+		}
+	}
+	// Masters have no master link when there are no replicas to read from
+	return linkUp && lastIO >= 0 && time.Duration(lastIO)*time.Second <= maxStaleness
+}
+
+// Close closes the connections to the master and the replicas
+func (c *replicaClient) Close() error {
+	if err := c.replicas.Close(); err != nil {
+		return err
+	}
+	if closer, ok := c.Client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storeMetrics are the prometheus metrics recorded by the SessionStore
+type storeMetrics struct {
+	compressionRatio prometheus.Histogram
+	valueSize        prometheus.Histogram
+	chunkedValues    prometheus.Counter
+
+	cacheRequests      *prometheus.CounterVec
+	cacheInvalidations prometheus.Counter
+}
+
+func newMetrics(registerer prometheus.Registerer) *storeMetrics {
+	return &storeMetrics{
+		compressionRatio: metrics.Register(registerer, prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "oauth2_proxy_redis_session_compression_ratio",
+				Help:    "Ratio of the encoded to the compressed size of sessions saved in redis.",
+				Buckets: []float64{1, 1.25, 1.5, 2, 3, 4, 6, 8},
+			},
+		)).(prometheus.Histogram),
+		valueSize: metrics.Register(registerer, prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "oauth2_proxy_redis_session_value_bytes",
+				Help:    "Size in bytes of the session values saved in redis.",
+				Buckets: prometheus.ExponentialBuckets(1024, 2, 10),
+			},
+		)).(prometheus.Histogram),
+		chunkedValues: metrics.Register(registerer, prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_redis_session_chunked_total",
+				Help: "Total number of session values saved in redis split into chunks.",
+			},
+		)).(prometheus.Counter),
+		cacheRequests: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_redis_session_cache_requests_total",
+				Help: "Total number of sessions loaded from the redis session cache, by result (hit or miss).",
+			},
+			[]string{"result"},
+		)).(*prometheus.CounterVec),
+		cacheInvalidations: metrics.Register(registerer, prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_redis_session_cache_invalidations_total",
+				Help: "Total number of redis keyspace notifications invalidating the redis session cache.",
+			},
+		)).(prometheus.Counter),
+	}
+}
@@ -1,24 +1,42 @@
 package redis
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 )
 
+// chunkManifestPrefix starts the value saved under the key of a session that
+// is split into chunks. It is followed by the number of chunks.
+const chunkManifestPrefix = "oauth2-proxy-chunks:"
+
 // SessionStore is an implementation of the persistence.Store
 // interface that stores sessions in redis
 type SessionStore struct {
 	Client Client
+
+	// ChunkSize, if set, is the maximum size of a value saved under a single
+	// key. Larger values are split into chunks saved under separate keys.
+	ChunkSize int
+
+	cache   *sessionCache
+	metrics *storeMetrics
 }
 
 // NewRedisSessionStore initialises a new instance of the SessionStore and wraps
@@ -30,14 +48,38 @@ func NewRedisSessionStore(opts *options.SessionOptions, cookieOpts *options.Cook
 	}
 
 	rs := &SessionStore{
-		Client: client,
+		Client:    client,
+		ChunkSize: opts.Redis.ChunkSize,
+		metrics:   newMetrics(prometheus.DefaultRegisterer),
+	}
+	if opts.Redis.CacheSize > 0 {
+		strict := opts.Redis.CacheConsistency != options.RedisCacheConsistencyEventual
+		rs.cache = newSessionCache(opts.Redis.CacheSize, opts.Redis.CacheTTL, strict, rs.metrics)
+		go rs.cache.runInvalidation(client, cookieOpts.Name)
+	}
+	manager := persistence.NewManager(rs, cookieOpts)
+	if opts.Redis.Compression != "" && opts.Redis.Compression != options.RedisCompressionNone {
+		manager.Compression = &persistence.Compression{
+			Algorithm:    opts.Redis.Compression,
+			ObserveRatio: rs.metrics.compressionRatio.Observe,
+		}
 	}
-	return persistence.NewManager(rs, cookieOpts), nil
+	return manager, nil
 }
 
 // Save takes a sessions.SessionState and stores the information from it
 // to redis, and adds a new persistence cookie on the HTTP response writer
 func (store *SessionStore) Save(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	if store.cache != nil {
+		defer store.cache.remove(key)
+	}
+	if store.metrics != nil {
+		store.metrics.valueSize.Observe(float64(len(value)))
+	}
+	if store.ChunkSize > 0 && len(value) > store.ChunkSize {
+		return store.saveChunks(ctx, key, value, exp)
+	}
+
 	err := store.Client.Set(ctx, key, value, exp)
 	if err != nil {
 		return fmt.Errorf("error saving redis session: %v", err)
@@ -45,19 +87,87 @@ func (store *SessionStore) Save(ctx context.Context, key string, value []byte, e
 	return nil
 }
 
+// saveChunks splits the value into chunks saved under separate keys, and
+// saves a manifest with the number of chunks under the key. The manifest is
+// saved last so that the session is never loaded with missing chunks.
+func (store *SessionStore) saveChunks(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	count := 0
+	for start := 0; start < len(value); start += store.ChunkSize {
+		end := min(start+store.ChunkSize, len(value))
+		if err := store.Client.Set(ctx, chunkKey(key, count), value[start:end], exp); err != nil {
+			return fmt.Errorf("error saving redis session chunk: %v", err)
+		}
+		count++
+	}
+
+	err := store.Client.Set(ctx, key, []byte(chunkManifestPrefix+strconv.Itoa(count)), exp)
+	if err != nil {
+		return fmt.Errorf("error saving redis session: %v", err)
+	}
+	if store.metrics != nil {
+		store.metrics.chunkedValues.Inc()
+	}
+	return nil
+}
+
 // Load reads sessions.SessionState information from a persistence
-// cookie within the HTTP request object
+// cookie within the HTTP request object, from the session cache when it
+// holds it
 func (store *SessionStore) Load(ctx context.Context, key string) ([]byte, error) {
+	if store.cache == nil || sessions.IsConsistentRead(ctx) {
+		return store.load(ctx, key)
+	}
+
+	if value, ok := store.cache.get(key); ok {
+		return value, nil
+	}
+	generation := store.cache.currentGeneration()
+	value, err := store.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	store.cache.add(key, value, generation)
+	return value, nil
+}
+
+// load loads the value of the key from redis, joining its chunks
+func (store *SessionStore) load(ctx context.Context, key string) ([]byte, error) {
 	value, err := store.Client.Get(ctx, key)
 	if err != nil {
 		return nil, fmt.Errorf("error loading redis session: %v", err)
 	}
+
+	count, chunked := parseChunkManifest(value)
+	if !chunked {
+		return value, nil
+	}
+	value = nil
+	for i := 0; i < count; i++ {
+		chunk, err := store.Client.Get(ctx, chunkKey(key, i))
+		if err != nil {
+			return nil, fmt.Errorf("error loading redis session chunk: %v", err)
+		}
+		value = append(value, chunk...)
+	}
 	return value, nil
 }
 
 // Clear clears any saved session information for a given persistence cookie
 // from redis, and then clears the session
 func (store *SessionStore) Clear(ctx context.Context, key string) error {
+	if store.cache != nil {
+		defer store.cache.remove(key)
+	}
+	// The manifest is read from the master so that no chunk is left behind
+	if value, err := masterClient(store.Client).Get(ctx, key); err == nil {
+		count, _ := parseChunkManifest(value)
+		for i := 0; i < count; i++ {
+			if err := store.Client.Del(ctx, chunkKey(key, i)); err != nil {
+				return fmt.Errorf("error clearing the session chunks from redis: %v", err)
+			}
+		}
+	}
+
 	err := store.Client.Del(ctx, key)
 	if err != nil {
 		return fmt.Errorf("error clearing the session from redis: %v", err)
@@ -65,6 +175,123 @@ func (store *SessionStore) Clear(ctx context.Context, key string) error {
 	return nil
 }
 
+// List lists the keys starting with the prefix
+func (store *SessionStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := store.Client.Scan(ctx, globEscaper.Replace(prefix)+"*")
+	if err != nil {
+		return nil, fmt.Errorf("error listing redis keys: %v", err)
+	}
+	return keys, nil
+}
+
+// chunkReapGracePeriod is how long the chunks found orphaned are checked
+// again after, before they are reaped, as the chunks of a value are saved
+// before its manifest
+var chunkReapGracePeriod = time.Second
+
+// Reap deletes up to limit of the chunks of the values starting with the
+// prefix that no longer exist, or no longer have that many chunks. These are
+// left behind when a value is overwritten or cleared while its chunks are
+// saved, and are never expired when the value was saved without an
+// expiration. Redis expires all other keys itself.
+func (store *SessionStore) Reap(ctx context.Context, prefix string, limit int) (sessions.ReapResult, error) {
+	keys, err := store.Client.Scan(ctx, globEscaper.Replace(prefix)+"*"+chunkKeyInfix+"*")
+	if err != nil {
+		return sessions.ReapResult{}, fmt.Errorf("error listing redis session chunks: %v", err)
+	}
+
+	orphaned := []string{}
+	for _, key := range keys {
+		if len(orphaned) == limit {
+			break
+		}
+		ok, err := store.orphanedChunk(ctx, key)
+		if err != nil {
+			return sessions.ReapResult{}, err
+		}
+		if ok {
+			orphaned = append(orphaned, key)
+		}
+	}
+	if len(orphaned) == 0 {
+		return sessions.ReapResult{}, nil
+	}
+
+	timer := time.NewTimer(chunkReapGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return sessions.ReapResult{}, ctx.Err()
+	case <-timer.C:
+	}
+
+	deleted := 0
+	for _, key := range orphaned {
+		ok, err := store.orphanedChunk(ctx, key)
+		if err != nil {
+			return sessions.ReapResult{Orphaned: deleted}, err
+		}
+		if !ok {
+			continue
+		}
+		if err := store.Client.Del(ctx, key); err != nil {
+			return sessions.ReapResult{Orphaned: deleted}, fmt.Errorf("error deleting redis session chunk: %v", err)
+		}
+		deleted++
+	}
+	return sessions.ReapResult{Orphaned: deleted}, nil
+}
+
+// orphanedChunk returns whether the key is a chunk of a value that no longer
+// exists, or no longer has that many chunks. The value is read from the
+// master, as replicas may not have its latest manifest.
+func (store *SessionStore) orphanedChunk(ctx context.Context, key string) (bool, error) {
+	i := strings.LastIndex(key, chunkKeyInfix)
+	if i < 0 {
+		return false, nil
+	}
+	n, err := strconv.Atoi(key[i+len(chunkKeyInfix):])
+	if err != nil {
+		return false, nil
+	}
+
+	value, err := masterClient(store.Client).Get(ctx, key[:i])
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error loading redis session chunk manifest: %v", err)
+	}
+	count, chunked := parseChunkManifest(value)
+	return !chunked || n >= count, nil
+}
+
+// globEscaper escapes the characters of redis glob patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// chunkKey returns the key a chunk of the value of the key is saved under
+func chunkKey(key string, i int) string {
+	return fmt.Sprintf("%s%s%d", key, chunkKeyInfix, i)
+}
+
+// chunkKeyInfix separates the key of a value from the number of its chunks in
+// the keys of the chunks
+const chunkKeyInfix = "-chunk-"
+
+// parseChunkManifest returns the number of chunks when the value is the
+// manifest of a value split into chunks
+func parseChunkManifest(value []byte) (int, bool) {
+	countStr, ok := bytes.CutPrefix(value, []byte(chunkManifestPrefix))
+	if !ok {
+		return 0, false
+	}
+	count, err := strconv.Atoi(string(countStr))
+	if err != nil || count < 0 {
+		return 0, false
+	}
+	return count, true
+}
+
 // Lock creates a lock object for sessions.SessionState
 func (store *SessionStore) Lock(key string) sessions.Lock {
 	return store.Client.Lock(key)
@@ -76,6 +303,15 @@ func (store *SessionStore) VerifyConnection(ctx context.Context) error {
 	return store.Client.Ping(ctx)
 }
 
+// Close closes the connections to redis, which also stops the invalidation
+// of the session cache
+func (store *SessionStore) Close() error {
+	if closer, ok := store.Client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 // NewRedisClient makes a redis.Client (either standalone, sentinel aware, or
 // redis cluster)
 func NewRedisClient(opts options.RedisStoreOptions) (Client, error) {
@@ -111,7 +347,7 @@ func buildSentinelClient(opts options.RedisStoreOptions) (Client, error) {
 		return nil, err
 	}
 
-	client := redis.NewFailoverClient(&redis.FailoverOptions{
+	failoverOpts := &redis.FailoverOptions{
 		MasterName:       opts.SentinelMasterName,
 		SentinelAddrs:    addrs,
 		SentinelPassword: opts.SentinelPassword,
@@ -119,8 +355,18 @@ func buildSentinelClient(opts options.RedisStoreOptions) (Client, error) {
 		Password:         opts.Password,
 		TLSConfig:        opt.TLSConfig,
 		ConnMaxIdleTime:  time.Duration(opts.IdleTimeout) * time.Second,
-	})
-	return newClient(client), nil
+		PoolSize:         poolSize(),
+	}
+	client := newClient(redis.NewFailoverClient(failoverOpts))
+	if !opts.SentinelReadReplicas {
+		return client, nil
+	}
+
+	// The replicas client connects to the replicas the sentinels do not
+	// report as down, or to the master when there are none
+	replicaOpts := *failoverOpts
+	replicaOpts.ReplicaOnly = true
+	return newReplicaClient(client, redis.NewFailoverClient(&replicaOpts), opts.SentinelReplicaMaxStaleness), nil
 }
 
 // buildClusterClient makes a redis.Client that is Redis Cluster aware
@@ -147,6 +393,7 @@ func buildClusterClient(opts options.RedisStoreOptions) (Client, error) {
 		Password:        opts.Password,
 		TLSConfig:       opt.TLSConfig,
 		ConnMaxIdleTime: time.Duration(opts.IdleTimeout) * time.Second,
+		PoolSize:        poolSize(),
 	})
 	return newClusterClient(client), nil
 }
@@ -171,11 +418,23 @@ func buildStandaloneClient(opts options.RedisStoreOptions) (Client, error) {
 	}
 
 	opt.ConnMaxIdleTime = time.Duration(opts.IdleTimeout) * time.Second
+	if size := poolSize(); size > 0 {
+		opt.PoolSize = size
+	}
 
 	client := redis.NewClient(opt)
 	return newClient(client), nil
 }
 
+// poolSize returns the size of the connection pool of the client, where 0
+// leaves the default of the client
+func poolSize() int {
+	if memory.LowMemory() {
+		return memory.StorePoolSize
+	}
+	return 0
+}
+
 // setupTLSConfig sets the TLSConfig if the TLS option is given in redis.Options
 func setupTLSConfig(opts options.RedisStoreOptions, opt *redis.Options) error {
 	if opts.InsecureSkipTLSVerify {
@@ -232,3 +491,4 @@ func parseRedisURLs(urls []string) ([]string, *redis.Options, error) {
 }
 
 var _ persistence.Store = (*SessionStore)(nil)
+var _ persistence.Reapable = (*SessionStore)(nil)
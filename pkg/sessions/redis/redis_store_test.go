@@ -1,16 +1,21 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	"github.com/Bose/minisentinel"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/tests"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 const (
@@ -65,6 +70,125 @@ var _ = Describe("Redis SessionStore Tests", func() {
 		},
 	)
 
+	Context("with compression and chunking", func() {
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.RedisSessionStoreType
+				opts.Redis.ConnectionURL = redisProtocol + mr.Addr()
+				opts.Redis.Compression = options.RedisCompressionLZ4
+				opts.Redis.ChunkSize = 64
+
+				// Capture the session store so that we can close the client
+				var err error
+				ss, err = NewRedisSessionStore(opts, cookieOpts)
+				return ss, err
+			},
+			func(d time.Duration) error {
+				mr.FastForward(d)
+				return nil
+			},
+		)
+	})
+
+	Context("with chunked values", func() {
+		var store *SessionStore
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			client, err := NewRedisClient(options.RedisStoreOptions{ConnectionURL: redisProtocol + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			store = &SessionStore{Client: client, ChunkSize: 4}
+			// Capture the session store so that we can close the client
+			ss = persistence.NewManager(store, &options.Cookie{})
+		})
+
+		It("splits large values into chunks", func() {
+			Expect(store.Save(ctx, "session", []byte("0123456789"), time.Hour)).To(Succeed())
+			Expect(mr.Keys()).To(ConsistOf("session", "session-chunk-0", "session-chunk-1", "session-chunk-2"))
+			Expect(mr.Get("session")).To(Equal(chunkManifestPrefix + "3"))
+			Expect(mr.TTL("session-chunk-2")).To(Equal(time.Hour))
+
+			value, err := store.Load(ctx, "session")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("0123456789")))
+		})
+
+		It("saves small values under the key", func() {
+			Expect(store.Save(ctx, "session", []byte("0123"), time.Hour)).To(Succeed())
+			Expect(mr.Keys()).To(ConsistOf("session"))
+
+			value, err := store.Load(ctx, "session")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte("0123")))
+		})
+
+		It("clears the chunks", func() {
+			Expect(store.Save(ctx, "session", []byte("0123456789"), time.Hour)).To(Succeed())
+			Expect(store.Clear(ctx, "session")).To(Succeed())
+			Expect(mr.Keys()).To(BeEmpty())
+		})
+
+		It("fails to load a value with a missing chunk", func() {
+			Expect(store.Save(ctx, "session", []byte("0123456789"), time.Hour)).To(Succeed())
+			mr.Del("session-chunk-1")
+
+			_, err := store.Load(ctx, "session")
+			Expect(err).To(MatchError(ContainSubstring("error loading redis session chunk")))
+		})
+
+		Context("when reaping", func() {
+			BeforeEach(func() {
+				gracePeriod := chunkReapGracePeriod
+				chunkReapGracePeriod = 100 * time.Millisecond
+				DeferCleanup(func() {
+					chunkReapGracePeriod = gracePeriod
+				})
+
+				Expect(store.Save(ctx, "_oauth2_proxy-kept", []byte("0123456789"), 0)).To(Succeed())
+				Expect(store.Save(ctx, "_oauth2_proxy-shrunk", []byte("0123456789"), 0)).To(Succeed())
+				Expect(store.Save(ctx, "_oauth2_proxy-shrunk", []byte("012345"), 0)).To(Succeed())
+				Expect(mr.Set("_oauth2_proxy-cleared-chunk-0", "0123")).To(Succeed())
+				Expect(mr.Set("other-chunk-0", "0123")).To(Succeed())
+			})
+
+			It("deletes the chunks of values that no longer have them", func() {
+				result, err := store.Reap(ctx, "_oauth2_proxy-", 10)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(sessionsapi.ReapResult{Orphaned: 2}))
+				Expect(mr.Keys()).To(ConsistOf(
+					"_oauth2_proxy-kept", "_oauth2_proxy-kept-chunk-0", "_oauth2_proxy-kept-chunk-1", "_oauth2_proxy-kept-chunk-2",
+					"_oauth2_proxy-shrunk", "_oauth2_proxy-shrunk-chunk-0", "_oauth2_proxy-shrunk-chunk-1",
+					"other-chunk-0",
+				))
+
+				value, err := store.Load(ctx, "_oauth2_proxy-kept")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(value).To(Equal([]byte("0123456789")))
+			})
+
+			It("deletes up to the limit", func() {
+				for _, orphaned := range []int{1, 1, 0} {
+					result, err := store.Reap(ctx, "_oauth2_proxy-", 1)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.Orphaned).To(Equal(orphaned))
+				}
+			})
+
+			It("keeps the chunks whose manifest is saved while they are reaped", func() {
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(chunkReapGracePeriod / 2)
+					Expect(mr.Set("_oauth2_proxy-cleared", chunkManifestPrefix+"1")).To(Succeed())
+				}()
+
+				result, err := store.Reap(ctx, "_oauth2_proxy-", 10)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Orphaned).To(Equal(1))
+				Expect(mr.Exists("_oauth2_proxy-cleared-chunk-0")).To(BeTrue())
+			})
+		})
+	})
+
 	Context("with sentinel", func() {
 		var ms *minisentinel.Sentinel
 
@@ -94,6 +218,307 @@ var _ = Describe("Redis SessionStore Tests", func() {
 		)
 	})
 
+	Context("with sentinel replica reads", func() {
+		var ms *minisentinel.Sentinel
+
+		BeforeEach(func() {
+			ms = minisentinel.NewSentinel(mr)
+			Expect(ms.Start()).To(Succeed())
+		})
+
+		tests.RunSessionStoreTests(
+			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
+				opts.Type = options.RedisSessionStoreType
+				opts.Redis.SentinelConnectionURLs = []string{redisProtocol + ms.Addr()}
+				opts.Redis.UseSentinel = true
+				opts.Redis.SentinelMasterName = ms.MasterInfo().Name
+				opts.Redis.SentinelReadReplicas = true
+				opts.Redis.SentinelReplicaMaxStaleness = time.Second
+
+				// Capture the session store so that we can close the client
+				var err error
+				ss, err = NewRedisSessionStore(opts, cookieOpts)
+				return ss, err
+			},
+			func(d time.Duration) error {
+				mr.FastForward(d)
+				return nil
+			},
+		)
+	})
+
+	Context("with a replica client", func() {
+		var replica *miniredis.Miniredis
+		var client *replicaClient
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			// The client is closed by the test rather than as a session store
+			ss = nil
+
+			var err error
+			replica, err = miniredis.Run()
+			Expect(err).ToNot(HaveOccurred())
+
+			master, err := NewRedisClient(options.RedisStoreOptions{ConnectionURL: redisProtocol + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			replicas, err := goredis.ParseURL(redisProtocol + replica.Addr())
+			Expect(err).ToNot(HaveOccurred())
+			client = newReplicaClient(master, goredis.NewClient(replicas), time.Minute).(*replicaClient)
+
+			// The replica is replicating the master until the next check
+			client.checkedAt = time.Now()
+			client.replicating = true
+
+			Expect(mr.Set("session", "master")).To(Succeed())
+			Expect(replica.Set("session", "replica")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(client.Close()).To(Succeed())
+			replica.Close()
+		})
+
+		It("reads keys from the replicas", func() {
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("replica")))
+		})
+
+		It("reads keys it wrote recently from the master", func() {
+			Expect(client.Set(ctx, "session", []byte("saved"), time.Minute)).To(Succeed())
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("saved")))
+
+			client.written["session"] = time.Now().Add(-2 * time.Minute)
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("replica")))
+		})
+
+		It("reads keys cleared recently from the master", func() {
+			Expect(client.Del(ctx, "session")).To(Succeed())
+			_, err := client.Get(ctx, "session")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("reads keys missing from the replicas from the master", func() {
+			replica.Del("session")
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("master")))
+		})
+
+		It("reads keys from the master when the replicas cannot be read from", func() {
+			replica.Close()
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("master")))
+		})
+
+		It("reads keys from the master for consistent reads", func() {
+			Expect(client.Get(sessionsapi.WithConsistentRead(ctx), "session")).To(Equal([]byte("master")))
+		})
+
+		It("reads keys from the master when the replication cannot be checked", func() {
+			client.checkedAt = time.Time{}
+			Expect(client.Get(ctx, "session")).To(Equal([]byte("master")))
+			Expect(client.replicating).To(BeFalse())
+		})
+
+		DescribeTable("checks the replication of the replicas",
+			func(info string, current bool) {
+				Expect(isReplicationCurrent(info, 5*time.Second)).To(Equal(current))
+			},
+			Entry("when replicating", "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:2\r\n", true),
+			Entry("when the link is down", "# Replication\r\nrole:slave\r\nmaster_link_status:down\r\nmaster_last_io_seconds_ago:-1\r\n", false),
+			Entry("when the master was last heard from too long ago", "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:9\r\n", false),
+			Entry("on a master", "# Replication\r\nrole:master\r\nconnected_slaves:0\r\n", false),
+		)
+	})
+
+	Context("with a session cache", func() {
+		const key = "_oauth2_proxy-session"
+		var store *SessionStore
+		var m *storeMetrics
+		ctx := context.Background()
+
+		newStore := func(strict bool) {
+			client, err := NewRedisClient(options.RedisStoreOptions{ConnectionURL: redisProtocol + mr.Addr()})
+			Expect(err).ToNot(HaveOccurred())
+			m = newMetrics(prometheus.NewRegistry())
+			store = &SessionStore{
+				Client:  client,
+				cache:   newSessionCache(2, time.Minute, strict, m),
+				metrics: m,
+			}
+			// Capture the session store so that we can close the client
+			ss = persistence.NewManager(store, &options.Cookie{})
+		}
+
+		// notify publishes the keyspace notification of a change of the key,
+		// and waits until the cache is invalidated
+		notify := func(key string) {
+			invalidations := testutil.ToFloat64(m.cacheInvalidations)
+			mr.Publish("__keyspace@0__:"+key, "set")
+			Eventually(func() float64 { return testutil.ToFloat64(m.cacheInvalidations) }).Should(Equal(invalidations + 1))
+		}
+
+		// setKeyspaceEvents sets the notify-keyspace-events setting returned by
+		// CONFIG GET, which miniredis does not implement
+		setKeyspaceEvents := func(setting string) {
+			Expect(mr.Server().Register("CONFIG", func(c *server.Peer, _ string, args []string) {
+				c.WriteMapLen(1)
+				c.WriteBulk(args[1])
+				c.WriteBulk(setting)
+			})).To(Succeed())
+		}
+
+		load := func(key string) string {
+			value, err := store.Load(ctx, key)
+			Expect(err).ToNot(HaveOccurred())
+			return string(value)
+		}
+
+		Context("with strict consistency", func() {
+			BeforeEach(func() {
+				setKeyspaceEvents("Kg$x")
+				newStore(true)
+				go store.cache.runInvalidation(store.Client, "_oauth2_proxy")
+				Eventually(func() bool {
+					store.cache.mutex.Lock()
+					defer store.cache.mutex.Unlock()
+					return store.cache.subscribed
+				}).Should(BeTrue())
+
+				Expect(mr.Set(key, "cached")).To(Succeed())
+			})
+
+			It("serves sessions from the cache until their changes are notified", func() {
+				Expect(load(key)).To(Equal("cached"))
+				Expect(mr.Set(key, "changed")).To(Succeed())
+				Expect(load(key)).To(Equal("cached"))
+
+				notify(key)
+				Expect(load(key)).To(Equal("changed"))
+
+				Expect(testutil.ToFloat64(m.cacheRequests.WithLabelValues("hit"))).To(Equal(1.0))
+				Expect(testutil.ToFloat64(m.cacheRequests.WithLabelValues("miss"))).To(Equal(2.0))
+			})
+
+			It("does not serve the sessions saved or cleared by the store from the cache", func() {
+				Expect(load(key)).To(Equal("cached"))
+				Expect(store.Save(ctx, key, []byte("saved"), time.Hour)).To(Succeed())
+				Expect(load(key)).To(Equal("saved"))
+
+				Expect(store.Clear(ctx, key)).To(Succeed())
+				_, err := store.Load(ctx, key)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("evicts the least recently used sessions", func() {
+				for _, k := range []string{key, "_oauth2_proxy-2", "_oauth2_proxy-3"} {
+					Expect(mr.Set(k, "cached")).To(Succeed())
+					Expect(load(k)).To(Equal("cached"))
+				}
+
+				Expect(mr.Set(key, "changed")).To(Succeed())
+				Expect(mr.Set("_oauth2_proxy-3", "changed")).To(Succeed())
+				Expect(load(key)).To(Equal("changed"))
+				Expect(load("_oauth2_proxy-3")).To(Equal("cached"))
+			})
+
+			It("does not cache sessions loaded before an invalidation", func() {
+				generation := store.cache.currentGeneration()
+				notify("_oauth2_proxy-other")
+				store.cache.add(key, []byte("stale"), generation)
+
+				Expect(load(key)).To(Equal("cached"))
+			})
+
+			It("stops serving sessions from the cache once the notifications are lost", func() {
+				Expect(load(key)).To(Equal("cached"))
+				store.cache.setSubscribed(false)
+				Expect(mr.Set(key, "changed")).To(Succeed())
+
+				Expect(load(key)).To(Equal("changed"))
+			})
+		})
+
+		It("does not serve sessions from a strict cache when keyspace notifications are not enabled", func() {
+			setKeyspaceEvents("")
+			newStore(true)
+			go store.cache.runInvalidation(store.Client, "_oauth2_proxy")
+			Consistently(func() bool {
+				store.cache.mutex.Lock()
+				defer store.cache.mutex.Unlock()
+				return store.cache.subscribed
+			}, 100*time.Millisecond).Should(BeFalse())
+
+			Expect(mr.Set(key, "cached")).To(Succeed())
+			Expect(load(key)).To(Equal("cached"))
+			Expect(mr.Set(key, "changed")).To(Succeed())
+			Expect(load(key)).To(Equal("changed"))
+		})
+
+		Context("with eventual consistency", func() {
+			BeforeEach(func() {
+				newStore(false)
+				Expect(mr.Set(key, "cached")).To(Succeed())
+			})
+
+			It("serves sessions from the cache without notifications", func() {
+				Expect(load(key)).To(Equal("cached"))
+				Expect(mr.Set(key, "changed")).To(Succeed())
+				Expect(load(key)).To(Equal("cached"))
+			})
+
+			It("serves sessions from the cache until they expire from it", func() {
+				store.cache.ttl = time.Millisecond
+				Expect(load(key)).To(Equal("cached"))
+				Expect(mr.Set(key, "changed")).To(Succeed())
+
+				time.Sleep(2 * time.Millisecond)
+				Expect(load(key)).To(Equal("changed"))
+			})
+		})
+
+		It("stops receiving notifications once the client is closed", func() {
+			newStore(true)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				store.cache.runInvalidation(store.Client, "_oauth2_proxy")
+			}()
+
+			Expect(store.Client.(closer).Close()).To(Succeed())
+			ss = nil
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	DescribeTable("lists the keys with a prefix",
+		func(redisOpts func() options.RedisStoreOptions) {
+			ctx := context.Background()
+			client, err := NewRedisClient(redisOpts())
+			Expect(err).ToNot(HaveOccurred())
+			store := &SessionStore{Client: client}
+			// Capture the session store so that we can close the client
+			ss = persistence.NewManager(store, &options.Cookie{})
+
+			for _, key := range []string{"index:_oauth2_proxy-1", "index:_oauth2_proxy-2", "index:other-1", "_oauth2_proxy-1"} {
+				Expect(store.Save(ctx, key, []byte("value"), time.Hour)).To(Succeed())
+			}
+			Expect(store.Save(ctx, "index:_oauth2_proxy*", []byte("value"), time.Hour)).To(Succeed())
+
+			keys, err := store.List(ctx, "index:_oauth2_proxy-")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(ConsistOf("index:_oauth2_proxy-1", "index:_oauth2_proxy-2"))
+
+			// Glob characters in the prefix are matched literally
+			keys, err = store.List(ctx, "index:_oauth2_proxy*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keys).To(ConsistOf("index:_oauth2_proxy*"))
+		},
+		Entry("with a standalone server", func() options.RedisStoreOptions {
+			return options.RedisStoreOptions{ConnectionURL: redisProtocol + mr.Addr()}
+		}),
+		Entry("with cluster", func() options.RedisStoreOptions {
+			return options.RedisStoreOptions{ClusterConnectionURLs: []string{redisProtocol + mr.Addr()}, UseCluster: true}
+		}),
+	)
+
 	Context("with cluster", func() {
 		tests.RunSessionStoreTests(
 			func(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessionsapi.SessionStore, error) {
@@ -243,3 +668,14 @@ var _ = Describe("Redis SessionStore Tests", func() {
 		})
 	})
 })
+
+var _ = DescribeTable("keyspaceEventsEnabled",
+	func(setting string, enabled bool) {
+		Expect(keyspaceEventsEnabled(setting)).To(Equal(enabled))
+	},
+	Entry("disabled", "", false),
+	Entry("with the keys set, deleted and expired", "Kg$x", true),
+	Entry("with all the events", "KA", true),
+	Entry("without the expired keys", "Kg$", false),
+	Entry("with keyevent notifications only", "EA", false),
+)
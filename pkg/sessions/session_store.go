@@ -1,22 +1,117 @@
 package sessions
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption/kms"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/failover"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/memcached"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/postgres"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // NewSessionStore creates a SessionStore from the provided configuration
 func NewSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	if len(opts.Failover.Stores) > 0 {
+		return newFailoverSessionStore(opts, cookieOpts)
+	}
+
+	ss, err := newSessionStore(opts, cookieOpts)
+	if err != nil || opts.KMS.Provider == "" {
+		return ss, err
+	}
+	return withEnvelopeEncryption(ss, opts.KMS)
+}
+
+// NewPersistentStore creates the Store of the persistent session store
+// configured, so that other data can be kept alongside the sessions
+func NewPersistentStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (persistence.Store, error) {
+	ss, err := newSessionStoreOfType(opts, cookieOpts)
+	if err != nil {
+		return nil, err
+	}
+	manager, ok := ss.(*persistence.Manager)
+	if !ok {
+		return nil, fmt.Errorf("the %s session store is not persistent", opts.Type)
+	}
+	return manager.Store, nil
+}
+
+// newFailoverSessionStore creates each session store in the failover chain,
+// starting with the primary store type.
+// Envelope encryption, if configured, is applied to every persistent store.
+func newFailoverSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	var stores []failover.Store
+	for _, storeType := range append([]string{opts.Type}, opts.Failover.Stores...) {
+		storeOpts := *opts
+		storeOpts.Type = storeType
+
+		ss, err := newSessionStore(&storeOpts, cookieOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s session store: %v", storeType, err)
+		}
+		if _, persistent := ss.(*persistence.Manager); persistent && opts.KMS.Provider != "" {
+			ss, err = withEnvelopeEncryption(ss, opts.KMS)
+			if err != nil {
+				return nil, err
+			}
+		}
+		stores = append(stores, failover.Store{Name: storeType, SessionStore: ss})
+	}
+	return failover.NewFailoverSessionStore(stores, opts.Failover, prometheus.DefaultRegisterer), nil
+}
+
+// newSessionStore creates a session store of the configured type, with
+// background refresh and the index of the sessions enabled if the store is
+// persistent
+func newSessionStore(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
+	ss, err := newSessionStoreOfType(opts, cookieOpts)
+	if err != nil {
+		return nil, err
+	}
+	if manager, ok := ss.(*persistence.Manager); ok {
+		if opts.Refresh.BeforeExpiry > 0 {
+			manager.Refresher = persistence.NewRefresher(opts.Refresh)
+		}
+		manager.Reaper = persistence.NewReaper(opts.Reaper)
+		manager.Index = opts.Index
+	}
+	return ss, nil
+}
+
+func newSessionStoreOfType(opts *options.SessionOptions, cookieOpts *options.Cookie) (sessions.SessionStore, error) {
 	switch opts.Type {
 	case options.CookieSessionStoreType:
 		return cookie.NewCookieSessionStore(opts, cookieOpts)
 	case options.RedisSessionStoreType:
 		return redis.NewRedisSessionStore(opts, cookieOpts)
+	case options.MemcachedSessionStoreType:
+		return memcached.NewMemcachedSessionStore(opts, cookieOpts)
+	case options.PostgresSessionStoreType:
+		return postgres.NewPostgresSessionStore(opts, cookieOpts)
 	default:
 		return nil, fmt.Errorf("unknown session store type '%s'", opts.Type)
 	}
 }
+
+// withEnvelopeEncryption wraps the Store of a persistent session store so
+// that sessions are envelope encrypted with data keys from the KMS
+func withEnvelopeEncryption(ss sessions.SessionStore, opts options.SessionKMSOptions) (sessions.SessionStore, error) {
+	manager, ok := ss.(*persistence.Manager)
+	if !ok {
+		return nil, errors.New("session kms encryption requires a persistent session store")
+	}
+
+	keys, err := kms.NewKeyManager(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising session kms: %v", err)
+	}
+	manager.Store = persistence.NewEnvelopeStore(manager.Store, kms.NewEnvelope(keys, opts.DataKeyRotation))
+	return manager, nil
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
 	sessionscookie "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/cookie"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/failover"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/memcached"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/persistence"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
 	. "github.com/onsi/ginkgo/v2"
@@ -60,6 +62,12 @@ var _ = Describe("NewSessionStore", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ss).To(BeAssignableToTypeOf(&sessionscookie.SessionStore{}))
 		})
+
+		It("has no persistent store", func() {
+			store, err := sessions.NewPersistentStore(opts, cookieOpts)
+			Expect(err).To(MatchError("the cookie session store is not persistent"))
+			Expect(store).To(BeNil())
+		})
 	})
 
 	Context("with type 'redis'", func() {
@@ -74,6 +82,108 @@ var _ = Describe("NewSessionStore", func() {
 			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
 			Expect(ss.(*persistence.Manager).Store).To(BeAssignableToTypeOf(&redis.SessionStore{}))
 		})
+
+		It("creates a redis.SessionStore as the persistent store", func() {
+			store, err := sessions.NewPersistentStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store).To(BeAssignableToTypeOf(&redis.SessionStore{}))
+		})
+	})
+
+	Context("with type 'memcached'", func() {
+		BeforeEach(func() {
+			opts.Type = options.MemcachedSessionStoreType
+			opts.Memcached.Servers = []string{"localhost:11211"}
+		})
+
+		It("creates a persistence.Manager that wraps a memcached.SessionStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			Expect(ss.(*persistence.Manager).Store).To(BeAssignableToTypeOf(&memcached.SessionStore{}))
+		})
+	})
+
+	Context("with background refresh", func() {
+		BeforeEach(func() {
+			opts.Type = options.RedisSessionStoreType
+			opts.Redis.ConnectionURL = "redis://"
+			opts.Refresh = options.SessionRefreshOptions{
+				BeforeExpiry: 5 * time.Minute,
+				Interval:     30 * time.Second,
+			}
+		})
+
+		It("adds a Refresher to the persistence.Manager", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			Expect(ss.(*persistence.Manager).Refresher).ToNot(BeNil())
+			Expect(ss.(*persistence.Manager).Refresher.BeforeExpiry).To(Equal(5 * time.Minute))
+		})
+
+		It("does not add a Refresher when disabled", func() {
+			opts.Refresh.BeforeExpiry = 0
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss.(*persistence.Manager).Refresher).To(BeNil())
+		})
+	})
+
+	Context("with session kms encryption", func() {
+		BeforeEach(func() {
+			opts.Type = options.RedisSessionStoreType
+			opts.Redis.ConnectionURL = "redis://"
+			opts.KMS = options.SessionKMSOptions{
+				Provider:        options.VaultKMSProvider,
+				KeyID:           "sessions",
+				Endpoint:        "https://vault.example.com",
+				VaultToken:      "token",
+				VaultMount:      "transit",
+				DataKeyRotation: time.Hour,
+			}
+		})
+
+		It("wraps the persistent store in a persistence.EnvelopeStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&persistence.Manager{}))
+			store := ss.(*persistence.Manager).Store
+			Expect(store).To(BeAssignableToTypeOf(&persistence.EnvelopeStore{}))
+			Expect(store.(*persistence.EnvelopeStore).Store).To(BeAssignableToTypeOf(&redis.SessionStore{}))
+		})
+
+		It("returns an error with the cookie session store", func() {
+			opts.Type = options.CookieSessionStoreType
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).To(MatchError("session kms encryption requires a persistent session store"))
+			Expect(ss).To(BeNil())
+		})
+	})
+
+	Context("with failover session stores", func() {
+		BeforeEach(func() {
+			opts.Type = options.RedisSessionStoreType
+			opts.Redis.ConnectionURL = "redis://"
+			opts.Failover = options.SessionFailoverOptions{
+				Stores:           []string{options.CookieSessionStoreType},
+				FailureThreshold: 3,
+				Cooldown:         30 * time.Second,
+			}
+		})
+
+		It("creates a failover.SessionStore", func() {
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ss).To(BeAssignableToTypeOf(&failover.SessionStore{}))
+		})
+
+		It("returns an error for an invalid failover store", func() {
+			opts.Failover.Stores = []string{"invalid-type"}
+			ss, err := sessions.NewSessionStore(opts, cookieOpts)
+			Expect(err).To(MatchError("error creating invalid-type session store: unknown session store type 'invalid-type'"))
+			Expect(ss).To(BeNil())
+		})
 	})
 
 	Context("with an invalid type", func() {
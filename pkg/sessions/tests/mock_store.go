@@ -3,6 +3,7 @@ package tests
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
@@ -56,6 +57,18 @@ func (s *MockStore) Clear(_ context.Context, key string) error {
 	return nil
 }
 
+// List lists the keys of the memory cache with the prefix that have not
+// expired
+func (s *MockStore) List(_ context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	for key, entry := range s.cache {
+		if strings.HasPrefix(key, prefix) && entry.expiration > s.elapsed {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
 func (s *MockStore) Lock(key string) sessions.Lock {
 	if s.lockCache[key] != nil {
 		return s.lockCache[key]
@@ -0,0 +1,310 @@
+package sigv4
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// credentialsRefreshWindow is how long before they expire temporary
+	// credentials are refreshed
+	credentialsRefreshWindow = 5 * time.Minute
+
+	// containerCredentialsEndpoint is the host of the relative URI of the
+	// ECS container credentials
+	containerCredentialsEndpoint = "http://169.254.170.2"
+
+	// instanceMetadataEndpoint is the EC2 instance metadata service
+	instanceMetadataEndpoint = "http://169.254.169.254"
+
+	// instanceMetadataTokenTTL is the lifetime in seconds of the IMDSv2
+	// session tokens
+	instanceMetadataTokenTTL = 21600
+)
+
+// CredentialsProvider returns the credentials to sign requests with
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials provides credentials that do not expire
+type StaticCredentials Credentials
+
+// Retrieve returns the credentials
+func (c StaticCredentials) Retrieve(context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// NewCredentialsProvider returns the provider of the credentials of the
+// environment, looked up in the same order as the AWS SDKs:
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//   - the web identity token of AWS_WEB_IDENTITY_TOKEN_FILE exchanged for
+//     the role of AWS_ROLE_ARN, as set up by IAM roles for service accounts
+//     on EKS
+//   - the container credentials of AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or
+//     AWS_CONTAINER_CREDENTIALS_FULL_URI, as set up for ECS task roles and
+//     EKS Pod Identity
+//   - the instance profile of the EC2 instance metadata service, with
+//     IMDSv2, unless AWS_EC2_METADATA_DISABLED is true
+//
+// Temporary credentials are fetched with the client when they are first
+// used, and refreshed before they expire.
+func NewCredentialsProvider(client *http.Client) (CredentialsProvider, error) {
+	switch {
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "" || os.Getenv("AWS_SECRET_ACCESS_KEY") != "":
+		creds, err := CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return StaticCredentials(creds), nil
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		if os.Getenv("AWS_ROLE_ARN") == "" {
+			return nil, errors.New("aws web identity credentials require AWS_ROLE_ARN to be set")
+		}
+		return &refreshingCredentials{fetch: webIdentityCredentials(client)}, nil
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		return &refreshingCredentials{fetch: containerCredentials(client)}, nil
+	case strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true"):
+		return nil, errors.New("aws credentials are not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token or container credentials are required when the instance metadata service is disabled")
+	default:
+		return &refreshingCredentials{fetch: instanceCredentials(client)}, nil
+	}
+}
+
+// fetchFunc fetches temporary credentials, returning when they expire
+type fetchFunc func(ctx context.Context) (Credentials, time.Time, error)
+
+// refreshingCredentials caches temporary credentials until they are about
+// to expire
+type refreshingCredentials struct {
+	fetch fetchFunc
+
+	mu         sync.Mutex
+	creds      Credentials
+	expiration time.Time
+}
+
+// Retrieve returns the cached credentials, fetching new credentials when
+// they are about to expire. The cached credentials are returned while they
+// are valid if they cannot be refreshed.
+func (r *refreshingCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.creds.AccessKeyID != "" && r.expiration.Sub(now) > credentialsRefreshWindow {
+		return r.creds, nil
+	}
+	creds, expiration, err := r.fetch(ctx)
+	if err != nil {
+		if r.creds.AccessKeyID != "" && now.Before(r.expiration) {
+			return r.creds, nil
+		}
+		return Credentials{}, err
+	}
+	r.creds, r.expiration = creds, expiration
+	return creds, nil
+}
+
+// temporaryCredentials are the credentials returned by the container
+// credentials endpoint and the instance metadata service
+type temporaryCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c temporaryCredentials) credentials() (Credentials, time.Time, error) {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return Credentials{}, time.Time{}, errors.New("aws temporary credentials response has no access key")
+	}
+	return Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+	}, c.Expiration, nil
+}
+
+// webIdentityCredentials exchanges the web identity token for the
+// credentials of the role with STS AssumeRoleWithWebIdentity. The token file
+// is read for each exchange, as it is rotated.
+func webIdentityCredentials(client *http.Client) fetchFunc {
+	return func(ctx context.Context) (Credentials, time.Time, error) {
+		token, err := os.ReadFile(os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+		if err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error reading aws web identity token: %v", err)
+		}
+		sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = "oauth2-proxy-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		}
+		form := url.Values{
+			"Action":           {"AssumeRoleWithWebIdentity"},
+			"Version":          {"2011-06-15"},
+			"RoleArn":          {os.Getenv("AWS_ROLE_ARN")},
+			"RoleSessionName":  {sessionName},
+			"WebIdentityToken": {strings.TrimSpace(string(token))},
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return Credentials{}, time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		body, err := doRequest(client, req)
+		if err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error assuming aws role with web identity: %v", err)
+		}
+
+		var resp struct {
+			Credentials struct {
+				AccessKeyID     string    `xml:"AccessKeyId"`
+				SecretAccessKey string    `xml:"SecretAccessKey"`
+				SessionToken    string    `xml:"SessionToken"`
+				Expiration      time.Time `xml:"Expiration"`
+			} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+		}
+		if err := xml.Unmarshal(body, &resp); err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error decoding aws web identity credentials: %v", err)
+		}
+		return temporaryCredentials{
+			AccessKeyID:     resp.Credentials.AccessKeyID,
+			SecretAccessKey: resp.Credentials.SecretAccessKey,
+			Token:           resp.Credentials.SessionToken,
+			Expiration:      resp.Credentials.Expiration,
+		}.credentials()
+	}
+}
+
+// stsEndpoint returns the endpoint of STS, regional when the region is set
+func stsEndpoint() string {
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_STS"); endpoint != "" {
+		return endpoint
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+	return "https://sts.amazonaws.com/"
+}
+
+// containerCredentials fetches the credentials of the container credentials
+// endpoint, authorized with the token of
+// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE or AWS_CONTAINER_AUTHORIZATION_TOKEN
+func containerCredentials(client *http.Client) fetchFunc {
+	return func(ctx context.Context) (Credentials, time.Time, error) {
+		endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+		if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+			endpoint = containerCredentialsEndpoint + uri
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return Credentials{}, time.Time{}, err
+		}
+
+		authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return Credentials{}, time.Time{}, fmt.Errorf("error reading aws container authorization token: %v", err)
+			}
+			authorization = strings.TrimSpace(string(token))
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		var creds temporaryCredentials
+		if err := doJSON(client, req, &creds); err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error fetching aws container credentials: %v", err)
+		}
+		return creds.credentials()
+	}
+}
+
+// instanceCredentials fetches the credentials of the instance profile from
+// the instance metadata service, with an IMDSv2 session token
+func instanceCredentials(client *http.Client) fetchFunc {
+	return func(ctx context.Context) (Credentials, time.Time, error) {
+		endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+		if endpoint == "" {
+			endpoint = instanceMetadataEndpoint
+		}
+		endpoint = strings.TrimSuffix(endpoint, "/")
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+		if err != nil {
+			return Credentials{}, time.Time{}, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(instanceMetadataTokenTTL))
+		token, err := doRequest(client, req)
+		if err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error fetching aws instance metadata token: %v", err)
+		}
+
+		credentialsPath := endpoint + "/latest/meta-data/iam/security-credentials/"
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, credentialsPath, nil)
+		if err != nil {
+			return Credentials{}, time.Time{}, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		roles, err := doRequest(client, req)
+		if err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error fetching aws instance profile: %v", err)
+		}
+		role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+		if role == "" {
+			return Credentials{}, time.Time{}, errors.New("aws instance has no instance profile")
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, credentialsPath+url.PathEscape(role), nil)
+		if err != nil {
+			return Credentials{}, time.Time{}, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		var creds temporaryCredentials
+		if err := doJSON(client, req, &creds); err != nil {
+			return Credentials{}, time.Time{}, fmt.Errorf("error fetching aws instance profile credentials: %v", err)
+		}
+		return creds.credentials()
+	}
+}
+
+// doRequest sends the request, returning the body of a 2xx response
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+// doJSON sends the request and decodes the body of a 2xx response into out
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	body, err := doRequest(client, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
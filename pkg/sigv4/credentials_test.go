@@ -0,0 +1,184 @@
+package sigv4
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clearCredentialsEnv unsets the variables the credentials are looked up by
+func clearCredentialsEnv(t *testing.T) {
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_ENDPOINT_URL_STS",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_DISABLED", "AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+const credentialsJSON = `{"AccessKeyId":"ASIATEMP","SecretAccessKey":"secret","Token":"session-token","Expiration":"2099-01-01T00:00:00Z"}`
+
+var temporaryCreds = Credentials{AccessKeyID: "ASIATEMP", SecretAccessKey: "secret", SessionToken: "session-token"}
+
+func TestCredentialsFromEnvironment(t *testing.T) {
+	clearCredentialsEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	provider, err := NewCredentialsProvider(http.DefaultClient)
+	assert.NoError(t, err)
+	creds, err := provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, creds)
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = NewCredentialsProvider(http.DefaultClient)
+	assert.EqualError(t, err, "aws credentials are not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+}
+
+func TestWebIdentityCredentials(t *testing.T) {
+	clearCredentialsEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", req.PostForm.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/oauth2-proxy", req.PostForm.Get("RoleArn"))
+		assert.Equal(t, "sessions", req.PostForm.Get("RoleSessionName"))
+		assert.Equal(t, "service-account-token", req.PostForm.Get("WebIdentityToken"))
+		rw.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIATEMP</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("service-account-token\n"), 0600))
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/oauth2-proxy")
+	t.Setenv("AWS_ROLE_SESSION_NAME", "sessions")
+	t.Setenv("AWS_ENDPOINT_URL_STS", server.URL)
+
+	provider, err := NewCredentialsProvider(server.Client())
+	assert.NoError(t, err)
+	creds, err := provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, temporaryCreds, creds)
+
+	t.Setenv("AWS_ROLE_ARN", "")
+	_, err = NewCredentialsProvider(server.Client())
+	assert.EqualError(t, err, "aws web identity credentials require AWS_ROLE_ARN to be set")
+}
+
+func TestContainerCredentials(t *testing.T) {
+	clearCredentialsEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/credentials", req.URL.Path)
+		if req.Header.Get("Authorization") != "pod-identity-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Write([]byte(credentialsJSON))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("pod-identity-token"), 0600))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	provider, err := NewCredentialsProvider(server.Client())
+	assert.NoError(t, err)
+	creds, err := provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, temporaryCreds, creds)
+}
+
+func TestInstanceCredentials(t *testing.T) {
+	clearCredentialsEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest/api/token" {
+			assert.Equal(t, http.MethodPut, req.Method)
+			assert.Equal(t, "21600", req.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			rw.Write([]byte("imds-token"))
+			return
+		}
+		if req.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			rw.Write([]byte("oauth2-proxy-role"))
+		case "/latest/meta-data/iam/security-credentials/oauth2-proxy-role":
+			rw.Write([]byte(credentialsJSON))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL+"/")
+
+	provider, err := NewCredentialsProvider(server.Client())
+	assert.NoError(t, err)
+	creds, err := provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, temporaryCreds, creds)
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	_, err = NewCredentialsProvider(server.Client())
+	assert.EqualError(t, err, "aws credentials are not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token or container credentials are required when the instance metadata service is disabled")
+}
+
+func TestRefreshingCredentials(t *testing.T) {
+	fetched := 0
+	expiration := time.Now().Add(time.Hour)
+	var fetchErr error
+	provider := &refreshingCredentials{fetch: func(context.Context) (Credentials, time.Time, error) {
+		if fetchErr != nil {
+			return Credentials{}, time.Time{}, fetchErr
+		}
+		fetched++
+		return temporaryCreds, expiration, nil
+	}}
+
+	for i := 0; i < 2; i++ {
+		creds, err := provider.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, temporaryCreds, creds)
+	}
+	assert.Equal(t, 1, fetched)
+
+	// Credentials about to expire are refreshed, and used while they are
+	// valid when they cannot be refreshed
+	provider.expiration = time.Now().Add(time.Minute)
+	fetchErr = errors.New("metadata service unavailable")
+	creds, err := provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, temporaryCreds, creds)
+
+	provider.expiration = time.Now().Add(-time.Minute)
+	_, err = provider.Retrieve(context.Background())
+	assert.EqualError(t, err, "metadata service unavailable")
+
+	fetchErr = nil
+	_, err = provider.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetched)
+}
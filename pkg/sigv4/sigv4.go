@@ -0,0 +1,188 @@
+// Package sigv4 signs requests to AWS APIs with AWS Signature Version 4.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// UnsignedPayload is the payload hash of requests whose body is not
+	// signed
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Credentials are the credentials used to sign AWS API requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads the credentials from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables
+func CredentialsFromEnv() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, errors.New("aws credentials are not set: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	return creds, nil
+}
+
+// Sign signs the request with AWS Signature Version 4.
+// All headers present on the request, and the host, are signed.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	sign(req, signedRequest{
+		host:        req.URL.Host,
+		path:        path,
+		query:       req.URL.Query(),
+		payloadHash: hex.EncodeToString(bodyHash[:]),
+		signHeader:  func(string) bool { return true },
+	}, creds, region, service, now)
+}
+
+// SignProxied signs a request proxied to an AWS service with AWS Signature
+// Version 4, as it is sent by an http.Transport: to the Host of the request
+// when set, with the request URI of its URL.
+// Only the host, the Content-Type and Content-MD5 headers and the X-Amz-*
+// headers are signed, so that the headers changed on the way to the service
+// do not break the signature. The payloadHash is the hex encoded SHA-256 hash
+// of the body, or UnsignedPayload, and is sent in the X-Amz-Content-Sha256
+// header.
+func SignProxied(req *http.Request, payloadHash string, creds Credentials, region, service string, now time.Time) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path, rawQuery, _ := strings.Cut(req.URL.RequestURI(), "?")
+	// The path is encoded again for all services but S3
+	if service != "s3" {
+		path = escapePath(path)
+	}
+	// Invalid query parameters are skipped, as the service will skip them
+	query, _ := url.ParseQuery(rawQuery)
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	sign(req, signedRequest{
+		host:        host,
+		path:        path,
+		query:       query,
+		payloadHash: payloadHash,
+		signHeader: func(name string) bool {
+			return name == "content-type" || name == "content-md5" || strings.HasPrefix(name, "x-amz-")
+		},
+	}, creds, region, service, now)
+}
+
+// signedRequest holds the parts of a request that are signed
+type signedRequest struct {
+	host        string
+	path        string
+	query       url.Values
+	payloadHash string
+	// signHeader returns whether the header, in lower case, is signed
+	signHeader func(name string) bool
+}
+
+func sign(req *http.Request, signed signedRequest, creds Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": signed.host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "host" || !signed.signHeader(name) {
+			continue
+		}
+		trimmed := make([]string, 0, len(values))
+		for _, v := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		signed.path,
+		strings.ReplaceAll(signed.query.Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		signed.payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapePath URI encodes every byte of the path but the unreserved
+// characters and the slashes
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package sigv4
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSignV4 uses the example request from the AWS Signature Version 4
+// documentation
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	Sign(req, nil, Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
+
+// TestSignProxied checks that proxied requests are signed as Sign signs the
+// same request sent directly, without the headers that are not signed
+func TestSignProxied(t *testing.T) {
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "session-token",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	body := []byte(`{"query":{}}`)
+	bodyHash := "be9b522cceff9db8d9564fbb87b3ae6b2968b4cacecbfc3831f96ba31cd7a7e6"
+
+	direct, err := http.NewRequest(http.MethodPost, "https://search.us-east-1.es.amazonaws.com/index/_search?size=10&q=a%20b", nil)
+	assert.NoError(t, err)
+	direct.Header.Set("Content-Type", "application/json")
+	direct.Header.Set("X-Amz-Content-Sha256", bodyHash)
+	Sign(direct, body, creds, "us-east-1", "s3", now)
+
+	proxied, err := http.NewRequest(http.MethodPost, "http://10.0.0.1:9200/index/_search?size=10&q=a%20b", nil)
+	assert.NoError(t, err)
+	proxied.Host = "search.us-east-1.es.amazonaws.com"
+	proxied.Header.Set("Content-Type", "application/json")
+	proxied.Header.Set("X-Forwarded-For", "192.0.2.1")
+	SignProxied(proxied, bodyHash, creds, "us-east-1", "s3", now)
+
+	assert.Equal(t, bodyHash, proxied.Header.Get("X-Amz-Content-Sha256"))
+	assert.Equal(t, "session-token", proxied.Header.Get("X-Amz-Security-Token"))
+	assert.Contains(t, proxied.Header.Get("Authorization"),
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+	assert.Equal(t, direct.Header.Get("Authorization"), proxied.Header.Get("Authorization"))
+}
+
+func TestEscapePath(t *testing.T) {
+	assert.Equal(t, "/", escapePath("/"))
+	assert.Equal(t, "/docs/a-b_c.d~e", escapePath("/docs/a-b_c.d~e"))
+	assert.Equal(t, "/a%2520b/c%3Ad", escapePath("/a%20b/c:d"))
+}
@@ -0,0 +1,189 @@
+package templates
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ohler55/ojg/jp"
+)
+
+// FuncMap returns the functions available to the templates rendered by the
+// proxy, such as the sign in and error pages.
+// Functions take the value they transform as their last argument, so that
+// they can be used in pipelines, eg. `{{ .Groups | join "," | lower }}`.
+//
+// It can be converted to both a `html/template.FuncMap` and a
+// `text/template.FuncMap`.
+func FuncMap() map[string]interface{} {
+	return map[string]interface{}{
+		// ToUpper and ToLower are kept for existing custom templates
+		"ToUpper": strings.ToUpper,
+		"ToLower": strings.ToLower,
+
+		"upper":        strings.ToUpper,
+		"lower":        strings.ToLower,
+		"trim":         strings.TrimSpace,
+		"split":        split,
+		"join":         join,
+		"replace":      replace,
+		"regexMatch":   regexMatch,
+		"regexReplace": regexReplace,
+		"hasGroup":     hasGroup,
+		"jsonPath":     jsonPath,
+		"b64":          b64,
+		"b64dec":       b64dec,
+		"sha256":       sha256Hex,
+		"default":      defaultValue,
+	}
+}
+
+// split splits the string at each separator, eg. `{{ .Value | split "," }}`
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// join joins the values with the separator, eg. `{{ .Groups | join "," }}`.
+// Values other than strings are formatted as with `fmt.Sprint`.
+func join(sep string, values interface{}) (string, error) {
+	switch v := values.(type) {
+	case nil:
+		return "", nil
+	case []string:
+		return strings.Join(v, sep), nil
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, value := range v {
+			parts = append(parts, fmt.Sprint(value))
+		}
+		return strings.Join(parts, sep), nil
+	default:
+		return "", fmt.Errorf("join: unsupported type %T", values)
+	}
+}
+
+// replace replaces every occurrence of old with the replacement, eg.
+// `{{ .Email | replace "@" "_at_" }}`
+func replace(old, replacement, s string) string {
+	return strings.ReplaceAll(s, old, replacement)
+}
+
+// regexMatch reports whether the string matches the regular expression, eg.
+// `{{ if .Email | regexMatch "@example\\.com$" }}`
+func regexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("regexMatch: %v", err)
+	}
+	return re.MatchString(s), nil
+}
+
+// regexReplace replaces the matches of the regular expression with the
+// replacement, which may refer to submatches as `$1`, eg.
+// `{{ .Email | regexReplace "@.*$" "" }}`
+func regexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("regexReplace: %v", err)
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// hasGroup reports whether the group is one of the groups, eg.
+// `{{ if hasGroup "admins" .Groups }}`
+func hasGroup(group string, groups []string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonPath gets the value at the JSONPath expression from JSON data, which
+// may be either a JSON encoded string or already decoded, eg.
+// `{{ .Claims | jsonPath "$.realm_access.roles" | join "," }}`.
+// A single match is returned as it is, several matches as a list and no
+// match as nil.
+func jsonPath(path string, data interface{}) (interface{}, error) {
+	expr, err := jp.ParseString(path)
+	if err != nil {
+		return nil, fmt.Errorf("jsonPath: invalid path %q: %v", path, err)
+	}
+
+	switch v := data.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(v), &data); err != nil {
+			return nil, fmt.Errorf("jsonPath: invalid JSON: %v", err)
+		}
+	case []byte:
+		if err := json.Unmarshal(v, &data); err != nil {
+			return nil, fmt.Errorf("jsonPath: invalid JSON: %v", err)
+		}
+	}
+
+	results := expr.Get(data)
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return results[0], nil
+	default:
+		return results, nil
+	}
+}
+
+// b64 encodes the string with standard, padded base64, eg.
+// `{{ printf "%s:%s" .User .Email | b64 }}`
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// b64dec decodes the standard or URL base64 encoded string, with or without
+// padding
+func b64dec(s string) (string, error) {
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return string(decoded), nil
+		}
+	}
+	return "", fmt.Errorf("b64dec: %q is not base64 encoded", s)
+}
+
+// sha256Hex hashes the string with SHA-256, returning the hex encoded hash, eg.
+// `{{ .Email | lower | sha256 }}`
+func sha256Hex(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+// defaultValue returns the value, or the default when it is empty, eg.
+// `{{ .Name | default "anonymous" }}`
+func defaultValue(def string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	case []string:
+		if len(v) == 0 {
+			return def
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return def
+		}
+	}
+	return value
+}
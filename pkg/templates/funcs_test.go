@@ -0,0 +1,124 @@
+package templates
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"text/template"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template functions", func() {
+	data := map[string]interface{}{
+		"User":   "john",
+		"Email":  "John.Doe@example.com",
+		"Groups": []string{"admins", "devs"},
+		"Empty":  "",
+		"Claims": `{"realm_access":{"roles":["viewer","editor"]},"tenant":"acme"}`,
+		"Basic":  "am9objpzZWNyZXQ=",
+	}
+
+	type funcsTableInput struct {
+		template      string
+		expected      string
+		expectedError string
+	}
+
+	DescribeTable("rendering a template",
+		func(in funcsTableInput) {
+			t, err := template.New("test").Funcs(FuncMap()).Parse(in.template)
+			Expect(err).ToNot(HaveOccurred())
+
+			buf := bytes.NewBuffer(nil)
+			err = t.Execute(buf, data)
+			if in.expectedError != "" {
+				Expect(err).To(MatchError(ContainSubstring(in.expectedError)))
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(Equal(in.expected))
+		},
+		Entry("with upper and lower", funcsTableInput{
+			template: `{{ .Email | lower }} {{ .User | upper }} {{ .User | ToUpper }}`,
+			expected: "john.doe@example.com JOHN JOHN",
+		}),
+		Entry("with trim", funcsTableInput{
+			template: `{{ "  padded " | trim }}`,
+			expected: "padded",
+		}),
+		Entry("with split and join", funcsTableInput{
+			template: `{{ "a,b,c" | split "," | join ";" }}`,
+			expected: "a;b;c",
+		}),
+		Entry("with join of groups", funcsTableInput{
+			template: `{{ .Groups | join "," }}`,
+			expected: "admins,devs",
+		}),
+		Entry("with join of an unsupported type", funcsTableInput{
+			template:      `{{ .User | join "," }}`,
+			expectedError: "join: unsupported type string",
+		}),
+		Entry("with replace", funcsTableInput{
+			template: `{{ .Email | replace "@" "_at_" }}`,
+			expected: "John.Doe_at_example.com",
+		}),
+		Entry("with regexMatch", funcsTableInput{
+			template: `{{ if .Email | regexMatch "@example\\.com$" }}match{{ end }}`,
+			expected: "match",
+		}),
+		Entry("with regexReplace", funcsTableInput{
+			template: `{{ .Email | regexReplace "^([^.]+)\\..*$" "$1" }}`,
+			expected: "John",
+		}),
+		Entry("with an invalid regular expression", funcsTableInput{
+			template:      `{{ .Email | regexReplace "(" "" }}`,
+			expectedError: "regexReplace: error parsing regexp",
+		}),
+		Entry("with hasGroup", funcsTableInput{
+			template: `{{ hasGroup "admins" .Groups }} {{ hasGroup "ops" .Groups }}`,
+			expected: "true false",
+		}),
+		Entry("with jsonPath matching a value", funcsTableInput{
+			template: `{{ .Claims | jsonPath "$.tenant" }}`,
+			expected: "acme",
+		}),
+		Entry("with jsonPath matching a list", funcsTableInput{
+			template: `{{ .Claims | jsonPath "$.realm_access.roles[*]" | join "," }}`,
+			expected: "viewer,editor",
+		}),
+		Entry("with jsonPath matching nothing", funcsTableInput{
+			template: `{{ .Claims | jsonPath "$.missing" | default "none" }}`,
+			expected: "none",
+		}),
+		Entry("with jsonPath of invalid JSON", funcsTableInput{
+			template:      `{{ .User | jsonPath "$.tenant" }}`,
+			expectedError: "jsonPath: invalid JSON",
+		}),
+		Entry("with b64 and b64dec", funcsTableInput{
+			template: `{{ printf "%s:secret" .User | b64 }} {{ .Basic | b64dec }}`,
+			expected: "am9objpzZWNyZXQ= john:secret",
+		}),
+		Entry("with b64dec of unpadded URL base64", funcsTableInput{
+			template: `{{ "PDw_Pz4" | b64dec }}`,
+			expected: "<<??>",
+		}),
+		Entry("with sha256", funcsTableInput{
+			template: `{{ .User | sha256 }}`,
+			expected: "96d9632f363564cc3032521409cf22a852f2032eec099ed5967c0d000cec607a",
+		}),
+		Entry("with default", funcsTableInput{
+			template: `{{ .Empty | default "anonymous" }} {{ .User | default "anonymous" }}`,
+			expected: "anonymous john",
+		}),
+	)
+
+	It("can be used in HTML templates", func() {
+		t, err := htmltemplate.New("test").Funcs(FuncMap()).Parse(`<p>{{ .Groups | join ", " }}</p>`)
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := bytes.NewBuffer(nil)
+		Expect(t.Execute(buf, data)).To(Succeed())
+		Expect(buf.String()).To(Equal("<p>admins, devs</p>"))
+	})
+})
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// accessTokenAudienceMatches returns whether the access token has one of the
+// audiences in its `aud` or `scp` claims. Access tokens that are not JWTs
+// cannot be checked and always match.
+func accessTokenAudienceMatches(accessToken string, audiences []string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		return true
+	}
+
+	tokenAudiences, _ := claims.GetAudience()
+	tokenAudiences = append(tokenAudiences, getScopes(claims)...)
+	for _, audience := range audiences {
+		for _, tokenAudience := range tokenAudiences {
+			if audience == tokenAudience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getScopes returns the scopes of the `scp` claim, which is either a space
+// separated string or a list of strings
+func getScopes(claims jwt.MapClaims) []string {
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes := []string{}
+		for _, scope := range scp {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	default:
+		return nil
+	}
+}
+
+// stripAccessToken removes the headers holding the access token of the session
+// from the request when the access token is not for one of the audiences of
+// the upstream server
+func stripAccessToken(req *http.Request, session *sessionsapi.SessionState, upstream string, audiences []string) {
+	if len(audiences) == 0 || session == nil || session.AccessToken == "" {
+		return
+	}
+	if accessTokenAudienceMatches(session.AccessToken, audiences) {
+		return
+	}
+
+	for name, values := range req.Header {
+		for _, value := range values {
+			if strings.Contains(value, session.AccessToken) {
+				logger.Errorf("Removing the %s header from the request to upstream %q: the access token is not for an audience of the upstream", name, upstream)
+				req.Header.Del(name)
+				break
+			}
+		}
+	}
+}
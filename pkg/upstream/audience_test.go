@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Access token audience", func() {
+	newToken := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		return token
+	}
+
+	type stripAccessTokenTableInput struct {
+		accessToken    string
+		audiences      []string
+		expectStripped bool
+	}
+
+	DescribeTable("stripAccessToken",
+		func(in stripAccessTokenTableInput) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.localhost/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+in.accessToken)
+			req.Header.Set("X-Forwarded-Access-Token", in.accessToken)
+			req.Header.Set("X-Forwarded-User", "user")
+
+			session := &sessionsapi.SessionState{AccessToken: in.accessToken}
+			stripAccessToken(req, session, "upstream", in.audiences)
+
+			if in.expectStripped {
+				Expect(req.Header).To(Equal(http.Header{"X-Forwarded-User": []string{"user"}}))
+			} else {
+				Expect(req.Header).To(HaveLen(3))
+			}
+		},
+		Entry("with no audiences", stripAccessTokenTableInput{
+			accessToken:    newToken(jwt.MapClaims{"aud": "other"}),
+			expectStripped: false,
+		}),
+		Entry("with a matching aud claim", stripAccessTokenTableInput{
+			accessToken:    newToken(jwt.MapClaims{"aud": []string{"other", "api://upstream"}}),
+			audiences:      []string{"api://upstream"},
+			expectStripped: false,
+		}),
+		Entry("with a matching scp claim", stripAccessTokenTableInput{
+			accessToken:    newToken(jwt.MapClaims{"aud": "other", "scp": "read upstream.read"}),
+			audiences:      []string{"upstream.read"},
+			expectStripped: false,
+		}),
+		Entry("with a matching scp list claim", stripAccessTokenTableInput{
+			accessToken:    newToken(jwt.MapClaims{"scp": []string{"upstream.read"}}),
+			audiences:      []string{"upstream.read"},
+			expectStripped: false,
+		}),
+		Entry("with a different audience", stripAccessTokenTableInput{
+			accessToken:    newToken(jwt.MapClaims{"aud": "other", "scp": "read"}),
+			audiences:      []string{"api://upstream"},
+			expectStripped: true,
+		}),
+		Entry("with an opaque access token", stripAccessTokenTableInput{
+			accessToken:    "opaque-access-token",
+			audiences:      []string{"api://upstream"},
+			expectStripped: false,
+		}),
+	)
+})
@@ -0,0 +1,357 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loadBalancer proxies the requests to an upstream across its healthy
+// targets, in proportion to their weights
+type loadBalancer struct {
+	upstream         string
+	targets          []*balancerTarget
+	failureThreshold int
+	cooldown         time.Duration
+	clock            clock.Clock
+	writer           pagewriter.Writer
+	metrics          *balancerMetrics
+	stop             chan struct{}
+
+	mu sync.Mutex
+}
+
+// balancerTarget is a single target of a loadBalancer
+type balancerTarget struct {
+	uri     string
+	weight  int
+	handler http.Handler
+	probe   *url.URL
+	client  *http.Client
+
+	// current is the smooth weighted round robin weight of the target,
+	// guarded by the mutex of the loadBalancer
+	current int
+
+	mu           sync.Mutex
+	failures     int
+	skippedUntil time.Time
+	probeFailed  bool
+}
+
+// newLoadBalancer creates the proxies to each of the targets of the upstream,
+// and starts their active health checks
+func newLoadBalancer(upstream options.Upstream, sigData *options.SignatureData, errorHandler ProxyErrorHandler, writer pagewriter.Writer, metrics *balancerMetrics) (*loadBalancer, error) {
+	b := &loadBalancer{
+		upstream: upstream.ID,
+		cooldown: options.DefaultUpstreamHealthCheckCooldown,
+		writer:   writer,
+		metrics:  metrics,
+		stop:     make(chan struct{}),
+	}
+
+	hc := upstream.HealthCheck
+	if hc == nil {
+		hc = &options.UpstreamHealthCheck{}
+	}
+	b.failureThreshold = hc.FailureThreshold
+	if hc.Cooldown != nil {
+		b.cooldown = hc.Cooldown.Duration()
+	}
+	timeout := options.DefaultUpstreamHealthCheckTimeout
+	if hc.Timeout != nil {
+		timeout = hc.Timeout.Duration()
+	}
+
+	for _, target := range upstream.Targets {
+		u, err := url.Parse(target.URI)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URI for target %q: %w", target.URI, err)
+		}
+		handler, err := newHTTPUpstreamProxy(upstream, u, sigData, errorHandler)
+		if err != nil {
+			return nil, fmt.Errorf("could not create proxy for target %q: %v", target.URI, err)
+		}
+
+		t := &balancerTarget{
+			uri:     target.URI,
+			weight:  target.Weight,
+			handler: handler,
+		}
+		if t.weight <= 0 {
+			t.weight = 1
+		}
+		if hc.Path != "" {
+			t.probe = healthCheckURL(u, hc.Path)
+			t.client = &http.Client{
+				Transport: newUpstreamTransport(u, upstream),
+				Timeout:   timeout,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+		}
+		b.targets = append(b.targets, t)
+		metrics.healthy.WithLabelValues(b.upstream, t.uri).Set(1)
+	}
+
+	if hc.Path != "" {
+		interval := options.DefaultUpstreamHealthCheckInterval
+		if hc.Interval != nil {
+			interval = hc.Interval.Duration()
+		}
+		go b.runHealthChecks(interval)
+	}
+	return b, nil
+}
+
+// targetURIs returns the URIs of the targets
+func targetURIs(targets []options.UpstreamTarget) []string {
+	uris := make([]string, 0, len(targets))
+	for _, target := range targets {
+		uris = append(uris, target.URI)
+	}
+	return uris
+}
+
+// healthCheckURL returns the URL of the health check path of the target
+func healthCheckURL(target *url.URL, path string) *url.URL {
+	if target.Scheme == unixScheme {
+		// The transport dials the socket of the target, so only the path
+		// of the health check is requested
+		return &url.URL{Scheme: unixScheme, Host: "localhost", Path: path}
+	}
+	return &url.URL{Scheme: target.Scheme, Host: target.Host, Path: path}
+}
+
+// ServeHTTP proxies the request to the next healthy target, recording whether
+// the target failed to handle it
+func (b *loadBalancer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	t := b.next()
+	if t == nil {
+		scope := middleware.GetRequestScope(req)
+		scope.Upstream = b.upstream
+		b.writer.WriteErrorPage(rw, pagewriter.ErrorPageOpts{
+			Status:    http.StatusServiceUnavailable,
+			RequestID: scope.RequestID,
+			AppError:  fmt.Sprintf("upstream %q has no healthy targets", b.upstream),
+			Messages:  []interface{}{"The upstream server is temporarily unavailable."},
+		})
+		return
+	}
+
+	if b.failureThreshold <= 0 {
+		t.handler.ServeHTTP(rw, req)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+	t.handler.ServeHTTP(recorder, req)
+
+	switch {
+	case req.Context().Err() != nil:
+		// The client went away, which says nothing about the target
+	case isUpstreamFailure(recorder.status):
+		b.failure(t)
+	default:
+		b.success(t)
+	}
+}
+
+// next picks the healthy target to proxy the next request to with the smooth
+// weighted round robin algorithm, which spreads the requests to each target
+// evenly between the requests to the others.
+// It returns nil if no target is healthy.
+func (b *loadBalancer) next() *balancerTarget {
+	now := b.clock.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *balancerTarget
+	total := 0
+	for _, t := range b.targets {
+		if !b.isHealthy(t, now) {
+			continue
+		}
+		t.current += t.weight
+		total += t.weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// isHealthy returns whether requests may be proxied to the target, returning
+// targets to the rotation once the cooldown they were skipped for has passed
+func (b *loadBalancer) isHealthy(t *balancerTarget, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.skippedUntil.IsZero() && !now.Before(t.skippedUntil) {
+		t.skippedUntil = time.Time{}
+		b.updateHealthy(t)
+	}
+	return !t.probeFailed && t.skippedUntil.IsZero()
+}
+
+// verifyTargets returns an error when none of the targets are healthy, for
+// the readiness checks of the proxy
+func (b *loadBalancer) verifyTargets(_ context.Context) error {
+	now := b.clock.Now()
+	for _, t := range b.targets {
+		if b.isHealthy(t, now) {
+			return nil
+		}
+	}
+	return fmt.Errorf("none of the %d targets are healthy", len(b.targets))
+}
+
+// success resets the failures of the target
+func (b *loadBalancer) success(t *balancerTarget) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures >= b.failureThreshold {
+		logger.Printf("Target %s of upstream %s has recovered", t.uri, b.upstream)
+		b.updateHealthy(t)
+	}
+	t.failures = 0
+}
+
+// failure records a failure, skipping the target for the cooldown once the
+// threshold is reached
+func (b *loadBalancer) failure(t *balancerTarget) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures++
+	if t.failures < b.failureThreshold {
+		return
+	}
+	if t.failures == b.failureThreshold {
+		logger.Errorf("Target %s of upstream %s is failing, skipping it for %s", t.uri, b.upstream, b.cooldown)
+	}
+	t.skippedUntil = b.clock.Now().Add(b.cooldown)
+	b.updateHealthy(t)
+}
+
+// runHealthChecks probes each target every interval until the health checks
+// are stopped
+func (b *loadBalancer) runHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.checkHealth()
+		select {
+		case <-ticker.C:
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// stopHealthChecks stops the active health checks of the targets
+func (b *loadBalancer) stopHealthChecks() {
+	close(b.stop)
+}
+
+// checkHealth probes all the targets concurrently
+func (b *loadBalancer) checkHealth() {
+	var wg sync.WaitGroup
+	for _, t := range b.targets {
+		wg.Add(1)
+		go func(t *balancerTarget) {
+			defer wg.Done()
+			b.probe(t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// probe requests the health check path of the target, marking it unhealthy
+// while the request fails
+func (b *loadBalancer) probe(t *balancerTarget) {
+	err := t.check()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		if !t.probeFailed {
+			logger.Errorf("Target %s of upstream %s failed its health check: %v", t.uri, b.upstream, err)
+		}
+		t.probeFailed = true
+	} else {
+		if t.probeFailed {
+			logger.Printf("Target %s of upstream %s passed its health check", t.uri, b.upstream)
+		}
+		t.probeFailed = false
+		// A target skipped for failing requests is back once it passes its
+		// health check
+		t.skippedUntil = time.Time{}
+		t.failures = 0
+	}
+	b.updateHealthy(t)
+}
+
+// check requests the health check path of the target
+func (t *balancerTarget) check() error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, t.probe.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+// updateHealthy records whether the target is healthy in the metrics.
+// The mutex of the target must be held.
+func (b *loadBalancer) updateHealthy(t *balancerTarget) {
+	healthy := 0.0
+	if !t.probeFailed && t.skippedUntil.IsZero() {
+		healthy = 1
+	}
+	b.metrics.healthy.WithLabelValues(b.upstream, t.uri).Set(healthy)
+}
+
+// balancerMetrics are the prometheus metrics recorded by the load balancers
+type balancerMetrics struct {
+	healthy *prometheus.GaugeVec
+}
+
+func newBalancerMetrics(registerer prometheus.Registerer) *balancerMetrics {
+	return &balancerMetrics{
+		healthy: metrics.Register(registerer, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "oauth2_proxy_upstream_target_healthy",
+				Help: "Whether a target of an upstream receives requests (1) or is skipped as unhealthy (0).",
+			},
+			[]string{"upstream", "target"},
+		)).(*prometheus.GaugeVec),
+	}
+}
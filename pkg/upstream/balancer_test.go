@@ -0,0 +1,157 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Load Balancer Suite", func() {
+	const upstreamID = "balanced-backend"
+
+	// target is a backend server answering with its name, or with its status
+	// and health status when set
+	type target struct {
+		server       *httptest.Server
+		status       atomic.Int32
+		healthStatus atomic.Int32
+	}
+
+	var targets []*target
+	var metrics *balancerMetrics
+
+	writer := &pagewriter.WriterFuncs{
+		ErrorPageFunc: func(rw http.ResponseWriter, opts pagewriter.ErrorPageOpts) {
+			rw.WriteHeader(opts.Status)
+			rw.Write([]byte("Error Page"))
+		},
+		ProxyErrorFunc: func(rw http.ResponseWriter, _ *http.Request, _ error) {
+			rw.WriteHeader(http.StatusBadGateway)
+			rw.Write([]byte("Proxy Error"))
+		},
+	}
+
+	BeforeEach(func() {
+		targets = nil
+		for _, name := range []string{"a", "b", "c"} {
+			t := &target{}
+			t.status.Store(http.StatusOK)
+			t.healthStatus.Store(http.StatusOK)
+			t.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/healthz" {
+					rw.WriteHeader(int(t.healthStatus.Load()))
+					return
+				}
+				rw.WriteHeader(int(t.status.Load()))
+				rw.Write([]byte(name))
+			}))
+			targets = append(targets, t)
+		}
+		metrics = newBalancerMetrics(prometheus.NewRegistry())
+	})
+
+	AfterEach(func() {
+		for _, t := range targets {
+			t.server.Close()
+		}
+	})
+
+	newBalancer := func(weights []int, hc *options.UpstreamHealthCheck) *loadBalancer {
+		upstream := options.Upstream{
+			ID:          upstreamID,
+			Path:        "/",
+			HealthCheck: hc,
+		}
+		for i, weight := range weights {
+			upstream.Targets = append(upstream.Targets, options.UpstreamTarget{URI: targets[i].server.URL, Weight: weight})
+		}
+
+		balancer, err := newLoadBalancer(upstream, nil, writer.ProxyErrorHandler, writer, metrics)
+		Expect(err).ToNot(HaveOccurred())
+		return balancer
+	}
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	serveMany := func(handler http.Handler, n int) []string {
+		bodies := []string{}
+		for i := 0; i < n; i++ {
+			bodies = append(bodies, serve(handler).Body.String())
+		}
+		return bodies
+	}
+
+	healthy := func(uri string) float64 {
+		return testutil.ToFloat64(metrics.healthy.WithLabelValues(upstreamID, uri))
+	}
+
+	It("spreads requests across the targets by their weights", func() {
+		balancer := newBalancer([]int{2, 0, 1}, nil)
+		Expect(serveMany(balancer, 8)).To(Equal([]string{"a", "b", "c", "a", "a", "b", "c", "a"}))
+	})
+
+	It("skips targets failing proxied requests for the cooldown", func() {
+		cooldown := options.Duration(time.Minute)
+		balancer := newBalancer([]int{1, 1}, &options.UpstreamHealthCheck{FailureThreshold: 2, Cooldown: &cooldown})
+		balancer.clock.Set(time.Now())
+		defer balancer.clock.Reset()
+
+		targets[1].status.Store(http.StatusServiceUnavailable)
+		Expect(serveMany(balancer, 4)).To(Equal([]string{"a", "b", "a", "b"}))
+		Expect(healthy(targets[1].server.URL)).To(Equal(0.0))
+
+		Expect(serveMany(balancer, 2)).To(Equal([]string{"a", "a"}))
+
+		// A single failure skips the target again after the cooldown
+		Expect(balancer.clock.Add(time.Minute)).To(Succeed())
+		Expect(serveMany(balancer, 4)).To(Equal([]string{"a", "b", "a", "a"}))
+
+		// The target is back once a request to it succeeds
+		targets[1].status.Store(http.StatusOK)
+		Expect(balancer.clock.Add(time.Minute)).To(Succeed())
+		Expect(serveMany(balancer, 4)).To(Equal([]string{"a", "b", "a", "b"}))
+		Expect(healthy(targets[1].server.URL)).To(Equal(1.0))
+	})
+
+	It("skips targets failing their active health checks until they pass", func() {
+		interval := options.Duration(10 * time.Millisecond)
+		balancer := newBalancer([]int{1, 1}, &options.UpstreamHealthCheck{Path: "/healthz", Interval: &interval})
+		defer balancer.stopHealthChecks()
+
+		targets[1].healthStatus.Store(http.StatusInternalServerError)
+		Eventually(func() float64 { return healthy(targets[1].server.URL) }).Should(Equal(0.0))
+		Expect(serveMany(balancer, 3)).To(Equal([]string{"a", "a", "a"}))
+
+		targets[1].healthStatus.Store(http.StatusOK)
+		Eventually(func() float64 { return healthy(targets[1].server.URL) }).Should(Equal(1.0))
+		Expect(serveMany(balancer, 2)).To(ConsistOf("a", "b"))
+	})
+
+	It("serves the error page when no target is healthy", func() {
+		balancer := newBalancer([]int{1}, &options.UpstreamHealthCheck{FailureThreshold: 1})
+
+		targets[0].status.Store(http.StatusBadGateway)
+		Expect(serve(balancer).Body.String()).To(Equal("a"))
+
+		rw := serve(balancer)
+		Expect(rw.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rw.Body.String()).To(Equal("Error Page"))
+		Expect(balancer.verifyTargets(context.Background())).To(MatchError("none of the 1 targets are healthy"))
+	})
+})
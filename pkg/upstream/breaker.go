@@ -0,0 +1,274 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// circuitBreaker tracks the failures of a single upstream server.
+// It opens after threshold consecutive failures. Once the cooldown has
+// passed it lets a single probe request through, and is closed by the
+// probe succeeding or reopened by it failing.
+type circuitBreaker struct {
+	upstream  string
+	threshold int
+	cooldown  time.Duration
+	clock     clock.Clock
+	metrics   *breakerMetrics
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(upstream string, threshold int, cooldown time.Duration, metrics *breakerMetrics) *circuitBreaker {
+	metrics.open.WithLabelValues(upstream).Set(0)
+	return &circuitBreaker{
+		upstream:  upstream,
+		threshold: threshold,
+		cooldown:  cooldown,
+		metrics:   metrics,
+	}
+}
+
+// allow returns whether a request may be proxied to the upstream server, and
+// whether the request is the probe of an open circuit
+func (b *circuitBreaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if b.probing || b.clock.Now().Before(b.openedAt.Add(b.cooldown)) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if b.failures >= b.threshold {
+		logger.Printf("Upstream %s has recovered, closing its circuit breaker", b.upstream)
+	}
+	b.failures = 0
+	b.metrics.open.WithLabelValues(b.upstream).Set(0)
+}
+
+// failure records a failure, opening the circuit once the threshold is reached
+func (b *circuitBreaker) failure(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return
+	}
+	if b.failures == b.threshold || probe {
+		logger.Errorf("Upstream %s is failing, opening its circuit breaker for %s", b.upstream, b.cooldown)
+		b.metrics.trips.WithLabelValues(b.upstream).Inc()
+	}
+	b.openedAt = b.clock.Now()
+	b.metrics.open.WithLabelValues(b.upstream).Set(1)
+}
+
+// release ends a probe without recording its outcome, so that another
+// request can probe the upstream server
+func (b *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// circuitBreakerProxy proxies requests to the upstream handler while its
+// circuit is closed, and to the fallback handler while it is open
+type circuitBreakerProxy struct {
+	breaker  *circuitBreaker
+	handler  http.Handler
+	fallback http.Handler
+}
+
+// newCircuitBreakerProxy wraps the upstream handler with the circuit breaker
+// configured for the upstream. The handler is returned unchanged if the
+// circuit breaker is disabled.
+func newCircuitBreakerProxy(upstream options.Upstream, handler http.Handler, sigData *options.SignatureData, writer pagewriter.Writer, metrics *breakerMetrics) (http.Handler, error) {
+	cb := upstream.CircuitBreaker
+	if cb == nil || cb.FailureThreshold <= 0 {
+		return handler, nil
+	}
+
+	cooldown := options.DefaultUpstreamCircuitBreakerCooldown
+	if cb.Cooldown != nil {
+		cooldown = cb.Cooldown.Duration()
+	}
+
+	fallback, err := newCircuitOpenHandler(upstream, sigData, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &circuitBreakerProxy{
+		breaker:  newCircuitBreaker(upstream.ID, cb.FailureThreshold, cooldown, metrics),
+		handler:  handler,
+		fallback: fallback,
+	}, nil
+}
+
+// newCircuitOpenHandler creates the handler serving requests while the
+// circuit is open: a proxy to the fallback server, the static error page or
+// the standard error page
+func newCircuitOpenHandler(upstream options.Upstream, sigData *options.SignatureData, writer pagewriter.Writer) (http.Handler, error) {
+	cb := upstream.CircuitBreaker
+
+	if cb.FallbackURI != "" {
+		u, err := url.Parse(cb.FallbackURI)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing fallback URI: %w", err)
+		}
+		return newHTTPUpstreamProxy(upstream, u, sigData, writer.ProxyErrorHandler)
+	}
+
+	if cb.ErrorPage != "" {
+		page, err := os.ReadFile(cb.ErrorPage)
+		if err != nil {
+			return nil, fmt.Errorf("could not read error page: %v", err)
+		}
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			middleware.GetRequestScope(req).Upstream = upstream.ID
+			rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = rw.Write(page)
+		}), nil
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		scope := middleware.GetRequestScope(req)
+		scope.Upstream = upstream.ID
+		writer.WriteErrorPage(rw, pagewriter.ErrorPageOpts{
+			Status:    http.StatusServiceUnavailable,
+			RequestID: scope.RequestID,
+			AppError:  fmt.Sprintf("circuit breaker for upstream %q is open", upstream.ID),
+			Messages:  []interface{}{"The upstream server is temporarily unavailable."},
+		})
+	}), nil
+}
+
+// ServeHTTP proxies the request while the circuit is closed, recording
+// whether the upstream server failed to handle it
+func (p *circuitBreakerProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	ok, probe := p.breaker.allow()
+	if !ok {
+		p.breaker.metrics.rejected.WithLabelValues(p.breaker.upstream).Inc()
+		p.fallback.ServeHTTP(rw, req)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+	p.handler.ServeHTTP(recorder, req)
+
+	switch {
+	case req.Context().Err() != nil:
+		// The client went away, which says nothing about the upstream server
+		p.breaker.release(probe)
+	case isUpstreamFailure(recorder.status):
+		p.breaker.failure(probe)
+	default:
+		p.breaker.success(probe)
+	}
+}
+
+// isUpstreamFailure returns whether the response status shows that the
+// upstream server could not be reached or could not handle the request
+func isUpstreamFailure(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusRecorder records the status code written to the ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap allows the http.ResponseController to flush and hijack the
+// underlying ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// breakerMetrics are the prometheus metrics recorded by the circuit breakers
+type breakerMetrics struct {
+	open     *prometheus.GaugeVec
+	trips    *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+}
+
+func newBreakerMetrics(registerer prometheus.Registerer) *breakerMetrics {
+	return &breakerMetrics{
+		open: metrics.Register(registerer, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "oauth2_proxy_upstream_circuit_open",
+				Help: "Whether the circuit breaker for an upstream is open (1) or closed (0).",
+			},
+			[]string{"upstream"},
+		)).(*prometheus.GaugeVec),
+		trips: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_upstream_circuit_trips_total",
+				Help: "Total number of times the circuit breaker for an upstream has opened.",
+			},
+			[]string{"upstream"},
+		)).(*prometheus.CounterVec),
+		rejected: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_upstream_circuit_rejected_total",
+				Help: "Total number of requests not proxied to an upstream because its circuit breaker was open.",
+			},
+			[]string{"upstream"},
+		)).(*prometheus.CounterVec),
+	}
+}
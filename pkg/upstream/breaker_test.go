@@ -0,0 +1,180 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Circuit Breaker Suite", func() {
+	const upstreamID = "breaker-backend"
+
+	var backend *httptest.Server
+	var backendStatus int
+	var backendRequests int
+	var metrics *breakerMetrics
+
+	writer := &pagewriter.WriterFuncs{
+		ErrorPageFunc: func(rw http.ResponseWriter, opts pagewriter.ErrorPageOpts) {
+			rw.WriteHeader(opts.Status)
+			rw.Write([]byte("Error Page"))
+		},
+		ProxyErrorFunc: func(rw http.ResponseWriter, _ *http.Request, _ error) {
+			rw.WriteHeader(http.StatusBadGateway)
+			rw.Write([]byte("Proxy Error"))
+		},
+	}
+
+	BeforeEach(func() {
+		backendStatus = http.StatusOK
+		backendRequests = 0
+		backend = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			backendRequests++
+			rw.WriteHeader(backendStatus)
+			rw.Write([]byte("backend"))
+		}))
+		metrics = newBreakerMetrics(prometheus.NewRegistry())
+	})
+
+	AfterEach(func() {
+		backend.Close()
+	})
+
+	newProxy := func(cb *options.UpstreamCircuitBreaker) *circuitBreakerProxy {
+		cooldown := options.Duration(time.Minute)
+		cb.FailureThreshold = 2
+		cb.Cooldown = &cooldown
+		upstream := options.Upstream{
+			ID:             upstreamID,
+			Path:           "/",
+			URI:            backend.URL,
+			CircuitBreaker: cb,
+		}
+
+		u, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := newHTTPUpstreamProxy(upstream, u, nil, writer.ProxyErrorHandler)
+		Expect(err).ToNot(HaveOccurred())
+		handler, err := newCircuitBreakerProxy(upstream, proxy, nil, writer, metrics)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(handler).To(BeAssignableToTypeOf(&circuitBreakerProxy{}))
+		return handler.(*circuitBreakerProxy)
+	}
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	It("returns the handler unchanged when disabled", func() {
+		handler := http.NewServeMux()
+		upstream := options.Upstream{ID: upstreamID, CircuitBreaker: &options.UpstreamCircuitBreaker{}}
+		Expect(newCircuitBreakerProxy(upstream, handler, nil, writer, metrics)).To(BeIdenticalTo(handler))
+	})
+
+	It("opens after consecutive failures and closes once a probe succeeds", func() {
+		proxy := newProxy(&options.UpstreamCircuitBreaker{})
+		proxy.breaker.clock.Set(time.Now())
+		defer proxy.breaker.clock.Reset()
+
+		backendStatus = http.StatusServiceUnavailable
+		Expect(serve(proxy).Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(testutil.ToFloat64(metrics.open.WithLabelValues(upstreamID))).To(Equal(0.0))
+		Expect(serve(proxy).Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(testutil.ToFloat64(metrics.open.WithLabelValues(upstreamID))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.trips.WithLabelValues(upstreamID))).To(Equal(1.0))
+
+		// While open, requests are not proxied to the backend
+		backendStatus = http.StatusOK
+		rw := serve(proxy)
+		Expect(rw.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rw.Body.String()).To(Equal("Error Page"))
+		Expect(backendRequests).To(Equal(2))
+		Expect(testutil.ToFloat64(metrics.rejected.WithLabelValues(upstreamID))).To(Equal(1.0))
+
+		// After the cooldown a probe is proxied, closing the circuit
+		Expect(proxy.breaker.clock.Add(time.Minute)).To(Succeed())
+		rw = serve(proxy)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(backendRequests).To(Equal(3))
+		Expect(testutil.ToFloat64(metrics.open.WithLabelValues(upstreamID))).To(Equal(0.0))
+	})
+
+	It("reopens when a probe fails", func() {
+		proxy := newProxy(&options.UpstreamCircuitBreaker{})
+		proxy.breaker.clock.Set(time.Now())
+		defer proxy.breaker.clock.Reset()
+
+		backendStatus = http.StatusBadGateway
+		serve(proxy)
+		serve(proxy)
+
+		Expect(proxy.breaker.clock.Add(time.Minute)).To(Succeed())
+		ok, probe := proxy.breaker.allow()
+		Expect(ok).To(BeTrue())
+		Expect(probe).To(BeTrue())
+
+		// Only one probe is let through at a time
+		ok, _ = proxy.breaker.allow()
+		Expect(ok).To(BeFalse())
+
+		proxy.breaker.failure(probe)
+		Expect(testutil.ToFloat64(metrics.trips.WithLabelValues(upstreamID))).To(Equal(2.0))
+		ok, _ = proxy.breaker.allow()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("counts connection errors as failures", func() {
+		proxy := newProxy(&options.UpstreamCircuitBreaker{})
+		backend.Close()
+
+		Expect(serve(proxy).Code).To(Equal(http.StatusBadGateway))
+		Expect(serve(proxy).Code).To(Equal(http.StatusBadGateway))
+		Expect(serve(proxy).Code).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("serves the fallback upstream while open", func() {
+		fallback := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Write([]byte("fallback"))
+		}))
+		defer fallback.Close()
+
+		proxy := newProxy(&options.UpstreamCircuitBreaker{FallbackURI: fallback.URL})
+		backendStatus = http.StatusGatewayTimeout
+		serve(proxy)
+		serve(proxy)
+
+		rw := serve(proxy)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(Equal("fallback"))
+	})
+
+	It("serves the static error page while open", func() {
+		errorPage := path.Join(GinkgoT().TempDir(), "error.html")
+		Expect(os.WriteFile(errorPage, []byte("<p>Down for maintenance</p>"), 0600)).To(Succeed())
+
+		proxy := newProxy(&options.UpstreamCircuitBreaker{ErrorPage: errorPage})
+		backendStatus = http.StatusServiceUnavailable
+		serve(proxy)
+		serve(proxy)
+
+		rw := serve(proxy)
+		Expect(rw.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rw.Header().Get(contentType)).To(Equal(textHTMLUTF8))
+		Expect(rw.Body.String()).To(Equal("<p>Down for maintenance</p>"))
+	})
+})
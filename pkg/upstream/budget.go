@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+)
+
+// timeoutBudget is the header holding the time remaining to respond to a
+// request, and the gateways trusted to set it
+type timeoutBudget struct {
+	header          string
+	trustedNetworks *ip.NetSet
+}
+
+// newTimeoutBudget parses the timeout budget options, returning nil when the
+// budget is not forwarded
+func newTimeoutBudget(opts *options.UpstreamTimeoutBudget) (*timeoutBudget, error) {
+	if opts == nil || opts.Header == "" {
+		return nil, nil
+	}
+
+	trustedNetworks := ip.NewNetSet()
+	for _, network := range opts.TrustedNetworks {
+		ipNet := ip.ParseIPNet(network)
+		if ipNet == nil {
+			return nil, fmt.Errorf("could not parse timeout budget trusted network (%s)", network)
+		}
+		trustedNetworks.AddIPNet(*ipNet)
+	}
+
+	return &timeoutBudget{
+		header:          http.CanonicalHeaderKey(opts.Header),
+		trustedNetworks: trustedNetworks,
+	}, nil
+}
+
+// inbound returns the budget sent by a trusted gateway, if any
+func (b *timeoutBudget) inbound(req *http.Request) (time.Duration, bool) {
+	value := req.Header.Get(b.header)
+	if value == "" {
+		return 0, false
+	}
+	remoteIP, err := ip.GetClientIP(nil, req)
+	if err != nil || !b.trustedNetworks.Has(remoteIP) {
+		return 0, false
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// timeoutBudgetHandler forwards the time remaining to respond to requests to
+// an upstream server
+type timeoutBudgetHandler struct {
+	budget  *timeoutBudget
+	timeout time.Duration
+	handler http.Handler
+}
+
+// newTimeoutBudgetHandler wraps the handler of an upstream server so that it
+// receives the remaining budget of each request, which is at most the timeout
+// of the upstream server
+func newTimeoutBudgetHandler(budget *timeoutBudget, upstream options.Upstream, handler http.Handler) http.Handler {
+	timeout := options.DefaultUpstreamTimeout
+	if upstream.Timeout != nil {
+		timeout = upstream.Timeout.Duration()
+	}
+
+	return &timeoutBudgetHandler{
+		budget:  budget,
+		timeout: timeout,
+		handler: handler,
+	}
+}
+
+// ServeHTTP sets the remaining budget on the request before passing it on.
+// The budget of a trusted gateway also bounds the request to the upstream
+// server, which is cancelled once it has passed.
+func (h *timeoutBudgetHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if inbound, ok := h.budget.inbound(req); ok {
+		ctx, cancel := context.WithTimeout(req.Context(), inbound)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	remaining := h.timeout
+	if deadline, ok := req.Context().Deadline(); ok {
+		remaining = min(remaining, time.Until(deadline))
+	}
+	remaining = max(remaining, 0)
+
+	req.Header.Set(h.budget.header, strconv.FormatInt(remaining.Milliseconds(), 10))
+	h.handler.ServeHTTP(rw, req)
+}
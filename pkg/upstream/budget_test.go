@@ -0,0 +1,109 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Timeout budget", func() {
+	const header = "X-Request-Timeout-Ms"
+
+	type timeoutBudgetTableInput struct {
+		remoteAddr     string
+		inbound        string
+		timeout        time.Duration
+		expectedBudget time.Duration
+		expectDeadline bool
+	}
+
+	DescribeTable("ServeHTTP",
+		func(in timeoutBudgetTableInput) {
+			budget, err := newTimeoutBudget(&options.UpstreamTimeoutBudget{
+				Header:          "x-request-timeout-ms",
+				TrustedNetworks: []string{"10.0.0.0/8"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var forwarded string
+			var hasDeadline bool
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				forwarded = req.Header.Get(header)
+				_, hasDeadline = req.Context().Deadline()
+			})
+
+			timeout := options.Duration(in.timeout)
+			upstream := options.Upstream{ID: "upstream", Timeout: &timeout}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.localhost/", nil)
+			req.RemoteAddr = in.remoteAddr
+			if in.inbound != "" {
+				req.Header.Set(header, in.inbound)
+			}
+			newTimeoutBudgetHandler(budget, upstream, handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			ms, err := strconv.ParseInt(forwarded, 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			// Allow for the time spent between setting the deadline and the header
+			Expect(time.Duration(ms) * time.Millisecond).To(BeNumerically("~", in.expectedBudget, 50*time.Millisecond))
+			Expect(hasDeadline).To(Equal(in.expectDeadline))
+		},
+		Entry("without an inbound budget", timeoutBudgetTableInput{
+			remoteAddr:     "10.0.0.1:1234",
+			timeout:        30 * time.Second,
+			expectedBudget: 30 * time.Second,
+			expectDeadline: false,
+		}),
+		Entry("with a shorter inbound budget from a trusted gateway", timeoutBudgetTableInput{
+			remoteAddr:     "10.0.0.1:1234",
+			inbound:        "5000",
+			timeout:        30 * time.Second,
+			expectedBudget: 5 * time.Second,
+			expectDeadline: true,
+		}),
+		Entry("with a longer inbound budget from a trusted gateway", timeoutBudgetTableInput{
+			remoteAddr:     "10.0.0.1:1234",
+			inbound:        "60000",
+			timeout:        30 * time.Second,
+			expectedBudget: 30 * time.Second,
+			expectDeadline: true,
+		}),
+		Entry("with an inbound budget from an untrusted address", timeoutBudgetTableInput{
+			remoteAddr:     "192.168.0.1:1234",
+			inbound:        "5000",
+			timeout:        30 * time.Second,
+			expectedBudget: 30 * time.Second,
+			expectDeadline: false,
+		}),
+		Entry("with an invalid inbound budget", timeoutBudgetTableInput{
+			remoteAddr:     "10.0.0.1:1234",
+			inbound:        "soon",
+			timeout:        10 * time.Second,
+			expectedBudget: 10 * time.Second,
+			expectDeadline: false,
+		}),
+		Entry("with an exhausted inbound budget", timeoutBudgetTableInput{
+			remoteAddr:     "10.0.0.1:1234",
+			inbound:        "0",
+			timeout:        10 * time.Second,
+			expectedBudget: 0,
+			expectDeadline: true,
+		}),
+	)
+
+	It("is not forwarded without a header", func() {
+		budget, err := newTimeoutBudget(&options.UpstreamTimeoutBudget{TrustedNetworks: []string{"10.0.0.0/8"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(budget).To(BeNil())
+	})
+
+	It("fails with an invalid trusted network", func() {
+		_, err := newTimeoutBudget(&options.UpstreamTimeoutBudget{Header: header, TrustedNetworks: []string{"gateway"}})
+		Expect(err).To(MatchError("could not parse timeout budget trusted network (gateway)"))
+	})
+})
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"net/http"
+	"strings"
+)
+
+// proxyCookieStripper removes the session and CSRF cookies of the proxy from
+// requests before they are proxied to an upstream server
+type proxyCookieStripper struct {
+	cookieName string
+	handler    http.Handler
+}
+
+// newProxyCookieStripper wraps the handler of an upstream server so that it
+// does not receive the cookies of the proxy
+func newProxyCookieStripper(cookieName string, handler http.Handler) http.Handler {
+	return &proxyCookieStripper{
+		cookieName: cookieName,
+		handler:    handler,
+	}
+}
+
+// ServeHTTP strips the proxy cookies from the request before passing it on
+func (s *proxyCookieStripper) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	stripProxyCookies(req, s.cookieName)
+	s.handler.ServeHTTP(rw, req)
+}
+
+// stripProxyCookies removes the cookies of the proxy from the Cookie headers
+// of the request, leaving the other cookies as they were sent
+func stripProxyCookies(req *http.Request, cookieName string) {
+	values := req.Header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	kept := []string{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ";") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(part, "=")
+			if !isProxyCookie(strings.TrimSpace(name), cookieName) {
+				kept = append(kept, part)
+			}
+		}
+	}
+
+	req.Header.Del("Cookie")
+	if len(kept) > 0 {
+		req.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+// isProxyCookie returns whether the cookie is the session cookie of the proxy,
+// one of the `_N` parts of a split session cookie, or a `_csrf` cookie
+func isProxyCookie(name, cookieName string) bool {
+	if name == cookieName {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(name, cookieName+"_")
+	if !ok {
+		return false
+	}
+	if suffix == "csrf" || strings.HasPrefix(suffix, "csrf_") {
+		return true
+	}
+	return suffix != "" && strings.Trim(suffix, "0123456789") == ""
+}
@@ -0,0 +1,52 @@
+package upstream
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy cookie stripping", func() {
+	type stripProxyCookiesTableInput struct {
+		cookies         []string
+		expectedCookies []string
+	}
+
+	DescribeTable("stripProxyCookies",
+		func(in stripProxyCookiesTableInput) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.localhost/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			for _, cookie := range in.cookies {
+				req.Header.Add("Cookie", cookie)
+			}
+
+			stripProxyCookies(req, "_oauth2_proxy")
+			Expect(req.Header.Values("Cookie")).To(Equal(in.expectedCookies))
+		},
+		Entry("with no cookies", stripProxyCookiesTableInput{
+			cookies:         nil,
+			expectedCookies: nil,
+		}),
+		Entry("with only application cookies", stripProxyCookiesTableInput{
+			cookies:         []string{"app=value; theme=dark"},
+			expectedCookies: []string{"app=value; theme=dark"},
+		}),
+		Entry("with the session cookie", stripProxyCookiesTableInput{
+			cookies:         []string{"app=value; _oauth2_proxy=session; theme=dark"},
+			expectedCookies: []string{"app=value; theme=dark"},
+		}),
+		Entry("with a split session cookie and CSRF cookies", stripProxyCookiesTableInput{
+			cookies:         []string{"_oauth2_proxy_0=part; _oauth2_proxy_1=part", "_oauth2_proxy_csrf=csrf; _oauth2_proxy_csrf_abc=csrf; app=value"},
+			expectedCookies: []string{"app=value"},
+		}),
+		Entry("with only proxy cookies", stripProxyCookiesTableInput{
+			cookies:         []string{"_oauth2_proxy=session"},
+			expectedCookies: nil,
+		}),
+		Entry("with application cookies sharing the prefix", stripProxyCookiesTableInput{
+			cookies:         []string{"_oauth2_proxy_app=value; _oauth2_proxy_=value"},
+			expectedCookies: []string{"_oauth2_proxy_app=value; _oauth2_proxy_=value"},
+		}),
+	)
+})
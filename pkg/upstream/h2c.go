@@ -0,0 +1,81 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"golang.org/x/net/http2"
+)
+
+// newH2CTransport creates the transport proxying requests to an HTTP or unix
+// socket upstream server over HTTP/2 cleartext (h2c), as needed by gRPC
+// services without TLS.
+// The timeout of the upstream bounds the wait for the response headers, like
+// the ResponseHeaderTimeout of HTTP/1.1 upstreams.
+func newH2CTransport(target *url.URL, timeout *options.Duration) http.RoundTripper {
+	var transport http.RoundTripper = &http2.Transport{
+		AllowHTTP: true,
+		// h2c connections are not encrypted, so the TLS dialer dials plain
+		// connections to the upstream server
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			dialer := net.Dialer{}
+			if target.Scheme == unixScheme {
+				return dialer.DialContext(ctx, target.Scheme, target.Path)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	if target.Scheme == unixScheme {
+		transport = &unixRoundTripper{Transport: transport}
+	}
+	if timeout != nil && timeout.Duration() > 0 {
+		transport = &headerTimeoutRoundTripper{transport: transport, timeout: timeout.Duration()}
+	}
+	return transport
+}
+
+// headerTimeoutRoundTripper cancels requests whose response headers are not
+// received before the timeout
+type headerTimeoutRoundTripper struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+func (t *headerTimeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+
+	res, err := t.transport.RoundTrip(req.WithContext(ctx))
+	timedOut := !timer.Stop()
+	if err != nil {
+		cancel()
+		if timedOut && req.Context().Err() == nil {
+			return nil, fmt.Errorf("timeout awaiting response headers: %w", err)
+		}
+		return nil, err
+	}
+
+	// The request stays open until the body of the response is closed
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelOnCloseBody cancels the context of the request once the body of its
+// response is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,101 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var _ = Describe("H2C Suite", func() {
+	var backend, frontend *httptest.Server
+	var client *http.Client
+
+	newH2CServer := func(handler http.Handler) *httptest.Server {
+		return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	}
+
+	BeforeEach(func() {
+		backend = newH2CServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/slow" {
+				time.Sleep(time.Second)
+			}
+			body, _ := io.ReadAll(req.Body)
+
+			rw.Header().Set("Trailer", "Grpc-Status")
+			rw.Header().Set("Content-Type", "application/grpc")
+			rw.Header().Set("X-Backend-Proto", req.Proto)
+			rw.Header().Set("X-Backend-User", req.Header.Get("X-Forwarded-User"))
+			rw.Write(body)
+			rw.Header().Set("Grpc-Status", "0")
+		}))
+
+		client = &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+	})
+
+	AfterEach(func() {
+		backend.Close()
+		if frontend != nil {
+			frontend.Close()
+		}
+	})
+
+	startProxy := func(upstream options.Upstream) {
+		u, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		upstream.ID = "grpc-backend"
+		upstream.URI = backend.URL
+		upstream.H2C = true
+
+		proxy, err := newHTTPUpstreamProxy(upstream, u, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		frontend = newH2CServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+			req.Header.Set("X-Forwarded-User", "alice")
+			proxy.ServeHTTP(rw, req)
+		}))
+	}
+
+	It("proxies requests over HTTP/2 cleartext with their trailers", func() {
+		startProxy(options.Upstream{})
+
+		res, err := client.Post(frontend.URL+"/helloworld.Greeter/SayHello", "application/grpc", strings.NewReader("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.ProtoMajor).To(Equal(2))
+		Expect(string(body)).To(Equal("hello"))
+		Expect(res.Header.Get("X-Backend-Proto")).To(Equal("HTTP/2.0"))
+		Expect(res.Header.Get("X-Backend-User")).To(Equal("alice"))
+		Expect(res.Trailer.Get("Grpc-Status")).To(Equal("0"))
+	})
+
+	It("times out waiting for the response headers", func() {
+		timeout := options.Duration(100 * time.Millisecond)
+		startProxy(options.Upstream{Timeout: &timeout})
+
+		res, err := client.Post(frontend.URL+"/slow", "application/grpc", strings.NewReader("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadGateway))
+	})
+})
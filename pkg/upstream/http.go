@@ -2,15 +2,16 @@ package upstream
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
 
 	"github.com/mbland/hmacauth"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
 )
 
 const (
@@ -41,20 +42,29 @@ var SignatureHeaders = []string{
 
 // newHTTPUpstreamProxy creates a new httpUpstreamProxy that can serve requests
 // to a single upstream host.
-func newHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *options.SignatureData, errorHandler ProxyErrorHandler) http.Handler {
+func newHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *options.SignatureData, errorHandler ProxyErrorHandler) (http.Handler, error) {
 	// Set path to empty so that request paths start at the server root
 	// Unix scheme need the path to find the socket
 	if u.Scheme != "unix" {
 		u.Path = ""
 	}
 
+	// Sign the requests of both proxies with the same secrets
+	signer, err := newRequestSigner(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request signer: %v", err)
+	}
+
 	// Create a ReverseProxy
-	proxy := newReverseProxy(u, upstream, errorHandler)
+	proxy, err := newReverseProxy(u, upstream, signer, errorHandler)
+	if err != nil {
+		return nil, err
+	}
 
 	// Set up a WebSocket proxy if required
 	var wsProxy http.Handler
 	if upstream.ProxyWebSockets == nil || *upstream.ProxyWebSockets {
-		wsProxy = newWebSocketReverseProxy(u, upstream.InsecureSkipTLSVerify)
+		wsProxy = newWebSocketReverseProxy(u, upstream.InsecureSkipTLSVerify, signer)
 	}
 
 	var auth hmacauth.HmacAuth
@@ -63,19 +73,21 @@ func newHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *option
 	}
 
 	return &httpUpstreamProxy{
-		upstream:  upstream.ID,
-		handler:   proxy,
-		wsHandler: wsProxy,
-		auth:      auth,
-	}
+		upstream:             upstream.ID,
+		handler:              proxy,
+		wsHandler:            wsProxy,
+		auth:                 auth,
+		accessTokenAudiences: upstream.AccessTokenAudiences,
+	}, nil
 }
 
 // httpUpstreamProxy represents a single HTTP(S) upstream proxy
 type httpUpstreamProxy struct {
-	upstream  string
-	handler   http.Handler
-	wsHandler http.Handler
-	auth      hmacauth.HmacAuth
+	upstream             string
+	handler              http.Handler
+	wsHandler            http.Handler
+	auth                 hmacauth.HmacAuth
+	accessTokenAudiences []string
 }
 
 // ServeHTTP proxies requests to the upstream provider while signing the
@@ -86,12 +98,14 @@ func (h *httpUpstreamProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 	// A scope should always be injected before this handler is called.
 	scope.Upstream = h.upstream
 
+	stripAccessToken(req, scope.Session, h.upstream, h.accessTokenAudiences)
+
 	// TODO (@NickMeves) - Deprecate GAP-Signature & remove GAP-Auth
 	if h.auth != nil {
 		req.Header.Set("GAP-Auth", rw.Header().Get("GAP-Auth"))
 		h.auth.SignRequest(req)
 	}
-	if h.wsHandler != nil && strings.EqualFold(req.Header.Get("Connection"), "upgrade") && req.Header.Get("Upgrade") == "websocket" {
+	if h.wsHandler != nil && isWebSocketRequest(req) {
 		h.wsHandler.ServeHTTP(rw, req)
 	} else {
 		h.handler.ServeHTTP(rw, req)
@@ -100,7 +114,7 @@ func (h *httpUpstreamProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request)
 
 // Unix implementation of http.RoundTripper, required to register unix protocol in reverse proxy
 type unixRoundTripper struct {
-	Transport *http.Transport
+	Transport http.RoundTripper
 }
 
 // Implementation of https://pkg.go.dev/net/http#RoundTripper interface to support http protocol over unix socket
@@ -121,25 +135,10 @@ func (t *unixRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 // servers based on the upstream configuration provided.
 // The proxy should render an error page if there are failures connecting to the
 // upstream server.
-func newReverseProxy(target *url.URL, upstream options.Upstream, errorHandler ProxyErrorHandler) http.Handler {
+// The requests are signed by the signer, when not nil.
+func newReverseProxy(target *url.URL, upstream options.Upstream, signer *requestSigner, errorHandler ProxyErrorHandler) (http.Handler, error) {
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
-	// Inherit default transport options from Go's stdlib
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-
-	if target.Scheme == "unix" {
-		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
-			dialer := net.Dialer{}
-			return dialer.DialContext(ctx, target.Scheme, target.Path)
-		}
-		transport.RegisterProtocol(target.Scheme, &unixRoundTripper{Transport: transport})
-	}
-
-	// Change default duration for waiting for an upstream response
-	if upstream.Timeout != nil {
-		transport.ResponseHeaderTimeout = upstream.Timeout.Duration()
-	}
-
 	// Configure options on the SingleHostReverseProxy
 	if upstream.FlushInterval != nil {
 		proxy.FlushInterval = upstream.FlushInterval.Duration()
@@ -147,12 +146,6 @@ func newReverseProxy(target *url.URL, upstream options.Upstream, errorHandler Pr
 		proxy.FlushInterval = options.DefaultUpstreamFlushInterval
 	}
 
-	// InsecureSkipVerify is a configurable option we allow
-	/* #nosec G402 */
-	if upstream.InsecureSkipTLSVerify {
-		transport.TLSClientConfig.InsecureSkipVerify = true
-	}
-
 	// Ensure we always pass the original request path
 	setProxyDirector(proxy)
 
@@ -160,6 +153,33 @@ func newReverseProxy(target *url.URL, upstream options.Upstream, errorHandler Pr
 		setProxyUpstreamHostHeader(proxy, target)
 	}
 
+	// Copy bodies with smaller, pooled buffers in low memory mode
+	proxy.BufferPool = memory.BufferPool()
+
+	// Remove the response headers that should not reach clients, and inject
+	// the configured response headers
+	filter, err := newResponseHeaderFilter(upstream)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case upstream.MaxResponseBodySize > 0:
+		// Responses declaring a body larger than the limit are failed before
+		// anything is written to the client
+		checkSize := checkResponseBodySize(upstream.MaxResponseBodySize)
+		proxy.ModifyResponse = func(res *http.Response) error {
+			if err := checkSize(res); err != nil {
+				return err
+			}
+			if filter != nil {
+				return filter.modifyResponse(res)
+			}
+			return nil
+		}
+	case filter != nil:
+		proxy.ModifyResponse = filter.modifyResponse
+	}
+
 	// Set the error handler so that upstream connection failures render the
 	// error page instead of sending a empty response
 	if errorHandler != nil {
@@ -167,9 +187,41 @@ func newReverseProxy(target *url.URL, upstream options.Upstream, errorHandler Pr
 	}
 
 	// Apply the customized transport to our proxy before returning it
-	proxy.Transport = transport
+	proxy.Transport = signer.transport(newUpstreamTransport(target, upstream))
+
+	return proxy, nil
+}
+
+// newUpstreamTransport creates the transport of the requests to the target
+// server, based on the upstream configuration provided.
+func newUpstreamTransport(target *url.URL, upstream options.Upstream) http.RoundTripper {
+	if upstream.H2C {
+		return newH2CTransport(target, upstream.Timeout)
+	}
+
+	// Inherit default transport options from Go's stdlib
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if target.Scheme == "unix" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, target.Scheme, target.Path)
+		}
+		transport.RegisterProtocol(target.Scheme, &unixRoundTripper{Transport: transport})
+	}
+
+	// Change default duration for waiting for an upstream response
+	if upstream.Timeout != nil {
+		transport.ResponseHeaderTimeout = upstream.Timeout.Duration()
+	}
+
+	// InsecureSkipVerify is a configurable option we allow
+	/* #nosec G402 */
+	if upstream.InsecureSkipTLSVerify {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
 
-	return proxy
+	return transport
 }
 
 // setProxyUpstreamHostHeader sets the proxy.Director so that upstream requests
@@ -196,7 +248,8 @@ func setProxyDirector(proxy *httputil.ReverseProxy) {
 }
 
 // newWebSocketReverseProxy creates a new reverse proxy for proxying websocket connections.
-func newWebSocketReverseProxy(u *url.URL, skipTLSVerify bool) http.Handler {
+// The handshakes are signed by the signer, when not nil.
+func newWebSocketReverseProxy(u *url.URL, skipTLSVerify bool, signer *requestSigner) http.Handler {
 	wsProxy := httputil.NewSingleHostReverseProxy(u)
 
 	// Inherit default transport options from Go's stdlib
@@ -208,7 +261,8 @@ func newWebSocketReverseProxy(u *url.URL, skipTLSVerify bool) http.Handler {
 	}
 
 	// Apply the customized transport to our proxy before returning it
-	wsProxy.Transport = transport
+	wsProxy.Transport = signer.transport(transport)
+	wsProxy.BufferPool = memory.BufferPool()
 
 	return wsProxy
 }
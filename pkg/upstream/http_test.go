@@ -74,7 +74,8 @@ var _ = Describe("HTTP Upstream Suite", func() {
 			u, err := url.Parse(*in.serverAddr)
 			Expect(err).ToNot(HaveOccurred())
 
-			handler := newHTTPUpstreamProxy(upstream, u, in.signatureData, in.errorHandler)
+			handler, err := newHTTPUpstreamProxy(upstream, u, in.signatureData, in.errorHandler)
+			Expect(err).ToNot(HaveOccurred())
 			handler.ServeHTTP(rw, req)
 
 			Expect(rw.Code).To(Equal(in.expectedResponse.code))
@@ -353,7 +354,8 @@ var _ = Describe("HTTP Upstream Suite", func() {
 		u, err := url.Parse(serverAddr)
 		Expect(err).ToNot(HaveOccurred())
 
-		handler := newHTTPUpstreamProxy(upstream, u, nil, nil)
+		handler, err := newHTTPUpstreamProxy(upstream, u, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
 		httpUpstream, ok := handler.(*httpUpstreamProxy)
 		Expect(ok).To(BeTrue())
 
@@ -393,7 +395,8 @@ var _ = Describe("HTTP Upstream Suite", func() {
 				Timeout:               &in.timeout,
 			}
 
-			handler := newHTTPUpstreamProxy(upstream, u, in.sigData, in.errorHandler)
+			handler, err := newHTTPUpstreamProxy(upstream, u, in.sigData, in.errorHandler)
+			Expect(err).ToNot(HaveOccurred())
 			upstreamProxy, ok := handler.(*httpUpstreamProxy)
 			Expect(ok).To(BeTrue())
 
@@ -483,7 +486,8 @@ var _ = Describe("HTTP Upstream Suite", func() {
 			u, err := url.Parse(serverAddr)
 			Expect(err).ToNot(HaveOccurred())
 
-			handler := newHTTPUpstreamProxy(upstream, u, nil, nil)
+			handler, err := newHTTPUpstreamProxy(upstream, u, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
 
 			proxyServer = httptest.NewServer(middleware.NewScope(false, "X-Request-Id")(handler))
 		})
@@ -0,0 +1,263 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The limits of an upstream server, as recorded in the limit metrics
+const (
+	limitRequestBody        = "request_body"
+	limitResponseBody       = "response_body"
+	limitClientReadTimeout  = "client_read_timeout"
+	limitClientWriteTimeout = "client_write_timeout"
+)
+
+// errResponseBodyTooLarge is returned when the response of an upstream
+// server is larger than its maximum response body size
+var errResponseBodyTooLarge = errors.New("upstream response body is too large")
+
+// upstreamLimits are the body size limits and client timeouts of an upstream
+// server
+type upstreamLimits struct {
+	upstream            string
+	maxRequestBodySize  int64
+	maxResponseBodySize int64
+	readTimeout         time.Duration
+	writeTimeout        time.Duration
+	writer              pagewriter.Writer
+	metrics             *limitMetrics
+}
+
+// newUpstreamLimits returns the limits of the upstream server, or nil if it
+// has none
+func newUpstreamLimits(upstream options.Upstream, writer pagewriter.Writer, metrics *limitMetrics) *upstreamLimits {
+	l := &upstreamLimits{
+		upstream:            upstream.ID,
+		maxRequestBodySize:  upstream.MaxRequestBodySize,
+		maxResponseBodySize: upstream.MaxResponseBodySize,
+		writer:              writer,
+		metrics:             metrics,
+	}
+	if upstream.ClientReadTimeout != nil {
+		l.readTimeout = upstream.ClientReadTimeout.Duration()
+	}
+	if upstream.ClientWriteTimeout != nil {
+		l.writeTimeout = upstream.ClientWriteTimeout.Duration()
+	}
+
+	if l.maxRequestBodySize <= 0 && l.maxResponseBodySize <= 0 && l.readTimeout <= 0 && l.writeTimeout <= 0 {
+		return nil
+	}
+	return l
+}
+
+// handler wraps the proxy to the upstream server with the limits.
+// Requests declaring a body larger than the limit are rejected before they
+// reach the upstream server, and the body and the time taken by the client
+// are bounded for the others.
+// WebSocket connections outlive the request, so are not limited.
+func (l *upstreamLimits) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if isWebSocketRequest(req) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		if l.maxRequestBodySize > 0 && req.ContentLength > l.maxRequestBodySize {
+			l.reject(rw, req, limitRequestBody, fmt.Errorf("request body of %d bytes is larger than the limit of %d bytes", req.ContentLength, l.maxRequestBodySize))
+			return
+		}
+
+		rc := http.NewResponseController(rw)
+		if l.writeTimeout > 0 {
+			if err := rc.SetWriteDeadline(time.Now().Add(l.writeTimeout)); err != nil {
+				logger.Errorf("Error setting the client write timeout of upstream %s: %v", l.upstream, err)
+			}
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			if l.maxRequestBodySize > 0 {
+				req.Body = http.MaxBytesReader(rw, req.Body, l.maxRequestBodySize)
+			}
+			// The read deadline also applies to the reads made by the server
+			// once the body has been read, so it is only set for requests
+			// with a body and cleared as soon as the body has been read
+			if l.readTimeout > 0 {
+				if err := rc.SetReadDeadline(time.Now().Add(l.readTimeout)); err != nil {
+					logger.Errorf("Error setting the client read timeout of upstream %s: %v", l.upstream, err)
+				} else {
+					body := &deadlineBody{ReadCloser: req.Body, clear: func() { _ = rc.SetReadDeadline(time.Time{}) }}
+					defer body.clearDeadline()
+					req.Body = body
+				}
+			}
+		}
+
+		if l.maxResponseBodySize > 0 || l.writeTimeout > 0 {
+			rw = &limitedResponseWriter{ResponseWriter: rw, limits: l, remaining: l.maxResponseBodySize}
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// errorHandler renders the error page for requests that exceeded the limits
+// of the upstream server, passing other errors on to the next error handler
+func (l *upstreamLimits) errorHandler(next ProxyErrorHandler) ProxyErrorHandler {
+	return func(rw http.ResponseWriter, req *http.Request, err error) {
+		// Error pages are not limited like the responses of the upstream
+		if lw, ok := rw.(*limitedResponseWriter); ok {
+			rw = lw.ResponseWriter
+		}
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errResponseBodyTooLarge):
+			l.reject(rw, req, limitResponseBody, err)
+		case errors.As(err, &maxBytesErr):
+			l.reject(rw, req, limitRequestBody, err)
+		case l.readTimeout > 0 && errors.Is(err, os.ErrDeadlineExceeded):
+			l.reject(rw, req, limitClientReadTimeout, err)
+		default:
+			next(rw, req, err)
+		}
+	}
+}
+
+// reject records the limit that was exceeded and renders its error page
+func (l *upstreamLimits) reject(rw http.ResponseWriter, req *http.Request, limit string, err error) {
+	l.metrics.rejected.WithLabelValues(l.upstream, limit).Inc()
+
+	scope := middleware.GetRequestScope(req)
+	opts := pagewriter.ErrorPageOpts{AppError: err.Error()}
+	if scope != nil {
+		scope.Upstream = l.upstream
+		opts.RequestID = scope.RequestID
+	}
+	switch limit {
+	case limitRequestBody:
+		opts.Status = http.StatusRequestEntityTooLarge
+		opts.Messages = []interface{}{"The request is too large."}
+	case limitClientReadTimeout:
+		opts.Status = http.StatusRequestTimeout
+		opts.Messages = []interface{}{"The request was not received in time."}
+	default:
+		opts.Status = http.StatusBadGateway
+		opts.Messages = []interface{}{"The response of the upstream server is too large."}
+	}
+	l.writer.WriteErrorPage(rw, opts)
+}
+
+// checkResponseBodySize fails responses that declare a body larger than the
+// limit, so that they are replaced with an error page before anything is
+// written to the client
+func checkResponseBodySize(maxResponseBodySize int64) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if res.ContentLength > maxResponseBodySize {
+			return fmt.Errorf("%w: %d bytes is larger than the limit of %d bytes", errResponseBodyTooLarge, res.ContentLength, maxResponseBodySize)
+		}
+		return nil
+	}
+}
+
+// deadlineBody clears the read deadline of the client connection once the
+// body of the request has been read
+type deadlineBody struct {
+	io.ReadCloser
+	clear func()
+	once  sync.Once
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.clearDeadline()
+	}
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	b.clearDeadline()
+	return b.ReadCloser.Close()
+}
+
+func (b *deadlineBody) clearDeadline() {
+	b.once.Do(b.clear)
+}
+
+// limitedResponseWriter cuts off responses once they reach the maximum
+// response body size, and records the responses cut off by the client write
+// timeout
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limits    *upstreamLimits
+	remaining int64
+	exceeded  bool
+	timedOut  bool
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	if w.exceeded {
+		return 0, errResponseBodyTooLarge
+	}
+
+	limited := w.limits.maxResponseBodySize > 0 && int64(len(b)) > w.remaining
+	if limited {
+		b = b[:w.remaining]
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.remaining -= int64(n)
+
+	if err != nil && !w.timedOut && w.limits.writeTimeout > 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+		w.timedOut = true
+		w.limits.metrics.rejected.WithLabelValues(w.limits.upstream, limitClientWriteTimeout).Inc()
+	}
+	if err == nil && limited {
+		w.exceeded = true
+		w.limits.metrics.rejected.WithLabelValues(w.limits.upstream, limitResponseBody).Inc()
+		err = errResponseBodyTooLarge
+	}
+	return n, err
+}
+
+// Unwrap allows the http.ResponseController to flush and hijack the
+// underlying ResponseWriter
+func (w *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// isWebSocketRequest returns whether the request upgrades the connection to
+// a WebSocket
+func isWebSocketRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Connection"), "upgrade") && req.Header.Get("Upgrade") == "websocket"
+}
+
+// limitMetrics are the prometheus metrics recorded by the upstream limits
+type limitMetrics struct {
+	rejected *prometheus.CounterVec
+}
+
+func newLimitMetrics(registerer prometheus.Registerer) *limitMetrics {
+	return &limitMetrics{
+		rejected: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_upstream_limit_rejected_total",
+				Help: "Total number of requests to an upstream rejected or cut off for exceeding one of its limits.",
+			},
+			[]string{"upstream", "limit"},
+		)).(*prometheus.CounterVec),
+	}
+}
@@ -0,0 +1,186 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Upstream Limits Suite", func() {
+	const upstreamID = "limited-backend"
+
+	var backend *httptest.Server
+	var backendRequests int
+	var metrics *limitMetrics
+
+	writer := &pagewriter.WriterFuncs{
+		ErrorPageFunc: func(rw http.ResponseWriter, opts pagewriter.ErrorPageOpts) {
+			rw.WriteHeader(opts.Status)
+			rw.Write([]byte("Error Page"))
+		},
+		ProxyErrorFunc: func(rw http.ResponseWriter, _ *http.Request, _ error) {
+			rw.WriteHeader(http.StatusBadGateway)
+			rw.Write([]byte("Proxy Error"))
+		},
+	}
+
+	BeforeEach(func() {
+		backendRequests = 0
+		backend = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			backendRequests++
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return
+			}
+			switch req.URL.Path {
+			case "/stream":
+				// Flushing before the body is complete sends it without a
+				// Content-Length
+				for i := 0; i < 4; i++ {
+					rw.Write([]byte("chunk"))
+					rw.(http.Flusher).Flush()
+				}
+			case "/large":
+				rw.Write([]byte(strings.Repeat("x", 64)))
+			default:
+				rw.Write(body)
+			}
+		}))
+		metrics = newLimitMetrics(prometheus.NewRegistry())
+	})
+
+	AfterEach(func() {
+		backend.Close()
+	})
+
+	newProxy := func(upstream options.Upstream) http.Handler {
+		upstream.ID = upstreamID
+		upstream.Path = "/"
+		upstream.URI = backend.URL
+
+		limits := newUpstreamLimits(upstream, writer, metrics)
+		Expect(limits).ToNot(BeNil())
+
+		u, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := newHTTPUpstreamProxy(upstream, u, nil, limits.errorHandler(writer.ProxyErrorHandler))
+		Expect(err).ToNot(HaveOccurred())
+		return limits.handler(proxy)
+	}
+
+	serve := func(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rejected := func(limit string) float64 {
+		return testutil.ToFloat64(metrics.rejected.WithLabelValues(upstreamID, limit))
+	}
+
+	It("returns no limits when none are set", func() {
+		zero := options.Duration(0)
+		Expect(newUpstreamLimits(options.Upstream{ID: upstreamID, ClientReadTimeout: &zero}, writer, metrics)).To(BeNil())
+	})
+
+	Context("with a maximum request body size", func() {
+		var proxy http.Handler
+
+		BeforeEach(func() {
+			proxy = newProxy(options.Upstream{MaxRequestBodySize: 8})
+		})
+
+		It("proxies requests within the limit", func() {
+			rw := serve(proxy, httptest.NewRequest("POST", "/", strings.NewReader("12345678")))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Body.String()).To(Equal("12345678"))
+			Expect(rejected(limitRequestBody)).To(Equal(0.0))
+		})
+
+		It("rejects requests declaring a larger body before proxying them", func() {
+			rw := serve(proxy, httptest.NewRequest("POST", "/", strings.NewReader("123456789")))
+			Expect(rw.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(rw.Body.String()).To(Equal("Error Page"))
+			Expect(backendRequests).To(Equal(0))
+			Expect(rejected(limitRequestBody)).To(Equal(1.0))
+		})
+
+		It("rejects requests streaming a larger body", func() {
+			req := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("12345"), strings.NewReader("6789")))
+			req.ContentLength = -1
+			rw := serve(proxy, req)
+			Expect(rw.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(rw.Body.String()).To(Equal("Error Page"))
+			Expect(rejected(limitRequestBody)).To(Equal(1.0))
+		})
+
+		It("rejects requests streaming a larger body to an upstream signing it", func() {
+			proxy = newProxy(options.Upstream{
+				MaxRequestBodySize: 8,
+				Signing: &options.UpstreamSigning{
+					HMAC: &options.UpstreamHMACSigning{Key: &options.SecretSource{Value: []byte("signing-key")}},
+				},
+			})
+
+			req := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("12345"), strings.NewReader("6789")))
+			req.ContentLength = -1
+			rw := serve(proxy, req)
+			Expect(rw.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(rw.Body.String()).To(Equal("Error Page"))
+			Expect(backendRequests).To(Equal(0))
+			Expect(rejected(limitRequestBody)).To(Equal(1.0))
+		})
+	})
+
+	Context("with a maximum response body size", func() {
+		var proxy http.Handler
+
+		BeforeEach(func() {
+			proxy = newProxy(options.Upstream{MaxResponseBodySize: 16})
+		})
+
+		It("proxies responses within the limit", func() {
+			rw := serve(proxy, httptest.NewRequest("POST", "/", strings.NewReader("small")))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Body.String()).To(Equal("small"))
+			Expect(rejected(limitResponseBody)).To(Equal(0.0))
+		})
+
+		It("replaces responses declaring a larger body with an error page", func() {
+			rw := serve(proxy, httptest.NewRequest("GET", "/large", nil))
+			Expect(rw.Code).To(Equal(http.StatusBadGateway))
+			Expect(rw.Body.String()).To(Equal("Error Page"))
+			Expect(rejected(limitResponseBody)).To(Equal(1.0))
+		})
+
+		It("cuts off streamed responses once they reach the limit", func() {
+			rw := serve(proxy, httptest.NewRequest("GET", "/stream", nil))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Body.String()).To(Equal("chunkchunkchunkc"))
+			Expect(rejected(limitResponseBody)).To(Equal(1.0))
+		})
+	})
+
+	It("does not reject requests with client timeouts", func() {
+		timeout := options.Duration(time.Minute)
+		proxy := newProxy(options.Upstream{ClientReadTimeout: &timeout, ClientWriteTimeout: &timeout})
+
+		rw := serve(proxy, httptest.NewRequest("POST", "/", strings.NewReader("body")))
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(Equal("body"))
+		Expect(rejected(limitClientReadTimeout)).To(Equal(0.0))
+		Expect(rejected(limitClientWriteTimeout)).To(Equal(0.0))
+	})
+})
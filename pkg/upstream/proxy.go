@@ -2,6 +2,7 @@ package upstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -14,6 +15,8 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/app/pagewriter"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/readiness"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // ProxyErrorHandler is a function that will be used to render error pages when
@@ -22,11 +25,28 @@ type ProxyErrorHandler func(http.ResponseWriter, *http.Request, error)
 
 // NewProxy creates a new multiUpstreamProxy that can serve requests directed to
 // multiple upstreams.
-func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData, writer pagewriter.Writer) (http.Handler, error) {
+// The cookies of the proxy, named after the cookieName, are removed from
+// requests to upstreams that do not opt out of it.
+// The access tokens of sessions are exchanged with the exchangeToken function
+// for upstreams with a token exchange.
+func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData, cookieName string, exchangeToken TokenExchanger, writer pagewriter.Writer) (http.Handler, error) {
 	m := &multiUpstreamProxy{
-		serveMux: mux.NewRouter(),
+		serveMux:        mux.NewRouter(),
+		breakerMetrics:  newBreakerMetrics(prometheus.DefaultRegisterer),
+		limitMetrics:    newLimitMetrics(prometheus.DefaultRegisterer),
+		balancerMetrics: newBalancerMetrics(prometheus.DefaultRegisterer),
+		cookieName:      cookieName,
+		exchangeToken:   exchangeToken,
+		exchangedTokens: newExchangedTokenCache(),
+		scopes:          map[*mux.Route][]string{},
 	}
 
+	timeoutBudget, err := newTimeoutBudget(upstreams.TimeoutBudget)
+	if err != nil {
+		return nil, err
+	}
+	m.timeoutBudget = timeoutBudget
+
 	if upstreams.ProxyRawPath {
 		m.serveMux.UseEncodedPath()
 	}
@@ -39,6 +59,14 @@ func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData,
 			continue
 		}
 
+		if len(upstream.Targets) > 0 {
+			upstream.ResponseHeaders = mergeResponseHeaders(upstreams.ResponseHeaders, upstream.ResponseHeaders)
+			if err := m.registerHTTPUpstreamProxy(upstream, nil, sigData, writer); err != nil {
+				return nil, fmt.Errorf("could not register load balanced upstream %q: %v", upstream.ID, err)
+			}
+			continue
+		}
+
 		u, err := url.Parse(upstream.URI)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing URI for upstream %q: %w", upstream.ID, err)
@@ -49,6 +77,7 @@ func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData,
 				return nil, fmt.Errorf("could not register file upstream %q: %v", upstream.ID, err)
 			}
 		case httpScheme, httpsScheme, unixScheme:
+			upstream.ResponseHeaders = mergeResponseHeaders(upstreams.ResponseHeaders, upstream.ResponseHeaders)
 			if err := m.registerHTTPUpstreamProxy(upstream, u, sigData, writer); err != nil {
 				return nil, fmt.Errorf("could not register %s upstream %q: %v", u.Scheme, upstream.ID, err)
 			}
@@ -64,7 +93,61 @@ func NewProxy(upstreams options.UpstreamConfig, sigData *options.SignatureData,
 // multiUpstreamProxy will serve requests directed to multiple upstream servers
 // registered in the serverMux.
 type multiUpstreamProxy struct {
-	serveMux *mux.Router
+	serveMux        *mux.Router
+	breakerMetrics  *breakerMetrics
+	limitMetrics    *limitMetrics
+	balancerMetrics *balancerMetrics
+	cookieName      string
+	timeoutBudget   *timeoutBudget
+	balancers       []*loadBalancer
+	exchangeToken   TokenExchanger
+	exchangedTokens *exchangedTokenCache
+	scopes          map[*mux.Route][]string
+}
+
+// ReadinessChecks returns a check of each load balanced upstream of a proxy
+// created by NewProxy, failing while none of the targets of the upstream are
+// healthy.
+func ReadinessChecks(proxy http.Handler) []readiness.Check {
+	m, ok := proxy.(*multiUpstreamProxy)
+	if !ok {
+		return nil
+	}
+	checks := make([]readiness.Check, 0, len(m.balancers))
+	for _, balancer := range m.balancers {
+		checks = append(checks, readiness.Check{
+			Name: fmt.Sprintf("upstream %q", balancer.upstream),
+			Run:  balancer.verifyTargets,
+		})
+	}
+	return checks
+}
+
+// StopHealthChecks stops the active health checks of the load balanced
+// upstreams of a proxy created by NewProxy, once the proxy is replaced.
+func StopHealthChecks(proxy http.Handler) {
+	m, ok := proxy.(*multiUpstreamProxy)
+	if !ok {
+		return
+	}
+	for _, balancer := range m.balancers {
+		balancer.stopHealthChecks()
+	}
+}
+
+// RequiredScopes returns the scopes the upstream that a proxy created by
+// NewProxy serves the request with requires the access token of the session
+// to be granted.
+func RequiredScopes(proxy http.Handler, req *http.Request) []string {
+	m, ok := proxy.(*multiUpstreamProxy)
+	if !ok || len(m.scopes) == 0 {
+		return nil
+	}
+	match := &mux.RouteMatch{}
+	if !m.serveMux.Match(req, match) {
+		return nil
+	}
+	return m.scopes[match.Route]
 }
 
 // ServerHTTP handles HTTP requests.
@@ -85,48 +168,98 @@ func (m *multiUpstreamProxy) registerFileServer(upstream options.Upstream, u *ur
 }
 
 // registerHTTPUpstreamProxy registers a new httpUpstreamProxy based on the configuration given.
+// Upstreams with targets are load balanced across them, and have no URL.
 func (m *multiUpstreamProxy) registerHTTPUpstreamProxy(upstream options.Upstream, u *url.URL, sigData *options.SignatureData, writer pagewriter.Writer) error {
-	logger.Printf("mapping path %q => upstream %q", upstream.Path, upstream.URI)
-	return m.registerHandler(upstream, newHTTPUpstreamProxy(upstream, u, sigData, writer.ProxyErrorHandler), writer)
+	errorHandler := writer.ProxyErrorHandler
+	limits := newUpstreamLimits(upstream, writer, m.limitMetrics)
+	if limits != nil {
+		errorHandler = limits.errorHandler(errorHandler)
+	}
+	var proxy http.Handler
+	if len(upstream.Targets) > 0 {
+		logger.Printf("mapping path %q => upstream targets %q", upstream.Path, targetURIs(upstream.Targets))
+		balancer, err := newLoadBalancer(upstream, sigData, errorHandler, writer, m.balancerMetrics)
+		if err != nil {
+			return err
+		}
+		m.balancers = append(m.balancers, balancer)
+		proxy = balancer
+	} else {
+		logger.Printf("mapping path %q => upstream %q", upstream.Path, upstream.URI)
+		var err error
+		proxy, err = newHTTPUpstreamProxy(upstream, u, sigData, errorHandler)
+		if err != nil {
+			return err
+		}
+	}
+	if limits != nil {
+		proxy = limits.handler(proxy)
+	}
+	handler, err := newCircuitBreakerProxy(upstream, proxy, sigData, writer, m.breakerMetrics)
+	if err != nil {
+		return err
+	}
+	if upstream.TokenExchange != nil {
+		if m.exchangeToken == nil {
+			return errors.New("no token exchanger to exchange access tokens with")
+		}
+		handler = newTokenExchangeHandler(upstream, m.exchangeToken, m.exchangedTokens, writer.ProxyErrorHandler, handler)
+	}
+	if m.cookieName != "" && (upstream.StripProxyCookies == nil || *upstream.StripProxyCookies) {
+		handler = newProxyCookieStripper(m.cookieName, handler)
+	}
+	if m.timeoutBudget != nil {
+		handler = newTimeoutBudgetHandler(m.timeoutBudget, upstream, handler)
+	}
+	return m.registerHandler(upstream, handler, writer)
 }
 
-// registerHandler ensures the given handler is regiestered with the serveMux.
+// registerHandler ensures the given handler is regiestered with the serveMux,
+// recording the scopes its route requires.
 func (m *multiUpstreamProxy) registerHandler(upstream options.Upstream, handler http.Handler, writer pagewriter.Writer) error {
+	var route *mux.Route
 	if upstream.RewriteTarget == "" {
-		m.registerSimpleHandler(upstream.Path, handler)
-		return nil
+		route = m.registerSimpleHandler(upstream.Path, handler)
+	} else {
+		var err error
+		route, err = m.registerRewriteHandler(upstream, handler, writer)
+		if err != nil {
+			return err
+		}
 	}
 
-	return m.registerRewriteHandler(upstream, handler, writer)
+	if len(upstream.Scopes) > 0 {
+		m.scopes[route] = upstream.Scopes
+	}
+	return nil
 }
 
 // registerSimpleHandler maintains the behaviour of the go standard serveMux
 // by ensuring any path with a trailing `/` matches all paths under that prefix.
-func (m *multiUpstreamProxy) registerSimpleHandler(path string, handler http.Handler) {
+func (m *multiUpstreamProxy) registerSimpleHandler(path string, handler http.Handler) *mux.Route {
 	if strings.HasSuffix(path, "/") {
-		m.serveMux.PathPrefix(path).Handler(handler)
-	} else {
-		m.serveMux.Path(path).Handler(handler)
+		return m.serveMux.PathPrefix(path).Handler(handler)
 	}
+	return m.serveMux.Path(path).Handler(handler)
 }
 
 // registerRewriteHandler ensures the handler is registered for all paths
 // which match the regex defined in the Path.
 // Requests to the handler will have the request path rewritten before the
 // request is made to the next handler.
-func (m *multiUpstreamProxy) registerRewriteHandler(upstream options.Upstream, handler http.Handler, writer pagewriter.Writer) error {
+func (m *multiUpstreamProxy) registerRewriteHandler(upstream options.Upstream, handler http.Handler, writer pagewriter.Writer) (*mux.Route, error) {
 	rewriteRegExp, err := regexp.Compile(upstream.Path)
 	if err != nil {
-		return fmt.Errorf("invalid path %q for upstream: %v", upstream.Path, err)
+		return nil, fmt.Errorf("invalid path %q for upstream: %v", upstream.Path, err)
 	}
 
 	rewrite := newRewritePath(rewriteRegExp, upstream.RewriteTarget, writer)
 	h := alice.New(rewrite).Then(handler)
-	m.serveMux.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+	route := m.serveMux.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
 		return rewriteRegExp.MatchString(req.URL.Path)
 	}).Handler(h)
 
-	return nil
+	return route, nil
 }
 
 // registerTrailingSlashHandler creates a new matcher that will check if the
@@ -105,7 +105,7 @@ var _ = Describe("Proxy Suite", func() {
 					}
 				}
 
-				upstreamServer, err := NewProxy(upstreams, sigData, writer)
+				upstreamServer, err := NewProxy(upstreams, sigData, "", nil, writer)
 				Expect(err).ToNot(HaveOccurred())
 
 				req := middlewareapi.AddRequestScope(
@@ -365,6 +365,28 @@ var _ = Describe("Proxy Suite", func() {
 		)
 	})
 
+	Context("RequiredScopes", func() {
+		DescribeTable("returns the scopes of the upstream of the request",
+			func(target string, expectedScopes []string) {
+				ok := http.StatusOK
+				upstreams := options.UpstreamConfig{
+					Upstreams: []options.Upstream{
+						{ID: "root", Path: "/", Static: true, StaticCode: &ok},
+						{ID: "calendar", Path: "/calendar/", Static: true, StaticCode: &ok, Scopes: []string{"calendar.read"}},
+						{ID: "drive", Path: "^/drive/(.*)", RewriteTarget: "/$1", URI: serverAddr, Scopes: []string{"drive.read", "drive.write"}},
+					},
+				}
+				proxy, err := NewProxy(upstreams, nil, "", nil, &pagewriter.WriterFuncs{})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(RequiredScopes(proxy, httptest.NewRequest(http.MethodGet, target, nil))).To(Equal(expectedScopes))
+			},
+			Entry("with an upstream without scopes", "/index.html", nil),
+			Entry("with an upstream with scopes", "/calendar/events", []string{"calendar.read"}),
+			Entry("with a rewrite upstream with scopes", "/drive/files", []string{"drive.read", "drive.write"}),
+		)
+	})
+
 	Context("sortByPathLongest", func() {
 		type sortByPathLongestTableInput struct {
 			input          []options.Upstream
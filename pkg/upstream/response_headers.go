@@ -0,0 +1,140 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/header"
+)
+
+// bodyHeaders describe the body of a response, and are passed back to clients
+// even when they are not allowed, so that the body can still be read
+var bodyHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding"}
+
+// headerPatterns matches header names case insensitively, either exactly or,
+// for patterns ending in `*`, by prefix
+type headerPatterns []string
+
+func newHeaderPatterns(names []string) headerPatterns {
+	patterns := make(headerPatterns, 0, len(names))
+	for _, name := range names {
+		patterns = append(patterns, http.CanonicalHeaderKey(name))
+	}
+	return patterns
+}
+
+// matches returns whether the canonical header name matches any pattern
+func (p headerPatterns) matches(name string) bool {
+	for _, pattern := range p {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseHeaderFilter removes the headers of upstream responses that should
+// not be passed back to clients, and injects the configured response headers
+type responseHeaderFilter struct {
+	allowed  headerPatterns
+	denied   headerPatterns
+	injected []string
+	injector header.Injector
+}
+
+// newResponseHeaderFilter returns the filter of the response headers of the
+// upstream server, or nil if all response headers are passed back as is
+func newResponseHeaderFilter(upstream options.Upstream) (*responseHeaderFilter, error) {
+	responseHeaders := upstream.ResponseHeaders
+	if responseHeaders == nil {
+		responseHeaders = &options.ResponseHeaders{}
+	}
+	if len(upstream.AllowedResponseHeaders) == 0 && len(upstream.DeniedResponseHeaders) == 0 &&
+		len(responseHeaders.Strip) == 0 && len(responseHeaders.Inject) == 0 {
+		return nil, nil
+	}
+
+	filter := &responseHeaderFilter{
+		denied: newHeaderPatterns(append(append([]string{}, upstream.DeniedResponseHeaders...), responseHeaders.Strip...)),
+	}
+	if len(upstream.AllowedResponseHeaders) > 0 {
+		filter.allowed = append(newHeaderPatterns(upstream.AllowedResponseHeaders), newHeaderPatterns(bodyHeaders)...)
+	}
+	if len(responseHeaders.Inject) > 0 {
+		injector, err := header.NewInjector(responseHeaders.Inject)
+		if err != nil {
+			return nil, fmt.Errorf("error building response header injector: %v", err)
+		}
+		filter.injector = injector
+		for _, h := range responseHeaders.Inject {
+			filter.injected = append(filter.injected, h.Name)
+		}
+	}
+	return filter, nil
+}
+
+// modifyResponse removes the denied headers, and the headers that are not
+// allowed, from the response, then replaces the injected headers.
+// It is set as the ModifyResponse func of the reverse proxy.
+func (f *responseHeaderFilter) modifyResponse(res *http.Response) error {
+	for name := range res.Header {
+		if (f.allowed != nil && !f.allowed.matches(name)) || f.denied.matches(name) {
+			delete(res.Header, name)
+		}
+	}
+
+	if f.injector != nil {
+		for _, name := range f.injected {
+			res.Header.Del(name)
+		}
+		var session *sessionsapi.SessionState
+		if res.Request != nil {
+			if scope := middleware.GetRequestScope(res.Request); scope != nil {
+				session = scope.Session
+			}
+		}
+		f.injector.Inject(res.Header, res.Request, session)
+	}
+	return nil
+}
+
+// mergeResponseHeaders merges the response headers of an upstream server into
+// the response headers of all upstream servers. The injected headers of the
+// upstream server replace those of the same name.
+func mergeResponseHeaders(all, upstream *options.ResponseHeaders) *options.ResponseHeaders {
+	if all == nil {
+		return upstream
+	}
+	if upstream == nil {
+		return all
+	}
+
+	merged := &options.ResponseHeaders{
+		Strip: append(append([]string{}, all.Strip...), upstream.Strip...),
+	}
+	for _, h := range all.Inject {
+		if !containsHeader(upstream.Inject, h.Name) {
+			merged.Inject = append(merged.Inject, h)
+		}
+	}
+	merged.Inject = append(merged.Inject, upstream.Inject...)
+	return merged
+}
+
+// containsHeader returns whether a header of the name is in the headers
+func containsHeader(headers []options.Header, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response header filtering", func() {
+	responseHeaders := func() http.Header {
+		return http.Header{
+			"Content-Type":      []string{"text/plain"},
+			"Content-Length":    []string{"5"},
+			"Cache-Control":     []string{"no-store"},
+			"Server":            []string{"app/1.0"},
+			"X-Debug-Trace":     []string{"trace"},
+			"X-Debug-Timings":   []string{"timings"},
+			"X-Application-Key": []string{"key"},
+		}
+	}
+
+	type responseHeaderFilterTableInput struct {
+		allowed         []string
+		denied          []string
+		responseHeaders *options.ResponseHeaders
+		expectedHeaders []string
+	}
+
+	DescribeTable("modifyResponse",
+		func(in responseHeaderFilterTableInput) {
+			filter, err := newResponseHeaderFilter(options.Upstream{
+				AllowedResponseHeaders: in.allowed,
+				DeniedResponseHeaders:  in.denied,
+				ResponseHeaders:        in.responseHeaders,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(filter).ToNot(BeNil())
+
+			res := &http.Response{Header: responseHeaders()}
+			Expect(filter.modifyResponse(res)).To(Succeed())
+
+			headers := []string{}
+			for name := range res.Header {
+				headers = append(headers, name)
+			}
+			Expect(headers).To(ConsistOf(in.expectedHeaders))
+		},
+		Entry("with denied headers", responseHeaderFilterTableInput{
+			denied:          []string{"server", "X-Debug-*"},
+			expectedHeaders: []string{"Content-Type", "Content-Length", "Cache-Control", "X-Application-Key"},
+		}),
+		Entry("with allowed headers", responseHeaderFilterTableInput{
+			allowed:         []string{"cache-control", "X-Debug-*"},
+			expectedHeaders: []string{"Content-Type", "Content-Length", "Cache-Control", "X-Debug-Trace", "X-Debug-Timings"},
+		}),
+		Entry("with denied headers that are allowed", responseHeaderFilterTableInput{
+			allowed:         []string{"X-*"},
+			denied:          []string{"X-Debug-Trace"},
+			expectedHeaders: []string{"Content-Type", "Content-Length", "X-Debug-Timings", "X-Application-Key"},
+		}),
+		Entry("with the body headers denied", responseHeaderFilterTableInput{
+			denied:          []string{"Content-Type"},
+			expectedHeaders: []string{"Content-Length", "Cache-Control", "Server", "X-Debug-Trace", "X-Debug-Timings", "X-Application-Key"},
+		}),
+		Entry("with stripped headers", responseHeaderFilterTableInput{
+			denied:          []string{"Server"},
+			responseHeaders: &options.ResponseHeaders{Strip: []string{"X-Debug-*"}},
+			expectedHeaders: []string{"Content-Type", "Content-Length", "Cache-Control", "X-Application-Key"},
+		}),
+		Entry("with injected headers that are not allowed", responseHeaderFilterTableInput{
+			allowed: []string{"Cache-Control"},
+			responseHeaders: &options.ResponseHeaders{
+				Inject: []options.Header{{Name: "X-Frame-Options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("DENY")}}}}},
+			},
+			expectedHeaders: []string{"Content-Type", "Content-Length", "Cache-Control", "X-Frame-Options"},
+		}),
+	)
+
+	It("does not filter without allowed, denied or response headers", func() {
+		filter, err := newResponseHeaderFilter(options.Upstream{ResponseHeaders: &options.ResponseHeaders{}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filter).To(BeNil())
+	})
+
+	It("replaces the injected headers of the response", func() {
+		filter, err := newResponseHeaderFilter(options.Upstream{
+			ResponseHeaders: &options.ResponseHeaders{
+				Strip: []string{"Strict-Transport-Security"},
+				Inject: []options.Header{
+					{Name: "Strict-Transport-Security", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("max-age=31536000")}}}},
+					{Name: "Cache-Control", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("private")}}}},
+					{Name: "X-Echo-User", Values: []options.HeaderValue{{ClaimSource: &options.ClaimSource{Claim: "user"}}}},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = middleware.AddRequestScope(req, &middleware.RequestScope{Session: &sessionsapi.SessionState{User: "alice"}})
+		res := &http.Response{Header: responseHeaders(), Request: req}
+		res.Header.Set("Strict-Transport-Security", "max-age=0")
+		Expect(filter.modifyResponse(res)).To(Succeed())
+
+		Expect(res.Header.Values("Strict-Transport-Security")).To(ConsistOf("max-age=31536000"))
+		Expect(res.Header.Values("Cache-Control")).To(ConsistOf("private"))
+		Expect(res.Header.Values("X-Echo-User")).To(ConsistOf("alice"))
+		Expect(res.Header.Get("Server")).To(Equal("app/1.0"))
+	})
+
+	It("does not inject headers from a missing session", func() {
+		filter, err := newResponseHeaderFilter(options.Upstream{
+			ResponseHeaders: &options.ResponseHeaders{
+				Inject: []options.Header{{Name: "X-Echo-User", Values: []options.HeaderValue{{ClaimSource: &options.ClaimSource{Claim: "user"}}}}},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		res := &http.Response{Header: http.Header{}, Request: httptest.NewRequest(http.MethodGet, "/", nil)}
+		Expect(filter.modifyResponse(res)).To(Succeed())
+		Expect(res.Header).To(BeEmpty())
+	})
+
+	DescribeTable("mergeResponseHeaders",
+		func(all, upstream, expected *options.ResponseHeaders) {
+			Expect(mergeResponseHeaders(all, upstream)).To(Equal(expected))
+		},
+		Entry("without response headers", nil, nil, nil),
+		Entry("with only the response headers of all upstreams",
+			&options.ResponseHeaders{Strip: []string{"Server"}}, nil,
+			&options.ResponseHeaders{Strip: []string{"Server"}},
+		),
+		Entry("with only the response headers of the upstream",
+			nil, &options.ResponseHeaders{Strip: []string{"Server"}},
+			&options.ResponseHeaders{Strip: []string{"Server"}},
+		),
+		Entry("with both",
+			&options.ResponseHeaders{
+				Strip: []string{"Server"},
+				Inject: []options.Header{
+					{Name: "X-Frame-Options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("DENY")}}}},
+					{Name: "Strict-Transport-Security", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("max-age=31536000")}}}},
+				},
+			},
+			&options.ResponseHeaders{
+				Strip: []string{"X-Powered-By"},
+				Inject: []options.Header{
+					{Name: "x-frame-options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("SAMEORIGIN")}}}},
+				},
+			},
+			&options.ResponseHeaders{
+				Strip: []string{"Server", "X-Powered-By"},
+				Inject: []options.Header{
+					{Name: "Strict-Transport-Security", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("max-age=31536000")}}}},
+					{Name: "x-frame-options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("SAMEORIGIN")}}}},
+				},
+			},
+		),
+	)
+
+	It("filters the responses of the upstream server", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			for name, values := range responseHeaders() {
+				if name != "Content-Length" {
+					rw.Header()[name] = values
+				}
+			}
+			rw.Write([]byte("hello"))
+		}))
+		defer server.Close()
+
+		u, err := url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := newReverseProxy(u, options.Upstream{
+			ID:                    "app",
+			DeniedResponseHeaders: []string{"Server", "X-Debug-*"},
+		}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(Equal("hello"))
+		Expect(rw.Header().Get("Cache-Control")).To(Equal("no-store"))
+		Expect(rw.Header().Get("X-Application-Key")).To(Equal("key"))
+		Expect(rw.Header().Values("Server")).To(BeEmpty())
+		Expect(rw.Header().Values("X-Debug-Trace")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,162 @@
+package upstream
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sigv4"
+)
+
+// requestSigner signs the requests proxied to an upstream server, once they
+// are ready to be sent
+type requestSigner struct {
+	clock clock.Clock
+
+	// payloadSigned is whether the hash of the body is signed, which
+	// requires reading the body into memory
+	payloadSigned bool
+
+	// sign signs the request with the hex encoded SHA-256 hash of its body,
+	// or sigv4.UnsignedPayload
+	sign func(req *http.Request, payloadHash string, now time.Time)
+}
+
+// newRequestSigner creates the signer of the requests proxied to the
+// upstream server, loading its secrets. It returns nil when the requests
+// are not signed.
+func newRequestSigner(upstream options.Upstream) (*requestSigner, error) {
+	signing := upstream.Signing
+	switch {
+	case signing == nil:
+		return nil, nil
+	case signing.AWSSigV4 != nil:
+		return newAWSSigV4Signer(*signing.AWSSigV4)
+	case signing.HMAC != nil:
+		return newHMACSigner(*signing.HMAC)
+	default:
+		return nil, fmt.Errorf("no signing method configured for upstream %q", upstream.ID)
+	}
+}
+
+// newAWSSigV4Signer creates a signer of AWS Signature Version 4, with the
+// credentials of the config or of the environment
+func newAWSSigV4Signer(config options.UpstreamAWSSigV4Signing) (*requestSigner, error) {
+	var creds sigv4.Credentials
+	if config.AccessKeyID == nil && config.SecretAccessKey == nil {
+		var err error
+		creds, err = sigv4.CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, secret := range []struct {
+			name   string
+			source *options.SecretSource
+			value  *string
+		}{
+			{"accessKeyID", config.AccessKeyID, &creds.AccessKeyID},
+			{"secretAccessKey", config.SecretAccessKey, &creds.SecretAccessKey},
+			{"sessionToken", config.SessionToken, &creds.SessionToken},
+		} {
+			if secret.source == nil {
+				continue
+			}
+			value, err := util.GetSecretValue(secret.source)
+			if err != nil {
+				return nil, fmt.Errorf("error loading %s: %v", secret.name, err)
+			}
+			*secret.value = strings.TrimSpace(string(value))
+		}
+	}
+
+	return &requestSigner{
+		payloadSigned: !config.UnsignedPayload,
+		sign: func(req *http.Request, payloadHash string, now time.Time) {
+			sigv4.SignProxied(req, payloadHash, creds, config.Region, config.Service, now)
+		},
+	}, nil
+}
+
+// newHMACSigner creates a signer of HMAC-SHA256 signatures of the
+// timestamp, method, request URI, host and body hash of the requests
+func newHMACSigner(config options.UpstreamHMACSigning) (*requestSigner, error) {
+	key, err := util.GetSecretValue(config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading key: %v", err)
+	}
+	header := config.Header
+	if header == "" {
+		header = options.DefaultUpstreamHMACSigningHeader
+	}
+
+	return &requestSigner{
+		payloadSigned: true,
+		sign: func(req *http.Request, payloadHash string, now time.Time) {
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(strings.Join([]string{timestamp, req.Method, req.URL.RequestURI(), host, payloadHash}, "\n")))
+			req.Header.Set(header, "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+		},
+	}, nil
+}
+
+// transport wraps the transport of the requests to the upstream server so
+// that they are signed. It returns the transport as is without a signer.
+func (s *requestSigner) transport(transport http.RoundTripper) http.RoundTripper {
+	if s == nil {
+		return transport
+	}
+	return &signingTransport{signer: s, transport: transport}
+}
+
+// signingTransport signs the requests sent by the transport
+type signingTransport struct {
+	signer    *requestSigner
+	transport http.RoundTripper
+}
+
+// RoundTrip signs a copy of the request, reading its body to hash it when
+// the payload is signed, before sending it
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+
+	payloadHash := sigv4.UnsignedPayload
+	if t.signer.payloadSigned {
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error reading the request body to sign it: %w", err)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+		hash := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(hash[:])
+	}
+
+	t.signer.sign(req, payloadHash, t.signer.clock.Now())
+	return t.transport.RoundTrip(req)
+}
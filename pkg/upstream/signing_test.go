@@ -0,0 +1,178 @@
+package upstream
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sigv4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Upstream request signing", func() {
+	const body = `{"query":"hello"}`
+
+	var backend *httptest.Server
+	var received *http.Request
+	var receivedBody string
+
+	BeforeEach(func() {
+		backend = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			data, err := io.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			received = req
+			receivedBody = string(data)
+		}))
+	})
+
+	AfterEach(func() {
+		backend.Close()
+	})
+
+	// proxyRequest proxies a POST request through an upstream with the
+	// signing to the backend
+	proxyRequest := func(upstream options.Upstream) {
+		u, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		upstream.ID = "signed"
+		upstream.URI = backend.URL
+
+		proxy, err := newHTTPUpstreamProxy(upstream, u, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, "/search?q=a%20b", strings.NewReader(body))
+		req.Host = "app.example.com"
+		req.Header.Set("Content-Type", "application/json")
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{})
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(receivedBody).To(Equal(body))
+	}
+
+	bodyHash := func() string {
+		hash := sha256.Sum256([]byte(body))
+		return hex.EncodeToString(hash[:])
+	}
+
+	Context("with AWS Signature Version 4", func() {
+		creds := sigv4.Credentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}
+
+		// expectedAuthorization signs the request received by the backend
+		// again, as the AWS service would to check it
+		expectedAuthorization := func(service string) string {
+			date, err := time.Parse("20060102T150405Z", received.Header.Get("X-Amz-Date"))
+			Expect(err).ToNot(HaveOccurred())
+
+			req, err := http.NewRequest(received.Method, "http://"+received.Host+received.RequestURI, nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", received.Header.Get("Content-Type"))
+			sigv4.SignProxied(req, received.Header.Get("X-Amz-Content-Sha256"), creds, "us-east-1", service, date)
+			return req.Header.Get("Authorization")
+		}
+
+		It("signs the requests with the host they are sent to and the hash of their body", func() {
+			passHostHeader := false
+			proxyRequest(options.Upstream{
+				PassHostHeader: &passHostHeader,
+				Signing: &options.UpstreamSigning{
+					AWSSigV4: &options.UpstreamAWSSigV4Signing{
+						Region:          "us-east-1",
+						Service:         "execute-api",
+						AccessKeyID:     &options.SecretSource{Value: []byte(creds.AccessKeyID)},
+						SecretAccessKey: &options.SecretSource{Value: []byte(creds.SecretAccessKey)},
+					},
+				},
+			})
+
+			Expect(received.Host).To(Equal(strings.TrimPrefix(backend.URL, "http://")))
+			Expect(received.Header.Get("X-Amz-Content-Sha256")).To(Equal(bodyHash()))
+			Expect(received.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"))
+			Expect(received.Header.Get("Authorization")).To(ContainSubstring("SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date,"))
+			Expect(received.Header.Get("Authorization")).To(Equal(expectedAuthorization("execute-api")))
+		})
+
+		It("reads the credentials from the environment and leaves the payload unsigned", func() {
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", creds.AccessKeyID)
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", creds.SecretAccessKey)
+			GinkgoT().Setenv("AWS_SESSION_TOKEN", "")
+
+			proxyRequest(options.Upstream{
+				Signing: &options.UpstreamSigning{
+					AWSSigV4: &options.UpstreamAWSSigV4Signing{
+						Region:          "us-east-1",
+						Service:         "s3",
+						UnsignedPayload: true,
+					},
+				},
+			})
+
+			Expect(received.Host).To(Equal("app.example.com"))
+			Expect(received.Header.Get("X-Amz-Content-Sha256")).To(Equal(sigv4.UnsignedPayload))
+			Expect(received.Header.Get("Authorization")).To(Equal(expectedAuthorization("s3")))
+		})
+
+		It("fails without credentials", func() {
+			GinkgoT().Setenv("AWS_ACCESS_KEY_ID", "")
+			GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+			u, err := url.Parse(backend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = newHTTPUpstreamProxy(options.Upstream{
+				ID:  "signed",
+				URI: backend.URL,
+				Signing: &options.UpstreamSigning{
+					AWSSigV4: &options.UpstreamAWSSigV4Signing{Region: "us-east-1", Service: "s3"},
+				},
+			}, u, nil, nil)
+			Expect(err).To(MatchError(ContainSubstring("could not create request signer: aws credentials are not set")))
+		})
+	})
+
+	Context("with HMAC", func() {
+		It("signs the timestamp, method, request URI, host and body hash of the requests", func() {
+			proxyRequest(options.Upstream{
+				Signing: &options.UpstreamSigning{
+					HMAC: &options.UpstreamHMACSigning{
+						Key:    &options.SecretSource{Value: []byte("signing-key")},
+						Header: "X-App-Signature",
+					},
+				},
+			})
+
+			timestamp, signature, ok := strings.Cut(received.Header.Get("X-App-Signature"), ",v1=")
+			Expect(ok).To(BeTrue())
+			Expect(timestamp).To(HavePrefix("t="))
+			timestamp = strings.TrimPrefix(timestamp, "t=")
+
+			mac := hmac.New(sha256.New, []byte("signing-key"))
+			mac.Write([]byte(timestamp + "\nPOST\n/search?q=a%20b\napp.example.com\n" + bodyHash()))
+			Expect(signature).To(Equal(hex.EncodeToString(mac.Sum(nil))))
+		})
+
+		It("sends the signature in the default header", func() {
+			proxyRequest(options.Upstream{
+				Signing: &options.UpstreamSigning{
+					HMAC: &options.UpstreamHMACSigning{
+						Key: &options.SecretSource{Value: []byte("signing-key")},
+					},
+				},
+			})
+
+			Expect(received.Header.Get(options.DefaultUpstreamHMACSigningHeader)).To(MatchRegexp(`^t=\d+,v1=[0-9a-f]{64}$`))
+		})
+	})
+})
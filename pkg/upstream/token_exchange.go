@@ -0,0 +1,155 @@
+package upstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// exchangedTokenLifetime is how long exchanged tokens without an expiry
+	// are cached
+	exchangedTokenLifetime = 5 * time.Minute
+
+	// exchangedTokenExpiryDelta is how long before they expire exchanged
+	// tokens are exchanged again, so that they do not expire in flight
+	exchangedTokenExpiryDelta = 10 * time.Second
+)
+
+// TokenExchanger exchanges the access token of the session for an access
+// token issued for the audience and scopes
+type TokenExchanger func(ctx context.Context, session *sessionsapi.SessionState, audience string, scopes []string) (*oauth2.Token, error)
+
+// exchangedToken is a cached exchanged access token
+type exchangedToken struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+// exchangedTokenCache caches the exchanged access tokens by the access token
+// of the session, the audience and the scopes they were exchanged for
+type exchangedTokenCache struct {
+	clock  clock.Clock
+	mutex  sync.Mutex
+	tokens map[string]exchangedToken
+}
+
+// newExchangedTokenCache creates an empty cache
+func newExchangedTokenCache() *exchangedTokenCache {
+	return &exchangedTokenCache{tokens: map[string]exchangedToken{}}
+}
+
+// exchangedTokenKey hashes the access token of the session, so that the
+// cache does not hold it
+func exchangedTokenKey(accessToken, audience string, scopes []string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(hash[:]) + "|" + audience + "|" + strings.Join(scopes, " ")
+}
+
+// get returns the cached access token of the key, if it has not expired
+func (c *exchangedTokenCache) get(key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok || !c.clock.Now().Before(token.expiresAt) {
+		return "", false
+	}
+	return token.accessToken, true
+}
+
+// set caches the access token of the key until shortly before it expires,
+// removing the expired tokens of other sessions
+func (c *exchangedTokenCache) set(key string, token *oauth2.Token) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	for k, t := range c.tokens {
+		if !now.Before(t.expiresAt) {
+			delete(c.tokens, k)
+		}
+	}
+
+	expiresAt := now.Add(exchangedTokenLifetime)
+	if !token.Expiry.IsZero() {
+		expiresAt = token.Expiry.Add(-exchangedTokenExpiryDelta)
+	}
+	c.tokens[key] = exchangedToken{accessToken: token.AccessToken, expiresAt: expiresAt}
+}
+
+// tokenExchangeHandler replaces the access token of the session with an
+// access token exchanged for the audience of the upstream server
+type tokenExchangeHandler struct {
+	upstream     string
+	config       options.UpstreamTokenExchange
+	exchange     TokenExchanger
+	cache        *exchangedTokenCache
+	errorHandler ProxyErrorHandler
+	handler      http.Handler
+}
+
+// newTokenExchangeHandler wraps the handler of an upstream server so that it
+// receives the access tokens exchanged for its audience
+func newTokenExchangeHandler(upstream options.Upstream, exchange TokenExchanger, cache *exchangedTokenCache, errorHandler ProxyErrorHandler, handler http.Handler) http.Handler {
+	return &tokenExchangeHandler{
+		upstream:     upstream.ID,
+		config:       *upstream.TokenExchange,
+		exchange:     exchange,
+		cache:        cache,
+		errorHandler: errorHandler,
+		handler:      handler,
+	}
+}
+
+// ServeHTTP exchanges the access token of the session, or takes it from the
+// cache, before passing the request on. Requests without a session, such as
+// those of skip auth routes, are passed on as they are.
+func (h *tokenExchangeHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	scope := middleware.GetRequestScope(req)
+	if scope == nil || scope.Session == nil || scope.Session.AccessToken == "" {
+		h.handler.ServeHTTP(rw, req)
+		return
+	}
+	session := scope.Session
+
+	key := exchangedTokenKey(session.AccessToken, h.config.Audience, h.config.Scopes)
+	accessToken, ok := h.cache.get(key)
+	if !ok {
+		token, err := h.exchange(req.Context(), session, h.config.Audience, h.config.Scopes)
+		if err != nil {
+			logger.Errorf("Error exchanging the access token for upstream %q: %v", h.upstream, err)
+			h.errorHandler(rw, req, err)
+			return
+		}
+		h.cache.set(key, token)
+		accessToken = token.AccessToken
+	}
+
+	replaceAccessToken(req, session.AccessToken, accessToken)
+	h.handler.ServeHTTP(rw, req)
+}
+
+// replaceAccessToken replaces the access token of the session in the headers
+// of the request with the exchanged access token, which is also set as the
+// bearer token of the Authorization header
+func replaceAccessToken(req *http.Request, sessionToken, exchangedToken string) {
+	for name, values := range req.Header {
+		for i, value := range values {
+			values[i] = strings.ReplaceAll(value, sessionToken, exchangedToken)
+		}
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+exchangedToken)
+}
@@ -0,0 +1,116 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	middlewareapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("Token exchange", func() {
+	var cache *exchangedTokenCache
+	var exchanges int
+	var exchangeErr error
+	var expiresIn time.Duration
+	var handler http.Handler
+	var upstreamHeaders http.Header
+
+	BeforeEach(func() {
+		cache = newExchangedTokenCache()
+		cache.clock.Set(time.Now())
+		exchanges = 0
+		exchangeErr = nil
+		expiresIn = time.Hour
+
+		exchange := func(_ context.Context, session *sessionsapi.SessionState, audience string, scopes []string) (*oauth2.Token, error) {
+			exchanges++
+			if exchangeErr != nil {
+				return nil, exchangeErr
+			}
+			token := &oauth2.Token{AccessToken: session.AccessToken + "@" + audience}
+			if expiresIn > 0 {
+				token.Expiry = cache.clock.Now().Add(expiresIn)
+			}
+			return token, nil
+		}
+		upstream := options.Upstream{
+			ID:            "api",
+			TokenExchange: &options.UpstreamTokenExchange{Audience: "api://upstream"},
+		}
+		errorHandler := func(rw http.ResponseWriter, _ *http.Request, _ error) {
+			rw.WriteHeader(http.StatusBadGateway)
+		}
+		handler = newTokenExchangeHandler(upstream, exchange, cache, errorHandler, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			upstreamHeaders = req.Header
+		}))
+		upstreamHeaders = nil
+	})
+
+	request := func(session *sessionsapi.SessionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.localhost/", nil)
+		req = middlewareapi.AddRequestScope(req, &middlewareapi.RequestScope{Session: session})
+		if session != nil {
+			req.Header.Set("X-Forwarded-Access-Token", session.AccessToken)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	It("replaces the access token of the session with the exchanged token", func() {
+		rw := request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(upstreamHeaders).To(Equal(http.Header{
+			"X-Forwarded-Access-Token": []string{"subject@api://upstream"},
+			"Authorization":            []string{"Bearer subject@api://upstream"},
+		}))
+	})
+
+	It("caches the exchanged tokens per session until they expire", func() {
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(exchanges).To(Equal(1))
+
+		request(&sessionsapi.SessionState{AccessToken: "other"})
+		Expect(exchanges).To(Equal(2))
+		Expect(upstreamHeaders.Get("Authorization")).To(Equal("Bearer other@api://upstream"))
+
+		Expect(cache.clock.Add(time.Hour - exchangedTokenExpiryDelta)).To(Succeed())
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(exchanges).To(Equal(3))
+		Expect(cache.tokens).To(HaveLen(1))
+	})
+
+	It("caches the exchanged tokens without an expiry for a while", func() {
+		expiresIn = 0
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(exchanges).To(Equal(1))
+
+		Expect(cache.clock.Add(exchangedTokenLifetime)).To(Succeed())
+		request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(exchanges).To(Equal(2))
+	})
+
+	It("renders the error page when the exchange fails", func() {
+		exchangeErr = errors.New("invalid_target")
+		rw := request(&sessionsapi.SessionState{AccessToken: "subject"})
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+		Expect(upstreamHeaders).To(BeNil())
+	})
+
+	It("passes on the requests without a session", func() {
+		rw := request(nil)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(exchanges).To(Equal(0))
+		Expect(upstreamHeaders).To(BeEmpty())
+	})
+})
@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/acme"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateACME checks that certificates can be obtained with ACME for the
+// hosts of the proxy, and stored
+func validateACME(o *options.Options) []string {
+	if !o.ACME.Enabled {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if !o.ACME.AcceptTOS {
+		msgs = append(msgs, "acme requires acme_accept_tos to accept the terms of service of the certificate authority")
+	}
+	if !isAbsoluteHTTPURL(o.ACME.DirectoryURL) {
+		msgs = append(msgs, fmt.Sprintf("acme_directory_url %q must be an absolute http or https URL", o.ACME.DirectoryURL))
+	}
+	if o.ACME.RenewBefore <= 0 {
+		msgs = append(msgs, "acme_renew_before must be positive")
+	}
+
+	if len(acme.Hosts(o)) == 0 {
+		msgs = append(msgs, "acme requires acme_hosts, or a redirect_url or virtual hosts to obtain certificates for")
+	}
+	for _, host := range o.ACME.Hosts {
+		if strings.Contains(host, "*") {
+			msgs = append(msgs, fmt.Sprintf("acme_hosts entry %q: wildcard certificates cannot be obtained with the HTTP-01 and TLS-ALPN-01 challenges", host))
+		}
+	}
+
+	if o.ACME.CacheDir == "" && o.Session.Type == options.CookieSessionStoreType {
+		msgs = append(msgs, "acme requires acme_cache_dir, or a persistent session store to store the certificates in")
+	}
+
+	if !serverEnabled(o.Server.SecureBindAddress) {
+		msgs = append(msgs, "acme requires https_address, as the certificates are served by the HTTPS server")
+	}
+	if o.Server.TLS != nil && (o.Server.TLS.Cert != nil || o.Server.TLS.Key != nil) {
+		msgs = append(msgs, "acme cannot be used with a TLS certificate and key for the server, as the certificates are obtained with ACME")
+	}
+	if o.Server.TLS != nil && (len(o.Server.TLS.Certificates) > 0 || o.Server.TLS.CertificatesDir != "") {
+		msgs = append(msgs, "acme cannot be used with further TLS certificates for the server, as the certificates are obtained with ACME")
+	}
+	return msgs
+}
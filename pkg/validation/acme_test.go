@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ACME", func() {
+	type validateACMETableInput struct {
+		opts       func(*options.Options)
+		errStrings []string
+	}
+
+	DescribeTable("validateACME",
+		func(in validateACMETableInput) {
+			opts := &options.Options{
+				RawRedirectURL: "https://auth.example.com/oauth2/callback",
+				Session:        options.SessionOptions{Type: options.RedisSessionStoreType},
+				Server:         options.Server{BindAddress: ":80", SecureBindAddress: ":443"},
+				ACME: options.ACME{
+					Enabled:      true,
+					AcceptTOS:    true,
+					DirectoryURL: options.LetsEncryptDirectoryURL,
+					RenewBefore:  30 * 24 * time.Hour,
+				},
+			}
+			if in.opts != nil {
+				in.opts(opts)
+			}
+			Expect(validateACME(opts)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with a valid configuration", validateACMETableInput{
+			errStrings: []string{},
+		}),
+		Entry("with ACME disabled", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.ACME = options.ACME{}
+				o.Server.SecureBindAddress = ""
+			},
+			errStrings: []string{},
+		}),
+		Entry("without accepting the terms of service", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.ACME.AcceptTOS = false
+			},
+			errStrings: []string{"acme requires acme_accept_tos to accept the terms of service of the certificate authority"},
+		}),
+		Entry("with an invalid directory URL and renewal", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.ACME.DirectoryURL = "acme.example.com"
+				o.ACME.RenewBefore = 0
+			},
+			errStrings: []string{
+				"acme_directory_url \"acme.example.com\" must be an absolute http or https URL",
+				"acme_renew_before must be positive",
+			},
+		}),
+		Entry("without hosts", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.RawRedirectURL = ""
+			},
+			errStrings: []string{"acme requires acme_hosts, or a redirect_url or virtual hosts to obtain certificates for"},
+		}),
+		Entry("with a wildcard host", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.ACME.Hosts = []string{"*.example.com"}
+			},
+			errStrings: []string{"acme_hosts entry \"*.example.com\": wildcard certificates cannot be obtained with the HTTP-01 and TLS-ALPN-01 challenges"},
+		}),
+		Entry("with the cookie session store", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.Session.Type = options.CookieSessionStoreType
+			},
+			errStrings: []string{"acme requires acme_cache_dir, or a persistent session store to store the certificates in"},
+		}),
+		Entry("with the cookie session store and a cache dir", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.Session.Type = options.CookieSessionStoreType
+				o.ACME.CacheDir = "/var/lib/oauth2-proxy/acme"
+			},
+			errStrings: []string{},
+		}),
+		Entry("without an HTTPS server", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.Server.SecureBindAddress = ""
+			},
+			errStrings: []string{"acme requires https_address, as the certificates are served by the HTTPS server"},
+		}),
+		Entry("with a TLS certificate", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.Server.TLS = &options.TLS{
+					Cert: &options.SecretSource{FromFile: "tls.crt"},
+					Key:  &options.SecretSource{FromFile: "tls.key"},
+				}
+			},
+			errStrings: []string{"acme cannot be used with a TLS certificate and key for the server, as the certificates are obtained with ACME"},
+		}),
+		Entry("with a TLS certificates dir", validateACMETableInput{
+			opts: func(o *options.Options) {
+				o.Server.TLS = &options.TLS{CertificatesDir: "/etc/oauth2-proxy/certificates"}
+			},
+			errStrings: []string{"acme cannot be used with further TLS certificates for the server, as the certificates are obtained with ACME"},
+		}),
+	)
+})
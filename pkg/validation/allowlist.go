@@ -15,6 +15,8 @@ func validateAllowlists(o *options.Options) []string {
 
 	msgs = append(msgs, validateAuthRoutes(o)...)
 	msgs = append(msgs, validateAuthRegexes(o)...)
+	msgs = append(msgs, validateAuthModeRoutes(o)...)
+	msgs = append(msgs, validateStepUpRoutes(o)...)
 	msgs = append(msgs, validateTrustedIPs(o)...)
 
 	if len(o.TrustedIPs) > 0 && o.ReverseProxy {
@@ -27,25 +29,72 @@ func validateAllowlists(o *options.Options) []string {
 	return msgs
 }
 
-// validateAuthRoutes validates method=path routes passed with options.SkipAuthRoutes
+// validateAuthRoutes validates method=path routes, and their conditions,
+// passed with options.SkipAuthRoutes
 func validateAuthRoutes(o *options.Options) []string {
 	msgs := []string{}
-	for _, route := range o.SkipAuthRoutes {
-		var regex string
-		parts := strings.SplitN(route, "=", 2)
-		if len(parts) == 1 {
-			regex = parts[0]
-		} else {
-			regex = parts[1]
+	for _, r := range o.SkipAuthRoutes {
+		route, err := options.ParseSkipAuthRoute(r)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+			continue
 		}
-		_, err := regexp.Compile(regex)
+
+		msgs = append(msgs, validateMethodPath(route.MethodPath)...)
+
+		for _, network := range route.Networks {
+			if ip.ParseIPNet(network) == nil {
+				msgs = append(msgs, fmt.Sprintf("skip auth route %q has a cidr condition (%s) that could not be recognized", r, network))
+			}
+		}
+	}
+	return msgs
+}
+
+// validateAuthModeRoutes validates mode:method=path routes, and their login
+// action, passed with options.AuthRoutes
+func validateAuthModeRoutes(o *options.Options) []string {
+	msgs := []string{}
+	for _, r := range o.AuthRoutes {
+		route, err := options.ParseAuthRoute(r)
 		if err != nil {
-			msgs = append(msgs, fmt.Sprintf("error compiling regex /%s/: %v", regex, err))
+			msgs = append(msgs, err.Error())
+			continue
+		}
+		if route.Mode == options.AuthModeBearerOnly && !o.SkipJwtBearerTokens {
+			msgs = append(msgs, fmt.Sprintf("auth route %q requires skip-jwt-bearer-tokens to be enabled", r))
 		}
+		msgs = append(msgs, validateMethodPath(route.MethodPath)...)
 	}
 	return msgs
 }
 
+// validateStepUpRoutes validates method=path routes, and their requirements,
+// passed with options.StepUpRoutes
+func validateStepUpRoutes(o *options.Options) []string {
+	msgs := []string{}
+	for _, r := range o.StepUpRoutes {
+		route, err := options.ParseStepUpRoute(r)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+			continue
+		}
+
+		msgs = append(msgs, validateMethodPath(route.MethodPath)...)
+	}
+	return msgs
+}
+
+// validateMethodPath validates the path regex of a method=path_regex,
+// method!=path_regex or path_regex route
+func validateMethodPath(methodPath string) []string {
+	regex := methodPath
+	if _, path, ok := strings.Cut(methodPath, "="); ok {
+		regex = path
+	}
+	return validateRegexes([]string{regex})
+}
+
 // validateRegex validates regex paths passed with options.SkipAuthRegex
 func validateAuthRegexes(o *options.Options) []string {
 	return validateRegexes(o.SkipAuthRegex)
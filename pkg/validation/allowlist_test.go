@@ -13,6 +13,12 @@ var _ = Describe("Allowlist", func() {
 		errStrings []string
 	}
 
+	type validateAuthModeRoutesTableInput struct {
+		routes              []string
+		skipJwtBearerTokens bool
+		errStrings          []string
+	}
+
 	type validateRegexesTableInput struct {
 		regexes    []string
 		errStrings []string
@@ -53,6 +59,140 @@ var _ = Describe("Allowlist", func() {
 				"error compiling regex /^]/foo/bar[$/: error parsing regexp: missing closing ]: `[$`",
 			},
 		}),
+		Entry("Valid conditions", &validateRoutesTableInput{
+			routes: []string{
+				"GET=^/metrics$ header=X-Scanner-Key:secret cidr=10.0.0.0/8,192.168.0.1",
+				"^/health header=X-Health-Check priority=-1 dry-run",
+			},
+			errStrings: []string{},
+		}),
+		Entry("Invalid conditions", &validateRoutesTableInput{
+			routes: []string{
+				"GET=^/metrics$ cidr=10.0.0.0/33",
+				"GET=^/metrics$ header=:value",
+				"GET=^/metrics$ priority=high",
+				"GET=^/metrics$ source=10.0.0.0/8",
+			},
+			errStrings: []string{
+				"skip auth route \"GET=^/metrics$ cidr=10.0.0.0/33\" has a cidr condition (10.0.0.0/33) that could not be recognized",
+				"skip auth route \"GET=^/metrics$ header=:value\" has a header condition without a header name",
+				"skip auth route \"GET=^/metrics$ priority=high\" has an invalid priority \"high\"",
+				"skip auth route \"GET=^/metrics$ source=10.0.0.0/8\" has unknown condition \"source\", must be one of \"header\", \"cidr\", \"priority\" or \"dry-run\"",
+			},
+		}),
+	)
+
+	DescribeTable("validateAuthModeRoutes",
+		func(r *validateAuthModeRoutesTableInput) {
+			opts := &options.Options{
+				AuthRoutes:          r.routes,
+				SkipJwtBearerTokens: r.skipJwtBearerTokens,
+			}
+			Expect(validateAuthModeRoutes(opts)).To(ConsistOf(r.errStrings))
+		},
+		Entry("Valid auth routes", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"required:/admin",
+				"optional:GET=^/public/",
+				"skip:!=^/app/",
+				"bearer-only:POST=^/api/",
+			},
+			skipJwtBearerTokens: true,
+			errStrings:          []string{},
+		}),
+		Entry("Missing and unknown modes", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"/admin",
+				":/admin",
+				"anonymous:/public",
+				"required,optional:/public",
+			},
+			errStrings: []string{
+				"auth route \"/admin\" must be of the form mode[,login=action]:[method=]path_regex or login=action:[method=]path_regex",
+				"auth route \":/admin\" must be of the form mode[,login=action]:[method=]path_regex or login=action:[method=]path_regex",
+				"auth route \"anonymous:/public\" has unknown mode \"anonymous\", must be one of \"required\", \"optional\", \"bearer-only\" or \"skip\"",
+				"auth route \"required,optional:/public\" sets the mode more than once",
+			},
+		}),
+		Entry("Valid login actions", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"required,login=redirect:^/app/",
+				"login=401,required:GET=^/api/",
+				"optional,login=403:!=^/app/",
+				"login=401:^/docs/[^ ]+\\.pdf$",
+			},
+			errStrings: []string{},
+		}),
+		Entry("Unknown and invalid login actions", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"login=302:/app",
+				"login=401,login=403:/app",
+				"skip,login=401:/app",
+			},
+			errStrings: []string{
+				"auth route \"login=302:/app\" has unknown login action \"302\", must be one of \"redirect\", \"401\" or \"403\"",
+				"auth route \"login=401,login=403:/app\" sets the login action more than once",
+				"auth route \"skip,login=401:/app\" cannot set a login action with mode \"skip\"",
+			},
+		}),
+		Entry("Bearer only routes without JWT bearer tokens", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"bearer-only:^/api/",
+			},
+			errStrings: []string{
+				"auth route \"bearer-only:^/api/\" requires skip-jwt-bearer-tokens to be enabled",
+			},
+		}),
+		Entry("Bad regexes do not compile", &validateAuthModeRoutesTableInput{
+			routes: []string{
+				"optional:GET=/(foo",
+			},
+			errStrings: []string{
+				"error compiling regex //(foo/: error parsing regexp: missing closing ): `/(foo`",
+			},
+		}),
+	)
+
+	DescribeTable("validateStepUpRoutes",
+		func(r *validateRoutesTableInput) {
+			opts := &options.Options{
+				StepUpRoutes: r.routes,
+			}
+			Expect(validateStepUpRoutes(opts)).To(ConsistOf(r.errStrings))
+		},
+		Entry("Valid step up routes", &validateRoutesTableInput{
+			routes: []string{
+				"^/admin/ mfa",
+				"POST=^/payments acr=urn:mace:incommon:iap:silver,phr",
+				"^/billing acr=phrh mfa",
+				"^/transfers max-age=5m",
+			},
+			errStrings: []string{},
+		}),
+		Entry("Missing, empty and unknown requirements", &validateRoutesTableInput{
+			routes: []string{
+				"^/admin/",
+				"^/admin/ acr=",
+				"^/admin/ otp",
+				"^/admin/ max-age=0s",
+				"^/admin/ max-age=often",
+			},
+			errStrings: []string{
+				"step up route \"^/admin/\" has no requirement, must have an \"acr\", \"mfa\" or \"max-age\" requirement",
+				"step up route \"^/admin/ acr=\" has an empty acr requirement",
+				"step up route \"^/admin/ otp\" has unknown requirement \"otp\", must be one of \"acr\", \"mfa\" or \"max-age\"",
+				"step up route \"^/admin/ max-age=0s\" has an invalid max-age \"0s\"",
+				"step up route \"^/admin/ max-age=often\" has an invalid max-age \"often\"",
+			},
+		}),
+		Entry("Bad regexes do not compile", &validateRoutesTableInput{
+			routes: []string{
+				"GET=/(foo mfa",
+			},
+			errStrings: []string{
+				"error compiling regex //(foo/: error parsing regexp: missing closing ): `/(foo`",
+			},
+		}),
 	)
 
 	DescribeTable("validateRegexes",
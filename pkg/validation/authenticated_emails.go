@@ -0,0 +1,29 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateAuthenticatedEmails checks the authenticated emails come from a
+// single source, and the URL is polled over HTTPS
+func validateAuthenticatedEmails(o *options.Options) []string {
+	msgs := []string{}
+	if o.AuthenticatedEmails.URL == "" {
+		return msgs
+	}
+
+	if o.AuthenticatedEmailsFile != "" {
+		msgs = append(msgs, "authenticated_emails_file and authenticated_emails_url are mutually exclusive")
+	}
+	u, err := url.Parse(o.AuthenticatedEmails.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		msgs = append(msgs, fmt.Sprintf("authenticated_emails_url %q must be an https URL", o.AuthenticatedEmails.URL))
+	}
+	if o.AuthenticatedEmails.RefreshInterval <= 0 {
+		msgs = append(msgs, fmt.Sprintf("authenticated_emails_refresh_interval (%s) must be positive", o.AuthenticatedEmails.RefreshInterval))
+	}
+	return msgs
+}
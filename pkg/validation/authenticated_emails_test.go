@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticated Emails", func() {
+	type validateAuthenticatedEmailsTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateAuthenticatedEmails",
+		func(in validateAuthenticatedEmailsTableInput) {
+			Expect(validateAuthenticatedEmails(in.opts)).To(ConsistOf(in.errStrings))
+		},
+		Entry("without a URL", validateAuthenticatedEmailsTableInput{
+			opts:       &options.Options{AuthenticatedEmailsFile: "emails.txt"},
+			errStrings: []string{},
+		}),
+		Entry("with a valid URL", validateAuthenticatedEmailsTableInput{
+			opts: &options.Options{AuthenticatedEmails: options.AuthenticatedEmails{
+				URL:             "https://emails.internal.example.com/oauth2-proxy",
+				RefreshInterval: time.Minute,
+			}},
+			errStrings: []string{},
+		}),
+		Entry("with both a file and a URL", validateAuthenticatedEmailsTableInput{
+			opts: &options.Options{
+				AuthenticatedEmailsFile: "emails.txt",
+				AuthenticatedEmails: options.AuthenticatedEmails{
+					URL:             "https://emails.internal.example.com/oauth2-proxy",
+					RefreshInterval: time.Minute,
+				},
+			},
+			errStrings: []string{"authenticated_emails_file and authenticated_emails_url are mutually exclusive"},
+		}),
+		Entry("with an http URL and no refresh interval", validateAuthenticatedEmailsTableInput{
+			opts: &options.Options{AuthenticatedEmails: options.AuthenticatedEmails{
+				URL: "http://emails.internal.example.com/oauth2-proxy",
+			}},
+			errStrings: []string{
+				`authenticated_emails_url "http://emails.internal.example.com/oauth2-proxy" must be an https URL`,
+				"authenticated_emails_refresh_interval (0s) must be positive",
+			},
+		}),
+	)
+})
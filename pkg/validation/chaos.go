@@ -0,0 +1,31 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateChaos checks the fault injection options are within range
+func validateChaos(o options.Chaos) []string {
+	msgs := []string{}
+	msgs = append(msgs, validateChaosFault("provider", o.ProviderLatency, o.ProviderLatencyPercentage, o.ProviderErrorPercentage)...)
+	msgs = append(msgs, validateChaosFault("session_store", o.SessionStoreLatency, o.SessionStoreLatencyPercentage, o.SessionStoreErrorPercentage)...)
+	msgs = append(msgs, validateChaosFault("upstream", o.UpstreamLatency, o.UpstreamLatencyPercentage, o.UpstreamErrorPercentage)...)
+	return msgs
+}
+
+func validateChaosFault(name string, latency time.Duration, latencyPercentage, errorPercentage int) []string {
+	msgs := []string{}
+	if latency < 0 {
+		msgs = append(msgs, fmt.Sprintf("chaos_%s_latency must not be negative", name))
+	}
+	if latencyPercentage < 0 || latencyPercentage > 100 {
+		msgs = append(msgs, fmt.Sprintf("chaos_%s_latency_percentage (%d) must be between 0 and 100", name, latencyPercentage))
+	}
+	if errorPercentage < 0 || errorPercentage > 100 {
+		msgs = append(msgs, fmt.Sprintf("chaos_%s_error_percentage (%d) must be between 0 and 100", name, errorPercentage))
+	}
+	return msgs
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chaos", func() {
+	type validateChaosTableInput struct {
+		chaos      options.Chaos
+		errStrings []string
+	}
+
+	DescribeTable("validateChaos",
+		func(in validateChaosTableInput) {
+			Expect(validateChaos(in.chaos)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with no faults", validateChaosTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with valid faults", validateChaosTableInput{
+			chaos: options.Chaos{
+				ProviderLatency:             time.Second,
+				ProviderLatencyPercentage:   50,
+				SessionStoreErrorPercentage: 100,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with out of range faults", validateChaosTableInput{
+			chaos: options.Chaos{
+				SessionStoreLatency:       -time.Second,
+				UpstreamLatencyPercentage: 101,
+				UpstreamErrorPercentage:   -1,
+			},
+			errStrings: []string{
+				"chaos_session_store_latency must not be negative",
+				"chaos_upstream_latency_percentage (101) must be between 0 and 100",
+				"chaos_upstream_error_percentage (-1) must be between 0 and 100",
+			},
+		}),
+	)
+})
@@ -1,22 +1,26 @@
 package validation
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/secrets"
 )
 
-const multipleValuesForSecretSource = "multiple values specified for secret source: specify either value, fromEnv of fromFile"
+const multipleValuesForSecretSource = "multiple values specified for secret source: specify either value, fromEnv, fromFile or fromRef"
 
 func validateSecretSource(source options.SecretSource) string {
 	switch {
-	case len(source.Value) > 0 && source.FromEnv == "" && source.FromFile == "":
+	case len(source.Value) > 0 && source.FromEnv == "" && source.FromFile == "" && source.FromRef == "":
 		return ""
-	case len(source.Value) == 0 && source.FromEnv != "" && source.FromFile == "":
+	case len(source.Value) == 0 && source.FromEnv != "" && source.FromFile == "" && source.FromRef == "":
 		return validateSecretSourceEnv(source.FromEnv)
-	case len(source.Value) == 0 && source.FromEnv == "" && source.FromFile != "":
+	case len(source.Value) == 0 && source.FromEnv == "" && source.FromFile != "" && source.FromRef == "":
 		return validateSecretSourceFile(source.FromFile)
+	case len(source.Value) == 0 && source.FromEnv == "" && source.FromFile == "" && source.FromRef != "":
+		return validateSecretSourceRef(source.FromRef)
 	default:
 		return multipleValuesForSecretSource
 	}
@@ -35,3 +39,14 @@ func validateSecretSourceFile(path string) string {
 	}
 	return ""
 }
+
+func validateSecretSourceRef(ref string) string {
+	if _, err := secrets.ParseRef(ref); err != nil {
+		return err.Error()
+	}
+	// Loading the secret also caches it for when it is first used
+	if _, err := secrets.Get(context.Background(), ref); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -123,5 +123,31 @@ var _ = Describe("Common", func() {
 			},
 			expectedMsg: "error loadig secret from file: stat invalidFile: no such file or directory",
 		}),
+		Entry("with FromFile and FromRef", validateSecretSourceTableInput{
+			source: func() options.SecretSource {
+				return options.SecretSource{
+					FromFile: validSecretSourceFile,
+					FromRef:  "kubernetes://apps/oauth2-proxy/client-secret",
+				}
+			},
+			expectedMsg: multipleValuesForSecretSource,
+		}),
+		Entry("with an invalid FromRef", validateSecretSourceTableInput{
+			source: func() options.SecretSource {
+				return options.SecretSource{
+					FromRef: "kubernetes://apps/client-secret",
+				}
+			},
+			expectedMsg: "invalid secret reference \"kubernetes://apps/client-secret\": expected kubernetes://namespace/secret/key",
+		}),
+		Entry("with a FromRef to an unsupported store", validateSecretSourceTableInput{
+			source: func() options.SecretSource {
+				return options.SecretSource{
+					FromRef: "aws://client-secret",
+				}
+			},
+			expectedMsg: "invalid secret reference \"aws://client-secret\": unsupported scheme \"aws\", expected kubernetes://namespace/secret/key, " +
+				"vault://path#field, aws-secretsmanager://secret-id, gcp-secretmanager://projects/project/secrets/secret or azure-keyvault://vault/secret",
+		}),
 	)
 })
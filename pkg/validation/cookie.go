@@ -1,17 +1,21 @@
 package validation
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/secrets"
 )
 
 func validateCookie(o options.Cookie) []string {
-	msgs := validateCookieSecret(o.Secret)
+	msgs := validateCookieKeyDerivation(o)
 
 	if o.Expire != time.Duration(0) && o.Refresh >= o.Expire {
 		msgs = append(msgs, fmt.Sprintf(
@@ -49,6 +53,107 @@ func validateCookieName(name string) []string {
 	return msgs
 }
 
+func validateCookieKeyDerivation(o options.Cookie) []string {
+	switch o.KeyDerivation {
+	case "", encryption.KeyDerivationNone:
+		msgs := validateCookieSecret(o.Secret)
+		if o.SigningSecret != "" {
+			msgs = append(msgs, "cookie_signing_secret requires cookie_key_derivation to be set")
+		}
+		return msgs
+	case encryption.KeyDerivationHKDF, encryption.KeyDerivationArgon2id:
+		msgs := validateCookieKDFSecret("cookie_secret", o.Secret, o.KeyDerivation)
+		if o.SigningSecret != "" {
+			msgs = append(msgs, validateCookieKDFSecret("cookie_signing_secret", o.SigningSecret, o.KeyDerivation)...)
+		}
+		return msgs
+	default:
+		return []string{fmt.Sprintf("cookie_key_derivation (%q) must be one of ['none', 'hkdf-sha256', 'argon2id']", o.KeyDerivation)}
+	}
+}
+
+// validateCookieKDFSecret checks that a secret used as key derivation input
+// is long enough. HKDF does not strengthen weak secrets, so requires at least
+// 16 bytes of input.
+func validateCookieKDFSecret(name, secret, method string) []string {
+	if secret == "" {
+		return []string{"missing setting: " + strings.ReplaceAll(name, "_", "-")}
+	}
+
+	if method == encryption.KeyDerivationHKDF && len(encryption.SecretBytes(secret)) < 16 {
+		return []string{fmt.Sprintf("%s must be at least 16 bytes when using hkdf-sha256 key derivation", name)}
+	}
+	return []string{}
+}
+
+// loadCookieSecretRef loads the cookie secret from its secret reference,
+// along with the previous secret once the reference has been rotated
+func loadCookieSecretRef(o *options.Cookie) []string {
+	if o.SecretRef == "" {
+		return []string{}
+	}
+	if o.Secret != "" {
+		return []string{"cookie_secret and cookie_secret_ref are mutually exclusive"}
+	}
+
+	secret, err := secrets.Get(context.Background(), o.SecretRef)
+	if err != nil {
+		return []string{fmt.Sprintf("could not load cookie secret: %v", err)}
+	}
+	o.Secret = string(secret)
+	if previous := secrets.Previous(o.SecretRef); previous != nil {
+		o.SetPreviousSecret(string(previous))
+	}
+	return []string{}
+}
+
+// configureCookieKeys derives the cookie encryption and signing keys from the
+// configured secrets when a key derivation method is set, and keeps the
+// keys in locked memory.
+func configureCookieKeys(o *options.Cookie) []string {
+	if previous := o.Previous(); previous != nil {
+		if msgs := configureCookieKeys(previous); len(msgs) > 0 {
+			return msgs
+		}
+	}
+	if o.Secret == "" {
+		// Reported by validateCookie
+		return []string{}
+	}
+	switch o.KeyDerivation {
+	case encryption.KeyDerivationHKDF, encryption.KeyDerivationArgon2id:
+	default:
+		// No derivation required, or an invalid method reported by
+		// validateCookie: the secret is used as the key
+		setCookieKeys(o, encryption.SecretBytes(o.Secret), []byte(o.Secret))
+		return []string{}
+	}
+
+	encryptionKey, err := encryption.DeriveKey(o.KeyDerivation, encryption.SecretBytes(o.Secret), encryption.CookieEncryptionKeyLabel, 32)
+	if err != nil {
+		return []string{fmt.Sprintf("could not derive cookie encryption key: %v", err)}
+	}
+
+	signingSecret := o.Secret
+	if o.SigningSecret != "" {
+		signingSecret = o.SigningSecret
+	}
+	signingKey, err := encryption.DeriveKey(o.KeyDerivation, encryption.SecretBytes(signingSecret), encryption.CookieSigningKeyLabel, 32)
+	if err != nil {
+		return []string{fmt.Sprintf("could not derive cookie signing key: %v", err)}
+	}
+
+	setCookieKeys(o, encryptionKey, signingKey)
+	return []string{}
+}
+
+func setCookieKeys(o *options.Cookie, encryptionKey, signingKey []byte) {
+	o.SetCookieKeys(encryptionKey, signingKey)
+	if !o.CookieKeysLocked() {
+		logger.Print("WARNING: could not lock the cookie keys in memory, they may be swapped to disk. Raise the RLIMIT_MEMLOCK limit of the process to lock them.")
+	}
+}
+
 func validateCookieSecret(secret string) []string {
 	if secret == "" {
 		return []string{"missing setting: cookie-secret"}
@@ -271,6 +271,66 @@ func TestValidateCookie(t *testing.T) {
 			},
 			errStrings: []string{},
 		},
+		{
+			name: "with hkdf key derivation and a passphrase secret",
+			cookie: options.Cookie{
+				Name:          validName,
+				Secret:        "a passphrase that is not an AES key size",
+				Expire:        time.Hour,
+				KeyDerivation: "hkdf-sha256",
+				SigningSecret: validSecret,
+			},
+			errStrings: []string{},
+		},
+		{
+			name: "with hkdf key derivation and a short secret",
+			cookie: options.Cookie{
+				Name:          validName,
+				Secret:        invalidSecret,
+				Expire:        time.Hour,
+				KeyDerivation: "hkdf-sha256",
+				SigningSecret: invalidSecret,
+			},
+			errStrings: []string{
+				"cookie_secret must be at least 16 bytes when using hkdf-sha256 key derivation",
+				"cookie_signing_secret must be at least 16 bytes when using hkdf-sha256 key derivation",
+			},
+		},
+		{
+			name: "with argon2id key derivation and a short secret",
+			cookie: options.Cookie{
+				Name:          validName,
+				Secret:        invalidSecret,
+				Expire:        time.Hour,
+				KeyDerivation: "argon2id",
+			},
+			errStrings: []string{},
+		},
+		{
+			name: "with a signing secret and no key derivation",
+			cookie: options.Cookie{
+				Name:          validName,
+				Secret:        validSecret,
+				Expire:        time.Hour,
+				KeyDerivation: "none",
+				SigningSecret: validSecret,
+			},
+			errStrings: []string{
+				"cookie_signing_secret requires cookie_key_derivation to be set",
+			},
+		},
+		{
+			name: "with an invalid key derivation",
+			cookie: options.Cookie{
+				Name:          validName,
+				Secret:        validSecret,
+				Expire:        time.Hour,
+				KeyDerivation: "pbkdf2",
+			},
+			errStrings: []string{
+				"cookie_key_derivation (\"pbkdf2\") must be one of ['none', 'hkdf-sha256', 'argon2id']",
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -286,3 +346,66 @@ func TestValidateCookie(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigureCookieKeys(t *testing.T) {
+	const secret = "secretthirtytwobytes+abcdefghijk"
+	const signingSecret = "anothersecretthirtytwobytes+abcd"
+
+	t.Run("without key derivation", func(t *testing.T) {
+		g := NewWithT(t)
+		cookie := options.Cookie{Secret: secret, KeyDerivation: "none"}
+
+		g.Expect(configureCookieKeys(&cookie)).To(BeEmpty())
+		g.Expect(cookie.GetEncryptionKey()).To(Equal([]byte(secret)))
+		g.Expect(cookie.GetSigningKey()).To(Equal([]byte(secret)))
+	})
+
+	t.Run("with hkdf key derivation", func(t *testing.T) {
+		g := NewWithT(t)
+		cookie := options.Cookie{Secret: secret, KeyDerivation: "hkdf-sha256"}
+
+		g.Expect(configureCookieKeys(&cookie)).To(BeEmpty())
+		g.Expect(cookie.GetEncryptionKey()).To(HaveLen(32))
+		g.Expect(cookie.GetEncryptionKey()).ToNot(Equal([]byte(secret)))
+		g.Expect(cookie.GetSigningKey()).To(HaveLen(32))
+		g.Expect(cookie.GetSigningKey()).ToNot(Equal(cookie.GetEncryptionKey()))
+	})
+
+	t.Run("with a separate signing secret", func(t *testing.T) {
+		g := NewWithT(t)
+		cookie := options.Cookie{Secret: secret, KeyDerivation: "hkdf-sha256"}
+		g.Expect(configureCookieKeys(&cookie)).To(BeEmpty())
+
+		rotated := options.Cookie{Secret: secret, SigningSecret: signingSecret, KeyDerivation: "hkdf-sha256"}
+		g.Expect(configureCookieKeys(&rotated)).To(BeEmpty())
+
+		g.Expect(rotated.GetEncryptionKey()).To(Equal(cookie.GetEncryptionKey()))
+		g.Expect(rotated.GetSigningKey()).ToNot(Equal(cookie.GetSigningKey()))
+	})
+
+	t.Run("with a previous cookie secret", func(t *testing.T) {
+		g := NewWithT(t)
+		previous := options.Cookie{Secret: secret, KeyDerivation: "hkdf-sha256"}
+		g.Expect(configureCookieKeys(&previous)).To(BeEmpty())
+
+		rotated := options.Cookie{Secret: signingSecret, KeyDerivation: "hkdf-sha256"}
+		rotated.SetPreviousSecret(secret)
+		g.Expect(configureCookieKeys(&rotated)).To(BeEmpty())
+
+		keys := rotated.GetCookieKeys()
+		g.Expect(keys).To(HaveLen(2))
+		g.Expect(keys[0].SigningKey).To(Equal(rotated.GetSigningKey()))
+		g.Expect(keys[1].EncryptionKey).To(Equal(previous.GetEncryptionKey()))
+		g.Expect(keys[1].SigningKey).To(Equal(previous.GetSigningKey()))
+	})
+}
+
+func TestLoadCookieSecretRef(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(loadCookieSecretRef(&options.Cookie{Secret: "secret"})).To(BeEmpty())
+	g.Expect(loadCookieSecretRef(&options.Cookie{Secret: "secret", SecretRef: "aws-secretsmanager://oauth2-proxy"})).
+		To(ConsistOf("cookie_secret and cookie_secret_ref are mutually exclusive"))
+	g.Expect(loadCookieSecretRef(&options.Cookie{SecretRef: "aws-secretsmanager://"})).
+		To(ConsistOf(`could not load cookie secret: invalid secret reference "aws-secretsmanager://": expected aws-secretsmanager://secret-id[#key]`))
+}
@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mbland/hmacauth"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+)
+
+// validateFIPS enables FIPS mode when requested and ensures that the
+// configuration doesn't require any cryptographic primitives that are not
+// FIPS 140-3 approved.
+func validateFIPS(o *options.Options) []string {
+	encryption.SetFIPSMode(o.FIPSMode)
+	if !encryption.FIPSMode() {
+		return []string{}
+	}
+
+	msgs := []string{}
+	msgs = append(msgs, validateFIPSServerTLS("server", o.Server)...)
+	msgs = append(msgs, validateFIPSServerTLS("metricsServer", o.MetricsServer)...)
+	msgs = append(msgs, validateFIPSServerTLS("adminServer", o.AdminServer)...)
+
+	if o.Cookie.KeyDerivation == encryption.KeyDerivationArgon2id {
+		msgs = append(msgs, fmt.Sprintf("cookie key derivation %q is not FIPS approved", o.Cookie.KeyDerivation))
+	}
+
+	if o.SignatureKey != "" {
+		algorithm, _, _ := strings.Cut(o.SignatureKey, ":")
+		// Invalid algorithms are reported by parseSignatureKey
+		if hash, err := hmacauth.DigestNameToCryptoHash(algorithm); err == nil && !encryption.IsFIPSApprovedHash(hash) {
+			msgs = append(msgs, fmt.Sprintf("signature hash algorithm %q is not FIPS approved", algorithm))
+		}
+	}
+
+	return msgs
+}
+
+// validateFIPSServerTLS checks the TLS options of a server and of its listeners
+func validateFIPSServerTLS(name string, server options.Server) []string {
+	msgs := prefixValues(name+": ", validateFIPSTLS(server.TLS)...)
+	for i, listener := range server.Listeners {
+		msgs = append(msgs, prefixValues(fmt.Sprintf("%s: listeners[%d]: ", name, i), validateFIPSTLS(listener.TLS)...)...)
+	}
+	return msgs
+}
+
+// validateFIPSTLS checks that any configured TLS cipher suites and curves are
+// FIPS approved.
+func validateFIPSTLS(tls *options.TLS) []string {
+	if tls == nil {
+		return []string{}
+	}
+
+	msgs := []string{}
+	for _, cipherSuite := range tls.CipherSuites {
+		if !encryption.IsFIPSApprovedCipherSuite(cipherSuite) {
+			msgs = append(msgs, fmt.Sprintf("TLS cipher suite %q is not FIPS approved", cipherSuite))
+		}
+	}
+	for _, curve := range tls.CurvePreferences {
+		if !encryption.IsFIPSApprovedCurve(curve) {
+			msgs = append(msgs, fmt.Sprintf("TLS curve %q is not FIPS approved", curve))
+		}
+	}
+	return msgs
+}
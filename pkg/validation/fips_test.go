@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FIPS", func() {
+	AfterEach(func() {
+		encryption.SetFIPSMode(false)
+	})
+
+	type validateFIPSTableInput struct {
+		options      *options.Options
+		expectedMsgs []string
+	}
+
+	DescribeTable("validateFIPS",
+		func(in validateFIPSTableInput) {
+			Expect(validateFIPS(in.options)).To(ConsistOf(in.expectedMsgs))
+			Expect(encryption.FIPSMode()).To(Equal(in.options.FIPSMode))
+		},
+		Entry("with FIPS mode disabled and non-approved configuration", validateFIPSTableInput{
+			options: &options.Options{
+				SignatureKey: "sha1:secret",
+				Server: options.Server{
+					TLS: &options.TLS{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+				},
+			},
+			expectedMsgs: []string{},
+		}),
+		Entry("with FIPS mode enabled and approved configuration", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode:     true,
+				SignatureKey: "sha256:secret",
+				Server: options.Server{
+					TLS: &options.TLS{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+				},
+			},
+			expectedMsgs: []string{},
+		}),
+		Entry("with FIPS mode enabled and non-approved cipher suites", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode: true,
+				Server: options.Server{
+					TLS: &options.TLS{CipherSuites: []string{
+						"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+						"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+					}},
+				},
+				MetricsServer: options.Server{
+					TLS: &options.TLS{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+				},
+			},
+			expectedMsgs: []string{
+				"server: TLS cipher suite \"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256\" is not FIPS approved",
+				"metricsServer: TLS cipher suite \"TLS_RSA_WITH_RC4_128_SHA\" is not FIPS approved",
+			},
+		}),
+		Entry("with FIPS mode enabled and non-approved curves", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode: true,
+				Server: options.Server{
+					TLS: &options.TLS{CurvePreferences: []string{"X25519", "P256"}},
+				},
+			},
+			expectedMsgs: []string{
+				"server: TLS curve \"X25519\" is not FIPS approved",
+			},
+		}),
+		Entry("with FIPS mode enabled and a non-approved signature hash", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode:     true,
+				SignatureKey: "sha1:secret",
+			},
+			expectedMsgs: []string{
+				"signature hash algorithm \"sha1\" is not FIPS approved",
+			},
+		}),
+		Entry("with FIPS mode enabled and argon2id cookie key derivation", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode: true,
+				Cookie:   options.Cookie{KeyDerivation: "argon2id"},
+			},
+			expectedMsgs: []string{
+				"cookie key derivation \"argon2id\" is not FIPS approved",
+			},
+		}),
+		Entry("with FIPS mode enabled and an invalid signature hash", validateFIPSTableInput{
+			options: &options.Options{
+				FIPSMode:     true,
+				SignatureKey: "unsupported:secret",
+			},
+			expectedMsgs: []string{},
+		}),
+	)
+})
@@ -0,0 +1,40 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// handoffMinSecretLength is the shortest secret that handoff keys can be
+// derived from
+const handoffMinSecretLength = 16
+
+// validateHandoff checks the session handoff options are consistent
+func validateHandoff(o options.Handoff) []string {
+	msgs := []string{}
+	if o.Secret == "" {
+		if len(o.AllowedDomains) > 0 {
+			msgs = append(msgs, "handoff_allowed_domains requires handoff_secret to be set")
+		}
+		if o.URL != "" {
+			msgs = append(msgs, "handoff_url requires handoff_secret to be set")
+		}
+		return msgs
+	}
+
+	if len(o.Secret) < handoffMinSecretLength {
+		msgs = append(msgs, fmt.Sprintf("handoff_secret must be at least %d bytes", handoffMinSecretLength))
+	}
+	if o.Expire <= 0 {
+		msgs = append(msgs, fmt.Sprintf("handoff_expire (%s) must be positive", o.Expire))
+	}
+	if o.URL != "" {
+		u, err := url.Parse(o.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			msgs = append(msgs, fmt.Sprintf("handoff_url (%q) must be an absolute http or https URL", o.URL))
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,61 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handoff", func() {
+	type validateHandoffTableInput struct {
+		handoff    options.Handoff
+		errStrings []string
+	}
+
+	DescribeTable("validateHandoff",
+		func(in validateHandoffTableInput) {
+			Expect(validateHandoff(in.handoff)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with handoff disabled", validateHandoffTableInput{
+			handoff:    options.Handoff{Expire: 30 * time.Second},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateHandoffTableInput{
+			handoff: options.Handoff{
+				Secret:         "0123456789abcdef",
+				Expire:         30 * time.Second,
+				AllowedDomains: []string{".example.net"},
+				URL:            "https://auth.example.com/oauth2/handoff",
+			},
+			errStrings: []string{},
+		}),
+		Entry("with allowed domains and a URL but no secret", validateHandoffTableInput{
+			handoff: options.Handoff{
+				Expire:         30 * time.Second,
+				AllowedDomains: []string{".example.net"},
+				URL:            "https://auth.example.com/oauth2/handoff",
+			},
+			errStrings: []string{
+				"handoff_allowed_domains requires handoff_secret to be set",
+				"handoff_url requires handoff_secret to be set",
+			},
+		}),
+		Entry("with a relative URL", validateHandoffTableInput{
+			handoff: options.Handoff{
+				Secret: "0123456789abcdef",
+				Expire: 30 * time.Second,
+				URL:    "/oauth2/handoff",
+			},
+			errStrings: []string{`handoff_url ("/oauth2/handoff") must be an absolute http or https URL`},
+		}),
+		Entry("with a short secret and no expiry", validateHandoffTableInput{
+			handoff: options.Handoff{Secret: "short"},
+			errStrings: []string{
+				"handoff_secret must be at least 16 bytes",
+				"handoff_expire (0s) must be positive",
+			},
+		}),
+	)
+})
@@ -2,8 +2,11 @@ package validation
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/header"
 )
 
 func validateHeaders(headers []options.Header) []string {
@@ -38,14 +41,25 @@ func validateHeader(header options.Header, names map[string]struct{}) []string {
 	return msgs
 }
 
-func validateHeaderValue(_ string, value options.HeaderValue) []string {
+func validateHeaderValue(name string, value options.HeaderValue) []string {
+	sources := 0
+	for _, set := range []bool{value.SecretSource != nil, value.ClaimSource != nil, value.JWT != nil, value.Template != ""} {
+		if set {
+			sources++
+		}
+	}
+
 	switch {
-	case value.SecretSource != nil && value.ClaimSource == nil:
+	case sources != 1:
+		return []string{"header value has multiple entries: only one entry per value is allowed"}
+	case value.SecretSource != nil:
 		return []string{validateSecretSource(*value.SecretSource)}
-	case value.SecretSource == nil && value.ClaimSource != nil:
+	case value.ClaimSource != nil:
 		return validateHeaderValueClaimSource(*value.ClaimSource)
+	case value.JWT != nil:
+		return validateHeaderValueJWTSource(*value.JWT)
 	default:
-		return []string{"header value has multiple entries: only one entry per value is allowed"}
+		return validateHeaderValueTemplate(name, value.Template)
 	}
 }
 
@@ -59,5 +73,86 @@ func validateHeaderValueClaimSource(claim options.ClaimSource) []string {
 	if claim.BasicAuthPassword != nil {
 		msgs = append(msgs, prefixValues("invalid basicAuthPassword: ", validateSecretSource(*claim.BasicAuthPassword))...)
 	}
+
+	for i, transform := range claim.Transforms {
+		msgs = append(msgs, prefixValues(fmt.Sprintf("invalid transform %d: ", i+1), validateClaimTransform(transform)...)...)
+	}
 	return msgs
 }
+
+func validateClaimTransform(transform options.ClaimTransform) []string {
+	set := 0
+	for _, ok := range []bool{
+		transform.Extract != "",
+		transform.Replace != nil,
+		transform.Case != "",
+		transform.Base64 != "",
+		transform.StripPrefix != "",
+	} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return []string{"exactly one transformation must be set per transform"}
+	}
+
+	switch {
+	case transform.Extract != "":
+		if _, err := regexp.Compile(transform.Extract); err != nil {
+			return []string{fmt.Sprintf("invalid extract: %v", err)}
+		}
+	case transform.Replace != nil:
+		if transform.Replace.Pattern == "" {
+			return []string{"replace pattern should not be empty"}
+		}
+		if _, err := regexp.Compile(transform.Replace.Pattern); err != nil {
+			return []string{fmt.Sprintf("invalid replace pattern: %v", err)}
+		}
+	case transform.Case != "":
+		if transform.Case != "upper" && transform.Case != "lower" {
+			return []string{fmt.Sprintf("unknown case %q: expected upper or lower", transform.Case)}
+		}
+	case transform.Base64 != "":
+		if transform.Base64 != "encode" && transform.Base64 != "decode" {
+			return []string{fmt.Sprintf("unknown base64 %q: expected encode or decode", transform.Base64)}
+		}
+	}
+	return []string{}
+}
+
+func validateHeaderValueJWTSource(source options.JWTSource) []string {
+	msgs := []string{}
+
+	if source.SigningKey == nil {
+		msgs = append(msgs, "jwt signingKey should not be empty")
+	} else {
+		msgs = append(msgs, prefixValues("invalid jwt signingKey: ", validateSecretSource(*source.SigningKey))...)
+	}
+	if source.Expiry != nil && source.Expiry.Duration() <= 0 {
+		msgs = append(msgs, "jwt expiry should be positive")
+	}
+	names := make([]string, 0, len(source.Claims))
+	for name := range source.Claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := reservedJWTClaims[name]; ok {
+			msgs = append(msgs, fmt.Sprintf("jwt claim %q is reserved: it is set by the proxy", name))
+		}
+	}
+	return msgs
+}
+
+func validateHeaderValueTemplate(name, text string) []string {
+	if _, err := header.ParseTemplate(name, text); err != nil {
+		return []string{fmt.Sprintf("invalid template: %v", err)}
+	}
+	return []string{}
+}
+
+// reservedJWTClaims are the claims of minted JWTs set by the proxy
+var reservedJWTClaims = map[string]struct{}{
+	"iss": {}, "sub": {}, "aud": {}, "iat": {}, "exp": {},
+}
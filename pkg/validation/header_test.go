@@ -50,6 +50,8 @@ var _ = Describe("Headers", func() {
 		},
 	}
 
+	zeroDuration := options.Duration(0)
+
 	DescribeTable("validateHeaders",
 		func(in validateHeaderTableInput) {
 			Expect(validateHeaders(in.headers)).To(ConsistOf(in.expectedMsgs))
@@ -135,7 +137,7 @@ var _ = Describe("Headers", func() {
 				validHeader1,
 			},
 			expectedMsgs: []string{
-				"invalid header \"With-Invalid-Secret\": invalid values: multiple values specified for secret source: specify either value, fromEnv of fromFile",
+				"invalid header \"With-Invalid-Secret\": invalid values: multiple values specified for secret source: specify either value, fromEnv, fromFile or fromRef",
 			},
 		}),
 		Entry("with a header with invalid basicAuthPassword source", validateHeaderTableInput{
@@ -159,5 +161,149 @@ var _ = Describe("Headers", func() {
 				"invalid header \"With-Invalid-Basic-Auth\": invalid values: invalid basicAuthPassword: error loading secret from environent: no value for for key \"UNKNOWN_ENV\"",
 			},
 		}),
+		Entry("with a valid jwt", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "Authorization",
+					Values: []options.HeaderValue{
+						{
+							JWT: &options.JWTSource{
+								SigningKey: &options.SecretSource{Value: []byte("key")},
+								Claims:     map[string]string{"email": "email"},
+							},
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{},
+		}),
+		Entry("with an invalid jwt", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "Authorization",
+					Values: []options.HeaderValue{
+						{
+							JWT: &options.JWTSource{
+								Expiry: &zeroDuration,
+								Claims: map[string]string{"sub": "email"},
+							},
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{
+				"invalid header \"Authorization\": invalid values: jwt signingKey should not be empty",
+				"invalid header \"Authorization\": invalid values: jwt expiry should be positive",
+				"invalid header \"Authorization\": invalid values: jwt claim \"sub\" is reserved: it is set by the proxy",
+			},
+		}),
+		Entry("with a jwt and a claim in one value", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "Authorization",
+					Values: []options.HeaderValue{
+						{
+							ClaimSource: &options.ClaimSource{Claim: "email"},
+							JWT:         &options.JWTSource{SigningKey: &options.SecretSource{Value: []byte("key")}},
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{
+				"invalid header \"Authorization\": invalid values: header value has multiple entries: only one entry per value is allowed",
+			},
+		}),
+		Entry("with a valid template", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "X-Auth-User",
+					Values: []options.HeaderValue{
+						{
+							Template: `user={{ .Email }};groups={{ .Groups | join "," }}`,
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{},
+		}),
+		Entry("with an invalid template", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "X-Auth-User",
+					Values: []options.HeaderValue{
+						{
+							Template: `{{ .Email | unknown }}`,
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{
+				"invalid header \"X-Auth-User\": invalid values: invalid template: template: X-Auth-User:1: function \"unknown\" not defined",
+			},
+		}),
+		Entry("with a template and a claim in one value", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "X-Auth-User",
+					Values: []options.HeaderValue{
+						{
+							ClaimSource: &options.ClaimSource{Claim: "email"},
+							Template:    "{{ .Email }}",
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{
+				"invalid header \"X-Auth-User\": invalid values: header value has multiple entries: only one entry per value is allowed",
+			},
+		}),
+		Entry("with a claim with valid transforms", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "X-Remote-User",
+					Values: []options.HeaderValue{
+						{
+							ClaimSource: &options.ClaimSource{
+								Claim: "email",
+								Transforms: []options.ClaimTransform{
+									{Extract: "^([^@]+)@"},
+									{Replace: &options.ClaimReplace{Pattern: "^", Replacement: `CORP\\`}},
+									{Case: "upper"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{},
+		}),
+		Entry("with a claim with invalid transforms", validateHeaderTableInput{
+			headers: []options.Header{
+				{
+					Name: "X-Remote-User",
+					Values: []options.HeaderValue{
+						{
+							ClaimSource: &options.ClaimSource{
+								Claim: "email",
+								Transforms: []options.ClaimTransform{
+									{Extract: "("},
+									{Case: "title"},
+									{Base64: "encode", StripPrefix: "CORP"},
+									{},
+									{Replace: &options.ClaimReplace{}},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsgs: []string{
+				"invalid header \"X-Remote-User\": invalid values: invalid transform 1: invalid extract: error parsing regexp: missing closing ): `(`",
+				"invalid header \"X-Remote-User\": invalid values: invalid transform 2: unknown case \"title\": expected upper or lower",
+				"invalid header \"X-Remote-User\": invalid values: invalid transform 3: exactly one transformation must be set per transform",
+				"invalid header \"X-Remote-User\": invalid values: invalid transform 4: exactly one transformation must be set per transform",
+				"invalid header \"X-Remote-User\": invalid values: invalid transform 5: replace pattern should not be empty",
+			},
+		}),
 	)
 })
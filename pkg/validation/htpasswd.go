@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// validateHtpasswd checks the htpasswd entries come from a single source,
+// and the minimum bcrypt cost is one bcrypt supports
+func validateHtpasswd(o *options.Options) []string {
+	msgs := []string{}
+	if o.HtpasswdFile != "" && o.HtpasswdEnv != "" {
+		msgs = append(msgs, "htpasswd_file and htpasswd_env are mutually exclusive")
+	}
+	if o.HtpasswdBcryptMinCost != 0 &&
+		(o.HtpasswdBcryptMinCost < bcrypt.MinCost || o.HtpasswdBcryptMinCost > bcrypt.MaxCost) {
+		msgs = append(msgs, fmt.Sprintf("htpasswd_bcrypt_min_cost (%d) must be 0 or between %d and %d",
+			o.HtpasswdBcryptMinCost, bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	return msgs
+}
+
+// validateHtpasswdLockout checks the lockout of htpasswd logins is
+// consistent
+func validateHtpasswdLockout(o options.HtpasswdLockout) []string {
+	msgs := []string{}
+	if o.Threshold < 0 {
+		msgs = append(msgs, "htpasswd_lockout_threshold must not be negative")
+	}
+	if o.Threshold <= 0 {
+		return msgs
+	}
+
+	if o.Duration <= 0 {
+		msgs = append(msgs, fmt.Sprintf("htpasswd_lockout_duration (%s) must be positive", o.Duration))
+	}
+	if o.MaxDuration < o.Duration {
+		msgs = append(msgs, fmt.Sprintf("htpasswd_lockout_max_duration (%s) must not be less than htpasswd_lockout_duration (%s)", o.MaxDuration, o.Duration))
+	}
+	return msgs
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Htpasswd", func() {
+	type validateHtpasswdTableInput struct {
+		opts       *options.Options
+		errStrings []string
+	}
+
+	DescribeTable("validateHtpasswd",
+		func(in validateHtpasswdTableInput) {
+			Expect(validateHtpasswd(in.opts)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with a htpasswd file", validateHtpasswdTableInput{
+			opts:       &options.Options{HtpasswdFile: "htpasswd.txt"},
+			errStrings: []string{},
+		}),
+		Entry("with a htpasswd environment variable and a minimum bcrypt cost", validateHtpasswdTableInput{
+			opts:       &options.Options{HtpasswdEnv: "HTPASSWD", HtpasswdBcryptMinCost: 12},
+			errStrings: []string{},
+		}),
+		Entry("with both a htpasswd file and environment variable", validateHtpasswdTableInput{
+			opts:       &options.Options{HtpasswdFile: "htpasswd.txt", HtpasswdEnv: "HTPASSWD"},
+			errStrings: []string{"htpasswd_file and htpasswd_env are mutually exclusive"},
+		}),
+		Entry("with a minimum bcrypt cost bcrypt does not support", validateHtpasswdTableInput{
+			opts:       &options.Options{HtpasswdBcryptMinCost: 32},
+			errStrings: []string{"htpasswd_bcrypt_min_cost (32) must be 0 or between 4 and 31"},
+		}),
+	)
+
+	type validateHtpasswdLockoutTableInput struct {
+		lockout    options.HtpasswdLockout
+		errStrings []string
+	}
+
+	DescribeTable("validateHtpasswdLockout",
+		func(in validateHtpasswdLockoutTableInput) {
+			Expect(validateHtpasswdLockout(in.lockout)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with lockouts disabled", validateHtpasswdLockoutTableInput{
+			lockout:    options.HtpasswdLockout{},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateHtpasswdLockoutTableInput{
+			lockout: options.HtpasswdLockout{
+				Threshold:   5,
+				Duration:    time.Minute,
+				MaxDuration: time.Hour,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a negative threshold", validateHtpasswdLockoutTableInput{
+			lockout:    options.HtpasswdLockout{Threshold: -1},
+			errStrings: []string{"htpasswd_lockout_threshold must not be negative"},
+		}),
+		Entry("with invalid durations", validateHtpasswdLockoutTableInput{
+			lockout: options.HtpasswdLockout{
+				Threshold:   5,
+				Duration:    time.Hour,
+				MaxDuration: time.Minute,
+			},
+			errStrings: []string{"htpasswd_lockout_max_duration (1m0s) must not be less than htpasswd_lockout_duration (1h0m0s)"},
+		}),
+		Entry("without a duration", validateHtpasswdLockoutTableInput{
+			lockout:    options.HtpasswdLockout{Threshold: 5},
+			errStrings: []string{"htpasswd_lockout_duration (0s) must be positive"},
+		}),
+	)
+})
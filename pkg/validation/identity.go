@@ -0,0 +1,25 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/identity"
+)
+
+// validateIdentityNormalization checks that the email domain aliases can be
+// parsed and that the subject emails file can be loaded
+func validateIdentityNormalization(o options.IdentityNormalization) []string {
+	msgs := []string{}
+	for _, alias := range o.EmailDomainAliases {
+		if _, err := identity.ParseEmailDomainAliases([]string{alias}); err != nil {
+			msgs = append(msgs, fmt.Sprintf("normalize_email_domain_aliases: %v", err))
+		}
+	}
+	if o.SubjectEmailsFile != "" {
+		if _, err := identity.NewNormalizer(options.IdentityNormalization{SubjectEmailsFile: o.SubjectEmailsFile}); err != nil {
+			msgs = append(msgs, fmt.Sprintf("normalize_subject_emails_file: %v", err))
+		}
+	}
+	return msgs
+}
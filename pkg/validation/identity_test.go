@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Identity Normalization", func() {
+	type validateIdentityNormalizationTableInput struct {
+		normalization options.IdentityNormalization
+		errStrings    []string
+	}
+
+	var subjectEmailsFile string
+
+	BeforeEach(func() {
+		f, err := os.CreateTemp("", "subject-emails-*.csv")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = f.WriteString("# subject,email\n00u1a2b3c,alice@example.com\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		subjectEmailsFile = f.Name()
+		DeferCleanup(os.Remove, subjectEmailsFile)
+	})
+
+	DescribeTable("validateIdentityNormalization",
+		func(in validateIdentityNormalizationTableInput) {
+			if in.normalization.SubjectEmailsFile == "valid" {
+				in.normalization.SubjectEmailsFile = subjectEmailsFile
+			}
+			Expect(validateIdentityNormalization(in.normalization)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with normalization disabled", validateIdentityNormalizationTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateIdentityNormalizationTableInput{
+			normalization: options.IdentityNormalization{
+				LowercaseEmail:     true,
+				EmailDomainAliases: []string{"old.example.com=example.com"},
+				SubjectEmailsFile:  "valid",
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid email domain aliases", validateIdentityNormalizationTableInput{
+			normalization: options.IdentityNormalization{
+				EmailDomainAliases: []string{"old.example.com", "old.example.com=@example.com"},
+			},
+			errStrings: []string{
+				"normalize_email_domain_aliases: invalid email domain alias \"old.example.com\": expected old.com=new.com",
+				"normalize_email_domain_aliases: invalid email domain alias \"old.example.com=@example.com\": expected old.com=new.com",
+			},
+		}),
+		Entry("with a missing subject emails file", validateIdentityNormalizationTableInput{
+			normalization: options.IdentityNormalization{
+				SubjectEmailsFile: "/does/not/exist.csv",
+			},
+			errStrings: []string{
+				"normalize_subject_emails_file: could not open subject emails file: open /does/not/exist.csv: no such file or directory",
+			},
+		}),
+	)
+})
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ldap"
+)
+
+// validateLDAP checks the directory server and user search of the LDAP
+// authorization are configured
+func validateLDAP(o options.LDAP) []string {
+	msgs := []string{}
+	if !o.Enabled() {
+		return msgs
+	}
+
+	if _, err := ldap.NewPool(ldap.Config{URL: o.URL, StartTLS: o.StartTLS}); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid ldap_url: %v", err))
+	}
+	if o.UserBaseDN == "" {
+		msgs = append(msgs, "ldap_user_base_dn is required when ldap_url is set")
+	}
+	if !strings.Contains(o.UserFilter, options.LDAPEmailPlaceholder) {
+		msgs = append(msgs, fmt.Sprintf("ldap_user_filter %q must contain %s", o.UserFilter, options.LDAPEmailPlaceholder))
+	} else if err := ldap.ValidateFilter(strings.ReplaceAll(o.UserFilter, options.LDAPEmailPlaceholder, "email")); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid ldap_user_filter: %v", err))
+	}
+	if len(o.Groups) > 0 && o.GroupAttribute == "" {
+		msgs = append(msgs, "ldap_group_attribute is required when ldap_group is set")
+	}
+	if o.PoolSize < 0 {
+		msgs = append(msgs, "ldap_pool_size must not be negative")
+	}
+	if o.Timeout <= 0 {
+		msgs = append(msgs, fmt.Sprintf("ldap_timeout (%s) must be positive", o.Timeout))
+	}
+	if o.CacheDuration < 0 {
+		msgs = append(msgs, fmt.Sprintf("ldap_cache_duration (%s) must not be negative", o.CacheDuration))
+	}
+	return msgs
+}
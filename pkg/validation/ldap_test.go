@@ -0,0 +1,110 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LDAP", func() {
+	type validateLDAPTableInput struct {
+		ldap       options.LDAP
+		errStrings []string
+	}
+
+	validLDAP := func() options.LDAP {
+		return options.LDAP{
+			URL:            "ldaps://ldap.example.com",
+			UserBaseDN:     "ou=people,dc=example,dc=com",
+			UserFilter:     "(|(mail={email})(userPrincipalName={email}))",
+			GroupAttribute: "memberOf",
+			Groups:         []string{"cn=admins,ou=groups,dc=example,dc=com"},
+			PoolSize:       4,
+			Timeout:        10 * time.Second,
+			CacheDuration:  5 * time.Minute,
+		}
+	}
+
+	DescribeTable("validateLDAP",
+		func(in validateLDAPTableInput) {
+			Expect(validateLDAP(in.ldap)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with LDAP disabled", validateLDAPTableInput{
+			ldap:       options.LDAP{},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateLDAPTableInput{
+			ldap:       validLDAP(),
+			errStrings: []string{},
+		}),
+		Entry("with an invalid URL", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.URL = "https://ldap.example.com"
+				return l
+			}(),
+			errStrings: []string{`invalid ldap_url: invalid LDAP URL "https://ldap.example.com": the scheme must be ldap or ldaps`},
+		}),
+		Entry("with StartTLS on an ldaps URL", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.StartTLS = true
+				return l
+			}(),
+			errStrings: []string{"invalid ldap_url: StartTLS cannot be used with an ldaps:// URL"},
+		}),
+		Entry("with a filter without the email", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.UserFilter = "(objectClass=person)"
+				return l
+			}(),
+			errStrings: []string{`ldap_user_filter "(objectClass=person)" must contain {email}`},
+		}),
+		Entry("with an invalid filter", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.UserFilter = "mail={email}"
+				return l
+			}(),
+			errStrings: []string{`invalid ldap_user_filter: invalid filter "mail=email": expected ( at "mail=email"`},
+		}),
+		Entry("without a base DN or group attribute", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.UserBaseDN = ""
+				l.GroupAttribute = ""
+				return l
+			}(),
+			errStrings: []string{
+				"ldap_user_base_dn is required when ldap_url is set",
+				"ldap_group_attribute is required when ldap_group is set",
+			},
+		}),
+		Entry("without groups", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.Groups = nil
+				l.GroupAttribute = ""
+				return l
+			}(),
+			errStrings: []string{},
+		}),
+		Entry("with invalid pool size and durations", validateLDAPTableInput{
+			ldap: func() options.LDAP {
+				l := validLDAP()
+				l.PoolSize = -1
+				l.Timeout = 0
+				l.CacheDuration = -time.Minute
+				return l
+			}(),
+			errStrings: []string{
+				"ldap_pool_size must not be negative",
+				"ldap_timeout (0s) must be positive",
+				"ldap_cache_duration (-1m0s) must not be negative",
+			},
+		}),
+	)
+})
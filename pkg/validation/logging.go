@@ -1,7 +1,14 @@
 package validation
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
@@ -51,6 +58,8 @@ func configureLogger(o options.Logging, msgs []string) []string {
 	logger.SetStandardTemplate(o.StandardFormat)
 	logger.SetAuthTemplate(o.AuthFormat)
 	logger.SetReqTemplate(o.RequestFormat)
+	msgs = append(msgs, configureRequestLogging(o)...)
+	msgs = append(msgs, configureLogPolicy(o)...)
 
 	logger.SetExcludePaths(o.ExcludePaths)
 
@@ -60,3 +69,212 @@ func configureLogger(o options.Logging, msgs []string) []string {
 
 	return msgs
 }
+
+// defaultSyslogTag is the tag of the request logs sent to syslog
+const defaultSyslogTag = "oauth2-proxy"
+
+// requestOutputParameters are the query parameters of the request log
+// destinations of each scheme
+var requestOutputParameters = map[string][]string{
+	"":           {"format"},
+	"file":       {"format", "max-size", "max-age", "max-backups", "compress"},
+	"syslog":     {"format", "tag"},
+	"syslog+udp": {"format", "tag"},
+	"syslog+tcp": {"format", "tag"},
+}
+
+// configureRequestLogging sets the formatter and the destinations of the
+// request logs
+func configureRequestLogging(o options.Logging) []string {
+	formatter, err := logger.NewRequestFormatter(o.RequestFormatter, o.RequestFormat)
+	if err != nil {
+		return []string{fmt.Sprintf("request_logging_formatter %q is invalid, expected one of %s", o.RequestFormatter, strings.Join(logger.RequestFormatterNames(), ", "))}
+	}
+
+	msgs := []string{}
+	outputs := []logger.RequestOutput{}
+	for _, destination := range o.RequestDestinations {
+		output, err := newRequestOutput(destination, o)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("request_logging_destinations entry %q: %v", destination, err))
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	if len(msgs) > 0 {
+		for _, output := range outputs {
+			if closer, ok := output.Writer.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+		return msgs
+	}
+
+	logger.SetReqFormatter(formatter)
+	logger.SetReqOutputs(outputs)
+	return msgs
+}
+
+// newRequestOutput creates the destination of the request logs of a
+// request_logging_destinations entry: stdout, stderr, file://<path>,
+// syslog:// or syslog+<udp|tcp>://<host>:<port>. The entry may choose its
+// formatter with a format query parameter.
+func newRequestOutput(destination string, o options.Logging) (logger.RequestOutput, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return logger.RequestOutput{}, err
+	}
+	parameters, ok := requestOutputParameters[u.Scheme]
+	if !ok {
+		return logger.RequestOutput{}, fmt.Errorf("unknown destination scheme %q", u.Scheme)
+	}
+	query := u.Query()
+	for name := range query {
+		if !slices.Contains(parameters, name) {
+			return logger.RequestOutput{}, fmt.Errorf("unknown parameter %q, expected one of %s", name, strings.Join(parameters, ", "))
+		}
+	}
+
+	formatterName := o.RequestFormatter
+	if query.Has("format") {
+		formatterName = query.Get("format")
+	}
+	formatter, err := logger.NewRequestFormatter(formatterName, o.RequestFormat)
+	if err != nil {
+		return logger.RequestOutput{}, err
+	}
+
+	var writer io.Writer
+	switch u.Scheme {
+	case "":
+		switch u.Path {
+		case "stdout":
+			// The standard output must not be closed with the destination
+			writer = struct{ io.Writer }{os.Stdout}
+		case "stderr":
+			writer = struct{ io.Writer }{os.Stderr}
+		default:
+			return logger.RequestOutput{}, errors.New("unknown destination, expected stdout, stderr, file://<path>, syslog:// or syslog+<udp|tcp>://<host>:<port>")
+		}
+	case "file":
+		writer, err = newRequestLogFile(u.Host+u.Path, query, o)
+	case "syslog", "syslog+udp", "syslog+tcp":
+		writer, err = newRequestLogSyslog(u, query)
+	}
+	if err != nil {
+		return logger.RequestOutput{}, err
+	}
+	return logger.RequestOutput{Formatter: formatter, Writer: writer}, nil
+}
+
+// newRequestLogFile creates a log file rotated with the max-size, max-age,
+// max-backups and compress query parameters, which default to the rotation
+// options of the log file
+func newRequestLogFile(filename string, query url.Values, o options.Logging) (io.Writer, error) {
+	if filename == "" {
+		return nil, errors.New("file destinations require a path")
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write to log file: %v", err)
+	}
+	file.Close()
+
+	rotation := o.File
+	for name, value := range map[string]*int{
+		"max-size":    &rotation.MaxSize,
+		"max-age":     &rotation.MaxAge,
+		"max-backups": &rotation.MaxBackups,
+	} {
+		if !query.Has(name) {
+			continue
+		}
+		if *value, err = strconv.Atoi(query.Get(name)); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	if query.Has("compress") {
+		if rotation.Compress, err = strconv.ParseBool(query.Get("compress")); err != nil {
+			return nil, fmt.Errorf("invalid compress: %v", err)
+		}
+	}
+
+	return &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    rotation.MaxSize, // megabytes
+		MaxAge:     rotation.MaxAge,  // days
+		MaxBackups: rotation.MaxBackups,
+		LocalTime:  o.LocalTime,
+		Compress:   rotation.Compress,
+	}, nil
+}
+
+// newRequestLogSyslog connects to the local syslog server, or to the syslog
+// server of the URL, tagging the logs with the tag query parameter
+func newRequestLogSyslog(u *url.URL, query url.Values) (io.Writer, error) {
+	network, address := "", ""
+	if u.Scheme != "syslog" || u.Host != "" {
+		network = strings.TrimPrefix(strings.TrimPrefix(u.Scheme, "syslog"), "+")
+		if network == "" {
+			network = "udp"
+		}
+		address = u.Host
+		if u.Port() == "" {
+			return nil, errors.New("syslog servers require a host and port")
+		}
+	}
+
+	tag := defaultSyslogTag
+	if query.Has("tag") {
+		tag = query.Get("tag")
+	}
+	return logger.NewSyslogWriter(network, address, tag)
+}
+
+// configureLogPolicy sets the policy redacting the sensitive fields of the log
+// lines and sampling the request logs
+func configureLogPolicy(o options.Logging) []string {
+	msgs := []string{}
+	policy := &logger.Policy{
+		RedactTokens: o.RedactTokens,
+		Emails:       logger.EmailRedaction(o.RedactEmails),
+		HashKey:      []byte(o.HashKey),
+		QueryParams:  o.RedactQueryParams,
+		SampleRates:  map[string]float64{},
+	}
+
+	switch policy.Emails {
+	case logger.EmailRedactionNone, logger.EmailRedactionRedact:
+		if o.HashKey != "" {
+			msgs = append(msgs, "logging_hash_key requires logging_redact_emails to be hash")
+		}
+	case logger.EmailRedactionHash:
+	default:
+		msgs = append(msgs, fmt.Sprintf("logging_redact_emails %q is invalid, expected redact or hash", o.RedactEmails))
+	}
+
+	for _, param := range o.RedactQueryParams {
+		if param == "" {
+			msgs = append(msgs, "logging_redact_query_params entries must not be empty")
+		}
+	}
+
+	for _, sample := range o.RequestSamples {
+		prefix, rate, ok := strings.Cut(sample, "=")
+		value, err := strconv.ParseFloat(rate, 64)
+		if !ok || !strings.HasPrefix(prefix, "/") || err != nil || value < 0 || value > 1 {
+			msgs = append(msgs, fmt.Sprintf("request_logging_samples entry %q must be <path prefix>=<rate>, with a rate between 0 and 1", sample))
+			continue
+		}
+		policy.SampleRates[prefix] = value
+	}
+
+	if len(msgs) > 0 {
+		return msgs
+	}
+	if !policy.RedactTokens && policy.Emails == logger.EmailRedactionNone && len(policy.QueryParams) == 0 && len(policy.SampleRates) == 0 {
+		policy = nil
+	}
+	logger.SetPolicy(policy)
+	return msgs
+}
@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"path/filepath"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logging", func() {
+	AfterEach(func() {
+		logger.SetReqOutputs(nil)
+		logger.SetReqTemplate(logger.DefaultRequestLoggingFormat)
+		logger.SetPolicy(nil)
+	})
+
+	type configureRequestLoggingTableInput struct {
+		formatter    string
+		destinations func(dir string) []string
+		errStrings   []interface{}
+	}
+
+	DescribeTable("configureRequestLogging",
+		func(in configureRequestLoggingTableInput) {
+			o := options.NewOptions().Logging
+			if in.formatter != "" {
+				o.RequestFormatter = in.formatter
+			}
+			if in.destinations != nil {
+				o.RequestDestinations = in.destinations(GinkgoT().TempDir())
+			}
+			Expect(configureRequestLogging(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with the default options", configureRequestLoggingTableInput{
+			errStrings: []interface{}{},
+		}),
+		Entry("with valid destinations", configureRequestLoggingTableInput{
+			formatter: "json",
+			destinations: func(dir string) []string {
+				return []string{
+					"stdout",
+					"stderr?format=combined",
+					"file://" + filepath.Join(dir, "access.log") + "?max-size=10&max-backups=3&compress=true",
+					"syslog+udp://127.0.0.1:514?tag=proxy&format=template",
+				}
+			},
+			errStrings: []interface{}{},
+		}),
+		Entry("with an unknown formatter", configureRequestLoggingTableInput{
+			formatter:  "xml",
+			errStrings: []interface{}{"request_logging_formatter \"xml\" is invalid, expected one of combined, json, template"},
+		}),
+		Entry("with invalid destinations", configureRequestLoggingTableInput{
+			destinations: func(dir string) []string {
+				return []string{
+					"stdin",
+					"kafka://localhost:9092",
+					"stdout?format=xml",
+					"stdout?tag=proxy",
+					"file://" + filepath.Join(dir, "access.log") + "?max-size=large",
+					"file://" + filepath.Join(dir, "missing", "access.log"),
+					"syslog+tcp://localhost",
+				}
+			},
+			errStrings: []interface{}{
+				"request_logging_destinations entry \"stdin\": unknown destination, expected stdout, stderr, file://<path>, syslog:// or syslog+<udp|tcp>://<host>:<port>",
+				"request_logging_destinations entry \"kafka://localhost:9092\": unknown destination scheme \"kafka\"",
+				"request_logging_destinations entry \"stdout?format=xml\": unknown request formatter \"xml\"",
+				"request_logging_destinations entry \"stdout?tag=proxy\": unknown parameter \"tag\", expected one of format",
+				ContainSubstring("invalid max-size: strconv.Atoi: parsing \"large\": invalid syntax"),
+				ContainSubstring("unable to write to log file: open"),
+				"request_logging_destinations entry \"syslog+tcp://localhost\": syslog servers require a host and port",
+			},
+		}),
+	)
+
+	type configureLogPolicyTableInput struct {
+		options    func(*options.Logging)
+		errStrings []string
+	}
+
+	DescribeTable("configureLogPolicy",
+		func(in configureLogPolicyTableInput) {
+			o := options.NewOptions().Logging
+			if in.options != nil {
+				in.options(&o)
+			}
+			Expect(configureLogPolicy(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with the default options", configureLogPolicyTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with a valid policy", configureLogPolicyTableInput{
+			options: func(o *options.Logging) {
+				o.RedactTokens = true
+				o.RedactEmails = "hash"
+				o.HashKey = "secret"
+				o.RedactQueryParams = []string{"code"}
+				o.RequestSamples = []string{"/static=0.1", "/ping=0"}
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an unknown email redaction", configureLogPolicyTableInput{
+			options: func(o *options.Logging) {
+				o.RedactEmails = "mask"
+			},
+			errStrings: []string{"logging_redact_emails \"mask\" is invalid, expected redact or hash"},
+		}),
+		Entry("with a hash key without hashing", configureLogPolicyTableInput{
+			options: func(o *options.Logging) {
+				o.RedactEmails = "redact"
+				o.HashKey = "secret"
+			},
+			errStrings: []string{"logging_hash_key requires logging_redact_emails to be hash"},
+		}),
+		Entry("with invalid samples and query parameters", configureLogPolicyTableInput{
+			options: func(o *options.Logging) {
+				o.RedactQueryParams = []string{""}
+				o.RequestSamples = []string{"/static", "static=0.5", "/static=2", "/static=half"}
+			},
+			errStrings: []string{
+				"logging_redact_query_params entries must not be empty",
+				"request_logging_samples entry \"/static\" must be <path prefix>=<rate>, with a rate between 0 and 1",
+				"request_logging_samples entry \"static=0.5\" must be <path prefix>=<rate>, with a rate between 0 and 1",
+				"request_logging_samples entry \"/static=2\" must be <path prefix>=<rate>, with a rate between 0 and 1",
+				"request_logging_samples entry \"/static=half\" must be <path prefix>=<rate>, with a rate between 0 and 1",
+			},
+		}),
+	)
+})
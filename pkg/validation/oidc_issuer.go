@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateOIDCIssuer checks the OIDC issuer options are consistent
+func validateOIDCIssuer(o options.OIDCIssuer) []string {
+	msgs := []string{}
+	if !o.Enabled() {
+		if len(o.Clients) > 0 {
+			msgs = append(msgs, "oidc_idp_clients require oidc_idp_signing_key_file to be set")
+		}
+		return msgs
+	}
+
+	if len(o.Clients) == 0 {
+		msgs = append(msgs, "oidc_idp_signing_key_file requires at least one oidc_idp_clients entry")
+	}
+	for _, entry := range o.Clients {
+		client, err := options.ParseOIDCIssuerClient(entry)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+			continue
+		}
+		for _, redirectURL := range client.RedirectURLs {
+			if !isAbsoluteHTTPURL(redirectURL) {
+				msgs = append(msgs, fmt.Sprintf("oidc_idp_clients entry %q has a redirect URI %q that is not an absolute http or https URL", client.ID, redirectURL))
+			}
+		}
+	}
+
+	if o.URL != "" && !isAbsoluteHTTPURL(o.URL) {
+		msgs = append(msgs, fmt.Sprintf("oidc_idp_issuer_url %q must be an absolute http or https URL", o.URL))
+	}
+	if o.TokenExpire <= 0 {
+		msgs = append(msgs, fmt.Sprintf("oidc_idp_token_expire (%s) must be positive", o.TokenExpire))
+	}
+	return msgs
+}
+
+func isAbsoluteHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OIDC Issuer", func() {
+	type validateOIDCIssuerTableInput struct {
+		issuer     options.OIDCIssuer
+		errStrings []string
+	}
+
+	DescribeTable("validateOIDCIssuer",
+		func(in validateOIDCIssuerTableInput) {
+			Expect(validateOIDCIssuer(in.issuer)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with the issuer disabled", validateOIDCIssuerTableInput{
+			issuer:     options.OIDCIssuer{TokenExpire: time.Hour},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateOIDCIssuerTableInput{
+			issuer: options.OIDCIssuer{
+				SigningKeyFile: "/etc/oauth2-proxy/issuer.pem",
+				URL:            "https://auth.example.com/oauth2/oidc",
+				Clients: []string{
+					"wiki:wiki-secret:https://wiki.example.com/oidc/callback",
+					"chat:chat-secret:https://chat.example.com/callback,https://chat.example.net/callback",
+				},
+				TokenExpire: time.Hour,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with clients but no signing key", validateOIDCIssuerTableInput{
+			issuer: options.OIDCIssuer{
+				Clients:     []string{"wiki:wiki-secret:https://wiki.example.com/oidc/callback"},
+				TokenExpire: time.Hour,
+			},
+			errStrings: []string{"oidc_idp_clients require oidc_idp_signing_key_file to be set"},
+		}),
+		Entry("with no clients", validateOIDCIssuerTableInput{
+			issuer: options.OIDCIssuer{
+				SigningKeyFile: "/etc/oauth2-proxy/issuer.pem",
+				TokenExpire:    time.Hour,
+			},
+			errStrings: []string{
+				"oidc_idp_signing_key_file requires at least one oidc_idp_clients entry",
+			},
+		}),
+		Entry("with invalid clients, URLs and expiry", validateOIDCIssuerTableInput{
+			issuer: options.OIDCIssuer{
+				SigningKeyFile: "/etc/oauth2-proxy/issuer.pem",
+				URL:            "/oauth2/oidc",
+				Clients: []string{
+					"wiki:wiki-secret",
+					"chat:chat-secret:https://chat.example.com/callback,chat.example.net/callback",
+				},
+			},
+			errStrings: []string{
+				"invalid oidc_idp_clients entry \"wiki\", expected client_id:client_secret:redirect_uri[,redirect_uri...]",
+				"oidc_idp_clients entry \"chat\" has a redirect URI \"chat.example.net/callback\" that is not an absolute http or https URL",
+				"oidc_idp_issuer_url \"/oauth2/oidc\" must be an absolute http or https URL",
+				"oidc_idp_token_expire (0s) must be positive",
+			},
+		}),
+	)
+})
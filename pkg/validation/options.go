@@ -10,8 +10,10 @@ import (
 
 	"github.com/mbland/hmacauth"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
 )
@@ -19,13 +21,40 @@ import (
 // Validate checks that required options are set and validates those that they
 // are of the correct format
 func Validate(o *options.Options) error {
-	msgs := validateCookie(o.Cookie)
+	msgs := validateFIPS(o)
+	memory.SetLowMemory(o.LowMemory)
+	msgs = append(msgs, loadCookieSecretRef(&o.Cookie)...)
+	msgs = append(msgs, validateCookie(o.Cookie)...)
+	msgs = append(msgs, configureCookieKeys(&o.Cookie)...)
 	msgs = append(msgs, validateSessionCookieMinimal(o)...)
+	msgs = append(msgs, validateSessionFailover(o)...)
+	msgs = append(msgs, validateSessionRefresh(o)...)
+	msgs = append(msgs, validateSessionReaper(o)...)
+	msgs = append(msgs, validateSessionArchive(o.Session.Archive)...)
+	msgs = append(msgs, validateRedisSessionEncoding(o.Session.Redis)...)
+	msgs = append(msgs, validateRedisReplicaReads(o.Session.Redis)...)
+	msgs = append(msgs, validateRedisSessionCache(o.Session.Redis)...)
 	msgs = append(msgs, validateRedisSessionStore(o)...)
+	msgs = append(msgs, validateMemcachedSessionStore(o)...)
+	msgs = append(msgs, validatePostgresSessionStore(o)...)
+	msgs = append(msgs, validateSessionKMS(o)...)
 	msgs = append(msgs, prefixValues("injectRequestHeaders: ", validateHeaders(o.InjectRequestHeaders)...)...)
 	msgs = append(msgs, prefixValues("injectResponseHeaders: ", validateHeaders(o.InjectResponseHeaders)...)...)
 	msgs = append(msgs, validateProviders(o)...)
 	msgs = append(msgs, validateAPIRoutes(o)...)
+	msgs = append(msgs, validateChaos(o.Chaos)...)
+	msgs = append(msgs, validateHandoff(o.Handoff)...)
+	msgs = append(msgs, validateOIDCIssuer(o.OIDCIssuer)...)
+	msgs = append(msgs, validateRateLimit(o)...)
+	msgs = append(msgs, validateHtpasswd(o)...)
+	msgs = append(msgs, validateHtpasswdLockout(o.HtpasswdLockout)...)
+	msgs = append(msgs, validateIdentityNormalization(o.IdentityNormalization)...)
+	msgs = append(msgs, validateLDAP(o.LDAP)...)
+	msgs = append(msgs, validateAuthenticatedEmails(o)...)
+	msgs = append(msgs, validateServerAuth(o)...)
+	msgs = append(msgs, validateAdminServer(o)...)
+	msgs = append(msgs, validateListeners(o)...)
+	msgs = append(msgs, validateACME(o)...)
 	msgs = configureLogger(o.Logging, msgs)
 	msgs = parseSignatureKey(o, msgs)
 
@@ -49,7 +78,7 @@ func Validate(o *options.Options) error {
 		}
 	}
 
-	if o.AuthenticatedEmailsFile == "" && len(o.EmailDomains) == 0 && o.HtpasswdFile == "" {
+	if o.AuthenticatedEmailsFile == "" && o.AuthenticatedEmails.URL == "" && len(o.EmailDomains) == 0 && !o.HtpasswdEnabled() && !o.LDAP.Enabled() {
 		msgs = append(msgs, "missing setting for email validation: email-domain or authenticated-emails-file required."+
 			"\n      use email-domain=* to authorize all email addresses")
 	}
@@ -80,13 +109,18 @@ func Validate(o *options.Options) error {
 		logger.Print("WARNING: no explicit redirect URL: redirects will default to insecure HTTP")
 	}
 
+	msgs = append(msgs, validateRedirectURLs("extra_redirect_urls", o.ExtraRedirectURLs)...)
 	msgs = append(msgs, validateUpstreams(o.UpstreamServers)...)
+	msgs = append(msgs, validateVirtualHosts(o)...)
 
 	if o.ReverseProxy {
-		parser, err := ip.GetRealClientIPParser(o.RealClientIPHeader)
+		parser, err := ip.GetRealClientIPParser(o.RealClientIPHeader, o.RealClientIPTrustedHops)
 		if err != nil {
 			msgs = append(msgs, fmt.Sprintf("real_client_ip_header (%s) not accepted parameter value: %v", o.RealClientIPHeader, err))
 		}
+		if o.RealClientIPTrustedHops < 0 {
+			msgs = append(msgs, fmt.Sprintf("real_client_ip_trusted_hops (%d) must not be negative", o.RealClientIPTrustedHops))
+		}
 		o.SetRealClientIPParser(parser)
 
 		// Allow the logger to get client IPs
@@ -99,12 +133,20 @@ func Validate(o *options.Options) error {
 	msgs = append(msgs, validateAllowlists(o)...)
 
 	if len(msgs) != 0 {
-		return fmt.Errorf("invalid configuration:\n  %s",
-			strings.Join(msgs, "\n  "))
+		return &Error{Messages: msgs}
 	}
 	return nil
 }
 
+// Error is returned by Validate with the messages of each invalid option
+type Error struct {
+	Messages []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(e.Messages, "\n  "))
+}
+
 func parseSignatureKey(o *options.Options, msgs []string) []string {
 	if o.SignatureKey == "" {
 		return msgs
@@ -152,6 +194,9 @@ func newVerifierFromJwtIssuer(audienceClaims []string, extraAudiences []string,
 		ExtraAudiences: extraAudiences,
 		IssuerURL:      jwtIssuer.issuerURI,
 	}
+	if encryption.FIPSMode() {
+		pvOpts.SupportedSigningAlgs = encryption.FIPSApprovedSigningAlgs
+	}
 
 	pv, err := internaloidc.NewProviderVerifier(context.TODO(), pvOpts)
 	if err != nil {
@@ -174,6 +219,19 @@ type jwtIssuer struct {
 	audience  string
 }
 
+// validateRedirectURLs checks that each of the redirect URLs that are
+// selected by the request host is an absolute http(s) URL
+func validateRedirectURLs(name string, redirectURLs []string) []string {
+	msgs := []string{}
+	for _, redirectURL := range redirectURLs {
+		parsed, err := url.Parse(redirectURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			msgs = append(msgs, fmt.Sprintf("%s: %q must be an absolute http(s) URL", name, redirectURL))
+		}
+	}
+	return msgs
+}
+
 func parseURL(toParse string, urltype string, msgs []string) (*url.URL, []string) {
 	parsed, err := url.Parse(toParse)
 	if err != nil {
@@ -81,6 +81,22 @@ func TestGoogleGroupInvalidFile(t *testing.T) {
 	assert.Equal(t, expected, err.Error())
 }
 
+func TestGoogleGroupCloudIdentity(t *testing.T) {
+	o := testOptions()
+	o.Providers[0].GoogleConfig.Groups = []string{"googlegroup"}
+	o.Providers[0].GoogleConfig.UseCloudIdentity = true
+	assert.Equal(t, nil, Validate(o))
+
+	o.Providers[0].GoogleConfig.AdminEmail = "admin@example.com"
+	err := Validate(o)
+	assert.NotEqual(t, nil, err)
+
+	expected := errorMsg([]string{
+		"invalid setting: google-use-cloud-identity can't be used with google-admin-email, google-service-account-json or google-use-application-default-credentials",
+	})
+	assert.Equal(t, expected, err.Error())
+}
+
 func TestInitializedOptions(t *testing.T) {
 	o := testOptions()
 	assert.Equal(t, nil, Validate(o))
@@ -97,6 +113,15 @@ func TestRedirectURL(t *testing.T) {
 	assert.Equal(t, expected, o.GetRedirectURL())
 }
 
+func TestExtraRedirectURLs(t *testing.T) {
+	o := testOptions()
+	o.ExtraRedirectURLs = []string{"https://*.example.com/oauth2/callback", "/oauth2/callback"}
+	err := Validate(o)
+	assert.NotEqual(t, nil, err)
+	assert.Contains(t, err.Error(), `extra_redirect_urls: "/oauth2/callback" must be an absolute http(s) URL`)
+	assert.NotContains(t, err.Error(), "*.example.com")
+}
+
 func TestCookieRefreshMustBeLessThanCookieExpire(t *testing.T) {
 	o := testOptions()
 	assert.Equal(t, nil, Validate(o))
@@ -178,17 +203,25 @@ func TestRealClientIPHeader(t *testing.T) {
 	assert.Equal(t, nil, Validate(o))
 	assert.NotNil(t, o.GetRealClientIPParser())
 
-	// Ensure unknown header format process an error.
+	// Ensure the Forwarded header and trusted hops work.
 	o = testOptions()
 	o.ReverseProxy = true
 	o.RealClientIPHeader = "Forwarded"
+	o.RealClientIPTrustedHops = 2
+	assert.Equal(t, nil, Validate(o))
+	assert.NotNil(t, o.GetRealClientIPParser())
+
+	// Ensure a negative number of trusted hops produces an error.
+	o = testOptions()
+	o.ReverseProxy = true
+	o.RealClientIPHeader = "X-Forwarded-For"
+	o.RealClientIPTrustedHops = -1
 	err := Validate(o)
 	assert.NotEqual(t, nil, err)
 	expected := errorMsg([]string{
-		"real_client_ip_header (Forwarded) not accepted parameter value: the http header key (Forwarded) is either invalid or unsupported",
+		"real_client_ip_trusted_hops (-1) must not be negative",
 	})
 	assert.Equal(t, expected, err.Error())
-	assert.Nil(t, o.GetRealClientIPParser())
 
 	// Ensure invalid header format produces an error.
 	o = testOptions()
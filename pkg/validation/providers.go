@@ -3,10 +3,14 @@ package validation
 import (
 	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 )
 
+// azureTenantIDRegex matches the GUID of an Azure tenant
+var azureTenantIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 // validateProviders is the initial validation migration for multiple providrers
 // It currently includes only logic that can verify the providers one by one and does not break the valdation pipe
 func validateProviders(o *options.Options) []string {
@@ -46,11 +50,20 @@ func validateProvider(provider options.Provider, providerIDs map[string]struct{}
 		msgs = append(msgs, "provider missing setting: client-id")
 	}
 
-	// login.gov uses a signed JWT to authenticate, not a client-secret
-	if provider.Type != "login.gov" {
-		if provider.ClientSecret == "" && provider.ClientSecretFile == "" {
+	// login.gov uses a signed JWT to authenticate, not a client-secret, and
+	// SAML identity providers post signed assertions rather than being called
+	if provider.Type != "login.gov" && provider.Type != options.SAMLProvider {
+		if provider.ClientSecret == "" && provider.ClientSecretFile == "" && provider.ClientSecretRef == "" {
 			msgs = append(msgs, "missing setting: client-secret or client-secret-file")
 		}
+		if provider.ClientSecretFile != "" && provider.ClientSecretRef != "" {
+			msgs = append(msgs, "client-secret-file and client-secret-ref are mutually exclusive")
+		}
+		if provider.ClientSecret == "" && provider.ClientSecretRef != "" {
+			if msg := validateSecretSourceRef(provider.ClientSecretRef); msg != "" {
+				msgs = append(msgs, "could not load client secret: "+msg)
+			}
+		}
 		if provider.ClientSecret == "" && provider.ClientSecretFile != "" {
 			_, err := os.ReadFile(provider.ClientSecretFile)
 			if err != nil {
@@ -59,7 +72,41 @@ func validateProvider(provider options.Provider, providerIDs map[string]struct{}
 		}
 	}
 
+	msgs = append(msgs, validateRedirectURLs(fmt.Sprintf("provider %q redirectURLs", provider.ID), provider.RedirectURLs)...)
 	msgs = append(msgs, validateGoogleConfig(provider)...)
+	msgs = append(msgs, validateGitHubConfig(provider)...)
+	msgs = append(msgs, validateAzureConfig(provider)...)
+	msgs = append(msgs, validateOIDCConfig(provider)...)
+	msgs = append(msgs, validateSAMLConfig(provider)...)
+
+	return msgs
+}
+
+func validateOIDCConfig(provider options.Provider) []string {
+	msgs := []string{}
+
+	switch provider.OIDCConfig.UserInfoPrecedence {
+	case "", options.OIDCUserInfoPrecedenceIDToken, options.OIDCUserInfoPrecedenceUserInfo:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid setting: oidc-userinfo-precedence must be %q or %q, got %q",
+			options.OIDCUserInfoPrecedenceIDToken, options.OIDCUserInfoPrecedenceUserInfo, provider.OIDCConfig.UserInfoPrecedence))
+	}
+
+	return msgs
+}
+
+func validateSAMLConfig(provider options.Provider) []string {
+	msgs := []string{}
+
+	if provider.Type != options.SAMLProvider {
+		return msgs
+	}
+	if provider.LoginURL == "" {
+		msgs = append(msgs, "missing setting: login-url, the single sign-on endpoint of the SAML identity provider")
+	}
+	if len(provider.SAMLConfig.IdPCertificateFiles) == 0 {
+		msgs = append(msgs, "missing setting: saml-idp-certificate-file")
+	}
 
 	return msgs
 }
@@ -71,14 +118,24 @@ func validateGoogleConfig(provider options.Provider) []string {
 	hasAdminEmail := provider.GoogleConfig.AdminEmail != ""
 	hasSAJSON := provider.GoogleConfig.ServiceAccountJSON != ""
 	useADC := provider.GoogleConfig.UseApplicationDefaultCredentials
+	useCloudIdentity := provider.GoogleConfig.UseCloudIdentity
 
-	if !hasGoogleGroups && !hasAdminEmail && !hasSAJSON && !useADC {
+	if !hasGoogleGroups && !hasAdminEmail && !hasSAJSON && !useADC && !useCloudIdentity {
 		return msgs
 	}
 
 	if !hasGoogleGroups {
 		msgs = append(msgs, "missing setting: google-group")
 	}
+
+	// Cloud Identity uses the Application Default Credentials without
+	// impersonating an admin
+	if useCloudIdentity {
+		if hasAdminEmail || hasSAJSON || useADC {
+			msgs = append(msgs, "invalid setting: google-use-cloud-identity can't be used with google-admin-email, google-service-account-json or google-use-application-default-credentials")
+		}
+		return msgs
+	}
 	if !hasAdminEmail {
 		msgs = append(msgs, "missing setting: google-admin-email")
 	}
@@ -96,3 +153,37 @@ func validateGoogleConfig(provider options.Provider) []string {
 
 	return msgs
 }
+
+func validateGitHubConfig(provider options.Provider) []string {
+	msgs := []string{}
+
+	switch provider.GitHubConfig.OrgRole {
+	case "":
+		return msgs
+	case "admin", "member":
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid setting: github-org-role %q must be admin or member", provider.GitHubConfig.OrgRole))
+	}
+
+	if provider.GitHubConfig.Org == "" {
+		msgs = append(msgs, "missing setting: github-org is required with github-org-role")
+	}
+
+	return msgs
+}
+
+func validateAzureConfig(provider options.Provider) []string {
+	msgs := []string{}
+
+	for _, tenant := range provider.AzureConfig.AllowedTenants {
+		switch tenant {
+		case "*", "organizations", "consumers":
+		default:
+			if !azureTenantIDRegex.MatchString(tenant) {
+				msgs = append(msgs, fmt.Sprintf("invalid setting: azure-allowed-tenant %q must be a tenant ID, organizations, consumers or *", tenant))
+			}
+		}
+	}
+
+	return msgs
+}
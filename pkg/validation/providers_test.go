@@ -79,5 +79,119 @@ var _ = Describe("Providers", func() {
 			},
 			errStrings: []string{skipButtonAndMultipleProvidersMsg},
 		}),
+		Entry("with a relative redirect URL", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						RedirectURLs: []string{"https://app.example.com/oauth2/callback", "/oauth2/callback"},
+					},
+				},
+			},
+			errStrings: []string{`provider "ProviderID" redirectURLs: "/oauth2/callback" must be an absolute http(s) URL`},
+		}),
+		Entry("with a GitHub org role", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						GitHubConfig: options.GitHubOptions{Org: "org", OrgRole: "admin"},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an invalid GitHub org role and no org", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						GitHubConfig: options.GitHubOptions{OrgRole: "owner"},
+					},
+				},
+			},
+			errStrings: []string{
+				`invalid setting: github-org-role "owner" must be admin or member`,
+				"missing setting: github-org is required with github-org-role",
+			},
+		}),
+		Entry("with Azure allowed tenants", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						AzureConfig:  options.AzureOptions{AllowedTenants: []string{"9188040d-6c67-4c5b-b112-36a304b66dad", "organizations"}},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an invalid Azure allowed tenant", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						AzureConfig:  options.AzureOptions{AllowedTenants: []string{"contoso.onmicrosoft.com"}},
+					},
+				},
+			},
+			errStrings: []string{
+				`invalid setting: azure-allowed-tenant "contoso.onmicrosoft.com" must be a tenant ID, organizations, consumers or *`,
+			},
+		}),
+		Entry("with an invalid userinfo precedence", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						ID:           "ProviderID",
+						ClientID:     "ClientID",
+						ClientSecret: "ClientSecret",
+						OIDCConfig:   options.OIDCOptions{UserInfoEnrichment: true, UserInfoPrecedence: "profile"},
+					},
+				},
+			},
+			errStrings: []string{
+				`invalid setting: oidc-userinfo-precedence must be "idToken" or "userInfo", got "profile"`,
+			},
+		}),
+		Entry("with a SAML provider", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						Type:       options.SAMLProvider,
+						ID:         "ProviderID",
+						ClientID:   "https://proxy.example.com/",
+						LoginURL:   "https://idp.example.com/sso",
+						SAMLConfig: options.SAMLOptions{IdPCertificateFiles: []string{"/etc/idp.pem"}},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a SAML provider without a login URL or certificate", &validateProvidersTableInput{
+			options: &options.Options{
+				Providers: options.Providers{
+					{
+						Type:     options.SAMLProvider,
+						ID:       "ProviderID",
+						ClientID: "https://proxy.example.com/",
+					},
+				},
+			},
+			errStrings: []string{
+				"missing setting: login-url, the single sign-on endpoint of the SAML identity provider",
+				"missing setting: saml-idp-certificate-file",
+			},
+		}),
 	)
 })
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ratelimit"
+)
+
+// validateRateLimit checks the rate limits and the store they are counted
+// in are consistent
+func validateRateLimit(o *options.Options) []string {
+	msgs := []string{}
+	if o.RateLimit.AuthRequests < 0 {
+		msgs = append(msgs, "rate_limit_auth_requests must not be negative")
+	}
+	if o.RateLimit.ProxyRequests < 0 {
+		msgs = append(msgs, "rate_limit_proxy_requests must not be negative")
+	}
+	if !o.RateLimit.Enabled() {
+		return msgs
+	}
+
+	if o.RateLimit.Period <= 0 {
+		msgs = append(msgs, fmt.Sprintf("rate_limit_period (%s) must be positive", o.RateLimit.Period))
+	}
+	if _, err := ratelimit.NewKeyFunc(o.RateLimit.Key, nil); err != nil {
+		msgs = append(msgs, fmt.Sprintf("invalid rate_limit_key: %v", err))
+	}
+
+	switch o.RateLimit.Store {
+	case "", options.RateLimitStoreMemory:
+	case options.RateLimitStoreRedis:
+		redis := o.Session.Redis
+		if redis.ConnectionURL == "" && !redis.UseSentinel && !redis.UseCluster {
+			msgs = append(msgs, "rate_limit_store \"redis\" requires the redis connection options of the session store to be set")
+		}
+	default:
+		msgs = append(msgs, fmt.Sprintf("rate_limit_store %q must be one of: %s, %s",
+			o.RateLimit.Store, options.RateLimitStoreMemory, options.RateLimitStoreRedis))
+	}
+	return msgs
+}
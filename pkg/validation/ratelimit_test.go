@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate Limit", func() {
+	type validateRateLimitTableInput struct {
+		rateLimit  options.RateLimit
+		redis      options.RedisStoreOptions
+		errStrings []string
+	}
+
+	DescribeTable("validateRateLimit",
+		func(in validateRateLimitTableInput) {
+			opts := &options.Options{RateLimit: in.rateLimit}
+			opts.Session.Redis = in.redis
+			Expect(validateRateLimit(opts)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with rate limits disabled", validateRateLimitTableInput{
+			rateLimit:  options.RateLimit{Key: "unknown"},
+			errStrings: []string{},
+		}),
+		Entry("with a valid configuration", validateRateLimitTableInput{
+			rateLimit: options.RateLimit{
+				AuthRequests: 10,
+				Period:       time.Minute,
+				Key:          "header:X-Api-Key",
+				Store:        options.RateLimitStoreMemory,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a redis store", validateRateLimitTableInput{
+			rateLimit: options.RateLimit{
+				ProxyRequests: 100,
+				Period:        time.Second,
+				Key:           options.RateLimitKeyUser,
+				Store:         options.RateLimitStoreRedis,
+			},
+			redis:      options.RedisStoreOptions{ConnectionURL: "redis://localhost:6379"},
+			errStrings: []string{},
+		}),
+		Entry("with a redis store without a connection", validateRateLimitTableInput{
+			rateLimit: options.RateLimit{
+				ProxyRequests: 100,
+				Period:        time.Second,
+				Store:         options.RateLimitStoreRedis,
+			},
+			errStrings: []string{"rate_limit_store \"redis\" requires the redis connection options of the session store to be set"},
+		}),
+		Entry("with invalid options", validateRateLimitTableInput{
+			rateLimit: options.RateLimit{
+				AuthRequests:  10,
+				ProxyRequests: -1,
+				Key:           "cookie",
+				Store:         "memcached",
+			},
+			errStrings: []string{
+				"rate_limit_proxy_requests must not be negative",
+				"rate_limit_period (0s) must be positive",
+				"invalid rate_limit_key: unknown rate limit key \"cookie\"",
+				"rate_limit_store \"memcached\" must be one of: memory, redis",
+			},
+		}),
+	)
+})
@@ -0,0 +1,222 @@
+package validation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	pkgutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+)
+
+// serverAuthMinBearerTokenLength is the shortest bearer token accepted, as
+// attempts to guess the token are not rate limited
+const serverAuthMinBearerTokenLength = 16
+
+// validateServerAuth checks the auth options of the servers. Only the metrics
+// and admin servers support them.
+func validateServerAuth(o *options.Options) []string {
+	msgs := []string{}
+	if o.Server.Auth != nil {
+		msgs = append(msgs, "server auth is only supported by the metrics and admin servers")
+	}
+
+	msgs = append(msgs, validateAuthenticatedServer("metrics server", o.MetricsServer)...)
+	msgs = append(msgs, validateAuthenticatedServer("admin server", o.AdminServer)...)
+	return msgs
+}
+
+func validateAuthenticatedServer(name string, server options.Server) []string {
+	auth := server.Auth
+	if auth == nil {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if auth.BearerToken != nil {
+		if msg := validateSecretSource(*auth.BearerToken); msg != "" {
+			msgs = append(msgs, fmt.Sprintf("%s bearer token: %s", name, msg))
+		} else if token, err := util.GetSecretValue(auth.BearerToken); err == nil && len(bytes.TrimSpace(token)) < serverAuthMinBearerTokenLength {
+			msgs = append(msgs, fmt.Sprintf("%s bearer token must be at least %d bytes", name, serverAuthMinBearerTokenLength))
+		}
+	}
+	if auth.ClientCA != nil {
+		if msg := validateSecretSource(*auth.ClientCA); msg != "" {
+			msgs = append(msgs, fmt.Sprintf("%s client CA: %s", name, msg))
+		}
+		if !serverServesTLS(server) {
+			msgs = append(msgs, fmt.Sprintf("%s client CA requires a secure bind address, client certificates are only presented over TLS", name))
+		}
+	}
+	for i, network := range auth.AllowedNetworks {
+		if ip.ParseIPNet(network) == nil {
+			msgs = append(msgs, fmt.Sprintf("%s allowedNetworks[%d] (%s) could not be recognized", name, i, network))
+		}
+	}
+
+	return msgs
+}
+
+// validateAdminServer checks that the admin server, when enabled, requires
+// clients to authenticate, as it can revoke any session, and that the
+// session store can list its sessions
+func validateAdminServer(o *options.Options) []string {
+	if !serverEnabled(o.AdminServer.BindAddress) && !serverEnabled(o.AdminServer.SecureBindAddress) && len(o.AdminServer.Listeners) == 0 {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if auth := o.AdminServer.Auth; auth == nil || (auth.BearerToken == nil && auth.ClientCA == nil) {
+		msgs = append(msgs, "admin server requires a bearer token or client CA, as it can revoke any session")
+	}
+	if o.Session.Type != options.RedisSessionStoreType && o.Session.Type != options.PostgresSessionStoreType {
+		msgs = append(msgs, fmt.Sprintf("admin server requires a redis or postgres session store to list the sessions, not %q", o.Session.Type))
+	}
+	if len(o.Session.Failover.Stores) > 0 {
+		msgs = append(msgs, "admin server cannot list the sessions of failover session stores")
+	}
+	return msgs
+}
+
+// validateListeners checks the listeners, the client CA files and the TLS
+// policies of the servers
+func validateListeners(o *options.Options) []string {
+	msgs := []string{}
+	for _, server := range []struct {
+		name    string
+		options options.Server
+	}{
+		{name: "server", options: o.Server},
+		{name: "metrics server", options: o.MetricsServer},
+		{name: "admin server", options: o.AdminServer},
+	} {
+		msgs = append(msgs, validateClientCAFiles(server.name, server.options.TLS)...)
+		msgs = append(msgs, validateTLSCertificates(server.name, server.options.TLS)...)
+		msgs = append(msgs, validateTLSPolicy(server.name, server.options.TLS, server.options)...)
+		for i, listener := range server.options.Listeners {
+			name := fmt.Sprintf("%s listeners[%d]", server.name, i)
+			if !serverEnabled(listener.BindAddress) {
+				msgs = append(msgs, fmt.Sprintf("%s requires a bind address", name))
+			}
+			if listener.TLS != nil && !tlsHasCertificate(listener.TLS) {
+				msgs = append(msgs, fmt.Sprintf("%s TLS requires a cert and key", name))
+			}
+			msgs = append(msgs, validateClientCAFiles(name, listener.TLS)...)
+			msgs = append(msgs, validateTLSCertificates(name, listener.TLS)...)
+			msgs = append(msgs, validateTLSPolicy(name, listener.TLS, server.options)...)
+		}
+	}
+	return msgs
+}
+
+// validateClientCAFiles checks that the client CA files of the TLS options
+// can be loaded
+func validateClientCAFiles(name string, tls *options.TLS) []string {
+	if tls == nil || len(tls.ClientCAFiles) == 0 {
+		return []string{}
+	}
+	if _, err := pkgutil.GetCertPool(tls.ClientCAFiles, false); err != nil {
+		return []string{fmt.Sprintf("%s client CA files: %v", name, err)}
+	}
+	return []string{}
+}
+
+// tlsHasCertificate returns whether the TLS options give certificates to
+// serve: a cert and key, or further certificates for the hosts requested
+// with SNI
+func tlsHasCertificate(tls *options.TLS) bool {
+	if tls.Cert != nil || tls.Key != nil {
+		return tls.Cert != nil && tls.Key != nil
+	}
+	return len(tls.Certificates) > 0 || tls.CertificatesDir != ""
+}
+
+// validateTLSCertificates checks the further certificates of the TLS options,
+// served for the hosts requested with SNI
+func validateTLSCertificates(name string, tls *options.TLS) []string {
+	if tls == nil {
+		return []string{}
+	}
+
+	msgs := []string{}
+	for i, certificate := range tls.Certificates {
+		prefix := fmt.Sprintf("%s TLS certificates[%d]", name, i)
+		if certificate.Cert == nil || certificate.Key == nil {
+			msgs = append(msgs, fmt.Sprintf("%s requires a cert and key", prefix))
+		}
+		for _, host := range certificate.Hosts {
+			if host == "" || strings.Contains(host, ":") || strings.Contains(strings.TrimPrefix(strings.TrimPrefix(host, "*"), "."), "*") {
+				msgs = append(msgs, fmt.Sprintf("%s host %q must be a server name, optionally starting with `*.` or `.` to match its subdomains", prefix, host))
+			}
+		}
+	}
+	if tls.CertificatesDir != "" {
+		if info, err := os.Stat(tls.CertificatesDir); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s TLS certificates dir: %v", name, err))
+		} else if !info.IsDir() {
+			msgs = append(msgs, fmt.Sprintf("%s TLS certificates dir %q is not a directory", name, tls.CertificatesDir))
+		}
+	}
+	return msgs
+}
+
+// validateTLSPolicy checks the client authentication and the application
+// protocols of the TLS options of a server or listener
+func validateTLSPolicy(name string, tls *options.TLS, server options.Server) []string {
+	if tls == nil {
+		return []string{}
+	}
+
+	msgs := []string{}
+	switch tls.ClientAuth {
+	case "", options.TLSClientAuthRequest, options.TLSClientAuthRequire:
+	case options.TLSClientAuthNone:
+		if len(tls.ClientCAFiles) > 0 {
+			msgs = append(msgs, fmt.Sprintf("%s TLS client auth %q cannot be used with client CA files", name, tls.ClientAuth))
+		}
+		if server.Auth != nil && server.Auth.ClientCA != nil {
+			msgs = append(msgs, fmt.Sprintf("%s TLS client auth %q cannot be used with a client CA, as clients would not present their certificate", name, tls.ClientAuth))
+		}
+	case options.TLSClientAuthVerifyIfGiven, options.TLSClientAuthRequireAndVerify:
+		if len(tls.ClientCAFiles) == 0 {
+			msgs = append(msgs, fmt.Sprintf("%s TLS client auth %q requires client CA files to verify the certificates with", name, tls.ClientAuth))
+		}
+	default:
+		msgs = append(msgs, fmt.Sprintf("%s TLS client auth %q is invalid, expected one of none, request, require, verify-if-given or require-and-verify", name, tls.ClientAuth))
+	}
+
+	for _, protocol := range tls.ALPNProtocols {
+		switch protocol {
+		case "http/1.1":
+		case "h2":
+			if !server.HTTP2 {
+				msgs = append(msgs, fmt.Sprintf("%s ALPN protocol %q requires HTTP/2 to be enabled", name, protocol))
+			}
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s ALPN protocol %q is not supported, expected h2 or http/1.1", name, protocol))
+		}
+	}
+	return msgs
+}
+
+// serverEnabled returns whether a server listens on the address
+func serverEnabled(address string) bool {
+	return address != "" && address != "-"
+}
+
+// serverServesTLS returns whether a server serves secure traffic, on its
+// secure address or on one of its listeners
+func serverServesTLS(server options.Server) bool {
+	if serverEnabled(server.SecureBindAddress) {
+		return true
+	}
+	for _, listener := range server.Listeners {
+		if listener.TLS != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package validation
+
+import (
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	type validateServerAuthTableInput struct {
+		server        options.Server
+		metricsServer options.Server
+		adminServer   options.Server
+		errStrings    []string
+	}
+
+	DescribeTable("validateServerAuth",
+		func(in validateServerAuthTableInput) {
+			o := &options.Options{Server: in.server, MetricsServer: in.metricsServer, AdminServer: in.adminServer}
+			Expect(validateServerAuth(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("without auth", validateServerAuthTableInput{
+			metricsServer: options.Server{BindAddress: ":9100"},
+			errStrings:    []string{},
+		}),
+		Entry("with a valid metrics server auth", validateServerAuthTableInput{
+			metricsServer: options.Server{
+				SecureBindAddress: ":9443",
+				Auth: &options.ServerAuth{
+					BearerToken:     &options.SecretSource{Value: []byte("0123456789abcdef")},
+					ClientCA:        &options.SecretSource{Value: []byte("ca")},
+					AllowedNetworks: []string{"10.0.0.0/8"},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with auth on the proxy server", validateServerAuthTableInput{
+			server: options.Server{
+				Auth: &options.ServerAuth{AllowedNetworks: []string{"10.0.0.0/8"}},
+			},
+			errStrings: []string{"server auth is only supported by the metrics and admin servers"},
+		}),
+		Entry("with an invalid metrics server auth", validateServerAuthTableInput{
+			metricsServer: options.Server{
+				BindAddress: ":9100",
+				Auth: &options.ServerAuth{
+					BearerToken:     &options.SecretSource{Value: []byte("short")},
+					ClientCA:        &options.SecretSource{Value: []byte("ca"), FromEnv: "CA"},
+					AllowedNetworks: []string{"10.0.0.0/33"},
+				},
+			},
+			errStrings: []string{
+				"metrics server bearer token must be at least 16 bytes",
+				"metrics server client CA: " + multipleValuesForSecretSource,
+				"metrics server client CA requires a secure bind address, client certificates are only presented over TLS",
+				"metrics server allowedNetworks[0] (10.0.0.0/33) could not be recognized",
+			},
+		}),
+		Entry("with an invalid admin server auth", validateServerAuthTableInput{
+			adminServer: options.Server{
+				BindAddress: ":9200",
+				Auth: &options.ServerAuth{
+					BearerToken: &options.SecretSource{Value: []byte("short")},
+				},
+			},
+			errStrings: []string{"admin server bearer token must be at least 16 bytes"},
+		}),
+	)
+
+	type validateAdminServerTableInput struct {
+		adminServer options.Server
+		session     options.SessionOptions
+		errStrings  []string
+	}
+
+	bearerToken := &options.ServerAuth{BearerToken: &options.SecretSource{Value: []byte("0123456789abcdef")}}
+
+	DescribeTable("validateAdminServer",
+		func(in validateAdminServerTableInput) {
+			o := &options.Options{AdminServer: in.adminServer, Session: in.session}
+			Expect(validateAdminServer(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("when disabled", validateAdminServerTableInput{
+			adminServer: options.Server{BindAddress: "-"},
+			session:     options.SessionOptions{Type: options.CookieSessionStoreType},
+			errStrings:  []string{},
+		}),
+		Entry("with auth and a redis session store", validateAdminServerTableInput{
+			adminServer: options.Server{BindAddress: ":9200", Auth: bearerToken},
+			session:     options.SessionOptions{Type: options.RedisSessionStoreType},
+			errStrings:  []string{},
+		}),
+		Entry("without a bearer token or client CA", validateAdminServerTableInput{
+			adminServer: options.Server{
+				BindAddress: ":9200",
+				Auth:        &options.ServerAuth{AllowedNetworks: []string{"10.0.0.0/8"}},
+			},
+			session:    options.SessionOptions{Type: options.PostgresSessionStoreType},
+			errStrings: []string{"admin server requires a bearer token or client CA, as it can revoke any session"},
+		}),
+		Entry("with a session store that cannot list its sessions", validateAdminServerTableInput{
+			adminServer: options.Server{SecureBindAddress: ":9200", Auth: bearerToken},
+			session: options.SessionOptions{
+				Type:     options.MemcachedSessionStoreType,
+				Failover: options.SessionFailoverOptions{Stores: []string{"cookie"}},
+			},
+			errStrings: []string{
+				"admin server requires a redis or postgres session store to list the sessions, not \"memcached\"",
+				"admin server cannot list the sessions of failover session stores",
+			},
+		}),
+	)
+
+	type validateListenersTableInput struct {
+		server        options.Server
+		metricsServer options.Server
+		errStrings    []string
+	}
+
+	tlsWithCert := &options.TLS{
+		Key:  &options.SecretSource{Value: []byte("key")},
+		Cert: &options.SecretSource{Value: []byte("cert")},
+	}
+
+	DescribeTable("validateListeners",
+		func(in validateListenersTableInput) {
+			o := &options.Options{Server: in.server, MetricsServer: in.metricsServer}
+			Expect(validateListeners(o)).To(ConsistOf(in.errStrings))
+		},
+		Entry("without listeners", validateListenersTableInput{
+			server:     options.Server{BindAddress: ":4180"},
+			errStrings: []string{},
+		}),
+		Entry("with valid listeners", validateListenersTableInput{
+			server: options.Server{
+				Listeners: []options.Listener{
+					{BindAddress: ":4180"},
+					{BindAddress: ":8443", TLS: tlsWithCert},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid listeners", validateListenersTableInput{
+			server: options.Server{
+				Listeners: []options.Listener{
+					{BindAddress: "-"},
+				},
+			},
+			metricsServer: options.Server{
+				Listeners: []options.Listener{
+					{BindAddress: ":9443", TLS: &options.TLS{Cert: &options.SecretSource{Value: []byte("cert")}}},
+				},
+			},
+			errStrings: []string{
+				"server listeners[0] requires a bind address",
+				"metrics server listeners[0] TLS requires a cert and key",
+			},
+		}),
+		Entry("with client CA files that cannot be loaded", validateListenersTableInput{
+			server: options.Server{
+				SecureBindAddress: ":443",
+				TLS: &options.TLS{
+					Key:           tlsWithCert.Key,
+					Cert:          tlsWithCert.Cert,
+					ClientCAFiles: []string{"/does/not/exist.pem"},
+				},
+			},
+			errStrings: []string{
+				"server client CA files: certificate authority file (/does/not/exist.pem) could not be read - open /does/not/exist.pem: no such file or directory",
+			},
+		}),
+		Entry("with valid SNI certificates", validateListenersTableInput{
+			server: options.Server{
+				SecureBindAddress: ":443",
+				TLS: &options.TLS{
+					Certificates: []options.TLSCertificate{
+						{Hosts: []string{"example.com", "*.example.org", ".example.net"}, Key: tlsWithCert.Key, Cert: tlsWithCert.Cert},
+						{Key: tlsWithCert.Key, Cert: tlsWithCert.Cert},
+					},
+					CertificatesDir: os.TempDir(),
+				},
+			},
+			metricsServer: options.Server{
+				Listeners: []options.Listener{
+					{BindAddress: ":9443", TLS: &options.TLS{Certificates: []options.TLSCertificate{{Key: tlsWithCert.Key, Cert: tlsWithCert.Cert}}}},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid SNI certificates", validateListenersTableInput{
+			server: options.Server{
+				SecureBindAddress: ":443",
+				TLS: &options.TLS{
+					Certificates: []options.TLSCertificate{
+						{Hosts: []string{"example.com:443", "foo.*.example.org", ""}, Key: tlsWithCert.Key, Cert: tlsWithCert.Cert},
+						{Cert: tlsWithCert.Cert},
+					},
+					CertificatesDir: "/does/not/exist",
+				},
+			},
+			metricsServer: options.Server{
+				Listeners: []options.Listener{
+					{BindAddress: ":9443", TLS: &options.TLS{Key: tlsWithCert.Key, Certificates: []options.TLSCertificate{{Key: tlsWithCert.Key, Cert: tlsWithCert.Cert}}}},
+				},
+			},
+			errStrings: []string{
+				"server TLS certificates[0] host \"example.com:443\" must be a server name, optionally starting with `*.` or `.` to match its subdomains",
+				"server TLS certificates[0] host \"foo.*.example.org\" must be a server name, optionally starting with `*.` or `.` to match its subdomains",
+				"server TLS certificates[0] host \"\" must be a server name, optionally starting with `*.` or `.` to match its subdomains",
+				"server TLS certificates[1] requires a cert and key",
+				"server TLS certificates dir: stat /does/not/exist: no such file or directory",
+				"metrics server listeners[0] TLS requires a cert and key",
+			},
+		}),
+		Entry("with a valid TLS policy", validateListenersTableInput{
+			server: options.Server{
+				SecureBindAddress: ":443",
+				HTTP2:             true,
+				TLS: &options.TLS{
+					Key:              tlsWithCert.Key,
+					Cert:             tlsWithCert.Cert,
+					MinVersion:       "TLS1.2",
+					MaxVersion:       "TLS1.3",
+					CurvePreferences: []string{"X25519", "P256"},
+					ALPNProtocols:    []string{"h2", "http/1.1"},
+					ClientAuth:       options.TLSClientAuthRequest,
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an invalid TLS policy", validateListenersTableInput{
+			server: options.Server{
+				SecureBindAddress: ":443",
+				TLS: &options.TLS{
+					Key:           tlsWithCert.Key,
+					Cert:          tlsWithCert.Cert,
+					ALPNProtocols: []string{"h2", "spdy/3"},
+					ClientAuth:    options.TLSClientAuthRequireAndVerify,
+				},
+			},
+			metricsServer: options.Server{
+				Auth: &options.ServerAuth{
+					ClientCA: &options.SecretSource{Value: []byte("ca")},
+				},
+				Listeners: []options.Listener{
+					{BindAddress: ":9443", TLS: &options.TLS{Key: tlsWithCert.Key, Cert: tlsWithCert.Cert, ClientAuth: options.TLSClientAuthNone}},
+					{BindAddress: ":9444", TLS: &options.TLS{Key: tlsWithCert.Key, Cert: tlsWithCert.Cert, ClientAuth: "optional"}},
+				},
+			},
+			errStrings: []string{
+				"server TLS client auth \"require-and-verify\" requires client CA files to verify the certificates with",
+				"server ALPN protocol \"h2\" requires HTTP/2 to be enabled",
+				"server ALPN protocol \"spdy/3\" is not supported, expected h2 or http/1.1",
+				"metrics server listeners[0] TLS client auth \"none\" cannot be used with a client CA, as clients would not present their certificate",
+				"metrics server listeners[1] TLS client auth \"optional\" is invalid, expected one of none, request, require, verify-if-given or require-and-verify",
+			},
+		}),
+	)
+
+	It("accepts a client CA on a server serving TLS on a listener only", func() {
+		o := &options.Options{
+			MetricsServer: options.Server{
+				Listeners: []options.Listener{{BindAddress: ":9443", TLS: tlsWithCert}},
+				Auth: &options.ServerAuth{
+					ClientCA: &options.SecretSource{Value: []byte("ca")},
+				},
+			},
+		}
+		Expect(validateServerAuth(o)).To(BeEmpty())
+	})
+})
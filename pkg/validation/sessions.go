@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption/kms"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/memcached"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/postgres"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions/redis"
 )
 
@@ -42,7 +46,7 @@ func validateSessionCookieMinimal(o *options.Options) []string {
 // validateRedisSessionStore builds a Redis Client from the options and
 // attempts to connect, Set, Get and Del a random health check key
 func validateRedisSessionStore(o *options.Options) []string {
-	if o.Session.Type != options.RedisSessionStoreType {
+	if !usesSessionStore(o, options.RedisSessionStoreType) {
 		return []string{}
 	}
 
@@ -61,6 +65,66 @@ func validateRedisSessionStore(o *options.Options) []string {
 	return sendRedisConnectionTest(client, key, nonce)
 }
 
+// validateRedisSessionEncoding checks the compression and chunking of the
+// sessions saved in redis
+func validateRedisSessionEncoding(o options.RedisStoreOptions) []string {
+	msgs := []string{}
+	switch o.Compression {
+	case "", options.RedisCompressionNone, options.RedisCompressionLZ4, options.RedisCompressionZstd, options.RedisCompressionBrotli:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid setting: redis-compression %q must be one of: %s, %s, %s, %s",
+			o.Compression, options.RedisCompressionNone, options.RedisCompressionLZ4, options.RedisCompressionZstd, options.RedisCompressionBrotli))
+	}
+	if o.ChunkSize < 0 {
+		msgs = append(msgs, "invalid setting: redis-chunk-size must not be negative")
+	}
+	return msgs
+}
+
+// validateRedisSessionCache checks the cache of the sessions saved in redis
+func validateRedisSessionCache(o options.RedisStoreOptions) []string {
+	msgs := []string{}
+	if o.CacheSize < 0 {
+		msgs = append(msgs, "invalid setting: redis-cache-size must not be negative")
+	}
+	if o.CacheSize <= 0 {
+		return msgs
+	}
+
+	if o.CacheTTL <= 0 {
+		msgs = append(msgs, "invalid setting: redis-cache-ttl must be positive")
+	}
+	switch o.CacheConsistency {
+	case options.RedisCacheConsistencyStrict:
+		if o.UseCluster {
+			// Cluster nodes only notify the changes of their own keys
+			msgs = append(msgs, "invalid setting: redis-cache-consistency strict is not supported with redis-use-cluster, as the keyspace notifications of a single node are received")
+		}
+	case options.RedisCacheConsistencyEventual:
+	default:
+		msgs = append(msgs, fmt.Sprintf("invalid setting: redis-cache-consistency %q must be one of: %s, %s",
+			o.CacheConsistency, options.RedisCacheConsistencyStrict, options.RedisCacheConsistencyEventual))
+	}
+	return msgs
+}
+
+// validateRedisReplicaReads checks that sessions are read from the replicas
+// of a sentinel master
+func validateRedisReplicaReads(o options.RedisStoreOptions) []string {
+	if !o.SentinelReadReplicas {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if !o.UseSentinel {
+		msgs = append(msgs, "invalid setting: redis-sentinel-read-replicas requires redis-use-sentinel")
+	}
+	if o.SentinelReplicaMaxStaleness <= 0 {
+		msgs = append(msgs, "invalid setting: redis-sentinel-replica-max-staleness must be positive")
+	}
+	return msgs
+}
+
 func sendRedisConnectionTest(client redis.Client, key string, val string) []string {
 	msgs := []string{}
 	ctx := context.Background()
@@ -86,3 +150,241 @@ func sendRedisConnectionTest(client redis.Client, key string, val string) []stri
 	}
 	return msgs
 }
+
+// validateMemcachedSessionStore builds a Memcached Client from the options and
+// attempts to connect, Set, Get and Del a random health check key
+func validateMemcachedSessionStore(o *options.Options) []string {
+	if !usesSessionStore(o, options.MemcachedSessionStoreType) {
+		return []string{}
+	}
+
+	switch o.Session.Memcached.AuthMechanism {
+	case options.MemcachedAuthSASL, options.MemcachedAuthASCII:
+	default:
+		return []string{fmt.Sprintf("invalid setting: memcached-auth-mechanism %q must be one of: %s, %s",
+			o.Session.Memcached.AuthMechanism, options.MemcachedAuthSASL, options.MemcachedAuthASCII)}
+	}
+
+	client, err := memcached.NewMemcachedClient(o.Session.Memcached)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to initialize a memcached client: %v", err)}
+	}
+
+	n, err := encryption.Nonce(32)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to generate a memcached initialization test key: %v", err)}
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(n)
+
+	key := fmt.Sprintf("%s-healthcheck-%s", o.Cookie.Name, nonce)
+	return sendMemcachedConnectionTest(client, key, nonce)
+}
+
+func sendMemcachedConnectionTest(client memcached.Client, key string, val string) []string {
+	msgs := []string{}
+	ctx := context.Background()
+
+	err := client.Set(ctx, key, []byte(val), time.Duration(60)*time.Second)
+	if err != nil {
+		msgs = append(msgs, fmt.Sprintf("unable to set a memcached initialization key: %v", err))
+	} else {
+		gval, err := client.Get(ctx, key)
+		if err != nil {
+			msgs = append(msgs,
+				fmt.Sprintf("unable to retrieve memcached initialization key: %v", err))
+		}
+		if string(gval) != val {
+			msgs = append(msgs,
+				"the retrieved memcached initialization key did not match the value we set")
+		}
+	}
+
+	err = client.Del(ctx, key)
+	if err != nil {
+		msgs = append(msgs, fmt.Sprintf("unable to delete the memcached initialization key: %v", err))
+	}
+	return msgs
+}
+
+// postgresIdentifierRegex matches unquoted PostgreSQL identifiers
+var postgresIdentifierRegex = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// validatePostgresSessionStore checks the PostgreSQL session store options
+// and attempts to connect to the database
+func validatePostgresSessionStore(o *options.Options) []string {
+	if !usesSessionStore(o, options.PostgresSessionStoreType) {
+		return []string{}
+	}
+
+	opts := o.Session.Postgres
+	msgs := []string{}
+	if opts.ConnectionURL == "" {
+		msgs = append(msgs, "missing setting: postgres-connection-url")
+	}
+	if !postgresIdentifierRegex.MatchString(opts.Table) {
+		msgs = append(msgs, fmt.Sprintf("postgres_table (%q) must be a lowercase identifier containing only letters, digits and underscores", opts.Table))
+	}
+	if opts.CleanupInterval < 0 {
+		msgs = append(msgs, "postgres_cleanup_interval must not be negative")
+	}
+	if opts.EncryptionKey != "" {
+		switch len(encryption.SecretBytes(opts.EncryptionKey)) {
+		case 16, 24, 32:
+		default:
+			msgs = append(msgs, "postgres_encryption_key must be 16, 24, or 32 bytes to create an AES cipher")
+		}
+	}
+	if len(msgs) > 0 {
+		return msgs
+	}
+
+	store, err := postgres.NewSessionStore(opts)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to initialize a postgres client: %v", err)}
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := store.VerifyConnection(ctx); err != nil {
+		return []string{fmt.Sprintf("unable to connect to postgres: %v", err)}
+	}
+	return msgs
+}
+
+// validateSessionKMS checks the session envelope encryption options and that
+// a client for the KMS can be created
+func validateSessionKMS(o *options.Options) []string {
+	opts := o.Session.KMS
+	if opts.Provider == "" {
+		return []string{}
+	}
+
+	msgs := []string{}
+	switch opts.Provider {
+	case options.AWSKMSProvider, options.GCPKMSProvider, options.VaultKMSProvider:
+	default:
+		msgs = append(msgs, fmt.Sprintf("session_kms_provider (%q) must be one of: aws, gcp, vault", opts.Provider))
+	}
+	if o.Session.Type == options.CookieSessionStoreType {
+		msgs = append(msgs, "session_kms_provider requires a persistent session store and cannot be used with session_store_type cookie")
+	}
+	if opts.KeyID == "" {
+		msgs = append(msgs, "missing setting: session-kms-key-id")
+	}
+	if opts.DataKeyRotation <= 0 {
+		msgs = append(msgs, "session_kms_data_key_rotation must be greater than 0")
+	}
+	if len(msgs) > 0 {
+		return msgs
+	}
+
+	if _, err := kms.NewKeyManager(opts); err != nil {
+		return []string{fmt.Sprintf("unable to initialize a session kms client: %v", err)}
+	}
+	return msgs
+}
+
+// validateSessionFailover checks the session store failover chain
+func validateSessionFailover(o *options.Options) []string {
+	opts := o.Session.Failover
+	if len(opts.Stores) == 0 {
+		return []string{}
+	}
+
+	msgs := []string{}
+	seen := map[string]bool{o.Session.Type: true}
+	for _, storeType := range opts.Stores {
+		switch storeType {
+		case options.CookieSessionStoreType, options.RedisSessionStoreType,
+			options.MemcachedSessionStoreType, options.PostgresSessionStoreType:
+		default:
+			msgs = append(msgs, fmt.Sprintf("session_store_failover contains an unknown session store type %q", storeType))
+			continue
+		}
+		if seen[storeType] {
+			msgs = append(msgs, fmt.Sprintf("session_store_failover contains the session store type %q more than once", storeType))
+		}
+		seen[storeType] = true
+	}
+	if opts.FailureThreshold <= 0 {
+		msgs = append(msgs, "session_store_failover_threshold must be greater than 0")
+	}
+	if opts.Cooldown <= 0 {
+		msgs = append(msgs, "session_store_failover_cooldown must be greater than 0")
+	}
+	return msgs
+}
+
+// validateSessionReaper checks the batches of the session reaper, which
+// reaps the sessions of persistent session stores
+func validateSessionReaper(o *options.Options) []string {
+	opts := o.Session.Reaper
+	msgs := []string{}
+	if opts.Interval < 0 {
+		msgs = append(msgs, "session_reaper_interval must not be negative")
+	}
+	if opts.BatchSize <= 0 {
+		msgs = append(msgs, "session_reaper_batch_size must be greater than 0")
+	}
+	if opts.Rate < 0 {
+		msgs = append(msgs, "session_reaper_rate must not be negative")
+	}
+	// Memcached expires all of its keys itself, and cannot list them
+	if opts.Interval > 0 &&
+		!usesSessionStore(o, options.RedisSessionStoreType) &&
+		!usesSessionStore(o, options.PostgresSessionStoreType) {
+		msgs = append(msgs, "session_reaper_interval requires a redis or postgres session store")
+	}
+	return msgs
+}
+
+// sessionArchiveMinSecretLength is the shortest secret that the keys of
+// session archives can be derived from
+const sessionArchiveMinSecretLength = 16
+
+// validateSessionArchive checks the secret of session archives is long
+// enough, when it is set
+func validateSessionArchive(o options.SessionArchiveOptions) []string {
+	if o.Secret != "" && len(o.Secret) < sessionArchiveMinSecretLength {
+		return []string{fmt.Sprintf("session_archive_secret must be at least %d bytes", sessionArchiveMinSecretLength)}
+	}
+	return []string{}
+}
+
+// validateSessionRefresh checks background refresh is used with a persistent
+// session store, as cookie sessions are only available during a request
+func validateSessionRefresh(o *options.Options) []string {
+	opts := o.Session.Refresh
+	if opts.BeforeExpiry == 0 {
+		return []string{}
+	}
+
+	msgs := []string{}
+	if opts.BeforeExpiry < 0 {
+		msgs = append(msgs, "session_refresh_before_expiry must not be negative")
+	}
+	if opts.Interval <= 0 {
+		msgs = append(msgs, "session_refresh_interval must be greater than 0")
+	}
+	if !usesSessionStore(o, options.RedisSessionStoreType) &&
+		!usesSessionStore(o, options.MemcachedSessionStoreType) &&
+		!usesSessionStore(o, options.PostgresSessionStoreType) {
+		msgs = append(msgs, "session_refresh_before_expiry requires a persistent session store (redis, memcached or postgres)")
+	}
+	return msgs
+}
+
+// usesSessionStore returns true if the session store type is the primary
+// session store or part of the failover chain
+func usesSessionStore(o *options.Options, storeType string) bool {
+	if o.Session.Type == storeType {
+		return true
+	}
+	for _, failoverType := range o.Session.Failover.Stores {
+		if failoverType == storeType {
+			return true
+		}
+	}
+	return false
+}
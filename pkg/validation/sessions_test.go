@@ -404,4 +404,392 @@ var _ = Describe("Sessions", func() {
 			errStrings: []string{clusterAndSentinelMsg},
 		}),
 	)
+
+	type postgresStoreTableInput struct {
+		opts       options.PostgresStoreOptions
+		errStrings []string
+	}
+
+	DescribeTable("validatePostgresSessionStore",
+		func(o *postgresStoreTableInput) {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Type:     options.PostgresSessionStoreType,
+					Postgres: o.opts,
+				},
+			}
+			Expect(validatePostgresSessionStore(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("with missing settings", &postgresStoreTableInput{
+			opts: options.PostgresStoreOptions{},
+			errStrings: []string{
+				"missing setting: postgres-connection-url",
+				"postgres_table (\"\") must be a lowercase identifier containing only letters, digits and underscores",
+			},
+		}),
+		Entry("with an invalid table and encryption key", &postgresStoreTableInput{
+			opts: options.PostgresStoreOptions{
+				ConnectionURL:   "postgres://localhost/sessions",
+				Table:           "sessions; DROP TABLE users",
+				CleanupInterval: -1 * time.Minute,
+				EncryptionKey:   "short",
+			},
+			errStrings: []string{
+				"postgres_table (\"sessions; DROP TABLE users\") must be a lowercase identifier containing only letters, digits and underscores",
+				"postgres_cleanup_interval must not be negative",
+				"postgres_encryption_key must be 16, 24, or 32 bytes to create an AES cipher",
+			},
+		}),
+	)
+
+	It("validatePostgresSessionStore fails to connect to an unreachable database", func() {
+		opts := &options.Options{
+			Session: options.SessionOptions{
+				Type: options.PostgresSessionStoreType,
+				Postgres: options.PostgresStoreOptions{
+					ConnectionURL: "postgres://127.0.0.1:1/sessions?sslmode=disable",
+					Table:         "oauth2_proxy_sessions",
+				},
+			},
+		}
+		Expect(validatePostgresSessionStore(opts)).To(ConsistOf(HavePrefix("unable to connect to postgres: ")))
+	})
+
+	type sessionKMSTableInput struct {
+		storeType  string
+		opts       options.SessionKMSOptions
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionKMS",
+		func(o *sessionKMSTableInput) {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Type: o.storeType,
+					KMS:  o.opts,
+				},
+			}
+			Expect(validateSessionKMS(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("without a provider", &sessionKMSTableInput{
+			storeType:  options.CookieSessionStoreType,
+			errStrings: []string{},
+		}),
+		Entry("with a valid vault configuration", &sessionKMSTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionKMSOptions{
+				Provider:        options.VaultKMSProvider,
+				KeyID:           "sessions",
+				Endpoint:        "https://vault.example.com",
+				VaultToken:      "token",
+				VaultMount:      "transit",
+				DataKeyRotation: time.Hour,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid settings", &sessionKMSTableInput{
+			storeType: options.CookieSessionStoreType,
+			opts: options.SessionKMSOptions{
+				Provider: "unknown",
+			},
+			errStrings: []string{
+				"session_kms_provider (\"unknown\") must be one of: aws, gcp, vault",
+				"session_kms_provider requires a persistent session store and cannot be used with session_store_type cookie",
+				"missing setting: session-kms-key-id",
+				"session_kms_data_key_rotation must be greater than 0",
+			},
+		}),
+		Entry("with a vault configuration missing the address", &sessionKMSTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionKMSOptions{
+				Provider:        options.VaultKMSProvider,
+				KeyID:           "sessions",
+				VaultToken:      "token",
+				DataKeyRotation: time.Hour,
+			},
+			errStrings: []string{
+				"unable to initialize a session kms client: vault address is not set",
+			},
+		}),
+	)
+
+	type sessionFailoverTableInput struct {
+		opts       options.SessionFailoverOptions
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionFailover",
+		func(o *sessionFailoverTableInput) {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Type:     options.RedisSessionStoreType,
+					Failover: o.opts,
+				},
+			}
+			Expect(validateSessionFailover(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("without failover stores", &sessionFailoverTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with a cookie failover store", &sessionFailoverTableInput{
+			opts: options.SessionFailoverOptions{
+				Stores:           []string{options.CookieSessionStoreType},
+				FailureThreshold: 3,
+				Cooldown:         30 * time.Second,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid settings", &sessionFailoverTableInput{
+			opts: options.SessionFailoverOptions{
+				Stores: []string{"invalid", options.RedisSessionStoreType, options.CookieSessionStoreType, options.CookieSessionStoreType},
+			},
+			errStrings: []string{
+				"session_store_failover contains an unknown session store type \"invalid\"",
+				"session_store_failover contains the session store type \"redis\" more than once",
+				"session_store_failover contains the session store type \"cookie\" more than once",
+				"session_store_failover_threshold must be greater than 0",
+				"session_store_failover_cooldown must be greater than 0",
+			},
+		}),
+	)
+
+	type sessionRefreshTableInput struct {
+		storeType  string
+		failover   []string
+		opts       options.SessionRefreshOptions
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionRefresh",
+		func(o *sessionRefreshTableInput) {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Type: o.storeType,
+					Failover: options.SessionFailoverOptions{
+						Stores: o.failover,
+					},
+					Refresh: o.opts,
+				},
+			}
+			Expect(validateSessionRefresh(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("with background refresh disabled", &sessionRefreshTableInput{
+			storeType:  options.CookieSessionStoreType,
+			errStrings: []string{},
+		}),
+		Entry("with a redis session store", &sessionRefreshTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionRefreshOptions{
+				BeforeExpiry: 5 * time.Minute,
+				Interval:     30 * time.Second,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a cookie session store failing over to postgres", &sessionRefreshTableInput{
+			storeType: options.CookieSessionStoreType,
+			failover:  []string{options.PostgresSessionStoreType},
+			opts: options.SessionRefreshOptions{
+				BeforeExpiry: 5 * time.Minute,
+				Interval:     30 * time.Second,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a cookie session store", &sessionRefreshTableInput{
+			storeType: options.CookieSessionStoreType,
+			opts: options.SessionRefreshOptions{
+				BeforeExpiry: 5 * time.Minute,
+				Interval:     30 * time.Second,
+			},
+			errStrings: []string{
+				"session_refresh_before_expiry requires a persistent session store (redis, memcached or postgres)",
+			},
+		}),
+		Entry("with invalid durations", &sessionRefreshTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionRefreshOptions{
+				BeforeExpiry: -time.Minute,
+			},
+			errStrings: []string{
+				"session_refresh_before_expiry must not be negative",
+				"session_refresh_interval must be greater than 0",
+			},
+		}),
+	)
+
+	type sessionReaperTableInput struct {
+		storeType  string
+		failover   []string
+		opts       options.SessionReaperOptions
+		errStrings []string
+	}
+
+	DescribeTable("validateSessionReaper",
+		func(o *sessionReaperTableInput) {
+			opts := &options.Options{
+				Session: options.SessionOptions{
+					Type: o.storeType,
+					Failover: options.SessionFailoverOptions{
+						Stores: o.failover,
+					},
+					Reaper: o.opts,
+				},
+			}
+			Expect(validateSessionReaper(opts)).To(ConsistOf(o.errStrings))
+		},
+		Entry("with the reaper disabled", &sessionReaperTableInput{
+			storeType: options.CookieSessionStoreType,
+			opts: options.SessionReaperOptions{
+				BatchSize: 100,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a redis session store", &sessionReaperTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionReaperOptions{
+				Interval:  time.Hour,
+				BatchSize: 100,
+				Rate:      1000,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a cookie session store failing over to postgres", &sessionReaperTableInput{
+			storeType: options.CookieSessionStoreType,
+			failover:  []string{options.PostgresSessionStoreType},
+			opts: options.SessionReaperOptions{
+				Interval:  time.Hour,
+				BatchSize: 100,
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a memcached session store", &sessionReaperTableInput{
+			storeType: options.MemcachedSessionStoreType,
+			opts: options.SessionReaperOptions{
+				Interval:  time.Hour,
+				BatchSize: 100,
+			},
+			errStrings: []string{
+				"session_reaper_interval requires a redis or postgres session store",
+			},
+		}),
+		Entry("with invalid settings", &sessionReaperTableInput{
+			storeType: options.RedisSessionStoreType,
+			opts: options.SessionReaperOptions{
+				Interval: -time.Hour,
+				Rate:     -1,
+			},
+			errStrings: []string{
+				"session_reaper_interval must not be negative",
+				"session_reaper_batch_size must be greater than 0",
+				"session_reaper_rate must not be negative",
+			},
+		}),
+	)
+
+	DescribeTable("validateSessionArchive",
+		func(secret string, errStrings []string) {
+			Expect(validateSessionArchive(options.SessionArchiveOptions{Secret: secret})).To(ConsistOf(errStrings))
+		},
+		Entry("without a secret", "", []string{}),
+		Entry("with a secret", "0123456789abcdef", []string{}),
+		Entry("with a short secret", "secret", []string{
+			"session_archive_secret must be at least 16 bytes",
+		}),
+	)
+
+	DescribeTable("validateRedisSessionEncoding",
+		func(opts options.RedisStoreOptions, errStrings []string) {
+			Expect(validateRedisSessionEncoding(opts)).To(ConsistOf(errStrings))
+		},
+		Entry("with the defaults", options.RedisStoreOptions{
+			Compression: options.RedisCompressionNone,
+		}, []string{}),
+		Entry("with lz4 compression and chunking", options.RedisStoreOptions{
+			Compression: options.RedisCompressionLZ4,
+			ChunkSize:   65536,
+		}, []string{}),
+		Entry("with zstd compression", options.RedisStoreOptions{
+			Compression: options.RedisCompressionZstd,
+		}, []string{}),
+		Entry("with brotli compression", options.RedisStoreOptions{
+			Compression: options.RedisCompressionBrotli,
+		}, []string{}),
+		Entry("with an unknown compression and a negative chunk size", options.RedisStoreOptions{
+			Compression: "zip",
+			ChunkSize:   -1,
+		}, []string{
+			"invalid setting: redis-compression \"zip\" must be one of: none, lz4, zstd, brotli",
+			"invalid setting: redis-chunk-size must not be negative",
+		}),
+	)
+
+	DescribeTable("validateRedisSessionCache",
+		func(opts options.RedisStoreOptions, errStrings []string) {
+			Expect(validateRedisSessionCache(opts)).To(ConsistOf(errStrings))
+		},
+		Entry("without a cache", options.RedisStoreOptions{}, []string{}),
+		Entry("with a strict cache", options.RedisStoreOptions{
+			CacheSize:        1000,
+			CacheTTL:         10 * time.Second,
+			CacheConsistency: options.RedisCacheConsistencyStrict,
+		}, []string{}),
+		Entry("with an eventual cache in front of cluster", options.RedisStoreOptions{
+			UseCluster:       true,
+			CacheSize:        1000,
+			CacheTTL:         10 * time.Second,
+			CacheConsistency: options.RedisCacheConsistencyEventual,
+		}, []string{}),
+		Entry("with a negative size", options.RedisStoreOptions{
+			CacheSize: -1,
+		}, []string{
+			"invalid setting: redis-cache-size must not be negative",
+		}),
+		Entry("with an invalid TTL and consistency", options.RedisStoreOptions{
+			CacheSize:        1000,
+			CacheConsistency: "weak",
+		}, []string{
+			"invalid setting: redis-cache-ttl must be positive",
+			"invalid setting: redis-cache-consistency \"weak\" must be one of: strict, eventual",
+		}),
+		Entry("with a strict cache in front of cluster", options.RedisStoreOptions{
+			UseCluster:       true,
+			CacheSize:        1000,
+			CacheTTL:         10 * time.Second,
+			CacheConsistency: options.RedisCacheConsistencyStrict,
+		}, []string{
+			"invalid setting: redis-cache-consistency strict is not supported with redis-use-cluster, as the keyspace notifications of a single node are received",
+		}),
+	)
+
+	DescribeTable("validateRedisReplicaReads",
+		func(opts options.RedisStoreOptions, errStrings []string) {
+			Expect(validateRedisReplicaReads(opts)).To(ConsistOf(errStrings))
+		},
+		Entry("without replica reads", options.RedisStoreOptions{}, []string{}),
+		Entry("with replica reads from sentinels", options.RedisStoreOptions{
+			UseSentinel:                 true,
+			SentinelReadReplicas:        true,
+			SentinelReplicaMaxStaleness: 5 * time.Second,
+		}, []string{}),
+		Entry("with replica reads without sentinels or staleness", options.RedisStoreOptions{
+			SentinelReadReplicas: true,
+		}, []string{
+			"invalid setting: redis-sentinel-read-replicas requires redis-use-sentinel",
+			"invalid setting: redis-sentinel-replica-max-staleness must be positive",
+		}),
+	)
+
+	It("validatePostgresSessionStore validates a postgres failover store", func() {
+		opts := &options.Options{
+			Session: options.SessionOptions{
+				Type: options.CookieSessionStoreType,
+				Failover: options.SessionFailoverOptions{
+					Stores: []string{options.PostgresSessionStoreType},
+				},
+				Postgres: options.PostgresStoreOptions{
+					Table: "oauth2_proxy_sessions",
+				},
+			},
+		}
+		Expect(validatePostgresSessionStore(opts)).To(ConsistOf("missing setting: postgres-connection-url"))
+	})
 })
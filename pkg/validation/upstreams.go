@@ -3,8 +3,12 @@ package validation
 import (
 	"fmt"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/ip"
+	"golang.org/x/net/http/httpguts"
 )
 
 func validateUpstreams(upstreams options.UpstreamConfig) []string {
@@ -15,6 +19,28 @@ func validateUpstreams(upstreams options.UpstreamConfig) []string {
 	for _, upstream := range upstreams.Upstreams {
 		msgs = append(msgs, validateUpstream(upstream, ids, paths)...)
 	}
+	msgs = append(msgs, validateUpstreamTimeoutBudget(upstreams.TimeoutBudget)...)
+	msgs = append(msgs, validateResponseHeaders("upstreams", upstreams.ResponseHeaders)...)
+
+	return msgs
+}
+
+// validateUpstreamTimeoutBudget checks that the timeout budget has a header
+// and that its trusted networks can be parsed
+func validateUpstreamTimeoutBudget(budget *options.UpstreamTimeoutBudget) []string {
+	if budget == nil {
+		return []string{}
+	}
+	msgs := []string{}
+
+	if budget.Header == "" {
+		msgs = append(msgs, "upstream timeoutBudget has no header: a header is required to forward the budget")
+	}
+	for i, network := range budget.TrustedNetworks {
+		if ip.ParseIPNet(network) == nil {
+			msgs = append(msgs, fmt.Sprintf("upstream timeoutBudget trustedNetworks[%d] (%s) could not be recognized", i, network))
+		}
+	}
 
 	return msgs
 }
@@ -43,8 +69,167 @@ func validateUpstream(upstream options.Upstream, ids, paths map[string]struct{})
 	}
 	paths[upstream.Path] = struct{}{}
 
-	msgs = append(msgs, validateUpstreamURI(upstream)...)
+	if len(upstream.Targets) > 0 {
+		msgs = append(msgs, validateUpstreamTargets(upstream)...)
+	} else {
+		msgs = append(msgs, validateUpstreamURI(upstream)...)
+	}
 	msgs = append(msgs, validateStaticUpstream(upstream)...)
+	msgs = append(msgs, validateUpstreamCircuitBreaker(upstream)...)
+	msgs = append(msgs, validateUpstreamResponseHeaders(upstream)...)
+	msgs = append(msgs, validateUpstreamLimits(upstream)...)
+	msgs = append(msgs, validateUpstreamHealthCheck(upstream)...)
+	msgs = append(msgs, validateUpstreamTokenExchange(upstream)...)
+	msgs = append(msgs, validateUpstreamSigning(upstream)...)
+	for i, scope := range upstream.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t") {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid scopes[%d] (%q): scopes must not be empty or contain whitespace", upstream.ID, i, scope))
+		}
+	}
+	if upstream.H2C && (upstream.Static || !supportsH2C(upstream)) {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has h2c, but only HTTP and unix socket upstreams support h2c", upstream.ID))
+	}
+	return msgs
+}
+
+// supportsH2C returns whether the URI, or all the targets, of the upstream
+// are HTTP or unix socket servers
+func supportsH2C(upstream options.Upstream) bool {
+	uris := []string{upstream.URI}
+	if len(upstream.Targets) > 0 {
+		uris = uris[:0]
+		for _, target := range upstream.Targets {
+			uris = append(uris, target.URI)
+		}
+	}
+	for _, uri := range uris {
+		if !strings.HasPrefix(uri, "http:") && !strings.HasPrefix(uri, "unix:") {
+			return false
+		}
+	}
+	return true
+}
+
+// validateUpstreamTargets checks that the targets replace the URI of the
+// upstream, and that they are HTTP(S) or unix socket servers
+func validateUpstreamTargets(upstream options.Upstream) []string {
+	msgs := []string{}
+
+	if upstream.Static {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has targets, but is a static upstream, this will have no effect.", upstream.ID))
+		return msgs
+	}
+	if upstream.URI != "" {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has both uri and targets: only one of them may be set", upstream.ID))
+	}
+
+	for i, target := range upstream.Targets {
+		if target.URI == "" {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has empty targets[%d].uri: uris are required for all targets", upstream.ID, i))
+			continue
+		}
+		u, err := url.Parse(target.URI)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid targets[%d].uri: %v", upstream.ID, i, err))
+			continue
+		}
+		switch u.Scheme {
+		case "http", "https", "unix":
+			// Valid, do nothing
+		default:
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid targets[%d].uri scheme: %q", upstream.ID, i, u.Scheme))
+		}
+		if target.Weight < 0 {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has a negative targets[%d].weight (%d)", upstream.ID, i, target.Weight))
+		}
+	}
+
+	return msgs
+}
+
+// validateUpstreamHealthCheck checks that the health check is only set for
+// upstreams with targets, and that its options can be used
+func validateUpstreamHealthCheck(upstream options.Upstream) []string {
+	hc := upstream.HealthCheck
+	if hc == nil {
+		return []string{}
+	}
+	msgs := []string{}
+
+	if len(upstream.Targets) == 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has healthCheck, but has no targets, this will have no effect.", upstream.ID))
+	}
+	if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has invalid healthCheck path (%q): paths must start with a slash", upstream.ID, hc.Path))
+	}
+	if hc.Interval != nil && hc.Interval.Duration() <= 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a healthCheck interval that is not positive (%s)", upstream.ID, hc.Interval.Duration()))
+	}
+	if hc.FailureThreshold < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative healthCheck failureThreshold (%d)", upstream.ID, hc.FailureThreshold))
+	}
+
+	return msgs
+}
+
+// validateUpstreamLimits checks that the body size limits and client timeouts
+// are not negative, and are only set for upstreams that proxy to a server
+func validateUpstreamLimits(upstream options.Upstream) []string {
+	msgs := []string{}
+
+	if upstream.MaxRequestBodySize < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative maxRequestBodySize (%d)", upstream.ID, upstream.MaxRequestBodySize))
+	}
+	if upstream.MaxResponseBodySize < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative maxResponseBodySize (%d)", upstream.ID, upstream.MaxResponseBodySize))
+	}
+	if upstream.ClientReadTimeout != nil && upstream.ClientReadTimeout.Duration() < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative clientReadTimeout (%s)", upstream.ID, upstream.ClientReadTimeout.Duration()))
+	}
+	if upstream.ClientWriteTimeout != nil && upstream.ClientWriteTimeout.Duration() < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative clientWriteTimeout (%s)", upstream.ID, upstream.ClientWriteTimeout.Duration()))
+	}
+
+	hasLimits := upstream.MaxRequestBodySize != 0 || upstream.MaxResponseBodySize != 0 ||
+		upstream.ClientReadTimeout != nil || upstream.ClientWriteTimeout != nil
+	if hasLimits && (upstream.Static || strings.HasPrefix(upstream.URI, "file:")) {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has body size limits or client timeouts, but only HTTP(S) and unix socket upstreams support them", upstream.ID))
+	}
+
+	return msgs
+}
+
+// validateUpstreamResponseHeaders checks that the allowed and denied response
+// header names are not empty, and only end in a wildcard
+func validateUpstreamResponseHeaders(upstream options.Upstream) []string {
+	owner := fmt.Sprintf("upstream %q", upstream.ID)
+	msgs := []string{}
+	msgs = append(msgs, validateResponseHeaderNames(owner, "allowedResponseHeaders", upstream.AllowedResponseHeaders)...)
+	msgs = append(msgs, validateResponseHeaderNames(owner, "deniedResponseHeaders", upstream.DeniedResponseHeaders)...)
+	msgs = append(msgs, validateResponseHeaders(owner, upstream.ResponseHeaders)...)
+	return msgs
+}
+
+// validateResponseHeaders checks the injected response headers, and the names
+// of the stripped response headers
+func validateResponseHeaders(owner string, responseHeaders *options.ResponseHeaders) []string {
+	if responseHeaders == nil {
+		return []string{}
+	}
+	msgs := []string{}
+	msgs = append(msgs, prefixValues(owner+" responseHeaders.inject: ", validateHeaders(responseHeaders.Inject)...)...)
+	msgs = append(msgs, validateResponseHeaderNames(owner, "responseHeaders.strip", responseHeaders.Strip)...)
+	return msgs
+}
+
+func validateResponseHeaderNames(owner, field string, names []string) []string {
+	msgs := []string{}
+	for i, name := range names {
+		prefix := strings.TrimSuffix(name, "*")
+		if prefix == "" || strings.ContainsAny(prefix, "*: \t") {
+			msgs = append(msgs, fmt.Sprintf("%s has invalid %s[%d] (%q): header names must not be empty and may only end in a wildcard", owner, field, i, name))
+		}
+	}
 	return msgs
 }
 
@@ -78,6 +263,12 @@ func validateStaticUpstream(upstream options.Upstream) []string {
 	if upstream.ProxyWebSockets != nil {
 		msgs = append(msgs, fmt.Sprintf("upstream %q has proxyWebSockets, but is a static upstream, this will have no effect.", upstream.ID))
 	}
+	if upstream.StripProxyCookies != nil {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has stripProxyCookies, but is a static upstream, this will have no effect.", upstream.ID))
+	}
+	if len(upstream.AllowedResponseHeaders) > 0 || len(upstream.DeniedResponseHeaders) > 0 || upstream.ResponseHeaders != nil {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has response header filtering, but is a static upstream, this will have no effect.", upstream.ID))
+	}
 
 	return msgs
 }
@@ -110,3 +301,131 @@ func validateUpstreamURI(upstream options.Upstream) []string {
 
 	return msgs
 }
+
+// validateUpstreamTokenExchange checks that the token exchange has an
+// audience or scopes, and is only configured for upstreams that proxy to a
+// server
+func validateUpstreamTokenExchange(upstream options.Upstream) []string {
+	if upstream.TokenExchange == nil {
+		return []string{}
+	}
+	msgs := []string{}
+
+	if upstream.TokenExchange.Audience == "" && len(upstream.TokenExchange.Scopes) == 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a token exchange without an audience or scopes", upstream.ID))
+	}
+	if upstream.Static || strings.HasPrefix(upstream.URI, "file:") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a token exchange, but only HTTP(S) and unix socket upstreams support token exchange", upstream.ID))
+	}
+	return msgs
+}
+
+// validateUpstreamSigning checks that the signing has exactly one method
+// with its required settings and secrets, and is only configured for
+// upstreams that proxy to a server. The bodies of the requests whose payload
+// is signed are read into memory, so their size must be limited.
+func validateUpstreamSigning(upstream options.Upstream) []string {
+	signing := upstream.Signing
+	if signing == nil {
+		return []string{}
+	}
+	msgs := []string{}
+
+	if upstream.Static || strings.HasPrefix(upstream.URI, "file:") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has signing, but only HTTP(S) and unix socket upstreams support signing", upstream.ID))
+	}
+	switch {
+	case (signing.AWSSigV4 == nil) == (signing.HMAC == nil):
+		msgs = append(msgs, fmt.Sprintf("upstream %q signing must have exactly one of awsSigV4 or hmac", upstream.ID))
+	case signing.AWSSigV4 != nil:
+		msgs = append(msgs, validateUpstreamAWSSigV4Signing(upstream.ID, *signing.AWSSigV4)...)
+	case signing.HMAC != nil:
+		hmac := signing.HMAC
+		if hmac.Key == nil {
+			msgs = append(msgs, fmt.Sprintf("upstream %q hmac signing has no key", upstream.ID))
+		} else if msg := validateSecretSource(*hmac.Key); msg != "" {
+			msgs = append(msgs, fmt.Sprintf("upstream %q hmac signing has an invalid key: %s", upstream.ID, msg))
+		}
+		if hmac.Header != "" && !httpguts.ValidHeaderFieldName(hmac.Header) {
+			msgs = append(msgs, fmt.Sprintf("upstream %q hmac signing has an invalid header name %q", upstream.ID, hmac.Header))
+		}
+	}
+
+	payloadSigned := signing.HMAC != nil || (signing.AWSSigV4 != nil && !signing.AWSSigV4.UnsignedPayload)
+	if payloadSigned && upstream.MaxRequestBodySize == 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q signs the request bodies, which are read into memory, so it requires a maxRequestBodySize", upstream.ID))
+	}
+	return msgs
+}
+
+// validateUpstreamAWSSigV4Signing checks that the AWS Signature Version 4
+// has a region and service, and either both or none of the access key ID
+// and secret
+func validateUpstreamAWSSigV4Signing(id string, sigV4 options.UpstreamAWSSigV4Signing) []string {
+	msgs := []string{}
+
+	if sigV4.Region == "" || sigV4.Service == "" {
+		msgs = append(msgs, fmt.Sprintf("upstream %q awsSigV4 signing requires a region and service", id))
+	}
+	if (sigV4.AccessKeyID == nil) != (sigV4.SecretAccessKey == nil) ||
+		(sigV4.SessionToken != nil && sigV4.AccessKeyID == nil) {
+		msgs = append(msgs, fmt.Sprintf("upstream %q awsSigV4 signing requires both accessKeyID and secretAccessKey, or neither to use the environment", id))
+	}
+	for _, secret := range []struct {
+		name   string
+		source *options.SecretSource
+	}{
+		{"accessKeyID", sigV4.AccessKeyID},
+		{"secretAccessKey", sigV4.SecretAccessKey},
+		{"sessionToken", sigV4.SessionToken},
+	} {
+		if secret.source == nil {
+			continue
+		}
+		if msg := validateSecretSource(*secret.source); msg != "" {
+			msgs = append(msgs, fmt.Sprintf("upstream %q awsSigV4 signing has an invalid %s: %s", id, secret.name, msg))
+		}
+	}
+	return msgs
+}
+
+// validateUpstreamCircuitBreaker checks that the circuit breaker is only
+// configured for upstreams that proxy to a server, and that its fallback and
+// error page can be used.
+func validateUpstreamCircuitBreaker(upstream options.Upstream) []string {
+	cb := upstream.CircuitBreaker
+	if cb == nil {
+		return []string{}
+	}
+	msgs := []string{}
+
+	if cb.FailureThreshold < 0 {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a negative circuit breaker failureThreshold (%d)", upstream.ID, cb.FailureThreshold))
+	}
+	if cb.FailureThreshold <= 0 {
+		return msgs
+	}
+
+	if upstream.Static || strings.HasPrefix(upstream.URI, "file:") {
+		msgs = append(msgs, fmt.Sprintf("upstream %q has a circuit breaker, but only HTTP(S) and unix socket upstreams support circuit breakers", upstream.ID))
+	}
+
+	if cb.FallbackURI != "" {
+		u, err := url.Parse(cb.FallbackURI)
+		switch {
+		case err != nil:
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid circuit breaker fallbackURI: %v", upstream.ID, err))
+		case u.Scheme != "http" && u.Scheme != "https":
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid circuit breaker fallbackURI scheme: %q", upstream.ID, u.Scheme))
+		}
+		if cb.ErrorPage != "" {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has a circuit breaker errorPage, but it has a fallbackURI, this will have no effect.", upstream.ID))
+		}
+	} else if cb.ErrorPage != "" {
+		if _, err := os.Stat(cb.ErrorPage); err != nil {
+			msgs = append(msgs, fmt.Sprintf("upstream %q has invalid circuit breaker errorPage: %v", upstream.ID, err))
+		}
+	}
+
+	return msgs
+}
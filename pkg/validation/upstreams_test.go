@@ -15,6 +15,8 @@ var _ = Describe("Upstreams", func() {
 	}
 
 	flushInterval := options.Duration(5 * time.Second)
+	clientTimeout := options.Duration(30 * time.Second)
+	negativeSecond := options.Duration(-time.Second)
 	staticCode200 := 200
 	truth := true
 
@@ -44,10 +46,44 @@ var _ = Describe("Upstreams", func() {
 	staticWithFlushIntervalMsg := "upstream \"foo\" has flushInterval, but is a static upstream, this will have no effect."
 	staticWithPassHostHeaderMsg := "upstream \"foo\" has passHostHeader, but is a static upstream, this will have no effect."
 	staticWithProxyWebSocketsMsg := "upstream \"foo\" has proxyWebSockets, but is a static upstream, this will have no effect."
+	staticWithStripProxyCookiesMsg := "upstream \"foo\" has stripProxyCookies, but is a static upstream, this will have no effect."
 	multipleIDsMsg := "multiple upstreams found with id \"foo\": upstream ids must be unique"
 	multiplePathsMsg := "multiple upstreams found with path \"/foo\": upstream paths must be unique"
 	staticCodeMsg := "upstream \"foo\" has staticCode (200), but is not a static upstream, set 'static' for a static response"
 
+	circuitBreakerNegativeMsg := "upstream \"foo\" has a negative circuit breaker failureThreshold (-1)"
+	circuitBreakerStaticMsg := "upstream \"foo\" has a circuit breaker, but only HTTP(S) and unix socket upstreams support circuit breakers"
+	circuitBreakerFallbackSchemeMsg := "upstream \"foo\" has invalid circuit breaker fallbackURI scheme: \"file\""
+	circuitBreakerErrorPageMsg := "upstream \"foo\" has a circuit breaker errorPage, but it has a fallbackURI, this will have no effect."
+	circuitBreakerMissingPageMsg := "upstream \"foo\" has invalid circuit breaker errorPage: stat /does/not/exist.html: no such file or directory"
+
+	timeoutBudgetHeaderMsg := "upstream timeoutBudget has no header: a header is required to forward the budget"
+	timeoutBudgetNetworkMsg := "upstream timeoutBudget trustedNetworks[1] (10.0.0.0/33) could not be recognized"
+	staticWithResponseHeadersMsg := "upstream \"foo\" has response header filtering, but is a static upstream, this will have no effect."
+	allowedResponseHeaderMsg := "upstream \"foo\" has invalid allowedResponseHeaders[1] (\"\"): header names must not be empty and may only end in a wildcard"
+	deniedResponseHeaderMsg := "upstream \"foo\" has invalid deniedResponseHeaders[0] (\"X-*-Debug\"): header names must not be empty and may only end in a wildcard"
+	strippedResponseHeaderMsg := "upstreams has invalid responseHeaders.strip[0] (\"*\"): header names must not be empty and may only end in a wildcard"
+	injectedResponseHeaderMsg := "upstream \"foo\" responseHeaders.inject: header has empty name: names are required for all headers"
+	negativeRequestBodySizeMsg := "upstream \"foo\" has a negative maxRequestBodySize (-1)"
+	negativeClientWriteTimeoutMsg := "upstream \"foo\" has a negative clientWriteTimeout (-1s)"
+	fileWithLimitsMsg := "upstream \"foo\" has body size limits or client timeouts, but only HTTP(S) and unix socket upstreams support them"
+	tokenExchangeAudienceMsg := "upstream \"foo\" has a token exchange without an audience or scopes"
+	tokenExchangeFileMsg := "upstream \"foo\" has a token exchange, but only HTTP(S) and unix socket upstreams support token exchange"
+	signingFileMsg := "upstream \"foo\" has signing, but only HTTP(S) and unix socket upstreams support signing"
+	signingMethodMsg := "upstream \"foo\" signing must have exactly one of awsSigV4 or hmac"
+	signingBodySizeMsg := "upstream \"foo\" signs the request bodies, which are read into memory, so it requires a maxRequestBodySize"
+	sigV4RegionMsg := "upstream \"foo\" awsSigV4 signing requires a region and service"
+	sigV4CredentialsMsg := "upstream \"foo\" awsSigV4 signing requires both accessKeyID and secretAccessKey, or neither to use the environment"
+	hmacKeyMsg := "upstream \"foo\" hmac signing has no key"
+	hmacHeaderMsg := "upstream \"foo\" hmac signing has an invalid header name \"X Signature\""
+	invalidScopeMsg := "upstream \"foo\" has invalid scopes[1] (\"calendar read\"): scopes must not be empty or contain whitespace"
+	uriWithTargetsMsg := "upstream \"foo\" has both uri and targets: only one of them may be set"
+	targetSchemeMsg := "upstream \"foo\" has invalid targets[1].uri scheme: \"file\""
+	targetWeightMsg := "upstream \"foo\" has a negative targets[0].weight (-1)"
+	healthCheckWithoutTargetsMsg := "upstream \"foo\" has healthCheck, but has no targets, this will have no effect."
+	healthCheckPathMsg := "upstream \"foo\" has invalid healthCheck path (\"healthz\"): paths must start with a slash"
+	httpsWithH2CMsg := "upstream \"foo\" has h2c, but only HTTP and unix socket upstreams support h2c"
+
 	DescribeTable("validateUpstreams",
 		func(o *validateUpstreamTableInput) {
 			Expect(validateUpstreams(o.upstreams)).To(ConsistOf(o.errStrings))
@@ -149,7 +185,9 @@ var _ = Describe("Upstreams", func() {
 						FlushInterval:         &flushInterval,
 						PassHostHeader:        &truth,
 						ProxyWebSockets:       &truth,
+						StripProxyCookies:     &truth,
 						InsecureSkipTLSVerify: true,
+						DeniedResponseHeaders: []string{"Server"},
 					},
 				},
 			},
@@ -159,6 +197,8 @@ var _ = Describe("Upstreams", func() {
 				staticWithFlushIntervalMsg,
 				staticWithPassHostHeaderMsg,
 				staticWithProxyWebSocketsMsg,
+				staticWithStripProxyCookiesMsg,
+				staticWithResponseHeadersMsg,
 			},
 		}),
 		Entry("with duplicate IDs", &validateUpstreamTableInput{
@@ -207,5 +247,458 @@ var _ = Describe("Upstreams", func() {
 			},
 			errStrings: []string{emptyURIMsg, staticCodeMsg},
 		}),
+		Entry("with a valid circuit breaker", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						CircuitBreaker: &options.UpstreamCircuitBreaker{
+							FailureThreshold: 5,
+							FallbackURI:      "https://fallback",
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a valid token exchange", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						TokenExchange: &options.UpstreamTokenExchange{
+							Audience: "api://foo",
+							Scopes:   []string{"read"},
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with a token exchange without an audience or scopes on a file upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:            "foo",
+						Path:          "/foo",
+						URI:           "file:///var/lib/foo",
+						TokenExchange: &options.UpstreamTokenExchange{},
+					},
+				},
+			},
+			errStrings: []string{tokenExchangeAudienceMsg, tokenExchangeFileMsg},
+		}),
+		Entry("with valid signing", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                 "foo",
+						Path:               "/foo",
+						URI:                "https://foo",
+						MaxRequestBodySize: 1 << 20,
+						Signing: &options.UpstreamSigning{
+							AWSSigV4: &options.UpstreamAWSSigV4Signing{
+								Region:          "us-east-1",
+								Service:         "execute-api",
+								AccessKeyID:     &options.SecretSource{Value: []byte("AKIDEXAMPLE")},
+								SecretAccessKey: &options.SecretSource{Value: []byte("secret")},
+							},
+						},
+					},
+					{
+						ID:                 "bar",
+						Path:               "/bar",
+						URI:                "http://bar",
+						MaxRequestBodySize: 1 << 20,
+						Signing: &options.UpstreamSigning{
+							HMAC: &options.UpstreamHMACSigning{
+								Key:    &options.SecretSource{Value: []byte("key")},
+								Header: "X-Bar-Signature",
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with signing without a method on a file upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:      "foo",
+						Path:    "/foo",
+						URI:     "file:///var/lib/foo",
+						Signing: &options.UpstreamSigning{},
+					},
+				},
+			},
+			errStrings: []string{signingFileMsg, signingMethodMsg},
+		}),
+		Entry("with signed payloads without a maximum request body size", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "https://foo",
+						Signing: &options.UpstreamSigning{
+							HMAC: &options.UpstreamHMACSigning{
+								Key: &options.SecretSource{Value: []byte("key")},
+							},
+						},
+					},
+					{
+						ID:   "bar",
+						Path: "/bar",
+						URI:  "https://bar",
+						Signing: &options.UpstreamSigning{
+							AWSSigV4: &options.UpstreamAWSSigV4Signing{
+								Region:          "us-east-1",
+								Service:         "s3",
+								UnsignedPayload: true,
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{signingBodySizeMsg},
+		}),
+		Entry("with an invalid awsSigV4 signing", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                 "foo",
+						Path:               "/foo",
+						URI:                "https://foo",
+						MaxRequestBodySize: 1024,
+						Signing: &options.UpstreamSigning{
+							AWSSigV4: &options.UpstreamAWSSigV4Signing{
+								Service:     "s3",
+								AccessKeyID: &options.SecretSource{Value: []byte("AKIDEXAMPLE")},
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{sigV4RegionMsg, sigV4CredentialsMsg},
+		}),
+		Entry("with an invalid hmac signing", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                 "foo",
+						Path:               "/foo",
+						URI:                "https://foo",
+						MaxRequestBodySize: 1024,
+						Signing: &options.UpstreamSigning{
+							HMAC: &options.UpstreamHMACSigning{
+								Header: "X Signature",
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{hmacKeyMsg, hmacHeaderMsg},
+		}),
+		Entry("with an invalid scope", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:     "foo",
+						Path:   "/foo",
+						URI:    "http://foo",
+						Scopes: []string{"calendar.read", "calendar read"},
+					},
+				},
+			},
+			errStrings: []string{invalidScopeMsg},
+		}),
+		Entry("with a negative circuit breaker threshold", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						CircuitBreaker: &options.UpstreamCircuitBreaker{
+							FailureThreshold: -1,
+						},
+					},
+				},
+			},
+			errStrings: []string{circuitBreakerNegativeMsg},
+		}),
+		Entry("with a circuit breaker on a static upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:     "foo",
+						Path:   "/foo",
+						Static: true,
+						CircuitBreaker: &options.UpstreamCircuitBreaker{
+							FailureThreshold: 5,
+						},
+					},
+				},
+			},
+			errStrings: []string{circuitBreakerStaticMsg},
+		}),
+		Entry("with an invalid circuit breaker fallback", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						CircuitBreaker: &options.UpstreamCircuitBreaker{
+							FailureThreshold: 5,
+							FallbackURI:      "file://var/lib/foo",
+							ErrorPage:        "/does/not/exist.html",
+						},
+					},
+				},
+			},
+			errStrings: []string{circuitBreakerFallbackSchemeMsg, circuitBreakerErrorPageMsg},
+		}),
+		Entry("with a missing circuit breaker error page", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						CircuitBreaker: &options.UpstreamCircuitBreaker{
+							FailureThreshold: 5,
+							ErrorPage:        "/does/not/exist.html",
+						},
+					},
+				},
+			},
+			errStrings: []string{circuitBreakerMissingPageMsg},
+		}),
+		Entry("with a valid timeout budget", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{validHTTPUpstream},
+				TimeoutBudget: &options.UpstreamTimeoutBudget{
+					Header:          "X-Request-Timeout-Ms",
+					TrustedNetworks: []string{"10.0.0.0/8", "::1"},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with an invalid timeout budget", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{validHTTPUpstream},
+				TimeoutBudget: &options.UpstreamTimeoutBudget{
+					TrustedNetworks: []string{"10.0.0.0/8", "10.0.0.0/33"},
+				},
+			},
+			errStrings: []string{timeoutBudgetHeaderMsg, timeoutBudgetNetworkMsg},
+		}),
+		Entry("with valid response header filters", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                     "foo",
+						Path:                   "/foo",
+						URI:                    "http://localhost:8080",
+						AllowedResponseHeaders: []string{"Cache-Control", "X-App-*"},
+						DeniedResponseHeaders:  []string{"Server", "X-App-Debug-*"},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid response header filters", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                     "foo",
+						Path:                   "/foo",
+						URI:                    "http://localhost:8080",
+						AllowedResponseHeaders: []string{"Cache-Control", ""},
+						DeniedResponseHeaders:  []string{"X-*-Debug"},
+					},
+				},
+			},
+			errStrings: []string{allowedResponseHeaderMsg, deniedResponseHeaderMsg},
+		}),
+		Entry("with valid response headers", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				ResponseHeaders: &options.ResponseHeaders{
+					Strip: []string{"Server"},
+					Inject: []options.Header{
+						{Name: "X-Frame-Options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("DENY")}}}},
+					},
+				},
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://localhost:8080",
+						ResponseHeaders: &options.ResponseHeaders{
+							Strip: []string{"X-Powered-By"},
+							Inject: []options.Header{
+								{Name: "X-Frame-Options", Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("SAMEORIGIN")}}}},
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid response headers", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				ResponseHeaders: &options.ResponseHeaders{
+					Strip: []string{"*"},
+				},
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://localhost:8080",
+						ResponseHeaders: &options.ResponseHeaders{
+							Inject: []options.Header{
+								{Values: []options.HeaderValue{{SecretSource: &options.SecretSource{Value: []byte("DENY")}}}},
+							},
+						},
+					},
+				},
+			},
+			errStrings: []string{strippedResponseHeaderMsg, injectedResponseHeaderMsg},
+		}),
+		Entry("with response headers on a static upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:              "foo",
+						Path:            "/foo",
+						Static:          true,
+						ResponseHeaders: &options.ResponseHeaders{Strip: []string{"Server"}},
+					},
+				},
+			},
+			errStrings: []string{staticWithResponseHeadersMsg},
+		}),
+		Entry("with body size limits and client timeouts", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                  "foo",
+						Path:                "/foo",
+						URI:                 "http://foo",
+						MaxRequestBodySize:  1 << 20,
+						MaxResponseBodySize: 10 << 20,
+						ClientReadTimeout:   &clientTimeout,
+						ClientWriteTimeout:  &clientTimeout,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with negative body size limits and client timeouts", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                 "foo",
+						Path:               "/foo",
+						URI:                "http://foo",
+						MaxRequestBodySize: -1,
+						ClientWriteTimeout: &negativeSecond,
+					},
+				},
+			},
+			errStrings: []string{negativeRequestBodySizeMsg, negativeClientWriteTimeoutMsg},
+		}),
+		Entry("with body size limits on a file upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:                 "foo",
+						Path:               "/foo",
+						URI:                "file://var/lib/foo",
+						MaxRequestBodySize: 1024,
+					},
+				},
+			},
+			errStrings: []string{fileWithLimitsMsg},
+		}),
+		Entry("with load balanced targets", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						Targets: []options.UpstreamTarget{
+							{URI: "http://foo-1", Weight: 2},
+							{URI: "unix:///var/run/foo.sock"},
+						},
+						HealthCheck: &options.UpstreamHealthCheck{Path: "/healthz", FailureThreshold: 3},
+						H2C:         true,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with invalid targets", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo",
+						Targets: []options.UpstreamTarget{
+							{URI: "http://foo-1", Weight: -1},
+							{URI: "file://var/lib/foo"},
+						},
+						HealthCheck: &options.UpstreamHealthCheck{Path: "healthz"},
+					},
+				},
+			},
+			errStrings: []string{uriWithTargetsMsg, targetWeightMsg, targetSchemeMsg, healthCheckPathMsg},
+		}),
+		Entry("with a health check without targets", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:          "foo",
+						Path:        "/foo",
+						URI:         "http://foo",
+						HealthCheck: &options.UpstreamHealthCheck{Path: "/healthz"},
+					},
+				},
+			},
+			errStrings: []string{healthCheckWithoutTargetsMsg},
+		}),
+		Entry("with h2c on an HTTP upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "http://foo:50051",
+						H2C:  true,
+					},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with h2c on an HTTPS upstream", &validateUpstreamTableInput{
+			upstreams: options.UpstreamConfig{
+				Upstreams: []options.Upstream{
+					{
+						ID:   "foo",
+						Path: "/foo",
+						URI:  "https://foo:50051",
+						H2C:  true,
+					},
+				},
+			},
+			errStrings: []string{httpsWithH2CMsg},
+		}),
 	)
 })
@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+)
+
+// validateVirtualHosts checks that each virtual host serves at least one
+// host, uses a configured provider and has valid upstreams
+func validateVirtualHosts(o *options.Options) []string {
+	msgs := []string{}
+
+	providerIDs := make(map[string]struct{}, len(o.Providers))
+	for _, provider := range o.Providers {
+		providerIDs[provider.ID] = struct{}{}
+	}
+
+	for i, vhost := range o.VirtualHosts {
+		prefix := fmt.Sprintf("virtualHosts[%d]: ", i)
+		if len(vhost.Hosts) == 0 {
+			msgs = append(msgs, prefix+"at least one host is required")
+		}
+		if vhost.ProviderID != "" {
+			if _, ok := providerIDs[vhost.ProviderID]; !ok {
+				msgs = append(msgs, fmt.Sprintf("%sprovider %q is not configured", prefix, vhost.ProviderID))
+			}
+		}
+		msgs = append(msgs, prefixValues(prefix, validateUpstreams(vhost.Upstreams)...)...)
+	}
+	return msgs
+}
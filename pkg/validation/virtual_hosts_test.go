@@ -0,0 +1,64 @@
+package validation
+
+import (
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VirtualHosts", func() {
+	type validateVirtualHostsTableInput struct {
+		virtualHosts options.VirtualHosts
+		errStrings   []string
+	}
+
+	DescribeTable("validateVirtualHosts",
+		func(in validateVirtualHostsTableInput) {
+			opts := &options.Options{
+				Providers:    options.Providers{{ID: "default"}, {ID: "github"}},
+				VirtualHosts: in.virtualHosts,
+			}
+			Expect(validateVirtualHosts(opts)).To(ConsistOf(in.errStrings))
+		},
+		Entry("with no virtual hosts", validateVirtualHostsTableInput{
+			errStrings: []string{},
+		}),
+		Entry("with a valid virtual host", validateVirtualHostsTableInput{
+			virtualHosts: options.VirtualHosts{
+				{
+					Hosts:      []string{"app.example.com"},
+					ProviderID: "github",
+					Upstreams: options.UpstreamConfig{
+						Upstreams: []options.Upstream{{ID: "app", Path: "/", URI: "http://app.internal"}},
+					},
+					CookieDomain:  ".example.com",
+					AllowedGroups: []string{"admins"},
+				},
+			},
+			errStrings: []string{},
+		}),
+		Entry("with no hosts and an unknown provider", validateVirtualHostsTableInput{
+			virtualHosts: options.VirtualHosts{
+				{Hosts: []string{"app.example.com"}},
+				{ProviderID: "gitlab"},
+			},
+			errStrings: []string{
+				"virtualHosts[1]: at least one host is required",
+				"virtualHosts[1]: provider \"gitlab\" is not configured",
+			},
+		}),
+		Entry("with an invalid upstream", validateVirtualHostsTableInput{
+			virtualHosts: options.VirtualHosts{
+				{
+					Hosts: []string{"app.example.com"},
+					Upstreams: options.UpstreamConfig{
+						Upstreams: []options.Upstream{{Path: "/", URI: "http://app.internal"}},
+					},
+				},
+			},
+			errStrings: []string{
+				"virtualHosts[0]: upstream has empty id: ids are required for all upstreams",
+			},
+		}),
+	)
+})
@@ -0,0 +1,168 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mbland/hmacauth"
+	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
+)
+
+// maxRequestSize is the maximum size of a verification request, including
+// the body of the request being verified
+const maxRequestSize = 10 << 20
+
+// signatureErrors describe the results of the signature check that are not a
+// match
+var signatureErrors = map[hmacauth.AuthenticationResult]string{
+	hmacauth.ResultNoSignature:          "missing signature",
+	hmacauth.ResultInvalidFormat:        "malformed signature",
+	hmacauth.ResultUnsupportedAlgorithm: "unsupported signature algorithm",
+	hmacauth.ResultMismatch:             "invalid signature",
+}
+
+// Options configures how the headers attached by the proxy are verified
+type Options struct {
+	// SignatureKey is the `algorithm:secret` key the proxy signs requests
+	// with in the GAP-Signature header. The signature is required when set.
+	SignatureKey string
+	// TokenVerifier verifies the ID token the proxy passes in the
+	// Authorization header. The token is required when set.
+	TokenVerifier internaloidc.IDTokenVerifier
+}
+
+// Request is a request received by an application, as forwarded by the proxy
+type Request struct {
+	// Method is the method of the request
+	Method string `json:"method"`
+	// URI is the path and query of the request
+	URI string `json:"uri"`
+	// Headers are the headers of the request
+	Headers http.Header `json:"headers"`
+	// Body is the body of the request, base64 encoded in JSON. It is part of
+	// the signature.
+	Body []byte `json:"body,omitempty"`
+}
+
+// Response is the outcome of the verification of a request
+type Response struct {
+	// Valid is whether the headers of the request were attached by the proxy
+	Valid bool `json:"valid"`
+	// Error is the reason the request is not valid
+	Error string `json:"error,omitempty"`
+
+	// User, Email and PreferredUsername are the identity headers of a valid
+	// request
+	User              string `json:"user,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferredUsername,omitempty"`
+	// Subject is the subject of the verified ID token
+	Subject string `json:"subject,omitempty"`
+}
+
+// Verifier verifies the headers the proxy attached to requests received by
+// an application
+type Verifier struct {
+	auth          hmacauth.HmacAuth
+	tokenVerifier internaloidc.IDTokenVerifier
+}
+
+// NewVerifier creates a Verifier from the options
+func NewVerifier(opts Options) (*Verifier, error) {
+	v := &Verifier{tokenVerifier: opts.TokenVerifier}
+
+	if opts.SignatureKey != "" {
+		algorithm, secret, ok := strings.Cut(opts.SignatureKey, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid signature hash:key spec: %s", opts.SignatureKey)
+		}
+		hash, err := hmacauth.DigestNameToCryptoHash(algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported signature hash algorithm: %s", algorithm)
+		}
+		v.auth = hmacauth.NewHmacAuth(hash, []byte(secret), upstream.SignatureHeader, upstream.SignatureHeaders)
+	}
+
+	if v.auth == nil && v.tokenVerifier == nil {
+		return nil, errors.New("a signature key or an ID token verifier is required")
+	}
+	return v, nil
+}
+
+// Verify checks the signature and the ID token of the request, as configured
+func (v *Verifier) Verify(ctx context.Context, r Request) Response {
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URI, nil)
+	if err != nil {
+		return Response{Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+	req.Header = r.Headers
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if len(r.Body) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(r.Body))
+	}
+
+	resp := Response{}
+	if v.auth != nil {
+		result, _, _ := v.auth.AuthenticateRequest(req)
+		if result != hmacauth.ResultMatch {
+			return Response{Error: signatureErrors[result]}
+		}
+	}
+
+	if v.tokenVerifier != nil {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return Response{Error: "missing bearer ID token"}
+		}
+		idToken, err := v.tokenVerifier.Verify(ctx, token)
+		if err != nil {
+			return Response{Error: fmt.Sprintf("invalid ID token: %v", err)}
+		}
+		resp.Subject = idToken.Subject
+	}
+
+	resp.Valid = true
+	resp.User = req.Header.Get("X-Forwarded-User")
+	resp.Email = req.Header.Get("X-Forwarded-Email")
+	resp.PreferredUsername = req.Header.Get("X-Forwarded-Preferred-Username")
+	return resp
+}
+
+// ServeHTTP verifies a JSON encoded Request posted by an application.
+// It responds with the JSON encoded Response, with a 200 status when the
+// request is valid and a 401 status otherwise.
+func (v *Verifier) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var r Request
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, maxRequestSize)).Decode(&r); err != nil {
+		writeResponse(rw, http.StatusBadRequest, Response{Error: fmt.Sprintf("invalid verification request: %v", err)})
+		return
+	}
+
+	resp := v.Verify(req.Context(), r)
+	status := http.StatusOK
+	if !resp.Valid {
+		status = http.StatusUnauthorized
+	}
+	writeResponse(rw, status, resp)
+}
+
+func writeResponse(rw http.ResponseWriter, status int, resp Response) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(resp)
+}
@@ -0,0 +1,168 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/mbland/hmacauth"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/upstream"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeTokenVerifier struct{}
+
+func (fakeTokenVerifier) Verify(_ context.Context, raw string) (*oidc.IDToken, error) {
+	if raw != "good-token" {
+		return nil, errors.New("bad token")
+	}
+	return &oidc.IDToken{Subject: "1234"}, nil
+}
+
+var _ = Describe("Verify", func() {
+	const signatureKey = "sha256:secret"
+
+	var signed Request
+
+	BeforeEach(func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/things?id=1", bytes.NewReader([]byte("payload")))
+		req.Header.Set("X-Forwarded-User", "1234")
+		req.Header.Set("X-Forwarded-Email", "john@example.com")
+		req.Header.Set("Authorization", "Bearer good-token")
+		hmacauth.NewHmacAuth(crypto.SHA256, []byte("secret"), upstream.SignatureHeader, upstream.SignatureHeaders).SignRequest(req)
+
+		signed = Request{
+			Method:  http.MethodPost,
+			URI:     "/api/things?id=1",
+			Headers: req.Header,
+			Body:    []byte("payload"),
+		}
+	})
+
+	It("requires a signature key or an ID token verifier", func() {
+		_, err := NewVerifier(Options{})
+		Expect(err).To(MatchError("a signature key or an ID token verifier is required"))
+
+		_, err = NewVerifier(Options{SignatureKey: "md4:secret"})
+		Expect(err).To(MatchError("unsupported signature hash algorithm: md4"))
+	})
+
+	Context("with a signature key", func() {
+		var v *Verifier
+
+		BeforeEach(func() {
+			var err error
+			v, err = NewVerifier(Options{SignatureKey: signatureKey})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts a request signed by the proxy", func() {
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{
+				Valid: true,
+				User:  "1234",
+				Email: "john@example.com",
+			}))
+		})
+
+		It("rejects a request with a tampered identity header", func() {
+			signed.Headers.Set("X-Forwarded-Email", "admin@example.com")
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{Error: "invalid signature"}))
+		})
+
+		It("rejects a request with a tampered body", func() {
+			signed.Body = []byte("other")
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{Error: "invalid signature"}))
+		})
+
+		It("rejects a request without a signature", func() {
+			signed.Headers.Del(upstream.SignatureHeader)
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{Error: "missing signature"}))
+		})
+	})
+
+	Context("with an ID token verifier", func() {
+		var v *Verifier
+
+		BeforeEach(func() {
+			var err error
+			v, err = NewVerifier(Options{SignatureKey: signatureKey, TokenVerifier: fakeTokenVerifier{}})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts a request with a valid ID token", func() {
+			resp := v.Verify(context.Background(), signed)
+			Expect(resp.Valid).To(BeTrue())
+			Expect(resp.Subject).To(Equal("1234"))
+		})
+
+		It("rejects a request without an ID token", func() {
+			v.auth = nil
+			signed.Headers.Del("Authorization")
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{Error: "missing bearer ID token"}))
+		})
+
+		It("rejects a request with an invalid ID token", func() {
+			v.auth = nil
+			signed.Headers.Set("Authorization", "Bearer bad-token")
+			Expect(v.Verify(context.Background(), signed)).To(Equal(Response{Error: "invalid ID token: bad token"}))
+		})
+	})
+
+	Context("ServeHTTP", func() {
+		var v *Verifier
+
+		BeforeEach(func() {
+			var err error
+			v, err = NewVerifier(Options{SignatureKey: signatureKey})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		serve := func(method string, body []byte) (*httptest.ResponseRecorder, Response) {
+			rw := httptest.NewRecorder()
+			v.ServeHTTP(rw, httptest.NewRequest(method, "/verify", bytes.NewReader(body)))
+
+			var resp Response
+			if rw.Header().Get("Content-Type") == "application/json" {
+				Expect(json.Unmarshal(rw.Body.Bytes(), &resp)).To(Succeed())
+			}
+			return rw, resp
+		}
+
+		It("responds 200 to a valid request", func() {
+			body, err := json.Marshal(signed)
+			Expect(err).ToNot(HaveOccurred())
+
+			rw, resp := serve(http.MethodPost, body)
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(resp.Valid).To(BeTrue())
+			Expect(resp.Email).To(Equal("john@example.com"))
+		})
+
+		It("responds 401 to an invalid request", func() {
+			signed.Headers.Set("X-Forwarded-User", "admin")
+			body, err := json.Marshal(signed)
+			Expect(err).ToNot(HaveOccurred())
+
+			rw, resp := serve(http.MethodPost, body)
+			Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Valid).To(BeFalse())
+		})
+
+		It("responds 400 to a malformed request", func() {
+			rw, resp := serve(http.MethodPost, []byte("{"))
+			Expect(rw.Code).To(Equal(http.StatusBadRequest))
+			Expect(resp.Error).To(HavePrefix("invalid verification request"))
+		})
+
+		It("only accepts POST requests", func() {
+			rw, _ := serve(http.MethodGet, nil)
+			Expect(rw.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// retryInterval is how long to wait before retrying a task that failed
+const retryInterval = time.Second
+
+// Task primes a dependency of the proxy, such as a connection to the session
+// store, so that the first requests served do not pay for it
+type Task struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+// WarmUp runs warm-up tasks when the proxy starts, and reports the proxy as
+// not ready until they have finished
+type WarmUp struct {
+	tasks         []Task
+	timeout       time.Duration
+	retryInterval time.Duration
+	done          chan struct{}
+}
+
+// New creates a WarmUp running the tasks for at most the timeout
+func New(timeout time.Duration, tasks ...Task) *WarmUp {
+	return &WarmUp{
+		tasks:         tasks,
+		timeout:       timeout,
+		retryInterval: retryInterval,
+		done:          make(chan struct{}),
+	}
+}
+
+// Start runs the tasks concurrently, retrying each task that fails until it
+// succeeds or the timeout passes. Tasks that do not succeed in time are
+// logged and given up on, so that a dependency that is down does not keep
+// the proxy from becoming ready.
+// It implements the Server interface so that it can run alongside the
+// servers of the proxy.
+func (w *WarmUp) Start(ctx context.Context) error {
+	defer close(w.done)
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, task := range w.tasks {
+		wg.Add(1)
+		go func(task Task) {
+			defer wg.Done()
+			w.run(ctx, task)
+		}(task)
+	}
+	wg.Wait()
+
+	logger.Printf("Warm-up finished in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (w *WarmUp) run(ctx context.Context, task Task) {
+	start := time.Now()
+	for {
+		err := task.Run(ctx)
+		if err == nil {
+			logger.Printf("Warmed up %s in %s", task.Name, time.Since(start).Round(time.Millisecond))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Errorf("Error warming up %s: %v", task.Name, err)
+			return
+		case <-time.After(w.retryInterval):
+		}
+	}
+}
+
+// VerifyConnection returns an error until the warm-up has finished, so that
+// the readiness check fails while the proxy is warming up
+func (w *WarmUp) VerifyConnection(_ context.Context) error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+		return errors.New("warming up")
+	}
+}
+
+// ResolveHostsTask resolves the hosts of the URLs, priming DNS caches
+// between the proxy and the name servers.
+// URLs with IP addresses or without hosts, such as unix sockets, are skipped.
+func ResolveHostsTask(name string, urls []string) Task {
+	hosts := []string{}
+	seen := make(map[string]struct{})
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if _, ok := seen[host]; ok || host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+		seen[host] = struct{}{}
+		hosts = append(hosts, host)
+	}
+
+	return Task{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			for _, host := range hosts {
+				if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
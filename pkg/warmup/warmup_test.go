@@ -0,0 +1,80 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WarmUp", func() {
+	It("is not ready until the tasks have finished", func() {
+		release := make(chan struct{})
+		w := New(time.Minute, Task{
+			Name: "blocking",
+			Run: func(ctx context.Context) error {
+				<-release
+				return nil
+			},
+		})
+
+		started := make(chan error)
+		go func() { started <- w.Start(context.Background()) }()
+
+		Consistently(func() error { return w.VerifyConnection(context.Background()) }, 50*time.Millisecond).Should(MatchError("warming up"))
+		close(release)
+		Eventually(started).Should(Receive(BeNil()))
+		Expect(w.VerifyConnection(context.Background())).To(Succeed())
+	})
+
+	It("retries a task until it succeeds", func() {
+		var runs int32
+		w := New(time.Minute, Task{
+			Name: "flaky",
+			Run: func(_ context.Context) error {
+				if atomic.AddInt32(&runs, 1) < 3 {
+					return errors.New("not yet")
+				}
+				return nil
+			},
+		})
+		w.retryInterval = time.Millisecond
+
+		Expect(w.Start(context.Background())).To(Succeed())
+		Expect(atomic.LoadInt32(&runs)).To(BeEquivalentTo(3))
+		Expect(w.VerifyConnection(context.Background())).To(Succeed())
+	})
+
+	It("gives up on a task when the timeout passes", func() {
+		w := New(20*time.Millisecond, Task{
+			Name: "failing",
+			Run:  func(_ context.Context) error { return errors.New("down") },
+		})
+		w.retryInterval = time.Millisecond
+
+		Expect(w.Start(context.Background())).To(Succeed())
+		Expect(w.VerifyConnection(context.Background())).To(Succeed())
+	})
+
+	Context("ResolveHostsTask", func() {
+		It("skips URLs without host names", func() {
+			task := ResolveHostsTask("upstreams", []string{
+				"http://127.0.0.1:8080",
+				"http://[::1]/",
+				"unix:///var/run/app.sock",
+				"file:///var/www",
+				"%",
+			})
+			Expect(task.Name).To(Equal("upstreams"))
+			Expect(task.Run(context.Background())).To(Succeed())
+		})
+
+		It("resolves the host names of the URLs", func() {
+			task := ResolveHostsTask("upstreams", []string{"http://localhost:8080", "https://localhost/app"})
+			Expect(task.Run(context.Background())).To(Succeed())
+		})
+	})
+})
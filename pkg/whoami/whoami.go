@@ -0,0 +1,84 @@
+package whoami
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+)
+
+// Redacted replaces the values of redacted claims
+const Redacted = "[REDACTED]"
+
+// Snapshot is the decoded session of a user, rendered to debug why they are,
+// or are not, allowed access. The raw tokens are never included, only the
+// claims they carry.
+type Snapshot struct {
+	// Provider is the name of the provider the user signed in with
+	Provider string `json:"provider,omitempty"`
+	// ProviderID is the ID of the provider the user signed in with
+	ProviderID string `json:"providerID,omitempty"`
+	// Authorized is whether the session passes the email and group checks
+	Authorized bool `json:"authorized"`
+
+	User              string   `json:"user,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	PreferredUsername string   `json:"preferredUsername,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	ExpiresOn *time.Time `json:"expiresOn,omitempty"`
+	Expired   bool       `json:"expired"`
+
+	// Tokens are the types of token held by the session
+	Tokens []string `json:"tokens"`
+	// IDTokenClaims are the claims of the ID token
+	IDTokenClaims map[string]interface{} `json:"idTokenClaims,omitempty"`
+	// AccessTokenClaims are the claims of the access token, when it is a JWT
+	AccessTokenClaims map[string]interface{} `json:"accessTokenClaims,omitempty"`
+}
+
+// NewSnapshot decodes the session, redacting the values of the redactClaims
+func NewSnapshot(session *sessions.SessionState, redactClaims []string) *Snapshot {
+	snapshot := &Snapshot{
+		ProviderID:        session.ProviderID,
+		User:              session.User,
+		Email:             session.Email,
+		PreferredUsername: session.PreferredUsername,
+		Groups:            session.Groups,
+		CreatedAt:         session.CreatedAt,
+		ExpiresOn:         session.ExpiresOn,
+		Expired:           session.IsExpired(),
+		Tokens:            []string{},
+	}
+
+	if session.AccessToken != "" {
+		snapshot.Tokens = append(snapshot.Tokens, "access_token")
+		snapshot.AccessTokenClaims = decodeClaims(session.AccessToken, redactClaims)
+	}
+	if session.IDToken != "" {
+		snapshot.Tokens = append(snapshot.Tokens, "id_token")
+		snapshot.IDTokenClaims = decodeClaims(session.IDToken, redactClaims)
+	}
+	if session.RefreshToken != "" {
+		snapshot.Tokens = append(snapshot.Tokens, "refresh_token")
+	}
+
+	return snapshot
+}
+
+// decodeClaims returns the claims of the token, without verifying it again,
+// or nil when the token is not a JWT
+func decodeClaims(token string, redactClaims []string) map[string]interface{} {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil
+	}
+
+	for _, claim := range redactClaims {
+		if _, ok := claims[claim]; ok {
+			claims[claim] = Redacted
+		}
+	}
+	return claims
+}
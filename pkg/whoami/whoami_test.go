@@ -0,0 +1,60 @@
+package whoami
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	newToken := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		return token
+	}
+
+	It("decodes the claims of the tokens of the session", func() {
+		expiresOn := time.Now().Add(time.Hour)
+		session := &sessions.SessionState{
+			ProviderID:   "entra",
+			User:         "user",
+			Email:        "user@example.com",
+			Groups:       []string{"admins"},
+			ExpiresOn:    &expiresOn,
+			AccessToken:  "opaque-access-token",
+			IDToken:      newToken(jwt.MapClaims{"sub": "user", "groups": []string{"admins"}}),
+			RefreshToken: "refresh-token",
+		}
+
+		snapshot := NewSnapshot(session, nil)
+		Expect(snapshot.ProviderID).To(Equal("entra"))
+		Expect(snapshot.Groups).To(Equal([]string{"admins"}))
+		Expect(snapshot.Expired).To(BeFalse())
+		Expect(snapshot.Tokens).To(Equal([]string{"access_token", "id_token", "refresh_token"}))
+		Expect(snapshot.IDTokenClaims).To(Equal(map[string]interface{}{
+			"sub":    "user",
+			"groups": []interface{}{"admins"},
+		}))
+		Expect(snapshot.AccessTokenClaims).To(BeNil())
+	})
+
+	It("redacts the claims of the tokens", func() {
+		session := &sessions.SessionState{
+			AccessToken: newToken(jwt.MapClaims{"sub": "user", "email": "user@example.com"}),
+			IDToken:     newToken(jwt.MapClaims{"sub": "user", "email": "user@example.com"}),
+		}
+
+		snapshot := NewSnapshot(session, []string{"email", "phone_number"})
+		Expect(snapshot.IDTokenClaims).To(Equal(map[string]interface{}{"sub": "user", "email": Redacted}))
+		Expect(snapshot.AccessTokenClaims).To(Equal(map[string]interface{}{"sub": "user", "email": Redacted}))
+	})
+
+	It("lists no tokens for a session without any", func() {
+		snapshot := NewSnapshot(&sessions.SessionState{Email: "user@example.com"}, nil)
+		Expect(snapshot.Tokens).To(BeEmpty())
+		Expect(snapshot.IDTokenClaims).To(BeNil())
+	})
+})
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/probe"
+	"github.com/spf13/pflag"
+)
+
+// probeCommand is the subcommand that runs a smoke test of a deployed proxy
+const probeCommand = "probe"
+
+// runProbe runs the probe subcommand with its arguments and returns the exit
+// code of the command
+func runProbe(args []string) int {
+	flagSet := pflag.NewFlagSet("oauth2-proxy probe", pflag.ContinueOnError)
+
+	opts := probe.Options{Out: os.Stderr}
+	flagSet.StringVar(&opts.URL, "url", "", "the URL of an application protected by the proxy, ideally an upstream that echoes the request headers")
+	flagSet.StringVar(&opts.ProxyPrefix, "proxy-prefix", "/oauth2", "the url root path that the proxy endpoints are served under")
+	flagSet.StringVar(&opts.CookieName, "cookie-name", "_oauth2_proxy", "the name of the session cookie")
+	flagSet.StringVar(&opts.TokenURL, "token-url", "", "the token endpoint of the provider")
+	flagSet.StringVar(&opts.DeviceAuthURL, "device-auth-url", "", "the device authorization endpoint of the provider, to sign in the test account with the device flow instead of its password")
+	flagSet.StringVar(&opts.ClientID, "client-id", "", "the client ID requesting tokens for the test account")
+	flagSet.StringVar(&opts.ClientSecret, "client-secret", "", "the client secret requesting tokens for the test account")
+	flagSet.StringVar(&opts.Scope, "scope", "openid email profile", "the scope of the tokens requested for the test account")
+	flagSet.StringVar(&opts.Username, "username", "", "the username of the test account")
+	flagSet.StringVar(&opts.Password, "password", os.Getenv("OAUTH2_PROXY_PROBE_PASSWORD"), "the password of the test account (defaults to $OAUTH2_PROXY_PROBE_PASSWORD)")
+	flagSet.StringSliceVar(&opts.ExpectHeaders, "expect-header", []string{}, "a header the proxy must inject into requests to the application (may be given multiple times)")
+	timeout := flagSet.Duration("timeout", time.Minute, "the maximum duration of the probe")
+
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if opts.URL == "" || opts.TokenURL == "" || opts.ClientID == "" {
+		fmt.Fprintln(os.Stderr, "--url, --token-url and --client-id are required")
+		flagSet.PrintDefaults()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	results := probe.Run(ctx, opts)
+	fmt.Print(results)
+	if results.Failed() {
+		return 1
+	}
+	return 0
+}
@@ -6,16 +6,20 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
 	"golang.org/x/exp/slices"
 
 	"github.com/bitly/go-simplejson"
+	"github.com/coreos/go-oidc/v3/oidc"
 
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/middleware"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	providerutil "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/util"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
 )
@@ -25,7 +29,20 @@ type AzureProvider struct {
 	*ProviderData
 	Tenant          string
 	GraphGroupField string
+	SkipGraphGroups bool
 	isV2Endpoint    bool
+
+	// GraphMaxPages limits the pages of groups requested from Microsoft Graph,
+	// every page is requested when it is 0
+	GraphMaxPages int
+	// GraphTimeout bounds each request to Microsoft Graph when it is set
+	GraphTimeout time.Duration
+	// AllowedTenants are the tenants users may sign in from, every tenant is
+	// allowed when it is empty
+	AllowedTenants []string
+
+	// graphGroupFields are the comma separated fields of the GraphGroupField
+	graphGroupFields []string
 }
 
 var _ Provider = (*AzureProvider)(nil)
@@ -34,6 +51,13 @@ const (
 	azureProviderName           = "Azure"
 	azureDefaultScope           = "openid"
 	azureDefaultGraphGroupField = "id"
+
+	// azureRolesClaim holds the app roles assigned to the user for the
+	// application
+	azureRolesClaim = "roles"
+
+	// azureConsumersTenantID is the tenant of personal Microsoft accounts
+	azureConsumersTenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
 )
 
 var (
@@ -57,6 +81,10 @@ var (
 		Host:   "graph.microsoft.com",
 		Path:   "/v1.0/me",
 	}
+
+	// azureTenantIDRegex matches the GUID of a tenant, such as
+	// `9188040d-6c67-4c5b-b112-36a304b66dad`
+	azureTenantIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 )
 
 // NewAzureProvider initiates a new AzureProvider
@@ -107,11 +135,26 @@ func NewAzureProvider(p *ProviderData, opts options.AzureOptions) *AzureProvider
 		}
 	}
 
+	var graphTimeout time.Duration
+	if opts.GraphTimeout != nil {
+		graphTimeout = opts.GraphTimeout.Duration()
+	}
+
+	if isAzureMultiTenant(tenant) && p.Verifier != nil && len(opts.AllowedTenants) == 0 {
+		logger.Printf("WARNING: tokens from every tenant are accepted with the %q Azure endpoint, set allowed tenants to restrict them", tenant)
+	}
+
 	return &AzureProvider{
 		ProviderData:    p,
 		Tenant:          tenant,
 		GraphGroupField: graphGroupField,
+		SkipGraphGroups: opts.SkipGraphGroups,
 		isV2Endpoint:    isV2Endpoint,
+		GraphMaxPages:   opts.GraphMaxPages,
+		GraphTimeout:    graphTimeout,
+		AllowedTenants:  opts.AllowedTenants,
+
+		graphGroupFields: splitGraphGroupField(graphGroupField),
 	}
 }
 
@@ -124,11 +167,13 @@ func overrideTenantURL(current, defaultURL *url.URL, tenant, path string) {
 	}
 }
 
-func getMicrosoftGraphGroupsURL(profileURL *url.URL, graphGroupField string) *url.URL {
+func getMicrosoftGraphGroupsURL(profileURL *url.URL, graphGroupFields []string) *url.URL {
 
 	selectStatement := "$select=displayName,id"
-	if !slices.Contains([]string{"displayName", "id"}, graphGroupField) {
-		selectStatement += "," + graphGroupField
+	for _, graphGroupField := range graphGroupFields {
+		if !slices.Contains([]string{"displayName", "id"}, graphGroupField) {
+			selectStatement += "," + graphGroupField
+		}
 	}
 
 	// Select only security groups. Due to the filter option, count param is mandatory even if unused otherwise
@@ -209,8 +254,9 @@ func (p *AzureProvider) EnrichSession(ctx context.Context, session *sessions.Ses
 		session.Email = email
 	}
 
-	// If using the v2.0 oidc endpoint we're also querying Microsoft Graph
-	if p.isV2Endpoint {
+	// If using the v2.0 oidc endpoint we're also querying Microsoft Graph,
+	// unless the app roles are used as the groups
+	if p.isV2Endpoint && !p.SkipGraphGroups {
 		groups, err := p.getGroupsFromProfileAPI(ctx, session)
 		if err != nil {
 			return fmt.Errorf("unable to get groups from Microsoft Graph: %v", err)
@@ -264,22 +310,49 @@ func (p *AzureProvider) extractClaimsIntoSession(ctx context.Context, session *s
 	// due to above issues, id_token may not be signed by AAD
 	// in that case, we will fallback to access token
 	var err error
-	s, err = p.buildSessionFromClaims(session.IDToken, session.AccessToken)
+	token := session.IDToken
+	s, err = p.buildSessionFromClaims(ctx, session.IDToken, session.AccessToken)
 	if err != nil || s.Email == "" {
-		s, err = p.buildSessionFromClaims(session.AccessToken, session.AccessToken)
+		token = session.AccessToken
+		s, err = p.buildSessionFromClaims(ctx, session.AccessToken, session.AccessToken)
 	}
 	if err != nil {
 		return fmt.Errorf("unable to get claims from token: %v", err)
 	}
 
+	roles, err := getAppRoles(ctx, token)
+	if err != nil {
+		return fmt.Errorf("unable to get app roles from token: %v", err)
+	}
+
 	session.Email = s.Email
-	if s.Groups != nil {
-		session.Groups = s.Groups
+	if s.Groups != nil || len(roles) > 0 {
+		session.Groups = util.RemoveDuplicateStr(append(s.Groups, roles...))
 	}
 
 	return nil
 }
 
+// getAppRoles returns the app roles assigned to the user for the application
+// in the `roles` claim of the token
+func getAppRoles(ctx context.Context, rawToken string) ([]string, error) {
+	if rawToken == "" {
+		return nil, nil
+	}
+
+	// Roles are only found in the token, the profile URL is not requested
+	extractor, err := providerutil.NewClaimExtractor(ctx, rawToken, &url.URL{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	if _, err := extractor.GetClaimInto(azureRolesClaim, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
 // verifySessionToken tries to validate id_token if present or access token when oidc verifier is configured
 func (p *AzureProvider) verifySessionToken(ctx context.Context, session *sessions.SessionState) error {
 	// Without a verifier there's no way to verify
@@ -287,19 +360,128 @@ func (p *AzureProvider) verifySessionToken(ctx context.Context, session *session
 		return nil
 	}
 
+	var token *oidc.IDToken
+	var err error
 	if session.IDToken != "" {
-		if _, err := p.Verifier.Verify(ctx, session.IDToken); err != nil {
+		if token, err = p.Verifier.Verify(ctx, session.IDToken); err != nil {
 			logger.Printf("unable to verify ID token, fallback to access token: %v", err)
-			if _, err = p.Verifier.Verify(ctx, session.AccessToken); err != nil {
+			if token, err = p.Verifier.Verify(ctx, session.AccessToken); err != nil {
 				return fmt.Errorf("unable to verify access token: %v", err)
 			}
 		}
-	} else if _, err := p.Verifier.Verify(ctx, session.AccessToken); err != nil {
+	} else if token, err = p.Verifier.Verify(ctx, session.AccessToken); err != nil {
 		return fmt.Errorf("unable to verify access token: %v", err)
 	}
+
+	return p.checkTenant(token)
+}
+
+// CreateSessionFromToken converts Bearer IDTokens into sessions, checking that
+// they were issued by one of the AllowedTenants
+func (p *AzureProvider) CreateSessionFromToken(ctx context.Context, token string) (*sessions.SessionState, error) {
+	if p.Verifier == nil {
+		return nil, ErrNotImplemented
+	}
+	verify := func(ctx context.Context, token string) (*oidc.IDToken, error) {
+		idToken, err := p.Verifier.Verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkTenant(idToken); err != nil {
+			return nil, err
+		}
+		return idToken, nil
+	}
+	return middleware.CreateTokenToSessionFunc(verify)(ctx, token)
+}
+
+// checkTenant checks that the verified token was issued by one of the
+// AllowedTenants. The tenant in the issuer URL must match the `tid` claim.
+func (p *AzureProvider) checkTenant(token *oidc.IDToken) error {
+	if len(p.AllowedTenants) == 0 {
+		return nil
+	}
+
+	issuerTenant, err := parseAzureIssuerTenant(token.Issuer)
+	if err != nil {
+		return err
+	}
+
+	var claims struct {
+		TenantID string `json:"tid"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return fmt.Errorf("unable to get the tid claim: %v", err)
+	}
+	if !strings.EqualFold(claims.TenantID, issuerTenant) {
+		return fmt.Errorf("tid claim %q does not match the tenant of issuer %q", claims.TenantID, token.Issuer)
+	}
+
+	if !isAzureTenantAllowed(issuerTenant, p.AllowedTenants) {
+		return fmt.Errorf("tenant %q is not allowed", issuerTenant)
+	}
 	return nil
 }
 
+// parseAzureIssuerTenant returns the tenant ID of an Azure issuer URL, either
+// `https://sts.windows.net/{tenant}/` for v1.0 tokens or
+// `https://login.microsoftonline.com/{tenant}/v2.0` for v2.0 tokens, on any
+// cloud host
+func parseAzureIssuerTenant(issuer string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid issuer %q", issuer)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	switch {
+	case len(segments) == 2 && segments[1] == "":
+	case len(segments) == 2 && segments[1] == "v2.0":
+	default:
+		return "", fmt.Errorf("invalid issuer %q", issuer)
+	}
+
+	if !azureTenantIDRegex.MatchString(segments[0]) {
+		return "", fmt.Errorf("invalid tenant in issuer %q", issuer)
+	}
+	return segments[0], nil
+}
+
+// isAzureTenantAllowed returns whether the tenant ID matches one of the
+// allowed tenants, which deny every tenant they do not list
+func isAzureTenantAllowed(tenantID string, allowedTenants []string) bool {
+	for _, allowed := range allowedTenants {
+		switch allowed {
+		case "*":
+			return true
+		case "organizations":
+			if !strings.EqualFold(tenantID, azureConsumersTenantID) {
+				return true
+			}
+		case "consumers":
+			if strings.EqualFold(tenantID, azureConsumersTenantID) {
+				return true
+			}
+		default:
+			if strings.EqualFold(tenantID, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAzureMultiTenant returns whether the tenant is one of the endpoints that
+// sign in users from several tenants
+func isAzureMultiTenant(tenant string) bool {
+	switch tenant {
+	case "common", "organizations", "consumers":
+		return true
+	default:
+		return false
+	}
+}
+
 // RefreshSession uses the RefreshToken to fetch new Access and ID Tokens
 func (p *AzureProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
 	if s == nil || s.RefreshToken == "" {
@@ -369,42 +551,81 @@ func (p *AzureProvider) getGroupsFromProfileAPI(ctx context.Context, s *sessions
 		return nil, fmt.Errorf("missing access token")
 	}
 
-	groupsURL := getMicrosoftGraphGroupsURL(p.ProfileURL, p.GraphGroupField).String()
+	groupsURL := getMicrosoftGraphGroupsURL(p.ProfileURL, p.graphGroupFields).String()
 
 	// Need and extra header while talking with MS Graph. For more context see
 	// https://docs.microsoft.com/en-us/graph/api/group-list-transitivememberof?view=graph-rest-1.0&tabs=http#request-headers
 	extraHeader := makeAzureHeader(s.AccessToken)
 	extraHeader.Add("ConsistencyLevel", "eventual")
 
+	return p.getGroupsFromGraphPages(ctx, groupsURL, extraHeader)
+}
+
+// getGroupsFromGraphPages requests the pages of groups from Microsoft Graph,
+// following the @odata.nextLink of each page until the last page or the
+// GraphMaxPages limit
+func (p *AzureProvider) getGroupsFromGraphPages(ctx context.Context, groupsURL string, header http.Header) ([]string, error) {
 	var groups []string
 
-	for groupsURL != "" {
-		jsonRequest, err := requests.New(groupsURL).
-			WithContext(ctx).
-			WithHeaders(extraHeader).
-			Do().
-			UnmarshalSimpleJSON()
+	for pages := 0; groupsURL != ""; pages++ {
+		if p.GraphMaxPages > 0 && pages >= p.GraphMaxPages {
+			logger.Printf("WARNING: Microsoft Graph returned more than %d pages of groups, further groups are not added to the session", p.GraphMaxPages)
+			break
+		}
+
+		jsonRequest, err := p.getGraphPage(ctx, groupsURL, header)
 		if err != nil {
 			return nil, fmt.Errorf("unable to unmarshal Microsoft Graph response: %v", err)
-
 		}
 		groupsURL, err = jsonRequest.Get("@odata.nextLink").String()
 		if err != nil {
 			groupsURL = ""
 		}
-		groupsPage := getGroupsFromJSON(jsonRequest, p.GraphGroupField)
+		groupsPage := getGroupsFromJSON(jsonRequest, p.graphGroupFields)
 		groups = append(groups, groupsPage...)
 	}
 
 	return groups, nil
 }
 
-func getGroupsFromJSON(json *simplejson.Json, graphGroupField string) []string {
+// getGraphPage requests a single page from Microsoft Graph, bounded by the
+// GraphTimeout when it is set
+func (p *AzureProvider) getGraphPage(ctx context.Context, pageURL string, header http.Header) (*simplejson.Json, error) {
+	if p.GraphTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.GraphTimeout)
+		defer cancel()
+	}
+
+	return requests.New(pageURL).
+		WithContext(ctx).
+		WithHeaders(header).
+		Do().
+		UnmarshalSimpleJSON()
+}
+
+// splitGraphGroupField splits a comma separated GraphGroupField, such as
+// `id,displayName`, into the fields added to the groups of the session
+func splitGraphGroupField(graphGroupField string) []string {
+	fields := []string{}
+	for _, field := range strings.Split(graphGroupField, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func getGroupsFromJSON(json *simplejson.Json, graphGroupFields []string) []string {
 	groups := []string{}
 
 	for i := range json.Get("value").MustArray() {
-		value := json.Get("value").GetIndex(i).Get(graphGroupField).MustString()
-		groups = append(groups, value)
+		for _, graphGroupField := range graphGroupFields {
+			value := json.Get("value").GetIndex(i).Get(graphGroupField).MustString()
+			if value != "" {
+				groups = append(groups, value)
+			}
+		}
 	}
 
 	return groups
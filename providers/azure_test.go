@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -13,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bitly/go-simplejson"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -367,6 +370,266 @@ func TestAzureProviderRedeem(t *testing.T) {
 	}
 }
 
+func TestAzureProviderAppRoles(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		IsV2Endpoint    bool
+		SkipGraphGroups bool
+	}{
+		{
+			Name: "with the v1.0 endpoint",
+		},
+		{
+			// Microsoft Graph is not available in the test, the groups request
+			// would fail
+			Name:            "with the v2.0 endpoint skipping Microsoft Graph",
+			IsV2Endpoint:    true,
+			SkipGraphGroups: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			idToken, err := newSignedTestIDToken(idTokenClaims{
+				RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"cd6d4fae-f6a6-4a34-8454-2c6b598e9532"}},
+				Email:            "foo@example.com",
+				Groups:           []string{"aa"},
+				Roles:            []string{"Admin", "aa"},
+			})
+			assert.NoError(t, err)
+
+			b := testAzureBackend(`{}`, authorizedAccessToken, "")
+			defer b.Close()
+
+			bURL, _ := url.Parse(b.URL)
+			p := testAzureProvider(bURL.Host, options.AzureOptions{SkipGraphGroups: testCase.SkipGraphGroups})
+			p.isV2Endpoint = testCase.IsV2Endpoint
+
+			session := CreateAuthorizedSession()
+			session.IDToken = idToken
+			assert.NoError(t, p.EnrichSession(context.Background(), session))
+			assert.Equal(t, "foo@example.com", session.Email)
+			assert.Equal(t, []string{"aa", "Admin"}, session.Groups)
+		})
+	}
+}
+
+func TestAzureGraphGroupFields(t *testing.T) {
+	json, err := simplejson.NewJson([]byte(`{
+		"value": [
+			{"displayName": "aa", "id": "11111111-2222-3333-4444-555555555555"},
+			{"id": "555555555555-4444-3333-2222-11111111"}
+		]
+	}`))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		GraphGroupField string
+		Groups          []string
+		Select          string
+	}{
+		{
+			GraphGroupField: "id",
+			Groups:          []string{"11111111-2222-3333-4444-555555555555", "555555555555-4444-3333-2222-11111111"},
+			Select:          "$select=displayName,id",
+		},
+		{
+			GraphGroupField: "displayName",
+			Groups:          []string{"aa"},
+			Select:          "$select=displayName,id",
+		},
+		{
+			GraphGroupField: "id, displayName",
+			Groups:          []string{"11111111-2222-3333-4444-555555555555", "aa", "555555555555-4444-3333-2222-11111111"},
+			Select:          "$select=displayName,id",
+		},
+		{
+			GraphGroupField: "id,mailNickname",
+			Groups:          []string{"11111111-2222-3333-4444-555555555555", "555555555555-4444-3333-2222-11111111"},
+			Select:          "$select=displayName,id,mailNickname",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.GraphGroupField, func(t *testing.T) {
+			p := testAzureProvider("", options.AzureOptions{GraphGroupField: testCase.GraphGroupField})
+			assert.Equal(t, testCase.Groups, getGroupsFromJSON(json, p.graphGroupFields))
+
+			groupsURL := getMicrosoftGraphGroupsURL(&url.URL{Host: "graph.microsoft.com"}, p.graphGroupFields)
+			assert.True(t, strings.HasSuffix(groupsURL.RawQuery, "&"+testCase.Select), groupsURL.RawQuery)
+		})
+	}
+}
+
+func TestAzureGraphPages(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		nextLink := ""
+		switch page {
+		case "":
+			nextLink = fmt.Sprintf(`, "@odata.nextLink": "%s/groups?page=2"`, server.URL)
+		case "2":
+			nextLink = fmt.Sprintf(`, "@odata.nextLink": "%s/groups?page=3"`, server.URL)
+		}
+		fmt.Fprintf(rw, `{"value": [{"id": "group%s"}]%s}`, page, nextLink)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name          string
+		groupsURL     string
+		graphMaxPages int
+		graphTimeout  time.Duration
+		groups        []string
+		expectError   bool
+	}{
+		{
+			name:      "every page",
+			groupsURL: server.URL + "/groups",
+			groups:    []string{"group", "group2", "group3"},
+		},
+		{
+			name:          "with a page limit",
+			groupsURL:     server.URL + "/groups",
+			graphMaxPages: 2,
+			groups:        []string{"group", "group2"},
+		},
+		{
+			name:         "with a timeout",
+			groupsURL:    server.URL + "/groups?page=slow",
+			graphTimeout: 10 * time.Millisecond,
+			expectError:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			p := testAzureProvider("", options.AzureOptions{})
+			p.GraphMaxPages = testCase.graphMaxPages
+			p.GraphTimeout = testCase.graphTimeout
+
+			groups, err := p.getGroupsFromGraphPages(context.Background(), testCase.groupsURL, http.Header{})
+			if testCase.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.groups, groups)
+		})
+	}
+}
+
+func TestAzureProviderAllowedTenants(t *testing.T) {
+	const (
+		tenantID      = "11111111-2222-3333-4444-555555555555"
+		otherTenantID = "66666666-7777-8888-9999-000000000000"
+	)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		allowedTenants []string
+		issuer         string
+		tid            string
+		expectError    bool
+	}{
+		{
+			name:   "without allowed tenants",
+			issuer: "https://issuer.example.com",
+		},
+		{
+			name:           "with an allowed v2.0 tenant",
+			allowedTenants: []string{otherTenantID, tenantID},
+			issuer:         "https://login.microsoftonline.com/" + tenantID + "/v2.0",
+			tid:            tenantID,
+		},
+		{
+			name:           "with an allowed v1.0 tenant",
+			allowedTenants: []string{tenantID},
+			issuer:         "https://sts.windows.net/" + tenantID + "/",
+			tid:            tenantID,
+		},
+		{
+			name:           "with a tenant that is not allowed",
+			allowedTenants: []string{otherTenantID},
+			issuer:         "https://login.microsoftonline.com/" + tenantID + "/v2.0",
+			tid:            tenantID,
+			expectError:    true,
+		},
+		{
+			name:           "with a tid claim not matching the issuer",
+			allowedTenants: []string{"*"},
+			issuer:         "https://login.microsoftonline.com/" + tenantID + "/v2.0",
+			tid:            otherTenantID,
+			expectError:    true,
+		},
+		{
+			name:           "with an issuer containing an allowed tenant",
+			allowedTenants: []string{tenantID},
+			issuer:         "https://evil.example.com/" + otherTenantID + "/" + tenantID + "/v2.0",
+			tid:            tenantID,
+			expectError:    true,
+		},
+		{
+			name:           "with any tenant allowed",
+			allowedTenants: []string{"*"},
+			issuer:         "https://login.microsoftonline.com/" + tenantID + "/v2.0",
+			tid:            tenantID,
+		},
+		{
+			name:           "with organizations and a work tenant",
+			allowedTenants: []string{"organizations"},
+			issuer:         "https://login.microsoftonline.com/" + tenantID + "/v2.0",
+			tid:            tenantID,
+		},
+		{
+			name:           "with organizations and a personal account",
+			allowedTenants: []string{"organizations"},
+			issuer:         "https://login.microsoftonline.com/" + azureConsumersTenantID + "/v2.0",
+			tid:            azureConsumersTenantID,
+			expectError:    true,
+		},
+		{
+			name:           "with consumers and a personal account",
+			allowedTenants: []string{"consumers"},
+			issuer:         "https://login.microsoftonline.com/" + azureConsumersTenantID + "/v2.0",
+			tid:            azureConsumersTenantID,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			idToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"aud": "cd6d4fae-f6a6-4a34-8454-2c6b598e9532",
+				"iss": testCase.issuer,
+				"tid": testCase.tid,
+			}).SignedString(key)
+			assert.NoError(t, err)
+
+			p := testAzureProvider("", options.AzureOptions{AllowedTenants: testCase.allowedTenants})
+			err = p.verifySessionToken(context.Background(), &sessions.SessionState{IDToken: idToken})
+			if testCase.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// Bearer tokens are checked the same way
+			_, err = p.CreateSessionFromToken(context.Background(), idToken)
+			if testCase.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestAzureProviderProtectedResourceConfiguredOAuthV1(t *testing.T) {
 	p := testAzureProvider("", options.AzureOptions{})
 	p.ProtectedResource, _ = url.Parse("http://my.resource.test")
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"context"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// callContextProvider prepares the context of each call to the provider,
+// bounding it with a timeout so that a slow identity provider cannot hold up
+// requests indefinitely, and attaching the retry policy for the requests the
+// provider makes
+type callContextProvider struct {
+	Provider
+	timeout time.Duration
+	retry   *requests.RetryPolicy
+}
+
+// providerTimeout returns the configured timeout for calls to the provider
+func providerTimeout(providerConfig options.Provider) time.Duration {
+	if providerConfig.Timeout == nil {
+		return options.DefaultProviderTimeout
+	}
+	return providerConfig.Timeout.Duration()
+}
+
+// providerRetryPolicy returns the configured retry policy for requests to the
+// provider, or nil if requests are not retried
+func providerRetryPolicy(providerConfig options.Provider) *requests.RetryPolicy {
+	retry := providerConfig.Retry
+	if retry == nil || retry.MaxRetries <= 0 {
+		return nil
+	}
+
+	backoff := retry.Backoff.Duration()
+	if backoff <= 0 {
+		backoff = options.DefaultProviderRetryBackoff
+	}
+	maxBackoff := retry.MaxBackoff.Duration()
+	if maxBackoff <= 0 {
+		maxBackoff = options.DefaultProviderRetryMaxBackoff
+	}
+	budget := retry.Budget
+	if budget <= 0 {
+		budget = options.DefaultProviderRetryBudget
+	}
+	return requests.NewRetryPolicy(retry.MaxRetries, backoff, maxBackoff, budget)
+}
+
+// withCallContext wraps the provider so that each call is bounded by the
+// timeout and retries its requests with the retry policy.
+// A zero timeout and nil retry policy return the provider unchanged.
+func withCallContext(p Provider, timeout time.Duration, retry *requests.RetryPolicy) Provider {
+	if timeout <= 0 && retry == nil {
+		return p
+	}
+	return &callContextProvider{Provider: p, timeout: timeout, retry: retry}
+}
+
+func (p *callContextProvider) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.retry != nil {
+		ctx = requests.WithRetryPolicy(ctx, p.retry)
+	}
+	if p.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+func (p *callContextProvider) Redeem(ctx context.Context, redirectURI, code, codeVerifier string) (*sessions.SessionState, error) {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.Redeem(ctx, redirectURI, code, codeVerifier)
+}
+
+func (p *callContextProvider) GetEmailAddress(ctx context.Context, s *sessions.SessionState) (string, error) {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.GetEmailAddress(ctx, s)
+}
+
+func (p *callContextProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.EnrichSession(ctx, s)
+}
+
+func (p *callContextProvider) Authorize(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.Authorize(ctx, s)
+}
+
+func (p *callContextProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.ValidateSession(ctx, s)
+}
+
+func (p *callContextProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.RefreshSession(ctx, s)
+}
+
+func (p *callContextProvider) CreateSessionFromToken(ctx context.Context, token string) (*sessions.SessionState, error) {
+	ctx, cancel := p.callContext(ctx)
+	defer cancel()
+	return p.Provider.CreateSessionFromToken(ctx, token)
+}
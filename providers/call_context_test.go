@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+)
+
+func TestProviderTimeoutDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	timeout := options.Duration(time.Minute)
+	disabled := options.Duration(0)
+
+	g.Expect(providerTimeout(options.Provider{})).To(Equal(options.DefaultProviderTimeout))
+	g.Expect(providerTimeout(options.Provider{Timeout: &timeout})).To(Equal(time.Minute))
+	g.Expect(providerTimeout(options.Provider{Timeout: &disabled})).To(BeZero())
+
+	p := &ProviderData{}
+	g.Expect(withCallContext(p, 0, nil)).To(BeIdenticalTo(p))
+}
+
+func TestProviderTimeoutRedeem(t *testing.T) {
+	g := NewWithT(t)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	redeemURL, err := url.Parse(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	p := withCallContext(&ProviderData{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedeemURL:    redeemURL,
+	}, 50*time.Millisecond, nil)
+
+	start := time.Now()
+	_, err = p.Redeem(context.Background(), "https://example.com/oauth2/callback", "code", "")
+	g.Expect(err).To(MatchError(ContainSubstring(context.DeadlineExceeded.Error())))
+	g.Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+}
+
+func TestProviderTimeoutKeepsParentDeadline(t *testing.T) {
+	g := NewWithT(t)
+
+	var deadline time.Time
+	p := withCallContext(&deadlineProvider{deadline: &deadline}, time.Hour, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	parentDeadline, _ := ctx.Deadline()
+
+	_, err := p.RefreshSession(ctx, &sessions.SessionState{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(deadline).To(Equal(parentDeadline))
+}
+
+func TestProviderRetryPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(providerRetryPolicy(options.Provider{})).To(BeNil())
+	g.Expect(providerRetryPolicy(options.Provider{Retry: &options.ProviderRetry{}})).To(BeNil())
+	g.Expect(providerRetryPolicy(options.Provider{Retry: &options.ProviderRetry{MaxRetries: 2}})).ToNot(BeNil())
+}
+
+func TestProviderRetryRedeem(t *testing.T) {
+	g := NewWithT(t)
+
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		attempts++
+		if attempts == 1 {
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(`{"access_token": "token"}`))
+	}))
+	defer server.Close()
+
+	redeemURL, err := url.Parse(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	p := withCallContext(&ProviderData{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedeemURL:    redeemURL,
+	}, 0, providerRetryPolicy(options.Provider{
+		Retry: &options.ProviderRetry{MaxRetries: 2, Backoff: options.Duration(time.Millisecond)},
+	}))
+
+	session, err := p.Redeem(context.Background(), "https://example.com/oauth2/callback", "code", "")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(session.AccessToken).To(Equal("token"))
+	g.Expect(attempts).To(Equal(2))
+}
+
+// deadlineProvider records the deadline of the context it is called with
+type deadlineProvider struct {
+	ProviderData
+	deadline *time.Time
+}
+
+func (p *deadlineProvider) RefreshSession(ctx context.Context, _ *sessions.SessionState) (bool, error) {
+	*p.deadline, _ = ctx.Deadline()
+	return false, nil
+}
@@ -0,0 +1,189 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+const (
+	cognitoProviderName = "Cognito"
+
+	// cognitoDefaultScope leaves out the `groups` scope the OIDC provider
+	// requests with allowed groups, which Cognito rejects as invalid
+	cognitoDefaultScope = "openid email profile"
+
+	cognitoGroupsClaim           = "cognito:groups"
+	cognitoUsernameClaim         = "cognito:username"
+	cognitoCustomAttributePrefix = "custom:"
+)
+
+// CognitoProvider creates an AWS Cognito provider based on OIDCProvider
+type CognitoProvider struct {
+	*OIDCProvider
+
+	attributes []string
+}
+
+// NewCognitoProvider makes a CognitoProvider using the ProviderData
+func NewCognitoProvider(p *ProviderData, opts options.Provider) *CognitoProvider {
+	p.setProviderDefaults(providerDefaults{
+		name:  cognitoProviderName,
+		scope: cognitoDefaultScope,
+	})
+	if p.GroupsClaim == "" || p.GroupsClaim == options.OIDCGroupsClaim {
+		p.GroupsClaim = cognitoGroupsClaim
+	}
+
+	provider := &CognitoProvider{
+		OIDCProvider: NewOIDCProvider(p, opts.OIDCConfig),
+		attributes:   opts.CognitoConfig.Attributes,
+	}
+	p.signOutURLFunc = provider.signOutURL
+	return provider
+}
+
+var _ Provider = (*CognitoProvider)(nil)
+
+// EnrichSession adds the username and attributes of the ID token to the session
+func (p *CognitoProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
+	if err := p.OIDCProvider.EnrichSession(ctx, s); err != nil {
+		return fmt.Errorf("could not enrich oidc session: %v", err)
+	}
+	return p.extractAttributes(s)
+}
+
+// RefreshSession adds the username and attributes of the refreshed ID token
+// to the session. Cognito does not issue a new refresh token when refreshing,
+// so the session keeps its refresh token.
+func (p *CognitoProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	refreshToken := s.RefreshToken
+	refreshed, err := p.OIDCProvider.RefreshSession(ctx, s)
+
+	// Refresh could have failed or there was not session to refresh (with no error raised)
+	if err != nil || !refreshed {
+		return refreshed, err
+	}
+
+	if s.RefreshToken == "" {
+		s.RefreshToken = refreshToken
+	}
+	return true, p.extractAttributes(s)
+}
+
+// CreateSessionFromToken converts Bearer IDTokens into sessions
+func (p *CognitoProvider) CreateSessionFromToken(ctx context.Context, token string) (*sessions.SessionState, error) {
+	ss, err := p.OIDCProvider.CreateSessionFromToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("could not create session from token: %v", err)
+	}
+
+	if err := p.extractAttributes(ss); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// ValidateSession checks that the session's IDToken is still valid. The ID
+// tokens Cognito issues when refreshing sessions have no nonce, so the nonce
+// is only checked when the ID token has one.
+func (p *CognitoProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
+	claims, err := parseCognitoClaims(s.IDToken)
+	if err != nil {
+		logger.Errorf("id_token verification failed: %v", err)
+		return false
+	}
+	if _, ok := claims["nonce"]; ok {
+		return p.OIDCProvider.ValidateSession(ctx, s)
+	}
+
+	ctx = oidc.ClientContext(ctx, requests.DefaultHTTPClient)
+	if _, err := p.Verifier.Verify(ctx, s.IDToken); err != nil {
+		logger.Errorf("id_token verification failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// extractAttributes sets the preferred username of the session to the Cognito
+// username when the ID token has no `preferred_username`, and adds the
+// attributes of the ID token to the session
+func (p *CognitoProvider) extractAttributes(s *sessions.SessionState) error {
+	if s.IDToken == "" {
+		return nil
+	}
+	claims, err := parseCognitoClaims(s.IDToken)
+	if err != nil {
+		return err
+	}
+
+	if s.PreferredUsername == "" {
+		if username, ok := claims[cognitoUsernameClaim].(string); ok {
+			s.PreferredUsername = username
+		}
+	}
+
+	attributes := map[string]string{}
+	for claim, value := range claims {
+		if p.isAttribute(claim) {
+			attributes[claim] = fmt.Sprint(value)
+		}
+	}
+	s.Attributes = nil
+	if len(attributes) > 0 {
+		s.Attributes = attributes
+	}
+	return nil
+}
+
+// isAttribute returns whether the claim is one of the configured attributes,
+// or a custom attribute when none are configured
+func (p *CognitoProvider) isAttribute(claim string) bool {
+	if len(p.attributes) == 0 {
+		return strings.HasPrefix(claim, cognitoCustomAttributePrefix)
+	}
+	for _, attribute := range p.attributes {
+		if claim == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// signOutURL returns the logout endpoint of the Cognito domain the users sign
+// in with, which redirects them on to the redirect URL once signed out. The
+// redirect URL must be one of the sign out URLs of the app client.
+func (p *CognitoProvider) signOutURL(_ *sessions.SessionState, redirect string) string {
+	if p.LoginURL == nil || p.LoginURL.Host == "" {
+		return ""
+	}
+
+	params := url.Values{}
+	params.Set("client_id", p.ClientID)
+	params.Set("logout_uri", redirect)
+	signOutURL := url.URL{
+		Scheme:   p.LoginURL.Scheme,
+		Host:     p.LoginURL.Host,
+		Path:     "/logout",
+		RawQuery: params.Encode(),
+	}
+	return signOutURL.String()
+}
+
+// parseCognitoClaims returns the claims of the ID token, which has already
+// been verified
+func parseCognitoClaims(idToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		return nil, fmt.Errorf("could not parse the id_token claims: %v", err)
+	}
+	return claims, nil
+}
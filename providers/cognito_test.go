@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCognitoProvider(serverURL *url.URL, opts options.Provider) *CognitoProvider {
+	verificationOptions := internaloidc.IDTokenVerificationOptions{
+		AudienceClaims: []string{"aud"},
+		ClientID:       oidcClientID,
+	}
+	providerData := &ProviderData{
+		ClientID:     oidcClientID,
+		ClientSecret: oidcSecret,
+		LoginURL: &url.URL{
+			Scheme: serverURL.Scheme,
+			Host:   serverURL.Host,
+			Path:   "/oauth2/authorize"},
+		RedeemURL: &url.URL{
+			Scheme: serverURL.Scheme,
+			Host:   serverURL.Host,
+			Path:   "/oauth2/token"},
+		ProfileURL:  &url.URL{},
+		EmailClaim:  "email",
+		GroupsClaim: options.OIDCGroupsClaim,
+		UserClaim:   "sub",
+		Verifier: internaloidc.NewVerifier(oidc.NewVerifier(
+			oidcIssuer,
+			mockJWKS{},
+			&oidc.Config{ClientID: oidcClientID},
+		), verificationOptions),
+	}
+	return NewCognitoProvider(providerData, opts)
+}
+
+func newSignedTestCognitoIDToken(t *testing.T, nonce bool) string {
+	claims := jwt.MapClaims{
+		"iss":              oidcIssuer,
+		"aud":              oidcClientID,
+		"sub":              "123456789",
+		"exp":              time.Now().Add(5 * time.Minute).Unix(),
+		"iat":              time.Now().Unix(),
+		"email":            "janed@me.com",
+		"email_verified":   true,
+		"cognito:username": "janed",
+		"cognito:groups":   []string{"admins", "users"},
+		"custom:tenant":    "acme",
+		"custom:level":     3,
+		"phone_number":     "+4798765432",
+	}
+	if nonce {
+		claims["nonce"] = encryption.HashNonce([]byte(oidcNonce))
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	require.NoError(t, err)
+	return idToken
+}
+
+func TestCognitoProviderDefaults(t *testing.T) {
+	p := newCognitoProvider(&url.URL{Scheme: "https", Host: "auth.example.com"}, options.Provider{})
+	assert.Equal(t, "Cognito", p.Data().ProviderName)
+	assert.Equal(t, "openid email profile", p.Data().Scope)
+	assert.Equal(t, "cognito:groups", p.Data().GroupsClaim)
+}
+
+func TestCognitoProviderRedeem(t *testing.T) {
+	idToken := newSignedTestCognitoIDToken(t, true)
+	body, err := json.Marshal(redeemTokenResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    10,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+	})
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		attributes         []string
+		expectedAttributes map[string]string
+	}{
+		"custom attributes by default": {
+			expectedAttributes: map[string]string{
+				"custom:tenant": "acme",
+				"custom:level":  "3",
+			},
+		},
+		"configured attributes": {
+			attributes: []string{"custom:tenant", "phone_number", "custom:missing"},
+			expectedAttributes: map[string]string{
+				"custom:tenant": "acme",
+				"phone_number":  "+4798765432",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			serverURL, server := newOIDCServer(body)
+			defer server.Close()
+			p := newCognitoProvider(serverURL, options.Provider{
+				CognitoConfig: options.CognitoOptions{Attributes: tc.attributes},
+			})
+
+			session, err := p.Redeem(context.Background(), "https://app.example.com/oauth2/callback", "code1234", "")
+			require.NoError(t, err)
+			require.NoError(t, p.EnrichSession(context.Background(), session))
+			assert.Equal(t, "janed@me.com", session.Email)
+			assert.Equal(t, "123456789", session.User)
+			assert.Equal(t, "janed", session.PreferredUsername)
+			assert.Equal(t, []string{"admins", "users"}, session.Groups)
+			assert.Equal(t, tc.expectedAttributes, session.Attributes)
+			assert.Equal(t, []string{"acme"}, session.GetClaim("custom:tenant"))
+		})
+	}
+}
+
+func TestCognitoProviderRefreshSession(t *testing.T) {
+	// Cognito returns no refresh token, and an ID token without a nonce
+	idToken := newSignedTestCognitoIDToken(t, false)
+	body, err := json.Marshal(redeemTokenResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   10,
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+	})
+	require.NoError(t, err)
+	serverURL, server := newOIDCServer(body)
+	defer server.Close()
+	p := newCognitoProvider(serverURL, options.Provider{})
+
+	session := &sessions.SessionState{
+		AccessToken:  "changeit",
+		IDToken:      newSignedTestCognitoIDToken(t, true),
+		RefreshToken: refreshToken,
+		Nonce:        []byte(oidcNonce),
+	}
+	refreshed, err := p.RefreshSession(context.Background(), session)
+	require.NoError(t, err)
+	assert.True(t, refreshed)
+	assert.Equal(t, accessToken, session.AccessToken)
+	assert.Equal(t, idToken, session.IDToken)
+	assert.Equal(t, refreshToken, session.RefreshToken)
+	assert.Equal(t, "janed", session.PreferredUsername)
+	assert.Equal(t, "acme", session.Attributes["custom:tenant"])
+	assert.True(t, p.ValidateSession(context.Background(), session))
+
+	session.IDToken = newSignedTestCognitoIDToken(t, true)
+	session.Nonce = []byte("other")
+	assert.False(t, p.ValidateSession(context.Background(), session))
+}
+
+func TestCognitoProviderCreateSessionFromToken(t *testing.T) {
+	p := newCognitoProvider(&url.URL{Scheme: "https", Host: "auth.example.com"}, options.Provider{})
+
+	session, err := p.CreateSessionFromToken(context.Background(), newSignedTestCognitoIDToken(t, false))
+	require.NoError(t, err)
+	assert.Equal(t, "janed@me.com", session.Email)
+	assert.Equal(t, []string{"admins", "users"}, session.Groups)
+	assert.Equal(t, "janed", session.PreferredUsername)
+	assert.Equal(t, map[string]string{"custom:tenant": "acme", "custom:level": "3"}, session.Attributes)
+}
+
+func TestCognitoProviderSignOutURL(t *testing.T) {
+	p := newCognitoProvider(&url.URL{Scheme: "https", Host: "auth.example.com"}, options.Provider{})
+
+	signOutURL, err := url.Parse(p.Data().SignOutURL(&sessions.SessionState{}, "https://app.example.com/"))
+	require.NoError(t, err)
+	assert.Equal(t, "https", signOutURL.Scheme)
+	assert.Equal(t, "auth.example.com", signOutURL.Host)
+	assert.Equal(t, "/logout", signOutURL.Path)
+	assert.Equal(t, url.Values{
+		"client_id":  []string{oidcClientID},
+		"logout_uri": []string{"https://app.example.com/"},
+	}, signOutURL.Query())
+
+	assert.Equal(t, "", newOIDCProvider(&url.URL{Scheme: "https", Host: "auth.example.com"}, false).SignOutURL(&sessions.SessionState{}, "https://app.example.com/"))
+}
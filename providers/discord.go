@@ -0,0 +1,250 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// DiscordProvider represents a Discord based Identity Provider
+type DiscordProvider struct {
+	*ProviderData
+
+	// guilds are the IDs of the guilds the membership of the user is checked in
+	guilds []string
+	// roleGuilds are the IDs of the guilds the roles of the user are looked
+	// up in
+	roleGuilds []string
+}
+
+var _ Provider = (*DiscordProvider)(nil)
+
+const (
+	discordProviderName = "Discord"
+	discordDefaultScope = "identify email"
+
+	discordGuildPrefix = "guild:"
+	discordRolePrefix  = "role:"
+)
+
+var (
+	// Default Login URL for Discord.
+	// Pre-parsed URL of https://discord.com/oauth2/authorize.
+	discordDefaultLoginURL = &url.URL{
+		Scheme: "https",
+		Host:   "discord.com",
+		Path:   "/oauth2/authorize",
+	}
+
+	// Default Redeem URL for Discord.
+	// Pre-parsed URL of https://discord.com/api/oauth2/token.
+	discordDefaultRedeemURL = &url.URL{
+		Scheme: "https",
+		Host:   "discord.com",
+		Path:   "/api/oauth2/token",
+	}
+
+	// Default Profile URL for Discord.
+	// The guilds of the user are listed under this URL too.
+	// Pre-parsed URL of https://discord.com/api/users/@me.
+	discordDefaultProfileURL = &url.URL{
+		Scheme: "https",
+		Host:   "discord.com",
+		Path:   "/api/users/@me",
+	}
+)
+
+// NewDiscordProvider initiates a new DiscordProvider
+func NewDiscordProvider(p *ProviderData, opts options.DiscordOptions) (*DiscordProvider, error) {
+	p.setProviderDefaults(providerDefaults{
+		name:        discordProviderName,
+		loginURL:    discordDefaultLoginURL,
+		redeemURL:   discordDefaultRedeemURL,
+		profileURL:  discordDefaultProfileURL,
+		validateURL: discordDefaultProfileURL,
+		scope:       discordDefaultScope,
+	})
+	p.getAuthorizationHeaderFunc = makeOIDCHeader
+
+	provider := &DiscordProvider{ProviderData: p}
+	provider.setAllowedGuilds(opts.Guilds)
+	if err := provider.setAllowedRoles(opts.Roles); err != nil {
+		return nil, fmt.Errorf("could not configure allowed roles: %v", err)
+	}
+	return provider, nil
+}
+
+// setAllowedGuilds adds the guilds to the AllowedGroups list, and requests
+// the scope listing the guilds of the user
+func (p *DiscordProvider) setAllowedGuilds(guilds []string) {
+	if len(guilds) == 0 {
+		return
+	}
+	if p.AllowedGroups == nil {
+		p.AllowedGroups = make(map[string]struct{})
+	}
+	for _, guild := range guilds {
+		p.guilds = append(p.guilds, guild)
+		p.AllowedGroups[discordGuildPrefix+guild] = struct{}{}
+	}
+	p.addScope("guilds")
+}
+
+// setAllowedRoles adds the `<guild ID>:<role ID>` roles to the AllowedGroups
+// list, and requests the scope reading the roles of the user in guilds
+func (p *DiscordProvider) setAllowedRoles(roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	if p.AllowedGroups == nil {
+		p.AllowedGroups = make(map[string]struct{})
+	}
+	for _, role := range roles {
+		guild, roleID, ok := strings.Cut(role, ":")
+		if !ok || guild == "" || roleID == "" {
+			return fmt.Errorf("invalid discord role %q, expected <guild ID>:<role ID>", role)
+		}
+		if !slices.Contains(p.roleGuilds, guild) {
+			p.roleGuilds = append(p.roleGuilds, guild)
+		}
+		p.AllowedGroups[discordRolePrefix+role] = struct{}{}
+	}
+	p.addScope("guilds.members.read")
+	return nil
+}
+
+// addScope adds the scope to the requested scopes, unless already requested
+func (p *DiscordProvider) addScope(scope string) {
+	if !slices.Contains(strings.Fields(p.Scope), scope) {
+		p.Scope += " " + scope
+	}
+}
+
+// Redeem exchanges the code for the access and refresh tokens of the user
+func (p *DiscordProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
+	return redeemOAuth2Code(ctx, p.ProviderData, redirectURL, code, codeVerifier)
+}
+
+// EnrichSession sets the user, email and, as groups, the allowed guilds and
+// roles of the user
+func (p *DiscordProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
+	// https://discord.com/developers/docs/resources/user#get-current-user
+	var user struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	err := requests.New(p.ProfileURL.String()).
+		WithContext(ctx).
+		WithHeaders(makeOIDCHeader(s.AccessToken)).
+		Do().
+		UnmarshalInto(&user)
+	if err != nil {
+		return fmt.Errorf("error getting user info: %v", err)
+	}
+
+	if user.Email == "" {
+		return errors.New("discord user has no email")
+	}
+	if !p.AllowUnverifiedEmail && !user.Verified {
+		return errors.New("user email is not verified")
+	}
+	s.User = user.Username
+	s.Email = user.Email
+	s.PreferredUsername = user.GlobalName
+
+	groups, err := p.getGroups(ctx, s)
+	if err != nil {
+		return err
+	}
+	s.Groups = groups
+	return nil
+}
+
+// getGroups returns the allowed guilds the user is a member of, as
+// `guild:<guild ID>`, and their roles in the guilds of allowed roles, as
+// `role:<guild ID>:<role ID>`
+func (p *DiscordProvider) getGroups(ctx context.Context, s *sessions.SessionState) ([]string, error) {
+	var groups []string
+
+	if len(p.guilds) > 0 {
+		// https://discord.com/developers/docs/resources/user#get-current-user-guilds
+		var guilds []struct {
+			ID string `json:"id"`
+		}
+		err := requests.New(p.makeAPIEndpoint("/guilds")).
+			WithContext(ctx).
+			WithHeaders(makeOIDCHeader(s.AccessToken)).
+			Do().
+			UnmarshalInto(&guilds)
+		if err != nil {
+			return nil, fmt.Errorf("error getting guilds: %v", err)
+		}
+		for _, guild := range guilds {
+			if slices.Contains(p.guilds, guild.ID) {
+				groups = append(groups, discordGuildPrefix+guild.ID)
+			}
+		}
+	}
+
+	for _, guild := range p.roleGuilds {
+		// https://discord.com/developers/docs/resources/user#get-current-user-guild-member
+		var member struct {
+			Roles []string `json:"roles"`
+		}
+		result := requests.New(p.makeAPIEndpoint("/guilds/" + url.PathEscape(guild) + "/member")).
+			WithContext(ctx).
+			WithHeaders(makeOIDCHeader(s.AccessToken)).
+			Do()
+		if result.StatusCode() == http.StatusNotFound {
+			// The user is not a member of the guild
+			continue
+		}
+		if err := result.UnmarshalInto(&member); err != nil {
+			return nil, fmt.Errorf("error getting the member roles in guild %s: %v", guild, err)
+		}
+		for _, role := range member.Roles {
+			groups = append(groups, discordRolePrefix+guild+":"+role)
+		}
+	}
+
+	return groups, nil
+}
+
+// makeAPIEndpoint returns the URL of the endpoint under the profile URL
+func (p *DiscordProvider) makeAPIEndpoint(path string) string {
+	endpoint := *p.ProfileURL
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	return endpoint.String()
+}
+
+// RefreshSession refreshes the access token of the session, and the guilds
+// and roles of the user
+func (p *DiscordProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	if s == nil || s.RefreshToken == "" {
+		return false, nil
+	}
+
+	if err := refreshOAuth2Token(ctx, p.ProviderData, s); err != nil {
+		return false, fmt.Errorf("unable to redeem refresh token: %v", err)
+	}
+	if err := p.EnrichSession(ctx, s); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ValidateSession validates the AccessToken
+func (p *DiscordProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
+	return validateToken(ctx, p, s.AccessToken, makeOIDCHeader(s.AccessToken))
+}
@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDiscordProvider(hostname string, opts options.DiscordOptions) (*DiscordProvider, error) {
+	p, err := NewDiscordProvider(
+		&ProviderData{
+			ProviderName: "",
+			LoginURL:     &url.URL{},
+			RedeemURL:    &url.URL{},
+			ProfileURL:   &url.URL{},
+			ValidateURL:  &url.URL{},
+			Scope:        ""},
+		opts)
+	if err != nil {
+		return nil, err
+	}
+	if hostname != "" {
+		updateURL(p.Data().LoginURL, hostname)
+		updateURL(p.Data().RedeemURL, hostname)
+		updateURL(p.Data().ProfileURL, hostname)
+		updateURL(p.Data().ValidateURL, hostname)
+	}
+	return p, nil
+}
+
+func testDiscordBackend(user string) *httptest.Server {
+	payloads := map[string]string{
+		"/api/users/@me":                   user,
+		"/api/users/@me/guilds":            `[{"id":"111","name":"Community"},{"id":"222","name":"Other"}]`,
+		"/api/users/@me/guilds/111/member": `{"roles":["901","902"]}`,
+		"/api/oauth2/token":                `{"access_token":"` + authorizedAccessToken + `","token_type":"Bearer","expires_in":604800}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			payload, ok := payloads[r.URL.Path]
+			if !ok {
+				w.WriteHeader(404)
+			} else if r.URL.Path != "/api/oauth2/token" && !IsAuthorizedInHeader(r.Header) {
+				w.WriteHeader(403)
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(200)
+				w.Write([]byte(payload))
+			}
+		}))
+}
+
+func TestNewDiscordProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	// Test that defaults are set when calling for a new provider with nothing set
+	p, err := NewDiscordProvider(&ProviderData{}, options.DiscordOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	providerData := p.Data()
+	g.Expect(providerData.ProviderName).To(Equal("Discord"))
+	g.Expect(providerData.LoginURL.String()).To(Equal("https://discord.com/oauth2/authorize"))
+	g.Expect(providerData.RedeemURL.String()).To(Equal("https://discord.com/api/oauth2/token"))
+	g.Expect(providerData.ProfileURL.String()).To(Equal("https://discord.com/api/users/@me"))
+	g.Expect(providerData.ValidateURL.String()).To(Equal("https://discord.com/api/users/@me"))
+	g.Expect(providerData.Scope).To(Equal("identify email"))
+}
+
+func TestDiscordProviderScopeAdjustForGuildsAndRoles(t *testing.T) {
+	p, err := testDiscordProvider("", options.DiscordOptions{
+		Guilds: []string{"111"},
+		Roles:  []string{"111:901", "222:903"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "identify email guilds guilds.members.read", p.Data().Scope)
+	assert.Equal(t, map[string]struct{}{
+		"guild:111":    {},
+		"role:111:901": {},
+		"role:222:903": {},
+	}, p.Data().AllowedGroups)
+
+	_, err = testDiscordProvider("", options.DiscordOptions{Roles: []string{"901"}})
+	assert.EqualError(t, err, "could not configure allowed roles: invalid discord role \"901\", expected <guild ID>:<role ID>")
+}
+
+func TestDiscordProviderEnrichSession(t *testing.T) {
+	testCases := map[string]struct {
+		user           string
+		opts           options.DiscordOptions
+		expectedError  string
+		expectedGroups []string
+	}{
+		"user": {
+			user: `{"id":"80351110224678912","username":"nelly","global_name":"Nelly","email":"nelly@discord.com","verified":true}`,
+		},
+		"guild and roles": {
+			user: `{"id":"80351110224678912","username":"nelly","global_name":"Nelly","email":"nelly@discord.com","verified":true}`,
+			opts: options.DiscordOptions{
+				Guilds: []string{"111", "333"},
+				Roles:  []string{"111:901", "333:904"},
+			},
+			expectedGroups: []string{"guild:111", "role:111:901", "role:111:902"},
+		},
+		"unverified email": {
+			user:          `{"id":"80351110224678912","username":"nelly","email":"nelly@discord.com","verified":false}`,
+			expectedError: "user email is not verified",
+		},
+		"no email": {
+			user:          `{"id":"80351110224678912","username":"nelly","email":null,"verified":false}`,
+			expectedError: "discord user has no email",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := testDiscordBackend(tc.user)
+			defer b.Close()
+
+			bURL, _ := url.Parse(b.URL)
+			p, err := testDiscordProvider(bURL.Host, tc.opts)
+			require.NoError(t, err)
+
+			session := CreateAuthorizedSession()
+			err = p.EnrichSession(context.Background(), session)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "nelly", session.User)
+			assert.Equal(t, "nelly@discord.com", session.Email)
+			assert.Equal(t, "Nelly", session.PreferredUsername)
+			assert.Equal(t, tc.expectedGroups, session.Groups)
+		})
+	}
+}
+
+func TestDiscordProviderRefreshSession(t *testing.T) {
+	b := testDiscordBackend(`{"id":"80351110224678912","username":"nelly","email":"nelly@discord.com","verified":true}`)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p, err := testDiscordProvider(bURL.Host, options.DiscordOptions{})
+	require.NoError(t, err)
+
+	refreshed, err := p.RefreshSession(context.Background(), &sessions.SessionState{})
+	assert.NoError(t, err)
+	assert.False(t, refreshed)
+
+	session := &sessions.SessionState{AccessToken: "expired", RefreshToken: "refresh"}
+	refreshed, err = p.RefreshSession(context.Background(), session)
+	require.NoError(t, err)
+	assert.True(t, refreshed)
+	assert.Equal(t, authorizedAccessToken, session.AccessToken)
+	assert.Equal(t, "refresh", session.RefreshToken)
+	assert.NotNil(t, session.ExpiresOn)
+	assert.Equal(t, "nelly@discord.com", session.Email)
+}
@@ -10,9 +10,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/clock"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
 	"golang.org/x/exp/maps"
@@ -26,6 +28,15 @@ type GitHubProvider struct {
 	Repo  string
 	Token string
 	Users []string
+
+	// OrgRole is the role required in Org, either admin or member
+	OrgRole string
+	// UseGraphQL looks up organisations and nested teams with the GraphQL API
+	UseGraphQL bool
+
+	clock           clock.Clock
+	membershipMu    sync.Mutex
+	membershipCache map[string]cachedGitHubMembership
 }
 
 var _ Provider = (*GitHubProvider)(nil)
@@ -80,6 +91,7 @@ func NewGitHubProvider(p *ProviderData, opts options.GitHubOptions) *GitHubProvi
 	provider.setOrgTeam(opts.Org, opts.Team)
 	provider.setRepo(opts.Repo, opts.Token)
 	provider.setUsers(opts.Users)
+	provider.setOrgRole(opts.OrgRole, opts.UseGraphQL)
 	return provider
 }
 
@@ -129,6 +141,14 @@ func (p *GitHubProvider) setUsers(users []string) {
 	p.Users = users
 }
 
+// setOrgRole configures the required organisation role, which is looked up
+// with the GraphQL API
+func (p *GitHubProvider) setOrgRole(role string, useGraphQL bool) {
+	p.OrgRole = role
+	p.UseGraphQL = useGraphQL || role != ""
+	p.membershipCache = make(map[string]cachedGitHubMembership)
+}
+
 // EnrichSession updates the User & Email after the initial Redeem
 func (p *GitHubProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
 	// Construct user info JSON from multiple GitHub API endpoints to have a more detailed session state
@@ -147,9 +167,17 @@ func (p *GitHubProvider) EnrichSession(ctx context.Context, s *sessions.SessionS
 	return p.getUser(ctx, s)
 }
 
-// ValidateSession validates the AccessToken
+// ValidateSession validates the AccessToken, and that the user still has the
+// required organisation role
 func (p *GitHubProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
-	return validateToken(ctx, p, s.AccessToken, makeGitHubHeader(s.AccessToken))
+	if !validateToken(ctx, p, s.AccessToken, makeGitHubHeader(s.AccessToken)) {
+		return false
+	}
+	if err := p.hasOrgRole(ctx, s); err != nil {
+		logger.Errorf("Session validation failed: %v", err)
+		return false
+	}
+	return true
 }
 
 func (p *GitHubProvider) hasOrg(s *sessions.SessionState) error {
@@ -382,6 +410,10 @@ func (p *GitHubProvider) checkRestrictions(ctx context.Context, s *sessions.Sess
 		return err
 	}
 
+	if err := p.hasOrgRole(ctx, s); err != nil {
+		return err
+	}
+
 	if p.Org == "" && p.Repo != "" && p.Token == "" {
 		// If we have a token we'll do the collaborator check in GetUserName
 		return p.hasRepoAccess(ctx, s.AccessToken)
@@ -421,6 +453,16 @@ func (p *GitHubProvider) hasOrgAndTeamAccess(s *sessions.SessionState) error {
 }
 
 func (p *GitHubProvider) getOrgAndTeam(ctx context.Context, s *sessions.SessionState) error {
+	if p.UseGraphQL {
+		membership, err := p.getMembership(ctx, s)
+		if err != nil {
+			return err
+		}
+		s.Groups = append(s.Groups, membership.orgs...)
+		s.Groups = append(s.Groups, membership.teams...)
+		return nil
+	}
+
 	err := p.getOrgs(ctx, s)
 	if err != nil {
 		return err
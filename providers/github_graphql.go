@@ -0,0 +1,282 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+const (
+	githubOrgRoleAdmin  = "admin"
+	githubOrgRoleMember = "member"
+
+	// githubMembershipCacheTTL is how long the membership of a session is
+	// cached for before it is looked up again
+	githubMembershipCacheTTL = 5 * time.Minute
+
+	githubOrgsQuery = `query($after: String) {
+  viewer {
+    login
+    organizations(first: 100, after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes { login viewerCanAdminister }
+    }
+  }
+}`
+
+	githubTeamsQuery = `query($org: String!, $login: String!, $after: String) {
+  organization(login: $org) {
+    teams(first: 100, after: $after, userLogins: [$login]) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        slug
+        ancestors(first: 100) { nodes { slug } }
+      }
+    }
+  }
+}`
+)
+
+// githubMembership is the membership of a user in GitHub organisations and
+// teams
+type githubMembership struct {
+	// orgRoles maps the lowercase login of the organisations of the user to
+	// their role in the organisation
+	orgRoles map[string]string
+	// orgs are the logins of the organisations of the user
+	orgs []string
+	// teams are the teams of the user formatted as `org:team`, including the
+	// parent teams of nested teams
+	teams []string
+}
+
+type cachedGitHubMembership struct {
+	membership *githubMembership
+	expires    time.Time
+}
+
+type githubPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// makeGitHubGraphQLEndpoint returns the GraphQL endpoint of the API. GitHub
+// Enterprise Server serves it at /api/graphql rather than under /api/v3.
+func (p *GitHubProvider) makeGitHubGraphQLEndpoint() *url.URL {
+	endpoint := path.Join(p.ValidateURL.Path, "graphql")
+	if regexp.MustCompile(`^/api/v\d+`).MatchString(p.ValidateURL.Path) {
+		endpoint = "/api/graphql"
+	}
+
+	return &url.URL{
+		Scheme: p.ValidateURL.Scheme,
+		Host:   p.ValidateURL.Host,
+		Path:   endpoint,
+	}
+}
+
+// graphQL runs the query against the GitHub GraphQL API and unmarshals the
+// data of the response into the value
+func (p *GitHubProvider) graphQL(ctx context.Context, accessToken, query string, variables map[string]interface{}, into interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling graphql query: %v", err)
+	}
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err = requests.New(p.makeGitHubGraphQLEndpoint().String()).
+		WithContext(ctx).
+		WithMethod(http.MethodPost).
+		WithBody(bytes.NewReader(body)).
+		WithHeaders(makeGitHubHeader(accessToken)).
+		SetHeader("Content-Type", "application/json").
+		Do().
+		UnmarshalInto(&resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql query failed: %s", resp.Errors[0].Message)
+	}
+	if len(resp.Data) == 0 {
+		return errors.New("graphql query returned no data")
+	}
+
+	return json.Unmarshal(resp.Data, into)
+}
+
+// getMembership returns the membership of the session user, looking it up
+// with the GraphQL API when it is not cached for the session
+func (p *GitHubProvider) getMembership(ctx context.Context, s *sessions.SessionState) (*githubMembership, error) {
+	key := sha256.Sum256([]byte(s.AccessToken))
+	cacheKey := hex.EncodeToString(key[:])
+
+	p.membershipMu.Lock()
+	cached, ok := p.membershipCache[cacheKey]
+	p.membershipMu.Unlock()
+	if ok && p.clock.Now().Before(cached.expires) {
+		return cached.membership, nil
+	}
+
+	membership, err := p.lookupMembership(ctx, s.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if memory.LowMemory() {
+		// Memberships are looked up each time rather than cached
+		return membership, nil
+	}
+
+	now := p.clock.Now()
+	p.membershipMu.Lock()
+	defer p.membershipMu.Unlock()
+	for k, entry := range p.membershipCache {
+		if !now.Before(entry.expires) {
+			delete(p.membershipCache, k)
+		}
+	}
+	p.membershipCache[cacheKey] = cachedGitHubMembership{
+		membership: membership,
+		expires:    now.Add(githubMembershipCacheTTL),
+	}
+
+	return membership, nil
+}
+
+// lookupMembership looks up the organisations of the user with their role,
+// and the teams of the user in the configured organisation
+func (p *GitHubProvider) lookupMembership(ctx context.Context, accessToken string) (*githubMembership, error) {
+	membership := &githubMembership{orgRoles: map[string]string{}}
+
+	var login string
+	after := interface{}(nil)
+	for {
+		var data struct {
+			Viewer struct {
+				Login         string `json:"login"`
+				Organizations struct {
+					PageInfo githubPageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						Login               string `json:"login"`
+						ViewerCanAdminister bool   `json:"viewerCanAdminister"`
+					} `json:"nodes"`
+				} `json:"organizations"`
+			} `json:"viewer"`
+		}
+		if err := p.graphQL(ctx, accessToken, githubOrgsQuery, map[string]interface{}{"after": after}, &data); err != nil {
+			return nil, fmt.Errorf("error getting organisations: %v", err)
+		}
+
+		login = data.Viewer.Login
+		for _, org := range data.Viewer.Organizations.Nodes {
+			role := githubOrgRoleMember
+			if org.ViewerCanAdminister {
+				role = githubOrgRoleAdmin
+			}
+			logger.Printf("Member of Github Organization:%q with role %q", org.Login, role)
+			membership.orgRoles[strings.ToLower(org.Login)] = role
+			membership.orgs = append(membership.orgs, org.Login)
+		}
+
+		if !data.Viewer.Organizations.PageInfo.HasNextPage {
+			break
+		}
+		after = data.Viewer.Organizations.PageInfo.EndCursor
+	}
+
+	if p.Org == "" || membership.orgRoles[strings.ToLower(p.Org)] == "" {
+		return membership, nil
+	}
+
+	teams := map[string]struct{}{}
+	after = nil
+	for {
+		var data struct {
+			Organization struct {
+				Teams struct {
+					PageInfo githubPageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						Slug      string `json:"slug"`
+						Ancestors struct {
+							Nodes []struct {
+								Slug string `json:"slug"`
+							} `json:"nodes"`
+						} `json:"ancestors"`
+					} `json:"nodes"`
+				} `json:"teams"`
+			} `json:"organization"`
+		}
+		variables := map[string]interface{}{"org": p.Org, "login": login, "after": after}
+		if err := p.graphQL(ctx, accessToken, githubTeamsQuery, variables, &data); err != nil {
+			return nil, fmt.Errorf("error getting teams: %v", err)
+		}
+
+		for _, team := range data.Organization.Teams.Nodes {
+			slugs := []string{team.Slug}
+			for _, ancestor := range team.Ancestors.Nodes {
+				slugs = append(slugs, ancestor.Slug)
+			}
+			for _, slug := range slugs {
+				group := p.Org + orgTeamSeparator + slug
+				if _, ok := teams[group]; ok {
+					continue
+				}
+				logger.Printf("Member of Github Organization/Team:%q/%q", p.Org, slug)
+				teams[group] = struct{}{}
+				membership.teams = append(membership.teams, group)
+			}
+		}
+
+		if !data.Organization.Teams.PageInfo.HasNextPage {
+			break
+		}
+		after = data.Organization.Teams.PageInfo.EndCursor
+	}
+
+	return membership, nil
+}
+
+// hasOrgRole checks that the session user has the required role in the
+// configured organisation
+func (p *GitHubProvider) hasOrgRole(ctx context.Context, s *sessions.SessionState) error {
+	if p.OrgRole == "" {
+		return nil
+	}
+
+	membership, err := p.getMembership(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	role := membership.orgRoles[strings.ToLower(p.Org)]
+	if role == githubOrgRoleAdmin || (role != "" && p.OrgRole == githubOrgRoleMember) {
+		return nil
+	}
+
+	logger.Printf("Missing role %q in Organization:%q", p.OrgRole, p.Org)
+	return errors.New("user is missing required organization role")
+}
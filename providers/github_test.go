@@ -2,13 +2,17 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/memory"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
 )
@@ -491,3 +495,224 @@ func TestGitHubProvider_ValidateSessionWithUserEmails(t *testing.T) {
 	valid := p.ValidateSession(context.Background(), session)
 	assert.True(t, valid)
 }
+
+// testGitHubGraphQLProvider creates a provider with its own API URL, as the
+// other tests update the default API URL
+func testGitHubGraphQLProvider(hostname string, opts options.GitHubOptions) *GitHubProvider {
+	p := testGitHubProvider(hostname, opts)
+	p.ValidateURL = &url.URL{Scheme: "http", Host: hostname, Path: "/"}
+	return p
+}
+
+// testGitHubGraphQLBackend serves the organisations and teams queries of the
+// GraphQL API, one page per response in the order given, and counts the
+// queries it receives
+func testGitHubGraphQLBackend(orgPages, teamPages []string, queries *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/graphql" && r.URL.Path != "/api/graphql" {
+				w.WriteHeader(404)
+				return
+			}
+
+			var body struct {
+				Query     string                 `json:"query"`
+				Variables map[string]interface{} `json:"variables"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			*queries++
+
+			pages := orgPages
+			if strings.Contains(body.Query, "organization(login: $org)") {
+				pages = teamPages
+			}
+			page := 0
+			if after, ok := body.Variables["after"].(string); ok {
+				page = len(after)
+			}
+			w.WriteHeader(200)
+			w.Write([]byte(pages[page]))
+		}))
+}
+
+var (
+	testGitHubOrgPages = []string{
+		`{"data": {"viewer": {"login": "mbland", "organizations": {
+			"pageInfo": {"hasNextPage": true, "endCursor": "a"},
+			"nodes": [{"login": "testorg", "viewerCanAdminister": false}]
+		}}}}`,
+		`{"data": {"viewer": {"login": "mbland", "organizations": {
+			"pageInfo": {"hasNextPage": false, "endCursor": "b"},
+			"nodes": [{"login": "adminorg", "viewerCanAdminister": true}]
+		}}}}`,
+	}
+	testGitHubTeamPages = []string{
+		`{"data": {"organization": {"teams": {
+			"pageInfo": {"hasNextPage": true, "endCursor": "a"},
+			"nodes": [{"slug": "backend", "ancestors": {"nodes": [{"slug": "engineering"}]}}]
+		}}}}`,
+		`{"data": {"organization": {"teams": {
+			"pageInfo": {"hasNextPage": false, "endCursor": "b"},
+			"nodes": [{"slug": "frontend", "ancestors": {"nodes": [{"slug": "engineering"}]}}]
+		}}}}`,
+	}
+)
+
+func TestGitHubProvider_getOrgAndTeamWithGraphQL(t *testing.T) {
+	queries := 0
+	b := testGitHubGraphQLBackend(testGitHubOrgPages, testGitHubTeamPages, &queries)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{
+		Org:        "testorg",
+		Team:       "engineering",
+		UseGraphQL: true,
+	})
+
+	session := CreateAuthorizedSession()
+	err := p.getOrgAndTeam(context.Background(), session)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testorg", "adminorg", "testorg:backend", "testorg:engineering", "testorg:frontend"}, session.Groups)
+	assert.Equal(t, 4, queries)
+
+	// The parent team of the nested teams of the user is allowed
+	assert.NoError(t, p.hasOrgAndTeamAccess(session))
+}
+
+func TestGitHubProvider_getOrgAndTeamWithGraphQLEnterprise(t *testing.T) {
+	queries := 0
+	b := testGitHubGraphQLBackend(testGitHubOrgPages, testGitHubTeamPages, &queries)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{UseGraphQL: true})
+	p.ValidateURL.Path = "/api/v3/"
+
+	session := CreateAuthorizedSession()
+	err := p.getOrgAndTeam(context.Background(), session)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testorg", "adminorg"}, session.Groups)
+}
+
+func TestGitHubProvider_getOrgAndTeamWithGraphQLErrors(t *testing.T) {
+	queries := 0
+	b := testGitHubGraphQLBackend([]string{`{"errors": [{"message": "rate limited"}]}`}, nil, &queries)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{UseGraphQL: true})
+
+	session := CreateAuthorizedSession()
+	err := p.getOrgAndTeam(context.Background(), session)
+	assert.EqualError(t, err, "error getting organisations: graphql query failed: rate limited")
+}
+
+func TestGitHubProvider_hasOrgRole(t *testing.T) {
+	testCases := map[string]struct {
+		org         string
+		orgRole     string
+		expectError bool
+	}{
+		"member of an organisation requiring members": {
+			org:     "testorg",
+			orgRole: "member",
+		},
+		"member of an organisation requiring admins": {
+			org:         "testorg",
+			orgRole:     "admin",
+			expectError: true,
+		},
+		"admin of an organisation requiring members": {
+			org:     "adminorg",
+			orgRole: "member",
+		},
+		"admin of an organisation requiring admins": {
+			org:     "adminorg",
+			orgRole: "admin",
+		},
+		"not a member of the organisation": {
+			org:         "otherorg",
+			orgRole:     "member",
+			expectError: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			queries := 0
+			b := testGitHubGraphQLBackend(testGitHubOrgPages, testGitHubTeamPages, &queries)
+			defer b.Close()
+
+			bURL, _ := url.Parse(b.URL)
+			p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{
+				Org:     tc.org,
+				OrgRole: tc.orgRole,
+			})
+			assert.True(t, p.UseGraphQL)
+
+			err := p.hasOrgRole(context.Background(), CreateAuthorizedSession())
+			if tc.expectError {
+				assert.EqualError(t, err, "user is missing required organization role")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGitHubProvider_membershipIsCachedPerSession(t *testing.T) {
+	queries := 0
+	b := testGitHubGraphQLBackend(testGitHubOrgPages, testGitHubTeamPages, &queries)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{
+		Org:     "adminorg",
+		OrgRole: "admin",
+	})
+
+	now := time.Now()
+	p.clock.Set(now)
+	defer p.clock.Reset()
+
+	session := CreateAuthorizedSession()
+	assert.NoError(t, p.hasOrgRole(context.Background(), session))
+	assert.NoError(t, p.hasOrgRole(context.Background(), session))
+	assert.Equal(t, 4, queries)
+
+	// Another session looks up its own membership
+	other := CreateAuthorizedSession()
+	other.AccessToken = "other_access_token"
+	assert.NoError(t, p.hasOrgRole(context.Background(), other))
+	assert.Equal(t, 8, queries)
+
+	// The membership is looked up again once the cache expires
+	p.clock.Set(now.Add(githubMembershipCacheTTL))
+	assert.NoError(t, p.hasOrgRole(context.Background(), session))
+	assert.Equal(t, 12, queries)
+}
+
+func TestGitHubProvider_membershipIsNotCachedWithLowMemory(t *testing.T) {
+	memory.SetLowMemory(true)
+	defer memory.SetLowMemory(false)
+
+	queries := 0
+	b := testGitHubGraphQLBackend(testGitHubOrgPages, testGitHubTeamPages, &queries)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testGitHubGraphQLProvider(bURL.Host, options.GitHubOptions{
+		Org:     "adminorg",
+		OrgRole: "admin",
+	})
+
+	session := CreateAuthorizedSession()
+	assert.NoError(t, p.hasOrgRole(context.Background(), session))
+	assert.NoError(t, p.hasOrgRole(context.Background(), session))
+	assert.Equal(t, 8, queries)
+	assert.Empty(t, p.membershipCache)
+}
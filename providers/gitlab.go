@@ -144,12 +144,13 @@ func (p *GitLabProvider) EnrichSession(ctx context.Context, s *sessions.SessionS
 	}
 
 	// Add projects as `project:blah` to s.Groups
-	p.addProjectsToSession(ctx, s)
+	p.addProjectsToSession(ctx, s, userinfo.Sub)
 
 	return nil
 }
 
 type gitlabUserinfo struct {
+	Sub           string   `json:"sub"`
 	Nickname      string   `json:"nickname"`
 	Email         string   `json:"email"`
 	EmailVerified bool     `json:"email_verified"`
@@ -180,7 +181,7 @@ func (p *GitLabProvider) getUserinfo(ctx context.Context, s *sessions.SessionSta
 // addProjectsToSession adds projects matching user access requirements into
 // the session state groups list.
 // This method prefixes projects names with `project:` to specify group kind.
-func (p *GitLabProvider) addProjectsToSession(ctx context.Context, s *sessions.SessionState) {
+func (p *GitLabProvider) addProjectsToSession(ctx context.Context, s *sessions.SessionState, userID string) {
 	// Iterate over projects, check if oauth2-proxy can get project information on behalf of the user
 	for _, project := range p.allowedProjects {
 		projectInfo, err := p.getProjectInfo(ctx, s, project.Name)
@@ -194,19 +195,26 @@ func (p *GitLabProvider) addProjectsToSession(ctx context.Context, s *sessions.S
 			continue
 		}
 
-		perms := projectInfo.Permissions.ProjectAccess
-		if perms == nil {
-			// use group project access as fallback
-			perms = projectInfo.Permissions.GroupAccess
-			// group project access is not set for this user then we give up
-			if perms == nil {
-				logger.Errorf("Warning: user %q has no project level access to %s",
-					s.Email, project.Name)
-				continue
+		accessLevel := projectInfo.Permissions.accessLevel()
+		if accessLevel < project.AccessLevel && userID != "" {
+			// The permissions only cover direct membership of the project and
+			// of its group, the members API includes the access inherited
+			// from ancestor groups and invited groups
+			member, err := p.getProjectMember(ctx, s, projectInfo.ID, userID)
+			if err != nil {
+				logger.Errorf("Warning: project member request failed: %v", err)
+			} else if member.AccessLevel > accessLevel {
+				accessLevel = member.AccessLevel
 			}
 		}
 
-		if perms.AccessLevel < project.AccessLevel {
+		if accessLevel == 0 {
+			logger.Errorf("Warning: user %q has no project level access to %s",
+				s.Email, project.Name)
+			continue
+		}
+
+		if accessLevel < project.AccessLevel {
 			logger.Errorf(
 				"Warning: user %q does not have the minimum required access level for project %q",
 				s.Email,
@@ -228,7 +236,20 @@ type gitlabProjectPermission struct {
 	GroupAccess   *gitlabPermissionAccess `json:"group_access"`
 }
 
+// accessLevel returns the highest access level of the user to the project,
+// or 0 when the user has no access
+func (p gitlabProjectPermission) accessLevel() int {
+	level := 0
+	for _, access := range []*gitlabPermissionAccess{p.ProjectAccess, p.GroupAccess} {
+		if access != nil && access.AccessLevel > level {
+			level = access.AccessLevel
+		}
+	}
+	return level
+}
+
 type gitlabProjectInfo struct {
+	ID                int                     `json:"id"`
 	Name              string                  `json:"name"`
 	Archived          bool                    `json:"archived"`
 	PathWithNamespace string                  `json:"path_with_namespace"`
@@ -256,6 +277,34 @@ func (p *GitLabProvider) getProjectInfo(ctx context.Context, s *sessions.Session
 	return &projectInfo, nil
 }
 
+type gitlabProjectMember struct {
+	ID          int `json:"id"`
+	AccessLevel int `json:"access_level"`
+}
+
+// getProjectMember returns the membership of the user to the project,
+// including the membership inherited from groups
+func (p *GitLabProvider) getProjectMember(ctx context.Context, s *sessions.SessionState, projectID int, userID string) (*gitlabProjectMember, error) {
+	var member gitlabProjectMember
+
+	endpointURL := &url.URL{
+		Scheme: p.LoginURL.Scheme,
+		Host:   p.LoginURL.Host,
+		Path:   fmt.Sprintf("/api/v4/projects/%d/members/all/%s", projectID, url.PathEscape(userID)),
+	}
+
+	err := requests.New(endpointURL.String()).
+		WithContext(ctx).
+		SetHeader("Authorization", tokenTypeBearer+" "+s.AccessToken).
+		Do().
+		UnmarshalInto(&member)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project member: %v", err)
+	}
+
+	return &member, nil
+}
+
 func formatProject(project *gitlabProject) string {
 	return gitlabProjectPrefix + project.Name
 }
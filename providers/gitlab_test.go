@@ -39,6 +39,7 @@ func testGitLabProvider(hostname, scope string, opts options.Provider) (*GitLabP
 func testGitLabBackend() *httptest.Server {
 	userInfo := `
 		{
+			"sub": "123",
 			"nickname": "FooBar",
 			"email": "foo@bar.com",
 			"email_verified": false,
@@ -103,6 +104,27 @@ func testGitLabBackend() *httptest.Server {
 		}
 	`
 
+	inheritedProjectInfo := `
+		{
+			"id": 42,
+			"name": "MyInheritedProject",
+			"archived": false,
+			"path_with_namespace": "my_group/my_subgroup/my_inherited_project",
+			"permissions": {
+				"project_access": null,
+				"group_access": null
+			}
+		}
+	`
+
+	inheritedProjectMember := `
+		{
+			"id": 123,
+			"username": "FooBar",
+			"access_level": 30
+		}
+	`
+
 	authHeader := "Bearer gitlab_access_token"
 
 	return httptest.NewServer(http.HandlerFunc(
@@ -143,6 +165,20 @@ func testGitLabBackend() *httptest.Server {
 				} else {
 					w.WriteHeader(401)
 				}
+			case "/api/v4/projects/my_group/my_subgroup/my_inherited_project":
+				if r.Header["Authorization"][0] == authHeader {
+					w.WriteHeader(200)
+					w.Write([]byte(inheritedProjectInfo))
+				} else {
+					w.WriteHeader(401)
+				}
+			case "/api/v4/projects/42/members/all/123":
+				if r.Header["Authorization"][0] == authHeader {
+					w.WriteHeader(200)
+					w.Write([]byte(inheritedProjectMember))
+				} else {
+					w.WriteHeader(401)
+				}
 			case "/api/v4/projects/my_group/my_bad_project":
 				w.WriteHeader(403)
 			default:
@@ -293,6 +329,18 @@ var _ = Describe("Gitlab Provider Tests", func() {
 				expectedGroups:  []string{"foo", "bar"},
 				expectedScope:   "openid email read_api",
 			}),
+			Entry("project membership valid on project inherited from an ancestor group", entitiesTableInput{
+				allowedProjects: []string{"my_group/my_subgroup/my_inherited_project=30"},
+				expectedAuthz:   true,
+				expectedGroups:  []string{"foo", "bar", "project:my_group/my_subgroup/my_inherited_project"},
+				expectedScope:   "openid email read_api",
+			}),
+			Entry("project membership invalid on project inherited from an ancestor group, insufficient access level", entitiesTableInput{
+				allowedProjects: []string{"my_group/my_subgroup/my_inherited_project=40"},
+				expectedAuthz:   false,
+				expectedGroups:  []string{"foo", "bar"},
+				expectedScope:   "openid email read_api",
+			}),
 			Entry("project membership invalid", entitiesTableInput{
 				allowedProjects: []string{"my_group/my_bad_project"},
 				expectedAuthz:   false,
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
@@ -22,6 +23,7 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/cloudidentity/v1"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
@@ -39,7 +41,7 @@ type GoogleProvider struct {
 	// This hits the Google API for each group, so it is called on Redeem &
 	// Refresh. `Authorize` uses the results of this saved in `session.Groups`
 	// Since it is called on every request.
-	groupValidator func(*sessions.SessionState) bool
+	groupValidator func(context.Context, *sessions.SessionState) bool
 }
 
 var _ Provider = (*GoogleProvider)(nil)
@@ -97,12 +99,12 @@ func NewGoogleProvider(p *ProviderData, opts options.GoogleOptions) (*GoogleProv
 		ProviderData: p,
 		// Set a default groupValidator to just always return valid (true), it will
 		// be overwritten if we configured a Google group restriction.
-		groupValidator: func(*sessions.SessionState) bool {
+		groupValidator: func(context.Context, *sessions.SessionState) bool {
 			return true
 		},
 	}
 
-	if opts.ServiceAccountJSON != "" || opts.UseApplicationDefaultCredentials {
+	if opts.ServiceAccountJSON != "" || opts.UseApplicationDefaultCredentials || opts.UseCloudIdentity {
 		// Backwards compatibility with `--google-group` option
 		if len(opts.Groups) > 0 {
 			provider.setAllowedGroups(opts.Groups)
@@ -111,6 +113,10 @@ func NewGoogleProvider(p *ProviderData, opts options.GoogleOptions) (*GoogleProv
 		provider.setGroupRestriction(opts)
 	}
 
+	if opts.APITokens {
+		p.exchangeTokenFunc = provider.exchangeRefreshToken
+	}
+
 	return provider, nil
 }
 
@@ -197,13 +203,13 @@ func (p *GoogleProvider) Redeem(ctx context.Context, redirectURL, code, codeVeri
 
 // EnrichSession checks the listed Google Groups configured and adds any
 // that the user is a member of to session.Groups.
-func (p *GoogleProvider) EnrichSession(_ context.Context, s *sessions.SessionState) error {
+func (p *GoogleProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
 	// TODO (@NickMeves) - Move to pure EnrichSession logic and stop
 	// reusing legacy `groupValidator`.
 	//
 	// This is called here to get the validator to do the `session.Groups`
 	// populating logic.
-	p.groupValidator(s)
+	p.groupValidator(ctx, s)
 
 	return nil
 }
@@ -215,13 +221,26 @@ func (p *GoogleProvider) EnrichSession(_ context.Context, s *sessions.SessionSta
 //
 // TODO (@NickMeves) - Unit Test this OR refactor away from groupValidator func
 func (p *GoogleProvider) setGroupRestriction(opts options.GoogleOptions) {
-	adminService := getAdminService(opts)
-	p.groupValidator = func(s *sessions.SessionState) bool {
+	var inGroup func(ctx context.Context, group, email string) bool
+	if opts.UseCloudIdentity {
+		checker := &cloudIdentityGroupChecker{
+			service:    getCloudIdentityService(opts),
+			groupNames: make(map[string]string),
+		}
+		inGroup = checker.userInGroup
+	} else {
+		adminService := getAdminService(opts)
+		inGroup = func(ctx context.Context, group, email string) bool {
+			return userInGroup(ctx, adminService, group, email)
+		}
+	}
+
+	p.groupValidator = func(ctx context.Context, s *sessions.SessionState) bool {
 		// Reset our saved Groups in case membership changed
 		// This is used by `Authorize` on every request
 		s.Groups = make([]string, 0, len(opts.Groups))
 		for _, group := range opts.Groups {
-			if userInGroup(adminService, group, s.Email) {
+			if inGroup(ctx, group, s.Email) {
 				s.Groups = append(s.Groups, group)
 			}
 		}
@@ -268,6 +287,31 @@ func getAdminService(opts options.GoogleOptions) *admin.Service {
 	return adminService
 }
 
+// getCloudIdentityService creates a Cloud Identity service authenticated with
+// the Application Default Credentials, impersonating the target principal
+// when one is set. No domain-wide delegation is needed: the service account
+// only needs to be allowed to view the groups.
+func getCloudIdentityService(opts options.GoogleOptions) *cloudidentity.Service {
+	ctx := context.Background()
+	clientOpts := []option.ClientOption{option.WithScopes(cloudidentity.CloudIdentityGroupsReadonlyScope)}
+	if opts.TargetPrincipal != "" {
+		ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: opts.TargetPrincipal,
+			Scopes:          []string{cloudidentity.CloudIdentityGroupsReadonlyScope},
+		})
+		if err != nil {
+			logger.Fatal("failed to fetch application default credentials: ", err)
+		}
+		clientOpts = append(clientOpts, option.WithTokenSource(ts))
+	}
+
+	service, err := cloudidentity.NewService(ctx, clientOpts...)
+	if err != nil {
+		logger.Fatal("failed to create Cloud Identity service: ", err)
+	}
+	return service
+}
+
 func getTargetPrincipal(ctx context.Context, opts options.GoogleOptions) (targetPrincipal string) {
 	targetPrincipal = opts.TargetPrincipal
 
@@ -298,9 +342,9 @@ func getTargetPrincipal(ctx context.Context, opts options.GoogleOptions) (target
 	return targetPrincipal
 }
 
-func userInGroup(service *admin.Service, group string, email string) bool {
+func userInGroup(ctx context.Context, service *admin.Service, group string, email string) bool {
 	// Use the HasMember API to checking for the user's presence in each group or nested subgroups
-	req := service.Members.HasMember(group, email)
+	req := service.Members.HasMember(group, email).Context(ctx)
 	r, err := req.Do()
 	if err == nil {
 		return r.IsMember
@@ -315,7 +359,7 @@ func userInGroup(service *admin.Service, group string, email string) bool {
 		// One case that can cause this is if the user email is from a different domain than the group,
 		// e.g. "member@otherdomain.com" in the group "group@mydomain.com" will result in a 400 error
 		// from the HasMember API. In that case, attempt to query the member object directly from the group.
-		req := service.Members.Get(group, email)
+		req := service.Members.Get(group, email).Context(ctx)
 		r, err := req.Do()
 		if err != nil {
 			logger.Errorf("error using get API to check member %s of google group %s: user not in the group", email, group)
@@ -333,6 +377,54 @@ func userInGroup(service *admin.Service, group string, email string) bool {
 	return false
 }
 
+// cloudIdentityGroupChecker checks group membership with the Cloud Identity
+// API, caching the resource names of the groups
+type cloudIdentityGroupChecker struct {
+	service *cloudidentity.Service
+
+	mu         sync.Mutex
+	groupNames map[string]string
+}
+
+// userInGroup checks whether the user is a member of the group, directly or
+// through nested groups
+func (c *cloudIdentityGroupChecker) userInGroup(ctx context.Context, group string, email string) bool {
+	name, err := c.groupName(ctx, group)
+	if err != nil {
+		logger.Errorf("error looking up group %s: %v", group, err)
+		return false
+	}
+
+	query := fmt.Sprintf("member_key_id == '%s'", strings.ReplaceAll(email, "'", "\\'"))
+	r, err := c.service.Groups.Memberships.CheckTransitiveMembership(name).Query(query).Context(ctx).Do()
+	if err != nil {
+		logger.Errorf("error checking membership of %s in group %s: %v", email, group, err)
+		return false
+	}
+	return r.HasMembership
+}
+
+// groupName returns the resource name, eg `groups/abc123`, of the group with
+// the email
+func (c *cloudIdentityGroupChecker) groupName(ctx context.Context, group string) (string, error) {
+	c.mu.Lock()
+	name, ok := c.groupNames[group]
+	c.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	r, err := c.service.Groups.Lookup().GroupKeyId(group).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.groupNames[group] = r.Name
+	c.mu.Unlock()
+	return r.Name, nil
+}
+
 // RefreshSession uses the RefreshToken to fetch new Access and ID Tokens
 func (p *GoogleProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
 	if s == nil || s.RefreshToken == "" {
@@ -348,13 +440,61 @@ func (p *GoogleProvider) RefreshSession(ctx context.Context, s *sessions.Session
 	// behavior in the `RefreshSession` case.
 	//
 	// re-check that the user is in the proper google group(s)
-	if !p.groupValidator(s) {
+	if !p.groupValidator(ctx, s) {
 		return false, fmt.Errorf("%s is no longer in the group(s)", s.Email)
 	}
 
 	return true, nil
 }
 
+// exchangeRefreshToken redeems the refresh token of the session for an access
+// token restricted to the scopes, which must have been granted to it.
+// Google does not support audiences, the scopes select the APIs the access
+// token can call.
+func (p *GoogleProvider) exchangeRefreshToken(ctx context.Context, s *sessions.SessionState, _ string, scopes []string) (*oauth2.Token, error) {
+	if s == nil || s.RefreshToken == "" {
+		return nil, errors.New("session has no refresh token to exchange")
+	}
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("client_id", p.ClientID)
+	params.Add("client_secret", clientSecret)
+	params.Add("refresh_token", s.RefreshToken)
+	params.Add("grant_type", "refresh_token")
+	if len(scopes) > 0 {
+		params.Add("scope", strings.Join(scopes, " "))
+	}
+
+	var data struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = requests.New(p.RedeemURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		Do().
+		UnmarshalInto(&data)
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange the refresh token for scopes %v: %v", scopes, err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken: data.AccessToken,
+		TokenType:   data.TokenType,
+	}
+	if data.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(data.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
 func (p *GoogleProvider) redeemRefreshToken(ctx context.Context, s *sessions.SessionState) error {
 	// https://developers.google.com/identity/protocols/OAuth2WebServer#refresh
 	clientSecret, err := p.GetClientSecret()
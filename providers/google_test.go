@@ -15,6 +15,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/cloudidentity/v1"
 	option "google.golang.org/api/option"
 )
 
@@ -125,14 +126,14 @@ func TestGoogleProviderGroupValidator(t *testing.T) {
 
 	testCases := map[string]struct {
 		session       *sessions.SessionState
-		validatorFunc func(*sessions.SessionState) bool
+		validatorFunc func(context.Context, *sessions.SessionState) bool
 		expectedAuthZ bool
 	}{
 		"Email is authorized with groupValidator": {
 			session: &sessions.SessionState{
 				Email: sessionEmail,
 			},
-			validatorFunc: func(s *sessions.SessionState) bool {
+			validatorFunc: func(_ context.Context, s *sessions.SessionState) bool {
 				return s.Email == sessionEmail
 			},
 			expectedAuthZ: true,
@@ -141,7 +142,7 @@ func TestGoogleProviderGroupValidator(t *testing.T) {
 			session: &sessions.SessionState{
 				Email: sessionEmail,
 			},
-			validatorFunc: func(s *sessions.SessionState) bool {
+			validatorFunc: func(_ context.Context, s *sessions.SessionState) bool {
 				return s.Email != sessionEmail
 			},
 			expectedAuthZ: false,
@@ -161,7 +162,7 @@ func TestGoogleProviderGroupValidator(t *testing.T) {
 			if tc.validatorFunc != nil {
 				p.groupValidator = tc.validatorFunc
 			}
-			g.Expect(p.groupValidator(tc.session)).To(Equal(tc.expectedAuthZ))
+			g.Expect(p.groupValidator(context.Background(), tc.session)).To(Equal(tc.expectedAuthZ))
 		})
 	}
 }
@@ -276,15 +277,93 @@ func TestGoogleProvider_userInGroup(t *testing.T) {
 
 	service.BasePath = ts.URL
 
-	result := userInGroup(service, "group@example.com", "member-in-domain@example.com")
+	result := userInGroup(context.Background(), service, "group@example.com", "member-in-domain@example.com")
 	assert.True(t, result)
 
-	result = userInGroup(service, "group@example.com", "member-out-of-domain@otherexample.com")
+	result = userInGroup(context.Background(), service, "group@example.com", "member-out-of-domain@otherexample.com")
 	assert.True(t, result)
 
-	result = userInGroup(service, "group@example.com", "non-member-in-domain@example.com")
+	result = userInGroup(context.Background(), service, "group@example.com", "non-member-in-domain@example.com")
 	assert.False(t, result)
 
-	result = userInGroup(service, "group@example.com", "non-member-out-of-domain@otherexample.com")
+	result = userInGroup(context.Background(), service, "group@example.com", "non-member-out-of-domain@otherexample.com")
 	assert.False(t, result)
+
+	// Membership is not checked once the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = userInGroup(ctx, service, "group@example.com", "member-in-domain@example.com")
+	assert.False(t, result)
+}
+
+func TestGoogleProvider_cloudIdentityUserInGroup(t *testing.T) {
+	lookups := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/groups:lookup":
+			lookups++
+			if r.URL.Query().Get("groupKey.id") == "group@example.com" {
+				fmt.Fprintln(w, `{"name": "groups/abc123"}`)
+			} else {
+				http.Error(w, `{"error": {"code": 404, "message": "Not found"}}`, http.StatusNotFound)
+			}
+		case "/v1/groups/abc123/memberships:checkTransitiveMembership":
+			switch r.URL.Query().Get("query") {
+			case "member_key_id == 'member@example.com'":
+				fmt.Fprintln(w, `{"hasMembership": true}`)
+			case "member_key_id == 'forbidden@example.com'":
+				http.Error(w, `{"error": {"code": 403, "message": "Forbidden"}}`, http.StatusForbidden)
+			default:
+				fmt.Fprintln(w, `{"hasMembership": false}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	service, err := cloudidentity.NewService(context.Background(), option.WithHTTPClient(ts.Client()))
+	assert.NoError(t, err)
+	service.BasePath = ts.URL + "/"
+
+	checker := &cloudIdentityGroupChecker{service: service, groupNames: make(map[string]string)}
+
+	assert.True(t, checker.userInGroup(context.Background(), "group@example.com", "member@example.com"))
+	assert.False(t, checker.userInGroup(context.Background(), "group@example.com", "non-member@example.com"))
+	assert.False(t, checker.userInGroup(context.Background(), "group@example.com", "forbidden@example.com"))
+	assert.False(t, checker.userInGroup(context.Background(), "missing@example.com", "member@example.com"))
+
+	// The resource name of the group is only looked up once
+	assert.Equal(t, 2, lookups)
+}
+
+func TestGoogleProviderAPITokens(t *testing.T) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		form = r.PostForm
+		fmt.Fprintln(w, `{"access_token": "bigquery_token", "token_type": "Bearer", "expires_in": 3599}`)
+	}))
+	defer ts.Close()
+
+	redeemURL, err := url.Parse(ts.URL)
+	assert.NoError(t, err)
+	p, err := NewGoogleProvider(&ProviderData{RedeemURL: redeemURL, ClientID: "client", ClientSecret: "secret"}, options.GoogleOptions{APITokens: true})
+	assert.NoError(t, err)
+
+	session := &sessions.SessionState{AccessToken: "access_token", RefreshToken: "refresh_token"}
+	token, err := p.Data().ExchangeToken(context.Background(), session, "ignored", []string{"https://www.googleapis.com/auth/bigquery.readonly"})
+	assert.NoError(t, err)
+	assert.Equal(t, "bigquery_token", token.AccessToken)
+	assert.False(t, token.Expiry.IsZero())
+	assert.Equal(t, url.Values{
+		"client_id":     []string{"client"},
+		"client_secret": []string{"secret"},
+		"refresh_token": []string{"refresh_token"},
+		"grant_type":    []string{"refresh_token"},
+		"scope":         []string{"https://www.googleapis.com/auth/bigquery.readonly"},
+	}, form)
+
+	_, err = p.Data().ExchangeToken(context.Background(), &sessions.SessionState{AccessToken: "access_token"}, "", nil)
+	assert.EqualError(t, err, "session has no refresh token to exchange")
 }
@@ -2,11 +2,16 @@ package providers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"golang.org/x/oauth2"
 )
 
 // stripToken is a helper function to obfuscate "access_token"
@@ -88,3 +93,83 @@ func hasQueryParams(endpoint string) bool {
 
 	return len(endpointURL.RawQuery) != 0
 }
+
+// oauth2Config returns the configuration redeeming and refreshing the tokens
+// of providers that are not OIDC providers. The client credentials are sent
+// in the request body, as all of them support it.
+func oauth2Config(p *ProviderData, redirectURL string) (*oauth2.Config, error) {
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  p.RedeemURL.String(),
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: redirectURL,
+	}, nil
+}
+
+// redeemOAuth2Code exchanges the code for a session with the access token,
+// refresh token and expiry of the token response
+func redeemOAuth2Code(ctx context.Context, p *ProviderData, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
+	if code == "" {
+		return nil, ErrMissingCode
+	}
+	c, err := oauth2Config(p, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []oauth2.AuthCodeOption
+	if codeVerifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	}
+
+	ctx = oidc.ClientContext(ctx, requests.DefaultHTTPClient)
+	token, err := c.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %v", err)
+	}
+
+	s := &sessions.SessionState{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+	}
+	s.CreatedAtNow()
+	if !token.Expiry.IsZero() {
+		s.SetExpiresOn(token.Expiry)
+	}
+	return s, nil
+}
+
+// refreshOAuth2Token refreshes the access token of the session with its
+// refresh token, keeping the refresh token when no new one is issued
+func refreshOAuth2Token(ctx context.Context, p *ProviderData, s *sessions.SessionState) error {
+	c, err := oauth2Config(p, "")
+	if err != nil {
+		return err
+	}
+
+	t := &oauth2.Token{
+		RefreshToken: s.RefreshToken,
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	ctx = oidc.ClientContext(ctx, requests.DefaultHTTPClient)
+	token, err := c.TokenSource(ctx, t).Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %v", err)
+	}
+
+	s.AccessToken = token.AccessToken
+	s.RefreshToken = token.RefreshToken
+	s.CreatedAtNow()
+	s.ExpiresOn = nil
+	if !token.Expiry.IsZero() {
+		s.SetExpiresOn(token.Expiry)
+	}
+	return nil
+}
@@ -3,16 +3,25 @@ package providers
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
 )
 
-const keycloakOIDCProviderName = "Keycloak OIDC"
+const (
+	keycloakOIDCProviderName = "Keycloak OIDC"
+
+	// keycloakDefaultRolePrefix distinguishes roles from groups in the session
+	keycloakDefaultRolePrefix = "role:"
+)
 
 // KeycloakOIDCProvider creates a Keycloak provider based on OIDCProvider
 type KeycloakOIDCProvider struct {
 	*OIDCProvider
+
+	realmRolePrefix  string
+	clientRolePrefix string
 }
 
 // NewKeycloakOIDCProvider makes a KeycloakOIDCProvider using the ProviderData
@@ -22,7 +31,15 @@ func NewKeycloakOIDCProvider(p *ProviderData, opts options.Provider) *KeycloakOI
 	})
 
 	provider := &KeycloakOIDCProvider{
-		OIDCProvider: NewOIDCProvider(p, opts.OIDCConfig),
+		OIDCProvider:     NewOIDCProvider(p, opts.OIDCConfig),
+		realmRolePrefix:  keycloakDefaultRolePrefix,
+		clientRolePrefix: keycloakDefaultRolePrefix,
+	}
+	if opts.KeycloakConfig.RealmRolePrefix != nil {
+		provider.realmRolePrefix = *opts.KeycloakConfig.RealmRolePrefix
+	}
+	if opts.KeycloakConfig.ClientRolePrefix != nil {
+		provider.clientRolePrefix = *opts.KeycloakConfig.ClientRolePrefix
 	}
 
 	provider.addAllowedRoles(opts.KeycloakConfig.Roles)
@@ -33,14 +50,39 @@ var _ Provider = (*KeycloakOIDCProvider)(nil)
 
 // addAllowedRoles sets Keycloak roles that are authorized.
 // Assumes `SetAllowedGroups` is already called on groups and appends to that
-// with `role:` prefixed roles.
+// with the prefixed roles.
 func (p *KeycloakOIDCProvider) addAllowedRoles(roles []string) {
 	if p.AllowedGroups == nil {
 		p.AllowedGroups = make(map[string]struct{})
 	}
 	for _, role := range roles {
-		p.AllowedGroups[formatRole(role)] = struct{}{}
+		for _, group := range p.roleGroups(role) {
+			p.AllowedGroups[group] = struct{}{}
+		}
+	}
+}
+
+// HasRole checks whether the session user has the realm role, or the client
+// role when given as `<client>:<role>`
+func (p *KeycloakOIDCProvider) HasRole(s *sessions.SessionState, role string) bool {
+	for _, group := range p.roleGroups(role) {
+		for _, sessionGroup := range s.Groups {
+			if sessionGroup == group {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// roleGroups returns the session groups the role may be added as: realm
+// roles, and client roles when the role names a client
+func (p *KeycloakOIDCProvider) roleGroups(role string) []string {
+	groups := []string{p.realmRolePrefix + role}
+	if strings.Contains(role, ":") && p.clientRolePrefix != p.realmRolePrefix {
+		groups = append(groups, p.clientRolePrefix+role)
+	}
+	return groups
 }
 
 // CreateSessionFromToken converts Bearer IDTokens into sessions
@@ -86,13 +128,12 @@ func (p *KeycloakOIDCProvider) extractRoles(ctx context.Context, s *sessions.Ses
 		return err
 	}
 
-	var roles []string
-	roles = append(roles, claims.RealmAccess.Roles...)
-	roles = append(roles, getClientRoles(claims)...)
-
-	// Add to groups list with `role:` prefix to distinguish from groups
-	for _, role := range roles {
-		s.Groups = append(s.Groups, formatRole(role))
+	// Add to groups list with a prefix to distinguish from groups
+	for _, role := range claims.RealmAccess.Roles {
+		s.Groups = append(s.Groups, p.realmRolePrefix+role)
+	}
+	for _, role := range getClientRoles(claims) {
+		s.Groups = append(s.Groups, p.clientRolePrefix+role)
 	}
 	return nil
 }
@@ -157,7 +198,3 @@ func getClientRoles(claims *accessClaims) []string {
 	}
 	return clientRoles
 }
-
-func formatRole(role string) string {
-	return fmt.Sprintf("role:%s", role)
-}
@@ -119,6 +119,37 @@ var _ = Describe("Keycloak OIDC Provider Tests", func() {
 			Expect(p.AllowedGroups).To(HaveKey("role:admin"))
 			Expect(p.AllowedGroups).To(HaveKey("role:editor"))
 		})
+
+		It("should use the configured role prefixes", func() {
+			realmPrefix := ""
+			clientPrefix := "client-role:"
+			p := newKeycloakOIDCProvider(nil, options.Provider{
+				KeycloakConfig: options.KeycloakOptions{
+					Roles:            []string{"admin", "app:editor"},
+					RealmRolePrefix:  &realmPrefix,
+					ClientRolePrefix: &clientPrefix,
+				},
+			})
+			Expect(p.AllowedGroups).To(HaveKey("admin"))
+			Expect(p.AllowedGroups).To(HaveKey("app:editor"))
+			Expect(p.AllowedGroups).To(HaveKey("client-role:app:editor"))
+			Expect(p.AllowedGroups).ToNot(HaveKey("client-role:admin"))
+		})
+	})
+
+	Context("Has Role", func() {
+		It("should check the realm and client roles of the session", func() {
+			clientPrefix := "client-role:"
+			p := newKeycloakOIDCProvider(nil, options.Provider{
+				KeycloakConfig: options.KeycloakOptions{ClientRolePrefix: &clientPrefix},
+			})
+			session := &sessions.SessionState{Groups: []string{"role:write", "client-role:default:read", "default:write"}}
+
+			Expect(p.HasRole(session, "write")).To(BeTrue())
+			Expect(p.HasRole(session, "default:read")).To(BeTrue())
+			Expect(p.HasRole(session, "read")).To(BeFalse())
+			Expect(p.HasRole(session, "default:write")).To(BeFalse())
+		})
 	})
 
 	Context("Enrich Session", func() {
@@ -183,6 +214,22 @@ var _ = Describe("Keycloak OIDC Provider Tests", func() {
 		})
 	})
 
+	Context("Role Prefixes", func() {
+		It("should add roles to groups with the configured prefixes", func() {
+			server, provider := newTestKeycloakOIDCSetup()
+			defer server.Close()
+			provider.realmRolePrefix = "realm:"
+			provider.clientRolePrefix = ""
+
+			session := &sessions.SessionState{
+				IDToken:     idToken,
+				AccessToken: getAccessToken(),
+			}
+			Expect(provider.extractRoles(context.Background(), session)).To(Succeed())
+			Expect(session.Groups).To(Equal([]string{"realm:write", "default:read"}))
+		})
+	})
+
 	Context("Refresh Session", func() {
 		It("should refresh session and extract roles again", func() {
 			server, provider := newTestKeycloakOIDCSetup()
@@ -16,6 +16,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
 )
 
@@ -128,6 +129,7 @@ func (p *LoginGovProvider) configure(opts options.LoginGovOptions) error {
 			return fmt.Errorf("could not read key file: %v", opts.JWTKeyFile)
 		}
 		signKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+		encryption.Zero(keyData)
 		if err != nil {
 			return fmt.Errorf("could not parse private key from PEM file: %v", opts.JWTKeyFile)
 		}
@@ -150,10 +152,10 @@ type loginGovCustomClaims struct {
 }
 
 // checkNonce checks the nonce in the id_token
-func checkNonce(idToken string, p *LoginGovProvider) (err error) {
+func checkNonce(ctx context.Context, idToken string, p *LoginGovProvider) (err error) {
 	token, err := jwt.ParseWithClaims(idToken, &loginGovCustomClaims{}, func(_ *jwt.Token) (interface{}, error) {
 		var pubkeys jose.JSONWebKeySet
-		rerr := requests.New(p.PubJWKURL.String()).Do().UnmarshalInto(&pubkeys)
+		rerr := requests.New(p.PubJWKURL.String()).WithContext(ctx).Do().UnmarshalInto(&pubkeys)
 		if rerr != nil {
 			return nil, rerr
 		}
@@ -247,7 +249,7 @@ func (p *LoginGovProvider) Redeem(ctx context.Context, _, code, codeVerifier str
 	}
 
 	// check nonce here
-	err = checkNonce(jsonResponse.IDToken, p)
+	err = checkNonce(ctx, jsonResponse.IDToken, p)
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +19,8 @@ import (
 type OIDCProvider struct {
 	*ProviderData
 
-	SkipNonce bool
+	SkipNonce        bool
+	GroupsOverageURL string
 }
 
 const oidcDefaultScope = "openid email profile"
@@ -49,8 +50,9 @@ func NewOIDCProvider(p *ProviderData, opts options.OIDCOptions) *OIDCProvider {
 	p.getAuthorizationHeaderFunc = makeOIDCHeader
 
 	return &OIDCProvider{
-		ProviderData: p,
-		SkipNonce:    opts.InsecureSkipNonce,
+		ProviderData:     p,
+		SkipNonce:        opts.InsecureSkipNonce,
+		GroupsOverageURL: opts.GroupsOverageURL,
 	}
 }
 
@@ -117,7 +119,7 @@ func (p *OIDCProvider) ValidateSession(ctx context.Context, s *sessions.SessionS
 	if p.SkipNonce {
 		return true
 	}
-	err = p.checkNonce(s)
+	err = p.checkNonce(ctx, s)
 	if err != nil {
 		logger.Errorf("nonce verification failed: %v", err)
 		return false
@@ -160,6 +162,7 @@ func (p *OIDCProvider) redeemRefreshToken(ctx context.Context, s *sessions.Sessi
 		RefreshToken: s.RefreshToken,
 		Expiry:       time.Now().Add(-time.Hour),
 	}
+	ctx = oidc.ClientContext(ctx, requests.DefaultHTTPClient)
 	token, err := c.TokenSource(ctx, t).Token()
 	if err != nil {
 		return fmt.Errorf("failed to get token: %v", err)
@@ -197,7 +200,7 @@ func (p *OIDCProvider) CreateSessionFromToken(ctx context.Context, token string)
 		return nil, err
 	}
 
-	ss, err := p.buildSessionFromClaims(token, "")
+	ss, err := p.buildSessionFromClaims(ctx, token, "")
 	if err != nil {
 		return nil, err
 	}
@@ -234,11 +237,15 @@ func (p *OIDCProvider) createSession(ctx context.Context, token *oauth2.Token, r
 	}
 
 	rawIDToken := getIDToken(token)
-	ss, err := p.buildSessionFromClaims(rawIDToken, token.AccessToken)
+	ss, err := p.buildSessionFromClaims(ctx, rawIDToken, token.AccessToken)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := p.resolveGroupsOverage(ctx, rawIDToken, token.AccessToken, ss); err != nil {
+		return nil, fmt.Errorf("could not resolve groups overage: %v", err)
+	}
+
 	ss.AccessToken = token.AccessToken
 	ss.RefreshToken = token.RefreshToken
 	ss.IDToken = rawIDToken
@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// groupsOverageEndpoint is the placeholder in the groups overage URL that is
+// replaced with the endpoint advertised in the `_claim_sources` claim
+const groupsOverageEndpoint = "endpoint"
+
+var groupsOveragePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// resolveGroupsOverage fetches the user's groups when the IdP has left them
+// out of the ID token, signalling this with the `_claim_names` and
+// `_claim_sources` distributed claims.
+// Groups are only fetched when the GroupsOverageURL is configured.
+func (p *OIDCProvider) resolveGroupsOverage(ctx context.Context, rawIDToken, accessToken string, s *sessions.SessionState) error {
+	if p.GroupsOverageURL == "" || rawIDToken == "" || len(s.Groups) > 0 {
+		return nil
+	}
+
+	// Only the ID token claims are used, the profile URL is not requested
+	extractor, err := util.NewClaimExtractor(ctx, rawIDToken, &url.URL{}, nil)
+	if err != nil {
+		return fmt.Errorf("could not initialise claim extractor: %v", err)
+	}
+
+	source, ok, err := util.GetClaimSource(extractor, p.GroupsClaim)
+	if err != nil || !ok {
+		return err
+	}
+
+	groupsURL, err := expandGroupsOverageURL(p.GroupsOverageURL, source.Endpoint, extractor)
+	if err != nil {
+		return err
+	}
+
+	token := accessToken
+	if source.AccessToken != "" {
+		token = source.AccessToken
+	}
+	if token == "" {
+		return errors.New("no access token to request groups with")
+	}
+
+	json, err := requests.New(groupsURL).
+		WithContext(ctx).
+		WithHeaders(makeOIDCHeader(token)).
+		Do().
+		UnmarshalSimpleJSON()
+	if err != nil {
+		return fmt.Errorf("error requesting groups: %v", err)
+	}
+
+	groups, err := groupsFromOverageResponse(json, p.GroupsClaim)
+	if err != nil {
+		return err
+	}
+	s.Groups = groups
+	return nil
+}
+
+// expandGroupsOverageURL replaces the placeholders in the URL template with
+// the claim source endpoint or the values of the ID token claims
+func expandGroupsOverageURL(template, endpoint string, extractor util.ClaimExtractor) (string, error) {
+	var errs []error
+	expanded := groupsOveragePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == groupsOverageEndpoint {
+			if endpoint == "" {
+				errs = append(errs, errors.New("claim source has no endpoint"))
+			}
+			return endpoint
+		}
+
+		var value string
+		exists, err := extractor.GetClaimInto(name, &value)
+		if err != nil || !exists || value == "" {
+			errs = append(errs, fmt.Errorf("could not get claim %q for the groups overage URL", name))
+			return ""
+		}
+		return url.PathEscape(value)
+	})
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+	return expanded, nil
+}
+
+// groupsFromOverageResponse reads the groups from the response, either from
+// the groups claim or from a Microsoft Graph style `value` list of group
+// names or group objects with an `id`
+func groupsFromOverageResponse(json *simplejson.Json, groupsClaim string) ([]string, error) {
+	if groups, ok := json.CheckGet(groupsClaim); ok {
+		return groups.StringArray()
+	}
+
+	values, ok := json.CheckGet("value")
+	if !ok {
+		return nil, fmt.Errorf("groups response has neither a %q nor a \"value\" field", groupsClaim)
+	}
+	items, err := values.Array()
+	if err != nil {
+		return nil, fmt.Errorf("could not read groups response: %v", err)
+	}
+
+	groups := make([]string, 0, len(items))
+	for i := range items {
+		item := values.GetIndex(i)
+		if group, err := item.String(); err == nil {
+			groups = append(groups, group)
+			continue
+		}
+		if id, err := item.Get("id").String(); err == nil {
+			groups = append(groups, id)
+		}
+	}
+	return groups, nil
+}
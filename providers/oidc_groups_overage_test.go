@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGroupsOverageTestSetup(t *testing.T, groupsBody string) (*OIDCProvider, *[]string) {
+	overageIDToken := defaultIDToken
+	overageIDToken.Groups = nil
+	overageIDToken.ClaimNames = map[string]string{"groups": "src1"}
+
+	var requests []string
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Add("content-type", "application/json")
+		if r.URL.Path == "/login/oauth/access_token" {
+			overageIDToken.ClaimSources = map[string]interface{}{
+				"src1": map[string]string{"endpoint": serverURL + "/source/groups"},
+			}
+			idToken, err := newSignedTestIDToken(overageIDToken)
+			assert.NoError(t, err)
+			body, err := json.Marshal(redeemTokenResponse{
+				AccessToken:  accessToken,
+				ExpiresIn:    10,
+				TokenType:    "Bearer",
+				RefreshToken: refreshToken,
+				IDToken:      idToken,
+			})
+			assert.NoError(t, err)
+			_, _ = rw.Write(body)
+			return
+		}
+
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("Authorization"))
+		_, _ = rw.Write([]byte(groupsBody))
+	}))
+	t.Cleanup(server.Close)
+	serverURL = server.URL
+
+	u, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	provider := newOIDCProvider(u, true)
+	provider.SkipClaimsFromProfileURL = true
+	return provider, &requests
+}
+
+func TestOIDCProviderGroupsOverage(t *testing.T) {
+	testCases := []struct {
+		name             string
+		groupsOverageURL string
+		groupsBody       string
+		expectedRequests []string
+		expectedGroups   []string
+		expectedError    string
+	}{
+		{
+			name:             "disabled",
+			groupsOverageURL: "",
+			expectedGroups:   nil,
+		},
+		{
+			name:             "from the claim source endpoint",
+			groupsOverageURL: "{endpoint}",
+			groupsBody:       `{"groups": ["a", "b"]}`,
+			expectedRequests: []string{"/source/groups Bearer " + accessToken},
+			expectedGroups:   []string{"a", "b"},
+		},
+		{
+			name:             "from a templated URL with Graph style group objects",
+			groupsOverageURL: "{endpoint}/users/{sub}/memberOf",
+			groupsBody:       `{"value": [{"id": "c"}, {"id": "d"}, "e"]}`,
+			expectedRequests: []string{"/source/groups/users/123456789/memberOf Bearer " + accessToken},
+			expectedGroups:   []string{"c", "d", "e"},
+		},
+		{
+			name:             "with a missing claim",
+			groupsOverageURL: "{endpoint}/{oid}",
+			expectedError:    "could not resolve groups overage: could not get claim \"oid\" for the groups overage URL",
+		},
+		{
+			name:             "with an unexpected response",
+			groupsOverageURL: "{endpoint}",
+			groupsBody:       `{"members": []}`,
+			expectedRequests: []string{"/source/groups Bearer " + accessToken},
+			expectedError:    "could not resolve groups overage: groups response has neither a \"groups\" nor a \"value\" field",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider, requests := newGroupsOverageTestSetup(t, tc.groupsBody)
+			provider.GroupsOverageURL = tc.groupsOverageURL
+
+			session, err := provider.Redeem(context.Background(), provider.RedeemURL.String(), "code1234", "")
+			assert.Equal(t, tc.expectedRequests, *requests)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedGroups, session.Groups)
+		})
+	}
+}
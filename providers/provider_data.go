@@ -9,6 +9,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
@@ -16,6 +17,7 @@ import (
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/secrets"
 	"golang.org/x/oauth2"
 )
 
@@ -36,6 +38,7 @@ type ProviderData struct {
 	ClientID          string
 	ClientSecret      string
 	ClientSecretFile  string
+	ClientSecretRef   string
 	Scope             string
 	// The picked CodeChallenge Method or empty if none.
 	CodeChallengeMethod string
@@ -49,12 +52,17 @@ type ProviderData struct {
 	GroupsClaim              string
 	Verifier                 internaloidc.IDTokenVerifier
 	SkipClaimsFromProfileURL bool
+	UserInfoEnrichment       bool
+	PreferUserInfoClaims     bool
+	DistributedClaims        bool
 
 	// Universal Group authorization data structure
 	// any provider can set to consume
 	AllowedGroups map[string]struct{}
 
 	getAuthorizationHeaderFunc func(string) http.Header
+	exchangeTokenFunc          func(context.Context, *sessions.SessionState, string, []string) (*oauth2.Token, error)
+	signOutURLFunc             func(*sessions.SessionState, string) string
 	loginURLParameterDefaults  url.Values
 	loginURLParameterOverrides map[string]*regexp.Regexp
 
@@ -64,11 +72,41 @@ type ProviderData struct {
 // Data returns the ProviderData
 func (p *ProviderData) Data() *ProviderData { return p }
 
+// WarmUp fetches the keys the ID tokens of the provider are verified with,
+// when its verifier fetches them from a JWKS URL
+func (p *ProviderData) WarmUp(ctx context.Context) error {
+	if verifier, ok := p.Verifier.(interface{ WarmUp(context.Context) error }); ok {
+		return verifier.WarmUp(ctx)
+	}
+	return nil
+}
+
+// SignOutURL returns the URL the user is redirected to when signing out, for
+// providers that sign the user out of their own session in the browser, which
+// redirects the user on to the absolute redirect URL. It is empty for other
+// providers.
+func (p *ProviderData) SignOutURL(s *sessions.SessionState, redirect string) string {
+	if p.signOutURLFunc == nil {
+		return ""
+	}
+	return p.signOutURLFunc(s, redirect)
+}
+
 func (p *ProviderData) GetClientSecret() (clientSecret string, err error) {
-	if p.ClientSecret != "" || p.ClientSecretFile == "" {
+	if p.ClientSecret != "" || (p.ClientSecretFile == "" && p.ClientSecretRef == "") {
 		return p.ClientSecret, nil
 	}
 
+	if p.ClientSecretRef != "" {
+		// The secret is cached by the resolver and renewed once it expires
+		refClientSecret, err := secrets.Get(context.Background(), p.ClientSecretRef)
+		if err != nil {
+			logger.Errorf("error loading client secret %s: %s", p.ClientSecretRef, err)
+			return "", errors.New("could not load client secret")
+		}
+		return string(refClientSecret), nil
+	}
+
 	// Getting ClientSecret can fail in runtime so we need to report it without returning the file name to the user
 	fileClientSecret, err := os.ReadFile(p.ClientSecretFile)
 	if err != nil {
@@ -238,14 +276,14 @@ func (p *ProviderData) verifyIDToken(ctx context.Context, token *oauth2.Token) (
 
 // buildSessionFromClaims uses IDToken claims to populate a fresh SessionState
 // with non-Token related fields.
-func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*sessions.SessionState, error) {
+func (p *ProviderData) buildSessionFromClaims(ctx context.Context, rawIDToken, accessToken string) (*sessions.SessionState, error) {
 	ss := &sessions.SessionState{}
 
 	if rawIDToken == "" {
 		return ss, nil
 	}
 
-	extractor, err := p.getClaimExtractor(rawIDToken, accessToken)
+	extractor, err := p.getClaimExtractor(ctx, rawIDToken, accessToken)
 	if err != nil {
 		return nil, err
 	}
@@ -260,12 +298,24 @@ func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*
 		{p.GroupsClaim, &ss.Groups},
 		// TODO (@NickMeves) Deprecate for dynamic claim to session mapping
 		{"preferred_username", &ss.PreferredUsername},
+		{"acr", &ss.ACR},
+		{"amr", &ss.AMR},
 	} {
 		if _, err := extractor.GetClaimInto(c.claim, c.dst); err != nil {
 			return nil, err
 		}
 	}
 
+	var authTime int64
+	hasAuthTime, err := extractor.GetClaimInto("auth_time", &authTime)
+	if err != nil {
+		return nil, err
+	}
+	if hasAuthTime {
+		t := time.Unix(authTime, 0)
+		ss.AuthTime = &t
+	}
+
 	// `email_verified` must be present and explicitly set to `false` to be
 	// considered unverified.
 	verifyEmail := (p.EmailClaim == options.OIDCEmailClaim) && !p.AllowUnverifiedEmail
@@ -285,13 +335,24 @@ func (p *ProviderData) buildSessionFromClaims(rawIDToken, accessToken string) (*
 	return ss, nil
 }
 
-func (p *ProviderData) getClaimExtractor(rawIDToken, accessToken string) (util.ClaimExtractor, error) {
+func (p *ProviderData) getClaimExtractor(ctx context.Context, rawIDToken, accessToken string) (util.ClaimExtractor, error) {
 	profileURL := p.ProfileURL
 	if p.SkipClaimsFromProfileURL {
 		profileURL = &url.URL{}
 	}
 
-	extractor, err := util.NewClaimExtractor(context.TODO(), rawIDToken, profileURL, p.getAuthorizationHeader(accessToken))
+	var opts []util.ClaimExtractorOption
+	if p.DistributedClaims {
+		opts = append(opts, util.WithDistributedClaims())
+	}
+
+	var extractor util.ClaimExtractor
+	var err error
+	if p.UserInfoEnrichment && !p.SkipClaimsFromProfileURL {
+		extractor, err = util.NewMergingClaimExtractor(ctx, rawIDToken, profileURL, p.getAuthorizationHeader(accessToken), p.PreferUserInfoClaims, opts...)
+	} else {
+		extractor, err = util.NewClaimExtractor(ctx, rawIDToken, profileURL, p.getAuthorizationHeader(accessToken), opts...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("could not initialise claim extractor: %v", err)
 	}
@@ -300,8 +361,8 @@ func (p *ProviderData) getClaimExtractor(rawIDToken, accessToken string) (util.C
 }
 
 // checkNonce compares the session's nonce with the IDToken's nonce claim
-func (p *ProviderData) checkNonce(s *sessions.SessionState) error {
-	extractor, err := p.getClaimExtractor(s.IDToken, "")
+func (p *ProviderData) checkNonce(ctx context.Context, s *sessions.SessionState) error {
+	extractor, err := p.getClaimExtractor(ctx, s.IDToken, "")
 	if err != nil {
 		return fmt.Errorf("id_token claims extraction failed: %v", err)
 	}
@@ -65,6 +65,19 @@ var (
 		RegisteredClaims: registeredClaims,
 	}
 
+	stepUpAuthTime = time.Unix(1311280970, 0)
+
+	stepUpIDToken = idTokenClaims{
+		Name:             "Jane Dobbs",
+		Email:            "janed@me.com",
+		Verified:         &verified,
+		ACR:              "phrh",
+		AMR:              []string{"pwd", "otp", "mfa"},
+		AuthTime:         1311280970,
+		Nonce:            encryption.HashNonce([]byte(oidcNonce)),
+		RegisteredClaims: registeredClaims,
+	}
+
 	numericGroupsIDToken = idTokenClaims{
 		Name:             "Jane Dobbs",
 		Email:            "janed@me.com",
@@ -120,6 +133,12 @@ type idTokenClaims struct {
 	Roles    interface{} `json:"roles,omitempty"`
 	Verified *bool       `json:"email_verified,omitempty"`
 	Nonce    string      `json:"nonce,omitempty"`
+	ACR      string      `json:"acr,omitempty"`
+	AMR      []string    `json:"amr,omitempty"`
+	AuthTime int64       `json:"auth_time,omitempty"`
+
+	ClaimNames   map[string]string      `json:"_claim_names,omitempty"`
+	ClaimSources map[string]interface{} `json:"_claim_sources,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -234,6 +253,9 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 		GroupsClaim              string
 		SkipClaimsFromProfileURL bool
 		SetProfileURL            bool
+		ProfileResponse          string
+		UserInfoEnrichment       bool
+		PreferUserInfoClaims     bool
 		ExpectedError            error
 		ExpectedSession          *sessions.SessionState
 		ExpectProfileURLCalled   bool
@@ -251,6 +273,21 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 				PreferredUsername: "Jane Dobbs",
 			},
 		},
+		"Authentication Context": {
+			IDToken:         stepUpIDToken,
+			AllowUnverified: false,
+			EmailClaim:      "email",
+			GroupsClaim:     "groups",
+			UserClaim:       "sub",
+			ExpectedSession: &sessions.SessionState{
+				User:              "123456789",
+				Email:             "janed@me.com",
+				PreferredUsername: "Jane Dobbs",
+				ACR:               "phrh",
+				AMR:               []string{"pwd", "otp", "mfa"},
+				AuthTime:          &stepUpAuthTime,
+			},
+		},
 		"Unverified Denied": {
 			IDToken:         unverifiedIDToken,
 			AllowUnverified: false,
@@ -417,6 +454,39 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 			SkipClaimsFromProfileURL: true,
 			ExpectedSession:          &sessions.SessionState{},
 		},
+		"Enrich claims from ProfileURL": {
+			IDToken:                defaultIDToken,
+			EmailClaim:             "email",
+			GroupsClaim:            "groups",
+			UserClaim:              "sub",
+			SetProfileURL:          true,
+			ProfileResponse:        `{"email": "jane@example.com", "groups": ["test:b", "test:c"]}`,
+			UserInfoEnrichment:     true,
+			ExpectProfileURLCalled: true,
+			ExpectedSession: &sessions.SessionState{
+				User:              "123456789",
+				Email:             "janed@me.com",
+				Groups:            []string{"test:a", "test:b", "test:c"},
+				PreferredUsername: "Jane Dobbs",
+			},
+		},
+		"Enrich claims from ProfileURL preferring them": {
+			IDToken:                defaultIDToken,
+			EmailClaim:             "email",
+			GroupsClaim:            "groups",
+			UserClaim:              "sub",
+			SetProfileURL:          true,
+			ProfileResponse:        `{"email": "jane@example.com", "groups": ["test:b", "test:c"]}`,
+			UserInfoEnrichment:     true,
+			PreferUserInfoClaims:   true,
+			ExpectProfileURLCalled: true,
+			ExpectedSession: &sessions.SessionState{
+				User:              "123456789",
+				Email:             "jane@example.com",
+				Groups:            []string{"test:b", "test:c", "test:a"},
+				PreferredUsername: "Jane Dobbs",
+			},
+		},
 	}
 	for testName, tc := range testCases {
 		t.Run(testName, func(t *testing.T) {
@@ -429,6 +499,10 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 			if tc.SetProfileURL {
 				profileURLSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					profileURLCalled = true
+					if tc.ProfileResponse != "" {
+						w.Write([]byte(tc.ProfileResponse))
+						return
+					}
 					w.Write([]byte("{}"))
 				}))
 				defer profileURLSrv.Close()
@@ -453,11 +527,13 @@ func TestProviderData_buildSessionFromClaims(t *testing.T) {
 			provider.EmailClaim = tc.EmailClaim
 			provider.GroupsClaim = tc.GroupsClaim
 			provider.SkipClaimsFromProfileURL = tc.SkipClaimsFromProfileURL
+			provider.UserInfoEnrichment = tc.UserInfoEnrichment
+			provider.PreferUserInfoClaims = tc.PreferUserInfoClaims
 
 			rawIDToken, err := newSignedTestIDToken(tc.IDToken)
 			g.Expect(err).ToNot(HaveOccurred())
 
-			ss, err := provider.buildSessionFromClaims(rawIDToken, "testtoken")
+			ss, err := provider.buildSessionFromClaims(context.Background(), rawIDToken, "testtoken")
 			if err != nil {
 				g.Expect(err).To(Equal(tc.ExpectedError))
 			}
@@ -520,7 +596,7 @@ func TestProviderData_checkNonce(t *testing.T) {
 				), verificationOptions),
 			}
 
-			if err := provider.checkNonce(tc.Session); err != nil {
+			if err := provider.checkNonce(context.Background(), tc.Session); err != nil {
 				g.Expect(err).To(Equal(tc.ExpectedError))
 			} else {
 				g.Expect(err).ToNot(HaveOccurred())
@@ -129,6 +129,13 @@ func (p *ProviderData) Authorize(_ context.Context, s *sessions.SessionState) (b
 	return false, nil
 }
 
+// HasRole checks whether the session user has a role with the provider.
+// Providers that do not add the roles of the user to the session have no
+// roles.
+func (p *ProviderData) HasRole(_ *sessions.SessionState, _ string) bool {
+	return false
+}
+
 // ValidateSession validates the AccessToken
 func (p *ProviderData) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
 	return validateToken(ctx, p, s.AccessToken, nil)
@@ -61,6 +61,25 @@ func TestCodeChallengeNotConfigured(t *testing.T) {
 	assert.NotContains(t, result, "code_challenge_method")
 }
 
+func TestLoginURLScopeOverride(t *testing.T) {
+	p := &ProviderData{
+		LoginURL: &url.URL{
+			Scheme: "http",
+			Host:   "my.test.idp",
+			Path:   "/oauth/authorize",
+		},
+		Scope: "openid email",
+	}
+
+	result := p.GetLoginURL("https://my.test.app/oauth", "", "", url.Values{})
+	assert.Contains(t, result, "scope=openid+email")
+
+	result = p.GetLoginURL("https://my.test.app/oauth", "", "", url.Values{"scope": []string{"openid email calendar.read"}})
+	u, err := url.Parse(result)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid email calendar.read"}, u.Query()["scope"])
+}
+
 func TestProviderDataEnrichSession(t *testing.T) {
 	g := NewWithT(t)
 	p := &ProviderData{}
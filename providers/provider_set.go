@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+	"golang.org/x/oauth2"
+)
+
+// ProviderSet holds all of the configured providers, identified by the IDs
+// of their configuration, so that users can choose which one to sign in with.
+// Sessions record the ID of the provider they were created with so that they
+// are refreshed and validated by the same provider.
+type ProviderSet struct {
+	ids       []string
+	providers map[string]Provider
+	names     map[string]string
+	hosts     map[string][]string
+}
+
+// NewProviderSet creates the providers from their configuration.
+// The first provider is the default, used for sessions that do not record
+// their provider.
+func NewProviderSet(providerConfigs options.Providers) (*ProviderSet, error) {
+	s := &ProviderSet{
+		providers: make(map[string]Provider),
+		names:     make(map[string]string),
+		hosts:     make(map[string][]string),
+	}
+
+	for _, providerConfig := range providerConfigs {
+		provider, err := NewProvider(providerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error initialising provider %q: %v", providerConfig.ID, err)
+		}
+
+		name := providerConfig.Name
+		if name == "" {
+			name = provider.Data().ProviderName
+		}
+
+		s.ids = append(s.ids, providerConfig.ID)
+		s.providers[providerConfig.ID] = provider
+		s.names[providerConfig.ID] = name
+		s.hosts[providerConfig.ID] = providerConfig.Hosts
+	}
+
+	if len(s.ids) == 0 {
+		return nil, fmt.Errorf("no providers configured")
+	}
+	return s, nil
+}
+
+// IDs returns the IDs of the providers in the order they were configured
+func (s *ProviderSet) IDs() []string {
+	return s.ids
+}
+
+// DefaultID returns the ID of the default provider
+func (s *ProviderSet) DefaultID() string {
+	return s.ids[0]
+}
+
+// Default returns the default provider
+func (s *ProviderSet) Default() Provider {
+	return s.providers[s.DefaultID()]
+}
+
+// Get returns the provider with the given ID
+func (s *ProviderSet) Get(id string) (Provider, bool) {
+	provider, ok := s.providers[id]
+	return provider, ok
+}
+
+// Name returns the display name of the provider with the given ID
+func (s *ProviderSet) Name(id string) string {
+	return s.names[id]
+}
+
+// ForHost returns the ID of the first provider configured for the request
+// host, if any
+func (s *ProviderSet) ForHost(host string) (string, bool) {
+	endpoint := &url.URL{Host: host}
+	for _, id := range s.ids {
+		if util.IsEndpointAllowed(endpoint, s.hosts[id]) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// ForSession returns the provider the session was created with.
+// Sessions that do not record their provider belong to the default provider.
+func (s *ProviderSet) ForSession(ss *sessions.SessionState) (Provider, bool) {
+	if ss.ProviderID == "" {
+		return s.Default(), true
+	}
+	return s.Get(ss.ProviderID)
+}
+
+// RefreshSession refreshes the session with the provider it was created with
+func (s *ProviderSet) RefreshSession(ctx context.Context, ss *sessions.SessionState) (bool, error) {
+	provider, ok := s.ForSession(ss)
+	if !ok {
+		return false, fmt.Errorf("session was created with unknown provider %q", ss.ProviderID)
+	}
+	return provider.RefreshSession(ctx, ss)
+}
+
+// ExchangeToken exchanges the access token of the session for an access
+// token of the audience, with the provider the session was created with
+func (s *ProviderSet) ExchangeToken(ctx context.Context, ss *sessions.SessionState, audience string, scopes []string) (*oauth2.Token, error) {
+	provider, ok := s.ForSession(ss)
+	if !ok {
+		return nil, fmt.Errorf("session was created with unknown provider %q", ss.ProviderID)
+	}
+	return provider.Data().ExchangeToken(ctx, ss, audience, scopes)
+}
+
+// ValidateSession validates the session with the provider it was created with.
+// Sessions created with a provider that is no longer configured are invalid.
+func (s *ProviderSet) ValidateSession(ctx context.Context, ss *sessions.SessionState) bool {
+	provider, ok := s.ForSession(ss)
+	if !ok {
+		logger.Errorf("Session was created with unknown provider %q", ss.ProviderID)
+		return false
+	}
+	return provider.ValidateSession(ctx, ss)
+}
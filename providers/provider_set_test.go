@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+)
+
+func TestProviderSet(t *testing.T) {
+	g := NewWithT(t)
+
+	s, err := NewProviderSet(options.Providers{
+		{
+			ID:           "github",
+			Type:         options.GitHubProvider,
+			ClientID:     "client",
+			ClientSecret: "secret",
+		},
+		{
+			ID:           "digitalocean",
+			Type:         options.DigitalOceanProvider,
+			Name:         "DO",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Hosts:        []string{".do.example.com", "example.net:8443"},
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(s.IDs()).To(Equal([]string{"github", "digitalocean"}))
+	g.Expect(s.DefaultID()).To(Equal("github"))
+	g.Expect(s.Default().Data().ProviderName).To(Equal("GitHub"))
+	g.Expect(s.Name("github")).To(Equal("GitHub"))
+	g.Expect(s.Name("digitalocean")).To(Equal("DO"))
+
+	for host, want := range map[string]string{
+		"app.do.example.com": "digitalocean",
+		"do.example.com":     "digitalocean",
+		"example.net:8443":   "digitalocean",
+		"example.net":        "",
+		"example.com":        "",
+	} {
+		id, ok := s.ForHost(host)
+		g.Expect(ok).To(Equal(want != ""), host)
+		g.Expect(id).To(Equal(want), host)
+	}
+
+	provider, ok := s.ForSession(&sessions.SessionState{})
+	g.Expect(ok).To(BeTrue())
+	g.Expect(provider).To(BeIdenticalTo(s.Default()))
+
+	provider, ok = s.ForSession(&sessions.SessionState{ProviderID: "digitalocean"})
+	g.Expect(ok).To(BeTrue())
+	g.Expect(provider.Data().ProviderName).To(Equal("DigitalOcean"))
+
+	// Sessions of providers that are no longer configured cannot be used
+	unknown := &sessions.SessionState{ProviderID: "removed"}
+	_, ok = s.ForSession(unknown)
+	g.Expect(ok).To(BeFalse())
+	g.Expect(s.ValidateSession(context.Background(), unknown)).To(BeFalse())
+	_, err = s.RefreshSession(context.Background(), unknown)
+	g.Expect(err).To(MatchError(`session was created with unknown provider "removed"`))
+}
+
+func TestProviderSetErrors(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewProviderSet(options.Providers{})
+	g.Expect(err).To(MatchError("no providers configured"))
+
+	_, err = NewProviderSet(options.Providers{{ID: "bad", Type: "unknown"}})
+	g.Expect(err).To(MatchError(ContainSubstring(`error initialising provider "bad"`)))
+}
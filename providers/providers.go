@@ -7,8 +7,11 @@ import (
 
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
 	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"github.com/prometheus/client_golang/prometheus"
 	k8serrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
@@ -26,6 +29,7 @@ type Provider interface {
 	GetEmailAddress(ctx context.Context, s *sessions.SessionState) (string, error)
 	EnrichSession(ctx context.Context, s *sessions.SessionState) error
 	Authorize(ctx context.Context, s *sessions.SessionState) (bool, error)
+	HasRole(s *sessions.SessionState, role string) bool
 	ValidateSession(ctx context.Context, s *sessions.SessionState) bool
 	RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error)
 	CreateSessionFromToken(ctx context.Context, token string) (*sessions.SessionState, error)
@@ -36,6 +40,15 @@ func NewProvider(providerConfig options.Provider) (Provider, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not create provider data: %v", err)
 	}
+	provider, err := newProvider(providerData, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+	provider = withCallContext(provider, providerTimeout(providerConfig), providerRetryPolicy(providerConfig))
+	return withRefreshThrottle(provider, requests.DefaultThrottle, prometheus.DefaultRegisterer), nil
+}
+
+func newProvider(providerData *ProviderData, providerConfig options.Provider) (Provider, error) {
 	switch providerConfig.Type {
 	case options.ADFSProvider:
 		return NewADFSProvider(providerData, providerConfig), nil
@@ -43,8 +56,12 @@ func NewProvider(providerConfig options.Provider) (Provider, error) {
 		return NewAzureProvider(providerData, providerConfig.AzureConfig), nil
 	case options.BitbucketProvider:
 		return NewBitbucketProvider(providerData, providerConfig.BitbucketConfig), nil
+	case options.CognitoProvider:
+		return NewCognitoProvider(providerData, providerConfig), nil
 	case options.DigitalOceanProvider:
 		return NewDigitalOceanProvider(providerData), nil
+	case options.DiscordProvider:
+		return NewDiscordProvider(providerData, providerConfig.DiscordConfig)
 	case options.FacebookProvider:
 		return NewFacebookProvider(providerData), nil
 	case options.GitHubProvider:
@@ -65,6 +82,12 @@ func NewProvider(providerConfig options.Provider) (Provider, error) {
 		return NewNextcloudProvider(providerData), nil
 	case options.OIDCProvider:
 		return NewOIDCProvider(providerData, providerConfig.OIDCConfig), nil
+	case options.SAMLProvider:
+		return NewSAMLProvider(providerData, providerConfig.SAMLConfig)
+	case options.SlackProvider:
+		return NewSlackProvider(providerData, providerConfig.SlackConfig), nil
+	case options.TwitchProvider:
+		return NewTwitchProvider(providerData), nil
 	default:
 		return nil, fmt.Errorf("unknown provider type %q", providerConfig.Type)
 	}
@@ -76,6 +99,7 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 		ClientID:         providerConfig.ClientID,
 		ClientSecret:     providerConfig.ClientSecret,
 		ClientSecretFile: providerConfig.ClientSecretFile,
+		ClientSecretRef:  providerConfig.ClientSecretRef,
 	}
 
 	needsVerifier, err := providerRequiresOIDCProviderVerifier(providerConfig.Type)
@@ -84,15 +108,21 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 	}
 
 	if needsVerifier {
-		pv, err := internaloidc.NewProviderVerifier(context.TODO(), internaloidc.ProviderVerifierOptions{
+		pvOpts := internaloidc.ProviderVerifierOptions{
 			AudienceClaims:         providerConfig.OIDCConfig.AudienceClaims,
 			ClientID:               providerConfig.ClientID,
 			ExtraAudiences:         providerConfig.OIDCConfig.ExtraAudiences,
 			IssuerURL:              providerConfig.OIDCConfig.IssuerURL,
 			JWKsURL:                providerConfig.OIDCConfig.JwksURL,
 			SkipDiscovery:          providerConfig.OIDCConfig.SkipDiscovery,
+			DiscoveryTimeout:       providerTimeout(providerConfig),
 			SkipIssuerVerification: providerConfig.OIDCConfig.InsecureSkipIssuerVerification,
-		})
+		}
+		if encryption.FIPSMode() {
+			pvOpts.SupportedSigningAlgs = encryption.FIPSApprovedSigningAlgs
+		}
+
+		pv, err := internaloidc.NewProviderVerifier(context.TODO(), pvOpts)
 		if err != nil {
 			return nil, fmt.Errorf("error building OIDC ProviderVerifier: %v", err)
 		}
@@ -139,6 +169,9 @@ func newProviderDataFromConfig(providerConfig options.Provider) (*ProviderData,
 	p.EmailClaim = providerConfig.OIDCConfig.EmailClaim
 	p.GroupsClaim = providerConfig.OIDCConfig.GroupsClaim
 	p.SkipClaimsFromProfileURL = providerConfig.SkipClaimsFromProfileURL
+	p.UserInfoEnrichment = providerConfig.OIDCConfig.UserInfoEnrichment
+	p.PreferUserInfoClaims = providerConfig.OIDCConfig.UserInfoPrecedence == options.OIDCUserInfoPrecedenceUserInfo
+	p.DistributedClaims = providerConfig.OIDCConfig.DistributedClaims
 
 	// Set PKCE enabled or disabled based on discovery and force options
 	p.CodeChallengeMethod = parseCodeChallengeMethod(providerConfig)
@@ -178,10 +211,12 @@ func parseCodeChallengeMethod(providerConfig options.Provider) string {
 
 func providerRequiresOIDCProviderVerifier(providerType options.ProviderType) (bool, error) {
 	switch providerType {
-	case options.BitbucketProvider, options.DigitalOceanProvider, options.FacebookProvider, options.GitHubProvider,
-		options.GoogleProvider, options.KeycloakProvider, options.LinkedInProvider, options.LoginGovProvider, options.NextCloudProvider:
+	case options.BitbucketProvider, options.DigitalOceanProvider, options.DiscordProvider, options.FacebookProvider,
+		options.GitHubProvider, options.GoogleProvider, options.KeycloakProvider, options.LinkedInProvider,
+		options.LoginGovProvider, options.NextCloudProvider, options.SAMLProvider, options.SlackProvider, options.TwitchProvider:
 		return false, nil
-	case options.ADFSProvider, options.AzureProvider, options.GitLabProvider, options.KeycloakOIDCProvider, options.OIDCProvider:
+	case options.ADFSProvider, options.AzureProvider, options.CognitoProvider, options.GitLabProvider, options.KeycloakOIDCProvider,
+		options.OIDCProvider:
 		return true, nil
 	default:
 		return false, fmt.Errorf("unknown provider type: %s", providerType)
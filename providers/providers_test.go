@@ -1,6 +1,8 @@
 package providers
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -72,6 +74,41 @@ func TestClientSecretFileOption(t *testing.T) {
 	g.Expect(s).To(Equal("testcase"))
 }
 
+func TestClientSecretRefOption(t *testing.T) {
+	g := NewWithT(t)
+
+	vault := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/secret/data/oauth2-proxy" || req.Header.Get("X-Vault-Token") != "vault-token" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(`{"data":{"data":{"client-secret":"testcase"},"metadata":{"version":1}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	providerConfig := options.Provider{
+		ID:              providerID,
+		Type:            "google",
+		ClientID:        clientID,
+		ClientSecretRef: "vault://secret/data/oauth2-proxy#client-secret",
+	}
+
+	p, err := newProviderDataFromConfig(providerConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.ClientSecretRef).To(Equal(providerConfig.ClientSecretRef))
+
+	s, err := p.GetClientSecret()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(s).To(Equal("testcase"))
+
+	p.ClientSecretRef = "vault://secret/data/oauth2-proxy#missing"
+	s, err = p.GetClientSecret()
+	g.Expect(err).To(MatchError("could not load client secret"))
+	g.Expect(s).To(BeEmpty())
+}
+
 func TestSkipOIDCDiscovery(t *testing.T) {
 	g := NewWithT(t)
 	providerConfig := options.Provider{
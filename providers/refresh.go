@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/metrics"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// refreshProvider holds back session refreshes while the provider has asked
+// for requests to slow down, sharing the throttle with every other refresh in
+// the process, and records metrics for the refreshes
+type refreshProvider struct {
+	Provider
+	throttle *requests.Throttle
+	metrics  *refreshMetrics
+}
+
+// withRefreshThrottle wraps the provider so that its session refreshes honour
+// the throttle
+func withRefreshThrottle(p Provider, throttle *requests.Throttle, registerer prometheus.Registerer) Provider {
+	return &refreshProvider{
+		Provider: p,
+		throttle: throttle,
+		metrics:  newRefreshMetrics(registerer),
+	}
+}
+
+func (p *refreshProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	p.metrics.inFlight.Inc()
+	defer p.metrics.inFlight.Dec()
+
+	ctx = requests.WithThrottle(ctx, p.throttle)
+	refreshed, err := p.Provider.RefreshSession(ctx, s)
+	p.metrics.refreshes.WithLabelValues(refreshResult(refreshed, err, requests.WasThrottled(ctx))).Inc()
+	return refreshed, err
+}
+
+// refreshResult is the result label of the refresh metrics
+func refreshResult(refreshed bool, err error, throttled bool) string {
+	switch {
+	case err != nil && throttled:
+		return "throttled"
+	case errors.Is(err, ErrNotImplemented):
+		return "not_implemented"
+	case err != nil:
+		return "error"
+	case refreshed:
+		return "refreshed"
+	default:
+		return "not_refreshed"
+	}
+}
+
+// refreshMetrics are the prometheus metrics recorded for session refreshes
+type refreshMetrics struct {
+	inFlight  prometheus.Gauge
+	refreshes *prometheus.CounterVec
+}
+
+func newRefreshMetrics(registerer prometheus.Registerer) *refreshMetrics {
+	return &refreshMetrics{
+		inFlight: metrics.Register(registerer, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "oauth2_proxy_session_refreshes_in_flight",
+				Help: "Number of session refreshes currently in progress with the provider.",
+			},
+		)).(prometheus.Gauge),
+		refreshes: metrics.Register(registerer, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "oauth2_proxy_session_refreshes_total",
+				Help: "Total number of session refreshes with the provider, by result.",
+			},
+			[]string{"result"},
+		)).(*prometheus.CounterVec),
+	}
+}
@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRefreshResult(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(refreshResult(true, nil, false)).To(Equal("refreshed"))
+	g.Expect(refreshResult(false, nil, false)).To(Equal("not_refreshed"))
+	g.Expect(refreshResult(false, ErrNotImplemented, false)).To(Equal("not_implemented"))
+	g.Expect(refreshResult(false, errors.New("failed"), false)).To(Equal("error"))
+	g.Expect(refreshResult(false, errors.New("failed"), true)).To(Equal("throttled"))
+}
+
+func TestRefreshThrottle(t *testing.T) {
+	g := NewWithT(t)
+
+	var requestCount int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		requestCount++
+		rw.Header().Set("Retry-After", "60")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	p := withRefreshThrottle(&requestingProvider{url: server.URL}, requests.NewThrottle(registry), registry).(*refreshProvider)
+
+	// The first refresh is sent and asked to slow down
+	_, err := p.RefreshSession(context.Background(), &sessions.SessionState{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(testutil.ToFloat64(p.metrics.refreshes.WithLabelValues("error"))).To(Equal(1.0))
+
+	// Further refreshes are held back without being sent
+	_, err = p.RefreshSession(context.Background(), &sessions.SessionState{})
+	g.Expect(err).To(MatchError(ContainSubstring("are throttled")))
+	g.Expect(requestCount).To(Equal(1))
+	g.Expect(testutil.ToFloat64(p.metrics.refreshes.WithLabelValues("throttled"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(p.metrics.inFlight)).To(BeZero())
+}
+
+// requestingProvider refreshes sessions by requesting the URL
+type requestingProvider struct {
+	ProviderData
+	url string
+}
+
+func (p *requestingProvider) RefreshSession(ctx context.Context, _ *sessions.SessionState) (bool, error) {
+	if err := requests.New(p.url).WithContext(ctx).Do().Error(); err != nil {
+		return false, err
+	}
+	return false, errors.New("unexpected response")
+}
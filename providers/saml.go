@@ -0,0 +1,606 @@
+package providers
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/encryption"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// SAMLProvider represents a SAML 2.0 identity provider, that users sign in
+// with through the proxy acting as a service provider. Authentication
+// requests are sent with the HTTP-Redirect binding and the identity provider
+// posts its response to the callback with the HTTP-POST binding.
+// The ClientID is the entity ID of the proxy and the LoginURL is the single
+// sign-on endpoint of the identity provider.
+type SAMLProvider struct {
+	*ProviderData
+
+	idpEntityID                string
+	certificates               []*x509.Certificate
+	logoutURL                  *url.URL
+	signingKey                 *rsa.PrivateKey
+	nameIDFormat               string
+	emailAttribute             string
+	groupsAttribute            string
+	preferredUsernameAttribute string
+
+	usedAssertions *samlReplayCache
+}
+
+var _ Provider = (*SAMLProvider)(nil)
+
+const (
+	samlProviderName = "SAML"
+
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlPOSTBinding        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearerMethod       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlEmailNameIDFormat  = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	samlDefaultEmailAttribute  = "email"
+	samlDefaultGroupsAttribute = "groups"
+
+	// samlClockSkew is the difference allowed between the clocks of the
+	// identity provider and the proxy when checking validity periods
+	samlClockSkew = 3 * time.Minute
+)
+
+// NewSAMLProvider initiates a new SAMLProvider
+func NewSAMLProvider(p *ProviderData, opts options.SAMLOptions) (*SAMLProvider, error) {
+	p.setProviderDefaults(providerDefaults{
+		name: samlProviderName,
+	})
+
+	provider := &SAMLProvider{
+		ProviderData:               p,
+		idpEntityID:                opts.IdPEntityID,
+		nameIDFormat:               opts.NameIDFormat,
+		emailAttribute:             opts.EmailAttribute,
+		groupsAttribute:            opts.GroupsAttribute,
+		preferredUsernameAttribute: opts.PreferredUsernameAttribute,
+		usedAssertions:             &samlReplayCache{used: make(map[string]time.Time)},
+	}
+	if provider.emailAttribute == "" {
+		provider.emailAttribute = samlDefaultEmailAttribute
+	}
+	if provider.groupsAttribute == "" {
+		provider.groupsAttribute = samlDefaultGroupsAttribute
+	}
+
+	if err := provider.configure(opts); err != nil {
+		return nil, fmt.Errorf("could not configure SAML provider: %v", err)
+	}
+	p.signOutURLFunc = provider.signOutURL
+	return provider, nil
+}
+
+func (p *SAMLProvider) configure(opts options.SAMLOptions) error {
+	for _, file := range opts.IdPCertificateFiles {
+		certificates, err := loadSAMLCertificates(file)
+		if err != nil {
+			return err
+		}
+		p.certificates = append(p.certificates, certificates...)
+	}
+	if len(p.certificates) == 0 {
+		return errors.New("no identity provider certificates are configured")
+	}
+
+	if opts.LogoutURL != "" {
+		logoutURL, err := url.Parse(opts.LogoutURL)
+		if err != nil {
+			return fmt.Errorf("could not parse logout URL: %v", err)
+		}
+		p.logoutURL = logoutURL
+	}
+
+	if opts.SigningKeyFile != "" {
+		keyData, err := os.ReadFile(opts.SigningKeyFile)
+		if err != nil {
+			return fmt.Errorf("could not read signing key file: %v", opts.SigningKeyFile)
+		}
+		p.signingKey, err = jwt.ParseRSAPrivateKeyFromPEM(keyData)
+		encryption.Zero(keyData)
+		if err != nil {
+			return fmt.Errorf("could not parse RSA Private Key PEM: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadSAMLCertificates reads the PEM encoded certificates of the file
+func loadSAMLCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read certificate file: %v", file)
+	}
+
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse certificate in %s: %v", file, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return certificates, nil
+}
+
+type samlNameID struct {
+	Format string `xml:"Format,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type samlNameIDPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+type samlAuthnRequest struct {
+	XMLName                     xml.Name          `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string            `xml:"ID,attr"`
+	Version                     string            `xml:"Version,attr"`
+	IssueInstant                string            `xml:"IssueInstant,attr"`
+	Destination                 string            `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string            `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string            `xml:"ProtocolBinding,attr"`
+	ForceAuthn                  bool              `xml:"ForceAuthn,attr,omitempty"`
+	Issuer                      string            `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *samlNameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type samlLogoutRequest struct {
+	XMLName      xml.Name   `xml:"urn:oasis:names:tc:SAML:2.0:protocol LogoutRequest"`
+	ID           string     `xml:"ID,attr"`
+	Version      string     `xml:"Version,attr"`
+	IssueInstant string     `xml:"IssueInstant,attr"`
+	Destination  string     `xml:"Destination,attr"`
+	Issuer       string     `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameID       samlNameID `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+}
+
+type samlStatusCode struct {
+	Value      string          `xml:"Value,attr"`
+	StatusCode *samlStatusCode `xml:"StatusCode"`
+}
+
+type samlResponse struct {
+	XMLName     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Destination string   `xml:"Destination,attr"`
+	Status      struct {
+		StatusCode    samlStatusCode `xml:"StatusCode"`
+		StatusMessage string         `xml:"StatusMessage"`
+	} `xml:"Status"`
+	Assertions []samlAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+}
+
+type samlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"Issuer"`
+	Subject struct {
+		NameID               samlNameID `xml:"NameID"`
+		SubjectConfirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   *struct {
+				NotBefore    string `xml:"NotBefore,attr"`
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+				Recipient    string `xml:"Recipient,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions *struct {
+		NotBefore            string `xml:"NotBefore,attr"`
+		NotOnOrAfter         string `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AuthnStatement *struct {
+		SessionNotOnOrAfter string `xml:"SessionNotOnOrAfter,attr"`
+	} `xml:"AuthnStatement"`
+	Attributes []struct {
+		Name         string   `xml:"Name,attr"`
+		FriendlyName string   `xml:"FriendlyName,attr"`
+		Values       []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+// GetLoginURL returns the single sign-on endpoint of the identity provider
+// with an authentication request, in the HTTP-Redirect binding. The state is
+// the relay state, that the identity provider posts back with its response.
+func (p *SAMLProvider) GetLoginURL(redirectURI, state, _ string, extraParams url.Values) string {
+	id, err := newSAMLID()
+	if err != nil {
+		logger.Errorf("Error creating SAML request ID: %v", err)
+		return ""
+	}
+
+	request := samlAuthnRequest{
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                samlTime(time.Now()),
+		Destination:                 p.LoginURL.String(),
+		AssertionConsumerServiceURL: redirectURI,
+		ProtocolBinding:             samlPOSTBinding,
+		ForceAuthn:                  extraParams.Get("prompt") == "login",
+		Issuer:                      p.ClientID,
+	}
+	if p.nameIDFormat != "" {
+		request.NameIDPolicy = &samlNameIDPolicy{Format: p.nameIDFormat, AllowCreate: true}
+	}
+
+	loginURL, err := p.redirectBindingURL(p.LoginURL, request, state)
+	if err != nil {
+		logger.Errorf("Error creating SAML authentication request: %v", err)
+		return ""
+	}
+	return loginURL
+}
+
+// redirectBindingURL returns the endpoint with the deflated request and the
+// relay state as parameters, signed when the proxy has a signing key, as
+// defined by the HTTP-Redirect binding
+func (p *SAMLProvider) redirectBindingURL(endpoint *url.URL, request interface{}, relayState string) (string, error) {
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// The signature covers the parameters in this order, as they are encoded
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	if p.signingKey != nil {
+		query += "&SigAlg=" + url.QueryEscape(rsaSHA256Signature)
+		digest := sha256.Sum256([]byte(query))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, p.signingKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("could not sign request: %v", err)
+		}
+		query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+	}
+
+	u := *endpoint
+	if u.RawQuery != "" {
+		query = u.RawQuery + "&" + query
+	}
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// Redeem verifies the SAML response the identity provider posted to the
+// callback, which is passed as the code, and creates the session of the user
+// from its assertion
+func (p *SAMLProvider) Redeem(_ context.Context, redirectURL, code, _ string) (*sessions.SessionState, error) {
+	if code == "" {
+		return nil, ErrMissingCode
+	}
+
+	assertion, err := p.verifyResponse(code, redirectURL, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response: %v", err)
+	}
+	return p.createSession(assertion)
+}
+
+// verifyResponse checks the status and signature of the response, and the
+// validity of its assertion
+func (p *SAMLProvider) verifyResponse(encoded, redirectURL string, now time.Time) (*samlAssertion, error) {
+	data, err := decodeXMLBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode response: %v", err)
+	}
+	document, err := parseXMLElement(data)
+	if err != nil {
+		return nil, err
+	}
+	if !document.is(samlProtocolNamespace, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+
+	// The status is checked before the signature, as error responses are not
+	// always signed
+	var response samlResponse
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("could not parse response: %v", err)
+	}
+	if status := response.Status.StatusCode; status.Value != samlStatusSuccess {
+		if status.StatusCode != nil {
+			return nil, fmt.Errorf("identity provider responded with status %s (%s): %s", status.Value, status.StatusCode.Value, response.Status.StatusMessage)
+		}
+		return nil, fmt.Errorf("identity provider responded with status %s: %s", status.Value, response.Status.StatusMessage)
+	}
+	if response.Destination != "" && response.Destination != redirectURL {
+		return nil, fmt.Errorf("response is destined to %q rather than %q", response.Destination, redirectURL)
+	}
+	if len(document.childElements(samlAssertionNamespace, "EncryptedAssertion")) != 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+
+	// Either the response or its assertion is signed. Only the content of
+	// the signed element, in its verified canonical form, is read.
+	signed := document
+	if len(document.childElements(xmldsigNamespace, "Signature")) == 0 {
+		assertions := document.childElements(samlAssertionNamespace, "Assertion")
+		if len(assertions) != 1 {
+			return nil, fmt.Errorf("expected one assertion, found %d", len(assertions))
+		}
+		signed = assertions[0]
+	}
+	canonical, err := verifyEnvelopedSignature(signed, document, p.certificates)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify signature: %v", err)
+	}
+
+	assertion := &samlAssertion{}
+	if signed == document {
+		var verified samlResponse
+		if err := xml.Unmarshal(canonical, &verified); err != nil {
+			return nil, fmt.Errorf("could not parse response: %v", err)
+		}
+		if len(verified.Assertions) != 1 {
+			return nil, fmt.Errorf("expected one assertion, found %d", len(verified.Assertions))
+		}
+		assertion = &verified.Assertions[0]
+	} else if err := xml.Unmarshal(canonical, assertion); err != nil {
+		return nil, fmt.Errorf("could not parse assertion: %v", err)
+	}
+
+	if err := p.validateAssertion(assertion, redirectURL, now); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// validateAssertion checks the issuer, conditions and bearer subject
+// confirmation of the assertion, which must not have been used before
+func (p *SAMLProvider) validateAssertion(a *samlAssertion, redirectURL string, now time.Time) error {
+	if issuer := strings.TrimSpace(a.Issuer); p.idpEntityID != "" && issuer != p.idpEntityID {
+		return fmt.Errorf("assertion is issued by %q rather than %q", issuer, p.idpEntityID)
+	}
+
+	if a.Conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+	if err := checkSAMLValidity(a.Conditions.NotBefore, a.Conditions.NotOnOrAfter, now); err != nil {
+		return fmt.Errorf("assertion %v", err)
+	}
+	if len(a.Conditions.AudienceRestrictions) == 0 {
+		return errors.New("assertion has no audience restriction")
+	}
+	for _, restriction := range a.Conditions.AudienceRestrictions {
+		if !slices.ContainsFunc(restriction.Audiences, func(audience string) bool {
+			return strings.TrimSpace(audience) == p.ClientID
+		}) {
+			return fmt.Errorf("assertion is not intended for audience %q", p.ClientID)
+		}
+	}
+
+	expires, err := bearerConfirmationExpiry(a, redirectURL, now)
+	if err != nil {
+		return err
+	}
+	if !p.usedAssertions.use(a.ID, expires.Add(samlClockSkew), now) {
+		return errors.New("assertion has been used before")
+	}
+	return nil
+}
+
+// bearerConfirmationExpiry returns when the bearer subject confirmation of
+// the assertion for the callback expires
+func bearerConfirmationExpiry(a *samlAssertion, redirectURL string, now time.Time) (time.Time, error) {
+	for _, confirmation := range a.Subject.SubjectConfirmations {
+		data := confirmation.Data
+		if confirmation.Method != samlBearerMethod || data == nil || data.NotBefore != "" || data.Recipient != redirectURL {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.NotOnOrAfter)
+		if err != nil || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			continue
+		}
+		return notOnOrAfter, nil
+	}
+	return time.Time{}, fmt.Errorf("assertion has no valid bearer subject confirmation for %q", redirectURL)
+}
+
+// checkSAMLValidity checks that the time is within the validity period,
+// allowing for clock skew
+func checkSAMLValidity(notBefore, notOnOrAfter string, now time.Time) error {
+	if notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("has an invalid NotBefore: %v", err)
+		}
+		if now.Add(samlClockSkew).Before(t) {
+			return errors.New("is not valid yet")
+		}
+	}
+	if notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("has an invalid NotOnOrAfter: %v", err)
+		}
+		if !now.Add(-samlClockSkew).Before(t) {
+			return errors.New("has expired")
+		}
+	}
+	return nil
+}
+
+// createSession maps the name ID and attributes of the assertion to the
+// session. The name ID is the user, and every attribute is kept in the session
+// attributes, with multiple values joined by commas.
+func (p *SAMLProvider) createSession(a *samlAssertion) (*sessions.SessionState, error) {
+	nameID := strings.TrimSpace(a.Subject.NameID.Value)
+	if nameID == "" {
+		return nil, errors.New("assertion has no name ID")
+	}
+
+	attributes := make(map[string][]string)
+	for _, attr := range a.Attributes {
+		values := make([]string, 0, len(attr.Values))
+		for _, value := range attr.Values {
+			values = append(values, strings.TrimSpace(value))
+		}
+		attributes[attr.Name] = append(attributes[attr.Name], values...)
+		if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+			attributes[attr.FriendlyName] = append(attributes[attr.FriendlyName], values...)
+		}
+	}
+	first := func(name string) string {
+		if values := attributes[name]; len(values) != 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	s := &sessions.SessionState{
+		User:   nameID,
+		Email:  first(p.emailAttribute),
+		Groups: attributes[p.groupsAttribute],
+	}
+	if s.Email == "" && a.Subject.NameID.Format == samlEmailNameIDFormat {
+		s.Email = nameID
+	}
+	if p.preferredUsernameAttribute != "" {
+		s.PreferredUsername = first(p.preferredUsernameAttribute)
+	}
+	for _, attr := range a.Attributes {
+		if s.Attributes == nil {
+			s.Attributes = make(map[string]string)
+		}
+		s.Attributes[attr.Name] = strings.Join(attributes[attr.Name], ",")
+	}
+
+	s.CreatedAtNow()
+	if a.AuthnStatement != nil && a.AuthnStatement.SessionNotOnOrAfter != "" {
+		expires, err := time.Parse(time.RFC3339, a.AuthnStatement.SessionNotOnOrAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SessionNotOnOrAfter: %v", err)
+		}
+		s.ExpiresOn = &expires
+	}
+	return s, nil
+}
+
+// ValidateSession returns true, SAML sessions have no token to validate with
+// the identity provider and are valid until they expire
+func (p *SAMLProvider) ValidateSession(_ context.Context, _ *sessions.SessionState) bool {
+	return true
+}
+
+// signOutURL returns the single logout endpoint of the identity provider with
+// a logout request for the name ID of the session, which redirects the user
+// on to the redirect URL, as the relay state, once signed out
+func (p *SAMLProvider) signOutURL(s *sessions.SessionState, redirect string) string {
+	if p.logoutURL == nil || s.User == "" {
+		return ""
+	}
+
+	id, err := newSAMLID()
+	if err != nil {
+		logger.Errorf("Error creating SAML request ID: %v", err)
+		return ""
+	}
+	request := samlLogoutRequest{
+		ID:           id,
+		Version:      "2.0",
+		IssueInstant: samlTime(time.Now()),
+		Destination:  p.logoutURL.String(),
+		Issuer:       p.ClientID,
+		NameID:       samlNameID{Format: p.nameIDFormat, Value: s.User},
+	}
+
+	logoutURL, err := p.redirectBindingURL(p.logoutURL, request, redirect)
+	if err != nil {
+		logger.Errorf("Error creating SAML logout request: %v", err)
+		return ""
+	}
+	return logoutURL
+}
+
+// newSAMLID returns a random ID for a request, which must not start with a
+// digit
+func newSAMLID() (string, error) {
+	nonce, err := encryption.Nonce(16)
+	if err != nil {
+		return "", err
+	}
+	return "id-" + hex.EncodeToString(nonce), nil
+}
+
+// samlTime formats the time as the UTC xs:dateTime of SAML messages
+func samlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// samlReplayCache remembers the IDs of the assertions users signed in with,
+// until they expire, so that each assertion signs a user in at most once.
+// Assertions are only remembered by the instance of the proxy they are used on.
+type samlReplayCache struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// use marks the assertion as used until it expires, returning false if it
+// was used already
+func (c *samlReplayCache) use(id string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for usedID, usedExpires := range c.used {
+		if now.After(usedExpires) {
+			delete(c.used, usedID)
+		}
+	}
+
+	if _, ok := c.used[id]; ok {
+		return false
+	}
+	c.used[id] = expires
+	return true
+}
@@ -0,0 +1,491 @@
+package providers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha256" // register the SHA-256 signature and digest hashes
+	_ "crypto/sha512" // register the SHA-512 signature and digest hashes
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	xmlNamespace        = "http://www.w3.org/XML/1998/namespace"
+	xmldsigNamespace    = "http://www.w3.org/2000/09/xmldsig#"
+	excC14NNamespace    = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSignature  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	rsaSHA256Signature  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	rsaSHA512Signature  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	sha256DigestMethod  = "http://www.w3.org/2001/04/xmlenc#sha256"
+	sha512DigestMethod  = "http://www.w3.org/2001/04/xmlenc#sha512"
+	excC14NTransform    = excC14NNamespace
+	inclusiveNamespaces = "InclusiveNamespaces"
+)
+
+// Only SHA-2 signatures and digests are accepted, SHA-1 ones may be forged
+var (
+	xmldsigSignatureHashes = map[string]crypto.Hash{
+		rsaSHA256Signature: crypto.SHA256,
+		rsaSHA512Signature: crypto.SHA512,
+	}
+	xmldsigDigestHashes = map[string]crypto.Hash{
+		sha256DigestMethod: crypto.SHA256,
+		sha512DigestMethod: crypto.SHA512,
+	}
+)
+
+// xmlElement is an element of a parsed XML document. The prefixes of names
+// are kept, rather than resolved, as the canonical form of signed elements
+// depends on them.
+type xmlElement struct {
+	parent *xmlElement
+	// name.Space is the prefix of the element, not its namespace
+	name  xml.Name
+	attrs []xml.Attr
+	// children are *xmlElement and xml.CharData nodes
+	children []interface{}
+}
+
+// parseXMLElement parses the root element of the document. Comments and
+// processing instructions are left out, and documents with directives, such
+// as DTDs, are rejected.
+func parseXMLElement(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *xmlElement
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse XML: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("could not parse XML: multiple root elements")
+			}
+			e := &xmlElement{
+				parent: current,
+				name:   t.Name,
+				attrs:  append([]xml.Attr(nil), t.Attr...),
+			}
+			if current == nil {
+				root = e
+			} else {
+				current.children = append(current.children, e)
+			}
+			current = e
+		case xml.EndElement:
+			if current == nil || t.Name != current.name {
+				return nil, fmt.Errorf("could not parse XML: unexpected end element %s", qualifiedName(t.Name))
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, t.Copy())
+			}
+		case xml.Directive:
+			return nil, errors.New("could not parse XML: directives are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("could not parse XML: incomplete document")
+	}
+	return root, nil
+}
+
+// qualifiedName returns the name with its prefix, as it appears in the document
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// isNamespaceDeclaration returns whether the attribute declares a namespace
+func isNamespaceDeclaration(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
+// namespace returns the namespace the prefix is bound to in the scope of the
+// element, and whether it is declared at all
+func (e *xmlElement) namespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, attr := range el.attrs {
+			if !isNamespaceDeclaration(attr) {
+				continue
+			}
+			if (prefix == "" && attr.Name.Space == "") || (prefix != "" && attr.Name.Local == prefix) {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// is returns whether the element has the namespace and local name
+func (e *xmlElement) is(namespace, local string) bool {
+	ns, _ := e.namespace(e.name.Space)
+	return e.name.Local == local && ns == namespace
+}
+
+// childElements returns the child elements with the namespace and local name
+func (e *xmlElement) childElements(namespace, local string) []*xmlElement {
+	var elements []*xmlElement
+	for _, child := range e.children {
+		if el, ok := child.(*xmlElement); ok && el.is(namespace, local) {
+			elements = append(elements, el)
+		}
+	}
+	return elements
+}
+
+// childElement returns the child element with the namespace and local name,
+// which must be unique
+func (e *xmlElement) childElement(namespace, local string) (*xmlElement, error) {
+	elements := e.childElements(namespace, local)
+	if len(elements) != 1 {
+		return nil, fmt.Errorf("expected one %s element in %s, found %d", local, e.name.Local, len(elements))
+	}
+	return elements[0], nil
+}
+
+// attr returns the value of the unprefixed attribute
+func (e *xmlElement) attr(local string) string {
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// text returns the character data of the element, without surrounding
+// whitespace
+func (e *xmlElement) text() string {
+	var text strings.Builder
+	for _, child := range e.children {
+		if data, ok := child.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// countID returns the number of elements of the subtree with the ID
+func (e *xmlElement) countID(id string) int {
+	count := 0
+	if e.attr("ID") == id {
+		count++
+	}
+	for _, child := range e.children {
+		if el, ok := child.(*xmlElement); ok {
+			count += el.countID(id)
+		}
+	}
+	return count
+}
+
+// verifyEnvelopedSignature verifies the signature the element, a SAML
+// response or assertion of the document, holds over itself with the
+// certificates of the identity provider. It returns the canonical form of the
+// signed element, which is what the signature covers, so that only verified
+// content is read from it.
+func verifyEnvelopedSignature(e, document *xmlElement, certificates []*x509.Certificate) ([]byte, error) {
+	signature, err := e.childElement(xmldsigNamespace, "Signature")
+	if err != nil {
+		return nil, err
+	}
+	signedInfo, err := signature.childElement(xmldsigNamespace, "SignedInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	// The reference must be to the element holding the signature, and no
+	// other element of the document may share its ID
+	id := e.attr("ID")
+	if id == "" || document.countID(id) != 1 {
+		return nil, fmt.Errorf("signed %s must have a unique ID", e.name.Local)
+	}
+	reference, err := signedInfo.childElement(xmldsigNamespace, "Reference")
+	if err != nil {
+		return nil, err
+	}
+	if reference.attr("URI") != "#"+id {
+		return nil, fmt.Errorf("signature references %q rather than the signed %s", reference.attr("URI"), e.name.Local)
+	}
+
+	canonical, err := canonicalizeReference(e, signature, reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDigest(reference, canonical); err != nil {
+		return nil, err
+	}
+
+	if err := verifySignedInfo(signature, signedInfo, certificates); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// canonicalizeReference applies the transforms of the reference to the
+// signed element
+func canonicalizeReference(e, signature, reference *xmlElement) ([]byte, error) {
+	var (
+		exclude    *xmlElement
+		prefixList string
+		canonical  bool
+	)
+	if transforms := reference.childElements(xmldsigNamespace, "Transforms"); len(transforms) == 1 {
+		for _, transform := range transforms[0].childElements(xmldsigNamespace, "Transform") {
+			switch algorithm := transform.attr("Algorithm"); algorithm {
+			case envelopedSignature:
+				exclude = signature
+			case excC14NTransform:
+				canonical = true
+				prefixList = inclusivePrefixList(transform)
+			default:
+				return nil, fmt.Errorf("unsupported transform %q", algorithm)
+			}
+		}
+	}
+	if exclude == nil || !canonical {
+		return nil, errors.New("signature must be enveloped and use exclusive canonicalization")
+	}
+	return canonicalize(e, exclude, prefixList)
+}
+
+// verifyDigest compares the digest value of the reference with the digest of
+// the canonical form of the signed element
+func verifyDigest(reference *xmlElement, canonical []byte) error {
+	digestMethod, err := reference.childElement(xmldsigNamespace, "DigestMethod")
+	if err != nil {
+		return err
+	}
+	hash, ok := xmldsigDigestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	digestValue, err := reference.childElement(xmldsigNamespace, "DigestValue")
+	if err != nil {
+		return err
+	}
+	expected, err := decodeXMLBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("could not decode digest value: %v", err)
+	}
+
+	h := hash.New()
+	h.Write(canonical)
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return errors.New("digest of the signed element does not match")
+	}
+	return nil
+}
+
+// verifySignedInfo verifies the signature value over the canonical form of
+// the signed info with the public keys of the certificates
+func verifySignedInfo(signature, signedInfo *xmlElement, certificates []*x509.Certificate) error {
+	c14nMethod, err := signedInfo.childElement(xmldsigNamespace, "CanonicalizationMethod")
+	if err != nil {
+		return err
+	}
+	if c14nMethod.attr("Algorithm") != excC14NTransform {
+		return fmt.Errorf("unsupported canonicalization method %q", c14nMethod.attr("Algorithm"))
+	}
+	signatureMethod, err := signedInfo.childElement(xmldsigNamespace, "SignatureMethod")
+	if err != nil {
+		return err
+	}
+	hash, ok := xmldsigSignatureHashes[signatureMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", signatureMethod.attr("Algorithm"))
+	}
+	signatureValue, err := signature.childElement(xmldsigNamespace, "SignatureValue")
+	if err != nil {
+		return err
+	}
+	value, err := decodeXMLBase64(signatureValue.text())
+	if err != nil {
+		return fmt.Errorf("could not decode signature value: %v", err)
+	}
+
+	canonical, err := canonicalize(signedInfo, nil, inclusivePrefixList(c14nMethod))
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(canonical)
+	digest := h.Sum(nil)
+
+	for _, certificate := range certificates {
+		key, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(key, hash, digest, value) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature does not match the certificates of the identity provider")
+}
+
+// inclusivePrefixList returns the prefixes of the InclusiveNamespaces of an
+// exclusive canonicalization algorithm
+func inclusivePrefixList(algorithm *xmlElement) string {
+	for _, el := range algorithm.childElements(excC14NNamespace, inclusiveNamespaces) {
+		return el.attr("PrefixList")
+	}
+	return ""
+}
+
+// decodeXMLBase64 decodes base64 content, which may be wrapped over several
+// lines
+func decodeXMLBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer(
+		"&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer(
+		"&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// exclusiveCanonicalizer writes the exclusive canonical form, without
+// comments, of an element, as defined by
+// https://www.w3.org/TR/xml-exc-c14n/
+type exclusiveCanonicalizer struct {
+	buf bytes.Buffer
+	// exclude is an element left out, such as an enveloped signature
+	exclude *xmlElement
+	// inclusive are the prefixes of the InclusiveNamespaces PrefixList, which
+	// are rendered as in inclusive canonicalization. The default namespace is
+	// the empty prefix.
+	inclusive []string
+}
+
+// canonicalAttr is an attribute with its resolved namespace, which
+// attributes are ordered by
+type canonicalAttr struct {
+	xml.Attr
+	namespace string
+}
+
+// canonicalize returns the exclusive canonical form of the element, leaving
+// out the excluded element
+func canonicalize(e, exclude *xmlElement, prefixList string) ([]byte, error) {
+	c := &exclusiveCanonicalizer{exclude: exclude}
+	for _, prefix := range strings.Fields(prefixList) {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusive = append(c.inclusive, prefix)
+	}
+
+	if err := c.writeElement(e, map[string]string{}); err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+// writeElement writes the element and its descendants. rendered are the
+// namespace declarations already written by the output ancestors of the
+// element.
+func (c *exclusiveCanonicalizer) writeElement(e *xmlElement, rendered map[string]string) error {
+	// Namespaces are only declared where they are visibly utilized, by the
+	// name of the element or its attributes
+	utilized := map[string]bool{e.name.Space: true}
+	attrs := []canonicalAttr{}
+	for _, attr := range e.attrs {
+		if isNamespaceDeclaration(attr) {
+			continue
+		}
+		namespace := ""
+		if attr.Name.Space != "" {
+			var ok bool
+			if namespace, ok = e.namespace(attr.Name.Space); !ok {
+				return fmt.Errorf("undeclared namespace prefix %q", attr.Name.Space)
+			}
+			utilized[attr.Name.Space] = true
+		}
+		attrs = append(attrs, canonicalAttr{Attr: attr, namespace: namespace})
+	}
+	for _, prefix := range c.inclusive {
+		if _, ok := e.namespace(prefix); ok {
+			utilized[prefix] = true
+		}
+	}
+
+	scope := make(map[string]string, len(rendered))
+	for prefix, namespace := range rendered {
+		scope[prefix] = namespace
+	}
+	declarations := []string{}
+	for prefix := range utilized {
+		if prefix == "xml" {
+			continue
+		}
+		namespace, ok := e.namespace(prefix)
+		if !ok && prefix != "" {
+			return fmt.Errorf("undeclared namespace prefix %q", prefix)
+		}
+		if current, ok := rendered[prefix]; (ok && current == namespace) || (!ok && prefix == "" && namespace == "") {
+			continue
+		}
+		scope[prefix] = namespace
+		declarations = append(declarations, prefix)
+	}
+	sort.Strings(declarations)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].namespace != attrs[j].namespace {
+			return attrs[i].namespace < attrs[j].namespace
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	c.buf.WriteString("<" + qualifiedName(e.name))
+	for _, prefix := range declarations {
+		if prefix == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + prefix + `="`)
+		}
+		c14nAttrEscaper.WriteString(&c.buf, scope[prefix])
+		c.buf.WriteString(`"`)
+	}
+	for _, attr := range attrs {
+		c.buf.WriteString(" " + qualifiedName(attr.Name) + `="`)
+		c14nAttrEscaper.WriteString(&c.buf, attr.Value)
+		c.buf.WriteString(`"`)
+	}
+	c.buf.WriteString(">")
+
+	for _, child := range e.children {
+		switch child := child.(type) {
+		case *xmlElement:
+			if child == c.exclude {
+				continue
+			}
+			if err := c.writeElement(child, scope); err != nil {
+				return err
+			}
+		case xml.CharData:
+			c14nTextEscaper.WriteString(&c.buf, string(child))
+		}
+	}
+
+	c.buf.WriteString("</" + qualifiedName(e.name) + ">")
+	return nil
+}
@@ -0,0 +1,392 @@
+package providers
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	samlTestEntityID = "https://proxy.example.com/"
+	samlTestCallback = "https://proxy.example.com/oauth2/callback"
+
+	// samlTestCertificate is the certificate of the key the test responses
+	// are signed with
+	samlTestCertificate = `-----BEGIN CERTIFICATE-----
+MIIDFzCCAf+gAwIBAgIUWTOResXX0A7Xhk1bDzLyzqSQY8AwDQYJKoZIhvcNAQEL
+BQAwGjEYMBYGA1UEAwwPaWRwLmV4YW1wbGUuY29tMCAXDTI2MTAxNjE3MjkxMloY
+DzIxMjYwOTIyMTcyOTEyWjAaMRgwFgYDVQQDDA9pZHAuZXhhbXBsZS5jb20wggEi
+MA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQC02W+IIMWNyWvcZ7Uis2G13/0b
+BSDeDcLDdbOCylWV+04TDqDjYVaHk48sf56AzUmm41wKadZ8LU4ezBYDZXTkFI5r
+lMB/n4EhG8vtA1G6/KJezmg93DGk8olEXWG/pyzRERBpGtRZhYiYjH2Pmuy18ytC
+c8eN79ipqGJ7Ae6xym+6/64a7TL117teMqpdbet0ec7q1BwauI6fdAK7YlAbkcGe
++B1mtb5IO0mfNijffz4IPqmjCbuu0kFUSezDYywXtTQk1ZWEAxQY9HG/DzLW6nWb
+lQTaS8CeLYqWrEbx/SpGnMvFAxlEEqDZaqUjgmUmEiLRNHxIxy8RUauLcCINAgMB
+AAGjUzBRMB0GA1UdDgQWBBRx4KyDrfeCSwwVC6i8pCTdyeuM4DAfBgNVHSMEGDAW
+gBRx4KyDrfeCSwwVC6i8pCTdyeuM4DAPBgNVHRMBAf8EBTADAQH/MA0GCSqGSIb3
+DQEBCwUAA4IBAQBn7Iem/9oFO2BiHMnP5q+TCwMqmFfE7rrK2nKek+WvgocCmX+g
+jSceMAfnRDSUmQkUKc5SnPSVUXtMd4y6LVGywTuLXBzM307+7tZIYB6TErglujib
+p/0LvfCMcBez/O5jGRdwRGQwnuj07sz8Ei1Infcp3REKH+vi/0+YkKQdhXLTxqF4
+mXpkuRJD/tKlcMGJNK/coPwoBKNMrSXq6xWyjFjyVVO5Zphmf029fX9Xyw1uj5V7
+9kl1uW5T+dXka0/XYCfQaRKc4Ihe9monpaIPVcPwyV0gZh8dFV52r7bLMF+RoWM8
+4njydTduh9CBSF73ntL8JPO1eAABQV7TCV9X
+-----END CERTIFICATE-----`
+
+	// samlTestAssertionSignedResponse is a response whose assertion is
+	// signed, with an InclusiveNamespaces prefix list, by xmlsec
+	samlTestAssertionSignedResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="_response1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z" Destination="https://proxy.example.com/oauth2/callback" InResponseTo="id-1">
+  <saml:Issuer>https://idp.example.com/</saml:Issuer>
+  <samlp:Status>
+    <samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+  </samlp:Status>
+  <saml:Assertion ID="_assertion1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z">
+    <saml:Issuer>https://idp.example.com/</saml:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#_assertion1"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>5JCBOs2TIfeC1zprZGBsvGmJ5eNiWjEAqSDOoaUUyIs=</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>b1nfKorpkHzX80pjod4G8e9O8fvZlh0qclJR9IJkfVPKJVtHD/ugfm8TtdMH0nGl
+E4wbRCItNMdxXP5E05nzpytVw8SI7Aa3EYP4oFHlqHmdJ3/TTv9pdiULMVnt5RR4
+hQgTQ+ngMy3PtqjOTw9u/vpNohiJs1PJTsR+6OG/ydzBQCJg1Y8ZhhgaDMVXNIJY
+X5MxOrzaDkWM41UgWIHuLqSvPGcCVrxm9DUdbATScGtPxprSs6GmSje89UizkI5N
+kKUassvIUKicjl25WXVQpmfHRixIlbdbYVCPVW8p9cxyLJ+XGt2vx0nmyVZ4mK0I
+7nNfXZSSk/Vgb8rDPhordQ==</ds:SignatureValue></ds:Signature>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">jdoe</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData NotOnOrAfter="2024-05-01T10:05:00Z" Recipient="https://proxy.example.com/oauth2/callback" InResponseTo="id-1"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotOnOrAfter="2024-05-01T10:05:00Z" NotBefore="2024-05-01T09:59:00Z">
+      <saml:AudienceRestriction>
+        <saml:Audience>https://proxy.example.com/</saml:Audience>
+      </saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:Advice><Extra xmlns="urn:example:extra" b="2" a="1">R&amp;D &lt;x&gt;<Nested xmlns="">text</Nested></Extra></saml:Advice>
+    <saml:AuthnStatement SessionNotOnOrAfter="2024-05-01T18:00:00Z" SessionIndex="_session1" AuthnInstant="2024-05-01T10:00:00Z">
+      <saml:AuthnContext>
+        <saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef>
+      </saml:AuthnContext>
+    </saml:AuthnStatement>
+    <saml:AttributeStatement>
+      <saml:Attribute NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:basic" Name="email">
+        <saml:AttributeValue xsi:type="xs:string">jdoe@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/claims/Group" FriendlyName="groups">
+        <saml:AttributeValue xsi:type="xs:string">admins</saml:AttributeValue>
+        <saml:AttributeValue xsi:type="xs:string">R&amp;D</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="displayName" FriendlyName="Display &quot;name&quot;">
+        <saml:AttributeValue>Jane Doe</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+	// samlTestResponseSignedResponse is a response that is signed as a whole,
+	// by xmlsec
+	samlTestResponseSignedResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="_response1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z" Destination="https://proxy.example.com/oauth2/callback" InResponseTo="id-1">
+  <saml:Issuer>https://idp.example.com/</saml:Issuer><ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#_response1"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>jGKremMATkwN04HbCUlo7UkZCcD2SP/pigzhUdgl61o=</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>G3+F+xbgBX9x0FDKLJ7XE7Rp9KD+0ln69Xywchl4g38RQI6zm9qbwTgaHJFlRsjv
+PgPpsaTmNyXAEp4hm/PJ0bRjvKpzWe+UA/TZnX8k1pOFHM/RHbbF5AX2kqa50Nu9
+Jj58Fd4X1uwXCab17N5uDKgqJs8cVjnqRYwI/TaeVUaYATq0Zfff1st2E/2cWBZ8
+fMDVtwGwU+9DTOkXDvb2de85yzLLpDeLZ5YbAdhMHbqkbt2Txq/+Y6r4qhq6X/hB
+aE5ENr8rHSlc1G+6254HhXKcu2vgIuROJV9eqMqKkgWGvH1SE+/yzvAlme5/5HyP
+kll8Vy/JEvymQmisoc1ecA==</ds:SignatureValue></ds:Signature>
+  <samlp:Status>
+    <samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+  </samlp:Status>
+  <saml:Assertion ID="_assertion1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z">
+    <saml:Issuer>https://idp.example.com/</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">jdoe</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData NotOnOrAfter="2024-05-01T10:05:00Z" Recipient="https://proxy.example.com/oauth2/callback" InResponseTo="id-1"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotOnOrAfter="2024-05-01T10:05:00Z" NotBefore="2024-05-01T09:59:00Z">
+      <saml:AudienceRestriction>
+        <saml:Audience>https://proxy.example.com/</saml:Audience>
+      </saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:Advice><Extra xmlns="urn:example:extra" b="2" a="1">R&amp;D &lt;x&gt;<Nested xmlns="">text</Nested></Extra></saml:Advice>
+    <saml:AuthnStatement SessionNotOnOrAfter="2024-05-01T18:00:00Z" SessionIndex="_session1" AuthnInstant="2024-05-01T10:00:00Z">
+      <saml:AuthnContext>
+        <saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef>
+      </saml:AuthnContext>
+    </saml:AuthnStatement>
+    <saml:AttributeStatement>
+      <saml:Attribute NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:basic" Name="email">
+        <saml:AttributeValue xsi:type="xs:string">jdoe@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/claims/Group" FriendlyName="groups">
+        <saml:AttributeValue xsi:type="xs:string">admins</saml:AttributeValue>
+        <saml:AttributeValue xsi:type="xs:string">R&amp;D</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="displayName" FriendlyName="Display &quot;name&quot;">
+        <saml:AttributeValue>Jane Doe</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+)
+
+// samlTestNow is within the validity period of the test responses
+var samlTestNow = time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC)
+
+func writeSAMLTestFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func testSAMLProvider(t *testing.T, opts options.SAMLOptions) *SAMLProvider {
+	if len(opts.IdPCertificateFiles) == 0 {
+		opts.IdPCertificateFiles = []string{writeSAMLTestFile(t, "idp.pem", []byte(samlTestCertificate))}
+	}
+	p, err := NewSAMLProvider(&ProviderData{
+		ClientID: samlTestEntityID,
+		LoginURL: &url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+	}, opts)
+	require.NoError(t, err)
+	return p
+}
+
+func encodeSAMLTestResponse(response string) string {
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
+
+// decodeSAMLTestRequest inflates the request of a HTTP-Redirect binding URL
+func decodeSAMLTestRequest(t *testing.T, u *url.URL) string {
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+	return string(request)
+}
+
+func TestNewSAMLProvider(t *testing.T) {
+	p := testSAMLProvider(t, options.SAMLOptions{})
+	assert.Equal(t, "SAML", p.Data().ProviderName)
+	assert.Equal(t, "email", p.emailAttribute)
+	assert.Equal(t, "groups", p.groupsAttribute)
+	assert.Len(t, p.certificates, 1)
+
+	_, err := NewSAMLProvider(&ProviderData{}, options.SAMLOptions{})
+	assert.EqualError(t, err, "could not configure SAML provider: no identity provider certificates are configured")
+
+	_, err = NewSAMLProvider(&ProviderData{}, options.SAMLOptions{
+		IdPCertificateFiles: []string{writeSAMLTestFile(t, "idp.pem", []byte("not a certificate"))},
+	})
+	assert.ErrorContains(t, err, "no certificates found in")
+}
+
+func TestSAMLProviderRedeem(t *testing.T) {
+	testCases := map[string]string{
+		"signed assertion": samlTestAssertionSignedResponse,
+		"signed response":  samlTestResponseSignedResponse,
+	}
+	for name, response := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p := testSAMLProvider(t, options.SAMLOptions{
+				IdPEntityID:                "https://idp.example.com/",
+				PreferredUsernameAttribute: "displayName",
+			})
+
+			assertion, err := p.verifyResponse(encodeSAMLTestResponse(response), samlTestCallback, samlTestNow)
+			require.NoError(t, err)
+			s, err := p.createSession(assertion)
+			require.NoError(t, err)
+
+			assert.Equal(t, "jdoe", s.User)
+			assert.Equal(t, "jdoe@example.com", s.Email)
+			assert.Equal(t, "Jane Doe", s.PreferredUsername)
+			assert.Equal(t, []string{"admins", "R&D"}, s.Groups)
+			assert.Equal(t, map[string]string{
+				"email": "jdoe@example.com",
+				"http://schemas.xmlsoap.org/claims/Group": "admins,R&D",
+				"displayName": "Jane Doe",
+			}, s.Attributes)
+			assert.Equal(t, time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC), *s.ExpiresOn)
+
+			// Each assertion signs a user in once
+			_, err = p.verifyResponse(encodeSAMLTestResponse(response), samlTestCallback, samlTestNow)
+			assert.EqualError(t, err, "assertion has been used before")
+		})
+	}
+
+	p := testSAMLProvider(t, options.SAMLOptions{})
+	_, err := p.Redeem(context.Background(), samlTestCallback, "", "")
+	assert.Equal(t, ErrMissingCode, err)
+}
+
+func TestSAMLProviderVerifyResponse(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherCertificate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "other.example.com"},
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &otherKey.PublicKey, otherKey)
+	require.NoError(t, err)
+
+	// wrapped moves the signed assertion into the advice of an assertion for
+	// another user, with the same ID and a copy of its signature
+	signatureStart := strings.Index(samlTestAssertionSignedResponse, "<ds:Signature")
+	signatureEnd := strings.Index(samlTestAssertionSignedResponse, "</ds:Signature>") + len("</ds:Signature>")
+	signature := samlTestAssertionSignedResponse[signatureStart:signatureEnd]
+	wrapped := strings.Replace(samlTestAssertionSignedResponse, "<saml:Assertion ",
+		`<saml:Assertion ID="_assertion1" Version="2.0" IssueInstant="2024-05-01T10:00:00Z">`+signature+
+			`<saml:Subject><saml:NameID>admin</saml:NameID></saml:Subject><saml:Advice><saml:Assertion `, 1)
+	wrapped = strings.Replace(wrapped, "</saml:Assertion>", "</saml:Assertion></saml:Advice></saml:Assertion>", 1)
+
+	testCases := map[string]struct {
+		response      string
+		opts          options.SAMLOptions
+		entityID      string
+		redirectURL   string
+		now           time.Time
+		expectedError string
+	}{
+		"tampered assertion": {
+			response:      strings.Replace(samlTestAssertionSignedResponse, ">jdoe<", ">admin<", 1),
+			expectedError: "could not verify signature: digest of the signed element does not match",
+		},
+		"tampered response": {
+			response:      strings.Replace(samlTestResponseSignedResponse, ">jdoe<", ">admin<", 1),
+			expectedError: "could not verify signature: digest of the signed element does not match",
+		},
+		"other identity provider": {
+			response: samlTestAssertionSignedResponse,
+			opts: options.SAMLOptions{IdPCertificateFiles: []string{writeSAMLTestFile(t, "other.pem",
+				pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCertificate}))}},
+			expectedError: "could not verify signature: signature does not match the certificates of the identity provider",
+		},
+		"wrapped assertion": {
+			response:      wrapped,
+			expectedError: "could not verify signature: signed Assertion must have a unique ID",
+		},
+		"unsigned assertion": {
+			response:      strings.Replace(samlTestAssertionSignedResponse, signature, "", 1),
+			expectedError: "could not verify signature: expected one Signature element in Assertion, found 0",
+		},
+		"issuer": {
+			response:      samlTestAssertionSignedResponse,
+			opts:          options.SAMLOptions{IdPEntityID: "https://other.example.com/"},
+			expectedError: `assertion is issued by "https://idp.example.com/" rather than "https://other.example.com/"`,
+		},
+		"audience": {
+			response:      samlTestAssertionSignedResponse,
+			entityID:      "https://other.example.com/",
+			expectedError: `assertion is not intended for audience "https://other.example.com/"`,
+		},
+		"recipient": {
+			response:      samlTestAssertionSignedResponse,
+			redirectURL:   "https://other.example.com/oauth2/callback",
+			expectedError: `response is destined to "https://proxy.example.com/oauth2/callback" rather than "https://other.example.com/oauth2/callback"`,
+		},
+		"expired": {
+			response:      samlTestAssertionSignedResponse,
+			now:           samlTestNow.Add(time.Hour),
+			expectedError: "assertion has expired",
+		},
+		"not valid yet": {
+			response:      samlTestAssertionSignedResponse,
+			now:           samlTestNow.Add(-time.Hour),
+			expectedError: "assertion is not valid yet",
+		},
+		"error status": {
+			response: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_response2" Version="2.0"><samlp:Status>` +
+				`<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Responder"><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:RequestDenied"/></samlp:StatusCode>` +
+				`<samlp:StatusMessage>User is not assigned to the application</samlp:StatusMessage></samlp:Status></samlp:Response>`,
+			expectedError: "identity provider responded with status urn:oasis:names:tc:SAML:2.0:status:Responder (urn:oasis:names:tc:SAML:2.0:status:RequestDenied): User is not assigned to the application",
+		},
+		"doctype": {
+			response:      `<?xml version="1.0"?><!DOCTYPE Response [<!ENTITY x "x">]><Response/>`,
+			expectedError: "could not parse XML: directives are not allowed",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p := testSAMLProvider(t, tc.opts)
+			if tc.entityID != "" {
+				p.ClientID = tc.entityID
+			}
+			redirectURL := samlTestCallback
+			if tc.redirectURL != "" {
+				redirectURL = tc.redirectURL
+			}
+			now := samlTestNow
+			if !tc.now.IsZero() {
+				now = tc.now
+			}
+
+			_, err := p.verifyResponse(encodeSAMLTestResponse(tc.response), redirectURL, now)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestSAMLProviderGetLoginURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := writeSAMLTestFile(t, "sp.pem", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	p := testSAMLProvider(t, options.SAMLOptions{
+		NameIDFormat:   samlEmailNameIDFormat,
+		SigningKeyFile: keyFile,
+	})
+	loginURL, err := url.Parse(p.GetLoginURL(samlTestCallback, "state", "nonce", url.Values{"prompt": []string{"login"}}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "idp.example.com", loginURL.Host)
+	assert.Equal(t, "state", loginURL.Query().Get("RelayState"))
+	request := decodeSAMLTestRequest(t, loginURL)
+	assert.Contains(t, request, `AssertionConsumerServiceURL="https://proxy.example.com/oauth2/callback"`)
+	assert.Contains(t, request, `ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"`)
+	assert.Contains(t, request, `ForceAuthn="true"`)
+	assert.Contains(t, request, `<Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">https://proxy.example.com/</Issuer>`)
+	assert.Contains(t, request, `<NameIDPolicy xmlns="urn:oasis:names:tc:SAML:2.0:protocol" Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress" AllowCreate="true"></NameIDPolicy>`)
+
+	// The signature covers the parameters as they are encoded in the URL
+	assert.Equal(t, rsaSHA256Signature, loginURL.Query().Get("SigAlg"))
+	signed := loginURL.RawQuery[:strings.Index(loginURL.RawQuery, "&Signature=")]
+	signature, err := base64.StdEncoding.DecodeString(loginURL.Query().Get("Signature"))
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(signed))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+}
+
+func TestSAMLProviderSignOutURL(t *testing.T) {
+	p := testSAMLProvider(t, options.SAMLOptions{})
+	assert.Equal(t, "", p.SignOutURL(&sessions.SessionState{User: "jdoe"}, "https://app.example.com/"))
+
+	p = testSAMLProvider(t, options.SAMLOptions{LogoutURL: "https://idp.example.com/slo"})
+	assert.Equal(t, "", p.SignOutURL(&sessions.SessionState{}, "https://app.example.com/"))
+
+	signOutURL, err := url.Parse(p.SignOutURL(&sessions.SessionState{User: "jdoe"}, "https://app.example.com/"))
+	require.NoError(t, err)
+	assert.Equal(t, "/slo", signOutURL.Path)
+	assert.Equal(t, "https://app.example.com/", signOutURL.Query().Get("RelayState"))
+	assert.Empty(t, signOutURL.Query().Get("Signature"))
+	request := decodeSAMLTestRequest(t, signOutURL)
+	assert.Contains(t, request, `<LogoutRequest xmlns="urn:oasis:names:tc:SAML:2.0:protocol"`)
+	assert.Contains(t, request, `<NameID xmlns="urn:oasis:names:tc:SAML:2.0:assertion">jdoe</NameID>`)
+}
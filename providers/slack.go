@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// SlackProvider represents a Slack based Identity Provider, signing users in
+// with Sign in with Slack
+type SlackProvider struct {
+	*ProviderData
+}
+
+var _ Provider = (*SlackProvider)(nil)
+
+const (
+	slackProviderName    = "Slack"
+	slackDefaultScope    = "openid email profile"
+	slackWorkspacePrefix = "workspace:"
+)
+
+var (
+	// Default Login URL for Slack.
+	// Pre-parsed URL of https://slack.com/openid/connect/authorize.
+	slackDefaultLoginURL = &url.URL{
+		Scheme: "https",
+		Host:   "slack.com",
+		Path:   "/openid/connect/authorize",
+	}
+
+	// Default Redeem URL for Slack.
+	// Pre-parsed URL of https://slack.com/api/openid.connect.token.
+	slackDefaultRedeemURL = &url.URL{
+		Scheme: "https",
+		Host:   "slack.com",
+		Path:   "/api/openid.connect.token",
+	}
+
+	// Default Profile URL for Slack.
+	// Pre-parsed URL of https://slack.com/api/openid.connect.userInfo.
+	slackDefaultProfileURL = &url.URL{
+		Scheme: "https",
+		Host:   "slack.com",
+		Path:   "/api/openid.connect.userInfo",
+	}
+)
+
+// NewSlackProvider initiates a new SlackProvider
+func NewSlackProvider(p *ProviderData, opts options.SlackOptions) *SlackProvider {
+	p.setProviderDefaults(providerDefaults{
+		name:        slackProviderName,
+		loginURL:    slackDefaultLoginURL,
+		redeemURL:   slackDefaultRedeemURL,
+		profileURL:  slackDefaultProfileURL,
+		validateURL: slackDefaultProfileURL,
+		scope:       slackDefaultScope,
+	})
+	p.getAuthorizationHeaderFunc = makeOIDCHeader
+
+	provider := &SlackProvider{ProviderData: p}
+	provider.setAllowedWorkspaces(opts.Workspaces)
+	return provider
+}
+
+// setAllowedWorkspaces adds the workspaces to the AllowedGroups list. Users
+// are asked to sign in to the workspace when it is the only one.
+func (p *SlackProvider) setAllowedWorkspaces(workspaces []string) {
+	if len(workspaces) == 0 {
+		return
+	}
+	if p.AllowedGroups == nil {
+		p.AllowedGroups = make(map[string]struct{})
+	}
+	for _, workspace := range workspaces {
+		p.AllowedGroups[slackWorkspacePrefix+workspace] = struct{}{}
+	}
+
+	if len(workspaces) == 1 && len(p.loginURLParameterDefaults["team"]) == 0 {
+		if p.loginURLParameterDefaults == nil {
+			p.loginURLParameterDefaults = url.Values{}
+		}
+		p.loginURLParameterDefaults.Set("team", workspaces[0])
+	}
+}
+
+// slackUserInfo is the response of the userinfo endpoint. Slack responds to
+// failed API calls with `ok` false rather than an error status.
+type slackUserInfo struct {
+	OK            bool   `json:"ok"`
+	Error         string `json:"error"`
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	TeamID        string `json:"https://slack.com/team_id"`
+}
+
+// Redeem exchanges the code for the access token of the user
+func (p *SlackProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
+	return redeemOAuth2Code(ctx, p.ProviderData, redirectURL, code, codeVerifier)
+}
+
+// EnrichSession sets the user, email and, as a group, the workspace the user
+// signed in to
+func (p *SlackProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
+	userinfo, err := p.getUserInfo(ctx, s.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	if !p.AllowUnverifiedEmail && !userinfo.EmailVerified {
+		return errors.New("user email is not verified")
+	}
+	s.User = userinfo.Sub
+	s.Email = userinfo.Email
+	s.PreferredUsername = userinfo.Name
+	s.Groups = nil
+	if userinfo.TeamID != "" {
+		s.Groups = []string{slackWorkspacePrefix + userinfo.TeamID}
+	}
+	return nil
+}
+
+// getUserInfo requests the claims of the user from the userinfo endpoint
+func (p *SlackProvider) getUserInfo(ctx context.Context, accessToken string) (*slackUserInfo, error) {
+	// https://api.slack.com/methods/openid.connect.userInfo
+	var userinfo slackUserInfo
+	err := requests.New(p.ProfileURL.String()).
+		WithContext(ctx).
+		WithHeaders(makeOIDCHeader(accessToken)).
+		Do().
+		UnmarshalInto(&userinfo)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user info: %v", err)
+	}
+	if !userinfo.OK {
+		return nil, fmt.Errorf("error getting user info: %s", userinfo.Error)
+	}
+	return &userinfo, nil
+}
+
+// ValidateSession validates the AccessToken. The userinfo endpoint is called
+// rather than only checking the status of the response, which is successful
+// for invalid tokens too.
+func (p *SlackProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
+	if s.AccessToken == "" {
+		return false
+	}
+	if _, err := p.getUserInfo(ctx, s.AccessToken); err != nil {
+		logger.Errorf("token validation request failed: %v", err)
+		return false
+	}
+	return true
+}
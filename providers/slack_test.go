@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSlackProvider(hostname string, opts options.SlackOptions) *SlackProvider {
+	p := NewSlackProvider(
+		&ProviderData{
+			ProviderName: "",
+			LoginURL:     &url.URL{},
+			RedeemURL:    &url.URL{},
+			ProfileURL:   &url.URL{},
+			ValidateURL:  &url.URL{},
+			Scope:        ""},
+		opts)
+	if hostname != "" {
+		updateURL(p.Data().LoginURL, hostname)
+		updateURL(p.Data().RedeemURL, hostname)
+		updateURL(p.Data().ProfileURL, hostname)
+		updateURL(p.Data().ValidateURL, hostname)
+	}
+	return p
+}
+
+// testSlackBackend responds to unauthorized requests successfully, with `ok`
+// false, like Slack does
+func testSlackBackend(payload string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/openid.connect.userInfo" {
+				w.WriteHeader(404)
+			} else if !IsAuthorizedInHeader(r.Header) {
+				w.WriteHeader(200)
+				w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			} else {
+				w.WriteHeader(200)
+				w.Write([]byte(payload))
+			}
+		}))
+}
+
+func TestNewSlackProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	// Test that defaults are set when calling for a new provider with nothing set
+	providerData := NewSlackProvider(&ProviderData{}, options.SlackOptions{}).Data()
+	g.Expect(providerData.ProviderName).To(Equal("Slack"))
+	g.Expect(providerData.LoginURL.String()).To(Equal("https://slack.com/openid/connect/authorize"))
+	g.Expect(providerData.RedeemURL.String()).To(Equal("https://slack.com/api/openid.connect.token"))
+	g.Expect(providerData.ProfileURL.String()).To(Equal("https://slack.com/api/openid.connect.userInfo"))
+	g.Expect(providerData.ValidateURL.String()).To(Equal("https://slack.com/api/openid.connect.userInfo"))
+	g.Expect(providerData.Scope).To(Equal("openid email profile"))
+}
+
+func TestSlackProviderWorkspaces(t *testing.T) {
+	p := testSlackProvider("", options.SlackOptions{Workspaces: []string{"T0123"}})
+	assert.Equal(t, map[string]struct{}{"workspace:T0123": {}}, p.Data().AllowedGroups)
+	assert.Equal(t, url.Values{"team": []string{"T0123"}}, p.Data().LoginURLParams(nil))
+
+	p = testSlackProvider("", options.SlackOptions{Workspaces: []string{"T0123", "T0456"}})
+	assert.Len(t, p.Data().AllowedGroups, 2)
+	assert.Empty(t, p.Data().LoginURLParams(nil))
+}
+
+func TestSlackProviderEnrichSession(t *testing.T) {
+	b := testSlackBackend(`{"ok":true,"sub":"U0R7JM","https://slack.com/user_id":"U0R7JM","https://slack.com/team_id":"T0123",` +
+		`"email":"krane@slack-corp.com","email_verified":true,"name":"krane"}`)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testSlackProvider(bURL.Host, options.SlackOptions{Workspaces: []string{"T0123"}})
+
+	session := CreateAuthorizedSession()
+	require.NoError(t, p.EnrichSession(context.Background(), session))
+	assert.Equal(t, "U0R7JM", session.User)
+	assert.Equal(t, "krane@slack-corp.com", session.Email)
+	assert.Equal(t, "krane", session.PreferredUsername)
+	assert.Equal(t, []string{"workspace:T0123"}, session.Groups)
+
+	authorized, err := p.Authorize(context.Background(), session)
+	assert.NoError(t, err)
+	assert.True(t, authorized)
+
+	err = p.EnrichSession(context.Background(), &sessions.SessionState{AccessToken: "unexpected_access_token"})
+	assert.EqualError(t, err, "error getting user info: invalid_auth")
+}
+
+func TestSlackProviderValidateSession(t *testing.T) {
+	b := testSlackBackend(`{"ok":true,"sub":"U0R7JM"}`)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testSlackProvider(bURL.Host, options.SlackOptions{})
+
+	assert.True(t, p.ValidateSession(context.Background(), CreateAuthorizedSession()))
+	assert.False(t, p.ValidateSession(context.Background(), &sessions.SessionState{AccessToken: "unexpected_access_token"}))
+}
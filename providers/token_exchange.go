@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ExchangeToken exchanges the access token of the session at the token
+// endpoint of the provider for an access token issued for the audience, and
+// the scopes when given, as specified by RFC 8693 OAuth 2.0 Token Exchange.
+// Providers that exchange tokens their own way set the exchangeTokenFunc.
+func (p *ProviderData) ExchangeToken(ctx context.Context, s *sessions.SessionState, audience string, scopes []string) (*oauth2.Token, error) {
+	if p.exchangeTokenFunc != nil {
+		return p.exchangeTokenFunc(ctx, s, audience, scopes)
+	}
+	if s == nil || s.AccessToken == "" {
+		return nil, errors.New("session has no access token to exchange")
+	}
+	clientSecret, err := p.GetClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("grant_type", tokenExchangeGrantType)
+	params.Add("client_id", p.ClientID)
+	params.Add("client_secret", clientSecret)
+	params.Add("subject_token", s.AccessToken)
+	params.Add("subject_token_type", accessTokenType)
+	params.Add("requested_token_type", accessTokenType)
+	params.Add("audience", audience)
+	if len(scopes) > 0 {
+		params.Add("scope", strings.Join(scopes, " "))
+	}
+
+	var jsonResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = requests.New(p.RedeemURL.String()).
+		WithContext(ctx).
+		WithMethod("POST").
+		WithBody(bytes.NewBufferString(params.Encode())).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		Do().
+		UnmarshalInto(&jsonResponse)
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange the access token for audience %q: %v", audience, err)
+	}
+	if jsonResponse.AccessToken == "" {
+		return nil, fmt.Errorf("no access token found exchanging the access token for audience %q", audience)
+	}
+
+	token := &oauth2.Token{
+		AccessToken: jsonResponse.AccessToken,
+		TokenType:   jsonResponse.TokenType,
+	}
+	if jsonResponse.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(jsonResponse.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
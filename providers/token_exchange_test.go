@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeToken(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		form = req.PostForm
+		if form.Get("audience") != "api://upstream" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`{"error":"invalid_target"}`))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"access_token":"exchanged","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer server.Close()
+
+	redeemURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	p := &ProviderData{
+		RedeemURL:    redeemURL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}
+	session := &sessions.SessionState{AccessToken: "subject"}
+
+	token, err := p.ExchangeToken(context.Background(), session, "api://upstream", []string{"read", "write"})
+	require.NoError(t, err)
+	assert.Equal(t, "exchanged", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.WithinDuration(t, time.Now().Add(300*time.Second), token.Expiry, 10*time.Second)
+	assert.Equal(t, url.Values{
+		"grant_type":           []string{"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"client_id":            []string{"client"},
+		"client_secret":        []string{"secret"},
+		"subject_token":        []string{"subject"},
+		"subject_token_type":   []string{"urn:ietf:params:oauth:token-type:access_token"},
+		"requested_token_type": []string{"urn:ietf:params:oauth:token-type:access_token"},
+		"audience":             []string{"api://upstream"},
+		"scope":                []string{"read write"},
+	}, form)
+
+	_, err = p.ExchangeToken(context.Background(), session, "api://other", nil)
+	assert.ErrorContains(t, err, "could not exchange the access token for audience \"api://other\"")
+
+	_, err = p.ExchangeToken(context.Background(), &sessions.SessionState{}, "api://upstream", nil)
+	assert.EqualError(t, err, "session has no access token to exchange")
+}
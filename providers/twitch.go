@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
+)
+
+// TwitchProvider represents a Twitch based Identity Provider
+type TwitchProvider struct {
+	*ProviderData
+}
+
+var _ Provider = (*TwitchProvider)(nil)
+
+const (
+	twitchProviderName = "Twitch"
+	twitchDefaultScope = "user:read:email"
+)
+
+var (
+	// Default Login URL for Twitch.
+	// Pre-parsed URL of https://id.twitch.tv/oauth2/authorize.
+	twitchDefaultLoginURL = &url.URL{
+		Scheme: "https",
+		Host:   "id.twitch.tv",
+		Path:   "/oauth2/authorize",
+	}
+
+	// Default Redeem URL for Twitch.
+	// Pre-parsed URL of https://id.twitch.tv/oauth2/token.
+	twitchDefaultRedeemURL = &url.URL{
+		Scheme: "https",
+		Host:   "id.twitch.tv",
+		Path:   "/oauth2/token",
+	}
+
+	// Default Profile URL for Twitch.
+	// Pre-parsed URL of https://api.twitch.tv/helix/users.
+	twitchDefaultProfileURL = &url.URL{
+		Scheme: "https",
+		Host:   "api.twitch.tv",
+		Path:   "/helix/users",
+	}
+
+	// Default Validation URL for Twitch.
+	// Pre-parsed URL of https://id.twitch.tv/oauth2/validate.
+	twitchDefaultValidateURL = &url.URL{
+		Scheme: "https",
+		Host:   "id.twitch.tv",
+		Path:   "/oauth2/validate",
+	}
+)
+
+// NewTwitchProvider initiates a new TwitchProvider
+func NewTwitchProvider(p *ProviderData) *TwitchProvider {
+	p.setProviderDefaults(providerDefaults{
+		name:        twitchProviderName,
+		loginURL:    twitchDefaultLoginURL,
+		redeemURL:   twitchDefaultRedeemURL,
+		profileURL:  twitchDefaultProfileURL,
+		validateURL: twitchDefaultValidateURL,
+		scope:       twitchDefaultScope,
+	})
+
+	provider := &TwitchProvider{ProviderData: p}
+	p.getAuthorizationHeaderFunc = provider.makeTwitchHeader
+	return provider
+}
+
+// makeTwitchHeader returns the headers of Twitch API requests, which must
+// name the client the access token was issued to
+func (p *TwitchProvider) makeTwitchHeader(accessToken string) http.Header {
+	return makeAuthorizationHeader(tokenTypeBearer, accessToken, map[string]string{
+		"Client-Id": p.ClientID,
+	})
+}
+
+// Redeem exchanges the code for the access and refresh tokens of the user
+func (p *TwitchProvider) Redeem(ctx context.Context, redirectURL, code, codeVerifier string) (*sessions.SessionState, error) {
+	return redeemOAuth2Code(ctx, p.ProviderData, redirectURL, code, codeVerifier)
+}
+
+// EnrichSession sets the user and email of the session
+func (p *TwitchProvider) EnrichSession(ctx context.Context, s *sessions.SessionState) error {
+	// https://dev.twitch.tv/docs/api/reference/#get-users
+	var users struct {
+		Data []struct {
+			ID          string `json:"id"`
+			Login       string `json:"login"`
+			DisplayName string `json:"display_name"`
+			Email       string `json:"email"`
+		} `json:"data"`
+	}
+	err := requests.New(p.ProfileURL.String()).
+		WithContext(ctx).
+		WithHeaders(p.makeTwitchHeader(s.AccessToken)).
+		Do().
+		UnmarshalInto(&users)
+	if err != nil {
+		return fmt.Errorf("error getting user info: %v", err)
+	}
+	if len(users.Data) == 0 {
+		return errors.New("no user found for the access token")
+	}
+
+	user := users.Data[0]
+	if user.Email == "" {
+		return errors.New("twitch user has no email")
+	}
+	s.User = user.Login
+	s.Email = user.Email
+	s.PreferredUsername = user.DisplayName
+	return nil
+}
+
+// RefreshSession refreshes the access token of the session
+func (p *TwitchProvider) RefreshSession(ctx context.Context, s *sessions.SessionState) (bool, error) {
+	if s == nil || s.RefreshToken == "" {
+		return false, nil
+	}
+
+	if err := refreshOAuth2Token(ctx, p.ProviderData, s); err != nil {
+		return false, fmt.Errorf("unable to redeem refresh token: %v", err)
+	}
+	return true, nil
+}
+
+// ValidateSession validates the AccessToken with the validation endpoint,
+// which Twitch requires access tokens to be validated with hourly
+func (p *TwitchProvider) ValidateSession(ctx context.Context, s *sessions.SessionState) bool {
+	return validateToken(ctx, p, s.AccessToken, makeAuthorizationHeader("OAuth", s.AccessToken, nil))
+}
@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTwitchProvider(hostname string) *TwitchProvider {
+	p := NewTwitchProvider(
+		&ProviderData{
+			ProviderName: "",
+			ClientID:     "twitch-client",
+			LoginURL:     &url.URL{},
+			RedeemURL:    &url.URL{},
+			ProfileURL:   &url.URL{},
+			ValidateURL:  &url.URL{},
+			Scope:        ""})
+	if hostname != "" {
+		updateURL(p.Data().LoginURL, hostname)
+		updateURL(p.Data().RedeemURL, hostname)
+		updateURL(p.Data().ProfileURL, hostname)
+		updateURL(p.Data().ValidateURL, hostname)
+	}
+	return p
+}
+
+func testTwitchBackend(payload string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/helix/users":
+				if !IsAuthorizedInHeader(r.Header) || r.Header.Get("Client-Id") != "twitch-client" {
+					w.WriteHeader(401)
+					return
+				}
+				w.WriteHeader(200)
+				w.Write([]byte(payload))
+			case "/oauth2/validate":
+				if r.Header.Get("Authorization") != "OAuth "+authorizedAccessToken {
+					w.WriteHeader(401)
+					return
+				}
+				w.WriteHeader(200)
+				w.Write([]byte(`{"client_id":"twitch-client","login":"twitchdev","expires_in":5520838}`))
+			case "/oauth2/token":
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(200)
+				w.Write([]byte(`{"access_token":"` + authorizedAccessToken + `","refresh_token":"rotated","expires_in":14124,"scope":["user:read:email"],"token_type":"bearer"}`))
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+}
+
+func TestNewTwitchProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	// Test that defaults are set when calling for a new provider with nothing set
+	providerData := NewTwitchProvider(&ProviderData{}).Data()
+	g.Expect(providerData.ProviderName).To(Equal("Twitch"))
+	g.Expect(providerData.LoginURL.String()).To(Equal("https://id.twitch.tv/oauth2/authorize"))
+	g.Expect(providerData.RedeemURL.String()).To(Equal("https://id.twitch.tv/oauth2/token"))
+	g.Expect(providerData.ProfileURL.String()).To(Equal("https://api.twitch.tv/helix/users"))
+	g.Expect(providerData.ValidateURL.String()).To(Equal("https://id.twitch.tv/oauth2/validate"))
+	g.Expect(providerData.Scope).To(Equal("user:read:email"))
+}
+
+func TestTwitchProviderEnrichSession(t *testing.T) {
+	b := testTwitchBackend(`{"data":[{"id":"141981764","login":"twitchdev","display_name":"TwitchDev","email":"dev@twitch.tv"}]}`)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testTwitchProvider(bURL.Host)
+
+	session := CreateAuthorizedSession()
+	require.NoError(t, p.EnrichSession(context.Background(), session))
+	assert.Equal(t, "twitchdev", session.User)
+	assert.Equal(t, "dev@twitch.tv", session.Email)
+	assert.Equal(t, "TwitchDev", session.PreferredUsername)
+
+	err := p.EnrichSession(context.Background(), &sessions.SessionState{AccessToken: "unexpected_access_token"})
+	assert.ErrorContains(t, err, "error getting user info")
+}
+
+func TestTwitchProviderRefreshAndValidateSession(t *testing.T) {
+	b := testTwitchBackend(`{"data":[]}`)
+	defer b.Close()
+
+	bURL, _ := url.Parse(b.URL)
+	p := testTwitchProvider(bURL.Host)
+
+	session := &sessions.SessionState{AccessToken: "expired", RefreshToken: "refresh"}
+	assert.False(t, p.ValidateSession(context.Background(), session))
+
+	refreshed, err := p.RefreshSession(context.Background(), session)
+	require.NoError(t, err)
+	assert.True(t, refreshed)
+	assert.Equal(t, authorizedAccessToken, session.AccessToken)
+	assert.Equal(t, "rotated", session.RefreshToken)
+	assert.True(t, p.ValidateSession(context.Background(), session))
+}
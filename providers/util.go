@@ -43,6 +43,10 @@ func makeLoginURL(p *ProviderData, redirectURI, state string, extraParams url.Va
 	params.Set("response_type", "code")
 	params.Add("state", state)
 	for n, p := range extraParams {
+		// A scope parameter replaces the scope of the provider
+		if n == "scope" {
+			params.Del(n)
+		}
 		for _, v := range p {
 			params.Add(n, v)
 		}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+)
+
+// reapSessionsCommand is the subcommand that reaps the expired and orphaned
+// sessions of the session store once, without running the proxy
+const reapSessionsCommand = "reap-sessions"
+
+// runReapSessions runs the reap-sessions subcommand with its arguments and
+// returns the exit code of the command
+func runReapSessions(args []string) int {
+	flagSet := newOptionsFlagSet(reapSessionsCommand)
+	if code, ok := flagSet.parse(args); !ok {
+		return code
+	}
+
+	opts, ss, err := loadSessionStore(flagSet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	reaper, ok := ss.(sessionsapi.SessionReaper)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "the %s session store does not hold sessions to reap\n", opts.Session.Type)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := reaper.ReapSessions(ctx)
+	fmt.Printf("Reaped %d expired and %d orphaned sessions\n", result.Expired, result.Orphaned)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not reap sessions: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loadSessionStore loads and validates the configuration, and creates the
+// session store it configures
+func loadSessionStore(flagSet *optionsFlagSet) (*options.Options, sessionsapi.SessionStore, error) {
+	opts, err := flagSet.loadOptions()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load config: %v", err)
+	}
+	if err := validation.Validate(opts); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	// Validation redirects the logs to the log file of the configuration
+	logger.SetOutput(os.Stderr)
+
+	ss, err := sessions.NewSessionStore(&opts.Session, &opts.Cookie)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create the session store: %v", err)
+	}
+	return opts, ss, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
+)
+
+// reloader serves the requests with an OAuthProxy built from the latest
+// configuration. When the configuration is reloaded, on SIGHUP or when one
+// of the config files changes, a new OAuthProxy replaces the current one.
+// Requests already being served finish with the OAuthProxy they started
+// with, and the servers keep listening throughout.
+type reloader struct {
+	// load loads the configuration from the flags and config files
+	load  func() (*options.Options, error)
+	files []string
+
+	proxy  atomic.Pointer[OAuthProxy]
+	server proxyhttp.Server
+	state  *processState
+
+	// The following are only accessed by the goroutine running Start
+	opts           *options.Options
+	validatorDone  chan bool
+	stopBackground context.CancelFunc
+	reloads        chan struct{}
+}
+
+// newReloader creates a reloader serving the requests with an OAuthProxy
+// built from the options, reloading the options with load. The background
+// servers run alongside the servers, and may request reloads.
+func newReloader(opts *options.Options, load func() (*options.Options, error), files []string, background ...proxyhttp.Server) (*reloader, error) {
+	r := &reloader{
+		load:    load,
+		files:   files,
+		reloads: make(chan struct{}, 1),
+		state:   newProcessState(),
+	}
+
+	injectProviderFaults(opts)
+	proxy, validatorDone, err := buildReloadedProxy(opts, r.state)
+	if err != nil {
+		return nil, err
+	}
+	r.proxy.Store(proxy)
+	r.opts = opts
+	r.validatorDone = validatorDone
+
+	var adminHandler http.Handler
+	if proxy.adminHandler != nil {
+		adminHandler = http.HandlerFunc(r.serveAdmin)
+	}
+	server, err := buildServer(opts, r, adminHandler, append([]proxyhttp.Server{r}, background...)...)
+	if err != nil {
+		return nil, err
+	}
+	r.server = server
+	return r, nil
+}
+
+// buildReloadedProxy builds an OAuthProxy sharing the process state, with an
+// emails validator that stops watching the authenticated emails file, or
+// polling their URL, once done is closed
+func buildReloadedProxy(opts *options.Options, state *processState) (*OAuthProxy, chan bool, error) {
+	if opts.AuthenticatedEmailsFile != "" {
+		// The emails validator exits when it cannot read the file, which
+		// must not happen when reloading a running proxy
+		if _, err := os.Stat(opts.AuthenticatedEmailsFile); err != nil {
+			return nil, nil, fmt.Errorf("invalid authenticated emails file: %v", err)
+		}
+	}
+
+	done := make(chan bool)
+	validator := newValidatorFromOptions(opts, done, func() {})
+	proxy, err := newOAuthProxy(opts, validator, state)
+	if err != nil {
+		close(done)
+		return nil, nil, err
+	}
+	return proxy, done, nil
+}
+
+// ServeHTTP serves the request with the current OAuthProxy
+func (r *reloader) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.proxy.Load().ServeHTTP(rw, req)
+}
+
+// serveAdmin serves the admin API with the current OAuthProxy
+func (r *reloader) serveAdmin(rw http.ResponseWriter, req *http.Request) {
+	r.proxy.Load().adminHandler.ServeHTTP(rw, req)
+}
+
+// Run runs the servers until the process is interrupted or terminated
+func (r *reloader) Run() error {
+	return startServer(r.server)
+}
+
+// Start runs the background tasks of the current OAuthProxy and reloads the
+// configuration when requested, until the context is cancelled.
+// It implements the Server interface so that it runs alongside the servers.
+func (r *reloader) Start(ctx context.Context) error {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	done := make(chan bool)
+	defer close(done)
+	for _, file := range r.files {
+		if err := watcher.WatchFileForUpdates(file, done, r.requestReload); err != nil {
+			logger.Errorf("Error watching config file for reloads: %v", err)
+		}
+	}
+
+	r.startBackground(ctx, r.proxy.Load())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			logger.Printf("Received SIGHUP, reloading the configuration")
+			r.reload(ctx)
+		case <-r.reloads:
+			r.reload(ctx)
+		}
+	}
+}
+
+// requestReload requests a reload of the configuration. Requests made while
+// a reload is pending are merged into it.
+func (r *reloader) requestReload() {
+	select {
+	case r.reloads <- struct{}{}:
+	default:
+	}
+}
+
+// reload loads and validates the configuration and replaces the current
+// OAuthProxy with one built from it. The current OAuthProxy is kept if the
+// configuration is invalid.
+func (r *reloader) reload(ctx context.Context) {
+	opts, err := r.load()
+	if err != nil {
+		logger.Errorf("Error reloading the configuration: %v", err)
+		return
+	}
+	if err := validation.Validate(opts); err != nil {
+		logger.Errorf("Error reloading the configuration: %v", err)
+		return
+	}
+	if err := verifyReloadable(r.opts, opts); err != nil {
+		logger.Errorf("Error reloading the configuration: %v", err)
+		return
+	}
+
+	proxy, validatorDone, err := buildReloadedProxy(opts, r.state)
+	if err != nil {
+		logger.Errorf("Error reloading the configuration: %v", err)
+		return
+	}
+	injectProviderFaults(opts)
+
+	previous := r.proxy.Swap(proxy)
+	r.startBackground(ctx, proxy)
+	close(r.validatorDone)
+	r.validatorDone = validatorDone
+	r.opts = opts
+	previous.stop()
+
+	logger.Printf("Reloaded the configuration")
+}
+
+// startBackground runs the background tasks of the proxy, stopping those of
+// the proxy it replaces
+func (r *reloader) startBackground(ctx context.Context, proxy *OAuthProxy) {
+	if r.stopBackground != nil {
+		r.stopBackground()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.stopBackground = cancel
+	go func() {
+		if err := proxyhttp.NewServerGroup(proxy.backgroundServers()...).Start(ctx); err != nil {
+			logger.Errorf("Error running background tasks: %v", err)
+		}
+	}()
+}
+
+// rotatedCookieSecret returns whether the cookie secret was rotated by its
+// secret reference, keeping the current secret as the previous one so that
+// existing sessions are kept
+func rotatedCookieSecret(current, updated *options.Options) bool {
+	previous := updated.Cookie.Previous()
+	return updated.Cookie.SecretRef != "" && previous != nil && previous.Secret == current.Cookie.Secret
+}
+
+// verifyReloadable returns an error when the updated options change the
+// listeners of the servers, or would invalidate the existing sessions, which
+// requires a restart
+func verifyReloadable(current, updated *options.Options) error {
+	switch {
+	case !reflect.DeepEqual(current.Server, updated.Server),
+		!reflect.DeepEqual(current.AdminServer, updated.AdminServer),
+		!reflect.DeepEqual(current.ACME, updated.ACME),
+		current.AllowQuerySemicolons != updated.AllowQuerySemicolons,
+		current.UpstreamLogout.ClientCAFile != updated.UpstreamLogout.ClientCAFile:
+		return errors.New("the server options cannot be changed without a restart")
+	case !reflect.DeepEqual(current.MetricsServer, updated.MetricsServer):
+		return errors.New("the metrics server options cannot be changed without a restart")
+	case current.Cookie.Name != updated.Cookie.Name,
+		current.Cookie.Secret != updated.Cookie.Secret && !rotatedCookieSecret(current, updated),
+		current.Cookie.SigningSecret != updated.Cookie.SigningSecret,
+		current.Cookie.KeyDerivation != updated.Cookie.KeyDerivation:
+		return errors.New("the cookie name and secrets cannot be changed without a restart, as existing sessions would be lost")
+	case !reflect.DeepEqual(current.Session, updated.Session):
+		return errors.New("the session store options cannot be changed without a restart, as existing sessions would be lost")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Configuration Reloading Suite", func() {
+	var staticCode int
+	var cookieSecret string
+	var skipAuthRoute string
+	var loadErr error
+	var r *reloader
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	// load builds the options serving the static code on any path, without
+	// authentication
+	load := func() (*options.Options, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		opts := baseTestOptions()
+		opts.Cookie.Secret = cookieSecret
+		opts.SignedState = true
+		opts.SkipAuthRoutes = []string{skipAuthRoute}
+		code := staticCode
+		opts.UpstreamServers = options.UpstreamConfig{
+			Upstreams: []options.Upstream{{ID: "static", Path: "/", Static: true, StaticCode: &code}},
+		}
+		return opts, nil
+	}
+
+	serve := func() int {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+		return rw.Code
+	}
+
+	BeforeEach(func() {
+		staticCode = http.StatusOK
+		cookieSecret = rawCookieSecret
+		skipAuthRoute = "^/"
+		loadErr = nil
+
+		opts, err := load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validation.Validate(opts)).To(Succeed())
+
+		r, err = newReloader(opts, load, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serve()).To(Equal(http.StatusOK))
+
+		ctx, cancel = context.WithCancel(context.Background())
+		r.startBackground(ctx, r.proxy.Load())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("serves the requests with the reloaded configuration", func() {
+		staticCode = http.StatusAccepted
+		r.reload(ctx)
+		Expect(serve()).To(Equal(http.StatusAccepted))
+	})
+
+	It("closes the session store of the replaced proxy", func() {
+		previous := r.proxy.Load()
+		store := &closingSessionStore{SessionStore: previous.sessionStore}
+		previous.sessionStore = store
+
+		r.reload(ctx)
+		Expect(r.proxy.Load()).ToNot(BeIdenticalTo(previous))
+		Expect(store.closed).To(BeTrue())
+	})
+
+	It("keeps the used states across reloads", func() {
+		usedStates := r.proxy.Load().usedStates
+		Expect(usedStates).ToNot(BeNil())
+
+		r.reload(ctx)
+		Expect(r.proxy.Load().usedStates).To(BeIdenticalTo(usedStates))
+	})
+
+	It("keeps the configuration when it fails to load", func() {
+		staticCode = http.StatusAccepted
+		loadErr = errors.New("failed to load config")
+		r.reload(ctx)
+		Expect(serve()).To(Equal(http.StatusOK))
+	})
+
+	It("keeps the configuration when it would lose the existing sessions", func() {
+		staticCode = http.StatusAccepted
+		cookieSecret = "0123456789abcdefghijklmnopqrstuv"
+		r.reload(ctx)
+		Expect(serve()).To(Equal(http.StatusOK))
+	})
+
+	It("accepts a cookie secret rotated by its secret reference", func() {
+		updated, err := load()
+		Expect(err).ToNot(HaveOccurred())
+		updated.Cookie.Secret = "0123456789abcdefghijklmnopqrstuv"
+		updated.Cookie.SecretRef = "vault://secret/data/oauth2-proxy#cookie-secret"
+		Expect(verifyReloadable(r.opts, updated)).ToNot(Succeed())
+
+		updated.Cookie.SetPreviousSecret(r.opts.Cookie.Secret)
+		Expect(verifyReloadable(r.opts, updated)).To(Succeed())
+	})
+
+	It("keeps the configuration when it is invalid", func() {
+		staticCode = http.StatusAccepted
+		skipAuthRoute = "^/("
+		r.reload(ctx)
+		Expect(serve()).To(Equal(http.StatusOK))
+	})
+})
+
+// closingSessionStore records whether the session store it wraps is closed
+type closingSessionStore struct {
+	sessionsapi.SessionStore
+	closed bool
+}
+
+func (s *closingSessionStore) Close() error {
+	s.closed = true
+	return nil
+}
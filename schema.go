@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/spf13/pflag"
+)
+
+// alphaConfigSchemaCommand is the subcommand that prints the JSON Schema of
+// the alpha configuration
+const alphaConfigSchemaCommand = "alpha-config-schema"
+
+// runAlphaConfigSchema runs the alpha-config-schema subcommand with its
+// arguments and returns the exit code of the command
+func runAlphaConfigSchema(args []string) int {
+	flagSet := pflag.NewFlagSet("oauth2-proxy alpha-config-schema", pflag.ContinueOnError)
+	outFile := flagSet.String("out-file", "", "the file to write the schema to, instead of stdout")
+
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	schema, err := options.GenerateJSONSchema(&options.AlphaOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not generate the schema: %v\n", err)
+		return 1
+	}
+	schema = append(schema, '\n')
+
+	if *outFile != "" {
+		err = os.WriteFile(*outFile, schema, 0644)
+	} else {
+		_, err = os.Stdout.Write(schema)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write the schema: %v\n", err)
+		return 1
+	}
+	return 0
+}
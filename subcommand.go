@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/spf13/pflag"
+)
+
+// optionsFlagSet is the flag set of a subcommand that loads the options of
+// the proxy, with the --config and --alpha-config flags. The options of the
+// proxy may be given as flags too, alongside the flags of the subcommand.
+type optionsFlagSet struct {
+	*pflag.FlagSet
+
+	config      *string
+	alphaConfig *string
+	args        []string
+}
+
+// newOptionsFlagSet creates the flag set of the subcommand with the name,
+// which the subcommand adds its own flags to before parsing its arguments
+func newOptionsFlagSet(name string) *optionsFlagSet {
+	flagSet := pflag.NewFlagSet("oauth2-proxy "+name, pflag.ContinueOnError)
+	flagSet.ParseErrorsWhitelist.UnknownFlags = true
+
+	return &optionsFlagSet{
+		FlagSet:     flagSet,
+		config:      flagSet.String("config", "", "path to config file"),
+		alphaConfig: flagSet.String("alpha-config", "", "path to alpha config file"),
+	}
+}
+
+// parse parses the arguments of the subcommand. It returns false with the
+// exit code of the subcommand when help was asked for or the arguments are
+// invalid.
+func (f *optionsFlagSet) parse(args []string) (int, bool) {
+	if err := f.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	f.args = args
+	return 0, true
+}
+
+// loadOptions loads the options of the proxy from the config files and the
+// arguments parsed
+func (f *optionsFlagSet) loadOptions() (*options.Options, error) {
+	return loadConfiguration(*f.config, *f.alphaConfig, f.FlagSet, f.args)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subcommand Options Suite", func() {
+	It("loads the options of the proxy given alongside the flags of the subcommand", func() {
+		flagSet := newOptionsFlagSet("test")
+		output := flagSet.String("output", "text", "the format of the output")
+
+		code, ok := flagSet.parse([]string{"--output=json", "--client-id=client", "--email-domain=example.com"})
+		Expect(ok).To(BeTrue())
+		Expect(code).To(Equal(0))
+		Expect(*output).To(Equal("json"))
+
+		opts, err := flagSet.loadOptions()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(opts.Providers[0].ClientID).To(Equal("client"))
+		Expect(opts.EmailDomains).To(ConsistOf("example.com"))
+	})
+
+	It("exits successfully when help is asked for", func() {
+		code, ok := newOptionsFlagSet("test").parse([]string{"--help"})
+		Expect(ok).To(BeFalse())
+		Expect(code).To(Equal(0))
+	})
+
+	It("exits with a usage error when the flags are invalid", func() {
+		code, ok := newOptionsFlagSet("test").parse([]string{"--config"})
+		Expect(ok).To(BeFalse())
+		Expect(code).To(Equal(2))
+	})
+})
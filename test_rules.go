@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	sessionsapi "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/sessions"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/identity"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+)
+
+// testRulesCommand is the subcommand that evaluates a table of requests
+// against the routing and authorization rules of a configuration
+const testRulesCommand = "test-rules"
+
+// The outcomes of a request evaluated against the rules
+const (
+	// ruleSkip means authentication is skipped for the request
+	ruleSkip = "skip"
+	// ruleAllow means the request is proxied with the session of the user
+	ruleAllow = "allow"
+	// ruleAnonymous means the request is proxied without a session
+	ruleAnonymous = "anonymous"
+	// ruleLogin means the user is sent to sign in
+	ruleLogin = "login"
+	// ruleUnauthorized means the request is denied with a 401 response
+	ruleUnauthorized = "unauthorized"
+	// ruleForbidden means the session of the user fails authorization
+	ruleForbidden = "forbidden"
+)
+
+// defaultRuleClientIP is the IP address requests are made from when their
+// case does not set one, from the documentation range of RFC 5737
+const defaultRuleClientIP = "192.0.2.1"
+
+// ruleCases is the format of the cases file of the test-rules subcommand
+type ruleCases struct {
+	Cases []ruleCase `json:"cases"`
+}
+
+// ruleCase is a request and the outcome expected for it
+type ruleCase struct {
+	// Name describes the case in the results, defaulting to the method and
+	// path of the request
+	Name string `json:"name,omitempty"`
+
+	// Method, Host and Path are the request line of the case.
+	// Method defaults to GET and Host to localhost.
+	Method string `json:"method,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path"`
+
+	// ClientIP is the IP address the request is made from, defaulting to
+	// 192.0.2.1
+	ClientIP string `json:"clientIP,omitempty"`
+
+	// User, Email and Groups describe the session of the request.
+	// Requests without a user or email have no session.
+	User   string   `json:"user,omitempty"`
+	Email  string   `json:"email,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Provider is the ID of the provider the user signed in with, defaulting
+	// to the first provider
+	Provider string `json:"provider,omitempty"`
+	// Bearer is set when the session is loaded from a bearer token rather
+	// than the session cookie
+	Bearer bool `json:"bearer,omitempty"`
+
+	// Expect is the expected outcome: one of skip, allow, anonymous, login,
+	// unauthorized or forbidden
+	Expect string `json:"expect"`
+}
+
+// name returns the name of the case in the results
+func (c ruleCase) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s %s%s", c.method(), c.Host, c.Path)
+}
+
+func (c ruleCase) method() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(c.Method)
+}
+
+// session returns the session of the case, if it has one
+func (c ruleCase) session() *sessionsapi.SessionState {
+	if c.User == "" && c.Email == "" {
+		return nil
+	}
+	return &sessionsapi.SessionState{
+		User:       c.User,
+		Email:      c.Email,
+		Groups:     c.Groups,
+		ProviderID: c.Provider,
+	}
+}
+
+// runTestRules runs the test-rules subcommand with its arguments and returns
+// the exit code of the command
+func runTestRules(args []string) int {
+	flagSet := newOptionsFlagSet(testRulesCommand)
+	casesFile := flagSet.String("cases", "", "path to the YAML file of the requests to evaluate and their expected outcomes")
+	if code, ok := flagSet.parse(args); !ok {
+		return code
+	}
+	if *casesFile == "" {
+		fmt.Fprintln(os.Stderr, "--cases is required")
+		flagSet.PrintDefaults()
+		return 2
+	}
+
+	opts, err := flagSet.loadOptions()
+	if err != nil {
+		logger.Errorf("ERROR: %v", err)
+		return 2
+	}
+	if err := validation.Validate(opts); err != nil {
+		logger.Errorf("%s", err)
+		return 2
+	}
+
+	cases, err := loadRuleCases(*casesFile)
+	if err != nil {
+		logger.Errorf("ERROR: %v", err)
+		return 2
+	}
+
+	tester, err := newRuleTester(opts, newValidatorFromOptions(opts, nil, func() {}))
+	if err != nil {
+		logger.Errorf("ERROR: %v", err)
+		return 2
+	}
+
+	if failed := tester.run(os.Stdout, cases); failed > 0 {
+		fmt.Printf("%d of %d cases failed\n", failed, len(cases))
+		return 1
+	}
+	return 0
+}
+
+// loadRuleCases reads the cases of the test-rules subcommand from a YAML file
+func loadRuleCases(path string) ([]ruleCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cases: %v", err)
+	}
+
+	cases := ruleCases{}
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("unable to parse cases: %v", err)
+	}
+	for i, c := range cases.Cases {
+		switch c.Expect {
+		case ruleSkip, ruleAllow, ruleAnonymous, ruleLogin, ruleUnauthorized, ruleForbidden:
+		default:
+			return nil, fmt.Errorf("case %d (%s) has unknown expected outcome %q", i, c.name(), c.Expect)
+		}
+	}
+	return cases.Cases, nil
+}
+
+// ruleTester evaluates requests against the routing and authorization rules
+// of the proxy, without its providers, session store or upstreams.
+// Only the allowed groups of the providers are checked: authorization that
+// needs the provider, such as GitHub organization membership, is assumed to
+// pass.
+type ruleTester struct {
+	proxy              *OAuthProxy
+	providers          map[string]*providers.ProviderData
+	defaultProviderID  string
+	realClientIPHeader string
+}
+
+// newRuleTester builds the rules of the proxy from the options
+func newRuleTester(opts *options.Options, validator func(string) bool) (*ruleTester, error) {
+	allowedRoutes, err := buildRoutesAllowlist(opts)
+	if err != nil {
+		return nil, err
+	}
+	apiRoutes, err := buildAPIRoutes(opts)
+	if err != nil {
+		return nil, err
+	}
+	authRoutes, err := buildAuthRoutes(opts)
+	if err != nil {
+		return nil, err
+	}
+	trustedIPs, err := buildTrustedIPs(opts)
+	if err != nil {
+		return nil, err
+	}
+	identityNormalizer, err := identity.NewNormalizer(opts.IdentityNormalization)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &ruleTester{
+		proxy: &OAuthProxy{
+			Validator:          validator,
+			allowedRoutes:      allowedRoutes,
+			apiRoutes:          apiRoutes,
+			authRoutes:         authRoutes,
+			skipAuthPreflight:  opts.SkipAuthPreflight,
+			forceJSONErrors:    opts.ForceJSONErrors,
+			realClientIPParser: opts.GetRealClientIPParser(),
+			trustedIPs:         trustedIPs,
+			identityNormalizer: identityNormalizer,
+			virtualHosts:       make([]virtualHost, 0, len(opts.VirtualHosts)),
+		},
+		providers:          make(map[string]*providers.ProviderData, len(opts.Providers)),
+		defaultProviderID:  opts.Providers[0].ID,
+		realClientIPHeader: opts.RealClientIPHeader,
+	}
+	for _, providerConfig := range opts.Providers {
+		provider := &providers.ProviderData{AllowedGroups: make(map[string]struct{}, len(providerConfig.AllowedGroups))}
+		for _, group := range providerConfig.AllowedGroups {
+			provider.AllowedGroups[group] = struct{}{}
+		}
+		t.providers[providerConfig.ID] = provider
+	}
+	for _, vhostConfig := range opts.VirtualHosts {
+		vhost := virtualHost{
+			hosts:      vhostConfig.Hosts,
+			providerID: vhostConfig.ProviderID,
+		}
+		if len(vhostConfig.AllowedGroups) > 0 {
+			vhost.allowedGroups = make(map[string]struct{}, len(vhostConfig.AllowedGroups))
+			for _, group := range vhostConfig.AllowedGroups {
+				vhost.allowedGroups[group] = struct{}{}
+			}
+		}
+		t.proxy.virtualHosts = append(t.proxy.virtualHosts, vhost)
+	}
+	return t, nil
+}
+
+// run evaluates the cases, writing a line per case to the output, and returns
+// the number of cases that did not have the expected outcome
+func (t *ruleTester) run(out io.Writer, cases []ruleCase) int {
+	failed := 0
+	for _, c := range cases {
+		actual, err := t.evaluate(c)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", c.name(), err)
+		case actual != c.Expect:
+			failed++
+			fmt.Fprintf(out, "FAIL %s: expected %s, got %s\n", c.name(), c.Expect, actual)
+		default:
+			fmt.Fprintf(out, "OK   %s: %s\n", c.name(), actual)
+		}
+	}
+	return failed
+}
+
+// evaluate returns the outcome of the request of the case, following the
+// checks made by getAuthenticatedSession and Proxy
+func (t *ruleTester) evaluate(c ruleCase) (string, error) {
+	req, err := t.newRequest(c)
+	if err != nil {
+		return "", err
+	}
+
+	p := t.proxy
+	if p.IsAllowedRequest(req) {
+		return ruleSkip, nil
+	}
+
+	mode := p.getAuthMode(req)
+	session := c.session()
+	p.identityNormalizer.Normalize(session)
+	if mode == options.AuthModeBearerOnly && !c.Bearer {
+		session = nil
+	}
+
+	providerID := c.Provider
+	if providerID == "" {
+		providerID = t.defaultProviderID
+	}
+	vhost := p.getVirtualHost(req)
+	if vhost != nil && vhost.providerID != "" && vhost.providerID != providerID {
+		session = nil
+	}
+
+	if session == nil {
+		if mode == options.AuthModeOptional {
+			return ruleAnonymous, nil
+		}
+		switch p.getLoginAction(req) {
+		case options.LoginActionUnauthorized:
+			return ruleUnauthorized, nil
+		case options.LoginActionForbidden:
+			return ruleForbidden, nil
+		default:
+			return ruleLogin, nil
+		}
+	}
+
+	provider, ok := t.providers[providerID]
+	if !ok {
+		return "", fmt.Errorf("unknown provider %q", providerID)
+	}
+	authorized, _ := provider.Authorize(req.Context(), session)
+	invalidEmail := session.Email != "" && !p.Validator(session.Email)
+	if invalidEmail || !authorized || (vhost != nil && !vhost.allowsSession(session)) {
+		if mode == options.AuthModeOptional {
+			return ruleAnonymous, nil
+		}
+		return ruleForbidden, nil
+	}
+	return ruleAllow, nil
+}
+
+// newRequest creates the request of the case
+func (t *ruleTester) newRequest(c ruleCase) (*http.Request, error) {
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return nil, fmt.Errorf("path %q must start with /", c.Path)
+	}
+
+	req, err := http.NewRequest(c.method(), (&url.URL{Scheme: "http", Host: host}).String()+c.Path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+
+	clientIP := c.ClientIP
+	if clientIP == "" {
+		clientIP = defaultRuleClientIP
+	}
+	if net.ParseIP(clientIP) == nil {
+		return nil, fmt.Errorf("invalid client IP %q", clientIP)
+	}
+	req.RemoteAddr = net.JoinHostPort(clientIP, "0")
+	if t.proxy.realClientIPParser != nil {
+		req.Header.Set(t.realClientIPHeader, clientIP)
+	}
+	return req, nil
+}
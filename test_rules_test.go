@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rule Testing Suite", func() {
+	var tester *ruleTester
+
+	BeforeEach(func() {
+		opts := options.NewOptions()
+		opts.Providers = options.Providers{
+			{ID: "default", AllowedGroups: []string{"staff"}},
+			{ID: "partners"},
+		}
+		opts.SkipAuthRoutes = []string{"GET=^/public/"}
+		opts.SkipAuthRegex = []string{"^/healthz$"}
+		opts.AuthRoutes = []string{"optional:^/news/", "bearer-only:^/api/v2/"}
+		opts.APIRoutes = []string{"^/api/"}
+		opts.TrustedIPs = []string{"10.0.0.0/8"}
+		opts.VirtualHosts = []options.VirtualHost{
+			{Hosts: []string{"admin.example.com"}, AllowedGroups: []string{"admins"}},
+			{Hosts: []string{"partners.example.com"}, ProviderID: "partners"},
+		}
+
+		var err error
+		tester, err = newRuleTester(opts, func(email string) bool {
+			return email != "blocked@example.com"
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	DescribeTable("evaluate",
+		func(c ruleCase, expected string) {
+			actual, err := tester.evaluate(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("with a skip auth route", ruleCase{Path: "/public/logo.png"}, ruleSkip),
+		Entry("with a skip auth route of another method", ruleCase{Method: "post", Path: "/public/logo.png"}, ruleLogin),
+		Entry("with a skip auth regex", ruleCase{Method: "DELETE", Path: "/healthz"}, ruleSkip),
+		Entry("with a trusted IP", ruleCase{Path: "/", ClientIP: "10.1.2.3"}, ruleSkip),
+		Entry("without a session", ruleCase{Path: "/"}, ruleLogin),
+		Entry("without a session on an API route", ruleCase{Path: "/api/v1/users"}, ruleUnauthorized),
+		Entry("without a session on an optional route", ruleCase{Path: "/news/today"}, ruleAnonymous),
+		Entry("with a session in the allowed groups", ruleCase{Path: "/", User: "alice", Groups: []string{"staff"}}, ruleAllow),
+		Entry("with a session outside the allowed groups", ruleCase{Path: "/", User: "bob", Groups: []string{"guests"}}, ruleForbidden),
+		Entry("with a session outside the allowed groups on an optional route", ruleCase{Path: "/news/today", User: "bob"}, ruleAnonymous),
+		Entry("with an invalid email", ruleCase{Path: "/", Email: "blocked@example.com", Groups: []string{"staff"}}, ruleForbidden),
+		Entry("with a cookie session on a bearer only route", ruleCase{Path: "/api/v2/users", User: "alice", Groups: []string{"staff"}}, ruleUnauthorized),
+		Entry("with a bearer session on a bearer only route", ruleCase{Path: "/api/v2/users", User: "alice", Groups: []string{"staff"}, Bearer: true}, ruleAllow),
+		Entry("with a session outside the groups of the virtual host", ruleCase{Host: "admin.example.com", Path: "/", User: "alice", Groups: []string{"staff"}}, ruleForbidden),
+		Entry("with a session in the groups of the virtual host", ruleCase{Host: "admin.example.com", Path: "/", User: "alice", Groups: []string{"staff", "admins"}}, ruleAllow),
+		Entry("with a session of another provider than the virtual host", ruleCase{Host: "partners.example.com", Path: "/", User: "alice", Groups: []string{"staff"}}, ruleLogin),
+		Entry("with a session of the provider of the virtual host", ruleCase{Host: "partners.example.com", Path: "/", User: "carol", Provider: "partners"}, ruleAllow),
+	)
+
+	It("rejects a case with a relative path", func() {
+		_, err := tester.evaluate(ruleCase{Path: "public"})
+		Expect(err).To(MatchError(`path "public" must start with /`))
+	})
+
+	It("reports the cases that do not have the expected outcome", func() {
+		out := &bytes.Buffer{}
+		failed := tester.run(out, []ruleCase{
+			{Name: "health checks", Path: "/healthz", Expect: ruleSkip},
+			{Path: "/", User: "bob", Expect: ruleAllow},
+		})
+		Expect(failed).To(Equal(1))
+		Expect(out.String()).To(Equal("OK   health checks: skip\nFAIL GET /: expected allow, got forbidden\n"))
+	})
+
+	Context("loadRuleCases", func() {
+		writeCases := func(content string) string {
+			f, err := os.CreateTemp("", "cases-*.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+			_, err = f.WriteString(content)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(os.Remove, f.Name())
+			return f.Name()
+		}
+
+		It("loads the cases", func() {
+			cases, err := loadRuleCases(writeCases(`
+cases:
+- name: admins
+  host: admin.example.com
+  path: /
+  user: alice
+  groups: [admins]
+  expect: allow
+- path: /healthz
+  expect: skip
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cases).To(Equal([]ruleCase{
+				{Name: "admins", Host: "admin.example.com", Path: "/", User: "alice", Groups: []string{"admins"}, Expect: ruleAllow},
+				{Path: "/healthz", Expect: ruleSkip},
+			}))
+		})
+
+		It("rejects an unknown expected outcome", func() {
+			_, err := loadRuleCases(writeCases(`
+cases:
+- path: /
+  expect: redirect
+`))
+			Expect(err).To(MatchError(`case 0 (GET /) has unknown expected outcome "redirect"`))
+		})
+	})
+})
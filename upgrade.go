@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	proxyhttp "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/http"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+)
+
+// upgradeOnSignal upgrades the process to a new copy of its binary when it
+// receives the upgrade signal, and stops the servers of the process once the
+// new process serves their sockets, until the context is cancelled.
+func upgradeOnSignal(ctx context.Context, stop context.CancelFunc) {
+	if proxyhttp.UpgradeSignal == nil {
+		return
+	}
+
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, proxyhttp.UpgradeSignal)
+	defer signal.Stop(upgrade)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-upgrade:
+			logger.Printf("Received SIGUSR2, upgrading the process")
+			if err := proxyhttp.Upgrade(ctx); err != nil {
+				logger.Errorf("Error upgrading the process: %v", err)
+				continue
+			}
+			logger.Printf("The upgraded process is serving, shutting down")
+			stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/util"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/validation"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/providers"
+)
+
+// validateCommand is the subcommand that validates a configuration without
+// running the proxy
+const validateCommand = "validate"
+
+// The checks a configuration goes through, in order
+const (
+	// checkLoad is loading the flags and config files
+	checkLoad = "load"
+	// checkOptions is validating the options
+	checkOptions = "options"
+	// checkCertificates is loading the CA certificates of the providers and
+	// the LDAP server
+	checkCertificates = "certificates"
+	// checkProviders is building the providers, running the OIDC discovery
+	// of their issuers
+	checkProviders = "providers"
+)
+
+// validationReport is the result of validating a configuration
+type validationReport struct {
+	Valid       bool         `json:"valid"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// diagnostic is a problem found in a configuration
+type diagnostic struct {
+	// Check is the check that found the problem
+	Check string `json:"check"`
+	// Provider is the ID of the provider the problem was found in, if any
+	Provider string `json:"provider,omitempty"`
+	Message  string `json:"message"`
+}
+
+// runValidate runs the validate subcommand with its arguments and returns the
+// exit code of the command
+func runValidate(args []string) int {
+	flagSet := newOptionsFlagSet(validateCommand)
+	output := flagSet.String("output", "text", "the format of the diagnostics: text or json")
+	if code, ok := flagSet.parse(args); !ok {
+		return code
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q: expected text or json\n", *output)
+		return 2
+	}
+
+	// Logs must not be mixed with the diagnostics
+	logger.SetOutput(os.Stderr)
+	report := validateConfiguration(flagSet.loadOptions)
+	// Validation redirects the logs to the log file of the configuration
+	logger.SetOutput(os.Stderr)
+
+	if err := report.write(os.Stdout, *output); err != nil {
+		logger.Errorf("ERROR: %v", err)
+		return 2
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// validateConfiguration loads and validates the configuration, checking that
+// the certificates can be loaded and that the providers can be built, which
+// requires the issuers of OIDC providers to be reachable when discovery is
+// enabled. The checks stop at the first one that fails.
+func validateConfiguration(load func() (*options.Options, error)) validationReport {
+	opts, err := load()
+	if err != nil {
+		return invalidReport(diagnostic{Check: checkLoad, Message: err.Error()})
+	}
+
+	if err := validation.Validate(opts); err != nil {
+		var validationErr *validation.Error
+		if !errors.As(err, &validationErr) {
+			return invalidReport(diagnostic{Check: checkOptions, Message: err.Error()})
+		}
+		diagnostics := make([]diagnostic, 0, len(validationErr.Messages))
+		for _, msg := range validationErr.Messages {
+			diagnostics = append(diagnostics, diagnostic{Check: checkOptions, Message: msg})
+		}
+		return invalidReport(diagnostics...)
+	}
+
+	if diagnostics := checkCertificatePools(opts); len(diagnostics) > 0 {
+		return invalidReport(diagnostics...)
+	}
+
+	var diagnostics []diagnostic
+	for _, providerConfig := range opts.Providers {
+		if _, err := providers.NewProvider(providerConfig); err != nil {
+			diagnostics = append(diagnostics, diagnostic{Check: checkProviders, Provider: providerConfig.ID, Message: err.Error()})
+		}
+	}
+	if len(diagnostics) > 0 {
+		return invalidReport(diagnostics...)
+	}
+	return validationReport{Valid: true, Diagnostics: []diagnostic{}}
+}
+
+// checkCertificatePools loads the CA certificates of the providers and the
+// LDAP server
+func checkCertificatePools(opts *options.Options) []diagnostic {
+	var diagnostics []diagnostic
+	for _, providerConfig := range opts.Providers {
+		if len(providerConfig.CAFiles) == 0 {
+			continue
+		}
+		if _, err := util.GetCertPool(providerConfig.CAFiles, providerConfig.UseSystemTrustStore); err != nil {
+			diagnostics = append(diagnostics, diagnostic{
+				Check:    checkCertificates,
+				Provider: providerConfig.ID,
+				Message:  fmt.Sprintf("unable to load provider CA file(s): %v", err),
+			})
+		}
+	}
+	if len(opts.LDAP.CAFiles) > 0 {
+		if _, err := util.GetCertPool(opts.LDAP.CAFiles, false); err != nil {
+			diagnostics = append(diagnostics, diagnostic{
+				Check:   checkCertificates,
+				Message: fmt.Sprintf("unable to load LDAP CA file(s): %v", err),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func invalidReport(diagnostics ...diagnostic) validationReport {
+	return validationReport{Valid: false, Diagnostics: diagnostics}
+}
+
+// write writes the report as text or JSON
+func (r validationReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	for _, d := range r.Diagnostics {
+		prefix := d.Check
+		if d.Provider != "" {
+			prefix += " (provider " + d.Provider + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", prefix, d.Message); err != nil {
+			return err
+		}
+	}
+	if r.Valid {
+		_, err := fmt.Fprintln(w, "configuration is valid")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "configuration is invalid: %d problem(s) found\n", len(r.Diagnostics))
+	return err
+}
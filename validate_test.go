@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Configuration Validation Suite", func() {
+	var opts *options.Options
+	var loadErr error
+
+	BeforeEach(func() {
+		opts = baseTestOptions()
+		loadErr = nil
+	})
+
+	validate := func() validationReport {
+		return validateConfiguration(func() (*options.Options, error) {
+			return opts, loadErr
+		})
+	}
+
+	It("reports a valid configuration", func() {
+		report := validate()
+		Expect(report.Valid).To(BeTrue())
+		Expect(report.Diagnostics).To(BeEmpty())
+	})
+
+	It("reports the errors loading the configuration", func() {
+		loadErr = errors.New("failed to parse flags: unknown flag: --unknown")
+		Expect(validate()).To(Equal(invalidReport(
+			diagnostic{Check: checkLoad, Message: "failed to parse flags: unknown flag: --unknown"},
+		)))
+	})
+
+	It("reports each invalid option", func() {
+		opts.Cookie.Secret = ""
+		opts.EmailDomains = nil
+		report := validate()
+		Expect(report.Valid).To(BeFalse())
+		Expect(report.Diagnostics).To(ContainElements(
+			diagnostic{Check: checkOptions, Message: "missing setting: cookie-secret"},
+			HaveField("Message", HavePrefix("missing setting for email validation")),
+		))
+	})
+
+	It("reports the CA files that cannot be loaded", func() {
+		opts.LDAP.CAFiles = []string{"/does/not/exist.pem"}
+		report := validate()
+		Expect(report.Valid).To(BeFalse())
+		Expect(report.Diagnostics).To(ConsistOf(diagnostic{
+			Check:   checkCertificates,
+			Message: "unable to load LDAP CA file(s): certificate authority file (/does/not/exist.pem) could not be read - open /does/not/exist.pem: no such file or directory",
+		}))
+	})
+
+	It("reports the providers whose issuer cannot be discovered", func() {
+		issuer := httptest.NewServer(nil)
+		issuer.Close()
+		opts.Providers[0].Type = options.OIDCProvider
+		opts.Providers[0].OIDCConfig.IssuerURL = issuer.URL
+
+		report := validate()
+		Expect(report.Valid).To(BeFalse())
+		Expect(report.Diagnostics).To(ConsistOf(SatisfyAll(
+			HaveField("Check", checkProviders),
+			HaveField("Provider", "providerID"),
+			HaveField("Message", ContainSubstring("error building OIDC ProviderVerifier")),
+		)))
+	})
+
+	It("writes the report as JSON", func() {
+		var buf bytes.Buffer
+		report := invalidReport(diagnostic{Check: checkProviders, Provider: "google", Message: "unreachable"})
+		Expect(report.write(&buf, "json")).To(Succeed())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(map[string]interface{}{
+			"valid": false,
+			"diagnostics": []interface{}{
+				map[string]interface{}{"check": "providers", "provider": "google", "message": "unreachable"},
+			},
+		}))
+	})
+
+	It("writes the report as text", func() {
+		var buf bytes.Buffer
+		report := invalidReport(
+			diagnostic{Check: checkOptions, Message: "missing setting: cookie-secret"},
+			diagnostic{Check: checkProviders, Provider: "google", Message: "unreachable"},
+		)
+		Expect(report.write(&buf, "text")).To(Succeed())
+		Expect(buf.String()).To(Equal("options: missing setting: cookie-secret\n" +
+			"providers (provider google): unreachable\n" +
+			"configuration is invalid: 2 problem(s) found\n"))
+	})
+})
@@ -1,21 +1,55 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/apis/options"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/requests"
 	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/watcher"
 )
 
-// UserMap holds information from the authenticated emails file
+const (
+	// authenticatedEmailsFetchTimeout bounds each request to the
+	// authenticated emails URL
+	authenticatedEmailsFetchTimeout = 30 * time.Second
+
+	// authenticatedEmailsMaxSize bounds the size of the authenticated emails
+	// read from the URL
+	authenticatedEmailsMaxSize = 16 << 20
+)
+
+// UserMap holds information from the authenticated emails file or URL
 type UserMap struct {
 	usersFile string
+	usersURL  string
 	m         unsafe.Pointer
+
+	// The validators of the last response from the URL, sent with the next
+	// requests so that an unchanged list is not downloaded again
+	etag         string
+	lastModified string
+}
+
+// userList is the parsed contents of the authenticated emails file.
+// Entries prefixed with ! are denied, and entries containing * or ? are
+// glob patterns.
+type userList struct {
+	allowed         map[string]bool
+	allowedPatterns []*regexp.Regexp
+	denied          map[string]bool
+	deniedPatterns  []*regexp.Regexp
 }
 
 // NewUserMap parses the authenticated emails file into a new UserMap
@@ -23,8 +57,8 @@ type UserMap struct {
 // TODO (@NickMeves): Audit usage of `unsafe.Pointer` and potentially refactor
 func NewUserMap(usersFile string, done <-chan bool, onUpdate func()) *UserMap {
 	um := &UserMap{usersFile: usersFile}
-	m := make(map[string]bool)
-	atomic.StorePointer(&um.m, unsafe.Pointer(&m)) // #nosec G103
+	l := newUserList()
+	atomic.StorePointer(&um.m, unsafe.Pointer(l)) // #nosec G103
 	if usersFile != "" {
 		logger.Printf("using authenticated emails file %s", usersFile)
 		watcher.WatchFileForUpdates(usersFile, done, func() {
@@ -36,11 +70,59 @@ func NewUserMap(usersFile string, done <-chan bool, onUpdate func()) *UserMap {
 	return um
 }
 
-// IsValid checks if an email is allowed
+// NewUserMapFromURL fetches the authenticated emails from the URL into a new
+// UserMap, fetching them again every interval until done is closed.
+// No emails are authenticated until they have been fetched.
+func NewUserMapFromURL(usersURL string, interval time.Duration, done <-chan bool, onUpdate func()) *UserMap {
+	um := &UserMap{usersURL: usersURL}
+	atomic.StorePointer(&um.m, unsafe.Pointer(newUserList())) // #nosec G103
+	logger.Printf("using authenticated emails URL %s", usersURL)
+	if _, err := um.FetchAuthenticatedEmails(); err != nil {
+		logger.Errorf("error fetching authenticated-emails-url=%q, %s", usersURL, err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				updated, err := um.FetchAuthenticatedEmails()
+				if err != nil {
+					logger.Errorf("error fetching authenticated-emails-url=%q, keeping the current emails: %s", usersURL, err)
+					continue
+				}
+				if updated {
+					onUpdate()
+				}
+			}
+		}
+	}()
+	return um
+}
+
+func newUserList() *userList {
+	return &userList{
+		allowed: make(map[string]bool),
+		denied:  make(map[string]bool),
+	}
+}
+
+// IsValid checks if an email is allowed, and not denied
 func (um *UserMap) IsValid(email string) (result bool) {
-	m := *(*map[string]bool)(atomic.LoadPointer(&um.m))
-	_, result = m[email]
-	return
+	l := (*userList)(atomic.LoadPointer(&um.m))
+	if matchesUserList(email, l.denied, l.deniedPatterns) {
+		return false
+	}
+	return matchesUserList(email, l.allowed, l.allowedPatterns)
+}
+
+// IsDenied checks if an email is denied
+func (um *UserMap) IsDenied(email string) bool {
+	l := (*userList)(atomic.LoadPointer(&um.m))
+	return matchesUserList(email, l.denied, l.deniedPatterns)
 }
 
 // LoadAuthenticatedEmailsFile loads the authenticated emails file from disk
@@ -56,27 +138,143 @@ func (um *UserMap) LoadAuthenticatedEmailsFile() {
 			logger.Fatalf("Error closing authenticated emails file: %s", cerr)
 		}
 	}(r)
+	updated, err := parseAuthenticatedEmails(r)
+	if err != nil {
+		logger.Errorf("error reading authenticated-emails-file=%q, %s", um.usersFile, err)
+		return
+	}
+	atomic.StorePointer(&um.m, unsafe.Pointer(updated)) // #nosec G103
+}
+
+// FetchAuthenticatedEmails fetches the authenticated emails from the URL,
+// unless they have not changed since they were last fetched, and returns
+// whether they were updated. The current emails are kept on errors.
+func (um *UserMap) FetchAuthenticatedEmails() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), authenticatedEmailsFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, um.usersURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if um.etag != "" {
+		req.Header.Set("If-None-Match", um.etag)
+	}
+	if um.lastModified != "" {
+		req.Header.Set("If-Modified-Since", um.lastModified)
+	}
+
+	resp, err := requests.DefaultHTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, authenticatedEmailsMaxSize+1))
+	if err != nil {
+		return false, err
+	}
+	if len(body) > authenticatedEmailsMaxSize {
+		// A truncated list could miss denied emails
+		return false, fmt.Errorf("the emails are larger than %d bytes", authenticatedEmailsMaxSize)
+	}
+	updated, err := parseAuthenticatedEmails(bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	atomic.StorePointer(&um.m, unsafe.Pointer(updated)) // #nosec G103
+	um.etag = resp.Header.Get("ETag")
+	um.lastModified = resp.Header.Get("Last-Modified")
+	return true, nil
+}
+
+// parseAuthenticatedEmails parses authenticated emails as CSV
+func parseAuthenticatedEmails(r io.Reader) (*userList, error) {
 	csvReader := csv.NewReader(r)
 	csvReader.Comma = ','
 	csvReader.Comment = '#'
 	csvReader.TrimLeadingSpace = true
 	records, err := csvReader.ReadAll()
 	if err != nil {
-		logger.Errorf("error reading authenticated-emails-file=%q, %s", um.usersFile, err)
-		return
+		return nil, err
 	}
-	updated := make(map[string]bool)
+	updated := newUserList()
 	for _, r := range records {
-		address := strings.ToLower(strings.TrimSpace(r[0]))
-		updated[address] = true
+		address := strings.ToLower(strings.TrimSpace(stripComment(r[0])))
+		addresses, patterns := &updated.allowed, &updated.allowedPatterns
+		if strings.HasPrefix(address, "!") {
+			address = strings.TrimSpace(address[1:])
+			addresses, patterns = &updated.denied, &updated.deniedPatterns
+		}
+		if address == "" {
+			continue
+		}
+		if strings.ContainsAny(address, "*?") {
+			*patterns = append(*patterns, globToRegexp(address))
+			continue
+		}
+		(*addresses)[address] = true
 	}
-	atomic.StorePointer(&um.m, unsafe.Pointer(&updated)) // #nosec G103
+	return updated, nil
+}
+
+// stripComment removes a comment following an entry, which starts with a #
+// after whitespace
+func stripComment(entry string) string {
+	for i := 1; i < len(entry); i++ {
+		if entry[i] == '#' && (entry[i-1] == ' ' || entry[i-1] == '\t') {
+			return entry[:i]
+		}
+	}
+	return entry
+}
+
+// globToRegexp compiles a glob pattern, where * matches any characters and
+// ? matches a single character, into an anchored regexp
+func globToRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// matchesUserList checks if an email is one of the addresses or matches one
+// of the patterns
+func matchesUserList(email string, addresses map[string]bool, patterns []*regexp.Regexp) bool {
+	if addresses[email] {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(email) {
+			return true
+		}
+	}
+	return false
 }
 
 func newValidatorImpl(domains []string, usersFile string,
 	done <-chan bool, onUpdate func()) func(string) bool {
-	validUsers := NewUserMap(usersFile, done, onUpdate)
+	return newValidatorWithUsers(domains, NewUserMap(usersFile, done, onUpdate))
+}
 
+// newValidatorFromOptions constructs the email validator of the options,
+// with the authenticated emails of the file or URL
+func newValidatorFromOptions(opts *options.Options, done <-chan bool, onUpdate func()) func(string) bool {
+	if opts.AuthenticatedEmails.URL != "" {
+		validUsers := NewUserMapFromURL(opts.AuthenticatedEmails.URL, opts.AuthenticatedEmails.RefreshInterval, done, onUpdate)
+		return newValidatorWithUsers(opts.EmailDomains, validUsers)
+	}
+	return newValidatorImpl(opts.EmailDomains, opts.AuthenticatedEmailsFile, done, onUpdate)
+}
+
+func newValidatorWithUsers(domains []string, validUsers *UserMap) func(string) bool {
 	var allowAll bool
 	for i, domain := range domains {
 		if domain == "*" {
@@ -91,6 +289,10 @@ func newValidatorImpl(domains []string, usersFile string,
 			return
 		}
 		email = strings.ToLower(email)
+		// Denied emails are rejected whichever domains are allowed
+		if validUsers.IsDenied(email) {
+			return false
+		}
 		valid = isEmailValidWithDomains(email, domains)
 		if !valid {
 			valid = validUsers.IsValid(email)
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 )
@@ -404,6 +407,76 @@ func TestValidatorCases(t *testing.T) {
 			allowedDomains: []string{"*.company.com"},
 			expectedAuthZ:  false,
 		},
+		{
+			name:           "IgnoreCommentsInAuthEmails",
+			email:          "foo.bar@example.com",
+			allowedEmails:  []string{"# the admins", "foo.bar@example.com # until June"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  true,
+		},
+		{
+			name:           "EmailMatchesGlobInAuthEmails",
+			email:          "foo@team-blue.example.com",
+			allowedEmails:  []string{"*@team-*.example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  true,
+		},
+		{
+			name:           "EmailMatchesSingleCharacterGlobInAuthEmails",
+			email:          "user2@example.com",
+			allowedEmails:  []string{"user?@example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  true,
+		},
+		{
+			name:           "EmailNotMatchingGlobInAuthEmails",
+			email:          "foo@team.example.com",
+			allowedEmails:  []string{"*@team-*.example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "GlobIsAnchoredInAuthEmails",
+			email:          "foo@team-blue.example.com.evil.com",
+			allowedEmails:  []string{"*@team-*.example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "GlobMatchesCharactersLiterallyInAuthEmails",
+			email:          "foo@team-blueXexample.com",
+			allowedEmails:  []string{"*@team-*.example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "DeniedEmailInAuthEmails",
+			email:          "xyzzy@example.com",
+			allowedEmails:  []string{"xyzzy@example.com", "!xyzzy@example.com"},
+			allowedDomains: []string(nil),
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "DeniedEmailInAllowedDomain",
+			email:          "xyzzy@example.com",
+			allowedEmails:  []string{"!xyzzy@example.com"},
+			allowedDomains: []string{"example.com"},
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "DeniedGlobWithAllDomainsAllowed",
+			email:          "foo@contractor.example.com",
+			allowedEmails:  []string{"!*@contractor.example.com"},
+			allowedDomains: []string{"*"},
+			expectedAuthZ:  false,
+		},
+		{
+			name:           "EmailNotDeniedWithAllDomainsAllowed",
+			email:          "foo@example.com",
+			allowedEmails:  []string{"!*@contractor.example.com"},
+			allowedDomains: []string{"*"},
+			expectedAuthZ:  true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -419,3 +492,81 @@ func TestValidatorCases(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatorDenyListUpdate(t *testing.T) {
+	vt := NewValidatorTest(t)
+	defer vt.TearDown()
+
+	g := NewWithT(t)
+	vt.WriteEmails(t, []string{"*@example.com"})
+	updated := make(chan bool)
+	validator := vt.NewValidator([]string(nil), updated)
+	g.Expect(validator("xyzzy@example.com")).To(BeTrue())
+
+	vt.WriteEmails(t, []string{"*@example.com", "!xyzzy@example.com"})
+	<-updated
+
+	g.Expect(validator("xyzzy@example.com")).To(BeFalse())
+	g.Expect(validator("plugh@example.com")).To(BeTrue())
+}
+
+func TestValidatorFromURL(t *testing.T) {
+	g := NewWithT(t)
+
+	emails := "xyzzy@example.com\n"
+	etag := `"v1"`
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("If-None-Match") == etag {
+			notModified++
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("ETag", etag)
+		_, _ = rw.Write([]byte(emails))
+	}))
+	defer server.Close()
+
+	done := make(chan bool)
+	defer close(done)
+	users := NewUserMapFromURL(server.URL, time.Hour, done, func() {})
+	validator := newValidatorWithUsers([]string(nil), users)
+	g.Expect(validator("xyzzy@example.com")).To(BeTrue())
+	g.Expect(validator("plugh@example.com")).To(BeFalse())
+
+	// The list is not downloaded again until it changes
+	updated, err := users.FetchAuthenticatedEmails()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(updated).To(BeFalse())
+	g.Expect(notModified).To(Equal(1))
+
+	emails, etag = "plugh@example.com\n", `"v2"`
+	updated, err = users.FetchAuthenticatedEmails()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(updated).To(BeTrue())
+	g.Expect(validator("xyzzy@example.com")).To(BeFalse())
+	g.Expect(validator("plugh@example.com")).To(BeTrue())
+	g.Expect(requests).To(Equal(3))
+}
+
+func TestValidatorFromURLKeepsEmailsOnError(t *testing.T) {
+	g := NewWithT(t)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(status)
+		_, _ = rw.Write([]byte("xyzzy@example.com\n"))
+	}))
+	defer server.Close()
+
+	done := make(chan bool)
+	defer close(done)
+	users := NewUserMapFromURL(server.URL, time.Hour, done, func() {})
+	g.Expect(users.IsValid("xyzzy@example.com")).To(BeTrue())
+
+	status = http.StatusInternalServerError
+	_, err := users.FetchAuthenticatedEmails()
+	g.Expect(err).To(MatchError("unexpected status 500"))
+	g.Expect(users.IsValid("xyzzy@example.com")).To(BeTrue())
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/logger"
+	internaloidc "github.com/oauth2-proxy/oauth2-proxy/v7/pkg/providers/oidc"
+	"github.com/oauth2-proxy/oauth2-proxy/v7/pkg/verify"
+	"github.com/spf13/pflag"
+)
+
+// verifyHeadersCommand is the subcommand that serves the verification of the
+// headers attached by the proxy to applications on localhost
+const verifyHeadersCommand = "verify-headers"
+
+// verifyHeadersPath is the path the verification requests are posted to
+const verifyHeadersPath = "/verify"
+
+// runVerifyHeaders runs the verify-headers subcommand with its arguments and
+// returns the exit code of the command
+func runVerifyHeaders(args []string) int {
+	flagSet := pflag.NewFlagSet("oauth2-proxy verify-headers", pflag.ContinueOnError)
+
+	address := flagSet.String("http-address", "127.0.0.1:4181", "[http://]<addr>:<port> to listen on for verification requests")
+	signatureKey := flagSet.String("signature-key", os.Getenv("OAUTH2_PROXY_SIGNATURE_KEY"), "GAP-Signature request signature key (algorithm:secretkey) of the proxy (defaults to $OAUTH2_PROXY_SIGNATURE_KEY)")
+	issuerURL := flagSet.String("oidc-issuer-url", "", "the issuer of the ID tokens passed by the proxy in the Authorization header")
+	jwksURL := flagSet.String("oidc-jwks-url", "", "the JWKS URL of the issuer, skipping OIDC discovery")
+	clientID := flagSet.String("client-id", "", "the client ID of the proxy, expected as the audience of the ID tokens")
+
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *signatureKey == "" && *issuerURL == "" {
+		fmt.Fprintln(os.Stderr, "--signature-key or --oidc-issuer-url is required")
+		flagSet.PrintDefaults()
+		return 2
+	}
+
+	opts := verify.Options{SignatureKey: *signatureKey}
+	if *issuerURL != "" {
+		pvOpts := internaloidc.ProviderVerifierOptions{
+			ClientID:      *clientID,
+			IssuerURL:     *issuerURL,
+			JWKsURL:       *jwksURL,
+			SkipDiscovery: *jwksURL != "",
+		}
+		pv, err := internaloidc.NewProviderVerifier(context.Background(), pvOpts)
+		if err != nil {
+			logger.Errorf("ERROR: could not create ID token verifier: %v", err)
+			return 1
+		}
+		opts.TokenVerifier = pv.Verifier()
+	}
+
+	verifier, err := verify.NewVerifier(opts)
+	if err != nil {
+		logger.Errorf("ERROR: %v", err)
+		return 2
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(verifyHeadersPath, verifier)
+	srv := &http.Server{
+		Addr:              strings.TrimPrefix(*address, "http://"),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Printf("Verifying headers on http://%s%s", srv.Addr, verifyHeadersPath)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("ERROR: %v", err)
+		return 1
+	}
+	return 0
+}